@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os/user"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewApproveCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "approve <run-id>",
+		Short: "Approve or reject the approval gate a run waits for",
+		Long: `Decides an approval gate of a run, which resumes it: a tako/approval@v1 step, a child workflow
+whose subscription sets approval_required, or a rollout wave of a fan-out whose rollout sets
+approval_required. The gate is chosen with --step: the ID of the step, the repository:workflow of
+the child, or wave-<n>; it can be left out when the run waits for a single gate. With --reject,
+the step fails, the child is skipped or the rollout is aborted. With --list, the pending gates of
+the run, or of every run, are listed instead.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if list, _ := cmd.Flags().GetBool("list"); list {
+				return cobra.MaximumNArgs(1)(cmd, args)
+			}
+			return cobra.ExactArgs(1)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			gate, _ := cmd.Flags().GetString("step")
+			reject, _ := cmd.Flags().GetBool("reject")
+			reason, _ := cmd.Flags().GetString("reason")
+			list, _ := cmd.Flags().GetBool("list")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			approvals, err := engine.NewApprovalManager(cacheDir)
+			if err != nil {
+				return err
+			}
+
+			if list {
+				var runID string
+				if len(args) > 0 {
+					runID = args[0]
+				}
+				requests, err := approvals.ListApprovals(runID)
+				if err != nil {
+					return err
+				}
+				printPendingApprovals(cmd.OutOrStdout(), requests)
+				return nil
+			}
+
+			runID := args[0]
+			decidedBy := ""
+			if current, err := user.Current(); err == nil {
+				decidedBy = current.Username
+			}
+			decision, err := approvals.Decide(runID, gate, !reject, decidedBy, reason)
+			if err != nil {
+				return fmt.Errorf("failed to decide approval of %s: %v", runID, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Approval %s of %s %s\n", decision.Gate, runID, decision.Status)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("step", "", "Gate to decide: a step ID, a repository:workflow or wave-<n> (default: the only pending gate)")
+	cmd.Flags().Bool("reject", false, "Reject the gate instead of approving it")
+	cmd.Flags().String("reason", "", "Reason recorded with the decision")
+	cmd.Flags().Bool("list", false, "List the pending approval gates instead of deciding one")
+	return cmd
+}
+
+// printPendingApprovals prints the approval gates that are not decided yet.
+func printPendingApprovals(out io.Writer, requests []*engine.ApprovalRequest) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RUN ID\tGATE\tREQUESTED\tDEADLINE\tMESSAGE")
+	for _, request := range requests {
+		if request.Status != engine.ApprovalPending {
+			continue
+		}
+		deadline := "-"
+		if request.Deadline != nil {
+			deadline = request.Deadline.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", request.RunID, request.Gate, request.RequestedAt.Format(time.RFC3339), deadline, request.Message)
+	}
+	w.Flush()
+}
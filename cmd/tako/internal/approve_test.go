@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestApproveCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	approvals, err := engine.NewApprovalManager(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create approval manager: %v", err)
+	}
+	for _, gate := range []string{"approve-prod", "test-org/app:update"} {
+		if _, err := approvals.RequestApproval(engine.ApprovalRequest{RunID: "exec-release", Gate: gate, Message: "Deploy 1.2.0?"}); err != nil {
+			t.Fatalf("failed to request approval: %v", err)
+		}
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"approve", "--list", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to list approvals: %v", err)
+	}
+	for _, want := range []string{"RUN ID", "exec-release", "approve-prod", "test-org/app:update", "Deploy 1.2.0?"} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, b.String())
+		}
+	}
+
+	// The gate must be chosen while the run waits for several
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	cmd.SetArgs([]string{"approve", "exec-release", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "2 pending approvals") {
+		t.Errorf("expected the gate to be ambiguous, got %v", err)
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"approve", "exec-release", "--step", "test-org/app:update", "--reject", "--reason", "broken", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to reject approval: %v", err)
+	}
+	if !strings.Contains(b.String(), "Approval test-org/app:update of exec-release rejected") {
+		t.Errorf("unexpected output: %s", b.String())
+	}
+
+	// The remaining gate is approved without naming it
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"approve", "exec-release", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to approve: %v", err)
+	}
+	if !strings.Contains(b.String(), "Approval approve-prod of exec-release approved") {
+		t.Errorf("unexpected output: %s", b.String())
+	}
+	if approval, _ := approvals.GetApproval("exec-release", "test-org/app:update"); approval == nil || approval.Status != engine.ApprovalRejected || approval.Reason != "broken" {
+		t.Errorf("expected the rejection to be recorded, got %+v", approval)
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewAuditCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the audit log of cross-repository triggers",
+		Long: `Inspects the audit log of the cache, which records every trigger decision of fan-outs: the
+events emitted with their fingerprint, the subscriptions that matched or were rejected with the
+results of their filters, the winners and losers of diamond resolution, and the final status of
+the child workflows. Each entry is chained to the previous one by its hash, so that changes to
+the log are detected.`,
+	}
+
+	cmd.AddCommand(newAuditShowCmd())
+	cmd.AddCommand(newAuditVerifyCmd())
+	return cmd
+}
+
+func newAuditShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <fanout-id>",
+		Short: "Show the trigger decisions of a fan-out",
+		Long: `Shows the trigger decisions of a fan-out, in the order they were made, after verifying the hash
+chain of the audit log.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			audit, err := engine.NewAuditLog(cacheDir)
+			if err != nil {
+				return err
+			}
+			if _, err := audit.Verify(); err != nil {
+				return err
+			}
+			entries, err := audit.Entries(args[0])
+			if err != nil {
+				return err
+			}
+			if len(entries) == 0 {
+				return fmt.Errorf("no audit entries found for fan-out %s", args[0])
+			}
+
+			if asJSON {
+				return encodeJSON(cmd, entries)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "SEQ\tTIME\tDECISION\tSUBSCRIBER\tDETAILS")
+			for _, entry := range entries {
+				subscriber := "-"
+				if entry.Repository != "" {
+					subscriber = entry.Repository + ":" + entry.Workflow
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", entry.Sequence, formatCacheTime(entry.Time), entry.Decision, subscriber, formatAuditDetails(entry))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().Bool("json", false, "Output the entries as JSON")
+	return cmd
+}
+
+func newAuditVerifyCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that the audit log was not modified",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			audit, err := engine.NewAuditLog(cacheDir)
+			if err != nil {
+				return err
+			}
+			result, err := audit.Verify()
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Audit log is intact: %d entries\n", result.Entries)
+			if result.PartialSize > 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "Ignoring a partial entry of %d bytes at its end, left by an interrupted append; the next append removes it\n", result.PartialSize)
+			}
+			return nil
+		},
+	}
+}
+
+// formatAuditDetails formats the reason, filter results and details of an entry on one line.
+func formatAuditDetails(entry engine.AuditEntry) string {
+	var parts []string
+	if entry.Reason != "" {
+		parts = append(parts, entry.Reason)
+	}
+	for _, filter := range entry.Filters {
+		result := fmt.Sprintf("%v", filter.Result)
+		if filter.Error != "" {
+			result = "error: " + filter.Error
+		}
+		parts = append(parts, fmt.Sprintf("filter %q => %s", filter.Expression, result))
+	}
+	keys := make([]string, 0, len(entry.Details))
+	for key := range entry.Details {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if entry.Details[key] != "" {
+			parts = append(parts, fmt.Sprintf("%s=%s", key, entry.Details[key]))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewBreakersCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "breakers",
+		Short: "Inspect and reset the circuit breakers of child workflows",
+		Long: `Inspects and resets the circuit breakers guarding the child workflows of fan-outs, one per
+subscriber endpoint (owner/repo:workflow). Their states are persisted in the cache, so that a
+flapping subscriber stays blocked across restarts until its breaker times out or is reset.`,
+	}
+	cmd.AddCommand(newBreakersListCmd())
+	cmd.AddCommand(newBreakersResetCmd())
+	return cmd
+}
+
+func newBreakersListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the circuit breakers with recorded failures",
+		Long: `Lists the circuit breakers with recorded failures: their endpoint, state, consecutive failures,
+last failure and, for open ones, when they let a request through again.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			store, err := openCircuitBreakers(cmd)
+			if err != nil {
+				return err
+			}
+			snapshots, err := store.List()
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				if snapshots == nil {
+					snapshots = []engine.CircuitBreakerSnapshot{}
+				}
+				return encodeJSON(cmd, snapshots)
+			}
+
+			now := time.Now()
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "ENDPOINT\tSTATE\tFAILURES\tLAST FAILURE\tOPEN UNTIL")
+			for _, snapshot := range snapshots {
+				fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", snapshot.Endpoint, snapshot.State, snapshot.Failures,
+					formatCacheTime(snapshot.LastFailureTime), formatOpenUntil(snapshot.OpenUntil, now))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the circuit breakers as JSON")
+	return cmd
+}
+
+func newBreakersResetCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reset [endpoint...]",
+		Short: "Close circuit breakers",
+		Long: `Closes the circuit breakers of endpoints (owner/repo:workflow), or all of them with --all, so
+that the next fan-outs trigger their subscribers again. Running processes keep the state they
+already loaded until their breakers next change.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			all, _ := cmd.Flags().GetBool("all")
+			if all == (len(args) > 0) {
+				return fmt.Errorf("either endpoints or --all is required")
+			}
+
+			store, err := openCircuitBreakers(cmd)
+			if err != nil {
+				return err
+			}
+			endpoints := args
+			if all {
+				snapshots, err := store.List()
+				if err != nil {
+					return err
+				}
+				endpoints = nil
+				for _, snapshot := range snapshots {
+					endpoints = append(endpoints, snapshot.Endpoint)
+				}
+			}
+			for _, endpoint := range endpoints {
+				snapshot, err := store.Get(endpoint)
+				if err != nil {
+					return err
+				}
+				if snapshot == nil {
+					return fmt.Errorf("no circuit breaker with failures for %s", endpoint)
+				}
+				if err := store.Delete(endpoint); err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Reset %s (was %s)\n", endpoint, snapshot.State)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool("all", false, "Reset all the circuit breakers")
+	return cmd
+}
+
+// openCircuitBreakers opens the store of the circuit breakers of the cache.
+func openCircuitBreakers(cmd *cobra.Command) (*engine.CircuitBreakerStore, error) {
+	cacheDir, err := resolveCacheDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return engine.NewCircuitBreakerStore(cacheDir)
+}
+
+// formatOpenUntil formats when an open circuit breaker lets a request through again.
+func formatOpenUntil(openUntil *time.Time, now time.Time) string {
+	switch {
+	case openUntil == nil:
+		return "-"
+	case !now.Before(*openUntil):
+		return formatCacheTime(*openUntil) + " (elapsed)"
+	default:
+		return formatCacheTime(*openUntil)
+	}
+}
@@ -0,0 +1,63 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestBreakersCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := engine.NewCircuitBreakerStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	openUntil := time.Now().Add(time.Hour)
+	for _, snapshot := range []engine.CircuitBreakerSnapshot{
+		{Endpoint: "org/app:update", State: "open", Failures: 5, LastFailureTime: time.Now(), OpenUntil: &openUntil},
+		{Endpoint: "org/docs:publish", State: "closed", Failures: 1, LastFailureTime: time.Now()},
+	} {
+		if err := store.Save(snapshot); err != nil {
+			t.Fatalf("failed to save snapshot: %v", err)
+		}
+	}
+
+	run := func(args ...string) (string, error) {
+		b := bytes.NewBufferString("")
+		cmd := NewRootCmd()
+		cmd.SetOut(b)
+		cmd.SetArgs(append(append([]string{"breakers"}, args...), "--cache-dir", cacheDir))
+		err := cmd.Execute()
+		return b.String(), err
+	}
+
+	out, err := run("list")
+	if err != nil {
+		t.Fatalf("failed to list circuit breakers: %v", err)
+	}
+	for _, want := range []string{"org/app:update", "open", "org/docs:publish", "closed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the circuit breakers, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := run("reset"); err == nil {
+		t.Errorf("expected reset to require endpoints or --all")
+	}
+	if _, err := run("reset", "org/api:deploy"); err == nil {
+		t.Errorf("expected an unknown endpoint to be rejected")
+	}
+	out, err = run("reset", "org/app:update")
+	if err != nil || !strings.Contains(out, "Reset org/app:update (was open)") {
+		t.Fatalf("failed to reset circuit breaker: %q, %v", out, err)
+	}
+	if _, err := run("reset", "--all"); err != nil {
+		t.Fatalf("failed to reset all circuit breakers: %v", err)
+	}
+	if snapshots, _ := store.List(); len(snapshots) != 0 {
+		t.Errorf("expected all circuit breakers to be reset, got %+v", snapshots)
+	}
+}
@@ -1,42 +1,165 @@
 package internal
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
 	"time"
 
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/git"
 	"github.com/spf13/cobra"
 )
 
+// defaultCacheMaxSize is the size limit of the cache used by `tako cache gc` when neither
+// --max-size nor TAKO_CACHE_MAX_SIZE is set.
+const defaultCacheMaxSize = "10GiB"
+
 func NewCacheCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cache",
 		Short: "Manage tako's cache",
 	}
 
+	cmd.AddCommand(newCacheListCmd())
+	cmd.AddCommand(newCacheInfoCmd())
 	cmd.AddCommand(newCacheCleanCmd())
+	cmd.AddCommand(newCacheRefreshCmd())
 	cmd.AddCommand(newCachePruneCmd())
+	cmd.AddCommand(newCacheGCCmd())
 
 	return cmd
 }
 
-func newCacheCleanCmd() *cobra.Command {
-	var confirm bool
+func newCacheListCmd() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "clean",
-		Short: "Clear the cache directory",
+		Use:   "list",
+		Short: "List the cached repositories",
+		Long:  `Lists the cached repositories with the branch they have checked out, when they were last fetched and used, and their size on disk.`,
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cacheDir, err := cmd.Flags().GetString("cache-dir")
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			repos, err := cache.Repositories(cacheDir)
 			if err != nil {
 				return err
 			}
 
-			if cacheDir == "~/.tako/cache" {
-				homeDir, err := os.UserHomeDir()
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPOSITORY\tBRANCH\tLAST FETCH\tLAST USED\tSIZE")
+			for _, repo := range repos {
+				branch, err := git.CurrentBranch(repo.Path)
 				if err != nil {
+					branch = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", repo.Name, branch, lastFetch(repo.Path), formatCacheTime(repo.LastUsed), cache.FormatSize(repo.Size))
+			}
+			return w.Flush()
+		},
+	}
+	return cmd
+}
+
+func newCacheInfoCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "info <repository>",
+		Short: "Show details of a cached repository",
+		Long:  `Shows details of a cached repository, given as owner/repo or owner/repo:ref.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			repos, err := matchCachedRepositories(cacheDir, args)
+			if err != nil {
+				return err
+			}
+
+			out := cmd.OutOrStdout()
+			for i, repo := range repos {
+				if i > 0 {
+					fmt.Fprintln(out)
+				}
+				w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+				fmt.Fprintf(w, "Repository:\t%s\n", repo.Name)
+				fmt.Fprintf(w, "Path:\t%s\n", repo.Path)
+				fmt.Fprintf(w, "Ref:\t%s\n", cache.RepositoryRef(repo))
+				if branch, err := git.CurrentBranch(repo.Path); err == nil {
+					fmt.Fprintf(w, "Branch:\t%s\n", branch)
+				}
+				if commit, err := git.HeadCommit(repo.Path); err == nil {
+					fmt.Fprintf(w, "Commit:\t%s\n", commit)
+				}
+				fmt.Fprintf(w, "Last fetch:\t%s\n", lastFetch(repo.Path))
+				fmt.Fprintf(w, "Last used:\t%s\n", formatCacheTime(repo.LastUsed))
+				fmt.Fprintf(w, "Size:\t%s\n", cache.FormatSize(repo.Size))
+				if err := w.Flush(); err != nil {
 					return err
 				}
-				cacheDir = filepath.Join(homeDir, ".tako", "cache")
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newCacheRefreshCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "refresh [repository...]",
+		Short: "Fetch updates for cached repositories",
+		Long: `Fetches updates for the given cached repositories, given as owner/repo or owner/repo:ref, or for
+all of them when none is given, and fast-forwards the branches they have checked out.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			repos, err := matchCachedRepositories(cacheDir, args)
+			if err != nil {
+				return err
+			}
+
+			var failed int
+			for _, repo := range repos {
+				if err := refreshRepository(repo); err != nil {
+					fmt.Fprintf(cmd.ErrOrStderr(), "Failed to refresh %s: %v\n", repo.Name, err)
+					failed++
+					continue
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "Refreshed %s\n", repo.Name)
+			}
+			if failed > 0 {
+				return fmt.Errorf("failed to refresh %d repository(ies)", failed)
+			}
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newCacheCleanCmd() *cobra.Command {
+	var confirm bool
+	var stale time.Duration
+	cmd := &cobra.Command{
+		Use:   "clean [repository...]",
+		Short: "Clear the cache directory",
+		Long: `Clears the cache directory. When repositories are given, as owner/repo or owner/repo:ref, only
+their clones are removed; with --stale, only the clones that were not used for that long.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			if len(args) > 0 || stale > 0 {
+				return cleanRepositories(cmd, cacheDir, args, stale)
 			}
 
 			if !confirm {
@@ -54,27 +177,97 @@ func newCacheCleanCmd() *cobra.Command {
 		},
 	}
 	cmd.Flags().BoolVar(&confirm, "confirm", false, "Confirm the cache cleaning")
+	cmd.Flags().DurationVar(&stale, "stale", 0, "Only remove the repository clones not used for this long (e.g. 720h)")
 	return cmd
 }
 
+// cleanRepositories removes the given cached repositories, or all of them when none is given,
+// that were not used within the stale duration.
+func cleanRepositories(cmd *cobra.Command, cacheDir string, refs []string, stale time.Duration) error {
+	repos, err := matchCachedRepositories(cacheDir, refs)
+	if err != nil {
+		return err
+	}
+
+	var evictions []cache.Eviction
+	for _, repo := range repos {
+		if stale > 0 && time.Since(repo.LastUsed) <= stale {
+			continue
+		}
+		evictions = append(evictions, cache.Eviction{Entry: repo})
+		fmt.Fprintf(cmd.OutOrStdout(), "Removing %s (%s)\n", repo.Name, cache.FormatSize(repo.Size))
+	}
+
+	freed, err := cache.Apply(evictions)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(cmd.OutOrStdout(), "Removed %d repository(ies), freeing %s.\n", len(evictions), cache.FormatSize(freed))
+	return nil
+}
+
+// matchCachedRepositories returns the cached repositories matching the given references, or
+// all of them when none is given. A reference that matches nothing is an error.
+func matchCachedRepositories(cacheDir string, refs []string) ([]cache.Entry, error) {
+	repos, err := cache.Repositories(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return repos, nil
+	}
+
+	var matched []cache.Entry
+	for _, ref := range refs {
+		found := false
+		for _, repo := range repos {
+			if cache.MatchesRepository(repo, ref) {
+				matched = append(matched, repo)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("repository %s is not in the cache", ref)
+		}
+	}
+	return matched, nil
+}
+
+// refreshRepository fetches a cached repository and brings its checkout up to date.
+func refreshRepository(repo cache.Entry) error {
+	if err := git.Fetch(repo.Path); err != nil {
+		return err
+	}
+	if err := git.Checkout(repo.Path, cache.RepositoryRef(repo)); err != nil {
+		return err
+	}
+	return git.FastForward(repo.Path)
+}
+
+// lastFetch formats when a cached repository was last fetched.
+func lastFetch(path string) string {
+	fetched, ok := git.LastFetchTime(path)
+	if !ok {
+		return "never"
+	}
+	return formatCacheTime(fetched)
+}
+
+// formatCacheTime formats a time for cache listings.
+func formatCacheTime(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
 func newCachePruneCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "prune",
 		Short: "Prune the cache directory",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			cacheDir, err := cmd.Flags().GetString("cache-dir")
+			cacheDir, err := resolveCacheDir(cmd)
 			if err != nil {
 				return err
 			}
 
-			if cacheDir == "~/.tako/cache" {
-				homeDir, err := os.UserHomeDir()
-				if err != nil {
-					return err
-				}
-				cacheDir = filepath.Join(homeDir, ".tako", "cache")
-			}
-
 			cmd.OutOrStdout().Write([]byte("Pruning cache...\n"))
 			if err := CleanOld(cacheDir, 30*24*time.Hour); err != nil {
 				return err
@@ -87,6 +280,82 @@ func newCachePruneCmd() *cobra.Command {
 	return cmd
 }
 
+func newCacheGCCmd() *cobra.Command {
+	var dryRun bool
+	var maxSize string
+	var maxStateAge time.Duration
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Evict cached data to keep the cache under its size quota",
+		Long: `Evict cached data to keep the cache directory under its size quota.
+
+Completed fan-out states and child workspaces older than --max-state-age are removed first.
+Then, while the cache is larger than --max-size, the least recently used repository clones,
+fan-out states and workspaces are removed. The size quota defaults to the TAKO_CACHE_MAX_SIZE
+environment variable, or ` + defaultCacheMaxSize + `.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			maxBytes, err := resolveCacheMaxSize(maxSize)
+			if err != nil {
+				return err
+			}
+
+			entries, err := cache.Scan(cacheDir)
+			if err != nil {
+				return err
+			}
+			evictions := cache.Plan(entries, cache.Policy{MaxSize: maxBytes, MaxStateAge: maxStateAge}, time.Now())
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Cache size: %s (limit %s)\n", cache.FormatSize(cache.TotalSize(entries)), cache.FormatSize(maxBytes))
+			if len(evictions) == 0 {
+				fmt.Fprintln(out, "Nothing to evict.")
+				return nil
+			}
+
+			var size int64
+			for _, eviction := range evictions {
+				size += eviction.Entry.Size
+				fmt.Fprintf(out, "  %s %s (%s): %s\n", eviction.Entry.Kind, eviction.Entry.Name, cache.FormatSize(eviction.Entry.Size), eviction.Reason)
+			}
+
+			if dryRun {
+				fmt.Fprintf(out, "Would evict %d entries, freeing %s.\n", len(evictions), cache.FormatSize(size))
+				return nil
+			}
+
+			freed, err := cache.Apply(evictions)
+			fmt.Fprintf(out, "Evicted %d entries, freeing %s.\n", len(evictions), cache.FormatSize(freed))
+			return err
+		},
+	}
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report what would be evicted and why without removing anything")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Size quota of the cache, such as 5GiB or 500MB")
+	cmd.Flags().DurationVar(&maxStateAge, "max-state-age", cache.DefaultMaxStateAge, "Age after which completed fan-out states and workspaces are evicted (0 to keep them)")
+	return cmd
+}
+
+// resolveCacheMaxSize returns the size quota of the cache: the --max-size flag, the
+// TAKO_CACHE_MAX_SIZE environment variable or defaultCacheMaxSize.
+func resolveCacheMaxSize(maxSize string) (int64, error) {
+	if maxSize == "" {
+		maxSize = os.Getenv("TAKO_CACHE_MAX_SIZE")
+	}
+	if maxSize == "" {
+		maxSize = defaultCacheMaxSize
+	}
+	maxBytes, err := cache.ParseSize(maxSize)
+	if err != nil {
+		return 0, fmt.Errorf("invalid --max-size: %v", err)
+	}
+	return maxBytes, nil
+}
+
 func CleanOld(cacheDir string, maxAge time.Duration) error {
 	reposDir := filepath.Join(cacheDir, "repos")
 	return filepath.Walk(reposDir, func(path string, info os.FileInfo, err error) error {
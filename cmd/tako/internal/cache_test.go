@@ -3,6 +3,7 @@ package internal
 import (
 	"bytes"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -63,3 +64,149 @@ func TestCleanOld(t *testing.T) {
 		t.Errorf("expected new file to be there, but it is not")
 	}
 }
+
+func TestCacheGCCmd_DryRun(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repos", "owner", "repo", "main")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repo dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "file"), make([]byte, 2048), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"cache", "gc", "--cache-dir", tmpDir, "--max-size", "1KiB", "--dry-run"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute cache gc command: %v", err)
+	}
+
+	for _, expected := range []string{"repository owner/repo:main", "least recently used", "Would evict 1 entries"} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected output to contain %q, got %q", expected, b.String())
+		}
+	}
+	if _, err := os.Stat(repoDir); err != nil {
+		t.Errorf("expected dry run to keep %s: %v", repoDir, err)
+	}
+}
+
+// runGit runs a git command in a directory for cache tests.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.email=test@example.com", "-c", "user.name=Test"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// setupCachedRepository creates an origin repository and clones it into the cache at
+// repos/owner/repo/main, returning the origin and the clone.
+func setupCachedRepository(t *testing.T, cacheDir string) (string, string) {
+	t.Helper()
+	origin := filepath.Join(t.TempDir(), "origin")
+	if err := os.MkdirAll(origin, 0755); err != nil {
+		t.Fatalf("failed to create origin: %v", err)
+	}
+	runGit(t, origin, "init", "-b", "main")
+	runGit(t, origin, "commit", "--allow-empty", "-m", "initial commit")
+
+	clone := filepath.Join(cacheDir, "repos", "owner", "repo", "main")
+	if err := os.MkdirAll(filepath.Dir(clone), 0755); err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+	runGit(t, filepath.Dir(clone), "clone", origin, clone)
+	return origin, clone
+}
+
+func executeCacheCmd(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	cmd.SetArgs(append([]string{"cache"}, args...))
+	err := cmd.Execute()
+	return b.String(), err
+}
+
+func TestCacheListAndInfoCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	_, clone := setupCachedRepository(t, cacheDir)
+
+	out, err := executeCacheCmd(t, "list", "--cache-dir", cacheDir)
+	if err != nil {
+		t.Fatalf("failed to execute cache list command: %v", err)
+	}
+	for _, expected := range []string{"REPOSITORY", "owner/repo:main", "main"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected list output to contain %q, got %q", expected, out)
+		}
+	}
+
+	out, err = executeCacheCmd(t, "info", "owner/repo", "--cache-dir", cacheDir)
+	if err != nil {
+		t.Fatalf("failed to execute cache info command: %v", err)
+	}
+	commit := runGit(t, clone, "rev-parse", "HEAD")
+	for _, expected := range []string{"owner/repo:main", clone, commit, "Branch:"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("expected info output to contain %q, got %q", expected, out)
+		}
+	}
+
+	if _, err := executeCacheCmd(t, "info", "owner/missing", "--cache-dir", cacheDir); err == nil {
+		t.Errorf("expected an error for a repository that is not cached")
+	}
+}
+
+func TestCacheRefreshCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	origin, clone := setupCachedRepository(t, cacheDir)
+	runGit(t, origin, "commit", "--allow-empty", "-m", "second commit")
+
+	out, err := executeCacheCmd(t, "refresh", "owner/repo:main", "--cache-dir", cacheDir)
+	if err != nil {
+		t.Fatalf("failed to execute cache refresh command: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Refreshed owner/repo:main") {
+		t.Errorf("expected output to report the refresh, got %q", out)
+	}
+	if got, want := runGit(t, clone, "rev-parse", "HEAD"), runGit(t, origin, "rev-parse", "HEAD"); got != want {
+		t.Errorf("expected the clone to be at %s after refresh, got %s", want, got)
+	}
+}
+
+func TestCacheCleanCmd_Repositories(t *testing.T) {
+	cacheDir := t.TempDir()
+	keep := filepath.Join(cacheDir, "repos", "owner", "keep", "main")
+	remove := filepath.Join(cacheDir, "repos", "owner", "remove", "main")
+	stale := filepath.Join(cacheDir, "repos", "owner", "stale", "v1")
+	for _, dir := range []string{keep, remove, stale} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("failed to create repo dir: %v", err)
+		}
+	}
+	old := time.Now().Add(-60 * 24 * time.Hour)
+	if err := os.Chtimes(stale, old, old); err != nil {
+		t.Fatalf("failed to change mod time: %v", err)
+	}
+
+	if _, err := executeCacheCmd(t, "clean", "owner/remove", "--cache-dir", cacheDir); err != nil {
+		t.Fatalf("failed to clean repository: %v", err)
+	}
+	if _, err := executeCacheCmd(t, "clean", "--stale", "720h", "--cache-dir", cacheDir); err != nil {
+		t.Fatalf("failed to clean stale repositories: %v", err)
+	}
+
+	for dir, wantExists := range map[string]bool{keep: true, remove: false, stale: false} {
+		_, err := os.Stat(dir)
+		if exists := err == nil; exists != wantExists {
+			t.Errorf("expected %s to exist = %v, got %v", dir, wantExists, exists)
+		}
+	}
+}
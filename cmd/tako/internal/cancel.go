@@ -0,0 +1,43 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewCancelCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cancel <run-id>",
+		Short: "Cancel a running execution",
+		Long: `Requests the cancellation of a running execution and of every child workflow it started.
+The run stops at its next cancellation check: running shell and container steps are killed,
+children that have not started yet are not triggered, and the run is marked as cancelled.
+A fan-out ID can also be given to cancel a single fan-out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runID := args[0]
+			reason, _ := cmd.Flags().GetString("reason")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			cancellations, err := engine.NewCancellationManager(cacheDir)
+			if err != nil {
+				return err
+			}
+			if err := cancellations.RequestCancellation(runID, reason); err != nil {
+				return fmt.Errorf("failed to cancel %s: %v", runID, err)
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Cancellation requested for %s\n", runID)
+			return nil
+		},
+	}
+
+	cmd.Flags().String("reason", "", "Reason recorded with the cancellation")
+	return cmd
+}
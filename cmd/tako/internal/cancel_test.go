@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestCancelCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"cancel", "exec-20240726-143022-a7b3c1d2", "--reason", "bad release", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute cancel command: %v", err)
+	}
+	if !strings.Contains(b.String(), "Cancellation requested for exec-20240726-143022-a7b3c1d2") {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+
+	cancellations, err := engine.NewCancellationManager(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create cancellation manager: %v", err)
+	}
+	request, err := cancellations.GetCancellation("exec-20240726-143022-a7b3c1d2")
+	if err != nil {
+		t.Fatalf("failed to read cancellation: %v", err)
+	}
+	if request == nil || request.Reason != "bad release" {
+		t.Errorf("expected cancellation with reason, got %+v", request)
+	}
+}
+
+func TestCancelCmdInvalidRunID(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetArgs([]string{"cancel", "../escape", "--cache-dir", t.TempDir()})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected an error for an invalid run ID")
+	}
+}
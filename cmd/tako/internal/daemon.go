@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewDaemonCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Trigger subscribers of events received from message brokers",
+		Long: `Subscribes to the NATS subjects and Kafka topics of a daemon config file and triggers the
+subscribers of every event received, as a fan-out of the event's source repository would.
+Messages are acknowledged once their subscribers completed; the fan-out of a message that the
+broker redelivers is not run twice, its idempotency fingerprint being derived from the
+message's broker ID. The circuit_breakers section of the config file is reloaded when the
+file changes. With --health-addr, the health of the engine is served as JSON on /healthz, with
+a 503 status when it is unhealthy. The daemon runs until it is interrupted.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			configPath, _ := cmd.Flags().GetString("config")
+			backend, _ := cmd.Flags().GetString("backend")
+			localOnly, _ := cmd.Flags().GetBool("local-only")
+			gitProtocol, _ := cmd.Flags().GetString("git-protocol")
+			fetchInterval, _ := cmd.Flags().GetDuration("fetch-interval")
+			maxFanOutDepth, _ := cmd.Flags().GetInt("max-fanout-depth")
+			maxTotalChildren, _ := cmd.Flags().GetInt("max-total-children")
+			healthAddr, _ := cmd.Flags().GetString("health-addr")
+
+			daemonConfig, err := config.LoadDaemon(configPath)
+			if err != nil {
+				return err
+			}
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			namespace, err := resolveNamespace(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			gitAuth, err := auth.FromEnvironment(os.Environ())
+			if err != nil {
+				return err
+			}
+
+			fanOuts, err := engine.NewFanOutOptions(userConfig(cmd))
+			if err != nil {
+				return err
+			}
+			retention, err := engine.NewRetentionOptions(userConfig(cmd))
+			if err != nil {
+				return err
+			}
+
+			runner, err := engine.NewRunner(engine.RunnerOptions{
+				WorkspaceRoot:    workspaceRoot,
+				CacheDir:         cacheDir,
+				Environment:      os.Environ(),
+				Namespace:        namespace,
+				MaxFanOutDepth:   maxFanOutDepth,
+				MaxTotalChildren: maxTotalChildren,
+				ContainerRuntime: userConfig(cmd).Execution.ContainerRuntime,
+				Git: engine.GitOptions{
+					LocalOnly:     localOnly,
+					Protocol:      gitProtocol,
+					Auth:          gitAuth,
+					FetchInterval: fetchInterval,
+				},
+				Backend:   backend,
+				FanOuts:   fanOuts,
+				Retention: retention,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create execution runner: %v", err)
+			}
+			defer runner.Close()
+
+			daemon, err := engine.NewEventDaemon(daemonConfig, runner, os.Environ())
+			if err != nil {
+				return err
+			}
+
+			if _, err := runner.Reconcile(engine.DefaultOrphanStaleAfter); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to recover interrupted runs: %v\n", err)
+			}
+
+			// In-flight fan-outs are marked interrupted when the daemon is stopped
+			ctx, stop := engine.NotifyInterrupt(context.Background())
+			defer stop()
+			if err := runner.WatchCircuitBreakers(ctx, configPath); err != nil {
+				return err
+			}
+			if err := runner.WatchSubscriptions(ctx); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to watch cached repositories: %v\n", err)
+			}
+			if healthAddr != "" {
+				maxCacheSize, err := resolveCacheMaxSize("")
+				if err != nil {
+					return err
+				}
+				stopHealth, err := serveHealth(healthAddr, runner.HealthHandler(engine.HealthOptions{MaxCacheSize: maxCacheSize}))
+				if err != nil {
+					return err
+				}
+				defer stopHealth()
+				fmt.Fprintf(cmd.OutOrStdout(), "Serving health on http://%s/healthz\n", healthAddr)
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Receiving events from %d sources\n", len(daemonConfig.Sources))
+			return daemon.Run(ctx)
+		},
+	}
+
+	cmd.Flags().String("config", "tako-daemon.yml", "Daemon config file listing the event sources")
+	cmd.Flags().String("backend", "", "Backend of child workflows: local, container, remote, kubernetes or noop (default: local)")
+	cmd.Flags().Bool("local-only", false, "Only use repositories already in the cache, never clone or fetch them")
+	cmd.Flags().String("git-protocol", "https", "Protocol used to clone repositories: https or ssh")
+	cmd.Flags().Duration("fetch-interval", engine.DefaultGitFetchInterval, "How long a cached repository is used before it is fetched again (negative to always fetch)")
+	cmd.Flags().Int("max-total-children", engine.DefaultMaxTotalChildren, "Maximum child workflows triggered by the fan-outs of each dispatched event, including those of its descendants")
+	cmd.Flags().Int("max-fanout-depth", engine.DefaultMaxFanOutDepth, "Maximum depth of the fan-out children of the dispatched events; deeper event chains fail")
+	cmd.Flags().String("health-addr", "", "Address to serve the health of the engine on, at /healthz (e.g. :8080; disabled by default)")
+	return cmd
+}
+
+// serveHealth serves a health handler on /healthz of an address until the returned function is
+// called.
+func serveHealth(addr string, handler http.Handler) (func(), error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serve health: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/healthz", handler)
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	}, nil
+}
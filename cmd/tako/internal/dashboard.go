@@ -0,0 +1,601 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/dangazineu/tako/internal/interfaces"
+	"github.com/spf13/cobra"
+)
+
+// dashboardSpinner are the frames of the spinner of running runs.
+var dashboardSpinner = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// dashboardLogLines is how many lines of the log of an expanded step are shown.
+const dashboardLogLines = 10
+
+func NewDashboardCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "dashboard [run-id]",
+		Short: "Follow the execution tree of a run in a terminal dashboard",
+		Long: `Shows the execution tree of a run, the last one started when no run ID is given, with the live
+status of the runs its fan-outs triggered: running children have a spinner, and the tree is
+refreshed from the execution history, the execution states and the fan-out states as it runs.
+
+Keys:
+  up/down, k/j   select a run or a step
+  enter, space   expand the steps of a run, or the end of the log of a step
+  c              cancel the selected run and every run it started
+  r              retry the selected failed branch: run its workflow again in a new run
+  q, ctrl-c      quit; retries keep running
+
+When the output is not a terminal, or with --once, the tree is printed once.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			once, _ := cmd.Flags().GetBool("once")
+			interval, _ := cmd.Flags().GetDuration("interval")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			runID := ""
+			if len(args) == 1 {
+				runID = args[0]
+			} else if runID, err = engine.LatestRunID(cacheDir, workspaceRoot); err != nil {
+				return err
+			}
+
+			model := newDashboardModel(cacheDir, workspaceRoot, runID)
+			model.startRetry = newRetryStarter(cmd, workspaceRoot)
+			if err := model.refresh(); err != nil {
+				return err
+			}
+
+			in, inOK := cmd.InOrStdin().(*os.File)
+			out, outOK := cmd.OutOrStdout().(*os.File)
+			if once || !inOK || !outOK || !isTerminal(int(in.Fd())) || !isTerminal(int(out.Fd())) {
+				_, err := io.WriteString(cmd.OutOrStdout(), model.view())
+				return err
+			}
+			ctx, stop := engine.NotifyInterrupt(context.Background())
+			defer stop()
+			return runDashboard(ctx, in, out, model, interval)
+		},
+	}
+
+	cmd.Flags().Bool("once", false, "Print the execution tree once instead of following it")
+	cmd.Flags().Duration("interval", 500*time.Millisecond, "How often the execution tree is refreshed")
+	return cmd
+}
+
+// dashboardModel is the state of the dashboard. Keys update it, and the screen is its view.
+type dashboardModel struct {
+	cacheDir      string
+	workspaceRoot string
+	runID         string
+
+	tree     *engine.RunTree
+	cursor   int             // Index of the selected row
+	offset   int             // Index of the first row on the screen
+	height   int             // Rows of the screen; 0 to show all the rows
+	expanded map[string]bool // Keys of the expanded runs and steps
+	frame    int             // Frame of the spinners
+	message  string
+
+	// retries are the retries of failed branches, by the key of the run they retry
+	retries    map[string]*dashboardRetry
+	startRetry func(node *engine.RunTree) (*dashboardRetry, error)
+	cancel     func(runID string) error
+}
+
+// dashboardRow is a line of the tree: a run, or one of its steps.
+type dashboardRow struct {
+	key   string
+	depth int
+	run   *engine.RunTree
+	step  *engine.RunTreeStep // Nil for the row of a run
+	retry *dashboardRetry     // Retry of the run of the row, when it was retried
+}
+
+// dashboardRetry is a run of the workflow of a failed branch started from the dashboard.
+type dashboardRetry struct {
+	mu     sync.Mutex
+	done   bool
+	runID  string // Known once the run finished
+	err    error
+	output string // File the output of the retry is written to
+}
+
+func newDashboardModel(cacheDir, workspaceRoot, runID string) *dashboardModel {
+	cancellations := func(runID string) error {
+		manager, err := engine.NewCancellationManager(cacheDir)
+		if err != nil {
+			return err
+		}
+		return manager.RequestCancellation(runID, "cancelled from the dashboard")
+	}
+	return &dashboardModel{
+		cacheDir:      cacheDir,
+		workspaceRoot: workspaceRoot,
+		runID:         runID,
+		expanded:      make(map[string]bool),
+		retries:       make(map[string]*dashboardRetry),
+		cancel:        cancellations,
+	}
+}
+
+// refresh loads the execution tree again.
+func (m *dashboardModel) refresh() error {
+	tree, err := engine.LoadRunTree(m.cacheDir, m.workspaceRoot, m.runID)
+	if err != nil {
+		return err
+	}
+	m.tree = tree
+	return nil
+}
+
+// runKey identifies a run of the tree across refreshes, including children not started yet.
+func runKey(node *engine.RunTree) string {
+	if node.RunID != "" {
+		return node.RunID
+	}
+	return node.FanOutID + "/" + node.Repository + ":" + node.Workflow
+}
+
+// rows flattens the tree into the rows of the screen.
+func (m *dashboardModel) rows() []dashboardRow {
+	var rows []dashboardRow
+	var walk func(node *engine.RunTree, depth int)
+	walk = func(node *engine.RunTree, depth int) {
+		key := runKey(node)
+		rows = append(rows, dashboardRow{key: key, depth: depth, run: node, retry: m.retries[key]})
+		if m.expanded[key] {
+			for i := range node.Steps {
+				rows = append(rows, dashboardRow{key: key + "#" + node.Steps[i].ID, depth: depth + 1, run: node, step: &node.Steps[i]})
+			}
+		}
+		for _, child := range node.Children {
+			walk(child, depth+1)
+		}
+	}
+	if m.tree != nil {
+		walk(m.tree, 0)
+	}
+	return rows
+}
+
+// tick advances the spinners.
+func (m *dashboardModel) tick() {
+	m.frame = (m.frame + 1) % len(dashboardSpinner)
+}
+
+// update applies a key to the dashboard, and reports whether the dashboard should quit.
+func (m *dashboardModel) update(key string) bool {
+	rows := m.rows()
+	if m.cursor >= len(rows) {
+		m.cursor = len(rows) - 1
+	}
+	if m.cursor < 0 {
+		m.cursor = 0
+	}
+
+	switch key {
+	case "q", "ctrl-c":
+		return true
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(rows)-1 {
+			m.cursor++
+		}
+	case "enter", " ":
+		if len(rows) > 0 {
+			row := rows[m.cursor]
+			m.expanded[row.key] = !m.expanded[row.key]
+		}
+	case "c":
+		if len(rows) > 0 {
+			m.cancelRun(rows[m.cursor].run)
+		}
+	case "r":
+		if len(rows) > 0 {
+			m.retryRun(rows[m.cursor].run)
+		}
+	}
+	return false
+}
+
+// cancelRun requests the cancellation of a run and of the runs it started.
+func (m *dashboardModel) cancelRun(node *engine.RunTree) {
+	switch {
+	case node.RunID == "":
+		m.message = fmt.Sprintf("%s:%s has not started", node.Repository, node.Workflow)
+	case node.Finished():
+		m.message = fmt.Sprintf("%s is already %s", node.RunID, node.Status)
+	default:
+		if err := m.cancel(node.RunID); err != nil {
+			m.message = fmt.Sprintf("Failed to cancel %s: %v", node.RunID, err)
+			return
+		}
+		m.message = fmt.Sprintf("Cancellation requested for %s", node.RunID)
+	}
+}
+
+// retryRun runs the workflow of a failed branch again, in the repository and with the inputs it
+// ran with.
+func (m *dashboardModel) retryRun(node *engine.RunTree) {
+	key := runKey(node)
+	switch {
+	case !node.Failed():
+		m.message = fmt.Sprintf("Only failed branches can be retried, %s:%s is %s", node.Repository, node.Workflow, node.Status)
+		return
+	case !strings.Contains(node.Repository, "/"):
+		m.message = fmt.Sprintf("%s:%s is not a repository of the cache and cannot be retried", node.Repository, node.Workflow)
+		return
+	}
+	if retry := m.retries[key]; retry != nil && !retry.finished() {
+		m.message = fmt.Sprintf("%s:%s is already being retried", node.Repository, node.Workflow)
+		return
+	}
+	retry, err := m.startRetry(node)
+	if err != nil {
+		m.message = fmt.Sprintf("Failed to retry %s:%s: %v", node.Repository, node.Workflow, err)
+		return
+	}
+	m.retries[key] = retry
+	m.message = fmt.Sprintf("Retrying %s:%s, output in %s", node.Repository, node.Workflow, retry.output)
+}
+
+// finished reports whether the retry finished.
+func (r *dashboardRetry) finished() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.done
+}
+
+// status describes the retry.
+func (r *dashboardRetry) status(spinner string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch {
+	case !r.done:
+		return spinner + " retrying"
+	case r.runID != "" && r.err == nil:
+		return "retried: " + r.runID + " completed"
+	case r.runID != "":
+		return "retried: " + r.runID + " failed"
+	default:
+		return fmt.Sprintf("retry failed: %v", r.err)
+	}
+}
+
+// newRetryStarter returns the function retrying a failed branch with tako exec in a new
+// process, which keeps running when the dashboard quits. The JSON result of the run is written
+// to a file of the dashboard directory of the workspace root.
+func newRetryStarter(cmd *cobra.Command, workspaceRoot string) func(node *engine.RunTree) (*dashboardRetry, error) {
+	return func(node *engine.RunTree) (*dashboardRetry, error) {
+		executable, err := os.Executable()
+		if err != nil {
+			return nil, err
+		}
+		args := []string{"exec", node.Workflow, "--repo", node.Repository, "--json"}
+		for _, name := range []string{"cache-dir", "namespace"} {
+			if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+				args = append(args, "--"+name, flag.Value.String())
+			}
+		}
+		names := make([]string, 0, len(node.Inputs))
+		for name := range node.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			args = append(args, "--inputs", name+"="+node.Inputs[name])
+		}
+
+		dir := filepath.Join(workspaceRoot, "dashboard")
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create dashboard directory: %v", err)
+		}
+		output, err := os.CreateTemp(dir, "retry-*.json")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create retry output: %v", err)
+		}
+		process := exec.Command(executable, args...)
+		process.Stdout = output
+		process.Stderr = output
+		if err := process.Start(); err != nil {
+			output.Close()
+			return nil, err
+		}
+
+		retry := &dashboardRetry{output: output.Name()}
+		go func() {
+			err := process.Wait()
+			output.Close()
+			runID := retryRunID(output.Name())
+			retry.mu.Lock()
+			defer retry.mu.Unlock()
+			retry.done, retry.runID, retry.err = true, runID, err
+		}()
+		return retry, nil
+	}
+}
+
+// retryRunID reads the run ID of the JSON result of a retry; empty when it has none.
+func retryRunID(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	// The JSON result is the first value of the output, before any error
+	var result interfaces.ExecutionResult
+	if err := json.NewDecoder(bytes.NewReader(data)).Decode(&result); err != nil {
+		return ""
+	}
+	return result.RunID
+}
+
+// view renders the dashboard.
+func (m *dashboardModel) view() string {
+	var b strings.Builder
+	rows := m.rows()
+	spinner := dashboardSpinner[m.frame]
+
+	if m.tree != nil {
+		fmt.Fprintf(&b, "Run %s: %s on %s, %s\n", m.tree.RunID, m.tree.Workflow, m.tree.Repository, summarizeRunTree(m.tree))
+	}
+
+	// Keep the selected row on the screen; the header and the footer take 4 lines
+	visible := len(rows)
+	if m.height > 0 {
+		visible = max(m.height-4, 1)
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+visible {
+		m.offset = m.cursor - visible + 1
+	}
+	m.offset = max(min(m.offset, len(rows)-visible), 0)
+
+	fmt.Fprintln(&b)
+	for i := m.offset; i < len(rows) && i < m.offset+visible; i++ {
+		line := m.renderRow(rows[i], spinner)
+		if i == m.cursor && m.height > 0 {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		b.WriteString(line)
+		b.WriteByte('\n')
+
+		// The end of the log of an expanded step follows it
+		if row := rows[i]; row.step != nil && m.expanded[row.key] {
+			for _, logLine := range stepLogTail(row.run.LogDir, row.step.ID) {
+				fmt.Fprintf(&b, "%s│ %s\n", strings.Repeat("  ", row.depth+1), logLine)
+			}
+		}
+	}
+
+	if m.height > 0 {
+		fmt.Fprintln(&b)
+		b.WriteString("↑/↓ select  enter expand  c cancel  r retry  q quit")
+		if m.message != "" {
+			b.WriteString("  " + m.message)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// renderRow renders the line of a run or of a step.
+func (m *dashboardModel) renderRow(row dashboardRow, spinner string) string {
+	indent := strings.Repeat("  ", row.depth)
+	if row.step != nil {
+		step := row.step
+		line := fmt.Sprintf("%s%s %s (%s, %s)", indent, statusSymbol(step.Status, spinner), step.ID, step.Status, step.Duration.Round(time.Millisecond))
+		if step.Error != "" {
+			line += ": " + firstLine(step.Error)
+		}
+		return line
+	}
+
+	run := row.run
+	marker := "▸"
+	if m.expanded[row.key] {
+		marker = "▾"
+	}
+	status := run.Status
+	if status == "" {
+		status = string(engine.ChildStatusPending)
+	}
+	line := fmt.Sprintf("%s%s %s %s:%s (%s", indent, marker, statusSymbol(status, spinner), run.Repository, run.Workflow, status)
+	if !run.StartTime.IsZero() {
+		end := run.EndTime
+		if end.IsZero() {
+			end = time.Now()
+		}
+		line += ", " + end.Sub(run.StartTime).Round(time.Second).String()
+	}
+	line += ")"
+	if run.RunID != "" {
+		line += " " + run.RunID
+	}
+	if run.Error != "" {
+		line += ": " + firstLine(run.Error)
+	}
+	if row.retry != nil {
+		line += " [" + row.retry.status(spinner) + "]"
+	}
+	return line
+}
+
+// statusSymbol returns the symbol of a status; the spinner for runs and steps in progress.
+func statusSymbol(status, spinner string) string {
+	switch status {
+	case string(engine.StatusRunning):
+		return spinner
+	case string(engine.StatusWaitingForApproval):
+		return "⏸"
+	case string(engine.StatusCompleted), engine.HistoryStepSucceeded:
+		return "✓"
+	case string(engine.StatusFailed), string(engine.ChildStatusTimedOut):
+		return "✗"
+	case string(engine.StatusCancelled), string(engine.StatusInterrupted):
+		return "⊘"
+	case string(engine.StatusSkipped):
+		return "-"
+	}
+	return "·"
+}
+
+// summarizeRunTree counts the runs of a tree by status.
+func summarizeRunTree(tree *engine.RunTree) string {
+	var total, completed, failed, running, waiting int
+	var count func(node *engine.RunTree)
+	count = func(node *engine.RunTree) {
+		total++
+		switch {
+		case node.Failed():
+			failed++
+		case node.Status == string(engine.StatusCompleted):
+			completed++
+		case node.Status == string(engine.StatusRunning):
+			running++
+		case node.Status == string(engine.StatusWaitingForApproval):
+			waiting++
+		}
+		for _, child := range node.Children {
+			count(child)
+		}
+	}
+	count(tree)
+	summary := fmt.Sprintf("%d/%d runs completed, %d failed, %d running", completed, total, failed, running)
+	if waiting > 0 {
+		summary += fmt.Sprintf(", %d waiting for approval", waiting)
+	}
+	return summary
+}
+
+// stepLogTail returns the last lines of the log of a step; none when it has no log.
+func stepLogTail(logDir, stepID string) []string {
+	if logDir == "" {
+		return []string{"(no log)"}
+	}
+	log, err := engine.OpenStepLog(logDir, stepID)
+	if err != nil {
+		return []string{"(no log)"}
+	}
+	defer log.Close()
+	var b strings.Builder
+	if err := copyTail(&b, log, dashboardLogLines); err != nil {
+		return []string{fmt.Sprintf("(failed to read the log: %v)", err)}
+	}
+	return strings.Split(strings.TrimRight(b.String(), "\n"), "\n")
+}
+
+// firstLine returns the first line of a message.
+func firstLine(message string) string {
+	line, _, _ := strings.Cut(message, "\n")
+	return line
+}
+
+// runDashboard follows the execution tree on a terminal until the dashboard is quit: the tree is
+// redrawn on the alternate screen when it is refreshed, when the spinners turn and on every key.
+func runDashboard(ctx context.Context, in, out *os.File, model *dashboardModel, interval time.Duration) error {
+	if interval <= 0 {
+		interval = 500 * time.Millisecond
+	}
+	// Without raw mode keys are read a line at a time, followed by enter
+	if restore, err := makeRaw(int(in.Fd())); err == nil {
+		defer restore()
+	}
+	fmt.Fprint(out, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(out, "\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(in, keys)
+
+	spinner := time.NewTicker(100 * time.Millisecond)
+	defer spinner.Stop()
+	refresh := time.NewTicker(interval)
+	defer refresh.Stop()
+
+	var screen string
+	for {
+		model.height = terminalHeight(int(out.Fd()))
+		if model.height == 0 {
+			model.height = 24
+		}
+		// The screen is only redrawn when it changed, and raw mode does not return the carriage
+		// on new lines
+		if view := strings.ReplaceAll(model.view(), "\n", "\r\n"); view != screen {
+			screen = view
+			fmt.Fprint(out, "\x1b[H\x1b[2J"+screen)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case key, ok := <-keys:
+			if !ok || model.update(key) {
+				return nil
+			}
+		case <-spinner.C:
+			model.tick()
+		case <-refresh.C:
+			if err := model.refresh(); err != nil {
+				model.message = err.Error()
+			}
+		}
+	}
+}
+
+// readKeys sends the keys read from a terminal, named after the escape sequences of the arrow
+// keys and the control characters, until the terminal is closed.
+func readKeys(in io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 16)
+	for {
+		n, err := in.Read(buf)
+		if err != nil {
+			return
+		}
+		for input := string(buf[:n]); input != ""; {
+			key := input[:1]
+			switch {
+			case strings.HasPrefix(input, "\x1b[A"):
+				key = "\x1b[A"
+				keys <- "up"
+			case strings.HasPrefix(input, "\x1b[B"):
+				key = "\x1b[B"
+				keys <- "down"
+			case key == "\r" || key == "\n":
+				keys <- "enter"
+			case key == "\x03":
+				keys <- "ctrl-c"
+			case key != "\x1b":
+				keys <- key
+			}
+			input = input[len(key):]
+		}
+	}
+}
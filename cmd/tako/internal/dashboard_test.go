@@ -0,0 +1,135 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+// writeDashboardRun writes the history of a finished root run whose fan-out triggered a failed
+// child, and returns the log directory of the child.
+func writeDashboardRun(t *testing.T, cacheDir string) string {
+	t.Helper()
+	logDir := filepath.Join(t.TempDir(), "exec-app", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatalf("failed to create log dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logDir, "test.log"), []byte("running tests\nFAIL: TestApp\n"), 0644); err != nil {
+		t.Fatalf("failed to write log: %v", err)
+	}
+
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	now := time.Now()
+	records := []engine.HistoryRecord{
+		{RunID: "exec-root", Repository: "org/lib", Workflow: "release", Status: engine.HistoryStatusFailed, StartTime: now.Add(-time.Minute), EndTime: now},
+		{RunID: "exec-app", ParentRunID: "exec-root", Repository: "org/app", Workflow: "update", Status: engine.HistoryStatusFailed,
+			StartTime: now.Add(-time.Minute), EndTime: now, LogDir: logDir, Steps: []engine.HistoryStep{{ID: "test", Status: engine.HistoryStepFailed}}},
+	}
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	states, err := engine.NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("failed to create fan-out states: %v", err)
+	}
+	fanOut, err := states.CreateFanOutState("fanout-1", "exec-root", "org/lib", "library_built", true, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create fan-out state: %v", err)
+	}
+	fanOut.AddChildWorkflow("org/app", "update", map[string]string{"version": "1.0"})
+	if err := fanOut.UpdateChildStatus("org/app", "update", engine.ChildStatusFailed, "exec-app", "step 'test' failed"); err != nil {
+		t.Fatalf("failed to update child: %v", err)
+	}
+	return logDir
+}
+
+func TestDashboardCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cacheDir := t.TempDir()
+	writeDashboardRun(t, cacheDir)
+
+	// Without a terminal, the tree of the latest run is printed once
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"dashboard", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute dashboard command: %v", err)
+	}
+	output := b.String()
+	for _, want := range []string{
+		"Run exec-root: release on org/lib, 0/2 runs completed, 2 failed, 0 running",
+		"▸ ✗ org/lib:release (failed, 1m0s) exec-root",
+		"  ▸ ✗ org/app:update (failed, 1m0s) exec-app: step 'test' failed",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestDashboardModel(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeDashboardRun(t, cacheDir)
+
+	model := newDashboardModel(cacheDir, t.TempDir(), "exec-root")
+	model.height = 20
+	var retried *engine.RunTree
+	model.startRetry = func(node *engine.RunTree) (*dashboardRetry, error) {
+		retried = node
+		return &dashboardRetry{output: "retry.json"}, nil
+	}
+	var cancelled []string
+	model.cancel = func(runID string) error {
+		cancelled = append(cancelled, runID)
+		return nil
+	}
+	if err := model.refresh(); err != nil {
+		t.Fatalf("refresh() error = %v", err)
+	}
+
+	// Finished runs are not cancelled
+	model.update("c")
+	if len(cancelled) != 0 || !strings.Contains(model.message, "exec-root is already failed") {
+		t.Errorf("expected a finished run not to be cancelled, got %v: %s", cancelled, model.message)
+	}
+
+	// Expanding the child shows its steps, and expanding a step the end of its log
+	model.update("down")
+	model.update("enter")
+	model.update("j")
+	model.update(" ")
+	view := model.view()
+	if !strings.Contains(view, "✗ test (failed, 0s)") || !strings.Contains(view, "│ FAIL: TestApp") {
+		t.Errorf("expected the step and its log, got:\n%s", view)
+	}
+
+	// The failed branch is retried with its workflow, repository and inputs
+	model.update("k")
+	model.update("r")
+	if retried == nil || retried.Repository != "org/app" || retried.Workflow != "update" || retried.Inputs["version"] != "1.0" {
+		t.Fatalf("expected the failed child to be retried, got %+v", retried)
+	}
+	if view := model.view(); !strings.Contains(view, "exec-app: step 'test' failed [⠋ retrying]") || !strings.Contains(view, "Retrying org/app:update") {
+		t.Errorf("expected the retry in the view, got:\n%s", view)
+	}
+	model.update("r")
+	if !strings.Contains(model.message, "already being retried") {
+		t.Errorf("expected a running retry not to be started again, got %s", model.message)
+	}
+
+	if !model.update("q") {
+		t.Error("expected q to quit")
+	}
+}
@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewEventsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "events",
+		Short: "Inspect the events of the cached repositories",
+	}
+	cmd.AddCommand(newEventsCompatCmd())
+	return cmd
+}
+
+func newEventsCompatCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "compat <event>",
+		Short: "Show which schema versions of an event its subscribers accept",
+		Long: `Shows which schema versions of an event type the subscriptions of the cached repositories accept,
+according to their schema_version ranges. The versions checked are those the cached repositories
+declare for the event, in their event schemas or in the events their workflows produce, and the
+versions given with --version, such as that of a major release yet to come. Fan-outs exclude the
+subscribers that reject the schema version of their event.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			versions, _ := cmd.Flags().GetStringSlice("version")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			evaluator, err := engine.NewSubscriptionEvaluator()
+			if err != nil {
+				return err
+			}
+
+			compatibility, err := engine.NewDiscoveryManager(cacheDir).CheckEventCompatibility(args[0], versions, evaluator)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return encodeJSON(cmd, compatibility)
+			}
+			printEventCompatibility(cmd, compatibility)
+			return nil
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the compatibility as JSON")
+	cmd.Flags().StringSlice("version", nil, "Also check this schema version (repeatable)")
+	return cmd
+}
+
+// printEventCompatibility prints the schema versions of an event, then a table of its subscribers
+// with a column per version.
+func printEventCompatibility(cmd *cobra.Command, compatibility *engine.EventCompatibility) {
+	out := cmd.OutOrStdout()
+	if len(compatibility.Subscribers) == 0 {
+		fmt.Fprintf(out, "No subscriptions to %s found.\n", compatibility.EventType)
+		return
+	}
+	if len(compatibility.Versions) == 0 {
+		fmt.Fprintf(out, "No schema versions of %s are declared; use --version to check one.\n", compatibility.EventType)
+	}
+	for _, version := range compatibility.Versions {
+		emitters := "not declared"
+		if len(version.Emitters) > 0 {
+			emitters = "declared by " + strings.Join(version.Emitters, ", ")
+		}
+		fmt.Fprintf(out, "Schema version %s: %s\n", version.Version, emitters)
+	}
+	fmt.Fprintln(out)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprint(w, "REPOSITORY\tWORKFLOW\tACCEPTS")
+	for _, version := range compatibility.Versions {
+		fmt.Fprintf(w, "\t%s", version.Version)
+	}
+	fmt.Fprintln(w)
+	for _, subscriber := range compatibility.Subscribers {
+		accepts := subscriber.SchemaVersion
+		if accepts == "" {
+			accepts = "any"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s", subscriber.Repository, subscriber.Workflow, accepts)
+		for _, version := range compatibility.Versions {
+			switch {
+			case subscriber.Error != "":
+				fmt.Fprint(w, "\terror")
+			case subscriber.Accepts(version.Version):
+				fmt.Fprint(w, "\tyes")
+			default:
+				fmt.Fprint(w, "\tno")
+			}
+		}
+		fmt.Fprintln(w)
+	}
+	w.Flush()
+	for _, subscriber := range compatibility.Subscribers {
+		if subscriber.Error != "" {
+			fmt.Fprintf(out, "Error: %s:%s: %s\n", subscriber.Repository, subscriber.Workflow, subscriber.Error)
+		}
+	}
+}
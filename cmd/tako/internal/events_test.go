@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestEventsCompatCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedTakoYml(t, cacheDir, "my-org/go-lib", `version: 0.1.0
+events:
+  schemas:
+    - type: library_released
+      schema_version: "1.0.0"
+      fields:
+        version: string
+    - type: library_released
+      schema_version: "2.0.0"
+      fields:
+        version: string
+`)
+	writeCachedTakoYml(t, cacheDir, "my-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+subscriptions:
+  - artifact: my-org/go-lib:default
+    events: [library_released]
+    schema_version: "^1.0.0"
+    workflow: update
+`)
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"events", "compat", "library_released", "--version", "3.0.0", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute events compat: %v", err)
+	}
+	output := b.String()
+	for _, expected := range []string{
+		"Schema version 2.0.0: declared by my-org/go-lib",
+		"Schema version 3.0.0: not declared",
+		"REPOSITORY  WORKFLOW  ACCEPTS  1.0.0  2.0.0  3.0.0",
+		"my-org/app  update    ^1.0.0   yes    no     no",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"events", "compat", "library_released", "--json", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute events compat --json: %v", err)
+	}
+	var compatibility engine.EventCompatibility
+	if err := json.Unmarshal(b.Bytes(), &compatibility); err != nil {
+		t.Fatalf("failed to decode output: %v", err)
+	}
+	if len(compatibility.Versions) != 2 || len(compatibility.Subscribers) != 1 || compatibility.Subscribers[0].Rejected[0] != "2.0.0" {
+		t.Errorf("unexpected compatibility: %+v", compatibility)
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"events", "compat", "unknown_event", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute events compat: %v", err)
+	}
+	if !strings.Contains(b.String(), "No subscriptions to unknown_event found.") {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+}
@@ -3,11 +3,14 @@ package internal
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
-	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/dangazineu/tako/internal/auth"
 	"github.com/dangazineu/tako/internal/engine"
+	"github.com/dangazineu/tako/internal/interfaces"
 	"github.com/spf13/cobra"
 )
 
@@ -16,48 +19,167 @@ func NewExecCmd() *cobra.Command {
 		Use:   "exec <workflow-name>",
 		Short: "Execute a workflow",
 		Long: `Executes a workflow defined in the tako.yml file.
-You can specify a workflow by its name.`,
+You can specify a workflow by its name. With --repo, the workflow of that repository is run, and
+its fan-out steps run the workflows of the repositories depending on it across the dependency
+graph, at most --max-concurrent-repos at once. --wait and --no-wait override whether fan-outs wait
+for the workflows they trigger. With --idempotent, a fan-out of an event that was already fanned
+out returns the earlier result instead of triggering the subscribers again; tako state inspects
+and expires the states that remember those events.
+
+Each run writes a lockfile, tako.lock in the workspace of the run, with the exact commit every
+repository of the execution tree ran against. --lockfile reproduces a past run against the commits
+of its lockfile: --repo and the subscribers of fan-outs are checked out at their locked commits,
+and a local repository must already be at its locked commit.
+
+With --since, the fan-outs only run the subtree affected by the changes since a git ref, including
+changes not committed yet and untracked files: when the repository of the run did not change, its
+fan-outs only trigger the subscribers whose repositories changed, and the workflows they trigger
+fan out to all their subscribers.
+
+Each run also writes its provenance, an in-toto statement of SLSA provenance of the commits, steps,
+events, child workflows and published artifacts of the run, to the append-only provenance store of
+the cache. --provenance-key signs it with a local key in a DSSE envelope, and --provenance-keyless
+with Sigstore keyless signing through cosign; tako provenance shows and verifies it.`,
 		Args: cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			workflowName := args[0]
 			repo, _ := cmd.Flags().GetString("repo")
 			resume, _ := cmd.Flags().GetString("resume")
 			dryRun, _ := cmd.Flags().GetBool("dry-run")
+			simulate, _ := cmd.Flags().GetBool("simulate")
 			debug, _ := cmd.Flags().GetBool("debug")
 			noCache, _ := cmd.Flags().GetBool("no-cache")
 			maxConcurrentRepos, _ := cmd.Flags().GetInt("max-concurrent-repos")
+			maxFanOutDepth, _ := cmd.Flags().GetInt("max-fanout-depth")
+			maxTotalChildren, _ := cmd.Flags().GetInt("max-total-children")
+			keepWorkspaceOnFailure, _ := cmd.Flags().GetBool("keep-workspace-on-failure")
+			interactive, _ := cmd.Flags().GetBool("interactive")
+			profile, _ := cmd.Flags().GetString("profile")
+			outputTail, _ := cmd.Flags().GetInt("output-tail")
+			logMaxSize, _ := cmd.Flags().GetInt64("log-max-size")
+			logMaxFiles, _ := cmd.Flags().GetInt("log-max-files")
+			follow, _ := cmd.Flags().GetBool("follow")
+			reportFormat, _ := cmd.Flags().GetString("report-format")
+			reportPath, _ := cmd.Flags().GetString("report-path")
+			asJSON, _ := cmd.Flags().GetBool("json")
+			lockfile, _ := cmd.Flags().GetString("lockfile")
+			provenanceKey, _ := cmd.Flags().GetString("provenance-key")
+			provenanceKeyless, _ := cmd.Flags().GetBool("provenance-keyless")
+			since, _ := cmd.Flags().GetString("since")
 
-			// Get cache directory
-			cacheDir, _ := cmd.Flags().GetString("cache-dir")
-			if cacheDir == "" {
-				homeDir, err := os.UserHomeDir()
+			// Inject faults into the run, for chaos testing in builds with the faults tag
+			var faults *engine.FaultInjector
+			if spec, _ := cmd.Flags().GetString("inject-faults"); spec != "" {
+				if !engine.FaultInjectionEnabled {
+					return fmt.Errorf("--inject-faults requires tako to be built with the faults build tag")
+				}
+				parsed, err := engine.ParseFaults(spec)
 				if err != nil {
-					return fmt.Errorf("failed to get user home directory: %v", err)
+					return fmt.Errorf("invalid --inject-faults: %v", err)
 				}
-				cacheDir = filepath.Join(homeDir, ".tako", "cache")
+				faults = engine.NewFaultInjector(parsed...)
 			}
 
-			inputs := make(map[string]string)
-			for _, arg := range os.Args {
-				if strings.HasPrefix(arg, "--inputs.") {
-					parts := strings.SplitN(strings.TrimPrefix(arg, "--inputs."), "=", 2)
-					if len(parts) == 2 {
-						inputs[parts[0]] = parts[1]
-					}
+			// Pin the repositories of the execution tree to the commits of a past run
+			var revisions *engine.RevisionLock
+			if lockfile != "" {
+				replay, err := engine.LoadLockfile(lockfile)
+				if err != nil {
+					return err
 				}
+				revisions = engine.NewRevisionLock(replay)
 			}
 
-			fmt.Printf("Executing workflow '%s'\n", workflowName)
-			if repo != "" {
-				fmt.Printf("Repository: %s\n", repo)
+			// Configure the retries, circuit breakers and idempotency of fan-outs
+			fanOuts, err := engine.NewFanOutOptions(userConfig(cmd))
+			if err != nil {
+				return err
 			}
-			if resume != "" {
-				fmt.Printf("Resuming from: %s\n", resume)
+			if cmd.Flags().Changed("idempotent") {
+				fanOuts.Idempotency, _ = cmd.Flags().GetBool("idempotent")
+			}
+			retention, err := engine.NewRetentionOptions(userConfig(cmd))
+			if err != nil {
+				return err
+			}
+
+			// Select the container runtime, from the flag or the environment
+			containerRuntime, _ := cmd.Flags().GetString("container-runtime")
+			if containerRuntime == "" {
+				containerRuntime = os.Getenv("TAKO_CONTAINER_RUNTIME")
 			}
-			if len(inputs) > 0 {
-				fmt.Println("Inputs:")
-				for k, v := range inputs {
-					fmt.Printf("  %s: %s\n", k, v)
+			if _, err := engine.ParseContainerRuntime(containerRuntime); err != nil {
+				return err
+			}
+
+			// Configure cloning and fetching of repositories; tokens come from the environment
+			localOnly, _ := cmd.Flags().GetBool("local-only")
+			gitProtocol, _ := cmd.Flags().GetString("git-protocol")
+			fetchInterval, _ := cmd.Flags().GetDuration("fetch-interval")
+			prefetch, _ := cmd.Flags().GetBool("prefetch")
+			gitAuth, err := auth.FromEnvironment(os.Environ())
+			if err != nil {
+				return err
+			}
+
+			// Select the backend of child workflows and configure remote execution on GitHub Actions
+			backend, _ := cmd.Flags().GetString("backend")
+			remote, _ := cmd.Flags().GetBool("remote")
+			remoteDispatch, _ := cmd.Flags().GetString("remote-dispatch")
+			remoteWorkflow, _ := cmd.Flags().GetString("remote-workflow")
+			remotePollInterval, _ := cmd.Flags().GetDuration("remote-poll-interval")
+			remoteTimeout, _ := cmd.Flags().GetDuration("remote-timeout")
+
+			// Configure the Jobs of the kubernetes backend
+			kubernetesNamespace, _ := cmd.Flags().GetString("kubernetes-namespace")
+			kubernetesImage, _ := cmd.Flags().GetString("kubernetes-image")
+			kubernetesContext, _ := cmd.Flags().GetString("kubernetes-context")
+			kubernetesServiceAccount, _ := cmd.Flags().GetString("kubernetes-service-account")
+			kubernetesEnvSecret, _ := cmd.Flags().GetString("kubernetes-env-secret")
+
+			// Get the cache directory and workspace root of the namespace
+			namespace, err := resolveNamespace(cmd)
+			if err != nil {
+				return err
+			}
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			inputs := workflowInputs(cmd, os.Args)
+
+			// Override whether the fan-outs of the workflow wait for their children
+			wait, _ := cmd.Flags().GetBool("wait")
+			noWait, _ := cmd.Flags().GetBool("no-wait")
+			var waitForChildren *bool
+			switch {
+			case wait:
+				waitForChildren = &wait
+			case noWait:
+				waitForChildren = new(bool)
+			}
+
+			// The JSON result is the only output of --json
+			if !asJSON {
+				fmt.Printf("Executing workflow '%s'\n", workflowName)
+				if repo != "" {
+					fmt.Printf("Repository: %s\n", repo)
+				}
+				if profile != "" {
+					fmt.Printf("Profile: %s\n", profile)
+				}
+				if resume != "" {
+					fmt.Printf("Resuming from: %s\n", resume)
+				}
+				if lockfile != "" {
+					fmt.Printf("Lockfile: %s\n", lockfile)
+				}
+				if len(inputs) > 0 {
+					fmt.Println("Inputs:")
+					for k, v := range inputs {
+						fmt.Printf("  %s: %s\n", k, v)
+					}
 				}
 			}
 
@@ -66,22 +188,83 @@ You can specify a workflow by its name.`,
 				return handleResumeExecution(resume, cacheDir)
 			}
 
-			// Determine workspace root
-			homeDir, err := os.UserHomeDir()
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
 			if err != nil {
-				return fmt.Errorf("failed to get user home directory: %v", err)
+				return err
 			}
-			workspaceRoot := filepath.Join(homeDir, ".tako", "workspaces")
 
 			// Create execution runner
 			runnerOpts := engine.RunnerOptions{
 				WorkspaceRoot:      workspaceRoot,
 				CacheDir:           cacheDir,
 				MaxConcurrentRepos: maxConcurrentRepos,
+				MaxFanOutDepth:     maxFanOutDepth,
+				MaxTotalChildren:   maxTotalChildren,
 				DryRun:             dryRun,
 				Debug:              debug,
 				NoCache:            noCache,
 				Environment:        os.Environ(),
+				Namespace:          namespace,
+				Profile:            profile,
+				WaitForChildren:    waitForChildren,
+
+				KeepWorkspaceOnFailure: keepWorkspaceOnFailure,
+				ContainerRuntime:       containerRuntime,
+				Git: engine.GitOptions{
+					LocalOnly:     localOnly,
+					Protocol:      gitProtocol,
+					Auth:          gitAuth,
+					FetchInterval: fetchInterval,
+					Prefetch:      prefetch,
+				},
+				Backend: backend,
+				Remote: engine.RemoteOptions{
+					Enabled:      remote,
+					Dispatch:     remoteDispatch,
+					WorkflowFile: remoteWorkflow,
+					PollInterval: remotePollInterval,
+					Timeout:      remoteTimeout,
+					BaseURL:      os.Getenv("TAKO_GITHUB_API_URL"),
+					Auth:         gitAuth,
+				},
+				Kubernetes: engine.KubernetesOptions{
+					Namespace:      kubernetesNamespace,
+					Image:          kubernetesImage,
+					Context:        kubernetesContext,
+					ServiceAccount: kubernetesServiceAccount,
+					EnvSecret:      kubernetesEnvSecret,
+				},
+				Logs: engine.LogOptions{
+					MaxFileSize: logMaxSize,
+					MaxFiles:    logMaxFiles,
+					OutputTail:  outputTail,
+				},
+				Report: engine.ReportOptions{
+					Format: reportFormat,
+					Path:   reportPath,
+				},
+				FanOuts:      fanOuts,
+				Retention:    retention,
+				Faults:       faults,
+				Revisions:    revisions,
+				ChangedSince: since,
+				Provenance: engine.ProvenanceOptions{
+					SigningKey: provenanceKey,
+					Keyless:    provenanceKeyless,
+				},
+			}
+			if version, err := deriveVersion(); err == nil {
+				runnerOpts.Provenance.BuilderVersion = version
+			}
+
+			// Stream the output of the steps, and of the child workflows, as they run
+			if follow {
+				runnerOpts.Logs.Follow = cmd.OutOrStdout()
+			}
+
+			// Ask for the missing required inputs instead of failing
+			if interactive {
+				runnerOpts.PromptInputs = newInputPrompter(cmd.InOrStdin(), cmd.OutOrStdout())
 			}
 
 			runner, err := engine.NewRunner(runnerOpts)
@@ -90,7 +273,35 @@ You can specify a workflow by its name.`,
 			}
 			defer runner.Close()
 
-			ctx := context.Background()
+			// The tree the run would start is walked without running any step
+			if simulate {
+				var tree *engine.SimulatedWorkflow
+				if repo != "" {
+					tree, err = runner.SimulateMultiRepoWorkflow(context.Background(), workflowName, inputs, repo)
+				} else {
+					repoPath, pathErr := determineRepositoryPath(cmd)
+					if pathErr != nil {
+						return fmt.Errorf("failed to determine repository path: %v", pathErr)
+					}
+					tree, err = runner.SimulateWorkflow(context.Background(), workflowName, inputs, repoPath)
+				}
+				if tree != nil {
+					printSimulation(cmd.OutOrStdout(), tree)
+				}
+				if err != nil {
+					return fmt.Errorf("simulation failed: %v", err)
+				}
+				return nil
+			}
+
+			// Runs and fan-outs left running by killed processes are recovered first
+			if _, err := runner.Reconcile(engine.DefaultOrphanStaleAfter); err != nil {
+				fmt.Fprintf(cmd.ErrOrStderr(), "Warning: failed to recover interrupted runs: %v\n", err)
+			}
+
+			// Interrupted runs persist their state before the process exits
+			ctx, stop := engine.NotifyInterrupt(context.Background())
+			defer stop()
 
 			if repo != "" {
 				// Multi-repository execution mode
@@ -98,7 +309,10 @@ You can specify a workflow by its name.`,
 				if err != nil {
 					return fmt.Errorf("multi-repository execution failed: %v", err)
 				}
-				return printExecutionResult(result)
+				if asJSON {
+					return printExecutionResultJSON(cmd, result)
+				}
+				return printExecutionResult(result, runner.ReportPath(), runner.LockfilePath(), runner.ProvenancePath())
 			} else {
 				// Single-repository execution mode
 				repoPath, err := determineRepositoryPath(cmd)
@@ -110,25 +324,94 @@ You can specify a workflow by its name.`,
 				if err != nil {
 					return fmt.Errorf("workflow execution failed: %v", err)
 				}
-				return printExecutionResult(result)
+				if asJSON {
+					return printExecutionResultJSON(cmd, result)
+				}
+				return printExecutionResult(result, runner.ReportPath(), runner.LockfilePath(), runner.ProvenancePath())
 			}
 		},
 	}
 
 	cmd.Flags().String("repo", "", "Specify the repository to run the workflow in (e.g., my-org/my-repo)")
 	cmd.Flags().String("resume", "", "Resume a previous workflow execution by providing the run ID")
-	cmd.Flags().StringToString("inputs", nil, "Pass input variables to the workflow (e.g., --inputs.version-bump=minor)")
+	cmd.Flags().StringToString("inputs", nil, "Pass input variables to the workflow (e.g., --inputs version-bump=minor or --inputs.version-bump=minor)")
+	cmd.Flags().Bool("wait", false, "Make the fan-out steps of the workflow wait for the child workflows they trigger")
+	cmd.Flags().Bool("no-wait", false, "Make the fan-out steps of the workflow only trigger their child workflows, without waiting for them")
+	cmd.Flags().Bool("idempotent", false, "Do not trigger the subscribers of events that were already fanned out (default: idempotency of ~/.tako/config.yml)")
 	cmd.Flags().Bool("dry-run", false, "Show the execution plan without making any changes")
+	cmd.Flags().Bool("simulate", false, "Print the tree of workflows the fan-outs of the run would trigger, with their resolved inputs, without running any step")
 	cmd.Flags().Bool("no-cache", false, "Invalidate the cache and execute all steps")
 	cmd.Flags().Int("max-concurrent-repos", 4, "Maximum number of repositories to process in parallel")
+	cmd.Flags().Int("max-fanout-depth", engine.DefaultMaxFanOutDepth, "Maximum depth of the fan-out children of the run; deeper event chains fail")
+	cmd.Flags().Int("max-total-children", 0, "Maximum child workflows triggered by the fan-outs of the whole run (default: execution.max_total_children of tako.yml, or 200)")
 	cmd.Flags().Bool("debug", false, "Enable interactive step-by-step execution")
+	cmd.Flags().Bool("keep-workspace-on-failure", false, "Keep the isolated workspaces of failed runs for debugging")
+	cmd.Flags().String("profile", "", "Profile of tako.yml merged over the workflow, such as prod")
+	cmd.Flags().Bool("interactive", false, "Prompt for the required inputs that were not provided instead of failing")
 	cmd.Flags().String("cache-dir", "", "Directory for caching repositories (default: ~/.tako/cache)")
 	cmd.Flags().String("root", "", "Root directory for local repository execution")
+	cmd.Flags().String("container-runtime", "", "Container runtime to use: auto, docker, podman or nerdctl (default: $TAKO_CONTAINER_RUNTIME, or auto)")
+	cmd.Flags().Bool("local-only", false, "Only use repositories already in the cache, never clone or fetch them")
+	cmd.Flags().String("git-protocol", "https", "Protocol used to clone repositories: https or ssh (HTTPS uses $TAKO_GIT_TOKEN or $GITHUB_TOKEN when set)")
+	cmd.Flags().Duration("fetch-interval", engine.DefaultGitFetchInterval, "How long a cached repository is used before it is fetched again (negative to always fetch)")
+	cmd.Flags().Bool("prefetch", false, "Clone or fetch the repositories subscribing to the events the workflow emits in the background when it starts")
+	cmd.Flags().String("backend", "", "Backend of child workflows: local, container, remote, kubernetes or noop (default: execution.backend of tako.yml, or local)")
+	cmd.Flags().Bool("remote", false, "Run child workflows on GitHub Actions instead of locally (same as --backend remote)")
+	cmd.Flags().String("remote-dispatch", engine.RemoteDispatchWorkflow, "How remote child workflows are triggered: workflow_dispatch or repository_dispatch")
+	cmd.Flags().String("remote-workflow", engine.DefaultRemoteWorkflowFile, "GitHub Actions workflow file triggered by workflow_dispatch")
+	cmd.Flags().Duration("remote-poll-interval", engine.DefaultRemotePollInterval, "How often the check runs of remote child workflows are polled")
+	cmd.Flags().Duration("remote-timeout", engine.DefaultRemoteTimeout, "How long a remote child workflow is awaited")
+	cmd.Flags().String("kubernetes-namespace", engine.DefaultKubernetesNamespace, "Namespace of the Jobs of the kubernetes backend")
+	cmd.Flags().String("kubernetes-image", "", "Image with tako running the Jobs of the kubernetes backend, unless tako.yml sets one")
+	cmd.Flags().String("kubernetes-context", "", "Kubeconfig context of the kubernetes backend (default: the current context)")
+	cmd.Flags().String("kubernetes-service-account", "", "Service account of the Jobs of the kubernetes backend")
+	cmd.Flags().String("kubernetes-env-secret", "", "Secret whose keys are set as environment variables of the Jobs, e.g. TAKO_GITHUB_TOKEN")
+	cmd.Flags().Bool("json", false, "Output the result of the run as JSON, with the results of the child workflows of its fan-outs nested under them")
+	cmd.Flags().Bool("follow", false, "Stream the output of steps as they run, including child workflows, prefixed with their repository and step")
+	cmd.Flags().String("report-format", engine.ReportFormatJSON, "Format of the execution report written after the run: json, junit, sarif or none")
+	cmd.Flags().String("lockfile", "", "Lockfile of a past run whose commits the repositories of the execution tree are pinned to")
+	cmd.Flags().String("since", "", "Only fan out to the repositories that changed since this git ref, unless the repository of the run changed")
+	cmd.Flags().String("provenance-key", "", "PEM file of the Ed25519 or ECDSA private key signing the provenance of the run in a DSSE envelope")
+	cmd.Flags().Bool("provenance-keyless", false, "Sign the provenance of the run with Sigstore keyless signing, through cosign sign-blob")
+	cmd.Flags().String("report-path", "", "File the execution report is written to (default: report.<ext> in the workspace of the run, ~/.tako/workspaces/<run-id>)")
+	cmd.Flags().Int("output-tail", engine.DefaultStepOutputTail, "Bytes of the end of the output of steps kept in their results; the full output is in their logs")
+	cmd.Flags().Int64("log-max-size", engine.DefaultStepLogMaxSize, "Size in bytes at which step logs are rotated")
+	cmd.Flags().Int("log-max-files", engine.DefaultStepLogMaxFiles, "Rotated files kept per step log; older output is dropped")
+	cmd.Flags().String("inject-faults", "", "Faults injected into the run for chaos testing, like $TAKO_FAULTS (builds with the faults tag only)")
+	cmd.Flags().MarkHidden("inject-faults")
+	cmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
 	cmd.FParseErrWhitelist.UnknownFlags = true
 
 	return cmd
 }
 
+// workflowInputs returns the workflow inputs given as --inputs <name>=<value> flags, which may be
+// repeated or comma-separated, and as --inputs.<name>=<value> arguments, which take precedence.
+func workflowInputs(cmd *cobra.Command, args []string) map[string]string {
+	inputs := inputsFromArgs(args)
+	flagInputs, _ := cmd.Flags().GetStringToString("inputs")
+	for name, value := range flagInputs {
+		if _, ok := inputs[name]; !ok {
+			inputs[name] = value
+		}
+	}
+	return inputs
+}
+
+// inputsFromArgs returns the workflow inputs given as --inputs.<name>=<value> arguments.
+func inputsFromArgs(args []string) map[string]string {
+	inputs := make(map[string]string)
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "--inputs.") {
+			parts := strings.SplitN(strings.TrimPrefix(arg, "--inputs."), "=", 2)
+			if len(parts) == 2 {
+				inputs[parts[0]] = parts[1]
+			}
+		}
+	}
+	return inputs
+}
+
 // handleResumeExecution handles resuming a previous execution.
 func handleResumeExecution(runID, cacheDir string) error {
 	// TODO: Implement resume functionality
@@ -153,8 +436,53 @@ func determineRepositoryPath(cmd *cobra.Command) (string, error) {
 	return cwd, nil
 }
 
-// printExecutionResult prints the execution result.
-func printExecutionResult(result *engine.ExecutionResult) error {
+// printSimulation prints the tree of workflows walked by a simulation.
+func printSimulation(w io.Writer, tree *engine.SimulatedWorkflow) {
+	fmt.Fprintf(w, "\nSimulated execution tree (%d workflows):\n", tree.Count())
+	printSimulatedWorkflow(w, tree, "  ")
+}
+
+// printSimulatedWorkflow prints a simulated workflow and its fan-outs at the given indentation.
+func printSimulatedWorkflow(w io.Writer, workflow *engine.SimulatedWorkflow, indent string) {
+	fmt.Fprintf(w, "%s%s: %s", indent, workflow.Repository, workflow.Workflow)
+	if len(workflow.Inputs) > 0 {
+		names := make([]string, 0, len(workflow.Inputs))
+		for name := range workflow.Inputs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, 0, len(names))
+		for _, name := range names {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", name, workflow.Inputs[name]))
+		}
+		fmt.Fprintf(w, " (%s)", strings.Join(pairs, ", "))
+	}
+	fmt.Fprintln(w)
+	if workflow.Error != "" {
+		fmt.Fprintf(w, "%s  ✗ %s\n", indent, workflow.Error)
+	}
+
+	for _, fanOut := range workflow.FanOuts {
+		fmt.Fprintf(w, "%s  ↳ step %s emits '%s'", indent, fanOut.StepID, fanOut.EventType)
+		if fanOut.Condition != "" {
+			fmt.Fprintf(w, " if %s", fanOut.Condition)
+		}
+		fmt.Fprintln(w)
+		if fanOut.Error != "" {
+			fmt.Fprintf(w, "%s    ✗ %s\n", indent, fanOut.Error)
+		}
+		for _, child := range fanOut.Children {
+			printSimulatedWorkflow(w, child, indent+"    ")
+		}
+		for _, skipped := range fanOut.Skipped {
+			fmt.Fprintf(w, "%s    - %s: %s skipped: %s\n", indent, skipped.Repository, skipped.Workflow, skipped.Reason)
+		}
+	}
+}
+
+// printExecutionResult prints the execution result, and where its report, lockfile and
+// provenance were written.
+func printExecutionResult(result *engine.ExecutionResult, reportPath, lockfilePath, provenancePath string) error {
 	if result == nil {
 		return fmt.Errorf("no execution result")
 	}
@@ -162,6 +490,15 @@ func printExecutionResult(result *engine.ExecutionResult) error {
 	fmt.Printf("\nExecution completed: %s\n", result.RunID)
 	fmt.Printf("Success: %v\n", result.Success)
 	fmt.Printf("Duration: %v\n", result.EndTime.Sub(result.StartTime))
+	if reportPath != "" {
+		fmt.Printf("Report: %s\n", reportPath)
+	}
+	if lockfilePath != "" {
+		fmt.Printf("Lockfile: %s\n", lockfilePath)
+	}
+	if provenancePath != "" {
+		fmt.Printf("Provenance: %s\n", provenancePath)
+	}
 
 	if result.Error != nil {
 		fmt.Printf("Error: %v\n", result.Error)
@@ -174,13 +511,65 @@ func printExecutionResult(result *engine.ExecutionResult) error {
 			if !step.Success {
 				status = "✗"
 			}
+			if step.Cached {
+				fmt.Printf("  %s %s (cached)\n", status, step.ID)
+				continue
+			}
+			if step.AllowedFailure {
+				fmt.Printf("  %s %s (%v, failure allowed)\n", status, step.ID, step.EndTime.Sub(step.StartTime))
+				continue
+			}
 			fmt.Printf("  %s %s (%v)\n", status, step.ID, step.EndTime.Sub(step.StartTime))
 		}
 	}
 
+	if len(result.Children) > 0 {
+		fmt.Printf("\nChild workflows triggered: %d\n", len(result.Children))
+		printChildResults(os.Stdout, result.Children, "  ")
+	}
+
 	if !result.Success {
 		return fmt.Errorf("execution failed")
 	}
 
 	return nil
 }
+
+// printExecutionResultJSON prints the execution result, and those of its child workflows, as JSON.
+func printExecutionResultJSON(cmd *cobra.Command, result *engine.ExecutionResult) error {
+	if result == nil {
+		return fmt.Errorf("no execution result")
+	}
+	if err := encodeJSON(cmd, result); err != nil {
+		return err
+	}
+	if !result.Success {
+		return fmt.Errorf("execution failed")
+	}
+	return nil
+}
+
+// printChildResults prints the child workflows of fan-outs, and their own children, at the given
+// indentation.
+func printChildResults(w io.Writer, children []interfaces.ChildResult, indent string) {
+	for _, child := range children {
+		status := "✗"
+		switch engine.ChildWorkflowStatus(child.Status) {
+		case engine.ChildStatusCompleted:
+			status = "✓"
+		case engine.ChildStatusSkipped:
+			status = "-"
+		}
+		fmt.Fprintf(w, "%s%s %s: %s (%s", indent, status, child.Repository, child.Workflow, child.Status)
+		if child.Result != nil {
+			fmt.Fprintf(w, ", %d steps, %v", len(child.Result.Steps), child.Result.EndTime.Sub(child.Result.StartTime))
+		}
+		fmt.Fprintln(w, ")")
+		if child.Error != "" {
+			fmt.Fprintf(w, "%s    %s\n", indent, child.Error)
+		}
+		if child.Result != nil {
+			printChildResults(w, child.Result.Children, indent+"  ")
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+func TestWorkflowInputs(t *testing.T) {
+	args := []string{"--inputs", "version=1.0.0,env=dev", "--inputs", "bump=minor", "--inputs.env=prod"}
+	cmd := NewExecCmd()
+	if err := cmd.ParseFlags(args); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+
+	got := workflowInputs(cmd, append([]string{"tako", "exec", "build"}, args...))
+	want := map[string]string{"version": "1.0.0", "env": "prod", "bump": "minor"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("workflowInputs() = %v, want %v", got, want)
+	}
+}
+
+func TestExecCmd_WaitFlags(t *testing.T) {
+	cmd := NewRootCmd()
+	cmd.SetArgs([]string{"exec", "build", "--wait", "--no-wait", "--cache-dir", t.TempDir()})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "[no-wait wait] were all set") {
+		t.Errorf("expected --wait and --no-wait to be mutually exclusive, got %v", err)
+	}
+}
+
+func TestPrintChildResults(t *testing.T) {
+	children := []interfaces.ChildResult{
+		{Repository: "org/app", Workflow: "update", Status: "completed", Result: &interfaces.ExecutionResult{
+			Children: []interfaces.ChildResult{{Repository: "org/deploy", Workflow: "deploy", Status: "failed", Error: "step failed"}},
+		}},
+		{Repository: "org/docs", Workflow: "publish", Status: "skipped"},
+	}
+
+	var b bytes.Buffer
+	printChildResults(&b, children, "  ")
+	want := `  ✓ org/app: update (completed, 0 steps, 0s)
+    ✗ org/deploy: deploy (failed)
+        step failed
+  - org/docs: publish (skipped)
+`
+	if b.String() != want {
+		t.Errorf("printChildResults() =\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestExecCmd_JSON(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	takoYml := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - id: compile
+        run: echo compiled
+`
+	if err := os.WriteFile(filepath.Join(root, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"exec", "build", "--root", root, "--cache-dir", t.TempDir(), "--local-only", "--report-format", "none", "--json"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute exec command: %v", err)
+	}
+
+	var result interfaces.ExecutionResult
+	if err := json.Unmarshal(b.Bytes(), &result); err != nil {
+		t.Fatalf("expected the result as JSON, got %q: %v", b.String(), err)
+	}
+	if !result.Success || len(result.Steps) != 1 || result.Steps[0].ID != "compile" {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewGCCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc",
+		Short: "Remove the artifacts of finished runs past their retention",
+		Long: `Removes the artifacts of finished runs that are older than their retention, and the stale locks
+of dead processes: the execution states of child runs and the states of fan-outs (--states),
+the files left in the workspaces of runs (--workspaces), their step logs and reports (--logs)
+and the records of tako history (--history). Ages are counted from the last update of the
+artifacts, and a retention of 0 keeps them forever. The artifacts of runs in progress are never
+removed.
+
+Retentions default to the retention section of ~/.tako/config.yml, or to 168h for states, 24h
+for workspaces, 720h for logs and 2160h for history. With compact_on_start: true in that
+section, runs and the daemon compact the artifacts in the background when they start, at most
+once an hour. Repository clones are evicted by tako cache gc.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			retention, err := engine.NewRetentionOptions(userConfig(cmd))
+			if err != nil {
+				return err
+			}
+			policies := retention.Policies
+			for name, policy := range map[string]*time.Duration{
+				"states":     &policies.States,
+				"workspaces": &policies.Workspaces,
+				"logs":       &policies.Logs,
+				"history":    &policies.History,
+			} {
+				if cmd.Flags().Changed(name) {
+					*policy, _ = cmd.Flags().GetDuration(name)
+				}
+			}
+
+			report, err := engine.NewRetentionManager(cacheDir, workspaceRoot, policies).Compact()
+			if asJSON {
+				if encodeErr := encodeJSON(cmd, report); encodeErr != nil && err == nil {
+					err = encodeErr
+				}
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Removed %d execution states, %d fan-out states, %d stale locks, %d workspaces, %d logs and %d history records, freeing %s.\n",
+				report.ExecutionStates, report.FanOutStates, report.Locks, report.Workspaces, report.Logs, report.HistoryRecords, cache.FormatSize(report.Freed))
+			return err
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output what was removed as JSON")
+	cmd.Flags().Duration("states", engine.DefaultStateRetention, "Retention of the execution states of child runs and of fan-out states")
+	cmd.Flags().Duration("workspaces", engine.DefaultWorkspaceRetention, "Retention of the files left in the workspaces of runs")
+	cmd.Flags().Duration("logs", engine.DefaultLogRetention, "Retention of the step logs and reports of runs")
+	cmd.Flags().Duration("history", engine.DefaultHistoryRetention, "Retention of the records of tako history")
+	return cmd
+}
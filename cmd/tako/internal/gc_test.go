@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestGCCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cacheDir := t.TempDir()
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	for _, record := range []engine.HistoryRecord{
+		{RunID: "exec-old", EndTime: time.Now().Add(-48 * time.Hour)},
+		{RunID: "exec-older", EndTime: time.Now().Add(-72 * time.Hour)},
+		{RunID: "exec-new", EndTime: time.Now()},
+	} {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	run := func(args ...string) (string, error) {
+		b := bytes.NewBufferString("")
+		cmd := NewRootCmd()
+		cmd.SetOut(b)
+		cmd.SetArgs(append(append([]string{"gc"}, args...), "--cache-dir", cacheDir))
+		err := cmd.Execute()
+		return b.String(), err
+	}
+
+	out, err := run("--history", "60h")
+	if err != nil || !strings.Contains(out, "0 logs and 1 history records") {
+		t.Fatalf("expected the history record past its retention removed, got %q, %v", out, err)
+	}
+
+	out, err = run("--history", "24h", "--json")
+	if err != nil {
+		t.Fatalf("failed to collect garbage: %v", err)
+	}
+	var report engine.CompactionReport
+	if err := json.Unmarshal([]byte(out), &report); err != nil || report.HistoryRecords != 1 {
+		t.Errorf("expected the report as JSON, got %q: %v", out, err)
+	}
+	if records, _ := history.Query(engine.HistoryFilter{}); len(records) != 1 {
+		t.Errorf("expected the recent history record kept, got %+v", records)
+	}
+}
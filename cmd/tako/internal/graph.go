@@ -1,11 +1,15 @@
 package internal
 
 import (
+	"fmt"
+	"github.com/dangazineu/tako/internal/engine"
 	"github.com/dangazineu/tako/internal/git"
 	"github.com/dangazineu/tako/internal/graph"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
 	"strings"
+	"text/tabwriter"
 )
 
 func NewGraphCmd() *cobra.Command {
@@ -13,55 +17,175 @@ func NewGraphCmd() *cobra.Command {
 		Use:   "graph",
 		Short: "Displays the dependency graph",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			root, _ := cmd.Flags().GetString("root")
-			repo, _ := cmd.Flags().GetString("repo")
-			local, _ := cmd.Flags().GetBool("local")
 			dot, _ := cmd.Flags().GetBool("dot")
-			cacheDir, _ := cmd.InheritedFlags().GetString("cache-dir")
 
-			workingDir, err := os.Getwd()
+			rootNode, err := buildEntrypointGraph(cmd)
 			if err != nil {
 				return err
 			}
-			homeDir, err := os.UserHomeDir()
+
+			if dot {
+				graph.PrintDot(cmd.OutOrStdout(), rootNode)
+			} else {
+				graph.PrintGraph(cmd.OutOrStdout(), rootNode)
+			}
+			return nil
+		},
+	}
+	cmd.PersistentFlags().String("root", "", "The root directory of the project")
+	cmd.PersistentFlags().String("repo", "", "The remote repository to use as the entrypoint (e.g. owner/repo:ref)")
+	cmd.PersistentFlags().Bool("local", false, "Only use local repositories, do not clone or update remote repositories")
+	cmd.Flags().Bool("dot", false, "Output the graph in DOT format")
+	cmd.AddCommand(newGraphRelatedCmd("dependents", "Show the repositories that depend on a repository, which a change to it rebuilds"))
+	cmd.AddCommand(newGraphRelatedCmd("dependencies", "Show the repositories a repository depends on"))
+	cmd.AddCommand(newGraphImpactCmd())
+	return cmd
+}
+
+// buildEntrypointGraph builds the dependency graph of the entrypoint given by the --root,
+// --repo and --local flags.
+func buildEntrypointGraph(cmd *cobra.Command) (*graph.Node, error) {
+	root, _ := cmd.Flags().GetString("root")
+	repo, _ := cmd.Flags().GetString("repo")
+	local, _ := cmd.Flags().GetBool("local")
+	cacheDir, err := resolveCacheDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	workingDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	entrypointPath, err := git.GetEntrypointPath(root, repo, cacheDir, workingDir, homeDir, local)
+	if err != nil {
+		return nil, err
+	}
+
+	var repoName string
+	if repo != "" {
+		repoName = strings.Split(repo, ":")[0]
+	} else {
+		repoName, err = git.GetRepoName(entrypointPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return graph.BuildGraph(repoName, entrypointPath, cacheDir, homeDir, local)
+}
+
+// newGraphRelatedCmd creates the dependents or dependencies subcommand of the graph command.
+func newGraphRelatedCmd(name, short string) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   name + " <repo>",
+		Short: short,
+		Long: short + `, directly or through other repositories, in the dependency graph of the
+entrypoint, by depth: 1 for direct ones, 2 for theirs, and so on. --depth limits how deep to look.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			depth, _ := cmd.Flags().GetInt("depth")
+			asJSON, _ := cmd.Flags().GetBool("json")
+			if depth < 0 {
+				return fmt.Errorf("--depth must not be negative")
+			}
+
+			rootNode, err := buildEntrypointGraph(cmd)
 			if err != nil {
 				return err
 			}
-
-			entrypointPath, err := git.GetEntrypointPath(root, repo, cacheDir, workingDir, homeDir, local)
+			var related []graph.Related
+			if name == "dependents" {
+				related, err = rootNode.Dependents(args[0], depth)
+			} else {
+				related, err = rootNode.Dependencies(args[0], depth)
+			}
 			if err != nil {
 				return err
 			}
 
-			var repoName string
-			if repo != "" {
-				repoName = strings.Split(repo, ":")[0]
-			} else {
-				repoName, err = git.GetRepoName(entrypointPath)
-				if err != nil {
-					return err
-				}
+			if asJSON {
+				return encodeJSON(cmd, related)
 			}
+			if len(related) == 0 {
+				fmt.Fprintf(cmd.OutOrStdout(), "No %s of %s found.\n", name, args[0])
+				return nil
+			}
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPOSITORY\tDEPTH")
+			for _, repository := range related {
+				fmt.Fprintf(w, "%s\t%d\n", repository.Name, repository.Depth)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Int("depth", 0, "Maximum depth to look at (0 for no limit)")
+	cmd.Flags().Bool("json", false, "Output the repositories as JSON")
+	return cmd
+}
 
-			rootNode, err := graph.BuildGraph(repoName, entrypointPath, cacheDir, homeDir, local)
+func newGraphImpactCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "impact <repo> --event <type>",
+		Short: "Show the workflows an event of a repository would trigger",
+		Long: `Shows the workflows of the cached repositories that an event emitted by a repository would trigger:
+the subscribers of the event, then the subscribers of the events their workflows emit, and so on, by
+depth. --depth limits how deep to look. Payloads are unknown, so the filters of subscriptions are not
+evaluated: subscribers with filters are marked as conditional. Disabled subscriptions are left out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			eventType, _ := cmd.Flags().GetString("event")
+			depth, _ := cmd.Flags().GetInt("depth")
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			cacheDir, err := resolveCacheDir(cmd)
 			if err != nil {
-				if _, ok := err.(*graph.CircularDependencyError); ok {
-					return err
-				}
 				return err
 			}
-
-			if dot {
-				graph.PrintDot(cmd.OutOrStdout(), rootNode)
-			} else {
-				graph.PrintGraph(cmd.OutOrStdout(), rootNode)
+			impact, err := engine.NewDiscoveryManager(cacheDir).AnalyzeEventImpact(args[0], eventType, depth)
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return encodeJSON(cmd, impact)
 			}
+			printEventImpact(cmd.OutOrStdout(), impact)
 			return nil
 		},
 	}
-	cmd.Flags().String("root", "", "The root directory of the project")
-	cmd.Flags().String("repo", "", "The remote repository to use as the entrypoint (e.g. owner/repo:ref)")
-	cmd.Flags().Bool("local", false, "Only use local repositories, do not clone or update remote repositories")
-	cmd.Flags().Bool("dot", false, "Output the graph in DOT format")
+	cmd.Flags().String("event", "", "Event type emitted by the repository")
+	cmd.Flags().Int("depth", 0, "Maximum depth to look at (0 for no limit)")
+	cmd.Flags().Bool("json", false, "Output the impact as JSON")
+	_ = cmd.MarkFlagRequired("event")
 	return cmd
 }
+
+// printEventImpact prints the workflows an event would trigger as a table, by depth.
+func printEventImpact(out io.Writer, impact *engine.EventImpact) {
+	if len(impact.Triggered) == 0 {
+		fmt.Fprintf(out, "No subscriptions to %s of %s found.\n", impact.EventType, impact.Repository)
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DEPTH\tREPOSITORY\tWORKFLOW\tTRIGGERED BY\tEMITS")
+	for _, triggered := range impact.Triggered {
+		trigger := triggered.Source + ":" + triggered.Event
+		if triggered.Conditional {
+			trigger += " (conditional)"
+		}
+		emits := strings.Join(triggered.Emits, ", ")
+		if emits == "" {
+			emits = "-"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", triggered.Depth, triggered.Repository, triggered.Workflow, trigger, emits)
+	}
+	w.Flush()
+	if impact.Truncated {
+		fmt.Fprintf(out, "More workflows would be triggered beyond depth %d.\n", impact.MaxDepth)
+	}
+}
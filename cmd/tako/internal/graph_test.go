@@ -2,11 +2,14 @@ package internal
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
 )
 
 func TestGraphCmd(t *testing.T) {
@@ -54,3 +57,93 @@ version: 0.1.0
 		t.Errorf("expected output to contain %q, got %q", expected, b.String())
 	}
 }
+
+func TestGraphDependentsCmd(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoA := filepath.Join(tmpDir, "repo-a")
+	if err := os.Mkdir(repoA, 0755); err != nil {
+		t.Fatalf("failed to create repoA: %v", err)
+	}
+	runGit(t, repoA, "init", "-q")
+	runGit(t, repoA, "remote", "add", "origin", "https://github.com/test/repo-a.git")
+	if err := os.WriteFile(filepath.Join(repoA, "tako.yml"), []byte("version: 0.1.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	rootCmd := NewRootCmd()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"graph", "dependents", "test/repo-a", "--root", repoA})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("failed to execute graph dependents: %v", err)
+	}
+	if expected := "No dependents of test/repo-a found.\n"; b.String() != expected {
+		t.Errorf("expected %q, got %q", expected, b.String())
+	}
+
+	rootCmd = NewRootCmd()
+	rootCmd.SetOut(bytes.NewBufferString(""))
+	rootCmd.SetErr(bytes.NewBufferString(""))
+	rootCmd.SetArgs([]string{"graph", "dependencies", "test/other", "--root", repoA})
+	if err := rootCmd.Execute(); err == nil || !strings.Contains(err.Error(), `repository "test/other" not found`) {
+		t.Errorf("expected an unknown repository to be rejected, got %v", err)
+	}
+}
+
+func TestGraphImpactCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedTakoYml(t, cacheDir, "my-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - uses: tako/fan-out@v1
+        with:
+          event_type: app_released
+subscriptions:
+  - artifact: my-org/go-lib:default
+    events: [library_released]
+    workflow: update
+`)
+	writeCachedTakoYml(t, cacheDir, "my-org/service", `version: 0.1.0
+workflows:
+  deploy:
+    steps:
+      - run: echo deploy
+subscriptions:
+  - artifact: my-org/app:default
+    events: [app_released]
+    workflow: deploy
+`)
+
+	b := bytes.NewBufferString("")
+	rootCmd := NewRootCmd()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"graph", "impact", "my-org/go-lib", "--event", "library_released", "--depth", "1", "--cache-dir", cacheDir})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("failed to execute graph impact: %v", err)
+	}
+	for _, expected := range []string{
+		"DEPTH  REPOSITORY  WORKFLOW  TRIGGERED BY                    EMITS",
+		"1      my-org/app  update    my-org/go-lib:library_released  app_released",
+		"More workflows would be triggered beyond depth 1.",
+	} {
+		if !strings.Contains(b.String(), expected) {
+			t.Errorf("expected output to contain %q, got:\n%s", expected, b.String())
+		}
+	}
+
+	b.Reset()
+	rootCmd = NewRootCmd()
+	rootCmd.SetOut(b)
+	rootCmd.SetArgs([]string{"graph", "impact", "my-org/go-lib", "--event", "library_released", "--json", "--cache-dir", cacheDir})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("failed to execute graph impact: %v", err)
+	}
+	var impact engine.EventImpact
+	if err := json.Unmarshal(b.Bytes(), &impact); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if len(impact.Triggered) != 2 || impact.Triggered[1].Repository != "my-org/service" || impact.Triggered[1].Depth != 2 {
+		t.Errorf("expected the service to be triggered at depth 2, got %+v", impact.Triggered)
+	}
+}
@@ -0,0 +1,88 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewHealthCmd() *cobra.Command {
+	var maxSize string
+	cmd := &cobra.Command{
+		Use:   "health",
+		Short: "Check the health of the engine",
+		Long: `Checks the health of the engine from its cache and workspaces: the fan-outs running, the circuit
+breakers with failures, the disk usage of the cache and workspaces, and the stale states left
+running by processes that died.
+
+Every open circuit breaker, kind of stale state and a cache over its quota (--max-size, the
+TAKO_CACHE_MAX_SIZE environment variable, or ` + defaultCacheMaxSize + `) is an issue: the engine is
+degraded with issues, and unhealthy with 3 or more of them or when part of the check failed.
+The command fails when the engine is unhealthy. tako daemon --health-addr serves the same
+health on /healthz.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+			staleAfter, _ := cmd.Flags().GetDuration("stale-after")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			maxBytes, err := resolveCacheMaxSize(maxSize)
+			if err != nil {
+				return err
+			}
+
+			health := engine.CheckEngineHealth(engine.HealthOptions{
+				CacheDir:      cacheDir,
+				WorkspaceRoot: workspaceRoot,
+				StaleAfter:    staleAfter,
+				MaxCacheSize:  maxBytes,
+			}, time.Now())
+			if asJSON {
+				if err := encodeJSON(cmd, health); err != nil {
+					return err
+				}
+			} else {
+				printHealth(cmd, health)
+			}
+			if health.Status == engine.HealthUnhealthy {
+				return fmt.Errorf("engine is unhealthy")
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the health as JSON")
+	cmd.Flags().StringVar(&maxSize, "max-size", "", "Size quota of the cache, such as 5GiB or 500MB")
+	cmd.Flags().Duration("stale-after", engine.DefaultOrphanStaleAfter, "How long a running state that does not record its process goes without updates before it is stale")
+	return cmd
+}
+
+// printHealth prints the health of the engine.
+func printHealth(cmd *cobra.Command, health engine.EngineHealth) {
+	out := cmd.OutOrStdout()
+	breakers := health.CircuitBreakers
+	fmt.Fprintf(out, "Status: %s\n", health.Status)
+	fmt.Fprintf(out, "Active fan-outs: %d\n", health.ActiveFanOuts)
+	fmt.Fprintf(out, "Circuit breakers: %d open, %d half-open, %d failing\n", breakers.Open, breakers.HalfOpen, breakers.Failing)
+	fmt.Fprintf(out, "Disk usage: cache %s", cache.FormatSize(health.Disk.Cache))
+	if health.Disk.MaxCacheSize > 0 {
+		fmt.Fprintf(out, " (quota %s)", cache.FormatSize(health.Disk.MaxCacheSize))
+	}
+	fmt.Fprintf(out, ", workspaces %s\n", cache.FormatSize(health.Disk.Workspaces))
+	fmt.Fprintf(out, "Stale states: %d runs, %d fan-outs\n", health.Stale.Runs, health.Stale.FanOuts)
+	for _, issue := range health.Issues {
+		fmt.Fprintf(out, "Issue: %s\n", issue)
+	}
+	for _, err := range health.Errors {
+		fmt.Fprintf(out, "Error: %s\n", err)
+	}
+}
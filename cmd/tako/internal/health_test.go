@@ -0,0 +1,70 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestHealthCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cacheDir := t.TempDir()
+
+	run := func(args ...string) (string, error) {
+		b := bytes.NewBufferString("")
+		cmd := NewRootCmd()
+		cmd.SetOut(b)
+		cmd.SetArgs(append(append([]string{"health"}, args...), "--cache-dir", cacheDir))
+		err := cmd.Execute()
+		return b.String(), err
+	}
+
+	out, err := run()
+	if err != nil {
+		t.Fatalf("expected an empty cache to be healthy: %v", err)
+	}
+	for _, want := range []string{"Status: healthy", "Active fan-outs: 0", "Circuit breakers: 0 open", "Stale states: 0 runs, 0 fan-outs"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the health, got:\n%s", want, out)
+		}
+	}
+
+	store, err := engine.NewCircuitBreakerStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+	openUntil := time.Now().Add(time.Hour)
+	if err := store.Save(engine.CircuitBreakerSnapshot{Endpoint: "org/app:update", State: "open", Failures: 5, OpenUntil: &openUntil}); err != nil {
+		t.Fatalf("failed to save snapshot: %v", err)
+	}
+
+	out, err = run("--json")
+	if err != nil {
+		t.Fatalf("expected a degraded engine not to fail: %v", err)
+	}
+	var health engine.EngineHealth
+	if err := json.Unmarshal([]byte(out), &health); err != nil {
+		t.Fatalf("expected the health as JSON, got %q: %v", out, err)
+	}
+	if health.Status != engine.HealthDegraded || health.CircuitBreakers.Open != 1 {
+		t.Errorf("expected an open circuit breaker to degrade the engine, got %+v", health)
+	}
+
+	// More open circuit breakers and a cache over its quota make the engine unhealthy
+	for _, endpoint := range []string{"org/api:deploy", "org/docs:publish"} {
+		if err := store.Save(engine.CircuitBreakerSnapshot{Endpoint: endpoint, State: "open", Failures: 5, OpenUntil: &openUntil}); err != nil {
+			t.Fatalf("failed to save snapshot: %v", err)
+		}
+	}
+	out, err = run("--max-size", "1")
+	if err == nil || !strings.Contains(err.Error(), "unhealthy") {
+		t.Errorf("expected an unhealthy engine to fail the command, got %v", err)
+	}
+	if !strings.Contains(out, "Issue: Cache over its quota") {
+		t.Errorf("expected the issues of the engine, got:\n%s", out)
+	}
+}
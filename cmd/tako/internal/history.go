@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewHistoryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "history",
+		Short: "List past runs",
+		Long: `Lists the runs recorded in the execution history of the cache, most recent first: their run ID,
+repository, workflow, status, duration and the outcome of the child workflows their fan-outs
+triggered. Every run is recorded when it completes.
+
+The runs of an execution tree, a root run and the child runs of its fan-outs, share the
+correlation ID of the root, which --correlation-id selects.
+
+With --flaky, reports the steps that fail intermittently across the selected runs instead: steps
+that both failed and succeeded, switching between the two at least twice.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, _ := cmd.Flags().GetString("repo")
+			workflow, _ := cmd.Flags().GetString("workflow")
+			correlationID, _ := cmd.Flags().GetString("correlation-id")
+			sinceFlag, _ := cmd.Flags().GetString("since")
+			limit, _ := cmd.Flags().GetInt("limit")
+			asJSON, _ := cmd.Flags().GetBool("json")
+			flaky, _ := cmd.Flags().GetBool("flaky")
+
+			since, err := parseSince(sinceFlag, time.Now())
+			if err != nil {
+				return err
+			}
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			history, err := engine.NewHistoryStore(cacheDir)
+			if err != nil {
+				return err
+			}
+			records, err := history.Query(engine.HistoryFilter{Repository: repo, Workflow: workflow, CorrelationID: correlationID, Since: since, Limit: limit})
+			if err != nil {
+				return err
+			}
+
+			if flaky {
+				return printFlakySteps(cmd, engine.FindFlakySteps(records), asJSON)
+			}
+
+			if asJSON {
+				if records == nil {
+					records = []engine.HistoryRecord{}
+				}
+				return encodeJSON(cmd, records)
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "RUN ID\tREPOSITORY\tWORKFLOW\tSTATUS\tSTARTED\tDURATION\tCHILDREN")
+			for _, record := range records {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", record.RunID, record.Repository, record.Workflow, record.Status,
+					formatCacheTime(record.StartTime), record.Duration.Round(time.Millisecond), formatChildCounts(record.Children))
+			}
+			return w.Flush()
+		},
+	}
+
+	cmd.Flags().String("repo", "", "Only list the runs of this repository (owner/repo)")
+	cmd.Flags().String("workflow", "", "Only list the runs of this workflow")
+	cmd.Flags().String("correlation-id", "", "Only list the runs of the execution tree with this correlation ID")
+	cmd.Flags().String("since", "", "Only list the runs that ended since this time: a duration such as 12h or 7d, or an RFC 3339 timestamp")
+	cmd.Flags().Int("limit", 0, "Maximum number of runs listed (0 for all)")
+	cmd.Flags().Bool("json", false, "Output the runs as JSON")
+	cmd.Flags().Bool("flaky", false, "Report the steps failing intermittently across the selected runs")
+
+	cmd.AddCommand(newHistoryDiffCmd())
+	return cmd
+}
+
+func newHistoryDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <run-a> <run-b>",
+		Short: "Compare two runs of a workflow",
+		Long: `Compares two runs of the same workflow recorded in the execution history: the status and
+duration of each of their steps, and the step outputs whose values differ.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			history, err := engine.NewHistoryStore(cacheDir)
+			if err != nil {
+				return err
+			}
+			var runs [2]*engine.HistoryRecord
+			for i, runID := range args {
+				record, err := history.Get(runID)
+				if err != nil {
+					return err
+				}
+				if record == nil {
+					return fmt.Errorf("run %s not found in the history", runID)
+				}
+				runs[i] = record
+			}
+
+			comparison, err := engine.CompareRuns(runs[0], runs[1])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return encodeJSON(cmd, comparison)
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Comparing runs of %s:%s\n", comparison.Base.Repository, comparison.Base.Workflow)
+			fmt.Fprintf(out, "  %s: %s in %s\n", comparison.Base.RunID, comparison.Base.Status, comparison.Base.Duration.Round(time.Millisecond))
+			fmt.Fprintf(out, "  %s: %s in %s\n\n", comparison.Other.RunID, comparison.Other.Status, comparison.Other.Duration.Round(time.Millisecond))
+
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "STEP\tSTATUS\tDURATION\tDELTA")
+			for _, step := range comparison.Steps {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", step.ID,
+					formatChange(step.BaseStatus, step.OtherStatus),
+					formatChange(formatStepDuration(step.BaseStatus, step.BaseDuration), formatStepDuration(step.OtherStatus, step.OtherDuration)),
+					formatDelta(step))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+
+			for _, step := range comparison.Steps {
+				for _, change := range step.ChangedOutputs {
+					fmt.Fprintf(out, "Output %s.%s: %q -> %q\n", step.ID, change.Name, change.Base, change.Other)
+				}
+			}
+			return nil
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the comparison as JSON")
+	return cmd
+}
+
+// printFlakySteps prints the report of flaky steps.
+func printFlakySteps(cmd *cobra.Command, steps []engine.FlakyStep, asJSON bool) error {
+	if asJSON {
+		if steps == nil {
+			steps = []engine.FlakyStep{}
+		}
+		return encodeJSON(cmd, steps)
+	}
+	if len(steps) == 0 {
+		fmt.Fprintln(cmd.OutOrStdout(), "No flaky steps found")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tWORKFLOW\tSTEP\tFAILURES\tFLIPS\tLAST FAILURE")
+	for _, step := range steps {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d (%.0f%%)\t%d\t%s\n", step.Repository, step.Workflow, step.Step,
+			step.Failures, step.Runs, step.FailureRate(), step.Flips, formatCacheTime(step.LastFailure))
+	}
+	return w.Flush()
+}
+
+// encodeJSON writes a value as indented JSON.
+func encodeJSON(cmd *cobra.Command, value interface{}) error {
+	encoder := json.NewEncoder(cmd.OutOrStdout())
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(value)
+}
+
+// formatChange formats a value of two runs, or the value alone when it did not change.
+func formatChange(base, other string) string {
+	if base == other {
+		return base
+	}
+	if base == "" {
+		base = "-"
+	}
+	if other == "" {
+		other = "-"
+	}
+	return base + " -> " + other
+}
+
+// formatStepDuration formats the duration of a step, or nothing when the run did not execute it.
+func formatStepDuration(status string, duration time.Duration) string {
+	if status == "" {
+		return ""
+	}
+	return duration.Round(time.Millisecond).String()
+}
+
+// formatDelta formats how much longer a step took in the second run.
+func formatDelta(step engine.StepComparison) string {
+	if step.BaseStatus == "" || step.OtherStatus == "" {
+		return "-"
+	}
+	delta := step.DurationDelta().Round(time.Millisecond)
+	if delta > 0 {
+		return "+" + delta.String()
+	}
+	return delta.String()
+}
+
+// parseSince converts the --since flag into a point in time. Durations, which may be given in
+// days such as 7d, are interpreted relative to now.
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if count, err := strconv.Atoi(days); err == nil && count > 0 {
+			return now.AddDate(0, 0, -count), nil
+		}
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration <= 0 {
+			return time.Time{}, fmt.Errorf("--since duration must be positive, got %s", value)
+		}
+		return now.Add(-duration), nil
+	}
+	since, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("--since must be a duration such as 7d or an RFC 3339 timestamp, got %q", value)
+	}
+	return since, nil
+}
+
+// formatChildCounts summarizes the child workflows of a run.
+func formatChildCounts(counts engine.HistoryChildCounts) string {
+	if counts.Total == 0 {
+		return "-"
+	}
+	summary := fmt.Sprintf("%d/%d completed", counts.Completed, counts.Total)
+	if failed := counts.Failed + counts.TimedOut; failed > 0 {
+		summary += fmt.Sprintf(", %d failed", failed)
+	}
+	return summary
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestHistoryCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	now := time.Now()
+	records := []engine.HistoryRecord{
+		{RunID: "exec-old", Repository: "org/app", Workflow: "build", Status: engine.HistoryStatusCompleted, StartTime: now.AddDate(0, 0, -10), EndTime: now.AddDate(0, 0, -10)},
+		{RunID: "exec-build", Repository: "org/app", Workflow: "build", Status: engine.HistoryStatusFailed, StartTime: now.Add(-time.Hour), EndTime: now.Add(-time.Hour),
+			Children: engine.HistoryChildCounts{Total: 3, Completed: 2, Failed: 1}},
+		{RunID: "exec-release", Repository: "org/lib", Workflow: "release", CorrelationID: "exec-build", Status: engine.HistoryStatusCompleted, StartTime: now, EndTime: now},
+	}
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "--since", "7d", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history command: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "exec-release") || !strings.Contains(lines[2], "2/3 completed, 1 failed") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "--repo", "org/app", "--workflow", "build", "--json", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history command: %v", err)
+	}
+	var listed []engine.HistoryRecord
+	if err := json.Unmarshal(b.Bytes(), &listed); err != nil {
+		t.Fatalf("failed to decode output: %v\n%s", err, b.String())
+	}
+	if len(listed) != 2 || listed[0].RunID != "exec-build" || listed[1].RunID != "exec-old" {
+		t.Errorf("unexpected runs: %+v", listed)
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "--correlation-id", "exec-build", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history command: %v", err)
+	}
+	lines = strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "exec-release") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		value    string
+		expected time.Time
+		wantErr  bool
+	}{
+		{value: "", expected: time.Time{}},
+		{value: "7d", expected: now.AddDate(0, 0, -7)},
+		{value: "90m", expected: now.Add(-90 * time.Minute)},
+		{value: "2025-01-01T00:00:00Z", expected: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "-1h", wantErr: true},
+		{value: "last week", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		since, err := parseSince(tc.value, now)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parseSince(%q): expected an error", tc.value)
+			}
+			continue
+		}
+		if err != nil || !since.Equal(tc.expected) {
+			t.Errorf("parseSince(%q) = %v, %v; expected %v", tc.value, since, err, tc.expected)
+		}
+	}
+}
+
+func TestHistoryDiffCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	records := []engine.HistoryRecord{
+		{RunID: "exec-a", Repository: "org/app", Workflow: "build", Status: engine.HistoryStatusFailed, Steps: []engine.HistoryStep{
+			{ID: "compile", Status: engine.HistoryStepSucceeded, Duration: time.Second, Outputs: map[string]string{"version": "1.0"}},
+			{ID: "test", Status: engine.HistoryStepFailed, Duration: 2 * time.Second},
+		}},
+		{RunID: "exec-b", Repository: "org/app", Workflow: "build", Status: engine.HistoryStatusCompleted, Steps: []engine.HistoryStep{
+			{ID: "compile", Status: engine.HistoryStepSucceeded, Duration: 1500 * time.Millisecond, Outputs: map[string]string{"version": "1.1"}},
+			{ID: "test", Status: engine.HistoryStepSucceeded, Duration: time.Second},
+		}},
+		{RunID: "exec-c", Repository: "org/lib", Workflow: "release", Status: engine.HistoryStatusCompleted},
+	}
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "diff", "exec-a", "exec-b", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history diff command: %v", err)
+	}
+	output := b.String()
+	for _, expected := range []string{"failed -> succeeded", "1s -> 1.5s", "+500ms", `Output compile.version: "1.0" -> "1.1"`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q:\n%s", expected, output)
+		}
+	}
+
+	for _, args := range [][]string{{"exec-a", "exec-missing"}, {"exec-a", "exec-c"}} {
+		cmd = NewRootCmd()
+		cmd.SetOut(bytes.NewBufferString(""))
+		cmd.SetErr(bytes.NewBufferString(""))
+		cmd.SetArgs(append([]string{"history", "diff", "--cache-dir", cacheDir}, args...))
+		if err := cmd.Execute(); err == nil {
+			t.Errorf("expected history diff %v to fail", args)
+		}
+	}
+}
+
+func TestHistoryCmd_Flaky(t *testing.T) {
+	cacheDir := t.TempDir()
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	now := time.Now()
+	for i, status := range []string{engine.HistoryStepFailed, engine.HistoryStepSucceeded, engine.HistoryStepFailed, engine.HistoryStepSucceeded} {
+		record := engine.HistoryRecord{RunID: "exec", Repository: "org/app", Workflow: "build", EndTime: now.Add(time.Duration(i) * time.Minute),
+			Steps: []engine.HistoryStep{{ID: "test", Status: status}, {ID: "compile", Status: engine.HistoryStepSucceeded}}}
+		if err := history.Append(record); err != nil {
+			t.Fatalf("failed to append record: %v", err)
+		}
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "--flaky", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history command: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], "test") || !strings.Contains(lines[1], "2/4 (50%)") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"history", "--flaky", "--repo", "org/other", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute history command: %v", err)
+	}
+	if !strings.Contains(b.String(), "No flaky steps found") {
+		t.Errorf("unexpected output:\n%s", b.String())
+	}
+}
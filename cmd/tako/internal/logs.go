@@ -0,0 +1,192 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewLogsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "logs <run-id> [step-id]",
+		Short: "Show the logs of the steps of a run",
+		Long: `Shows the full output of the shell and container steps of a run, as logged while they ran: stdout
+and stderr, interleaved. Without a step ID, the logs of all the steps of the run are shown, in
+the order they ran. Step results only keep the end of the output of their steps.
+
+The logs of completed runs are found through the execution history of the cache, and those of
+running ones in their workspace. Logs are rotated when they grow too large, so the beginning of
+the output of very verbose steps may be missing.`,
+		Args: cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runID := args[0]
+			tail, _ := cmd.Flags().GetInt("tail")
+			pager, _ := cmd.Flags().GetBool("pager")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			logDir, steps, err := findRunLogs(cacheDir, workspaceRoot, runID)
+			if err != nil {
+				return err
+			}
+			if len(args) == 2 {
+				steps = []string{args[1]}
+			}
+
+			out := cmd.OutOrStdout()
+			if pager {
+				return runPager(out, func(w io.Writer) error {
+					return printStepLogs(w, logDir, steps, len(args) == 1, tail)
+				})
+			}
+			return printStepLogs(out, logDir, steps, len(args) == 1, tail)
+		},
+	}
+
+	cmd.Flags().Int("tail", 0, "Only show the last lines of each log")
+	cmd.Flags().Bool("pager", false, "Page through the logs with $PAGER (default: less)")
+	return cmd
+}
+
+// findRunLogs returns the directory of the step logs of a run and its steps with logs, in the
+// order they ran.
+func findRunLogs(cacheDir, workspaceRoot, runID string) (string, []string, error) {
+	if runID == "" || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return "", nil, fmt.Errorf("invalid run ID %q", runID)
+	}
+
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		return "", nil, err
+	}
+	record, err := history.Get(runID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var logDir string
+	if record != nil && record.LogDir != "" {
+		logDir = record.LogDir
+	} else {
+		// Runs still in progress only have their workspace
+		logDir = filepath.Join(workspaceRoot, runID, "logs")
+	}
+
+	logged, err := engine.ListStepLogs(logDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil, fmt.Errorf("no logs found for run %s", runID)
+		}
+		return "", nil, err
+	}
+
+	// The steps recorded in the history come first, in the order they ran
+	var steps []string
+	if record != nil {
+		for _, step := range record.Steps {
+			if slices.Contains(logged, step.ID) && !slices.Contains(steps, step.ID) {
+				steps = append(steps, step.ID)
+			}
+		}
+	}
+	for _, step := range logged {
+		if !slices.Contains(steps, step) {
+			steps = append(steps, step)
+		}
+	}
+	return logDir, steps, nil
+}
+
+// printStepLogs writes the logs of steps, with a header before each when there are several.
+func printStepLogs(w io.Writer, logDir string, steps []string, headers bool, tail int) error {
+	for i, step := range steps {
+		if headers {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "==> %s <==\n", step)
+		}
+		log, err := engine.OpenStepLog(logDir, step)
+		if err != nil {
+			return err
+		}
+		if tail > 0 {
+			err = copyTail(w, log, tail)
+		} else {
+			_, err = io.Copy(w, log)
+		}
+		_ = log.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read the log of step '%s': %v", step, err)
+		}
+	}
+	return nil
+}
+
+// copyTail writes the last lines of a reader.
+func copyTail(w io.Writer, r io.Reader, lines int) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	kept := make([]string, 0, lines)
+	for scanner.Scan() {
+		if len(kept) == lines {
+			kept = kept[1:]
+		}
+		kept = append(kept, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, line := range kept {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPager writes through the pager of $PAGER, or less (more on Windows), to the output.
+func runPager(out io.Writer, write func(io.Writer) error) error {
+	pager := os.Getenv("PAGER")
+	shell := []string{"sh", "-c"}
+	if runtime.GOOS == "windows" {
+		shell = []string{"cmd", "/C"}
+	}
+	if pager == "" {
+		pager = "less"
+		if runtime.GOOS == "windows" {
+			pager = "more"
+		}
+	}
+	cmd := exec.Command(shell[0], shell[1], pager)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start pager %q: %v", pager, err)
+	}
+	writeErr := write(stdin)
+	_ = stdin.Close()
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("pager %q failed: %v", pager, err)
+	}
+	return writeErr
+}
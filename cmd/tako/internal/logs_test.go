@@ -0,0 +1,74 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestLogsCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	logDir := filepath.Join(t.TempDir(), "exec-build", "logs")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		t.Fatalf("failed to create log dir: %v", err)
+	}
+	logs := map[string]string{
+		"test.log":    "ok\n",
+		"build.log.1": "line 1\nline 2\n",
+		"build.log":   "line 3\n",
+	}
+	for name, content := range logs {
+		if err := os.WriteFile(filepath.Join(logDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write log: %v", err)
+		}
+	}
+	history, err := engine.NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create history: %v", err)
+	}
+	record := engine.HistoryRecord{
+		RunID:  "exec-build",
+		Status: engine.HistoryStatusCompleted,
+		LogDir: logDir,
+		Steps:  []engine.HistoryStep{{ID: "build"}, {ID: "test"}},
+	}
+	if err := history.Append(record); err != nil {
+		t.Fatalf("failed to append record: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		{"all steps", []string{"exec-build"}, "==> build <==\nline 1\nline 2\nline 3\n\n==> test <==\nok\n"},
+		{"one step", []string{"exec-build", "build"}, "line 1\nline 2\nline 3\n"},
+		{"tail", []string{"exec-build", "build", "--tail", "2"}, "line 2\nline 3\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := bytes.NewBufferString("")
+			cmd := NewRootCmd()
+			cmd.SetOut(b)
+			cmd.SetArgs(append([]string{"logs", "--cache-dir", cacheDir}, tt.args...))
+			if err := cmd.Execute(); err != nil {
+				t.Fatalf("failed to execute logs command: %v", err)
+			}
+			if b.String() != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, b.String())
+			}
+		})
+	}
+
+	cmd := NewRootCmd()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetErr(bytes.NewBufferString(""))
+	cmd.SetArgs([]string{"logs", "--cache-dir", cacheDir, "exec-build", "deploy"})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "no log of step 'deploy'") {
+		t.Errorf("expected an error for a step without log, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewPlanCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "plan <workflow-name>",
+		Short: "Show the execution tree a workflow would start",
+		Long: `Shows the tree of workflows a workflow would trigger through its fan-outs, with their resolved
+inputs, without running any step. Subscriptions are discovered and their filters evaluated as a run would.
+With --estimate, also reports the compute the tree is expected to need, from the resources and timeouts its
+workflows and steps declare: the peak of workflows, CPU and memory running at once, and the total CPU time.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			repo, _ := cmd.Flags().GetString("repo")
+			profile, _ := cmd.Flags().GetString("profile")
+			maxFanOutDepth, _ := cmd.Flags().GetInt("max-fanout-depth")
+			localOnly, _ := cmd.Flags().GetBool("local-only")
+			estimate, _ := cmd.Flags().GetBool("estimate")
+
+			gitAuth, err := auth.FromEnvironment(os.Environ())
+			if err != nil {
+				return err
+			}
+			namespace, err := resolveNamespace(cmd)
+			if err != nil {
+				return err
+			}
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+
+			runner, err := engine.NewRunner(engine.RunnerOptions{
+				WorkspaceRoot:  workspaceRoot,
+				CacheDir:       cacheDir,
+				MaxFanOutDepth: maxFanOutDepth,
+				Environment:    os.Environ(),
+				Namespace:      namespace,
+				Profile:        profile,
+				Git: engine.GitOptions{
+					LocalOnly: localOnly,
+					Auth:      gitAuth,
+				},
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create execution runner: %v", err)
+			}
+			defer runner.Close()
+
+			inputs := workflowInputs(cmd, os.Args)
+			var tree *engine.SimulatedWorkflow
+			if repo != "" {
+				tree, err = runner.SimulateMultiRepoWorkflow(context.Background(), args[0], inputs, repo)
+			} else {
+				repoPath, pathErr := determineRepositoryPath(cmd)
+				if pathErr != nil {
+					return fmt.Errorf("failed to determine repository path: %v", pathErr)
+				}
+				tree, err = runner.SimulateWorkflow(context.Background(), args[0], inputs, repoPath)
+			}
+			if tree != nil {
+				printSimulation(cmd.OutOrStdout(), tree)
+			}
+			if err != nil {
+				return fmt.Errorf("simulation failed: %v", err)
+			}
+
+			if estimate {
+				report, err := engine.EstimateSimulation(tree)
+				if err != nil {
+					return fmt.Errorf("failed to estimate the execution tree: %v", err)
+				}
+				printEstimate(cmd.OutOrStdout(), report)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().String("repo", "", "Specify the repository of the workflow (e.g., my-org/my-repo)")
+	cmd.Flags().String("root", "", "Root directory of the local repository of the workflow")
+	cmd.Flags().StringToString("inputs", nil, "Pass input variables to the workflow (e.g., --inputs version-bump=minor or --inputs.version-bump=minor)")
+	cmd.Flags().String("profile", "", "Profile of tako.yml merged over the workflow, such as prod")
+	cmd.Flags().Int("max-fanout-depth", engine.DefaultMaxFanOutDepth, "Maximum depth of the fan-out children of the run; deeper event chains fail")
+	cmd.Flags().Bool("local-only", false, "Only use repositories already in the cache, never clone or fetch them")
+	cmd.Flags().Bool("estimate", false, "Report the peak concurrency and total compute of the execution tree")
+	cmd.FParseErrWhitelist.UnknownFlags = true
+
+	return cmd
+}
+
+// printEstimate prints the estimate of the compute of an execution tree.
+func printEstimate(w io.Writer, estimate *engine.ExecutionEstimate) {
+	fmt.Fprintf(w, "\nEstimate (from declared resources and timeouts):\n")
+	fmt.Fprintf(w, "  Workflows: %d\n", estimate.Workflows)
+	fmt.Fprintf(w, "  Peak concurrency: %d workflows, %.2f CPU, %s memory\n",
+		estimate.PeakWorkflows, estimate.PeakCPU, cache.FormatSize(estimate.PeakMemoryBytes))
+	fmt.Fprintf(w, "  Total compute: %s of CPU time\n", estimate.CPUTime)
+	fmt.Fprintf(w, "  Duration: %s\n", estimate.Duration)
+	if len(estimate.Undeclared) > 0 {
+		fmt.Fprintf(w, "  Steps without resources or timeout (not counted): %s\n", strings.Join(estimate.Undeclared, ", "))
+	}
+}
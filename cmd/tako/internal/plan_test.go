@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPlanCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	root := t.TempDir()
+	cacheDir := t.TempDir()
+	takoYml := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - id: compile
+        run: touch compiled
+        timeout: 10m
+        resources:
+          cpu_limit: "2"
+          mem_limit: 1Gi
+      - id: notify
+        run: echo done
+`
+	if err := os.WriteFile(filepath.Join(root, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"plan", "build", "--root", root, "--cache-dir", cacheDir, "--local-only", "--estimate"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute plan command: %v", err)
+	}
+
+	out := b.String()
+	for _, want := range []string{
+		"Simulated execution tree (1 workflows)",
+		"Peak concurrency: 1 workflows, 2.00 CPU, 1.0GiB memory",
+		"Total compute: 20m0s of CPU time",
+		"Duration: 10m0s",
+		"not counted): " + filepath.Base(root) + ":build/notify",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the output:\n%s", want, out)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "compiled")); !os.IsNotExist(err) {
+		t.Errorf("expected the steps of the workflow not to run")
+	}
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+// newInputPrompter returns a prompter asking for the missing inputs of a workflow on a terminal,
+// one at a time and in name order. Enter accepts the default of an input, and the choices of
+// enum and boolean inputs are listed as numbered options. Invalid values are asked again.
+func newInputPrompter(in io.Reader, out io.Writer) engine.InputPrompter {
+	reader := bufio.NewReader(in)
+	return func(workflowName string, missing map[string]config.WorkflowInput) (map[string]string, error) {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		fmt.Fprintf(out, "Workflow '%s' requires inputs that were not provided:\n", workflowName)
+		values := make(map[string]string, len(names))
+		for _, name := range names {
+			value, err := promptForInput(reader, out, name, missing[name])
+			if err != nil {
+				return nil, err
+			}
+			values[name] = value
+		}
+		return values, nil
+	}
+}
+
+// promptForInput asks for the value of an input until a valid one is entered.
+func promptForInput(reader *bufio.Reader, out io.Writer, name string, input config.WorkflowInput) (string, error) {
+	choices := input.Validation.Enum
+	if input.Type == config.InputTypeBoolean {
+		choices = []string{"true", "false"}
+	}
+	defaultValue := ""
+	if input.Default != nil {
+		defaultValue = config.FormatInputValue(input.Default)
+	}
+
+	for {
+		fmt.Fprintf(out, "\n%s", name)
+		if input.Type != "" {
+			fmt.Fprintf(out, " (%s)", input.Type)
+		}
+		if input.Description != "" {
+			fmt.Fprintf(out, ": %s", input.Description)
+		}
+		fmt.Fprintln(out)
+		for i, choice := range choices {
+			fmt.Fprintf(out, "  %d) %s\n", i+1, choice)
+		}
+		if defaultValue != "" {
+			fmt.Fprintf(out, "Value [%s]: ", defaultValue)
+		} else {
+			fmt.Fprint(out, "Value: ")
+		}
+
+		line, err := reader.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			return "", fmt.Errorf("no value entered for input '%s'", name)
+		}
+		value := strings.TrimSpace(line)
+		if value == "" {
+			value = defaultValue
+		}
+		// Options are selected by value or by number
+		if i, err := strconv.Atoi(value); err == nil && i >= 1 && i <= len(choices) && !slices.Contains(choices, value) {
+			value = choices[i-1]
+		}
+
+		if value == "" {
+			fmt.Fprintf(out, "A value is required.\n")
+			continue
+		}
+		typed, err := input.Parse(value)
+		if err == nil {
+			err = input.Check(typed)
+		}
+		if err != nil {
+			fmt.Fprintf(out, "Invalid value: %v\n", err)
+			continue
+		}
+		return value, nil
+	}
+}
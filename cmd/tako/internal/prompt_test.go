@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestInputPrompter(t *testing.T) {
+	missing := map[string]config.WorkflowInput{
+		"environment": {Description: "Target environment", Required: true, Validation: config.WorkflowInputValidation{Enum: []string{"dev", "staging", "prod"}}},
+		"replicas":    {Type: config.InputTypeInteger, Required: true, Default: 2},
+		"canary":      {Type: config.InputTypeBoolean, Required: true},
+		"version":     {Required: true, Validation: config.WorkflowInputValidation{Pattern: `^v[0-9.]+$`}},
+	}
+	// canary picks option 2, environment is entered as a value after an invalid one, replicas
+	// takes its default, and version is asked again until it matches its pattern
+	in := strings.NewReader("2\nqa\nstaging\n\n1.2\nv1.2\n")
+	var out bytes.Buffer
+
+	values, err := newInputPrompter(in, &out)("deploy", missing)
+	if err != nil {
+		t.Fatalf("prompter failed: %v", err)
+	}
+	expected := map[string]string{"canary": "false", "environment": "staging", "replicas": "2", "version": "v1.2"}
+	for name, value := range expected {
+		if values[name] != value {
+			t.Errorf("expected %s=%s, got %v", name, value, values)
+		}
+	}
+
+	output := out.String()
+	for _, expected := range []string{
+		"Workflow 'deploy' requires inputs that were not provided:",
+		"environment: Target environment\n  1) dev\n  2) staging\n  3) prod\nValue: ",
+		"Invalid value: value 'qa' is not in allowed values [dev staging prod]",
+		"replicas (integer)\nValue [2]: ",
+		"Invalid value: value '1.2' does not match pattern",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got %q", expected, output)
+		}
+	}
+}
+
+func TestInputPrompter_NoValue(t *testing.T) {
+	missing := map[string]config.WorkflowInput{"version": {Required: true}}
+	_, err := newInputPrompter(strings.NewReader("\n"), &bytes.Buffer{})("deploy", missing)
+	if err == nil || !strings.Contains(err.Error(), "no value entered for input 'version'") {
+		t.Errorf("expected an error once the input ends, got %v", err)
+	}
+}
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewProvenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "provenance",
+		Short: "Inspect and verify the provenance of runs",
+		Long: `Inspects the provenance tako exec writes for each run to the append-only provenance store of the
+cache: an in-toto statement of SLSA provenance with the parameters of the run, the commits of the
+repositories of its execution tree, its steps, the events its fan-outs emitted, the child workflows
+they triggered and the artifacts it published. Provenance signed with --provenance-key is verified
+with the public key; provenance signed keylessly is verified with cosign verify-blob and its bundle.`,
+	}
+
+	cmd.AddCommand(newProvenanceShowCmd())
+	cmd.AddCommand(newProvenanceVerifyCmd())
+	return cmd
+}
+
+func newProvenanceShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <run-id>",
+		Short: "Show the provenance of a run",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			store, err := newProvenanceStore(cmd)
+			if err != nil {
+				return err
+			}
+			statement, err := store.Statement(args[0])
+			if err != nil {
+				return err
+			}
+			if asJSON {
+				return encodeJSON(cmd, statement)
+			}
+			printProvenance(cmd.OutOrStdout(), statement)
+
+			// Tell how the provenance can be verified, when it was signed
+			out := cmd.OutOrStdout()
+			for _, signed := range []struct{ suffix, how string }{
+				{engine.ProvenanceEnvelopeFile, "tako provenance verify " + args[0] + " --key <public-key>"},
+				{engine.ProvenanceBundleFile, "cosign verify-blob --bundle"},
+			} {
+				path, err := store.Path(args[0], signed.suffix)
+				if err != nil {
+					return err
+				}
+				if _, err := os.Stat(path); err == nil {
+					fmt.Fprintf(out, "Signed: %s (verify with %s)\n", path, signed.how)
+				}
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("json", false, "Output the in-toto statement")
+	return cmd
+}
+
+func newProvenanceVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify <run-id> --key <public-key>",
+		Short: "Verify the signed provenance of a run",
+		Long: `Verifies that the provenance of a run is signed by the PEM public key matching the private key of
+--provenance-key, and that the signed statement is the one of the provenance store.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			keyPath, _ := cmd.Flags().GetString("key")
+			key, err := os.ReadFile(keyPath)
+			if err != nil {
+				return fmt.Errorf("failed to read public key: %v", err)
+			}
+
+			store, err := newProvenanceStore(cmd)
+			if err != nil {
+				return err
+			}
+			statement, err := store.Verify(args[0], key)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "Provenance of run %s is verified: %d subjects, %d repositories\n",
+				args[0], len(statement.Subject), len(statement.Predicate.BuildDefinition.ResolvedDependencies))
+			return nil
+		},
+	}
+
+	cmd.Flags().String("key", "", "PEM file of the Ed25519 or ECDSA public key")
+	_ = cmd.MarkFlagRequired("key")
+	return cmd
+}
+
+// newProvenanceStore opens the provenance store of the cache directory.
+func newProvenanceStore(cmd *cobra.Command) (*engine.ProvenanceStore, error) {
+	cacheDir, err := resolveCacheDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return engine.NewProvenanceStore(cacheDir)
+}
+
+// printProvenance prints the parameters of a run, and the artifacts and commits of its
+// provenance as tables.
+func printProvenance(out io.Writer, statement *engine.ProvenanceStatement) {
+	definition := statement.Predicate.BuildDefinition
+	metadata := statement.Predicate.RunDetails.Metadata
+	fmt.Fprintf(out, "Run: %s\n", metadata.InvocationID)
+	fmt.Fprintf(out, "Workflow: %s:%s\n", definition.ExternalParameters.Repository, definition.ExternalParameters.Workflow)
+	fmt.Fprintf(out, "Trigger: %s\n", definition.ExternalParameters.Trigger)
+	fmt.Fprintf(out, "Status: %s\n", definition.InternalParameters["status"])
+	fmt.Fprintf(out, "Started: %s\n", formatCacheTime(metadata.StartedOn))
+	fmt.Fprintf(out, "Finished: %s\n", formatCacheTime(metadata.FinishedOn))
+
+	if len(definition.ResolvedDependencies) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tCOMMIT\tURI")
+		for _, dependency := range definition.ResolvedDependencies {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", dependency.Name, dependency.Digest["gitCommit"], dependency.URI)
+		}
+		w.Flush()
+	}
+	if len(statement.Subject) > 0 {
+		fmt.Fprintln(out)
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ARTIFACT\tDIGEST\tURI")
+		for _, subject := range statement.Subject {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", subject.Name, formatDigest(subject.Digest), subject.URI)
+		}
+		w.Flush()
+	}
+	fmt.Fprintln(out)
+}
+
+// formatDigest formats the digests of an artifact as <algorithm>:<hex>, sorted by algorithm.
+func formatDigest(digests map[string]string) string {
+	algorithms := make([]string, 0, len(digests))
+	for algorithm := range digests {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	parts := make([]string, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		parts = append(parts, algorithm+":"+digests[algorithm])
+	}
+	return strings.Join(parts, ", ")
+}
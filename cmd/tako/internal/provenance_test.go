@@ -0,0 +1,110 @@
+package internal
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestProvenanceCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := engine.NewProvenanceStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create provenance store: %v", err)
+	}
+	now := time.Now()
+	statement := engine.ProvenanceStatement{
+		Type:          engine.InTotoStatementType,
+		Subject:       []engine.ResourceDescriptor{{Name: "app.tar.gz", URI: "oci://registry/app:1.0", Digest: map[string]string{"sha256": "abc"}}},
+		PredicateType: engine.SLSAProvenancePredicate,
+		Predicate: engine.ProvenancePredicate{
+			BuildDefinition: engine.ProvenanceBuildDefinition{
+				BuildType:          engine.ProvenanceBuildType,
+				ExternalParameters: engine.ProvenanceParameters{Workflow: "release", Repository: "org/app", Trigger: engine.ProvenanceTrigger{Type: engine.ProvenanceTriggerExec}},
+				InternalParameters: map[string]string{"status": engine.HistoryStatusCompleted},
+				ResolvedDependencies: []engine.ResourceDescriptor{
+					{Name: "org/app", URI: "git+https://github.com/org/app.git@main", Digest: map[string]string{"gitCommit": strings.Repeat("a", 40)}},
+				},
+			},
+			RunDetails: engine.ProvenanceRunDetails{
+				Builder:  engine.ProvenanceBuilder{ID: engine.ProvenanceBuilderID},
+				Metadata: engine.ProvenanceMetadata{InvocationID: "exec-release", StartedOn: now, FinishedOn: now},
+			},
+		},
+	}
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		t.Fatalf("failed to encode statement: %v", err)
+	}
+	statementPath, _ := store.Path("exec-release", engine.ProvenanceStatementFile)
+	if err := os.WriteFile(statementPath, payload, 0444); err != nil {
+		t.Fatalf("failed to write statement: %v", err)
+	}
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	envelope, err := engine.SignProvenance(payload, private)
+	if err != nil {
+		t.Fatalf("failed to sign statement: %v", err)
+	}
+	data, _ := json.Marshal(envelope)
+	envelopePath, _ := store.Path("exec-release", engine.ProvenanceEnvelopeFile)
+	if err := os.WriteFile(envelopePath, data, 0444); err != nil {
+		t.Fatalf("failed to write envelope: %v", err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(public)
+	keyPath := filepath.Join(t.TempDir(), "provenance.pub")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"provenance", "show", "exec-release", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute provenance show command: %v", err)
+	}
+	output := b.String()
+	for _, want := range []string{"Workflow: org/app:release", "Status: completed", strings.Repeat("a", 40), "sha256:abc", "Signed: " + envelopePath} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"provenance", "verify", "exec-release", "--key", keyPath, "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute provenance verify command: %v", err)
+	}
+	if !strings.Contains(b.String(), "Provenance of run exec-release is verified: 1 subjects, 1 repositories") {
+		t.Errorf("unexpected output: %s", b.String())
+	}
+
+	// A statement that does not match its signature is rejected
+	os.Chmod(statementPath, 0644)
+	if err := os.WriteFile(statementPath, bytes.Replace(payload, []byte("release"), []byte("nightly"), 1), 0444); err != nil {
+		t.Fatalf("failed to write statement: %v", err)
+	}
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	cmd.SetArgs([]string{"provenance", "verify", "exec-release", "--key", keyPath, "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err == nil {
+		t.Error("expected a modified statement to be rejected")
+	}
+}
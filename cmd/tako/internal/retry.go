@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewRetryCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry <fanout-id>",
+		Short: "Retry the children of a fan-out that did not complete",
+		Long: `Triggers the child workflows of a finished fan-out that did not complete again, with the events
+the fan-out emitted: the children that failed or timed out, were cancelled, or were skipped after
+an aborted rollout wave. With --only-failed, only the children that failed or timed out are
+retried. The children that completed are not run again, and the fan-out state is updated in place:
+each retried child keeps the runs of its earlier attempts, and the fan-out is completed or failed
+again from the status of all its children. tako state and tako dashboard show the retried fan-out.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fanOutID := args[0]
+			onlyFailed, _ := cmd.Flags().GetBool("only-failed")
+			backend, _ := cmd.Flags().GetString("backend")
+			localOnly, _ := cmd.Flags().GetBool("local-only")
+			gitProtocol, _ := cmd.Flags().GetString("git-protocol")
+			fetchInterval, _ := cmd.Flags().GetDuration("fetch-interval")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+			namespace, err := resolveNamespace(cmd)
+			if err != nil {
+				return err
+			}
+			workspaceRoot, err := resolveWorkspaceRoot(cmd)
+			if err != nil {
+				return err
+			}
+			gitAuth, err := auth.FromEnvironment(os.Environ())
+			if err != nil {
+				return err
+			}
+			fanOuts, err := engine.NewFanOutOptions(userConfig(cmd))
+			if err != nil {
+				return err
+			}
+
+			runner, err := engine.NewRunner(engine.RunnerOptions{
+				WorkspaceRoot:    workspaceRoot,
+				CacheDir:         cacheDir,
+				Environment:      os.Environ(),
+				Namespace:        namespace,
+				ContainerRuntime: userConfig(cmd).Execution.ContainerRuntime,
+				Git: engine.GitOptions{
+					LocalOnly:     localOnly,
+					Protocol:      gitProtocol,
+					Auth:          gitAuth,
+					FetchInterval: fetchInterval,
+				},
+				Backend: backend,
+				FanOuts: fanOuts,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to create execution runner: %v", err)
+			}
+			defer runner.Close()
+
+			// Interrupted children are left for the next retry
+			ctx, stop := engine.NotifyInterrupt(context.Background())
+			defer stop()
+
+			result, err := runner.RetryFanOut(ctx, fanOutID, onlyFailed)
+			if err != nil {
+				return err
+			}
+			printRetryResult(cmd.OutOrStdout(), result)
+			if !result.Success {
+				return fmt.Errorf("fan-out %s did not complete: %s", fanOutID, strings.Join(result.Errors, "; "))
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().Bool("only-failed", false, "Only retry the children that failed or timed out, not those cancelled or skipped")
+	cmd.Flags().String("backend", "", "Backend of child workflows: local, container, remote, kubernetes or noop (default: local)")
+	cmd.Flags().Bool("local-only", false, "Only use repositories already in the cache, never clone or fetch them")
+	cmd.Flags().String("git-protocol", "https", "Protocol used to clone repositories: https or ssh")
+	cmd.Flags().Duration("fetch-interval", engine.DefaultGitFetchInterval, "How long a cached repository is used before it is fetched again (negative to always fetch)")
+	return cmd
+}
+
+// printRetryResult prints the children a retry triggered again, and the status the fan-out
+// finished with.
+func printRetryResult(out io.Writer, result *engine.FanOutResult) {
+	fmt.Fprintf(out, "Retried %d children of fan-out %s\n\n", len(result.Retried), result.FanOutID)
+	if len(result.Retried) > 0 {
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPOSITORY\tWORKFLOW\tSTATUS\tRUN ID\tATTEMPT\tERROR")
+		for _, child := range result.Retried {
+			runID := child.RunID
+			if runID == "" {
+				runID = "-"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", child.Repository, child.Workflow, child.Status, runID, child.Retries+1, child.ErrorMessage)
+		}
+		w.Flush()
+		fmt.Fprintln(out)
+	}
+	if summary := result.ChildrenSummary; summary != nil {
+		fmt.Fprintf(out, "Fan-out %s: %s (%s)\n", result.FanOutID, summary.Status, formatChildCounts(stateChildCounts(*summary)))
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestRetryCmd(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	cacheDir := t.TempDir()
+	repoDir := filepath.Join(cacheDir, "repos", "test-org", "app", "main")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create cached repository: %v", err)
+	}
+	takoYml := `version: 0.1.0
+workflows:
+  update:
+    inputs:
+      version:
+        type: string
+    steps:
+      - run: echo updated to {{ .Inputs.version }}
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    inputs:
+      version: "{{ .payload.version }}"
+`
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	// A finished fan-out whose only child failed
+	states, err := engine.NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("failed to create state manager: %v", err)
+	}
+	state, err := states.CreateFanOutState("fanout-1", "exec-release", "test-org/lib", "library_built", true, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create fan-out state: %v", err)
+	}
+	state.SetEvents([]engine.Event{{Type: "library_built", Source: "test-org/lib", Payload: map[string]interface{}{"version": "1.2.0"}}})
+	state.AddChildWorkflow("test-org/app", "update", map[string]string{"version": "1.2.0"})
+	state.StartWaiting()
+	state.UpdateChildStatus("test-org/app", "update", engine.ChildStatusFailed, "exec-app", "tests failed")
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"retry", "fanout-1", "--only-failed", "--local-only", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute retry command: %v\n%s", err, b.String())
+	}
+	output := b.String()
+	for _, want := range []string{"Retried 1 children of fan-out fanout-1", "test-org/app", "completed", "Fan-out fanout-1: completed (1/1 completed)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, output)
+		}
+	}
+
+	// Nothing is left to retry
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetErr(b)
+	cmd.SetArgs([]string{"retry", "fanout-1", "--local-only", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err == nil || !strings.Contains(err.Error(), "no children to retry") {
+		t.Errorf("expected nothing to retry, got %v", err)
+	}
+}
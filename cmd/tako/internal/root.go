@@ -1,8 +1,15 @@
 package internal
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
 	"os"
+	"path/filepath"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
 
 	"github.com/spf13/cobra"
 )
@@ -15,13 +22,34 @@ func NewRootCmd() *cobra.Command {
 		Short: "Tako is a command-line interface for multi-repository operations.",
 		Long: `Tako is a command-line tool that simplifies multi-repository workflows by understanding the dependencies between your projects.
 It allows you to run commands across your repositories in the correct order, ensuring that changes are built, tested, and released reliably.`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return applyUserConfig(cmd)
+		},
 	}
 
 	cmd.PersistentFlags().StringVar(&cacheDir, "cache-dir", "~/.tako/cache", "The cache directory to use.")
+	cmd.PersistentFlags().String("namespace", "", "Namespace isolating the cache, workspaces and states of a tenant (default: $TAKO_NAMESPACE)")
 	cmd.AddCommand(NewExecCmd())
+	cmd.AddCommand(NewPlanCmd())
 	cmd.AddCommand(NewGraphCmd())
 	cmd.AddCommand(NewRunCmd())
 	cmd.AddCommand(NewCacheCmd())
+	cmd.AddCommand(NewSubscriptionsCmd())
+	cmd.AddCommand(NewEventsCmd())
+	cmd.AddCommand(NewCancelCmd())
+	cmd.AddCommand(NewApproveCmd())
+	cmd.AddCommand(NewRetryCmd())
+	cmd.AddCommand(NewStateCmd())
+	cmd.AddCommand(NewBreakersCmd())
+	cmd.AddCommand(NewHealthCmd())
+	cmd.AddCommand(NewGCCmd())
+	cmd.AddCommand(NewHistoryCmd())
+	cmd.AddCommand(NewLogsCmd())
+	cmd.AddCommand(NewDashboardCmd())
+	cmd.AddCommand(NewAuditCmd())
+	cmd.AddCommand(NewProvenanceCmd())
+	cmd.AddCommand(NewDaemonCmd())
+	cmd.AddCommand(NewSchemaCmd())
 	cmd.AddCommand(NewCompletionCmd())
 	cmd.AddCommand(validateCmd)
 	cmd.AddCommand(NewVersionCmd())
@@ -29,7 +57,67 @@ It allows you to run commands across your repositories in the correct order, ens
 	return cmd
 }
 
+// userConfigKey is the context key of the user configuration of the running command.
+type userConfigKey struct{}
+
+// applyUserConfig loads the user configuration, with the overrides of the environment, into the
+// context of the command, sets the defaults of the flags of the command that were not given,
+// and configures the logs.
+func applyUserConfig(cmd *cobra.Command) error {
+	// A missing home directory only fails when TAKO_CONFIG is not set either
+	homeDir, _ := os.UserHomeDir()
+	cfg, err := config.ApplyUserConfig(cmd.Flags(), cmd.CommandPath(), os.Environ(), homeDir)
+	if err != nil {
+		return err
+	}
+	slog.SetDefault(slog.New(cfg.LogHandler(os.Stderr)))
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	cmd.SetContext(context.WithValue(ctx, userConfigKey{}, cfg))
+	return nil
+}
+
+// userConfig returns the user configuration of the running command; empty when it was not loaded.
+func userConfig(cmd *cobra.Command) *config.UserConfig {
+	if ctx := cmd.Context(); ctx != nil {
+		if cfg, ok := ctx.Value(userConfigKey{}).(*config.UserConfig); ok {
+			return cfg
+		}
+	}
+	return &config.UserConfig{}
+}
+
+// resolveNamespace returns the namespace selected with --namespace, or else with TAKO_NAMESPACE.
+func resolveNamespace(cmd *cobra.Command) (string, error) {
+	namespace, _ := cmd.Flags().GetString("namespace")
+	if namespace == "" {
+		namespace = os.Getenv(engine.NamespaceEnv)
+	}
+	if err := engine.ValidateNamespace(namespace); err != nil {
+		return "", err
+	}
+	return namespace, nil
+}
+
+// resolveWorkspaceRoot returns the directory of the run workspaces of the namespace of the command.
+func resolveWorkspaceRoot(cmd *cobra.Command) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user home directory: %v", err)
+	}
+	namespace, err := resolveNamespace(cmd)
+	if err != nil {
+		return "", err
+	}
+	return engine.NamespaceDir(filepath.Join(homeDir, ".tako", "workspaces"), namespace), nil
+}
+
 func Execute() {
+	// Tokens used for Git and the GitHub API never reach the logs
+	slog.SetDefault(slog.New(auth.NewRedactingHandler(slog.NewTextHandler(os.Stderr, nil))))
+
 	if err := NewRootCmd().Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -2,6 +2,9 @@ package internal
 
 import (
 	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -14,3 +17,84 @@ func TestExecute(t *testing.T) {
 		t.Fatalf("failed to execute root command: %v", err)
 	}
 }
+
+func TestResolveNamespace(t *testing.T) {
+	t.Setenv("TAKO_NAMESPACE", "team-a")
+	cmd, _, err := NewRootCmd().Find([]string{"cache", "list"})
+	if err != nil {
+		t.Fatalf("failed to find command: %v", err)
+	}
+	if err := cmd.ParseFlags(nil); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if namespace, err := resolveNamespace(cmd); err != nil || namespace != "team-a" {
+		t.Errorf("expected the namespace of the environment, got %q, %v", namespace, err)
+	}
+
+	if err := cmd.Flags().Set("namespace", "team-b"); err != nil {
+		t.Fatalf("failed to set flag: %v", err)
+	}
+	if namespace, err := resolveNamespace(cmd); err != nil || namespace != "team-b" {
+		t.Errorf("expected the flag to win over the environment, got %q, %v", namespace, err)
+	}
+	cacheDir, err := resolveCacheDir(cmd)
+	if err != nil {
+		t.Fatalf("failed to resolve cache dir: %v", err)
+	}
+	if !strings.HasSuffix(cacheDir, filepath.Join(".tako", "namespaces", "team-b", "cache")) {
+		t.Errorf("expected the cache directory of the namespace, got %s", cacheDir)
+	}
+
+	if err := cmd.Flags().Set("namespace", "Team B"); err != nil {
+		t.Fatalf("failed to set flag: %v", err)
+	}
+	if _, err := resolveNamespace(cmd); err == nil {
+		t.Errorf("expected an invalid namespace to be rejected")
+	}
+}
+
+func TestApplyUserConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := `namespace: team-a
+execution:
+  max_concurrent_repos: 8
+  max_fanout_depth: 3
+idempotency: true
+flags:
+  tako exec:
+    follow: "true"
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	t.Setenv("TAKO_CONFIG", path)
+	t.Setenv("TAKO_NAMESPACE", "team-b")
+
+	cmd, _, err := NewRootCmd().Find([]string{"exec"})
+	if err != nil {
+		t.Fatalf("failed to find command: %v", err)
+	}
+	if err := cmd.ParseFlags([]string{"--max-concurrent-repos", "2"}); err != nil {
+		t.Fatalf("failed to parse flags: %v", err)
+	}
+	if err := applyUserConfig(cmd); err != nil {
+		t.Fatalf("applyUserConfig() error = %v", err)
+	}
+
+	// Flags win over the environment, which wins over the file
+	for name, want := range map[string]string{"max-concurrent-repos": "2", "namespace": "team-b", "max-fanout-depth": "3", "follow": "true"} {
+		if got := cmd.Flags().Lookup(name).Value.String(); got != want {
+			t.Errorf("expected --%s to be %s, got %s", name, want, got)
+		}
+	}
+	if !userConfig(cmd).Idempotency {
+		t.Errorf("expected the user configuration in the context of the command")
+	}
+
+	if err := os.WriteFile(path, []byte("log: {format: xml}"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if err := applyUserConfig(cmd); err == nil || !strings.Contains(err.Error(), "log.format") {
+		t.Errorf("expected an invalid config to be rejected, got %v", err)
+	}
+}
@@ -1,20 +1,35 @@
 package internal
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"github.com/dangazineu/tako/internal/git"
 	"github.com/dangazineu/tako/internal/graph"
 	"github.com/spf13/cobra"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
 )
 
 func NewRunCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "run [command] [args...]",
 		Short: "Execute a shell command across all dependent repositories",
-		Args:  cobra.MinimumNArgs(1),
+		Long: `Executes a shell command in the repository and in all the repositories that depend on it, in
+dependency order. Repositories are grouped in levels, each after all the repositories it depends
+on; the repositories of a level run concurrently, at most --max-concurrent at once, with each line
+of their output prefixed by their name. Once the command fails in a repository, the rest of its
+level completes and the later levels are skipped. A table of the status and duration of the
+command in each repository is printed at the end.
+
+With --since, the command only runs in the repositories that changed since a git ref, including
+changes not committed yet and untracked files, and in all the repositories that depend on them.`,
+		Args: cobra.MinimumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			root, _ := cmd.Flags().GetString("root")
 			repo, _ := cmd.Flags().GetString("repo")
@@ -22,7 +37,20 @@ func NewRunCmd() *cobra.Command {
 			only, _ := cmd.Flags().GetStringSlice("only")
 			ignore, _ := cmd.Flags().GetStringSlice("ignore")
 			dryRun, _ := cmd.Flags().GetBool("dry-run")
-			cacheDir, _ := cmd.InheritedFlags().GetString("cache-dir")
+			maxConcurrent, _ := cmd.Flags().GetInt("max-concurrent")
+			since, _ := cmd.Flags().GetString("since")
+			if maxConcurrent < 1 {
+				return fmt.Errorf("--max-concurrent must be at least 1")
+			}
+			if since != "" {
+				if err := git.ValidateRef(since); err != nil {
+					return err
+				}
+			}
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
 			commandStr := strings.Join(args, " ")
 
 			if strings.HasPrefix(commandStr, "mvn") {
@@ -65,36 +93,61 @@ func NewRunCmd() *cobra.Command {
 				return err
 			}
 
-			sortedNodes, err := filteredNodes.TopologicalSort()
+			if since != "" {
+				filteredNodes, err = changedSince(cmd.ErrOrStderr(), filteredNodes, since)
+				if err != nil {
+					return err
+				}
+				if filteredNodes == nil {
+					fmt.Fprintf(cmd.OutOrStdout(), "No repositories changed since %s.\n", since)
+					return nil
+				}
+			}
+
+			levels, err := filteredNodes.Levels()
 			if err != nil {
 				return err
 			}
+			levels = runnableLevels(levels)
 
-			if len(sortedNodes) == 0 {
+			if len(levels) == 0 {
 				fmt.Fprintln(cmd.OutOrStdout(), "Warning: No repositories matched the filter criteria.")
 				return nil
 			}
 
 			//   1. Dependency: If repo-a's tako.yml lists repo-b as a dependent, it means B depends on A. The graph edge is A -> B.
 			//   2. Build Order: To build B, its dependency A must be built first.
-			//   3. Topological Sort: A topological sort of the graph A -> B will correctly produce the list [A, B].
-			//   4. Conclusion: The run command must iterate through the topologically sorted list in its natural, forward order (A, then B) to ensure dependencies are built
-			//      before the projects that need them.
-			for _, node := range sortedNodes {
-				if dryRun {
-					fmt.Fprintf(cmd.OutOrStdout(), "[dry-run] %s: %s\n", node.Name, commandStr)
-				} else {
-					fmt.Fprintf(cmd.OutOrStdout(), "--- Running in %s ---\n", node.Name)
-					c := exec.Command("bash", "-c", commandStr)
-					c.Dir = node.Path
-					c.Stdout = cmd.OutOrStdout()
-					c.Stderr = cmd.ErrOrStderr()
-					if err := c.Run(); err != nil {
-						return fmt.Errorf("command failed in %s: %w", node.Name, err)
+			//   3. Levels: The levels of the graph A -> B are [A], then [B]: each repository comes after all of its dependencies.
+			//   4. Conclusion: The run command must run the levels in order (A, then B) to ensure dependencies are built before the
+			//      projects that need them, while the repositories of a level, which do not depend on each other, can run concurrently.
+			if dryRun {
+				for _, level := range levels {
+					for _, node := range level {
+						fmt.Fprintf(cmd.OutOrStdout(), "[dry-run] %s: %s\n", node.Name, commandStr)
 					}
 				}
+				return nil
 			}
 
+			results := runLevels(cmd.Context(), cmd.OutOrStdout(), cmd.ErrOrStderr(), levels, commandStr, maxConcurrent)
+			fmt.Fprintln(cmd.OutOrStdout())
+			printRepoRunResults(cmd.OutOrStdout(), results)
+			var failed []repoRunResult
+			for _, result := range results {
+				if result.Status == repoRunFailed {
+					failed = append(failed, result)
+				}
+			}
+			if len(failed) == 1 {
+				return fmt.Errorf("command failed in %s: %w", failed[0].Repository, failed[0].Err)
+			}
+			if len(failed) > 1 {
+				names := make([]string, len(failed))
+				for i, result := range failed {
+					names[i] = result.Repository
+				}
+				return fmt.Errorf("command failed in %d repositories: %s", len(failed), strings.Join(names, ", "))
+			}
 			return nil
 		},
 	}
@@ -104,5 +157,188 @@ func NewRunCmd() *cobra.Command {
 	cmd.Flags().StringSlice("only", []string{}, "Only run on the specified repository and its dependents")
 	cmd.Flags().StringSlice("ignore", []string{}, "Ignore the specified repository and its dependents")
 	cmd.Flags().Bool("dry-run", false, "Show what commands would be run without executing them")
+	cmd.Flags().Int("max-concurrent", 4, "Maximum number of independent repositories to run the command in at once")
+	cmd.Flags().String("since", "", "Only run in the repositories that changed since this git ref, and in their dependents")
 	return cmd
 }
+
+// Statuses of the repositories of a run.
+const (
+	repoRunSucceeded = "succeeded"
+	repoRunFailed    = "failed"
+	repoRunSkipped   = "skipped" // A repository of an earlier level failed
+)
+
+// repoRunResult is the outcome of the command in a repository.
+type repoRunResult struct {
+	Repository string
+	Level      int
+	Status     string
+	Duration   time.Duration
+	Err        error
+}
+
+// changedSince returns the subgraph of the repositories that changed since a ref, with all their
+// dependents, or nil when none changed. Repositories that cannot be diffed against the ref, such
+// as those without it, are considered changed.
+func changedSince(warnings io.Writer, root *graph.Node, since string) (*graph.Node, error) {
+	var changed []string
+	for _, node := range root.AllNodes() {
+		if node.Path == "" {
+			continue // A virtual root
+		}
+		files, err := git.ChangedFiles(node.Path, since)
+		if err != nil {
+			fmt.Fprintf(warnings, "Warning: %v; considering %s changed\n", err, node.Name)
+		}
+		if err != nil || len(files) > 0 {
+			changed = append(changed, node.Name)
+		}
+	}
+	if len(changed) == 0 {
+		return nil, nil
+	}
+	return root.Filter(changed, nil)
+}
+
+// runnableLevels drops the virtual roots that filtering adds to the graph, which are not
+// repositories, and the levels left empty.
+func runnableLevels(levels [][]*graph.Node) [][]*graph.Node {
+	var runnable [][]*graph.Node
+	for _, level := range levels {
+		var nodes []*graph.Node
+		for _, node := range level {
+			if node.Path != "" {
+				nodes = append(nodes, node)
+			}
+		}
+		if len(nodes) > 0 {
+			runnable = append(runnable, nodes)
+		}
+	}
+	return runnable
+}
+
+// runLevels runs the command in the repositories of each level in turn, at most maxConcurrent
+// at once. The output of each repository is prefixed with its name, line by line. Once a
+// repository fails, the rest of its level completes and the later levels are skipped.
+func runLevels(ctx context.Context, stdout, stderr io.Writer, levels [][]*graph.Node, command string, maxConcurrent int) []repoRunResult {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var mu sync.Mutex // Serializes the lines of concurrent repositories
+	var results []repoRunResult
+	failed := false
+	for i, level := range levels {
+		levelResults := make([]repoRunResult, len(level))
+		if failed {
+			for j, node := range level {
+				levelResults[j] = repoRunResult{Repository: node.Name, Level: i, Status: repoRunSkipped}
+			}
+			results = append(results, levelResults...)
+			continue
+		}
+
+		names := make([]string, len(level))
+		for j, node := range level {
+			names[j] = node.Name
+		}
+		fmt.Fprintf(stdout, "--- Level %d: %s ---\n", i, strings.Join(names, ", "))
+
+		var wg sync.WaitGroup
+		semaphore := make(chan struct{}, maxConcurrent)
+		for j, node := range level {
+			wg.Add(1)
+			go func(j int, node *graph.Node) {
+				defer wg.Done()
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				prefix := "[" + node.Name + "] "
+				out := &prefixWriter{w: stdout, prefix: prefix, mu: &mu}
+				errOut := &prefixWriter{w: stderr, prefix: prefix, mu: &mu}
+				start := time.Now()
+				c := exec.CommandContext(ctx, "bash", "-c", command)
+				c.Dir = node.Path
+				c.Stdout = out
+				c.Stderr = errOut
+				err := c.Run()
+				out.Flush()
+				errOut.Flush()
+
+				result := repoRunResult{Repository: node.Name, Level: i, Status: repoRunSucceeded, Duration: time.Since(start)}
+				if err != nil {
+					result.Status, result.Err = repoRunFailed, err
+				}
+				levelResults[j] = result
+			}(j, node)
+		}
+		wg.Wait()
+
+		for _, result := range levelResults {
+			if result.Status == repoRunFailed {
+				failed = true
+			}
+		}
+		results = append(results, levelResults...)
+	}
+	return results
+}
+
+// printRepoRunResults prints a table of the status and duration of the command in each
+// repository, by level.
+func printRepoRunResults(out io.Writer, results []repoRunResult) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tLEVEL\tSTATUS\tDURATION")
+	for _, result := range results {
+		duration := "-"
+		if result.Status != repoRunSkipped {
+			duration = result.Duration.Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", result.Repository, result.Level, result.Status, duration)
+	}
+	w.Flush()
+}
+
+// prefixWriter writes complete lines to a writer shared by concurrent repositories, each
+// preceded by a prefix, so that their lines are not mixed up.
+type prefixWriter struct {
+	w       io.Writer
+	prefix  string
+	mu      *sync.Mutex // Shared by the writers of the same output
+	partial []byte      // Start of a line not yet written
+}
+
+// Write writes the complete lines of p, keeping the end of the last one for the next write.
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	var lines []byte
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.partial[:i+1]...)
+		w.partial = w.partial[i+1:]
+	}
+	if len(lines) > 0 {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		if _, err := w.w.Write(lines); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line, when the output did not end with a newline.
+func (w *prefixWriter) Flush() {
+	if len(w.partial) == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(w.w, "%s%s\n", w.prefix, w.partial)
+	w.partial = nil
+}
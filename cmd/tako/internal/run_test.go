@@ -2,6 +2,7 @@ package internal
 
 import (
 	"bytes"
+	"context"
 	"github.com/dangazineu/tako/internal/graph"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -255,3 +256,96 @@ func TestRunCmd_DryRunIntegration(t *testing.T) {
 	assert.Contains(t, output, "[dry-run]")
 	assert.Contains(t, output, "echo test")
 }
+
+func TestRunLevels(t *testing.T) {
+	node := func(name string) *graph.Node {
+		return &graph.Node{Name: name, Path: t.TempDir()}
+	}
+	nodeA, nodeB, nodeC, nodeD := node("repo-a"), node("repo-b"), node("repo-c"), node("repo-d")
+	require.NoError(t, os.WriteFile(filepath.Join(nodeB.Path, "fail"), nil, 0644))
+	levels := [][]*graph.Node{{nodeA}, {nodeB, nodeC}, {nodeD}}
+
+	var out bytes.Buffer
+	results := runLevels(context.Background(), &out, &out, levels, `printf 'one\ntwo'; test ! -f fail`, 2)
+
+	var statuses []string
+	for _, result := range results {
+		statuses = append(statuses, result.Repository+"="+result.Status)
+	}
+	assert.Equal(t, []string{"repo-a=succeeded", "repo-b=failed", "repo-c=succeeded", "repo-d=skipped"}, statuses)
+	assert.Error(t, results[1].Err)
+	assert.Equal(t, 1, results[2].Level)
+
+	output := out.String()
+	assert.Contains(t, output, "--- Level 0: repo-a ---\n[repo-a] one\n[repo-a] two\n")
+	assert.Contains(t, output, "--- Level 1: repo-b, repo-c ---\n")
+	assert.Contains(t, output, "[repo-c] one\n")
+	assert.NotContains(t, output, "Level 2")
+
+	var table bytes.Buffer
+	printRepoRunResults(&table, results)
+	assert.Contains(t, table.String(), "REPOSITORY  LEVEL  STATUS     DURATION\n")
+	assert.Contains(t, table.String(), "repo-d      2      skipped    -\n")
+}
+
+func TestRunnableLevels(t *testing.T) {
+	nodeA := &graph.Node{Name: "A", Path: "/A"}
+	nodeB := &graph.Node{Name: "B", Path: "/B"}
+	root := &graph.Node{Name: "virtual-root", Children: []*graph.Node{nodeA, nodeB}}
+
+	levels, err := root.Levels()
+	require.NoError(t, err)
+	levels = runnableLevels(levels)
+	require.Len(t, levels, 1)
+	assert.Equal(t, []*graph.Node{nodeA, nodeB}, levels[0])
+}
+
+func TestChangedSince(t *testing.T) {
+	repo := func(name string) *graph.Node {
+		dir := t.TempDir()
+		runGit(t, dir, "init", "-q")
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte(name), 0644))
+		runGit(t, dir, "add", "README.md")
+		runGit(t, dir, "commit", "-q", "-m", "initial commit")
+		return &graph.Node{Name: name, Path: dir}
+	}
+	// A -> B -> C, A -> D
+	nodeC := repo("C")
+	nodeB := repo("B")
+	nodeB.Children = []*graph.Node{nodeC}
+	nodeD := repo("D")
+	nodeA := repo("A")
+	nodeA.Children = []*graph.Node{nodeB, nodeD}
+
+	var warnings bytes.Buffer
+	affected, err := changedSince(&warnings, nodeA, "HEAD")
+	require.NoError(t, err)
+	assert.Nil(t, affected, "expected no repository to have changed")
+
+	require.NoError(t, os.WriteFile(filepath.Join(nodeB.Path, "README.md"), []byte("changed"), 0644))
+	affected, err = changedSince(&warnings, nodeA, "HEAD")
+	require.NoError(t, err)
+	var names []string
+	for _, node := range affected.AllNodes() {
+		names = append(names, node.Name)
+	}
+	assert.ElementsMatch(t, []string{"B", "C"}, names)
+	assert.Empty(t, warnings.String())
+
+	// Untracked files are changes too
+	require.NoError(t, os.WriteFile(filepath.Join(nodeD.Path, "new.txt"), []byte("new"), 0644))
+	affected, err = changedSince(&warnings, nodeA, "HEAD")
+	require.NoError(t, err)
+	names = nil
+	for _, node := range affected.AllNodes() {
+		if node.Path != "" { // Not the virtual root of B and D
+			names = append(names, node.Name)
+		}
+	}
+	assert.ElementsMatch(t, []string{"B", "C", "D"}, names)
+
+	affected, err = changedSince(&warnings, nodeA, "v9.9.9")
+	require.NoError(t, err)
+	assert.Len(t, affected.AllNodes(), 4)
+	assert.Contains(t, warnings.String(), "considering A changed")
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dangazineu/tako/internal/schema"
+	"github.com/spf13/cobra"
+)
+
+func NewSchemaCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "schema",
+		Short: "Work with the JSON Schema of tako.yml",
+	}
+	cmd.AddCommand(newSchemaExportCmd())
+	return cmd
+}
+
+func newSchemaExportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Print the JSON Schema of tako.yml",
+		Long: `Prints the JSON Schema of the tako.yml format, for editors and CI to validate configurations
+before running them. It covers workflows, steps, subscriptions, resources and the parameters of
+built-in steps such as tako/fan-out@v1.
+
+With the YAML language server, a tako.yml refers to the published schema with:
+
+  # yaml-language-server: $schema=` + schema.ID,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, _ := cmd.Flags().GetString("output")
+
+			data, err := schema.Marshal()
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				_, err := cmd.OutOrStdout().Write(data)
+				return err
+			}
+			if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+				return fmt.Errorf("failed to create the output directory: %v", err)
+			}
+			if err := os.WriteFile(output, data, 0644); err != nil {
+				return fmt.Errorf("failed to write the schema: %v", err)
+			}
+			return nil
+		},
+	}
+	cmd.Flags().StringP("output", "o", "", "Write the schema to this file instead of the standard output")
+	return cmd
+}
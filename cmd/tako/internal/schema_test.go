@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSchemaExportCmd(t *testing.T) {
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"schema", "export"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &schema); err != nil {
+		t.Fatalf("expected the schema to be JSON, got %v", err)
+	}
+	if schema["title"] != "tako.yml" {
+		t.Errorf("unexpected schema: %v", schema)
+	}
+
+	output := filepath.Join(t.TempDir(), "schema", "tako.schema.json")
+	cmd = NewRootCmd()
+	cmd.SetArgs([]string{"schema", "export", "--output", output})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute command: %v", err)
+	}
+	written, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("failed to read the schema: %v", err)
+	}
+	if !bytes.Equal(written, b.Bytes()) {
+		t.Error("expected the written schema to match the printed one")
+	}
+}
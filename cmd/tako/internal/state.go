@@ -0,0 +1,253 @@
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewStateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "state",
+		Short: "Inspect the states of idempotent fan-outs",
+		Long: `Inspects the states of the idempotent fan-outs of the cache, which exec --idempotent and the
+idempotency setting of ~/.tako/config.yml enable. The fan-out of an event whose fingerprint has
+a state returns the result of the earlier fan-out instead of triggering the subscribers again,
+until the state expires: idempotency_retention (24h by default) after the fan-out finished.
+
+Fingerprints can be abbreviated to any unique prefix.`,
+	}
+	cmd.AddCommand(newStateListCmd())
+	cmd.AddCommand(newStateShowCmd())
+	cmd.AddCommand(newStatePurgeCmd())
+	return cmd
+}
+
+func newStateListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the states of idempotent fan-outs",
+		Long: `Lists the states of the idempotent fan-outs, most recent first: their event fingerprint, source
+repository, event type, status, the outcome of their children and when they expire.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			states, err := openFanOutStates(cmd)
+			if err != nil {
+				return err
+			}
+			idempotent := states.ListIdempotentStates()
+			if asJSON {
+				if idempotent == nil {
+					idempotent = []engine.IdempotentState{}
+				}
+				return encodeJSON(cmd, idempotent)
+			}
+
+			now := time.Now()
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "FINGERPRINT\tSOURCE\tEVENT\tSTATUS\tSTARTED\tCHILDREN\tEXPIRES")
+			for _, state := range idempotent {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", state.Fingerprint, state.SourceRepo, state.EventType, state.Status,
+					formatCacheTime(state.StartTime), formatChildCounts(stateChildCounts(state.FanOutSummary)), formatExpiry(state, now))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the states as JSON")
+	return cmd
+}
+
+func newStateShowCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show <fingerprint>",
+		Short: "Show the state of an idempotent fan-out",
+		Long: `Shows the state of the idempotent fan-out of an event fingerprint and the status of each of
+its child workflows.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			asJSON, _ := cmd.Flags().GetBool("json")
+
+			states, err := openFanOutStates(cmd)
+			if err != nil {
+				return err
+			}
+			fingerprint, err := resolveFingerprint(states, args[0])
+			if err != nil {
+				return err
+			}
+			state, err := states.GetIdempotentState(fingerprint)
+			if err != nil {
+				return err
+			}
+			fanOut, err := states.GetFanOutStateByFingerprint(fingerprint)
+			if err != nil {
+				return err
+			}
+			children := fanOut.GetChildren()
+
+			if asJSON {
+				if children == nil {
+					children = []engine.ChildWorkflow{}
+				}
+				return encodeJSON(cmd, struct {
+					*engine.IdempotentState
+					Children []engine.ChildWorkflow `json:"children"`
+				}{state, children})
+			}
+
+			out := cmd.OutOrStdout()
+			fmt.Fprintf(out, "Fingerprint: %s\n", state.Fingerprint)
+			fmt.Fprintf(out, "Fan-out: %s\n", state.ID)
+			fmt.Fprintf(out, "Event: %s from %s\n", state.EventType, state.SourceRepo)
+			if state.Namespace != "" {
+				fmt.Fprintf(out, "Namespace: %s\n", state.Namespace)
+			}
+			fmt.Fprintf(out, "Status: %s\n", state.Status)
+			if state.ErrorMessage != "" {
+				fmt.Fprintf(out, "Error: %s\n", state.ErrorMessage)
+			}
+			fmt.Fprintf(out, "Started: %s\n", formatCacheTime(state.StartTime))
+			if state.EndTime != nil {
+				fmt.Fprintf(out, "Ended: %s\n", formatCacheTime(*state.EndTime))
+			}
+			fmt.Fprintf(out, "Expires: %s\n", formatExpiry(*state, time.Now()))
+			if len(children) == 0 {
+				return nil
+			}
+
+			fmt.Fprintln(out)
+			w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPOSITORY\tWORKFLOW\tSTATUS\tRUN ID")
+			for _, child := range children {
+				runID := child.RunID
+				if runID == "" {
+					runID = "-"
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", child.Repository, child.Workflow, child.Status, runID)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().Bool("json", false, "Output the state as JSON")
+	return cmd
+}
+
+func newStatePurgeCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "purge [fingerprint]",
+		Short: "Expire the state of an idempotent fan-out",
+		Long: `Removes the state of the idempotent fan-out of an event fingerprint before its retention ends,
+so that the next fan-out of the event triggers its subscribers again. A fan-out still running
+must be cancelled first. With --expired, removes the states whose retention ended instead.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			expired, _ := cmd.Flags().GetBool("expired")
+			if expired == (len(args) == 1) {
+				return fmt.Errorf("either a fingerprint or --expired is required")
+			}
+
+			states, err := openFanOutStates(cmd)
+			if err != nil {
+				return err
+			}
+			out := cmd.OutOrStdout()
+			if expired {
+				purged, err := states.PurgeExpiredStates()
+				for _, fingerprint := range purged {
+					fmt.Fprintf(out, "Purged %s\n", fingerprint)
+				}
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(out, "Purged %d expired states\n", len(purged))
+				return nil
+			}
+
+			fingerprint, err := resolveFingerprint(states, args[0])
+			if err != nil {
+				return err
+			}
+			if err := states.PurgeFingerprint(fingerprint); err != nil {
+				return err
+			}
+			fmt.Fprintf(out, "Purged %s\n", fingerprint)
+			return nil
+		},
+	}
+	cmd.Flags().Bool("expired", false, "Purge the states whose retention ended")
+	return cmd
+}
+
+// openFanOutStates opens the fan-out states of the cache, with the idempotency retention of the
+// user configuration.
+func openFanOutStates(cmd *cobra.Command) (*engine.FanOutStateManager, error) {
+	cacheDir, err := resolveCacheDir(cmd)
+	if err != nil {
+		return nil, err
+	}
+	fanOuts, err := engine.NewFanOutOptions(userConfig(cmd))
+	if err != nil {
+		return nil, err
+	}
+	states, err := engine.NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		return nil, err
+	}
+	if fanOuts.IdempotencyRetention > 0 {
+		states.SetIdempotencyRetention(fanOuts.IdempotencyRetention)
+	}
+	return states, nil
+}
+
+// resolveFingerprint returns the fingerprint of the state that a fingerprint or a unique prefix of
+// one designates.
+func resolveFingerprint(states *engine.FanOutStateManager, prefix string) (string, error) {
+	var matches []string
+	for _, state := range states.ListIdempotentStates() {
+		if state.Fingerprint == prefix {
+			return prefix, nil
+		}
+		if strings.HasPrefix(state.Fingerprint, prefix) {
+			matches = append(matches, state.Fingerprint)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("no fan-out state for fingerprint %s", prefix)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("fingerprint prefix %s is ambiguous: %s", prefix, strings.Join(matches, ", "))
+	}
+}
+
+// stateChildCounts returns the counts of the children of a fan-out.
+func stateChildCounts(summary engine.FanOutSummary) engine.HistoryChildCounts {
+	return engine.HistoryChildCounts{
+		Total:     summary.TotalChildren,
+		Completed: summary.CompletedChildren,
+		Failed:    summary.FailedChildren,
+		TimedOut:  summary.TimedOutChildren,
+		Cancelled: summary.CancelledChildren,
+		Skipped:   summary.SkippedChildren,
+	}
+}
+
+// formatExpiry formats when the retention of a state ends.
+func formatExpiry(state engine.IdempotentState, now time.Time) string {
+	switch {
+	case state.ExpiresAt == nil:
+		return "-"
+	case state.Expired(now):
+		return formatCacheTime(*state.ExpiresAt) + " (expired)"
+	default:
+		return formatCacheTime(*state.ExpiresAt)
+	}
+}
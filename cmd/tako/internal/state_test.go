@@ -0,0 +1,89 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+func TestStateCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	states, err := engine.NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("failed to create state manager: %v", err)
+	}
+	finished, _, err := states.CreateIdempotentFanOutState("abc123", "", "org/lib", "released", false, 0)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	finished.AddChildWorkflow("org/app", "update", nil)
+	if err := finished.UpdateChildStatus("org/app", "update", engine.ChildStatusCompleted, "exec-1", ""); err != nil {
+		t.Fatalf("failed to update child: %v", err)
+	}
+	if err := finished.CompleteFanOut(); err != nil {
+		t.Fatalf("failed to complete fan-out: %v", err)
+	}
+	if _, _, err := states.CreateIdempotentFanOutState("abd456", "", "org/lib", "tagged", false, 0); err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		b := bytes.NewBufferString("")
+		cmd := NewRootCmd()
+		cmd.SetOut(b)
+		cmd.SetArgs(append(append([]string{"state"}, args...), "--cache-dir", cacheDir))
+		err := cmd.Execute()
+		return b.String(), err
+	}
+
+	out, err := run("list")
+	if err != nil {
+		t.Fatalf("failed to list states: %v", err)
+	}
+	for _, want := range []string{"abc123", "abd456", "released", "1/1 completed"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the states, got:\n%s", want, out)
+		}
+	}
+
+	out, err = run("list", "--json")
+	if err != nil {
+		t.Fatalf("failed to list states: %v", err)
+	}
+	var listed []engine.IdempotentState
+	if err := json.Unmarshal([]byte(out), &listed); err != nil || len(listed) != 2 {
+		t.Fatalf("expected the states as JSON, got %q: %v", out, err)
+	}
+
+	out, err = run("show", "abc")
+	if err != nil {
+		t.Fatalf("failed to show state: %v", err)
+	}
+	for _, want := range []string{"Fingerprint: abc123", "Status: completed", "org/app", "exec-1"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the state, got:\n%s", want, out)
+		}
+	}
+
+	if _, err := run("show", "ab"); err == nil || !strings.Contains(err.Error(), "ambiguous") {
+		t.Errorf("expected an ambiguous prefix to be rejected, got %v", err)
+	}
+	if _, err := run("purge", "abd"); err == nil || !strings.Contains(err.Error(), "cancel it before purging") {
+		t.Errorf("expected a running fan-out not to be purged, got %v", err)
+	}
+	if _, err := run("purge"); err == nil {
+		t.Errorf("expected purge to require a fingerprint or --expired")
+	}
+
+	out, err = run("purge", "abc123")
+	if err != nil || !strings.Contains(out, "Purged abc123") {
+		t.Fatalf("failed to purge state: %q, %v", out, err)
+	}
+	if _, err := run("show", "abc123"); err == nil {
+		t.Errorf("expected the purged state to be gone")
+	}
+}
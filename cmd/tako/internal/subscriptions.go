@@ -0,0 +1,236 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
+	"github.com/spf13/cobra"
+)
+
+func NewSubscriptionsCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "subscriptions",
+		Short: "Inspect and manage event subscriptions",
+	}
+
+	cmd.AddCommand(newSubscriptionsListCmd())
+	cmd.AddCommand(newSubscriptionsLintCmd())
+	cmd.AddCommand(newSubscriptionsDisableCmd())
+	cmd.AddCommand(newSubscriptionsEnableCmd())
+
+	return cmd
+}
+
+func newSubscriptionsListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the subscriptions of the cached repositories",
+		Long:  `Lists which cached repositories subscribe to which artifacts and events, and the workflows they trigger.`,
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			artifact, _ := cmd.Flags().GetString("artifact")
+
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			matches, err := engine.NewDiscoveryManager(cacheDir).ListSubscriptions()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "REPOSITORY\tARTIFACT\tEVENTS\tWORKFLOW\tPRIORITY\tSTATUS")
+			for _, match := range matches {
+				sub := match.Subscription
+				if artifact != "" && sub.Artifact != artifact {
+					continue
+				}
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", match.Repository, sub.Artifact, strings.Join(sub.Events, ","), sub.Workflow, sub.Priority, subscriptionStatus(sub, time.Now()))
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().String("artifact", "", "Only list the subscriptions to this artifact")
+	return cmd
+}
+
+func newSubscriptionsLintCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "lint",
+		Short: "Check the subscriptions of the cached repositories",
+		Long: `Checks the subscriptions of the cached repositories ahead of time. Reports CEL filters that do not
+compile, input templates that cannot be resolved from the event payload, and dangling subscriptions
+that point to workflows or artifacts that do not exist.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
+
+			evaluator, err := engine.NewSubscriptionEvaluator()
+			if err != nil {
+				return err
+			}
+
+			issues, err := engine.NewDiscoveryManager(cacheDir).LintSubscriptions(evaluator)
+			if err != nil {
+				return err
+			}
+
+			for _, issue := range issues {
+				fmt.Fprintln(cmd.OutOrStdout(), issue.String())
+			}
+			if len(issues) > 0 {
+				return fmt.Errorf("found %d subscription issue(s)", len(issues))
+			}
+			fmt.Fprintln(cmd.OutOrStdout(), "No subscription issues found.")
+			return nil
+		},
+	}
+	return cmd
+}
+
+func newSubscriptionsDisableCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "disable <artifact>",
+		Short: "Disable the subscriptions to an artifact",
+		Long: `Disables the subscriptions to an artifact in the local tako.yml, so they stop triggering workflows.
+Use --until to put the subscriptions in maintenance mode until a point in time, given either as an
+RFC 3339 timestamp (e.g. 2025-01-02T15:04:05Z) or as a duration from now (e.g. 2h).`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, _ := cmd.Flags().GetString("workflow")
+			untilFlag, _ := cmd.Flags().GetString("until")
+
+			until, err := parseUntil(untilFlag, time.Now())
+			if err != nil {
+				return err
+			}
+
+			takoPath, err := subscriptionsConfigPath(cmd)
+			if err != nil {
+				return err
+			}
+
+			count, err := config.SetSubscriptionsDisabled(takoPath, args[0], workflow, true, until)
+			if err != nil {
+				return err
+			}
+
+			if until != "" {
+				fmt.Fprintf(cmd.OutOrStdout(), "Disabled %d subscription(s) to %s until %s\n", count, args[0], until)
+			} else {
+				fmt.Fprintf(cmd.OutOrStdout(), "Disabled %d subscription(s) to %s\n", count, args[0])
+			}
+			return nil
+		},
+	}
+	cmd.Flags().String("root", "", "The root directory of the project. Defaults to the current directory")
+	cmd.Flags().String("workflow", "", "Only disable the subscriptions that trigger this workflow")
+	cmd.Flags().String("until", "", "Re-enable the subscriptions automatically at this time (RFC 3339 timestamp or duration)")
+	return cmd
+}
+
+func newSubscriptionsEnableCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "enable <artifact>",
+		Short: "Enable the subscriptions to an artifact",
+		Long:  `Enables the subscriptions to an artifact in the local tako.yml, clearing any maintenance window.`,
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			workflow, _ := cmd.Flags().GetString("workflow")
+
+			takoPath, err := subscriptionsConfigPath(cmd)
+			if err != nil {
+				return err
+			}
+
+			count, err := config.SetSubscriptionsDisabled(takoPath, args[0], workflow, false, "")
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Enabled %d subscription(s) to %s\n", count, args[0])
+			return nil
+		},
+	}
+	cmd.Flags().String("root", "", "The root directory of the project. Defaults to the current directory")
+	cmd.Flags().String("workflow", "", "Only enable the subscriptions that trigger this workflow")
+	return cmd
+}
+
+// subscriptionsConfigPath returns the path of the tako.yml edited by the subscriptions commands.
+func subscriptionsConfigPath(cmd *cobra.Command) (string, error) {
+	root, _ := cmd.Flags().GetString("root")
+	if root == "" {
+		workingDir, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		root = workingDir
+	}
+	return filepath.Join(root, "tako.yml"), nil
+}
+
+// resolveCacheDir returns the cache directory selected with --cache-dir, expanding the default ~/.tako/cache,
+// within the directories of the namespace of the command.
+func resolveCacheDir(cmd *cobra.Command) (string, error) {
+	cacheDir, err := cmd.Flags().GetString("cache-dir")
+	if err != nil {
+		return "", err
+	}
+	if cacheDir == "" {
+		cacheDir = "~/.tako/cache"
+	}
+	if rest, ok := strings.CutPrefix(cacheDir, "~/"); ok {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		cacheDir = filepath.Join(homeDir, rest)
+	}
+	namespace, err := resolveNamespace(cmd)
+	if err != nil {
+		return "", err
+	}
+	return engine.NamespaceDir(cacheDir, namespace), nil
+}
+
+// subscriptionStatus describes whether a subscription currently triggers workflows.
+func subscriptionStatus(sub config.Subscription, now time.Time) string {
+	switch {
+	case sub.IsActive(now):
+		return "enabled"
+	case sub.Until != "":
+		return "disabled until " + sub.Until
+	default:
+		return "disabled"
+	}
+}
+
+// parseUntil converts the --until flag into an RFC 3339 timestamp.
+// Durations are interpreted relative to now.
+func parseUntil(value string, now time.Time) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration <= 0 {
+			return "", fmt.Errorf("--until duration must be positive, got %s", value)
+		}
+		return now.Add(duration).UTC().Format(time.RFC3339), nil
+	}
+	if _, err := time.Parse(time.RFC3339, value); err != nil {
+		return "", fmt.Errorf("--until must be an RFC 3339 timestamp or a duration, got %q", value)
+	}
+	return value, nil
+}
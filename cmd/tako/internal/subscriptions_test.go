@@ -0,0 +1,200 @@
+package internal
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestSubscriptionsDisableEnableCmd(t *testing.T) {
+	tmpDir := t.TempDir()
+	takoYml := `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+subscriptions:
+  - artifact: my-org/go-lib:go-lib
+    events: [library_built]
+    workflow: update
+`
+	takoPath := filepath.Join(tmpDir, "tako.yml")
+	if err := os.WriteFile(takoPath, []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "disable", "my-org/go-lib:go-lib", "--root", tmpDir, "--until", "2030-01-02T15:04:05Z"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute disable command: %v", err)
+	}
+	if !strings.Contains(b.String(), "Disabled 1 subscription(s)") {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+
+	cfg, err := config.Load(takoPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if !cfg.Subscriptions[0].Disabled || cfg.Subscriptions[0].Until != "2030-01-02T15:04:05Z" {
+		t.Errorf("expected subscription to be disabled until 2030, got %+v", cfg.Subscriptions[0])
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "enable", "my-org/go-lib:go-lib", "--root", tmpDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute enable command: %v", err)
+	}
+
+	cfg, err = config.Load(takoPath)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	if cfg.Subscriptions[0].Disabled {
+		t.Error("expected subscription to be enabled")
+	}
+}
+
+func TestParseUntil(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	until, err := parseUntil("2h", now)
+	if err != nil || until != "2025-06-01T14:00:00Z" {
+		t.Errorf("expected duration to be resolved relative to now, got %q (%v)", until, err)
+	}
+
+	until, err = parseUntil("2030-01-02T15:04:05Z", now)
+	if err != nil || until != "2030-01-02T15:04:05Z" {
+		t.Errorf("expected timestamp to be kept, got %q (%v)", until, err)
+	}
+
+	for _, invalid := range []string{"tomorrow", "-1h"} {
+		if _, err := parseUntil(invalid, now); err == nil {
+			t.Errorf("expected error for %q", invalid)
+		}
+	}
+}
+
+func writeCachedTakoYml(t *testing.T, cacheDir, repository, takoYml string) {
+	t.Helper()
+	repoPath := filepath.Join(cacheDir, "repos", repository, "main")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+}
+
+func TestSubscriptionsListCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedTakoYml(t, cacheDir, "my-org/go-lib", `version: 0.1.0
+artifacts:
+  go-lib:
+    path: .
+`)
+	writeCachedTakoYml(t, cacheDir, "my-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+subscriptions:
+  - artifact: my-org/go-lib:go-lib
+    events: [library_built, library_released]
+    workflow: update
+    priority: 10
+  - artifact: my-org/go-lib:default
+    events: [library_built]
+    workflow: update
+    disabled: true
+`)
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "list", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute list command: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header and 2 subscriptions, got %q", b.String())
+	}
+	if fields := strings.Fields(lines[1]); len(fields) != 6 || fields[0] != "my-org/app" || fields[2] != "library_built,library_released" || fields[4] != "10" || fields[5] != "enabled" {
+		t.Errorf("unexpected first subscription: %q", lines[1])
+	}
+	if !strings.HasSuffix(lines[2], "disabled") {
+		t.Errorf("expected second subscription to be disabled: %q", lines[2])
+	}
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "list", "--cache-dir", cacheDir, "--artifact", "my-org/go-lib:default"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("failed to execute list command: %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 2 {
+		t.Errorf("expected only the default artifact subscription, got %q", b.String())
+	}
+}
+
+func TestSubscriptionsLintCmd(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedTakoYml(t, cacheDir, "my-org/go-lib", `version: 0.1.0
+artifacts:
+  go-lib:
+    path: .
+`)
+	writeCachedTakoYml(t, cacheDir, "my-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+subscriptions:
+  - artifact: my-org/go-lib:go-lib
+    events: [library_built]
+    filters: ["payload.version != ''"]
+    workflow: update
+`)
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "lint", "--cache-dir", cacheDir})
+	if err := cmd.Execute(); err != nil {
+		t.Fatalf("expected lint to pass, got %v: %s", err, b.String())
+	}
+	if !strings.Contains(b.String(), "No subscription issues found.") {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+
+	writeCachedTakoYml(t, cacheDir, "my-org/other", `version: 0.1.0
+subscriptions:
+  - artifact: my-org/go-lib:missing
+    events: [library_built]
+    workflow: removed
+`)
+
+	b.Reset()
+	cmd = NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"subscriptions", "lint", "--cache-dir", cacheDir})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "found 2 subscription issue(s)") {
+		t.Fatalf("expected lint to report 2 issues, got %v", err)
+	}
+	if !strings.Contains(b.String(), "workflow 'removed' does not exist") || !strings.Contains(b.String(), "artifact 'missing' is not declared") {
+		t.Errorf("unexpected output: %q", b.String())
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package internal
+
+import (
+	"fmt"
+	"os"
+)
+
+// isTerminal reports whether a file descriptor is a character device, like a console.
+func isTerminal(fd int) bool {
+	info, err := os.NewFile(uintptr(fd), "").Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// makeRaw is not supported on this platform: keys are read a line at a time.
+func makeRaw(fd int) (func(), error) {
+	return nil, fmt.Errorf("raw terminal mode is not supported on this platform")
+}
+
+// terminalHeight is unknown on this platform.
+func terminalHeight(fd int) int {
+	return 0
+}
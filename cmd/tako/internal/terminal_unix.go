@@ -0,0 +1,43 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package internal
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// isTerminal reports whether a file descriptor is a terminal.
+func isTerminal(fd int) bool {
+	_, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	return err == nil
+}
+
+// makeRaw puts a terminal in raw mode, so that keys are read as they are pressed and not echoed,
+// and returns the function restoring its previous mode.
+func makeRaw(fd int) (func(), error) {
+	previous, err := unix.IoctlGetTermios(fd, ioctlReadTermios)
+	if err != nil {
+		return nil, err
+	}
+	raw := *previous
+	raw.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	raw.Oflag &^= unix.OPOST
+	raw.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	raw.Cflag &^= unix.CSIZE | unix.PARENB
+	raw.Cflag |= unix.CS8
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlWriteTermios, &raw); err != nil {
+		return nil, err
+	}
+	return func() { _ = unix.IoctlSetTermios(fd, ioctlWriteTermios, previous) }, nil
+}
+
+// terminalHeight returns the number of rows of a terminal; 0 when unknown.
+func terminalHeight(fd int) int {
+	size, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ)
+	if err != nil {
+		return 0
+	}
+	return int(size.Row)
+}
@@ -4,8 +4,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
 	"github.com/dangazineu/tako/internal/git"
 	"github.com/spf13/cobra"
 )
@@ -14,12 +16,27 @@ func NewValidateCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "validate",
 		Short: "Validate a tako.yml file",
-		Long:  `Validate a tako.yml file.`,
+		Long: `Validates a tako.yml file, then checks it against the subscriptions of the repositories in the
+cache: subscriptions pointing to workflows or artifacts that do not exist, invalid CEL filters and
+schema version ranges, payload fields read by subscriptions that the emitters of their events do not
+provide, payloads breaking the event schemas of their emitter or the fields their subscribers consume,
+and events emitted by the tako.yml that no subscription receives. The last ones are
+warnings, which do not fail the validation.
+
+The repository of the tako.yml is known with --repo, or can be given with --as; otherwise the events
+it emits match the subscriptions to their type from any repository.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			root, _ := cmd.Flags().GetString("root")
 			repo, _ := cmd.Flags().GetString("repo")
 			local, _ := cmd.Flags().GetBool("local")
-			cacheDir, _ := cmd.InheritedFlags().GetString("cache-dir")
+			repository, _ := cmd.Flags().GetString("as")
+			if repository == "" && repo != "" && !strings.HasPrefix(repo, ".") && !strings.HasPrefix(repo, "file://") {
+				repository = strings.Split(repo, ":")[0]
+			}
+			cacheDir, err := resolveCacheDir(cmd)
+			if err != nil {
+				return err
+			}
 
 			workingDir, err := os.Getwd()
 			if err != nil {
@@ -35,10 +52,31 @@ func NewValidateCmd() *cobra.Command {
 				return err
 			}
 
-			_, err = config.Load(filepath.Join(entrypointPath, "tako.yml"))
+			cfg, err := config.LoadWithCache(filepath.Join(entrypointPath, "tako.yml"), cacheDir)
+			if err != nil {
+				return err
+			}
+
+			evaluator, err := engine.NewSubscriptionEvaluator()
 			if err != nil {
 				return err
 			}
+			issues, err := engine.NewDiscoveryManager(cacheDir).CheckConsistency(repository, cfg, evaluator)
+			if err != nil {
+				return err
+			}
+			errorCount := 0
+			for _, issue := range issues {
+				severity := "warning"
+				if !issue.Warning {
+					severity = "error"
+					errorCount++
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "%s: %s\n", severity, issue.String())
+			}
+			if errorCount > 0 {
+				return fmt.Errorf("found %d issue(s)", errorCount)
+			}
 			fmt.Fprintln(cmd.OutOrStdout(), "Validation successful!")
 			return nil
 		},
@@ -46,6 +84,7 @@ func NewValidateCmd() *cobra.Command {
 	cmd.Flags().String("root", "", "The root directory of the project")
 	cmd.Flags().String("repo", "", "The remote repository to use as the entrypoint (e.g. owner/repo:ref)")
 	cmd.Flags().Bool("local", false, "Only use local repositories, do not clone or update remote repositories")
+	cmd.Flags().String("as", "", "The repository of the tako.yml (owner/repo), to match the subscriptions to its events")
 	return cmd
 }
 
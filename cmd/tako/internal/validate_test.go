@@ -40,3 +40,61 @@ dependents: []
 		t.Errorf("expected output to contain %q, got %q", expected, b.String())
 	}
 }
+
+func TestValidateCmd_CrossRepoChecks(t *testing.T) {
+	cacheDir := t.TempDir()
+	subscriberDir := filepath.Join(cacheDir, "repos", "org", "app", "main")
+	if err := os.MkdirAll(subscriberDir, 0755); err != nil {
+		t.Fatalf("failed to create cached repository: %v", err)
+	}
+	subscriber := `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+subscriptions:
+  - artifact: org/lib:default
+    events: [library_built]
+    workflow: deploy
+`
+	if err := os.WriteFile(filepath.Join(subscriberDir, "tako.yml"), []byte(subscriber), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	emitter := `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: built
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+      - id: docs
+        uses: tako/fan-out@v1
+        with:
+          event_type: docs_published
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "tako.yml"), []byte(emitter), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	b := bytes.NewBufferString("")
+	cmd := NewRootCmd()
+	cmd.SetOut(b)
+	cmd.SetErr(bytes.NewBufferString(""))
+	cmd.SetArgs([]string{"validate", "--root", tmpDir, "--as", "org/lib", "--cache-dir", cacheDir})
+	err := cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "found 1 issue(s)") {
+		t.Errorf("expected the validation to fail with 1 issue, got %v", err)
+	}
+	output := b.String()
+	for _, expected := range []string{
+		"error: org/app: subscription 0 (org/lib:default -> deploy): workflow 'deploy' does not exist",
+		"warning: org/lib: workflow 'release' emits event 'docs_published' that no cached subscription receives",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("expected output to contain %q, got %q", expected, output)
+		}
+	}
+}
@@ -14,14 +14,13 @@ func NewCleanupCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "cleanup [environment]",
 		Short: "Cleanup a test environment",
-		Args:  cobra.ExactArgs(1),
+		Args:  cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			local, _ := cmd.Flags().GetBool("local")
 			owner, _ := cmd.Flags().GetString("owner")
-			envName := args[0]
-			env, ok := e2e.GetEnvironments(owner)[envName]
-			if !ok {
-				return fmt.Errorf("environment not found: %s", envName)
+			env, err := resolveEnvironment(cmd, args, owner)
+			if err != nil {
+				return err
 			}
 
 			preserveTmp, _ := cmd.Flags().GetBool("preserve-tmp")
@@ -52,6 +51,7 @@ func NewCleanupCmd() *cobra.Command {
 	cmd.Flags().String("owner", "", "The owner of the repositories")
 	cmd.Flags().Bool("local", false, "Cleanup the test case locally")
 	cmd.Flags().Bool("preserve-tmp", false, "Preserve the temporary directory")
+	cmd.Flags().String("scenario", "", "Scenario file defining the environment, instead of a built-in environment")
 	cmd.MarkFlagRequired("owner")
 	return cmd
 }
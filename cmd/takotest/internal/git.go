@@ -1 +1,21 @@
 package internal
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// commitAll commits every change of a repository, as takotest rather than the configured user.
+func commitAll(repoPath, message string) error {
+	for _, args := range [][]string{
+		{"add", "-A"},
+		{"-c", "user.name=takotest", "-c", "user.email=takotest@example.com", "commit", "-q", "--allow-empty", "-m", message},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoPath
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to commit '%s' in %s: %w: %s", message, repoPath, err, out)
+		}
+	}
+	return nil
+}
@@ -26,14 +26,16 @@ func NewSetupCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "setup [environment]",
 		Short: "Setup a test environment",
-		Args:  cobra.ExactArgs(1),
+		Long: `Sets up a built-in test environment, or the environment of a scenario file given with --scenario:
+a YAML file declaring the repositories of the environment with their tako.yml, subscriptions, files and
+seeded commits.`,
+		Args: cobra.MaximumNArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
 			local, _ := cmd.Flags().GetBool("local")
 			owner, _ := cmd.Flags().GetString("owner")
-			envName := args[0]
-			env, ok := e2e.GetEnvironments(owner)[envName]
-			if !ok {
-				return fmt.Errorf("environment not found: %s", envName)
+			env, err := resolveEnvironment(cmd, args, owner)
+			if err != nil {
+				return err
 			}
 
 			if local {
@@ -47,10 +49,31 @@ func NewSetupCmd() *cobra.Command {
 	cmd.Flags().String("cache-dir", "", "The cache directory to use")
 	cmd.Flags().Bool("with-repo-entrypoint", false, "Setup the test case with a remote entrypoint")
 	cmd.Flags().String("owner", "", "The owner of the repositories")
+	cmd.Flags().String("scenario", "", "Scenario file defining the environment, instead of a built-in environment")
 	cmd.MarkFlagRequired("owner")
 	return cmd
 }
 
+// resolveEnvironment returns the environment named by the arguments, or loaded from the
+// --scenario file.
+func resolveEnvironment(cmd *cobra.Command, args []string, owner string) (e2e.TestEnvironmentDef, error) {
+	scenario, _ := cmd.Flags().GetString("scenario")
+	if scenario != "" {
+		if len(args) > 0 {
+			return e2e.TestEnvironmentDef{}, fmt.Errorf("an environment and --scenario cannot both be given")
+		}
+		return e2e.LoadScenario(scenario)
+	}
+	if len(args) == 0 {
+		return e2e.TestEnvironmentDef{}, fmt.Errorf("an environment or --scenario is required")
+	}
+	env, ok := e2e.GetEnvironments(owner)[args[0]]
+	if !ok {
+		return e2e.TestEnvironmentDef{}, fmt.Errorf("environment not found: %s", args[0])
+	}
+	return env, nil
+}
+
 func setupLocal(cmd *cobra.Command, env *e2e.TestEnvironmentDef, owner string) error {
 	withRepoEntrypoint, _ := cmd.Flags().GetBool("with-repo-entrypoint")
 	workDir, _ := cmd.Flags().GetString("work-dir")
@@ -256,8 +279,7 @@ func setupRemote(cmd *cobra.Command, env *e2e.TestEnvironmentDef, owner string)
 		}
 
 		// Create tako.yml
-		takoConfig := buildTakoConfig(env.Name, owner, &repoDef)
-		content, err := yaml.Marshal(takoConfig)
+		content, err := takoConfigContent(env.Name, owner, &repoDef)
 		if err != nil {
 			return err
 		}
@@ -268,19 +290,29 @@ func setupRemote(cmd *cobra.Command, env *e2e.TestEnvironmentDef, owner string)
 
 		// Create other files from templates
 		for _, fileDef := range repoDef.Files {
-			templateContent, err := e2e.GetTemplate(fileDef.Template)
+			fileContent, err := e2e.FileContent(fileDef, env.Name, owner)
 			if err != nil {
 				return err
 			}
-			// Replace placeholders
-			templateContent = strings.ReplaceAll(templateContent, "{{.Owner}}", owner)
-			templateContent = strings.ReplaceAll(templateContent, "{{.EnvName}}", env.Name)
-
-			err = createOrUpdateFileWithRetry(fileDef.Path, []byte(templateContent), "add "+fileDef.Path)
+			err = createOrUpdateFileWithRetry(fileDef.Path, []byte(fileContent), "add "+fileDef.Path)
 			if err != nil {
 				return err
 			}
 		}
+
+		// Seed the commits of the scenario; the contents API commits each file separately
+		for _, commit := range repoDef.Commits {
+			for _, fileDef := range commit.Files {
+				fileContent, err := e2e.FileContent(fileDef, env.Name, owner)
+				if err != nil {
+					return err
+				}
+				err = createOrUpdateFileWithRetry(fileDef.Path, []byte(fileContent), commit.Message)
+				if err != nil {
+					return err
+				}
+			}
+		}
 	}
 
 	tmpDir, err := os.MkdirTemp("", "tako-e2e-")
@@ -333,37 +365,44 @@ func createRepoFiles(repoPath string, repoDef *e2e.RepositoryDef, envName, owner
 		return fmt.Errorf("failed to add remote in %s: %w", repoPath, err)
 	}
 
-	// Create tako.yml (special handling for malformed-config environment)
-	if envName == "malformed-config" {
-		// For malformed config, use the template file instead of generating config
-		malformedContent, err := e2e.GetTemplate("malformed-config/malformed-tako.yml")
-		if err != nil {
-			return err
-		}
-		if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(malformedContent), 0644); err != nil {
-			return err
-		}
-	} else {
-		// Normal config generation
-		takoConfig := buildTakoConfig(envName, owner, repoDef)
-		content, err := yaml.Marshal(takoConfig)
-		if err != nil {
+	// Create tako.yml
+	content, err := takoConfigContent(envName, owner, repoDef)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), content, 0644); err != nil {
+		return err
+	}
+
+	// Create other files from templates
+	if err := writeRepoFiles(repoPath, repoDef.Files, envName, owner); err != nil {
+		return err
+	}
+
+	// Seed the commits of the scenario on top of an initial commit of the files
+	if len(repoDef.Commits) > 0 {
+		if err := commitAll(repoPath, "initial commit"); err != nil {
 			return err
 		}
-		if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), content, 0644); err != nil {
-			return err
+		for _, commit := range repoDef.Commits {
+			if err := writeRepoFiles(repoPath, commit.Files, envName, owner); err != nil {
+				return err
+			}
+			if err := commitAll(repoPath, commit.Message); err != nil {
+				return err
+			}
 		}
 	}
+	return nil
+}
 
-	// Create other files from templates
-	for _, fileDef := range repoDef.Files {
-		content, err := e2e.GetTemplate(fileDef.Template)
+// writeRepoFiles writes files of an environment into a repository.
+func writeRepoFiles(repoPath string, files []e2e.FileDef, envName, owner string) error {
+	for _, fileDef := range files {
+		content, err := e2e.FileContent(fileDef, envName, owner)
 		if err != nil {
 			return err
 		}
-		// Replace placeholders
-		content = strings.ReplaceAll(content, "{{.Owner}}", owner)
-		content = strings.ReplaceAll(content, "{{.EnvName}}", envName)
 		filePath := filepath.Join(repoPath, fileDef.Path)
 		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
 			return err
@@ -375,6 +414,42 @@ func createRepoFiles(repoPath string, repoDef *e2e.RepositoryDef, envName, owner
 	return nil
 }
 
+// takoConfigContent returns the tako.yml of a repository of an environment: its own content, or a
+// generated config, with the subscriptions of the repository added.
+func takoConfigContent(envName, owner string, repoDef *e2e.RepositoryDef) ([]byte, error) {
+	// For malformed config, use the template file instead of generating config
+	if envName == "malformed-config" {
+		malformedContent, err := e2e.GetTemplate("malformed-config/malformed-tako.yml")
+		if err != nil {
+			return nil, err
+		}
+		return []byte(malformedContent), nil
+	}
+
+	var takoConfig *config.Config
+	if repoDef.TakoYAML != "" {
+		content, err := e2e.FileContent(e2e.FileDef{Content: repoDef.TakoYAML}, envName, owner)
+		if err != nil {
+			return nil, err
+		}
+		if len(repoDef.Subscriptions) == 0 {
+			return []byte(content), nil
+		}
+		takoConfig = &config.Config{}
+		if err := yaml.Unmarshal([]byte(content), takoConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse the tako.yml of %s: %w", repoDef.Name, err)
+		}
+	} else {
+		takoConfig = buildTakoConfig(envName, owner, repoDef)
+	}
+
+	for _, sub := range repoDef.Subscriptions {
+		sub.Artifact = e2e.RepositoryArtifact(owner, envName, sub.Artifact)
+		takoConfig.Subscriptions = append(takoConfig.Subscriptions, sub)
+	}
+	return yaml.Marshal(takoConfig)
+}
+
 func buildTakoConfig(envName, owner string, repoDef *e2e.RepositoryDef) *config.Config {
 	takoConfig := &config.Config{
 		Version: "0.1.0",
@@ -0,0 +1,81 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dangazineu/tako/test/e2e"
+	"github.com/spf13/cobra"
+)
+
+func NewVerifyCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "verify [environment]",
+		Short: "Verify the post-conditions of a test run",
+		Long: `Checks the post-conditions of a run in a test environment set up by takotest setup, declared in a YAML
+file given with --checks ("-" reads it from stdin):
+
+  files:      files that must or must not exist in the repositories, optionally with their content
+  fan_outs:   fan-outs recorded in the cache, with their status, number of children and child statuses
+  runs:       runs recorded in the execution history, with their status, number and children
+
+Repositories are named as in the environment, like repo-a. Exits with an error listing the failed checks.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			owner, _ := cmd.Flags().GetString("owner")
+			checks, _ := cmd.Flags().GetString("checks")
+			workDir, _ := cmd.Flags().GetString("work-dir")
+			cacheDir, _ := cmd.Flags().GetString("cache-dir")
+			withRepoEntrypoint, _ := cmd.Flags().GetBool("with-repo-entrypoint")
+			if workDir == "" && !withRepoEntrypoint {
+				return fmt.Errorf("--work-dir is required unless --with-repo-entrypoint is set")
+			}
+
+			env, err := resolveEnvironment(cmd, args, owner)
+			if err != nil {
+				return err
+			}
+
+			var data []byte
+			if checks == "-" {
+				data, err = io.ReadAll(cmd.InOrStdin())
+			} else {
+				data, err = os.ReadFile(checks)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read checks: %w", err)
+			}
+			verification, err := e2e.ParseVerification(data)
+			if err != nil {
+				return fmt.Errorf("invalid checks: %w", err)
+			}
+
+			failures := verification.Failures(e2e.VerifyTarget{
+				Env:                env,
+				Owner:              owner,
+				WorkDir:            workDir,
+				CacheDir:           cacheDir,
+				WithRepoEntrypoint: withRepoEntrypoint,
+			})
+			if len(failures) > 0 {
+				for _, failure := range failures {
+					fmt.Fprintf(cmd.OutOrStdout(), "✗ %s\n", failure)
+				}
+				return fmt.Errorf("verification failed: %d failures", len(failures))
+			}
+			fmt.Fprintf(cmd.OutOrStdout(), "✓ %d checks passed\n", verification.Checks())
+			return nil
+		},
+	}
+	cmd.Flags().String("checks", "", "YAML file of the checks to run, or - for stdin")
+	cmd.Flags().String("work-dir", "", "The working directory of the environment")
+	cmd.Flags().String("cache-dir", "", "The cache directory of the environment")
+	cmd.Flags().Bool("with-repo-entrypoint", false, "The environment was set up with a remote entrypoint")
+	cmd.Flags().String("owner", "", "The owner of the repositories")
+	cmd.Flags().String("scenario", "", "Scenario file defining the environment, instead of a built-in environment")
+	cmd.MarkFlagRequired("owner")
+	cmd.MarkFlagRequired("checks")
+	cmd.MarkFlagRequired("cache-dir")
+	return cmd
+}
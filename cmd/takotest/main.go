@@ -2,20 +2,33 @@ package main
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/dangazineu/tako/cmd/takotest/internal"
+	"github.com/dangazineu/tako/internal/config"
 	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
 	Use:   "takotest",
 	Short: "A tool for managing e2e tests for tako",
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// A missing home directory only fails when TAKO_CONFIG is not set either
+		homeDir, _ := os.UserHomeDir()
+		cfg, err := config.ApplyUserConfig(cmd.Flags(), cmd.CommandPath(), os.Environ(), homeDir)
+		if err != nil {
+			return err
+		}
+		slog.SetDefault(slog.New(cfg.LogHandler(os.Stderr)))
+		return nil
+	},
 }
 
 func main() {
 	rootCmd.AddCommand(internal.NewSetupCmd())
 	rootCmd.AddCommand(internal.NewCleanupCmd())
+	rootCmd.AddCommand(internal.NewVerifyCmd())
 	if err := rootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -132,43 +132,17 @@ func runTest(t *testing.T, tc *e2e.TestCase, env e2e.TestEnvironmentDef, mode st
 	verify(t, tc, workDir, cacheDir, withRepoEntryPoint, env)
 }
 
-func verify(t *testing.T, tc *e2e.TestCase, workDir, cacheDir string, withRepoEntryPoint bool, env e2e.TestEnvironmentDef) {
+func verify(t *testing.T, tc *e2e.TestCase, workDir, cacheDir string, withRepoEntrypoint bool, env e2e.TestEnvironmentDef) {
 	// Use the data-driven verification from the test case
-	for _, fileCheck := range tc.Verify.Files {
-		for _, repo := range env.Repositories {
-			repoName := fmt.Sprintf("%s-%s", env.Name, repo.Name)
-			var filePath string
-			if withRepoEntryPoint {
-				filePath = filepath.Join(cacheDir, "repos", testOrg, repoName, repo.Branch, fileCheck.FileName)
-			} else {
-				if repo.Name == env.Repositories[0].Name {
-					filePath = filepath.Join(workDir, repoName, fileCheck.FileName)
-				} else {
-					filePath = filepath.Join(cacheDir, "repos", testOrg, repoName, repo.Branch, fileCheck.FileName)
-				}
-			}
-
-			if fileCheck.ShouldExist {
-				content, err := os.ReadFile(filePath)
-				if err != nil {
-					t.Errorf("expected file %s to exist but got error: %v", filePath, err)
-					continue
-				}
-				if fileCheck.ExpectedContent != "" {
-					actualContent := strings.TrimSpace(string(content))
-					if actualContent != fileCheck.ExpectedContent {
-						t.Errorf("file %s: expected content %q, got %q", filePath, fileCheck.ExpectedContent, actualContent)
-					}
-				}
-			} else {
-				// Verify the file does NOT exist
-				if _, err := os.Stat(filePath); err == nil {
-					t.Errorf("file %s should not exist", filePath)
-				} else if !os.IsNotExist(err) {
-					t.Errorf("unexpected error checking file %s: %v", filePath, err)
-				}
-			}
-		}
+	failures := tc.Verify.Failures(e2e.VerifyTarget{
+		Env:                env,
+		Owner:              testOrg,
+		WorkDir:            workDir,
+		CacheDir:           cacheDir,
+		WithRepoEntrypoint: withRepoEntrypoint,
+	})
+	for _, failure := range failures {
+		t.Error(failure)
 	}
 }
 
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v63/github"
+)
+
+// tokenRefreshMargin is how long before expiry installation tokens are renewed.
+const tokenRefreshMargin = 5 * time.Minute
+
+// AppTokenSource issues installation tokens of a GitHub App. The installation of each owner
+// is looked up, unless the source is restricted to a single installation, and its tokens are
+// cached until shortly before they expire.
+type AppTokenSource struct {
+	appID          int64
+	privateKey     *rsa.PrivateKey
+	installationID int64 // When set, tokens are issued for this installation only
+	baseURL        *url.URL
+
+	mu     sync.Mutex
+	tokens map[string]*github.InstallationToken // By normalized owner
+	now    func() time.Time
+}
+
+// NewAppTokenSource creates a token source for a GitHub App from its ID and PEM-encoded
+// private key.
+func NewAppTokenSource(appID int64, privateKeyPEM []byte) (*AppTokenSource, error) {
+	key, err := parsePrivateKey(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid GitHub App private key: %w", err)
+	}
+	return &AppTokenSource{
+		appID:      appID,
+		privateKey: key,
+		tokens:     make(map[string]*github.InstallationToken),
+		now:        time.Now,
+	}, nil
+}
+
+// SetInstallationID restricts the source to one installation, whatever the owner.
+func (s *AppTokenSource) SetInstallationID(id int64) {
+	s.installationID = id
+}
+
+// SetBaseURL sets the URL of the GitHub API, for GitHub Enterprise Server.
+func (s *AppTokenSource) SetBaseURL(apiURL string) error {
+	parsed, err := url.Parse(strings.TrimSuffix(apiURL, "/") + "/")
+	if err != nil {
+		return fmt.Errorf("invalid GitHub API URL '%s': %w", apiURL, err)
+	}
+	s.baseURL = parsed
+	return nil
+}
+
+// Token implements TokenSource. It returns ErrNoToken for owners the App is not installed on.
+func (s *AppTokenSource) Token(ctx context.Context, owner string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := normalizeOwner(owner)
+	if s.installationID != 0 {
+		key = ""
+	}
+	if token, ok := s.tokens[key]; ok && s.now().Add(tokenRefreshMargin).Before(token.GetExpiresAt().Time) {
+		return token.GetToken(), nil
+	}
+
+	jwt, err := s.appJWT()
+	if err != nil {
+		return "", err
+	}
+	client := github.NewClient(nil).WithAuthToken(jwt)
+	if s.baseURL != nil {
+		client.BaseURL = s.baseURL
+	}
+
+	installationID := s.installationID
+	if installationID == 0 {
+		if installationID, err = findInstallation(ctx, client, owner); err != nil {
+			return "", err
+		}
+	}
+
+	token, _, err := client.Apps.CreateInstallationToken(ctx, installationID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create installation token: %w", err)
+	}
+	RegisterSecret(token.GetToken())
+	s.tokens[key] = token
+	return token.GetToken(), nil
+}
+
+// findInstallation returns the installation of the App on an organization or a user.
+func findInstallation(ctx context.Context, client *github.Client, owner string) (int64, error) {
+	installation, _, err := client.Apps.FindOrganizationInstallation(ctx, owner)
+	if isNotFound(err) {
+		installation, _, err = client.Apps.FindUserInstallation(ctx, owner)
+	}
+	if isNotFound(err) {
+		return 0, fmt.Errorf("%w: the GitHub App is not installed on %s", ErrNoToken, owner)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find the GitHub App installation of %s: %w", owner, err)
+	}
+	return installation.GetID(), nil
+}
+
+func isNotFound(err error) bool {
+	var errResp *github.ErrorResponse
+	return errors.As(err, &errResp) && errResp.Response != nil && errResp.Response.StatusCode == http.StatusNotFound
+}
+
+// appJWT returns a JSON Web Token authenticating as the App, valid for ten minutes. It is
+// backdated by a minute to tolerate clock drift with GitHub.
+func (s *AppTokenSource) appJWT() (string, error) {
+	now := s.now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(s.appID, 10),
+	})
+
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, s.privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GitHub App token: %w", err)
+	}
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// parsePrivateKey parses an RSA private key in PKCS #1 or PKCS #8 PEM encoding.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not an RSA key")
+	}
+	return key, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func generatePrivateKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+}
+
+// newAppServer fakes the GitHub API for an App installed on the organization "org" only.
+func newAppServer(t *testing.T, created *int32) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/orgs/org/installation", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+			t.Errorf("expected the App JWT, got %q", r.Header.Get("Authorization"))
+		}
+		fmt.Fprint(w, `{"id": 42}`)
+	})
+	mux.HandleFunc("/app/installations/42/access_tokens", func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(created, 1)
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"token": "ghs_installation%d", "expires_at": %q}`, n, time.Now().Add(time.Hour).Format(time.RFC3339))
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAppTokenSource(t *testing.T) {
+	var created int32
+	server := newAppServer(t, &created)
+
+	app, err := NewAppTokenSource(1, generatePrivateKey(t))
+	if err != nil {
+		t.Fatalf("NewAppTokenSource() error = %v", err)
+	}
+	if err := app.SetBaseURL(server.URL); err != nil {
+		t.Fatalf("SetBaseURL() error = %v", err)
+	}
+
+	token, err := app.Token(context.Background(), "org")
+	if err != nil {
+		t.Fatalf("Token() error = %v", err)
+	}
+	if token != "ghs_installation1" {
+		t.Errorf("expected the installation token, got %s", token)
+	}
+
+	// The token is cached until it is close to expiry
+	if token, _ := app.Token(context.Background(), "org"); token != "ghs_installation1" {
+		t.Errorf("expected the cached token, got %s", token)
+	}
+	app.now = func() time.Time { return time.Now().Add(time.Hour) }
+	if token, _ := app.Token(context.Background(), "org"); token != "ghs_installation2" {
+		t.Errorf("expected a renewed token, got %s", token)
+	}
+
+	// Owners without an installation fall through to the next source
+	if _, err := app.Token(context.Background(), "someone-else"); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken for an owner without an installation, got %v", err)
+	}
+
+	if got := Redact("token ghs_installation1 leaked"); got != "token *** leaked" {
+		t.Errorf("expected installation tokens to be redacted, got %q", got)
+	}
+}
+
+func TestProvider_AppWithDefaultToken(t *testing.T) {
+	var created int32
+	server := newAppServer(t, &created)
+
+	provider, err := FromEnvironment([]string{
+		"TAKO_GITHUB_APP_ID=1",
+		"TAKO_GITHUB_APP_PRIVATE_KEY=" + string(generatePrivateKey(t)),
+		"TAKO_GITHUB_API_URL=" + server.URL,
+		"GITHUB_TOKEN=default-token",
+	})
+	if err != nil {
+		t.Fatalf("FromEnvironment() error = %v", err)
+	}
+
+	if token, err := provider.Token(context.Background(), "org"); err != nil || token != "ghs_installation1" {
+		t.Errorf("expected the installation token for org, got %s, %v", token, err)
+	}
+	if token, err := provider.Token(context.Background(), "other"); err != nil || token != "default-token" {
+		t.Errorf("expected the default token for other, got %s, %v", token, err)
+	}
+}
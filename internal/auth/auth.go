@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNoToken is returned by token sources that have no token for an owner, so that the
+// next source is tried.
+var ErrNoToken = errors.New("no token available")
+
+// TokenSource provides tokens to authenticate with GitHub for the repositories of an owner.
+type TokenSource interface {
+	Token(ctx context.Context, owner string) (string, error)
+}
+
+// StaticToken is a token that does not expire, such as a personal access token or the
+// GITHUB_TOKEN of a GitHub Actions job.
+type StaticToken string
+
+// Token implements TokenSource.
+func (t StaticToken) Token(_ context.Context, _ string) (string, error) {
+	if t == "" {
+		return "", ErrNoToken
+	}
+	return string(t), nil
+}
+
+// Provider selects the token source of each owner: a source scoped to the owner first, then
+// the default sources in order. Every token it returns is registered for redaction.
+type Provider struct {
+	mu       sync.RWMutex
+	owners   map[string]TokenSource
+	defaults []TokenSource
+}
+
+// NewProvider creates a provider without any token sources; it authenticates nothing.
+func NewProvider() *Provider {
+	return &Provider{owners: make(map[string]TokenSource)}
+}
+
+// SetOwnerSource scopes a token source to the repositories of an owner (a user or an organization).
+func (p *Provider) SetOwnerSource(owner string, source TokenSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.owners[normalizeOwner(owner)] = source
+}
+
+// AddDefaultSource adds a token source for the owners without a scoped source. Default
+// sources are tried in the order they were added.
+func (p *Provider) AddDefaultSource(source TokenSource) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.defaults = append(p.defaults, source)
+}
+
+// Token implements TokenSource. It returns ErrNoToken when no source has a token for the
+// owner, in which case requests are made anonymously.
+func (p *Provider) Token(ctx context.Context, owner string) (string, error) {
+	p.mu.RLock()
+	sources := make([]TokenSource, 0, len(p.defaults)+1)
+	if source, ok := p.owners[normalizeOwner(owner)]; ok {
+		sources = append(sources, source)
+	}
+	sources = append(sources, p.defaults...)
+	p.mu.RUnlock()
+
+	for _, source := range sources {
+		token, err := source.Token(ctx, owner)
+		if errors.Is(err, ErrNoToken) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to get token for %s: %w", owner, err)
+		}
+		RegisterSecret(token)
+		return token, nil
+	}
+	return "", ErrNoToken
+}
+
+// Environment variables read by FromEnvironment.
+const (
+	envToken             = "TAKO_GITHUB_TOKEN"
+	envOwnerTokenPrefix  = "TAKO_GITHUB_TOKEN_"
+	envAppID             = "TAKO_GITHUB_APP_ID"
+	envAppPrivateKey     = "TAKO_GITHUB_APP_PRIVATE_KEY"
+	envAppPrivateKeyFile = "TAKO_GITHUB_APP_PRIVATE_KEY_FILE"
+	envAppInstallationID = "TAKO_GITHUB_APP_INSTALLATION_ID"
+	envAPIURL            = "TAKO_GITHUB_API_URL"
+)
+
+// defaultTokenVariables are the variables holding the default token, by precedence.
+var defaultTokenVariables = []string{envToken, "TAKO_GIT_TOKEN", "GITHUB_TOKEN", "GH_TOKEN"}
+
+// FromEnvironment configures a provider from environment variables, given as KEY=value:
+//   - TAKO_GITHUB_TOKEN_<OWNER> scopes a token to an owner, with the owner in upper case and
+//     hyphens replaced by underscores (TAKO_GITHUB_TOKEN_MY_ORG for my-org);
+//   - TAKO_GITHUB_APP_ID with TAKO_GITHUB_APP_PRIVATE_KEY or TAKO_GITHUB_APP_PRIVATE_KEY_FILE
+//     authenticates as the installations of a GitHub App, optionally restricted to
+//     TAKO_GITHUB_APP_INSTALLATION_ID;
+//   - TAKO_GITHUB_TOKEN, TAKO_GIT_TOKEN, GITHUB_TOKEN or GH_TOKEN is the token of all other owners.
+//
+// App installations take precedence over the default token for the owners they are installed on.
+func FromEnvironment(env []string) (*Provider, error) {
+	vars := make(map[string]string, len(env))
+	for _, entry := range env {
+		if key, value, ok := strings.Cut(entry, "="); ok && value != "" {
+			vars[key] = value
+		}
+	}
+
+	provider := NewProvider()
+	for key, value := range vars {
+		if owner, ok := strings.CutPrefix(key, envOwnerTokenPrefix); ok && owner != "" {
+			provider.SetOwnerSource(owner, StaticToken(value))
+		}
+	}
+
+	if appID := vars[envAppID]; appID != "" {
+		app, err := appFromEnvironment(appID, vars)
+		if err != nil {
+			return nil, err
+		}
+		provider.AddDefaultSource(app)
+	}
+
+	for _, name := range defaultTokenVariables {
+		if token := vars[name]; token != "" {
+			provider.AddDefaultSource(StaticToken(token))
+			break
+		}
+	}
+
+	return provider, nil
+}
+
+// appFromEnvironment creates the GitHub App token source configured by environment variables.
+func appFromEnvironment(appID string, vars map[string]string) (*AppTokenSource, error) {
+	id, err := strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s '%s': must be a number", envAppID, appID)
+	}
+
+	privateKey := []byte(vars[envAppPrivateKey])
+	if len(privateKey) == 0 {
+		path := vars[envAppPrivateKeyFile]
+		if path == "" {
+			return nil, fmt.Errorf("%s requires %s or %s", envAppID, envAppPrivateKey, envAppPrivateKeyFile)
+		}
+		if privateKey, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read GitHub App private key: %w", err)
+		}
+	}
+
+	app, err := NewAppTokenSource(id, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if installationID := vars[envAppInstallationID]; installationID != "" {
+		id, err := strconv.ParseInt(installationID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%s': must be a number", envAppInstallationID, installationID)
+		}
+		app.SetInstallationID(id)
+	}
+	if apiURL := vars[envAPIURL]; apiURL != "" {
+		if err := app.SetBaseURL(apiURL); err != nil {
+			return nil, err
+		}
+	}
+	return app, nil
+}
+
+// normalizeOwner makes owners case-insensitive and matches the owners of environment
+// variables, in which hyphens are written as underscores.
+func normalizeOwner(owner string) string {
+	return strings.ReplaceAll(strings.ToLower(owner), "-", "_")
+}
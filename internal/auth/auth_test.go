@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFromEnvironment_Precedence(t *testing.T) {
+	provider, err := FromEnvironment([]string{
+		"GITHUB_TOKEN=default-token",
+		"GH_TOKEN=ignored-token",
+		"TAKO_GITHUB_TOKEN_MY_ORG=my-org-token",
+		"TAKO_GITHUB_TOKEN_EMPTY=",
+	})
+	if err != nil {
+		t.Fatalf("FromEnvironment() error = %v", err)
+	}
+
+	tests := []struct {
+		owner string
+		want  string
+	}{
+		{owner: "my-org", want: "my-org-token"},
+		{owner: "My-Org", want: "my-org-token"},
+		{owner: "other", want: "default-token"},
+		{owner: "empty", want: "default-token"},
+	}
+	for _, tt := range tests {
+		got, err := provider.Token(context.Background(), tt.owner)
+		if err != nil {
+			t.Fatalf("Token(%s) error = %v", tt.owner, err)
+		}
+		if got != tt.want {
+			t.Errorf("Token(%s) = %s, want %s", tt.owner, got, tt.want)
+		}
+	}
+}
+
+func TestFromEnvironment_NoToken(t *testing.T) {
+	provider, err := FromEnvironment([]string{"PATH=/usr/bin"})
+	if err != nil {
+		t.Fatalf("FromEnvironment() error = %v", err)
+	}
+	if _, err := provider.Token(context.Background(), "org"); !errors.Is(err, ErrNoToken) {
+		t.Errorf("expected ErrNoToken, got %v", err)
+	}
+}
+
+func TestFromEnvironment_InvalidApp(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+	}{
+		{name: "invalid id", env: []string{"TAKO_GITHUB_APP_ID=abc", "TAKO_GITHUB_APP_PRIVATE_KEY=key"}},
+		{name: "missing key", env: []string{"TAKO_GITHUB_APP_ID=1"}},
+		{name: "invalid key", env: []string{"TAKO_GITHUB_APP_ID=1", "TAKO_GITHUB_APP_PRIVATE_KEY=not a key"}},
+		{name: "missing key file", env: []string{"TAKO_GITHUB_APP_ID=1", "TAKO_GITHUB_APP_PRIVATE_KEY_FILE=/does/not/exist.pem"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := FromEnvironment(tt.env); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+type failingSource struct{}
+
+func (failingSource) Token(context.Context, string) (string, error) {
+	return "", errors.New("boom")
+}
+
+func TestProvider_SourceError(t *testing.T) {
+	provider := NewProvider()
+	provider.AddDefaultSource(StaticToken(""))
+	provider.AddDefaultSource(failingSource{})
+	provider.AddDefaultSource(StaticToken("never-reached"))
+
+	if _, err := provider.Token(context.Background(), "org"); err == nil || errors.Is(err, ErrNoToken) {
+		t.Errorf("expected the error of the failing source, got %v", err)
+	}
+}
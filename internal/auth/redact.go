@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// redactedValue replaces secrets in redacted text.
+const redactedValue = "***"
+
+// minSecretLength avoids redacting short values that would mangle unrelated text.
+const minSecretLength = 8
+
+var (
+	secretsMu sync.RWMutex
+	secrets   = make(map[string]struct{})
+)
+
+// RegisterSecret records a value, such as a token, that Redact removes from text.
+func RegisterSecret(secret string) {
+	if len(secret) < minSecretLength {
+		return
+	}
+	secretsMu.Lock()
+	defer secretsMu.Unlock()
+
+	secrets[secret] = struct{}{}
+}
+
+// Redact replaces the registered secrets in text.
+func Redact(text string) string {
+	secretsMu.RLock()
+	defer secretsMu.RUnlock()
+
+	for secret := range secrets {
+		text = strings.ReplaceAll(text, secret, redactedValue)
+	}
+	return text
+}
+
+// RedactingHandler is a slog handler that redacts the registered secrets from the messages
+// and string attributes of records before passing them to another handler.
+type RedactingHandler struct {
+	next slog.Handler
+}
+
+// NewRedactingHandler wraps a handler so that it never logs registered secrets.
+func NewRedactingHandler(next slog.Handler) *RedactingHandler {
+	return &RedactingHandler{next: next}
+}
+
+// Enabled implements slog.Handler.
+func (h *RedactingHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.next.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler.
+func (h *RedactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, Redact(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.next.Handle(ctx, redacted)
+}
+
+// WithAttrs implements slog.Handler.
+func (h *RedactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, len(attrs))
+	for i, attr := range attrs {
+		redacted[i] = redactAttr(attr)
+	}
+	return &RedactingHandler{next: h.next.WithAttrs(redacted)}
+}
+
+// WithGroup implements slog.Handler.
+func (h *RedactingHandler) WithGroup(name string) slog.Handler {
+	return &RedactingHandler{next: h.next.WithGroup(name)}
+}
+
+// redactAttr redacts string values, errors and groups of attributes.
+func redactAttr(attr slog.Attr) slog.Attr {
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, Redact(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, len(group))
+		for i, member := range group {
+			redacted[i] = redactAttr(member)
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, Redact(err.Error()))
+		}
+	}
+	return slog.Attr{Key: attr.Key, Value: value}
+}
@@ -0,0 +1,276 @@
+package cache
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// EntryKind is the kind of data stored in a cache entry.
+type EntryKind string
+
+const (
+	// KindRepository is a clone of a repository at a ref, under repos/<owner>/<repo>/<ref>.
+	KindRepository EntryKind = "repository"
+	// KindFanOutState is the persisted state of a fan-out, under fanout-states.
+	KindFanOutState EntryKind = "fanout-state"
+	// KindWorkspace is a child workspace left behind by a fan-out, under workspaces.
+	KindWorkspace EntryKind = "workspace"
+)
+
+// Entry is a unit of the cache directory that can be evicted on its own.
+type Entry struct {
+	Kind EntryKind
+	// Name identifies the entry, such as owner/repo:ref for repositories.
+	Name string
+	Path string
+	Size int64
+	// LastUsed is when the entry was last used, or last modified for entries that are not tracked.
+	LastUsed time.Time
+	// Active is set for fan-out states that have not completed yet; they are never evicted.
+	Active bool
+}
+
+// Scan lists the entries of a cache directory, sorted by kind and name. Missing parts of the
+// cache are skipped.
+func Scan(cacheDir string) ([]Entry, error) {
+	var entries []Entry
+
+	repos, err := scanRepositories(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, repos...)
+
+	states, err := scanFanOutStates(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, states...)
+
+	workspaces, err := scanWorkspaces(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, workspaces...)
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Kind != entries[j].Kind {
+			return entries[i].Kind < entries[j].Kind
+		}
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// Repositories lists the repository clones of a cache directory, sorted by name.
+func Repositories(cacheDir string) ([]Entry, error) {
+	entries, err := scanRepositories(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name < entries[j].Name
+	})
+	return entries, nil
+}
+
+// MatchesRepository reports whether a repository entry matches a reference given either as
+// owner/repo, which matches every cached ref, or as owner/repo:ref.
+func MatchesRepository(entry Entry, ref string) bool {
+	if entry.Kind != KindRepository {
+		return false
+	}
+	if strings.Contains(ref, ":") {
+		return entry.Name == ref
+	}
+	return strings.SplitN(entry.Name, ":", 2)[0] == ref
+}
+
+// RepositoryRef returns the ref a repository entry was cloned at.
+func RepositoryRef(entry Entry) string {
+	parts := strings.SplitN(entry.Name, ":", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// Touch records that a cached repository was used, so it is evicted after the ones used less
+// recently. The time of use is the modification time of the repository directory.
+func Touch(path string) error {
+	now := time.Now()
+	if err := os.Chtimes(path, now, now); err != nil {
+		return fmt.Errorf("failed to record use of %s: %w", path, err)
+	}
+	return nil
+}
+
+// scanRepositories lists the clones under repos/<owner>/<repo>/<ref>.
+func scanRepositories(cacheDir string) ([]Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(cacheDir, "repos", "*", "*", "*"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, path := range matches {
+		// Hidden directories are clones in progress
+		if strings.HasPrefix(filepath.Base(path), ".") {
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		size, err := DirSize(path)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, _ := filepath.Rel(filepath.Join(cacheDir, "repos"), path)
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		entries = append(entries, Entry{
+			Kind:     KindRepository,
+			Name:     fmt.Sprintf("%s/%s:%s", parts[0], parts[1], parts[2]),
+			Path:     path,
+			Size:     size,
+			LastUsed: info.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+// fanOutStateFile holds the fields of a persisted fan-out state that eviction depends on.
+type fanOutStateFile struct {
+	Status  string     `json:"status"`
+	EndTime *time.Time `json:"end_time,omitempty"`
+}
+
+// scanFanOutStates lists the fan-out state files. States that cannot be read are reported as
+// inactive, last used when the file was last written.
+func scanFanOutStates(cacheDir string) ([]Entry, error) {
+	matches, err := filepath.Glob(filepath.Join(cacheDir, "fanout-states", "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+
+		entry := Entry{
+			Kind:     KindFanOutState,
+			Name:     strings.TrimSuffix(filepath.Base(path), ".json"),
+			Path:     path,
+			Size:     info.Size(),
+			LastUsed: info.ModTime(),
+		}
+		if data, err := os.ReadFile(path); err == nil {
+			if state, ok := decodeFanOutStateFile(data); ok {
+				entry.Active = state.EndTime == nil && isActiveFanOutStatus(state.Status)
+				if state.EndTime != nil {
+					entry.LastUsed = *state.EndTime
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// decodeFanOutStateFile decodes the fields eviction depends on from a fan-out state file, either
+// JSON or in the compact encoding: a gzipped gob stream whose first value holds them.
+func decodeFanOutStateFile(data []byte) (fanOutStateFile, bool) {
+	var state fanOutStateFile
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		compressed, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return state, false
+		}
+		return state, gob.NewDecoder(compressed).Decode(&state) == nil
+	}
+	return state, json.Unmarshal(data, &state) == nil
+}
+
+// isActiveFanOutStatus reports whether a fan-out with the given status may still be running.
+func isActiveFanOutStatus(status string) bool {
+	switch status {
+	case "pending", "running", "waiting":
+		return true
+	default:
+		return false
+	}
+}
+
+// scanWorkspaces lists the child workspaces kept in the cache directory.
+func scanWorkspaces(cacheDir string) ([]Entry, error) {
+	dirEntries, err := os.ReadDir(filepath.Join(cacheDir, "workspaces"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read workspaces: %w", err)
+	}
+
+	var entries []Entry
+	for _, dirEntry := range dirEntries {
+		info, err := dirEntry.Info()
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		path := filepath.Join(cacheDir, "workspaces", dirEntry.Name())
+		size, err := DirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, Entry{
+			Kind:     KindWorkspace,
+			Name:     dirEntry.Name(),
+			Path:     path,
+			Size:     size,
+			LastUsed: info.ModTime(),
+		})
+	}
+	return entries, nil
+}
+
+// DirSize returns the total size of the regular files under a directory, without following
+// symbolic links. Files removed while walking are ignored.
+func DirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to compute size of %s: %w", path, err)
+	}
+	return size, nil
+}
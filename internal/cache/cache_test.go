@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, path string, size int) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeFile(t, filepath.Join(cacheDir, "repos", "owner", "repo", "main", "README.md"), 100)
+	writeFile(t, filepath.Join(cacheDir, "repos", "owner", "repo", "main", "src", "main.go"), 50)
+	writeFile(t, filepath.Join(cacheDir, "workspaces", "child-1", "file"), 10)
+	if err := os.MkdirAll(filepath.Join(cacheDir, "fanout-states"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "fanout-states", "done.json"), []byte(`{"status":"completed","end_time":"2024-01-02T03:04:05Z"}`), 0644); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(cacheDir, "fanout-states", "running.json"), []byte(`{"status":"running"}`), 0644); err != nil {
+		t.Fatalf("failed to write state: %v", err)
+	}
+
+	entries, err := Scan(cacheDir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(entries) != 4 {
+		t.Fatalf("expected 4 entries, got %d: %+v", len(entries), entries)
+	}
+
+	byName := make(map[string]Entry)
+	for _, entry := range entries {
+		byName[entry.Name] = entry
+	}
+
+	repo := byName["owner/repo:main"]
+	if repo.Kind != KindRepository || repo.Size != 150 {
+		t.Errorf("unexpected repository entry: %+v", repo)
+	}
+	if ws := byName["child-1"]; ws.Kind != KindWorkspace || ws.Size != 10 {
+		t.Errorf("unexpected workspace entry: %+v", ws)
+	}
+	done := byName["done"]
+	if done.Kind != KindFanOutState || done.Active {
+		t.Errorf("unexpected completed state entry: %+v", done)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !done.LastUsed.Equal(want) {
+		t.Errorf("expected completed state last used at its end time %v, got %v", want, done.LastUsed)
+	}
+	if !byName["running"].Active {
+		t.Errorf("expected running state to be active")
+	}
+}
+
+func TestScan_EmptyCache(t *testing.T) {
+	entries, err := Scan(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %+v", entries)
+	}
+}
+
+func TestTouch(t *testing.T) {
+	dir := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(dir, old, old); err != nil {
+		t.Fatalf("failed to change mod time: %v", err)
+	}
+
+	if err := Touch(dir); err != nil {
+		t.Fatalf("Touch() error = %v", err)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("failed to stat: %v", err)
+	}
+	if time.Since(info.ModTime()) > time.Minute {
+		t.Errorf("expected mod time to be updated, got %v", info.ModTime())
+	}
+}
+
+func TestMatchesRepository(t *testing.T) {
+	entry := Entry{Kind: KindRepository, Name: "owner/repo:main"}
+	tests := map[string]bool{
+		"owner/repo":         true,
+		"owner/repo:main":    true,
+		"owner/repo:develop": false,
+		"owner/other":        false,
+		"owner/rep":          false,
+	}
+	for ref, want := range tests {
+		if got := MatchesRepository(entry, ref); got != want {
+			t.Errorf("MatchesRepository(%q) = %v, want %v", ref, got, want)
+		}
+	}
+	if got := RepositoryRef(entry); got != "main" {
+		t.Errorf("RepositoryRef() = %q, want main", got)
+	}
+}
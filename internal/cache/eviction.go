@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+// DefaultMaxStateAge is how long completed fan-out states and child workspaces are kept.
+const DefaultMaxStateAge = 7 * 24 * time.Hour
+
+// Policy decides which cache entries are evicted.
+type Policy struct {
+	// MaxSize is the size the cache is brought back under by evicting the least recently used
+	// entries; 0 means no limit.
+	MaxSize int64
+	// MaxStateAge is the age after which completed fan-out states and child workspaces are
+	// evicted regardless of the size of the cache; 0 means no limit.
+	MaxStateAge time.Duration
+}
+
+// Eviction is an entry to remove from the cache, and why.
+type Eviction struct {
+	Entry  Entry
+	Reason string
+}
+
+// Plan returns the entries to evict from a cache under a policy: first the fan-out states and
+// workspaces older than MaxStateAge, then, while the cache is larger than MaxSize, the least
+// recently used of the remaining entries. Active fan-out states are never evicted.
+func Plan(entries []Entry, policy Policy, now time.Time) []Eviction {
+	var evictions []Eviction
+	var candidates []Entry
+	var total int64
+
+	for _, entry := range entries {
+		if entry.Active {
+			total += entry.Size
+			continue
+		}
+
+		age := now.Sub(entry.LastUsed)
+		if entry.Kind != KindRepository && policy.MaxStateAge > 0 && age > policy.MaxStateAge {
+			evictions = append(evictions, Eviction{
+				Entry:  entry,
+				Reason: fmt.Sprintf("%s last used %s ago, older than %s", entry.Kind, formatAge(age), formatAge(policy.MaxStateAge)),
+			})
+			continue
+		}
+
+		total += entry.Size
+		candidates = append(candidates, entry)
+	}
+
+	if policy.MaxSize <= 0 || total <= policy.MaxSize {
+		return evictions
+	}
+
+	// Least recently used first
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].LastUsed.Before(candidates[j].LastUsed)
+	})
+	for _, entry := range candidates {
+		if total <= policy.MaxSize {
+			break
+		}
+		evictions = append(evictions, Eviction{
+			Entry: entry,
+			Reason: fmt.Sprintf("least recently used (last used %s ago) while the cache is %s, over the %s limit",
+				formatAge(now.Sub(entry.LastUsed)), FormatSize(total), FormatSize(policy.MaxSize)),
+		})
+		total -= entry.Size
+	}
+
+	return evictions
+}
+
+// Apply removes evicted entries from the cache and returns the number of bytes freed. It
+// carries on after failures and returns the first error.
+func Apply(evictions []Eviction) (int64, error) {
+	var freed int64
+	var firstErr error
+	for _, eviction := range evictions {
+		if err := os.RemoveAll(eviction.Entry.Path); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("failed to evict %s: %w", eviction.Entry.Name, err)
+			}
+			continue
+		}
+		freed += eviction.Entry.Size
+	}
+	return freed, firstErr
+}
+
+// TotalSize returns the total size of cache entries.
+func TotalSize(entries []Entry) int64 {
+	var total int64
+	for _, entry := range entries {
+		total += entry.Size
+	}
+	return total
+}
+
+// formatAge formats a duration in the largest whole unit among days, hours and minutes.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d/(24*time.Hour)))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d/time.Hour))
+	default:
+		return fmt.Sprintf("%dm", int(d/time.Minute))
+	}
+}
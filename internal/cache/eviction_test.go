@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	now := time.Now()
+	entries := []Entry{
+		{Kind: KindRepository, Name: "a/old:main", Size: 400, LastUsed: now.Add(-72 * time.Hour)},
+		{Kind: KindRepository, Name: "a/recent:main", Size: 400, LastUsed: now.Add(-time.Hour)},
+		{Kind: KindRepository, Name: "a/middle:main", Size: 400, LastUsed: now.Add(-24 * time.Hour)},
+		{Kind: KindFanOutState, Name: "stale", Size: 10, LastUsed: now.Add(-30 * 24 * time.Hour)},
+		{Kind: KindFanOutState, Name: "active", Size: 10, LastUsed: now.Add(-30 * 24 * time.Hour), Active: true},
+		{Kind: KindWorkspace, Name: "fresh", Size: 10, LastUsed: now},
+	}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		want   []string
+	}{
+		{
+			name:   "no limits",
+			policy: Policy{},
+			want:   nil,
+		},
+		{
+			name:   "old states only",
+			policy: Policy{MaxStateAge: DefaultMaxStateAge},
+			want:   []string{"stale"},
+		},
+		{
+			name:   "under the size limit",
+			policy: Policy{MaxSize: 2000},
+			want:   nil,
+		},
+		{
+			name:   "least recently used first",
+			policy: Policy{MaxSize: 500, MaxStateAge: DefaultMaxStateAge},
+			want:   []string{"stale", "a/old:main", "a/middle:main"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evictions := Plan(entries, tt.policy, now)
+			var got []string
+			for _, eviction := range evictions {
+				if eviction.Reason == "" {
+					t.Errorf("expected a reason for evicting %s", eviction.Entry.Name)
+				}
+				got = append(got, eviction.Entry.Name)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Plan() evicted %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "repo")
+	writeFile(t, filepath.Join(path, "file"), 64)
+
+	freed, err := Apply([]Eviction{{Entry: Entry{Name: "repo", Path: path, Size: 64}}})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if freed != 64 {
+		t.Errorf("expected 64 bytes freed, got %d", freed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", path)
+	}
+}
@@ -0,0 +1,60 @@
+package cache
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits are the suffixes accepted by ParseSize, longest first so that "MiB" is not read as "B".
+var sizeUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"KiB", 1 << 10}, {"MiB", 1 << 20}, {"GiB", 1 << 30}, {"TiB", 1 << 40},
+	{"Ki", 1 << 10}, {"Mi", 1 << 20}, {"Gi", 1 << 30}, {"Ti", 1 << 40},
+	{"KB", 1e3}, {"MB", 1e6}, {"GB", 1e9}, {"TB", 1e12},
+	{"K", 1e3}, {"M", 1e6}, {"G", 1e9}, {"T", 1e12},
+	{"B", 1},
+}
+
+// ParseSize parses a size such as "512Mi", "10GB" or "1073741824" into bytes.
+func ParseSize(spec string) (int64, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return 0, fmt.Errorf("empty size")
+	}
+
+	multiplier := 1.0
+	number := spec
+	for _, unit := range sizeUnits {
+		if strings.HasSuffix(spec, unit.suffix) {
+			multiplier = unit.multiplier
+			number = strings.TrimSpace(strings.TrimSuffix(spec, unit.suffix))
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", spec)
+	}
+	return int64(value * multiplier), nil
+}
+
+// FormatSize formats a number of bytes with a binary unit, such as "1.5GiB".
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%dB", bytes)
+	}
+
+	value := float64(bytes)
+	suffixes := []string{"KiB", "MiB", "GiB", "TiB"}
+	i := -1
+	for value >= unit && i < len(suffixes)-1 {
+		value /= unit
+		i++
+	}
+	return fmt.Sprintf("%.1f%s", value, suffixes[i])
+}
@@ -0,0 +1,46 @@
+package cache
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    int64
+		wantErr bool
+	}{
+		{spec: "1024", want: 1024},
+		{spec: "512Mi", want: 512 << 20},
+		{spec: "10GiB", want: 10 << 30},
+		{spec: "1.5G", want: 1500000000},
+		{spec: "200MB", want: 200000000},
+		{spec: "", wantErr: true},
+		{spec: "lots", wantErr: true},
+		{spec: "-1G", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParseSize(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSize(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.spec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	tests := map[int64]string{
+		512:      "512B",
+		1536:     "1.5KiB",
+		10 << 30: "10.0GiB",
+		3 << 40:  "3.0TiB",
+	}
+	for bytes, want := range tests {
+		if got := FormatSize(bytes); got != want {
+			t.Errorf("FormatSize(%d) = %q, want %q", bytes, got, want)
+		}
+	}
+}
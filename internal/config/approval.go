@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Actions taken when an approval gate times out.
+const (
+	ApprovalOnTimeoutReject  = "reject"
+	ApprovalOnTimeoutApprove = "approve"
+)
+
+// ApprovalParams are the with: parameters of the tako/approval@v1 step, which pauses the run
+// until tako approve approves or rejects it.
+type ApprovalParams struct {
+	// Message tells the approvers what they approve. It may use templates.
+	Message string `yaml:"message,omitempty"`
+	// Timeout is the Go duration after which the gate is decided by OnTimeout; the gate waits
+	// forever when empty.
+	Timeout string `yaml:"timeout,omitempty"`
+	// OnTimeout is reject (default) or approve.
+	OnTimeout string `yaml:"on_timeout,omitempty"`
+}
+
+// ParseApprovalParams parses the with: parameters of a tako/approval@v1 step.
+func ParseApprovalParams(with map[string]interface{}) (*ApprovalParams, error) {
+	// The parameters are decoded like the rest of tako.yml, rejecting unknown ones
+	data, err := yaml.Marshal(with)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	var params ApprovalParams
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&params); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// Validate checks the timeout and the action taken when it expires.
+func (p *ApprovalParams) Validate() error {
+	if err := validateTimeout(p.Timeout); err != nil {
+		return err
+	}
+	switch p.OnTimeout {
+	case "", ApprovalOnTimeoutReject, ApprovalOnTimeoutApprove:
+	default:
+		return fmt.Errorf("on_timeout must be reject or approve, got '%s'", p.OnTimeout)
+	}
+	if p.OnTimeout != "" && p.Timeout == "" {
+		return fmt.Errorf("on_timeout requires a timeout")
+	}
+	return nil
+}
+
+// EffectiveOnTimeout returns the action taken when the gate times out, rejecting by default.
+func (p *ApprovalParams) EffectiveOnTimeout() string {
+	if p.OnTimeout == "" {
+		return ApprovalOnTimeoutReject
+	}
+	return p.OnTimeout
+}
+
+func isApprovalStep(uses string) bool {
+	return strings.HasPrefix(uses, "tako/approval@")
+}
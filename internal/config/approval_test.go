@@ -0,0 +1,64 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseApprovalParams(t *testing.T) {
+	params, err := ParseApprovalParams(nil)
+	if err != nil {
+		t.Fatalf("ParseApprovalParams() error = %v", err)
+	}
+	if params.EffectiveOnTimeout() != ApprovalOnTimeoutReject {
+		t.Errorf("expected gates to be rejected on timeout by default, got %q", params.EffectiveOnTimeout())
+	}
+	params, err = ParseApprovalParams(map[string]interface{}{"message": "Deploy {{ .Inputs.version }}?", "timeout": "1h", "on_timeout": "approve"})
+	if err != nil {
+		t.Fatalf("ParseApprovalParams() error = %v", err)
+	}
+	if params.Timeout != "1h" || params.EffectiveOnTimeout() != ApprovalOnTimeoutApprove {
+		t.Errorf("unexpected parameters: %+v", params)
+	}
+
+	testCases := []struct {
+		name    string
+		with    map[string]interface{}
+		wantErr string
+	}{
+		{name: "invalid timeout", with: map[string]interface{}{"timeout": "soon"}, wantErr: "invalid timeout"},
+		{name: "unknown action", with: map[string]interface{}{"timeout": "1h", "on_timeout": "escalate"}, wantErr: "on_timeout must be reject or approve"},
+		{name: "action without timeout", with: map[string]interface{}{"on_timeout": "approve"}, wantErr: "on_timeout requires a timeout"},
+		{name: "unknown parameter", with: map[string]interface{}{"approvers": []string{"alice"}}, wantErr: "field approvers not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseApprovalParams(tc.with)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateSubscriptionApproval(t *testing.T) {
+	subscription := Subscription{
+		Artifact:         "my-org/lib:default",
+		Events:           []string{"library_built"},
+		Workflow:         "update",
+		ApprovalRequired: true,
+		ApprovalTimeout:  "30m",
+	}
+	if err := subscription.ValidateSubscription(); err != nil {
+		t.Errorf("ValidateSubscription() error = %v", err)
+	}
+
+	subscription.ApprovalTimeout = "-1m"
+	if err := subscription.ValidateSubscription(); err == nil || !strings.Contains(err.Error(), "invalid approval_timeout") {
+		t.Errorf("expected the negative timeout to be rejected, got %v", err)
+	}
+	subscription.ApprovalRequired, subscription.ApprovalTimeout = false, "30m"
+	if err := subscription.ValidateSubscription(); err == nil || !strings.Contains(err.Error(), "approval_timeout requires approval_required") {
+		t.Errorf("expected the timeout without approval to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+var circuitBreakerEndpointRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+(:[A-Za-z0-9_-]+)?$`)
+
+// CircuitBreakersConfig configures the circuit breakers that stop fan-outs from triggering the
+// child workflows of subscribers that keep failing.
+type CircuitBreakersConfig struct {
+	// Default applies to every endpoint without an override.
+	Default CircuitBreakerSettings `yaml:"default,omitempty"`
+	// Endpoints overrides Default for a repository, as "owner/repo", or for one of its
+	// workflows, as "owner/repo:workflow". Workflow overrides take precedence.
+	Endpoints map[string]CircuitBreakerSettings `yaml:"endpoints,omitempty"`
+}
+
+// CircuitBreakerSettings are the thresholds of a circuit breaker. Unset fields inherit the
+// default settings, or else the built-in defaults.
+type CircuitBreakerSettings struct {
+	// FailureThreshold is the number of consecutive failures opening the breaker.
+	FailureThreshold int `yaml:"failure_threshold,omitempty"`
+	// SuccessThreshold is the number of successful probes closing a half-open breaker.
+	SuccessThreshold int `yaml:"success_threshold,omitempty"`
+	// OpenDuration is how long an open breaker rejects calls before probing, as a Go duration.
+	OpenDuration string `yaml:"open_duration,omitempty"`
+	// HalfOpenProbes is the number of calls a half-open breaker lets through.
+	HalfOpenProbes int `yaml:"half_open_probes,omitempty"`
+}
+
+// LoadCircuitBreakers reads the circuit_breakers section of a tako.yml or daemon config file,
+// without validating the rest of the file. It returns nil when the file has no such section.
+func LoadCircuitBreakers(path string) (*CircuitBreakersConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var file struct {
+		CircuitBreakers *CircuitBreakersConfig `yaml:"circuit_breakers"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("could not unmarshal config: %w", err)
+	}
+	if file.CircuitBreakers == nil {
+		return nil, nil
+	}
+	if err := file.CircuitBreakers.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid circuit breakers: %w", err)
+	}
+	return file.CircuitBreakers, nil
+}
+
+// Validate checks the default settings and the endpoint overrides.
+func (c *CircuitBreakersConfig) Validate() error {
+	if err := c.Default.Validate(); err != nil {
+		return fmt.Errorf("default: %w", err)
+	}
+	for endpoint, settings := range c.Endpoints {
+		if !circuitBreakerEndpointRegex.MatchString(endpoint) {
+			return fmt.Errorf("invalid endpoint '%s': must be owner/repo or owner/repo:workflow", endpoint)
+		}
+		if err := settings.Validate(); err != nil {
+			return fmt.Errorf("endpoint '%s': %w", endpoint, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the thresholds are not negative and that the open duration parses.
+func (s *CircuitBreakerSettings) Validate() error {
+	if s.FailureThreshold < 0 {
+		return fmt.Errorf("failure_threshold must not be negative")
+	}
+	if s.SuccessThreshold < 0 {
+		return fmt.Errorf("success_threshold must not be negative")
+	}
+	if s.HalfOpenProbes < 0 {
+		return fmt.Errorf("half_open_probes must not be negative")
+	}
+	if err := validateTimeout(s.OpenDuration); err != nil {
+		return fmt.Errorf("invalid open_duration: %w", err)
+	}
+	return nil
+}
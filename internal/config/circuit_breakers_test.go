@@ -0,0 +1,76 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadCircuitBreakers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tako.yml")
+	content := `version: 0.1.0
+circuit_breakers:
+  default:
+    failure_threshold: 3
+    open_duration: 1m
+  endpoints:
+    my-org/flaky:
+      failure_threshold: 10
+    my-org/flaky:deploy:
+      half_open_probes: 1
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := LoadCircuitBreakers(path)
+	if err != nil {
+		t.Fatalf("LoadCircuitBreakers() error = %v", err)
+	}
+	if cfg.Default.FailureThreshold != 3 || cfg.Default.OpenDuration != "1m" {
+		t.Errorf("unexpected default settings: %+v", cfg.Default)
+	}
+	if cfg.Endpoints["my-org/flaky"].FailureThreshold != 10 || cfg.Endpoints["my-org/flaky:deploy"].HalfOpenProbes != 1 {
+		t.Errorf("unexpected endpoint settings: %+v", cfg.Endpoints)
+	}
+
+	if err := os.WriteFile(path, []byte("version: 0.1.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	if cfg, err := LoadCircuitBreakers(path); err != nil || cfg != nil {
+		t.Errorf("expected no circuit breakers, got %+v, %v", cfg, err)
+	}
+}
+
+func TestCircuitBreakersConfig_Validate(t *testing.T) {
+	testCases := []struct {
+		name          string
+		config        CircuitBreakersConfig
+		expectedError string
+	}{
+		{
+			name:          "negative failure threshold",
+			config:        CircuitBreakersConfig{Default: CircuitBreakerSettings{FailureThreshold: -1}},
+			expectedError: "default: failure_threshold must not be negative",
+		},
+		{
+			name:          "invalid open duration",
+			config:        CircuitBreakersConfig{Endpoints: map[string]CircuitBreakerSettings{"org/repo": {OpenDuration: "soon"}}},
+			expectedError: "endpoint 'org/repo': invalid open_duration",
+		},
+		{
+			name:          "invalid endpoint",
+			config:        CircuitBreakersConfig{Endpoints: map[string]CircuitBreakerSettings{"repo": {}}},
+			expectedError: "invalid endpoint 'repo': must be owner/repo or owner/repo:workflow",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.Validate(); err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
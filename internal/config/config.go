@@ -3,8 +3,13 @@ package config
 import (
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -14,6 +19,28 @@ type Config struct {
 	Artifacts     map[string]Artifact `yaml:"artifacts"`
 	Workflows     map[string]Workflow `yaml:"workflows"`
 	Subscriptions []Subscription      `yaml:"subscriptions,omitempty"`
+	// Include imports workflows from other repositories; see LoadWithCache.
+	Include []Include `yaml:"include,omitempty"`
+	// Execution selects how the child workflows of runs started in this repository execute.
+	Execution *Execution `yaml:"execution,omitempty"`
+	// Events configures the external sinks of the events this repository emits.
+	Events *EventsConfig `yaml:"events,omitempty"`
+	// CircuitBreakers configures the circuit breakers guarding the child workflows of fan-outs.
+	CircuitBreakers *CircuitBreakersConfig `yaml:"circuit_breakers,omitempty"`
+	// Profiles are overlays of the workflows for environments, selected when a workflow is run.
+	Profiles map[string]Profile `yaml:"profiles,omitempty"`
+}
+
+// Execution configures the backend child workflows run on.
+type Execution struct {
+	// Backend is the default backend of child workflows: local, container, remote, noop, or
+	// another registered backend. Subscriptions can override it.
+	Backend string `yaml:"backend,omitempty"`
+	// Image is the container backend's image for steps without one, unless the workflow sets one.
+	Image string `yaml:"image,omitempty"`
+	// MaxTotalChildren caps the child workflows triggered by the fan-outs of the whole execution
+	// tree of a run started in this repository; the default cap when zero.
+	MaxTotalChildren int `yaml:"max_total_children,omitempty"`
 }
 
 type Artifact struct {
@@ -26,13 +53,72 @@ type Workflow struct {
 	Name      string                   `yaml:"-"`
 	On        string                   `yaml:"on,omitempty"`
 	Image     string                   `yaml:"image,omitempty"`
-	Env       []string                 `yaml:"env,omitempty"`
+	Env       map[string]string        `yaml:"env,omitempty"`
 	Secrets   []string                 `yaml:"secrets,omitempty"`
 	Resources Resources                `yaml:"resources,omitempty"`
 	Inputs    map[string]WorkflowInput `yaml:"inputs,omitempty"`
 	Steps     []WorkflowStep           `yaml:"steps,omitempty"`
+	// Timeout bounds the whole workflow run, as a Go duration such as "30m".
+	Timeout string `yaml:"timeout,omitempty"`
+	// EnvPassthrough lists glob patterns, such as "PATH" or "GO*", of the host environment
+	// variables the steps inherit. Steps inherit the whole host environment when it is unset,
+	// and none of it when it is empty.
+	EnvPassthrough []string `yaml:"env_passthrough,omitempty"`
+	// WorkingDirectory is the directory the steps run in, relative to the repository; the
+	// repository itself by default. Monorepos root workflows at the path of an artifact with
+	// "{{ .Artifacts.<name> }}".
+	WorkingDirectory string `yaml:"working_directory,omitempty"`
+	// Shell runs the commands of the steps; sh by default, and on Windows pwsh when it is
+	// installed or Windows PowerShell otherwise.
+	Shell string `yaml:"shell,omitempty"`
+	// Services are containers started before the steps and removed after them, keyed by the
+	// hostname the steps reach them at.
+	Services map[string]Service `yaml:"services,omitempty"`
+	// Outputs are the outputs of the workflow, as templates over the outputs of its steps such
+	// as "{{ .Steps.build.version }}". They are the contract of the workflow with the workflows
+	// calling it and with the fan-outs triggering it, whatever steps produce them.
+	Outputs map[string]string `yaml:"outputs,omitempty"`
+	// OnSuccess steps run after the steps of a successful run, and OnFailure steps after those
+	// of a failed, cancelled or timed out run, e.g. to notify or clean up. Their failures are
+	// logged without changing the outcome of the run.
+	OnSuccess []WorkflowStep `yaml:"on_success,omitempty"`
+	OnFailure []WorkflowStep `yaml:"on_failure,omitempty"`
+	// Notifications notify channels when runs of the workflow, or the fan-outs they emit, break.
+	Notifications []Notification `yaml:"notifications,omitempty"`
+}
+
+// Service is a container running alongside the steps of a workflow, such as a database used
+// by integration tests.
+type Service struct {
+	Image string            `yaml:"image"`
+	Env   map[string]string `yaml:"env,omitempty"`
+	// Ports publishes container ports on the host, as "container" or "host:container", so steps
+	// running on the host can reach the service.
+	Ports []string `yaml:"ports,omitempty"`
+	// Command replaces the default command of the image.
+	Command     []string            `yaml:"command,omitempty"`
+	HealthCheck *ServiceHealthCheck `yaml:"health_check,omitempty"`
 }
 
+// ServiceHealthCheck decides when a service is ready for the steps to use it.
+type ServiceHealthCheck struct {
+	// Command is run with "sh -c" inside the service container; the service is ready once it succeeds.
+	Command string `yaml:"command"`
+	// Interval is the time between two checks, as a Go duration; defaults to 1s.
+	Interval string `yaml:"interval,omitempty"`
+	// Timeout bounds the wait for the service to become ready, as a Go duration; defaults to 60s.
+	Timeout string `yaml:"timeout,omitempty"`
+}
+
+// serviceNameRegex matches service names, which are used as hostnames.
+var serviceNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// backendNameRegex matches execution backend names.
+var backendNameRegex = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+// servicePortRegex matches "container" and "host:container" port mappings.
+var servicePortRegex = regexp.MustCompile(`^([0-9]{1,5}:)?[0-9]{1,5}(/(tcp|udp))?$`)
+
 type Resources struct {
 	CPULimit  string `yaml:"cpu_limit,omitempty"`
 	MemLimit  string `yaml:"mem_limit,omitempty"`
@@ -51,6 +137,8 @@ type WorkflowInputValidation struct {
 	Enum []string `yaml:"enum,omitempty"`
 	Min  *float64 `yaml:"min,omitempty"`
 	Max  *float64 `yaml:"max,omitempty"`
+	// Pattern is a regular expression string inputs must match.
+	Pattern string `yaml:"pattern,omitempty"`
 }
 
 type WorkflowStep struct {
@@ -70,8 +158,54 @@ type WorkflowStep struct {
 	Resources       *Resources             `yaml:"resources,omitempty"`
 	Produces        *WorkflowStepProduces  `yaml:"produces,omitempty"`
 	OnFailure       []WorkflowStep         `yaml:"on_failure,omitempty"`
+	// Timeout bounds a single step, as a Go duration such as "5m".
+	// A step can never run past the timeout of its workflow.
+	Timeout string `yaml:"timeout,omitempty"`
+	// Parallel makes the step a group whose steps run concurrently. The group completes once
+	// all of them succeed, and fails as soon as one of them fails.
+	Parallel []WorkflowStep `yaml:"parallel,omitempty"`
+	// MaxParallel limits how many steps of a parallel group run at once; 0 means no limit.
+	MaxParallel int `yaml:"max_parallel,omitempty"`
+	// Container tunes how a containerized step runs; it requires an image.
+	Container *ContainerOptions `yaml:"container,omitempty"`
+	// WorkingDirectory is the directory the step runs in, relative to the repository, such as
+	// "services/api" or "{{ .Artifacts.api }}"; the workflow's by default.
+	WorkingDirectory string `yaml:"working_directory,omitempty"`
+	// Shell runs the step's command: sh, bash, pwsh, powershell, cmd, python or node; the
+	// workflow's by default. Multi-line commands run as scripts.
+	Shell string `yaml:"shell,omitempty"`
+	// Cache skips the step when a prior successful run of it had the same key, restoring its
+	// outputs and paths instead.
+	Cache *StepCache `yaml:"cache,omitempty"`
+	// ContinueOnError records a failure of the step as allowed rather than failing the workflow:
+	// the steps after it still run.
+	ContinueOnError bool `yaml:"continue_on_error,omitempty"`
+}
+
+// StepCache is the cache of a step.
+type StepCache struct {
+	// Key identifies what the step's results depend on, as a template such as
+	// "deps-{{ hashFiles \"**/go.sum\" }}".
+	Key string `yaml:"key"`
+	// Paths are the files and directories the step produces, relative to the repository, which
+	// a cache hit restores.
+	Paths []string `yaml:"paths,omitempty"`
 }
 
+// Shells that run the commands of steps.
+const (
+	ShellSh         = "sh"
+	ShellBash       = "bash"
+	ShellPwsh       = "pwsh"
+	ShellPowerShell = "powershell"
+	ShellCmd        = "cmd"
+	ShellPython     = "python"
+	ShellNode       = "node"
+)
+
+// shells are the supported shells of steps.
+var shells = []string{ShellSh, ShellBash, ShellPwsh, ShellPowerShell, ShellCmd, ShellPython, ShellNode}
+
 // VolumeMount represents a volume mount for containerized steps.
 type VolumeMount struct {
 	Source      string `yaml:"source"`
@@ -79,6 +213,33 @@ type VolumeMount struct {
 	ReadOnly    bool   `yaml:"read_only,omitempty"`
 }
 
+// ContainerOptions holds the container settings of a step beyond its image.
+type ContainerOptions struct {
+	// Volumes are mounted in addition to the workspace, which is always mounted at /workspace.
+	Volumes []VolumeMount `yaml:"volumes,omitempty"`
+	// Network is the network to attach the container to; it takes precedence over the step's network.
+	Network string `yaml:"network,omitempty"`
+	// WorkDir is the absolute working directory inside the container; defaults to /workspace.
+	WorkDir string `yaml:"workdir,omitempty"`
+	// User runs the container as uid[:gid] or name[:group] instead of the non-root default.
+	User string `yaml:"user,omitempty"`
+	// Entrypoint replaces the default "sh -c" used to run the step's command. The first element
+	// becomes the image entrypoint, and the remaining ones are passed before the command.
+	Entrypoint []string `yaml:"entrypoint,omitempty"`
+	// PullPolicy is one of "missing" (the default), "always" or "never".
+	PullPolicy string `yaml:"pull_policy,omitempty"`
+}
+
+// Image pull policies of containerized steps.
+const (
+	PullPolicyMissing = "missing"
+	PullPolicyAlways  = "always"
+	PullPolicyNever   = "never"
+)
+
+// containerUserRegex matches uid[:gid] and name[:group] user specifications.
+var containerUserRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*(:[a-zA-Z0-9_][a-zA-Z0-9_.-]*)?$`)
+
 type WorkflowStepProduces struct {
 	Artifact string            `yaml:"artifact,omitempty"`
 	Outputs  map[string]string `yaml:"outputs,omitempty"`
@@ -100,12 +261,43 @@ func (step *WorkflowStep) UnmarshalYAML(node *yaml.Node) error {
 	return fmt.Errorf("step must be either a string or an object")
 }
 
+// Load reads and validates a tako.yml file. Files that include workflows from other
+// repositories must be loaded with LoadWithCache instead.
 func Load(path string) (*Config, error) {
+	return LoadWithCache(path, "")
+}
+
+// LoadRaw reads a tako.yml file without validating it.
+// It is meant for tools that report every problem in a file instead of failing on the first one.
+func LoadRaw(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("could not read config file: %w", err)
 	}
 
+	return decode(data)
+}
+
+// parse decodes the contents of a tako.yml file, resolves its includes from cacheDir and validates it.
+func parse(data []byte, cacheDir string) (*Config, error) {
+	config, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := resolveIncludes(config, cacheDir, nil); err != nil {
+		return nil, err
+	}
+
+	if err := validate(config); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// decode decodes the contents of a tako.yml file and fills in the derived names.
+func decode(data []byte) (*Config, error) {
 	var config Config
 	if err := yaml.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("could not unmarshal config: %w", err)
@@ -123,10 +315,6 @@ func Load(path string) (*Config, error) {
 		config.Workflows[name] = workflow
 	}
 
-	if err := validate(&config); err != nil {
-		return nil, err
-	}
-
 	return &config, nil
 }
 
@@ -147,16 +335,89 @@ func validate(config *Config) error {
 		}
 	}
 
+	if config.Execution != nil {
+		if config.Execution.Backend != "" && !backendNameRegex.MatchString(config.Execution.Backend) {
+			return fmt.Errorf("invalid execution backend '%s': must be a lowercase name such as local, container, remote or noop", config.Execution.Backend)
+		}
+		if strings.ContainsAny(config.Execution.Image, " \t\n") {
+			return fmt.Errorf("invalid execution image '%s'", config.Execution.Image)
+		}
+		if config.Execution.MaxTotalChildren < 0 {
+			return fmt.Errorf("invalid execution max_total_children %d: must not be negative", config.Execution.MaxTotalChildren)
+		}
+	}
+
+	if config.Events != nil {
+		for i := range config.Events.Sinks {
+			if err := config.Events.Sinks[i].Validate(); err != nil {
+				return fmt.Errorf("invalid event sink %d: %w", i, err)
+			}
+		}
+		if config.Events.Signing != nil {
+			if err := config.Events.Signing.Validate(); err != nil {
+				return fmt.Errorf("invalid event signing: %w", err)
+			}
+		}
+		if err := validateEventSchemas(config.Events.Schemas); err != nil {
+			return err
+		}
+		if err := config.Events.validateDiamondStrategies(); err != nil {
+			return err
+		}
+	}
+
+	if config.CircuitBreakers != nil {
+		if err := config.CircuitBreakers.Validate(); err != nil {
+			return fmt.Errorf("invalid circuit breakers: %w", err)
+		}
+	}
+
 	for workflowName, workflow := range config.Workflows {
 		if err := validateWorkflow(workflowName, &workflow); err != nil {
 			return fmt.Errorf("invalid workflow '%s': %w", workflowName, err)
 		}
 	}
 
+	if err := validateWorkflowCalls(config.Workflows); err != nil {
+		return err
+	}
+	if err := validateArtifactPublishing(config.Workflows, config.Artifacts); err != nil {
+		return err
+	}
+
+	for profileName, profile := range config.Profiles {
+		if err := validateProfile(profile, config.Workflows); err != nil {
+			return fmt.Errorf("invalid profile '%s': %w", profileName, err)
+		}
+	}
+
 	return nil
 }
 
 func validateWorkflow(_ string, workflow *Workflow) error {
+	if err := validateTimeout(workflow.Timeout); err != nil {
+		return err
+	}
+
+	for _, pattern := range workflow.EnvPassthrough {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("invalid env_passthrough pattern '%s'", pattern)
+		}
+	}
+
+	if err := validateWorkingDirectory(workflow.WorkingDirectory); err != nil {
+		return err
+	}
+	if err := validateShell(workflow.Shell); err != nil {
+		return err
+	}
+
+	for serviceName, service := range workflow.Services {
+		if err := validateService(serviceName, &service); err != nil {
+			return fmt.Errorf("invalid service '%s': %w", serviceName, err)
+		}
+	}
+
 	for inputName, input := range workflow.Inputs {
 		if err := validateWorkflowInput(inputName, &input); err != nil {
 			return fmt.Errorf("invalid input '%s': %w", inputName, err)
@@ -169,36 +430,43 @@ func validateWorkflow(_ string, workflow *Workflow) error {
 		}
 	}
 
-	return nil
-}
-
-func validateWorkflowInput(_ string, input *WorkflowInput) error {
-	if input.Type != "" {
-		validTypes := []string{"string", "boolean", "number"}
-		valid := false
-		for _, validType := range validTypes {
-			if input.Type == validType {
-				valid = true
-				break
-			}
+	for outputName, outputValue := range workflow.Outputs {
+		if outputValue == "" {
+			return fmt.Errorf("output '%s' cannot have empty value", outputName)
 		}
-		if !valid {
-			return fmt.Errorf("invalid input type '%s', must be one of: %v", input.Type, validTypes)
+		if err := validateTemplateExpression(outputValue); err != nil {
+			return fmt.Errorf("invalid output '%s': %w", outputName, err)
 		}
 	}
 
-	if len(input.Validation.Enum) > 0 && input.Type != "string" && input.Type != "" {
-		return fmt.Errorf("enum validation is only supported for string inputs")
+	for i, step := range workflow.OnSuccess {
+		if err := validateWorkflowStep(i, &step); err != nil {
+			return fmt.Errorf("invalid on_success step %d: %w", i, err)
+		}
+	}
+	for i, step := range workflow.OnFailure {
+		if err := validateWorkflowStep(i, &step); err != nil {
+			return fmt.Errorf("invalid on_failure step %d: %w", i, err)
+		}
 	}
 
-	if (input.Validation.Min != nil || input.Validation.Max != nil) && input.Type != "number" && input.Type != "" {
-		return fmt.Errorf("min/max validation is only supported for number inputs")
+	for i := range workflow.Notifications {
+		if err := workflow.Notifications[i].Validate(); err != nil {
+			return fmt.Errorf("invalid notification %d: %w", i, err)
+		}
 	}
 
 	return nil
 }
 
 func validateWorkflowStep(_ int, step *WorkflowStep) error {
+	if len(step.Parallel) > 0 {
+		return validateParallelStep(step)
+	}
+	if step.MaxParallel != 0 {
+		return fmt.Errorf("'max_parallel' can only be used with 'parallel'")
+	}
+
 	if step.Run == "" && step.Uses == "" {
 		return fmt.Errorf("step must specify either 'run' or 'uses'")
 	}
@@ -210,6 +478,25 @@ func validateWorkflowStep(_ int, step *WorkflowStep) error {
 		if err := validateBuiltinStep(step.Uses); err != nil {
 			return err
 		}
+		if isNotifyStep(step.Uses) {
+			if _, err := ParseNotifyStepParams(step.Uses, step.With); err != nil {
+				return fmt.Errorf("invalid %s step: %w", step.Uses, err)
+			}
+		}
+		if isPublishArtifactStep(step.Uses) {
+			if _, err := ParsePublishArtifactParams(step.With); err != nil {
+				return fmt.Errorf("invalid %s step: %w", step.Uses, err)
+			}
+		}
+		if isApprovalStep(step.Uses) {
+			if _, err := ParseApprovalParams(step.With); err != nil {
+				return fmt.Errorf("invalid %s step: %w", step.Uses, err)
+			}
+		}
+	}
+
+	if err := validateTimeout(step.Timeout); err != nil {
+		return err
 	}
 
 	if step.Produces != nil {
@@ -218,6 +505,134 @@ func validateWorkflowStep(_ int, step *WorkflowStep) error {
 		}
 	}
 
+	if step.Container != nil {
+		if step.Image == "" {
+			return fmt.Errorf("'container' options require an 'image'")
+		}
+		if err := validateContainerOptions(step.Container); err != nil {
+			return fmt.Errorf("invalid container options: %w", err)
+		}
+	}
+
+	if err := validateWorkingDirectory(step.WorkingDirectory); err != nil {
+		return err
+	}
+	if err := validateShell(step.Shell); err != nil {
+		return err
+	}
+	if step.Shell != "" && step.Uses != "" {
+		return fmt.Errorf("'shell' can only be used with 'run'")
+	}
+	if step.Cache != nil {
+		if step.Uses != "" {
+			return fmt.Errorf("'cache' can only be used with 'run'")
+		}
+		if err := validateStepCache(step); err != nil {
+			return fmt.Errorf("invalid cache: %w", err)
+		}
+	}
+	if step.WorkingDirectory != "" && step.Container != nil && step.Container.WorkDir != "" {
+		return fmt.Errorf("'working_directory' and 'container.workdir' cannot be used together")
+	}
+
+	for i, failureStep := range step.OnFailure {
+		if err := validateWorkflowStep(i, &failureStep); err != nil {
+			return fmt.Errorf("invalid failure step %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// validateService checks a service container definition.
+func validateService(name string, service *Service) error {
+	if !serviceNameRegex.MatchString(name) {
+		return fmt.Errorf("service name must be a valid hostname of lowercase letters, digits and '-'")
+	}
+	if service.Image == "" {
+		return fmt.Errorf("missing required field: image")
+	}
+	for _, port := range service.Ports {
+		if !servicePortRegex.MatchString(port) {
+			return fmt.Errorf("invalid port '%s', must be 'container' or 'host:container'", port)
+		}
+	}
+
+	if service.HealthCheck != nil {
+		if service.HealthCheck.Command == "" {
+			return fmt.Errorf("health_check requires a 'command'")
+		}
+		if err := validateTimeout(service.HealthCheck.Interval); err != nil {
+			return fmt.Errorf("invalid health_check interval: %w", err)
+		}
+		if err := validateTimeout(service.HealthCheck.Timeout); err != nil {
+			return fmt.Errorf("invalid health_check timeout: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validateContainerOptions checks the container options of a step.
+func validateContainerOptions(options *ContainerOptions) error {
+	switch options.PullPolicy {
+	case "", PullPolicyMissing, PullPolicyAlways, PullPolicyNever:
+	default:
+		return fmt.Errorf("pull_policy must be one of %s, %s or %s, got '%s'", PullPolicyMissing, PullPolicyAlways, PullPolicyNever, options.PullPolicy)
+	}
+
+	if options.WorkDir != "" && !strings.HasPrefix(options.WorkDir, "/") {
+		return fmt.Errorf("workdir must be an absolute path, got '%s'", options.WorkDir)
+	}
+
+	if options.User != "" && !containerUserRegex.MatchString(options.User) {
+		return fmt.Errorf("user must be in format 'uid[:gid]' or 'name[:group]', got '%s'", options.User)
+	}
+
+	if len(options.Entrypoint) > 0 && options.Entrypoint[0] == "" {
+		return fmt.Errorf("entrypoint must not start with an empty element")
+	}
+
+	for i, volume := range options.Volumes {
+		if volume.Source == "" || volume.Destination == "" {
+			return fmt.Errorf("volume %d must specify 'source' and 'destination'", i)
+		}
+	}
+
+	return nil
+}
+
+// validateParallelStep checks a parallel group and the steps it contains.
+func validateParallelStep(step *WorkflowStep) error {
+	if step.Run != "" || step.Uses != "" || step.Image != "" {
+		return fmt.Errorf("parallel step cannot specify 'run', 'uses' or 'image'")
+	}
+	if step.Produces != nil {
+		return fmt.Errorf("parallel step cannot specify 'produces'")
+	}
+	if step.MaxParallel < 0 {
+		return fmt.Errorf("max_parallel must not be negative, got %d", step.MaxParallel)
+	}
+	if err := validateTimeout(step.Timeout); err != nil {
+		return err
+	}
+
+	ids := make(map[string]bool)
+	for i, parallelStep := range step.Parallel {
+		if parallelStep.ID != "" {
+			if ids[parallelStep.ID] {
+				return fmt.Errorf("duplicate parallel step id '%s'", parallelStep.ID)
+			}
+			ids[parallelStep.ID] = true
+		}
+		if len(parallelStep.Parallel) > 0 {
+			return fmt.Errorf("parallel steps cannot be nested")
+		}
+		if err := validateWorkflowStep(i, &parallelStep); err != nil {
+			return fmt.Errorf("invalid parallel step %d: %w", i, err)
+		}
+	}
+
 	for i, failureStep := range step.OnFailure {
 		if err := validateWorkflowStep(i, &failureStep); err != nil {
 			return fmt.Errorf("invalid failure step %d: %w", i, err)
@@ -227,6 +642,67 @@ func validateWorkflowStep(_ int, step *WorkflowStep) error {
 	return nil
 }
 
+// validateShell checks that an optional shell is supported.
+func validateShell(shell string) error {
+	if shell != "" && !slices.Contains(shells, shell) {
+		return fmt.Errorf("invalid shell '%s': must be one of %s", shell, strings.Join(shells, ", "))
+	}
+	return nil
+}
+
+// validateWorkingDirectory checks that an optional working directory stays inside the
+// repository. Templated directories are checked once expanded, when the steps run.
+func validateWorkingDirectory(dir string) error {
+	if dir == "" {
+		return nil
+	}
+	if strings.Contains(dir, "{{") {
+		if err := validateTemplateExpression(dir); err != nil {
+			return fmt.Errorf("invalid working_directory '%s': %w", dir, err)
+		}
+		return nil
+	}
+	if filepath.IsAbs(dir) || !filepath.IsLocal(dir) {
+		return fmt.Errorf("invalid working_directory '%s': must be a path inside the repository", dir)
+	}
+	return nil
+}
+
+// validateStepCache checks the cache of a step: its key and id, since entries are kept per step,
+// and paths inside the repository.
+func validateStepCache(step *WorkflowStep) error {
+	if step.ID == "" {
+		return fmt.Errorf("cached steps must have an 'id'")
+	}
+	if strings.TrimSpace(step.Cache.Key) == "" {
+		return fmt.Errorf("'key' is required")
+	}
+	if err := validateTemplateExpression(step.Cache.Key); err != nil {
+		return fmt.Errorf("invalid key: %w", err)
+	}
+	for _, cachePath := range step.Cache.Paths {
+		if filepath.IsAbs(cachePath) || !filepath.IsLocal(cachePath) {
+			return fmt.Errorf("path '%s' must be inside the repository", cachePath)
+		}
+	}
+	return nil
+}
+
+// validateTimeout checks that an optional timeout is a positive Go duration.
+func validateTimeout(timeout string) error {
+	if timeout == "" {
+		return nil
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return fmt.Errorf("invalid timeout '%s': %v", timeout, err)
+	}
+	if duration <= 0 {
+		return fmt.Errorf("invalid timeout '%s': must be positive", timeout)
+	}
+	return nil
+}
+
 func validateWorkflowStepProduces(produces *WorkflowStepProduces) error {
 	for outputName, outputValue := range produces.Outputs {
 		if outputValue == "" {
@@ -262,6 +738,86 @@ var knownBuiltinSteps = map[string][]string{
 	"tako/update-dependency":   {"v1"},
 	"tako/create-pull-request": {"v1"},
 	"tako/poll":                {"v1"},
+	"tako/call-workflow":       {"v1"},
+	"tako/notify-slack":        {"v1"},
+	"tako/notify-webhook":      {"v1"},
+	"tako/notify-email":        {"v1"},
+	"tako/publish-artifact":    {"v1"},
+	"tako/approval":            {"v1"},
+}
+
+// validateWorkflowCalls checks the tako/call-workflow@v1 steps of every workflow. Calls within
+// the repository must target an existing workflow and must not form a cycle; calls to other
+// repositories can only be checked when they run.
+func validateWorkflowCalls(workflows map[string]Workflow) error {
+	calls := make(map[string][]string)
+	for workflowName, workflow := range workflows {
+		steps := append(append(append([]WorkflowStep(nil), workflow.Steps...), workflow.OnSuccess...), workflow.OnFailure...)
+		for _, step := range workflowCallSteps(steps) {
+			target, _ := step.With["workflow"].(string)
+			if target == "" {
+				return fmt.Errorf("invalid workflow '%s': call-workflow step must specify 'workflow'", workflowName)
+			}
+			if repository, ok := step.With["repository"]; ok {
+				if repositoryStr, ok := repository.(string); !ok || repositoryStr == "" {
+					return fmt.Errorf("invalid workflow '%s': call-workflow 'repository' must be a non-empty string", workflowName)
+				}
+				continue
+			}
+			if _, exists := workflows[target]; !exists {
+				return fmt.Errorf("invalid workflow '%s': call-workflow step references non-existent workflow '%s'", workflowName, target)
+			}
+			calls[workflowName] = append(calls[workflowName], target)
+		}
+	}
+
+	// Depth-first search for cycles: a workflow still on the stack was called by itself
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	marks := make(map[string]int)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch marks[name] {
+		case visiting:
+			return fmt.Errorf("workflow call cycle detected: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		marks[name] = visiting
+		for _, target := range calls[name] {
+			if err := visit(target, append(path, name)); err != nil {
+				return err
+			}
+		}
+		marks[name] = visited
+		return nil
+	}
+
+	names := make([]string, 0, len(calls))
+	for name := range calls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// workflowCallSteps returns the tako/call-workflow@v1 steps, including those of parallel groups.
+func workflowCallSteps(steps []WorkflowStep) []WorkflowStep {
+	var calls []WorkflowStep
+	for _, step := range steps {
+		if strings.HasPrefix(step.Uses, "tako/call-workflow@") {
+			calls = append(calls, step)
+		}
+		calls = append(calls, workflowCallSteps(step.Parallel)...)
+	}
+	return calls
 }
 
 func validateBuiltinStep(uses string) error {
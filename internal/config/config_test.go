@@ -270,6 +270,47 @@ subscriptions:
 `,
 			expectedError: "artifact reference 'invalid-format' must be in format 'repo:artifact'",
 		},
+		{
+			name: "invalid execution backend",
+			yamlContent: `
+version: "0.1.0"
+execution:
+  backend: "Local"
+workflows:
+  test:
+    steps:
+      - "echo test"
+`,
+			expectedError: "invalid execution backend 'Local'",
+		},
+		{
+			name: "negative max total children",
+			yamlContent: `
+version: "0.1.0"
+execution:
+  max_total_children: -1
+workflows:
+  test:
+    steps:
+      - "echo test"
+`,
+			expectedError: "invalid execution max_total_children -1",
+		},
+		{
+			name: "nats event sink without subject",
+			yamlContent: `
+version: "0.1.0"
+events:
+  sinks:
+    - type: nats
+      url: nats://localhost:4222
+workflows:
+  test:
+    steps:
+      - "echo test"
+`,
+			expectedError: "invalid event sink 0: subject is required for nats sinks",
+		},
 		{
 			name: "subscription references non-existent workflow",
 			yamlContent: `
@@ -298,6 +339,249 @@ workflows:
 `,
 			expectedError: "step cannot specify both 'run' and 'uses'",
 		},
+		{
+			name: "invalid workflow timeout",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    timeout: "forever"
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "invalid timeout 'forever'",
+		},
+		{
+			name: "invalid env passthrough pattern",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    env_passthrough: ["PATH", "GO[*"]
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "invalid env_passthrough pattern 'GO[*'",
+		},
+		{
+			name: "working directory outside the repository",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        working_directory: "../other"
+`,
+			expectedError: "invalid working_directory '../other': must be a path inside the repository",
+		},
+		{
+			name: "working directory with container workdir",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        image: "alpine:3.20"
+        working_directory: "services/api"
+        container:
+          workdir: /src
+`,
+			expectedError: "'working_directory' and 'container.workdir' cannot be used together",
+		},
+		{
+			name: "unsupported shell",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    shell: zsh
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "invalid shell 'zsh': must be one of sh, bash, pwsh, powershell, cmd, python, node",
+		},
+		{
+			name: "shell without run",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - uses: tako/fan-out@v1
+        shell: bash
+        with:
+          event_type: built
+`,
+			expectedError: "'shell' can only be used with 'run'",
+		},
+		{
+			name: "cached step without id",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "make"
+        cache:
+          key: build
+`,
+			expectedError: "invalid cache: cached steps must have an 'id'",
+		},
+		{
+			name: "cache path outside the repository",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - id: build
+        run: "make"
+        cache:
+          key: build
+          paths: ["../out"]
+`,
+			expectedError: "invalid cache: path '../out' must be inside the repository",
+		},
+		{
+			name: "negative step timeout",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        timeout: "-5s"
+`,
+			expectedError: "invalid timeout '-5s': must be positive",
+		},
+		{
+			name: "call-workflow without workflow",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - uses: tako/call-workflow@v1
+`,
+			expectedError: "call-workflow step must specify 'workflow'",
+		},
+		{
+			name: "call-workflow to non-existent workflow",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - uses: tako/call-workflow@v1
+        with:
+          workflow: missing
+`,
+			expectedError: "call-workflow step references non-existent workflow 'missing'",
+		},
+		{
+			name: "call-workflow cycle",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  build:
+    steps:
+      - uses: tako/call-workflow@v1
+        with:
+          workflow: test
+  test:
+    steps:
+      - id: checks
+        parallel:
+          - uses: tako/call-workflow@v1
+            with:
+              workflow: build
+`,
+			expectedError: "workflow call cycle detected: build -> test -> build",
+		},
+		{
+			name: "container options without image",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        container:
+          user: "1000"
+`,
+			expectedError: "'container' options require an 'image'",
+		},
+		{
+			name: "invalid container pull policy",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        image: "alpine:3.19"
+        container:
+          pull_policy: "sometimes"
+`,
+			expectedError: "pull_policy must be one of missing, always or never, got 'sometimes'",
+		},
+		{
+			name: "relative container workdir",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        image: "alpine:3.19"
+        container:
+          workdir: "src"
+`,
+			expectedError: "workdir must be an absolute path, got 'src'",
+		},
+		{
+			name: "parallel step with run",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        parallel:
+          - run: "echo a"
+`,
+			expectedError: "parallel step cannot specify 'run', 'uses' or 'image'",
+		},
+		{
+			name: "duplicate parallel step ids",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - id: checks
+        parallel:
+          - id: lint
+            run: "echo a"
+          - id: lint
+            run: "echo b"
+`,
+			expectedError: "duplicate parallel step id 'lint'",
+		},
+		{
+			name: "max_parallel without parallel",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - run: "echo test"
+        max_parallel: 2
+`,
+			expectedError: "'max_parallel' can only be used with 'parallel'",
+		},
 		{
 			name: "built-in step without version",
 			yamlContent: `
@@ -398,6 +682,123 @@ workflows:
 `,
 			expectedError: "invalid failure step 0: built-in step 'tako/checkout' must include version",
 		},
+		{
+			name: "invalid step in workflow on_success",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - id: "test"
+        run: "echo test"
+    on_success:
+      - id: "notify"
+`,
+			expectedError: "invalid on_success step 0: step must specify either 'run' or 'uses'",
+		},
+		{
+			name: "invalid notification step",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    steps:
+      - id: "notify"
+        uses: "tako/notify-slack@v1"
+        with:
+          url_env: SLACK_WEBHOOK_URL
+`,
+			expectedError: "invalid tako/notify-slack@v1 step: message is required",
+		},
+		{
+			name: "invalid notification policy",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    notifications:
+      - on: [fan_out_failed]
+        type: webhook
+    steps:
+      - id: "test"
+        run: "echo test"
+`,
+			expectedError: "invalid notification 0: exactly one of url and url_env is required",
+		},
+		{
+			name: "invalid workflow output",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    outputs:
+      version: "{{ .Steps.test.version"
+    steps:
+      - id: "test"
+        run: "echo test"
+`,
+			expectedError: "invalid output 'version': unbalanced template braces",
+		},
+		{
+			name: "service without image",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    services:
+      postgres:
+        env:
+          POSTGRES_PASSWORD: test
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "invalid service 'postgres': missing required field: image",
+		},
+		{
+			name: "invalid service name",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    services:
+      Redis_Cache:
+        image: "redis:7"
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "service name must be a valid hostname",
+		},
+		{
+			name: "invalid service port",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    services:
+      redis:
+        image: "redis:7"
+        ports: ["localhost:6379"]
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "invalid port 'localhost:6379'",
+		},
+		{
+			name: "service health check without command",
+			yamlContent: `
+version: "0.1.0"
+workflows:
+  test:
+    services:
+      redis:
+        image: "redis:7"
+        health_check:
+          interval: 2s
+    steps:
+      - run: "echo test"
+`,
+			expectedError: "health_check requires a 'command'",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -465,6 +866,41 @@ func TestLoad_WorkflowInputValidationErrors(t *testing.T) {
         type: float`,
 			expectedError: "invalid input type 'float'",
 		},
+		{
+			name: "pattern on non-string input",
+			inputYAML: `    inputs:
+      my_input:
+        type: integer
+        validation:
+          pattern: "^[0-9]+$"`,
+			expectedError: "pattern validation is only supported for string inputs",
+		},
+		{
+			name: "invalid pattern",
+			inputYAML: `    inputs:
+      my_input:
+        validation:
+          pattern: "v[0-9"`,
+			expectedError: "invalid pattern 'v[0-9'",
+		},
+		{
+			name: "default of another type",
+			inputYAML: `    inputs:
+      my_input:
+        type: integer
+        default: "two"`,
+			expectedError: "invalid default: 'two' is not an integer",
+		},
+		{
+			name: "default out of range",
+			inputYAML: `    inputs:
+      my_input:
+        type: number
+        default: 0.5
+        validation:
+          min: 1`,
+			expectedError: "invalid default: value 0.5 is less than the minimum 1",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Event source types.
+const (
+	EventSourceNATS  = "nats"  // Subscribes to a NATS subject
+	EventSourceKafka = "kafka" // Consumes a Kafka topic through a Kafka REST Proxy
+)
+
+// DefaultEventSourceGroup is the Kafka consumer group of sources that do not set one.
+const DefaultEventSourceGroup = "tako"
+
+var sourceRepositoryRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]+/[A-Za-z0-9_.-]+$`)
+
+// DaemonConfig configures `tako daemon`, which triggers the subscribers of the events it
+// receives from message brokers.
+type DaemonConfig struct {
+	Version string        `yaml:"version"`
+	Sources []EventSource `yaml:"sources"`
+	// CircuitBreakers configures the circuit breakers of the daemon's fan-outs. The daemon
+	// reloads them when the file changes.
+	CircuitBreakers *CircuitBreakersConfig `yaml:"circuit_breakers,omitempty"`
+}
+
+// EventSource is a broker subject or topic whose messages are events. Messages are
+// EnhancedEvent JSON, as published by event sinks; other JSON objects are the payload of an
+// event of the source's event_type emitted by its source repository.
+type EventSource struct {
+	// Name identifies the source in logs and in the idempotency fingerprints of its messages.
+	Name    string            `yaml:"name"`
+	Type    string            `yaml:"type"`              // nats or kafka
+	URL     string            `yaml:"url"`               // nats://host:4222 or the REST Proxy URL
+	Subject string            `yaml:"subject,omitempty"` // NATS subject, wildcards allowed
+	Queue   string            `yaml:"queue,omitempty"`   // NATS queue group sharing the messages between daemons
+	Topic   string            `yaml:"topic,omitempty"`   // Kafka topic
+	Group   string            `yaml:"group,omitempty"`   // Kafka consumer group; tako when empty
+	Headers map[string]string `yaml:"headers,omitempty"` // Extra HTTP headers of Kafka REST Proxy requests
+	// EventType and Source describe messages that are not EnhancedEvent JSON.
+	EventType string `yaml:"event_type,omitempty"`
+	Source    string `yaml:"source,omitempty"`
+	// PollInterval is the wait between Kafka polls returning no records; 1s when empty.
+	PollInterval string `yaml:"poll_interval,omitempty"`
+	// SignatureKeyEnv names the environment variable holding the key the source's events must
+	// be signed with; unsigned events and events with an invalid signature are skipped.
+	SignatureKeyEnv string `yaml:"signature_key_env,omitempty"`
+}
+
+// LoadDaemon reads and validates a daemon configuration file.
+func LoadDaemon(path string) (*DaemonConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read daemon config file: %w", err)
+	}
+
+	var config DaemonConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("could not unmarshal daemon config: %w", err)
+	}
+
+	if len(config.Sources) == 0 {
+		return nil, fmt.Errorf("at least one event source is required")
+	}
+	names := make(map[string]bool)
+	for i := range config.Sources {
+		source := &config.Sources[i]
+		if err := source.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid event source %d: %w", i, err)
+		}
+		if names[source.Name] {
+			return nil, fmt.Errorf("duplicate event source name '%s'", source.Name)
+		}
+		names[source.Name] = true
+	}
+	if config.CircuitBreakers != nil {
+		if err := config.CircuitBreakers.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid circuit breakers: %w", err)
+		}
+	}
+
+	return &config, nil
+}
+
+// Validate checks the source's type and the fields its type requires.
+func (s *EventSource) Validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if s.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	switch s.Type {
+	case EventSourceNATS:
+		if s.Subject == "" {
+			return fmt.Errorf("subject is required for nats sources")
+		}
+	case EventSourceKafka:
+		if s.Topic == "" {
+			return fmt.Errorf("topic is required for kafka sources")
+		}
+	default:
+		return fmt.Errorf("invalid type '%s': must be %s or %s", s.Type, EventSourceNATS, EventSourceKafka)
+	}
+	if s.EventType != "" {
+		if err := validateEventType(s.EventType); err != nil {
+			return err
+		}
+	}
+	if s.Source != "" && !sourceRepositoryRegex.MatchString(s.Source) {
+		return fmt.Errorf("invalid source '%s': must be owner/repo", s.Source)
+	}
+	if s.PollInterval != "" {
+		if err := validateTimeout(s.PollInterval); err != nil {
+			return fmt.Errorf("invalid poll_interval: %w", err)
+		}
+	}
+	return nil
+}
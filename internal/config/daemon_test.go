@@ -0,0 +1,104 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadDaemon(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tako-daemon.yml")
+	content := `version: 0.1.0
+sources:
+  - name: releases
+    type: nats
+    url: nats://nats.internal:4222
+    subject: tako.events.>
+    queue: tako
+  - name: builds
+    type: kafka
+    url: http://rest-proxy:8082
+    topic: ci-builds
+    event_type: build_completed
+    source: org/ci
+    poll_interval: 5s
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	cfg, err := LoadDaemon(path)
+	if err != nil {
+		t.Fatalf("LoadDaemon() error = %v", err)
+	}
+	if len(cfg.Sources) != 2 {
+		t.Fatalf("expected 2 sources, got %d", len(cfg.Sources))
+	}
+	if cfg.Sources[0].Subject != "tako.events.>" || cfg.Sources[0].Queue != "tako" {
+		t.Errorf("unexpected nats source: %+v", cfg.Sources[0])
+	}
+	if cfg.Sources[1].EventType != "build_completed" || cfg.Sources[1].Source != "org/ci" {
+		t.Errorf("unexpected kafka source: %+v", cfg.Sources[1])
+	}
+}
+
+func TestLoadDaemon_ValidationErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "no sources",
+			content:       "version: 0.1.0\n",
+			expectedError: "at least one event source is required",
+		},
+		{
+			name: "kafka without topic",
+			content: `sources:
+  - name: builds
+    type: kafka
+    url: http://rest-proxy:8082
+`,
+			expectedError: "invalid event source 0: topic is required for kafka sources",
+		},
+		{
+			name: "invalid source repository",
+			content: `sources:
+  - name: builds
+    type: nats
+    url: nats://localhost
+    subject: builds
+    source: ci
+`,
+			expectedError: "invalid source 'ci': must be owner/repo",
+		},
+		{
+			name: "duplicate names",
+			content: `sources:
+  - name: builds
+    type: nats
+    url: nats://localhost
+    subject: builds
+  - name: builds
+    type: nats
+    url: nats://localhost
+    subject: releases
+`,
+			expectedError: "duplicate event source name 'builds'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tako-daemon.yml")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+			if _, err := LoadDaemon(path); err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"regexp"
+	"slices"
+	"strings"
 )
 
 // Event represents an event that can be emitted by a workflow step.
@@ -17,6 +20,212 @@ type EventProduction struct {
 	Events []Event `yaml:"events,omitempty"`
 }
 
+// Event sink types.
+const (
+	EventSinkNATS    = "nats"    // Publishes to a NATS subject
+	EventSinkKafka   = "kafka"   // Produces to a Kafka topic through a Kafka REST Proxy
+	EventSinkWebhook = "webhook" // POSTs to a URL
+)
+
+// EventsConfig configures what happens to the events emitted by the repository's workflows.
+type EventsConfig struct {
+	// Sinks also receive the events emitted by fan-out steps, besides subscribers.
+	Sinks []EventSink `yaml:"sinks,omitempty"`
+	// Signing signs the events emitted by fan-out steps for subscribers to verify their origin.
+	Signing *EventSigning `yaml:"signing,omitempty"`
+	// Schemas declare the payloads of the events the repository emits, the contract their
+	// subscribers rely on.
+	Schemas []EventPayloadSchema `yaml:"schemas,omitempty"`
+	// DiamondStrategy resolves the diamond dependencies of the events the repository emits:
+	// identical subscriptions of several repositories. first by default.
+	DiamondStrategy string `yaml:"diamond_strategy,omitempty"`
+	// DiamondStrategies overrides DiamondStrategy by event type.
+	DiamondStrategies map[string]string `yaml:"diamond_strategies,omitempty"`
+}
+
+// Diamond strategies, which decide the subscriptions of a diamond dependency an event triggers.
+const (
+	// DiamondStrategyFirst triggers the subscription of the first repository in alphabetical order.
+	DiamondStrategyFirst = "first"
+	// DiamondStrategyPriority triggers the subscription of highest priority, then the first.
+	DiamondStrategyPriority = "priority"
+	// DiamondStrategyMergeInputs also groups the subscriptions that only differ by their inputs,
+	// and triggers the first with the inputs of all of them, its own winning conflicts.
+	DiamondStrategyMergeInputs = "merge-inputs"
+	// DiamondStrategyFail fails the fan-out instead of triggering any subscription.
+	DiamondStrategyFail = "fail"
+)
+
+// DiamondStrategies are the supported diamond strategies.
+var DiamondStrategies = []string{DiamondStrategyFirst, DiamondStrategyPriority, DiamondStrategyMergeInputs, DiamondStrategyFail}
+
+// DiamondStrategyFor returns the diamond strategy of an event type; first when none is set.
+func (c *EventsConfig) DiamondStrategyFor(eventType string) string {
+	if c == nil {
+		return DiamondStrategyFirst
+	}
+	if strategy, ok := c.DiamondStrategies[eventType]; ok {
+		return strategy
+	}
+	if c.DiamondStrategy != "" {
+		return c.DiamondStrategy
+	}
+	return DiamondStrategyFirst
+}
+
+// validateDiamondStrategies checks the diamond strategies of a tako.yml and the event types they
+// are set for.
+func (c *EventsConfig) validateDiamondStrategies() error {
+	if c.DiamondStrategy != "" && !slices.Contains(DiamondStrategies, c.DiamondStrategy) {
+		return fmt.Errorf("invalid diamond_strategy '%s': must be one of %s", c.DiamondStrategy, strings.Join(DiamondStrategies, ", "))
+	}
+	for _, eventType := range slices.Sorted(maps.Keys(c.DiamondStrategies)) {
+		strategy := c.DiamondStrategies[eventType]
+		if err := validateEventType(eventType); err != nil {
+			return fmt.Errorf("invalid diamond_strategies: %w", err)
+		}
+		if !slices.Contains(DiamondStrategies, strategy) {
+			return fmt.Errorf("invalid diamond strategy '%s' of event '%s': must be one of %s", strategy, eventType, strings.Join(DiamondStrategies, ", "))
+		}
+	}
+	return nil
+}
+
+// Types of the payload fields of event schemas and subscription contracts, as in JSON.
+const (
+	PayloadFieldString  = "string"
+	PayloadFieldNumber  = "number"
+	PayloadFieldBoolean = "boolean"
+	PayloadFieldObject  = "object"
+	PayloadFieldArray   = "array"
+)
+
+// payloadFieldTypes are the supported types of payload fields.
+var payloadFieldTypes = []string{PayloadFieldString, PayloadFieldNumber, PayloadFieldBoolean, PayloadFieldObject, PayloadFieldArray}
+
+// payloadFieldPattern matches the names of payload fields, which templates and CEL
+// expressions read as payload.<field>.
+var payloadFieldPattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// EventPayloadSchema declares the payload of an event type, at a schema version.
+type EventPayloadSchema struct {
+	Type          string `yaml:"type"`
+	SchemaVersion string `yaml:"schema_version,omitempty"`
+	// Fields maps the payload fields to their type: string, number, boolean, object or array.
+	Fields map[string]string `yaml:"fields"`
+	// Required lists the fields every event of the type carries.
+	Required []string `yaml:"required,omitempty"`
+}
+
+// Validate checks the event type, the schema version and the fields of the schema.
+func (s *EventPayloadSchema) Validate() error {
+	if err := validateEventType(s.Type); err != nil {
+		return err
+	}
+	if err := validateSchemaVersion(s.SchemaVersion); err != nil {
+		return err
+	}
+	if len(s.Fields) == 0 {
+		return fmt.Errorf("fields cannot be empty")
+	}
+	if err := validatePayloadFields(s.Fields); err != nil {
+		return err
+	}
+	for _, field := range s.Required {
+		if _, ok := s.Fields[field]; !ok {
+			return fmt.Errorf("required field '%s' is not declared in fields", field)
+		}
+	}
+	return nil
+}
+
+// validatePayloadFields checks the names and types of payload fields.
+func validatePayloadFields(fields map[string]string) error {
+	for field, fieldType := range fields {
+		if !payloadFieldPattern.MatchString(field) {
+			return fmt.Errorf("invalid payload field name '%s'", field)
+		}
+		if !slices.Contains(payloadFieldTypes, fieldType) {
+			return fmt.Errorf("invalid type '%s' of field '%s': must be one of %s", fieldType, field, strings.Join(payloadFieldTypes, ", "))
+		}
+	}
+	return nil
+}
+
+// validateEventSchemas checks the schemas of a tako.yml, which declare each version of an event
+// type once.
+func validateEventSchemas(schemas []EventPayloadSchema) error {
+	declared := make(map[string]bool, len(schemas))
+	for i := range schemas {
+		if err := schemas[i].Validate(); err != nil {
+			return fmt.Errorf("invalid event schema %d: %w", i, err)
+		}
+		key := schemas[i].Type + "@" + schemas[i].SchemaVersion
+		if declared[key] {
+			return fmt.Errorf("invalid event schema %d: schema of event '%s' declared twice", i, schemas[i].Type)
+		}
+		declared[key] = true
+	}
+	return nil
+}
+
+// EventSigning signs emitted events with an HMAC-SHA256 key. The signature covers the whole
+// EnhancedEvent envelope and travels in its metadata headers.
+type EventSigning struct {
+	// KeyEnv names the environment variable holding the signing key.
+	KeyEnv string `yaml:"key_env"`
+}
+
+// Validate checks that the signing key is configured.
+func (s *EventSigning) Validate() error {
+	if s.KeyEnv == "" {
+		return fmt.Errorf("key_env is required")
+	}
+	return nil
+}
+
+// EventSink is an external system fan-out events are published to, as EnhancedEvent JSON.
+type EventSink struct {
+	Type    string            `yaml:"type"`              // nats, kafka or webhook
+	URL     string            `yaml:"url"`               // nats://host:4222, the REST Proxy URL, or the webhook URL
+	Subject string            `yaml:"subject,omitempty"` // NATS subject; {type} is replaced by the event type
+	Topic   string            `yaml:"topic,omitempty"`   // Kafka topic; {type} is replaced by the event type
+	Headers map[string]string `yaml:"headers,omitempty"` // Extra HTTP headers of kafka and webhook requests
+	// SecretEnv names the environment variable holding the key of the webhook's HMAC-SHA256 signature.
+	SecretEnv string `yaml:"secret_env,omitempty"`
+	// Events restricts the sink to these event types; all events when empty.
+	Events []string `yaml:"events,omitempty"`
+}
+
+// Validate checks the sink's type and the fields its type requires.
+func (s *EventSink) Validate() error {
+	if s.URL == "" {
+		return fmt.Errorf("url is required")
+	}
+	switch s.Type {
+	case EventSinkNATS:
+		if s.Subject == "" {
+			return fmt.Errorf("subject is required for nats sinks")
+		}
+	case EventSinkKafka:
+		if s.Topic == "" {
+			return fmt.Errorf("topic is required for kafka sinks")
+		}
+	case EventSinkWebhook:
+	default:
+		return fmt.Errorf("invalid type '%s': must be %s, %s or %s", s.Type, EventSinkNATS, EventSinkKafka, EventSinkWebhook)
+	}
+	if s.SecretEnv != "" && s.Type != EventSinkWebhook {
+		return fmt.Errorf("secret_env is only supported by webhook sinks")
+	}
+	for _, eventType := range s.Events {
+		if err := validateEventType(eventType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // validateEventType validates that event types follow the naming conventions.
 func validateEventType(eventType string) error {
 	// Event types should be snake_case and not empty
@@ -120,3 +120,96 @@ func TestEventProduction_ValidateEvents(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateEventSchemas(t *testing.T) {
+	testCases := []struct {
+		name        string
+		schemas     []EventPayloadSchema
+		expectError bool
+	}{
+		{
+			name: "valid schemas",
+			schemas: []EventPayloadSchema{
+				{Type: "library_built", SchemaVersion: "1.0.0", Fields: map[string]string{"version": "string"}, Required: []string{"version"}},
+				{Type: "library_built", SchemaVersion: "2.0.0", Fields: map[string]string{"version": "string", "size": "number"}},
+			},
+			expectError: false,
+		},
+		{
+			name:        "invalid event type",
+			schemas:     []EventPayloadSchema{{Type: "library-built", Fields: map[string]string{"version": "string"}}},
+			expectError: true,
+		},
+		{
+			name:        "invalid schema version",
+			schemas:     []EventPayloadSchema{{Type: "library_built", SchemaVersion: "v1", Fields: map[string]string{"version": "string"}}},
+			expectError: true,
+		},
+		{
+			name:        "no fields",
+			schemas:     []EventPayloadSchema{{Type: "library_built"}},
+			expectError: true,
+		},
+		{
+			name:        "invalid field type",
+			schemas:     []EventPayloadSchema{{Type: "library_built", Fields: map[string]string{"version": "text"}}},
+			expectError: true,
+		},
+		{
+			name:        "invalid field name",
+			schemas:     []EventPayloadSchema{{Type: "library_built", Fields: map[string]string{"build-version": "string"}}},
+			expectError: true,
+		},
+		{
+			name:        "undeclared required field",
+			schemas:     []EventPayloadSchema{{Type: "library_built", Fields: map[string]string{"version": "string"}, Required: []string{"commit"}}},
+			expectError: true,
+		},
+		{
+			name: "duplicate schema version",
+			schemas: []EventPayloadSchema{
+				{Type: "library_built", SchemaVersion: "1.0.0", Fields: map[string]string{"version": "string"}},
+				{Type: "library_built", SchemaVersion: "1.0.0", Fields: map[string]string{"version": "number"}},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateEventSchemas(tc.schemas)
+			if tc.expectError && err == nil {
+				t.Errorf("expected error, got nil")
+			}
+			if !tc.expectError && err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestEventsConfig_DiamondStrategies(t *testing.T) {
+	events := &EventsConfig{DiamondStrategy: DiamondStrategyPriority, DiamondStrategies: map[string]string{"library_built": DiamondStrategyFail}}
+	if err := events.validateDiamondStrategies(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strategy := events.DiamondStrategyFor("library_built"); strategy != DiamondStrategyFail {
+		t.Errorf("expected the strategy of the event type, got %s", strategy)
+	}
+	if strategy := events.DiamondStrategyFor("docs_published"); strategy != DiamondStrategyPriority {
+		t.Errorf("expected the strategy of the repository, got %s", strategy)
+	}
+	if strategy := (*EventsConfig)(nil).DiamondStrategyFor("docs_published"); strategy != DiamondStrategyFirst {
+		t.Errorf("expected the first strategy by default, got %s", strategy)
+	}
+
+	for _, invalid := range []*EventsConfig{
+		{DiamondStrategy: "random"},
+		{DiamondStrategies: map[string]string{"library_built": "last"}},
+		{DiamondStrategies: map[string]string{"library-built": DiamondStrategyFirst}},
+	} {
+		if err := invalid.validateDiamondStrategies(); err == nil {
+			t.Errorf("expected an error for %+v", invalid)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Include imports workflow definitions from the tako.yml of another repository.
+type Include struct {
+	// Repository is the repository to include workflows from, as owner/repo:ref. The ref pins
+	// the version of the included workflows and defaults to main.
+	Repository string `yaml:"repository"`
+	// Workflows lists the workflows to include; every workflow of the repository when empty.
+	Workflows []string `yaml:"workflows,omitempty"`
+}
+
+// LoadWithCache reads a tako.yml file and resolves its include: entries from the repositories
+// in cacheDir, laid out as <cacheDir>/repos/<owner>/<repo>/<ref>. Workflows defined in the file
+// itself take precedence over included workflows with the same name.
+func LoadWithCache(path, cacheDir string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	return parse(data, cacheDir)
+}
+
+// resolveIncludes merges the workflows included by config into it. Included files may include
+// other repositories themselves; stack holds the repositories being resolved, to detect cycles.
+func resolveIncludes(config *Config, cacheDir string, stack []string) error {
+	if len(config.Include) == 0 {
+		return nil
+	}
+	if cacheDir == "" {
+		return fmt.Errorf("cannot resolve include of '%s' without a cache directory", config.Include[0].Repository)
+	}
+
+	origins := make(map[string]string)
+	for i, include := range config.Include {
+		owner, repo, ref, err := parseIncludeRepository(include.Repository)
+		if err != nil {
+			return fmt.Errorf("invalid include %d: %w", i, err)
+		}
+		for _, repository := range stack {
+			if repository == include.Repository {
+				return fmt.Errorf("include cycle detected: %s", strings.Join(append(stack, include.Repository), " -> "))
+			}
+		}
+
+		includePath := filepath.Join(cacheDir, "repos", owner, repo, ref, "tako.yml")
+		data, err := os.ReadFile(includePath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("included repository '%s' not found in cache at %s", include.Repository, filepath.Dir(includePath))
+			}
+			return fmt.Errorf("could not read included config from '%s': %w", include.Repository, err)
+		}
+
+		included, err := decode(data)
+		if err != nil {
+			return fmt.Errorf("invalid config included from '%s': %w", include.Repository, err)
+		}
+		if err := resolveIncludes(included, cacheDir, append(stack, include.Repository)); err != nil {
+			return err
+		}
+		if err := validate(included); err != nil {
+			return fmt.Errorf("invalid config included from '%s': %w", include.Repository, err)
+		}
+
+		names := include.Workflows
+		if len(names) == 0 {
+			for name := range included.Workflows {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+		}
+
+		for _, name := range names {
+			workflow, exists := included.Workflows[name]
+			if !exists {
+				return fmt.Errorf("workflow '%s' not found in included repository '%s'", name, include.Repository)
+			}
+			if origin, exists := origins[name]; exists {
+				return fmt.Errorf("workflow '%s' is included from both '%s' and '%s'", name, origin, include.Repository)
+			}
+			origins[name] = include.Repository
+
+			// Workflows defined locally override included ones
+			if _, exists := config.Workflows[name]; exists {
+				continue
+			}
+			if config.Workflows == nil {
+				config.Workflows = make(map[string]Workflow)
+			}
+			config.Workflows[name] = workflow
+		}
+	}
+
+	return nil
+}
+
+// parseIncludeRepository splits an owner/repo:ref reference, defaulting the ref to main.
+func parseIncludeRepository(repository string) (owner, repo, ref string, err error) {
+	if repository == "" {
+		return "", "", "", fmt.Errorf("repository is required")
+	}
+
+	name, ref, _ := strings.Cut(repository, ":")
+	if ref == "" {
+		ref = "main"
+	}
+	owner, repo, found := strings.Cut(name, "/")
+	if !found || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", "", fmt.Errorf("repository '%s' must be in format 'owner/repo:ref'", repository)
+	}
+	if strings.Contains(ref, "..") || strings.ContainsAny(ref, `\`) {
+		return "", "", "", fmt.Errorf("invalid ref '%s' in repository '%s'", ref, repository)
+	}
+
+	return owner, repo, ref, nil
+}
@@ -0,0 +1,201 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCachedConfig writes a tako.yml for owner/repo at ref into the cache directory.
+func writeCachedConfig(t *testing.T, cacheDir, ownerRepo, ref, content string) {
+	t.Helper()
+
+	repoDir := filepath.Join(cacheDir, "repos", ownerRepo, ref)
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeConfig writes a tako.yml into a new directory and returns its path.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "tako.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const sharedTemplates = `
+version: "0.1.0"
+workflows:
+  build:
+    steps:
+      - id: compile
+        run: "make build"
+  release:
+    steps:
+      - run: "make release"
+`
+
+func TestLoadWithCache_Include(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedConfig(t, cacheDir, "my-org/templates", "v1", sharedTemplates)
+
+	path := writeConfig(t, `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates:v1"
+workflows:
+  release:
+    steps:
+      - run: "make local-release"
+subscriptions:
+  - artifact: "my-org/lib:lib"
+    events: ["library_built"]
+    workflow: "build"
+`)
+
+	config, err := LoadWithCache(path, cacheDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	build, exists := config.Workflows["build"]
+	if !exists {
+		t.Fatal("expected the included workflow 'build' to be available")
+	}
+	if build.Name != "build" || build.Steps[0].Run != "make build" {
+		t.Errorf("unexpected included workflow: %+v", build)
+	}
+	if run := config.Workflows["release"].Steps[0].Run; run != "make local-release" {
+		t.Errorf("expected the local workflow to override the included one, got %q", run)
+	}
+}
+
+func TestLoadWithCache_IncludeSelectedWorkflows(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedConfig(t, cacheDir, "my-org/templates", "main", sharedTemplates)
+
+	path := writeConfig(t, `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates"
+    workflows: ["build"]
+`)
+
+	config, err := LoadWithCache(path, cacheDir)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, exists := config.Workflows["release"]; exists {
+		t.Error("expected only the selected workflows to be included")
+	}
+	if _, exists := config.Workflows["build"]; !exists {
+		t.Error("expected the selected workflow to be included from the main ref")
+	}
+}
+
+func TestLoadWithCache_IncludeErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		cached        map[string]string
+		yamlContent   string
+		cacheDir      bool
+		expectedError string
+	}{
+		{
+			name: "no cache directory",
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates:v1"
+`,
+			expectedError: "cannot resolve include of 'my-org/templates:v1' without a cache directory",
+		},
+		{
+			name: "repository not in cache",
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates:v1"
+`,
+			cacheDir:      true,
+			expectedError: "included repository 'my-org/templates:v1' not found in cache",
+		},
+		{
+			name: "invalid repository",
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "templates"
+`,
+			cacheDir:      true,
+			expectedError: "must be in format 'owner/repo:ref'",
+		},
+		{
+			name:   "missing workflow",
+			cached: map[string]string{"my-org/templates": sharedTemplates},
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates:v1"
+    workflows: ["deploy"]
+`,
+			cacheDir:      true,
+			expectedError: "workflow 'deploy' not found in included repository 'my-org/templates:v1'",
+		},
+		{
+			name: "same workflow from two repositories",
+			cached: map[string]string{
+				"my-org/templates": sharedTemplates,
+				"my-org/other":     sharedTemplates,
+			},
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "my-org/templates:v1"
+  - repository: "my-org/other:v1"
+    workflows: ["build"]
+`,
+			cacheDir:      true,
+			expectedError: "workflow 'build' is included from both 'my-org/templates:v1' and 'my-org/other:v1'",
+		},
+		{
+			name: "include cycle",
+			cached: map[string]string{
+				"my-org/a": "version: \"0.1.0\"\ninclude:\n  - repository: \"my-org/b:v1\"\n",
+				"my-org/b": "version: \"0.1.0\"\ninclude:\n  - repository: \"my-org/a:v1\"\n",
+			},
+			yamlContent: `
+version: "0.1.0"
+include:
+  - repository: "my-org/a:v1"
+`,
+			cacheDir:      true,
+			expectedError: "include cycle detected: my-org/a:v1 -> my-org/b:v1 -> my-org/a:v1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cacheDir := ""
+			if tc.cacheDir {
+				cacheDir = t.TempDir()
+			}
+			for repo, content := range tc.cached {
+				writeCachedConfig(t, cacheDir, repo, "v1", content)
+			}
+
+			_, err := LoadWithCache(writeConfig(t, tc.yamlContent), cacheDir)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
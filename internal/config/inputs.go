@@ -0,0 +1,186 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Types of workflow inputs. Inputs are passed between runs, from CLI flags and from event
+// payloads as strings; typed inputs are parsed from their string form, and lists and objects
+// are encoded as JSON.
+const (
+	InputTypeString  = "string"
+	InputTypeBoolean = "boolean"
+	InputTypeNumber  = "number"
+	InputTypeInteger = "integer"
+	InputTypeList    = "list"
+	InputTypeObject  = "object"
+)
+
+var inputTypes = []string{InputTypeString, InputTypeBoolean, InputTypeNumber, InputTypeInteger, InputTypeList, InputTypeObject}
+
+// Parse converts the string form of an input value to the type of the input: a bool, an int64,
+// a float64, a []interface{} or a map[string]interface{}. Lists are JSON arrays or
+// comma-separated values, and objects are JSON (or YAML flow) mappings.
+func (input WorkflowInput) Parse(value string) (interface{}, error) {
+	switch input.Type {
+	case InputTypeBoolean:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not a boolean", value)
+		}
+		return b, nil
+	case InputTypeInteger:
+		i, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' is not an integer", value)
+		}
+		return i, nil
+	case InputTypeNumber:
+		f, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("'%s' is not a number", value)
+		}
+		return f, nil
+	case InputTypeList:
+		trimmed := strings.TrimSpace(value)
+		if trimmed == "" {
+			return []interface{}{}, nil
+		}
+		if !strings.HasPrefix(trimmed, "[") {
+			var list []interface{}
+			for _, item := range strings.Split(trimmed, ",") {
+				list = append(list, strings.TrimSpace(item))
+			}
+			return list, nil
+		}
+		var list []interface{}
+		if err := yaml.Unmarshal([]byte(trimmed), &list); err != nil {
+			return nil, fmt.Errorf("'%s' is not a list", value)
+		}
+		return normalizeInputValue(list), nil
+	case InputTypeObject:
+		var object map[string]interface{}
+		if err := yaml.Unmarshal([]byte(value), &object); err != nil || object == nil {
+			return nil, fmt.Errorf("'%s' is not an object", value)
+		}
+		return normalizeInputValue(object), nil
+	default:
+		return value, nil
+	}
+}
+
+// Check reports whether a value of the type of the input, as returned by Parse, satisfies the
+// validation rules of the input.
+func (input WorkflowInput) Check(value interface{}) error {
+	if s, ok := value.(string); ok {
+		if len(input.Validation.Enum) > 0 && !slices.Contains(input.Validation.Enum, s) {
+			return fmt.Errorf("value '%s' is not in allowed values %v", s, input.Validation.Enum)
+		}
+		if input.Validation.Pattern != "" {
+			// Validated when the config is loaded
+			if matched, _ := regexp.MatchString(input.Validation.Pattern, s); !matched {
+				return fmt.Errorf("value '%s' does not match pattern '%s'", s, input.Validation.Pattern)
+			}
+		}
+	}
+
+	var number float64
+	switch v := value.(type) {
+	case int64:
+		number = float64(v)
+	case float64:
+		number = v
+	default:
+		return nil
+	}
+	if input.Validation.Min != nil && number < *input.Validation.Min {
+		return fmt.Errorf("value %v is less than the minimum %v", value, *input.Validation.Min)
+	}
+	if input.Validation.Max != nil && number > *input.Validation.Max {
+		return fmt.Errorf("value %v is greater than the maximum %v", value, *input.Validation.Max)
+	}
+	return nil
+}
+
+// FormatInputValue returns the string form of an input value: strings as is, and other values,
+// including defaults decoded from YAML, as JSON.
+func FormatInputValue(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(normalizeInputValue(value))
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(data)
+}
+
+// normalizeInputValue converts the maps decoded from YAML, keyed by arbitrary values, to maps
+// keyed by strings, so that they can be encoded as JSON.
+func normalizeInputValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			v[key] = normalizeInputValue(item)
+		}
+		return v
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprintf("%v", key)] = normalizeInputValue(item)
+		}
+		return m
+	case []interface{}:
+		for i, item := range v {
+			v[i] = normalizeInputValue(item)
+		}
+		return v
+	case int:
+		return int64(v)
+	default:
+		return value
+	}
+}
+
+func validateWorkflowInput(_ string, input *WorkflowInput) error {
+	if input.Type != "" && !slices.Contains(inputTypes, input.Type) {
+		return fmt.Errorf("invalid input type '%s', must be one of: %v", input.Type, inputTypes)
+	}
+
+	if len(input.Validation.Enum) > 0 && input.Type != InputTypeString && input.Type != "" {
+		return fmt.Errorf("enum validation is only supported for string inputs")
+	}
+
+	if input.Validation.Pattern != "" {
+		if input.Type != InputTypeString && input.Type != "" {
+			return fmt.Errorf("pattern validation is only supported for string inputs")
+		}
+		if _, err := regexp.Compile(input.Validation.Pattern); err != nil {
+			return fmt.Errorf("invalid pattern '%s': %v", input.Validation.Pattern, err)
+		}
+	}
+
+	if (input.Validation.Min != nil || input.Validation.Max != nil) && input.Type != InputTypeNumber && input.Type != InputTypeInteger && input.Type != "" {
+		return fmt.Errorf("min/max validation is only supported for number inputs (number, integer)")
+	}
+
+	if input.Default != nil {
+		value, err := input.Parse(FormatInputValue(input.Default))
+		if err == nil {
+			err = input.Check(value)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid default: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,76 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWorkflowInput_Parse(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   WorkflowInput
+		value   string
+		want    interface{}
+		wantErr string
+	}{
+		{name: "string", input: WorkflowInput{}, value: " 1.0 ", want: " 1.0 "},
+		{name: "boolean", input: WorkflowInput{Type: InputTypeBoolean}, value: "True", want: true},
+		{name: "invalid boolean", input: WorkflowInput{Type: InputTypeBoolean}, value: "yes", wantErr: "'yes' is not a boolean"},
+		{name: "integer", input: WorkflowInput{Type: InputTypeInteger}, value: "-42", want: int64(-42)},
+		{name: "invalid integer", input: WorkflowInput{Type: InputTypeInteger}, value: "4.2", wantErr: "'4.2' is not an integer"},
+		{name: "number", input: WorkflowInput{Type: InputTypeNumber}, value: "0.25", want: 0.25},
+		{name: "invalid number", input: WorkflowInput{Type: InputTypeNumber}, value: "NaN", wantErr: "'NaN' is not a number"},
+		{name: "comma-separated list", input: WorkflowInput{Type: InputTypeList}, value: "a, b,c", want: []interface{}{"a", "b", "c"}},
+		{name: "JSON list", input: WorkflowInput{Type: InputTypeList}, value: `["a", 1, true]`, want: []interface{}{"a", int64(1), true}},
+		{name: "empty list", input: WorkflowInput{Type: InputTypeList}, value: "", want: []interface{}{}},
+		{name: "object", input: WorkflowInput{Type: InputTypeObject}, value: `{"region": "eu", "zones": [1, 2]}`,
+			want: map[string]interface{}{"region": "eu", "zones": []interface{}{int64(1), int64(2)}}},
+		{name: "invalid object", input: WorkflowInput{Type: InputTypeObject}, value: "eu", wantErr: "'eu' is not an object"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.input.Parse(tc.value)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("Parse(%q) = %#v, want %#v", tc.value, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestFormatInputValue(t *testing.T) {
+	testCases := []struct {
+		value interface{}
+		want  string
+	}{
+		{"1.0", "1.0"},
+		{true, "true"},
+		{2, "2"},
+		{1500000.0, "1500000"},
+		{[]interface{}{"eu", 1}, `["eu",1]`},
+		{map[string]interface{}{"region": map[interface{}]interface{}{"name": "eu", 1: "one"}}, `{"region":{"1":"one","name":"eu"}}`},
+	}
+	for _, tc := range testCases {
+		if got := FormatInputValue(tc.value); got != tc.want {
+			t.Errorf("FormatInputValue(%#v) = %q, want %q", tc.value, got, tc.want)
+		}
+	}
+
+	// The string form of a value parses back to the value
+	input := WorkflowInput{Type: InputTypeObject}
+	value := map[string]interface{}{"targets": []interface{}{"eu", "us"}, "canary": true}
+	parsed, err := input.Parse(FormatInputValue(value))
+	if err != nil || !reflect.DeepEqual(parsed, value) {
+		t.Errorf("expected %v to round trip, got %v (%v)", value, parsed, err)
+	}
+}
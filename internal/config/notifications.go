@@ -0,0 +1,179 @@
+package config
+
+import (
+	"fmt"
+	"net/mail"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Notification channel types.
+const (
+	NotificationSlack   = "slack"   // POSTs to a Slack incoming webhook
+	NotificationWebhook = "webhook" // POSTs the notification as JSON to a URL
+	NotificationEmail   = "email"   // Sends an email through an SMTP server
+)
+
+// Notification triggers of workflow notification policies.
+const (
+	NotifyWorkflowFailed = "workflow_failed" // The run failed or timed out
+	NotifyFanOutFailed   = "fan_out_failed"  // A fan-out step failed
+	NotifyChildFailed    = "child_failed"    // A child workflow of a fan-out failed
+	NotifyChildTimedOut  = "child_timed_out" // A child workflow of a fan-out timed out
+)
+
+var notificationTriggers = []string{NotifyWorkflowFailed, NotifyFanOutFailed, NotifyChildFailed, NotifyChildTimedOut}
+
+// Notification is a notification policy of a workflow: the channel is notified when one of
+// the triggers happens during a run.
+type Notification struct {
+	On                  []string `yaml:"on"`
+	NotificationChannel `yaml:",inline"`
+}
+
+// NotificationChannel is where notifications are sent. Webhook URLs and credentials are read
+// from the environment, so that they stay out of tako.yml.
+type NotificationChannel struct {
+	Type string `yaml:"type"` // slack, webhook or email
+	// URL is the URL of a slack or webhook channel; URLEnv names the environment variable
+	// holding it instead, as Slack webhook URLs are secrets.
+	URL    string `yaml:"url,omitempty"`
+	URLEnv string `yaml:"url_env,omitempty"`
+	// Channel overrides the default channel of a Slack webhook.
+	Channel string            `yaml:"channel,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"` // Extra HTTP headers of webhook requests
+	// SecretEnv names the environment variable holding the key of the webhook's HMAC-SHA256 signature.
+	SecretEnv string `yaml:"secret_env,omitempty"`
+	// SMTP is the host:port of the mail server of an email channel.
+	SMTP string   `yaml:"smtp,omitempty"`
+	From string   `yaml:"from,omitempty"`
+	To   []string `yaml:"to,omitempty"`
+	// UsernameEnv and PasswordEnv name the environment variables holding the SMTP credentials;
+	// the server is used without authentication when unset.
+	UsernameEnv string `yaml:"username_env,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+}
+
+// NotifyStepParams are the with: parameters of the tako/notify-slack@v1, tako/notify-webhook@v1
+// and tako/notify-email@v1 steps: a channel, whose type is given by the step, and a message.
+type NotifyStepParams struct {
+	NotificationChannel `yaml:",inline"`
+	// Title summarizes the message; it is the subject of emails.
+	Title string `yaml:"title,omitempty"`
+	// Message is the text of the notification; it may use templates.
+	Message string `yaml:"message"`
+}
+
+// notifyStepTypes maps the notification steps to the type of their channel.
+var notifyStepTypes = map[string]string{
+	"tako/notify-slack":   NotificationSlack,
+	"tako/notify-webhook": NotificationWebhook,
+	"tako/notify-email":   NotificationEmail,
+}
+
+// ParseNotifyStepParams parses the with: parameters of a notification step.
+func ParseNotifyStepParams(uses string, with map[string]interface{}) (*NotifyStepParams, error) {
+	name, _, _ := strings.Cut(uses, "@")
+	channelType, ok := notifyStepTypes[name]
+	if !ok {
+		return nil, fmt.Errorf("'%s' is not a notification step", uses)
+	}
+
+	// The parameters are decoded like the rest of tako.yml, rejecting unknown ones
+	data, err := yaml.Marshal(with)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	var params NotifyStepParams
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	if params.Type != "" && params.Type != channelType {
+		return nil, fmt.Errorf("type must not be set: the step sends %s notifications", channelType)
+	}
+	params.Type = channelType
+	if params.Message == "" {
+		return nil, fmt.Errorf("message is required")
+	}
+	if err := params.NotificationChannel.Validate(); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// isNotifyStep reports whether a step is one of the notification steps.
+func isNotifyStep(uses string) bool {
+	name, _, _ := strings.Cut(uses, "@")
+	_, ok := notifyStepTypes[name]
+	return ok
+}
+
+// Validate checks the triggers and the channel of the policy.
+func (n *Notification) Validate() error {
+	if len(n.On) == 0 {
+		return fmt.Errorf("on is required")
+	}
+	for _, trigger := range n.On {
+		valid := false
+		for _, known := range notificationTriggers {
+			if trigger == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid trigger '%s': must be one of %s", trigger, strings.Join(notificationTriggers, ", "))
+		}
+	}
+	return n.NotificationChannel.Validate()
+}
+
+// Validate checks the channel's type and the fields its type requires.
+func (c *NotificationChannel) Validate() error {
+	switch c.Type {
+	case NotificationSlack, NotificationWebhook:
+		if (c.URL == "") == (c.URLEnv == "") {
+			return fmt.Errorf("exactly one of url and url_env is required for %s notifications", c.Type)
+		}
+		if c.SMTP != "" || c.From != "" || len(c.To) > 0 || c.UsernameEnv != "" || c.PasswordEnv != "" {
+			return fmt.Errorf("smtp, from, to, username_env and password_env are only supported by email notifications")
+		}
+	case NotificationEmail:
+		if c.URL != "" || c.URLEnv != "" || len(c.Headers) > 0 || c.SecretEnv != "" {
+			return fmt.Errorf("url, url_env, headers and secret_env are not supported by email notifications")
+		}
+		if c.SMTP == "" {
+			return fmt.Errorf("smtp is required for email notifications")
+		}
+		if !strings.Contains(c.SMTP, ":") {
+			return fmt.Errorf("invalid smtp '%s': must be host:port", c.SMTP)
+		}
+		if _, err := mail.ParseAddress(c.From); err != nil {
+			return fmt.Errorf("invalid from '%s': %v", c.From, err)
+		}
+		if len(c.To) == 0 {
+			return fmt.Errorf("to is required for email notifications")
+		}
+		for _, to := range c.To {
+			if _, err := mail.ParseAddress(to); err != nil {
+				return fmt.Errorf("invalid to '%s': %v", to, err)
+			}
+		}
+		if (c.UsernameEnv == "") != (c.PasswordEnv == "") {
+			return fmt.Errorf("username_env and password_env must be set together")
+		}
+	default:
+		return fmt.Errorf("invalid type '%s': must be %s, %s or %s", c.Type, NotificationSlack, NotificationWebhook, NotificationEmail)
+	}
+	if c.Channel != "" && c.Type != NotificationSlack {
+		return fmt.Errorf("channel is only supported by slack notifications")
+	}
+	if (len(c.Headers) > 0 || c.SecretEnv != "") && c.Type != NotificationWebhook {
+		return fmt.Errorf("headers and secret_env are only supported by webhook notifications")
+	}
+	return nil
+}
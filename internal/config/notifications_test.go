@@ -0,0 +1,95 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNotification_Validate(t *testing.T) {
+	slack := NotificationChannel{Type: NotificationSlack, URLEnv: "SLACK_WEBHOOK_URL"}
+	email := NotificationChannel{Type: NotificationEmail, SMTP: "smtp.example.com:587", From: "tako@example.com", To: []string{"oncall@example.com"}}
+
+	testCases := []struct {
+		name    string
+		policy  Notification
+		wantErr string
+	}{
+		{name: "slack", policy: Notification{On: []string{NotifyFanOutFailed, NotifyChildTimedOut}, NotificationChannel: slack}},
+		{name: "email", policy: Notification{On: []string{NotifyWorkflowFailed}, NotificationChannel: email}},
+		{name: "webhook", policy: Notification{On: []string{NotifyChildFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationWebhook, URL: "https://hooks.example.com/tako", SecretEnv: "HOOK_SECRET"}}},
+		{name: "no trigger", policy: Notification{NotificationChannel: slack}, wantErr: "on is required"},
+		{name: "unknown trigger", policy: Notification{On: []string{"child_started"}, NotificationChannel: slack}, wantErr: "invalid trigger 'child_started'"},
+		{name: "unknown type", policy: Notification{On: []string{NotifyWorkflowFailed}, NotificationChannel: NotificationChannel{Type: "sms"}}, wantErr: "invalid type 'sms'"},
+		{name: "slack without url", policy: Notification{On: []string{NotifyWorkflowFailed}, NotificationChannel: NotificationChannel{Type: NotificationSlack}},
+			wantErr: "exactly one of url and url_env"},
+		{name: "slack with secret", policy: Notification{On: []string{NotifyWorkflowFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationSlack, URL: "https://hooks.slack.com/x", SecretEnv: "SECRET"}},
+			wantErr: "only supported by webhook notifications"},
+		{name: "email without recipients", policy: Notification{On: []string{NotifyWorkflowFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationEmail, SMTP: "smtp.example.com:25", From: "tako@example.com"}},
+			wantErr: "to is required"},
+		{name: "email with invalid sender", policy: Notification{On: []string{NotifyWorkflowFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationEmail, SMTP: "smtp.example.com:25", From: "tako", To: []string{"oncall@example.com"}}},
+			wantErr: "invalid from 'tako'"},
+		{name: "email without port", policy: Notification{On: []string{NotifyWorkflowFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationEmail, SMTP: "smtp.example.com", From: "tako@example.com", To: []string{"oncall@example.com"}}},
+			wantErr: "must be host:port"},
+		{name: "email with half the credentials", policy: Notification{On: []string{NotifyWorkflowFailed},
+			NotificationChannel: NotificationChannel{Type: NotificationEmail, SMTP: "smtp.example.com:25", From: "tako@example.com", To: []string{"oncall@example.com"}, UsernameEnv: "SMTP_USER"}},
+			wantErr: "must be set together"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.policy.Validate()
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestParseNotifyStepParams(t *testing.T) {
+	params, err := ParseNotifyStepParams("tako/notify-slack@v1", map[string]interface{}{
+		"url_env": "SLACK_WEBHOOK_URL",
+		"channel": "#releases",
+		"message": "Released {{ .Inputs.version }}",
+	})
+	if err != nil {
+		t.Fatalf("ParseNotifyStepParams() error = %v", err)
+	}
+	if params.Type != NotificationSlack || params.Channel != "#releases" || params.Message != "Released {{ .Inputs.version }}" {
+		t.Errorf("unexpected parameters: %+v", params)
+	}
+
+	testCases := []struct {
+		name    string
+		uses    string
+		with    map[string]interface{}
+		wantErr string
+	}{
+		{name: "no message", uses: "tako/notify-webhook@v1", with: map[string]interface{}{"url": "https://hooks.example.com"}, wantErr: "message is required"},
+		{name: "unknown parameter", uses: "tako/notify-webhook@v1", with: map[string]interface{}{"url": "https://hooks.example.com", "message": "hi", "retries": 3},
+			wantErr: "field retries not found"},
+		{name: "other type", uses: "tako/notify-slack@v1", with: map[string]interface{}{"type": "webhook", "url": "https://hooks.example.com", "message": "hi"},
+			wantErr: "type must not be set"},
+		{name: "invalid channel", uses: "tako/notify-email@v1", with: map[string]interface{}{"smtp": "smtp.example.com:25", "message": "hi"},
+			wantErr: "invalid from"},
+		{name: "not a notification step", uses: "tako/checkout@v1", with: map[string]interface{}{}, wantErr: "not a notification step"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseNotifyStepParams(tc.uses, tc.with)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
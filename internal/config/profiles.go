@@ -0,0 +1,145 @@
+package config
+
+import (
+	"fmt"
+	"maps"
+	"sort"
+)
+
+// Profile is an overlay of the workflows of a tako.yml for an environment, such as dev, staging
+// or prod, selected when a workflow is run. Its settings apply to every workflow, and those of
+// its workflows section to a single workflow.
+//
+// Profiles merge over the base definition, and more specific settings take precedence:
+// the workflow definition, then the profile, then the workflows section of the profile, and
+// finally the inputs given to the run, which always win over defaults.
+type Profile struct {
+	ProfileOverlay `yaml:",inline"`
+	Workflows      map[string]ProfileOverlay `yaml:"workflows,omitempty"`
+}
+
+// ProfileOverlay holds the settings a profile changes in a workflow.
+type ProfileOverlay struct {
+	// Inputs replaces the defaults of the inputs with these names. At the top of a profile,
+	// it only applies to the workflows declaring the inputs.
+	Inputs map[string]interface{} `yaml:"inputs,omitempty"`
+	// Env sets environment variables in every step, over the env of the steps.
+	Env map[string]string `yaml:"env,omitempty"`
+	// Resources replaces the resource limits of the workflow that it sets.
+	Resources *Resources `yaml:"resources,omitempty"`
+}
+
+// ApplyProfile merges a profile over the workflows of the configuration.
+func (c *Config) ApplyProfile(name string) error {
+	profile, exists := c.Profiles[name]
+	if !exists {
+		names := make([]string, 0, len(c.Profiles))
+		for profileName := range c.Profiles {
+			names = append(names, profileName)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("profile '%s' not found, available profiles: %v", name, names)
+	}
+	c.Workflows = applyProfile(c.Workflows, profile)
+	return nil
+}
+
+// applyProfile returns the workflows with a profile merged over them. The workflows given are
+// left unchanged.
+func applyProfile(workflows map[string]Workflow, profile Profile) map[string]Workflow {
+	result := make(map[string]Workflow, len(workflows))
+	for name, workflow := range workflows {
+		workflow = profile.ProfileOverlay.apply(workflow)
+		if overlay, exists := profile.Workflows[name]; exists {
+			workflow = overlay.apply(workflow)
+		}
+		result[name] = workflow
+	}
+	return result
+}
+
+// apply returns a copy of a workflow with the overlay merged over it. Input defaults are only
+// replaced for the inputs the workflow declares.
+func (o ProfileOverlay) apply(workflow Workflow) Workflow {
+	if len(o.Inputs) > 0 {
+		inputs := maps.Clone(workflow.Inputs)
+		for name, value := range o.Inputs {
+			input, declared := inputs[name]
+			if !declared {
+				continue
+			}
+			input.Default = value
+			inputs[name] = input
+		}
+		workflow.Inputs = inputs
+	}
+
+	if o.Resources != nil {
+		if o.Resources.CPULimit != "" {
+			workflow.Resources.CPULimit = o.Resources.CPULimit
+		}
+		if o.Resources.MemLimit != "" {
+			workflow.Resources.MemLimit = o.Resources.MemLimit
+		}
+		if o.Resources.DiskLimit != "" {
+			workflow.Resources.DiskLimit = o.Resources.DiskLimit
+		}
+	}
+
+	if len(o.Env) > 0 {
+		workflow.Steps = withStepEnv(workflow.Steps, o.Env)
+		workflow.OnSuccess = withStepEnv(workflow.OnSuccess, o.Env)
+		workflow.OnFailure = withStepEnv(workflow.OnFailure, o.Env)
+	}
+	return workflow
+}
+
+// withStepEnv returns a copy of steps, including nested ones, with environment variables set.
+func withStepEnv(steps []WorkflowStep, env map[string]string) []WorkflowStep {
+	if steps == nil {
+		return nil
+	}
+	result := make([]WorkflowStep, len(steps))
+	for i, step := range steps {
+		stepEnv := maps.Clone(step.Env)
+		if stepEnv == nil {
+			stepEnv = make(map[string]string, len(env))
+		}
+		maps.Copy(stepEnv, env)
+		step.Env = stepEnv
+		step.Parallel = withStepEnv(step.Parallel, env)
+		step.OnFailure = withStepEnv(step.OnFailure, env)
+		result[i] = step
+	}
+	return result
+}
+
+// validateProfile checks that the workflows section of a profile only refers to existing
+// workflows and declared inputs, and that the input defaults it sets are valid.
+func validateProfile(profile Profile, workflows map[string]Workflow) error {
+	names := make([]string, 0, len(profile.Workflows))
+	for name := range profile.Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		workflow, exists := workflows[name]
+		if !exists {
+			return fmt.Errorf("workflow '%s' does not exist", name)
+		}
+		for input := range profile.Workflows[name].Inputs {
+			if _, declared := workflow.Inputs[input]; !declared {
+				return fmt.Errorf("workflow '%s' has no input '%s'", name, input)
+			}
+		}
+	}
+
+	for name, workflow := range applyProfile(workflows, profile) {
+		for inputName, input := range workflow.Inputs {
+			if err := validateWorkflowInput(inputName, &input); err != nil {
+				return fmt.Errorf("invalid input '%s' of workflow '%s': %w", inputName, name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesYml = `version: "0.1.0"
+workflows:
+  deploy:
+    inputs:
+      environment:
+        default: dev
+      replicas:
+        type: integer
+        default: 1
+    resources:
+      cpu_limit: "1"
+      mem_limit: 1Gi
+    steps:
+      - id: deploy
+        run: echo deploy
+        env:
+          LOG_LEVEL: debug
+          REGION: eu
+      - id: checks
+        parallel:
+          - run: echo check
+  test:
+    steps:
+      - run: echo test
+profiles:
+  prod:
+    inputs:
+      environment: prod
+      replicas: 2
+    env:
+      LOG_LEVEL: warn
+    resources:
+      mem_limit: 4Gi
+    workflows:
+      deploy:
+        inputs:
+          replicas: 5
+`
+
+func loadProfilesConfig(t *testing.T, content string) (*Config, error) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tako.yml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	return Load(path)
+}
+
+func TestConfig_ApplyProfile(t *testing.T) {
+	cfg, err := loadProfilesConfig(t, profilesYml)
+	if err != nil {
+		t.Fatalf("failed to load config: %v", err)
+	}
+	base := cfg.Workflows["deploy"]
+
+	if err := cfg.ApplyProfile("prod"); err != nil {
+		t.Fatalf("ApplyProfile() error = %v", err)
+	}
+	deploy := cfg.Workflows["deploy"]
+
+	// The workflows section of the profile wins over the top of the profile
+	if deploy.Inputs["environment"].Default != "prod" || deploy.Inputs["replicas"].Default != 5 {
+		t.Errorf("unexpected input defaults: %+v", deploy.Inputs)
+	}
+	if deploy.Resources.CPULimit != "1" || deploy.Resources.MemLimit != "4Gi" {
+		t.Errorf("unexpected resources: %+v", deploy.Resources)
+	}
+	step := deploy.Steps[0]
+	if step.Env["LOG_LEVEL"] != "warn" || step.Env["REGION"] != "eu" {
+		t.Errorf("unexpected step env: %v", step.Env)
+	}
+	if deploy.Steps[1].Parallel[0].Env["LOG_LEVEL"] != "warn" {
+		t.Errorf("expected the profile env in parallel steps, got %v", deploy.Steps[1].Parallel[0].Env)
+	}
+	if test := cfg.Workflows["test"]; len(test.Inputs) != 0 || test.Steps[0].Env["LOG_LEVEL"] != "warn" {
+		t.Errorf("expected the profile to only set the env of a workflow without inputs, got %+v", test)
+	}
+
+	// The base definition is left unchanged
+	if base.Inputs["environment"].Default != "dev" || base.Steps[0].Env["LOG_LEVEL"] != "debug" || base.Resources.MemLimit != "1Gi" {
+		t.Errorf("expected the base workflow to be unchanged, got %+v", base)
+	}
+
+	if err := cfg.ApplyProfile("staging"); err == nil || !strings.Contains(err.Error(), "profile 'staging' not found, available profiles: [prod]") {
+		t.Errorf("expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestLoad_InvalidProfiles(t *testing.T) {
+	testCases := []struct {
+		name          string
+		profile       string
+		expectedError string
+	}{
+		{
+			name: "unknown workflow",
+			profile: `    workflows:
+      release:
+        env: {A: b}`,
+			expectedError: "invalid profile 'prod': workflow 'release' does not exist",
+		},
+		{
+			name: "undeclared input",
+			profile: `    workflows:
+      deploy:
+        inputs:
+          region: eu`,
+			expectedError: "invalid profile 'prod': workflow 'deploy' has no input 'region'",
+		},
+		{
+			name: "invalid default",
+			profile: `    inputs:
+      replicas: many`,
+			expectedError: "invalid input 'replicas' of workflow 'deploy': invalid default: 'many' is not an integer",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			content := `version: "0.1.0"
+workflows:
+  deploy:
+    inputs:
+      replicas:
+        type: integer
+    steps:
+      - run: echo deploy
+profiles:
+  prod:
+` + tc.profile + "\n"
+			_, err := loadProfilesConfig(t, content)
+			if err == nil || !strings.Contains(err.Error(), tc.expectedError) {
+				t.Errorf("expected error containing %q, got %v", tc.expectedError, err)
+			}
+		})
+	}
+}
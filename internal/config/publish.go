@@ -0,0 +1,143 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Registry types of the tako/publish-artifact@v1 step.
+const (
+	RegistryOCI = "oci" // An OCI distribution registry, such as ghcr.io
+	RegistryS3  = "s3"  // An S3 bucket, or a bucket of an S3-compatible object store
+)
+
+// ociRepositoryRegex matches OCI repositories: a registry host, with an optional port, and a
+// lowercase repository name of one or more path components.
+var ociRepositoryRegex = regexp.MustCompile(`^[a-zA-Z0-9.-]+(:[0-9]+)?(/[a-z0-9]+([._-][a-z0-9]+)*)+$`)
+
+// PublishArtifactParams are the with: parameters of the tako/publish-artifact@v1 step, which
+// pushes an artifact of the repository to a registry under its content digest. Credentials are
+// read from the environment, so that they stay out of tako.yml.
+type PublishArtifactParams struct {
+	// Artifact is the name of the artifact to publish, declared in the artifacts section.
+	Artifact string `yaml:"artifact"`
+	Registry string `yaml:"registry"` // oci or s3
+
+	// Repository is the OCI repository to push to, such as ghcr.io/my-org/go-lib.
+	Repository string `yaml:"repository,omitempty"`
+	// Tag also points to the pushed manifest; latest by default. It may use templates.
+	Tag string `yaml:"tag,omitempty"`
+	// Insecure talks to the OCI registry over plain HTTP, for local registries.
+	Insecure bool `yaml:"insecure,omitempty"`
+	// UsernameEnv and PasswordEnv name the environment variables holding the credentials of the
+	// OCI registry; it is used anonymously when unset.
+	UsernameEnv string `yaml:"username_env,omitempty"`
+	PasswordEnv string `yaml:"password_env,omitempty"`
+
+	// Bucket is the S3 bucket to upload to, under Prefix.
+	Bucket string `yaml:"bucket,omitempty"`
+	Prefix string `yaml:"prefix,omitempty"`
+	// Region is the region of the bucket; us-east-1 by default.
+	Region string `yaml:"region,omitempty"`
+	// Endpoint is the URL of an S3-compatible object store, addressed with path-style URLs;
+	// AWS by default.
+	Endpoint string `yaml:"endpoint,omitempty"`
+	// AccessKeyIDEnv and SecretAccessKeyEnv name the environment variables holding the S3
+	// credentials; AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY by default.
+	AccessKeyIDEnv     string `yaml:"access_key_id_env,omitempty"`
+	SecretAccessKeyEnv string `yaml:"secret_access_key_env,omitempty"`
+}
+
+// ParsePublishArtifactParams parses the with: parameters of a tako/publish-artifact@v1 step.
+func ParsePublishArtifactParams(with map[string]interface{}) (*PublishArtifactParams, error) {
+	// The parameters are decoded like the rest of tako.yml, rejecting unknown ones
+	data, err := yaml.Marshal(with)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	var params PublishArtifactParams
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+	return &params, nil
+}
+
+// Validate checks the artifact, the registry type and the fields its type requires.
+func (p *PublishArtifactParams) Validate() error {
+	if p.Artifact == "" {
+		return fmt.Errorf("artifact is required")
+	}
+	oci := p.Repository != "" || p.Tag != "" || p.Insecure || p.UsernameEnv != "" || p.PasswordEnv != ""
+	s3 := p.Bucket != "" || p.Prefix != "" || p.Region != "" || p.Endpoint != "" || p.AccessKeyIDEnv != "" || p.SecretAccessKeyEnv != ""
+	switch p.Registry {
+	case RegistryOCI:
+		if s3 {
+			return fmt.Errorf("bucket, prefix, region, endpoint, access_key_id_env and secret_access_key_env are only supported by s3 registries")
+		}
+		if !ociRepositoryRegex.MatchString(p.Repository) {
+			return fmt.Errorf("repository must be an OCI repository such as ghcr.io/my-org/go-lib, got '%s'", p.Repository)
+		}
+		if (p.UsernameEnv == "") != (p.PasswordEnv == "") {
+			return fmt.Errorf("username_env and password_env must be set together")
+		}
+	case RegistryS3:
+		if oci {
+			return fmt.Errorf("repository, tag, insecure, username_env and password_env are only supported by oci registries")
+		}
+		if p.Bucket == "" {
+			return fmt.Errorf("bucket is required for s3 registries")
+		}
+		if p.Endpoint != "" {
+			if parsed, err := url.Parse(p.Endpoint); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+				return fmt.Errorf("endpoint must be an http or https URL, got '%s'", p.Endpoint)
+			}
+		}
+	default:
+		return fmt.Errorf("registry must be %s or %s, got '%s'", RegistryOCI, RegistryS3, p.Registry)
+	}
+	return nil
+}
+
+// validateArtifactPublishing checks that the tako/publish-artifact@v1 steps of every workflow,
+// including those of parallel groups and hooks, publish declared artifacts.
+func validateArtifactPublishing(workflows map[string]Workflow, artifacts map[string]Artifact) error {
+	for workflowName, workflow := range workflows {
+		steps := append(append(append([]WorkflowStep{}, workflow.Steps...), workflow.OnSuccess...), workflow.OnFailure...)
+		for _, step := range publishSteps(steps) {
+			params, err := ParsePublishArtifactParams(step.With)
+			if err != nil {
+				continue // Reported by the validation of the step
+			}
+			if _, ok := artifacts[params.Artifact]; !ok {
+				return fmt.Errorf("invalid workflow '%s': publish-artifact step references non-existent artifact '%s'", workflowName, params.Artifact)
+			}
+		}
+	}
+	return nil
+}
+
+// publishSteps returns the tako/publish-artifact@v1 steps, including those of parallel groups.
+func publishSteps(steps []WorkflowStep) []WorkflowStep {
+	var publishes []WorkflowStep
+	for _, step := range steps {
+		if isPublishArtifactStep(step.Uses) {
+			publishes = append(publishes, step)
+		}
+		publishes = append(publishes, publishSteps(step.Parallel)...)
+	}
+	return publishes
+}
+
+// isPublishArtifactStep reports whether a step is the tako/publish-artifact step.
+func isPublishArtifactStep(uses string) bool {
+	return strings.HasPrefix(uses, "tako/publish-artifact@")
+}
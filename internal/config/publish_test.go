@@ -0,0 +1,65 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePublishArtifactParams(t *testing.T) {
+	params, err := ParsePublishArtifactParams(map[string]interface{}{
+		"artifact":   "lib",
+		"registry":   "oci",
+		"repository": "ghcr.io/my-org/go-lib",
+		"tag":        "{{ .Inputs.version }}",
+	})
+	if err != nil {
+		t.Fatalf("ParsePublishArtifactParams() error = %v", err)
+	}
+	if params.Registry != RegistryOCI || params.Repository != "ghcr.io/my-org/go-lib" || params.Tag != "{{ .Inputs.version }}" {
+		t.Errorf("unexpected parameters: %+v", params)
+	}
+
+	testCases := []struct {
+		name    string
+		with    map[string]interface{}
+		wantErr string
+	}{
+		{name: "no artifact", with: map[string]interface{}{"registry": "s3", "bucket": "b"}, wantErr: "artifact is required"},
+		{name: "unknown registry", with: map[string]interface{}{"artifact": "lib", "registry": "gcs"}, wantErr: "registry must be oci or s3"},
+		{name: "invalid repository", with: map[string]interface{}{"artifact": "lib", "registry": "oci", "repository": "My-Lib"},
+			wantErr: "repository must be an OCI repository"},
+		{name: "half credentials", with: map[string]interface{}{"artifact": "lib", "registry": "oci", "repository": "ghcr.io/org/lib", "username_env": "USER"},
+			wantErr: "username_env and password_env must be set together"},
+		{name: "s3 field on oci", with: map[string]interface{}{"artifact": "lib", "registry": "oci", "repository": "ghcr.io/org/lib", "bucket": "b"},
+			wantErr: "only supported by s3 registries"},
+		{name: "no bucket", with: map[string]interface{}{"artifact": "lib", "registry": "s3"}, wantErr: "bucket is required"},
+		{name: "invalid endpoint", with: map[string]interface{}{"artifact": "lib", "registry": "s3", "bucket": "b", "endpoint": "minio:9000"},
+			wantErr: "endpoint must be an http or https URL"},
+		{name: "unknown parameter", with: map[string]interface{}{"artifact": "lib", "registry": "s3", "bucket": "b", "acl": "public"},
+			wantErr: "field acl not found"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParsePublishArtifactParams(tc.with)
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateArtifactPublishing(t *testing.T) {
+	workflows := map[string]Workflow{"release": {Steps: []WorkflowStep{{
+		Parallel: []WorkflowStep{{
+			Uses: "tako/publish-artifact@v1",
+			With: map[string]interface{}{"artifact": "docs", "registry": "s3", "bucket": "b"},
+		}},
+	}}}}
+	err := validateArtifactPublishing(workflows, map[string]Artifact{"lib": {Path: "."}})
+	if err == nil || !strings.Contains(err.Error(), "non-existent artifact 'docs'") {
+		t.Errorf("expected the undeclared artifact to be rejected, got %v", err)
+	}
+	if err := validateArtifactPublishing(workflows, map[string]Artifact{"docs": {Path: "docs"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
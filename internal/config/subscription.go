@@ -1,9 +1,16 @@
 package config
 
 import (
+	"bytes"
 	"fmt"
+	"os"
+	"path"
 	"regexp"
 	"strings"
+	templateparse "text/template/parse"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 // Subscription represents a repository's subscription to events from other repositories.
@@ -14,8 +21,106 @@ type Subscription struct {
 	Filters       []string          `yaml:"filters,omitempty"`        // CEL expressions for event filtering
 	Workflow      string            `yaml:"workflow"`                 // Workflow to trigger
 	Inputs        map[string]string `yaml:"inputs,omitempty"`         // Input mappings for the triggered workflow
+	Priority      int               `yaml:"priority,omitempty"`       // Scheduling priority; higher values are triggered first
+	Disabled      bool              `yaml:"disabled,omitempty"`       // Stop triggering this subscription
+	Until         string            `yaml:"until,omitempty"`          // RFC 3339 time at which a disabled subscription re-enables itself
+	Ref           string            `yaml:"ref,omitempty"`            // Revision the workflow runs against: <ref>, <commit> or <ref>@<commit>
+	Backend       string            `yaml:"backend,omitempty"`        // Execution backend of the workflow; the run's default when empty
+	DedupWindow   string            `yaml:"dedup_window,omitempty"`   // Drop events identical to one received within this Go duration
+	// SignatureKeyEnv names the environment variable holding the key events must be signed
+	// with; unsigned events and events with an invalid signature are rejected.
+	SignatureKeyEnv string `yaml:"signature_key_env,omitempty"`
+	// Consumes maps the payload fields the subscription relies on to their type, a contract
+	// events lacking one of them, or carrying it with another type, violate.
+	Consumes map[string]string `yaml:"consumes,omitempty"`
+	// Paths are glob patterns, where ** matches any number of directories, on the paths of the
+	// emitting repository the subscription depends on. Events whose changed_paths match none of
+	// them skip the subscription; events without changed_paths always trigger it.
+	Paths []string `yaml:"paths,omitempty"`
+	// SkipUnchanged skips events whose artifact_digest equals that of the last event the
+	// subscription's workflow completed for.
+	SkipUnchanged bool `yaml:"skip_unchanged,omitempty"`
+	// ApprovalRequired holds the triggered workflow until tako approve approves it. Without
+	// an approval within ApprovalTimeout, a Go duration, the workflow is rejected.
+	ApprovalRequired bool   `yaml:"approval_required,omitempty"`
+	ApprovalTimeout  string `yaml:"approval_timeout,omitempty"`
+	// Affinity reuses the workspace the workflow prepared for a fan-out of an event type, with
+	// the files its steps left behind, for the next fan-out of the same event type.
+	Affinity *SubscriptionAffinity `yaml:"affinity,omitempty"`
+
+	Transform *SubscriptionTransform `yaml:"transform,omitempty"` // Structured input mappings computed from the payload
+}
+
+// SubscriptionAffinity configures the reuse of the workspaces of a subscription's workflow.
+// A workspace is reused while the workflow runs the same revision of the repository, and only
+// once the run that prepared it succeeded.
+type SubscriptionAffinity struct {
+	// StaleAfter is the Go duration after which an unused workspace is discarded instead of
+	// reused; DefaultAffinityStaleAfter when empty.
+	StaleAfter string `yaml:"stale_after,omitempty"`
+}
+
+// DefaultAffinityStaleAfter is how long an unused workspace of a subscription with affinity
+// is kept for the next fan-out of its event type.
+const DefaultAffinityStaleAfter = 24 * time.Hour
+
+// EffectiveStaleAfter returns the duration after which an unused workspace is discarded.
+func (a *SubscriptionAffinity) EffectiveStaleAfter() time.Duration {
+	if a.StaleAfter == "" {
+		return DefaultAffinityStaleAfter
+	}
+	staleAfter, err := time.ParseDuration(a.StaleAfter)
+	if err != nil {
+		return DefaultAffinityStaleAfter
+	}
+	return staleAfter
+}
+
+// SubscriptionTransform reshapes the event payload into workflow inputs.
+// Each input is computed by a Go template or a CEL expression over the event; lists and maps
+// produced by CEL expressions are rendered as JSON strings.
+type SubscriptionTransform struct {
+	Language string            `yaml:"language,omitempty"` // "template" (default) or "cel"
+	Inputs   map[string]string `yaml:"inputs"`             // Expressions keyed by workflow input name
+}
+
+// Languages supported by subscription transforms.
+const (
+	TransformLanguageTemplate = "template"
+	TransformLanguageCEL      = "cel"
+)
+
+// EffectiveLanguage returns the language of the transform, defaulting to Go templates.
+func (t *SubscriptionTransform) EffectiveLanguage() string {
+	if t.Language == "" {
+		return TransformLanguageTemplate
+	}
+	return t.Language
 }
 
+// IsActive reports whether the subscription should be triggered at the given time.
+// A disabled subscription stays inactive until its Until time, if one is set.
+func (s *Subscription) IsActive(now time.Time) bool {
+	if !s.Disabled {
+		return true
+	}
+	if s.Until == "" {
+		return false
+	}
+
+	until, err := time.Parse(time.RFC3339, s.Until)
+	if err != nil {
+		return false
+	}
+	return !now.Before(until)
+}
+
+// Bounds for subscription priorities. Subscriptions without a priority default to 0.
+const (
+	MinSubscriptionPriority = -100
+	MaxSubscriptionPriority = 100
+)
+
 // validateArtifactReference validates the repo:artifact format.
 func validateArtifactReference(artifact string) error {
 	if artifact == "" {
@@ -58,6 +163,58 @@ func validateArtifactReference(artifact string) error {
 	return nil
 }
 
+// PinnedRef is the revision a subscriber workflow runs against. It is written as a branch or
+// tag (<ref>), a commit SHA (<commit>), or a commit expected on a branch or tag (<ref>@<commit>).
+type PinnedRef struct {
+	Ref    string // Branch or tag; empty for the default branch
+	Commit string // Full or abbreviated commit SHA; empty for the head of Ref
+}
+
+var (
+	commitSHAPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+	refNamePattern   = regexp.MustCompile(`^[A-Za-z0-9._/-]+$`)
+)
+
+// ParsePinnedRef parses a revision given as <ref>, <commit> or <ref>@<commit>. A lone value of
+// 7 to 40 lowercase hexadecimal characters is a commit on the default branch.
+func ParsePinnedRef(spec string) (PinnedRef, error) {
+	if spec == "" {
+		return PinnedRef{}, fmt.Errorf("ref cannot be empty")
+	}
+
+	var pinned PinnedRef
+	if ref, commit, found := strings.Cut(spec, "@"); found {
+		pinned = PinnedRef{Ref: ref, Commit: commit}
+		if ref == "" {
+			return PinnedRef{}, fmt.Errorf("ref '%s' must name a branch or tag before '@'", spec)
+		}
+		if !commitSHAPattern.MatchString(commit) {
+			return PinnedRef{}, fmt.Errorf("commit '%s' in ref '%s' must be 7 to 40 lowercase hexadecimal characters", commit, spec)
+		}
+	} else if commitSHAPattern.MatchString(spec) {
+		pinned = PinnedRef{Commit: spec}
+	} else {
+		pinned = PinnedRef{Ref: spec}
+	}
+
+	if pinned.Ref != "" && (!refNamePattern.MatchString(pinned.Ref) || strings.HasPrefix(pinned.Ref, "-") || strings.Contains(pinned.Ref, "..")) {
+		return PinnedRef{}, fmt.Errorf("'%s' is not a valid branch or tag name", pinned.Ref)
+	}
+	return pinned, nil
+}
+
+// String formats the revision as it is written in configuration.
+func (p PinnedRef) String() string {
+	switch {
+	case p.Commit == "":
+		return p.Ref
+	case p.Ref == "":
+		return p.Commit
+	default:
+		return p.Ref + "@" + p.Commit
+	}
+}
+
 // ValidateSubscription validates a single subscription.
 func (s *Subscription) ValidateSubscription() error {
 	// Validate artifact reference
@@ -102,6 +259,65 @@ func (s *Subscription) ValidateSubscription() error {
 		return fmt.Errorf("workflow name '%s' must start with a letter and contain only letters, numbers, underscores, and hyphens", s.Workflow)
 	}
 
+	// Validate scheduling priority
+	if s.Priority < MinSubscriptionPriority || s.Priority > MaxSubscriptionPriority {
+		return fmt.Errorf("priority %d must be between %d and %d", s.Priority, MinSubscriptionPriority, MaxSubscriptionPriority)
+	}
+
+	// Validate maintenance window
+	if s.Until != "" {
+		if !s.Disabled {
+			return fmt.Errorf("until requires disabled to be true")
+		}
+		if _, err := time.Parse(time.RFC3339, s.Until); err != nil {
+			return fmt.Errorf("until '%s' must be an RFC 3339 timestamp: %w", s.Until, err)
+		}
+	}
+
+	// Validate pinned revision
+	if s.Ref != "" {
+		if _, err := ParsePinnedRef(s.Ref); err != nil {
+			return fmt.Errorf("invalid ref: %w", err)
+		}
+	}
+
+	// Validate execution backend
+	if s.Backend != "" && !backendNameRegex.MatchString(s.Backend) {
+		return fmt.Errorf("invalid backend '%s': must be a lowercase name such as local, container, remote or noop", s.Backend)
+	}
+
+	// Validate deduplication window
+	if err := validateTimeout(s.DedupWindow); err != nil {
+		return fmt.Errorf("invalid dedup_window: %w", err)
+	}
+
+	// Validate approval timeout
+	if err := validateTimeout(s.ApprovalTimeout); err != nil {
+		return fmt.Errorf("invalid approval_timeout: %w", err)
+	}
+	if s.ApprovalTimeout != "" && !s.ApprovalRequired {
+		return fmt.Errorf("approval_timeout requires approval_required")
+	}
+
+	// Validate workspace affinity
+	if s.Affinity != nil {
+		if err := validateTimeout(s.Affinity.StaleAfter); err != nil {
+			return fmt.Errorf("invalid affinity.stale_after: %w", err)
+		}
+	}
+
+	// Validate consumed payload fields
+	if err := validatePayloadFields(s.Consumes); err != nil {
+		return fmt.Errorf("invalid consumes: %w", err)
+	}
+
+	// Validate changed path patterns
+	for _, pattern := range s.Paths {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" || strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("invalid paths pattern '%s': must be a glob relative to the repository", pattern)
+		}
+	}
+
 	// Validate template expressions in input mappings
 	for inputName, inputValue := range s.Inputs {
 		if err := validateTemplateExpression(inputValue); err != nil {
@@ -109,6 +325,58 @@ func (s *Subscription) ValidateSubscription() error {
 		}
 	}
 
+	// Validate payload transformation
+	if s.Transform != nil {
+		if err := s.Transform.validate(s.Inputs); err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// validate checks the transform language and expressions. Transformed inputs must not
+// also be mapped by the subscription's plain inputs.
+func (t *SubscriptionTransform) validate(inputs map[string]string) error {
+	language := t.EffectiveLanguage()
+	if language != TransformLanguageTemplate && language != TransformLanguageCEL {
+		return fmt.Errorf("unsupported language '%s', must be '%s' or '%s'", t.Language, TransformLanguageTemplate, TransformLanguageCEL)
+	}
+
+	if len(t.Inputs) == 0 {
+		return fmt.Errorf("inputs cannot be empty")
+	}
+
+	for inputName, expression := range t.Inputs {
+		if _, exists := inputs[inputName]; exists {
+			return fmt.Errorf("input '%s' is also defined in the subscription inputs", inputName)
+		}
+		if strings.TrimSpace(expression) == "" {
+			return fmt.Errorf("input '%s': expression cannot be empty", inputName)
+		}
+
+		var err error
+		if language == TransformLanguageCEL {
+			err = validateCELExpression(expression)
+		} else {
+			err = validateTemplateSyntax(expression)
+		}
+		if err != nil {
+			return fmt.Errorf("input '%s': %w", inputName, err)
+		}
+	}
+
+	return nil
+}
+
+// validateTemplateSyntax parses a Go template without resolving its functions, which are
+// provided by the execution engine.
+func validateTemplateSyntax(text string) error {
+	tree := templateparse.New("transform")
+	tree.Mode = templateparse.SkipFuncCheck
+	if _, err := tree.Parse(text, "", "", map[string]*templateparse.Tree{}); err != nil {
+		return fmt.Errorf("invalid template: %w", err)
+	}
 	return nil
 }
 
@@ -122,3 +390,131 @@ func ValidateSubscriptions(subscriptions []Subscription) error {
 
 	return nil
 }
+
+// SetSubscriptionsDisabled disables or enables the subscriptions of the tako.yml file at path
+// that match the artifact and, when not empty, the workflow. When disabling, a non-empty until
+// timestamp puts the subscriptions in maintenance mode until that time. The file is edited in
+// place so that comments and the rest of the document are preserved.
+// Returns the number of subscriptions that matched.
+func SetSubscriptionsDisabled(path, artifact, workflow string, disabled bool, until string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not read config file: %w", err)
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return 0, fmt.Errorf("could not unmarshal config: %w", err)
+	}
+	if len(document.Content) == 0 || document.Content[0].Kind != yaml.MappingNode {
+		return 0, fmt.Errorf("config file %s is not a YAML mapping", path)
+	}
+
+	subscriptions := mappingValue(document.Content[0], "subscriptions")
+	if subscriptions == nil || subscriptions.Kind != yaml.SequenceNode {
+		return 0, fmt.Errorf("config file %s has no subscriptions", path)
+	}
+
+	matched := 0
+	for _, item := range subscriptions.Content {
+		if item.Kind != yaml.MappingNode {
+			continue
+		}
+		if value := mappingValue(item, "artifact"); value == nil || value.Value != artifact {
+			continue
+		}
+		if workflow != "" {
+			if value := mappingValue(item, "workflow"); value == nil || value.Value != workflow {
+				continue
+			}
+		}
+
+		matched++
+		if disabled {
+			setMappingValue(item, "disabled", "true", "!!bool")
+			if until != "" {
+				setMappingValue(item, "until", until, "!!str")
+			} else {
+				removeMappingKey(item, "until")
+			}
+		} else {
+			removeMappingKey(item, "disabled")
+			removeMappingKey(item, "until")
+		}
+	}
+
+	if matched == 0 {
+		if workflow != "" {
+			return 0, fmt.Errorf("no subscription to artifact '%s' triggers workflow '%s'", artifact, workflow)
+		}
+		return 0, fmt.Errorf("no subscription to artifact '%s' found", artifact)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&document); err != nil {
+		return 0, fmt.Errorf("could not marshal config: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return 0, fmt.Errorf("could not marshal config: %w", err)
+	}
+
+	// Never write a config that would fail to load. Workflows included from other
+	// repositories are only known with the cache, so such configs are only decoded.
+	edited, err := decode(buf.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	if len(edited.Include) == 0 {
+		if err := validate(edited); err != nil {
+			return 0, err
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("could not stat config file: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return 0, fmt.Errorf("could not write config file: %w", err)
+	}
+
+	return matched, nil
+}
+
+// mappingValue returns the value node for a key in a YAML mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// setMappingValue sets a scalar value for a key in a YAML mapping node, adding the key if needed.
+func setMappingValue(mapping *yaml.Node, key, value, tag string) {
+	if existing := mappingValue(mapping, key); existing != nil {
+		existing.Kind = yaml.ScalarNode
+		existing.Tag = tag
+		existing.Value = value
+		existing.Content = nil
+		return
+	}
+
+	mapping.Content = append(mapping.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value},
+	)
+}
+
+// removeMappingKey removes a key and its value from a YAML mapping node.
+func removeMappingKey(mapping *yaml.Node, key string) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return
+		}
+	}
+}
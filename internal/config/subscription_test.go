@@ -1,7 +1,11 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestValidateArtifactReference(t *testing.T) {
@@ -150,6 +154,246 @@ func TestSubscription_ValidateSubscription(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "disabled with maintenance window",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Disabled: true,
+				Until:    "2030-01-02T15:04:05Z",
+			},
+			expectError: false,
+		},
+		{
+			name: "until without disabled",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Until:    "2030-01-02T15:04:05Z",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid until timestamp",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Disabled: true,
+				Until:    "tomorrow",
+			},
+			expectError: true,
+		},
+		{
+			name: "valid priority",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Priority: -10,
+			},
+			expectError: false,
+		},
+		{
+			name: "priority out of range",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Priority: MaxSubscriptionPriority + 1,
+			},
+			expectError: true,
+		},
+		{
+			name: "valid template transform",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Inputs:   map[string]string{"version": "{{ .payload.version }}"},
+				Transform: &SubscriptionTransform{
+					Inputs: map[string]string{"modules": "{{ range .payload.modules }}{{ .name | upper }},{{ end }}"},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "valid CEL transform",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Transform: &SubscriptionTransform{
+					Language: TransformLanguageCEL,
+					Inputs:   map[string]string{"modules": "payload.modules.map(m, m.name)"},
+				},
+			},
+			expectError: false,
+		},
+		{
+			name: "transform with unsupported language",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Transform: &SubscriptionTransform{
+					Language: "jq",
+					Inputs:   map[string]string{"modules": ".payload.modules"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "transform without inputs",
+			subscription: Subscription{
+				Artifact:  "my-org/go-lib:go-lib",
+				Events:    []string{"library_built"},
+				Workflow:  "update_integration",
+				Transform: &SubscriptionTransform{Language: TransformLanguageCEL},
+			},
+			expectError: true,
+		},
+		{
+			name: "transform input also mapped by inputs",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Inputs:   map[string]string{"version": "{{ .payload.version }}"},
+				Transform: &SubscriptionTransform{
+					Inputs: map[string]string{"version": "{{ .payload.version }}"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "transform with invalid template",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Transform: &SubscriptionTransform{
+					Inputs: map[string]string{"modules": "{{ range .payload.modules }}{{ .name }}"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid pinned ref",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Ref:      "main@zzz",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid backend",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Backend:  "GitHub Actions",
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid dedup window",
+			subscription: Subscription{
+				Artifact:    "my-org/go-lib:go-lib",
+				Events:      []string{"library_built"},
+				Workflow:    "update_integration",
+				DedupWindow: "5 minutes",
+			},
+			expectError: true,
+		},
+		{
+			name: "valid consumed fields",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Consumes: map[string]string{"version": "string", "modules": "array"},
+			},
+			expectError: false,
+		},
+		{
+			name: "consumed field with invalid type",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Consumes: map[string]string{"version": "semver"},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid changed path patterns",
+			subscription: Subscription{
+				Artifact:      "my-org/go-lib:go-lib",
+				Events:        []string{"library_built"},
+				Workflow:      "update_integration",
+				Paths:         []string{"src/**/*.go", "go.mod"},
+				SkipUnchanged: true,
+			},
+			expectError: false,
+		},
+		{
+			name: "absolute changed path pattern",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Paths:    []string{"/src/**"},
+			},
+			expectError: true,
+		},
+		{
+			name: "malformed changed path pattern",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Paths:    []string{"src/[a-"},
+			},
+			expectError: true,
+		},
+		{
+			name: "transform with invalid CEL expression",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Transform: &SubscriptionTransform{
+					Language: TransformLanguageCEL,
+					Inputs:   map[string]string{"modules": "payload.modules.map(m, m.name"},
+				},
+			},
+			expectError: true,
+		},
+		{
+			name: "valid affinity",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Affinity: &SubscriptionAffinity{StaleAfter: "6h"},
+			},
+			expectError: false,
+		},
+		{
+			name: "invalid affinity stale_after",
+			subscription: Subscription{
+				Artifact: "my-org/go-lib:go-lib",
+				Events:   []string{"library_built"},
+				Workflow: "update_integration",
+				Affinity: &SubscriptionAffinity{StaleAfter: "a while"},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -165,6 +409,47 @@ func TestSubscription_ValidateSubscription(t *testing.T) {
 	}
 }
 
+func TestParsePinnedRef(t *testing.T) {
+	testCases := []struct {
+		spec        string
+		expected    PinnedRef
+		expectError bool
+	}{
+		{spec: "main", expected: PinnedRef{Ref: "main"}},
+		{spec: "release/v1", expected: PinnedRef{Ref: "release/v1"}},
+		{spec: "abc1234", expected: PinnedRef{Commit: "abc1234"}},
+		{spec: "main@abc1234def", expected: PinnedRef{Ref: "main", Commit: "abc1234def"}},
+		{spec: "", expectError: true},
+		{spec: "@abc1234", expectError: true},
+		{spec: "main@xyz", expectError: true},
+		{spec: "main@abc", expectError: true},
+		{spec: "-main", expectError: true},
+		{spec: "feature..x", expectError: true},
+		{spec: "my branch", expectError: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			pinned, err := ParsePinnedRef(tc.spec)
+			if tc.expectError {
+				if err == nil {
+					t.Errorf("expected error, got %+v", pinned)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if pinned != tc.expected {
+				t.Errorf("ParsePinnedRef(%q) = %+v, want %+v", tc.spec, pinned, tc.expected)
+			}
+			if pinned.String() != tc.spec {
+				t.Errorf("String() = %q, want %q", pinned.String(), tc.spec)
+			}
+		})
+	}
+}
+
 func TestValidateSubscriptions(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -222,3 +507,104 @@ func TestValidateSubscriptions(t *testing.T) {
 		})
 	}
 }
+
+func TestSubscription_IsActive(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name         string
+		subscription Subscription
+		expected     bool
+	}{
+		{name: "enabled", subscription: Subscription{}, expected: true},
+		{name: "disabled", subscription: Subscription{Disabled: true}, expected: false},
+		{name: "maintenance window open", subscription: Subscription{Disabled: true, Until: "2025-06-01T13:00:00Z"}, expected: false},
+		{name: "maintenance window over", subscription: Subscription{Disabled: true, Until: "2025-06-01T12:00:00Z"}, expected: true},
+		{name: "invalid until stays disabled", subscription: Subscription{Disabled: true, Until: "soon"}, expected: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := tc.subscription.IsActive(now); actual != tc.expected {
+				t.Errorf("expected IsActive to be %v, got %v", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestSetSubscriptionsDisabled(t *testing.T) {
+	takoYml := `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo update
+  notify:
+    steps:
+      - run: echo notify
+# Subscriptions to upstream libraries
+subscriptions:
+  - artifact: my-org/go-lib:go-lib
+    events: [library_built]
+    workflow: update
+  - artifact: my-org/go-lib:go-lib
+    events: [library_built]
+    workflow: notify
+  - artifact: my-org/other:other
+    events: [library_built]
+    workflow: update
+`
+	path := filepath.Join(t.TempDir(), "tako.yml")
+	if err := os.WriteFile(path, []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	count, err := SetSubscriptionsDisabled(path, "my-org/go-lib:go-lib", "update", true, "2030-01-02T15:04:05Z")
+	if err != nil {
+		t.Fatalf("failed to disable subscription: %v", err)
+	}
+	if count != 1 {
+		t.Errorf("expected 1 subscription to be disabled, got %d", count)
+	}
+
+	config, err := Load(path)
+	if err != nil {
+		t.Fatalf("failed to load edited config: %v", err)
+	}
+	if !config.Subscriptions[0].Disabled || config.Subscriptions[0].Until != "2030-01-02T15:04:05Z" {
+		t.Errorf("expected first subscription to be disabled until 2030, got %+v", config.Subscriptions[0])
+	}
+	if config.Subscriptions[1].Disabled || config.Subscriptions[2].Disabled {
+		t.Error("expected other subscriptions to stay enabled")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read tako.yml: %v", err)
+	}
+	if !strings.Contains(string(data), "# Subscriptions to upstream libraries") {
+		t.Error("expected comments to be preserved")
+	}
+
+	// Enabling without a workflow applies to every subscription to the artifact
+	count, err = SetSubscriptionsDisabled(path, "my-org/go-lib:go-lib", "", false, "")
+	if err != nil {
+		t.Fatalf("failed to enable subscriptions: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("expected 2 subscriptions to be enabled, got %d", count)
+	}
+	config, err = Load(path)
+	if err != nil {
+		t.Fatalf("failed to load edited config: %v", err)
+	}
+	if config.Subscriptions[0].Disabled || config.Subscriptions[0].Until != "" {
+		t.Errorf("expected maintenance window to be cleared, got %+v", config.Subscriptions[0])
+	}
+
+	if _, err := SetSubscriptionsDisabled(path, "my-org/missing:lib", "", true, ""); err == nil {
+		t.Error("expected error for unknown artifact")
+	}
+	if _, err := SetSubscriptionsDisabled(path, "my-org/other:other", "", true, "not-a-time"); err == nil {
+		t.Error("expected error for invalid until timestamp")
+	}
+}
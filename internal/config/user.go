@@ -0,0 +1,385 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// UserConfigEnv names the environment variable pointing at another user configuration file.
+const UserConfigEnv = "TAKO_CONFIG"
+
+// Log formats of the user configuration.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+var (
+	logFormats     = []string{LogFormatText, LogFormatJSON}
+	stateEncodings = []string{"json", "compact"}
+	logLevels      = map[string]slog.Level{"debug": slog.LevelDebug, "info": slog.LevelInfo, "warn": slog.LevelWarn, "error": slog.LevelError}
+)
+
+// UserConfig is the user-level configuration of ~/.tako/config.yml, loaded by tako and
+// takotest. Its settings are defaults: the TAKO_* environment variables override them, and the
+// flags of a command override both.
+type UserConfig struct {
+	// CacheDir is the default --cache-dir of tako; a leading ~/ is the home directory.
+	CacheDir string `yaml:"cache_dir,omitempty"`
+	// Namespace is the default --namespace of tako.
+	Namespace string        `yaml:"namespace,omitempty"`
+	Log       UserLogConfig `yaml:"log,omitempty"`
+	// Execution sets the defaults of the execution flags of tako.
+	Execution UserExecutionConfig `yaml:"execution,omitempty"`
+	// Retry configures the retries of the child workflows of fan-outs.
+	Retry *RetrySettings `yaml:"retry,omitempty"`
+	// CircuitBreakers configures the circuit breakers of fan-outs, unless the config file of
+	// `tako daemon` configures them.
+	CircuitBreakers *CircuitBreakersConfig `yaml:"circuit_breakers,omitempty"`
+	// Idempotency makes the fan-outs of runs idempotent: a fan-out emitting the same event as an
+	// earlier one returns its result instead of triggering the subscribers again.
+	Idempotency bool `yaml:"idempotency,omitempty"`
+	// IdempotencyRetention is how long, as a Go duration, the state of a finished idempotent
+	// fan-out prevents the same event from triggering the subscribers again; 24h by default.
+	IdempotencyRetention string `yaml:"idempotency_retention,omitempty"`
+	// StatePersistence configures how the states of fan-outs are written, for fan-outs with many
+	// children.
+	StatePersistence *StatePersistenceSettings `yaml:"state_persistence,omitempty"`
+	// Retention configures how long the artifacts of finished runs are kept by tako gc and the
+	// compaction at start.
+	Retention *RetentionSettings `yaml:"retention,omitempty"`
+	// Flags sets the defaults of any flag by command path, such as "tako" for every tako
+	// command, "tako exec" or "takotest setup". More specific paths win.
+	Flags map[string]map[string]string `yaml:"flags,omitempty"`
+}
+
+// UserLogConfig configures the logs of the commands.
+type UserLogConfig struct {
+	Format string `yaml:"format,omitempty"` // text (the default) or json
+	Level  string `yaml:"level,omitempty"`  // debug, info (the default), warn or error
+}
+
+// UserExecutionConfig sets the defaults of the flags of the same names of tako exec and the
+// other commands running workflows.
+type UserExecutionConfig struct {
+	MaxConcurrentRepos int    `yaml:"max_concurrent_repos,omitempty"`
+	MaxFanOutDepth     int    `yaml:"max_fanout_depth,omitempty"`
+	MaxTotalChildren   int    `yaml:"max_total_children,omitempty"`
+	Backend            string `yaml:"backend,omitempty"`
+	ContainerRuntime   string `yaml:"container_runtime,omitempty"`
+}
+
+// RetrySettings configure the retries of a failing operation. Unset fields keep the built-in
+// defaults.
+type RetrySettings struct {
+	// MaxRetries is the number of retries after the first attempt; 0 disables retries.
+	MaxRetries *int `yaml:"max_retries,omitempty"`
+	// InitialDelay and MaxDelay bound the backoff between attempts, as Go durations.
+	InitialDelay string `yaml:"initial_delay,omitempty"`
+	MaxDelay     string `yaml:"max_delay,omitempty"`
+	// BackoffFactor multiplies the delay after every attempt.
+	BackoffFactor float64 `yaml:"backoff_factor,omitempty"`
+}
+
+// StatePersistenceSettings configure how the states of fan-outs are written to disk. Unset
+// fields write the whole state on every update of a child.
+type StatePersistenceSettings struct {
+	// FlushInterval batches the updates of the children of a fan-out for this long, as a Go
+	// duration, recording them in a journal in between.
+	FlushInterval string `yaml:"flush_interval,omitempty"`
+	// SyncInterval is how often the journal is synced to disk; after every update when unset.
+	SyncInterval string `yaml:"sync_interval,omitempty"`
+	// ShardChildren writes each child of the fan-outs with at least this many children to its
+	// own file.
+	ShardChildren int `yaml:"shard_children,omitempty"`
+	// Encoding is the encoding of the state files: json (the default) or compact, gzipped gobs
+	// whose child details are decoded when they are needed.
+	Encoding string `yaml:"encoding,omitempty"`
+	// MaxPayloadSize is the size in bytes, as JSON, above which the payloads of the events of a
+	// fan-out are spilled to files of their own and truncated from its state.
+	MaxPayloadSize int `yaml:"max_payload_size,omitempty"`
+}
+
+// RetentionSettings configure how long the artifacts of finished runs are kept, as Go durations
+// since their last update; "0" keeps them forever. Unset fields keep the built-in defaults.
+type RetentionSettings struct {
+	// States are the execution states of child runs and the states of fan-outs.
+	States string `yaml:"states,omitempty"`
+	// Workspaces are the files left in the workspaces of runs, but their logs and reports.
+	Workspaces string `yaml:"workspaces,omitempty"`
+	// Logs are the step logs and execution reports of runs.
+	Logs string `yaml:"logs,omitempty"`
+	// History are the records of tako history.
+	History string `yaml:"history,omitempty"`
+	// CompactOnStart compacts the artifacts in the background when a run or the daemon starts,
+	// at most once an hour.
+	CompactOnStart bool `yaml:"compact_on_start,omitempty"`
+}
+
+// DefaultUserConfigPath returns the path of the user configuration file: $TAKO_CONFIG in an
+// environment, or else .tako/config.yml under the home directory, which must then be known.
+func DefaultUserConfigPath(environ []string, homeDir string) (string, error) {
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok && name == UserConfigEnv && value != "" {
+			return value, nil
+		}
+	}
+	if homeDir == "" {
+		return "", fmt.Errorf("failed to get user home directory")
+	}
+	return filepath.Join(homeDir, ".tako", "config.yml"), nil
+}
+
+// LoadUserConfig reads and validates a user configuration file. A missing file is an empty
+// configuration.
+func LoadUserConfig(path string) (*UserConfig, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &UserConfig{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read user config file: %w", err)
+	}
+
+	var cfg UserConfig
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("could not unmarshal user config %s: %w", path, err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid user config %s: %w", path, err)
+	}
+	return &cfg, nil
+}
+
+// ApplyUserConfig loads the user configuration of a command, from the file of
+// DefaultUserConfigPath with the overrides of an environment, and sets the defaults of the flags
+// of the command that were not given. tako and takotest apply it before running any command.
+func ApplyUserConfig(flags *pflag.FlagSet, commandPath string, environ []string, homeDir string) (*UserConfig, error) {
+	path, err := DefaultUserConfigPath(environ, homeDir)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadUserConfig(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.ApplyEnvironment(environ); err != nil {
+		return nil, err
+	}
+
+	for name, value := range cfg.FlagDefaults(commandPath) {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return nil, fmt.Errorf("invalid default of --%s in %s: %v", name, path, err)
+		}
+	}
+	return cfg, nil
+}
+
+// ApplyEnvironment overrides the settings with the TAKO_* variables of an environment:
+// TAKO_CACHE_DIR, TAKO_NAMESPACE, TAKO_LOG_FORMAT, TAKO_LOG_LEVEL, TAKO_MAX_CONCURRENT_REPOS,
+// TAKO_BACKEND, TAKO_CONTAINER_RUNTIME and TAKO_IDEMPOTENCY.
+func (c *UserConfig) ApplyEnvironment(environ []string) error {
+	env := make(map[string]string)
+	for _, entry := range environ {
+		if name, value, ok := strings.Cut(entry, "="); ok && value != "" {
+			env[name] = value
+		}
+	}
+
+	for name, setting := range map[string]*string{
+		"TAKO_CACHE_DIR":         &c.CacheDir,
+		"TAKO_NAMESPACE":         &c.Namespace,
+		"TAKO_LOG_FORMAT":        &c.Log.Format,
+		"TAKO_LOG_LEVEL":         &c.Log.Level,
+		"TAKO_BACKEND":           &c.Execution.Backend,
+		"TAKO_CONTAINER_RUNTIME": &c.Execution.ContainerRuntime,
+	} {
+		if value, ok := env[name]; ok {
+			*setting = value
+		}
+	}
+	if value, ok := env["TAKO_MAX_CONCURRENT_REPOS"]; ok {
+		repos, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid TAKO_MAX_CONCURRENT_REPOS '%s': %v", value, err)
+		}
+		c.Execution.MaxConcurrentRepos = repos
+	}
+	if value, ok := env["TAKO_IDEMPOTENCY"]; ok {
+		idempotency, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid TAKO_IDEMPOTENCY '%s': %v", value, err)
+		}
+		c.Idempotency = idempotency
+	}
+	return c.Validate()
+}
+
+// Validate checks the log settings, the execution limits, the idempotency retention, the
+// persistence of fan-out states, the retention of artifacts, the retries and the circuit
+// breakers.
+func (c *UserConfig) Validate() error {
+	if c.Log.Format != "" && !slices.Contains(logFormats, c.Log.Format) {
+		return fmt.Errorf("log.format must be one of %s, got '%s'", strings.Join(logFormats, ", "), c.Log.Format)
+	}
+	if _, ok := logLevels[c.Log.Level]; c.Log.Level != "" && !ok {
+		return fmt.Errorf("log.level must be one of debug, info, warn, error, got '%s'", c.Log.Level)
+	}
+	if c.Execution.MaxConcurrentRepos < 0 || c.Execution.MaxFanOutDepth < 0 || c.Execution.MaxTotalChildren < 0 {
+		return fmt.Errorf("execution limits must not be negative")
+	}
+	if c.IdempotencyRetention != "" {
+		if retention, err := time.ParseDuration(c.IdempotencyRetention); err != nil || retention <= 0 {
+			return fmt.Errorf("idempotency_retention must be a positive duration, got '%s'", c.IdempotencyRetention)
+		}
+	}
+	if c.StatePersistence != nil {
+		if err := c.StatePersistence.Validate(); err != nil {
+			return fmt.Errorf("state_persistence: %w", err)
+		}
+	}
+	if c.Retention != nil {
+		if err := c.Retention.Validate(); err != nil {
+			return fmt.Errorf("retention: %w", err)
+		}
+	}
+	if c.Retry != nil {
+		if err := c.Retry.Validate(); err != nil {
+			return fmt.Errorf("retry: %w", err)
+		}
+	}
+	if c.CircuitBreakers != nil {
+		if err := c.CircuitBreakers.Validate(); err != nil {
+			return fmt.Errorf("circuit_breakers: %w", err)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the retries and the backoff factor are not negative and that the delays
+// parse.
+func (s *RetrySettings) Validate() error {
+	if s.MaxRetries != nil && *s.MaxRetries < 0 {
+		return fmt.Errorf("max_retries must not be negative")
+	}
+	if s.BackoffFactor < 0 {
+		return fmt.Errorf("backoff_factor must not be negative")
+	}
+	for name, delay := range map[string]string{"initial_delay": s.InitialDelay, "max_delay": s.MaxDelay} {
+		if delay == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(delay); err != nil {
+			return fmt.Errorf("invalid %s '%s': %v", name, delay, err)
+		}
+	}
+	return nil
+}
+
+// Validate checks the encoding, and that the intervals are durations and the sizes are not
+// negative.
+func (s *StatePersistenceSettings) Validate() error {
+	if s.Encoding != "" && !slices.Contains(stateEncodings, s.Encoding) {
+		return fmt.Errorf("encoding must be one of %s, got '%s'", strings.Join(stateEncodings, ", "), s.Encoding)
+	}
+	for _, interval := range []struct{ name, value string }{
+		{"flush_interval", s.FlushInterval},
+		{"sync_interval", s.SyncInterval},
+	} {
+		if interval.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(interval.value); err != nil || duration < 0 {
+			return fmt.Errorf("%s must be a duration that is not negative, got '%s'", interval.name, interval.value)
+		}
+	}
+	if s.ShardChildren < 0 || s.MaxPayloadSize < 0 {
+		return fmt.Errorf("shard_children and max_payload_size must not be negative")
+	}
+	return nil
+}
+
+// Validate checks that the retentions are durations that are not negative.
+func (s *RetentionSettings) Validate() error {
+	for _, retention := range []struct{ name, value string }{
+		{"states", s.States},
+		{"workspaces", s.Workspaces},
+		{"logs", s.Logs},
+		{"history", s.History},
+	} {
+		if retention.value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(retention.value); err != nil || duration < 0 {
+			return fmt.Errorf("%s must be a duration that is not negative, got '%s'", retention.name, retention.value)
+		}
+	}
+	return nil
+}
+
+// FlagDefaults returns the defaults of the flags of a command, by flag name, from the settings
+// that are set and the flags sections of the command path and of its parents. The settings only
+// apply to tako commands.
+func (c *UserConfig) FlagDefaults(commandPath string) map[string]string {
+	defaults := make(map[string]string)
+	if commandPath == "tako" || strings.HasPrefix(commandPath, "tako ") {
+		for name, value := range map[string]string{
+			"cache-dir":         c.CacheDir,
+			"namespace":         c.Namespace,
+			"backend":           c.Execution.Backend,
+			"container-runtime": c.Execution.ContainerRuntime,
+		} {
+			if value != "" {
+				defaults[name] = value
+			}
+		}
+		for name, value := range map[string]int{
+			"max-concurrent-repos": c.Execution.MaxConcurrentRepos,
+			"max-fanout-depth":     c.Execution.MaxFanOutDepth,
+			"max-total-children":   c.Execution.MaxTotalChildren,
+		} {
+			if value > 0 {
+				defaults[name] = strconv.Itoa(value)
+			}
+		}
+	}
+
+	// The flags of parent commands apply first, so that those of the command win
+	words := strings.Fields(commandPath)
+	for i := 1; i <= len(words); i++ {
+		for name, value := range c.Flags[strings.Join(words[:i], " ")] {
+			defaults[name] = value
+		}
+	}
+	return defaults
+}
+
+// LogHandler returns a handler writing the logs to w in the format and at the level of the
+// configuration. Tokens used for Git and the GitHub API never reach the logs: the registered
+// secrets are redacted.
+func (c *UserConfig) LogHandler(w io.Writer) slog.Handler {
+	opts := &slog.HandlerOptions{Level: logLevels[c.Log.Level]}
+	if c.Log.Format == LogFormatJSON {
+		return auth.NewRedactingHandler(slog.NewJSONHandler(w, opts))
+	}
+	return auth.NewRedactingHandler(slog.NewTextHandler(w, opts))
+}
@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/spf13/pflag"
+)
+
+func TestLoadUserConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	cfg, err := LoadUserConfig(filepath.Join(dir, "missing.yml"))
+	if err != nil || !reflect.DeepEqual(cfg, &UserConfig{}) {
+		t.Errorf("expected an empty configuration for a missing file, got %+v, %v", cfg, err)
+	}
+
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "empty", content: ""},
+		{name: "full", content: `cache_dir: ~/tako-cache
+namespace: team-a
+log: {format: json, level: debug}
+execution: {max_concurrent_repos: 8, backend: container}
+retry: {max_retries: 0, initial_delay: 1s, backoff_factor: 3}
+circuit_breakers: {default: {failure_threshold: 2}}
+idempotency: true
+state_persistence: {flush_interval: 500ms, sync_interval: 100ms, shard_children: 1000, encoding: compact, max_payload_size: 65536}
+retention: {states: 72h, logs: "0", compact_on_start: true}
+flags:
+  tako exec: {follow: "true"}
+`},
+		{name: "unknown field", content: "cache: ~/tako", wantErr: "field cache not found"},
+		{name: "invalid log format", content: "log: {format: xml}", wantErr: "log.format must be one of text, json"},
+		{name: "invalid log level", content: "log: {level: trace}", wantErr: "log.level must be one of"},
+		{name: "negative limit", content: "execution: {max_total_children: -1}", wantErr: "must not be negative"},
+		{name: "invalid idempotency retention", content: "idempotency_retention: 0s", wantErr: "idempotency_retention must be a positive duration"},
+		{name: "invalid retention", content: "retention: {history: -1h}", wantErr: "retention: history must be a duration that is not negative"},
+		{name: "invalid state persistence", content: "state_persistence: {flush_interval: later}", wantErr: "state_persistence: flush_interval must be a duration that is not negative"},
+		{name: "invalid state encoding", content: "state_persistence: {encoding: msgpack}", wantErr: "state_persistence: encoding must be one of json, compact"},
+		{name: "invalid retry delay", content: "retry: {max_delay: soon}", wantErr: "retry: invalid max_delay 'soon'"},
+		{name: "invalid circuit breakers", content: "circuit_breakers: {endpoints: {app: {}}}", wantErr: "circuit_breakers: invalid endpoint 'app'"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".yml")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write config: %v", err)
+			}
+			_, err := LoadUserConfig(path)
+			if tc.wantErr == "" && err != nil {
+				t.Errorf("LoadUserConfig() error = %v", err)
+			}
+			if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUserConfig_ApplyEnvironment(t *testing.T) {
+	cfg := &UserConfig{Namespace: "team-a", Execution: UserExecutionConfig{MaxConcurrentRepos: 8, Backend: "container"}}
+	if err := cfg.ApplyEnvironment([]string{"TAKO_NAMESPACE=team-b", "TAKO_MAX_CONCURRENT_REPOS=2", "TAKO_IDEMPOTENCY=true", "TAKO_BACKEND=", "PATH=/bin"}); err != nil {
+		t.Fatalf("ApplyEnvironment() error = %v", err)
+	}
+	want := &UserConfig{Namespace: "team-b", Execution: UserExecutionConfig{MaxConcurrentRepos: 2, Backend: "container"}, Idempotency: true}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("ApplyEnvironment() = %+v, want %+v", cfg, want)
+	}
+
+	for _, env := range []string{"TAKO_MAX_CONCURRENT_REPOS=many", "TAKO_IDEMPOTENCY=maybe", "TAKO_LOG_FORMAT=xml"} {
+		if err := (&UserConfig{}).ApplyEnvironment([]string{env}); err == nil {
+			t.Errorf("expected %s to be rejected", env)
+		}
+	}
+}
+
+func TestDefaultUserConfigPath(t *testing.T) {
+	if path, err := DefaultUserConfigPath([]string{"TAKO_CONFIG=/etc/tako.yml"}, ""); err != nil || path != "/etc/tako.yml" {
+		t.Errorf("expected TAKO_CONFIG to be used, got %q, %v", path, err)
+	}
+	if path, err := DefaultUserConfigPath([]string{"TAKO_CONFIG="}, "/home/dev"); err != nil || path != filepath.Join("/home/dev", ".tako", "config.yml") {
+		t.Errorf("expected the file of the home directory, got %q, %v", path, err)
+	}
+	if _, err := DefaultUserConfigPath(nil, ""); err == nil {
+		t.Errorf("expected an unknown home directory to fail")
+	}
+}
+
+func TestUserConfig_FlagDefaults(t *testing.T) {
+	cfg := &UserConfig{
+		CacheDir:  "/var/cache/tako",
+		Execution: UserExecutionConfig{MaxConcurrentRepos: 8},
+		Flags: map[string]map[string]string{
+			"tako":           {"local-only": "true", "cache-dir": "/tmp/tako"},
+			"tako exec":      {"follow": "true", "local-only": "false"},
+			"takotest setup": {"owner": "tako-test"},
+		},
+	}
+
+	want := map[string]string{"cache-dir": "/tmp/tako", "max-concurrent-repos": "8", "local-only": "false", "follow": "true"}
+	if got := cfg.FlagDefaults("tako exec"); !reflect.DeepEqual(got, want) {
+		t.Errorf("FlagDefaults(tako exec) = %v, want %v", got, want)
+	}
+
+	// The settings of tako do not apply to takotest
+	want = map[string]string{"owner": "tako-test"}
+	if got := cfg.FlagDefaults("takotest setup"); !reflect.DeepEqual(got, want) {
+		t.Errorf("FlagDefaults(takotest setup) = %v, want %v", got, want)
+	}
+}
+
+func TestApplyUserConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yml")
+	content := "cache_dir: /var/cache/tako\nflags:\n  takotest setup: {owner: tako-test, local: \"true\"}\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	environ := []string{UserConfigEnv + "=" + path, "TAKO_LOG_FORMAT=json"}
+
+	flags := pflag.NewFlagSet("setup", pflag.ContinueOnError)
+	owner := flags.String("owner", "", "")
+	local := flags.Bool("local", false, "")
+	if err := flags.Parse([]string{"--owner", "someone"}); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := ApplyUserConfig(flags, "takotest setup", environ, "")
+	if err != nil {
+		t.Fatalf("ApplyUserConfig() error = %v", err)
+	}
+	if cfg.Log.Format != LogFormatJSON {
+		t.Errorf("expected the environment to override the log format, got '%s'", cfg.Log.Format)
+	}
+	// The flags that were given win over the defaults of the configuration
+	if *owner != "someone" || !*local {
+		t.Errorf("expected owner 'someone' and local true, got '%s' and %v", *owner, *local)
+	}
+
+	flags = pflag.NewFlagSet("setup", pflag.ContinueOnError)
+	flags.Int("owner", 0, "")
+	if _, err := ApplyUserConfig(flags, "takotest setup", environ, ""); err == nil || !strings.Contains(err.Error(), "invalid default of --owner") {
+		t.Errorf("expected an invalid flag default to fail, got %v", err)
+	}
+}
+
+func TestUserConfig_LogHandlerRedactsSecrets(t *testing.T) {
+	auth.RegisterSecret("ghp_user_config_secret")
+	for _, format := range []string{LogFormatText, LogFormatJSON} {
+		var out bytes.Buffer
+		cfg := &UserConfig{Log: UserLogConfig{Format: format}}
+		slog.New(cfg.LogHandler(&out)).Info("cloning with ghp_user_config_secret", "token", "ghp_user_config_secret")
+		if strings.Contains(out.String(), "ghp_user_config_secret") {
+			t.Errorf("expected the %s logs to redact the secret, got %s", format, out.String())
+		}
+	}
+}
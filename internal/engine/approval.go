@@ -0,0 +1,472 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// defaultApprovalPollInterval is how often waiting runs check for the decision of their gate.
+const defaultApprovalPollInterval = 500 * time.Millisecond
+
+// ApprovalStatus is the status of an approval gate.
+type ApprovalStatus string
+
+const (
+	ApprovalPending  ApprovalStatus = "pending"
+	ApprovalApproved ApprovalStatus = "approved"
+	ApprovalRejected ApprovalStatus = "rejected"
+)
+
+// ApprovalTimeoutDecider is recorded as the decider of the gates decided by their timeout.
+const ApprovalTimeoutDecider = "timeout"
+
+// ApprovalRequest is an approval gate a run waits on, and its decision once it was made.
+type ApprovalRequest struct {
+	RunID string `json:"run_id"`
+	// Gate identifies the gate within its run: the ID of a tako/approval@v1 step, the
+	// repository:workflow of a subscription child, or the wave of a rollout.
+	Gate string `json:"gate"`
+
+	// Repository and Workflow are the child a fan-out holds, and FanOutID its fan-out; empty
+	// for approval steps.
+	Repository string `json:"repository,omitempty"`
+	Workflow   string `json:"workflow,omitempty"`
+	FanOutID   string `json:"fanout_id,omitempty"`
+
+	Message     string         `json:"message,omitempty"`
+	Status      ApprovalStatus `json:"status"`
+	RequestedAt time.Time      `json:"requested_at"`
+
+	// Deadline is when the gate is decided by OnTimeout; nil when it waits forever.
+	Deadline  *time.Time `json:"deadline,omitempty"`
+	OnTimeout string     `json:"on_timeout,omitempty"`
+
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+	DecidedBy string     `json:"decided_by,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+}
+
+// approvalDecision is the decision of a gate, persisted apart from its request so that the
+// first of the approvers and the timeout to decide wins.
+type approvalDecision struct {
+	Status    ApprovalStatus `json:"status"`
+	DecidedAt time.Time      `json:"decided_at"`
+	DecidedBy string         `json:"decided_by,omitempty"`
+	Reason    string         `json:"reason,omitempty"`
+}
+
+// ApprovalManager persists the approval gates of runs and their decisions.
+// Gates live in the shared cache directory, so that tako approve decides the gates of runs in
+// any process sharing the cache.
+type ApprovalManager struct {
+	dir          string
+	pollInterval time.Duration
+	clock        Clock // Clock of the requests, decisions and deadlines; the system clock when nil
+}
+
+// NewApprovalManager creates an approval manager storing gates under cacheDir.
+func NewApprovalManager(cacheDir string) (*ApprovalManager, error) {
+	dir := filepath.Join(cacheDir, "approvals")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create approval directory: %v", err)
+	}
+
+	return &ApprovalManager{
+		dir:          dir,
+		pollInterval: defaultApprovalPollInterval,
+	}, nil
+}
+
+// SetPollInterval sets how often waiting runs check for the decision of their gate.
+func (am *ApprovalManager) SetPollInterval(interval time.Duration) {
+	if interval > 0 {
+		am.pollInterval = interval
+	}
+}
+
+// SetClock sets the clock the gates are requested and decided on, and their deadlines pass on.
+func (am *ApprovalManager) SetClock(clock Clock) {
+	am.clock = clock
+}
+
+// now returns the time of the manager's clock.
+func (am *ApprovalManager) now() time.Time {
+	return clockOrSystem(am.clock).Now()
+}
+
+// RequestApproval records that a run waits for the approval of a gate. The decision of an
+// earlier request of the same gate, by an earlier attempt of the run, is discarded.
+func (am *ApprovalManager) RequestApproval(request ApprovalRequest) (*ApprovalRequest, error) {
+	if err := validateCancellationRunID(request.RunID); err != nil {
+		return nil, err
+	}
+	if request.Gate == "" {
+		return nil, fmt.Errorf("approval gate is required")
+	}
+
+	request.Status = ApprovalPending
+	request.RequestedAt = am.now()
+	request.DecidedAt = nil
+	request.DecidedBy = ""
+	request.Reason = ""
+	data, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approval request: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Join(am.dir, request.RunID), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create approval directory: %v", err)
+	}
+	requestFile := am.requestPath(request.RunID, request.Gate)
+	if err := os.Remove(decisionPath(requestFile)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove earlier approval decision: %v", err)
+	}
+
+	// Write to temporary file first, then atomic rename
+	tempFile := requestFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to write approval request: %v", err)
+	}
+	if err := os.Rename(tempFile, requestFile); err != nil {
+		os.Remove(tempFile) // Clean up on failure
+		return nil, fmt.Errorf("failed to write approval request: %v", err)
+	}
+
+	return &request, nil
+}
+
+// GetApproval returns a gate of a run with its decision, or nil if the run never requested it.
+func (am *ApprovalManager) GetApproval(runID, gate string) (*ApprovalRequest, error) {
+	if validateCancellationRunID(runID) != nil {
+		return nil, nil
+	}
+	return am.readApproval(am.requestPath(runID, gate))
+}
+
+// ListApprovals returns the gates of a run, or of every run when runID is empty, in the order
+// they were requested.
+func (am *ApprovalManager) ListApprovals(runID string) ([]*ApprovalRequest, error) {
+	runDirs := []string{runID}
+	if runID == "" {
+		entries, err := os.ReadDir(am.dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read approval directory: %v", err)
+		}
+		runDirs = runDirs[:0]
+		for _, entry := range entries {
+			if entry.IsDir() {
+				runDirs = append(runDirs, entry.Name())
+			}
+		}
+	} else if err := validateCancellationRunID(runID); err != nil {
+		return nil, err
+	}
+
+	var approvals []*ApprovalRequest
+	for _, dir := range runDirs {
+		files, err := filepath.Glob(filepath.Join(am.dir, dir, "*.json"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list approvals: %v", err)
+		}
+		for _, file := range files {
+			if strings.HasSuffix(file, ".decision.json") {
+				continue
+			}
+			approval, err := am.readApproval(file)
+			if err != nil {
+				return nil, err
+			}
+			if approval != nil {
+				approvals = append(approvals, approval)
+			}
+		}
+	}
+	sort.Slice(approvals, func(i, j int) bool {
+		return approvals[i].RequestedAt.Before(approvals[j].RequestedAt)
+	})
+	return approvals, nil
+}
+
+// Decide approves or rejects a pending gate of a run. When gate is empty, the only pending
+// gate of the run is decided. Only the first decision of a gate is recorded.
+func (am *ApprovalManager) Decide(runID, gate string, approve bool, decidedBy, reason string) (*ApprovalRequest, error) {
+	if err := validateCancellationRunID(runID); err != nil {
+		return nil, err
+	}
+	if gate == "" {
+		approvals, err := am.ListApprovals(runID)
+		if err != nil {
+			return nil, err
+		}
+		var pending []string
+		for _, approval := range approvals {
+			if approval.Status == ApprovalPending {
+				pending = append(pending, approval.Gate)
+			}
+		}
+		switch len(pending) {
+		case 0:
+			return nil, fmt.Errorf("run %s has no pending approval", runID)
+		case 1:
+			gate = pending[0]
+		default:
+			return nil, fmt.Errorf("run %s has %d pending approvals, choose one of: %s", runID, len(pending), strings.Join(pending, ", "))
+		}
+	}
+
+	requestFile := am.requestPath(runID, gate)
+	approval, err := am.readApproval(requestFile)
+	if err != nil {
+		return nil, err
+	}
+	if approval == nil {
+		return nil, fmt.Errorf("run %s has no approval %s", runID, gate)
+	}
+	if approval.Status != ApprovalPending {
+		return nil, fmt.Errorf("approval %s of run %s was already %s", gate, runID, approval.Status)
+	}
+
+	decision := approvalDecision{
+		Status:    ApprovalRejected,
+		DecidedAt: am.now(),
+		DecidedBy: decidedBy,
+		Reason:    reason,
+	}
+	if approve {
+		decision.Status = ApprovalApproved
+	}
+	data, err := json.MarshalIndent(decision, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal approval decision: %v", err)
+	}
+
+	// The decision is written aside and linked into place, so that it is never read partially
+	// written, even when its decider crashed, and concurrent decisions do not overwrite each other
+	file, err := os.CreateTemp(filepath.Dir(requestFile), ".decision-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to write approval decision: %v", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write approval decision: %v", err)
+	}
+	if err := os.Link(file.Name(), decisionPath(requestFile)); err != nil {
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to write approval decision: %v", err)
+		}
+		if decided, _ := am.readApproval(requestFile); decided != nil && decided.Status != ApprovalPending {
+			return nil, fmt.Errorf("approval %s of run %s was already %s", gate, runID, decided.Status)
+		}
+		return nil, fmt.Errorf("approval %s of run %s is being decided", gate, runID)
+	}
+
+	approval.apply(decision)
+	return approval, nil
+}
+
+// Wait blocks until a gate of a run is decided, and returns its decision. Once the deadline of
+// the gate passed, it is decided by its timeout action. Wait returns the cause of ctx if it is
+// done first.
+func (am *ApprovalManager) Wait(ctx context.Context, runID, gate string) (*ApprovalRequest, error) {
+	ticker := time.NewTicker(am.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		approval, err := am.GetApproval(runID, gate)
+		if err != nil {
+			return nil, err
+		}
+		if approval == nil {
+			return nil, fmt.Errorf("run %s has no approval %s", runID, gate)
+		}
+		if approval.Status != ApprovalPending {
+			return approval, nil
+		}
+		if approval.Deadline != nil && !am.now().Before(*approval.Deadline) {
+			approve := approval.OnTimeout == config.ApprovalOnTimeoutApprove
+			reason := fmt.Sprintf("not decided within %s", approval.Deadline.Sub(approval.RequestedAt).Round(time.Second))
+			if decided, err := am.Decide(runID, gate, approve, ApprovalTimeoutDecider, reason); err == nil {
+				return decided, nil
+			}
+			// An approver decided first; its decision is read on the next poll
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, context.Cause(ctx)
+		case <-ticker.C:
+		}
+	}
+}
+
+// readApproval reads a gate with its decision, or returns nil if the gate does not exist.
+func (am *ApprovalManager) readApproval(requestFile string) (*ApprovalRequest, error) {
+	data, err := os.ReadFile(requestFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval request: %v", err)
+	}
+	var approval ApprovalRequest
+	if err := json.Unmarshal(data, &approval); err != nil {
+		return nil, fmt.Errorf("failed to parse approval request: %v", err)
+	}
+
+	// Decisions are linked into place once written whole
+	if data, err := os.ReadFile(decisionPath(requestFile)); err == nil {
+		var decision approvalDecision
+		if json.Unmarshal(data, &decision) == nil {
+			approval.apply(decision)
+		}
+	}
+	return &approval, nil
+}
+
+// apply records a decision in the gate.
+func (r *ApprovalRequest) apply(decision approvalDecision) {
+	decidedAt := decision.DecidedAt
+	r.Status = decision.Status
+	r.DecidedAt = &decidedAt
+	r.DecidedBy = decision.DecidedBy
+	r.Reason = decision.Reason
+}
+
+// requestPath returns the path of the request of a gate of a run. Gates are named by their
+// hash, since they contain the slashes of repository names.
+func (am *ApprovalManager) requestPath(runID, gate string) string {
+	key := sha256.Sum256([]byte(gate))
+	return filepath.Join(am.dir, runID, hex.EncodeToString(key[:8])+".json")
+}
+
+// decisionPath returns the path of the decision of a gate from the path of its request.
+func decisionPath(requestFile string) string {
+	return strings.TrimSuffix(requestFile, ".json") + ".decision.json"
+}
+
+// deadline returns when a gate requested now with the given timeout, a Go duration, times out;
+// nil when the timeout is empty and the gate waits forever.
+func (am *ApprovalManager) deadline(timeout string) (*time.Time, error) {
+	if timeout == "" {
+		return nil, nil
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return nil, fmt.Errorf("invalid approval timeout '%s': %v", timeout, err)
+	}
+	deadline := am.now().Add(duration)
+	return &deadline, nil
+}
+
+// executeApprovalStep pauses the run until the approval gate of the step is decided by tako
+// approve, or by its timeout. The step waits for approval meanwhile; it completes with the
+// decision when the gate is approved, and fails when it is rejected.
+func (r *Runner) executeApprovalStep(ctx context.Context, step config.WorkflowStep, stepID string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
+	fail := func(err error) (StepResult, error) {
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
+	params, err := config.ParseApprovalParams(step.With)
+	if err != nil {
+		return fail(err)
+	}
+	message, err := r.expandTemplate(params.Message, inputs, stepOutputs)
+	if err != nil {
+		return fail(fmt.Errorf("failed to expand message: %v", err))
+	}
+	deadline, err := r.approvals.deadline(params.Timeout)
+	if err != nil {
+		return fail(err)
+	}
+
+	request, err := r.approvals.RequestApproval(ApprovalRequest{
+		RunID:     r.runID,
+		Gate:      stepID,
+		Message:   message,
+		Deadline:  deadline,
+		OnTimeout: params.EffectiveOnTimeout(),
+	})
+	if err != nil {
+		return fail(err)
+	}
+	if err := r.state.WaitForApproval(stepID); err != nil {
+		return fail(err)
+	}
+
+	// Approvers find the gate in the step log and the followed output
+	capture := newStepOutput(r.logDir(), stepID, r.followLabel(stepID), r.logs, false)
+	if message != "" {
+		fmt.Fprintf(capture.Stdout(), "%s\n", message)
+	}
+	fmt.Fprintf(capture.Stdout(), "Waiting for approval: tako approve %s --step %s\n", r.runID, stepID)
+	if request.Deadline != nil {
+		onTimeout := ApprovalRejected
+		if request.OnTimeout == config.ApprovalOnTimeoutApprove {
+			onTimeout = ApprovalApproved
+		}
+		fmt.Fprintf(capture.Stdout(), "Without a decision by %s, the step is %s\n", request.Deadline.Format(time.RFC3339), onTimeout)
+	}
+	decision, err := r.approvals.Wait(ctx, r.runID, stepID)
+	if err == nil {
+		fmt.Fprintf(capture.Stdout(), "%s\n", describeApproval(decision))
+	}
+	capture.Close()
+	if err != nil {
+		// An interrupted step stays waiting, and requests approval again when the run resumes
+		if IsRunInterrupted(ctx) {
+			return StepResult{ID: stepID, Success: false, Error: err, StartTime: startTime, EndTime: r.now()}, err
+		}
+		return fail(fmt.Errorf("approval was not decided: %w", err))
+	}
+
+	r.state.ResumeStep(stepID)
+	if decision.Status != ApprovalApproved {
+		return fail(fmt.Errorf("%s", describeApproval(decision)))
+	}
+	outputs := map[string]string{"decided_by": decision.DecidedBy, "reason": decision.Reason}
+	output := describeApproval(decision)
+	r.state.CompleteStep(stepID, output, outputs)
+	return StepResult{
+		ID:        stepID,
+		Success:   true,
+		StartTime: startTime,
+		EndTime:   r.now(),
+		Output:    output,
+		Outputs:   outputs,
+	}, nil
+}
+
+// describeApproval returns a sentence telling how a gate was decided.
+func describeApproval(approval *ApprovalRequest) string {
+	description := fmt.Sprintf("approval %s was %s", approval.Gate, approval.Status)
+	if approval.DecidedBy == ApprovalTimeoutDecider {
+		description += " on timeout"
+	} else if approval.DecidedBy != "" {
+		description += " by " + approval.DecidedBy
+	}
+	if approval.Reason != "" {
+		description += ": " + approval.Reason
+	}
+	return description
+}
@@ -0,0 +1,342 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decideWhenPending decides a gate of any run once it is pending, and returns the run ID.
+func decideWhenPending(t *testing.T, approvals *ApprovalManager, gate string, approve bool, reason string) string {
+	t.Helper()
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		requests, err := approvals.ListApprovals("")
+		if err != nil {
+			t.Errorf("ListApprovals() error = %v", err)
+			return ""
+		}
+		for _, request := range requests {
+			if request.Gate == gate && request.Status == ApprovalPending {
+				if _, err := approvals.Decide(request.RunID, gate, approve, "alice", reason); err != nil {
+					t.Errorf("Decide() error = %v", err)
+				}
+				return request.RunID
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Errorf("approval %s was never requested", gate)
+	return ""
+}
+
+func TestApprovalManager(t *testing.T) {
+	approvals, err := NewApprovalManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+	approvals.SetPollInterval(10 * time.Millisecond)
+
+	if _, err := approvals.Decide("exec-1", "", true, "alice", ""); err == nil || !strings.Contains(err.Error(), "no pending approval") {
+		t.Errorf("expected no pending approval, got %v", err)
+	}
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-1", Gate: "deploy", Message: "ship it"}); err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-1", Gate: "test-org/app:update"}); err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if _, err := approvals.Decide("exec-1", "", true, "alice", ""); err == nil || !strings.Contains(err.Error(), "2 pending approvals") {
+		t.Errorf("expected the gate to be ambiguous, got %v", err)
+	}
+
+	decision, err := approvals.Decide("exec-1", "deploy", false, "alice", "not on a friday")
+	if err != nil {
+		t.Fatalf("Decide() error = %v", err)
+	}
+	if decision.Status != ApprovalRejected || decision.DecidedBy != "alice" || decision.Reason != "not on a friday" || decision.DecidedAt == nil {
+		t.Errorf("unexpected decision: %+v", decision)
+	}
+	if _, err := approvals.Decide("exec-1", "deploy", true, "bob", ""); err == nil || !strings.Contains(err.Error(), "already rejected") {
+		t.Errorf("expected the first decision to win, got %v", err)
+	}
+
+	// The only pending gate is decided when none is given
+	decision, err = approvals.Decide("exec-1", "", true, "bob", "")
+	if err != nil || decision.Gate != "test-org/app:update" || decision.Status != ApprovalApproved {
+		t.Fatalf("expected the pending gate to be approved, got %+v, %v", decision, err)
+	}
+	waited, err := approvals.Wait(context.Background(), "exec-1", "test-org/app:update")
+	if err != nil || waited.Status != ApprovalApproved || waited.DecidedBy != "bob" {
+		t.Errorf("expected Wait() to return the decision, got %+v, %v", waited, err)
+	}
+
+	// Requesting a gate again discards the decision of the earlier request
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-1", Gate: "deploy"}); err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if approval, _ := approvals.GetApproval("exec-1", "deploy"); approval == nil || approval.Status != ApprovalPending {
+		t.Errorf("expected the gate to be pending again, got %+v", approval)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := approvals.Wait(ctx, "exec-1", "deploy"); err != context.DeadlineExceeded {
+		t.Errorf("expected Wait() to stop with its context, got %v", err)
+	}
+
+	// Gates without a decision are decided by their timeout action
+	past := time.Now().Add(-time.Second)
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-2", Gate: "deploy", Deadline: &past, OnTimeout: "approve"}); err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	waited, err = approvals.Wait(context.Background(), "exec-2", "deploy")
+	if err != nil || waited.Status != ApprovalApproved || waited.DecidedBy != ApprovalTimeoutDecider {
+		t.Errorf("expected the gate to be approved on timeout, got %+v, %v", waited, err)
+	}
+
+	all, err := approvals.ListApprovals("")
+	if err != nil || len(all) != 3 {
+		t.Errorf("expected the 3 gates of both runs, got %d, %v", len(all), err)
+	}
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "../escape", Gate: "deploy"}); err == nil {
+		t.Error("expected an invalid run ID to be rejected")
+	}
+}
+
+func TestApprovalManager_TimeoutOnClock(t *testing.T) {
+	approvals, err := NewApprovalManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+	approvals.SetPollInterval(10 * time.Millisecond)
+	clock := NewFakeClock(time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC))
+	approvals.SetClock(clock)
+
+	deadline, err := approvals.deadline("1h")
+	if err != nil || !deadline.Equal(clock.Now().Add(time.Hour)) {
+		t.Fatalf("expected the deadline an hour from the fake time, got %v, %v", deadline, err)
+	}
+	request, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-1", Gate: "deploy", Deadline: deadline, OnTimeout: "reject"})
+	if err != nil || !request.RequestedAt.Equal(clock.Now()) {
+		t.Fatalf("expected the gate to be requested at the fake time, got %+v, %v", request, err)
+	}
+
+	decided := make(chan *ApprovalRequest, 1)
+	go func() {
+		waited, err := approvals.Wait(context.Background(), "exec-1", "deploy")
+		if err != nil {
+			t.Errorf("Wait() error = %v", err)
+		}
+		decided <- waited
+	}()
+	select {
+	case waited := <-decided:
+		t.Fatalf("expected the gate to wait for its deadline, got %+v", waited)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(time.Hour)
+	select {
+	case waited := <-decided:
+		if waited.Status != ApprovalRejected || waited.DecidedBy != ApprovalTimeoutDecider || !waited.DecidedAt.Equal(clock.Now()) {
+			t.Errorf("expected the gate to be rejected on timeout at the fake time, got %+v", waited)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("expected the gate to be decided once its deadline passed")
+	}
+}
+
+func TestApprovalManager_DecisionOfCrashedDecider(t *testing.T) {
+	approvals, err := NewApprovalManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+	if _, err := approvals.RequestApproval(ApprovalRequest{RunID: "exec-1", Gate: "deploy"}); err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+
+	// A decider that crashed while writing its decision leaves the gate decidable
+	requestFile := approvals.requestPath("exec-1", "deploy")
+	if err := os.WriteFile(filepath.Join(filepath.Dir(requestFile), ".decision-crashed"), []byte(`{"status": "appr`), 0644); err != nil {
+		t.Fatalf("failed to write partial decision: %v", err)
+	}
+	if approval, _ := approvals.GetApproval("exec-1", "deploy"); approval == nil || approval.Status != ApprovalPending {
+		t.Errorf("expected the gate to be pending, got %+v", approval)
+	}
+	if decision, err := approvals.Decide("exec-1", "deploy", true, "alice", ""); err != nil || decision.Status != ApprovalApproved {
+		t.Errorf("expected the gate to be approved, got %+v, %v", decision, err)
+	}
+	if _, err := os.Stat(decisionPath(requestFile)); err != nil {
+		t.Errorf("expected the decision to be linked into place: %v", err)
+	}
+}
+
+func TestRunnerApprovalStep(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    steps:
+      - id: approve
+        uses: tako/approval@v1
+        with:
+          message: Release {{ .Inputs.version }}?
+      - id: deploy
+        run: echo deployed by {{ .Steps.approve.decided_by }}
+    inputs:
+      version:
+        default: "1.2.0"
+`)
+	approvals, err := NewApprovalManager(runner.cacheDir)
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+
+	// The step waits for approval until it is decided
+	waiting := make(chan ExecutionStatus, 1)
+	go func() {
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			if approval, _ := approvals.GetApproval(runner.GetRunID(), "approve"); approval != nil {
+				if approval.Message != "Release 1.2.0?" {
+					t.Errorf("expected the message to be expanded, got %q", approval.Message)
+				}
+				waiting <- runner.state.GetStepStatus("approve")
+				break
+			}
+			time.Sleep(20 * time.Millisecond)
+		}
+		decideWhenPending(t, approvals, "approve", true, "")
+	}()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if status := <-waiting; status != StatusWaitingForApproval {
+		t.Errorf("expected the step to wait for approval, got %s", status)
+	}
+	if !result.Success || len(result.Steps) != 2 || !strings.Contains(result.Steps[1].Output, "deployed by alice") {
+		t.Errorf("expected the run to resume once approved, got %+v", result.Steps)
+	}
+}
+
+func TestRunnerApprovalStepRejected(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    steps:
+      - id: approve
+        uses: tako/approval@v1
+      - id: deploy
+        run: touch deployed
+`)
+	approvals, err := NewApprovalManager(runner.cacheDir)
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+	go decideWhenPending(t, approvals, "approve", false, "not today")
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err == nil || !strings.Contains(err.Error(), "approval approve was rejected by alice: not today") {
+		t.Fatalf("expected the rejection to fail the run, got %v", err)
+	}
+	if result.Success || len(result.Steps) != 1 {
+		t.Errorf("expected the run to stop at the rejected step, got %+v", result.Steps)
+	}
+	if _, statErr := os.Stat(filepath.Join(repoDir, "deployed")); !os.IsNotExist(statErr) {
+		t.Error("expected the step after the rejected gate not to run")
+	}
+}
+
+func TestFanOutApprovalGates(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	// The app requires approval, and the service is in a second wave requiring approval
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+          rollout:
+            waves: ["1"]
+            approval_required: true
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    approval_required: true
+    approval_timeout: 1m
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/svc", `version: 0.1.0
+workflows:
+  deploy:
+    steps:
+      - run: echo deployed
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: deploy
+`)
+
+	approvals, err := NewApprovalManager(runner.cacheDir)
+	if err != nil {
+		t.Fatalf("NewApprovalManager() error = %v", err)
+	}
+	runIDs := make(chan string, 2)
+	go func() {
+		runIDs <- decideWhenPending(t, approvals, "test-org/app:update", true, "")
+		runIDs <- decideWhenPending(t, approvals, "wave-2", false, "app looks broken")
+	}()
+
+	result, _ := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if result == nil || len(result.Steps) != 1 || result.Steps[0].Success {
+		t.Fatalf("expected the rejected wave to fail the fan-out, got %+v", result)
+	}
+	// The gates belong to the run that emitted the fan-out
+	for i := 0; i < 2; i++ {
+		if runID := <-runIDs; runID != result.RunID {
+			t.Errorf("expected the gates of run %s, got %s", result.RunID, runID)
+		}
+	}
+
+	states, err := NewFanOutStateManager(filepath.Join(runner.cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	fanOuts := states.FanOutsOfRun(result.RunID)
+	if len(fanOuts) != 1 {
+		t.Fatalf("expected a fan-out of the run, got %d", len(fanOuts))
+	}
+	children := make(map[string]ChildWorkflow)
+	for _, child := range fanOuts[0].GetChildren() {
+		children[child.Repository] = child
+	}
+	if app := children["test-org/app"]; app.Status != ChildStatusCompleted || app.Approval != ApprovalApproved {
+		t.Errorf("expected the approved app to run, got %+v", app)
+	}
+	if svc := children["test-org/svc"]; svc.Status != ChildStatusSkipped || !strings.Contains(svc.ErrorMessage, "wave 2 was not approved") {
+		t.Errorf("expected the service to be skipped, got %+v", svc)
+	}
+	if summary := fanOuts[0].GetSummary(); summary.Status != FanOutStatusFailed {
+		t.Errorf("expected the aborted rollout to fail the fan-out, got %s", summary.Status)
+	}
+}
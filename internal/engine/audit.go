@@ -0,0 +1,312 @@
+package engine
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Decisions recorded in the audit log.
+const (
+	AuditEventEmitted         = "event_emitted"         // A fan-out emitted an event
+	AuditDuplicateEvent       = "duplicate_event"       // The event was already fanned out; no child was triggered again
+	AuditSubscriptionMatched  = "subscription_matched"  // A subscription matched the event
+	AuditSubscriptionRejected = "subscription_rejected" // A subscription did not receive the event, see Reason
+	AuditDiamondResolved      = "diamond_resolved"      // Identical subscriptions were triggered once, for the winner
+	AuditChildFinished        = "child_finished"        // The final status of a triggered child workflow
+	AuditChildRetried         = "child_retried"         // A finished child workflow was triggered again by tako retry
+	AuditApprovalDecided      = "approval_decided"      // An approval gate holding a child or a rollout wave was decided
+)
+
+// auditLockTimeout is how long an append waits for the appends of other processes, and
+// auditStaleLock the age at which the lock of a crashed process is broken.
+const (
+	auditLockTimeout = 10 * time.Second
+	auditStaleLock   = 30 * time.Second
+)
+
+// AuditEntry is a decision of a fan-out about triggering cross-repository workflows. Each
+// entry records the hash of the previous one, so that modifying, removing or reordering
+// entries breaks the chain.
+type AuditEntry struct {
+	Sequence   int64             `json:"seq"`
+	Time       time.Time         `json:"time"`
+	FanOutID   string            `json:"fan_out_id"`
+	Decision   string            `json:"decision"`
+	Repository string            `json:"repository,omitempty"`
+	Workflow   string            `json:"workflow,omitempty"`
+	Reason     string            `json:"reason,omitempty"`
+	Filters    []FilterResult    `json:"filters,omitempty"`
+	Details    map[string]string `json:"details,omitempty"`
+	PrevHash   string            `json:"prev_hash"`
+	Hash       string            `json:"hash"`
+}
+
+// computeHash returns the hash of the entry: the SHA-256 of its JSON encoding without its own
+// hash, which includes the hash of the previous entry.
+func (e AuditEntry) computeHash() (string, error) {
+	e.Hash = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AuditLog is the append-only, hash-chained audit log of the trigger decisions of fan-outs,
+// one JSON entry per line in the cache. Appends of concurrent processes are serialized with a
+// lock file. An entry is only recorded once its line ends: a final line without a newline is
+// the partial entry of an append that did not complete, which reads ignore and the next
+// append removes.
+type AuditLog struct {
+	path string
+	mu   sync.Mutex
+
+	clock Clock // Clock the entries are timed on; the system clock when nil
+}
+
+// auditTail is the last entry of a log, kept in a sidecar file with the size of the log after
+// it, so that appends do not read the log again unless it changed otherwise.
+type auditTail struct {
+	Sequence int64  `json:"seq"`
+	Hash     string `json:"hash"`
+	Size     int64  `json:"size"`
+}
+
+// AuditVerification is the result of verifying an audit log.
+type AuditVerification struct {
+	Entries     int   // Number of entries, all intact
+	PartialSize int64 // Size of the partial entry at the end of the log, left by an interrupted append; 0 when there is none
+}
+
+// NewAuditLog creates the audit log of a cache directory.
+func NewAuditLog(cacheDir string) (*AuditLog, error) {
+	dir := filepath.Join(cacheDir, "audit")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %v", err)
+	}
+	return &AuditLog{path: filepath.Join(dir, "audit.jsonl")}, nil
+}
+
+// SetClock sets the clock the entries are timed on.
+func (l *AuditLog) SetClock(clock Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.clock = clock
+}
+
+// Append chains an entry to the end of the log, setting its sequence number and hashes.
+func (l *AuditLog) Append(entry AuditEntry) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := l.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	tail, err := l.tail()
+	if err != nil {
+		return err
+	}
+	entry.Sequence = tail.Sequence + 1
+	entry.PrevHash = tail.Hash
+	if entry.Time.IsZero() {
+		entry.Time = clockOrSystem(l.clock).Now().UTC()
+	}
+	if entry.Hash, err = entry.computeHash(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit entry: %v", err)
+	}
+	data = append(data, '\n')
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to append to audit log: %v", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to append to audit log: %v", err)
+	}
+
+	// The entry is recorded; a tail that cannot be kept is found again by the next append
+	if err := l.writeTail(auditTail{Sequence: entry.Sequence, Hash: entry.Hash, Size: tail.Size + int64(len(data))}); err != nil {
+		os.Remove(l.tailPath())
+	}
+	return nil
+}
+
+// tail returns the last entry of the log, from its sidecar file while the log has the size
+// recorded there, else by reading the log. The partial entry of an interrupted append is
+// removed, so that the next entry starts on its own line.
+func (l *AuditLog) tail() (auditTail, error) {
+	var size int64
+	info, err := os.Stat(l.path)
+	if err == nil {
+		size = info.Size()
+	} else if !os.IsNotExist(err) {
+		return auditTail{}, fmt.Errorf("failed to open audit log: %v", err)
+	}
+
+	var tail auditTail
+	if data, err := os.ReadFile(l.tailPath()); err == nil && json.Unmarshal(data, &tail) == nil && tail.Size == size {
+		return tail, nil
+	}
+
+	tail = auditTail{}
+	partial, err := l.read(func(entry AuditEntry) error {
+		tail.Sequence, tail.Hash = entry.Sequence, entry.Hash
+		return nil
+	})
+	if err != nil {
+		return auditTail{}, err
+	}
+	tail.Size = size - partial
+	if partial > 0 {
+		slog.Warn("removing the partial entry of an interrupted append from the audit log", "path", l.path, "size", partial)
+		if err := os.Truncate(l.path, tail.Size); err != nil {
+			return auditTail{}, fmt.Errorf("failed to repair audit log: %v", err)
+		}
+	}
+	return tail, nil
+}
+
+// writeTail replaces the sidecar file of the last entry of the log.
+func (l *AuditLog) writeTail(tail auditTail) error {
+	data, err := json.Marshal(tail)
+	if err != nil {
+		return err
+	}
+	tempFile := l.tailPath() + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, l.tailPath()); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
+// tailPath returns the path of the sidecar file of the last entry of the log.
+func (l *AuditLog) tailPath() string {
+	return l.path + ".tail"
+}
+
+// lock acquires the lock file of the log, breaking the locks left by crashed processes.
+func (l *AuditLog) lock() (func(), error) {
+	lockPath := l.path + ".lock"
+	deadline := time.Now().Add(auditLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock audit log: %v", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && clockOrSystem(l.clock).Now().Sub(info.ModTime()) > auditStaleLock {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock audit log: %s is held by another process", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// read calls visit for every entry of the log, in order, and returns the size of the partial
+// entry at its end, if any.
+func (l *AuditLog) read(visit func(AuditEntry) error) (int64, error) {
+	file, err := os.Open(l.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to open audit log: %v", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for line := 1; ; line++ {
+		data, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return int64(len(data)), nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read audit log: %v", err)
+		}
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return 0, fmt.Errorf("audit log line %d is not an entry: %v", line, err)
+		}
+		if err := visit(entry); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Entries returns the entries of a fan-out, in the order they were recorded; all the entries
+// when fanOutID is empty.
+func (l *AuditLog) Entries(fanOutID string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	_, err := l.read(func(entry AuditEntry) error {
+		if fanOutID == "" || entry.FanOutID == fanOutID {
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// Verify checks the hash chain of the whole log. It fails on the first entry that was
+// modified, inserted, reordered or removed before the last one, and reports the partial entry
+// of an interrupted append, which is not part of the chain.
+func (l *AuditLog) Verify() (AuditVerification, error) {
+	var result AuditVerification
+	prevHash := ""
+	partial, err := l.read(func(entry AuditEntry) error {
+		result.Entries++
+		if entry.Sequence != int64(result.Entries) {
+			return fmt.Errorf("audit log is not intact: entry %d has sequence number %d", result.Entries, entry.Sequence)
+		}
+		if entry.PrevHash != prevHash {
+			return fmt.Errorf("audit log is not intact: entry %d does not follow the previous entry", entry.Sequence)
+		}
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+		if entry.Hash != hash {
+			return fmt.Errorf("audit log is not intact: entry %d was modified", entry.Sequence)
+		}
+		prevHash = entry.Hash
+		return nil
+	})
+	result.PartialSize = partial
+	return result, err
+}
@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+func TestAuditLog_HashChain(t *testing.T) {
+	cacheDir := t.TempDir()
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	for _, entry := range []AuditEntry{
+		{FanOutID: "fanout-1", Decision: AuditEventEmitted},
+		{FanOutID: "fanout-2", Decision: AuditEventEmitted},
+		{FanOutID: "fanout-1", Decision: AuditSubscriptionMatched, Repository: "org/app", Workflow: "update"},
+	} {
+		if err := audit.Append(entry); err != nil {
+			t.Fatalf("failed to append entry: %v", err)
+		}
+	}
+
+	// Another process appending to the log continues the chain
+	other, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	if err := other.Append(AuditEntry{FanOutID: "fanout-2", Decision: AuditChildFinished}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+	if err := audit.Append(AuditEntry{FanOutID: "fanout-1", Decision: AuditChildFinished}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+
+	if result, err := audit.Verify(); err != nil || result.Entries != 5 {
+		t.Fatalf("expected an intact log of 5 entries, got %d: %v", result.Entries, err)
+	}
+	entries, err := audit.Entries("fanout-1")
+	if err != nil {
+		t.Fatalf("failed to read entries: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Sequence != 1 || entries[1].Sequence != 3 || entries[2].Sequence != 5 {
+		t.Errorf("unexpected entries of the fan-out: %+v", entries)
+	}
+
+	// Modifying an entry breaks the chain
+	path := filepath.Join(cacheDir, "audit", "audit.jsonl")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	tampered := strings.Replace(string(data), `"repository":"org/app"`, `"repository":"org/evil"`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0644); err != nil {
+		t.Fatalf("failed to write audit log: %v", err)
+	}
+	if _, err := audit.Verify(); err == nil || !strings.Contains(err.Error(), "entry 3 was modified") {
+		t.Errorf("expected the modified entry to be detected, got %v", err)
+	}
+
+	// So does removing one
+	lines := strings.SplitAfter(string(data), "\n")
+	if err := os.WriteFile(path, []byte(lines[0]+strings.Join(lines[2:], "")), 0644); err != nil {
+		t.Fatalf("failed to write audit log: %v", err)
+	}
+	if _, err := audit.Verify(); err == nil || !strings.Contains(err.Error(), "not intact") {
+		t.Errorf("expected the removed entry to be detected, got %v", err)
+	}
+}
+
+func TestAuditLog_PartialFinalEntry(t *testing.T) {
+	cacheDir := t.TempDir()
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	for _, fanOutID := range []string{"fanout-1", "fanout-2"} {
+		if err := audit.Append(AuditEntry{FanOutID: fanOutID, Decision: AuditEventEmitted}); err != nil {
+			t.Fatalf("failed to append entry: %v", err)
+		}
+	}
+
+	// An append interrupted after writing part of its entry
+	path := filepath.Join(cacheDir, "audit", "audit.jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	partial := `{"seq":3,"time":"2026-`
+	file.WriteString(partial)
+	file.Close()
+
+	result, err := audit.Verify()
+	if err != nil || result.Entries != 2 || result.PartialSize != int64(len(partial)) {
+		t.Fatalf("expected 2 intact entries and the partial one reported, got %+v: %v", result, err)
+	}
+	if entries, err := audit.Entries(""); err != nil || len(entries) != 2 {
+		t.Fatalf("expected the partial entry ignored, got %d entries: %v", len(entries), err)
+	}
+
+	// The next append removes it and continues the chain
+	if err := audit.Append(AuditEntry{FanOutID: "fanout-3", Decision: AuditEventEmitted}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+	if result, err := audit.Verify(); err != nil || result.Entries != 3 || result.PartialSize != 0 {
+		t.Errorf("expected an intact log of 3 entries, got %+v: %v", result, err)
+	}
+}
+
+func TestAuditLog_AppendsFromTheTailFile(t *testing.T) {
+	cacheDir := t.TempDir()
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to create audit log: %v", err)
+	}
+	if err := audit.Append(AuditEntry{FanOutID: "fanout-1", Decision: AuditEventEmitted}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+
+	// While the log has the size of the tail file, appends do not read it
+	path := filepath.Join(cacheDir, "audit", "audit.jsonl")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(strings.Repeat(" ", len(data)-1)+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write audit log: %v", err)
+	}
+	if err := audit.Append(AuditEntry{FanOutID: "fanout-1", Decision: AuditChildFinished}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+	entries, err := audit.Entries("")
+	if err != nil || len(entries) != 1 || entries[0].Sequence != 2 {
+		t.Fatalf("expected the entry chained to the tail file, got %+v: %v", entries, err)
+	}
+
+	// Without the tail file, appends read the log
+	if err := os.Remove(path + ".tail"); err != nil {
+		t.Fatalf("failed to remove tail file: %v", err)
+	}
+	if err := audit.Append(AuditEntry{FanOutID: "fanout-1", Decision: AuditChildFinished}); err != nil {
+		t.Fatalf("failed to append entry: %v", err)
+	}
+	entries, err = audit.Entries("")
+	if err != nil || len(entries) != 2 || entries[1].Sequence != 3 || entries[1].PrevHash != entries[0].Hash {
+		t.Errorf("expected the entry chained to the last one of the log, got %+v: %v", entries, err)
+	}
+}
+
+func TestFanOutExecutor_AuditLog(t *testing.T) {
+	cacheDir := t.TempDir()
+	runner := &failingRepoWorkflowRunner{failRepos: map[string]bool{"test-org/repo-2": true}}
+	executor, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	subscriptions := rolloutSubscriptions(3)
+	subscriptions[2].Subscription.Filters = []string{"event.payload.version.startsWith('1.')", "event.payload.version == '1.0.0'"}
+	subscriptions = append(subscriptions,
+		// Identical to the subscription of repo-1 but from another repository: it loses
+		interfaces.SubscriptionMatch{Repository: "test-org/repo-4", Subscription: subscriptions[0].Subscription},
+		interfaces.SubscriptionMatch{Repository: "test-org/repo-5", Subscription: config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   []string{"library_built"},
+			Workflow: "update-5",
+			Filters:  []string{"event.payload.version == '2.0.0'"},
+		}},
+	)
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"payload":           map[string]interface{}{"version": "1.0.0"},
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	if _, err := audit.Verify(); err != nil {
+		t.Fatalf("expected an intact audit log: %v", err)
+	}
+	entries, err := audit.Entries(result.FanOutID)
+	if err != nil {
+		t.Fatalf("failed to read entries: %v", err)
+	}
+
+	find := func(decision, repository string) *AuditEntry {
+		for i := range entries {
+			if entries[i].Decision == decision && entries[i].Repository == repository {
+				return &entries[i]
+			}
+		}
+		t.Errorf("expected a %s entry for %q in %+v", decision, repository, entries)
+		return &AuditEntry{}
+	}
+
+	if emitted := find(AuditEventEmitted, ""); emitted.Details["event_type"] != "library_built" || emitted.Details["event_fingerprint"] == "" {
+		t.Errorf("expected the event and its fingerprint, got %+v", emitted.Details)
+	}
+	matched := find(AuditSubscriptionMatched, "test-org/repo-3")
+	if len(matched.Filters) != 2 || !matched.Filters[0].Result || !matched.Filters[1].Result {
+		t.Errorf("expected the results of both filters, got %+v", matched.Filters)
+	}
+	rejected := find(AuditSubscriptionRejected, "test-org/repo-5")
+	if len(rejected.Filters) != 1 || rejected.Filters[0].Result || rejected.Reason != "filter 0 did not hold" {
+		t.Errorf("expected the rejecting filter, got %+v", rejected)
+	}
+	if diamond := find(AuditDiamondResolved, "test-org/repo-1"); diamond.Details["losers"] != "test-org/repo-4:update-1" {
+		t.Errorf("expected repo-4 to lose the diamond resolution, got %+v", diamond.Details)
+	}
+	if child := find(AuditChildFinished, "test-org/repo-1"); child.Details["status"] != string(ChildStatusCompleted) {
+		t.Errorf("expected the completed child, got %+v", child.Details)
+	}
+	if child := find(AuditChildFinished, "test-org/repo-2"); child.Details["status"] != string(ChildStatusFailed) {
+		t.Errorf("expected the failed child, got %+v", child.Details)
+	}
+}
@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// Built-in execution backends of child workflows.
+const (
+	BackendLocal     = "local"     // Runs steps in an isolated local workspace
+	BackendContainer = "container" // Runs every step in a container, in an isolated local workspace
+	BackendRemote    = "remote"    // Dispatches workflows to GitHub Actions
+	BackendNoop      = "noop"      // Records workflows without running them
+)
+
+// DefaultContainerBackendImage is the image of the container backend's steps when neither the
+// workflow nor the repository's execution.image sets one.
+const DefaultContainerBackendImage = "alpine:3"
+
+// BackendRegistry holds the backends child workflows can run on, by name. It implements the
+// interfaces.WorkflowRunner interface by running workflows on its default backend, so that it
+// can be injected wherever a single runner is expected.
+type BackendRegistry struct {
+	mu             sync.RWMutex
+	backends       map[string]interfaces.WorkflowRunner
+	defaultBackend string
+}
+
+// NewBackendRegistry creates an empty registry whose default backend is BackendLocal.
+func NewBackendRegistry() *BackendRegistry {
+	return &BackendRegistry{
+		backends:       make(map[string]interfaces.WorkflowRunner),
+		defaultBackend: BackendLocal,
+	}
+}
+
+// Register adds a backend, replacing any backend of the same name.
+func (r *BackendRegistry) Register(name string, runner interfaces.WorkflowRunner) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.backends[name] = runner
+}
+
+// Get returns a backend by name; the empty name is the default backend.
+func (r *BackendRegistry) Get(name string) (interfaces.WorkflowRunner, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if name == "" {
+		name = r.defaultBackend
+	}
+	runner, ok := r.backends[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown execution backend '%s' (available: %v)", name, slices.Sorted(maps.Keys(r.backends)))
+	}
+	return runner, nil
+}
+
+// Names returns the names of the registered backends, sorted.
+func (r *BackendRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return slices.Sorted(maps.Keys(r.backends))
+}
+
+// Default returns the name of the default backend.
+func (r *BackendRegistry) Default() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.defaultBackend
+}
+
+// SetDefault selects the backend of workflows that do not name one.
+func (r *BackendRegistry) SetDefault(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.backends[name]; !ok {
+		return fmt.Errorf("unknown execution backend '%s' (available: %v)", name, slices.Sorted(maps.Keys(r.backends)))
+	}
+	r.defaultBackend = name
+	return nil
+}
+
+// ExecuteWorkflow runs a workflow on the default backend.
+func (r *BackendRegistry) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	runner, err := r.Get("")
+	if err != nil {
+		return nil, err
+	}
+	return runner.ExecuteWorkflow(ctx, repoPath, workflowName, inputs)
+}
+
+// RecordedWorkflow is a workflow run requested from a RecordingWorkflowRunner.
+type RecordedWorkflow struct {
+	Repository string
+	Workflow   string
+	Inputs     map[string]string
+	Time       time.Time
+}
+
+// RecordingWorkflowRunner is the no-op backend: it records the workflows it is asked to run
+// and reports them successful without running anything, e.g. to preview a fan-out.
+type RecordingWorkflowRunner struct {
+	mu       sync.Mutex
+	recorded []RecordedWorkflow
+}
+
+// NewRecordingWorkflowRunner creates a no-op backend.
+func NewRecordingWorkflowRunner() *RecordingWorkflowRunner {
+	return &RecordingWorkflowRunner{}
+}
+
+// ExecuteWorkflow records the workflow and reports it successful.
+func (r *RecordingWorkflowRunner) ExecuteWorkflow(_ context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	now := time.Now()
+	r.mu.Lock()
+	r.recorded = append(r.recorded, RecordedWorkflow{
+		Repository: repoPath,
+		Workflow:   workflowName,
+		Inputs:     maps.Clone(inputs),
+		Time:       now,
+	})
+	r.mu.Unlock()
+
+	slog.Info("recorded workflow without running it", "repository", repoPath, "workflow", workflowName)
+	return &interfaces.ExecutionResult{
+		RunID:     GenerateRunID(),
+		Success:   true,
+		StartTime: now,
+		EndTime:   now,
+	}, nil
+}
+
+// Recorded returns the workflows recorded so far, in the order they were requested.
+func (r *RecordingWorkflowRunner) Recorded() []RecordedWorkflow {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.recorded)
+}
+
+// _ ensures the backends implement the WorkflowRunner interface.
+var (
+	_ interfaces.WorkflowRunner = (*BackendRegistry)(nil)
+	_ interfaces.WorkflowRunner = (*RecordingWorkflowRunner)(nil)
+)
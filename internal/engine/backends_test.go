@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestBackendRegistry(t *testing.T) {
+	registry := NewBackendRegistry()
+	local := NewRecordingWorkflowRunner()
+	noop := NewRecordingWorkflowRunner()
+	registry.Register(BackendLocal, local)
+	registry.Register(BackendNoop, noop)
+
+	if got := registry.Names(); strings.Join(got, ",") != "local,noop" {
+		t.Errorf("expected backends local,noop, got %v", got)
+	}
+
+	// The registry runs workflows on its default backend
+	if _, err := registry.ExecuteWorkflow(context.Background(), "org/app", "build", nil); err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if err := registry.SetDefault(BackendNoop); err != nil {
+		t.Fatalf("SetDefault() error = %v", err)
+	}
+	if _, err := registry.ExecuteWorkflow(context.Background(), "org/app", "deploy", map[string]string{"env": "prod"}); err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if len(local.Recorded()) != 1 || local.Recorded()[0].Workflow != "build" {
+		t.Errorf("expected build on the local backend, got %v", local.Recorded())
+	}
+	recorded := noop.Recorded()
+	if len(recorded) != 1 || recorded[0].Workflow != "deploy" || recorded[0].Inputs["env"] != "prod" {
+		t.Errorf("expected deploy on the noop backend, got %v", recorded)
+	}
+
+	if _, err := registry.Get("kubernetes"); err == nil || !strings.Contains(err.Error(), "unknown execution backend 'kubernetes'") {
+		t.Errorf("expected an unknown backend error, got %v", err)
+	}
+	if err := registry.SetDefault("kubernetes"); err == nil {
+		t.Errorf("expected an error when selecting an unknown default backend")
+	}
+}
+
+func TestFanOutExecutor_SubscriptionBackend(t *testing.T) {
+	registry := NewBackendRegistry()
+	local := NewRecordingWorkflowRunner()
+	noop := NewRecordingWorkflowRunner()
+	registry.Register(BackendLocal, local)
+	registry.Register(BackendNoop, noop)
+
+	executor, err := NewFanOutExecutor(t.TempDir(), false, registry)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	if _, err := executor.executeChildWorkflow(context.Background(), "org/app", "build", BackendNoop, nil); err != nil {
+		t.Fatalf("executeChildWorkflow() error = %v", err)
+	}
+	if _, err := executor.executeChildWorkflow(context.Background(), "org/app", "test", "", nil); err != nil {
+		t.Fatalf("executeChildWorkflow() error = %v", err)
+	}
+	if len(noop.Recorded()) != 1 || noop.Recorded()[0].Workflow != "build" {
+		t.Errorf("expected the subscription's backend to run build, got %v", noop.Recorded())
+	}
+	if len(local.Recorded()) != 1 || local.Recorded()[0].Workflow != "test" {
+		t.Errorf("expected the default backend to run test, got %v", local.Recorded())
+	}
+
+	if _, err := executor.executeChildWorkflow(context.Background(), "org/app", "build", "missing", nil); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
+
+func TestRunner_SelectBackend(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      RunnerOptions
+		execution *config.Execution
+		want      string
+	}{
+		{name: "default", want: BackendLocal},
+		{name: "tako.yml", execution: &config.Execution{Backend: BackendNoop}, want: BackendNoop},
+		{name: "options override tako.yml", opts: RunnerOptions{Backend: BackendContainer}, execution: &config.Execution{Backend: BackendNoop}, want: BackendContainer},
+		{name: "remote", opts: RunnerOptions{Remote: RemoteOptions{Enabled: true}}, want: BackendRemote},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.WorkspaceRoot = t.TempDir()
+			tt.opts.CacheDir = t.TempDir()
+			tt.opts.Environment = []string{}
+			runner, err := NewRunner(tt.opts)
+			if err != nil {
+				t.Fatalf("NewRunner() error = %v", err)
+			}
+			defer runner.Close()
+
+			if err := runner.selectBackend(tt.execution); err != nil {
+				t.Fatalf("selectBackend() error = %v", err)
+			}
+			if got := runner.Backends().Default(); got != tt.want {
+				t.Errorf("expected backend %s, got %s", tt.want, got)
+			}
+		})
+	}
+
+	if _, err := NewRunner(RunnerOptions{WorkspaceRoot: t.TempDir(), CacheDir: t.TempDir(), Backend: "missing"}); err == nil {
+		t.Errorf("expected an error for an unknown backend")
+	}
+}
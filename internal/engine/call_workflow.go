@@ -0,0 +1,167 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// CallWorkflowParams represents the parameters of a tako/call-workflow@v1 step.
+type CallWorkflowParams struct {
+	// Workflow is the name of the workflow to call.
+	Workflow string `yaml:"workflow"`
+	// Repository is the repository defining the workflow, as owner/repo or owner/repo:ref.
+	// When empty, the workflow is called from the current repository, in the same working directory.
+	Repository string `yaml:"repository,omitempty"`
+	// Inputs are passed to the called workflow; values may use templates.
+	Inputs map[string]string `yaml:"inputs,omitempty"`
+}
+
+// parseCallWorkflowParams parses the with: parameters of a tako/call-workflow@v1 step.
+func parseCallWorkflowParams(with map[string]interface{}) (*CallWorkflowParams, error) {
+	params := &CallWorkflowParams{Inputs: make(map[string]string)}
+
+	workflow, ok := with["workflow"].(string)
+	if !ok || workflow == "" {
+		return nil, fmt.Errorf("workflow is required for call-workflow step")
+	}
+	params.Workflow = workflow
+
+	if repository, exists := with["repository"]; exists {
+		repositoryStr, ok := repository.(string)
+		if !ok || repositoryStr == "" {
+			return nil, fmt.Errorf("repository must be a non-empty string")
+		}
+		params.Repository = repositoryStr
+	}
+
+	if inputs, exists := with["inputs"]; exists {
+		inputsMap, ok := inputs.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("inputs must be a map")
+		}
+		for name, value := range inputsMap {
+			if value == nil {
+				params.Inputs[name] = ""
+				continue
+			}
+			params.Inputs[name] = fmt.Sprint(value)
+		}
+	}
+
+	return params, nil
+}
+
+// executeCallWorkflowStep executes the tako/call-workflow@v1 built-in step. The called workflow
+// runs synchronously in a child run, and its outputs become the outputs of this step.
+func (r *Runner) executeCallWorkflowStep(ctx context.Context, step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
+	fail := func(err error) (StepResult, error) {
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   time.Now(),
+		}, err
+	}
+
+	params, err := parseCallWorkflowParams(step.With)
+	if err != nil {
+		return fail(err)
+	}
+
+	callInputs := make(map[string]string, len(params.Inputs))
+	for name, value := range params.Inputs {
+		expanded, err := r.expandTemplate(value, inputs, stepOutputs)
+		if err != nil {
+			return fail(fmt.Errorf("failed to expand input '%s': %v", name, err))
+		}
+		callInputs[name] = expanded
+	}
+
+	slog.Info("calling workflow", "workflow", params.Workflow, "repository", params.Repository)
+
+	var result *interfaces.ExecutionResult
+	if params.Repository == "" {
+		result, err = r.callLocalWorkflow(ctx, params.Workflow, callInputs, workDir)
+	} else {
+		callCtx := withProvenanceTrigger(ctx, ProvenanceTrigger{Type: ProvenanceTriggerCall})
+		result, err = r.childWorkflowRunner.ExecuteWorkflow(callCtx, params.Repository, params.Workflow, callInputs)
+	}
+	if err == nil && result != nil && !result.Success {
+		err = result.Error
+		if err == nil {
+			err = fmt.Errorf("workflow did not succeed")
+		}
+	}
+	if err != nil {
+		stepResult, stepErr := fail(fmt.Errorf("called workflow '%s' failed: %w", params.Workflow, err))
+		if result != nil {
+			stepResult.Outputs = calledWorkflowOutputs(result)
+		}
+		return stepResult, stepErr
+	}
+
+	output := fmt.Sprintf("Called workflow '%s' (run %s): %d steps executed", params.Workflow, result.RunID, len(result.Steps))
+	outputs := calledWorkflowOutputs(result)
+	r.state.CompleteStep(stepID, output, outputs)
+
+	return StepResult{
+		ID:        stepID,
+		Success:   true,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+		Output:    output,
+		Outputs:   outputs,
+	}, nil
+}
+
+// callLocalWorkflow runs a workflow of the current repository in a child run, in the same
+// working directory so the called workflow sees the changes made by the caller.
+func (r *Runner) callLocalWorkflow(ctx context.Context, workflowName string, inputs map[string]string, workDir string) (*interfaces.ExecutionResult, error) {
+	childRunner, childWorkspace, err := r.childRunnerFactory.CreateChildRunner()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create child runner: %w", err)
+	}
+	childRunner.trigger = ProvenanceTrigger{Type: ProvenanceTriggerCall}
+
+	childRunID := childRunner.GetRunID()
+	if err := r.state.AddChildRun(childRunID); err != nil {
+		slog.Warn("failed to record called workflow run", "run_id", childRunID, "error", err)
+	}
+
+	result, err := childRunner.ExecuteWorkflow(ctx, workflowName, inputs, workDir)
+
+	if closeErr := childRunner.Close(); closeErr != nil {
+		slog.Warn("failed to close child runner", "run_id", childRunID, "error", closeErr)
+	}
+	succeeded := err == nil && result != nil && result.Success
+	if kept, cleanErr := r.childRunnerFactory.ReleaseChildWorkspace(childRunID, succeeded); cleanErr != nil {
+		slog.Warn("failed to cleanup child workspace", "path", childWorkspace, "error", cleanErr)
+	} else if kept {
+		slog.Info("keeping workspace of failed called workflow", "run_id", childRunID, "path", childWorkspace)
+	}
+
+	return result, err
+}
+
+// calledWorkflowOutputs returns the outputs declared by a called workflow. For workflows that
+// declare none, it merges the outputs of their steps in execution order, so that when several
+// steps produce the same output, the last one wins.
+func calledWorkflowOutputs(result *interfaces.ExecutionResult) map[string]string {
+	if result.Outputs != nil {
+		return result.Outputs
+	}
+	outputs := make(map[string]string)
+	for _, step := range result.Steps {
+		for name, value := range step.Outputs {
+			outputs[name] = value
+		}
+	}
+	return outputs
+}
@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newCallWorkflowRunner writes a tako.yml with the given workflows and returns a runner for it.
+func newCallWorkflowRunner(t *testing.T, workflows string) (*Runner, string) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	repoDir := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("Failed to create repository directory: %v", err)
+	}
+	content := "version: 0.1.0\nworkflows:\n" + workflows
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	t.Cleanup(func() { runner.Close() })
+
+	return runner, repoDir
+}
+
+func TestParseCallWorkflowParams(t *testing.T) {
+	tests := []struct {
+		name    string
+		with    map[string]interface{}
+		wantErr string
+	}{
+		{"workflow only", map[string]interface{}{"workflow": "build"}, ""},
+		{"repository and inputs", map[string]interface{}{"workflow": "build", "repository": "org/shared:v1", "inputs": map[string]interface{}{"count": 3}}, ""},
+		{"missing workflow", map[string]interface{}{}, "workflow is required"},
+		{"empty repository", map[string]interface{}{"workflow": "build", "repository": ""}, "repository must be a non-empty string"},
+		{"inputs not a map", map[string]interface{}{"workflow": "build", "inputs": "x"}, "inputs must be a map"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parseCallWorkflowParams(tt.with)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if params.Workflow != "build" {
+					t.Errorf("Expected workflow 'build', got %q", params.Workflow)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRunnerCallWorkflow(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  build:
+    inputs:
+      version:
+        type: string
+        required: true
+    steps:
+      - id: compile
+        run: echo "artifact-{{ .Inputs.version }}"
+        produces:
+          outputs:
+            artifact: from_stdout
+  release:
+    steps:
+      - id: call
+        uses: tako/call-workflow@v1
+        with:
+          workflow: build
+          inputs:
+            version: "{{ .Inputs.version }}"
+      - id: publish
+        run: echo "publishing {{ .Steps.call.artifact }}"
+        produces:
+          outputs:
+            message: from_stdout
+`)
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", map[string]string{"version": "1.2.3"}, repoDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	if artifact := result.Steps[0].Outputs["artifact"]; artifact != "artifact-1.2.3" {
+		t.Errorf("Expected the outputs of the called workflow, got %q", artifact)
+	}
+	if message := result.Steps[1].Outputs["message"]; message != "publishing artifact-1.2.3" {
+		t.Errorf("Expected the called outputs to be visible to later steps, got %q", message)
+	}
+	if children := runner.state.ChildRuns; len(children) != 1 {
+		t.Errorf("Expected the called workflow to be recorded as a child run, got %v", children)
+	}
+}
+
+func TestRunnerCallWorkflowDeclaredOutputs(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  build:
+    outputs:
+      artifact: "{{ .Steps.package.name }}"
+    steps:
+      - id: compile
+        run: echo compiled
+        produces:
+          outputs:
+            log: from_stdout
+      - id: package
+        run: echo app.tar.gz
+        produces:
+          outputs:
+            name: from_stdout
+  release:
+    steps:
+      - id: call
+        uses: tako/call-workflow@v1
+        with:
+          workflow: build
+`)
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	outputs := result.Steps[0].Outputs
+	if len(outputs) != 1 || outputs["artifact"] != "app.tar.gz" {
+		t.Errorf("Expected only the declared outputs of the called workflow, got %v", outputs)
+	}
+}
+
+func TestRunnerCallWorkflowFromRepository(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    steps:
+      - id: call
+        uses: tako/call-workflow@v1
+        with:
+          workflow: shared-build
+          repository: test-org/templates:v2
+`)
+
+	sharedDir := filepath.Join(runner.cacheDir, "repos", "test-org", "templates", "v2")
+	if err := os.MkdirAll(sharedDir, 0755); err != nil {
+		t.Fatalf("Failed to create cached repository: %v", err)
+	}
+	shared := `version: 0.1.0
+workflows:
+  shared-build:
+    steps:
+      - id: build
+        run: echo from-templates
+        produces:
+          outputs:
+            origin: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(sharedDir, "tako.yml"), []byte(shared), 0644); err != nil {
+		t.Fatalf("Failed to create cached tako.yml: %v", err)
+	}
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if origin := result.Steps[0].Outputs["origin"]; origin != "from-templates" {
+		t.Errorf("Expected outputs of the workflow at the pinned ref, got %q", origin)
+	}
+}
+
+func TestRunnerCallWorkflowFailure(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  broken:
+    steps:
+      - run: exit 3
+  release:
+    steps:
+      - id: call
+        uses: tako/call-workflow@v1
+        with:
+          workflow: broken
+      - id: after
+        run: echo unreachable
+`)
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err == nil {
+		t.Fatal("Expected the workflow to fail")
+	}
+	if !strings.Contains(err.Error(), "called workflow 'broken' failed") {
+		t.Errorf("Expected the called workflow failure in the error, got %v", err)
+	}
+	if len(result.Steps) != 1 || result.Steps[0].Success {
+		t.Errorf("Expected only the failed call step, got %+v", result.Steps)
+	}
+}
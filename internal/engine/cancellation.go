@@ -0,0 +1,183 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrRunCancelled is the cause of contexts cancelled because a run was cancelled.
+var ErrRunCancelled = errors.New("run was cancelled")
+
+// defaultCancellationPollInterval is how often running executions check for cancellation markers.
+const defaultCancellationPollInterval = 500 * time.Millisecond
+
+// CancellationRequest is the marker persisted when a run is cancelled.
+type CancellationRequest struct {
+	RunID       string    `json:"run_id"`
+	Reason      string    `json:"reason,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+}
+
+// CancellationManager persists cancellation markers for runs.
+// Markers live in the shared cache directory, so that runners, fan-out executors and child
+// runners in any process sharing the cache observe the cancellation of a run.
+type CancellationManager struct {
+	dir          string
+	pollInterval time.Duration
+}
+
+// NewCancellationManager creates a cancellation manager storing markers under cacheDir.
+func NewCancellationManager(cacheDir string) (*CancellationManager, error) {
+	dir := filepath.Join(cacheDir, "cancellations")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cancellation directory: %v", err)
+	}
+
+	return &CancellationManager{
+		dir:          dir,
+		pollInterval: defaultCancellationPollInterval,
+	}, nil
+}
+
+// SetPollInterval sets how often watched runs check for cancellation markers.
+func (cm *CancellationManager) SetPollInterval(interval time.Duration) {
+	if interval > 0 {
+		cm.pollInterval = interval
+	}
+}
+
+// RequestCancellation records that a run, and every run it started, should stop.
+func (cm *CancellationManager) RequestCancellation(runID, reason string) error {
+	if err := validateCancellationRunID(runID); err != nil {
+		return err
+	}
+
+	request := CancellationRequest{
+		RunID:       runID,
+		Reason:      reason,
+		RequestedAt: time.Now(),
+	}
+	data, err := json.MarshalIndent(request, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal cancellation request: %v", err)
+	}
+
+	// Write to temporary file first, then atomic rename
+	markerFile := cm.markerPath(runID)
+	tempFile := markerFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cancellation marker: %v", err)
+	}
+	if err := os.Rename(tempFile, markerFile); err != nil {
+		os.Remove(tempFile) // Clean up on failure
+		return fmt.Errorf("failed to write cancellation marker: %v", err)
+	}
+
+	return nil
+}
+
+// GetCancellation returns the cancellation request of a run, or nil if it was not cancelled.
+func (cm *CancellationManager) GetCancellation(runID string) (*CancellationRequest, error) {
+	if validateCancellationRunID(runID) != nil {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(cm.markerPath(runID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cancellation marker: %v", err)
+	}
+
+	var request CancellationRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return nil, fmt.Errorf("failed to parse cancellation marker: %v", err)
+	}
+	return &request, nil
+}
+
+// IsCancelled reports whether cancellation was requested for any of the given runs.
+func (cm *CancellationManager) IsCancelled(runIDs ...string) bool {
+	for _, runID := range runIDs {
+		if request, _ := cm.GetCancellation(runID); request != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// ClearCancellation removes the cancellation marker of a run, if any.
+func (cm *CancellationManager) ClearCancellation(runID string) error {
+	if err := validateCancellationRunID(runID); err != nil {
+		return err
+	}
+	if err := os.Remove(cm.markerPath(runID)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove cancellation marker: %v", err)
+	}
+	return nil
+}
+
+// Watch returns a context that is cancelled with ErrRunCancelled as soon as cancellation is
+// requested for any of the given runs. Empty run IDs are ignored. The returned function
+// stops watching and must be called once the work is done.
+func (cm *CancellationManager) Watch(ctx context.Context, runIDs ...string) (context.Context, context.CancelFunc) {
+	watched := make([]string, 0, len(runIDs))
+	for _, runID := range runIDs {
+		if runID != "" {
+			watched = append(watched, runID)
+		}
+	}
+
+	watchCtx, cancel := context.WithCancelCause(ctx)
+	if cm.IsCancelled(watched...) {
+		cancel(ErrRunCancelled)
+		return watchCtx, func() { cancel(context.Canceled) }
+	}
+
+	go func() {
+		ticker := time.NewTicker(cm.pollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-watchCtx.Done():
+				return
+			case <-ticker.C:
+				if cm.IsCancelled(watched...) {
+					cancel(ErrRunCancelled)
+					return
+				}
+			}
+		}
+	}()
+
+	return watchCtx, func() { cancel(context.Canceled) }
+}
+
+// IsRunCancelled reports whether a context was cancelled because its run was cancelled.
+func IsRunCancelled(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrRunCancelled)
+}
+
+// markerPath returns the path of the cancellation marker of a run.
+func (cm *CancellationManager) markerPath(runID string) string {
+	return filepath.Join(cm.dir, runID+".json")
+}
+
+// validateCancellationRunID rejects run IDs that cannot be used as marker file names.
+func validateCancellationRunID(runID string) error {
+	if runID == "" {
+		return fmt.Errorf("run ID is required")
+	}
+	if strings.ContainsAny(runID, `/\`) || runID == "." || runID == ".." {
+		return fmt.Errorf("invalid run ID: %s", runID)
+	}
+	return nil
+}
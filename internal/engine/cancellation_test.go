@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+func TestCancellationManager_Markers(t *testing.T) {
+	cm, err := NewCancellationManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create cancellation manager: %v", err)
+	}
+
+	if cm.IsCancelled("exec-1") {
+		t.Fatal("Expected run not to be cancelled")
+	}
+
+	if err := cm.RequestCancellation("exec-1", "bad release"); err != nil {
+		t.Fatalf("RequestCancellation failed: %v", err)
+	}
+	if !cm.IsCancelled("exec-0", "exec-1") {
+		t.Error("Expected run to be cancelled")
+	}
+
+	request, err := cm.GetCancellation("exec-1")
+	if err != nil {
+		t.Fatalf("GetCancellation failed: %v", err)
+	}
+	if request == nil || request.RunID != "exec-1" || request.Reason != "bad release" {
+		t.Errorf("Unexpected cancellation request: %+v", request)
+	}
+
+	if err := cm.ClearCancellation("exec-1"); err != nil {
+		t.Fatalf("ClearCancellation failed: %v", err)
+	}
+	if cm.IsCancelled("exec-1") {
+		t.Error("Expected cancellation to be cleared")
+	}
+
+	for _, runID := range []string{"", "../escape", "a/b", ".."} {
+		if err := cm.RequestCancellation(runID, ""); err == nil {
+			t.Errorf("Expected RequestCancellation(%q) to fail", runID)
+		}
+	}
+}
+
+func TestCancellationManager_Watch(t *testing.T) {
+	cm, err := NewCancellationManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create cancellation manager: %v", err)
+	}
+	cm.SetPollInterval(10 * time.Millisecond)
+
+	ctx, stop := cm.Watch(context.Background(), "exec-child", "", "exec-parent")
+	defer stop()
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("Expected context not to be cancelled yet")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := cm.RequestCancellation("exec-parent", ""); err != nil {
+		t.Fatalf("RequestCancellation failed: %v", err)
+	}
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(2 * time.Second):
+		t.Fatal("Expected context to be cancelled after the parent was cancelled")
+	}
+	if !IsRunCancelled(ctx) {
+		t.Errorf("Expected cancellation cause, got %v", context.Cause(ctx))
+	}
+
+	// Stopping a watch is not a run cancellation
+	other, stopOther := cm.Watch(context.Background(), "exec-other")
+	stopOther()
+	if IsRunCancelled(other) {
+		t.Error("Expected stopped watch not to report a run cancellation")
+	}
+}
+
+func TestRunnerCancellation(t *testing.T) {
+	tempDir := t.TempDir()
+
+	content := `version: 0.1.0
+workflows:
+  slow:
+    steps:
+      - id: wait
+        run: sleep 30
+      - id: after
+        run: echo "after"
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      cacheDir,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	cancellations, err := NewCancellationManager(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create cancellation manager: %v", err)
+	}
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		cancellations.RequestCancellation(runner.GetRunID(), "stop")
+	}()
+
+	start := time.Now()
+	result, err := runner.ExecuteWorkflow(context.Background(), "slow", nil, tempDir)
+	if !errors.Is(err, ErrRunCancelled) {
+		t.Fatalf("Expected a cancellation error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the running step to be killed, took %v", elapsed)
+	}
+	if result.Success || len(result.Steps) != 1 {
+		t.Errorf("Expected only the cancelled step to run, got %+v", result.Steps)
+	}
+
+	state := runner.state
+	if state.GetStatus() != StatusCancelled || state.Error != "cancelled: stop" {
+		t.Errorf("Expected cancelled state with reason, got %s (%s)", state.GetStatus(), state.Error)
+	}
+	if state.GetStepStatus("wait") != StatusCancelled {
+		t.Errorf("Expected the running step to be cancelled, got %s", state.GetStepStatus("wait"))
+	}
+	if cancellations.IsCancelled(runner.GetRunID()) {
+		t.Error("Expected the cancellation marker to be cleared once the run stopped")
+	}
+}
+
+func TestFanOutExecutor_CancelledBeforeChildrenStart(t *testing.T) {
+	cacheDir := t.TempDir()
+	runner := &orderRecordingWorkflowRunner{}
+	executor, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetLockOwner("exec-parent", "")
+
+	if err := executor.cancellations.RequestCancellation("exec-parent", ""); err != nil {
+		t.Fatalf("RequestCancellation failed: %v", err)
+	}
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type":        "library_built",
+			"wait_for_children": true,
+		},
+	}
+	subscriptions := []interfaces.SubscriptionMatch{
+		{Repository: "test-org/app", Subscription: config.Subscription{Artifact: "source-org/library:default", Events: []string{"library_built"}, Workflow: "update-app"}},
+		{Repository: "test-org/lib", Subscription: config.Subscription{Artifact: "source-org/library:default", Events: []string{"library_built"}, Workflow: "update-lib"}},
+	}
+
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if !result.Cancelled || result.Success {
+		t.Errorf("Expected a cancelled, unsuccessful fan-out, got %+v", result)
+	}
+	if len(runner.order) != 0 {
+		t.Errorf("Expected no children to start, got %v", runner.order)
+	}
+	if result.ChildrenSummary == nil || result.ChildrenSummary.CancelledChildren != 2 || result.ChildrenSummary.Status != FanOutStatusCancelled {
+		t.Errorf("Expected 2 cancelled children in a cancelled fan-out, got %+v", result.ChildrenSummary)
+	}
+}
+
+func TestFanOutExecutor_CancelledWhileChildrenRun(t *testing.T) {
+	runner := &blockingWorkflowRunner{}
+	runner.running.Add(2)
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetLockOwner("exec-parent", "")
+
+	// Cancel once the children of the concurrency limit are running
+	go func() {
+		runner.running.Wait()
+		if err := executor.cancellations.RequestCancellation("exec-parent", ""); err != nil {
+			t.Errorf("RequestCancellation failed: %v", err)
+		}
+	}()
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type":        "library_built",
+			"wait_for_children": true,
+			"concurrency_limit": 2,
+		},
+	}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(4))
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if !result.Cancelled || result.Success {
+		t.Errorf("Expected a cancelled, unsuccessful fan-out, got %+v", result)
+	}
+	if result.ChildrenSummary == nil || result.ChildrenSummary.CancelledChildren != 4 {
+		t.Errorf("Expected the running and the remaining children to be cancelled, got %+v", result.ChildrenSummary)
+	}
+	if !strings.Contains(strings.Join(result.Errors, "\n"), "fan-out cancelled: 2 children were not started") {
+		t.Errorf("Expected the children not started to be reported, got %v", result.Errors)
+	}
+}
@@ -0,0 +1,124 @@
+package engine
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+)
+
+// celFunctionLibrary returns the functions available to every CEL expression evaluated by tako:
+// subscription filters and step if: conditions.
+//
+// Besides the CEL standard library, expressions can use:
+//   - semver.major(v), semver.minor(v), semver.patch(v) returning the version components as int.
+//   - semver.compare(a, b) returning -1, 0 or 1.
+//   - semver.valid(v) reporting whether v is a semantic version.
+//   - semver.satisfies(v, range) checking v against a range such as ^1.0.0 or ">=1.0.0 <2.0.0".
+//   - time.parse(value) parsing an RFC 3339 timestamp, and time.parse(value, layout) using a Go layout.
+//   - time.now() returning the current time, as told by now; the system time when now is nil.
+//   - the regex.* functions (regex.replace, regex.extract, regex.extractAll) and the string
+//     helpers (lowerAscii, upperAscii, trim, split, replace, ...) of the CEL extension libraries.
+//
+// Versions may carry a leading "v"; pre-release and build suffixes are ignored.
+func celFunctionLibrary(now func() time.Time) []cel.EnvOption {
+	if now == nil {
+		now = time.Now
+	}
+	return []cel.EnvOption{
+		ext.Strings(),
+		cel.OptionalTypes(),
+		ext.Regex(),
+		cel.Function("semver.major",
+			cel.Overload("semver_major_string", []*cel.Type{cel.StringType}, cel.IntType,
+				cel.UnaryBinding(semverComponent(func(v SemVer) int { return v.Major })))),
+		cel.Function("semver.minor",
+			cel.Overload("semver_minor_string", []*cel.Type{cel.StringType}, cel.IntType,
+				cel.UnaryBinding(semverComponent(func(v SemVer) int { return v.Minor })))),
+		cel.Function("semver.patch",
+			cel.Overload("semver_patch_string", []*cel.Type{cel.StringType}, cel.IntType,
+				cel.UnaryBinding(semverComponent(func(v SemVer) int { return v.Patch })))),
+		cel.Function("semver.compare",
+			cel.Overload("semver_compare_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.IntType,
+				cel.BinaryBinding(semverCompare))),
+		cel.Function("semver.valid",
+			cel.Overload("semver_valid_string", []*cel.Type{cel.StringType}, cel.BoolType,
+				cel.UnaryBinding(semverValid))),
+		cel.Function("semver.satisfies",
+			cel.Overload("semver_satisfies_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(semverSatisfies))),
+		cel.Function("time.parse",
+			cel.Overload("time_parse_string", []*cel.Type{cel.StringType}, cel.TimestampType,
+				cel.UnaryBinding(func(value ref.Val) ref.Val {
+					return timeParse(value, types.String(time.RFC3339))
+				})),
+			cel.Overload("time_parse_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.TimestampType,
+				cel.BinaryBinding(timeParse))),
+		cel.Function("time.now",
+			cel.Overload("time_now", []*cel.Type{}, cel.TimestampType,
+				cel.FunctionBinding(func(...ref.Val) ref.Val {
+					return types.Timestamp{Time: now().UTC()}
+				}))),
+	}
+}
+
+// parseLooseSemVer parses a semantic version, accepting a leading "v" and ignoring any
+// pre-release or build suffix.
+func parseLooseSemVer(version string) (SemVer, error) {
+	core := strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(core, "-+"); i >= 0 {
+		core = core[:i]
+	}
+	return parseSemVer(core)
+}
+
+// semverComponent returns a CEL binding that extracts one component of a version.
+func semverComponent(component func(SemVer) int) func(ref.Val) ref.Val {
+	return func(value ref.Val) ref.Val {
+		version, err := parseLooseSemVer(string(value.(types.String)))
+		if err != nil {
+			return types.NewErr("%v", err)
+		}
+		return types.Int(component(version))
+	}
+}
+
+func semverCompare(lhs, rhs ref.Val) ref.Val {
+	v1, err := parseLooseSemVer(string(lhs.(types.String)))
+	if err != nil {
+		return types.NewErr("%v", err)
+	}
+	v2, err := parseLooseSemVer(string(rhs.(types.String)))
+	if err != nil {
+		return types.NewErr("%v", err)
+	}
+	return types.Int(compareVersions(v1, v2))
+}
+
+func semverValid(value ref.Val) ref.Val {
+	_, err := parseLooseSemVer(string(value.(types.String)))
+	return types.Bool(err == nil)
+}
+
+func semverSatisfies(value, rangeSpec ref.Val) ref.Val {
+	version, err := parseLooseSemVer(string(value.(types.String)))
+	if err != nil {
+		return types.NewErr("%v", err)
+	}
+	satisfied, err := evaluateVersionRange(version, string(rangeSpec.(types.String)))
+	if err != nil {
+		return types.NewErr("%v", err)
+	}
+	return types.Bool(satisfied)
+}
+
+func timeParse(value, layout ref.Val) ref.Val {
+	parsed, err := time.Parse(string(layout.(types.String)), string(value.(types.String)))
+	if err != nil {
+		return types.NewErr("invalid time '%s': %v", string(value.(types.String)), err)
+	}
+	return types.Timestamp{Time: parsed}
+}
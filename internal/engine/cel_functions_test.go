@@ -0,0 +1,118 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCELFunctionLibrary(t *testing.T) {
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	event := Event{
+		Type: "library_built",
+		Payload: map[string]interface{}{
+			"version":    "v2.3.4-rc.1",
+			"branch":     "release/2.3",
+			"created_at": "2025-01-02T15:04:05Z",
+		},
+	}
+
+	tests := []struct {
+		name    string
+		filter  string
+		want    bool
+		wantErr bool
+	}{
+		{"semver major", "semver.major(payload.version) == 2", true, false},
+		{"semver minor and patch", "semver.minor(payload.version) == 3 && semver.patch(payload.version) == 4", true, false},
+		{"semver compare", "semver.compare(payload.version, '2.10.0') < 0", true, false},
+		{"semver compare equal", "semver.compare('1.0.0', 'v1.0.0') == 0", true, false},
+		{"semver valid", "semver.valid(payload.version) && !semver.valid('latest')", true, false},
+		{"semver satisfies", "semver.satisfies(payload.version, '^2.0.0')", true, false},
+		{"semver satisfies range", "semver.satisfies(payload.version, '>=3.0.0 <4.0.0')", false, false},
+		{"semver invalid version", "semver.major('latest') > 0", false, true},
+		{"regex matches", "payload.branch.matches('^release/')", true, false},
+		{"regex extract", "regex.extract(payload.branch, 'release/(.*)') == optional.of('2.3')", true, false},
+		{"regex replace", "regex.replace(payload.branch, '/', '-') == 'release-2.3'", true, false},
+		{"string helpers", "payload.branch.upperAscii().startsWith('RELEASE') && payload.branch.split('/').size() == 2", true, false},
+		{"time parse", "time.parse(payload.created_at) < time.parse('2025-06-01T00:00:00Z')", true, false},
+		{"time parse layout", "time.parse('2025-01-02', '2006-01-02').getFullYear() == 2025", true, false},
+		{"time now", "time.now() > time.parse(payload.created_at)", true, false},
+		{"time invalid", "time.parse('yesterday') < time.now()", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluator.evaluateCELFilter(tt.filter, event)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evaluateCELFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateCELFilter(%q) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCELFunctionLibrary_TimeNowReadsTheClock(t *testing.T) {
+	clock := NewFakeClock(time.Date(2025, 1, 2, 15, 0, 0, 0, time.UTC))
+	event := Event{Type: "library_built", Payload: map[string]interface{}{"created_at": "2025-01-02T15:04:05Z"}}
+	filter := "time.now() > time.parse(payload.created_at)"
+
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+	evaluator.SetClock(clock)
+	if got, err := evaluator.evaluateCELFilter(filter, event); err != nil || got {
+		t.Errorf("expected the filter to read the fake time, got %v, %v", got, err)
+	}
+	// The compiled program is cached, and reads the clock when it is evaluated
+	clock.Advance(time.Hour)
+	if got, err := evaluator.evaluateCELFilter(filter, event); err != nil || !got {
+		t.Errorf("expected the filter to read the advanced time, got %v, %v", got, err)
+	}
+
+	conditions, err := NewConditionEvaluator()
+	if err != nil {
+		t.Fatalf("NewConditionEvaluator() error = %v", err)
+	}
+	conditions.SetClock(clock)
+	if got, err := conditions.Evaluate("time.now() == time.parse('2025-01-02T16:00:00Z')", nil, nil); err != nil || !got {
+		t.Errorf("expected the condition to read the fake time, got %v, %v", got, err)
+	}
+
+	rollout := &RolloutConfig{Gate: "time.now().getHours() == 16"}
+	if got, err := rollout.evaluateRolloutGate(1, 2, rolloutStats{}, rolloutStats{}, clock.Now); err != nil || !got {
+		t.Errorf("expected the rollout gate to read the fake time, got %v, %v", got, err)
+	}
+}
+
+func TestParseLooseSemVer(t *testing.T) {
+	tests := []struct {
+		version string
+		want    SemVer
+		wantErr bool
+	}{
+		{"1.2.3", SemVer{1, 2, 3}, false},
+		{"v1.2.3", SemVer{1, 2, 3}, false},
+		{"1.2.3-beta.1", SemVer{1, 2, 3}, false},
+		{"1.2.3+build.5", SemVer{1, 2, 3}, false},
+		{"1.2", SemVer{}, true},
+		{"", SemVer{}, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseLooseSemVer(tt.version)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseLooseSemVer(%q) error = %v, wantErr %v", tt.version, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseLooseSemVer(%q) = %v, want %v", tt.version, got, tt.want)
+		}
+	}
+}
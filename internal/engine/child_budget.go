@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// DefaultMaxTotalChildren is how many child workflows the fan-outs of an execution tree can
+// trigger in total, unless the root run sets another cap.
+const DefaultMaxTotalChildren = 200
+
+// ErrChildBudgetExceeded is returned when a fan-out would trigger more child workflows than the
+// budget of its execution tree has left.
+var ErrChildBudgetExceeded = errors.New("child workflow budget exceeded")
+
+const (
+	childBudgetLockTimeout = 10 * time.Second
+	childBudgetStaleLock   = time.Minute
+)
+
+// ChildBudget is the count of the child workflows triggered by an execution tree, against its cap.
+type ChildBudget struct {
+	CorrelationID string    `json:"correlation_id"`
+	Limit         int       `json:"limit"`
+	Triggered     int       `json:"triggered"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ChildBudgetStore keeps the budgets of execution trees in the shared cache, so that the
+// processes running the runs of a tree draw from the same budget.
+type ChildBudgetStore struct {
+	dir string
+}
+
+// NewChildBudgetStore creates the store of the budgets under a cache directory.
+func NewChildBudgetStore(cacheDir string) (*ChildBudgetStore, error) {
+	dir := filepath.Join(cacheDir, "budgets")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create budget directory: %v", err)
+	}
+	return &ChildBudgetStore{dir: dir}, nil
+}
+
+// Reserve draws n child workflows from the budget of an execution tree, all or none. The first
+// reservation of a tree sets its limit, DefaultMaxTotalChildren when zero, so that the cap of
+// the root run holds for its whole tree.
+func (s *ChildBudgetStore) Reserve(correlationID string, limit, n int) (*ChildBudget, error) {
+	if limit <= 0 {
+		limit = DefaultMaxTotalChildren
+	}
+	unlock, err := s.lock(correlationID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	budget, err := s.Get(correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if budget == nil {
+		budget = &ChildBudget{CorrelationID: correlationID, Limit: limit}
+	}
+	if budget.Triggered+n > budget.Limit {
+		return budget, fmt.Errorf("%w: the execution tree %s already triggered %d of its max_total_children of %d, and a fan-out would trigger %d more",
+			ErrChildBudgetExceeded, correlationID, budget.Triggered, budget.Limit, n)
+	}
+	budget.Triggered += n
+	budget.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(budget, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal budget: %v", err)
+	}
+	// Write to temporary file first, then atomic rename
+	budgetFile := s.path(correlationID)
+	tempFile := budgetFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save budget: %v", err)
+	}
+	if err := os.Rename(tempFile, budgetFile); err != nil {
+		os.Remove(tempFile) // Clean up on failure
+		return nil, fmt.Errorf("failed to save budget: %v", err)
+	}
+	return budget, nil
+}
+
+// Get returns the budget of an execution tree, or nil when none of its fan-outs triggered children.
+func (s *ChildBudgetStore) Get(correlationID string) (*ChildBudget, error) {
+	data, err := os.ReadFile(s.path(correlationID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read budget: %v", err)
+	}
+	var budget ChildBudget
+	if err := json.Unmarshal(data, &budget); err != nil {
+		return nil, fmt.Errorf("failed to parse budget of %s: %v", correlationID, err)
+	}
+	return &budget, nil
+}
+
+// path returns the file of the budget of a tree. Correlation IDs received with events may hold
+// any character, so only those of run IDs are kept.
+func (s *ChildBudgetStore) path(correlationID string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, correlationID)
+	return filepath.Join(s.dir, name+".json")
+}
+
+// lock acquires the lock file of the budget of a tree, breaking the locks left by crashed processes.
+func (s *ChildBudgetStore) lock(correlationID string) (func(), error) {
+	lockPath := s.path(correlationID) + ".lock"
+	deadline := time.Now().Add(childBudgetLockTimeout)
+	for {
+		file, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			fmt.Fprintf(file, "%d", os.Getpid())
+			file.Close()
+			return func() { os.Remove(lockPath) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to lock budget: %v", err)
+		}
+		if info, err := os.Stat(lockPath); err == nil && time.Since(info.ModTime()) > childBudgetStaleLock {
+			os.Remove(lockPath)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("failed to lock budget: %s is held by another process", lockPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// SetChildBudget sets the store of the budgets of execution trees the fan-outs of the executor
+// draw their children from, and the cap of the tree; DefaultMaxTotalChildren when zero. The
+// children are not budgeted when the store is nil.
+func (fe *FanOutExecutor) SetChildBudget(store *ChildBudgetStore, maxTotalChildren int) {
+	fe.childBudget = store
+	fe.maxTotalChildren = maxTotalChildren
+}
+
+// reserveChildBudget draws the children a fan-out triggers from the budget of its execution tree.
+func (fe *FanOutExecutor) reserveChildBudget(n int) error {
+	if fe.childBudget == nil || fe.correlationID == "" || n == 0 {
+		return nil
+	}
+	budget, err := fe.childBudget.Reserve(fe.correlationID, fe.maxTotalChildren, n)
+	if err != nil {
+		return err
+	}
+	fe.logger.Debug("Reserved child workflows from the budget of the execution tree",
+		"correlation_id", fe.correlationID,
+		"triggered", budget.Triggered,
+		"limit", budget.Limit,
+	)
+	return nil
+}
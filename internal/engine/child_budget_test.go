@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestChildBudgetStore_Reserve(t *testing.T) {
+	store, err := NewChildBudgetStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create budget store: %v", err)
+	}
+
+	if _, err := store.Reserve("exec-root", 5, 3); err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	// The limit of the first reservation holds for the tree
+	if _, err := store.Reserve("exec-root", 100, 3); !errors.Is(err, ErrChildBudgetExceeded) {
+		t.Fatalf("expected the budget exceeded, got %v", err)
+	}
+	budget, err := store.Reserve("exec-root", 100, 2)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if budget.Triggered != 5 || budget.Limit != 5 {
+		t.Errorf("expected 5 of 5 children triggered, got %+v", budget)
+	}
+
+	// Other trees have their own budget, the default one unless they set another
+	budget, err = store.Reserve("exec-other", 0, 1)
+	if err != nil {
+		t.Fatalf("Reserve() error = %v", err)
+	}
+	if budget.Limit != DefaultMaxTotalChildren || budget.Triggered != 1 {
+		t.Errorf("expected the default budget, got %+v", budget)
+	}
+}
+
+func TestChildBudgetStore_ConcurrentReservations(t *testing.T) {
+	cacheDir := t.TempDir()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Each process has its own store over the shared cache
+			store, err := NewChildBudgetStore(cacheDir)
+			if err != nil {
+				t.Errorf("Failed to create budget store: %v", err)
+				return
+			}
+			if _, err := store.Reserve("exec-root", 10, 1); err == nil {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			} else if !errors.Is(err, ErrChildBudgetExceeded) {
+				t.Errorf("Reserve() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if granted != 10 {
+		t.Errorf("expected exactly 10 children granted, got %d", granted)
+	}
+}
+
+func TestFanOutExecutor_ChildBudget(t *testing.T) {
+	cacheDir := t.TempDir()
+	store, err := NewChildBudgetStore(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create budget store: %v", err)
+	}
+	runner := NewRecordingWorkflowRunner()
+	executor, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetCorrelationID("exec-root")
+	executor.SetChildBudget(store, 3)
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+
+	if _, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2)); err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2))
+	if !errors.Is(err, ErrChildBudgetExceeded) {
+		t.Fatalf("expected the budget of the tree exceeded, got %v", err)
+	}
+	if result.TriggeredCount != 0 || len(runner.Recorded()) != 2 {
+		t.Errorf("expected only the children of the first fan-out triggered, got %d", len(runner.Recorded()))
+	}
+}
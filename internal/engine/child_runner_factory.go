@@ -17,10 +17,29 @@ type ChildRunnerFactory struct {
 	maxConcurrentRepos  int
 	debug               bool
 	environment         []string
+	parentRunID         string
+	correlationID       string
+	lineage             []string
+	maxFanOutDepth      int
+	maxTotalChildren    int
+	namespace           string
+	containerRuntime    string
+	logs                LogOptions
+	gitManager          *GitManager // Clones repositories missing from the cache; nil to only use the cache
+	faults              *FaultInjector
+	fanOuts             FanOutOptions
+	provenance          ProvenanceOptions
+	clock               Clock
+	revisions           *RevisionLock
 
 	// Cache locking to prevent race conditions
 	cacheLockManager *LockManager
 
+	// Per-run workspace isolation and cleanup
+	workspaces     *WorkspaceManager
+	cleanupManager *CleanupManager
+	affinity       *WorkspaceAffinityStore // Workspaces kept for subscriptions with affinity
+
 	// Synchronization
 	mu sync.RWMutex
 }
@@ -48,6 +67,17 @@ func NewChildRunnerFactory(parentWorkspaceRoot, cacheDir string, maxConcurrentRe
 		return nil, fmt.Errorf("failed to create cache lock manager: %w", err)
 	}
 
+	// Each child run gets its own workspace under the children directory
+	workspaces, err := NewWorkspaceManager(childrenDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace manager: %w", err)
+	}
+
+	affinity, err := NewWorkspaceAffinityStore(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace affinity store: %w", err)
+	}
+
 	return &ChildRunnerFactory{
 		parentWorkspaceRoot: parentWorkspaceRoot,
 		cacheDir:            cacheDir,
@@ -55,6 +85,9 @@ func NewChildRunnerFactory(parentWorkspaceRoot, cacheDir string, maxConcurrentRe
 		debug:               debug,
 		environment:         environment,
 		cacheLockManager:    cacheLockManager,
+		workspaces:          workspaces,
+		affinity:            affinity,
+		cleanupManager:      NewCleanupManager(childrenDir, 0, debug),
 	}, nil
 }
 
@@ -62,21 +95,35 @@ func NewChildRunnerFactory(parentWorkspaceRoot, cacheDir string, maxConcurrentRe
 // Each child gets its own workspace directory but shares the cache directory.
 // Returns the new Runner and its unique workspace path.
 func (f *ChildRunnerFactory) CreateChildRunner() (*Runner, string, error) {
+	return f.CreateChildRunnerContext(context.Background())
+}
+
+// CreateChildRunnerContext creates a child Runner like CreateChildRunner, for the child workflow
+// a fan-out triggers with ctx: the child takes the lineage, correlation ID and trigger the fan-out
+// gives it, instead of those of the parent runner.
+func (f *ChildRunnerFactory) CreateChildRunnerContext(ctx context.Context) (*Runner, string, error) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	// Generate unique run ID for this child
-	childRunID := GenerateRunID()
+	childRunID := NamespacedRunID(GenerateRunID(), f.namespace)
 
 	// Create isolated workspace for this child
-	childWorkspace := filepath.Join(f.parentWorkspaceRoot, "children", childRunID)
-
-	if err := os.MkdirAll(childWorkspace, 0755); err != nil {
-		return nil, "", fmt.Errorf("failed to create child workspace %s: %w", childWorkspace, err)
+	workspace, err := f.workspaces.CreateWorkspace(childRunID, "")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create child workspace for %s: %w", childRunID, err)
 	}
+	childWorkspace := workspace.Path
 
-	// Create RunnerOptions for the child with isolated workspace
+	// Create RunnerOptions for the child with isolated workspace.
+	// The child reuses the workspace run ID so its workspace can be found by run ID.
 	opts := RunnerOptions{
+		RunID:              childRunID,
+		ParentRunID:        f.parentRunID,
+		CorrelationID:      f.correlationID,
+		Lineage:            f.lineage,
+		MaxFanOutDepth:     f.maxFanOutDepth,
+		MaxTotalChildren:   f.maxTotalChildren,
 		WorkspaceRoot:      childWorkspace,
 		CacheDir:           f.cacheDir, // Shared cache directory
 		MaxConcurrentRepos: f.maxConcurrentRepos,
@@ -84,19 +131,180 @@ func (f *ChildRunnerFactory) CreateChildRunner() (*Runner, string, error) {
 		Debug:              f.debug,
 		NoCache:            false, // Use cache for efficiency
 		Environment:        f.environment,
+		Namespace:          f.namespace,
+
+		KeepWorkspaceOnFailure: f.cleanupManager.KeepOnFailure(),
+		ContainerRuntime:       f.containerRuntime,
+		Logs:                   f.logs,
+		Report:                 ReportOptions{Format: ReportFormatNone}, // The report of the parent covers its children
+		Faults:                 f.faults,                                // Faults are counted across the execution tree
+		FanOuts:                f.fanOuts,
+		Clock:                  f.clock,
+		Revisions:              f.revisions, // Revisions are recorded across the execution tree
+		Provenance:             f.provenance,
+	}
+	if f.gitManager != nil {
+		opts.Git = f.gitManager.Options()
+	}
+	if lineage, ok := lineageFromContext(ctx); ok {
+		opts.Lineage = lineage
+	}
+	if correlationID, ok := correlationIDFromContext(ctx); ok {
+		opts.CorrelationID = correlationID
 	}
 
 	// Create the child Runner instance
 	childRunner, err := NewRunner(opts)
 	if err != nil {
 		// Clean up the workspace if Runner creation fails
-		os.RemoveAll(childWorkspace)
+		f.workspaces.CleanupWorkspace(childRunID)
 		return nil, "", fmt.Errorf("failed to create child runner: %w", err)
 	}
+	if trigger, ok := provenanceTriggerFromContext(ctx); ok {
+		childRunner.trigger = trigger
+	}
 
 	return childRunner, childWorkspace, nil
 }
 
+// SetParentRunID sets the run ID of the parent runner, which child runners record
+// as their parent so execution trees and lock wait-for graphs can be linked.
+func (f *ChildRunnerFactory) SetParentRunID(runID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.parentRunID = runID
+}
+
+// SetCorrelationID sets the correlation ID of the execution tree of the parent runner, which
+// child runners share.
+func (f *ChildRunnerFactory) SetCorrelationID(correlationID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.correlationID = correlationID
+}
+
+// SetLineage sets the lineage of the parent runner, which child runners inherit unless the
+// fan-out triggering them gives them their own, and the maximum fan-out depth of the tree.
+func (f *ChildRunnerFactory) SetLineage(lineage []string, maxFanOutDepth int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.lineage = lineage
+	f.maxFanOutDepth = maxFanOutDepth
+}
+
+// SetMaxTotalChildren sets the cap of the child workflows of the execution tree, which child
+// runners share.
+func (f *ChildRunnerFactory) SetMaxTotalChildren(maxTotalChildren int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.maxTotalChildren = maxTotalChildren
+}
+
+// SetNamespace sets the namespace of the parent runner, which child runners belong to.
+func (f *ChildRunnerFactory) SetNamespace(namespace string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.namespace = namespace
+}
+
+// SetFanOutOptions sets the options of the fan-outs of child runners, inherited from the parent
+// runner.
+func (f *ChildRunnerFactory) SetFanOutOptions(opts FanOutOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.fanOuts = opts
+}
+
+// SetFaultInjector sets the faults injected into child runners, shared with the parent runner.
+func (f *ChildRunnerFactory) SetFaultInjector(faults *FaultInjector) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.faults = faults
+}
+
+// SetClock sets the clock of child runners and of the cache locks, shared with the parent runner.
+func (f *ChildRunnerFactory) SetClock(clock Clock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.clock = clock
+	f.cacheLockManager.SetClock(clock)
+}
+
+// SetProvenance sets how child runners sign their provenance, shared with the parent runner.
+func (f *ChildRunnerFactory) SetProvenance(opts ProvenanceOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.provenance = opts
+}
+
+// SetRevisionLock sets the revision lock of child runners, shared with the parent runner.
+func (f *ChildRunnerFactory) SetRevisionLock(revisions *RevisionLock) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.revisions = revisions
+}
+
+// SetKeepWorkspaceOnFailure controls whether workspaces of failed child runs are
+// kept on disk for debugging instead of being removed when the child finishes.
+func (f *ChildRunnerFactory) SetKeepWorkspaceOnFailure(keep bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cleanupManager.SetKeepOnFailure(keep)
+}
+
+// SetLogOptions sets the options of the step logs of child runners, so they follow the output
+// of their steps to the same output as their parent.
+func (f *ChildRunnerFactory) SetLogOptions(logs LogOptions) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.logs = logs
+}
+
+// SetContainerRuntime sets the container runtime child runners use, so they run containers
+// with the same runtime as their parent.
+func (f *ChildRunnerFactory) SetContainerRuntime(runtime string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.containerRuntime = runtime
+}
+
+// SetGitManager sets the Git manager used to clone child repositories that are missing from
+// the cache. Child runners are configured with the same Git options.
+func (f *ChildRunnerFactory) SetGitManager(gitManager *GitManager) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.gitManager = gitManager
+}
+
+// ReleaseChildWorkspace finalizes the workspace of a finished child run through the
+// cleanup manager. Returns true if the workspace was kept for debugging.
+func (f *ChildRunnerFactory) ReleaseChildWorkspace(runID string, success bool) (bool, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	kept, err := f.cleanupManager.FinalizeWorkspace(runID, success)
+	if err != nil {
+		return false, err
+	}
+
+	f.workspaces.DetachWorkspace(runID)
+	return kept, nil
+}
+
 // AcquireCacheLock acquires a lock for cache operations to prevent race conditions.
 // The lock is scoped to a specific repository to allow concurrent access to different repos.
 func (f *ChildRunnerFactory) AcquireCacheLock(ctx context.Context, runID, repository string, lockType LockType) error {
@@ -406,6 +406,58 @@ func TestChildRunnerFactory_GetChildrenDirectory(t *testing.T) {
 	}
 }
 
+func TestChildRunnerFactory_ReleaseChildWorkspace(t *testing.T) {
+	tempDir := t.TempDir()
+	parentWorkspace := filepath.Join(tempDir, "parent")
+	cacheDir := filepath.Join(tempDir, "cache")
+
+	factory, err := NewChildRunnerFactory(parentWorkspace, cacheDir, 2, false, nil)
+	if err != nil {
+		t.Fatalf("Failed to create factory: %v", err)
+	}
+	defer factory.Close()
+
+	// The child runner ID must match its workspace so it can be cleaned up by run ID
+	child, workspace, err := factory.CreateChildRunner()
+	if err != nil {
+		t.Fatalf("Failed to create child runner: %v", err)
+	}
+	child.Close()
+	if filepath.Base(workspace) != child.GetRunID() {
+		t.Errorf("Expected workspace %s to be named after run ID %s", workspace, child.GetRunID())
+	}
+
+	kept, err := factory.ReleaseChildWorkspace(child.GetRunID(), false)
+	if err != nil {
+		t.Fatalf("Failed to release child workspace: %v", err)
+	}
+	if kept {
+		t.Error("Workspace should not be kept by default")
+	}
+	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
+		t.Error("Child workspace should be removed")
+	}
+
+	// With keep-on-failure, failed children keep their workspace
+	factory.SetKeepWorkspaceOnFailure(true)
+	failedChild, failedWorkspace, err := factory.CreateChildRunner()
+	if err != nil {
+		t.Fatalf("Failed to create child runner: %v", err)
+	}
+	failedChild.Close()
+
+	kept, err = factory.ReleaseChildWorkspace(failedChild.GetRunID(), false)
+	if err != nil {
+		t.Fatalf("Failed to release child workspace: %v", err)
+	}
+	if !kept {
+		t.Error("Failed child workspace should be kept")
+	}
+	if _, err := os.Stat(failedWorkspace); err != nil {
+		t.Errorf("Failed child workspace should still exist: %v", err)
+	}
+}
+
 // Helper functions for testing
 
 func contains(s, substr string) bool {
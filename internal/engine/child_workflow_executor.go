@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -20,6 +21,7 @@ type ChildWorkflowExecutor struct {
 	templateEngine   *TemplateEngine
 	containerManager *ContainerManager
 	resourceManager  *ResourceManager
+	containerImage   string // When set, steps without an image run in a container; see SetContainerImage
 
 	// Synchronization
 	mu sync.RWMutex
@@ -40,6 +42,16 @@ func NewChildWorkflowExecutor(factory *ChildRunnerFactory, templateEngine *Templ
 	}, nil
 }
 
+// SetContainerImage isolates every step in a container: steps without an image run in the
+// workflow's image, or else in the execution.image of the repository's tako.yml, or else in
+// this image.
+func (e *ChildWorkflowExecutor) SetContainerImage(image string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.containerImage = image
+}
+
 // ExecuteWorkflow executes a workflow in an isolated child environment.
 // It implements the interfaces.WorkflowRunner interface.
 func (e *ChildWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
@@ -60,12 +72,17 @@ func (e *ChildWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, w
 	}
 
 	// Create isolated child runner
-	childRunner, childWorkspace, err := e.factory.CreateChildRunner()
+	childRunner, childWorkspace, err := e.factory.CreateChildRunnerContext(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create child runner: %w", err)
 	}
 
-	// Ensure cleanup of child workspace
+	// Ensure the child workspace is finalized once the workflow finishes.
+	// Workspaces of failed runs may be kept for debugging.
+	childRunID := childRunner.GetRunID()
+	succeeded := false
+	var lease *WorkspaceLease
+	var childRepoPath string
 	defer func() {
 		// Close the runner first
 		if closeErr := childRunner.Close(); closeErr != nil {
@@ -73,17 +90,40 @@ func (e *ChildWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, w
 			fmt.Fprintf(os.Stderr, "warning: failed to close child runner: %v\n", closeErr)
 		}
 
-		// Clean up the workspace directory
-		if cleanErr := e.cleanupWorkspace(childWorkspace); cleanErr != nil {
+		// The workspace of a successful run is kept for the next run of its affinity
+		if lease != nil {
+			if releaseErr := lease.Release(childRepoPath, succeeded); releaseErr != nil {
+				fmt.Fprintf(os.Stderr, "warning: failed to keep workspace of child run %s: %v\n", childRunID, releaseErr)
+			}
+		}
+
+		kept, cleanErr := e.factory.ReleaseChildWorkspace(childRunID, succeeded)
+		if cleanErr != nil {
 			// Log error but don't override the main error
 			fmt.Fprintf(os.Stderr, "warning: failed to cleanup child workspace %s: %v\n", childWorkspace, cleanErr)
+		} else if kept {
+			fmt.Fprintf(os.Stderr, "Keeping workspace of failed child run %s at %s\n", childRunID, childWorkspace)
 		}
 	}()
 
+	// Children with affinity run in the workspace of the previous run of their affinity
+	if affinity, ok := workspaceAffinityFromContext(ctx); ok {
+		if lease, err = e.factory.affinity.Acquire(affinity, repoPath); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to reuse workspace of %s: %v\n", affinity.Repository, err)
+		}
+	}
+	if lease != nil && lease.Warm() != "" {
+		warmRepoPath := filepath.Join(childWorkspace, childRepoDirName(repoPath))
+		if err := os.Rename(lease.Warm(), warmRepoPath); err == nil {
+			childRepoPath = warmRepoPath
+		}
+	}
+
 	// Resolve repository path to child workspace
-	childRepoPath, err := e.resolveChildRepoPath(repoPath, childWorkspace)
-	if err != nil {
-		return nil, fmt.Errorf("failed to resolve child repository path: %w", err)
+	if childRepoPath == "" {
+		if childRepoPath, err = e.resolveChildRepoPath(ctx, repoPath, childWorkspace); err != nil {
+			return nil, fmt.Errorf("failed to resolve child repository path: %w", err)
+		}
 	}
 
 	// Discover tako.yml in the child repository
@@ -96,7 +136,7 @@ func (e *ChildWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, w
 	}
 
 	// Load and validate the configuration
-	cfg, err := config.Load(takoYmlPath)
+	cfg, err := config.LoadWithCache(takoYmlPath, e.factory.cacheDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load tako.yml: %w", err)
 	}
@@ -112,16 +152,51 @@ func (e *ChildWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, w
 		return nil, fmt.Errorf("invalid workflow inputs: %w", err)
 	}
 
+	// The followed output of the child is prefixed with its repository
+	childRunner.repository = childRepositoryName(repoPath)
+
+	// On the container backend, every step runs in a container
+	if e.containerImage != "" {
+		childRunner.containerImage = e.containerImage
+		if cfg.Execution != nil && cfg.Execution.Image != "" {
+			childRunner.containerImage = cfg.Execution.Image
+		}
+		if workflow.Image != "" {
+			childRunner.containerImage = workflow.Image
+		}
+	}
+
 	// Execute the workflow using the child runner
 	result, err := childRunner.ExecuteWorkflow(ctx, workflowName, inputs, childRepoPath)
 	if err != nil {
 		return nil, fmt.Errorf("workflow execution failed: %w", err)
 	}
+	succeeded = result.Success
 
 	// Convert engine.ExecutionResult to interfaces.ExecutionResult
 	return e.convertExecutionResult(result), nil
 }
 
+// childRepositoryName returns the repository of a child repository path: owner/repo for
+// repository references, or the name of the directory of local paths.
+func childRepositoryName(repoPath string) string {
+	if _, err := os.Stat(repoPath); err == nil {
+		return filepath.Base(filepath.Clean(repoPath))
+	}
+	repoName, _, _ := strings.Cut(repoPath, ":")
+	return repoName
+}
+
+// childRepoDirName returns the name of the directory of the child workspace a repository is
+// overlaid into: the name of the directory of local paths, or of the repository of references.
+func childRepoDirName(repoPath string) string {
+	if _, err := os.Stat(repoPath); err == nil {
+		return filepath.Base(filepath.Clean(repoPath))
+	}
+	repoName, _, _ := strings.Cut(repoPath, ":")
+	return path.Base(repoName)
+}
+
 // validateRepoPath validates the repository path to prevent path traversal attacks.
 func (e *ChildWorkflowExecutor) validateRepoPath(repoPath string) error {
 	// Check for path traversal patterns
@@ -143,124 +218,70 @@ func (e *ChildWorkflowExecutor) validateRepoPath(repoPath string) error {
 }
 
 // resolveChildRepoPath resolves the repository path within the child workspace.
-// It handles both local paths and remote repository references.
-func (e *ChildWorkflowExecutor) resolveChildRepoPath(repoPath, childWorkspace string) (string, error) {
+// It handles both local paths and remote repository references. The repository is
+// overlaid into childWorkspace/<repo> so the workflow never runs in the shared cache.
+func (e *ChildWorkflowExecutor) resolveChildRepoPath(ctx context.Context, repoPath, childWorkspace string) (string, error) {
 	// Check if it's a local path
 	if _, err := os.Stat(repoPath); err == nil {
 		// It's a local path, copy it to child workspace
-		childRepoPath := filepath.Join(childWorkspace, "repo")
+		childRepoPath := filepath.Join(childWorkspace, filepath.Base(filepath.Clean(repoPath)))
 		if err := e.copyRepository(repoPath, childRepoPath); err != nil {
 			return "", fmt.Errorf("failed to copy repository: %w", err)
 		}
 		return childRepoPath, nil
 	}
 
-	// It's likely a remote repository reference (owner/repo format)
+	// It's likely a remote repository reference (owner/repo, owner/repo:ref or owner/repo:ref@commit format)
+	repoName, ref, hasRef := strings.Cut(repoPath, ":")
+	ref, commit, _ := strings.Cut(ref, "@")
+	if !hasRef || ref == "" {
+		ref = "main"
+	}
+
 	// Validate the repository format first
-	if !strings.Contains(repoPath, "/") {
+	if !strings.Contains(repoName, "/") {
 		return "", fmt.Errorf("invalid repository format: %s", repoPath)
 	}
 
 	// Parse repository parts
-	repoParts := strings.Split(repoPath, "/")
+	repoParts := strings.Split(repoName, "/")
 	if len(repoParts) < 2 {
 		return "", fmt.Errorf("invalid repository format: %s", repoPath)
 	}
 
-	childRepoPath := filepath.Join(childWorkspace, "repo")
+	childRepoPath := filepath.Join(childWorkspace, repoParts[len(repoParts)-1])
 
-	// Try to find in cache first (assume main branch for now)
-	cachedPath := filepath.Join(e.factory.cacheDir, "repos", repoPath, "main")
-	if _, err := os.Stat(cachedPath); err == nil {
-		// Found in cache, copy it
-		if err := e.copyRepository(cachedPath, childRepoPath); err != nil {
-			return "", fmt.Errorf("failed to copy from cache: %w", err)
-		}
-		return childRepoPath, nil
-	}
-
-	// Not in cache, would need to clone - for now return error
-	return "", fmt.Errorf("repository %s not found in cache", repoPath)
-}
+	// Resolve the clone in the cache, cloning or updating it when a Git manager is set
+	e.factory.mu.RLock()
+	gitManager := e.factory.gitManager
+	e.factory.mu.RUnlock()
 
-// copyRepository copies a repository from source to destination.
-func (e *ChildWorkflowExecutor) copyRepository(src, dst string) error {
-	// Create destination directory
-	if err := os.MkdirAll(dst, 0755); err != nil {
-		return fmt.Errorf("failed to create destination directory: %w", err)
-	}
-
-	if err := os.MkdirAll(dst, 0755); err != nil {
-		return err
-	}
-
-	// For now, we'll do a simple directory walk and copy
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	cachedPath := filepath.Join(e.factory.cacheDir, "repos", repoName, ref)
+	if gitManager != nil {
+		var err error
+		if cachedPath, err = gitManager.EnsureRepository(ctx, repoName+":"+ref); err != nil {
+			return "", err
 		}
-
-		// Calculate destination path
-		relPath, err := filepath.Rel(src, path)
-		if err != nil {
-			return err
-		}
-		dstPath := filepath.Join(dst, relPath)
-
-		// Skip .git directory
-		if info.IsDir() && info.Name() == ".git" {
-			return filepath.SkipDir
-		}
-
-		// Create directories
-		if info.IsDir() {
-			return os.MkdirAll(dstPath, info.Mode())
-		}
-
-		// Copy files
-		return e.copyFile(path, dstPath)
-	})
-}
-
-// copyFile copies a single file from source to destination.
-func (e *ChildWorkflowExecutor) copyFile(src, dst string) error {
-	sourceFile, err := os.Open(src)
-	if err != nil {
-		return err
+	} else if _, err := os.Stat(cachedPath); err != nil {
+		return "", fmt.Errorf("repository %s not found in cache", repoPath)
 	}
-	defer sourceFile.Close()
 
-	destFile, err := os.Create(dst)
-	if err != nil {
-		return err
-	}
-	defer destFile.Close()
-
-	// Get source file info for permissions
-	srcInfo, err := os.Stat(src)
-	if err != nil {
-		return err
-	}
-
-	// Copy content
-	buf := make([]byte, 64*1024) // 64KB buffer
-	for {
-		n, err := sourceFile.Read(buf)
-		if n > 0 {
-			if _, werr := destFile.Write(buf[:n]); werr != nil {
-				return werr
-			}
-		}
-		if err != nil {
-			if err.Error() == "EOF" {
-				break
-			}
-			return err
+	// A pinned commit is checked out exactly; otherwise the cached checkout is copied
+	if commit != "" {
+		if err := exportCommit(ctx, cachedPath, commit, childRepoPath); err != nil {
+			return "", fmt.Errorf("failed to check out %s: %w", repoPath, err)
 		}
+		return childRepoPath, nil
 	}
+	if err := e.copyRepository(cachedPath, childRepoPath); err != nil {
+		return "", fmt.Errorf("failed to copy from cache: %w", err)
+	}
+	return childRepoPath, nil
+}
 
-	// Set permissions
-	return os.Chmod(dst, srcInfo.Mode())
+// copyRepository copies a repository from source to destination, skipping the .git directory.
+func (e *ChildWorkflowExecutor) copyRepository(src, dst string) error {
+	return copyTree(src, dst)
 }
 
 // validateWorkflowInputs validates the provided inputs against the workflow definition.
@@ -282,47 +303,14 @@ func (e *ChildWorkflowExecutor) validateWorkflowInputs(inputs map[string]string,
 			continue
 		}
 
-		// Validate based on type
-		switch inputDef.Type {
-		case "string":
-			// Validate enum if specified
-			if len(inputDef.Validation.Enum) > 0 {
-				valid := false
-				for _, enumVal := range inputDef.Validation.Enum {
-					if value == enumVal {
-						valid = true
-						break
-					}
-				}
-				if !valid {
-					return fmt.Errorf("input '%s' must be one of: %v", name, inputDef.Validation.Enum)
-				}
-			}
-		case "number":
-			// For now, we're passing everything as strings, so skip number validation
-			// In a full implementation, you'd parse and validate numeric constraints
+		// Validate the type and constraints of the input
+		typed, err := inputDef.Parse(value)
+		if err == nil {
+			err = inputDef.Check(typed)
 		}
-	}
-
-	return nil
-}
-
-// cleanupWorkspace removes the child workspace directory.
-// It's designed to be idempotent - safe to call multiple times.
-func (e *ChildWorkflowExecutor) cleanupWorkspace(workspace string) error {
-	// Check if workspace exists
-	if _, err := os.Stat(workspace); os.IsNotExist(err) {
-		// Already cleaned up, nothing to do
-		return nil
-	}
-
-	// Remove the workspace
-	if err := os.RemoveAll(workspace); err != nil {
-		// Check if it's because it doesn't exist (race condition)
-		if os.IsNotExist(err) {
-			return nil
+		if err != nil {
+			return fmt.Errorf("input '%s': %v", name, err)
 		}
-		return fmt.Errorf("failed to remove workspace: %w", err)
 	}
 
 	return nil
@@ -345,6 +333,10 @@ func (e *ChildWorkflowExecutor) convertExecutionResult(result *ExecutionResult)
 			EndTime:   step.EndTime,
 			Output:    step.Output,
 			Outputs:   step.Outputs,
+			Skipped:   step.Skipped,
+			ErrorType: step.ErrorType,
+
+			AllowedFailure: step.AllowedFailure,
 		}
 	}
 
@@ -355,5 +347,9 @@ func (e *ChildWorkflowExecutor) convertExecutionResult(result *ExecutionResult)
 		StartTime: result.StartTime,
 		EndTime:   result.EndTime,
 		Steps:     steps,
+		Outputs:   result.Outputs,
+		Children:  result.Children,
+
+		AllowedFailures: result.AllowedFailures,
 	}
 }
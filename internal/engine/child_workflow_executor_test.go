@@ -114,42 +114,6 @@ func TestChildWorkflowExecutor_ValidateRepoPath(t *testing.T) {
 	}
 }
 
-func TestChildWorkflowExecutor_CopyFile(t *testing.T) {
-	tempDir := t.TempDir()
-
-	// Create source file
-	srcPath := filepath.Join(tempDir, "source.txt")
-	content := []byte("test content")
-	if err := os.WriteFile(srcPath, content, 0644); err != nil {
-		t.Fatalf("Failed to create source file: %v", err)
-	}
-
-	// Test copy
-	executor := &ChildWorkflowExecutor{}
-	dstPath := filepath.Join(tempDir, "dest.txt")
-
-	if err := executor.copyFile(srcPath, dstPath); err != nil {
-		t.Errorf("Failed to copy file: %v", err)
-	}
-
-	// Verify content
-	copiedContent, err := os.ReadFile(dstPath)
-	if err != nil {
-		t.Errorf("Failed to read copied file: %v", err)
-	}
-
-	if string(copiedContent) != string(content) {
-		t.Errorf("Content mismatch: expected %s, got %s", content, copiedContent)
-	}
-
-	// Verify permissions
-	srcInfo, _ := os.Stat(srcPath)
-	dstInfo, _ := os.Stat(dstPath)
-	if srcInfo.Mode() != dstInfo.Mode() {
-		t.Errorf("Permission mismatch: expected %v, got %v", srcInfo.Mode(), dstInfo.Mode())
-	}
-}
-
 func TestChildWorkflowExecutor_CopyRepository(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -259,29 +223,6 @@ func TestChildWorkflowExecutor_ValidateWorkflowInputs(t *testing.T) {
 	}
 }
 
-func TestChildWorkflowExecutor_CleanupWorkspace(t *testing.T) {
-	tempDir := t.TempDir()
-	executor := &ChildWorkflowExecutor{}
-
-	// Test cleanup of existing workspace
-	workspace := filepath.Join(tempDir, "workspace")
-	os.MkdirAll(filepath.Join(workspace, "subdir"), 0755)
-	os.WriteFile(filepath.Join(workspace, "file.txt"), []byte("content"), 0644)
-
-	if err := executor.cleanupWorkspace(workspace); err != nil {
-		t.Errorf("Failed to cleanup workspace: %v", err)
-	}
-
-	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
-		t.Error("Workspace should be removed")
-	}
-
-	// Test idempotent cleanup (already cleaned)
-	if err := executor.cleanupWorkspace(workspace); err != nil {
-		t.Errorf("Cleanup should be idempotent: %v", err)
-	}
-}
-
 func TestChildWorkflowExecutor_ConvertExecutionResult(t *testing.T) {
 	executor := &ChildWorkflowExecutor{}
 
@@ -463,11 +404,11 @@ func TestChildWorkflowExecutor_ResolveChildRepoPath(t *testing.T) {
 	os.MkdirAll(localRepo, 0755)
 	os.WriteFile(filepath.Join(localRepo, "test.txt"), []byte("test"), 0644)
 
-	resolvedPath, err := executor.resolveChildRepoPath(localRepo, childWorkspace)
+	resolvedPath, err := executor.resolveChildRepoPath(context.Background(), localRepo, childWorkspace)
 	if err != nil {
 		t.Errorf("Failed to resolve local repo path: %v", err)
 	}
-	expectedPath := filepath.Join(childWorkspace, "repo")
+	expectedPath := filepath.Join(childWorkspace, "local-repo")
 	if resolvedPath != expectedPath {
 		t.Errorf("Expected resolved path %s, got %s", expectedPath, resolvedPath)
 	}
@@ -485,18 +426,22 @@ func TestChildWorkflowExecutor_ResolveChildRepoPath(t *testing.T) {
 	childWorkspace2 := filepath.Join(tempDir, "child2")
 	os.MkdirAll(childWorkspace2, 0755)
 
-	resolvedPath2, err := executor.resolveChildRepoPath("test-org/test-repo", childWorkspace2)
+	resolvedPath2, err := executor.resolveChildRepoPath(context.Background(), "test-org/test-repo", childWorkspace2)
 	if err != nil {
 		t.Errorf("Failed to resolve cached repo path: %v", err)
 	}
 
+	if expected := filepath.Join(childWorkspace2, "test-repo"); resolvedPath2 != expected {
+		t.Errorf("Expected resolved path %s, got %s", expected, resolvedPath2)
+	}
+
 	// Verify cached copy worked
 	if _, err := os.Stat(filepath.Join(resolvedPath2, "cached.txt")); err != nil {
 		t.Error("Cached repo was not copied correctly")
 	}
 
 	// Test with non-existent remote repo
-	_, err = executor.resolveChildRepoPath("non-existent/repo", childWorkspace)
+	_, err = executor.resolveChildRepoPath(context.Background(), "non-existent/repo", childWorkspace)
 	if err == nil {
 		t.Error("Expected error for non-existent repo")
 	}
@@ -2,6 +2,8 @@ package engine
 
 import (
 	"fmt"
+	"log/slog"
+	"strings"
 	"sync"
 	"time"
 )
@@ -54,7 +56,12 @@ type CircuitBreaker struct {
 	successes        int
 	lastFailureTime  time.Time
 	halfOpenRequests int
+	clock            Clock // Clock the open duration elapses on; the system clock when nil
 	mu               sync.RWMutex
+
+	// endpoint and store persist the state of the circuit breaker of a manager with a store
+	endpoint string
+	store    *CircuitBreakerStore
 }
 
 // NewCircuitBreaker creates a new circuit breaker with the given configuration.
@@ -65,6 +72,13 @@ func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
 	}
 }
 
+// SetClock sets the clock the open duration of the circuit breaker elapses on.
+func (cb *CircuitBreaker) SetClock(clock Clock) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+	cb.clock = clock
+}
+
 // Call executes a function with circuit breaker protection.
 func (cb *CircuitBreaker) Call(fn func() error) error {
 	if !cb.canExecute() {
@@ -86,7 +100,7 @@ func (cb *CircuitBreaker) canExecute() bool {
 		return true
 	case CircuitBreakerOpen:
 		// Check if timeout has passed to transition to half-open
-		if time.Since(cb.lastFailureTime) >= cb.config.Timeout {
+		if clockOrSystem(cb.clock).Now().Sub(cb.lastFailureTime) >= cb.config.Timeout {
 			cb.state = CircuitBreakerHalfOpen
 			cb.halfOpenRequests = 0
 			return true
@@ -103,20 +117,69 @@ func (cb *CircuitBreaker) canExecute() bool {
 // recordResult updates the circuit breaker state based on the execution result.
 func (cb *CircuitBreaker) recordResult(err error) {
 	cb.mu.Lock()
-	defer cb.mu.Unlock()
-
 	if err != nil {
 		cb.onFailure()
 	} else {
 		cb.onSuccess()
 	}
+	snapshot, store := cb.snapshot(), cb.store
+	cb.mu.Unlock()
+
+	cb.persist(store, snapshot)
+}
+
+// snapshot returns the state of the circuit breaker to persist. The caller must hold the lock.
+func (cb *CircuitBreaker) snapshot() CircuitBreakerSnapshot {
+	snapshot := CircuitBreakerSnapshot{
+		Endpoint:        cb.endpoint,
+		State:           cb.state.String(),
+		Failures:        cb.failures,
+		Successes:       cb.successes,
+		LastFailureTime: cb.lastFailureTime,
+		UpdatedAt:       clockOrSystem(cb.clock).Now(),
+	}
+	if cb.state == CircuitBreakerOpen {
+		openUntil := cb.lastFailureTime.Add(cb.config.Timeout)
+		snapshot.OpenUntil = &openUntil
+	}
+	return snapshot
+}
+
+// restore sets the state of the circuit breaker to a persisted one.
+func (cb *CircuitBreaker) restore(snapshot CircuitBreakerSnapshot) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch snapshot.State {
+	case CircuitBreakerOpen.String():
+		cb.state = CircuitBreakerOpen
+	case CircuitBreakerHalfOpen.String():
+		cb.state = CircuitBreakerHalfOpen
+	default:
+		cb.state = CircuitBreakerClosed
+	}
+	cb.failures = snapshot.Failures
+	cb.successes = snapshot.Successes
+	cb.lastFailureTime = snapshot.LastFailureTime
+	cb.halfOpenRequests = 0
+}
+
+// persist saves the state of the circuit breaker to the store of its manager, if any. Failing
+// to persist it does not fail the calls it guards.
+func (cb *CircuitBreaker) persist(store *CircuitBreakerStore, snapshot CircuitBreakerSnapshot) {
+	if store == nil {
+		return
+	}
+	if err := store.Save(snapshot); err != nil {
+		slog.Warn("failed to persist circuit breaker", "endpoint", cb.endpoint, "error", err)
+	}
 }
 
 // onFailure handles a failed execution.
 func (cb *CircuitBreaker) onFailure() {
 	cb.failures++
 	cb.successes = 0
-	cb.lastFailureTime = time.Now()
+	cb.lastFailureTime = clockOrSystem(cb.clock).Now()
 
 	switch cb.state {
 	case CircuitBreakerClosed:
@@ -174,16 +237,25 @@ func (cb *CircuitBreaker) GetStats() CircuitBreakerStats {
 	}
 }
 
-// Reset manually resets the circuit breaker to closed state.
-func (cb *CircuitBreaker) Reset() {
+// setConfig replaces the configuration of the circuit breaker, keeping its state and counters.
+func (cb *CircuitBreaker) setConfig(config CircuitBreakerConfig) {
 	cb.mu.Lock()
 	defer cb.mu.Unlock()
+	cb.config = config
+}
 
+// Reset manually resets the circuit breaker to closed state.
+func (cb *CircuitBreaker) Reset() {
+	cb.mu.Lock()
 	cb.state = CircuitBreakerClosed
 	cb.failures = 0
 	cb.successes = 0
 	cb.halfOpenRequests = 0
 	cb.lastFailureTime = time.Time{}
+	snapshot, store := cb.snapshot(), cb.store
+	cb.mu.Unlock()
+
+	cb.persist(store, snapshot)
 }
 
 // CircuitBreakerStats contains statistics about a circuit breaker.
@@ -200,10 +272,14 @@ type CircuitBreakerStats struct {
 }
 
 // CircuitBreakerManager manages circuit breakers for different endpoints.
+// Endpoints are "owner/repo:workflow"; overrides apply to an endpoint or to its repository.
 type CircuitBreakerManager struct {
-	breakers map[string]*CircuitBreaker
-	config   CircuitBreakerConfig
-	mu       sync.RWMutex
+	breakers  map[string]*CircuitBreaker
+	config    CircuitBreakerConfig
+	overrides map[string]CircuitBreakerConfig
+	clock     Clock                // Clock of the circuit breakers; the system clock when nil
+	store     *CircuitBreakerStore // Store persisting the circuit breakers; nil to keep them in memory
+	mu        sync.RWMutex
 }
 
 // NewCircuitBreakerManager creates a new circuit breaker manager.
@@ -223,12 +299,95 @@ func (cbm *CircuitBreakerManager) GetCircuitBreaker(endpoint string) *CircuitBre
 		return breaker
 	}
 
-	// Create new circuit breaker for this endpoint
-	breaker := NewCircuitBreaker(cbm.config)
+	// Create new circuit breaker for this endpoint, restoring its persisted state
+	breaker := cbm.newCircuitBreaker(endpoint)
+	if cbm.store != nil {
+		snapshot, err := cbm.store.Get(endpoint)
+		if err != nil {
+			slog.Warn("failed to restore circuit breaker", "endpoint", endpoint, "error", err)
+		} else if snapshot != nil {
+			breaker.restore(*snapshot)
+		}
+	}
 	cbm.breakers[endpoint] = breaker
 	return breaker
 }
 
+// newCircuitBreaker creates the circuit breaker of an endpoint. The caller must hold the lock.
+func (cbm *CircuitBreakerManager) newCircuitBreaker(endpoint string) *CircuitBreaker {
+	breaker := NewCircuitBreaker(cbm.configFor(endpoint))
+	breaker.clock = cbm.clock
+	breaker.endpoint = endpoint
+	breaker.store = cbm.store
+	return breaker
+}
+
+// SetStore persists the circuit breakers in a store, and restores the circuit breakers it holds,
+// so that they survive restarts of the process.
+func (cbm *CircuitBreakerManager) SetStore(store *CircuitBreakerStore) error {
+	snapshots, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	cbm.mu.Lock()
+	defer cbm.mu.Unlock()
+	cbm.store = store
+	for _, breaker := range cbm.breakers {
+		breaker.mu.Lock()
+		breaker.store = store
+		breaker.mu.Unlock()
+	}
+	for _, snapshot := range snapshots {
+		breaker, exists := cbm.breakers[snapshot.Endpoint]
+		if !exists {
+			breaker = cbm.newCircuitBreaker(snapshot.Endpoint)
+			cbm.breakers[snapshot.Endpoint] = breaker
+		}
+		breaker.restore(snapshot)
+	}
+	return nil
+}
+
+// SetClock sets the clock of the circuit breakers, existing and future.
+func (cbm *CircuitBreakerManager) SetClock(clock Clock) {
+	cbm.mu.Lock()
+	defer cbm.mu.Unlock()
+
+	cbm.clock = clock
+	for _, breaker := range cbm.breakers {
+		breaker.SetClock(clock)
+	}
+}
+
+// Configure replaces the default configuration and the per-endpoint overrides, keyed by
+// endpoint or by repository. Existing circuit breakers switch to their new configuration
+// without losing their state.
+func (cbm *CircuitBreakerManager) Configure(config CircuitBreakerConfig, overrides map[string]CircuitBreakerConfig) {
+	cbm.mu.Lock()
+	defer cbm.mu.Unlock()
+
+	cbm.config = config
+	cbm.overrides = overrides
+	for endpoint, breaker := range cbm.breakers {
+		breaker.setConfig(cbm.configFor(endpoint))
+	}
+}
+
+// configFor returns the configuration of an endpoint: its override, or else the override of
+// its repository, or else the default configuration. The caller must hold the lock.
+func (cbm *CircuitBreakerManager) configFor(endpoint string) CircuitBreakerConfig {
+	if config, ok := cbm.overrides[endpoint]; ok {
+		return config
+	}
+	if repository, _, ok := strings.Cut(endpoint, ":"); ok {
+		if config, ok := cbm.overrides[repository]; ok {
+			return config
+		}
+	}
+	return cbm.config
+}
+
 // GetAllStats returns statistics for all circuit breakers.
 func (cbm *CircuitBreakerManager) GetAllStats() map[string]CircuitBreakerStats {
 	cbm.mu.RLock()
@@ -258,6 +417,10 @@ func (cbm *CircuitBreakerManager) ResetEndpoint(endpoint string) {
 
 	if breaker, exists := cbm.breakers[endpoint]; exists {
 		breaker.Reset()
+	} else if cbm.store != nil {
+		if err := cbm.store.Delete(endpoint); err != nil {
+			slog.Warn("failed to reset circuit breaker", "endpoint", endpoint, "error", err)
+		}
 	}
 }
 
@@ -266,7 +429,7 @@ func (cbm *CircuitBreakerManager) CleanupStaleBreakers(staleDuration time.Durati
 	cbm.mu.Lock()
 	defer cbm.mu.Unlock()
 
-	cutoff := time.Now().Add(-staleDuration)
+	cutoff := clockOrSystem(cbm.clock).Now().Add(-staleDuration)
 	for endpoint, breaker := range cbm.breakers {
 		stats := breaker.GetStats()
 		// Remove breakers that are closed and haven't failed recently
@@ -0,0 +1,140 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// DefaultCircuitBreakerReloadInterval is how often the config files of circuit breakers are
+// checked for changes.
+const DefaultCircuitBreakerReloadInterval = 5 * time.Second
+
+// CircuitBreakerConfigs converts the circuit_breakers section of a config file into the
+// default configuration and the per-endpoint overrides of a CircuitBreakerManager. Unset
+// settings inherit the default section, or else DefaultCircuitBreakerConfig.
+func CircuitBreakerConfigs(cfg *config.CircuitBreakersConfig) (CircuitBreakerConfig, map[string]CircuitBreakerConfig, error) {
+	defaults := DefaultCircuitBreakerConfig()
+	if cfg == nil {
+		return defaults, nil, nil
+	}
+
+	defaults, err := applyCircuitBreakerSettings(defaults, cfg.Default)
+	if err != nil {
+		return CircuitBreakerConfig{}, nil, fmt.Errorf("default: %w", err)
+	}
+	overrides := make(map[string]CircuitBreakerConfig, len(cfg.Endpoints))
+	for endpoint, settings := range cfg.Endpoints {
+		override, err := applyCircuitBreakerSettings(defaults, settings)
+		if err != nil {
+			return CircuitBreakerConfig{}, nil, fmt.Errorf("endpoint '%s': %w", endpoint, err)
+		}
+		overrides[endpoint] = override
+	}
+	return defaults, overrides, nil
+}
+
+// applyCircuitBreakerSettings returns base with the settings that are set replacing its fields.
+func applyCircuitBreakerSettings(base CircuitBreakerConfig, settings config.CircuitBreakerSettings) (CircuitBreakerConfig, error) {
+	if settings.FailureThreshold > 0 {
+		base.FailureThreshold = settings.FailureThreshold
+	}
+	if settings.SuccessThreshold > 0 {
+		base.SuccessThreshold = settings.SuccessThreshold
+	}
+	if settings.HalfOpenProbes > 0 {
+		base.MaxRequests = settings.HalfOpenProbes
+	}
+	if settings.OpenDuration != "" {
+		duration, err := time.ParseDuration(settings.OpenDuration)
+		if err != nil {
+			return CircuitBreakerConfig{}, fmt.Errorf("invalid open_duration '%s': %v", settings.OpenDuration, err)
+		}
+		base.Timeout = duration
+	}
+	return base, nil
+}
+
+// CircuitBreakerConfigWatcher configures a CircuitBreakerManager from the circuit_breakers
+// section of a tako.yml or daemon config file and reconfigures it when the file changes.
+// Removing the section restores the fallback configuration, or else the default one.
+type CircuitBreakerConfigWatcher struct {
+	path     string
+	manager  *CircuitBreakerManager
+	fallback *config.CircuitBreakersConfig
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+}
+
+// NewCircuitBreakerConfigWatcher creates a watcher of the circuit breakers of a config file.
+func NewCircuitBreakerConfigWatcher(path string, manager *CircuitBreakerManager) *CircuitBreakerConfigWatcher {
+	return &CircuitBreakerConfigWatcher{path: path, manager: manager}
+}
+
+// SetFallback sets the configuration of the manager while the file has no circuit_breakers
+// section, such as that of the user configuration.
+func (w *CircuitBreakerConfigWatcher) SetFallback(fallback *config.CircuitBreakersConfig) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.fallback = fallback
+}
+
+// Reload configures the manager from the file if the file changed since the last reload. It
+// reports whether it did. An invalid file leaves the current configuration in place.
+func (w *CircuitBreakerConfigWatcher) Reload() (bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat circuit breaker config: %v", err)
+	}
+	if info.ModTime().Equal(w.modTime) && info.Size() == w.size {
+		return false, nil
+	}
+
+	cfg, err := config.LoadCircuitBreakers(w.path)
+	if err != nil {
+		return false, err
+	}
+	if cfg == nil {
+		cfg = w.fallback
+	}
+	defaults, overrides, err := CircuitBreakerConfigs(cfg)
+	if err != nil {
+		return false, fmt.Errorf("invalid circuit breakers: %v", err)
+	}
+	w.manager.Configure(defaults, overrides)
+	w.modTime = info.ModTime()
+	w.size = info.Size()
+	return true, nil
+}
+
+// Watch reloads the file every interval until ctx is done. Failed reloads are logged and
+// retried at the next interval.
+func (w *CircuitBreakerConfigWatcher) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := w.Reload()
+			if err != nil {
+				slog.Warn("failed to reload circuit breakers", "path", w.path, "error", err)
+			} else if reloaded {
+				slog.Info("reloaded circuit breakers", "path", w.path)
+			}
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestCircuitBreakerConfigs(t *testing.T) {
+	defaults, overrides, err := CircuitBreakerConfigs(&config.CircuitBreakersConfig{
+		Default: config.CircuitBreakerSettings{FailureThreshold: 2, OpenDuration: "1m"},
+		Endpoints: map[string]config.CircuitBreakerSettings{
+			"org/flaky": {FailureThreshold: 10, HalfOpenProbes: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CircuitBreakerConfigs() error = %v", err)
+	}
+
+	builtin := DefaultCircuitBreakerConfig()
+	expected := CircuitBreakerConfig{FailureThreshold: 2, SuccessThreshold: builtin.SuccessThreshold, Timeout: time.Minute, MaxRequests: builtin.MaxRequests}
+	if defaults != expected {
+		t.Errorf("Expected defaults %+v, got %+v", expected, defaults)
+	}
+	expected.FailureThreshold = 10
+	expected.MaxRequests = 1
+	if overrides["org/flaky"] != expected {
+		t.Errorf("Expected override %+v, got %+v", expected, overrides["org/flaky"])
+	}
+}
+
+func TestCircuitBreakerManager_Configure(t *testing.T) {
+	cbm := NewCircuitBreakerManager(DefaultCircuitBreakerConfig())
+	existing := cbm.GetCircuitBreaker("org/flaky:build")
+	existing.Call(func() error { return errors.New("failure") })
+
+	cbm.Configure(CircuitBreakerConfig{FailureThreshold: 7, Timeout: time.Second}, map[string]CircuitBreakerConfig{
+		"org/flaky":        {FailureThreshold: 2, Timeout: time.Second},
+		"org/flaky:deploy": {FailureThreshold: 1, Timeout: time.Second},
+	})
+
+	thresholds := map[string]int{
+		"org/flaky:build":  2, // Repository override
+		"org/flaky:deploy": 1, // Endpoint override takes precedence
+		"org/stable:build": 7, // Default
+	}
+	for endpoint, threshold := range thresholds {
+		if got := cbm.GetCircuitBreaker(endpoint).GetStats().FailureThreshold; got != threshold {
+			t.Errorf("Expected failure threshold %d for %s, got %d", threshold, endpoint, got)
+		}
+	}
+
+	// The existing breaker kept its failure and opens on the next one
+	existing.Call(func() error { return errors.New("failure") })
+	if existing.GetState() != CircuitBreakerOpen {
+		t.Errorf("Expected reconfigured breaker to open, got %v", existing.GetState())
+	}
+}
+
+func TestCircuitBreakerConfigWatcher_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tako.yml")
+	write := func(content string, modTime time.Time) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatalf("Failed to set modification time: %v", err)
+		}
+	}
+	now := time.Now()
+	write("version: 0.1.0\ncircuit_breakers:\n  endpoints:\n    org/repo:\n      failure_threshold: 4\n", now)
+
+	cbm := NewCircuitBreakerManager(DefaultCircuitBreakerConfig())
+	watcher := NewCircuitBreakerConfigWatcher(path, cbm)
+	if reloaded, err := watcher.Reload(); err != nil || !reloaded {
+		t.Fatalf("Expected first reload to apply the config, got %v, %v", reloaded, err)
+	}
+	breaker := cbm.GetCircuitBreaker("org/repo:build")
+	if breaker.GetStats().FailureThreshold != 4 {
+		t.Errorf("Expected failure threshold 4, got %d", breaker.GetStats().FailureThreshold)
+	}
+	if reloaded, err := watcher.Reload(); err != nil || reloaded {
+		t.Errorf("Expected unchanged file not to be reloaded, got %v, %v", reloaded, err)
+	}
+
+	// An invalid change keeps the current configuration
+	write("circuit_breakers:\n  default:\n    open_duration: soon\n", now.Add(time.Second))
+	if _, err := watcher.Reload(); err == nil {
+		t.Errorf("Expected invalid config to fail to reload")
+	}
+	if breaker.GetStats().FailureThreshold != 4 {
+		t.Errorf("Expected failure threshold to remain 4, got %d", breaker.GetStats().FailureThreshold)
+	}
+
+	// Removing the section restores the defaults
+	write("version: 0.1.0\n", now.Add(2*time.Second))
+	if reloaded, err := watcher.Reload(); err != nil || !reloaded {
+		t.Fatalf("Expected changed file to be reloaded, got %v, %v", reloaded, err)
+	}
+	if got := breaker.GetStats().FailureThreshold; got != DefaultCircuitBreakerConfig().FailureThreshold {
+		t.Errorf("Expected default failure threshold, got %d", got)
+	}
+}
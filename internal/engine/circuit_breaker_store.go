@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// CircuitBreakerSnapshot is the persisted state of the circuit breaker of an endpoint.
+type CircuitBreakerSnapshot struct {
+	Endpoint        string    `json:"endpoint"`
+	State           string    `json:"state"` // closed, open or half-open
+	Failures        int       `json:"failures"`
+	Successes       int       `json:"successes,omitempty"`
+	LastFailureTime time.Time `json:"last_failure_time"`
+	// OpenUntil is when an open circuit breaker lets a request through again.
+	OpenUntil *time.Time `json:"open_until,omitempty"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// healthy reports whether the snapshot holds nothing worth remembering: a closed circuit
+// breaker without failures.
+func (s CircuitBreakerSnapshot) healthy() bool {
+	return s.State == CircuitBreakerClosed.String() && s.Failures == 0
+}
+
+// CircuitBreakerStore keeps the states of the circuit breakers in the shared cache, so that
+// their protection survives restarts and holds across the processes of the cache.
+type CircuitBreakerStore struct {
+	dir string
+}
+
+// NewCircuitBreakerStore creates the store of the circuit breakers under a cache directory.
+func NewCircuitBreakerStore(cacheDir string) (*CircuitBreakerStore, error) {
+	dir := filepath.Join(cacheDir, "circuit-breakers")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create circuit breaker directory: %v", err)
+	}
+	return &CircuitBreakerStore{dir: dir}, nil
+}
+
+// Save persists the state of the circuit breaker of an endpoint. The state of a closed circuit
+// breaker without failures is removed instead.
+func (s *CircuitBreakerStore) Save(snapshot CircuitBreakerSnapshot) error {
+	if snapshot.healthy() {
+		return s.Delete(snapshot.Endpoint)
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal circuit breaker: %v", err)
+	}
+	// Write to a temporary file first, then atomic rename; processes may save the same endpoint
+	temp, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to save circuit breaker: %v", err)
+	}
+	_, err = temp.Write(data)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), s.path(snapshot.Endpoint))
+	}
+	if err != nil {
+		os.Remove(temp.Name()) // Clean up on failure
+		return fmt.Errorf("failed to save circuit breaker: %v", err)
+	}
+	return nil
+}
+
+// Get returns the state of the circuit breaker of an endpoint, or nil when none is persisted.
+func (s *CircuitBreakerStore) Get(endpoint string) (*CircuitBreakerSnapshot, error) {
+	return s.read(s.path(endpoint))
+}
+
+// List returns the persisted states of the circuit breakers, sorted by endpoint.
+func (s *CircuitBreakerStore) List() ([]CircuitBreakerSnapshot, error) {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list circuit breakers: %v", err)
+	}
+	var snapshots []CircuitBreakerSnapshot
+	for _, match := range matches {
+		snapshot, err := s.read(match)
+		if err != nil {
+			return nil, err
+		}
+		if snapshot != nil {
+			snapshots = append(snapshots, *snapshot)
+		}
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Endpoint < snapshots[j].Endpoint })
+	return snapshots, nil
+}
+
+// Delete removes the state of the circuit breaker of an endpoint, which closes it for the
+// processes that restore it.
+func (s *CircuitBreakerStore) Delete(endpoint string) error {
+	if err := os.Remove(s.path(endpoint)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove circuit breaker of %s: %v", endpoint, err)
+	}
+	return nil
+}
+
+// read reads a state file, returning nil when it does not exist.
+func (s *CircuitBreakerStore) read(path string) (*CircuitBreakerSnapshot, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read circuit breaker: %v", err)
+	}
+	var snapshot CircuitBreakerSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("failed to parse circuit breaker %s: %v", filepath.Base(path), err)
+	}
+	return &snapshot, nil
+}
+
+// path returns the state file of an endpoint. Endpoints are owner/repo:workflow, so only the
+// characters safe in file names are kept, the endpoint itself being recorded in the file.
+func (s *CircuitBreakerStore) path(endpoint string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '-' || r == '.' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return '_'
+	}, endpoint)
+	return filepath.Join(s.dir, name+".json")
+}
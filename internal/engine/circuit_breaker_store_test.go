@@ -0,0 +1,70 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerManager_Persistence(t *testing.T) {
+	cacheDir := t.TempDir()
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	config := CircuitBreakerConfig{FailureThreshold: 2, SuccessThreshold: 1, Timeout: time.Minute, MaxRequests: 1}
+
+	newManager := func() *CircuitBreakerManager {
+		store, err := NewCircuitBreakerStore(cacheDir)
+		if err != nil {
+			t.Fatalf("Failed to create store: %v", err)
+		}
+		manager := NewCircuitBreakerManager(config)
+		manager.SetClock(clock)
+		if err := manager.SetStore(store); err != nil {
+			t.Fatalf("Failed to restore circuit breakers: %v", err)
+		}
+		return manager
+	}
+
+	manager := newManager()
+	breaker := manager.GetCircuitBreaker("org/app:update")
+	for i := 0; i < 2; i++ {
+		breaker.Call(func() error { return errors.New("failed") })
+	}
+	manager.GetCircuitBreaker("org/docs:publish").Call(func() error { return nil })
+
+	// A restarted process restores the open circuit breaker
+	restarted := newManager()
+	if state := restarted.GetCircuitBreaker("org/app:update").GetState(); state != CircuitBreakerOpen {
+		t.Fatalf("expected the circuit breaker to be restored open, got %s", state)
+	}
+	if err := restarted.GetCircuitBreaker("org/app:update").Call(func() error { return nil }); err == nil {
+		t.Errorf("expected the restored circuit breaker to block calls")
+	}
+
+	store, _ := NewCircuitBreakerStore(cacheDir)
+	snapshots, err := store.List()
+	if err != nil || len(snapshots) != 1 {
+		t.Fatalf("expected only the failing circuit breaker to be persisted, got %+v, %v", snapshots, err)
+	}
+	if snapshots[0].Endpoint != "org/app:update" || snapshots[0].Failures != 2 || snapshots[0].OpenUntil == nil || !snapshots[0].OpenUntil.Equal(clock.Now().Add(time.Minute)) {
+		t.Errorf("unexpected snapshot %+v", snapshots[0])
+	}
+
+	// Once the timeout elapsed, a success closes it and removes its state
+	clock.Advance(time.Minute)
+	if err := restarted.GetCircuitBreaker("org/app:update").Call(func() error { return nil }); err != nil {
+		t.Fatalf("expected the half-open circuit breaker to let a call through: %v", err)
+	}
+	if snapshot, err := store.Get("org/app:update"); err != nil || snapshot != nil {
+		t.Errorf("expected the state of the closed circuit breaker to be removed, got %+v, %v", snapshot, err)
+	}
+
+	// Resetting an endpoint that the manager never used removes its persisted state
+	if err := store.Save(CircuitBreakerSnapshot{Endpoint: "org/lib:build", State: "open", Failures: 3}); err != nil {
+		t.Fatalf("Failed to save snapshot: %v", err)
+	}
+	restarted.ResetEndpoint("org/api:deploy")
+	newManager().ResetEndpoint("org/lib:build")
+	if snapshot, _ := store.Get("org/lib:build"); snapshot != nil {
+		t.Errorf("expected the reset circuit breaker to be removed, got %+v", snapshot)
+	}
+}
@@ -66,6 +66,8 @@ func TestCircuitBreakerHalfOpenTransition(t *testing.T) {
 		MaxRequests:      2,
 	}
 	cb := NewCircuitBreaker(config)
+	clock := NewFakeClock(time.Now())
+	cb.SetClock(clock)
 
 	// Open the circuit
 	cb.Call(func() error { return errors.New("test error") })
@@ -74,7 +76,7 @@ func TestCircuitBreakerHalfOpenTransition(t *testing.T) {
 	}
 
 	// Wait for timeout
-	time.Sleep(60 * time.Millisecond)
+	clock.Advance(60 * time.Millisecond)
 
 	// Next call should transition to half-open
 	successFn := func() error { return nil }
@@ -95,12 +97,14 @@ func TestCircuitBreakerHalfOpenToOpen(t *testing.T) {
 		MaxRequests:      2,
 	}
 	cb := NewCircuitBreaker(config)
+	clock := NewFakeClock(time.Now())
+	cb.SetClock(clock)
 
 	// Open the circuit
 	cb.Call(func() error { return errors.New("test error") })
 
 	// Wait for timeout and transition to half-open
-	time.Sleep(60 * time.Millisecond)
+	clock.Advance(60 * time.Millisecond)
 	cb.Call(func() error { return nil }) // First success in half-open
 
 	// Failure in half-open should immediately open the circuit
@@ -118,12 +122,14 @@ func TestCircuitBreakerHalfOpenToClosed(t *testing.T) {
 		MaxRequests:      3,
 	}
 	cb := NewCircuitBreaker(config)
+	clock := NewFakeClock(time.Now())
+	cb.SetClock(clock)
 
 	// Open the circuit
 	cb.Call(func() error { return errors.New("test error") })
 
 	// Wait for timeout and transition to half-open
-	time.Sleep(60 * time.Millisecond)
+	clock.Advance(60 * time.Millisecond)
 
 	// Two successes should close the circuit
 	cb.Call(func() error { return nil })
@@ -142,12 +148,14 @@ func TestCircuitBreakerMaxRequestsInHalfOpen(t *testing.T) {
 		MaxRequests:      2,
 	}
 	cb := NewCircuitBreaker(config)
+	clock := NewFakeClock(time.Now())
+	cb.SetClock(clock)
 
 	// Open the circuit
 	cb.Call(func() error { return errors.New("test error") })
 
 	// Wait for timeout
-	time.Sleep(60 * time.Millisecond)
+	clock.Advance(60 * time.Millisecond)
 
 	// First two calls should succeed (within MaxRequests)
 	err1 := cb.Call(func() error { return nil })
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ type CleanupManager struct {
 	workspaceRoot string
 	maxAge        time.Duration
 	debug         bool
+	keepOnFailure bool
 }
 
 // NewCleanupManager creates a new cleanup manager.
@@ -28,6 +30,66 @@ func NewCleanupManager(workspaceRoot string, maxAge time.Duration, debug bool) *
 	}
 }
 
+// SetKeepOnFailure controls whether workspaces of failed runs are preserved for debugging.
+// Preserved workspaces are left on disk and eventually removed by CleanupOrphanedWorkspaces.
+func (cm *CleanupManager) SetKeepOnFailure(keep bool) {
+	cm.keepOnFailure = keep
+}
+
+// KeepOnFailure returns whether workspaces of failed runs are preserved.
+func (cm *CleanupManager) KeepOnFailure() bool {
+	return cm.keepOnFailure
+}
+
+// FinalizeWorkspace removes the workspace of a finished run, located at workspaceRoot/runID,
+// except for the logs of its steps and its execution report.
+// If the run failed and keep-on-failure is enabled, the workspace is left in place and
+// true is returned. This is an idempotent operation.
+func (cm *CleanupManager) FinalizeWorkspace(runID string, success bool) (bool, error) {
+	if runID == "" || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return false, fmt.Errorf("invalid runID %q", runID)
+	}
+
+	workspacePath := filepath.Join(cm.workspaceRoot, runID)
+
+	if !success && cm.keepOnFailure {
+		if cm.debug {
+			fmt.Printf("Keeping workspace of failed run for debugging: %s\n", workspacePath)
+		}
+		return true, nil
+	}
+
+	if cm.debug {
+		fmt.Printf("Cleaning up workspace: %s\n", workspacePath)
+	}
+
+	// The step logs are kept, for tako logs, and so are the execution report and lockfile
+	entries, err := os.ReadDir(workspacePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to remove workspace %s: %v", workspacePath, err)
+	}
+	kept := false
+	for _, entry := range entries {
+		if (entry.Name() == "logs" && entry.IsDir()) || strings.HasPrefix(entry.Name(), "report.") || entry.Name() == LockfileName {
+			kept = true
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(workspacePath, entry.Name())); err != nil {
+			return false, fmt.Errorf("failed to remove workspace %s: %v", workspacePath, err)
+		}
+	}
+	if !kept {
+		if err := os.Remove(workspacePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return false, fmt.Errorf("failed to remove workspace %s: %v", workspacePath, err)
+		}
+	}
+
+	return false, nil
+}
+
 // CleanupOrphanedWorkspaces removes child workflow workspaces that are older than maxAge
 // and don't have active processes. This is an idempotent operation.
 func (cm *CleanupManager) CleanupOrphanedWorkspaces() error {
@@ -183,3 +183,83 @@ func TestCleanupManager_hasActiveProcesses(t *testing.T) {
 		t.Errorf("Workspace with lock file should have active processes")
 	}
 }
+
+func TestCleanupManager_FinalizeWorkspace(t *testing.T) {
+	tempDir := t.TempDir()
+	cm := NewCleanupManager(tempDir, 0, false)
+
+	createWorkspace := func(runID string) string {
+		path := filepath.Join(tempDir, runID)
+		if err := os.MkdirAll(filepath.Join(path, "repo"), 0755); err != nil {
+			t.Fatalf("Failed to create workspace: %v", err)
+		}
+		return path
+	}
+
+	// Successful runs are always cleaned up
+	successful := createWorkspace("run-success")
+	kept, err := cm.FinalizeWorkspace("run-success", true)
+	if err != nil {
+		t.Fatalf("Failed to finalize workspace: %v", err)
+	}
+	if kept {
+		t.Error("Successful run workspace should not be kept")
+	}
+	if _, err := os.Stat(successful); !os.IsNotExist(err) {
+		t.Error("Successful run workspace should be removed")
+	}
+
+	// The step logs and execution reports of cleaned up workspaces are kept
+	logged := createWorkspace("run-logged")
+	if err := os.MkdirAll(filepath.Join(logged, "logs"), 0755); err != nil {
+		t.Fatalf("Failed to create logs directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(logged, "report.json"), []byte("{}"), 0644); err != nil {
+		t.Fatalf("Failed to create report: %v", err)
+	}
+	if _, err := cm.FinalizeWorkspace("run-logged", true); err != nil {
+		t.Fatalf("Failed to finalize workspace: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logged, "repo")); !os.IsNotExist(err) {
+		t.Error("Workspace of the logged run should be removed")
+	}
+	if _, err := os.Stat(filepath.Join(logged, "logs")); err != nil {
+		t.Errorf("Step logs should be kept: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(logged, "report.json")); err != nil {
+		t.Errorf("Execution report should be kept: %v", err)
+	}
+
+	// Failed runs are cleaned up unless keep-on-failure is enabled
+	failed := createWorkspace("run-failed")
+	if _, err := cm.FinalizeWorkspace("run-failed", false); err != nil {
+		t.Fatalf("Failed to finalize workspace: %v", err)
+	}
+	if _, err := os.Stat(failed); !os.IsNotExist(err) {
+		t.Error("Failed run workspace should be removed by default")
+	}
+
+	cm.SetKeepOnFailure(true)
+	if !cm.KeepOnFailure() {
+		t.Error("Expected keep-on-failure to be enabled")
+	}
+	kept, err = cm.FinalizeWorkspace("run-failed-kept", false)
+	if err != nil {
+		t.Fatalf("Failed to finalize workspace: %v", err)
+	}
+	if !kept {
+		t.Error("Failed run workspace should be kept when keep-on-failure is enabled")
+	}
+
+	// Finalizing is idempotent
+	if _, err := cm.FinalizeWorkspace("run-success", true); err != nil {
+		t.Errorf("Finalizing a removed workspace should succeed: %v", err)
+	}
+
+	// Run IDs must not escape the workspace root
+	for _, runID := range []string{"", "..", "a/b"} {
+		if _, err := cm.FinalizeWorkspace(runID, true); err == nil {
+			t.Errorf("Expected error for run ID %q", runID)
+		}
+	}
+}
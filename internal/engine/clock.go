@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time to the engine: when runs, steps, fan-outs and their children start and
+// end, when states were updated, and how long retries back off and circuit breakers stay open.
+// Timeouts enforced through contexts always use real time.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// After returns a channel receiving the current time once d has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the clock of the real time, used unless another one is set.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// clockOrSystem returns clock, or the system clock when it is nil.
+func clockOrSystem(clock Clock) Clock {
+	if clock == nil {
+		return SystemClock
+	}
+	return clock
+}
+
+// FakeClock is a clock whose time only moves when it is advanced, for fast and deterministic
+// tests of timeouts, retention and backoff.
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeClockWaiter
+}
+
+// fakeClockWaiter is a channel of After waiting for the fake time to reach its deadline.
+type fakeClockWaiter struct {
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// NewFakeClock creates a fake clock set to start.
+func NewFakeClock(start time.Time) *FakeClock {
+	return &FakeClock{now: start}
+}
+
+// Now returns the fake time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// After returns a channel receiving the fake time once it has been advanced by d.
+func (c *FakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, fakeClockWaiter{deadline: c.now.Add(d), ch: ch})
+	return ch
+}
+
+// Advance moves the fake time forward by d, and releases the After channels whose deadline
+// it reached, in deadline order.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the fake time to t, which may travel back in time, and releases the After
+// channels whose deadline it reached, in deadline order.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	sort.SliceStable(c.waiters, func(i, j int) bool {
+		return c.waiters[i].deadline.Before(c.waiters[j].deadline)
+	})
+	remaining := c.waiters[:0]
+	for _, waiter := range c.waiters {
+		if waiter.deadline.After(t) {
+			remaining = append(remaining, waiter)
+			continue
+		}
+		waiter.ch <- t
+	}
+	c.waiters = remaining
+}
+
+// Waiters returns the number of After channels waiting for the fake time to advance, so that
+// tests can advance it once the code under test is waiting.
+func (c *FakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntilWaiters waits, in real time, until at least n After channels are waiting for the
+// fake time to advance, and reports whether they were before timeout.
+func (c *FakeClock) BlockUntilWaiters(n int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for c.Waiters() < n {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,214 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	if !clock.Now().Equal(start) {
+		t.Fatalf("expected %v, got %v", start, clock.Now())
+	}
+
+	select {
+	case <-clock.After(0):
+	default:
+		t.Fatal("expected After(0) to fire immediately")
+	}
+
+	late := clock.After(2 * time.Minute)
+	early := clock.After(time.Minute)
+	if clock.Waiters() != 2 {
+		t.Fatalf("expected 2 waiters, got %d", clock.Waiters())
+	}
+
+	clock.Advance(90 * time.Second)
+	select {
+	case fired := <-early:
+		if !fired.Equal(start.Add(90 * time.Second)) {
+			t.Errorf("expected the channel to receive the fake time, got %v", fired)
+		}
+	default:
+		t.Fatal("expected the channel whose deadline passed to fire")
+	}
+	select {
+	case <-late:
+		t.Fatal("expected the channel whose deadline is ahead not to fire")
+	default:
+	}
+
+	// Time can travel back, then forward past the remaining deadline
+	clock.Set(start.Add(-time.Hour))
+	if clock.Waiters() != 1 {
+		t.Fatalf("expected 1 waiter, got %d", clock.Waiters())
+	}
+	clock.Set(start.Add(time.Hour))
+	<-late
+	if clock.Waiters() != 0 {
+		t.Errorf("expected no waiters, got %d", clock.Waiters())
+	}
+}
+
+func TestRetryableExecutorUsesClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	executor := NewRetryableExecutor(RetryConfig{
+		MaxRetries:      2,
+		InitialDelay:    time.Hour,
+		MaxDelay:        time.Hour,
+		BackoffFactor:   2,
+		RetryableErrors: []string{"unavailable"},
+	})
+	executor.SetClock(clock)
+
+	attempts := 0
+	done := make(chan error, 1)
+	go func() {
+		done <- executor.Execute(context.Background(), func() error {
+			attempts++
+			if attempts < 3 {
+				return errors.New("service unavailable")
+			}
+			return nil
+		})
+	}()
+
+	// Each retry waits an hour of fake time, which passes instantly
+	for i := 0; i < 2; i++ {
+		if !clock.BlockUntilWaiters(1, 5*time.Second) {
+			t.Fatalf("expected retry %d to wait for the clock", i+1)
+		}
+		clock.Advance(time.Hour)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if attempts != 3 {
+		t.Errorf("expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestCircuitBreakerManagerUsesClock(t *testing.T) {
+	clock := NewFakeClock(time.Now())
+	manager := NewCircuitBreakerManager(CircuitBreakerConfig{FailureThreshold: 1, SuccessThreshold: 1, Timeout: time.Hour, MaxRequests: 1})
+	existing := manager.GetCircuitBreaker("org/a:build")
+	manager.SetClock(clock)
+	created := manager.GetCircuitBreaker("org/b:build")
+
+	for _, breaker := range []*CircuitBreaker{existing, created} {
+		breaker.Call(func() error { return errors.New("failed") })
+		if breaker.Call(func() error { return nil }) == nil {
+			t.Fatal("expected the breaker to open after a failure")
+		}
+	}
+
+	clock.Advance(time.Hour)
+	for _, breaker := range []*CircuitBreaker{existing, created} {
+		if err := breaker.Call(func() error { return nil }); err != nil {
+			t.Errorf("expected the breaker to let a probe through after its open duration, got %v", err)
+		}
+	}
+
+	// Breakers that last failed long ago in fake time are stale
+	manager.CleanupStaleBreakers(time.Minute)
+	if len(manager.GetAllStats()) != 0 {
+		t.Errorf("expected stale breakers to be removed, got %v", manager.GetAllStats())
+	}
+}
+
+func TestFanOutStateManagerUsesClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := NewFakeClock(start)
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	manager.SetClock(clock)
+
+	state, err := manager.CreateFanOutState("fanout-1", "", "org/lib", "built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	if !state.StartTime.Equal(start) {
+		t.Errorf("expected the state to start at the fake time, got %v", state.StartTime)
+	}
+
+	state.AddChildWorkflow("org/app", "update", nil)
+	state.UpdateChildStatus("org/app", "update", ChildStatusRunning, "", "")
+	state.StartWaiting()
+	clock.Advance(time.Minute)
+	if lost := state.LostChildren(clock.Now()); len(lost) != 1 {
+		t.Errorf("expected the child to be lost after a minute without heartbeats, got %v", lost)
+	}
+	state.UpdateChildStatus("org/app", "update", ChildStatusCompleted, "", "")
+	if state.EndTime == nil || !state.EndTime.Equal(start.Add(time.Minute)) {
+		t.Errorf("expected the fan-out to end at the fake time, got %v", state.EndTime)
+	}
+
+	// Retention elapses in fake time
+	if err := manager.CleanupCompletedStates(time.Hour); err != nil {
+		t.Fatalf("CleanupCompletedStates() error = %v", err)
+	}
+	if _, err := manager.GetFanOutState("fanout-1"); err != nil {
+		t.Fatalf("expected the recent state to be kept, got %v", err)
+	}
+	clock.Advance(2 * time.Hour)
+	if err := manager.CleanupCompletedStates(time.Hour); err != nil {
+		t.Fatalf("CleanupCompletedStates() error = %v", err)
+	}
+	if _, err := manager.GetFanOutState("fanout-1"); err == nil {
+		t.Error("expected the state to be removed once its retention elapsed")
+	}
+}
+
+func TestRunnerUsesClock(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	cachedRepo := filepath.Join(cacheDir, "repos", "org", "repo", "main")
+	if err := os.MkdirAll(cachedRepo, 0755); err != nil {
+		t.Fatalf("Failed to create cached repo: %v", err)
+	}
+	takoYml := `version: "0.1.0"
+workflows:
+  build:
+    steps:
+      - id: compile
+        run: echo compiled
+`
+	if err := os.WriteFile(filepath.Join(cachedRepo, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      cacheDir,
+		Environment:   []string{"PATH=/usr/bin:/bin"},
+		Clock:         NewFakeClock(start),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "build", map[string]string{}, "org/repo")
+	if err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+	if !result.StartTime.Equal(start) || !result.EndTime.Equal(start) {
+		t.Errorf("expected the run to start and end at the fake time, got %v and %v", result.StartTime, result.EndTime)
+	}
+	for _, step := range result.Steps {
+		if !step.StartTime.Equal(start) || !step.EndTime.Equal(start) {
+			t.Errorf("expected step %s to start and end at the fake time, got %v and %v", step.ID, step.StartTime, step.EndTime)
+		}
+	}
+	if !runner.state.StartTime.Equal(start) {
+		t.Errorf("expected the execution state to start at the fake time, got %v", runner.state.StartTime)
+	}
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+)
+
+// conditionReferencePattern matches template-style references such as .inputs.version in step
+// conditions, so that they can be rewritten into the CEL variables inputs and steps.
+var conditionReferencePattern = regexp.MustCompile(`(^|[^\w)\].])\.(inputs|steps)\b`)
+
+// ConditionEvaluator evaluates the if: conditions of workflow steps as CEL expressions.
+// Conditions can reference the workflow inputs as inputs.<name>, with the types they are
+// declared with, and the outputs of previous steps as steps.<id>.<output>, and use the
+// functions of the tako CEL library.
+type ConditionEvaluator struct {
+	celEnv       *cel.Env
+	programCache *celProgramCache
+	clock        Clock // Clock of time.now(); the system clock when nil
+}
+
+// NewConditionEvaluator creates a new step condition evaluator.
+func NewConditionEvaluator() (*ConditionEvaluator, error) {
+	options := []cel.EnvOption{
+		cel.Variable("inputs", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("steps", cel.MapType(cel.StringType, cel.MapType(cel.StringType, cel.StringType))),
+	}
+	ce := &ConditionEvaluator{programCache: newCELProgramCache(100)}
+	env, err := cel.NewEnv(append(options, celFunctionLibrary(ce.now)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
+	}
+	ce.celEnv = env
+	return ce, nil
+}
+
+// SetClock sets the clock time.now() reads in conditions.
+func (ce *ConditionEvaluator) SetClock(clock Clock) {
+	ce.clock = clock
+}
+
+// now returns the time of the evaluator's clock.
+func (ce *ConditionEvaluator) now() time.Time {
+	return clockOrSystem(ce.clock).Now()
+}
+
+// Evaluate reports whether a step condition holds. An empty condition always holds.
+func (ce *ConditionEvaluator) Evaluate(condition string, inputs map[string]interface{}, stepOutputs map[string]map[string]string) (bool, error) {
+	expr := normalizeCondition(condition)
+	if expr == "" {
+		return true, nil
+	}
+
+	program, found := ce.programCache.get(expr)
+	if !found {
+		ast, issues := ce.celEnv.Compile(expr)
+		if issues != nil && issues.Err() != nil {
+			return false, fmt.Errorf("CEL compilation error: %v", issues.Err())
+		}
+
+		var err error
+		program, err = ce.celEnv.Program(ast)
+		if err != nil {
+			return false, fmt.Errorf("CEL program creation error: %v", err)
+		}
+		ce.programCache.put(expr, program)
+	}
+
+	if inputs == nil {
+		inputs = map[string]interface{}{}
+	}
+	if stepOutputs == nil {
+		stepOutputs = map[string]map[string]string{}
+	}
+
+	result, _, err := program.Eval(map[string]interface{}{
+		"inputs": inputs,
+		"steps":  stepOutputs,
+	})
+	if err != nil {
+		return false, fmt.Errorf("CEL evaluation error: %v", err)
+	}
+
+	if result.Type() != types.BoolType {
+		return false, fmt.Errorf("condition must return boolean, got %v", result.Type())
+	}
+
+	return result.Value().(bool), nil
+}
+
+// normalizeCondition trims a condition and rewrites template-style references
+// (.inputs.name, .steps.id.output) into CEL variable references.
+func normalizeCondition(condition string) string {
+	return conditionReferencePattern.ReplaceAllString(strings.TrimSpace(condition), "${1}${2}")
+}
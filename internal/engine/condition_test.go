@@ -0,0 +1,69 @@
+package engine
+
+import (
+	"testing"
+)
+
+func TestConditionEvaluator_Evaluate(t *testing.T) {
+	evaluator, err := NewConditionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create condition evaluator: %v", err)
+	}
+
+	inputs := map[string]interface{}{
+		"version":              "1.4.0",
+		"has_breaking_changes": "false",
+		"replicas":             int64(3),
+		"targets":              []interface{}{"eu", "us"},
+	}
+	stepOutputs := map[string]map[string]string{
+		"build": {"status": "ok"},
+	}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+		wantErr   bool
+	}{
+		{"empty condition", "  ", true, false},
+		{"input comparison", "inputs.has_breaking_changes == 'true'", false, false},
+		{"template-style reference", ".inputs.version != 'none'", true, false},
+		{"negated template-style reference", "!(.inputs.has_breaking_changes == 'true')", true, false},
+		{"step output", ".steps.build.status == 'ok'", true, false},
+		{"semver helper", "semver.minor(inputs.version) >= 4", true, false},
+		{"typed inputs", "inputs.replicas > 2 && 'us' in inputs.targets", true, false},
+		{"missing input", "inputs.missing == 'x'", false, true},
+		{"non-boolean result", "inputs.version", false, true},
+		{"syntax error", "inputs.version ==", false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluator.Evaluate(tt.condition, inputs, stepOutputs)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Evaluate(%q) error = %v, wantErr %v", tt.condition, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Evaluate(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeCondition(t *testing.T) {
+	tests := map[string]string{
+		".inputs.version":                    "inputs.version",
+		"!.inputs.flag":                      "!inputs.flag",
+		"a.inputs.x == .steps.s.out":         "a.inputs.x == steps.s.out",
+		"size(.inputs.list) > 0":             "size(inputs.list) > 0",
+		"  inputs.version == 'a.inputs'   ":  "inputs.version == 'a.inputs'",
+		"payload.inputs == 1 && .steps.a.b ": "payload.inputs == 1 && steps.a.b",
+	}
+
+	for condition, want := range tests {
+		if got := normalizeCondition(condition); got != want {
+			t.Errorf("normalizeCondition(%q) = %q, want %q", condition, got, want)
+		}
+	}
+}
@@ -0,0 +1,334 @@
+package engine
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// payloadReferencePattern matches the payload fields read by input templates, transforms and
+// filters: {{ .payload.field }} in templates and event.payload.field in CEL expressions.
+var payloadReferencePattern = regexp.MustCompile(`\bpayload\.([a-zA-Z_][a-zA-Z0-9_]*)`)
+
+// EmittedEvent is an event emitted by a step of a workflow, through a fan-out or the events of
+// its produces section.
+type EmittedEvent struct {
+	Repository string
+	Workflow   string
+	Step       string
+	Type       string
+	// Payload holds the names of the payload fields, sorted.
+	Payload []string
+	// SchemaVersion is the schema version the event is emitted with, if any.
+	SchemaVersion string
+	// PayloadTypes maps the payload fields to the JSON type of their value; templates are strings.
+	PayloadTypes map[string]string
+}
+
+// ConsistencyIssue is a problem found by the cross-repository checks of a tako.yml.
+type ConsistencyIssue struct {
+	SubscriptionIssue
+	// Warning marks the issues that do not break a run, such as events that no subscription
+	// receives yet.
+	Warning bool `json:"warning,omitempty"`
+}
+
+// ListEmittedEvents returns the events emitted by the steps of the workflows of a tako.yml,
+// including parallel steps and hooks, sorted by workflow.
+func ListEmittedEvents(repository string, cfg *config.Config) []EmittedEvent {
+	var events []EmittedEvent
+	var visit func(workflow string, steps []config.WorkflowStep)
+	visit = func(workflow string, steps []config.WorkflowStep) {
+		for _, step := range steps {
+			if strings.HasPrefix(step.Uses, "tako/fan-out@") {
+				if eventType, ok := step.With["event_type"].(string); ok && eventType != "" {
+					payload, _ := step.With["payload"].(map[string]interface{})
+					schemaVersion, _ := step.With["schema_version"].(string)
+					events = append(events, EmittedEvent{
+						Repository: repository, Workflow: workflow, Step: step.ID, Type: eventType, Payload: sortedKeys(payload),
+						SchemaVersion: schemaVersion, PayloadTypes: payloadTypes(payload),
+					})
+				}
+				// Batch fan-outs emit each of their events
+				if batch, err := parseFanOutEvents(step.With["events"]); err == nil {
+					for _, event := range batch {
+						events = append(events, EmittedEvent{
+							Repository: repository, Workflow: workflow, Step: step.ID, Type: event.EventType, Payload: sortedKeys(event.Payload),
+							SchemaVersion: event.SchemaVersion, PayloadTypes: payloadTypes(event.Payload),
+						})
+					}
+				}
+			}
+			if step.Produces != nil {
+				for _, event := range step.Produces.Events {
+					types := make(map[string]string, len(event.Payload))
+					for field := range event.Payload {
+						types[field] = config.PayloadFieldString
+					}
+					events = append(events, EmittedEvent{
+						Repository: repository, Workflow: workflow, Step: step.ID, Type: event.Type, Payload: sortedKeys(event.Payload),
+						SchemaVersion: event.SchemaVersion, PayloadTypes: types,
+					})
+				}
+			}
+			visit(workflow, step.Parallel)
+			visit(workflow, step.OnFailure)
+		}
+	}
+
+	names := make([]string, 0, len(cfg.Workflows))
+	for name := range cfg.Workflows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		workflow := cfg.Workflows[name]
+		visit(name, workflow.Steps)
+		visit(name, workflow.OnSuccess)
+		visit(name, workflow.OnFailure)
+	}
+	return events
+}
+
+// sortedKeys returns the keys of a map, sorted.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckConsistency checks a tako.yml against the subscriptions of the cached repositories.
+// Besides the issues of LintSubscriptions, applied to the subscriptions of the tako.yml too, it
+// reports the events the tako.yml emits that no subscription receives, as warnings, and the
+// payload fields that subscriptions read but that no emitter of their events provides.
+//
+// The repository identifies the tako.yml as "owner/repo". When it is empty, the subscriptions
+// receiving its events are those to their type from any repository, and the payloads of its
+// events are not checked.
+func (dm *DiscoveryManager) CheckConsistency(repository string, cfg *config.Config, evaluator *SubscriptionEvaluator) ([]ConsistencyIssue, error) {
+	repositories, configs, loadIssues, err := dm.loadCachedConfigs()
+	if err != nil {
+		return nil, err
+	}
+	label := repository
+	if label == "" {
+		label = "tako.yml"
+	}
+	if repository != "" {
+		if _, cached := configs[repository]; !cached {
+			repositories = append(repositories, repository)
+		}
+		// The tako.yml being validated replaces the cached copy of its repository
+		configs[repository] = cfg
+	}
+
+	var issues []ConsistencyIssue
+	for _, issue := range loadIssues {
+		if issue.Repository != repository {
+			issues = append(issues, ConsistencyIssue{SubscriptionIssue: issue})
+		}
+	}
+
+	// Subscriptions of the cached repositories and of the tako.yml
+	type subscriber struct {
+		repository string
+		cfg        *config.Config
+	}
+	subscribers := make([]subscriber, 0, len(repositories)+1)
+	for _, name := range repositories {
+		if configs[name] != nil {
+			subscribers = append(subscribers, subscriber{name, configs[name]})
+		}
+	}
+	if repository == "" {
+		subscribers = append(subscribers, subscriber{label, cfg})
+	}
+
+	// Emitters of each event, keyed by "owner/repo:type"
+	emitters := make(map[string][]EmittedEvent)
+	for _, name := range repositories {
+		if configs[name] == nil {
+			continue
+		}
+		for _, event := range ListEmittedEvents(name, configs[name]) {
+			key := name + ":" + event.Type
+			emitters[key] = append(emitters[key], event)
+		}
+	}
+
+	received := make(map[string]bool)
+	for _, sub := range subscribers {
+		for i, subscription := range sub.cfg.Subscriptions {
+			messages := lintSubscription(subscription, sub.cfg, configs, evaluator)
+			messages = append(messages, checkPayloadReferences(subscription, emitters)...)
+			messages = append(messages, checkConsumedContract(subscription, configs, emitters, evaluator)...)
+			for _, message := range messages {
+				issues = append(issues, ConsistencyIssue{SubscriptionIssue: SubscriptionIssue{
+					Repository: sub.repository,
+					Index:      i,
+					Artifact:   subscription.Artifact,
+					Workflow:   subscription.Workflow,
+					Message:    message,
+				}})
+			}
+
+			artifactRepository, _, _ := strings.Cut(subscription.Artifact, ":")
+			for _, eventType := range subscription.Events {
+				received[artifactRepository+":"+eventType] = true
+				received[":"+eventType] = true
+			}
+		}
+	}
+
+	var schemas []config.EventPayloadSchema
+	if cfg.Events != nil {
+		schemas = cfg.Events.Schemas
+	}
+	for _, event := range ListEmittedEvents(repository, cfg) {
+		if schema := findEventSchema(schemas, event.Type, event.SchemaVersion); schema != nil {
+			for _, violation := range checkPayloadSchema(schema, event.PayloadTypes) {
+				issues = append(issues, ConsistencyIssue{SubscriptionIssue: SubscriptionIssue{
+					Repository: label,
+					Index:      -1,
+					Workflow:   event.Workflow,
+					Message:    fmt.Sprintf("workflow '%s' emits event '%s' violating its payload schema: %s", event.Workflow, event.Type, violation),
+				}})
+			}
+		}
+		if received[repository+":"+event.Type] {
+			continue
+		}
+		issues = append(issues, ConsistencyIssue{
+			SubscriptionIssue: SubscriptionIssue{
+				Repository: label,
+				Index:      -1,
+				Workflow:   event.Workflow,
+				Message:    fmt.Sprintf("workflow '%s' emits event '%s' that no cached subscription receives", event.Workflow, event.Type),
+			},
+			Warning: true,
+		})
+	}
+
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Repository != issues[j].Repository {
+			return issues[i].Repository < issues[j].Repository
+		}
+		return issues[i].Index < issues[j].Index
+	})
+	return issues, nil
+}
+
+// checkPayloadReferences reports the payload fields a subscription reads that none of the
+// emitters of its events provides. Events without known emitters are not checked.
+func checkPayloadReferences(subscription config.Subscription, emitters map[string][]EmittedEvent) []string {
+	artifactRepository, _, _ := strings.Cut(subscription.Artifact, ":")
+
+	var messages []string
+	for _, eventType := range subscription.Events {
+		events := emitters[artifactRepository+":"+eventType]
+		if len(events) == 0 {
+			continue
+		}
+
+		provided := make(map[string]bool)
+		for _, event := range events {
+			for _, field := range event.Payload {
+				provided[field] = true
+			}
+		}
+		var missing []string
+		for _, field := range subscriptionPayloadReferences(subscription) {
+			if !provided[field] {
+				missing = append(missing, field)
+			}
+		}
+		for _, field := range missing {
+			messages = append(messages, fmt.Sprintf("payload field '%s' is not emitted with event '%s' by %s", field, eventType, artifactRepository))
+		}
+	}
+	return messages
+}
+
+// checkConsumedContract reports the fields a subscription consumes that the emitter of its events
+// does not guarantee: fields missing from, or typed differently by, the payload schemas the
+// emitter declares for the event at the versions the subscription accepts or, when it declares
+// none, the payloads it emits.
+func checkConsumedContract(subscription config.Subscription, configs map[string]*config.Config, emitters map[string][]EmittedEvent, evaluator *SubscriptionEvaluator) []string {
+	if len(subscription.Consumes) == 0 {
+		return nil
+	}
+	artifactRepository, _, _ := strings.Cut(subscription.Artifact, ":")
+
+	var messages []string
+	for _, eventType := range subscription.Events {
+		var schemas []config.EventPayloadSchema
+		if emitter := configs[artifactRepository]; emitter != nil && emitter.Events != nil {
+			for _, schema := range emitter.Events.Schemas {
+				if schema.Type != eventType {
+					continue
+				}
+				if compatible, err := evaluator.CheckSchemaCompatibility(schema.SchemaVersion, subscription.SchemaVersion); err == nil && compatible {
+					schemas = append(schemas, schema)
+				}
+			}
+		}
+
+		if len(schemas) > 0 {
+			for _, schema := range schemas {
+				version := ""
+				if schema.SchemaVersion != "" {
+					version = " " + schema.SchemaVersion
+				}
+				for _, field := range sortedKeys(subscription.Consumes) {
+					declared, ok := schema.Fields[field]
+					switch {
+					case !ok:
+						messages = append(messages, fmt.Sprintf("consumed field '%s' is not declared by the schema%s of event '%s' of %s", field, version, eventType, artifactRepository))
+					case declared != subscription.Consumes[field]:
+						messages = append(messages, fmt.Sprintf("consumed field '%s' is of type %s in the schema%s of event '%s' of %s, expected %s", field, declared, version, eventType, artifactRepository, subscription.Consumes[field]))
+					}
+				}
+			}
+			continue
+		}
+
+		for _, event := range emitters[artifactRepository+":"+eventType] {
+			for _, violation := range checkConsumedFields(subscription.Consumes, event.PayloadTypes) {
+				messages = append(messages, fmt.Sprintf("event '%s' emitted by workflow '%s' of %s breaks the contract: %s", eventType, event.Workflow, artifactRepository, violation))
+			}
+		}
+	}
+	return messages
+}
+
+// subscriptionPayloadReferences returns the payload fields read by the inputs, transform and
+// filters of a subscription, sorted.
+func subscriptionPayloadReferences(subscription config.Subscription) []string {
+	expressions := append([]string(nil), subscription.Filters...)
+	for _, input := range subscription.Inputs {
+		expressions = append(expressions, input)
+	}
+	if subscription.Transform != nil {
+		for _, input := range subscription.Transform.Inputs {
+			expressions = append(expressions, input)
+		}
+	}
+
+	var fields []string
+	for _, expression := range expressions {
+		for _, match := range payloadReferencePattern.FindAllStringSubmatch(expression, -1) {
+			if !slices.Contains(fields, match[1]) {
+				fields = append(fields, match[1])
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+const consistencyLibraryYml = `version: "1.0"
+artifacts:
+  lib:
+    path: "."
+workflows:
+  release:
+    steps:
+      - id: build
+        run: echo "build"
+        produces:
+          events:
+            - type: library_built
+              payload:
+                version: "{{ .Inputs.version }}"
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_released
+          payload:
+            version: "1.0.0"
+            changelog: "notes"
+      - id: checks
+        parallel:
+          - id: docs
+            uses: tako/fan-out@v1
+            with:
+              event_type: docs_published
+`
+
+func TestListEmittedEvents(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tako.yml")
+	if err := os.WriteFile(path, []byte(consistencyLibraryYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load tako.yml: %v", err)
+	}
+
+	events := ListEmittedEvents("test-org/library", cfg)
+	if len(events) != 3 {
+		t.Fatalf("Expected 3 events, got %+v", events)
+	}
+	if events[0].Type != "library_built" || events[0].Step != "build" || strings.Join(events[0].Payload, ",") != "version" {
+		t.Errorf("Unexpected produced event: %+v", events[0])
+	}
+	if events[1].Type != "library_released" || strings.Join(events[1].Payload, ",") != "changelog,version" {
+		t.Errorf("Unexpected fan-out event: %+v", events[1])
+	}
+	if events[2].Type != "docs_published" || events[2].Step != "docs" || events[2].Repository != "test-org/library" {
+		t.Errorf("Unexpected parallel fan-out event: %+v", events[2])
+	}
+
+	// Batch fan-outs emit each of their events
+	batchYml := `version: "1.0"
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          events:
+            - event_type: library_released
+              payload:
+                version: "1.0.0"
+            - event_type: docs_published
+`
+	if err := os.WriteFile(path, []byte(batchYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	cfg, err = config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load tako.yml: %v", err)
+	}
+	events = ListEmittedEvents("test-org/library", cfg)
+	if len(events) != 2 || events[0].Type != "library_released" || strings.Join(events[0].Payload, ",") != "version" || events[1].Type != "docs_published" || events[1].Step != "publish" {
+		t.Errorf("Unexpected batch fan-out events: %+v", events)
+	}
+}
+
+func TestDiscoveryManager_CheckConsistency(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    inputs:
+      version:
+        type: string
+      commit:
+        type: string
+    steps:
+      - run: echo "update"
+subscriptions:
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "update"
+    filters:
+      - "event.payload.version != ''"
+    inputs:
+      version: "{{ .payload.version }}"
+      commit: "{{ .payload.commit }}"
+  - artifact: "test-org/library:lib"
+    events: ["library_released"]
+    schema_version: "not-a-range"
+    workflow: "missing"
+`)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tako.yml")
+	if err := os.WriteFile(path, []byte(consistencyLibraryYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load tako.yml: %v", err)
+	}
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	issues, err := NewDiscoveryManager(cacheDir).CheckConsistency("test-org/library", cfg, evaluator)
+	if err != nil {
+		t.Fatalf("CheckConsistency failed: %v", err)
+	}
+
+	var errs, warnings []string
+	for _, issue := range issues {
+		if issue.Warning {
+			warnings = append(warnings, issue.String())
+		} else {
+			errs = append(errs, issue.String())
+		}
+	}
+	for _, expected := range []string{
+		"subscription 0 (test-org/library:lib -> update): payload field 'commit' is not emitted with event 'library_built' by test-org/library",
+		"subscription 1 (test-org/library:lib -> missing): workflow 'missing' does not exist",
+		"subscription 1 (test-org/library:lib -> missing): invalid schema version: invalid version range format",
+	} {
+		if !containsIssue(errs, expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, errs)
+		}
+	}
+	if containsIssue(errs, "payload field 'version'") {
+		t.Errorf("Expected the emitted payload field not to be reported, got %v", errs)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "test-org/library: workflow 'release' emits event 'docs_published' that no cached subscription receives") {
+		t.Errorf("Expected a warning for the unsubscribed event only, got %v", warnings)
+	}
+
+	// Without a repository, the payloads of the tako.yml are unknown and events match by type
+	issues, err = NewDiscoveryManager(cacheDir).CheckConsistency("", cfg, evaluator)
+	if err != nil {
+		t.Fatalf("CheckConsistency failed: %v", err)
+	}
+	for _, issue := range issues {
+		if strings.Contains(issue.Message, "payload field") {
+			t.Errorf("Expected payloads not to be checked, got %v", issue)
+		}
+		if issue.Warning && !strings.Contains(issue.Message, "docs_published") {
+			t.Errorf("Unexpected warning: %v", issue)
+		}
+	}
+}
+
+func TestDiscoveryManager_CheckConsistencyContracts(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    steps:
+      - run: echo "update"
+subscriptions:
+  - artifact: "test-org/library:lib"
+    events: ["library_released"]
+    workflow: "update"
+    consumes:
+      version: string
+      size: number
+      commit: string
+  - artifact: "test-org/library:lib"
+    events: ["docs_published"]
+    workflow: "update"
+    consumes:
+      url: string
+      pages: number
+`)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tako.yml")
+	if err := os.WriteFile(path, []byte(`version: "1.0"
+artifacts:
+  lib:
+    path: "."
+events:
+  schemas:
+    - type: library_released
+      schema_version: 1.0.0
+      fields:
+        version: string
+        size: string
+      required: [version]
+workflows:
+  release:
+    steps:
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_released
+          payload:
+            size: 12
+      - id: docs
+        uses: tako/fan-out@v1
+        with:
+          event_type: docs_published
+          payload:
+            url: "https://docs"
+            pages: "{{ .Steps.build.pages }}"
+`), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load tako.yml: %v", err)
+	}
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	issues, err := NewDiscoveryManager(cacheDir).CheckConsistency("test-org/library", cfg, evaluator)
+	if err != nil {
+		t.Fatalf("CheckConsistency failed: %v", err)
+	}
+	var errs []string
+	for _, issue := range issues {
+		if !issue.Warning {
+			errs = append(errs, issue.String())
+		}
+	}
+	for _, expected := range []string{
+		// The emitter breaks its own schema
+		"workflow 'release' emits event 'library_released' violating its payload schema: required field 'version' is missing",
+		"workflow 'release' emits event 'library_released' violating its payload schema: field 'size' is of type number, expected string",
+		// Subscribers are checked against the declared schema
+		"consumed field 'commit' is not declared by the schema 1.0.0 of event 'library_released' of test-org/library",
+		"consumed field 'size' is of type string in the schema 1.0.0 of event 'library_released' of test-org/library, expected number",
+		// or against the emitted payloads when the event has no schema
+		"event 'docs_published' emitted by workflow 'release' of test-org/library breaks the contract: consumed field 'pages' is of type string, expected number",
+	} {
+		if !containsIssue(errs, expected) {
+			t.Errorf("Expected an error containing %q, got %v", expected, errs)
+		}
+	}
+	if containsIssue(errs, "consumed field 'version'") || containsIssue(errs, "consumed field 'url'") {
+		t.Errorf("Expected the fields honoring the contract not to be reported, got %v", errs)
+	}
+}
+
+// containsIssue reports whether one of the issues contains a message.
+func containsIssue(issues []string, message string) bool {
+	for _, issue := range issues {
+		if strings.Contains(issue, message) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,9 +3,11 @@ package engine
 import (
 	"context"
 	"fmt"
+	"io"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,16 +18,17 @@ import (
 type ContainerRuntime string
 
 const (
-	RuntimeDocker ContainerRuntime = "docker"
-	RuntimePodman ContainerRuntime = "podman"
-	RuntimeNone   ContainerRuntime = "none"
+	RuntimeDocker  ContainerRuntime = "docker"
+	RuntimePodman  ContainerRuntime = "podman"
+	RuntimeNerdctl ContainerRuntime = "nerdctl"
+	RuntimeNone    ContainerRuntime = "none"
 )
 
 // ContainerConfig holds configuration for container execution.
 type ContainerConfig struct {
 	Image        string
 	Command      []string
-	Entrypoint   []string
+	Entrypoint   []string // The image entrypoint followed by its leading arguments
 	WorkDir      string
 	Env          map[string]string
 	Volumes      []VolumeMount
@@ -33,6 +36,13 @@ type ContainerConfig struct {
 	Capabilities []string
 	Resources    *ResourceLimits
 	Security     *SecurityConfig
+	User         string // Overrides Security.RunAsUser when set
+	PullPolicy   string
+
+	// Stdout and Stderr receive the output of the container as it is produced, instead of the
+	// result
+	Stdout io.Writer
+	Stderr io.Writer
 }
 
 // VolumeMount represents a volume mount configuration.
@@ -63,6 +73,7 @@ type SecurityConfig struct {
 // ContainerManager handles container operations with security hardening.
 type ContainerManager struct {
 	runtime         ContainerRuntime
+	rootless        bool // Whether the runtime maps container users to the invoking user
 	securityManager *SecurityManager
 	registryManager *RegistryManager
 	defaultProfile  SecurityProfile
@@ -71,22 +82,48 @@ type ContainerManager struct {
 
 // NewContainerManager creates a new container manager with runtime auto-detection.
 func NewContainerManager(debug bool) (*ContainerManager, error) {
-	runtime, err := detectContainerRuntime()
+	return NewContainerManagerWithRuntime("", debug)
+}
+
+// NewContainerManagerWithRuntime creates a new container manager using the given runtime, or
+// the first available one when runtime is empty or "auto". A runtime that was asked for
+// explicitly must be available; there is no fallback to another one.
+func NewContainerManagerWithRuntime(runtime ContainerRuntime, debug bool) (*ContainerManager, error) {
+	runtime, err := ParseContainerRuntime(string(runtime))
 	if err != nil {
-		return nil, fmt.Errorf("failed to detect container runtime: %w", err)
+		return nil, err
 	}
 
 	if runtime == RuntimeNone {
-		return nil, fmt.Errorf("no supported container runtime found (docker or podman required)")
+		runtime, err = detectContainerRuntime()
+		if err != nil {
+			return nil, fmt.Errorf("failed to detect container runtime: %w", err)
+		}
+		if runtime == RuntimeNone {
+			return nil, fmt.Errorf("no supported container runtime found (docker, podman or nerdctl required)")
+		}
+	} else if err := checkContainerRuntime(runtime); err != nil {
+		return nil, fmt.Errorf("container runtime %s is not available: %w", runtime, err)
 	}
 
 	return &ContainerManager{
 		runtime:        runtime,
+		rootless:       detectRootless(runtime),
 		defaultProfile: SecurityProfileModerate,
 		debug:          debug,
 	}, nil
 }
 
+// Runtime returns the container runtime used by the manager.
+func (cm *ContainerManager) Runtime() ContainerRuntime {
+	return cm.runtime
+}
+
+// Rootless reports whether the runtime runs rootless.
+func (cm *ContainerManager) Rootless() bool {
+	return cm.rootless
+}
+
 // WithSecurityManager sets the security manager.
 func (cm *ContainerManager) WithSecurityManager(sm *SecurityManager) *ContainerManager {
 	cm.securityManager = sm
@@ -99,37 +136,6 @@ func (cm *ContainerManager) WithRegistryManager(rm *RegistryManager) *ContainerM
 	return cm
 }
 
-// detectContainerRuntime auto-detects available container runtime.
-// Returns error for interface consistency (currently always nil).
-//
-//nolint:unparam // Error return maintained for interface consistency
-func detectContainerRuntime() (ContainerRuntime, error) {
-	// Check for Docker first
-	if _, err := exec.LookPath("docker"); err == nil {
-		// Verify Docker is actually running
-		cmd := exec.Command("docker", "version", "--format", "{{.Server.Version}}")
-		if err := cmd.Run(); err == nil {
-			return RuntimeDocker, nil
-		}
-	}
-
-	// Check for Podman
-	if _, err := exec.LookPath("podman"); err == nil {
-		// Verify Podman is accessible
-		cmd := exec.Command("podman", "version", "--format", "{{.Server.Version}}")
-		if err := cmd.Run(); err == nil {
-			return RuntimePodman, nil
-		}
-		// Podman might work in rootless mode without server
-		cmd = exec.Command("podman", "info", "--format", "{{.Version.Version}}")
-		if err := cmd.Run(); err == nil {
-			return RuntimePodman, nil
-		}
-	}
-
-	return RuntimeNone, nil
-}
-
 // ValidateContainerConfig validates container configuration early.
 func (cm *ContainerManager) ValidateContainerConfig(step config.WorkflowStep) error {
 	if step.Image == "" {
@@ -231,16 +237,37 @@ func (cm *ContainerManager) BuildContainerConfig(step config.WorkflowStep, workD
 		return nil, err
 	}
 
+	options := step.Container
+	if options == nil {
+		options = &config.ContainerOptions{}
+	}
+
 	config := &ContainerConfig{
 		Image:   step.Image,
 		WorkDir: "/workspace",
 		Env:     make(map[string]string),
 	}
 
-	// Set command/entrypoint
-	if step.Run != "" {
-		config.Command = []string{"sh", "-c", step.Run}
+	// Set command/entrypoint; a custom entrypoint replaces the default shell
+	if len(options.Entrypoint) > 0 {
+		config.Entrypoint = options.Entrypoint
+		if step.Run != "" {
+			config.Command = []string{step.Run}
+		}
+	} else if step.Run != "" {
+		// Containers run Linux images, so steps run with sh unless they choose a shell
+		shell := step.Shell
+		if shell == "" {
+			shell = "sh"
+		}
+		config.Command = shellArgs(shell, step.Run)
+	}
+
+	if options.WorkDir != "" {
+		config.WorkDir = options.WorkDir
 	}
+	config.User = options.User
+	config.PullPolicy = options.PullPolicy
 
 	// Copy environment variables
 	for k, v := range env {
@@ -266,7 +293,7 @@ func (cm *ContainerManager) BuildContainerConfig(step config.WorkflowStep, workD
 	}
 
 	// Add any additional volumes from step configuration
-	for _, vol := range step.Volumes {
+	for _, vol := range slices.Concat(step.Volumes, options.Volumes) {
 		// Validate volume paths for security
 		if err := validateVolumePath(vol.Source); err != nil {
 			return nil, fmt.Errorf("invalid volume source path: %w", err)
@@ -294,6 +321,9 @@ func (cm *ContainerManager) BuildContainerConfig(step config.WorkflowStep, workD
 	if step.Network != "" {
 		config.Network = step.Network
 	}
+	if options.Network != "" {
+		config.Network = options.Network
+	}
 
 	// Configure security settings with secure defaults
 	config.Security = &SecurityConfig{
@@ -378,6 +408,12 @@ func (cm *ContainerManager) RunContainer(ctx context.Context, containerConfig *C
 	var stdout, stderr strings.Builder
 	cmd.Stdout = &stdout
 	cmd.Stderr = &stderr
+	if containerConfig.Stdout != nil {
+		cmd.Stdout = containerConfig.Stdout
+	}
+	if containerConfig.Stderr != nil {
+		cmd.Stderr = containerConfig.Stderr
+	}
 
 	// Execute container
 	err = cmd.Run()
@@ -391,6 +427,14 @@ func (cm *ContainerManager) RunContainer(ctx context.Context, containerConfig *C
 		EndTime:       time.Now(),
 	}
 
+	// A cancelled run only kills the runtime client, so stop the container itself
+	if ctx.Err() != nil {
+		if cleanupErr := cm.cleanupContainer(containerName); cleanupErr != nil && cm.debug {
+			fmt.Printf("Warning: failed to stop cancelled container %s: %v\n", containerName, cleanupErr)
+		}
+		return result, fmt.Errorf("container %s was stopped: %w", containerName, context.Cause(ctx))
+	}
+
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			result.ExitCode = exitError.ExitCode()
@@ -433,8 +477,10 @@ func (cm *ContainerManager) buildRunCommand(containerName string, config *Contai
 	if config.Security != nil {
 		security := config.Security
 
-		// Run as non-root user
-		args = append(args, "--user", fmt.Sprintf("%d:%d", security.RunAsUser, security.RunAsUser))
+		// Run as non-root user, unless the step chose its own user
+		if config.User == "" {
+			args = append(args, cm.defaultUserArgs(security.RunAsUser)...)
+		}
 
 		// Read-only root filesystem
 		if security.ReadOnlyRootFS {
@@ -462,9 +508,18 @@ func (cm *ContainerManager) buildRunCommand(containerName string, config *Contai
 		}
 	}
 
+	if config.User != "" {
+		args = append(args, "--user", config.User)
+	}
+
 	// Network configuration
 	args = append(args, "--network", config.Network)
 
+	// Entrypoint override
+	if len(config.Entrypoint) > 0 {
+		args = append(args, "--entrypoint", config.Entrypoint[0])
+	}
+
 	// Working directory
 	if config.WorkDir != "" {
 		args = append(args, "--workdir", config.WorkDir)
@@ -497,7 +552,10 @@ func (cm *ContainerManager) buildRunCommand(containerName string, config *Contai
 	// Container image
 	args = append(args, config.Image)
 
-	// Command and arguments
+	// Leading entrypoint arguments, then the command and arguments
+	if len(config.Entrypoint) > 1 {
+		args = append(args, config.Entrypoint[1:]...)
+	}
 	if len(config.Command) > 0 {
 		args = append(args, config.Command...)
 	}
@@ -512,6 +570,29 @@ func (cm *ContainerManager) cleanupContainer(containerName string) error {
 	return cmd.Run()
 }
 
+// EnsureImage makes an image available according to a step's pull policy: "never" uses the
+// local image as is, "always" pulls it on every run, and "missing" (the default) only pulls
+// images that are not available locally.
+func (cm *ContainerManager) EnsureImage(ctx context.Context, image, pullPolicy string) error {
+	switch pullPolicy {
+	case config.PullPolicyNever:
+		return nil
+	case config.PullPolicyAlways:
+		return cm.pullImage(ctx, image)
+	default:
+		if cm.imageExists(ctx, image) {
+			return nil
+		}
+		return cm.PullImage(ctx, image)
+	}
+}
+
+// imageExists reports whether an image is available in the local image store of the runtime.
+func (cm *ContainerManager) imageExists(ctx context.Context, image string) bool {
+	cmd := exec.CommandContext(ctx, string(cm.runtime), "image", "inspect", image)
+	return cmd.Run() == nil
+}
+
 // PullImage pulls a container image if not already present.
 func (cm *ContainerManager) PullImage(ctx context.Context, image string) error {
 	// Check cache first if registry manager is available
@@ -525,6 +606,11 @@ func (cm *ContainerManager) PullImage(ctx context.Context, image string) error {
 		}
 	}
 
+	return cm.pullImage(ctx, image)
+}
+
+// pullImage pulls a container image from its registry.
+func (cm *ContainerManager) pullImage(ctx context.Context, image string) error {
 	if cm.debug {
 		fmt.Printf("Pulling container image: %s\n", image)
 	}
@@ -539,8 +625,8 @@ func (cm *ContainerManager) PullImage(ctx context.Context, image string) error {
 		if err == nil && authStr != "" {
 			// For Docker, use --auth flag; for Podman use --creds
 			switch cm.runtime {
-			case RuntimeDocker:
-				// Docker doesn't support inline auth, we need to login first
+			case RuntimeDocker, RuntimeNerdctl:
+				// Docker and nerdctl don't support inline auth, we need to login first
 				creds, _ := cm.registryManager.GetCredentials(registry)
 				if creds != nil && creds.Username != "" && creds.Password != "" {
 					// Login to registry
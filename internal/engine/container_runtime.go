@@ -0,0 +1,112 @@
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// supportedRuntimes lists the container runtimes in the order they are auto-detected.
+var supportedRuntimes = []ContainerRuntime{RuntimeDocker, RuntimePodman, RuntimeNerdctl}
+
+// ParseContainerRuntime parses a runtime name as given by the --container-runtime flag or the
+// TAKO_CONTAINER_RUNTIME environment variable. An empty name or "auto" selects auto-detection,
+// which is returned as RuntimeNone.
+func ParseContainerRuntime(name string) (ContainerRuntime, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "auto", string(RuntimeNone):
+		return RuntimeNone, nil
+	case string(RuntimeDocker):
+		return RuntimeDocker, nil
+	case string(RuntimePodman):
+		return RuntimePodman, nil
+	case string(RuntimeNerdctl):
+		return RuntimeNerdctl, nil
+	default:
+		return RuntimeNone, fmt.Errorf("unsupported container runtime '%s', must be one of: auto, docker, podman, nerdctl", name)
+	}
+}
+
+// detectContainerRuntime auto-detects available container runtime.
+// Returns error for interface consistency (currently always nil).
+//
+//nolint:unparam // Error return maintained for interface consistency
+func detectContainerRuntime() (ContainerRuntime, error) {
+	for _, runtime := range supportedRuntimes {
+		if checkContainerRuntime(runtime) == nil {
+			return runtime, nil
+		}
+	}
+
+	return RuntimeNone, nil
+}
+
+// checkContainerRuntime verifies that a runtime is installed and can reach its engine.
+func checkContainerRuntime(runtime ContainerRuntime) error {
+	if _, err := exec.LookPath(string(runtime)); err != nil {
+		return fmt.Errorf("%s not found in PATH", runtime)
+	}
+
+	var args []string
+	switch runtime {
+	case RuntimeDocker:
+		args = []string{"version", "--format", "{{.Server.Version}}"}
+	case RuntimePodman:
+		// Rootless Podman has no server to report a version, so ask for its own
+		args = []string{"info", "--format", "{{.Version.Version}}"}
+	default:
+		args = []string{"info"}
+	}
+
+	if output, err := exec.Command(string(runtime), args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s is not usable: %v: %s", runtime, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// detectRootless reports whether a runtime runs rootless, in which case container users are
+// mapped to the user invoking it rather than to the same uid on the host.
+func detectRootless(runtime ContainerRuntime) bool {
+	var args []string
+	switch runtime {
+	case RuntimePodman:
+		args = []string{"info", "--format", "{{.Host.Security.Rootless}}"}
+	case RuntimeDocker, RuntimeNerdctl:
+		args = []string{"info", "--format", "{{json .SecurityOptions}}"}
+	default:
+		return false
+	}
+
+	output, err := exec.Command(string(runtime), args...).Output()
+	if err != nil {
+		return false
+	}
+	return parseRootless(runtime, string(output))
+}
+
+// parseRootless interprets the output of the info command run by detectRootless.
+func parseRootless(runtime ContainerRuntime, output string) bool {
+	if runtime == RuntimePodman {
+		return strings.TrimSpace(output) == "true"
+	}
+	return strings.Contains(output, "rootless")
+}
+
+// defaultUserArgs returns the arguments selecting the user of a container whose step did not
+// choose one. Files the container writes to the workspace mount must end up owned by the
+// invoking user:
+//   - rootless Podman maps that user into the container with --userns=keep-id;
+//   - rootless Docker and nerdctl map the container's root to that user, and any other uid to
+//     a subordinate one;
+//   - rootful runtimes run as the unprivileged uid of the security settings.
+func (cm *ContainerManager) defaultUserArgs(runAsUser int) []string {
+	if cm.rootless {
+		switch cm.runtime {
+		case RuntimePodman:
+			return []string{"--userns", "keep-id"}
+		case RuntimeDocker, RuntimeNerdctl:
+			return []string{"--user", "0:0"}
+		}
+	}
+	return []string{"--user", fmt.Sprintf("%d:%d", runAsUser, runAsUser)}
+}
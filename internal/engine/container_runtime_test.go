@@ -0,0 +1,143 @@
+package engine
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseContainerRuntime(t *testing.T) {
+	testCases := []struct {
+		name    string
+		want    ContainerRuntime
+		wantErr bool
+	}{
+		{name: "", want: RuntimeNone},
+		{name: "auto", want: RuntimeNone},
+		{name: "docker", want: RuntimeDocker},
+		{name: "Podman", want: RuntimePodman},
+		{name: " nerdctl ", want: RuntimeNerdctl},
+		{name: "containerd", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := ParseContainerRuntime(tc.name)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("ParseContainerRuntime(%q) expected an error", tc.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseContainerRuntime(%q) failed: %v", tc.name, err)
+		} else if got != tc.want {
+			t.Errorf("ParseContainerRuntime(%q) = %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestParseRootless(t *testing.T) {
+	testCases := []struct {
+		runtime ContainerRuntime
+		output  string
+		want    bool
+	}{
+		{RuntimePodman, "true\n", true},
+		{RuntimePodman, "false\n", false},
+		{RuntimeDocker, `["name=seccomp,profile=builtin","name=rootless","name=cgroupns"]`, true},
+		{RuntimeDocker, `["name=seccomp,profile=builtin","name=cgroupns"]`, false},
+		{RuntimeNerdctl, `["name=seccomp,profile=default","name=rootless"]`, true},
+	}
+
+	for _, tc := range testCases {
+		if got := parseRootless(tc.runtime, tc.output); got != tc.want {
+			t.Errorf("parseRootless(%s, %q) = %v, want %v", tc.runtime, tc.output, got, tc.want)
+		}
+	}
+}
+
+func TestBuildRunCommand_RootlessUser(t *testing.T) {
+	testCases := []struct {
+		name     string
+		cm       *ContainerManager
+		user     string
+		expected string
+		absent   string
+	}{
+		{
+			name:     "rootful docker runs as the unprivileged default",
+			cm:       &ContainerManager{runtime: RuntimeDocker},
+			expected: "--user 1001:1001",
+		},
+		{
+			name:     "rootless podman keeps the invoking user",
+			cm:       &ContainerManager{runtime: RuntimePodman, rootless: true},
+			expected: "--userns keep-id",
+			absent:   "--user ",
+		},
+		{
+			name:     "rootless docker runs as the mapped root",
+			cm:       &ContainerManager{runtime: RuntimeDocker, rootless: true},
+			expected: "--user 0:0",
+			absent:   "1001:1001",
+		},
+		{
+			name:     "rootless nerdctl runs as the mapped root",
+			cm:       &ContainerManager{runtime: RuntimeNerdctl, rootless: true},
+			expected: "--user 0:0",
+		},
+		{
+			name:     "step user takes precedence",
+			cm:       &ContainerManager{runtime: RuntimePodman, rootless: true},
+			user:     "1000:1000",
+			expected: "--user 1000:1000",
+			absent:   "keep-id",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			containerConfig := &ContainerConfig{
+				Image:    "alpine:latest",
+				Command:  []string{"sh", "-c", "id"},
+				User:     tc.user,
+				Security: &SecurityConfig{RunAsUser: 1001},
+			}
+
+			args, err := tc.cm.buildRunCommand("test-container", containerConfig)
+			if err != nil {
+				t.Fatalf("buildRunCommand() failed: %v", err)
+			}
+			cmdStr := strings.Join(args, " ")
+
+			if !strings.Contains(cmdStr, tc.expected) {
+				t.Errorf("Expected %q in command: %s", tc.expected, cmdStr)
+			}
+			if tc.absent != "" && strings.Contains(cmdStr, tc.absent) {
+				t.Errorf("Did not expect %q in command: %s", tc.absent, cmdStr)
+			}
+		})
+	}
+}
+
+func TestNewRunnerContainerRuntimeSelection(t *testing.T) {
+	tempDir := t.TempDir()
+	opts := RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	}
+
+	opts.ContainerRuntime = "containerd"
+	if _, err := NewRunner(opts); err == nil || !strings.Contains(err.Error(), "invalid container runtime") {
+		t.Errorf("Expected an unsupported runtime error, got %v", err)
+	}
+
+	if _, err := exec.LookPath("nerdctl"); err == nil {
+		t.Skip("nerdctl is installed")
+	}
+	opts.ContainerRuntime = "nerdctl"
+	if _, err := NewRunner(opts); err == nil || !strings.Contains(err.Error(), "container runtime nerdctl is not available") {
+		t.Errorf("Expected an explicitly selected runtime to be required, got %v", err)
+	}
+}
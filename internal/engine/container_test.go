@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
@@ -17,7 +18,7 @@ func TestDetectContainerRuntime(t *testing.T) {
 	}
 
 	// Should detect at least one runtime or none
-	validRuntimes := []ContainerRuntime{RuntimeDocker, RuntimePodman, RuntimeNone}
+	validRuntimes := []ContainerRuntime{RuntimeDocker, RuntimePodman, RuntimeNerdctl, RuntimeNone}
 	found := false
 	for _, valid := range validRuntimes {
 		if runtime == valid {
@@ -502,6 +503,96 @@ func TestBuildRunCommand(t *testing.T) {
 	}
 }
 
+func TestBuildContainerConfig_ContainerOptions(t *testing.T) {
+	cm := &ContainerManager{runtime: RuntimeDocker}
+
+	step := config.WorkflowStep{
+		Image:   "python:3.12",
+		Run:     "print('hello')",
+		Network: "none",
+		Volumes: []config.VolumeMount{{Source: "/tmp/data", Destination: "/data", ReadOnly: true}},
+		Container: &config.ContainerOptions{
+			Volumes:    []config.VolumeMount{{Source: "/tmp/cache", Destination: "/cache"}},
+			Network:    "bridge",
+			WorkDir:    "/workspace/src",
+			User:       "1000:1000",
+			Entrypoint: []string{"python", "-c"},
+			PullPolicy: config.PullPolicyNever,
+		},
+	}
+
+	containerConfig, err := cm.BuildContainerConfig(step, "/tmp/test", map[string]string{}, nil)
+	if err != nil {
+		t.Fatalf("BuildContainerConfig() failed: %v", err)
+	}
+
+	if containerConfig.Network != "bridge" {
+		t.Errorf("Expected container network to take precedence, got %s", containerConfig.Network)
+	}
+	if containerConfig.WorkDir != "/workspace/src" {
+		t.Errorf("Expected workdir /workspace/src, got %s", containerConfig.WorkDir)
+	}
+	if containerConfig.PullPolicy != config.PullPolicyNever {
+		t.Errorf("Expected pull policy %s, got %s", config.PullPolicyNever, containerConfig.PullPolicy)
+	}
+	if len(containerConfig.Volumes) != 3 {
+		t.Errorf("Expected workspace, step and container volumes, got %+v", containerConfig.Volumes)
+	}
+
+	args, err := cm.buildRunCommand("test-container", containerConfig)
+	if err != nil {
+		t.Fatalf("buildRunCommand() failed: %v", err)
+	}
+	cmdStr := strings.Join(args, " ")
+
+	for _, flag := range []string{
+		"--user 1000:1000",
+		"--network bridge",
+		"--entrypoint python",
+		"--workdir /workspace/src",
+		"--volume /tmp/data:/data:ro",
+		"--volume /tmp/cache:/cache",
+	} {
+		if !strings.Contains(cmdStr, flag) {
+			t.Errorf("buildRunCommand() missing %q\nFull command: %s", flag, cmdStr)
+		}
+	}
+	if strings.Contains(cmdStr, "1001:1001") {
+		t.Errorf("Expected the step user to replace the default user\nFull command: %s", cmdStr)
+	}
+	if !strings.HasSuffix(cmdStr, "python:3.12 -c print('hello')") {
+		t.Errorf("Expected the entrypoint arguments before the command\nFull command: %s", cmdStr)
+	}
+}
+
+func TestBuildContainerConfig_Shell(t *testing.T) {
+	cm := &ContainerManager{runtime: RuntimeDocker}
+
+	step := config.WorkflowStep{Image: "alpine:latest", Run: "echo hello", Shell: "bash"}
+	containerConfig, err := cm.BuildContainerConfig(step, "/tmp/test", map[string]string{}, nil)
+	if err != nil {
+		t.Fatalf("BuildContainerConfig() failed: %v", err)
+	}
+	if want := []string{"bash", "-c", "echo hello"}; !reflect.DeepEqual(containerConfig.Command, want) {
+		t.Errorf("Expected command %v, got %v", want, containerConfig.Command)
+	}
+}
+
+func TestBuildContainerConfig_InvalidContainerVolume(t *testing.T) {
+	cm := &ContainerManager{runtime: RuntimeDocker}
+
+	step := config.WorkflowStep{
+		Image: "alpine:latest",
+		Container: &config.ContainerOptions{
+			Volumes: []config.VolumeMount{{Source: "relative/path", Destination: "/data"}},
+		},
+	}
+
+	if _, err := cm.BuildContainerConfig(step, "/tmp/test", map[string]string{}, nil); err == nil {
+		t.Error("Expected relative container volume sources to be rejected")
+	}
+}
+
 func TestIsContainerStep(t *testing.T) {
 	tests := []struct {
 		name string
@@ -2,28 +2,41 @@ package engine
 
 import (
 	"fmt"
+	"maps"
 	"strings"
 	"time"
 )
 
 // ContextBuilder helps build template contexts for different execution scenarios.
 type ContextBuilder struct {
-	inputs      map[string]string
-	stepOutputs map[string]map[string]string
-	event       *EventContext
-	trigger     *TriggerContext
+	inputs           map[string]interface{}
+	stepOutputs      map[string]map[string]string
+	event            *EventContext
+	trigger          *TriggerContext
+	artifacts        map[string]string
+	workingDirectory string
+	scope            templateScope
 }
 
 // NewContextBuilder creates a new context builder.
 func NewContextBuilder() *ContextBuilder {
 	return &ContextBuilder{
-		inputs:      make(map[string]string),
+		inputs:      make(map[string]interface{}),
 		stepOutputs: make(map[string]map[string]string),
 	}
 }
 
 // WithInputs sets the workflow inputs.
 func (cb *ContextBuilder) WithInputs(inputs map[string]string) *ContextBuilder {
+	cb.inputs = make(map[string]interface{}, len(inputs))
+	for name, value := range inputs {
+		cb.inputs[name] = value
+	}
+	return cb
+}
+
+// WithTypedInputs sets the workflow inputs, converted to the types they are declared with.
+func (cb *ContextBuilder) WithTypedInputs(inputs map[string]interface{}) *ContextBuilder {
 	cb.inputs = inputs
 	return cb
 }
@@ -34,6 +47,30 @@ func (cb *ContextBuilder) WithStepOutputs(stepOutputs map[string]map[string]stri
 	return cb
 }
 
+// WithEnvironment sets the environment variables, given as KEY=value, that the env function reads.
+func (cb *ContextBuilder) WithEnvironment(environment []string) *ContextBuilder {
+	cb.scope.environment = environment
+	return cb
+}
+
+// WithWorkDir sets the directory that hash_files globs are relative to.
+func (cb *ContextBuilder) WithWorkDir(workDir string) *ContextBuilder {
+	cb.scope.workDir = workDir
+	return cb
+}
+
+// WithArtifacts sets the absolute paths of the artifacts of the repository, by name.
+func (cb *ContextBuilder) WithArtifacts(artifacts map[string]string) *ContextBuilder {
+	cb.artifacts = artifacts
+	return cb
+}
+
+// WithWorkingDirectory sets the absolute directory the step runs in.
+func (cb *ContextBuilder) WithWorkingDirectory(dir string) *ContextBuilder {
+	cb.workingDirectory = dir
+	return cb
+}
+
 // WithEvent sets the event context for subscription-triggered workflows.
 func (cb *ContextBuilder) WithEvent(eventType, source string, payload map[string]interface{}) *ContextBuilder {
 	cb.event = &EventContext{
@@ -68,6 +105,10 @@ func (cb *ContextBuilder) Build() *TemplateContext {
 		Steps:   cb.stepOutputs,
 		Event:   cb.event,
 		Trigger: cb.trigger,
+		scope:   cb.scope,
+
+		Artifacts:        cb.artifacts,
+		WorkingDirectory: cb.workingDirectory,
 	}
 }
 
@@ -187,7 +228,7 @@ func ValidateContext(context *TemplateContext) error {
 
 	// Validate inputs
 	if context.Inputs == nil {
-		context.Inputs = make(map[string]string)
+		context.Inputs = make(map[string]interface{})
 	}
 
 	// Validate step outputs
@@ -256,13 +297,13 @@ func validateTriggerContext(trigger *TriggerContext) error {
 func MergeContexts(contexts ...*TemplateContext) *TemplateContext {
 	if len(contexts) == 0 {
 		return &TemplateContext{
-			Inputs: make(map[string]string),
+			Inputs: make(map[string]interface{}),
 			Steps:  make(map[string]map[string]string),
 		}
 	}
 
 	result := &TemplateContext{
-		Inputs: make(map[string]string),
+		Inputs: make(map[string]interface{}),
 		Steps:  make(map[string]map[string]string),
 	}
 
@@ -293,6 +334,12 @@ func MergeContexts(contexts ...*TemplateContext) *TemplateContext {
 		if ctx.Trigger != nil {
 			result.Trigger = ctx.Trigger
 		}
+		if ctx.Artifacts != nil {
+			result.Artifacts = ctx.Artifacts
+		}
+		if ctx.WorkingDirectory != "" {
+			result.WorkingDirectory = ctx.WorkingDirectory
+		}
 	}
 
 	return result
@@ -305,8 +352,10 @@ func CloneContext(ctx *TemplateContext) *TemplateContext {
 	}
 
 	result := &TemplateContext{
-		Inputs: make(map[string]string),
-		Steps:  make(map[string]map[string]string),
+		Inputs:           make(map[string]interface{}),
+		Steps:            make(map[string]map[string]string),
+		Artifacts:        maps.Clone(ctx.Artifacts),
+		WorkingDirectory: ctx.WorkingDirectory,
 	}
 
 	// Copy inputs
@@ -249,7 +249,7 @@ func TestEventFilter(t *testing.T) {
 func TestValidateContext(t *testing.T) {
 	t.Run("valid context", func(t *testing.T) {
 		context := &TemplateContext{
-			Inputs: map[string]string{"key": "value"},
+			Inputs: map[string]interface{}{"key": "value"},
 			Steps:  map[string]map[string]string{"step1": {"output": "value"}},
 			Event: &EventContext{
 				Type:      "test",
@@ -296,7 +296,7 @@ func TestValidateContext(t *testing.T) {
 
 	t.Run("invalid event context", func(t *testing.T) {
 		context := &TemplateContext{
-			Inputs: map[string]string{},
+			Inputs: map[string]interface{}{},
 			Steps:  map[string]map[string]string{},
 			Event: &EventContext{
 				Type:   "", // Invalid: empty type
@@ -312,7 +312,7 @@ func TestValidateContext(t *testing.T) {
 
 	t.Run("invalid trigger context", func(t *testing.T) {
 		context := &TemplateContext{
-			Inputs: map[string]string{},
+			Inputs: map[string]interface{}{},
 			Steps:  map[string]map[string]string{},
 			Trigger: &TriggerContext{
 				Artifacts: []ArtifactInfo{
@@ -330,7 +330,7 @@ func TestValidateContext(t *testing.T) {
 
 func TestMergeContexts(t *testing.T) {
 	context1 := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"key1": "value1",
 			"key2": "value2",
 		},
@@ -344,7 +344,7 @@ func TestMergeContexts(t *testing.T) {
 	}
 
 	context2 := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"key2": "newvalue2", // Override
 			"key3": "value3",    // New
 		},
@@ -390,7 +390,7 @@ func TestMergeContexts(t *testing.T) {
 
 func TestCloneContext(t *testing.T) {
 	original := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"key1": "value1",
 			"key2": "value2",
 		},
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"context"
+	"strings"
+)
+
+// Environment variables linking the runs started by a run, such as by its steps or the Jobs of
+// the kubernetes backend, to the execution tree they belong to. A runner inherits them from its
+// environment when its options do not set them.
+const (
+	// ParentRunIDEnv is the run ID of the run that started the process.
+	ParentRunIDEnv = "TAKO_PARENT_RUN_ID"
+
+	// CorrelationIDEnv is the correlation ID of the execution tree the process belongs to.
+	CorrelationIDEnv = "TAKO_CORRELATION_ID"
+)
+
+// contextKeyCorrelationID carries the correlation ID of the child workflow a backend runs.
+const contextKeyCorrelationID contextKey = "correlation_id"
+
+// withCorrelationID returns a context carrying the correlation ID of the child workflow run
+// with it, when one is given.
+func withCorrelationID(ctx context.Context, correlationID string) context.Context {
+	if correlationID == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, contextKeyCorrelationID, correlationID)
+}
+
+// correlationIDFromContext returns the correlation ID carried by a context, and whether it
+// carries one.
+func correlationIDFromContext(ctx context.Context) (string, bool) {
+	correlationID, ok := ctx.Value(contextKeyCorrelationID).(string)
+	return correlationID, ok
+}
+
+// inheritRunLinks resolves the parent run ID and correlation ID of a run: those of its options,
+// else those of its environment. A run that belongs to no execution tree starts its own, whose
+// correlation ID is the run ID of its root.
+func inheritRunLinks(runID string, opts RunnerOptions) (parentRunID, correlationID string) {
+	parentRunID, correlationID = opts.ParentRunID, opts.CorrelationID
+	if parentRunID == "" {
+		parentRunID, _ = lookupEnvironment(opts.Environment, ParentRunIDEnv)
+	}
+	if correlationID == "" {
+		correlationID, _ = lookupEnvironment(opts.Environment, CorrelationIDEnv)
+	}
+	if correlationID == "" {
+		correlationID = runID
+	}
+	return parentRunID, correlationID
+}
+
+// runLinkEnvironment returns the environment variables linking the runs a run starts to it.
+func (r *Runner) runLinkEnvironment() []string {
+	return []string{
+		ParentRunIDEnv + "=" + r.runID,
+		CorrelationIDEnv + "=" + r.correlationID,
+		LineageEnv + "=" + strings.Join(r.lineage, ","),
+	}
+}
+
+// CorrelationID returns the correlation ID shared by the runs of the execution tree of the run.
+func (r *Runner) CorrelationID() string {
+	return r.correlationID
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewRunner_CorrelationID(t *testing.T) {
+	tempDir := t.TempDir()
+
+	root, err := NewRunner(RunnerOptions{WorkspaceRoot: filepath.Join(tempDir, "root"), CacheDir: filepath.Join(tempDir, "cache")})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer root.Close()
+	if root.CorrelationID() != root.runID || root.state.CorrelationID != root.runID {
+		t.Errorf("expected a root run to be correlated by its run ID, got %q", root.CorrelationID())
+	}
+
+	// Child runners share the correlation ID of the root
+	child, _, err := root.childRunnerFactory.CreateChildRunner()
+	if err != nil {
+		t.Fatalf("Failed to create child runner: %v", err)
+	}
+	defer child.Close()
+	if child.CorrelationID() != root.runID || child.parentRunID != root.runID {
+		t.Errorf("expected the child linked to the root, got parent %q and correlation %q", child.parentRunID, child.CorrelationID())
+	}
+
+	// Runs started by a step inherit the links from their environment
+	inherited, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "inherited"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{ParentRunIDEnv + "=exec-parent", CorrelationIDEnv + "=exec-root"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer inherited.Close()
+	if inherited.parentRunID != "exec-parent" || inherited.CorrelationID() != "exec-root" || inherited.state.ParentRunID != "exec-parent" {
+		t.Errorf("expected the links of the environment, got parent %q and correlation %q", inherited.parentRunID, inherited.CorrelationID())
+	}
+}
+
+func TestRunner_StepsReceiveRunLinks(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - run: echo "$TAKO_PARENT_RUN_ID $TAKO_CORRELATION_ID" > links.txt
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{CorrelationIDEnv + "=exec-root", "PATH=" + os.Getenv("PATH")},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+	if _, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir); err != nil {
+		t.Fatalf("Failed to execute workflow: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(tempDir, "links.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read the links of the step: %v", err)
+	}
+	if got, want := strings.TrimSpace(string(data)), runner.runID+" exec-root"; got != want {
+		t.Errorf("expected the step to link its runs to the run, got %q, want %q", got, want)
+	}
+
+	history, err := NewHistoryStore(filepath.Join(tempDir, "cache"))
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	records, err := history.Query(HistoryFilter{CorrelationID: "exec-root"})
+	if err != nil || len(records) != 1 {
+		t.Errorf("expected the run recorded with its correlation ID, got %+v, %v", records, err)
+	}
+}
+
+func TestFanOutExecutor_RecordsCorrelationID(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, NewRecordingWorkflowRunner())
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetCorrelationID("exec-root")
+
+	state, err := executor.stateManager.CreateFanOutState("fanout-1", "exec-parent", "org/lib", "library_built", false, 0)
+	if err != nil {
+		t.Fatalf("Failed to create fan-out state: %v", err)
+	}
+	child := state.AddChildWorkflow("org/app", "update", nil)
+	if state.CorrelationID != "exec-root" || child.CorrelationID != "exec-root" {
+		t.Errorf("expected the fan-out and its children correlated, got %q and %q", state.CorrelationID, child.CorrelationID)
+	}
+}
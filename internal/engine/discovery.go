@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -16,12 +17,14 @@ type SubscriptionMatch = interfaces.SubscriptionMatch
 // DiscoveryManager handles repository discovery and subscription lookup.
 type DiscoveryManager struct {
 	cacheDir string
+	catalog  *SubscriptionCatalog // Index of the subscriptions of the cache, shared in the process
 }
 
 // NewDiscoveryManager creates a new discovery manager with the specified cache directory.
 func NewDiscoveryManager(cacheDir string) *DiscoveryManager {
 	return &DiscoveryManager{
 		cacheDir: cacheDir,
+		catalog:  SubscriptionCatalogFor(cacheDir),
 	}
 }
 
@@ -30,105 +33,65 @@ func NewDiscoveryManager(cacheDir string) *DiscoveryManager {
 var _ interfaces.SubscriptionDiscoverer = (*DiscoveryManager)(nil)
 
 // FindSubscribers finds all repositories that subscribe to the specified artifact and event type.
-// Returns a sorted list of subscription matches for deterministic behavior.
+// Returns a sorted list of subscription matches for deterministic behavior. Subscriptions are
+// looked up in the catalog of the cache, which reads the cached repositories once.
 func (dm *DiscoveryManager) FindSubscribers(artifact, eventType string) ([]SubscriptionMatch, error) {
-	if artifact == "" {
-		return nil, fmt.Errorf("artifact cannot be empty")
-	}
-	if eventType == "" {
-		return nil, fmt.Errorf("event type cannot be empty")
-	}
-
-	matches := make([]SubscriptionMatch, 0)
+	return dm.FindSubscribersContext(context.Background(), artifact, eventType)
+}
 
-	// Scan the cache directory for repositories
-	repoBaseDir := filepath.Join(dm.cacheDir, "repos")
-	if _, err := os.Stat(repoBaseDir); os.IsNotExist(err) {
-		// No cached repositories - this is not an error, just return empty results
-		return matches, nil
+// FindSubscribersContext is FindSubscribers, giving up on reading the cached repositories when
+// ctx is done.
+func (dm *DiscoveryManager) FindSubscribersContext(ctx context.Context, artifact, eventType string) ([]SubscriptionMatch, error) {
+	if err := validateDiscoveryQuery(artifact, eventType); err != nil {
+		return nil, err
 	}
+	return dm.catalog.LookupContext(ctx, artifact, eventType)
+}
 
-	// Walk through owner directories (first level)
-	ownerEntries, err := os.ReadDir(repoBaseDir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read cache directory: %v", err)
+// StreamSubscribers calls yield with the subscriptions to an event type of an artifact as the
+// cached repositories are read, in no particular order, so that large caches give partial
+// results early. It stops when ctx is done.
+func (dm *DiscoveryManager) StreamSubscribers(ctx context.Context, artifact, eventType string, yield func(SubscriptionMatch)) error {
+	if err := validateDiscoveryQuery(artifact, eventType); err != nil {
+		return err
 	}
+	return dm.catalog.Stream(ctx, artifact, eventType, yield)
+}
 
-	for _, ownerEntry := range ownerEntries {
-		if !ownerEntry.IsDir() {
-			continue
-		}
-
-		ownerPath := filepath.Join(repoBaseDir, ownerEntry.Name())
-
-		// Walk through repo directories (second level)
-		repoEntries, err := os.ReadDir(ownerPath)
-		if err != nil {
-			continue // Skip directories we can't read
-		}
-
-		for _, repoEntry := range repoEntries {
-			if !repoEntry.IsDir() {
-				continue
-			}
-
-			repoPath := filepath.Join(ownerPath, repoEntry.Name())
-			repoName := fmt.Sprintf("%s/%s", ownerEntry.Name(), repoEntry.Name())
-
-			// Check for main branch directory (default branch)
-			mainBranchPath := filepath.Join(repoPath, "main")
-			if _, err := os.Stat(mainBranchPath); os.IsNotExist(err) {
-				continue // Skip if main branch doesn't exist
-			}
-
-			// Load subscriptions from this repository
-			subscriptions, err := dm.LoadSubscriptions(mainBranchPath)
-			if err != nil {
-				continue // Skip repositories with loading errors
-			}
+// SetWorkers sets how many cached repositories are read concurrently when the catalog of the
+// cache is built.
+func (dm *DiscoveryManager) SetWorkers(n int) {
+	dm.catalog.SetWorkers(n)
+}
 
-			// Check if any subscription matches our criteria
-			for _, subscription := range subscriptions {
-				if dm.matchesArtifactAndEvent(subscription, artifact, eventType) {
-					matches = append(matches, SubscriptionMatch{
-						Repository:   repoName,
-						Subscription: subscription,
-						RepoPath:     mainBranchPath,
-					})
-				}
-			}
-		}
+// validateDiscoveryQuery checks the artifact and event type subscribers are looked up for.
+func validateDiscoveryQuery(artifact, eventType string) error {
+	if artifact == "" {
+		return fmt.Errorf("artifact cannot be empty")
 	}
+	if eventType == "" {
+		return fmt.Errorf("event type cannot be empty")
+	}
+	return nil
+}
 
-	// Sort matches alphabetically by repository name for deterministic behavior
-	sort.Slice(matches, func(i, j int) bool {
-		return matches[i].Repository < matches[j].Repository
-	})
-
-	return matches, nil
+// Catalog returns the catalog of the subscriptions of the cache.
+func (dm *DiscoveryManager) Catalog() *SubscriptionCatalog {
+	return dm.catalog
 }
 
 // LoadSubscriptions loads subscriptions from a repository's tako.yml file.
 func (dm *DiscoveryManager) LoadSubscriptions(repoPath string) ([]config.Subscription, error) {
-	takoYmlPath := filepath.Join(repoPath, "tako.yml")
-
-	// Check if tako.yml exists
-	if _, err := os.Stat(takoYmlPath); os.IsNotExist(err) {
-		// No tako.yml file - this is not an error, just return empty subscriptions
-		return []config.Subscription{}, nil
-	}
-
-	// Load the configuration
-	cfg, err := config.Load(takoYmlPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load tako.yml from %s: %v", takoYmlPath, err)
-	}
-
-	return cfg.Subscriptions, nil
+	return loadSubscriptions(repoPath, dm.cacheDir)
 }
 
 // matchesArtifactAndEvent checks if a subscription matches the specified artifact and event type.
 func (dm *DiscoveryManager) matchesArtifactAndEvent(subscription config.Subscription, artifact, eventType string) bool {
+	return subscriptionMatches(subscription, artifact, eventType)
+}
+
+// subscriptionMatches checks if a subscription matches the specified artifact and event type.
+func subscriptionMatches(subscription config.Subscription, artifact, eventType string) bool {
 	// Check if the subscription's artifact matches
 	if subscription.Artifact != artifact {
 		return false
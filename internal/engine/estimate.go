@@ -0,0 +1,199 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// ExecutionEstimate is the compute a simulated execution tree is expected to need, from the
+// resources and timeouts declared by its workflows and steps. Steps use their own cpu_limit
+// and mem_limit, or else those of their workflow, and run for their timeout, so the estimate
+// bounds what the tree may use rather than what it typically uses. Steps declaring none of
+// them count for nothing and are listed in Undeclared.
+type ExecutionEstimate struct {
+	Workflows       int           `json:"workflows"`         // Workflows that would run
+	PeakWorkflows   int           `json:"peak_workflows"`    // Workflows running at once at the peak
+	PeakCPU         float64       `json:"peak_cpu"`          // Cores used at once at the peak
+	PeakMemoryBytes int64         `json:"peak_memory_bytes"` // Memory used at once at the peak
+	CPUTime         time.Duration `json:"cpu_time"`          // Total compute, in core time
+	Duration        time.Duration `json:"duration"`          // Wall time of the tree, as if every fan-out waited for its children
+	Undeclared      []string      `json:"undeclared,omitempty"`
+}
+
+// workflowEstimate is the estimate of a workflow, a step, or steps running together.
+type workflowEstimate struct {
+	duration      time.Duration
+	cpuTime       time.Duration
+	peakCPU       float64
+	peakMemory    int64
+	peakWorkflows int
+}
+
+// estimator accumulates what the estimate of a tree sees beyond the figures of its workflows.
+type estimator struct {
+	workflows  int
+	undeclared []string
+}
+
+// EstimateSimulation estimates the compute of the execution tree walked by a simulation.
+// Workflows that would not run, because their simulation failed, count for nothing.
+func EstimateSimulation(tree *SimulatedWorkflow) (*ExecutionEstimate, error) {
+	e := &estimator{}
+	root, err := e.workflow(tree)
+	if err != nil {
+		return nil, err
+	}
+	return &ExecutionEstimate{
+		Workflows:       e.workflows,
+		PeakWorkflows:   root.peakWorkflows,
+		PeakCPU:         root.peakCPU,
+		PeakMemoryBytes: root.peakMemory,
+		CPUTime:         root.cpuTime,
+		Duration:        root.duration,
+		Undeclared:      e.undeclared,
+	}, nil
+}
+
+// workflow estimates a simulated workflow and the children of its fan-outs.
+func (e *estimator) workflow(node *SimulatedWorkflow) (workflowEstimate, error) {
+	if node.Error != "" {
+		return workflowEstimate{}, nil
+	}
+	e.workflows++
+
+	defaults, err := processLimitsFromResources(&node.definition.Resources)
+	if err != nil {
+		return workflowEstimate{}, fmt.Errorf("%s:%s: %v", node.Repository, node.Workflow, err)
+	}
+	// Fan-outs were simulated in the order of the steps, parallel groups included
+	fanOuts := node.FanOuts
+	estimate, err := e.steps(node, node.definition.Steps, defaults, &fanOuts)
+	if err != nil {
+		return workflowEstimate{}, err
+	}
+
+	// A run never outlasts the timeout of its workflow
+	if node.definition.Timeout != "" {
+		timeout, _ := time.ParseDuration(node.definition.Timeout) // Validated when the config is loaded
+		if estimate.duration == 0 || estimate.duration > timeout {
+			estimate.duration = timeout
+		}
+	}
+	estimate.peakWorkflows++
+	return estimate, nil
+}
+
+// steps estimates steps running one after the other.
+func (e *estimator) steps(node *SimulatedWorkflow, steps []config.WorkflowStep, defaults ProcessLimits, fanOuts *[]SimulatedFanOut) (workflowEstimate, error) {
+	var total workflowEstimate
+	for _, step := range steps {
+		estimate, err := e.step(node, step, defaults, fanOuts)
+		if err != nil {
+			return workflowEstimate{}, err
+		}
+		total.duration += estimate.duration
+		total.cpuTime += estimate.cpuTime
+		total.peakCPU = max(total.peakCPU, estimate.peakCPU)
+		total.peakMemory = max(total.peakMemory, estimate.peakMemory)
+		total.peakWorkflows = max(total.peakWorkflows, estimate.peakWorkflows)
+	}
+	return total, nil
+}
+
+// step estimates a step: the steps of a parallel group running together, the children of a
+// fan-out, or the declared resources and timeout of any other step.
+func (e *estimator) step(node *SimulatedWorkflow, step config.WorkflowStep, defaults ProcessLimits, fanOuts *[]SimulatedFanOut) (workflowEstimate, error) {
+	if len(step.Parallel) > 0 {
+		estimates := make([]workflowEstimate, 0, len(step.Parallel))
+		for _, parallel := range step.Parallel {
+			estimate, err := e.step(node, parallel, defaults, fanOuts)
+			if err != nil {
+				return workflowEstimate{}, err
+			}
+			estimates = append(estimates, estimate)
+		}
+		return concurrentEstimate(estimates, step.MaxParallel), nil
+	}
+
+	if step.Uses == "tako/fan-out@v1" {
+		if len(*fanOuts) == 0 {
+			return workflowEstimate{}, nil
+		}
+		fanOut := (*fanOuts)[0]
+		*fanOuts = (*fanOuts)[1:]
+		estimates := make([]workflowEstimate, 0, len(fanOut.Children))
+		for _, child := range fanOut.Children {
+			estimate, err := e.workflow(child)
+			if err != nil {
+				return workflowEstimate{}, err
+			}
+			estimates = append(estimates, estimate)
+		}
+		return concurrentEstimate(estimates, fanOut.ConcurrencyLimit), nil
+	}
+
+	limits, err := processLimitsFromResources(step.Resources)
+	if err != nil {
+		return workflowEstimate{}, fmt.Errorf("%s:%s: step '%s': %v", node.Repository, node.Workflow, step.ID, err)
+	}
+	if limits.CPU <= 0 {
+		limits.CPU = defaults.CPU
+	}
+	if limits.MemoryBytes <= 0 {
+		limits.MemoryBytes = defaults.MemoryBytes
+	}
+	var duration time.Duration
+	if step.Timeout != "" {
+		duration, _ = time.ParseDuration(step.Timeout) // Validated when the config is loaded
+	}
+	if limits.IsZero() && duration == 0 {
+		e.undeclared = append(e.undeclared, fmt.Sprintf("%s:%s/%s", node.Repository, node.Workflow, step.ID))
+	}
+
+	return workflowEstimate{
+		duration:   duration,
+		cpuTime:    time.Duration(float64(duration) * limits.CPU),
+		peakCPU:    limits.CPU,
+		peakMemory: limits.MemoryBytes,
+	}, nil
+}
+
+// concurrentEstimate estimates steps or workflows running together, at most limit at once
+// (all of them when limit is zero). They start in batches, each lasting as long as its
+// longest member, and the peaks are those of the largest members running at once.
+func concurrentEstimate(estimates []workflowEstimate, limit int) workflowEstimate {
+	if limit <= 0 || limit > len(estimates) {
+		limit = len(estimates)
+	}
+
+	var total workflowEstimate
+	for start := 0; start < len(estimates); start += limit {
+		var batch time.Duration
+		for _, estimate := range estimates[start:min(start+limit, len(estimates))] {
+			batch = max(batch, estimate.duration)
+		}
+		total.duration += batch
+	}
+
+	cpu := make([]float64, 0, len(estimates))
+	memory := make([]int64, 0, len(estimates))
+	workflows := make([]int, 0, len(estimates))
+	for _, estimate := range estimates {
+		total.cpuTime += estimate.cpuTime
+		cpu = append(cpu, estimate.peakCPU)
+		memory = append(memory, estimate.peakMemory)
+		workflows = append(workflows, estimate.peakWorkflows)
+	}
+	slices.Sort(cpu)
+	slices.Sort(memory)
+	slices.Sort(workflows)
+	for i := 1; i <= limit; i++ {
+		total.peakCPU += cpu[len(cpu)-i]
+		total.peakMemory += memory[len(memory)-i]
+		total.peakWorkflows += workflows[len(workflows)-i]
+	}
+	return total
+}
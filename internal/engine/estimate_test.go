@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// estimatedWorkflow returns a simulated workflow of the given definition.
+func estimatedWorkflow(repository string, definition config.Workflow, fanOuts ...SimulatedFanOut) *SimulatedWorkflow {
+	return &SimulatedWorkflow{Repository: repository, Workflow: "build", FanOuts: fanOuts, definition: definition}
+}
+
+func TestEstimateSimulation(t *testing.T) {
+	child := config.Workflow{
+		Resources: config.Resources{CPULimit: "1", MemLimit: "1Gi"},
+		Steps: []config.WorkflowStep{
+			{ID: "compile", Timeout: "10m"},
+			{ID: "test", Timeout: "20m", Resources: &config.Resources{CPULimit: "2"}},
+		},
+	}
+	root := config.Workflow{
+		Steps: []config.WorkflowStep{
+			{ID: "build", Timeout: "5m", Resources: &config.Resources{CPULimit: "4", MemLimit: "2Gi"}},
+			{ID: "publish", Uses: "tako/fan-out@v1"},
+			{ID: "announce"},
+		},
+	}
+	tree := estimatedWorkflow("org/lib", root, SimulatedFanOut{
+		StepID:           "publish",
+		ConcurrencyLimit: 2,
+		Children: []*SimulatedWorkflow{
+			estimatedWorkflow("org/a", child),
+			estimatedWorkflow("org/b", child),
+			estimatedWorkflow("org/c", child),
+			{Repository: "org/broken", Workflow: "build", Error: "workflow 'build' not found"},
+		},
+	})
+
+	estimate, err := EstimateSimulation(tree)
+	if err != nil {
+		t.Fatalf("Failed to estimate: %v", err)
+	}
+
+	if estimate.Workflows != 4 {
+		t.Errorf("Expected the 4 workflows that would run, got %d", estimate.Workflows)
+	}
+	// Two children at once, the parent waiting for them
+	if estimate.PeakWorkflows != 3 {
+		t.Errorf("Expected a peak of 3 workflows, got %d", estimate.PeakWorkflows)
+	}
+	if estimate.PeakCPU != 4 {
+		t.Errorf("Expected the peak CPU of the build step, got %v", estimate.PeakCPU)
+	}
+	if estimate.PeakMemoryBytes != 2<<30 {
+		t.Errorf("Expected a peak of 2GiB, got %d", estimate.PeakMemoryBytes)
+	}
+	// 5m of the build, then two batches of children of 30m each
+	if estimate.Duration != 65*time.Minute {
+		t.Errorf("Expected a duration of 65m, got %s", estimate.Duration)
+	}
+	// 4 x 5m, and 3 children of 1 x 10m + 2 x 20m
+	if estimate.CPUTime != 170*time.Minute {
+		t.Errorf("Expected 170m of CPU time, got %s", estimate.CPUTime)
+	}
+	if !slices.Equal(estimate.Undeclared, []string{"org/lib:build/announce"}) {
+		t.Errorf("Expected the step without hints to be reported, got %v", estimate.Undeclared)
+	}
+}
+
+func TestEstimateSimulationParallelAndTimeout(t *testing.T) {
+	workflow := config.Workflow{
+		Timeout: "15m",
+		Steps: []config.WorkflowStep{
+			{ID: "checks", MaxParallel: 2, Parallel: []config.WorkflowStep{
+				{ID: "lint", Timeout: "10m", Resources: &config.Resources{CPULimit: "1", MemLimit: "256Mi"}},
+				{ID: "unit", Timeout: "10m", Resources: &config.Resources{CPULimit: "2", MemLimit: "512Mi"}},
+				{ID: "e2e", Timeout: "10m", Resources: &config.Resources{CPULimit: "500m", MemLimit: "1Gi"}},
+			}},
+		},
+	}
+
+	estimate, err := EstimateSimulation(estimatedWorkflow("org/app", workflow))
+	if err != nil {
+		t.Fatalf("Failed to estimate: %v", err)
+	}
+
+	if estimate.PeakCPU != 3 {
+		t.Errorf("Expected the two largest CPU limits at once, got %v", estimate.PeakCPU)
+	}
+	if estimate.PeakMemoryBytes != 1536<<20 {
+		t.Errorf("Expected the two largest memory limits at once, got %d", estimate.PeakMemoryBytes)
+	}
+	if estimate.Duration != 15*time.Minute {
+		t.Errorf("Expected the two batches to be cut by the workflow timeout, got %s", estimate.Duration)
+	}
+}
+
+func TestEstimateSimulationInvalidResources(t *testing.T) {
+	workflow := config.Workflow{Steps: []config.WorkflowStep{{ID: "build", Resources: &config.Resources{CPULimit: "lots"}}}}
+	if _, err := EstimateSimulation(estimatedWorkflow("org/app", workflow)); err == nil {
+		t.Error("Expected an invalid CPU limit to fail the estimate")
+	}
+}
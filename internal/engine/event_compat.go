@@ -0,0 +1,171 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// IncompatibleSubscriber is a subscriber of an event excluded from a fan-out because its
+// schema_version range rejects the schema version of the event.
+type IncompatibleSubscriber struct {
+	EventType     string `json:"event_type"`
+	SchemaVersion string `json:"schema_version"` // Schema version of the event
+	Repository    string `json:"repository"`
+	Workflow      string `json:"workflow"`
+	Accepts       string `json:"accepts"` // schema_version range of the subscription
+}
+
+// String formats the subscriber for display.
+func (s IncompatibleSubscriber) String() string {
+	return fmt.Sprintf("%s:%s (accepts %s)", s.Repository, s.Workflow, s.Accepts)
+}
+
+// EventCompatibility reports which schema versions of an event type its subscribers accept.
+type EventCompatibility struct {
+	EventType string `json:"event_type"`
+	// Versions are the schema versions checked, from lowest to highest.
+	Versions    []EventSchemaVersion      `json:"versions"`
+	Subscribers []SubscriberCompatibility `json:"subscribers"`
+}
+
+// EventSchemaVersion is a schema version of an event type.
+type EventSchemaVersion struct {
+	Version string `json:"version"`
+	// Emitters are the cached repositories that declare the version, in their event schemas or
+	// in the events their workflows produce; empty for versions that were only requested.
+	Emitters []string `json:"emitters"`
+}
+
+// SubscriberCompatibility lists the schema versions of an event type a subscription accepts.
+type SubscriberCompatibility struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	// SchemaVersion is the schema_version range of the subscription; empty accepts any version.
+	SchemaVersion string   `json:"schema_version,omitempty"`
+	Accepted      []string `json:"accepted"`
+	Rejected      []string `json:"rejected"`
+	// Error is why the range of the subscription could not be checked.
+	Error string `json:"error,omitempty"`
+}
+
+// Accepts returns whether the subscriber accepts a schema version it was checked against.
+func (s SubscriberCompatibility) Accepts(version string) bool {
+	return slices.Contains(s.Accepted, version)
+}
+
+// CheckEventCompatibility checks which schema versions of an event type the subscriptions of the
+// cached repositories accept: the versions the cached repositories declare for it, and the
+// extra versions given, such as that of a release yet to come. Repositories whose tako.yml
+// cannot be loaded are skipped.
+func (dm *DiscoveryManager) CheckEventCompatibility(eventType string, extraVersions []string, evaluator *SubscriptionEvaluator) (*EventCompatibility, error) {
+	for _, version := range extraVersions {
+		if _, err := parseSemVer(version); err != nil {
+			return nil, fmt.Errorf("invalid schema version '%s': %v", version, err)
+		}
+	}
+
+	repositories, configs, _, err := dm.loadCachedConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	emitters := make(map[string][]string)
+	for _, version := range extraVersions {
+		emitters[version] = nil
+	}
+	for _, repository := range repositories {
+		cfg := configs[repository]
+		if cfg == nil {
+			continue
+		}
+		for _, version := range declaredSchemaVersions(cfg, eventType) {
+			if !slices.Contains(emitters[version], repository) {
+				emitters[version] = append(emitters[version], repository)
+			}
+		}
+	}
+	versions := sortedKeys(emitters)
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, erri := parseSemVer(versions[i])
+		vj, errj := parseSemVer(versions[j])
+		if erri != nil || errj != nil {
+			return erri == nil // Unparsable versions go last
+		}
+		return compareVersions(vi, vj) < 0
+	})
+
+	compatibility := &EventCompatibility{
+		EventType:   eventType,
+		Versions:    make([]EventSchemaVersion, 0, len(versions)),
+		Subscribers: make([]SubscriberCompatibility, 0),
+	}
+	for _, version := range versions {
+		compatibility.Versions = append(compatibility.Versions, EventSchemaVersion{
+			Version:  version,
+			Emitters: append(make([]string, 0), emitters[version]...),
+		})
+	}
+
+	for _, repository := range repositories {
+		cfg := configs[repository]
+		if cfg == nil {
+			continue
+		}
+		for _, subscription := range cfg.Subscriptions {
+			if !slices.Contains(subscription.Events, eventType) {
+				continue
+			}
+			subscriber := SubscriberCompatibility{
+				Repository:    repository,
+				Workflow:      subscription.Workflow,
+				SchemaVersion: subscription.SchemaVersion,
+				Accepted:      make([]string, 0),
+				Rejected:      make([]string, 0),
+			}
+			for _, version := range versions {
+				compatible, err := evaluator.CheckSchemaCompatibility(version, subscription.SchemaVersion)
+				if err != nil {
+					subscriber.Error = err.Error()
+					break
+				}
+				if compatible {
+					subscriber.Accepted = append(subscriber.Accepted, version)
+				} else {
+					subscriber.Rejected = append(subscriber.Rejected, version)
+				}
+			}
+			compatibility.Subscribers = append(compatibility.Subscribers, subscriber)
+		}
+	}
+
+	return compatibility, nil
+}
+
+// declaredSchemaVersions returns the schema versions of an event type a tako.yml declares, in its
+// event schemas and in the events its workflows produce.
+func declaredSchemaVersions(cfg *config.Config, eventType string) []string {
+	var versions []string
+	if cfg.Events != nil {
+		for _, schema := range cfg.Events.Schemas {
+			if schema.Type == eventType && schema.SchemaVersion != "" {
+				versions = append(versions, schema.SchemaVersion)
+			}
+		}
+	}
+	for _, name := range sortedKeys(cfg.Workflows) {
+		for _, step := range cfg.Workflows[name].Steps {
+			if step.Produces == nil {
+				continue
+			}
+			for _, event := range step.Produces.Events {
+				if event.Type == eventType && event.SchemaVersion != "" {
+					versions = append(versions, event.SchemaVersion)
+				}
+			}
+		}
+	}
+	return versions
+}
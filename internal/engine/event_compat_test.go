@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestFanOutExecutor_SchemaIncompatibleSubscribers(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &orderRecordingWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetEventSchemas([]config.EventPayloadSchema{{
+		Type:          "library_built",
+		SchemaVersion: "2.0.0",
+		Fields:        map[string]string{"version": config.PayloadFieldString},
+	}})
+
+	subscriptions := rolloutSubscriptions(3)
+	subscriptions[0].Subscription.SchemaVersion = "^1.0.0"
+	subscriptions[1].Subscription.SchemaVersion = ">=1.0.0"
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":     "library_built",
+		"schema_version": "2.0.0",
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if result.TriggeredCount != 2 {
+		t.Errorf("Expected the 2 compatible subscribers to be triggered, got %d", result.TriggeredCount)
+	}
+
+	expected := []IncompatibleSubscriber{{
+		EventType:     "library_built",
+		SchemaVersion: "2.0.0",
+		Repository:    "test-org/repo-1",
+		Workflow:      "update-1",
+		Accepts:       "^1.0.0",
+	}}
+	if !slices.Equal(result.SchemaIncompatible, expected) {
+		t.Errorf("Expected %+v to be excluded, got %+v", expected, result.SchemaIncompatible)
+	}
+	if got := expected[0].String(); got != "test-org/repo-1:update-1 (accepts ^1.0.0)" {
+		t.Errorf("Unexpected formatting: %q", got)
+	}
+}
+
+func TestDiscoveryManager_CheckEventCompatibility(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/library", `version: "1.0"
+workflows:
+  release:
+    steps:
+      - uses: tako/fan-out@v1
+        produces:
+          events:
+            - type: library_released
+              schema_version: "2.0.0"
+events:
+  schemas:
+    - type: library_released
+      schema_version: "1.0.0"
+      fields:
+        version: string
+    - type: library_released
+      schema_version: "2.0.0"
+      fields:
+        version: string
+`)
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    steps:
+      - run: echo "update"
+subscriptions:
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    schema_version: "^1.0.0"
+    workflow: "update"
+  - artifact: "test-org/library:default"
+    events: ["library_built"]
+    workflow: "update"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/docs", `version: "1.0"
+workflows:
+  publish:
+    steps:
+      - run: echo "publish"
+subscriptions:
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    workflow: "publish"
+`)
+
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+	dm := NewDiscoveryManager(cacheDir)
+	compatibility, err := dm.CheckEventCompatibility("library_released", []string{"3.0.0"}, evaluator)
+	if err != nil {
+		t.Fatalf("CheckEventCompatibility failed: %v", err)
+	}
+
+	var versions []string
+	for _, version := range compatibility.Versions {
+		versions = append(versions, version.Version)
+	}
+	if !slices.Equal(versions, []string{"1.0.0", "2.0.0", "3.0.0"}) {
+		t.Errorf("Expected the declared and requested versions in order, got %v", versions)
+	}
+	if emitters := compatibility.Versions[1].Emitters; !slices.Equal(emitters, []string{"test-org/library"}) {
+		t.Errorf("Expected version 2.0.0 to be declared once by the library, got %v", emitters)
+	}
+	if emitters := compatibility.Versions[2].Emitters; len(emitters) != 0 {
+		t.Errorf("Expected the requested version to have no emitters, got %v", emitters)
+	}
+
+	if len(compatibility.Subscribers) != 2 {
+		t.Fatalf("Expected 2 subscribers, got %+v", compatibility.Subscribers)
+	}
+	app, docs := compatibility.Subscribers[0], compatibility.Subscribers[1]
+	if app.Repository != "test-org/app" || !slices.Equal(app.Accepted, []string{"1.0.0"}) || !slices.Equal(app.Rejected, []string{"2.0.0", "3.0.0"}) {
+		t.Errorf("Unexpected compatibility of the app: %+v", app)
+	}
+	if docs.Repository != "test-org/docs" || len(docs.Rejected) != 0 || !docs.Accepts("3.0.0") {
+		t.Errorf("Expected the docs to accept any version, got %+v", docs)
+	}
+
+	if _, err := dm.CheckEventCompatibility("library_released", []string{"v3"}, evaluator); err == nil || !strings.Contains(err.Error(), "invalid schema version 'v3'") {
+		t.Errorf("Expected an invalid version to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package engine
+
+import (
+	"fmt"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// payloadValueType returns the JSON type of a payload value: string, number, boolean, object or
+// array. It returns an empty string for nil and values of other types.
+func payloadValueType(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return config.PayloadFieldString
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return config.PayloadFieldNumber
+	case bool:
+		return config.PayloadFieldBoolean
+	case map[string]interface{}:
+		return config.PayloadFieldObject
+	case []interface{}:
+		return config.PayloadFieldArray
+	default:
+		return ""
+	}
+}
+
+// payloadTypes returns the JSON types of the fields of a payload.
+func payloadTypes(payload map[string]interface{}) map[string]string {
+	types := make(map[string]string, len(payload))
+	for field, value := range payload {
+		types[field] = payloadValueType(value)
+	}
+	return types
+}
+
+// findEventSchema returns the schema of an event type at a schema version among the declared
+// ones. Events without a schema version are checked against the highest version declared for
+// their type. It returns nil when the type has no schema at that version.
+func findEventSchema(schemas []config.EventPayloadSchema, eventType, version string) *config.EventPayloadSchema {
+	var found *config.EventPayloadSchema
+	var foundVersion SemVer
+	for i := range schemas {
+		schema := &schemas[i]
+		if schema.Type != eventType {
+			continue
+		}
+		if version != "" {
+			if schema.SchemaVersion == version {
+				return schema
+			}
+			continue
+		}
+		// Schemas without a version rank below every versioned one
+		schemaVersion := SemVer{Major: -1}
+		if schema.SchemaVersion != "" {
+			parsed, err := parseSemVer(schema.SchemaVersion)
+			if err != nil {
+				continue
+			}
+			schemaVersion = parsed
+		}
+		if found == nil || compareVersions(schemaVersion, foundVersion) > 0 {
+			found, foundVersion = schema, schemaVersion
+		}
+	}
+	return found
+}
+
+// checkPayloadSchema returns the violations of a schema by the types of the fields of a payload:
+// the required fields it lacks, then the declared fields it carries with another type.
+func checkPayloadSchema(schema *config.EventPayloadSchema, types map[string]string) []string {
+	var violations []string
+	for _, field := range schema.Required {
+		if _, ok := types[field]; !ok {
+			violations = append(violations, fmt.Sprintf("required field '%s' is missing", field))
+		}
+	}
+	for _, field := range sortedKeys(types) {
+		declared, ok := schema.Fields[field]
+		if ok && types[field] != declared {
+			violations = append(violations, fmt.Sprintf("field '%s' is of type %s, expected %s", field, describePayloadType(types[field]), declared))
+		}
+	}
+	return violations
+}
+
+// checkConsumedFields returns the violations of the contract of a subscription by the types of
+// the fields of a payload: the consumed fields it lacks or carries with another type, sorted by
+// field.
+func checkConsumedFields(consumes map[string]string, types map[string]string) []string {
+	var violations []string
+	for _, field := range sortedKeys(consumes) {
+		actual, ok := types[field]
+		switch {
+		case !ok:
+			violations = append(violations, fmt.Sprintf("consumed field '%s' is missing", field))
+		case actual != consumes[field]:
+			violations = append(violations, fmt.Sprintf("consumed field '%s' is of type %s, expected %s", field, describePayloadType(actual), consumes[field]))
+		}
+	}
+	return violations
+}
+
+// describePayloadType names the JSON type of a payload value in violations.
+func describePayloadType(valueType string) string {
+	if valueType == "" {
+		return "null"
+	}
+	return valueType
+}
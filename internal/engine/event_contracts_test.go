@@ -0,0 +1,142 @@
+package engine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestFindEventSchema(t *testing.T) {
+	schemas := []config.EventPayloadSchema{
+		{Type: "library_built", Fields: map[string]string{"name": "string"}},
+		{Type: "library_built", SchemaVersion: "1.2.0", Fields: map[string]string{"version": "string"}},
+		{Type: "library_built", SchemaVersion: "1.10.0", Fields: map[string]string{"version": "string", "size": "number"}},
+		{Type: "docs_published", Fields: map[string]string{"url": "string"}},
+	}
+
+	tests := []struct {
+		name      string
+		eventType string
+		version   string
+		want      string
+	}{
+		{"exact version", "library_built", "1.2.0", "1.2.0"},
+		{"highest version without one", "library_built", "", "1.10.0"},
+		{"unversioned schema", "docs_published", "", ""},
+		{"undeclared version", "library_built", "2.0.0", "none"},
+		{"undeclared type", "test_completed", "", "none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := findEventSchema(schemas, tt.eventType, tt.version)
+			got := "none"
+			if schema != nil {
+				got = schema.SchemaVersion
+			}
+			if got != tt.want {
+				t.Errorf("findEventSchema(%q, %q) = %q, want %q", tt.eventType, tt.version, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckPayloadSchema(t *testing.T) {
+	schema := &config.EventPayloadSchema{
+		Type:     "library_built",
+		Fields:   map[string]string{"version": "string", "size": "number", "modules": "array"},
+		Required: []string{"version"},
+	}
+
+	violations := checkPayloadSchema(schema, payloadTypes(map[string]interface{}{
+		"size":    "12",
+		"modules": []interface{}{"core"},
+		"extra":   true,
+	}))
+	want := []string{
+		"required field 'version' is missing",
+		"field 'size' is of type string, expected number",
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("checkPayloadSchema() = %v, want %v", violations, want)
+	}
+
+	if violations := checkPayloadSchema(schema, payloadTypes(map[string]interface{}{"version": "1.0.0", "size": 12})); len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violations)
+	}
+}
+
+func TestCheckConsumedFields(t *testing.T) {
+	consumes := map[string]string{"version": "string", "count": "number", "meta": "object"}
+
+	violations := checkConsumedFields(consumes, payloadTypes(map[string]interface{}{
+		"version": "1.0.0",
+		"count":   nil,
+	}))
+	want := []string{
+		"consumed field 'count' is of type null, expected number",
+		"consumed field 'meta' is missing",
+	}
+	if !reflect.DeepEqual(violations, want) {
+		t.Errorf("checkConsumedFields() = %v, want %v", violations, want)
+	}
+
+	if violations := checkConsumedFields(consumes, payloadTypes(map[string]interface{}{
+		"version": "1.0.0",
+		"count":   3.0,
+		"meta":    map[string]interface{}{},
+	})); len(violations) != 0 {
+		t.Errorf("expected no violations, got %v", violations)
+	}
+}
+
+func TestFanOutExecutor_EventSchemas(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &orderRecordingWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetEventSchemas([]config.EventPayloadSchema{{
+		Type:          "library_built",
+		SchemaVersion: "1.0.0",
+		Fields:        map[string]string{"version": "string", "size": "number"},
+		Required:      []string{"version"},
+	}})
+
+	// Events violating the declared schema are not emitted
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type": "library_built",
+		"payload":    map[string]interface{}{"size": "large"},
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(1))
+	if err == nil || result.EventEmitted {
+		t.Fatalf("expected the fan-out to fail without emitting, got %+v, %v", result, err)
+	}
+	for _, violation := range []string{"required field 'version' is missing", "field 'size' is of type string, expected number"} {
+		if !strings.Contains(err.Error(), violation) {
+			t.Errorf("expected error to contain %q, got %v", violation, err)
+		}
+	}
+
+	// Declared schema versions are not looked up among the common schemas
+	subscriptions := rolloutSubscriptions(2)
+	subscriptions[1].Subscription.Consumes = map[string]string{"commit": "string"}
+	step = config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"schema_version":    "1.0.0",
+		"payload":           map[string]interface{}{"version": "1.2.3", "size": 12},
+		"wait_for_children": true,
+	}}
+	result, err = executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("ExecuteWithSubscriptions() error = %v", err)
+	}
+
+	// Subscribers whose contract the event breaks are not triggered
+	if result.TriggeredCount != 1 {
+		t.Errorf("expected 1 triggered subscriber, got %d", result.TriggeredCount)
+	}
+	if len(result.Errors) != 1 || !strings.Contains(result.Errors[0], "payload contract violated: consumed field 'commit' is missing") {
+		t.Errorf("expected a contract violation error, got %v", result.Errors)
+	}
+}
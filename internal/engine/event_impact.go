@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// EventImpact is the tree of workflows an event would trigger across the cached repositories:
+// the subscribers of the event, then the subscribers of the events their workflows emit, and so
+// on.
+type EventImpact struct {
+	Repository string `json:"repository"`
+	EventType  string `json:"event_type"`
+	// MaxDepth limits the levels of the tree; 0 for no limit.
+	MaxDepth  int                 `json:"max_depth,omitempty"`
+	Triggered []TriggeredWorkflow `json:"triggered"`
+	// Truncated is whether workflows beyond MaxDepth would be triggered too.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// TriggeredWorkflow is a workflow an event would trigger.
+type TriggeredWorkflow struct {
+	// Depth is 1 for the subscribers of the event, 2 for those of the events they emit, and so on.
+	Depth      int    `json:"depth"`
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	// Event is the event type that triggers the workflow, emitted by Source.
+	Event  string `json:"event"`
+	Source string `json:"source"`
+	// Conditional is whether the subscription has filters, which may reject the event depending
+	// on its payload.
+	Conditional bool `json:"conditional,omitempty"`
+	// Emits are the event types the workflow emits, which trigger the next depth.
+	Emits []string `json:"emits,omitempty"`
+}
+
+// AnalyzeEventImpact returns the workflows of the cached repositories an event emitted by a
+// repository would trigger, directly or through the events their workflows emit, up to maxDepth
+// levels (0 for no limit). Disabled subscriptions are left out; payloads are unknown, so the
+// filters of subscriptions are not evaluated. Each workflow is visited once per event type, so
+// that cycles of events end.
+func (dm *DiscoveryManager) AnalyzeEventImpact(repository, eventType string, maxDepth int) (*EventImpact, error) {
+	if err := validateDiscoveryQuery(repository, eventType); err != nil {
+		return nil, err
+	}
+	if maxDepth < 0 {
+		return nil, fmt.Errorf("depth must not be negative, got %d", maxDepth)
+	}
+	repositories, configs, _, err := dm.loadCachedConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	// Event types each workflow emits, by repository:workflow
+	emits := make(map[string][]string)
+	for _, name := range repositories {
+		if cfg := configs[name]; cfg != nil {
+			for _, event := range ListEmittedEvents(name, cfg) {
+				key := name + ":" + event.Workflow
+				if !slices.Contains(emits[key], event.Type) {
+					emits[key] = append(emits[key], event.Type)
+				}
+			}
+		}
+	}
+	for key := range emits {
+		slices.Sort(emits[key])
+	}
+
+	type emission struct{ source, eventType string }
+	impact := &EventImpact{Repository: repository, EventType: eventType, MaxDepth: maxDepth, Triggered: make([]TriggeredWorkflow, 0)}
+	visited := map[string]bool{repository + ":" + eventType: true}
+	frontier := []emission{{repository, eventType}}
+	now := time.Now()
+	for depth := 1; len(frontier) > 0; depth++ {
+		var next []emission
+		for _, emitted := range frontier {
+			artifact := emitted.source + ":default"
+			for _, name := range repositories {
+				cfg := configs[name]
+				if cfg == nil {
+					continue
+				}
+				for _, subscription := range cfg.Subscriptions {
+					if !subscriptionMatches(subscription, artifact, emitted.eventType) || !subscription.IsActive(now) {
+						continue
+					}
+					if maxDepth > 0 && depth > maxDepth {
+						impact.Truncated = true
+						continue
+					}
+					triggered := TriggeredWorkflow{
+						Depth:       depth,
+						Repository:  name,
+						Workflow:    subscription.Workflow,
+						Event:       emitted.eventType,
+						Source:      emitted.source,
+						Conditional: len(subscription.Filters) > 0,
+						Emits:       emits[name+":"+subscription.Workflow],
+					}
+					impact.Triggered = append(impact.Triggered, triggered)
+					for _, eventType := range triggered.Emits {
+						key := name + ":" + eventType
+						if !visited[key] {
+							visited[key] = true
+							next = append(next, emission{name, eventType})
+						}
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return impact, nil
+}
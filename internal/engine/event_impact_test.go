@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDiscoveryManager_AnalyzeEventImpact(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    steps:
+      - uses: tako/fan-out@v1
+        with:
+          event_type: app_released
+subscriptions:
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    workflow: "update"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/service", `version: "1.0"
+workflows:
+  deploy:
+    steps:
+      - run: echo "deploy"
+  rebuild:
+    steps:
+      - uses: tako/fan-out@v1
+        with:
+          event_type: library_released
+subscriptions:
+  - artifact: "test-org/app:default"
+    events: ["app_released"]
+    filters: ["event.payload.env == 'prod'"]
+    workflow: "deploy"
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    workflow: "rebuild"
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    workflow: "deploy"
+    disabled: true
+`)
+
+	dm := NewDiscoveryManager(cacheDir)
+	impact, err := dm.AnalyzeEventImpact("test-org/library", "library_released", 0)
+	if err != nil {
+		t.Fatalf("AnalyzeEventImpact failed: %v", err)
+	}
+	var got []string
+	for _, triggered := range impact.Triggered {
+		got = append(got, formatTriggered(triggered))
+	}
+	expected := []string{
+		"1 test-org/app:update by test-org/library:library_released",
+		"1 test-org/service:rebuild by test-org/library:library_released",
+		"2 test-org/service:deploy by test-org/app:app_released (conditional)",
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, got)
+			break
+		}
+	}
+	if impact.Truncated {
+		t.Error("Expected the unlimited analysis not to be truncated")
+	}
+	if emits := impact.Triggered[0].Emits; len(emits) != 1 || emits[0] != "app_released" {
+		t.Errorf("Expected the app to emit app_released, got %v", emits)
+	}
+
+	impact, err = dm.AnalyzeEventImpact("test-org/library", "library_released", 1)
+	if err != nil {
+		t.Fatalf("AnalyzeEventImpact failed: %v", err)
+	}
+	if len(impact.Triggered) != 2 || !impact.Truncated {
+		t.Errorf("Expected the depth limit to truncate the analysis, got %+v", impact)
+	}
+}
+
+// formatTriggered formats a triggered workflow for comparison.
+func formatTriggered(triggered TriggeredWorkflow) string {
+	s := fmt.Sprintf("%d %s:%s by %s:%s", triggered.Depth, triggered.Repository, triggered.Workflow, triggered.Source, triggered.Event)
+	if triggered.Conditional {
+		s += " (conditional)"
+	}
+	return s
+}
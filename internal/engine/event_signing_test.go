@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestSignEvent(t *testing.T) {
+	key := []byte("signing-key")
+	event := NewEventBuilder("library_built").
+		WithSource("source-org/library").
+		WithPayload(map[string]interface{}{"version": "1.0.0", "count": 3}).
+		WithHeader("X-Build", "42").
+		Build()
+
+	if err := VerifyEventSignature(&event, key); !errors.Is(err, ErrEventUnsigned) {
+		t.Fatalf("expected ErrEventUnsigned, got %v", err)
+	}
+	if err := SignEvent(&event, key); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+
+	// The signature survives the JSON of a broker
+	data, err := json.Marshal(event)
+	if err != nil {
+		t.Fatalf("Failed to marshal event: %v", err)
+	}
+	var received EnhancedEvent
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Failed to unmarshal event: %v", err)
+	}
+	if err := VerifyEventSignature(&received, key); err != nil {
+		t.Errorf("expected the received event to verify, got %v", err)
+	}
+
+	if err := VerifyEventSignature(&received, []byte("other-key")); err == nil {
+		t.Errorf("expected a signature from another key to be rejected")
+	}
+	received.Payload["version"] = "2.0.0"
+	if err := VerifyEventSignature(&received, key); err == nil {
+		t.Errorf("expected a tampered payload to be rejected")
+	}
+	received.Payload["version"] = "1.0.0"
+	received.Metadata.Headers["X-Build"] = "43"
+	if err := VerifyEventSignature(&received, key); err == nil {
+		t.Errorf("expected tampered headers to be rejected")
+	}
+}
+
+func TestFanOutExecutor_SubscriptionsVerifySignatures(t *testing.T) {
+	runner := NewRecordingWorkflowRunner()
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	subscriptions := rolloutSubscriptions(2)
+	subscriptions[0].Subscription.SignatureKeyEnv = "TAKO_EVENT_KEY"
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+
+	// Unsigned events only reach the subscriptions that do not require signatures
+	executor.SetEventSigning(nil, []string{"TAKO_EVENT_KEY=signing-key"})
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if result.TriggeredCount != 1 || runner.Recorded()[0].Workflow != "update-2" {
+		t.Errorf("expected only the subscription without a key triggered, got %+v", runner.Recorded())
+	}
+
+	executor.SetEventSigning([]byte("signing-key"), []string{"TAKO_EVENT_KEY=signing-key"})
+	result, err = executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if result.TriggeredCount != 2 {
+		t.Errorf("expected signed events to trigger both subscriptions, got %d", result.TriggeredCount)
+	}
+}
+
+func TestEventDaemon_HandleVerifiesSignatures(t *testing.T) {
+	dispatcher := &recordingDispatcher{}
+	daemon := &EventDaemon{dispatcher: dispatcher}
+	source := daemonSource{
+		config:       config.EventSource{Name: "builds"},
+		signatureKey: []byte("signing-key"),
+	}
+
+	event := NewEventBuilder("build_completed").WithSource("org/ci").Build()
+	unsigned, _ := json.Marshal(event)
+	if err := SignEvent(&event, []byte("signing-key")); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	signed, _ := json.Marshal(event)
+
+	for _, data := range [][]byte{unsigned, signed} {
+		if err := daemon.handle(context.Background(), source, BrokerMessage{Data: data}); err != nil {
+			t.Fatalf("handle() error = %v", err)
+		}
+	}
+	if len(dispatcher.events) != 1 || dispatcher.events[0].Metadata.ID != event.Metadata.ID {
+		t.Errorf("expected only the signed event dispatched, got %d events", len(dispatcher.events))
+	}
+}
+
+func TestEventDaemon_HandleVerifiesSignaturesBeforeDefaults(t *testing.T) {
+	dispatcher := &recordingDispatcher{}
+	daemon := &EventDaemon{dispatcher: dispatcher}
+	source := daemonSource{
+		config:       config.EventSource{Name: "builds", Source: "org/ci"},
+		signatureKey: []byte("signing-key"),
+	}
+
+	// The emitter signs an envelope without a source repository or a payload
+	event := EnhancedEvent{Type: "build_completed", Metadata: EventMetadata{ID: "evt-1"}}
+	if err := SignEvent(&event, []byte("signing-key")); err != nil {
+		t.Fatalf("Failed to sign event: %v", err)
+	}
+	data, _ := json.Marshal(event)
+
+	if err := daemon.handle(context.Background(), source, BrokerMessage{Data: data}); err != nil {
+		t.Fatalf("handle() error = %v", err)
+	}
+	if len(dispatcher.events) != 1 {
+		t.Fatalf("expected the signed event dispatched, got %d events", len(dispatcher.events))
+	}
+	dispatched := dispatcher.events[0]
+	if dispatched.Metadata.Source != "org/ci" || dispatched.Payload == nil {
+		t.Errorf("expected the defaults of the source filled in, got source %q and payload %v", dispatched.Metadata.Source, dispatched.Payload)
+	}
+	if len(dispatcher.received) != 1 || VerifyEventSignature(dispatcher.received[0], []byte("signing-key")) != nil {
+		t.Errorf("expected the envelope as received dispatched for subscribers to verify")
+	}
+}
+
+func TestNewEventDaemon_ReadsSignatureKeysFromEnvironment(t *testing.T) {
+	cfg := &config.DaemonConfig{Sources: []config.EventSource{
+		{Name: "builds", Type: "kafka", URL: "http://localhost:8082", Topic: "builds", SignatureKeyEnv: "TAKO_EVENT_KEY"},
+	}}
+	daemon, err := NewEventDaemon(cfg, &recordingDispatcher{}, []string{"TAKO_EVENT_KEY=signing-key"})
+	if err != nil {
+		t.Fatalf("NewEventDaemon() error = %v", err)
+	}
+	if string(daemon.sources[0].signatureKey) != "signing-key" {
+		t.Errorf("expected the signature key of the environment, got %q", daemon.sources[0].signatureKey)
+	}
+	if _, err := NewEventDaemon(cfg, &recordingDispatcher{}, nil); err == nil || !strings.Contains(err.Error(), "TAKO_EVENT_KEY") {
+		t.Errorf("expected a missing signature key to fail, got %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// eventSinkTimeout bounds the publication of an event to a sink.
+const eventSinkTimeout = 10 * time.Second
+
+// EventSink publishes events to an external system.
+type EventSink interface {
+	// Name identifies the sink in logs.
+	Name() string
+	// Publish sends the event, as EnhancedEvent JSON.
+	Publish(ctx context.Context, event *EnhancedEvent) error
+}
+
+// EventPublisher publishes events to the sinks configured in tako.yml, each restricted to
+// its event types.
+type EventPublisher struct {
+	sinks []filteredSink
+}
+
+type filteredSink struct {
+	sink   EventSink
+	events []string // All event types when empty
+}
+
+// NewEventPublisher creates the sinks of a configuration. The environment, given as
+// KEY=value, provides the secrets of the sinks.
+func NewEventPublisher(sinks []config.EventSink, environment []string) (*EventPublisher, error) {
+	publisher := &EventPublisher{}
+	for i, cfg := range sinks {
+		sink, err := NewEventSink(cfg, environment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event sink %d: %w", i, err)
+		}
+		publisher.AddSink(sink, cfg.Events...)
+	}
+	return publisher, nil
+}
+
+// AddSink adds a sink receiving the given event types, or all events when none are given.
+func (p *EventPublisher) AddSink(sink EventSink, events ...string) {
+	p.sinks = append(p.sinks, filteredSink{sink: sink, events: events})
+}
+
+// Publish sends an event to the sinks that accept it and returns the errors of the sinks that
+// failed. Sinks are best effort: their failures never stop a fan-out.
+func (p *EventPublisher) Publish(ctx context.Context, event *EnhancedEvent) []error {
+	var errs []error
+	for _, s := range p.sinks {
+		if len(s.events) > 0 && !slices.Contains(s.events, event.Type) {
+			continue
+		}
+		sinkCtx, cancel := context.WithTimeout(ctx, eventSinkTimeout)
+		if err := s.sink.Publish(sinkCtx, event); err != nil {
+			errs = append(errs, fmt.Errorf("failed to publish event to %s: %w", s.sink.Name(), err))
+		}
+		cancel()
+	}
+	return errs
+}
+
+// NewEventSink creates the sink of a configuration.
+func NewEventSink(cfg config.EventSink, environment []string) (EventSink, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url '%s': %w", cfg.URL, err)
+	}
+
+	switch cfg.Type {
+	case config.EventSinkNATS:
+		return &NATSSink{url: target, subject: cfg.Subject}, nil
+	case config.EventSinkKafka:
+		return &KafkaRESTSink{url: strings.TrimSuffix(cfg.URL, "/"), topic: cfg.Topic, headers: cfg.Headers, client: http.DefaultClient}, nil
+	default:
+		sink := &WebhookSink{url: cfg.URL, headers: cfg.Headers, client: http.DefaultClient}
+		if cfg.SecretEnv != "" {
+			secret, ok := lookupEnvironment(environment, cfg.SecretEnv)
+			if !ok {
+				return nil, fmt.Errorf("secret_env %s is not set", cfg.SecretEnv)
+			}
+			sink.secret = []byte(secret)
+		}
+		return sink, nil
+	}
+}
+
+// sinkDestination replaces {type} with the event type in a subject or topic.
+func sinkDestination(destination string, event *EnhancedEvent) string {
+	return strings.ReplaceAll(destination, "{type}", event.Type)
+}
+
+// NATSSink publishes events to a NATS subject, speaking the NATS client protocol over a
+// connection per event. Servers supporting headers receive the event ID as Nats-Msg-Id, which
+// JetStream uses to deduplicate messages.
+type NATSSink struct {
+	url     *url.URL
+	subject string
+}
+
+// Name implements EventSink.
+func (s *NATSSink) Name() string {
+	return "nats subject " + s.subject
+}
+
+// Publish implements EventSink.
+func (s *NATSSink) Publish(ctx context.Context, event *EnhancedEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	conn, err := dialNATS(ctx, s.url)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.publish(sinkDestination(s.subject, event), event.Metadata.ID, data); err != nil {
+		return err
+	}
+	return conn.flush()
+}
+
+// KafkaRESTSink produces events to a Kafka topic through a Kafka REST Proxy (API v2), keyed
+// by event type.
+type KafkaRESTSink struct {
+	url     string
+	topic   string
+	headers map[string]string
+	client  *http.Client
+}
+
+// Name implements EventSink.
+func (s *KafkaRESTSink) Name() string {
+	return "kafka topic " + s.topic
+}
+
+// Publish implements EventSink.
+func (s *KafkaRESTSink) Publish(ctx context.Context, event *EnhancedEvent) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"records": []map[string]interface{}{{"key": event.Type, "value": event}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	topicURL := s.url + "/topics/" + url.PathEscape(sinkDestination(s.topic, event))
+	return postEvent(ctx, s.client, topicURL, "application/vnd.kafka.json.v2+json", body, s.headers)
+}
+
+// WebhookSink POSTs events to a URL. With a secret, the X-Tako-Signature-256 header holds
+// the hex HMAC-SHA256 of the body, as "sha256=<hex>".
+type WebhookSink struct {
+	url     string
+	headers map[string]string
+	secret  []byte
+	client  *http.Client
+}
+
+// Name implements EventSink.
+func (s *WebhookSink) Name() string {
+	if parsed, err := url.Parse(s.url); err == nil {
+		return "webhook " + parsed.Host
+	}
+	return "webhook"
+}
+
+// Publish implements EventSink.
+func (s *WebhookSink) Publish(ctx context.Context, event *EnhancedEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	headers := map[string]string{
+		"X-Tako-Event":    event.Type,
+		"X-Tako-Delivery": event.Metadata.ID,
+	}
+	for name, value := range s.headers {
+		headers[name] = value
+	}
+	if len(s.secret) > 0 {
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write(body)
+		headers["X-Tako-Signature-256"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return postEvent(ctx, s.client, s.url, "application/json", body, headers)
+}
+
+// postEvent POSTs a body and fails on responses other than 2xx.
+func postEvent(ctx context.Context, client *http.Client, target, contentType string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	return nil
+}
+
+// lookupEnvironment returns the value of a variable of an environment given as KEY=value.
+func lookupEnvironment(environment []string, name string) (string, bool) {
+	for i := len(environment) - 1; i >= 0; i-- {
+		if key, value, ok := strings.Cut(environment[i], "="); ok && key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func newTestEvent() *EnhancedEvent {
+	event := NewEventBuilder("library_built").
+		WithSource("org/lib").
+		WithPayload(map[string]interface{}{"version": "1.2.0"}).
+		Build()
+	return &event
+}
+
+// fakeNATSServer accepts one connection, answers PING with PONG and sends what the client
+// published on the returned channel, as "<verb> <subject>\n<headers><payload>".
+func fakeNATSServer(t *testing.T, headers bool) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	published := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`INFO {"server_id":"test","headers":` + strconv.FormatBool(headers) + "}\r\n"))
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			switch fields[0] {
+			case "PUB", "HPUB":
+				size, _ := strconv.Atoi(fields[len(fields)-1])
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(reader, data); err != nil {
+					return
+				}
+				published <- fields[0] + " " + fields[1] + "\n" + string(data[:size])
+			case "PING":
+				conn.Write([]byte("PONG\r\n"))
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), published
+}
+
+func TestNATSSink(t *testing.T) {
+	for _, headers := range []bool{true, false} {
+		t.Run("headers="+strconv.FormatBool(headers), func(t *testing.T) {
+			url, published := fakeNATSServer(t, headers)
+			sink, err := NewEventSink(config.EventSink{Type: config.EventSinkNATS, URL: url, Subject: "tako.{type}"}, nil)
+			if err != nil {
+				t.Fatalf("NewEventSink() error = %v", err)
+			}
+
+			event := newTestEvent()
+			if err := sink.Publish(context.Background(), event); err != nil {
+				t.Fatalf("Publish() error = %v", err)
+			}
+			message := <-published
+			if headers {
+				if !strings.HasPrefix(message, "HPUB tako.library_built\nNATS/1.0\r\nNats-Msg-Id: "+event.Metadata.ID+"\r\n") {
+					t.Errorf("expected the event ID as message ID, got %q", message)
+				}
+			} else if !strings.HasPrefix(message, "PUB tako.library_built\n{") {
+				t.Errorf("unexpected message %q", message)
+			}
+			if !strings.Contains(message, `"version":"1.2.0"`) {
+				t.Errorf("expected the event payload, got %q", message)
+			}
+		})
+	}
+}
+
+func TestKafkaRESTSink(t *testing.T) {
+	var path, contentType string
+	var body struct {
+		Records []struct {
+			Key   string        `json:"key"`
+			Value EnhancedEvent `json:"value"`
+		} `json:"records"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, contentType = r.URL.Path, r.Header.Get("Content-Type")
+		json.NewDecoder(r.Body).Decode(&body)
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer server.Close()
+
+	sink, err := NewEventSink(config.EventSink{Type: config.EventSinkKafka, URL: server.URL + "/", Topic: "tako-events"}, nil)
+	if err != nil {
+		t.Fatalf("NewEventSink() error = %v", err)
+	}
+	if err := sink.Publish(context.Background(), newTestEvent()); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+	if path != "/topics/tako-events" || contentType != "application/vnd.kafka.json.v2+json" {
+		t.Errorf("unexpected request to %s with content type %s", path, contentType)
+	}
+	if len(body.Records) != 1 || body.Records[0].Key != "library_built" || body.Records[0].Value.Metadata.Source != "org/lib" {
+		t.Errorf("unexpected records: %+v", body.Records)
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	var received http.Header
+	var payload []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+		payload, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	sink, err := NewEventSink(config.EventSink{
+		Type:      config.EventSinkWebhook,
+		URL:       server.URL,
+		Headers:   map[string]string{"X-Team": "platform"},
+		SecretEnv: "WEBHOOK_SECRET",
+	}, []string{"WEBHOOK_SECRET=s3cr3t-key"})
+	if err != nil {
+		t.Fatalf("NewEventSink() error = %v", err)
+	}
+	event := newTestEvent()
+	if err := sink.Publish(context.Background(), event); err != nil {
+		t.Fatalf("Publish() error = %v", err)
+	}
+
+	mac := hmac.New(sha256.New, []byte("s3cr3t-key"))
+	mac.Write(payload)
+	if got, want := received.Get("X-Tako-Signature-256"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Errorf("expected signature %s, got %s", want, got)
+	}
+	if received.Get("X-Tako-Event") != "library_built" || received.Get("X-Tako-Delivery") != event.Metadata.ID || received.Get("X-Team") != "platform" {
+		t.Errorf("unexpected headers: %v", received)
+	}
+
+	if _, err := NewEventSink(config.EventSink{Type: config.EventSinkWebhook, URL: server.URL, SecretEnv: "MISSING"}, nil); err == nil {
+		t.Errorf("expected an error for an unset secret")
+	}
+}
+
+// failingSink fails every publication.
+type failingSink struct{ calls int }
+
+func (s *failingSink) Name() string { return "failing" }
+
+func (s *failingSink) Publish(context.Context, *EnhancedEvent) error {
+	s.calls++
+	return errors.New("broker unavailable")
+}
+
+func TestEventPublisher(t *testing.T) {
+	all, filtered := &failingSink{}, &failingSink{}
+	publisher := &EventPublisher{}
+	publisher.AddSink(all)
+	publisher.AddSink(filtered, "release_published")
+
+	errs := publisher.Publish(context.Background(), newTestEvent())
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "failed to publish event to failing: broker unavailable") {
+		t.Errorf("expected the error of the unfiltered sink, got %v", errs)
+	}
+	if all.calls != 1 || filtered.calls != 0 {
+		t.Errorf("expected only the unfiltered sink to be called, got %d and %d calls", all.calls, filtered.calls)
+	}
+}
@@ -0,0 +1,493 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+const (
+	// DefaultEventSourcePollInterval is the wait between Kafka polls returning no records.
+	DefaultEventSourcePollInterval = time.Second
+
+	// Bounds of the wait before a source whose connection failed reconnects.
+	eventSourceMinBackoff = time.Second
+	eventSourceMaxBackoff = 30 * time.Second
+)
+
+// BrokerMessage is a message received from an event source.
+type BrokerMessage struct {
+	// ID is the broker's ID of the message, the same when the broker redelivers it; empty when
+	// the broker has none.
+	ID   string
+	Data []byte
+}
+
+// EventSource receives messages from a message broker.
+type EventSource interface {
+	// Name identifies the source in logs.
+	Name() string
+	// Receive calls handle for every message until ctx is done or the connection fails. A
+	// message is acknowledged once handle returns nil; an error of handle closes the connection
+	// without acknowledging it, so that the broker redelivers it to the next connection.
+	Receive(ctx context.Context, handle func(context.Context, BrokerMessage) error) error
+}
+
+// NewEventSource creates the source of a daemon configuration.
+func NewEventSource(cfg config.EventSource) (EventSource, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	target, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url '%s': %w", cfg.URL, err)
+	}
+
+	if cfg.Type == config.EventSourceNATS {
+		return &NATSSource{url: target, subject: cfg.Subject, queue: cfg.Queue}, nil
+	}
+	source := &KafkaRESTSource{
+		url:          strings.TrimSuffix(cfg.URL, "/"),
+		topic:        cfg.Topic,
+		group:        cfg.Group,
+		headers:      cfg.Headers,
+		pollInterval: DefaultEventSourcePollInterval,
+		client:       http.DefaultClient,
+	}
+	if source.group == "" {
+		source.group = config.DefaultEventSourceGroup
+	}
+	if cfg.PollInterval != "" {
+		if source.pollInterval, err = time.ParseDuration(cfg.PollInterval); err != nil {
+			return nil, fmt.Errorf("invalid poll_interval: %w", err)
+		}
+	}
+	return source, nil
+}
+
+// NATSSource subscribes to a NATS subject, optionally in a queue group. Messages published by
+// a NATS sink are identified by their Nats-Msg-Id header, and messages of JetStream push
+// consumers by their stream sequence; JetStream messages are acknowledged after they are
+// handled.
+type NATSSource struct {
+	url     *url.URL
+	subject string
+	queue   string
+}
+
+// Name implements EventSource.
+func (s *NATSSource) Name() string {
+	return "nats subject " + s.subject
+}
+
+// Receive implements EventSource.
+func (s *NATSSource) Receive(ctx context.Context, handle func(context.Context, BrokerMessage) error) error {
+	dialCtx, cancel := context.WithTimeout(ctx, eventSinkTimeout)
+	conn, err := dialNATS(dialCtx, s.url)
+	cancel()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	subscribe := fmt.Sprintf("SUB %s 1\r\n", s.subject)
+	if s.queue != "" {
+		subscribe = fmt.Sprintf("SUB %s %s 1\r\n", s.subject, s.queue)
+	}
+	if err := conn.write(subscribe); err != nil {
+		return err
+	}
+	if err := conn.flush(); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", s.subject, err)
+	}
+	_ = conn.conn.SetDeadline(time.Time{})
+
+	// Messages are read on their own goroutine, which keeps answering the server's PINGs
+	// while long fan-outs are handled
+	messages := make(chan *natsMessage)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			msg, err := conn.next()
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return fmt.Errorf("connection lost: %w", err)
+		case msg := <-messages:
+			if err := handle(ctx, BrokerMessage{ID: natsMessageID(msg), Data: msg.Data}); err != nil {
+				return err
+			}
+			if strings.HasPrefix(msg.Reply, "$JS.ACK.") {
+				if err := conn.publish(msg.Reply, "", []byte("+ACK")); err != nil {
+					return fmt.Errorf("failed to acknowledge message: %w", err)
+				}
+			}
+		}
+	}
+}
+
+// natsMessageID returns the Nats-Msg-Id of a message, else the stream and stream sequence of
+// a JetStream message, from its $JS.ACK.[<domain>.<account>.]<stream>.<consumer>.<delivered>.
+// <stream sequence>... reply subject.
+func natsMessageID(msg *natsMessage) string {
+	if id := msg.Headers["Nats-Msg-Id"]; id != "" {
+		return id
+	}
+	tokens := strings.Split(msg.Reply, ".")
+	switch {
+	case len(tokens) < 9 || tokens[0] != "$JS" || tokens[1] != "ACK":
+		return ""
+	case len(tokens) == 9:
+		return tokens[2] + "-" + tokens[5]
+	default:
+		return tokens[4] + "-" + tokens[7]
+	}
+}
+
+// KafkaRESTSource consumes a Kafka topic in a consumer group, through a Kafka REST Proxy (API
+// v2). Offsets are committed once their record is handled, and records are identified by
+// their topic, partition and offset.
+type KafkaRESTSource struct {
+	url          string
+	topic        string
+	group        string
+	headers      map[string]string
+	pollInterval time.Duration
+	client       *http.Client
+}
+
+// kafkaRecord is a record returned by the REST Proxy.
+type kafkaRecord struct {
+	Topic     string          `json:"topic"`
+	Value     json.RawMessage `json:"value"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+}
+
+// Name implements EventSource.
+func (s *KafkaRESTSource) Name() string {
+	return "kafka topic " + s.topic
+}
+
+// Receive implements EventSource.
+func (s *KafkaRESTSource) Receive(ctx context.Context, handle func(context.Context, BrokerMessage) error) error {
+	var instance struct {
+		BaseURI string `json:"base_uri"`
+	}
+	err := s.request(ctx, http.MethodPost, s.url+"/consumers/"+url.PathEscape(s.group), map[string]string{
+		"name":               "tako-" + GenerateRunID(),
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &instance)
+	if err != nil {
+		return fmt.Errorf("failed to create consumer: %w", err)
+	}
+	defer func() {
+		// The consumer leaves the group even when ctx is done
+		deleteCtx, cancel := context.WithTimeout(context.Background(), eventSinkTimeout)
+		defer cancel()
+		if err := s.request(deleteCtx, http.MethodDelete, instance.BaseURI, nil, nil); err != nil {
+			slog.Warn("failed to delete Kafka consumer", "consumer", instance.BaseURI, "error", err)
+		}
+	}()
+
+	if err := s.request(ctx, http.MethodPost, instance.BaseURI+"/subscription", map[string][]string{"topics": {s.topic}}, nil); err != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", s.topic, err)
+	}
+
+	for {
+		var records []kafkaRecord
+		if err := s.request(ctx, http.MethodGet, instance.BaseURI+"/records", nil, &records); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to poll records: %w", err)
+		}
+
+		for _, record := range records {
+			msg := BrokerMessage{ID: fmt.Sprintf("%s-%d-%d", record.Topic, record.Partition, record.Offset), Data: record.Value}
+			if err := handle(ctx, msg); err != nil {
+				return err
+			}
+			offsets := map[string][]map[string]interface{}{
+				"offsets": {{"topic": record.Topic, "partition": record.Partition, "offset": record.Offset}},
+			}
+			if err := s.request(ctx, http.MethodPost, instance.BaseURI+"/offsets", offsets, nil); err != nil {
+				return fmt.Errorf("failed to commit offset %d: %w", record.Offset, err)
+			}
+		}
+
+		if len(records) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(s.pollInterval):
+			}
+		}
+	}
+}
+
+// request sends a REST Proxy request and decodes its JSON response into out, if not nil.
+func (s *KafkaRESTSource) request(ctx context.Context, method, target string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/vnd.kafka.v2+json")
+	}
+	req.Header.Set("Accept", "application/vnd.kafka.json.v2+json, application/vnd.kafka.v2+json")
+	for name, value := range s.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// EventDispatcher triggers the subscribers of an event. The event ID, when set, is the
+// idempotency fingerprint of the fan-out: an event dispatched twice with the same ID triggers
+// its subscribers once.
+type EventDispatcher interface {
+	DispatchEvent(ctx context.Context, event *EnhancedEvent, eventID string) (*FanOutResult, error)
+}
+
+// EventDaemon feeds the events received from the sources of a daemon configuration into the
+// subscription matching and fan-out of a dispatcher.
+type EventDaemon struct {
+	sources    []daemonSource
+	dispatcher EventDispatcher
+}
+
+type daemonSource struct {
+	config       config.EventSource
+	source       EventSource
+	signatureKey []byte // Key the source's events must be signed with; nil to accept unsigned events
+}
+
+// NewEventDaemon creates the sources of a daemon configuration. The signature keys of the
+// sources are read from environment, as returned by os.Environ.
+func NewEventDaemon(cfg *config.DaemonConfig, dispatcher EventDispatcher, environment []string) (*EventDaemon, error) {
+	daemon := &EventDaemon{dispatcher: dispatcher}
+	for _, sourceConfig := range cfg.Sources {
+		source, err := NewEventSource(sourceConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid event source '%s': %w", sourceConfig.Name, err)
+		}
+		s := daemonSource{config: sourceConfig, source: source}
+		if sourceConfig.SignatureKeyEnv != "" {
+			if s.signatureKey, err = eventSigningKey(environment, sourceConfig.SignatureKeyEnv); err != nil {
+				return nil, fmt.Errorf("invalid event source '%s': %w", sourceConfig.Name, err)
+			}
+		}
+		daemon.sources = append(daemon.sources, s)
+	}
+	return daemon, nil
+}
+
+// Run receives events until ctx is done. Sources whose connection fails reconnect with an
+// exponential backoff.
+func (d *EventDaemon) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for _, s := range d.sources {
+		wg.Add(1)
+		go func(s daemonSource) {
+			defer wg.Done()
+			d.receive(ctx, s)
+		}(s)
+	}
+	wg.Wait()
+	return nil
+}
+
+// receive runs a source until ctx is done, reconnecting it when it fails.
+func (d *EventDaemon) receive(ctx context.Context, s daemonSource) {
+	backoff := eventSourceMinBackoff
+	for {
+		slog.Info("receiving events", "source", s.config.Name, "from", s.source.Name())
+		started := time.Now()
+		err := s.source.Receive(ctx, func(ctx context.Context, msg BrokerMessage) error {
+			return d.handle(ctx, s, msg)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > eventSourceMaxBackoff {
+			backoff = eventSourceMinBackoff
+		}
+		slog.Warn("event source failed, reconnecting", "source", s.config.Name, "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(2*backoff, eventSourceMaxBackoff)
+	}
+}
+
+// handle dispatches the event of a message. Messages that are not events, or whose signature
+// does not verify, are logged and skipped, while dispatch errors are returned for the broker
+// to redeliver the message.
+func (d *EventDaemon) handle(ctx context.Context, s daemonSource, msg BrokerMessage) error {
+	cfg := s.config
+	received, err := parseBrokerMessage(cfg, msg.Data)
+	if err != nil {
+		slog.Warn("skipping message that is not an event", "source", cfg.Name, "message_id", msg.ID, "error", err)
+		return nil
+	}
+	// The signature covers the envelope as its emitter sent it, before the defaults of the
+	// source are filled in
+	if s.signatureKey != nil {
+		if err := VerifyEventSignature(received, s.signatureKey); err != nil {
+			slog.Warn("skipping event with an invalid signature", "source", cfg.Name, "message_id", msg.ID, "event", received.Type, "error", err)
+			return nil
+		}
+	}
+	event, err := normalizeBrokerEvent(cfg, received)
+	if err != nil {
+		slog.Warn("skipping message that is not an event", "source", cfg.Name, "message_id", msg.ID, "error", err)
+		return nil
+	}
+
+	eventID := brokerEventID(cfg.Name, msg.ID, event)
+	result, err := d.dispatcher.DispatchEvent(withReceivedEvent(ctx, received), event, eventID)
+	if err != nil {
+		return fmt.Errorf("failed to dispatch event '%s' from %s: %w", event.Type, event.Metadata.Source, err)
+	}
+	slog.Info("dispatched event",
+		"source", cfg.Name,
+		"event", event.Type,
+		"from", event.Metadata.Source,
+		"fan_out_id", result.FanOutID,
+		"triggered", result.TriggeredCount)
+	return nil
+}
+
+// contextKeyReceivedEvent carries the envelope of an event as it was received from a broker.
+const contextKeyReceivedEvent contextKey = "received_event"
+
+// withReceivedEvent returns a context carrying the envelope of the event dispatched with it,
+// as it was received from a broker.
+func withReceivedEvent(ctx context.Context, event *EnhancedEvent) context.Context {
+	return context.WithValue(ctx, contextKeyReceivedEvent, event)
+}
+
+// receivedEventFromContext returns the envelope of the event carried by a context, and whether
+// it carries one.
+func receivedEventFromContext(ctx context.Context) (*EnhancedEvent, bool) {
+	event, ok := ctx.Value(contextKeyReceivedEvent).(*EnhancedEvent)
+	return event, ok && event != nil
+}
+
+// decodeBrokerMessage decodes a message into an event. Messages with a type are EnhancedEvent
+// JSON; other JSON objects are the payload of an event of the source's event_type, emitted by
+// its source repository.
+func decodeBrokerMessage(cfg config.EventSource, data []byte) (*EnhancedEvent, error) {
+	event, err := parseBrokerMessage(cfg, data)
+	if err != nil {
+		return nil, err
+	}
+	return normalizeBrokerEvent(cfg, event)
+}
+
+// parseBrokerMessage decodes a message into the event it carries, as it was sent.
+func parseBrokerMessage(cfg config.EventSource, data []byte) (*EnhancedEvent, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, fmt.Errorf("message is not a JSON object: %w", err)
+	}
+
+	event := &EnhancedEvent{}
+	if _, ok := fields["type"].(string); ok {
+		if err := json.Unmarshal(data, event); err != nil {
+			return nil, fmt.Errorf("invalid event: %w", err)
+		}
+	} else {
+		if cfg.EventType == "" {
+			return nil, fmt.Errorf("message has no type and the source has no event_type")
+		}
+		event.Type = cfg.EventType
+		event.Payload = fields
+	}
+	return event, nil
+}
+
+// normalizeBrokerEvent returns a copy of a received event whose source repository defaults to
+// the one of its source, and whose payload is never nil.
+func normalizeBrokerEvent(cfg config.EventSource, received *EnhancedEvent) (*EnhancedEvent, error) {
+	event := *received
+	if event.Metadata.Source == "" {
+		event.Metadata.Source = cfg.Source
+	}
+	if event.Metadata.Source == "" {
+		return nil, fmt.Errorf("event '%s' has no source repository and the source sets none", event.Type)
+	}
+	if event.Payload == nil {
+		event.Payload = make(map[string]interface{})
+	}
+	return &event, nil
+}
+
+// brokerEventID derives the idempotency fingerprint of a message from its broker ID, else
+// from the ID of its event, scoped to the source; it is empty when neither is known, and the
+// fan-out then hashes the event's payload.
+func brokerEventID(sourceName, messageID string, event *EnhancedEvent) string {
+	id := messageID
+	if id == "" {
+		id = event.Metadata.ID
+	}
+	if id == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(sourceName + "\x00" + id))
+	return hex.EncodeToString(sum[:])
+}
+
+// _ ensures the runner dispatches the events of the daemon.
+var _ EventDispatcher = (*Runner)(nil)
@@ -0,0 +1,322 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// fakeNATSPublisher accepts one connection, delivers the given messages to its subscription
+// once subscribed, and sends the lines the client writes afterwards on the returned channel.
+func fakeNATSPublisher(t *testing.T, messages ...string) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	lines := make(chan string, 16)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Write([]byte(`INFO {"server_id":"test","headers":true}` + "\r\n"))
+
+		reader := bufio.NewReader(conn)
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "PING":
+				conn.Write([]byte("PONG\r\n"))
+				for _, msg := range messages {
+					conn.Write([]byte(msg))
+				}
+				messages = nil
+			case strings.HasPrefix(line, "PUB "):
+				payload, _ := reader.ReadString('\n')
+				lines <- line + " " + strings.TrimSpace(payload)
+			default:
+				lines <- line
+			}
+		}
+	}()
+	return "nats://" + listener.Addr().String(), lines
+}
+
+func TestNATSSource(t *testing.T) {
+	event := `{"type":"library_built","payload":{"version":"1.2.0"},"metadata":{"source":"org/lib"}}`
+	headers := "NATS/1.0\r\nNats-Msg-Id: msg-1\r\n\r\n"
+	url, lines := fakeNATSPublisher(t,
+		fmt.Sprintf("HMSG tako.events 1 %d %d\r\n%s%s\r\n", len(headers), len(headers)+len(event), headers, event),
+		fmt.Sprintf("MSG tako.events 1 $JS.ACK.EVENTS.tako.1.42.7.1700000000.0 %d\r\n%s\r\n", len(event), event),
+	)
+	source, err := NewEventSource(config.EventSource{Name: "events", Type: config.EventSourceNATS, URL: url, Subject: "tako.events", Queue: "workers"})
+	if err != nil {
+		t.Fatalf("NewEventSource() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var received []BrokerMessage
+	err = source.Receive(ctx, func(_ context.Context, msg BrokerMessage) error {
+		received = append(received, msg)
+		if len(received) == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Receive() error = %v", err)
+	}
+
+	if len(received) != 2 || received[0].ID != "msg-1" || received[1].ID != "EVENTS-42" {
+		t.Fatalf("expected the message IDs msg-1 and EVENTS-42, got %+v", received)
+	}
+	if string(received[0].Data) != event {
+		t.Errorf("unexpected data %q", received[0].Data)
+	}
+
+	// The server may read the acknowledgement after Receive returned
+	var sent []string
+	timeout := time.After(5 * time.Second)
+	for !strings.HasPrefix(strings.Join(sent, "\n"), "CONNECT") || !strings.Contains(strings.Join(sent, "\n"), "+ACK") {
+		select {
+		case line := <-lines:
+			sent = append(sent, line)
+		case <-timeout:
+			t.Fatalf("expected the JetStream message to be acknowledged, got %q", sent)
+		}
+	}
+	all := strings.Join(sent, "\n")
+	if !strings.Contains(all, "SUB tako.events workers 1") {
+		t.Errorf("expected a queue subscription, got %q", all)
+	}
+	if !strings.Contains(all, "PUB $JS.ACK.EVENTS.tako.1.42.7.1700000000.0 4 +ACK") {
+		t.Errorf("expected the acknowledgement on the reply subject, got %q", all)
+	}
+}
+
+// fakeKafkaRESTProxy serves the consumer API of a REST Proxy, returning the given records on
+// the first poll and recording the committed offsets.
+type fakeKafkaRESTProxy struct {
+	mu        sync.Mutex
+	records   string
+	committed []int64
+	deleted   bool
+}
+
+func (p *fakeKafkaRESTProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/consumers/tako":
+		fmt.Fprintf(w, `{"instance_id":"i","base_uri":"http://%s/consumers/tako/instances/i"}`, r.Host)
+	case r.URL.Path == "/consumers/tako/instances/i/subscription":
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/consumers/tako/instances/i/records":
+		records := p.records
+		p.records = "[]"
+		w.Write([]byte(records))
+	case r.URL.Path == "/consumers/tako/instances/i/offsets":
+		var body struct {
+			Offsets []struct {
+				Offset int64 `json:"offset"`
+			} `json:"offsets"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		p.committed = append(p.committed, body.Offsets[0].Offset)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		p.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestKafkaRESTSource(t *testing.T) {
+	proxy := &fakeKafkaRESTProxy{records: `[
+		{"topic":"builds","partition":0,"offset":7,"value":{"version":"1.2.0"}},
+		{"topic":"builds","partition":0,"offset":8,"value":{"version":"1.3.0"}}
+	]`}
+	server := httptest.NewServer(proxy)
+	defer server.Close()
+
+	source, err := NewEventSource(config.EventSource{Name: "builds", Type: config.EventSourceKafka, URL: server.URL, Topic: "builds", PollInterval: "10ms"})
+	if err != nil {
+		t.Fatalf("NewEventSource() error = %v", err)
+	}
+
+	// A failing handler stops the source before the offset of its record is committed
+	var ids []string
+	err = source.Receive(context.Background(), func(_ context.Context, msg BrokerMessage) error {
+		ids = append(ids, msg.ID)
+		if len(ids) == 2 {
+			return errors.New("dispatch failed")
+		}
+		return nil
+	})
+	if err == nil || err.Error() != "dispatch failed" {
+		t.Fatalf("expected the handler's error, got %v", err)
+	}
+	if strings.Join(ids, ",") != "builds-0-7,builds-0-8" {
+		t.Errorf("unexpected message IDs %v", ids)
+	}
+	if len(proxy.committed) != 1 || proxy.committed[0] != 7 {
+		t.Errorf("expected only offset 7 to be committed, got %v", proxy.committed)
+	}
+	if !proxy.deleted {
+		t.Errorf("expected the consumer to be deleted")
+	}
+}
+
+func TestDecodeBrokerMessage(t *testing.T) {
+	source := config.EventSource{Name: "builds", EventType: "build_completed", Source: "org/ci"}
+
+	event, err := decodeBrokerMessage(source, []byte(`{"type":"library_built","payload":{"version":"1.2.0"},"metadata":{"id":"evt-1","source":"org/lib"}}`))
+	if err != nil {
+		t.Fatalf("decodeBrokerMessage() error = %v", err)
+	}
+	if event.Type != "library_built" || event.Metadata.Source != "org/lib" || event.Payload["version"] != "1.2.0" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	event, err = decodeBrokerMessage(source, []byte(`{"commit":"abc123"}`))
+	if err != nil {
+		t.Fatalf("decodeBrokerMessage() error = %v", err)
+	}
+	if event.Type != "build_completed" || event.Metadata.Source != "org/ci" || event.Payload["commit"] != "abc123" {
+		t.Errorf("expected the source's event type and repository, got %+v", event)
+	}
+
+	if _, err := decodeBrokerMessage(config.EventSource{Name: "raw"}, []byte(`{"commit":"abc123"}`)); err == nil {
+		t.Errorf("expected an error for a message without type")
+	}
+	if _, err := decodeBrokerMessage(source, []byte(`not json`)); err == nil {
+		t.Errorf("expected an error for a message that is not JSON")
+	}
+}
+
+func TestBrokerEventID(t *testing.T) {
+	event := &EnhancedEvent{Metadata: EventMetadata{ID: "evt-1"}}
+	byMessage := brokerEventID("builds", "builds-0-7", event)
+	if byMessage != brokerEventID("builds", "builds-0-7", &EnhancedEvent{}) {
+		t.Errorf("expected the broker ID to identify redelivered messages")
+	}
+	if byMessage == brokerEventID("releases", "builds-0-7", event) {
+		t.Errorf("expected the IDs of different sources to differ")
+	}
+	if byMessage == brokerEventID("builds", "", event) {
+		t.Errorf("expected the event ID without a broker ID")
+	}
+	if !fanOutEventIDRegex.MatchString(byMessage) {
+		t.Errorf("expected an ID usable as fan-out event_id, got %s", byMessage)
+	}
+	if got := brokerEventID("builds", "", &EnhancedEvent{}); got != "" {
+		t.Errorf("expected no ID, got %s", got)
+	}
+}
+
+// recordingDispatcher records the events it dispatches, failing as many times as failures.
+type recordingDispatcher struct {
+	mu       sync.Mutex
+	events   []*EnhancedEvent
+	received []*EnhancedEvent
+	ids      []string
+	failures int
+}
+
+func (d *recordingDispatcher) DispatchEvent(ctx context.Context, event *EnhancedEvent, eventID string) (*FanOutResult, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.failures > 0 {
+		d.failures--
+		return nil, errors.New("discovery failed")
+	}
+	d.events = append(d.events, event)
+	if received, ok := receivedEventFromContext(ctx); ok {
+		d.received = append(d.received, received)
+	}
+	d.ids = append(d.ids, eventID)
+	return &FanOutResult{Success: true}, nil
+}
+
+func TestEventDaemon_Handle(t *testing.T) {
+	dispatcher := &recordingDispatcher{failures: 1}
+	daemon := &EventDaemon{dispatcher: dispatcher}
+	source := daemonSource{config: config.EventSource{Name: "builds", EventType: "build_completed", Source: "org/ci"}}
+	msg := BrokerMessage{ID: "builds-0-7", Data: []byte(`{"commit":"abc123"}`)}
+
+	// Dispatch errors are returned for the broker to redeliver the message
+	if err := daemon.handle(context.Background(), source, msg); err == nil {
+		t.Fatalf("expected the dispatch error")
+	}
+	if err := daemon.handle(context.Background(), source, msg); err != nil {
+		t.Fatalf("handle() error = %v", err)
+	}
+	if len(dispatcher.events) != 1 || dispatcher.ids[0] != brokerEventID("builds", "builds-0-7", nil) {
+		t.Errorf("expected the event dispatched with its broker fingerprint, got %v", dispatcher.ids)
+	}
+
+	// Messages that are not events are skipped
+	if err := daemon.handle(context.Background(), source, BrokerMessage{Data: []byte("garbage")}); err != nil {
+		t.Errorf("expected invalid messages to be skipped, got %v", err)
+	}
+}
+
+func TestFanOutExecutor_EventIDIdempotency(t *testing.T) {
+	runner := NewRecordingWorkflowRunner()
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetIdempotency(true)
+
+	step := func(payload string) config.WorkflowStep {
+		return config.WorkflowStep{ID: "dispatch", Uses: "tako/fan-out@v1", With: map[string]interface{}{
+			"event_type":        "library_built",
+			"payload":           map[string]interface{}{"version": payload},
+			"event_id":          "builds-0-7",
+			"wait_for_children": true,
+		}}
+	}
+
+	first, err := executor.ExecuteWithSubscriptions(step("1.2.0"), "org/lib", nil)
+	if err != nil {
+		t.Fatalf("first fan-out failed: %v", err)
+	}
+	// The same ID is the same event, whatever its payload
+	second, err := executor.ExecuteWithSubscriptions(step("1.2.1"), "org/lib", nil)
+	if err != nil {
+		t.Fatalf("second fan-out failed: %v", err)
+	}
+	if first.FanOutID != "fanout-builds-0-7" || second.FanOutID != first.FanOutID {
+		t.Errorf("expected both fan-outs to be fanout-builds-0-7, got %s and %s", first.FanOutID, second.FanOutID)
+	}
+
+	invalid := step("1.2.0")
+	invalid.With["event_id"] = "../escape"
+	if _, err := executor.ExecuteWithSubscriptions(invalid, "org/lib", nil); err == nil {
+		t.Errorf("expected an error for an event_id that is not a file name")
+	}
+}
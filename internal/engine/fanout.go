@@ -10,7 +10,8 @@
 //   - Deterministic event fingerprinting using SHA256 hashing
 //   - Persistent state management across process restarts
 //   - Configurable retention periods for idempotent states
-//   - Atomic file operations to handle concurrent duplicates
+//   - Atomic file operations to handle concurrent duplicates, and per-child claim files so
+//     that concurrent processes emitting the same event trigger each child exactly once
 //   - Backward compatible (disabled by default)
 //
 // Example Usage:
@@ -23,7 +24,7 @@
 //	executor.SetIdempotency(true)
 //
 //	// Configure custom retention for idempotent states (optional)
-//	executor.stateManager.SetIdempotencyRetention(48 * time.Hour)
+//	executor.SetIdempotencyRetention(48 * time.Hour)
 //
 //	// Execute fan-out step (duplicates will be detected automatically)
 //	result, err := executor.Execute(step, sourceRepo)
@@ -37,8 +38,16 @@ package engine
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -59,11 +68,48 @@ type FanOutExecutor struct {
 	metricsCollector      *MetricsCollector
 	healthChecker         *HealthChecker
 	cleanupManager        *CleanupManager
+	repoLocks             *LockManager
+	cancellations         *CancellationManager
+	approvals             *ApprovalManager     // Approval gates holding children and rollout waves
+	dedup                 *DedupStore          // Recent deliveries to subscriptions with a dedup window
+	digests               *ArtifactDigestStore // Artifact digests subscriptions last ran for
+	changedSince          string               // Only subscribers that changed since this git ref are triggered; all when empty
+	changedRepos          sync.Map             // Whether the repository of a subscriber path changed since changedSince
+	audit                 *AuditLog            // Trigger decisions, for compliance
 	logger                Logger
 	workflowRunner        interfaces.WorkflowRunner
+	gitManager            *GitManager     // Resolves the commits subscribers run against; nil to run the cached checkout
+	eventPublisher        *EventPublisher // Publishes emitted events to external sinks; nil to publish none
+	signingKey            []byte          // Signs emitted events; nil to emit them unsigned
+	receivedEvent         *EnhancedEvent  // Event received from a broker, whose signature subscribers verify
+	environment           []string        // KEY=value entries holding the signature keys of subscriptions
+	faults                *FaultInjector  // Faults injected when children are triggered; nil for none
+	clock                 Clock           // Clock of fan-outs, their states, retries and circuit breakers
+	revisions             *RevisionLock   // Pins subscribers to a replayed lockfile and records their commits; nil for none
 	cacheDir              string
 	debug                 bool
 
+	// Identity used for subscriber repository locks
+	lockRunID       string
+	lockParentRunID string
+
+	// correlationID is the correlation ID of the execution tree, carried by the emitted events
+	correlationID string
+
+	// Payload schemas declared for the emitted events; events of other types are not checked
+	eventSchemas []config.EventPayloadSchema
+
+	// Events config of the diamond strategies of the emitted events; first for all when nil
+	diamondStrategies *config.EventsConfig
+
+	// Lineage of the run performing the fan-outs and maximum fan-out depth of its tree
+	lineage  []string
+	maxDepth int
+
+	// Budget of the child workflows of the execution tree; unlimited when childBudget is nil
+	childBudget      *ChildBudgetStore
+	maxTotalChildren int
+
 	// Configuration
 	retryConfig          RetryConfig
 	circuitBreakerConfig CircuitBreakerConfig
@@ -78,6 +124,7 @@ func NewFanOutExecutor(cacheDir string, debug bool, workflowRunner interfaces.Wo
 	if err != nil {
 		return nil, fmt.Errorf("failed to create subscription evaluator: %v", err)
 	}
+	subscriptionEvaluator.SetPrecompiled(discoveryManager.Catalog())
 
 	// Create state manager for tracking fan-out operations
 	stateDir := filepath.Join(cacheDir, "fanout-states")
@@ -102,6 +149,37 @@ func NewFanOutExecutor(cacheDir string, debug bool, workflowRunner interfaces.Wo
 	cleanupManager := NewCleanupManager(filepath.Join(cacheDir, "workspaces"), 0, debug) // Use default maxAge
 	logger := NewStructuredLogger(debug)
 
+	// Repository locks live in the shared cache so concurrent fan-outs see each other
+	repoLocks, err := NewLockManager(filepath.Join(cacheDir, "repo-locks"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repository lock manager: %v", err)
+	}
+
+	cancellations, err := NewCancellationManager(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cancellation manager: %v", err)
+	}
+
+	approvals, err := NewApprovalManager(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create approval manager: %v", err)
+	}
+
+	dedup, err := NewDedupStore(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	digests, err := NewArtifactDigestStore(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+
 	return &FanOutExecutor{
 		discoveryManager:      discoveryManager,
 		subscriptionEvaluator: subscriptionEvaluator,
@@ -111,6 +189,12 @@ func NewFanOutExecutor(cacheDir string, debug bool, workflowRunner interfaces.Wo
 		metricsCollector:      metricsCollector,
 		healthChecker:         healthChecker,
 		cleanupManager:        cleanupManager,
+		repoLocks:             repoLocks,
+		cancellations:         cancellations,
+		approvals:             approvals,
+		dedup:                 dedup,
+		digests:               digests,
+		audit:                 audit,
 		logger:                logger,
 		workflowRunner:        workflowRunner,
 		cacheDir:              cacheDir,
@@ -121,6 +205,102 @@ func NewFanOutExecutor(cacheDir string, debug bool, workflowRunner interfaces.Wo
 	}, nil
 }
 
+// SetLockOwner sets the run that holds subscriber repository locks during fan-out.
+// The parent run ID links nested fan-outs so that deadlocks across them are detected.
+// When no owner is set, each fan-out operation locks on behalf of its own fan-out ID.
+func (fe *FanOutExecutor) SetLockOwner(runID, parentRunID string) {
+	fe.lockRunID = runID
+	fe.lockParentRunID = parentRunID
+}
+
+// SetCorrelationID sets the correlation ID of the execution tree recorded in the fan-out states
+// of the executor and their children.
+func (fe *FanOutExecutor) SetCorrelationID(correlationID string) {
+	fe.correlationID = correlationID
+	fe.stateManager.SetCorrelationID(correlationID)
+}
+
+// SetNamespace sets the namespace recorded in the fan-out states of the executor.
+func (fe *FanOutExecutor) SetNamespace(namespace string) {
+	fe.stateManager.SetNamespace(namespace)
+}
+
+// SetGitManager sets the Git manager used to resolve the commits subscribers run against.
+// Without one, subscribers run the checkout in the cache and pinned revisions are passed on
+// to the workflow runner unresolved.
+func (fe *FanOutExecutor) SetGitManager(gitManager *GitManager) {
+	fe.gitManager = gitManager
+}
+
+// SetEventPublisher sets the publisher of the events the executor emits to external sinks.
+func (fe *FanOutExecutor) SetEventPublisher(publisher *EventPublisher) {
+	fe.eventPublisher = publisher
+}
+
+// SetEventSigning sets the key signing the events the executor emits, and the environment
+// holding the keys subscriptions verify event signatures with.
+func (fe *FanOutExecutor) SetEventSigning(key []byte, environment []string) {
+	fe.signingKey = key
+	fe.environment = environment
+}
+
+// SetEventSchemas sets the schemas declared for the payloads of the events the executor emits.
+// Events of a declared type violating its schema are not emitted.
+func (fe *FanOutExecutor) SetEventSchemas(schemas []config.EventPayloadSchema) {
+	fe.eventSchemas = schemas
+}
+
+// SetDiamondStrategies sets the events config whose diamond strategies resolve the diamond
+// dependencies of the events the executor emits. Without one, the first subscription wins.
+func (fe *FanOutExecutor) SetDiamondStrategies(events *config.EventsConfig) {
+	fe.diamondStrategies = events
+}
+
+// SetReceivedEvent sets the event a fan-out dispatches on behalf of a broker. Subscriptions
+// verify the signature of this envelope rather than of the one the fan-out rebuilds.
+func (fe *FanOutExecutor) SetReceivedEvent(event *EnhancedEvent) {
+	fe.receivedEvent = event
+}
+
+// SetCircuitBreakerManager sets the manager of the circuit breakers guarding child workflows,
+// so that breakers and their configuration are shared with other executors.
+func (fe *FanOutExecutor) SetCircuitBreakerManager(manager *CircuitBreakerManager) {
+	fe.circuitBreakerManager = manager
+	fe.healthChecker.circuitBreakerManager = manager
+}
+
+// SetFaultInjector sets the faults injected when the executor triggers children and persists
+// its fan-out states.
+func (fe *FanOutExecutor) SetFaultInjector(faults *FaultInjector) {
+	fe.faults = faults
+	fe.stateManager.SetFaultInjector(faults)
+}
+
+// SetClock sets the clock of the executor's fan-outs, of their states, of the delays between
+// retries of their children, of their circuit breakers, of their approval gates, of their
+// repository locks, of their audit entries and of the CEL expressions of their filters and
+// rollout gates.
+func (fe *FanOutExecutor) SetClock(clock Clock) {
+	fe.clock = clock
+	fe.subscriptionEvaluator.SetClock(clock)
+	fe.approvals.SetClock(clock)
+	fe.stateManager.SetClock(clock)
+	fe.repoLocks.SetClock(clock)
+	fe.audit.SetClock(clock)
+	fe.circuitBreakerManager.SetClock(clock)
+}
+
+// SetRevisionLock sets the revision lock of the execution tree, which pins subscribers to the
+// commits of a replayed lockfile and records the commits they run against.
+func (fe *FanOutExecutor) SetRevisionLock(revisions *RevisionLock) {
+	fe.revisions = revisions
+}
+
+// now returns the time of the executor's clock.
+func (fe *FanOutExecutor) now() time.Time {
+	return clockOrSystem(fe.clock).Now()
+}
+
 // SetIdempotency enables or disables idempotency checking for duplicate events.
 //
 // When enabled, the executor will prevent duplicate workflow executions for the same event
@@ -148,7 +328,8 @@ func NewFanOutExecutor(cacheDir string, debug bool, workflowRunner interfaces.Wo
 // Configuration Notes:
 //   - Idempotency is disabled by default for backward compatibility
 //   - When enabled, requires additional disk space for state persistence
-//   - Idempotent states are retained for 24 hours by default (configurable)
+//   - Idempotent states are retained for 24 hours by default (see SetIdempotencyRetention),
+//     after which the event triggers the subscribers again
 //   - Works across process restarts and multiple executor instances
 //
 // Performance Impact:
@@ -159,11 +340,27 @@ func (fe *FanOutExecutor) SetIdempotency(enabled bool) {
 	fe.enableIdempotency = enabled
 }
 
+// SetIdempotencyRetention sets how long the states of finished idempotent fan-outs prevent the
+// fan-outs of the same events from triggering the subscribers again.
+func (fe *FanOutExecutor) SetIdempotencyRetention(retention time.Duration) {
+	fe.stateManager.SetIdempotencyRetention(retention)
+}
+
+// SetStatePersistence sets how the executor writes the states of its fan-outs, e.g. batching the
+// updates of their children.
+func (fe *FanOutExecutor) SetStatePersistence(persistence StatePersistence) {
+	fe.stateManager.SetPersistence(persistence)
+}
+
 // IsIdempotencyEnabled returns whether idempotency checking is enabled.
 func (fe *FanOutExecutor) IsIdempotencyEnabled() bool {
 	return fe.enableIdempotency
 }
 
+// fanOutEventIDRegex restricts event IDs to the characters of fan-out state file names, which
+// idempotent fan-outs derive from the fingerprint.
+var fanOutEventIDRegex = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
 // FanOutParams represents the parameters for the tako/fan-out@v1 step.
 type FanOutParams struct {
 	EventType        string                 `yaml:"event_type"`
@@ -172,6 +369,48 @@ type FanOutParams struct {
 	ConcurrencyLimit int                    `yaml:"concurrency_limit"`
 	Payload          map[string]interface{} `yaml:"payload"`
 	SchemaVersion    string                 `yaml:"schema_version"`
+	Targets          []string               `yaml:"targets"`        // Glob patterns on owner/repo; only matching subscribers are triggered
+	Exclude          []string               `yaml:"exclude"`        // Glob patterns on owner/repo; matching subscribers are never triggered
+	Rollout          *RolloutConfig         `yaml:"rollout"`        // Optional staged rollout triggering subscribers in waves
+	Refs             map[string]string      `yaml:"refs"`           // Revisions subscribers run against by owner/repo; override the ref of their subscription
+	EventID          string                 `yaml:"event_id"`       // ID of the event; when set, the idempotency fingerprint instead of the payload hash
+	FailurePolicy    *FailurePolicy         `yaml:"failure_policy"` // How failed children affect the fan-out; any failure fails it when nil
+	StrictInputs     bool                   `yaml:"strict_inputs"`  // Whether inputs that cannot be mapped for a subscriber stop the fan-out before any child is triggered
+	// Events are the events of a batch fan-out, emitted together in place of the single event of
+	// EventType, Payload, SchemaVersion and EventID. EventType is then their comma-separated types.
+	Events []FanOutEvent `yaml:"events"`
+	// ChangedPaths are the paths of the emitting repository that changed, and ArtifactDigest a
+	// digest of its artifact; both are added to the payload of each event, for subscriptions to
+	// skip the events that did not affect them. The runner computes ChangedPaths from the
+	// changes of the repository since the ChangedSince revision.
+	ChangedPaths   []string `yaml:"changed_paths"`
+	ChangedSince   string   `yaml:"changed_since"`
+	ArtifactDigest string   `yaml:"artifact_digest"`
+	// Artifacts are the published artifacts of the emitting repository by name, each with the
+	// digest and reference subscribers pull it by; they are added to the payload of each event.
+	// The runner sets them from the tako/publish-artifact@v1 steps of the run.
+	Artifacts map[string]PublishedArtifact `yaml:"artifacts"`
+}
+
+// FanOutEvent is one of the events emitted together by a batch fan-out step.
+type FanOutEvent struct {
+	EventType     string                 `yaml:"event_type"`
+	Payload       map[string]interface{} `yaml:"payload"`
+	SchemaVersion string                 `yaml:"schema_version"`
+	EventID       string                 `yaml:"event_id"`
+}
+
+// emittedEvents returns the events the fan-out emits: those of a batch, or its single event.
+func (params *FanOutParams) emittedEvents() []FanOutEvent {
+	if len(params.Events) > 0 {
+		return params.Events
+	}
+	return []FanOutEvent{{
+		EventType:     params.EventType,
+		Payload:       params.Payload,
+		SchemaVersion: params.SchemaVersion,
+		EventID:       params.EventID,
+	}}
 }
 
 // ChildExecutionError represents detailed error information for a child workflow execution.
@@ -179,8 +418,9 @@ type ChildExecutionError struct {
 	Repository   string        `json:"repository"`
 	Workflow     string        `json:"workflow"`
 	RunID        string        `json:"run_id,omitempty"`
-	ErrorType    string        `json:"error_type"` // "execution_failed", "workflow_failed", "timeout", "circuit_breaker"
+	ErrorType    string        `json:"error_type"` // "execution_failed", "workflow_failed", "timeout", "circuit_breaker", "cancelled", "input_mapping_failed"
 	ErrorMessage string        `json:"error_message"`
+	Template     string        `json:"template,omitempty"` // Input template or transform expression that failed, for input_mapping_failed
 	StartTime    time.Time     `json:"start_time"`
 	Duration     time.Duration `json:"duration"`
 	RetryCount   int           `json:"retry_count"`
@@ -191,14 +431,29 @@ type FanOutResult struct {
 	Success          bool
 	EventEmitted     bool
 	SubscribersFound int
+	TargetedOut      int // Subscribers skipped by the targets/exclude filters
+	Deduplicated     int // Subscribers skipped because they received the same event within their dedup window
+	BatchDuplicates  int // Subscribers of a batch fan-out skipped because an earlier event of the batch triggers them
+	Unchanged        int // Subscribers skipped because the event did not change the paths or artifact they depend on
 	TriggeredCount   int
 	Errors           []string              // Legacy simple error messages
 	DetailedErrors   []ChildExecutionError // Detailed error information
 	StartTime        time.Time
 	EndTime          time.Time
-	FanOutID         string         // ID of the fan-out state for tracking
-	TimeoutExceeded  bool           // Whether the overall operation timed out
-	ChildrenSummary  *FanOutSummary // Summary of child workflow statuses
+	FanOutID         string          // ID of the fan-out state for tracking
+	TimeoutExceeded  bool            // Whether the overall operation timed out
+	Cancelled        bool            // Whether the fan-out or the run that emitted it was cancelled
+	ChildrenSummary  *FanOutSummary  // Summary of child workflow statuses
+	Children         []ChildWorkflow // Child workflows, sorted by repository and workflow
+
+	FailurePolicy     string // Failure policy mode of the fan-out; continue when empty
+	ToleratedFailures int    // Failed children that did not fail the fan-out, under a threshold policy
+	FailFastTriggered bool   // Whether a failure cancelled the remaining children, under a fail-fast policy
+
+	Diamonds []DiamondResolution // How the diamond dependencies of the subscribers were resolved
+	Retried  []ChildWorkflow     // Children triggered again by a retry of the fan-out, after their new run
+	// SchemaIncompatible are the subscribers excluded because they reject the schema version of the event
+	SchemaIncompatible []IncompatibleSubscriber
 }
 
 // Execute performs the fan-out operation with proper state management.
@@ -208,18 +463,25 @@ func (fe *FanOutExecutor) Execute(step config.WorkflowStep, sourceRepo string) (
 
 // ExecuteWithSubscriptions performs the fan-out operation with pre-discovered subscriptions.
 func (fe *FanOutExecutor) ExecuteWithSubscriptions(step config.WorkflowStep, sourceRepo string, subscriptions []interfaces.SubscriptionMatch) (*FanOutResult, error) {
-	return fe.executeWithContextAndSubscriptions(step, sourceRepo, "", subscriptions)
+	return fe.executeWithContextAndSubscriptions(context.Background(), step, sourceRepo, "", subscriptions)
+}
+
+// ExecuteWithSubscriptionsContext performs the fan-out operation with pre-discovered subscriptions
+// within ctx: once ctx is done, running children are stopped and pending ones are not started.
+// The fan-out is recorded as a fan-out of the run set with SetLockOwner, if any.
+func (fe *FanOutExecutor) ExecuteWithSubscriptionsContext(ctx context.Context, step config.WorkflowStep, sourceRepo string, subscriptions []interfaces.SubscriptionMatch) (*FanOutResult, error) {
+	return fe.executeWithContextAndSubscriptions(ctx, step, sourceRepo, fe.lockRunID, subscriptions)
 }
 
 // ExecuteWithContext performs the fan-out operation with optional parent run context.
 func (fe *FanOutExecutor) ExecuteWithContext(step config.WorkflowStep, sourceRepo, parentRunID string) (*FanOutResult, error) {
 	// Backward compatibility - discover subscriptions internally
-	return fe.executeWithContextAndSubscriptions(step, sourceRepo, parentRunID, nil)
+	return fe.executeWithContextAndSubscriptions(context.Background(), step, sourceRepo, parentRunID, nil)
 }
 
 // executeWithContextAndSubscriptions is the internal implementation that optionally accepts pre-discovered subscriptions.
-func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.WorkflowStep, sourceRepo, parentRunID string, preDiscoveredSubscriptions []interfaces.SubscriptionMatch) (*FanOutResult, error) {
-	startTime := time.Now()
+func (fe *FanOutExecutor) executeWithContextAndSubscriptions(ctx context.Context, step config.WorkflowStep, sourceRepo, parentRunID string, preDiscoveredSubscriptions []interfaces.SubscriptionMatch) (*FanOutResult, error) {
+	startTime := fe.now()
 	result := &FanOutResult{
 		StartTime:       startTime,
 		Errors:          []string{},
@@ -227,10 +489,17 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 		TimeoutExceeded: false,
 	}
 
+	// Updates of the children batched by the state persistence are written before returning
+	defer func() {
+		if err := fe.stateManager.Flush(); err != nil {
+			fe.logger.Warn("Failed to flush fan-out states", "error", err.Error())
+		}
+	}()
+
 	// Record metrics
 	fe.metricsCollector.RecordFanOutStarted()
 	defer func() {
-		duration := time.Since(startTime)
+		duration := fe.now().Sub(startTime)
 		success := len(result.Errors) == 0
 		fe.metricsCollector.RecordFanOutCompleted(duration, success, result.TriggeredCount)
 
@@ -249,7 +518,7 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	params, err := fe.parseFanOutParams(step.With)
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("invalid parameters: %v", err))
-		result.EndTime = time.Now()
+		result.EndTime = fe.now()
 		return result, err
 	}
 
@@ -258,7 +527,7 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 		timeout, err = time.ParseDuration(params.Timeout)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("invalid timeout format: %v", err))
-			result.EndTime = time.Now()
+			result.EndTime = fe.now()
 			return result, err
 		}
 	}
@@ -269,30 +538,11 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	var eventFingerprint string
 
 	if fe.enableIdempotency {
-		// Create enhanced event from parameters for fingerprinting
-		// Note: We DON'T use EventBuilder here because it generates unique IDs,
-		// which would defeat the purpose of idempotency. Instead, we create the event
-		// manually without an ID so fingerprinting falls back to payload hashing.
-		enhancedEvent := EnhancedEvent{
-			Type:    params.EventType,
-			Payload: params.Payload,
-			Metadata: EventMetadata{
-				Source:  sourceRepo,
-				Headers: make(map[string]string),
-				// Note: No ID or Timestamp set - this makes fingerprinting deterministic
-			},
-		}
-
-		// Set schema if provided
-		if params.SchemaVersion != "" {
-			enhancedEvent.Schema = fmt.Sprintf("%s@%s", params.EventType, params.SchemaVersion)
-		}
-
 		// Generate event fingerprint
-		eventFingerprint, err = GenerateEventFingerprint(&enhancedEvent)
+		eventFingerprint, err = fanOutFingerprint(params, sourceRepo)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("failed to generate event fingerprint: %v", err))
-			result.EndTime = time.Now()
+			result.EndTime = fe.now()
 			return result, err
 		}
 
@@ -304,24 +554,68 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 		existingState, err := fe.stateManager.GetFanOutStateByFingerprint(eventFingerprint)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("failed to check for existing state: %v", err))
-			result.EndTime = time.Now()
+			result.EndTime = fe.now()
 			return result, err
 		}
 
+		// The state of an earlier fan-out whose retention ended no longer prevents a replay
+		if existingState != nil && fe.stateManager.Expired(existingState) {
+			fe.logger.Info("Replaying fan-out whose idempotent state expired",
+				"fan_out_id", existingState.ID,
+				"fingerprint", eventFingerprint,
+			)
+			if err := fe.stateManager.PurgeFingerprint(eventFingerprint); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to purge expired state: %v", err))
+				result.EndTime = fe.now()
+				return result, err
+			}
+			existingState = nil
+		}
+
 		if existingState != nil {
 			if fe.debug {
 				fmt.Printf("Found existing state for fingerprint %s: %s (status: %s)\n", eventFingerprint, existingState.ID, existingState.Status)
 			}
 
 			// Handle duplicate event based on existing state status
-			return fe.handleDuplicateEvent(existingState, timeout, startTime)
+			if !existingState.Abandoned() {
+				return fe.handleDuplicateEvent(existingState, timeout, startTime)
+			}
 		}
 
 		// No duplicate found, create new state with fingerprint
 		fanOutID = fmt.Sprintf("fanout-%s", eventFingerprint)
 		result.FanOutID = fanOutID
 
-		state, err = fe.stateManager.CreateFanOutStateWithFingerprint(fanOutID, eventFingerprint, parentRunID, sourceRepo, params.EventType, params.WaitForChildren, timeout) //nolint:staticcheck,ineffassign
+		if existingState != nil {
+			state = existingState
+		} else {
+			var created bool
+			state, created, err = fe.stateManager.CreateIdempotentFanOutState(eventFingerprint, parentRunID, sourceRepo, params.EventType, params.WaitForChildren, timeout)
+			if err == nil && !created && !state.Abandoned() {
+				// Another process created the state since the check above and triggers the children
+				return fe.handleDuplicateEvent(state, timeout, startTime)
+			}
+		}
+		if err == nil && state.Abandoned() {
+			// The process running the fan-out died: the children it did not finish are claimed
+			// and triggered again
+			fe.logger.Warn("Taking over fan-out abandoned by a dead process",
+				"fan_out_id", state.ID,
+				"owner_pid", state.OwnerPID,
+			)
+			// The repository locks of a dead process are stale and broken when the children
+			// are locked again
+			for _, child := range state.InterruptedChildren() {
+				fe.logger.Warn("Child was interrupted while holding its repository lock",
+					"fan_out_id", state.ID,
+					"repository", child.Repository,
+					"workflow", child.Workflow,
+					"lock_owner", child.LockOwner,
+				)
+				fe.setChildLockOwner(state, child.Repository, child.Workflow, "")
+			}
+		}
 	} else {
 		// Traditional creation without idempotency - use nanoseconds for uniqueness
 		fanOutID = fmt.Sprintf("fanout-%d-%s", startTime.UnixNano(), params.EventType)
@@ -331,106 +625,308 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	}
 	if err != nil {
 		result.Errors = append(result.Errors, fmt.Sprintf("failed to create fan-out state: %v", err))
-		result.EndTime = time.Now()
+		result.EndTime = fe.now()
 		return result, err
 	}
 
 	// Start the fan-out operation
+	if params.FailurePolicy != nil {
+		result.FailurePolicy = params.FailurePolicy.Mode
+		state.SetFailurePolicy(params.FailurePolicy)
+	}
 	state.StartFanOut()
 
 	if fe.debug {
 		fmt.Printf("Fan-out step: emitting event '%s' from '%s' (ID: %s)\n", params.EventType, sourceRepo, fanOutID)
 	}
 
-	// Create enhanced event from parameters
-	enhancedEvent := NewEventBuilder(params.EventType).
-		WithSource(sourceRepo).
-		WithPayload(params.Payload).
-		Build()
+	// Every event of a batch is built, validated and signed before any of them is emitted
+	emittedEvents := params.emittedEvents()
+	enhancedEvents := make([]EnhancedEvent, 0, len(emittedEvents))
+	for _, emittedEvent := range emittedEvents {
+		enhancedEvent, err := fe.buildEvent(emittedEvent, sourceRepo)
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+			result.EndTime = fe.now()
+			return result, err
+		}
+		enhancedEvents = append(enhancedEvents, enhancedEvent)
+	}
 
-	// Set schema if provided
-	if params.SchemaVersion != "" {
-		enhancedEvent.Schema = fmt.Sprintf("%s@%s", params.EventType, params.SchemaVersion)
+	// The events are persisted for the failed children to be retried with them
+	events := make([]Event, 0, len(enhancedEvents))
+	for _, enhancedEvent := range enhancedEvents {
+		events = append(events, enhancedEvent.ToLegacyEvent())
+	}
+	if err := state.SetEvents(events); err != nil {
+		fe.logger.Warn("Failed to record the events of the fan-out", "fan_out_id", fanOutID, "error", err.Error())
 	}
 
-	// Apply defaults and validate event if schema is specified
-	if enhancedEvent.Schema != "" {
-		if err := fe.eventValidator.ApplyDefaults(&enhancedEvent); err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("failed to apply event defaults: %v", err))
-			result.EndTime = time.Now()
-			return result, err
+	result.EventEmitted = true
+	for i := range enhancedEvents {
+		enhancedEvent := &enhancedEvents[i]
+		emitted := AuditEntry{
+			FanOutID: fanOutID,
+			Decision: AuditEventEmitted,
+			Details: map[string]string{
+				"event_type":    enhancedEvent.Type,
+				"source":        sourceRepo,
+				"parent_run_id": parentRunID,
+			},
 		}
-
-		if err := fe.eventValidator.ValidateEvent(enhancedEvent); err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("event validation failed: %v", err))
-			result.EndTime = time.Now()
-			return result, err
+		legacyEvent := enhancedEvent.ToLegacyEvent()
+		if eventFingerprint != "" && len(enhancedEvents) == 1 {
+			emitted.Details["event_fingerprint"] = eventFingerprint
+		} else if fingerprint, err := GenerateEventFingerprint(&legacyEvent); err == nil {
+			emitted.Details["event_fingerprint"] = fingerprint
+		}
+		if emittedEvents[i].EventID != "" {
+			emitted.Details["event_id"] = emittedEvents[i].EventID
 		}
+		fe.recordAudit(emitted)
 
-		if fe.debug {
-			fmt.Printf("Event validated against schema '%s'\n", enhancedEvent.Schema)
+		// Sinks are best effort: an unreachable broker must not stop the fan-out
+		if fe.eventPublisher != nil {
+			for _, err := range fe.eventPublisher.Publish(ctx, enhancedEvent) {
+				fe.logger.Warn("Failed to publish event", "event_type", enhancedEvent.Type, "error", err.Error())
+			}
 		}
 	}
 
-	// Convert to legacy event for backward compatibility with existing code
-	event := enhancedEvent.ToLegacyEvent()
+	// Each subscriber is triggered once per fan-out, by the first event of a batch it matches
+	var groups []eventSubscribers
+	var validSubscribers []SubscriptionMatch
+	triggeredBy := make(map[string]string)
+	for i := range enhancedEvents {
+		enhancedEvent := &enhancedEvents[i]
+		eventType := enhancedEvent.Type
+
+		// Use pre-discovered subscriptions if provided, otherwise discover them
+		var subscribers []interfaces.SubscriptionMatch
+		if preDiscoveredSubscriptions != nil {
+			// Use the pre-discovered subscriptions, split by event for batches
+			subscribers = preDiscoveredSubscriptions
+			if len(enhancedEvents) > 1 {
+				subscribers = subscribersToEvent(preDiscoveredSubscriptions, eventType)
+			}
+			if fe.debug {
+				fmt.Printf("Using %d pre-discovered subscriptions\n", len(subscribers))
+			}
+		} else {
+			// Find subscribers for this event (backward compatibility)
+			artifact := fmt.Sprintf("%s:default", sourceRepo)
+			discoveredSubscribers, err := fe.discoveryManager.FindSubscribersContext(ctx, artifact, eventType)
+			if err != nil {
+				state.FailFanOut(fmt.Sprintf("failed to find subscribers: %v", err))
+				result.Errors = append(result.Errors, fmt.Sprintf("failed to find subscribers: %v", err))
+				result.EndTime = fe.now()
+				return result, err
+			}
+			subscribers = discoveredSubscribers
+		}
 
-	result.EventEmitted = true
+		result.SubscribersFound += len(subscribers)
 
-	// Use pre-discovered subscriptions if provided, otherwise discover them
-	var subscribers []interfaces.SubscriptionMatch
-	if preDiscoveredSubscriptions != nil {
-		// Use the pre-discovered subscriptions
-		subscribers = preDiscoveredSubscriptions
 		if fe.debug {
-			fmt.Printf("Using %d pre-discovered subscriptions\n", len(subscribers))
-		}
-	} else {
-		// Find subscribers for this event (backward compatibility)
-		artifact := fmt.Sprintf("%s:default", sourceRepo)
-		discoveredSubscribers, err := fe.discoveryManager.FindSubscribers(artifact, params.EventType)
-		if err != nil {
-			state.FailFanOut(fmt.Sprintf("failed to find subscribers: %v", err))
-			result.Errors = append(result.Errors, fmt.Sprintf("failed to find subscribers: %v", err))
-			result.EndTime = time.Now()
-			return result, err
+			fmt.Printf("Found %d subscribers for event '%s'\n", len(subscribers), eventType)
 		}
-		subscribers = discoveredSubscribers
-	}
 
-	result.SubscribersFound = len(subscribers)
-
-	if fe.debug {
-		fmt.Printf("Found %d subscribers for event '%s'\n", len(subscribers), params.EventType)
-	}
+		// Restrict the subscribers to the repositories targeted by the emitter
+		if len(params.Targets) > 0 || len(params.Exclude) > 0 {
+			targeted := filterTargetedSubscribers(subscribers, params.Targets, params.Exclude)
+			result.TargetedOut += len(subscribers) - len(targeted)
+			for _, subscriber := range subscribers {
+				if !containsSubscriber(targeted, subscriber) {
+					fe.recordAudit(AuditEntry{
+						FanOutID:   fanOutID,
+						Decision:   AuditSubscriptionRejected,
+						Repository: subscriber.Repository,
+						Workflow:   subscriber.Subscription.Workflow,
+						Reason:     "not targeted by the fan-out",
+					})
+				}
+			}
+			if fe.debug {
+				fmt.Printf("Targeting filters skipped %d subscribers\n", len(subscribers)-len(targeted))
+			}
+			subscribers = targeted
+		}
 
-	// Filter subscribers using subscription evaluation
-	validSubscribers := []SubscriptionMatch{}
-	for _, subscriber := range subscribers {
-		matches, err := fe.subscriptionEvaluator.EvaluateSubscription(subscriber.Subscription, event)
-		if err != nil {
-			result.Errors = append(result.Errors, fmt.Sprintf("subscription evaluation failed for %s: %v", subscriber.Repository, err))
-			continue
+		// Subscribers verify the signature of the event received from a broker, if any
+		signedEvent := enhancedEvent
+		if fe.receivedEvent != nil && len(enhancedEvents) == 1 {
+			signedEvent = fe.receivedEvent
 		}
-		if matches {
+
+		// Convert to legacy event for backward compatibility with existing code
+		event := enhancedEvent.ToLegacyEvent()
+
+		// Filter subscribers using subscription evaluation
+		group := eventSubscribers{event: event, id: enhancedEvent.Metadata.ID}
+		for _, subscriber := range subscribers {
+			decision := AuditEntry{
+				FanOutID:   fanOutID,
+				Decision:   AuditSubscriptionRejected,
+				Repository: subscriber.Repository,
+				Workflow:   subscriber.Subscription.Workflow,
+			}
+			if !subscriber.Subscription.IsActive(startTime) {
+				if fe.debug {
+					fmt.Printf("Skipping disabled subscription in %s for workflow '%s'\n", subscriber.Repository, subscriber.Subscription.Workflow)
+				}
+				decision.Reason = "subscription is disabled"
+				fe.recordAudit(decision)
+				continue
+			}
+			if err := fe.verifySubscriptionSignature(subscriber.Subscription, signedEvent); err != nil {
+				if fe.debug {
+					fmt.Printf("Rejecting event for %s workflow '%s': %v\n", subscriber.Repository, subscriber.Subscription.Workflow, err)
+				}
+				decision.Reason = fmt.Sprintf("signature verification failed: %v", err)
+				fe.recordAudit(decision)
+				continue
+			}
+			evaluation, err := fe.subscriptionEvaluator.ExplainSubscription(subscriber.Subscription, event)
+			decision.Filters = evaluation.Filters
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("subscription evaluation failed for %s: %v", subscriber.Repository, err))
+				decision.Reason = fmt.Sprintf("evaluation failed: %v", err)
+				fe.recordAudit(decision)
+				continue
+			}
+			if !evaluation.Matched {
+				if evaluation.SchemaIncompatible {
+					incompatible := IncompatibleSubscriber{
+						EventType:     event.Type,
+						SchemaVersion: event.SchemaVersion,
+						Repository:    subscriber.Repository,
+						Workflow:      subscriber.Subscription.Workflow,
+						Accepts:       subscriber.Subscription.SchemaVersion,
+					}
+					fe.logger.Warn("Subscriber excluded by an incompatible schema version",
+						"fan_out_id", fanOutID,
+						"event_type", event.Type,
+						"schema_version", event.SchemaVersion,
+						"subscriber", incompatible.String())
+					result.SchemaIncompatible = append(result.SchemaIncompatible, incompatible)
+				}
+				decision.Reason = evaluation.Reason
+				fe.recordAudit(decision)
+				continue
+			}
+			key := subscriber.Repository + ":" + subscriber.Subscription.Workflow
+			if firstEvent, ok := triggeredBy[key]; ok && len(enhancedEvents) > 1 {
+				result.BatchDuplicates++
+				decision.Reason = fmt.Sprintf("already triggered by event '%s' of the batch", firstEvent)
+				fe.recordAudit(decision)
+				continue
+			}
+			if reason := fe.unchangedReason(subscriber, event); reason != "" {
+				result.Unchanged++
+				if fe.debug {
+					fmt.Printf("Skipping unchanged subscription in %s for workflow '%s': %s\n", subscriber.Repository, subscriber.Subscription.Workflow, reason)
+				}
+				state.AddSkippedChild(subscriber.Repository, subscriber.Subscription.Workflow, ChildSkipUnchanged, reason)
+				decision.Reason = reason
+				fe.recordAudit(decision)
+				continue
+			}
+			// The delivery is only claimed once the child is triggered, so that the subscribers
+			// dropped and the fan-outs stopped before do not use their dedup window up
+			duplicate, err := fe.deliveredWithinWindow(subscriber, event, startTime)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("deduplication failed for %s: %v", subscriber.Repository, err))
+				decision.Reason = fmt.Sprintf("deduplication failed: %v", err)
+				fe.recordAudit(decision)
+				continue
+			}
+			if duplicate {
+				result.Deduplicated++
+				if fe.debug {
+					fmt.Printf("Skipping duplicate event for %s workflow '%s' within its dedup window\n", subscriber.Repository, subscriber.Subscription.Workflow)
+				}
+				decision.Reason = fmt.Sprintf("duplicate event within the dedup window of %s", subscriber.Subscription.DedupWindow)
+				fe.recordAudit(decision)
+				continue
+			}
+			decision.Decision = AuditSubscriptionMatched
+			if len(enhancedEvents) > 1 {
+				decision.Details = map[string]string{"event_type": eventType}
+			}
+			fe.recordAudit(decision)
+			triggeredBy[key] = eventType
+			group.subscribers = append(group.subscribers, subscriber)
 			validSubscribers = append(validSubscribers, subscriber)
 		}
+		groups = append(groups, group)
 	}
 
 	if fe.debug {
 		fmt.Printf("After filtering: %d valid subscribers\n", len(validSubscribers))
 	}
 
+	// Subscribers whose inputs cannot be mapped from the event are reported before any child is triggered
+	groups, validSubscribers, inputErrors := fe.checkSubscriberInputs(groups)
+	for _, inputError := range inputErrors {
+		result.Errors = append(result.Errors, fmt.Sprintf("failed to process payload for %s: %s", inputError.Repository, inputError.ErrorMessage))
+	}
+	result.DetailedErrors = append(result.DetailedErrors, inputErrors...)
+	if len(inputErrors) > 0 && params.StrictInputs {
+		err := fmt.Errorf("inputs of %d subscribers cannot be mapped from the event", len(inputErrors))
+		fe.logger.Error("Fan-out stopped", "fan_out_id", fanOutID, "error", err.Error())
+		state.FailFanOut(err.Error())
+		result.EndTime = fe.now()
+		return result, err
+	}
+
+	// Event chains must neither loop back to an ancestor nor grow past the maximum depth
+	if err := fe.checkLineage(validSubscribers); err != nil {
+		fe.logger.Error("Fan-out stopped", "fan_out_id", fanOutID, "error", err.Error())
+		state.FailFanOut(err.Error())
+		result.Errors = append(result.Errors, err.Error())
+		result.EndTime = fe.now()
+		return result, err
+	}
+
+	// Under the fail strategy, a diamond dependency stops the fan-out before any child is triggered
+	if err := fe.checkDiamonds(groups, state); err != nil {
+		fe.logger.Error("Fan-out stopped", "fan_out_id", fanOutID, "error", err.Error())
+		state.FailFanOut(err.Error())
+		result.Diamonds = state.GetDiamonds()
+		result.Errors = append(result.Errors, err.Error())
+		result.EndTime = fe.now()
+		return result, err
+	}
+
+	// The children are drawn from the budget of the whole execution tree
+	if err := fe.reserveChildBudget(len(validSubscribers)); err != nil {
+		fe.logger.Error("Fan-out stopped", "fan_out_id", fanOutID, "error", err.Error())
+		state.FailFanOut(err.Error())
+		result.Errors = append(result.Errors, err.Error())
+		result.EndTime = fe.now()
+		return result, err
+	}
+
 	// Trigger subscribers with state tracking
 	if len(validSubscribers) > 0 {
-		triggeredCount, errors, detailedErrors := fe.triggerSubscribersWithState(validSubscribers, event, params, state)
+		triggeredCount, errors, detailedErrors := fe.triggerEventSubscribersWithState(ctx, groups, params, state)
 		result.TriggeredCount = triggeredCount
 		result.Errors = append(result.Errors, errors...)
 		result.DetailedErrors = append(result.DetailedErrors, detailedErrors...)
 	}
 
-	// Handle waiting for children
-	if params.WaitForChildren {
+	// Handle waiting for children; a cancelled or interrupted fan-out does not wait
+	if IsRunInterrupted(ctx) {
+		result.Errors = append(result.Errors, "fan-out was interrupted")
+		state.InterruptFanOut("interrupted by a signal")
+	} else if fe.isCancelled(state) {
+		result.Cancelled = true
+		state.CancelFanOut("fan-out was cancelled")
+	} else if failed := countFailedChildren(state); params.FailurePolicy.failFast() && failed > 0 {
+		// The remaining children were cancelled after the first failure
+		result.FailFastTriggered = true
+		state.FailFanOut(fmt.Sprintf("fail-fast: %d children failed, the remaining children were cancelled", failed))
+	} else if params.WaitForChildren {
 		if result.TriggeredCount > 0 {
 			if fe.debug {
 				fmt.Printf("Waiting for %d child workflows to complete\n", result.TriggeredCount)
@@ -468,6 +964,25 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	// Get final children summary
 	summary := state.GetSummary()
 	result.ChildrenSummary = &summary
+	result.Children = state.GetChildren()
+	result.Diamonds = state.GetDiamonds()
+	for _, child := range result.Children {
+		finished := AuditEntry{
+			FanOutID:   state.ID,
+			Decision:   AuditChildFinished,
+			Repository: child.Repository,
+			Workflow:   child.Workflow,
+			Reason:     child.ErrorMessage,
+			Details:    map[string]string{"status": string(child.Status)},
+		}
+		if child.RunID != "" {
+			finished.Details["run_id"] = child.RunID
+		}
+		if child.Commit != "" {
+			finished.Details["commit"] = child.Commit
+		}
+		fe.recordAudit(finished)
+	}
 
 	// Determine if operation timed out
 	if result.ChildrenSummary != nil && result.ChildrenSummary.TimedOutChildren > 0 {
@@ -475,7 +990,10 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	}
 
 	result.Success = len(result.Errors) == 0
-	result.EndTime = time.Now()
+	if result.Success && params.FailurePolicy != nil && params.FailurePolicy.Mode == FailurePolicyThreshold {
+		result.ToleratedFailures = summary.FailedChildren + summary.TimedOutChildren
+	}
+	result.EndTime = fe.now()
 
 	if fe.debug {
 		fmt.Printf("Fan-out completed: success=%v, triggered=%d, errors=%d, detailed_errors=%d\n",
@@ -490,6 +1008,143 @@ func (fe *FanOutExecutor) executeWithContextAndSubscriptions(step config.Workflo
 	return result, nil
 }
 
+// buildEvent builds an event emitted by a fan-out from sourceRepo, applying the defaults of its
+// schema, validating it and signing it.
+func (fe *FanOutExecutor) buildEvent(emitted FanOutEvent, sourceRepo string) (EnhancedEvent, error) {
+	// Create enhanced event from parameters
+	enhancedEvent := NewEventBuilder(emitted.EventType).
+		WithSource(sourceRepo).
+		WithPayload(emitted.Payload).
+		WithCorrelation(fe.correlationID).
+		Build()
+	if emitted.EventID != "" {
+		enhancedEvent.Metadata.ID = emitted.EventID
+	}
+
+	// Set schema if provided
+	if emitted.SchemaVersion != "" {
+		enhancedEvent.Schema = fmt.Sprintf("%s@%s", emitted.EventType, emitted.SchemaVersion)
+	}
+
+	// Apply defaults and validate event if schema is specified, unless tako.yml declares it
+	declared := findEventSchema(fe.eventSchemas, emitted.EventType, emitted.SchemaVersion)
+	if enhancedEvent.Schema != "" && declared == nil {
+		if err := fe.eventValidator.ApplyDefaults(&enhancedEvent); err != nil {
+			return enhancedEvent, fmt.Errorf("failed to apply event defaults: %v", err)
+		}
+
+		if err := fe.eventValidator.ValidateEvent(enhancedEvent); err != nil {
+			return enhancedEvent, fmt.Errorf("event validation failed: %v", err)
+		}
+
+		if fe.debug {
+			fmt.Printf("Event validated against schema '%s'\n", enhancedEvent.Schema)
+		}
+	}
+
+	// Events of a declared type must honor the contract their subscribers rely on
+	if declared != nil {
+		if violations := checkPayloadSchema(declared, payloadTypes(enhancedEvent.Payload)); len(violations) > 0 {
+			return enhancedEvent, fmt.Errorf("event '%s' violates its payload schema: %s", emitted.EventType, strings.Join(violations, "; "))
+		}
+	}
+
+	// Subscribers verify the origin of signed events
+	if fe.signingKey != nil {
+		if err := SignEvent(&enhancedEvent, fe.signingKey); err != nil {
+			return enhancedEvent, fmt.Errorf("failed to sign event: %v", err)
+		}
+	}
+	return enhancedEvent, nil
+}
+
+// fanOutFingerprint returns the fingerprint identifying the events of a fan-out from sourceRepo
+// for idempotency: the fingerprint of its event, or a hash of those of the events of a batch.
+func fanOutFingerprint(params *FanOutParams, sourceRepo string) (string, error) {
+	events := params.emittedEvents()
+	fingerprints := make([]string, 0, len(events))
+	for _, emitted := range events {
+		// Note: We DON'T use EventBuilder here because it generates unique IDs,
+		// which would defeat the purpose of idempotency. Instead, we create the event
+		// manually without an ID so fingerprinting falls back to payload hashing.
+		enhancedEvent := EnhancedEvent{
+			Type:    emitted.EventType,
+			Payload: emitted.Payload,
+			Metadata: EventMetadata{
+				Source:  sourceRepo,
+				Headers: make(map[string]string),
+				// Note: No ID or Timestamp set - this makes fingerprinting deterministic
+			},
+		}
+		// An explicit ID, e.g. the broker ID of a received message, identifies the event instead
+		enhancedEvent.Metadata.ID = emitted.EventID
+
+		// Set schema if provided
+		if emitted.SchemaVersion != "" {
+			enhancedEvent.Schema = fmt.Sprintf("%s@%s", emitted.EventType, emitted.SchemaVersion)
+		}
+
+		fingerprint, err := GenerateEventFingerprint(&enhancedEvent)
+		if err != nil {
+			return "", err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	if len(fingerprints) == 1 {
+		return fingerprints[0], nil
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fingerprints, "\n")))
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// fanOutEventTypes returns the types of the events a fan-out step emits, without validating
+// its other parameters.
+func fanOutEventTypes(withParams map[string]interface{}) ([]string, error) {
+	if events, ok := withParams["events"]; ok {
+		batch, err := parseFanOutEvents(events)
+		if err != nil {
+			return nil, err
+		}
+		var eventTypes []string
+		for _, event := range batch {
+			if !slices.Contains(eventTypes, event.EventType) {
+				eventTypes = append(eventTypes, event.EventType)
+			}
+		}
+		return eventTypes, nil
+	}
+	eventType, ok := withParams["event_type"].(string)
+	if !ok || eventType == "" {
+		return nil, fmt.Errorf("event_type is required for fan-out step")
+	}
+	return []string{eventType}, nil
+}
+
+// mergeSubscriptions appends the subscriptions discovered for an event of a batch to those of
+// its other events, skipping the subscriptions to several events of the batch already found.
+func mergeSubscriptions(merged, discovered []SubscriptionMatch) []SubscriptionMatch {
+	for _, subscriber := range discovered {
+		found := slices.ContainsFunc(merged, func(existing SubscriptionMatch) bool {
+			return reflect.DeepEqual(existing, subscriber)
+		})
+		if !found {
+			merged = append(merged, subscriber)
+		}
+	}
+	return merged
+}
+
+// subscribersToEvent returns the subscribers subscribing to an event type.
+func subscribersToEvent(subscribers []SubscriptionMatch, eventType string) []SubscriptionMatch {
+	var matching []SubscriptionMatch
+	for _, subscriber := range subscribers {
+		if slices.Contains(subscriber.Subscription.Events, eventType) {
+			matching = append(matching, subscriber)
+		}
+	}
+	return matching
+}
+
 // parseFanOutParams parses the fan-out step parameters from the step's with map.
 func (fe *FanOutExecutor) parseFanOutParams(withParams map[string]interface{}) (*FanOutParams, error) {
 	params := &FanOutParams{
@@ -498,8 +1153,24 @@ func (fe *FanOutExecutor) parseFanOutParams(withParams map[string]interface{}) (
 		Payload:          make(map[string]interface{}),
 	}
 
-	// Required: event_type
-	if eventType, ok := withParams["event_type"]; ok {
+	// Required: event_type, or the events of a batch
+	if events, ok := withParams["events"]; ok {
+		for _, single := range []string{"event_type", "payload", "schema_version", "event_id"} {
+			if _, ok := withParams[single]; ok {
+				return nil, fmt.Errorf("%s cannot be used with events; set it on each event", single)
+			}
+		}
+		batch, err := parseFanOutEvents(events)
+		if err != nil {
+			return nil, err
+		}
+		params.Events = batch
+		eventTypes := make([]string, 0, len(batch))
+		for _, event := range batch {
+			eventTypes = append(eventTypes, event.EventType)
+		}
+		params.EventType = strings.Join(eventTypes, ",")
+	} else if eventType, ok := withParams["event_type"]; ok {
 		if eventTypeStr, ok := eventType.(string); ok {
 			params.EventType = eventTypeStr
 		} else {
@@ -561,35 +1232,384 @@ func (fe *FanOutExecutor) parseFanOutParams(withParams map[string]interface{}) (
 		}
 	}
 
-	return params, nil
-}
+	// Optional: strict_inputs
+	if strictInputs, ok := withParams["strict_inputs"]; ok {
+		if strictBool, ok := strictInputs.(bool); ok {
+			params.StrictInputs = strictBool
+		} else {
+			return nil, fmt.Errorf("strict_inputs must be a boolean")
+		}
+	}
 
-// triggerSubscribersWithState triggers workflows in subscriber repositories with state tracking.
-func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []SubscriptionMatch, event Event, params *FanOutParams, state *FanOutState) (int, []string, []ChildExecutionError) {
-	errors := []string{}
-	detailedErrors := []ChildExecutionError{}
-	triggeredCount := 0
+	// Optional: failure_policy
+	if failurePolicy, ok := withParams["failure_policy"]; ok {
+		policy, err := parseFailurePolicy(failurePolicy)
+		if err != nil {
+			return nil, err
+		}
+		params.FailurePolicy = policy
+	}
+
+	// Optional: event_id
+	if eventID, ok := withParams["event_id"]; ok {
+		eventIDStr, err := parseFanOutEventID(eventID)
+		if err != nil {
+			return nil, err
+		}
+		params.EventID = eventIDStr
+	}
+
+	// Optional: targets and exclude
+	targets, err := parseRepositoryPatterns(withParams, "targets")
+	if err != nil {
+		return nil, err
+	}
+	params.Targets = targets
+
+	exclude, err := parseRepositoryPatterns(withParams, "exclude")
+	if err != nil {
+		return nil, err
+	}
+	params.Exclude = exclude
 
-	// Generate event fingerprint for subscription deduplication
-	eventFingerprint, err := GenerateEventFingerprint(&event)
+	// Optional: refs
+	refs, err := parseRepositoryRefs(withParams)
 	if err != nil {
-		errors = append(errors, fmt.Sprintf("failed to generate event fingerprint for diamond resolution: %v", err))
-		eventFingerprint = "" // Continue without diamond resolution
+		return nil, err
+	}
+	params.Refs = refs
+
+	// Optional: rollout
+	if rollout, ok := withParams["rollout"]; ok {
+		rolloutConfig, err := parseRolloutConfig(rollout)
+		if err != nil {
+			return nil, err
+		}
+		params.Rollout = rolloutConfig
+	}
+
+	// Optional: changed_paths and artifact_digest, added to the payloads
+	if changedPaths, ok := withParams["changed_paths"]; ok {
+		paths, err := parseChangedPaths(changedPaths)
+		if err != nil {
+			return nil, err
+		}
+		params.ChangedPaths = paths
+	}
+	if artifactDigest, ok := withParams["artifact_digest"]; ok {
+		digest, ok := artifactDigest.(string)
+		if !ok {
+			return nil, fmt.Errorf("artifact_digest must be a string")
+		}
+		params.ArtifactDigest = digest
+	}
+	if artifacts, ok := withParams["artifacts"]; ok {
+		published, err := parsePublishedArtifacts(artifacts)
+		if err != nil {
+			return nil, err
+		}
+		params.Artifacts = published
+	}
+	params.addChanges()
+
+	return params, nil
+}
+
+// parseFanOutEventID parses the ID of an emitted event.
+func parseFanOutEventID(value interface{}) (string, error) {
+	eventID, ok := value.(string)
+	if !ok || !fanOutEventIDRegex.MatchString(eventID) {
+		return "", fmt.Errorf("event_id must be a string of letters, digits, '.', '_' and '-'")
+	}
+	return eventID, nil
+}
+
+// parseFanOutEvents parses the events of a batch fan-out: a non-empty list of maps with the
+// event_type, payload, schema_version and event_id of each event.
+func parseFanOutEvents(value interface{}) ([]FanOutEvent, error) {
+	items, ok := value.([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, fmt.Errorf("events must be a non-empty list of events")
+	}
+
+	events := make([]FanOutEvent, 0, len(items))
+	for i, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("events[%d] must be a map", i)
+		}
+		event := FanOutEvent{Payload: make(map[string]interface{})}
+		for key, value := range fields {
+			switch key {
+			case "event_type":
+				eventType, ok := value.(string)
+				if !ok || eventType == "" {
+					return nil, fmt.Errorf("events[%d].event_type must be a non-empty string", i)
+				}
+				event.EventType = eventType
+			case "payload":
+				payload, ok := value.(map[string]interface{})
+				if !ok {
+					return nil, fmt.Errorf("events[%d].payload must be a map", i)
+				}
+				event.Payload = payload
+			case "schema_version":
+				schemaVersion, ok := value.(string)
+				if !ok {
+					return nil, fmt.Errorf("events[%d].schema_version must be a string", i)
+				}
+				event.SchemaVersion = schemaVersion
+			case "event_id":
+				eventID, err := parseFanOutEventID(value)
+				if err != nil {
+					return nil, fmt.Errorf("events[%d]: %v", i, err)
+				}
+				event.EventID = eventID
+			default:
+				return nil, fmt.Errorf("events[%d] has unknown field '%s'", i, key)
+			}
+		}
+		if event.EventType == "" {
+			return nil, fmt.Errorf("events[%d].event_type is required", i)
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+// parseRepositoryPatterns parses an optional list of owner/repo glob patterns.
+// A single pattern may also be given as a plain string.
+func parseRepositoryPatterns(withParams map[string]interface{}, name string) ([]string, error) {
+	value, ok := withParams[name]
+	if !ok {
+		return nil, nil
+	}
+
+	var patterns []string
+	switch v := value.(type) {
+	case string:
+		patterns = []string{v}
+	case []string:
+		patterns = v
+	case []interface{}:
+		for _, item := range v {
+			pattern, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings", name)
+			}
+			patterns = append(patterns, pattern)
+		}
+	default:
+		return nil, fmt.Errorf("%s must be a list of strings", name)
+	}
+
+	for _, pattern := range patterns {
+		if pattern == "" {
+			return nil, fmt.Errorf("%s cannot contain empty patterns", name)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid %s pattern '%s': %v", name, pattern, err)
+		}
+	}
+
+	return patterns, nil
+}
+
+// parseRepositoryRefs parses the optional map of pinned revisions keyed by owner/repo.
+func parseRepositoryRefs(withParams map[string]interface{}) (map[string]string, error) {
+	value, ok := withParams["refs"]
+	if !ok {
+		return nil, nil
+	}
+
+	var entries map[string]interface{}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		entries = v
+	case map[string]string:
+		entries = make(map[string]interface{}, len(v))
+		for repository, ref := range v {
+			entries[repository] = ref
+		}
+	default:
+		return nil, fmt.Errorf("refs must be a map of owner/repo to ref")
+	}
+
+	refs := make(map[string]string, len(entries))
+	for repository, value := range entries {
+		ref, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("ref of %s must be a string", repository)
+		}
+		if _, _, _, err := parseRepositorySpec(repository); err != nil || strings.Contains(repository, ":") {
+			return nil, fmt.Errorf("refs key '%s' must be an owner/repo repository", repository)
+		}
+		if _, err := config.ParsePinnedRef(ref); err != nil {
+			return nil, fmt.Errorf("invalid ref for %s: %v", repository, err)
+		}
+		refs[repository] = ref
+	}
+	return refs, nil
+}
+
+// filterTargetedSubscribers keeps the subscribers whose repository matches at least one of the
+// target patterns (all repositories when there are none) and none of the exclude patterns.
+// Patterns are globs on owner/repo, e.g. "my-org/*" or "my-org/service-?".
+func filterTargetedSubscribers(subscribers []SubscriptionMatch, targets, exclude []string) []SubscriptionMatch {
+	matchesAny := func(patterns []string, repository string) bool {
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, repository); matched {
+				return true
+			}
+		}
+		return false
 	}
 
-	// Resolve diamond dependencies using first-wins rule
-	uniqueSubscribers, skippedCount, diamondErrors := fe.resolveDiamondDependencies(subscribers, eventFingerprint)
-	errors = append(errors, diamondErrors...)
+	filtered := make([]SubscriptionMatch, 0, len(subscribers))
+	for _, subscriber := range subscribers {
+		if len(targets) > 0 && !matchesAny(targets, subscriber.Repository) {
+			continue
+		}
+		if matchesAny(exclude, subscriber.Repository) {
+			continue
+		}
+		filtered = append(filtered, subscriber)
+	}
+	return filtered
+}
+
+// eventSubscribers is an event emitted by a fan-out and the subscribers it triggers.
+type eventSubscribers struct {
+	event       Event
+	id          string // ID of the event, recorded in the provenance of the children
+	subscribers []SubscriptionMatch
+}
+
+// checkSubscriberInputs maps the events of each group to the inputs of the workflows of their
+// subscribers, removing the subscribers whose input templates or payload transform fail on the
+// concrete event. It returns the remaining groups and subscribers, and an input_mapping_failed
+// error for each subscriber removed. The subscribers are mapped with a bounded pool of workers,
+// and the results are in their order.
+func (fe *FanOutExecutor) checkSubscriberInputs(groups []eventSubscribers) ([]eventSubscribers, []SubscriptionMatch, []ChildExecutionError) {
+	now := fe.now()
+
+	type mapping struct {
+		group      int
+		subscriber SubscriptionMatch
+		err        error
+	}
+	var mappings []mapping
+	for i, group := range groups {
+		for _, subscriber := range group.subscribers {
+			mappings = append(mappings, mapping{group: i, subscriber: subscriber})
+		}
+	}
+	fe.forEachChild(len(mappings), func(i int) {
+		_, mappings[i].err = fe.subscriptionEvaluator.ProcessEvent(groups[mappings[i].group].event, mappings[i].subscriber.Subscription)
+	})
+
+	var valid []SubscriptionMatch
+	var inputErrors []ChildExecutionError
+	checked := make([]eventSubscribers, len(groups))
+	for i, group := range groups {
+		checked[i] = eventSubscribers{event: group.event, id: group.id}
+	}
+	for _, mapped := range mappings {
+		subscriber := mapped.subscriber
+		if mapped.err == nil {
+			checked[mapped.group].subscribers = append(checked[mapped.group].subscribers, subscriber)
+			valid = append(valid, subscriber)
+			continue
+		}
+		inputError := ChildExecutionError{
+			Repository:   subscriber.Repository,
+			Workflow:     subscriber.Subscription.Workflow,
+			ErrorType:    "input_mapping_failed",
+			ErrorMessage: mapped.err.Error(),
+			StartTime:    now,
+		}
+		var mappingErr *InputMappingError
+		if errors.As(mapped.err, &mappingErr) {
+			inputError.Template = mappingErr.Template
+		}
+		inputErrors = append(inputErrors, inputError)
+	}
+	return checked, valid, inputErrors
+}
+
+// triggerSubscribersWithState triggers workflows in subscriber repositories with state tracking.
+func (fe *FanOutExecutor) triggerSubscribersWithState(ctx context.Context, subscribers []SubscriptionMatch, event Event, params *FanOutParams, state *FanOutState) (int, []string, []ChildExecutionError) {
+	return fe.triggerEventSubscribersWithState(ctx, []eventSubscribers{{event: event, subscribers: subscribers}}, params, state)
+}
+
+// triggerEventSubscribersWithState triggers the subscribers of the events of a fan-out, each
+// with the inputs mapped from its event, as the children of a single fan-out state.
+func (fe *FanOutExecutor) triggerEventSubscribersWithState(ctx context.Context, groups []eventSubscribers, params *FanOutParams, state *FanOutState) (int, []string, []ChildExecutionError) {
+	errors := []string{}
+	detailedErrors := []ChildExecutionError{}
+	triggeredCount := 0
+
+	// Resolve the diamond dependencies of each event with its diamond strategy
+	var uniqueSubscribers []SubscriptionMatch
+	var resolutions []diamondResolution
+	var diamonds []DiamondResolution
+	subscriberEvents := make(map[string]Event)
+	subscriberTriggers := make(map[string]ProvenanceTrigger)
+	for _, group := range groups {
+		// Generate event fingerprint for subscription deduplication
+		eventFingerprint, err := GenerateEventFingerprint(&group.event)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("failed to generate event fingerprint for diamond resolution: %v", err))
+			eventFingerprint = "" // Continue without diamond resolution
+		}
+
+		unique, groupResolutions, diamondErrors := fe.resolveDiamonds(group.subscribers, eventFingerprint, fe.diamondStrategy(group.event.Type))
+		errors = append(errors, diamondErrors...)
+		uniqueSubscribers = append(uniqueSubscribers, unique...)
+		resolutions = append(resolutions, groupResolutions...)
+		for _, resolution := range groupResolutions {
+			diamonds = append(diamonds, resolution.record(group.event.Type))
+		}
+		for _, subscriber := range unique {
+			key := subscriber.Repository + ":" + subscriber.Subscription.Workflow
+			if _, ok := subscriberEvents[key]; !ok {
+				subscriberEvents[key] = group.event
+				subscriberTriggers[key] = ProvenanceTrigger{
+					Type:        ProvenanceTriggerEvent,
+					EventType:   group.event.Type,
+					Source:      group.event.Source,
+					EventID:     group.id,
+					Fingerprint: eventFingerprint,
+					FanOutID:    state.ID,
+				}
+			}
+		}
+	}
+	skippedCount := 0
+	for i, resolution := range resolutions {
+		skippedCount += len(resolution.losers)
+		fe.recordAudit(AuditEntry{
+			FanOutID:   state.ID,
+			Decision:   AuditDiamondResolved,
+			Repository: resolution.winner.Repository,
+			Workflow:   resolution.winner.Subscription.Workflow,
+			Reason:     resolution.reason(),
+			Details:    map[string]string{"losers": strings.Join(diamonds[i].Losers, ", "), "strategy": resolution.strategy},
+		})
+	}
+	if len(diamonds) > 0 {
+		if err := state.AddDiamonds(diamonds...); err != nil {
+			errors = append(errors, fmt.Sprintf("failed to record diamond resolutions: %v", err))
+		}
+	}
 
 	if fe.debug && skippedCount > 0 {
 		fmt.Printf("Diamond dependency resolution: skipped %d duplicate subscriptions, processing %d unique subscriptions\n",
 			skippedCount, len(uniqueSubscribers))
 	}
 
-	// Sort unique subscribers alphabetically for deterministic execution order
-	sort.Slice(uniqueSubscribers, func(i, j int) bool {
-		return uniqueSubscribers[i].Repository < uniqueSubscribers[j].Repository
-	})
+	// Order unique subscribers by priority, then alphabetically for deterministic execution order
+	uniqueSubscribers = sortSubscriptionsByPriority(uniqueSubscribers)
 
 	// Determine concurrency limit
 	concurrencyLimit := params.ConcurrencyLimit
@@ -597,31 +1617,208 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 		concurrencyLimit = len(uniqueSubscribers) // No limit, run all in parallel
 	}
 
+	// Stop triggering children once the fan-out or the run that emitted it is cancelled
+	runCtx, stopWatching := fe.cancellations.Watch(ctx, state.ID, fe.lockRunID, fe.lockParentRunID)
+	defer stopWatching()
+
+	// Under the fail-fast policy, the first failure cancels the children's context
+	childCtx, failFast := context.WithCancelCause(runCtx)
+	defer failFast(context.Canceled)
+
+	// The errors of failed children are reported once the failure policy judged them
+	var childErrors []string
+
 	// Use semaphore pattern for concurrency control
 	semaphore := make(chan struct{}, concurrencyLimit)
 	var wg sync.WaitGroup
 	var mutex sync.Mutex
 
-	for _, subscriber := range uniqueSubscribers {
-		// Add child workflow to state before triggering
-		workflowInputs, err := fe.subscriptionEvaluator.ProcessEventPayload(event.Payload, subscriber.Subscription)
-		if err != nil {
-			errors = append(errors, fmt.Sprintf("failed to process payload for %s: %v", subscriber.Repository, err))
+	// Add all child workflows to state before triggering any of them. Their inputs are processed
+	// and their claims taken concurrently, and they are added to the state at once in the order
+	// of the subscribers.
+	type scheduledChild struct {
+		subscriber SubscriptionMatch
+		child      *ChildWorkflow
+	}
+	scheduled := make([]scheduledChild, 0, len(uniqueSubscribers))
+	claimOwner := fmt.Sprintf("%s (pid %d)", state.ID, os.Getpid())
+	if fe.lockRunID != "" {
+		claimOwner = fmt.Sprintf("%s (pid %d)", fe.lockRunID, os.Getpid())
+	}
+	var registrations []ChildRegistration
+	var claimedSubscribers []SubscriptionMatch
+	for _, prepared := range fe.prepareChildren(uniqueSubscribers, subscriberEvents, state, claimOwner) {
+		subscriber := prepared.subscriber
+		if prepared.err != nil {
+			errors = append(errors, prepared.err.Error())
+			continue
+		}
+		if prepared.duplicate {
+			fe.logger.Info("Child already triggered by another subscription",
+				"fan_out_id", state.ID,
+				"repository", subscriber.Repository,
+				"workflow", subscriber.Subscription.Workflow,
+			)
+			continue
+		}
+		if prepared.deduplicated {
+			fe.logger.Info("Child dropped as a duplicate within its dedup window",
+				"fan_out_id", state.ID,
+				"repository", subscriber.Repository,
+				"workflow", subscriber.Subscription.Workflow,
+			)
 			continue
 		}
+		if !prepared.claimed {
+			fe.logger.Info("Child already triggered by another process",
+				"fan_out_id", state.ID,
+				"repository", subscriber.Repository,
+				"workflow", subscriber.Subscription.Workflow,
+			)
+			continue
+		}
+		registrations = append(registrations, ChildRegistration{Repository: subscriber.Repository, Workflow: subscriber.Subscription.Workflow, Inputs: prepared.inputs})
+		claimedSubscribers = append(claimedSubscribers, subscriber)
+	}
+	if len(registrations) > 0 {
+		for i, child := range state.AddChildWorkflows(registrations) {
+			scheduled = append(scheduled, scheduledChild{subscriber: claimedSubscribers[i], child: child})
+		}
+	}
+
+	// Split the children into rollout waves; without a rollout they form a single wave
+	waveSizes := []int{len(scheduled)}
+	if params.Rollout != nil {
+		sizes, err := params.Rollout.WaveSizes(len(scheduled))
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("failed to plan rollout: %v", err))
+			sizes = waveSizes
+		}
+		waveSizes = sizes
+	}
+	wave, waveStart, waveEnd := 0, 0, 0
+	if len(waveSizes) > 0 {
+		waveEnd = waveSizes[0]
+	}
+	var rolloutSoFar rolloutStats
 
-		child := state.AddChildWorkflow(subscriber.Repository, subscriber.Subscription.Workflow, workflowInputs)
+	// cancelRemaining cancels the children not started yet once a child failed under fail-fast
+	cancelRemaining := func(from int) bool {
+		if context.Cause(childCtx) != errFailFast {
+			return false
+		}
+		// The children still running append their errors concurrently
+		mutex.Lock()
+		errors = append(errors, fmt.Sprintf("fail-fast: %d children were not started", len(scheduled)-from))
+		mutex.Unlock()
+		for _, cancelled := range scheduled[from:] {
+			state.UpdateChildStatus(cancelled.subscriber.Repository, cancelled.subscriber.Subscription.Workflow, ChildStatusCancelled, "",
+				"not started: "+errFailFast.Error())
+		}
+		return true
+	}
+
+	for i, next := range scheduled {
+		if cancelRemaining(i) {
+			break
+		}
+
+		// Wait for the previous wave to finish and check its gate before starting the next one
+		if i == waveEnd {
+			wg.Wait()
+
+			var waveStats rolloutStats
+			for _, finished := range scheduled[waveStart:waveEnd] {
+				waveStats.record(state.GetChildStatus(finished.subscriber.Repository, finished.subscriber.Subscription.Workflow))
+			}
+			rolloutSoFar.add(waveStats)
+
+			proceed, gateErr := params.Rollout.evaluateRolloutGate(wave+1, len(waveSizes), waveStats, rolloutSoFar, fe.now)
+			if gateErr != nil || !proceed {
+				reason := "gate was not satisfied"
+				if gateErr != nil {
+					reason = fmt.Sprintf("failed to evaluate gate: %v", gateErr)
+				} else if strings.TrimSpace(params.Rollout.Gate) == "" {
+					reason = fmt.Sprintf("%d children failed", waveStats.failed+waveStats.timedOut)
+				}
+				errors = append(errors, fmt.Sprintf("rollout aborted after wave %d of %d: %s", wave+1, len(waveSizes), reason))
+				for _, skipped := range scheduled[i:] {
+					state.UpdateChildStatus(skipped.subscriber.Repository, skipped.subscriber.Subscription.Workflow, ChildStatusSkipped, "",
+						fmt.Sprintf("skipped after rollout wave %d was aborted", wave+1))
+				}
+				break
+			}
+
+			// A wave requiring approval is held until it is decided; a stopped fan-out is
+			// handled below like any other
+			if params.Rollout.ApprovalRequired {
+				if err := fe.awaitWaveApproval(runCtx, params.Rollout, wave+2, len(waveSizes), waveSizes[wave+1], state); err != nil && runCtx.Err() == nil {
+					errors = append(errors, fmt.Sprintf("rollout aborted before wave %d of %d: %v", wave+2, len(waveSizes), err))
+					for _, skipped := range scheduled[i:] {
+						state.UpdateChildStatus(skipped.subscriber.Repository, skipped.subscriber.Subscription.Workflow, ChildStatusSkipped, "",
+							fmt.Sprintf("skipped after rollout wave %d was not approved", wave+2))
+					}
+					break
+				}
+			}
+
+			wave++
+			waveStart, waveEnd = waveEnd, waveEnd+waveSizes[wave]
+			if fe.debug {
+				fmt.Printf("Starting rollout wave %d of %d with %d children\n", wave+1, len(waveSizes), waveSizes[wave])
+			}
+		}
+
+		// Acquire the semaphore before starting the goroutine so that, when the
+		// concurrency limit is hit, children are started in priority order
+		semaphore <- struct{}{}
+
+		if cancelRemaining(i) {
+			<-semaphore
+			break
+		}
+		if runCtx.Err() != nil {
+			<-semaphore
+			if IsRunInterrupted(runCtx) {
+				// Children not started stay pending, for the process taking the fan-out over
+				break
+			}
+			mutex.Lock()
+			errors = append(errors, fmt.Sprintf("fan-out cancelled: %d children were not started", len(scheduled)-i))
+			mutex.Unlock()
+			for _, cancelled := range scheduled[i:] {
+				state.UpdateChildStatus(cancelled.subscriber.Repository, cancelled.subscriber.Subscription.Workflow, ChildStatusCancelled, "",
+					"fan-out was cancelled before the child started")
+			}
+			break
+		}
 
 		wg.Add(1)
 		go func(sub SubscriptionMatch, childWorkflow *ChildWorkflow) {
 			defer wg.Done()
-
-			// Acquire semaphore
-			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
+			// Children whose subscription requires approval are held until it is decided
+			if sub.Subscription.ApprovalRequired {
+				if err := fe.awaitChildApproval(childCtx, sub, state); err != nil {
+					if IsRunInterrupted(runCtx) {
+						// The child stays pending, for the process taking the fan-out over
+						return
+					}
+					status := ChildStatusSkipped
+					if childCtx.Err() != nil {
+						status = ChildStatusCancelled
+					}
+					state.UpdateChildStatus(sub.Repository, sub.Subscription.Workflow, status, "", err.Error())
+					mutex.Lock()
+					errors = append(errors, fmt.Sprintf("workflow in %s was not started: %v", sub.Repository, err))
+					mutex.Unlock()
+					return
+				}
+			}
+
 			// Record child execution start
-			childStartTime := time.Now()
+			childStartTime := fe.now()
 			fe.metricsCollector.RecordChildStarted()
 
 			endpoint := fmt.Sprintf("%s:%s", sub.Repository, sub.Subscription.Workflow)
@@ -631,12 +1828,15 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				"endpoint", endpoint,
 			)
 
-			// Update child status to running
+			// Update child status to running, and keep recording that this process runs it
 			state.UpdateChildStatus(sub.Repository, sub.Subscription.Workflow, ChildStatusRunning, "", "")
+			stopHeartbeat := state.startHeartbeat(sub.Repository, sub.Subscription.Workflow, fe.logger)
+			defer stopHeartbeat()
 
 			// Get circuit breaker for this endpoint
 			circuitBreaker := fe.circuitBreakerManager.GetCircuitBreaker(endpoint)
 			retryExecutor := NewRetryableExecutor(fe.retryConfig)
+			retryExecutor.SetClock(fe.clock)
 
 			var finalErr error
 			var runID string
@@ -644,7 +1844,7 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 			var retryCount int
 
 			// Create context with timeout for child execution
-			ctx := context.Background()
+			ctx := childCtx
 			if params.Timeout != "" {
 				if timeout, parseErr := time.ParseDuration(params.Timeout); parseErr == nil {
 					var cancel context.CancelFunc
@@ -653,33 +1853,69 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				}
 			}
 
-			// Execute with resilience (circuit breaker + retry)
-			err := circuitBreaker.Call(func() error {
-				return retryExecutor.ExecuteWithCallback(ctx, func() error {
-					result, execErr := fe.executeChildWorkflow(ctx, sub.Repository, sub.Subscription.Workflow, childWorkflow.Inputs)
-					if execErr != nil {
-						return execErr
-					}
-					// Store the result for later use
-					executionResult = result
-					if result != nil {
-						runID = result.RunID
-					}
-					return nil
-				}, func(attempt int, retryErr error) {
-					retryCount = attempt
-					fe.logger.Warn("Child workflow execution retry",
+			// The provenance of the child records the event that triggered it
+			ctx = withProvenanceTrigger(ctx, subscriberTriggers[sub.Repository+":"+sub.Subscription.Workflow])
+
+			// Children of subscriptions with affinity reuse the workspace of the previous fan-out
+			// of their event type
+			if affinity := sub.Subscription.Affinity; affinity != nil {
+				ctx = withWorkspaceAffinity(ctx, WorkspaceAffinity{
+					EventType:  subscriberEvents[sub.Repository+":"+sub.Subscription.Workflow].Type,
+					Repository: sub.Repository,
+					Workflow:   sub.Subscription.Workflow,
+					StaleAfter: affinity.EffectiveStaleAfter(),
+				})
+			}
+
+			// Serialize runs from different fan-outs that target the same subscriber repository
+			lockOwner := fe.lockRunID
+			if lockOwner == "" {
+				lockOwner = state.ID
+			}
+			childRepo, err := fe.resolveChildRevision(ctx, sub, params, state)
+			if err != nil {
+				err = fmt.Errorf("failed to resolve revision of %s: %w", sub.Repository, err)
+			} else if err = fe.repoLocks.WaitForLock(ctx, lockOwner, fe.lockParentRunID, sub.Repository, LockTypeWrite); err != nil {
+				err = fmt.Errorf("failed to lock repository %s: %w", sub.Repository, err)
+			} else {
+				fe.setChildLockOwner(state, sub.Repository, sub.Subscription.Workflow, lockOwner)
+
+				// Execute with resilience (circuit breaker + retry)
+				err = circuitBreaker.Call(func() error {
+					return retryExecutor.ExecuteWithCallback(ctx, func() error {
+						result, execErr := fe.executeChildWorkflow(ctx, childRepo, sub.Subscription.Workflow, sub.Subscription.Backend, childWorkflow.Inputs)
+						if execErr != nil {
+							return execErr
+						}
+						// Store the result for later use
+						executionResult = result
+						if result != nil {
+							runID = result.RunID
+						}
+						return nil
+					}, func(attempt int, retryErr error) {
+						retryCount = attempt
+						fe.logger.Warn("Child workflow execution retry",
+							"repository", sub.Repository,
+							"workflow", sub.Subscription.Workflow,
+							"attempt", attempt,
+							"error", retryErr.Error(),
+						)
+					})
+				})
+
+				if releaseErr := fe.repoLocks.ReleaseLock(lockOwner, sub.Repository, LockTypeWrite); releaseErr != nil {
+					fe.logger.Warn("Failed to release repository lock",
 						"repository", sub.Repository,
-						"workflow", sub.Subscription.Workflow,
-						"attempt", attempt,
-						"error", retryErr.Error(),
+						"error", releaseErr.Error(),
 					)
-				})
-			})
+				}
+				fe.setChildLockOwner(state, sub.Repository, sub.Subscription.Workflow, "")
+			}
 
 			// Determine final status and record metrics
 			var finalStatus ChildWorkflowStatus
-			childDuration := time.Since(childStartTime)
+			childDuration := fe.now().Sub(childStartTime)
 
 			if err != nil {
 				finalErr = err
@@ -694,6 +1930,21 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 						"workflow", sub.Subscription.Workflow,
 						"endpoint", endpoint,
 					)
+				} else if strings.Contains(err.Error(), ErrDeadlock.Error()) {
+					errorType = "deadlock"
+					fe.logger.Warn("Child workflow aborted to break a repository lock deadlock",
+						"repository", sub.Repository,
+						"workflow", sub.Subscription.Workflow,
+						"error", err.Error(),
+					)
+				} else if IsRunCancelled(runCtx) {
+					errorType = "cancelled"
+					finalStatus = ChildStatusCancelled
+				} else if context.Cause(childCtx) == errFailFast {
+					errorType = "cancelled"
+					finalStatus = ChildStatusCancelled
+					err = fmt.Errorf("%w: %v", errFailFast, err)
+					finalErr = err
 				} else if strings.Contains(err.Error(), "context deadline exceeded") {
 					errorType = "timeout"
 					finalStatus = ChildStatusTimedOut
@@ -702,7 +1953,11 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				}
 
 				mutex.Lock()
-				errors = append(errors, fmt.Sprintf("failed to trigger workflow in %s: %v", sub.Repository, err))
+				if finalStatus == ChildStatusCancelled {
+					errors = append(errors, fmt.Sprintf("failed to trigger workflow in %s: %v", sub.Repository, err))
+				} else {
+					childErrors = append(childErrors, fmt.Sprintf("failed to trigger workflow in %s: %v", sub.Repository, err))
+				}
 				detailedErrors = append(detailedErrors, ChildExecutionError{
 					Repository:   sub.Repository,
 					Workflow:     sub.Subscription.Workflow,
@@ -716,12 +1971,33 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				mutex.Unlock()
 			} else {
 				// Execution completed, but check if the workflow itself succeeded
-				if executionResult != nil && !executionResult.Success {
+				if executionResult != nil && !executionResult.Success && (IsRunCancelled(runCtx) || context.Cause(childCtx) == errFailFast) {
+					finalStatus = ChildStatusCancelled
+					finalErr = fmt.Errorf("child workflow was cancelled")
+
+					mutex.Lock()
+					errors = append(errors, fmt.Sprintf("workflow cancelled in %s", sub.Repository))
+					detailedErrors = append(detailedErrors, ChildExecutionError{
+						Repository:   sub.Repository,
+						Workflow:     sub.Subscription.Workflow,
+						RunID:        runID,
+						ErrorType:    "cancelled",
+						ErrorMessage: "child workflow was cancelled",
+						StartTime:    childStartTime,
+						Duration:     childDuration,
+						RetryCount:   retryCount,
+					})
+					mutex.Unlock()
+				} else if executionResult != nil && !executionResult.Success {
 					finalStatus = ChildStatusFailed
+					if resultTimedOut(executionResult) {
+						// Backends that enforce deadlines themselves report timeouts in the result
+						finalStatus = ChildStatusTimedOut
+					}
 					finalErr = fmt.Errorf("child workflow execution completed but workflow failed")
 
 					mutex.Lock()
-					errors = append(errors, fmt.Sprintf("workflow failed in %s: workflow execution was unsuccessful", sub.Repository))
+					childErrors = append(childErrors, fmt.Sprintf("workflow failed in %s: workflow execution was unsuccessful", sub.Repository))
 					detailedErrors = append(detailedErrors, ChildExecutionError{
 						Repository:   sub.Repository,
 						Workflow:     sub.Subscription.Workflow,
@@ -736,6 +2012,17 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				} else {
 					finalStatus = ChildStatusCompleted
 					// runID is already set from the execution result
+					fe.recordArtifactDigest(sub, subscriberEvents[sub.Repository+":"+sub.Subscription.Workflow])
+
+					if executionResult != nil && executionResult.Outputs != nil {
+						if err := state.SetChildOutputs(sub.Repository, sub.Subscription.Workflow, executionResult.Outputs); err != nil {
+							fe.logger.Warn("Failed to record child workflow outputs",
+								"repository", sub.Repository,
+								"workflow", sub.Subscription.Workflow,
+								"error", err,
+							)
+						}
+					}
 
 					// Schedule cleanup of child workspace (async, best effort)
 					if runID != "" {
@@ -755,6 +2042,19 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 			// Record child completion metrics
 			fe.metricsCollector.RecordChildCompleted(childDuration, finalStatus)
 
+			if (finalStatus == ChildStatusFailed || finalStatus == ChildStatusTimedOut) && params.FailurePolicy.failFast() {
+				failFast(errFailFast)
+			}
+
+			// Children stopped by a signal stay running, for the process taking the fan-out over
+			if IsRunInterrupted(runCtx) && finalStatus != ChildStatusCompleted {
+				finalStatus = ChildStatusRunning
+			}
+
+			if executionResult != nil {
+				state.SetChildResult(sub.Repository, sub.Subscription.Workflow, executionResult)
+			}
+
 			// Update final child status
 			state.UpdateChildStatus(sub.Repository, sub.Subscription.Workflow, finalStatus, runID,
 				func() string {
@@ -771,14 +2071,100 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 				"duration_ms", childDuration.Milliseconds(),
 				"run_id", runID,
 			)
-		}(subscriber, child)
+		}(next.subscriber, next.child)
 	}
 
 	wg.Wait()
+
+	// Failed children fail the fan-out unless a threshold policy tolerates them
+	failed := countFailedChildren(state)
+	if params.FailurePolicy.tolerates(failed, len(scheduled)) {
+		if failed > 0 {
+			fe.logger.Warn("Failed children tolerated by the failure threshold",
+				"failed", failed,
+				"total", len(scheduled),
+				"threshold_percent", params.FailurePolicy.Threshold,
+			)
+		}
+	} else {
+		errors = append(errors, childErrors...)
+		if params.FailurePolicy != nil && params.FailurePolicy.Mode == FailurePolicyThreshold {
+			errors = append(errors, fmt.Sprintf("failure threshold exceeded: %d of %d children failed, more than %g%%",
+				failed, len(scheduled), params.FailurePolicy.Threshold))
+		}
+	}
+
 	return triggeredCount, errors, detailedErrors
 }
 
-// resolveDiamondDependencies implements the "first-wins" rule for diamond dependency resolution.
+// countFailedChildren returns the number of children of a fan-out that failed or timed out.
+func countFailedChildren(state *FanOutState) int {
+	summary := state.GetSummary()
+	return summary.FailedChildren + summary.TimedOutChildren
+}
+
+// resolveChildRevision returns the repository reference a child workflow runs: the subscriber,
+// pinned to the commit its revision resolves to, which is recorded in the fan-out state and in
+// the revision lock of the tree. The refs of the fan-out step override the ref of the
+// subscription, and a replayed lockfile overrides both. Unpinned subscribers whose cached
+// repository is not a Git clone run the cached checkout as it is.
+func (fe *FanOutExecutor) resolveChildRevision(ctx context.Context, sub SubscriptionMatch, params *FanOutParams, state *FanOutState) (string, error) {
+	spec := sub.Subscription.Ref
+	if ref, ok := params.Refs[sub.Repository]; ok {
+		spec = ref
+	}
+
+	var pinned config.PinnedRef
+	if spec != "" {
+		var err error
+		if pinned, err = config.ParsePinnedRef(spec); err != nil {
+			return "", err
+		}
+	}
+	if locked, ok := fe.revisions.Pinned(sub.Repository, pinned.Ref); ok {
+		pinned = config.PinnedRef{Ref: locked.Ref, Commit: locked.Commit}
+		spec = pinned.String()
+	}
+
+	commit := pinned.Commit
+	if fe.gitManager != nil {
+		resolved, err := fe.gitManager.ResolveCommit(ctx, sub.Repository, pinned)
+		if err != nil {
+			if spec == "" {
+				return sub.Repository, nil
+			}
+			return "", err
+		}
+		commit = resolved
+	} else if spec == "" {
+		return sub.Repository, nil
+	}
+
+	fe.revisions.Record(LockedRepository{Repository: sub.Repository, Ref: pinned.Ref, Commit: commit})
+	if err := state.SetChildRevision(sub.Repository, sub.Subscription.Workflow, spec, commit); err != nil {
+		fe.logger.Warn("Failed to record child revision",
+			"repository", sub.Repository,
+			"error", err.Error(),
+		)
+	}
+
+	ref := pinned.Ref
+	if ref == "" {
+		ref = "main"
+	}
+	if commit == "" {
+		return fmt.Sprintf("%s:%s", sub.Repository, ref), nil
+	}
+	return fmt.Sprintf("%s:%s@%s", sub.Repository, ref, commit), nil
+}
+
+// isCancelled reports whether cancellation was requested for the fan-out or for the run that emitted it.
+func (fe *FanOutExecutor) isCancelled(state *FanOutState) bool {
+	return fe.cancellations.IsCancelled(state.ID, fe.lockRunID, fe.lockParentRunID)
+}
+
+// resolveDiamondDependencies implements the "first-wins" rule for diamond dependency resolution,
+// the first diamond strategy; see resolveDiamonds for the others.
 // This prevents duplicate subscriptions from triggering multiple workflows for the same logical event.
 //
 // Algorithm:
@@ -796,9 +2182,119 @@ func (fe *FanOutExecutor) triggerSubscribersWithState(subscribers []Subscription
 //   - skippedCount: number of duplicate subscriptions that were skipped
 //   - errors: any errors encountered during fingerprint generation
 func (fe *FanOutExecutor) resolveDiamondDependencies(subscribers []SubscriptionMatch, eventFingerprint string) ([]SubscriptionMatch, int, []string) {
+	uniqueSubscribers, resolutions, errors := fe.resolveDiamonds(subscribers, eventFingerprint, config.DiamondStrategyFirst)
+	skippedCount := 0
+	for _, resolution := range resolutions {
+		skippedCount += len(resolution.losers)
+	}
+	return uniqueSubscribers, skippedCount, errors
+}
+
+// DiamondResolution records how a diamond dependency of a fan-out was resolved: which of the
+// identical subscriptions of several repositories its event triggered, and why.
+type DiamondResolution struct {
+	EventType string `json:"event_type"`
+	Strategy  string `json:"strategy"`
+	// Winner is the subscription triggered, as repository:workflow; empty when the diamond
+	// failed the fan-out.
+	Winner string `json:"winner,omitempty"`
+	// Losers are the subscriptions skipped, as repository:workflow.
+	Losers []string `json:"losers"`
+	// Inputs are the inputs of the winner merged from those of the losers, under the
+	// merge-inputs strategy.
+	Inputs map[string]string `json:"inputs,omitempty"`
+}
+
+// diamondResolution is a group of identical subscriptions, of which only the winner is
+// triggered.
+type diamondResolution struct {
+	strategy string
+	winner   SubscriptionMatch
+	losers   []SubscriptionMatch
+}
+
+// record returns the record of the resolution of a diamond of an event type.
+func (r diamondResolution) record(eventType string) DiamondResolution {
+	record := DiamondResolution{
+		EventType: eventType,
+		Strategy:  r.strategy,
+		Winner:    fmt.Sprintf("%s:%s", r.winner.Repository, r.winner.Subscription.Workflow),
+	}
+	for _, loser := range r.losers {
+		record.Losers = append(record.Losers, fmt.Sprintf("%s:%s", loser.Repository, loser.Subscription.Workflow))
+	}
+	switch r.strategy {
+	case config.DiamondStrategyMergeInputs:
+		record.Inputs = r.winner.Subscription.Inputs
+	case config.DiamondStrategyFail:
+		// No subscription of the diamond is triggered
+		record.Losers = append([]string{record.Winner}, record.Losers...)
+		record.Winner = ""
+	}
+	return record
+}
+
+// reason explains why the winner of a diamond was triggered instead of the losers.
+func (r diamondResolution) reason() string {
+	switch r.strategy {
+	case config.DiamondStrategyPriority:
+		return "identical subscription filters and inputs, highest priority wins"
+	case config.DiamondStrategyMergeInputs:
+		return "identical subscription filters, first wins with the inputs of all"
+	case config.DiamondStrategyFail:
+		return "identical subscription filters and inputs, diamond fails the fan-out"
+	default:
+		return "identical subscription filters and inputs, first wins"
+	}
+}
+
+// diamondStrategy returns the diamond strategy of an event type.
+func (fe *FanOutExecutor) diamondStrategy(eventType string) string {
+	return fe.diamondStrategies.DiamondStrategyFor(eventType)
+}
+
+// checkDiamonds fails a fan-out emitting an event whose diamond strategy is fail when its
+// subscribers include a diamond dependency, recording the diamonds in its state.
+func (fe *FanOutExecutor) checkDiamonds(groups []eventSubscribers, state *FanOutState) error {
+	var diamonds []DiamondResolution
+	for _, group := range groups {
+		if fe.diamondStrategy(group.event.Type) != config.DiamondStrategyFail {
+			continue
+		}
+		eventFingerprint, err := GenerateEventFingerprint(&group.event)
+		if err != nil {
+			continue
+		}
+		_, resolutions, _ := fe.resolveDiamonds(group.subscribers, eventFingerprint, config.DiamondStrategyFail)
+		for _, resolution := range resolutions {
+			diamonds = append(diamonds, resolution.record(group.event.Type))
+		}
+	}
+	if len(diamonds) == 0 {
+		return nil
+	}
+
+	if err := state.AddDiamonds(diamonds...); err != nil {
+		return err
+	}
+	for _, diamond := range diamonds {
+		fe.recordAudit(AuditEntry{
+			FanOutID: state.ID,
+			Decision: AuditDiamondResolved,
+			Reason:   diamondResolution{strategy: config.DiamondStrategyFail}.reason(),
+			Details:  map[string]string{"event_type": diamond.EventType, "losers": strings.Join(diamond.Losers, ", ")},
+		})
+	}
+	return fmt.Errorf("diamond dependency of event '%s': %s subscribe identically, and its diamond_strategy is fail",
+		diamonds[0].EventType, strings.Join(diamonds[0].Losers, ", "))
+}
+
+// resolveDiamonds applies a diamond strategy to the subscribers of an event, returning the
+// subscribers to trigger and the groups of identical subscriptions that were resolved.
+func (fe *FanOutExecutor) resolveDiamonds(subscribers []SubscriptionMatch, eventFingerprint, strategy string) ([]SubscriptionMatch, []diamondResolution, []string) {
 	if eventFingerprint == "" || len(subscribers) <= 1 {
 		// Skip diamond resolution if no event fingerprint or insufficient subscribers
-		return subscribers, 0, nil
+		return subscribers, nil, nil
 	}
 
 	// Map from subscription fingerprint to the first (winning) subscriber
@@ -807,10 +2303,14 @@ func (fe *FanOutExecutor) resolveDiamondDependencies(subscribers []SubscriptionM
 	fingerprintToAll := make(map[string][]SubscriptionMatch)
 	errors := []string{}
 
-	// Sort subscribers by repository path for deterministic first-wins ordering
+	// Sort subscribers by repository path for deterministic first-wins ordering, after their
+	// priority under the priority strategy
 	sortedSubscribers := make([]SubscriptionMatch, len(subscribers))
 	copy(sortedSubscribers, subscribers)
-	sort.Slice(sortedSubscribers, func(i, j int) bool {
+	sort.SliceStable(sortedSubscribers, func(i, j int) bool {
+		if strategy == config.DiamondStrategyPriority && sortedSubscribers[i].Subscription.Priority != sortedSubscribers[j].Subscription.Priority {
+			return sortedSubscribers[i].Subscription.Priority > sortedSubscribers[j].Subscription.Priority
+		}
 		if sortedSubscribers[i].Repository != sortedSubscribers[j].Repository {
 			return sortedSubscribers[i].Repository < sortedSubscribers[j].Repository
 		}
@@ -819,7 +2319,12 @@ func (fe *FanOutExecutor) resolveDiamondDependencies(subscribers []SubscriptionM
 
 	// Process subscribers in sorted order to ensure deterministic first-wins
 	for _, subscriber := range sortedSubscribers {
-		subscriptionFingerprint, err := GenerateSubscriptionFingerprint(subscriber, eventFingerprint)
+		fingerprinted := subscriber
+		if strategy == config.DiamondStrategyMergeInputs {
+			// Subscriptions that only differ by their inputs are merged
+			fingerprinted.Subscription.Inputs = nil
+		}
+		subscriptionFingerprint, err := GenerateSubscriptionFingerprint(fingerprinted, eventFingerprint)
 		if err != nil {
 			errors = append(errors, fmt.Sprintf("failed to generate subscription fingerprint for %s:%s: %v",
 				subscriber.Repository, subscriber.Subscription.Workflow, err))
@@ -839,14 +2344,18 @@ func (fe *FanOutExecutor) resolveDiamondDependencies(subscribers []SubscriptionM
 
 	// Build unique subscribers list and log skipped duplicates
 	uniqueSubscribers := make([]SubscriptionMatch, 0, len(fingerprintToWinner))
-	skippedCount := 0
+	var resolutions []diamondResolution
 
 	for fingerprint, winner := range fingerprintToWinner {
+		allForFingerprint := fingerprintToAll[fingerprint]
+		if len(allForFingerprint) > 1 && strategy == config.DiamondStrategyMergeInputs {
+			winner.Subscription.Inputs = mergeSubscriptionInputs(allForFingerprint)
+		}
 		uniqueSubscribers = append(uniqueSubscribers, winner)
 
-		allForFingerprint := fingerprintToAll[fingerprint]
 		if len(allForFingerprint) > 1 {
-			skippedCount += len(allForFingerprint) - 1 // All except the winner
+			resolution := diamondResolution{strategy: strategy, winner: winner, losers: allForFingerprint[1:]}
+			resolutions = append(resolutions, resolution)
 
 			// Log detailed information about diamond resolution
 			skippedRepos := make([]string, 0, len(allForFingerprint)-1)
@@ -854,31 +2363,72 @@ func (fe *FanOutExecutor) resolveDiamondDependencies(subscribers []SubscriptionM
 				skippedRepos = append(skippedRepos, fmt.Sprintf("%s:%s", sub.Repository, sub.Subscription.Workflow))
 			}
 
-			fe.logger.Info("Diamond dependency resolved using first-wins rule",
+			fe.logger.Info("Diamond dependency resolved",
+				"strategy", strategy,
 				"fingerprint", fingerprint[:16]+"...", // Truncated for readability
 				"winner", fmt.Sprintf("%s:%s", winner.Repository, winner.Subscription.Workflow),
 				"skipped", strings.Join(skippedRepos, ", "),
-				"reason", "identical subscription filters and inputs",
+				"reason", resolution.reason(),
 			)
 		}
 	}
 
-	return uniqueSubscribers, skippedCount, errors
+	// Resolutions are recorded in a deterministic order
+	sort.Slice(resolutions, func(i, j int) bool {
+		if resolutions[i].winner.Repository != resolutions[j].winner.Repository {
+			return resolutions[i].winner.Repository < resolutions[j].winner.Repository
+		}
+		return resolutions[i].winner.Subscription.Workflow < resolutions[j].winner.Subscription.Workflow
+	})
+	return uniqueSubscribers, resolutions, errors
+}
+
+// mergeSubscriptionInputs merges the inputs of subscriptions, those of earlier subscriptions
+// winning conflicts.
+func mergeSubscriptionInputs(subscribers []SubscriptionMatch) map[string]string {
+	merged := make(map[string]string)
+	for i := len(subscribers) - 1; i >= 0; i-- {
+		for name, value := range subscribers[i].Subscription.Inputs {
+			merged[name] = value
+		}
+	}
+	return merged
 }
 
 // executeChildWorkflow executes a workflow in a child repository using the injected WorkflowRunner.
-// This replaces the simulation with actual isolated child workflow execution.
-func (fe *FanOutExecutor) executeChildWorkflow(ctx context.Context, repository, workflow string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+// This replaces the simulation with actual isolated child workflow execution. A named backend
+// selects a backend of the injected BackendRegistry; the empty name uses the runner as is.
+func (fe *FanOutExecutor) executeChildWorkflow(ctx context.Context, repository, workflow, backend string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
 	if fe.workflowRunner == nil {
 		return nil, fmt.Errorf("workflow runner not configured for child execution")
 	}
+	runner := fe.workflowRunner
+	if backend != "" {
+		backends, ok := runner.(*BackendRegistry)
+		if !ok {
+			return nil, fmt.Errorf("execution backend '%s' requested but no backends are configured", backend)
+		}
+		var err error
+		if runner, err = backends.Get(backend); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := fe.faults.fail(FaultChildTrigger, repository); err != nil {
+		return nil, err
+	}
+	if err := fe.faults.delay(ctx, FaultSlowSubscriber, repository); err != nil {
+		return nil, err
+	}
 
 	if fe.debug {
 		fmt.Printf("EXECUTING: Triggering workflow '%s' in '%s' with inputs: %v\n", workflow, repository, inputs)
 	}
 
-	// Execute the child workflow using the injected WorkflowRunner
-	result, err := fe.workflowRunner.ExecuteWorkflow(ctx, repository, workflow, inputs)
+	// Execute the child workflow using the injected WorkflowRunner, which passes its lineage on
+	lineage := append(slices.Clone(fe.lineage), lineageNode(repository, workflow))
+	childCtx := withCorrelationID(withLineage(ctx, lineage), fe.correlationID)
+	result, err := runner.ExecuteWorkflow(childCtx, repository, workflow, inputs)
 	if err != nil {
 		return nil, fmt.Errorf("child workflow execution failed in %s: %w", repository, err)
 	}
@@ -894,10 +2444,61 @@ func (fe *FanOutExecutor) executeChildWorkflow(ctx context.Context, repository,
 	return result, nil
 }
 
+// resultTimedOut reports whether a workflow failed because a step or the workflow timed out.
+func resultTimedOut(result *interfaces.ExecutionResult) bool {
+	for _, step := range result.Steps {
+		if step.ErrorType == interfaces.StepErrorStepTimeout || step.ErrorType == interfaces.StepErrorWorkflowTimeout {
+			return true
+		}
+	}
+	return false
+}
+
+// recordAudit appends a trigger decision to the audit log. Like the history, the audit log
+// must not fail the fan-out: a decision that cannot be recorded is logged.
+func (fe *FanOutExecutor) recordAudit(entry AuditEntry) {
+	if err := fe.audit.Append(entry); err != nil {
+		fe.logger.Warn("Failed to record audit entry",
+			"fan_out_id", entry.FanOutID,
+			"decision", entry.Decision,
+			"error", err.Error(),
+		)
+	}
+}
+
+// setChildLockOwner records which run holds the repository lock of a child. The record only
+// serves a process taking the fan-out over, so a failure to persist it is logged.
+func (fe *FanOutExecutor) setChildLockOwner(state *FanOutState, repository, workflow, owner string) {
+	if err := state.SetChildLockOwner(repository, workflow, owner); err != nil {
+		fe.logger.Warn("Failed to record the repository lock owner of a child",
+			"fan_out_id", state.ID,
+			"repository", repository,
+			"workflow", workflow,
+			"error", err.Error(),
+		)
+	}
+}
+
+// containsSubscriber reports whether a subscription of a repository is among subscribers.
+func containsSubscriber(subscribers []SubscriptionMatch, subscriber SubscriptionMatch) bool {
+	for _, s := range subscribers {
+		if s.Repository == subscriber.Repository && s.Subscription.Workflow == subscriber.Subscription.Workflow {
+			return true
+		}
+	}
+	return false
+}
+
 // handleDuplicateEvent handles different scenarios when a duplicate event is detected.
 func (fe *FanOutExecutor) handleDuplicateEvent(existingState *FanOutState, timeout time.Duration, startTime time.Time) (*FanOutResult, error) {
+	fe.recordAudit(AuditEntry{
+		FanOutID: existingState.ID,
+		Decision: AuditDuplicateEvent,
+		Reason:   "the event was already fanned out",
+		Details:  map[string]string{"status": string(existingState.Status)},
+	})
 	switch existingState.Status {
-	case FanOutStatusCompleted, FanOutStatusFailed, FanOutStatusTimedOut:
+	case FanOutStatusCompleted, FanOutStatusFailed, FanOutStatusTimedOut, FanOutStatusCancelled:
 		// State is complete, reconstruct and return result
 		if fe.debug {
 			fmt.Printf("Duplicate event detected: state %s is already complete (%s)\n", existingState.ID, existingState.Status)
@@ -931,19 +2532,32 @@ func (fe *FanOutExecutor) reconstructFanOutResult(state *FanOutState, startTime
 		TriggeredCount:   0, // Duplicate call - no new workflows were triggered
 		Errors:           []string{},
 		DetailedErrors:   []ChildExecutionError{},
-		StartTime:        startTime,  // Use current call's start time
-		EndTime:          time.Now(), // End time is now for the duplicate call
+		StartTime:        startTime, // Use current call's start time
+		EndTime:          fe.now(),  // End time is now for the duplicate call
 		FanOutID:         state.ID,
 		TimeoutExceeded:  summary.TimedOutChildren > 0,
 		ChildrenSummary:  &summary,
+		Children:         state.GetChildren(),
 	}
 
 	// Add error message if the original execution failed
 	if state.Status == FanOutStatusFailed && state.ErrorMessage != "" {
 		result.Errors = append(result.Errors, fmt.Sprintf("original execution failed: %s", state.ErrorMessage))
 	}
+	if state.Status == FanOutStatusCancelled {
+		result.Cancelled = true
+		result.Errors = append(result.Errors, "original execution was cancelled")
+	}
 
-	// Add summary errors for failed children
+	// Add summary errors for failed children, unless the failure policy tolerated them
+	if state.FailurePolicy != nil {
+		result.FailurePolicy = state.FailurePolicy.Mode
+	}
+	if failed := summary.FailedChildren + summary.TimedOutChildren; state.Status == FanOutStatusCompleted && failed > 0 &&
+		state.FailurePolicy.tolerates(failed, summary.TotalChildren) {
+		result.ToleratedFailures = failed
+		return result
+	}
 	if summary.FailedChildren > 0 {
 		result.Errors = append(result.Errors, fmt.Sprintf("%d child workflows failed", summary.FailedChildren))
 	}
@@ -962,55 +2576,22 @@ func (fe *FanOutExecutor) waitForExistingState(state *FanOutState, timeout time.
 		waitTimeout = 5 * time.Minute
 	}
 
-	// Poll for completion
-	pollInterval := 100 * time.Millisecond
-	maxPollInterval := 1 * time.Second
-	waitStartTime := time.Now()
-
-	for {
-		// Check if timeout exceeded
-		if time.Since(waitStartTime) > waitTimeout {
-			// Reconstruct result with timeout indication
-			result := fe.reconstructFanOutResult(state, startTime)
-			result.TimeoutExceeded = true
-			result.Errors = append(result.Errors, "timeout exceeded while waiting for existing execution to complete")
-			return result, nil
-		}
-
-		// Check if state is complete
-		if state.IsComplete() {
-			return fe.reconstructFanOutResult(state, startTime), nil
-		}
-
-		// Sleep before next poll
-		time.Sleep(pollInterval)
-
-		// Exponential backoff up to max interval
-		if pollInterval < maxPollInterval {
-			pollInterval = pollInterval * 2
-			if pollInterval > maxPollInterval {
-				pollInterval = maxPollInterval
-			}
-		}
-
-		// Refresh state from disk/memory to get latest status
-		freshState, err := fe.stateManager.GetFanOutState(state.ID)
-		if err != nil {
-			// If we can't refresh the state, return current result
-			if fe.debug {
-				fmt.Printf("Warning: failed to refresh state %s: %v\n", state.ID, err)
-			}
-			return fe.reconstructFanOutResult(state, startTime), nil
-		}
-		state = freshState
+	if !fe.stateManager.WaitForCompletion(state, waitTimeout) {
+		// Reconstruct result with timeout indication
+		result := fe.reconstructFanOutResult(state, startTime)
+		result.TimeoutExceeded = true
+		result.Errors = append(result.Errors, "timeout exceeded while waiting for existing execution to complete")
+		return result, nil
 	}
+
+	return fe.reconstructFanOutResult(state, startTime), nil
 }
 
 // simulateWorkflowTrigger is kept for backward compatibility with tests.
 // TODO: Remove this method after all tests are updated to use real execution.
 func (fe *FanOutExecutor) simulateWorkflowTrigger(repository, workflow string, inputs map[string]string) error {
 	// Convert to real execution with a background context
-	_, err := fe.executeChildWorkflow(context.Background(), repository, workflow, inputs)
+	_, err := fe.executeChildWorkflow(context.Background(), repository, workflow, "", inputs)
 	return err
 }
 
@@ -1025,43 +2606,22 @@ func (fe *FanOutExecutor) waitForChildrenWithState(state *FanOutState, timeout t
 		timeout = 5 * time.Minute
 	}
 
-	// Poll for completion with exponential backoff
-	pollInterval := 100 * time.Millisecond
-	maxPollInterval := 1 * time.Second
-	startTime := time.Now()
-
-	for {
-		// Check if timeout exceeded
-		if time.Since(startTime) > timeout {
-			state.TimeoutFanOut()
-			return fmt.Errorf("timeout exceeded while waiting for children")
-		}
-
-		// Check if fan-out is complete
-		if state.IsComplete() {
-			if fe.debug {
-				summary := state.GetSummary()
-				if summary.FailedChildren > 0 || summary.TimedOutChildren > 0 {
-					fmt.Printf("Children completed with failures: %d failed, %d timed out\n",
-						summary.FailedChildren, summary.TimedOutChildren)
-				} else {
-					fmt.Printf("All children completed successfully\n")
-				}
-			}
-			return nil
-		}
-
-		// Sleep before next poll
-		time.Sleep(pollInterval)
+	// Wait for the children to update the state, instead of polling it
+	if !fe.stateManager.WaitForCompletion(state, timeout) {
+		state.TimeoutFanOut()
+		return fmt.Errorf("timeout exceeded while waiting for children")
+	}
 
-		// Exponential backoff up to max interval
-		if pollInterval < maxPollInterval {
-			pollInterval = pollInterval * 2
-			if pollInterval > maxPollInterval {
-				pollInterval = maxPollInterval
-			}
+	if fe.debug {
+		summary := state.GetSummary()
+		if summary.FailedChildren > 0 || summary.TimedOutChildren > 0 {
+			fmt.Printf("Children completed with failures: %d failed, %d timed out\n",
+				summary.FailedChildren, summary.TimedOutChildren)
+		} else {
+			fmt.Printf("All children completed successfully\n")
 		}
 	}
+	return nil
 }
 
 // waitForChildren waits for child workflows to complete (legacy method for backward compatibility).
@@ -0,0 +1,109 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// approvalRunID returns the run the approval gates of a fan-out belong to: the run that emitted
+// it, or the fan-out itself when no run did.
+func (fe *FanOutExecutor) approvalRunID(state *FanOutState) string {
+	if fe.lockRunID != "" {
+		return fe.lockRunID
+	}
+	return state.ID
+}
+
+// awaitChildApproval holds a child whose subscription requires approval until its gate is
+// decided. It returns an error when the gate is rejected, or when ctx is done first.
+func (fe *FanOutExecutor) awaitChildApproval(ctx context.Context, sub SubscriptionMatch, state *FanOutState) error {
+	gate := sub.Repository + ":" + sub.Subscription.Workflow
+	deadline, err := fe.approvals.deadline(sub.Subscription.ApprovalTimeout)
+	if err != nil {
+		return err
+	}
+	request := ApprovalRequest{
+		RunID:      fe.approvalRunID(state),
+		Gate:       gate,
+		Repository: sub.Repository,
+		Workflow:   sub.Subscription.Workflow,
+		FanOutID:   state.ID,
+		Message:    fmt.Sprintf("%s event of %s triggers %s", state.EventType, state.SourceRepo, gate),
+		Deadline:   deadline,
+		OnTimeout:  config.ApprovalOnTimeoutReject,
+	}
+	if err := state.SetChildApproval(sub.Repository, sub.Subscription.Workflow, ApprovalPending); err != nil {
+		return err
+	}
+	decision, err := fe.awaitApproval(ctx, request, state)
+	if err != nil {
+		return err
+	}
+	if err := state.SetChildApproval(sub.Repository, sub.Subscription.Workflow, decision.Status); err != nil {
+		fe.logger.Warn("Failed to record child approval",
+			"repository", sub.Repository,
+			"workflow", sub.Subscription.Workflow,
+			"error", err.Error(),
+		)
+	}
+	if decision.Status != ApprovalApproved {
+		return fmt.Errorf("%s", describeApproval(decision))
+	}
+	return nil
+}
+
+// awaitWaveApproval holds a rollout wave until its gate is decided. It returns an error when
+// the gate is rejected, or when ctx is done first.
+func (fe *FanOutExecutor) awaitWaveApproval(ctx context.Context, rollout *RolloutConfig, wave, waves, size int, state *FanOutState) error {
+	deadline, err := fe.approvals.deadline(rollout.ApprovalTimeout)
+	if err != nil {
+		return err
+	}
+	decision, err := fe.awaitApproval(ctx, ApprovalRequest{
+		RunID:     fe.approvalRunID(state),
+		Gate:      fmt.Sprintf("wave-%d", wave),
+		FanOutID:  state.ID,
+		Message:   fmt.Sprintf("rollout wave %d of %d of the %s event of %s triggers %d children", wave, waves, state.EventType, state.SourceRepo, size),
+		Deadline:  deadline,
+		OnTimeout: config.ApprovalOnTimeoutReject,
+	}, state)
+	if err != nil {
+		return err
+	}
+	if decision.Status != ApprovalApproved {
+		return fmt.Errorf("%s", describeApproval(decision))
+	}
+	return nil
+}
+
+// awaitApproval requests an approval gate of a fan-out and waits for its decision, which is
+// recorded in the audit log.
+func (fe *FanOutExecutor) awaitApproval(ctx context.Context, request ApprovalRequest, state *FanOutState) (*ApprovalRequest, error) {
+	if _, err := fe.approvals.RequestApproval(request); err != nil {
+		return nil, err
+	}
+	fe.logger.Info("Waiting for approval",
+		"fan_out_id", state.ID,
+		"run_id", request.RunID,
+		"gate", request.Gate,
+	)
+	if fe.debug {
+		fmt.Printf("Waiting for approval: tako approve %s --step %s\n", request.RunID, request.Gate)
+	}
+
+	decision, err := fe.approvals.Wait(ctx, request.RunID, request.Gate)
+	if err != nil {
+		return nil, fmt.Errorf("approval %s was not decided: %w", request.Gate, err)
+	}
+	fe.recordAudit(AuditEntry{
+		FanOutID:   state.ID,
+		Decision:   AuditApprovalDecided,
+		Repository: decision.Repository,
+		Workflow:   decision.Workflow,
+		Reason:     describeApproval(decision),
+		Details:    map[string]string{"gate": decision.Gate, "status": string(decision.Status), "decided_by": decision.DecidedBy},
+	})
+	return decision, nil
+}
@@ -0,0 +1,240 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/git"
+)
+
+// Payload fields in which fan-outs tell subscribers what changed in the emitting repository.
+const (
+	PayloadChangedPaths   = "changed_paths"
+	PayloadArtifactDigest = "artifact_digest"
+)
+
+// parseChangedPaths parses the changed_paths of a fan-out: a list of slash-separated paths
+// relative to the emitting repository.
+func parseChangedPaths(value interface{}) ([]string, error) {
+	var items []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		items = v
+	case []string:
+		for _, item := range v {
+			items = append(items, item)
+		}
+	default:
+		return nil, fmt.Errorf("changed_paths must be a list of paths")
+	}
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		changedPath, ok := item.(string)
+		if !ok || changedPath == "" {
+			return nil, fmt.Errorf("changed_paths must be a list of paths")
+		}
+		paths = append(paths, filepath.ToSlash(changedPath))
+	}
+	return paths, nil
+}
+
+// parsePublishedArtifacts parses the artifacts of a fan-out: a map of artifact names to their
+// digest and reference.
+func parsePublishedArtifacts(value interface{}) (map[string]PublishedArtifact, error) {
+	items, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("artifacts must be a map of artifact names to their digest and reference")
+	}
+	artifacts := make(map[string]PublishedArtifact, len(items))
+	for name, item := range items {
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("artifact '%s' must have a digest and a reference", name)
+		}
+		digest, _ := fields["digest"].(string)
+		reference, _ := fields["reference"].(string)
+		if digest == "" || reference == "" || len(fields) != 2 {
+			return nil, fmt.Errorf("artifact '%s' must have a digest and a reference", name)
+		}
+		artifacts[name] = PublishedArtifact{Digest: digest, Reference: reference}
+	}
+	return artifacts, nil
+}
+
+// addChanges adds the changed paths, artifact digest and published artifacts of the fan-out,
+// when set, to the payload of each of its events.
+func (params *FanOutParams) addChanges() {
+	if params.ChangedPaths == nil && params.ArtifactDigest == "" && params.Artifacts == nil {
+		return
+	}
+	withChanges := func(payload map[string]interface{}) map[string]interface{} {
+		changed := make(map[string]interface{}, len(payload)+3)
+		for key, value := range payload {
+			changed[key] = value
+		}
+		if params.ChangedPaths != nil {
+			changedPaths := make([]interface{}, len(params.ChangedPaths))
+			for i, changedPath := range params.ChangedPaths {
+				changedPaths[i] = changedPath
+			}
+			changed[PayloadChangedPaths] = changedPaths
+		}
+		if params.ArtifactDigest != "" {
+			changed[PayloadArtifactDigest] = params.ArtifactDigest
+		}
+		if params.Artifacts != nil {
+			artifacts := make(map[string]interface{}, len(params.Artifacts))
+			for name, published := range params.Artifacts {
+				artifacts[name] = map[string]interface{}{"digest": published.Digest, "reference": published.Reference}
+			}
+			changed[PayloadArtifacts] = artifacts
+		}
+		return changed
+	}
+	params.Payload = withChanges(params.Payload)
+	for i := range params.Events {
+		params.Events[i].Payload = withChanges(params.Events[i].Payload)
+	}
+}
+
+// ArtifactDigestStore remembers the artifact digest of the last event each subscription's
+// workflow completed for, so that subscriptions can skip the events that did not change the
+// artifact. Entries are files in the cache so that concurrent tako processes share them.
+type ArtifactDigestStore struct {
+	dir string
+}
+
+// NewArtifactDigestStore creates an artifact digest store in the cache directory.
+func NewArtifactDigestStore(cacheDir string) (*ArtifactDigestStore, error) {
+	dir := filepath.Join(cacheDir, "digests")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create digest directory: %v", err)
+	}
+	return &ArtifactDigestStore{dir: dir}, nil
+}
+
+// Last returns the digest last recorded under key, or an empty string when there is none.
+func (s *ArtifactDigestStore) Last(key string) string {
+	data, err := os.ReadFile(filepath.Join(s.dir, key))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// Record records the digest under key, replacing the previous one.
+func (s *ArtifactDigestStore) Record(key, digest string) error {
+	tmp, err := os.CreateTemp(s.dir, ".digest-*")
+	if err != nil {
+		return fmt.Errorf("failed to create digest entry: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(digest)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write digest entry: %v", err)
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, key))
+}
+
+// artifactDigestKey returns the key of the digests of the events of a type from a source
+// delivered to a subscriber.
+func artifactDigestKey(subscriber SubscriptionMatch, event Event) string {
+	key := sha256.Sum256([]byte(subscriber.Repository + ":" + subscriber.Subscription.Workflow + "\x00" + event.Source + "\x00" + event.Type))
+	return hex.EncodeToString(key[:])
+}
+
+// SetChangedSince limits the subscribers the fan-outs trigger to those whose repository changed
+// since a git ref, including the changes not committed yet and the untracked files; all of them
+// when the ref is empty. tako exec --since sets it when the repository of the run did not change.
+func (fe *FanOutExecutor) SetChangedSince(ref string) {
+	fe.changedSince = ref
+}
+
+// subscriberChanged reports whether the repository of a subscriber changed since the
+// changedSince ref. Repositories that cannot be diffed against it, such as those without a
+// checkout or without the ref, are considered changed.
+func (fe *FanOutExecutor) subscriberChanged(subscriber SubscriptionMatch) bool {
+	if subscriber.RepoPath == "" {
+		return true
+	}
+	if changed, ok := fe.changedRepos.Load(subscriber.RepoPath); ok {
+		return changed.(bool)
+	}
+	files, err := git.ChangedFiles(subscriber.RepoPath, fe.changedSince)
+	if err != nil {
+		fe.logger.Warn("Failed to diff subscriber, considering it changed",
+			"repository", subscriber.Repository,
+			"since", fe.changedSince,
+			"error", err.Error(),
+		)
+	}
+	changed := err != nil || len(files) > 0
+	fe.changedRepos.Store(subscriber.RepoPath, changed)
+	return changed
+}
+
+// unchangedReason returns why an event leaves a subscription unchanged: its repository did not
+// change since the changedSince ref, none of its changed paths matches the paths of the
+// subscription, or its artifact digest is the one the subscription's workflow last completed
+// for. It returns an empty string when the subscription is affected by the event, including when
+// the event does not tell what changed.
+func (fe *FanOutExecutor) unchangedReason(subscriber SubscriptionMatch, event Event) string {
+	if fe.changedSince != "" && !fe.subscriberChanged(subscriber) {
+		return fmt.Sprintf("repository did not change since %s", fe.changedSince)
+	}
+	subscription := subscriber.Subscription
+	if len(subscription.Paths) > 0 {
+		if value, ok := event.Payload[PayloadChangedPaths]; ok {
+			if changedPaths, err := parseChangedPaths(value); err == nil && !matchesChangedPaths(subscription, changedPaths) {
+				return fmt.Sprintf("none of the %d changed paths matches the paths of the subscription", len(changedPaths))
+			}
+		}
+	}
+	if subscription.SkipUnchanged && fe.digests != nil {
+		if digest, ok := event.Payload[PayloadArtifactDigest].(string); ok && digest != "" && fe.digests.Last(artifactDigestKey(subscriber, event)) == digest {
+			return fmt.Sprintf("artifact digest %s is unchanged since the last run of the subscription", digest)
+		}
+	}
+	return ""
+}
+
+// matchesChangedPaths reports whether one of the changed paths matches the paths of a
+// subscription.
+func matchesChangedPaths(subscription config.Subscription, changedPaths []string) bool {
+	for _, pattern := range subscription.Paths {
+		matcher := globPattern(pattern)
+		for _, changedPath := range changedPaths {
+			if matcher.MatchString(changedPath) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recordArtifactDigest records the artifact digest of an event once a subscriber's workflow
+// completed for it, when its subscription skips unchanged artifacts.
+func (fe *FanOutExecutor) recordArtifactDigest(subscriber SubscriptionMatch, event Event) {
+	if !subscriber.Subscription.SkipUnchanged || fe.digests == nil {
+		return
+	}
+	digest, ok := event.Payload[PayloadArtifactDigest].(string)
+	if !ok || digest == "" {
+		return
+	}
+	if err := fe.digests.Record(artifactDigestKey(subscriber, event), digest); err != nil {
+		fe.logger.Warn("Failed to record artifact digest",
+			"repository", subscriber.Repository,
+			"workflow", subscriber.Subscription.Workflow,
+			"error", err,
+		)
+	}
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestFanOutExecutor_parseFanOutParamsChanges(t *testing.T) {
+	executor := &FanOutExecutor{}
+
+	params, err := executor.parseFanOutParams(map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"event_type": "library_built", "payload": map[string]interface{}{"version": "1.0.0"}},
+			map[string]interface{}{"event_type": "docs_built"},
+		},
+		"changed_paths":   []interface{}{"src/main.go", "docs/index.md"},
+		"artifact_digest": "abc123",
+	})
+	if err != nil {
+		t.Fatalf("parseFanOutParams() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"version":             "1.0.0",
+		PayloadChangedPaths:   []interface{}{"src/main.go", "docs/index.md"},
+		PayloadArtifactDigest: "abc123",
+	}
+	if !reflect.DeepEqual(params.Events[0].Payload, want) {
+		t.Errorf("expected the changes in the payload, got %v", params.Events[0].Payload)
+	}
+	if params.Events[1].Payload[PayloadArtifactDigest] != "abc123" {
+		t.Errorf("expected the changes in the payload of every event, got %v", params.Events[1].Payload)
+	}
+
+	if _, err := executor.parseFanOutParams(map[string]interface{}{
+		"event_type":    "library_built",
+		"changed_paths": "src/main.go",
+	}); err == nil || !strings.Contains(err.Error(), "changed_paths must be a list of paths") {
+		t.Errorf("expected an invalid changed_paths error, got %v", err)
+	}
+}
+
+func TestFanOutExecutor_SkipsUnchangedSubscribers(t *testing.T) {
+	runner := &orderRecordingWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	subscriptions := rolloutSubscriptions(3)
+	subscriptions[0].Subscription.Paths = []string{"docs/**"}
+	subscriptions[1].Subscription.Paths = []string{"src/**/*.go"}
+	subscriptions[2].Subscription.SkipUnchanged = true
+	fanOut := func(changedPaths []interface{}) *FanOutResult {
+		t.Helper()
+		step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+			"event_type":        "library_built",
+			"changed_paths":     changedPaths,
+			"artifact_digest":   "abc123",
+			"wait_for_children": true,
+		}}
+		result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+		if err != nil || !result.Success {
+			t.Fatalf("ExecuteWithSubscriptions() = %+v, %v", result, err)
+		}
+		return result
+	}
+
+	// Subscriptions whose paths did not change are skipped without failing the fan-out
+	result := fanOut([]interface{}{"src/pkg/lib.go"})
+	if result.TriggeredCount != 2 || result.Unchanged != 1 {
+		t.Errorf("expected 2 triggered and 1 unchanged subscribers, got %d and %d", result.TriggeredCount, result.Unchanged)
+	}
+	if result.ChildrenSummary.SkippedChildren != 1 || result.ChildrenSummary.UnchangedChildren != 1 {
+		t.Errorf("expected the unchanged child in the summary, got %+v", result.ChildrenSummary)
+	}
+	for _, child := range result.Children {
+		if child.Repository == "test-org/repo-1" && (child.Status != ChildStatusSkipped || child.SkipReason != ChildSkipUnchanged) {
+			t.Errorf("expected repo-1 to be skipped as unchanged, got %+v", child)
+		}
+	}
+
+	// The digest the subscription last completed for is skipped
+	result = fanOut([]interface{}{"src/pkg/lib.go"})
+	if result.TriggeredCount != 1 || result.Unchanged != 2 {
+		t.Errorf("expected 1 triggered and 2 unchanged subscribers, got %d and %d", result.TriggeredCount, result.Unchanged)
+	}
+}
+
+func TestFanOutExecutor_SkipsSubscribersUnchangedSince(t *testing.T) {
+	runner := &orderRecordingWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetChangedSince("HEAD")
+
+	subscriptions := rolloutSubscriptions(3)
+	for i := range subscriptions[:2] {
+		repo := t.TempDir()
+		gitForTest(t, repo, "init", "-q")
+		gitForTest(t, repo, "commit", "-q", "--allow-empty", "-m", "initial commit")
+		subscriptions[i].RepoPath = repo
+	}
+	// repo-1 has an untracked file, repo-2 did not change, and repo-3 has no checkout to diff
+	if err := os.WriteFile(filepath.Join(subscriptions[0].RepoPath, "new.go"), []byte("package lib"), 0644); err != nil {
+		t.Fatalf("failed to write new.go: %v", err)
+	}
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil || !result.Success {
+		t.Fatalf("ExecuteWithSubscriptions() = %+v, %v", result, err)
+	}
+	if result.TriggeredCount != 2 || result.Unchanged != 1 {
+		t.Errorf("expected 2 triggered and 1 unchanged subscribers, got %d and %d", result.TriggeredCount, result.Unchanged)
+	}
+	for _, child := range result.Children {
+		if child.Repository == "test-org/repo-2" && (child.Status != ChildStatusSkipped || child.SkipReason != ChildSkipUnchanged || !strings.Contains(child.ErrorMessage, "did not change since HEAD")) {
+			t.Errorf("expected repo-2 to be skipped as unchanged since HEAD, got %+v", child)
+		}
+	}
+}
+
+func TestRunner_FanOutsOfChangedRepositoriesAreNotLimited(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		ChangedSince:  "HEAD",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	repo := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	gitForTest(t, repo, "init", "-q")
+	gitForTest(t, repo, "commit", "-q", "--allow-empty", "-m", "initial commit")
+	if got := runner.resolveFanOutSince(context.Background(), repo); got != "HEAD" {
+		t.Errorf("expected the fan-outs of an unchanged repository to be limited to the changes since HEAD, got %q", got)
+	}
+	if err := os.WriteFile(filepath.Join(repo, "new.go"), []byte("package lib"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := runner.resolveFanOutSince(context.Background(), repo); got != "" {
+		t.Errorf("expected the fan-outs of a changed repository to trigger all subscribers, got %q", got)
+	}
+
+	if _, err := NewRunner(RunnerOptions{WorkspaceRoot: filepath.Join(tempDir, "other"), CacheDir: filepath.Join(tempDir, "cache"), ChangedSince: "--output=diff"}); err == nil {
+		t.Error("expected a ref starting with '-' to be rejected")
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DedupStore remembers the events recently delivered to subscriptions with a dedup window.
+// Unlike idempotency, which records the whole fan-out for 24 hours, an entry only records when
+// its window ends. Entries are files in the cache so that concurrent tako processes share them.
+type DedupStore struct {
+	dir string
+}
+
+// NewDedupStore creates a dedup store in the cache directory.
+func NewDedupStore(cacheDir string) (*DedupStore, error) {
+	dir := filepath.Join(cacheDir, "dedup")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create dedup directory: %v", err)
+	}
+	return &DedupStore{dir: dir}, nil
+}
+
+// dedupStaleLock is the age at which the takeover lock of an entry left by a crashed process
+// is broken.
+const dedupStaleLock = 30 * time.Second
+
+// Claim records a delivery of key at now, suppressing the deliveries of the same key for the
+// window. It reports false when the key was already claimed within its window, or when another
+// process is claiming it at the same time.
+func (s *DedupStore) Claim(key string, window time.Duration, now time.Time) (bool, error) {
+	path := filepath.Join(s.dir, key)
+
+	// The entry is written aside and linked into place, so that concurrent claims never read
+	// a partially written entry and only one of them creates it
+	tmp, err := os.CreateTemp(s.dir, ".claim-*")
+	if err != nil {
+		return false, fmt.Errorf("failed to create dedup entry: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.WriteString(now.Add(window).UTC().Format(time.RFC3339Nano))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to write dedup entry: %v", err)
+	}
+
+	err = os.Link(tmp.Name(), path)
+	if err == nil {
+		s.prune(now)
+		return true, nil
+	}
+	if !os.IsExist(err) {
+		return false, fmt.Errorf("failed to record dedup entry: %v", err)
+	}
+	if s.Delivered(key, now) {
+		return false, nil
+	}
+
+	// The previous window is over. Takeovers are serialized, so that of the processes finding
+	// the same expired entry, only one replaces it.
+	unlock, locked, err := s.lockEntry(key, now)
+	if err != nil || !locked {
+		return false, err
+	}
+	defer unlock()
+	if s.Delivered(key, now) {
+		return false, nil
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return false, fmt.Errorf("failed to record dedup entry: %v", err)
+	}
+	return true, nil
+}
+
+// Delivered reports whether key was claimed within a window that is not over by now.
+func (s *DedupStore) Delivered(key string, now time.Time) bool {
+	expiry, ok := s.expiry(filepath.Join(s.dir, key))
+	return ok && now.Before(expiry)
+}
+
+// lockEntry takes the lock serializing the takeovers and removals of the entry of key. It
+// reports false when another process holds the lock; the lock of a crashed process is broken
+// once it is stale, for a later claim to take.
+func (s *DedupStore) lockEntry(key string, now time.Time) (func(), bool, error) {
+	lockFile := filepath.Join(s.dir, "."+key+".lock")
+	lock, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		if info, statErr := os.Stat(lockFile); statErr == nil && now.Sub(info.ModTime()) > dedupStaleLock {
+			os.Remove(lockFile)
+		}
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock dedup entry: %v", err)
+	}
+	lock.Close()
+	return func() { os.Remove(lockFile) }, true, nil
+}
+
+// expiry returns the end of the window of an entry.
+func (s *DedupStore) expiry(path string) (time.Time, bool) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	expiry, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(data)))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return expiry, true
+}
+
+// prune removes the entries whose window is over, under the lock of their takeovers so that
+// an entry taken over meanwhile is kept.
+func (s *DedupStore) prune(now time.Time) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		key := entry.Name()
+		if strings.HasPrefix(key, ".") || s.Delivered(key, now) {
+			continue
+		}
+		unlock, locked, err := s.lockEntry(key, now)
+		if err != nil || !locked {
+			continue
+		}
+		if expiry, ok := s.expiry(filepath.Join(s.dir, key)); ok && !now.Before(expiry) {
+			os.Remove(filepath.Join(s.dir, key))
+		}
+		unlock()
+	}
+}
+
+// dedupKey returns the key of the deliveries of an event to a subscriber and the dedup window
+// of the subscriber; zero for subscribers without one. Identical events have the same type,
+// source and payload, whatever their event IDs.
+func dedupKey(subscriber SubscriptionMatch, event Event) (string, time.Duration, error) {
+	if subscriber.Subscription.DedupWindow == "" {
+		return "", 0, nil
+	}
+	window, err := time.ParseDuration(subscriber.Subscription.DedupWindow)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid dedup_window '%s': %v", subscriber.Subscription.DedupWindow, err)
+	}
+
+	eventHash, err := generateEventHash(event.Type, event.Source, event.Payload)
+	if err != nil {
+		return "", 0, err
+	}
+	key := sha256.Sum256([]byte(subscriber.Repository + ":" + subscriber.Subscription.Workflow + "\x00" + eventHash))
+	return hex.EncodeToString(key[:]), window, nil
+}
+
+// deliveredWithinWindow reports whether an event identical to event was delivered to a
+// subscription with a dedup window within that window. It does not claim the delivery, which
+// is only claimed by claimDelivery once the child is triggered.
+func (fe *FanOutExecutor) deliveredWithinWindow(subscriber SubscriptionMatch, event Event, now time.Time) (bool, error) {
+	key, window, err := dedupKey(subscriber, event)
+	if err != nil || window == 0 {
+		return false, err
+	}
+	return fe.dedup.Delivered(key, now), nil
+}
+
+// claimDelivery reports whether an event is delivered to a subscriber. Subscriptions with a
+// dedup window drop the events identical to one delivered to them within the window.
+func (fe *FanOutExecutor) claimDelivery(subscriber SubscriptionMatch, event Event, now time.Time) (bool, error) {
+	key, window, err := dedupKey(subscriber, event)
+	if err != nil {
+		return false, err
+	}
+	if window == 0 {
+		return true, nil
+	}
+	return fe.dedup.Claim(key, window, now)
+}
@@ -0,0 +1,130 @@
+package engine
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestDedupStore_Claim(t *testing.T) {
+	store, err := NewDedupStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create dedup store: %v", err)
+	}
+	now := time.Now()
+
+	if claimed, err := store.Claim("event", time.Minute, now); err != nil || !claimed {
+		t.Fatalf("Expected first delivery to be claimed, got %v, %v", claimed, err)
+	}
+	if claimed, err := store.Claim("event", time.Minute, now.Add(30*time.Second)); err != nil || claimed {
+		t.Errorf("Expected delivery within the window to be dropped, got %v, %v", claimed, err)
+	}
+	if claimed, err := store.Claim("other", time.Minute, now.Add(30*time.Second)); err != nil || !claimed {
+		t.Errorf("Expected other event to be claimed, got %v, %v", claimed, err)
+	}
+	if claimed, err := store.Claim("event", time.Minute, now.Add(2*time.Minute)); err != nil || !claimed {
+		t.Errorf("Expected delivery after the window to be claimed, got %v, %v", claimed, err)
+	}
+}
+
+func TestDedupStore_ConcurrentClaims(t *testing.T) {
+	store, err := NewDedupStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create dedup store: %v", err)
+	}
+	now := time.Now()
+
+	// Of the claims of a new event, and then of the takeovers of its expired entry, only one wins
+	for _, at := range []time.Time{now, now.Add(2 * time.Minute)} {
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		claims := 0
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := store.Claim("event", time.Minute, at)
+				if err != nil {
+					t.Errorf("Claim() error = %v", err)
+				}
+				if claimed {
+					mu.Lock()
+					claims++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if claims != 1 {
+			t.Errorf("Expected exactly one of the concurrent claims at %v to win, got %d", at.Sub(now), claims)
+		}
+		if !store.Delivered("event", at) {
+			t.Errorf("Expected the winning claim to be recorded")
+		}
+	}
+}
+
+func TestFanOutExecutor_DedupWindow(t *testing.T) {
+	runner := &failingRepoWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	subscriptions := rolloutSubscriptions(2)
+	subscriptions[0].Subscription.DedupWindow = "5m"
+
+	fanOut := func(version string) *FanOutResult {
+		t.Helper()
+		step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+			"event_type":        "library_built",
+			"wait_for_children": true,
+			"payload":           map[string]interface{}{"version": version},
+		}}
+		result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+		if err != nil || !result.Success {
+			t.Fatalf("Fan-out failed: %v %v", err, result.Errors)
+		}
+		return result
+	}
+
+	if result := fanOut("1.0.0"); result.TriggeredCount != 2 || result.Deduplicated != 0 {
+		t.Errorf("Expected both subscribers to be triggered, got %d triggered and %d deduplicated", result.TriggeredCount, result.Deduplicated)
+	}
+
+	// The duplicate only reaches the subscription without a dedup window
+	if result := fanOut("1.0.0"); result.TriggeredCount != 1 || result.Deduplicated != 1 {
+		t.Errorf("Expected the duplicate to be dropped once, got %d triggered and %d deduplicated", result.TriggeredCount, result.Deduplicated)
+	}
+
+	if result := fanOut("1.0.1"); result.TriggeredCount != 2 || result.Deduplicated != 0 {
+		t.Errorf("Expected a different event to reach both subscribers, got %d triggered and %d deduplicated", result.TriggeredCount, result.Deduplicated)
+	}
+}
+
+func TestFanOutExecutor_DedupWindowClaimedOnTrigger(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &failingRepoWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	subscriptions := rolloutSubscriptions(1)
+	subscriptions[0].Subscription.DedupWindow = "5m"
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"payload":           map[string]interface{}{"version": "1.0.0"},
+	}}
+
+	// A fan-out stopped before triggering its children does not use their dedup window up
+	executor.SetLineage([]string{lineageNode(subscriptions[0].Repository, subscriptions[0].Subscription.Workflow)}, 0)
+	if _, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions); err == nil {
+		t.Fatalf("Expected the fan-out to be stopped by the event cycle")
+	}
+	executor.SetLineage(nil, 0)
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil || result.TriggeredCount != 1 || result.Deduplicated != 0 {
+		t.Errorf("Expected the retried event to be delivered, got %d triggered and %d deduplicated, %v", result.TriggeredCount, result.Deduplicated, err)
+	}
+}
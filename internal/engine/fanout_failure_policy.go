@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Failure policies of fan-outs.
+const (
+	// FailurePolicyContinue runs every child and fails the fan-out if any of them fails.
+	FailurePolicyContinue = "continue"
+	// FailurePolicyFailFast cancels the remaining children as soon as one fails.
+	FailurePolicyFailFast = "fail-fast"
+	// FailurePolicyThreshold runs every child and fails the fan-out only if more than a
+	// percentage of them fail.
+	FailurePolicyThreshold = "threshold"
+)
+
+// errFailFast is the cause of the contexts of children cancelled by the fail-fast policy.
+var errFailFast = errors.New("cancelled by the fail-fast failure policy")
+
+// FailurePolicy decides how the failures of children affect a fan-out. Failed and timed out
+// children count as failures.
+type FailurePolicy struct {
+	Mode string `yaml:"mode"`
+	// Threshold is the percentage of children allowed to fail under the threshold mode.
+	Threshold float64 `yaml:"threshold,omitempty"`
+}
+
+// parseFailurePolicy parses the failure_policy parameter of a fan-out step: a mode, or a map
+// with a mode and, for the threshold mode, a threshold such as "20%" or 20.
+func parseFailurePolicy(value interface{}) (*FailurePolicy, error) {
+	policy := &FailurePolicy{}
+	switch v := value.(type) {
+	case string:
+		if v == FailurePolicyThreshold {
+			return nil, fmt.Errorf("failure_policy.threshold is required by the threshold mode")
+		}
+		policy.Mode = v
+	case map[string]interface{}:
+		mode, ok := v["mode"].(string)
+		if !ok {
+			return nil, fmt.Errorf("failure_policy.mode must be a string")
+		}
+		policy.Mode = mode
+		if threshold, ok := v["threshold"]; ok {
+			percent, err := parseFailureThreshold(threshold)
+			if err != nil {
+				return nil, err
+			}
+			policy.Threshold = percent
+		} else if mode == FailurePolicyThreshold {
+			return nil, fmt.Errorf("failure_policy.threshold is required by the threshold mode")
+		}
+	default:
+		return nil, fmt.Errorf("failure_policy must be a string or a map")
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// parseFailureThreshold parses a percentage given as "20%", "20" or a number.
+func parseFailureThreshold(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(v), "%"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid failure_policy.threshold '%s': must be a percentage", v)
+		}
+		return percent, nil
+	default:
+		return 0, fmt.Errorf("failure_policy.threshold must be a percentage, got %v", value)
+	}
+}
+
+// Validate checks the mode and the threshold.
+func (p *FailurePolicy) Validate() error {
+	switch p.Mode {
+	case FailurePolicyContinue, FailurePolicyFailFast:
+		if p.Threshold != 0 {
+			return fmt.Errorf("failure_policy.threshold is only supported by the threshold mode")
+		}
+	case FailurePolicyThreshold:
+		if p.Threshold < 0 || p.Threshold > 100 {
+			return fmt.Errorf("failure_policy.threshold must be between 0%% and 100%%, got %g%%", p.Threshold)
+		}
+	default:
+		return fmt.Errorf("invalid failure_policy '%s': must be %s, %s or %s", p.Mode, FailurePolicyContinue, FailurePolicyFailFast, FailurePolicyThreshold)
+	}
+	return nil
+}
+
+// failFast reports whether the first failure cancels the remaining children. A nil policy is
+// the continue mode.
+func (p *FailurePolicy) failFast() bool {
+	return p != nil && p.Mode == FailurePolicyFailFast
+}
+
+// tolerates reports whether the fan-out succeeds despite failed of its total children failing.
+func (p *FailurePolicy) tolerates(failed, total int) bool {
+	if failed == 0 {
+		return true
+	}
+	if p == nil || p.Mode != FailurePolicyThreshold || total == 0 {
+		return false
+	}
+	return float64(failed)*100 <= p.Threshold*float64(total)
+}
@@ -0,0 +1,223 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// blockingWorkflowRunner fails the children in failRepos once the other running children were
+// started, and keeps those running until they are cancelled.
+type blockingWorkflowRunner struct {
+	failRepos map[string]bool
+	running   sync.WaitGroup
+}
+
+func (r *blockingWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	if r.failRepos[repoPath] {
+		// Fail only once the other children of the first batch are running
+		r.running.Wait()
+		return &interfaces.ExecutionResult{Success: false, StartTime: time.Now(), EndTime: time.Now()}, nil
+	}
+	r.running.Done()
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestParseFailurePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    FailurePolicy
+		wantErr string
+	}{
+		{name: "fail-fast", value: "fail-fast", want: FailurePolicy{Mode: FailurePolicyFailFast}},
+		{name: "continue", value: "continue", want: FailurePolicy{Mode: FailurePolicyContinue}},
+		{name: "threshold percentage", value: map[string]interface{}{"mode": "threshold", "threshold": "25%"}, want: FailurePolicy{Mode: FailurePolicyThreshold, Threshold: 25}},
+		{name: "threshold number", value: map[string]interface{}{"mode": "threshold", "threshold": 10}, want: FailurePolicy{Mode: FailurePolicyThreshold, Threshold: 10}},
+		{name: "unknown mode", value: "retry", wantErr: "invalid failure_policy 'retry'"},
+		{name: "threshold without value", value: "threshold", wantErr: "failure_policy.threshold is required"},
+		{name: "threshold missing from map", value: map[string]interface{}{"mode": "threshold"}, wantErr: "failure_policy.threshold is required"},
+		{name: "threshold out of range", value: map[string]interface{}{"mode": "threshold", "threshold": "150%"}, wantErr: "must be between 0% and 100%"},
+		{name: "threshold on other mode", value: map[string]interface{}{"mode": "fail-fast", "threshold": 10}, wantErr: "only supported by the threshold mode"},
+		{name: "invalid type", value: 3, wantErr: "failure_policy must be a string or a map"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := parseFailurePolicy(tt.value)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFailurePolicy() error = %v", err)
+			}
+			if *policy != tt.want {
+				t.Errorf("Expected %+v, got %+v", tt.want, *policy)
+			}
+		})
+	}
+}
+
+func TestFailurePolicy_Tolerates(t *testing.T) {
+	threshold := &FailurePolicy{Mode: FailurePolicyThreshold, Threshold: 25}
+	var unset *FailurePolicy
+
+	if !unset.tolerates(0, 4) || unset.tolerates(1, 4) {
+		t.Errorf("Expected the default policy to fail on any failure")
+	}
+	if !threshold.tolerates(1, 4) {
+		t.Errorf("Expected 25%% of failures to be tolerated")
+	}
+	if threshold.tolerates(2, 4) {
+		t.Errorf("Expected 50%% of failures not to be tolerated")
+	}
+}
+
+func TestFanOutExecutor_FailurePolicy(t *testing.T) {
+	tests := []struct {
+		name            string
+		policy          interface{}
+		failRepos       map[string]bool
+		expectedRun     int
+		expectCancelled int
+		expectStatus    FanOutStatus
+		expectTolerated int
+		expectedError   string
+	}{
+		{
+			name:          "default fails after running every child",
+			failRepos:     map[string]bool{"test-org/repo-1": true},
+			expectedRun:   4,
+			expectStatus:  FanOutStatusFailed,
+			expectedError: "workflow failed in test-org/repo-1",
+		},
+		{
+			name:          "continue fails after running every child",
+			policy:        "continue",
+			failRepos:     map[string]bool{"test-org/repo-2": true},
+			expectedRun:   4,
+			expectStatus:  FanOutStatusFailed,
+			expectedError: "workflow failed in test-org/repo-2",
+		},
+		{
+			name:            "fail-fast cancels the remaining children",
+			policy:          "fail-fast",
+			failRepos:       map[string]bool{"test-org/repo-1": true},
+			expectedRun:     1,
+			expectCancelled: 3,
+			expectStatus:    FanOutStatusFailed,
+			expectedError:   "fail-fast: 3 children were not started",
+		},
+		{
+			name:            "threshold tolerates failures",
+			policy:          map[string]interface{}{"mode": "threshold", "threshold": "25%"},
+			failRepos:       map[string]bool{"test-org/repo-3": true},
+			expectedRun:     4,
+			expectStatus:    FanOutStatusCompleted,
+			expectTolerated: 1,
+		},
+		{
+			name:          "threshold exceeded",
+			policy:        map[string]interface{}{"mode": "threshold", "threshold": "25%"},
+			failRepos:     map[string]bool{"test-org/repo-1": true, "test-org/repo-4": true},
+			expectedRun:   4,
+			expectStatus:  FanOutStatusFailed,
+			expectedError: "failure threshold exceeded: 2 of 4 children failed, more than 25%",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &failingRepoWorkflowRunner{failRepos: tt.failRepos}
+			executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+			if err != nil {
+				t.Fatalf("Failed to create executor: %v", err)
+			}
+
+			with := map[string]interface{}{
+				"event_type":        "library_built",
+				"wait_for_children": true,
+				"concurrency_limit": 1,
+			}
+			if tt.policy != nil {
+				with["failure_policy"] = tt.policy
+			}
+			step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: with}
+
+			result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(4))
+			if err != nil {
+				t.Fatalf("Fan-out failed: %v", err)
+			}
+
+			if len(runner.order) != tt.expectedRun {
+				t.Errorf("Expected %d children to run, got %d (%v)", tt.expectedRun, len(runner.order), runner.order)
+			}
+			summary := result.ChildrenSummary
+			if summary == nil || summary.CancelledChildren != tt.expectCancelled || summary.Status != tt.expectStatus {
+				t.Errorf("Expected status %s with %d cancelled children, got %+v", tt.expectStatus, tt.expectCancelled, summary)
+			}
+			if result.ToleratedFailures != tt.expectTolerated {
+				t.Errorf("Expected %d tolerated failures, got %d", tt.expectTolerated, result.ToleratedFailures)
+			}
+			if result.FailFastTriggered != (tt.policy == "fail-fast") {
+				t.Errorf("Unexpected FailFastTriggered %v", result.FailFastTriggered)
+			}
+
+			if tt.expectedError == "" {
+				if !result.Success {
+					t.Errorf("Expected fan-out to succeed, got errors: %v", result.Errors)
+				}
+				return
+			}
+			if result.Success {
+				t.Fatalf("Expected fan-out to fail")
+			}
+			if !strings.Contains(strings.Join(result.Errors, "\n"), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedError, result.Errors)
+			}
+		})
+	}
+}
+
+func TestFanOutExecutor_FailFastConcurrentChildren(t *testing.T) {
+	const concurrency = 16
+	runner := &blockingWorkflowRunner{failRepos: map[string]bool{"test-org/repo-1": true}}
+	runner.running.Add(concurrency - 1)
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"concurrency_limit": concurrency,
+		"failure_policy":    "fail-fast",
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(24))
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+
+	// The running children are cancelled while the remaining ones are marked as not started
+	summary := result.ChildrenSummary
+	if summary == nil || summary.Status != FanOutStatusFailed || summary.CancelledChildren != 23 {
+		t.Errorf("Expected 23 cancelled children of a failed fan-out, got %+v", summary)
+	}
+	errors := strings.Join(result.Errors, "\n")
+	if !strings.Contains(errors, "fail-fast: 8 children were not started") {
+		t.Errorf("Expected the children not started to be reported, got %v", result.Errors)
+	}
+	if !result.FailFastTriggered {
+		t.Error("Expected fail-fast to be triggered")
+	}
+}
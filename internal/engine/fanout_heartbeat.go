@@ -0,0 +1,128 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultHeartbeatInterval is how often the process running a child records that it is
+	// still alive in the fan-out state.
+	DefaultHeartbeatInterval = 10 * time.Second
+
+	// heartbeatMisses is how many heartbeats a running child may miss before waiters
+	// consider it lost.
+	heartbeatMisses = 3
+)
+
+// SetHeartbeatInterval sets how often running children record their heartbeat.
+func (sm *FanOutStateManager) SetHeartbeatInterval(interval time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if interval > 0 {
+		sm.heartbeatInterval = interval
+	}
+}
+
+// getHeartbeatInterval returns how often running children record their heartbeat.
+func (sm *FanOutStateManager) getHeartbeatInterval() time.Duration {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.heartbeatInterval
+}
+
+// HeartbeatChild records that the process running a child is still alive, and renews the lease
+// of its claim on the child.
+func (state *FanOutState) HeartbeatChild(repository, workflow string) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	state.loadDetails()
+	child, exists := state.Children[childID]
+	if !exists || child.Status != ChildStatusRunning {
+		state.mu.Unlock()
+		return nil
+	}
+	now := state.stateManager.now()
+	child.LastHeartbeat = &now
+	inputs := child.Inputs
+	state.mu.Unlock()
+
+	if err := state.renewClaim(repository, workflow, inputs); err != nil {
+		return err
+	}
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// startHeartbeat records the heartbeat of a running child every heartbeat interval until the
+// returned function is called.
+func (state *FanOutState) startHeartbeat(repository, workflow string, logger Logger) func() {
+	ticker := time.NewTicker(state.stateManager.getHeartbeatInterval())
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := state.HeartbeatChild(repository, workflow); err != nil {
+					logger.Warn("Failed to record child heartbeat",
+						"repository", repository,
+						"workflow", workflow,
+						"error", err.Error(),
+					)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(done)
+	}
+}
+
+// LostChildren returns the running children whose last heartbeat, or start when they recorded
+// none, is older than the given number of heartbeat intervals: the process running them died.
+func (state *FanOutState) LostChildren(now time.Time) []ChildWorkflow {
+	limit := heartbeatMisses * state.stateManager.getHeartbeatInterval()
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	state.loadDetails()
+
+	var lost []ChildWorkflow
+	for _, child := range state.Children {
+		if child.Status != ChildStatusRunning {
+			continue
+		}
+		last := child.StartTime
+		if child.LastHeartbeat != nil {
+			last = *child.LastHeartbeat
+		}
+		if now.Sub(last) > limit {
+			lost = append(lost, *child)
+		}
+	}
+	sort.Slice(lost, func(i, j int) bool {
+		return lost[i].Repository+"/"+lost[i].Workflow < lost[j].Repository+"/"+lost[j].Workflow
+	})
+	return lost
+}
+
+// failLostChildren fails the running children that stopped sending heartbeats, so that waiters
+// do not wait for them until the fan-out times out. It returns how many were failed.
+func (state *FanOutState) failLostChildren(now time.Time) int {
+	lost := state.LostChildren(now)
+	for _, child := range lost {
+		last := child.StartTime
+		if child.LastHeartbeat != nil {
+			last = *child.LastHeartbeat
+		}
+		state.UpdateChildStatus(child.Repository, child.Workflow, ChildStatusFailed, child.RunID,
+			fmt.Sprintf("child workflow lost: no heartbeat since %s", last.Format(time.RFC3339)))
+	}
+	return len(lost)
+}
@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// slowWorkflowRunner runs every workflow for a fixed duration.
+type slowWorkflowRunner struct {
+	duration time.Duration
+}
+
+func (r *slowWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	start := time.Now()
+	time.Sleep(r.duration)
+	return &interfaces.ExecutionResult{Success: true, StartTime: start, EndTime: time.Now()}, nil
+}
+
+func TestFanOutState_LostChildren(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	manager.SetHeartbeatInterval(time.Second)
+	state, err := manager.CreateFanOutState("fanout-heartbeat", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	state.AddChildWorkflow("org/alive", "build", nil)
+	state.AddChildWorkflow("org/lost", "build", nil)
+	state.AddChildWorkflow("org/pending", "build", nil)
+	state.UpdateChildStatus("org/alive", "build", ChildStatusRunning, "", "")
+	state.UpdateChildStatus("org/lost", "build", ChildStatusRunning, "", "")
+	state.StartWaiting()
+
+	// The heartbeats of org/alive keep it alive
+	later := time.Now().Add(heartbeatMisses*time.Second + time.Second)
+	state.mu.Lock()
+	state.Children["org/alive-build"].LastHeartbeat = &later
+	state.mu.Unlock()
+	if err := state.HeartbeatChild("org/pending", "build"); err != nil {
+		t.Fatalf("HeartbeatChild failed: %v", err)
+	}
+	if state.Children["org/pending-build"].LastHeartbeat != nil {
+		t.Errorf("expected no heartbeat for a child that is not running")
+	}
+
+	lost := state.LostChildren(later)
+	if len(lost) != 1 || lost[0].Repository != "org/lost" {
+		t.Fatalf("expected only org/lost to be lost, got %+v", lost)
+	}
+	if failed := state.failLostChildren(later); failed != 1 {
+		t.Errorf("expected 1 child failed, got %d", failed)
+	}
+	if status := state.GetChildStatus("org/lost", "build"); status != ChildStatusFailed {
+		t.Errorf("expected the lost child failed, got %s", status)
+	}
+	if message := state.Children["org/lost-build"].ErrorMessage; !strings.Contains(message, "child workflow lost") {
+		t.Errorf("expected the loss to be reported, got %q", message)
+	}
+}
+
+func TestFanOutStateManager_WaitFailsLostChildren(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	manager.SetHeartbeatInterval(10 * time.Millisecond)
+	state, err := manager.CreateFanOutState("fanout-zombie", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	state.AddChildWorkflow("org/zombie", "build", nil)
+	state.UpdateChildStatus("org/zombie", "build", ChildStatusRunning, "", "")
+	state.StartWaiting()
+
+	// Nothing records heartbeats for the child: the waiter gives up on it long before the timeout
+	started := time.Now()
+	if !manager.WaitForCompletion(state, time.Minute) {
+		t.Fatalf("expected the fan-out to complete")
+	}
+	if elapsed := time.Since(started); elapsed > 10*time.Second {
+		t.Errorf("expected the lost child detected from its heartbeats, waited %s", elapsed)
+	}
+	if state.Status != FanOutStatusFailed || state.GetChildStatus("org/zombie", "build") != ChildStatusFailed {
+		t.Errorf("expected the lost child to fail the fan-out, got %s", state.Status)
+	}
+}
+
+func TestFanOutExecutor_ChildHeartbeats(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &slowWorkflowRunner{duration: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.stateManager.SetHeartbeatInterval(10 * time.Millisecond)
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(1))
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if !result.Success || len(result.Children) != 1 {
+		t.Fatalf("expected a successful fan-out, got %+v", result)
+	}
+	child := result.Children[0]
+	if child.LastHeartbeat == nil || child.EndTime == nil || child.EndTime.Sub(*child.LastHeartbeat) > 100*time.Millisecond {
+		t.Errorf("expected heartbeats recorded until the child finished, got %v (ended %v)", child.LastHeartbeat, child.EndTime)
+	}
+}
@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// FanOutOptions configures the fan-outs of a run and of its child runs.
+type FanOutOptions struct {
+	// Retry configures the retries of the child workflows; DefaultRetryConfig when nil.
+	Retry *RetryConfig
+	// CircuitBreakers configures the circuit breakers, unless a config file watched by
+	// WatchCircuitBreakers configures them; DefaultCircuitBreakerConfig when nil.
+	CircuitBreakers *config.CircuitBreakersConfig
+	// Idempotency makes the fan-outs idempotent: a fan-out emitting the same event as an earlier
+	// one returns its result instead of triggering the subscribers again.
+	Idempotency bool
+	// IdempotencyRetention is how long the states of finished idempotent fan-outs prevent
+	// replays; DefaultIdempotencyRetention when 0.
+	IdempotencyRetention time.Duration
+	// StatePersistence configures how the fan-out states are written; the zero value writes the
+	// whole state on every update.
+	StatePersistence StatePersistence
+}
+
+// NewFanOutOptions returns the fan-out options of the user configuration.
+func NewFanOutOptions(cfg *config.UserConfig) (FanOutOptions, error) {
+	opts := FanOutOptions{CircuitBreakers: cfg.CircuitBreakers, Idempotency: cfg.Idempotency}
+	if cfg.Retry != nil {
+		retry, err := RetryConfigFromSettings(*cfg.Retry)
+		if err != nil {
+			return FanOutOptions{}, err
+		}
+		opts.Retry = &retry
+	}
+	if cfg.IdempotencyRetention != "" {
+		retention, err := time.ParseDuration(cfg.IdempotencyRetention)
+		if err != nil {
+			return FanOutOptions{}, fmt.Errorf("invalid idempotency_retention '%s': %v", cfg.IdempotencyRetention, err)
+		}
+		opts.IdempotencyRetention = retention
+	}
+	if cfg.StatePersistence != nil {
+		persistence, err := StatePersistenceFromSettings(*cfg.StatePersistence)
+		if err != nil {
+			return FanOutOptions{}, err
+		}
+		opts.StatePersistence = persistence
+	}
+	return opts, nil
+}
+
+// RetryConfigFromSettings returns DefaultRetryConfig with the settings that are set replacing
+// its fields.
+func RetryConfigFromSettings(settings config.RetrySettings) (RetryConfig, error) {
+	retry := DefaultRetryConfig()
+	if settings.MaxRetries != nil {
+		retry.MaxRetries = *settings.MaxRetries
+	}
+	if settings.BackoffFactor > 0 {
+		retry.BackoffFactor = settings.BackoffFactor
+	}
+	for _, delay := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"initial_delay", settings.InitialDelay, &retry.InitialDelay},
+		{"max_delay", settings.MaxDelay, &retry.MaxDelay},
+	} {
+		if delay.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(delay.value)
+		if err != nil {
+			return RetryConfig{}, fmt.Errorf("invalid %s '%s': %v", delay.name, delay.value, err)
+		}
+		*delay.field = duration
+	}
+	return retry, nil
+}
+
+// apply configures a fan-out executor with the options.
+func (o FanOutOptions) apply(executor *FanOutExecutor) {
+	if o.Retry != nil {
+		executor.ConfigureRetry(*o.Retry)
+	}
+	executor.SetIdempotency(o.Idempotency)
+	if o.IdempotencyRetention > 0 {
+		executor.SetIdempotencyRetention(o.IdempotencyRetention)
+	}
+	executor.SetStatePersistence(o.StatePersistence)
+}
@@ -0,0 +1,61 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestRetryConfigFromSettings(t *testing.T) {
+	noRetries := 0
+	retry, err := RetryConfigFromSettings(config.RetrySettings{MaxRetries: &noRetries, InitialDelay: "1s", BackoffFactor: 3})
+	if err != nil {
+		t.Fatalf("RetryConfigFromSettings() error = %v", err)
+	}
+	defaults := DefaultRetryConfig()
+	if retry.MaxRetries != 0 || retry.InitialDelay != time.Second || retry.BackoffFactor != 3 || retry.MaxDelay != defaults.MaxDelay {
+		t.Errorf("expected the settings over the defaults, got %+v", retry)
+	}
+
+	if _, err := RetryConfigFromSettings(config.RetrySettings{MaxDelay: "soon"}); err == nil {
+		t.Errorf("expected an invalid delay to be rejected")
+	}
+}
+
+func TestRunnerFanOutOptions(t *testing.T) {
+	tempDir := t.TempDir()
+	opts, err := NewFanOutOptions(&config.UserConfig{
+		Retry:                &config.RetrySettings{MaxDelay: "1m"},
+		CircuitBreakers:      &config.CircuitBreakersConfig{Default: config.CircuitBreakerSettings{FailureThreshold: 2}},
+		Idempotency:          true,
+		IdempotencyRetention: "1h",
+	})
+	if err != nil {
+		t.Fatalf("NewFanOutOptions() error = %v", err)
+	}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		FanOuts:       opts,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	executor, err := runner.newFanOutExecutor()
+	if err != nil {
+		t.Fatalf("Failed to create fan-out executor: %v", err)
+	}
+	if !executor.IsIdempotencyEnabled() || executor.retryConfig.MaxDelay != time.Minute {
+		t.Errorf("expected the fan-out options to configure the executor")
+	}
+	if retention := executor.stateManager.GetIdempotencyRetention(); retention != time.Hour {
+		t.Errorf("expected the idempotency retention of the options, got %v", retention)
+	}
+	if threshold := runner.CircuitBreakers().GetCircuitBreaker("org/app:update").config.FailureThreshold; threshold != 2 {
+		t.Errorf("expected the failure threshold of the options, got %d", threshold)
+	}
+}
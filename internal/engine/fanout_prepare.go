@@ -0,0 +1,105 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// DefaultChildPreparationWorkers is how many subscribers of a fan-out have their inputs
+// processed and their children claimed at once, before the children are triggered.
+const DefaultChildPreparationWorkers = 16
+
+// preparedChild is a subscriber of a fan-out whose inputs were processed and whose child and
+// delivery were claimed.
+type preparedChild struct {
+	subscriber   SubscriptionMatch
+	inputs       map[string]string
+	claimed      bool
+	duplicate    bool // Another subscriber of the fan-out claims the same child
+	deduplicated bool // The same event was delivered to the subscription within its dedup window
+	err          error
+}
+
+// prepareChildren processes the inputs of the subscribers of a fan-out from their events and
+// claims their children and deliveries, with a bounded pool of workers, so that large fan-outs
+// do not set their children up one at a time. The results are in the order of the subscribers; of the
+// subscribers triggering the same child with the same inputs, only the first claims it.
+func (fe *FanOutExecutor) prepareChildren(subscribers []SubscriptionMatch, subscriberEvents map[string]Event, state *FanOutState, claimOwner string) []preparedChild {
+	prepared := make([]preparedChild, len(subscribers))
+	for i, subscriber := range subscribers {
+		prepared[i].subscriber = subscriber
+	}
+
+	// Inputs are processed from the payload of the event each subscriber was matched with
+	fe.forEachChild(len(prepared), func(i int) {
+		sub := prepared[i].subscriber
+		event := subscriberEvents[sub.Repository+":"+sub.Subscription.Workflow]
+		inputs, err := fe.subscriptionEvaluator.ProcessEvent(event, sub.Subscription)
+		if err != nil {
+			prepared[i].err = fmt.Errorf("failed to process payload for %s: %v", sub.Repository, err)
+			return
+		}
+		prepared[i].inputs = inputs
+	})
+
+	// Claims of the same child would race each other, so the subscribers after the first are
+	// left out in order
+	claimed := make(map[string]bool)
+	for i := range prepared {
+		if prepared[i].err != nil {
+			continue
+		}
+		sub := prepared[i].subscriber
+		encodedInputs, _ := json.Marshal(prepared[i].inputs)
+		key := sub.Repository + ":" + sub.Subscription.Workflow + "\x00" + string(encodedInputs)
+		prepared[i].duplicate = claimed[key]
+		claimed[key] = true
+	}
+
+	// Each child is triggered once, even when other processes handle the same fan-out, and the
+	// deliveries to subscriptions with a dedup window are claimed once the child is
+	now := fe.now()
+	fe.forEachChild(len(prepared), func(i int) {
+		if prepared[i].err != nil || prepared[i].duplicate {
+			return
+		}
+		sub := prepared[i].subscriber
+		prepared[i].claimed, prepared[i].err = state.ClaimChild(sub.Repository, sub.Subscription.Workflow, prepared[i].inputs, claimOwner)
+		if !prepared[i].claimed || prepared[i].err != nil {
+			return
+		}
+		event := subscriberEvents[sub.Repository+":"+sub.Subscription.Workflow]
+		deliver, err := fe.claimDelivery(sub, event, now)
+		prepared[i].deduplicated = err == nil && !deliver
+		if err != nil {
+			prepared[i].err = fmt.Errorf("deduplication failed for %s: %v", sub.Repository, err)
+		}
+	})
+	return prepared
+}
+
+// forEachChild calls prepare with the indexes of n children, with a bounded pool of workers.
+func (fe *FanOutExecutor) forEachChild(n int, prepare func(i int)) {
+	workers := DefaultChildPreparationWorkers
+	if workers > n {
+		workers = n
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				prepare(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
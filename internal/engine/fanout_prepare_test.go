@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestFanOutExecutor_PrepareChildren(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &failingRepoWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	state, err := executor.stateManager.CreateFanOutState("fanout-prepare", "", "source-org/library", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	// More subscribers than workers, two of which cannot map the payload and one repeating another
+	subscribers := rolloutSubscriptions(40)
+	for i := range subscribers {
+		subscribers[i].Subscription.Inputs = map[string]string{"version": "{{ .payload.version }}"}
+	}
+	subscribers[5].Subscription.Inputs = map[string]string{"version": "{{ .payload.version.major }}"}
+	subscribers[20].Subscription.Inputs = map[string]string{"version": "{{ .payload.version.major }}"}
+	subscribers = append(subscribers, subscribers[3])
+
+	events := make(map[string]Event)
+	for _, subscriber := range subscribers {
+		events[subscriber.Repository+":"+subscriber.Subscription.Workflow] = Event{Type: "library_built", Payload: map[string]interface{}{"version": "1.2.0"}}
+	}
+	prepared := executor.prepareChildren(subscribers, events, state, "test")
+
+	if len(prepared) != len(subscribers) {
+		t.Fatalf("expected a result per subscriber, got %d", len(prepared))
+	}
+	claimed := 0
+	for i, child := range prepared {
+		if child.subscriber.Repository != subscribers[i].Repository {
+			t.Errorf("expected result %d to be of %s, got %s", i, subscribers[i].Repository, child.subscriber.Repository)
+		}
+		switch {
+		case i == 5 || i == 20:
+			if child.err == nil || !strings.Contains(child.err.Error(), fmt.Sprintf("failed to process payload for test-org/repo-%d", i+1)) {
+				t.Errorf("expected the payload of subscriber %d not to be processed, got %v", i, child.err)
+			}
+		case i == len(subscribers)-1:
+			if !child.duplicate || child.claimed {
+				t.Errorf("expected the repeated subscriber to be left out, got %+v", child)
+			}
+		default:
+			if child.err != nil || !child.claimed || child.inputs["version"] != "1.2.0" {
+				t.Errorf("expected subscriber %d to be claimed with its inputs, got %+v", i, child)
+			}
+		}
+		if child.claimed {
+			claimed++
+		}
+	}
+	if claimed != 38 {
+		t.Errorf("expected 38 claimed children, got %d", claimed)
+	}
+
+	// Claims are taken once, by whichever process prepares the children first
+	for _, child := range executor.prepareChildren(subscribers, events, state, "other") {
+		if child.claimed {
+			t.Errorf("expected %s to be claimed already", child.subscriber.Repository)
+		}
+	}
+}
+
+func TestFanOutExecutor_AddsPreparedChildrenInOrder(t *testing.T) {
+	runner := &failingRepoWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	subscribers := rolloutSubscriptions(30)
+	subscribers[2].Subscription.Inputs = map[string]string{"version": "{{ .payload.version.major }}"}
+	subscribers[9].Subscription.Inputs = map[string]string{"version": "{{ .payload.version.major }}"}
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"payload":           map[string]interface{}{"version": "1.2.0"},
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscribers)
+	if err != nil {
+		t.Fatalf("ExecuteWithSubscriptions() error = %v", err)
+	}
+	if result.TriggeredCount != 28 {
+		t.Errorf("expected 28 children to be triggered, got %d", result.TriggeredCount)
+	}
+	// The errors of subscribers are reported in their order, whichever worker mapped them
+	var failed []string
+	for _, detailed := range result.DetailedErrors {
+		if detailed.ErrorType == "input_mapping_failed" {
+			failed = append(failed, detailed.Repository)
+		}
+	}
+	if strings.Join(failed, ",") != "test-org/repo-3,test-org/repo-10" {
+		t.Errorf("expected the input errors of repo-3 and repo-10 in order, got %v", failed)
+	}
+
+	state, err := executor.stateManager.GetFanOutState(result.FanOutID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if children := state.GetChildren(); len(children) != 28 {
+		t.Errorf("expected the 28 children in the state, got %d", len(children))
+	}
+}
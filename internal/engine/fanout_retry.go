@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+)
+
+// retryableChild reports whether a retry of a fan-out triggers a child again: a child that
+// failed or timed out, or with onlyFailed false, any child that did not complete and was not
+// skipped because the event left its subscription unchanged.
+func retryableChild(child ChildWorkflow, onlyFailed bool) bool {
+	switch child.Status {
+	case ChildStatusFailed, ChildStatusTimedOut:
+		return true
+	case ChildStatusCancelled:
+		return !onlyFailed
+	case ChildStatusSkipped:
+		return !onlyFailed && child.SkipReason != ChildSkipUnchanged
+	}
+	return false
+}
+
+// Retry triggers the children of a finished fan-out that did not complete again, or with
+// onlyFailed those that failed or timed out, with the events the fan-out emitted. The children
+// are rerun as part of the same fan-out state, which is completed or failed again from the
+// status of all its children.
+func (fe *FanOutExecutor) Retry(ctx context.Context, fanOutID string, onlyFailed bool) (*FanOutResult, error) {
+	state, err := fe.stateManager.GetFanOutState(fanOutID)
+	if err != nil {
+		return nil, err
+	}
+	if !state.IsComplete() {
+		return nil, fmt.Errorf("fan-out %s is still running", fanOutID)
+	}
+	events, err := state.GetEvents()
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, fmt.Errorf("fan-out %s has no recorded events to retry its children with", fanOutID)
+	}
+
+	state.mu.RLock()
+	sourceRepo, correlationID, timeout, failurePolicy := state.SourceRepo, state.CorrelationID, state.Timeout, state.FailurePolicy
+	state.mu.RUnlock()
+
+	selected := make(map[string]ChildWorkflow)
+	for _, child := range state.GetChildren() {
+		if retryableChild(child, onlyFailed) {
+			selected[child.Repository+":"+child.Workflow] = child
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("fan-out %s has no children to retry", fanOutID)
+	}
+
+	// The retried children belong to the execution tree of the fan-out
+	fe.SetCorrelationID(correlationID)
+
+	startTime := fe.now()
+	result := &FanOutResult{
+		StartTime:      startTime,
+		FanOutID:       fanOutID,
+		Errors:         []string{},
+		DetailedErrors: []ChildExecutionError{},
+	}
+
+	// Each child is triggered by the first event of the fan-out its subscription still matches
+	params := &FanOutParams{
+		WaitForChildren: true,
+		FailurePolicy:   failurePolicy,
+		Refs:            make(map[string]string),
+	}
+	if timeout > 0 {
+		params.Timeout = timeout.String()
+	}
+	var groups []eventSubscribers
+	retried := make(map[string]bool)
+	for _, event := range events {
+		subscribers, err := fe.discoveryManager.FindSubscribersContext(ctx, fmt.Sprintf("%s:default", sourceRepo), event.Type)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find subscribers: %v", err)
+		}
+		result.SubscribersFound += len(subscribers)
+
+		group := eventSubscribers{event: event}
+		for _, subscriber := range subscribers {
+			key := subscriber.Repository + ":" + subscriber.Subscription.Workflow
+			child, ok := selected[key]
+			if !ok || retried[key] {
+				continue
+			}
+			if err := state.RetryChild(child.Repository, child.Workflow); err != nil {
+				result.Errors = append(result.Errors, err.Error())
+				continue
+			}
+			retried[key] = true
+			// The child runs against the revision it was pinned to, resolved again
+			if child.Ref != "" {
+				params.Refs[child.Repository] = child.Ref
+			}
+
+			entry := AuditEntry{
+				FanOutID:   fanOutID,
+				Decision:   AuditChildRetried,
+				Repository: child.Repository,
+				Workflow:   child.Workflow,
+				Reason:     child.ErrorMessage,
+				Details:    map[string]string{"status": string(child.Status), "retry": strconv.Itoa(child.Retries + 1)},
+			}
+			if child.RunID != "" {
+				entry.Details["previous_run_id"] = child.RunID
+			}
+			fe.recordAudit(entry)
+			group.subscribers = append(group.subscribers, subscriber)
+		}
+		groups = append(groups, group)
+	}
+	for key, child := range selected {
+		if !retried[key] {
+			result.Errors = append(result.Errors, fmt.Sprintf("%s no longer subscribes to the events of the fan-out", key))
+			result.DetailedErrors = append(result.DetailedErrors, ChildExecutionError{
+				Repository:   child.Repository,
+				Workflow:     child.Workflow,
+				RunID:        child.RunID,
+				ErrorType:    "not_subscribed",
+				ErrorMessage: "no longer subscribes to the events of the fan-out",
+				StartTime:    startTime,
+			})
+		}
+	}
+
+	if err := state.StartFanOut(); err != nil {
+		return nil, fmt.Errorf("failed to start fan-out %s: %v", fanOutID, err)
+	}
+	if len(retried) > 0 {
+		triggeredCount, errors, detailedErrors := fe.triggerEventSubscribersWithState(ctx, groups, params, state)
+		result.TriggeredCount = triggeredCount
+		result.Errors = append(result.Errors, errors...)
+		result.DetailedErrors = append(result.DetailedErrors, detailedErrors...)
+	}
+
+	switch {
+	case IsRunInterrupted(ctx):
+		result.Errors = append(result.Errors, "fan-out was interrupted")
+		state.InterruptFanOut("interrupted by a signal")
+	case fe.isCancelled(state):
+		result.Cancelled = true
+		state.CancelFanOut("fan-out was cancelled")
+	default:
+		state.FinishRetry()
+	}
+
+	summary := state.GetSummary()
+	result.ChildrenSummary = &summary
+	result.Children = state.GetChildren()
+	result.Diamonds = state.GetDiamonds()
+	for _, child := range result.Children {
+		if !retried[child.Repository+":"+child.Workflow] {
+			continue
+		}
+		result.Retried = append(result.Retried, child)
+		finished := AuditEntry{
+			FanOutID:   fanOutID,
+			Decision:   AuditChildFinished,
+			Repository: child.Repository,
+			Workflow:   child.Workflow,
+			Reason:     child.ErrorMessage,
+			Details:    map[string]string{"status": string(child.Status)},
+		}
+		if child.RunID != "" {
+			finished.Details["run_id"] = child.RunID
+		}
+		if child.Commit != "" {
+			finished.Details["commit"] = child.Commit
+		}
+		fe.recordAudit(finished)
+	}
+
+	result.TimeoutExceeded = summary.TimedOutChildren > 0
+	result.Success = len(result.Errors) == 0 && summary.Status == FanOutStatusCompleted
+	if failurePolicy != nil {
+		result.FailurePolicy = failurePolicy.Mode
+		if result.Success && failurePolicy.Mode == FailurePolicyThreshold {
+			result.ToleratedFailures = summary.FailedChildren + summary.TimedOutChildren
+		}
+	}
+	result.EndTime = fe.now()
+	return result, nil
+}
@@ -0,0 +1,164 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRunnerRetryFanOut(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	// The service fails until the marker is written
+	marker := filepath.Join(tempDir, "fixed")
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+          payload:
+            version: "1.2.0"
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    inputs:
+      version:
+        type: string
+    steps:
+      - run: echo updated to {{ .Inputs.version }}
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    inputs:
+      version: "{{ .payload.version }}"
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/svc", `version: 0.1.0
+workflows:
+  update:
+    inputs:
+      release:
+        type: string
+    steps:
+      - run: test -f `+marker+` && echo updated to {{ .Inputs.release }}
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    inputs:
+      release: "{{ .payload.version }}"
+`)
+
+	first, _ := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if first == nil {
+		t.Fatal("expected the result of the run")
+	}
+	states, err := NewFanOutStateManager(filepath.Join(runner.cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	fanOuts := states.FanOutsOfRun(first.RunID)
+	if len(fanOuts) != 1 {
+		t.Fatalf("expected a fan-out of the run, got %d", len(fanOuts))
+	}
+	fanOut := fanOuts[0]
+	if events, _ := fanOut.GetEvents(); len(events) != 1 || events[0].Type != "library_built" || events[0].Payload["version"] != "1.2.0" {
+		t.Fatalf("expected the emitted event to be persisted, got %+v", events)
+	}
+	before := make(map[string]ChildWorkflow)
+	for _, child := range fanOut.GetChildren() {
+		before[child.Repository] = child
+	}
+	if before["test-org/svc"].Status != ChildStatusFailed || before["test-org/app"].Status != ChildStatusCompleted {
+		t.Fatalf("expected the service to fail and the app to complete, got %+v", before)
+	}
+
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		t.Fatalf("failed to write marker: %v", err)
+	}
+	result, err := runner.RetryFanOut(context.Background(), fanOut.ID, true)
+	if err != nil {
+		t.Fatalf("RetryFanOut() error = %v", err)
+	}
+	if !result.Success || result.FanOutID != fanOut.ID || len(result.Retried) != 1 || result.Retried[0].Repository != "test-org/svc" {
+		t.Fatalf("expected only the failed service to be retried, got %+v", result)
+	}
+
+	// The same state is updated, with the earlier run of the retried child
+	states, err = NewFanOutStateManager(filepath.Join(runner.cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	retried, err := states.GetFanOutState(fanOut.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if summary := retried.GetSummary(); summary.Status != FanOutStatusCompleted || summary.CompletedChildren != 2 {
+		t.Errorf("expected the fan-out to complete, got %+v", summary)
+	}
+	after := make(map[string]ChildWorkflow)
+	for _, child := range retried.GetChildren() {
+		after[child.Repository] = child
+	}
+	svc := after["test-org/svc"]
+	if svc.Status != ChildStatusCompleted || svc.Retries != 1 || svc.ErrorMessage != "" || svc.Inputs["release"] != "1.2.0" {
+		t.Errorf("unexpected retried child: %+v", svc)
+	}
+	// A child that failed to run has no run to record
+	var previous []string
+	if runID := before["test-org/svc"].RunID; runID != "" {
+		previous = append(previous, runID)
+	}
+	if svc.RunID == "" || svc.RunID == before["test-org/svc"].RunID || !slices.Equal(svc.PreviousRunIDs, previous) {
+		t.Errorf("expected a new run after %v, got %q after %v", previous, svc.RunID, svc.PreviousRunIDs)
+	}
+	if app := after["test-org/app"]; app.RunID != before["test-org/app"].RunID || app.Retries != 0 {
+		t.Errorf("expected the completed app not to be retried, got %+v", app)
+	}
+
+	// A fan-out whose children all completed has nothing to retry
+	if _, err := runner.RetryFanOut(context.Background(), fanOut.ID, false); err == nil || !strings.Contains(err.Error(), "no children to retry") {
+		t.Errorf("expected nothing to retry, got %v", err)
+	}
+	if _, err := runner.RetryFanOut(context.Background(), "fanout-missing", false); err == nil {
+		t.Error("expected an unknown fan-out to be rejected")
+	}
+}
+
+func TestRetryableChild(t *testing.T) {
+	tests := []struct {
+		child      ChildWorkflow
+		onlyFailed bool
+		want       bool
+	}{
+		{ChildWorkflow{Status: ChildStatusFailed}, true, true},
+		{ChildWorkflow{Status: ChildStatusTimedOut}, true, true},
+		{ChildWorkflow{Status: ChildStatusCancelled}, true, false},
+		{ChildWorkflow{Status: ChildStatusCancelled}, false, true},
+		{ChildWorkflow{Status: ChildStatusSkipped}, false, true},
+		{ChildWorkflow{Status: ChildStatusSkipped, SkipReason: ChildSkipUnchanged}, false, false},
+		{ChildWorkflow{Status: ChildStatusCompleted}, false, false},
+	}
+	for _, tt := range tests {
+		if got := retryableChild(tt.child, tt.onlyFailed); got != tt.want {
+			t.Errorf("retryableChild(%s %q, %v) = %v, want %v", tt.child.Status, tt.child.SkipReason, tt.onlyFailed, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,267 @@
+package engine
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+)
+
+// RolloutConfig configures a staged fan-out, where subscribers are triggered in waves.
+//
+// Each wave is either a cumulative percentage of the subscribers ("10%", "50%") or a
+// cumulative number of subscribers ("2"). The last wave is always extended to cover every
+// subscriber. A wave only starts once every child of the previous waves has finished and
+// the gate allows it; otherwise the remaining waves are skipped.
+type RolloutConfig struct {
+	Waves []string `yaml:"waves"`
+	// Gate is a CEL expression evaluated after each wave, with the variables wave and rollout
+	// holding the child counts of the last wave and of the whole rollout so far. When empty,
+	// the rollout proceeds only if no child of the last wave failed or timed out.
+	Gate string `yaml:"gate,omitempty"`
+	// ApprovalRequired holds each wave after the first, once the gate allowed it, until tako
+	// approve approves it. Without an approval within ApprovalTimeout, a Go duration, the
+	// rollout is aborted.
+	ApprovalRequired bool   `yaml:"approval_required,omitempty"`
+	ApprovalTimeout  string `yaml:"approval_timeout,omitempty"`
+}
+
+// rolloutStats holds the child counts exposed to rollout gates.
+type rolloutStats struct {
+	size      int
+	succeeded int
+	failed    int
+	timedOut  int
+}
+
+// add accumulates the counts of another set of children.
+func (s *rolloutStats) add(other rolloutStats) {
+	s.size += other.size
+	s.succeeded += other.succeeded
+	s.failed += other.failed
+	s.timedOut += other.timedOut
+}
+
+// record counts a child that finished with the given status.
+func (s *rolloutStats) record(status ChildWorkflowStatus) {
+	s.size++
+	switch status {
+	case ChildStatusCompleted:
+		s.succeeded++
+	case ChildStatusFailed:
+		s.failed++
+	case ChildStatusTimedOut:
+		s.timedOut++
+	}
+}
+
+// toMap converts the counts into the CEL map representation used by gates.
+func (s rolloutStats) toMap() map[string]int64 {
+	return map[string]int64{
+		"size":      int64(s.size),
+		"succeeded": int64(s.succeeded),
+		"failed":    int64(s.failed),
+		"timed_out": int64(s.timedOut),
+	}
+}
+
+// parseRolloutConfig parses the rollout parameter of a fan-out step.
+func parseRolloutConfig(value interface{}) (*RolloutConfig, error) {
+	rolloutMap, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("rollout must be a map")
+	}
+
+	rollout := &RolloutConfig{}
+	waves, ok := rolloutMap["waves"].([]interface{})
+	if !ok || len(waves) == 0 {
+		return nil, fmt.Errorf("rollout.waves must be a non-empty list")
+	}
+	for _, wave := range waves {
+		switch w := wave.(type) {
+		case string:
+			rollout.Waves = append(rollout.Waves, w)
+		case int:
+			rollout.Waves = append(rollout.Waves, strconv.Itoa(w))
+		default:
+			return nil, fmt.Errorf("rollout.waves must contain percentages or counts, got %v", wave)
+		}
+	}
+
+	if gate, ok := rolloutMap["gate"]; ok {
+		gateStr, ok := gate.(string)
+		if !ok {
+			return nil, fmt.Errorf("rollout.gate must be a string")
+		}
+		rollout.Gate = gateStr
+	}
+
+	if approval, ok := rolloutMap["approval_required"]; ok {
+		approvalBool, ok := approval.(bool)
+		if !ok {
+			return nil, fmt.Errorf("rollout.approval_required must be a boolean")
+		}
+		rollout.ApprovalRequired = approvalBool
+	}
+	if timeout, ok := rolloutMap["approval_timeout"]; ok {
+		timeoutStr, ok := timeout.(string)
+		if !ok {
+			return nil, fmt.Errorf("rollout.approval_timeout must be a string")
+		}
+		rollout.ApprovalTimeout = timeoutStr
+	}
+
+	if err := rollout.Validate(); err != nil {
+		return nil, err
+	}
+	return rollout, nil
+}
+
+// Validate checks the wave definitions and compiles the gate expression.
+func (r *RolloutConfig) Validate() error {
+	if len(r.Waves) == 0 {
+		return fmt.Errorf("rollout.waves must be a non-empty list")
+	}
+
+	lastPercent := 0.0
+	for _, wave := range r.Waves {
+		value, percent, err := parseRolloutWave(wave)
+		if err != nil {
+			return err
+		}
+		if percent {
+			if value <= lastPercent {
+				return fmt.Errorf("rollout wave '%s' must be larger than the previous percentage wave", wave)
+			}
+			lastPercent = value
+		}
+	}
+
+	if strings.TrimSpace(r.Gate) != "" {
+		if _, err := compileRolloutGate(r.Gate, nil); err != nil {
+			return fmt.Errorf("invalid rollout.gate: %v", err)
+		}
+	}
+
+	if r.ApprovalTimeout != "" {
+		if !r.ApprovalRequired {
+			return fmt.Errorf("rollout.approval_timeout requires rollout.approval_required")
+		}
+		if timeout, err := time.ParseDuration(r.ApprovalTimeout); err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid rollout.approval_timeout '%s': must be a positive duration", r.ApprovalTimeout)
+		}
+	}
+
+	return nil
+}
+
+// WaveSizes splits total subscribers into the configured waves and returns the number of
+// subscribers in each one. Waves that would not add any subscriber are dropped.
+func (r *RolloutConfig) WaveSizes(total int) ([]int, error) {
+	sizes := make([]int, 0, len(r.Waves))
+	covered := 0
+	for _, wave := range r.Waves {
+		value, percent, err := parseRolloutWave(wave)
+		if err != nil {
+			return nil, err
+		}
+
+		end := int(value)
+		if percent {
+			end = int(math.Ceil(float64(total) * value / 100))
+		}
+		if end > total {
+			end = total
+		}
+		if end > covered {
+			sizes = append(sizes, end-covered)
+			covered = end
+		}
+	}
+	if covered < total {
+		sizes = append(sizes, total-covered)
+	}
+	return sizes, nil
+}
+
+// parseRolloutWave parses a single wave, returning its value and whether it is a percentage.
+func parseRolloutWave(wave string) (float64, bool, error) {
+	spec := strings.TrimSpace(wave)
+	if strings.HasSuffix(spec, "%") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(spec, "%")), 64)
+		if err != nil || value <= 0 || value > 100 {
+			return 0, false, fmt.Errorf("invalid rollout wave '%s': percentages must be between 0%% and 100%%", wave)
+		}
+		return value, true, nil
+	}
+
+	count, err := strconv.Atoi(spec)
+	if err != nil || count <= 0 {
+		return 0, false, fmt.Errorf("invalid rollout wave '%s': must be a percentage such as 10%% or a positive count", wave)
+	}
+	return float64(count), false, nil
+}
+
+// compileRolloutGate compiles a rollout gate expression, whose time.now() reads now, or the
+// system time when now is nil.
+func compileRolloutGate(gate string, now func() time.Time) (cel.Program, error) {
+	options := []cel.EnvOption{
+		cel.Variable("wave", cel.MapType(cel.StringType, cel.IntType)),
+		cel.Variable("rollout", cel.MapType(cel.StringType, cel.IntType)),
+	}
+	env, err := cel.NewEnv(append(options, celFunctionLibrary(now)...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
+	}
+
+	ast, issues := env.Compile(gate)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("CEL compilation error: %v", issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return nil, fmt.Errorf("gate must return boolean, got %v", ast.OutputType())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("CEL program creation error: %v", err)
+	}
+	return program, nil
+}
+
+// evaluateRolloutGate decides whether the rollout may continue after a wave.
+// The wave variable holds the counts of the wave that just finished, plus its 1-based index;
+// the rollout variable holds the counts of every finished wave, plus the number of waves.
+// time.now() reads now.
+func (r *RolloutConfig) evaluateRolloutGate(waveIndex, waveCount int, wave, overall rolloutStats, now func() time.Time) (bool, error) {
+	if strings.TrimSpace(r.Gate) == "" {
+		return wave.failed == 0 && wave.timedOut == 0, nil
+	}
+
+	program, err := compileRolloutGate(r.Gate, now)
+	if err != nil {
+		return false, err
+	}
+
+	waveVars := wave.toMap()
+	waveVars["index"] = int64(waveIndex)
+	rolloutVars := overall.toMap()
+	rolloutVars["waves"] = int64(waveCount)
+	rolloutVars["completed_waves"] = int64(waveIndex)
+
+	result, _, err := program.Eval(map[string]interface{}{
+		"wave":    waveVars,
+		"rollout": rolloutVars,
+	})
+	if err != nil {
+		return false, fmt.Errorf("CEL evaluation error: %v", err)
+	}
+	if result.Type() != types.BoolType {
+		return false, fmt.Errorf("gate must return boolean, got %v", result.Type())
+	}
+	return result.Value().(bool), nil
+}
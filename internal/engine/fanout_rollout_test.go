@@ -0,0 +1,198 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// failingRepoWorkflowRunner records the started children and fails the ones in failRepos.
+type failingRepoWorkflowRunner struct {
+	mu        sync.Mutex
+	order     []string
+	failRepos map[string]bool
+}
+
+func (r *failingRepoWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	r.mu.Lock()
+	r.order = append(r.order, repoPath)
+	r.mu.Unlock()
+
+	return &interfaces.ExecutionResult{
+		RunID:     fmt.Sprintf("run-%s", workflowName),
+		Success:   !r.failRepos[repoPath],
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	}, nil
+}
+
+// rolloutSubscriptions returns subscriptions from n repositories, ordered by priority so that
+// repo-1 is triggered first. Distinct workflows keep diamond resolution from merging them.
+func rolloutSubscriptions(n int) []interfaces.SubscriptionMatch {
+	subscriptions := make([]interfaces.SubscriptionMatch, 0, n)
+	for i := 1; i <= n; i++ {
+		subscriptions = append(subscriptions, interfaces.SubscriptionMatch{
+			Repository: fmt.Sprintf("test-org/repo-%d", i),
+			Subscription: config.Subscription{
+				Artifact: "source-org/library:default",
+				Events:   []string{"library_built"},
+				Workflow: fmt.Sprintf("update-%d", i),
+				Priority: n - i,
+			},
+		})
+	}
+	return subscriptions
+}
+
+func TestRolloutConfig_WaveSizes(t *testing.T) {
+	tests := []struct {
+		name     string
+		waves    []string
+		total    int
+		expected []int
+	}{
+		{"percentages", []string{"10%", "50%", "100%"}, 10, []int{1, 4, 5}},
+		{"percentages round up", []string{"10%", "50%"}, 3, []int{1, 1, 1}},
+		{"last wave is extended", []string{"25%"}, 8, []int{2, 6}},
+		{"counts", []string{"1", "3"}, 10, []int{1, 2, 7}},
+		{"empty waves are dropped", []string{"1", "10%", "50%"}, 4, []int{1, 1, 2}},
+		{"counts larger than total", []string{"5"}, 2, []int{2}},
+		{"no subscribers", []string{"10%"}, 0, []int{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollout := &RolloutConfig{Waves: tt.waves}
+			sizes, err := rollout.WaveSizes(tt.total)
+			if err != nil {
+				t.Fatalf("WaveSizes failed: %v", err)
+			}
+			if fmt.Sprint(sizes) != fmt.Sprint(tt.expected) {
+				t.Errorf("Expected wave sizes %v, got %v", tt.expected, sizes)
+			}
+		})
+	}
+}
+
+func TestParseRolloutConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		wantErr string
+	}{
+		{"percentages", map[string]interface{}{"waves": []interface{}{"10%", "50%", "100%"}}, ""},
+		{"counts and gate", map[string]interface{}{"waves": []interface{}{1, "5"}, "gate": "wave.failed == 0"}, ""},
+		{"not a map", "10%", "rollout must be a map"},
+		{"missing waves", map[string]interface{}{"gate": "true"}, "rollout.waves must be a non-empty list"},
+		{"invalid percentage", map[string]interface{}{"waves": []interface{}{"150%"}}, "percentages must be between"},
+		{"invalid count", map[string]interface{}{"waves": []interface{}{"0"}}, "positive count"},
+		{"decreasing percentages", map[string]interface{}{"waves": []interface{}{"50%", "10%"}}, "must be larger than the previous"},
+		{"invalid gate", map[string]interface{}{"waves": []interface{}{"50%"}, "gate": "wave.failed =="}, "invalid rollout.gate"},
+		{"non-boolean gate", map[string]interface{}{"waves": []interface{}{"50%"}, "gate": "wave.failed"}, "gate must return boolean"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseRolloutConfig(tt.value)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Expected no error, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestFanOutExecutor_RolloutWaves(t *testing.T) {
+	tests := []struct {
+		name          string
+		rollout       map[string]interface{}
+		failRepos     map[string]bool
+		expectedRun   int
+		expectSkipped int
+		expectedError string
+	}{
+		{
+			name:        "all waves succeed",
+			rollout:     map[string]interface{}{"waves": []interface{}{"25%", "50%"}},
+			expectedRun: 4,
+		},
+		{
+			name:          "failure aborts remaining waves",
+			rollout:       map[string]interface{}{"waves": []interface{}{"1", "50%"}},
+			failRepos:     map[string]bool{"test-org/repo-1": true},
+			expectedRun:   1,
+			expectSkipped: 3,
+			expectedError: "rollout aborted after wave 1 of 3: 1 children failed",
+		},
+		{
+			name:          "gate tolerates failures",
+			rollout:       map[string]interface{}{"waves": []interface{}{"50%"}, "gate": "wave.succeeded >= 1"},
+			failRepos:     map[string]bool{"test-org/repo-1": true},
+			expectedRun:   4,
+			expectedError: "workflow failed in test-org/repo-1",
+		},
+		{
+			name:          "gate on aggregated results",
+			rollout:       map[string]interface{}{"waves": []interface{}{"1", "2"}, "gate": "rollout.succeeded >= 2 || wave.index == 1"},
+			failRepos:     map[string]bool{"test-org/repo-2": true},
+			expectedRun:   2,
+			expectSkipped: 2,
+			expectedError: "rollout aborted after wave 2 of 3: gate was not satisfied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &failingRepoWorkflowRunner{failRepos: tt.failRepos}
+			executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+			if err != nil {
+				t.Fatalf("Failed to create executor: %v", err)
+			}
+
+			step := config.WorkflowStep{
+				Uses: "tako/fan-out@v1",
+				With: map[string]interface{}{
+					"event_type":        "library_built",
+					"wait_for_children": true,
+					"rollout":           tt.rollout,
+				},
+			}
+
+			result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(4))
+			if err != nil {
+				t.Fatalf("Fan-out failed: %v", err)
+			}
+
+			if len(runner.order) != tt.expectedRun {
+				t.Errorf("Expected %d children to run, got %d (%v)", tt.expectedRun, len(runner.order), runner.order)
+			}
+			if result.ChildrenSummary == nil || result.ChildrenSummary.SkippedChildren != tt.expectSkipped {
+				t.Errorf("Expected %d skipped children, got %+v", tt.expectSkipped, result.ChildrenSummary)
+			}
+
+			if tt.expectedError == "" {
+				if !result.Success {
+					t.Errorf("Expected rollout to succeed, got errors: %v", result.Errors)
+				}
+				return
+			}
+			if result.Success {
+				t.Fatalf("Expected rollout to fail")
+			}
+			if !strings.Contains(strings.Join(result.Errors, "\n"), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedError, result.Errors)
+			}
+		})
+	}
+}
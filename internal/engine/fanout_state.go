@@ -9,10 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
 )
 
 // FanOutState represents the state of a fan-out operation and its child workflows.
@@ -29,9 +32,52 @@ type FanOutState struct {
 	Timeout       time.Duration             `json:"timeout,omitempty"`
 	ErrorMessage  string                    `json:"error_message,omitempty"`
 
+	// Namespace is the tenant of the run that started the fan-out; empty for the default one.
+	Namespace string `json:"namespace,omitempty"`
+
+	// CorrelationID is the correlation ID of the execution tree of the run that started the fan-out.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Fingerprint is the event fingerprint of an idempotent fan-out; empty for the others.
+	Fingerprint string `json:"fingerprint,omitempty"`
+
+	// OwnerPID is the process running the fan-out. Another process takes over a fan-out whose
+	// owner died before finishing it.
+	OwnerPID int `json:"owner_pid,omitempty"`
+
+	// FailurePolicy decides whether failed children fail the fan-out; nil fails it on any failure.
+	FailurePolicy *FailurePolicy `json:"failure_policy,omitempty"`
+
+	// Diamonds are the diamond dependencies of the subscribers and how they were resolved.
+	Diamonds []DiamondResolution `json:"diamonds,omitempty"`
+
+	// Events are the events the fan-out emitted, for tako retry to trigger its failed children
+	// again with the payloads they were first triggered by.
+	Events []Event `json:"events,omitempty"`
+
+	// SpilledPayloads are the files, under the payloads directory of the state, of the payloads
+	// of the events too large to be recorded in the state, by event; empty for the events
+	// recorded whole.
+	SpilledPayloads []string `json:"spilled_payloads,omitempty"`
+
+	// Revision is incremented every time the state is persisted, so that waiters watching the
+	// state file can tell updates written by other processes from stale copies.
+	Revision uint64 `json:"revision,omitempty"`
+
+	// ChildShards tells that each child is written to its own file under the shards directory
+	// of the state rather than to the state file, for fan-outs with many children.
+	ChildShards bool `json:"child_shards,omitempty"`
+
+	// SchemaVersion is the version of the shape of the state file, which older files are
+	// migrated from when they are loaded.
+	SchemaVersion int `json:"schema_version"`
+
 	// Runtime fields (not serialized)
 	mu           sync.RWMutex        `json:"-"`
 	stateManager *FanOutStateManager `json:"-"`
+	changed      chan struct{}       `json:"-"`
+	writes       stateWrites         `json:"-"`
+	details      *lazyDetails        `json:"-"` // Details of the children not decoded yet
 }
 
 // ChildWorkflow represents a child workflow triggered by fan-out.
@@ -44,8 +90,47 @@ type ChildWorkflow struct {
 	EndTime      *time.Time          `json:"end_time,omitempty"`
 	ErrorMessage string              `json:"error_message,omitempty"`
 	Inputs       map[string]string   `json:"inputs"`
+
+	// Ref is the revision the child was pinned to, and Commit the SHA it resolved to and ran against.
+	Ref    string `json:"ref,omitempty"`
+	Commit string `json:"commit,omitempty"`
+
+	// LockOwner is the run holding the subscriber repository lock while the child runs.
+	// It is persisted so a resumed fan-out knows which children were interrupted mid-lock.
+	LockOwner string `json:"lock_owner,omitempty"`
+
+	// CorrelationID is the correlation ID of the execution tree the child run belongs to.
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Outputs are the outputs declared by the child workflow, recorded when it completes.
+	Outputs map[string]string `json:"outputs,omitempty"`
+
+	// LastHeartbeat is when the process running the child last recorded it was alive. Waiters
+	// fail running children whose heartbeats stopped instead of waiting for the timeout.
+	LastHeartbeat *time.Time `json:"last_heartbeat,omitempty"`
+
+	// SkipReason tells why a skipped child was not started; ChildSkipUnchanged when the event
+	// did not change anything its subscription depends on.
+	SkipReason string `json:"skip_reason,omitempty"`
+
+	// Approval is the status of the approval gate of a child whose subscription requires
+	// approval; the child stays pending while its approval is pending.
+	Approval ApprovalStatus `json:"approval,omitempty"`
+
+	// Retries is how many times tako retry triggered the child again, and PreviousRunIDs the
+	// runs of its earlier attempts, the first one first.
+	Retries        int      `json:"retries,omitempty"`
+	PreviousRunIDs []string `json:"previous_run_ids,omitempty"`
+
+	// Result is the execution of the child workflow when this process ran it. It is not
+	// persisted: fan-outs loaded from their state do not have it.
+	Result *interfaces.ExecutionResult `json:"-"`
 }
 
+// ChildSkipUnchanged is the skip reason of the children whose subscription is not affected by
+// the changes of the event. Unlike other skipped children, they do not fail the fan-out.
+const ChildSkipUnchanged = "unchanged"
+
 // FanOutStatus represents the status of a fan-out operation.
 type FanOutStatus string
 
@@ -56,6 +141,10 @@ const (
 	FanOutStatusCompleted FanOutStatus = "completed"
 	FanOutStatusFailed    FanOutStatus = "failed"
 	FanOutStatusTimedOut  FanOutStatus = "timed_out"
+	FanOutStatusCancelled FanOutStatus = "cancelled"
+	// FanOutStatusInterrupted marks a fan-out whose process stopped before it finished. The
+	// next dispatch of the same event takes it over and runs its unfinished children.
+	FanOutStatusInterrupted FanOutStatus = "interrupted"
 )
 
 // ChildWorkflowStatus represents the status of a child workflow.
@@ -67,6 +156,11 @@ const (
 	ChildStatusCompleted ChildWorkflowStatus = "completed"
 	ChildStatusFailed    ChildWorkflowStatus = "failed"
 	ChildStatusTimedOut  ChildWorkflowStatus = "timed_out"
+	// ChildStatusSkipped marks a child that was never started because its rollout wave was
+	// aborted, or because the event left its subscription unchanged.
+	ChildStatusSkipped ChildWorkflowStatus = "skipped"
+	// ChildStatusCancelled marks a child that was stopped, or never started, because the fan-out was cancelled.
+	ChildStatusCancelled ChildWorkflowStatus = "cancelled"
 )
 
 // FanOutStateManager manages the persistent state of fan-out operations.
@@ -75,8 +169,24 @@ type FanOutStateManager struct {
 	mu                   sync.RWMutex
 	states               map[string]*FanOutState
 	idempotencyRetention time.Duration
+	watchInterval        time.Duration
+	claimLease           time.Duration  // How long a child claim holds without its owner finishing the child
+	namespace            string         // Namespace recorded in the states created
+	correlationID        string         // Correlation ID recorded in the states created
+	heartbeatInterval    time.Duration  // How often running children record their heartbeat
+	faults               *FaultInjector // Faults injected when states are persisted; nil for none
+	clock                Clock          // Clock of the times recorded in states and of their retention
+	persistence          StatePersistence
 }
 
+// DefaultIdempotencyRetention is how long the state of a finished idempotent fan-out prevents
+// the fan-out of the same event from triggering the subscribers again.
+const DefaultIdempotencyRetention = 24 * time.Hour
+
+// defaultClaimLease is how long a claim on a child prevents other processes from triggering it,
+// unless the process that claimed it died first. The heartbeats of a running child renew it.
+const defaultClaimLease = time.Hour
+
 // NewFanOutStateManager creates a new state manager for fan-out operations.
 func NewFanOutStateManager(stateDir string) (*FanOutStateManager, error) {
 	if err := os.MkdirAll(stateDir, 0755); err != nil {
@@ -86,7 +196,10 @@ func NewFanOutStateManager(stateDir string) (*FanOutStateManager, error) {
 	manager := &FanOutStateManager{
 		stateDir:             stateDir,
 		states:               make(map[string]*FanOutState),
-		idempotencyRetention: 24 * time.Hour, // Default 24 hours for idempotent states
+		idempotencyRetention: DefaultIdempotencyRetention,
+		watchInterval:        defaultStateWatchInterval,
+		claimLease:           defaultClaimLease,
+		heartbeatInterval:    DefaultHeartbeatInterval,
 	}
 
 	// Load existing states from disk
@@ -108,8 +221,8 @@ func (sm *FanOutStateManager) CreateFanOutState(id, parentRunID, sourceRepo, eve
 func (sm *FanOutStateManager) CreateFanOutStateWithFingerprint(id, fingerprint, parentRunID, sourceRepo, eventType string, waitingForAll bool, timeout time.Duration) (*FanOutState, error) {
 	if fingerprint != "" {
 		// Use fingerprint-based ID and atomic creation
-		fingerprintID := fmt.Sprintf("fanout-%s", fingerprint)
-		return sm.createStateAtomic(fingerprintID, parentRunID, sourceRepo, eventType, waitingForAll, timeout)
+		state, _, err := sm.CreateIdempotentFanOutState(fingerprint, parentRunID, sourceRepo, eventType, waitingForAll, timeout)
+		return state, err
 	}
 
 	// Traditional creation without fingerprint
@@ -122,10 +235,13 @@ func (sm *FanOutStateManager) CreateFanOutStateWithFingerprint(id, fingerprint,
 		SourceRepo:    sourceRepo,
 		EventType:     eventType,
 		Status:        FanOutStatusPending,
-		StartTime:     time.Now(),
+		StartTime:     sm.now(),
 		Children:      make(map[string]*ChildWorkflow),
 		WaitingForAll: waitingForAll,
 		Timeout:       timeout,
+		Namespace:     sm.namespace,
+		CorrelationID: sm.correlationID,
+		SchemaVersion: FanOutStateSchemaVersion,
 		stateManager:  sm,
 	}
 
@@ -139,6 +255,46 @@ func (sm *FanOutStateManager) CreateFanOutStateWithFingerprint(id, fingerprint,
 	return state, nil
 }
 
+// CreateIdempotentFanOutState creates the fan-out state of an event fingerprint, unless a
+// state already exists for it, e.g. because another process handles the same event. It
+// reports whether it created the state; exactly one of concurrent callers does.
+func (sm *FanOutStateManager) CreateIdempotentFanOutState(fingerprint, parentRunID, sourceRepo, eventType string, waitingForAll bool, timeout time.Duration) (*FanOutState, bool, error) {
+	return sm.createStateAtomic(fmt.Sprintf("fanout-%s", fingerprint), fingerprint, parentRunID, sourceRepo, eventType, waitingForAll, timeout)
+}
+
+// SetCorrelationID sets the correlation ID recorded in the fan-out states the manager creates.
+func (sm *FanOutStateManager) SetCorrelationID(correlationID string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.correlationID = correlationID
+}
+
+// SetFaultInjector sets the faults injected when the manager persists states.
+func (sm *FanOutStateManager) SetFaultInjector(faults *FaultInjector) {
+	sm.faults = faults
+}
+
+// SetClock sets the clock of the times recorded in fan-out states, of the leases of their
+// claims and of their retention.
+func (sm *FanOutStateManager) SetClock(clock Clock) {
+	sm.clock = clock
+}
+
+// now returns the time of the manager's clock, or the system time for states without a manager.
+func (sm *FanOutStateManager) now() time.Time {
+	if sm == nil {
+		return time.Now()
+	}
+	return clockOrSystem(sm.clock).Now()
+}
+
+// SetNamespace sets the namespace recorded in the fan-out states the manager creates.
+func (sm *FanOutStateManager) SetNamespace(namespace string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.namespace = namespace
+}
+
 // SetIdempotencyRetention sets the retention period for idempotent states.
 // This only affects cleanup of states with fingerprint-based names.
 func (sm *FanOutStateManager) SetIdempotencyRetention(retention time.Duration) {
@@ -198,32 +354,308 @@ func (sm *FanOutStateManager) GetFanOutStateByFingerprint(fingerprint string) (*
 	return state, nil
 }
 
-// AddChildWorkflow adds a child workflow to the fan-out state.
+// AddChildWorkflow adds a child workflow to the fan-out state. A child added again, when it is
+// retried, keeps the runs of its earlier attempts.
 func (state *FanOutState) AddChildWorkflow(repository, workflow string, inputs map[string]string) *ChildWorkflow {
+	return state.AddChildWorkflows([]ChildRegistration{{Repository: repository, Workflow: workflow, Inputs: inputs}})[0]
+}
+
+// ChildRegistration is a child workflow added to a fan-out state.
+type ChildRegistration struct {
+	Repository string
+	Workflow   string
+	Inputs     map[string]string
+}
+
+// AddChildWorkflows adds child workflows to the fan-out state in order, like AddChildWorkflow,
+// and persists the state once for all of them.
+func (state *FanOutState) AddChildWorkflows(registrations []ChildRegistration) []*ChildWorkflow {
+	children := make([]*ChildWorkflow, 0, len(registrations))
+	childIDs := make([]string, 0, len(registrations))
+	now := state.stateManager.now()
+
+	state.mu.Lock()
+	state.loadDetails()
+	for _, registration := range registrations {
+		childID := fmt.Sprintf("%s-%s", registration.Repository, registration.Workflow)
+		child := &ChildWorkflow{
+			Repository:    registration.Repository,
+			Workflow:      registration.Workflow,
+			Status:        ChildStatusPending,
+			StartTime:     now,
+			Inputs:        registration.Inputs,
+			CorrelationID: state.CorrelationID,
+		}
+		if previous, exists := state.Children[childID]; exists {
+			child.Retries = previous.Retries
+			child.PreviousRunIDs = previous.PreviousRunIDs
+		}
+		state.Children[childID] = child
+		children = append(children, child)
+		childIDs = append(childIDs, childID)
+	}
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	state.stateManager.persistChildren(state, childIDs...)
+
+	return children
+}
+
+// AddSkippedChild records a child of the fan-out that is not started, with the reason and a
+// message telling why.
+func (state *FanOutState) AddSkippedChild(repository, workflow, reason, message string) *ChildWorkflow {
 	childID := fmt.Sprintf("%s-%s", repository, workflow)
+	now := state.stateManager.now()
 	child := &ChildWorkflow{
-		Repository: repository,
-		Workflow:   workflow,
-		Status:     ChildStatusPending,
-		StartTime:  time.Now(),
-		Inputs:     inputs,
+		Repository:   repository,
+		Workflow:     workflow,
+		Status:       ChildStatusSkipped,
+		StartTime:    now,
+		EndTime:      &now,
+		ErrorMessage: message,
+		SkipReason:   reason,
 	}
 
 	state.mu.Lock()
+	state.loadDetails()
+	child.CorrelationID = state.CorrelationID
 	state.Children[childID] = child
 	state.mu.Unlock()
 
 	// Persist state after releasing lock
-	state.stateManager.persistState(state)
+	state.stateManager.persistChildren(state, childID)
 
 	return child
 }
 
+// childClaim is the claim of a process on triggering a child of a fan-out.
+type childClaim struct {
+	Owner      string    `json:"owner"`
+	PID        int       `json:"pid"`
+	Repository string    `json:"repository"`
+	Workflow   string    `json:"workflow"`
+	ClaimedAt  time.Time `json:"claimed_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// claimTakeoverStaleLock is the age at which the takeover lock of a claim left by a crashed
+// process is broken.
+const claimTakeoverStaleLock = 30 * time.Second
+
+// ClaimChild records that owner triggers a child of the fan-out with the given inputs. Claims
+// are files created exclusively, so that when several processes handle the same fan-out, e.g.
+// concurrent emitters of an idempotent event, each child is triggered by exactly one of them.
+// It reports false when the child was already claimed. A claim is leased, and renewed while
+// the child runs: once its owner process died or its lease expired, and the child did not
+// finish, another process takes the claim over and triggers the child again.
+func (state *FanOutState) ClaimChild(repository, workflow string, inputs map[string]string, owner string) (bool, error) {
+	dir := state.stateManager.claimDir(state.ID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return false, fmt.Errorf("failed to create claim directory: %v", err)
+	}
+	claimFile, err := state.claimFile(repository, workflow, inputs)
+	if err != nil {
+		return false, err
+	}
+
+	now := state.stateManager.now()
+	data, err := json.Marshal(childClaim{
+		Owner:      owner,
+		PID:        os.Getpid(),
+		Repository: repository,
+		Workflow:   workflow,
+		ClaimedAt:  now,
+		ExpiresAt:  now.Add(state.stateManager.claimLease),
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal claim of child %s:%s: %v", repository, workflow, err)
+	}
+
+	file, err := os.OpenFile(claimFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return state.takeOverClaim(claimFile, repository, workflow, data)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to claim child %s:%s: %v", repository, workflow, err)
+	}
+	defer file.Close()
+
+	if _, err := file.Write(data); err != nil {
+		return true, fmt.Errorf("failed to write claim of child %s:%s: %v", repository, workflow, err)
+	}
+	return true, nil
+}
+
+// claimFile returns the file of the claim on a child of the fan-out with the given inputs.
+func (state *FanOutState) claimFile(repository, workflow string, inputs map[string]string) (string, error) {
+	// Subscriptions of a workflow with different inputs are different children
+	encodedInputs, err := json.Marshal(inputs)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal inputs of child %s:%s: %v", repository, workflow, err)
+	}
+	key := sha256.Sum256([]byte(repository + ":" + workflow + "\x00" + string(encodedInputs)))
+	return filepath.Join(state.stateManager.claimDir(state.ID), hex.EncodeToString(key[:16])), nil
+}
+
+// RetryChild prepares a finished child of the fan-out to be triggered again: its claim is
+// released, and its run is recorded among the runs of its earlier attempts.
+func (state *FanOutState) RetryChild(repository, workflow string) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	state.loadDetails()
+	child, exists := state.Children[childID]
+	if !exists {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow not found: %s", childID)
+	}
+	if child.Status == ChildStatusPending || child.Status == ChildStatusRunning {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow %s is still %s", childID, child.Status)
+	}
+	claimFile, err := state.claimFile(repository, workflow, child.Inputs)
+	if err != nil {
+		state.mu.Unlock()
+		return err
+	}
+	if err := os.Remove(claimFile); err != nil && !os.IsNotExist(err) {
+		state.mu.Unlock()
+		return fmt.Errorf("failed to release claim of child %s:%s: %v", repository, workflow, err)
+	}
+	child.Retries++
+	if child.RunID != "" {
+		child.PreviousRunIDs = append(child.PreviousRunIDs, child.RunID)
+	}
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// takeOverClaim replaces the existing claim on a child with data when that claim is stale and
+// the child did not finish, as persisted by the processes handling the fan-out. Takeovers are
+// serialized with a lock file, so that only one of the processes finding the same stale claim
+// takes it over.
+func (state *FanOutState) takeOverClaim(claimFile, repository, workflow string, data []byte) (bool, error) {
+	unlock, locked, err := state.lockClaim(claimFile)
+	if err != nil || !locked {
+		// Another process is taking the claim over
+		return false, err
+	}
+	defer unlock()
+
+	if !claimStale(claimFile, state.stateManager.claimLease, state.stateManager.now()) {
+		return false, nil
+	}
+	if err := state.stateManager.refreshState(state); err != nil {
+		return false, fmt.Errorf("failed to read state of child %s:%s: %v", repository, workflow, err)
+	}
+	state.mu.RLock()
+	child, exists := state.Children[fmt.Sprintf("%s-%s", repository, workflow)]
+	finished := exists && child.Status != ChildStatusPending && child.Status != ChildStatusRunning
+	state.mu.RUnlock()
+	if finished {
+		return false, nil
+	}
+
+	if err := replaceClaim(claimFile, data); err != nil {
+		return false, fmt.Errorf("failed to take over claim of child %s:%s: %v", repository, workflow, err)
+	}
+	return true, nil
+}
+
+// renewClaim extends the lease of the claim of this process on a child, so that a child running
+// for longer than a lease is not taken over while this process is alive. Claims of other
+// processes are left as they are, as are claims being taken over.
+func (state *FanOutState) renewClaim(repository, workflow string, inputs map[string]string) error {
+	claimFile, err := state.claimFile(repository, workflow, inputs)
+	if err != nil {
+		return err
+	}
+	unlock, locked, err := state.lockClaim(claimFile)
+	if err != nil || !locked {
+		return err
+	}
+	defer unlock()
+
+	data, err := os.ReadFile(claimFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read claim of child %s:%s: %v", repository, workflow, err)
+	}
+	var claim childClaim
+	if err := json.Unmarshal(data, &claim); err != nil || claim.PID != os.Getpid() {
+		return nil
+	}
+	claim.ExpiresAt = state.stateManager.now().Add(state.stateManager.claimLease)
+	if data, err = json.Marshal(claim); err != nil {
+		return fmt.Errorf("failed to marshal claim of child %s:%s: %v", repository, workflow, err)
+	}
+	if err := replaceClaim(claimFile, data); err != nil {
+		return fmt.Errorf("failed to renew claim of child %s:%s: %v", repository, workflow, err)
+	}
+	return nil
+}
+
+// lockClaim takes the lock serializing the takeovers and renewals of a claim. It reports false
+// when another process holds the lock; the lock of a crashed process is broken once it is
+// stale, for a later takeover to take.
+func (state *FanOutState) lockClaim(claimFile string) (func(), bool, error) {
+	lockFile := claimFile + ".lock"
+	lock, err := os.OpenFile(lockFile, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		if info, statErr := os.Stat(lockFile); statErr == nil && state.stateManager.now().Sub(info.ModTime()) > claimTakeoverStaleLock {
+			os.Remove(lockFile)
+		}
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to lock claim: %v", err)
+	}
+	lock.Close()
+	return func() { os.Remove(lockFile) }, true, nil
+}
+
+// replaceClaim atomically replaces a claim file with data.
+func replaceClaim(claimFile string, data []byte) error {
+	tempFile := fmt.Sprintf("%s.tmp.%d", claimFile, os.Getpid())
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tempFile, claimFile); err != nil {
+		os.Remove(tempFile)
+		return err
+	}
+	return nil
+}
+
+// claimStale reports whether the owner of a claim died or its lease expired by now; the owner
+// renews the lease with the heartbeats of the child while it runs. Claims written before they
+// recorded their owner process expire a lease after they were written.
+func claimStale(claimFile string, lease time.Duration, now time.Time) bool {
+	info, err := os.Stat(claimFile)
+	if err != nil {
+		return false
+	}
+	claim := childClaim{ExpiresAt: info.ModTime().Add(lease)}
+	if data, err := os.ReadFile(claimFile); err == nil {
+		json.Unmarshal(data, &claim)
+	}
+	if now.After(claim.ExpiresAt) {
+		return true
+	}
+	return claim.PID > 0 && claim.PID != os.Getpid() && !processAlive(claim.PID)
+}
+
 // UpdateChildStatus updates the status of a child workflow.
 func (state *FanOutState) UpdateChildStatus(repository, workflow string, status ChildWorkflowStatus, runID, errorMessage string) error {
 	childID := fmt.Sprintf("%s-%s", repository, workflow)
 
 	state.mu.Lock()
+	state.loadDetails()
 	child, exists := state.Children[childID]
 	if !exists {
 		state.mu.Unlock()
@@ -237,9 +669,13 @@ func (state *FanOutState) UpdateChildStatus(repository, workflow string, status
 	if errorMessage != "" {
 		child.ErrorMessage = errorMessage
 	}
-	if status == ChildStatusCompleted || status == ChildStatusFailed || status == ChildStatusTimedOut {
-		now := time.Now()
+	if status == ChildStatusCompleted || status == ChildStatusFailed || status == ChildStatusTimedOut || status == ChildStatusSkipped || status == ChildStatusCancelled {
+		now := state.stateManager.now()
 		child.EndTime = &now
+	} else if status == ChildStatusRunning {
+		// A child starting to run is alive until its heartbeats stop
+		now := state.stateManager.now()
+		child.LastHeartbeat = &now
 	}
 
 	// Check if all children are complete and update parent status
@@ -247,13 +683,210 @@ func (state *FanOutState) UpdateChildStatus(repository, workflow string, status
 	state.mu.Unlock()
 
 	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// GetChildStatus returns the status of a child workflow, or an empty status if it is unknown.
+func (state *FanOutState) GetChildStatus(repository, workflow string) ChildWorkflowStatus {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	if child, exists := state.Children[childID]; exists {
+		return child.Status
+	}
+	return ""
+}
+
+// SetChildLockOwner records which run holds the repository lock for a child workflow.
+// An empty owner records that the lock was released.
+func (state *FanOutState) SetChildLockOwner(repository, workflow, owner string) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	child, exists := state.Children[childID]
+	if !exists {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow not found: %s", childID)
+	}
+	child.LockOwner = owner
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// InterruptedChildren returns the children that did not finish while their run held the lock
+// of their repository, e.g. because the process running the fan-out died.
+func (state *FanOutState) InterruptedChildren() []ChildWorkflow {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	state.loadDetails()
+
+	var interrupted []ChildWorkflow
+	for _, child := range state.Children {
+		if child.LockOwner != "" && (child.Status == ChildStatusPending || child.Status == ChildStatusRunning) {
+			interrupted = append(interrupted, *child)
+		}
+	}
+	sort.Slice(interrupted, func(i, j int) bool {
+		return interrupted[i].Repository+":"+interrupted[i].Workflow < interrupted[j].Repository+":"+interrupted[j].Workflow
+	})
+	return interrupted
+}
+
+// SetChildRevision records the revision a child workflow was pinned to and the commit it runs against.
+func (state *FanOutState) SetChildRevision(repository, workflow, ref, commit string) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	state.loadDetails()
+	child, exists := state.Children[childID]
+	if !exists {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow not found: %s", childID)
+	}
+	child.Ref = ref
+	child.Commit = commit
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// SetChildOutputs records the outputs of a completed child workflow.
+func (state *FanOutState) SetChildOutputs(repository, workflow string, outputs map[string]string) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	state.loadDetails()
+	child, exists := state.Children[childID]
+	if !exists {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow not found: %s", childID)
+	}
+	child.Outputs = outputs
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// SetChildApproval records the status of the approval gate of a child workflow.
+func (state *FanOutState) SetChildApproval(repository, workflow string, approval ApprovalStatus) error {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	child, exists := state.Children[childID]
+	if !exists {
+		state.mu.Unlock()
+		return fmt.Errorf("child workflow not found: %s", childID)
+	}
+	child.Approval = approval
+	state.mu.Unlock()
+
+	// Persist state after releasing lock
+	return state.stateManager.persistChildren(state, childID)
+}
+
+// SetChildResult records the execution of a child workflow run by this process. Results are
+// not persisted.
+func (state *FanOutState) SetChildResult(repository, workflow string, result *interfaces.ExecutionResult) {
+	childID := fmt.Sprintf("%s-%s", repository, workflow)
+
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	if child, exists := state.Children[childID]; exists {
+		child.Result = result
+	}
+}
+
+// AddDiamonds records how diamond dependencies of the subscribers were resolved.
+func (state *FanOutState) AddDiamonds(diamonds ...DiamondResolution) error {
+	state.mu.Lock()
+	state.Diamonds = append(state.Diamonds, diamonds...)
+	state.mu.Unlock()
+
+	return state.stateManager.persistState(state)
+}
+
+// GetDiamonds returns the diamond dependencies of the subscribers and how they were resolved.
+func (state *FanOutState) GetDiamonds() []DiamondResolution {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	return slices.Clone(state.Diamonds)
+}
+
+// SetEvents records the events the fan-out emits. Payloads larger than the payload limit of the
+// state persistence are spilled to files of their own and truncated from the state.
+func (state *FanOutState) SetEvents(events []Event) error {
+	events, spilled, err := state.stateManager.spillPayloads(state.ID, events)
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	state.Events = events
+	state.SpilledPayloads = spilled
+	state.mu.Unlock()
+
+	return state.stateManager.persistState(state)
+}
+
+// GetEvents returns the events the fan-out emitted, with their spilled payloads; none for
+// fan-outs started before they were recorded.
+func (state *FanOutState) GetEvents() ([]Event, error) {
+	state.mu.RLock()
+	events := slices.Clone(state.Events)
+	spilled := slices.Clone(state.SpilledPayloads)
+	state.mu.RUnlock()
+
+	for i, name := range spilled {
+		if name == "" || i >= len(events) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(state.stateManager.payloadDir(state.ID), name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spilled payload of event %s: %v", events[i].Type, err)
+		}
+		if err := json.Unmarshal(data, &events[i].Payload); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal spilled payload of event %s: %v", events[i].Type, err)
+		}
+	}
+	return events, nil
+}
+
+// SetFailurePolicy sets the policy deciding whether failed children fail the fan-out.
+func (state *FanOutState) SetFailurePolicy(policy *FailurePolicy) error {
+	state.mu.Lock()
+	state.FailurePolicy = policy
+	state.mu.Unlock()
+
 	return state.stateManager.persistState(state)
 }
 
+// Abandoned reports whether the fan-out was left unfinished by a process that died.
+func (state *FanOutState) Abandoned() bool {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+
+	switch state.Status {
+	case FanOutStatusCompleted, FanOutStatusFailed, FanOutStatusTimedOut, FanOutStatusCancelled:
+		return false
+	case FanOutStatusInterrupted:
+		return true
+	}
+	return state.OwnerPID > 0 && state.OwnerPID != os.Getpid() && !processAlive(state.OwnerPID)
+}
+
 // StartFanOut marks the fan-out as running.
 func (state *FanOutState) StartFanOut() error {
 	state.mu.Lock()
 	state.Status = FanOutStatusRunning
+	state.OwnerPID = os.Getpid()
+	state.EndTime = nil // Set by a previous owner that was interrupted
+	state.ErrorMessage = ""
 	state.mu.Unlock()
 
 	return state.stateManager.persistState(state)
@@ -265,7 +898,7 @@ func (state *FanOutState) StartWaiting() error {
 	if len(state.Children) == 0 {
 		// No children to wait for, complete immediately
 		state.Status = FanOutStatusCompleted
-		now := time.Now()
+		now := state.stateManager.now()
 		state.EndTime = &now
 	} else {
 		state.Status = FanOutStatusWaiting
@@ -281,7 +914,7 @@ func (state *FanOutState) StartWaiting() error {
 func (state *FanOutState) CompleteFanOut() error {
 	state.mu.Lock()
 	state.Status = FanOutStatusCompleted
-	now := time.Now()
+	now := state.stateManager.now()
 	state.EndTime = &now
 	state.mu.Unlock()
 
@@ -293,18 +926,53 @@ func (state *FanOutState) FailFanOut(errorMessage string) error {
 	state.mu.Lock()
 	state.Status = FanOutStatusFailed
 	state.ErrorMessage = errorMessage
-	now := time.Now()
+	now := state.stateManager.now()
+	state.EndTime = &now
+	state.mu.Unlock()
+
+	return state.stateManager.persistState(state)
+}
+
+// CancelFanOut marks the fan-out as cancelled.
+func (state *FanOutState) CancelFanOut(errorMessage string) error {
+	state.mu.Lock()
+	state.Status = FanOutStatusCancelled
+	state.ErrorMessage = errorMessage
+	now := state.stateManager.now()
 	state.EndTime = &now
 	state.mu.Unlock()
 
 	return state.stateManager.persistState(state)
 }
 
+// InterruptFanOut marks the fan-out as interrupted. Its unfinished children keep their status,
+// for the process taking the fan-out over to run them.
+func (state *FanOutState) InterruptFanOut(errorMessage string) error {
+	state.mu.Lock()
+	state.Status = FanOutStatusInterrupted
+	state.ErrorMessage = errorMessage
+	now := state.stateManager.now()
+	state.EndTime = &now
+	state.mu.Unlock()
+
+	return state.stateManager.persistState(state)
+}
+
+// FinishRetry sets the status of a fan-out whose children were retried from those of all its
+// children, as a fan-out waiting for them does once they finished.
+func (state *FanOutState) FinishRetry() error {
+	state.mu.Lock()
+	state.settleStatus()
+	state.mu.Unlock()
+
+	return state.stateManager.persistState(state)
+}
+
 // TimeoutFanOut marks the fan-out as timed out.
 func (state *FanOutState) TimeoutFanOut() error {
 	state.mu.Lock()
 	state.Status = FanOutStatusTimedOut
-	now := time.Now()
+	now := state.stateManager.now()
 	state.EndTime = &now
 	state.mu.Unlock()
 
@@ -318,7 +986,9 @@ func (state *FanOutState) IsComplete() bool {
 
 	return state.Status == FanOutStatusCompleted ||
 		state.Status == FanOutStatusFailed ||
-		state.Status == FanOutStatusTimedOut
+		state.Status == FanOutStatusTimedOut ||
+		state.Status == FanOutStatusCancelled ||
+		state.Status == FanOutStatusInterrupted
 }
 
 // GetSummary returns a summary of the fan-out state.
@@ -347,12 +1017,39 @@ func (state *FanOutState) GetSummary() FanOutSummary {
 			summary.RunningChildren++
 		case ChildStatusPending:
 			summary.PendingChildren++
+		case ChildStatusSkipped:
+			summary.SkippedChildren++
+			if child.SkipReason == ChildSkipUnchanged {
+				summary.UnchangedChildren++
+			}
+		case ChildStatusCancelled:
+			summary.CancelledChildren++
 		}
 	}
 
 	return summary
 }
 
+// GetChildren returns copies of the child workflows of the fan-out, sorted by repository and
+// workflow.
+func (state *FanOutState) GetChildren() []ChildWorkflow {
+	state.mu.RLock()
+	defer state.mu.RUnlock()
+	state.loadDetails()
+
+	children := make([]ChildWorkflow, 0, len(state.Children))
+	for _, child := range state.Children {
+		children = append(children, *child)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].Repository != children[j].Repository {
+			return children[i].Repository < children[j].Repository
+		}
+		return children[i].Workflow < children[j].Workflow
+	})
+	return children
+}
+
 // FanOutSummary provides a summary view of fan-out state.
 type FanOutSummary struct {
 	ID                string       `json:"id"`
@@ -365,6 +1062,9 @@ type FanOutSummary struct {
 	TimedOutChildren  int          `json:"timed_out_children"`
 	RunningChildren   int          `json:"running_children"`
 	PendingChildren   int          `json:"pending_children"`
+	SkippedChildren   int          `json:"skipped_children,omitempty"`
+	CancelledChildren int          `json:"cancelled_children,omitempty"`
+	UnchangedChildren int          `json:"unchanged_children,omitempty"`
 	ErrorMessage      string       `json:"error_message,omitempty"`
 }
 
@@ -374,23 +1074,34 @@ func (state *FanOutState) checkAndUpdateStatus() {
 	if !state.WaitingForAll || state.Status != FanOutStatusWaiting {
 		return
 	}
+	state.settleStatus()
+}
 
+// settleStatus completes or fails the fan-out once none of its children is pending or running.
+// Must be called with state.mu held.
+func (state *FanOutState) settleStatus() {
 	allComplete := true
-	anyFailed := false
+	failed := 0
+	notRun := false
 
 	for _, child := range state.Children {
 		switch child.Status {
 		case ChildStatusPending, ChildStatusRunning:
 			allComplete = false
 		case ChildStatusFailed, ChildStatusTimedOut:
-			anyFailed = true
+			failed++
+		case ChildStatusSkipped, ChildStatusCancelled:
+			if child.SkipReason != ChildSkipUnchanged {
+				notRun = true
+			}
 		}
 	}
 
 	if allComplete {
-		now := time.Now()
+		now := state.stateManager.now()
 		state.EndTime = &now
-		if anyFailed {
+		// A threshold failure policy tolerates some failed children, but never children that did not run
+		if notRun || !state.FailurePolicy.tolerates(failed, len(state.Children)) {
 			state.Status = FanOutStatusFailed
 		} else {
 			state.Status = FanOutStatusCompleted
@@ -398,25 +1109,23 @@ func (state *FanOutState) checkAndUpdateStatus() {
 	}
 }
 
-// persistState saves the fan-out state to disk.
-// The state mutex should be held for reading by the caller.
+// persistState saves the fan-out state to disk and wakes up the goroutines waiting for it to change.
+// The state mutex must not be held by the caller.
 func (sm *FanOutStateManager) persistState(state *FanOutState) error {
-	stateFile := filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", state.ID))
-
-	// Read state data under lock, then release before I/O
-	state.mu.RLock()
-	data, err := json.MarshalIndent(state, "", "  ")
-	state.mu.RUnlock()
+	state.mu.Lock()
+	state.Revision++
+	state.mu.Unlock()
 
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %v", err)
-	}
+	state.notifyChanged()
 
-	if err := os.WriteFile(stateFile, data, 0644); err != nil {
-		return fmt.Errorf("failed to write state file: %v", err)
-	}
+	state.writes.mu.Lock()
+	defer state.writes.mu.Unlock()
+	return sm.writeState(state)
+}
 
-	return nil
+// claimDir returns the directory of the child claims of a fan-out.
+func (sm *FanOutStateManager) claimDir(stateID string) string {
+	return filepath.Join(sm.stateDir, "claims", stateID)
 }
 
 // loadStates loads all existing fan-out states from disk.
@@ -444,22 +1153,15 @@ func (sm *FanOutStateManager) loadStates() error {
 
 // loadStateFile loads a single state file from disk.
 func (sm *FanOutStateManager) loadStateFile(filename string) error {
-	stateFile := filepath.Join(sm.stateDir, filename)
-
-	data, err := os.ReadFile(stateFile)
+	state, err := sm.readStateFile(filepath.Join(sm.stateDir, filename))
 	if err != nil {
-		return fmt.Errorf("failed to read state file: %v", err)
-	}
-
-	var state FanOutState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return fmt.Errorf("failed to unmarshal state: %v", err)
+		return err
 	}
 
 	// Restore runtime fields
 	state.stateManager = sm
 
-	sm.states[state.ID] = &state
+	sm.states[state.ID] = state
 	return nil
 }
 
@@ -478,14 +1180,41 @@ func (sm *FanOutStateManager) ListActiveFanOuts() []FanOutSummary {
 	return active
 }
 
+// FanOutsOfRun returns the fan-outs started by the steps of a run, in the order they started.
+func (sm *FanOutStateManager) FanOutsOfRun(runID string) []*FanOutState {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var fanOuts []*FanOutState
+	for _, state := range sm.states {
+		if state.ParentRunID == runID {
+			fanOuts = append(fanOuts, state)
+		}
+	}
+	sort.Slice(fanOuts, func(i, j int) bool {
+		if !fanOuts[i].StartTime.Equal(fanOuts[j].StartTime) {
+			return fanOuts[i].StartTime.Before(fanOuts[j].StartTime)
+		}
+		return fanOuts[i].ID < fanOuts[j].ID
+	})
+	return fanOuts
+}
+
 // CleanupCompletedStates removes completed fan-out states older than the specified duration.
 // For idempotent states (those with fingerprint-based names), it uses the configured
 // idempotency retention period instead of the provided duration.
 func (sm *FanOutStateManager) CleanupCompletedStates(olderThan time.Duration) error {
+	_, err := sm.cleanupCompletedStates(olderThan)
+	return err
+}
+
+// cleanupCompletedStates removes the completed fan-out states like CleanupCompletedStates, and
+// returns the number of states removed.
+func (sm *FanOutStateManager) cleanupCompletedStates(olderThan time.Duration) (int, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	now := time.Now()
+	now := sm.now()
 	var toDelete []string
 
 	for id, state := range sm.states {
@@ -495,7 +1224,7 @@ func (sm *FanOutStateManager) CleanupCompletedStates(olderThan time.Duration) er
 
 		// Determine retention period based on state type
 		var retentionPeriod time.Duration
-		if sm.isIdempotentState(id) {
+		if state.Fingerprint != "" || sm.isIdempotentState(id) {
 			// Use idempotency retention for fingerprint-based states
 			retentionPeriod = sm.idempotencyRetention
 		} else {
@@ -509,17 +1238,169 @@ func (sm *FanOutStateManager) CleanupCompletedStates(olderThan time.Duration) er
 		}
 	}
 
-	for _, id := range toDelete {
-		stateFile := filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", id))
-		if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
-			return fmt.Errorf("failed to remove state file %s: %v", stateFile, err)
+	for i, id := range toDelete {
+		if err := sm.removeState(id); err != nil {
+			return i, err
 		}
-		delete(sm.states, id)
 	}
 
+	return len(toDelete), nil
+}
+
+// removeState removes a fan-out state, its journal, its spilled payloads, the shards and the
+// claims of its children, from disk and memory. Must be called with sm.mu held.
+func (sm *FanOutStateManager) removeState(id string) error {
+	if state, exists := sm.states[id]; exists {
+		state.closeWrites()
+	}
+	stateFile := filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", id))
+	if err := os.Remove(stateFile); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove state file %s: %v", stateFile, err)
+	}
+	if err := os.Remove(sm.journalFile(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove journal of %s: %v", id, err)
+	}
+	if err := os.RemoveAll(sm.shardDir(id)); err != nil {
+		return fmt.Errorf("failed to remove child shards of %s: %v", id, err)
+	}
+	if err := os.RemoveAll(sm.payloadDir(id)); err != nil {
+		return fmt.Errorf("failed to remove spilled payloads of %s: %v", id, err)
+	}
+	if err := os.RemoveAll(sm.claimDir(id)); err != nil {
+		return fmt.Errorf("failed to remove child claims of %s: %v", id, err)
+	}
+	delete(sm.states, id)
 	return nil
 }
 
+// IdempotentState describes the state of an idempotent fan-out: the fan-out of its event
+// fingerprint returns its result instead of triggering the subscribers again until it expires.
+type IdempotentState struct {
+	Fingerprint string `json:"fingerprint"`
+	SourceRepo  string `json:"source_repo"`
+	EventType   string `json:"event_type"`
+	Namespace   string `json:"namespace,omitempty"`
+	FanOutSummary
+	// ExpiresAt is when the retention of the finished fan-out ends; nil while it runs.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Expired reports whether the retention of the state ended at the given time.
+func (s IdempotentState) Expired(now time.Time) bool {
+	return s.ExpiresAt != nil && !now.Before(*s.ExpiresAt)
+}
+
+// ListIdempotentStates returns the states of the idempotent fan-outs, most recent first.
+func (sm *FanOutStateManager) ListIdempotentStates() []IdempotentState {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	var states []IdempotentState
+	for _, state := range sm.states {
+		if described, ok := sm.describeIdempotentState(state); ok {
+			states = append(states, described)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if !states[i].StartTime.Equal(states[j].StartTime) {
+			return states[i].StartTime.After(states[j].StartTime)
+		}
+		return states[i].Fingerprint < states[j].Fingerprint
+	})
+	return states
+}
+
+// GetIdempotentState returns the state of the idempotent fan-out of an event fingerprint, or nil
+// when there is none.
+func (sm *FanOutStateManager) GetIdempotentState(fingerprint string) (*IdempotentState, error) {
+	state, err := sm.GetFanOutStateByFingerprint(fingerprint)
+	if err != nil || state == nil {
+		return nil, err
+	}
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	described, _ := sm.describeIdempotentState(state)
+	return &described, nil
+}
+
+// describeIdempotentState describes a state, reporting whether it is idempotent. Must be called
+// with sm.mu held.
+func (sm *FanOutStateManager) describeIdempotentState(state *FanOutState) (IdempotentState, bool) {
+	fingerprint := state.Fingerprint
+	if fingerprint == "" && sm.isIdempotentState(state.ID) {
+		// States persisted before fingerprints were recorded only have it in their ID
+		fingerprint = strings.TrimPrefix(state.ID, "fanout-")
+	}
+	if fingerprint == "" {
+		return IdempotentState{}, false
+	}
+
+	state.mu.RLock()
+	described := IdempotentState{
+		Fingerprint: fingerprint,
+		SourceRepo:  state.SourceRepo,
+		EventType:   state.EventType,
+		Namespace:   state.Namespace,
+	}
+	state.mu.RUnlock()
+	described.FanOutSummary = state.GetSummary()
+	if state.IsComplete() && described.EndTime != nil {
+		expiresAt := described.EndTime.Add(sm.idempotencyRetention)
+		described.ExpiresAt = &expiresAt
+	}
+	return described, true
+}
+
+// Expired reports whether the retention of a finished idempotent fan-out ended, after which the
+// fan-out of its event triggers the subscribers again.
+func (sm *FanOutStateManager) Expired(state *FanOutState) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	described, ok := sm.describeIdempotentState(state)
+	return ok && described.Expired(sm.now())
+}
+
+// PurgeFingerprint removes the state of the idempotent fan-out of an event fingerprint, so that
+// the next fan-out of the event triggers the subscribers again. The fan-out must be finished.
+func (sm *FanOutStateManager) PurgeFingerprint(fingerprint string) error {
+	state, err := sm.GetFanOutStateByFingerprint(fingerprint)
+	if err != nil {
+		return err
+	}
+	if state == nil {
+		return fmt.Errorf("no fan-out state for fingerprint %s", fingerprint)
+	}
+	if !state.IsComplete() {
+		return fmt.Errorf("the fan-out of fingerprint %s is %s; cancel it before purging its state", fingerprint, state.GetSummary().Status)
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.removeState(state.ID)
+}
+
+// PurgeExpiredStates removes the states of the idempotent fan-outs whose retention ended and
+// returns their fingerprints.
+func (sm *FanOutStateManager) PurgeExpiredStates() ([]string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	now := sm.now()
+	var purged []string
+	for id, state := range sm.states {
+		described, ok := sm.describeIdempotentState(state)
+		if !ok || !described.Expired(now) {
+			continue
+		}
+		if err := sm.removeState(id); err != nil {
+			return purged, err
+		}
+		purged = append(purged, described.Fingerprint)
+	}
+	sort.Strings(purged)
+	return purged, nil
+}
+
 // isIdempotentState checks if a state ID represents an idempotent state
 // by checking if it follows the fingerprint-based naming pattern.
 func (sm *FanOutStateManager) isIdempotentState(stateID string) bool {
@@ -547,12 +1428,13 @@ func (sm *FanOutStateManager) isIdempotentState(stateID string) bool {
 // createStateAtomic creates a fan-out state using atomic file operations to handle race conditions.
 // If a state with the same ID already exists, it loads and returns the existing state.
 // Returns the state and a boolean indicating whether it was newly created (true) or existing (false).
-func (sm *FanOutStateManager) createStateAtomic(id, parentRunID, sourceRepo, eventType string, waitingForAll bool, timeout time.Duration) (*FanOutState, error) {
+// The fingerprint of an idempotent fan-out is recorded in the state.
+func (sm *FanOutStateManager) createStateAtomic(id, fingerprint, parentRunID, sourceRepo, eventType string, waitingForAll bool, timeout time.Duration) (*FanOutState, bool, error) {
 	// Check if state already exists in memory
 	sm.mu.RLock()
 	if existingState, exists := sm.states[id]; exists {
 		sm.mu.RUnlock()
-		return existingState, nil
+		return existingState, false, nil
 	}
 	sm.mu.RUnlock()
 
@@ -563,17 +1445,21 @@ func (sm *FanOutStateManager) createStateAtomic(id, parentRunID, sourceRepo, eve
 		SourceRepo:    sourceRepo,
 		EventType:     eventType,
 		Status:        FanOutStatusPending,
-		StartTime:     time.Now(),
+		StartTime:     sm.now(),
 		Children:      make(map[string]*ChildWorkflow),
 		WaitingForAll: waitingForAll,
 		Timeout:       timeout,
+		Namespace:     sm.namespace,
+		CorrelationID: sm.correlationID,
+		Fingerprint:   fingerprint,
+		SchemaVersion: FanOutStateSchemaVersion,
 		stateManager:  sm,
 	}
 
 	// Generate temporary filename with random UUID
 	tempID := make([]byte, 16)
 	if _, err := rand.Read(tempID); err != nil {
-		return nil, fmt.Errorf("failed to generate temp ID: %v", err)
+		return nil, false, fmt.Errorf("failed to generate temp ID: %v", err)
 	}
 	tempFileName := fmt.Sprintf("%s.tmp.%x", id, tempID)
 	tempFile := filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", tempFileName))
@@ -582,52 +1468,41 @@ func (sm *FanOutStateManager) createStateAtomic(id, parentRunID, sourceRepo, eve
 	// Marshal state data
 	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal state: %v", err)
+		return nil, false, fmt.Errorf("failed to marshal state: %v", err)
 	}
 
 	// Write to temporary file
 	if err := os.WriteFile(tempFile, data, 0644); err != nil {
-		return nil, fmt.Errorf("failed to write temp state file: %v", err)
+		return nil, false, fmt.Errorf("failed to write temp state file: %v", err)
 	}
 
-	// Attempt atomic rename
-	if err := os.Rename(tempFile, finalFile); err != nil {
-		// Clean up temp file
-		os.Remove(tempFile)
-
-		// Check if the rename failed because the target already exists
-		if os.IsExist(err) || (finalFile != "" && fileExists(finalFile)) {
-			// Another process won the race, load the existing state
-			if err := sm.loadStateFile(fmt.Sprintf("%s.json", id)); err != nil {
-				return nil, fmt.Errorf("failed to load existing state after race condition: %v", err)
-			}
-
-			sm.mu.RLock()
-			existingState, exists := sm.states[id]
-			sm.mu.RUnlock()
-
-			if !exists {
-				return nil, fmt.Errorf("state should exist after loading but not found: %s", id)
-			}
-
-			return existingState, nil
-		}
-
-		return nil, fmt.Errorf("failed to rename temp file to final state file: %v", err)
-	}
-
-	// Successfully created new state, add to memory
+	// Link the temporary file into place: unlike a rename, a link fails when the state file
+	// already exists, so exactly one of several concurrent processes creates the state. The
+	// manager lock makes the goroutines of this process agree on the state object too.
 	sm.mu.Lock()
-	sm.states[id] = state
-	sm.mu.Unlock()
-
-	return state, nil
-}
+	defer sm.mu.Unlock()
+	err = os.Link(tempFile, finalFile)
+	os.Remove(tempFile)
+	if err == nil {
+		sm.states[id] = state
+		return state, true, nil
+	}
+	if !os.IsExist(err) {
+		return nil, false, fmt.Errorf("failed to link temp file to final state file: %v", err)
+	}
 
-// fileExists checks if a file exists.
-func fileExists(path string) bool {
-	_, err := os.Stat(path)
-	return err == nil
+	// Another goroutine or process won the race, load the existing state
+	if existingState, exists := sm.states[id]; exists {
+		return existingState, false, nil
+	}
+	if err := sm.loadStateFile(fmt.Sprintf("%s.json", id)); err != nil {
+		return nil, false, fmt.Errorf("failed to load existing state after race condition: %v", err)
+	}
+	existingState, exists := sm.states[id]
+	if !exists {
+		return nil, false, fmt.Errorf("state should exist after loading but not found: %s", id)
+	}
+	return existingState, false, nil
 }
 
 // GenerateEventFingerprint generates a deterministic fingerprint for an event to enable idempotency.
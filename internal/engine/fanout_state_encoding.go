@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Encodings of the fan-out state files.
+const (
+	// StateEncodingJSON writes the states as indented JSON.
+	StateEncodingJSON = "json"
+	// StateEncodingCompact writes the states as gzipped gobs, whose child details are only
+	// decoded when they are needed. The state files keep their names, and are told apart from
+	// JSON ones by their gzip header.
+	StateEncodingCompact = "compact"
+)
+
+func init() {
+	// Event payloads decoded from JSON or YAML nest these types in their interface values
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+}
+
+// compactHeader is the first value of a compact state file: the fields other tools read
+// without decoding the rest of the state, such as the cache eviction.
+type compactHeader struct {
+	Status  FanOutStatus
+	EndTime *time.Time
+}
+
+// childDetails are the fields of a child that a compact state encodes apart from the others,
+// because neither the summaries of the fan-out nor the waiters need them.
+type childDetails struct {
+	Inputs         map[string]string
+	Outputs        map[string]string
+	ErrorMessage   string
+	Ref            string
+	Commit         string
+	PreviousRunIDs []string
+}
+
+// detachDetails removes the details of a child and returns them.
+func detachDetails(child *ChildWorkflow) childDetails {
+	details := childDetails{
+		Inputs:         child.Inputs,
+		Outputs:        child.Outputs,
+		ErrorMessage:   child.ErrorMessage,
+		Ref:            child.Ref,
+		Commit:         child.Commit,
+		PreviousRunIDs: child.PreviousRunIDs,
+	}
+	child.Inputs, child.Outputs, child.PreviousRunIDs = nil, nil, nil
+	child.ErrorMessage, child.Ref, child.Commit = "", "", ""
+	return details
+}
+
+// restore sets the details of a child.
+func (d childDetails) restore(child *ChildWorkflow) {
+	child.Inputs = d.Inputs
+	child.Outputs = d.Outputs
+	child.ErrorMessage = d.ErrorMessage
+	child.Ref = d.Ref
+	child.Commit = d.Commit
+	child.PreviousRunIDs = d.PreviousRunIDs
+}
+
+// lazyDetails are the encoded details of the children of a state read from a compact file.
+type lazyDetails struct {
+	once    sync.Once
+	encoded []byte
+}
+
+// loadDetails decodes the details of the children of a state read from a compact file the first
+// time they are needed. Methods reading or updating the details of children, or copying
+// children, call it first. Must be called with state.mu held, for reading or writing.
+func (state *FanOutState) loadDetails() {
+	lazy := state.details
+	if lazy == nil {
+		return
+	}
+	lazy.once.Do(func() {
+		var details map[string]childDetails
+		if err := gob.NewDecoder(bytes.NewReader(lazy.encoded)).Decode(&details); err != nil {
+			slog.Warn("failed to decode the details of the children of a fan-out state", "fanout", state.ID, "error", err)
+			return
+		}
+		for childID, detail := range details {
+			if child, exists := state.Children[childID]; exists {
+				detail.restore(child)
+			}
+		}
+	})
+}
+
+// encodeState encodes a state in the encoding of the manager. Must be called with state.mu
+// held for writing, with the details of the children loaded.
+func (sm *FanOutStateManager) encodeState(state *FanOutState) ([]byte, error) {
+	if sm.persistence.Encoding != StateEncodingCompact {
+		return json.MarshalIndent(state, "", "  ")
+	}
+
+	childIDs := make([]string, 0, len(state.Children))
+	for childID := range state.Children {
+		childIDs = append(childIDs, childID)
+	}
+	sort.Strings(childIDs)
+	summaries := make([]ChildWorkflow, 0, len(childIDs))
+	details := make(map[string]childDetails, len(childIDs))
+	for _, childID := range childIDs {
+		summary := *state.Children[childID]
+		summary.Result = nil
+		details[childID] = detachDetails(&summary)
+		summaries = append(summaries, summary)
+	}
+	var encodedDetails bytes.Buffer
+	if err := gob.NewEncoder(&encodedDetails).Encode(details); err != nil {
+		return nil, err
+	}
+
+	var data bytes.Buffer
+	compressed := gzip.NewWriter(&data)
+	encoder := gob.NewEncoder(compressed)
+	err := encoder.Encode(compactHeader{Status: state.Status, EndTime: state.EndTime})
+	if err == nil {
+		// The children are encoded as summaries and details instead
+		children := state.Children
+		state.Children = nil
+		err = encoder.Encode(state)
+		state.Children = children
+	}
+	if err == nil {
+		err = encoder.Encode(summaries)
+	}
+	if err == nil {
+		err = encoder.Encode(encodedDetails.Bytes())
+	}
+	if closeErr := compressed.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data.Bytes(), nil
+}
+
+// isCompactState reports whether the data of a state file is in the compact encoding.
+func isCompactState(data []byte) bool {
+	return len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b
+}
+
+// decodeCompactState decodes a state file in the compact encoding. The details of its children
+// are decoded when they are first needed, and it is not migrated.
+func decodeCompactState(data []byte) (*FanOutState, error) {
+	compressed, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	decoder := gob.NewDecoder(compressed)
+
+	var header compactHeader
+	var state FanOutState
+	var summaries []ChildWorkflow
+	var details []byte
+	for _, value := range []interface{}{&header, &state, &summaries, &details} {
+		if err := decoder.Decode(value); err != nil {
+			return nil, err
+		}
+	}
+
+	state.Children = make(map[string]*ChildWorkflow, len(summaries))
+	for i := range summaries {
+		child := &summaries[i]
+		state.Children[fmt.Sprintf("%s-%s", child.Repository, child.Workflow)] = child
+	}
+	if len(details) > 0 {
+		state.details = &lazyDetails{encoded: details}
+	}
+	return &state, nil
+}
+
+// decodeState decodes a state file in either encoding, upgrading it and its children to the
+// latest schema version, and returns the schema version it was written with.
+func decodeState(data []byte) (*FanOutState, int, error) {
+	if isCompactState(data) {
+		state, err := decodeCompactState(data)
+		if err != nil {
+			return nil, 0, err
+		}
+		if state.SchemaVersion == FanOutStateSchemaVersion {
+			return state, state.SchemaVersion, nil
+		}
+		// Older compact states are migrated through their JSON encoding, with the details of
+		// their children
+		state.loadDetails()
+		if data, err = json.Marshal(state); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	data, version, err := migrateState("fan-out", data, fanOutStateMigrations)
+	if err != nil {
+		return nil, 0, err
+	}
+	state := &FanOutState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, 0, err
+	}
+	return state, version, nil
+}
+
+// payloadDir returns the directory of the payloads spilled from a fan-out state.
+func (sm *FanOutStateManager) payloadDir(stateID string) string {
+	return filepath.Join(sm.stateDir, "payloads", stateID)
+}
+
+// spillPayloads returns the events with the payloads larger than the payload limit of the
+// manager truncated, after writing them to files of their own, and the names of those files by
+// event; nil when no payload is spilled.
+func (sm *FanOutStateManager) spillPayloads(stateID string, events []Event) ([]Event, []string, error) {
+	if sm.persistence.MaxPayloadSize <= 0 {
+		return events, nil, nil
+	}
+
+	var spilled []string
+	truncated := slices.Clone(events)
+	for i, event := range events {
+		payload, err := json.Marshal(event.Payload)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to marshal payload of event %s: %v", event.Type, err)
+		}
+		if len(payload) <= sm.persistence.MaxPayloadSize {
+			continue
+		}
+
+		key := sha256.Sum256(payload)
+		name := hex.EncodeToString(key[:16]) + ".json"
+		if err := os.MkdirAll(sm.payloadDir(stateID), 0755); err != nil {
+			return nil, nil, fmt.Errorf("failed to create payload directory: %v", err)
+		}
+		if err := replaceFile(filepath.Join(sm.payloadDir(stateID), name), payload, false); err != nil {
+			return nil, nil, fmt.Errorf("failed to spill payload of event %s: %v", event.Type, err)
+		}
+		if spilled == nil {
+			spilled = make([]string, len(events))
+		}
+		spilled[i] = name
+		truncated[i].Payload = nil
+	}
+	return truncated, spilled, nil
+}
@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/cache"
+)
+
+// populateStateForTest adds children with inputs and outputs to a state, failing one of them.
+func populateStateForTest(t *testing.T, state *FanOutState, children int) {
+	t.Helper()
+	registrations := make([]ChildRegistration, children)
+	for i := range registrations {
+		registrations[i] = ChildRegistration{
+			Repository: fmt.Sprintf("test-org/app-%03d", i),
+			Workflow:   "update",
+			Inputs:     map[string]string{"version": "1.2.0", "channel": "stable"},
+		}
+	}
+	state.AddChildWorkflows(registrations)
+	if err := state.SetChildOutputs("test-org/app-000", "update", map[string]string{"image": "app:1.2.0"}); err != nil {
+		t.Fatalf("SetChildOutputs() error = %v", err)
+	}
+	if err := state.UpdateChildStatus("test-org/app-001", "update", ChildStatusFailed, "run-1", "tests failed"); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+}
+
+func TestFanOutStateManager_CompactEncoding(t *testing.T) {
+	cacheDir := t.TempDir()
+	stateDir := filepath.Join(cacheDir, "fanout-states")
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+
+	jsonState, err := sm.CreateFanOutState("fanout-json", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	populateStateForTest(t, jsonState, 200)
+
+	sm.SetPersistence(StatePersistence{Encoding: StateEncodingCompact})
+	state, err := sm.CreateFanOutState("fanout-compact", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	if err := state.SetEvents([]Event{{Type: "library_built", Payload: map[string]interface{}{"version": "1.2.0", "tags": []interface{}{"stable", 1.0}}}}); err != nil {
+		t.Fatalf("SetEvents() error = %v", err)
+	}
+	populateStateForTest(t, state, 200)
+
+	compact, err := os.ReadFile(filepath.Join(stateDir, state.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	plain, err := os.ReadFile(filepath.Join(stateDir, jsonState.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	if !isCompactState(compact) || len(compact)*4 > len(plain) {
+		t.Errorf("expected the compact state to be a fraction of the JSON one, got %d and %d bytes", len(compact), len(plain))
+	}
+
+	// The cache tells running compact states from finished ones
+	entries, err := cache.Scan(cacheDir)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name == state.ID && !entry.Active {
+			t.Errorf("expected the compact state to be active")
+		}
+	}
+
+	reloaded, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	loaded, err := reloaded.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if summary := loaded.GetSummary(); summary.TotalChildren != 200 || summary.FailedChildren != 1 {
+		t.Errorf("expected the summary of the children, got %+v", summary)
+	}
+
+	// The details of the children are only decoded when they are needed
+	if child := loaded.Children["test-org/app-001-update"]; child.Inputs != nil || child.ErrorMessage != "" {
+		t.Errorf("expected the details to be decoded lazily, got %+v", child)
+	}
+	children := loaded.GetChildren()
+	if children[0].Outputs["image"] != "app:1.2.0" || children[1].ErrorMessage != "tests failed" || children[2].Inputs["channel"] != "stable" {
+		t.Errorf("expected the details of the children, got %+v", children[:3])
+	}
+	if events, err := loaded.GetEvents(); err != nil || len(events) != 1 || events[0].Payload["tags"].([]interface{})[0] != "stable" {
+		t.Errorf("expected the events with their payloads, got %+v, %v", events, err)
+	}
+}
+
+func TestFanOutStateManager_SpillsLargePayloads(t *testing.T) {
+	stateDir := t.TempDir()
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	sm.SetPersistence(StatePersistence{MaxPayloadSize: 64})
+
+	state, err := sm.CreateFanOutState("fanout-spilled", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	changelog := strings.Repeat("fixed a bug; ", 100)
+	if err := state.SetEvents([]Event{
+		{Type: "library_built", Payload: map[string]interface{}{"version": "1.2.0"}},
+		{Type: "library_released", Payload: map[string]interface{}{"version": "1.2.0", "changelog": changelog}},
+	}); err != nil {
+		t.Fatalf("SetEvents() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(stateDir, state.ID+".json"))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	if strings.Contains(string(data), "fixed a bug") || !strings.Contains(string(data), `"version": "1.2.0"`) {
+		t.Errorf("expected only the large payload to be truncated from the state:\n%s", data)
+	}
+	spilled, err := os.ReadDir(sm.payloadDir(state.ID))
+	if err != nil || len(spilled) != 1 {
+		t.Fatalf("expected the large payload to be spilled to a file, got %d, %v", len(spilled), err)
+	}
+
+	// The events are read back whole, also by other processes
+	reloaded, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	loaded, err := reloaded.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	events, err := loaded.GetEvents()
+	if err != nil {
+		t.Fatalf("GetEvents() error = %v", err)
+	}
+	if len(events) != 2 || events[0].Payload["version"] != "1.2.0" || events[1].Payload["changelog"] != changelog {
+		t.Errorf("expected the events with their whole payloads, got %+v", events)
+	}
+
+	// Removing the state removes its spilled payloads
+	if err := state.CompleteFanOut(); err != nil {
+		t.Fatalf("CompleteFanOut() error = %v", err)
+	}
+	if err := sm.CleanupCompletedStates(-time.Hour); err != nil {
+		t.Fatalf("CleanupCompletedStates() error = %v", err)
+	}
+	if _, err := os.Stat(sm.payloadDir(state.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the spilled payloads to be removed with the state, got %v", err)
+	}
+}
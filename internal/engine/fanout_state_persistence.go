@@ -0,0 +1,474 @@
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// StatePersistence configures how the fan-out states are written to disk. The zero value writes
+// the whole state on every update.
+type StatePersistence struct {
+	// FlushInterval is how long the updates of the children of a fan-out are batched before the
+	// state is written. Batched updates are appended to the journal of the state, which the
+	// next load and the waiters of other processes replay, so that none is lost when the process
+	// dies. Updates settling the status of the fan-out are written at once.
+	FlushInterval time.Duration
+	// SyncInterval is how often the journal is synced to disk; after every update when zero.
+	SyncInterval time.Duration
+	// ShardChildren writes each child of the fan-outs with at least this many children to its
+	// own file, so that an update writes the children it changed rather than all of them; never
+	// when zero.
+	ShardChildren int
+	// Encoding is the encoding of the state files, StateEncodingJSON when empty.
+	Encoding string
+	// MaxPayloadSize is the size, as JSON, above which the payloads of the events of a fan-out
+	// are spilled to files of their own and truncated from its state; never when zero.
+	MaxPayloadSize int
+}
+
+// StatePersistenceFromSettings returns the state persistence of the settings of the user
+// configuration.
+func StatePersistenceFromSettings(settings config.StatePersistenceSettings) (StatePersistence, error) {
+	persistence := StatePersistence{
+		ShardChildren:  settings.ShardChildren,
+		Encoding:       settings.Encoding,
+		MaxPayloadSize: settings.MaxPayloadSize,
+	}
+	for _, interval := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"flush_interval", settings.FlushInterval, &persistence.FlushInterval},
+		{"sync_interval", settings.SyncInterval, &persistence.SyncInterval},
+	} {
+		if interval.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(interval.value)
+		if err != nil {
+			return StatePersistence{}, fmt.Errorf("invalid %s '%s': %v", interval.name, interval.value, err)
+		}
+		*interval.field = duration
+	}
+	return persistence, nil
+}
+
+// stateWrites tracks the writes of a fan-out state. Its mutex serializes them, so that an older
+// state file never replaces a newer one and the journal is only emptied of the updates the state
+// file includes.
+type stateWrites struct {
+	mu            sync.Mutex
+	journal       *os.File        // Journal of the batched updates; nil when none is open
+	lastSync      time.Time       // When the journal was last synced to disk
+	flushTimer    *time.Timer     // Writes the batched updates; nil when none is batched
+	flushedStatus FanOutStatus    // Status of the fan-out in the state file
+	dirty         map[string]bool // Children updated since the state file was written
+	replayed      bool            // The journal was replayed when the state was loaded
+	removed       bool            // The state was removed and is not written anymore
+}
+
+// journalEntry is an update of a child recorded in the journal of a fan-out state.
+type journalEntry struct {
+	Revision uint64         `json:"revision"`
+	ChildID  string         `json:"child_id"`
+	Child    *ChildWorkflow `json:"child"`
+}
+
+// SetPersistence sets how the manager writes the states. It must be set before the states are
+// updated.
+func (sm *FanOutStateManager) SetPersistence(persistence StatePersistence) {
+	sm.persistence = persistence
+}
+
+// journalFile returns the journal of the batched updates of a fan-out state.
+func (sm *FanOutStateManager) journalFile(stateID string) string {
+	return filepath.Join(sm.stateDir, stateID+".journal")
+}
+
+// shardDir returns the directory of the children of a sharded fan-out state.
+func (sm *FanOutStateManager) shardDir(stateID string) string {
+	return filepath.Join(sm.stateDir, "shards", stateID)
+}
+
+// shardFile returns the file of a child of a sharded fan-out state.
+func (sm *FanOutStateManager) shardFile(stateID, childID string) string {
+	key := sha256.Sum256([]byte(childID))
+	return filepath.Join(sm.shardDir(stateID), hex.EncodeToString(key[:16])+".json")
+}
+
+// persistChildren saves the updates of children of the fan-out state and wakes up the goroutines
+// waiting for it to change, like persistState. Unless they settle the status of the fan-out, the
+// updates are appended to the journal and batched for the flush interval. The state mutex must
+// not be held by the caller.
+func (sm *FanOutStateManager) persistChildren(state *FanOutState, childIDs ...string) error {
+	if sm.persistence.FlushInterval <= 0 && sm.persistence.ShardChildren <= 0 {
+		return sm.persistState(state)
+	}
+
+	state.mu.Lock()
+	state.loadDetails()
+	state.Revision++
+	var entries bytes.Buffer
+	var err error
+	for _, childID := range childIDs {
+		var entry []byte
+		if entry, err = json.Marshal(journalEntry{Revision: state.Revision, ChildID: childID, Child: state.Children[childID]}); err != nil {
+			break
+		}
+		// Entries start on a new line, so that an entry partially written by a process that
+		// died does not corrupt the next one
+		entries.WriteByte('\n')
+		entries.Write(entry)
+	}
+	status := state.Status
+	state.mu.Unlock()
+
+	state.notifyChanged()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal journal entry: %v", err)
+	}
+
+	writes := &state.writes
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+	if writes.removed {
+		return nil
+	}
+	if writes.dirty == nil {
+		writes.dirty = make(map[string]bool)
+	}
+	for _, childID := range childIDs {
+		writes.dirty[childID] = true
+	}
+	if sm.persistence.FlushInterval <= 0 || status != writes.flushedStatus {
+		return sm.writeState(state)
+	}
+
+	if err := sm.appendJournal(state, entries.Bytes()); err != nil {
+		return err
+	}
+	if writes.flushTimer == nil {
+		writes.flushTimer = time.AfterFunc(sm.persistence.FlushInterval, func() {
+			if err := sm.flushState(state); err != nil {
+				slog.Warn("failed to flush fan-out state", "fanout", state.ID, "error", err)
+			}
+		})
+	}
+	return nil
+}
+
+// appendJournal appends entries to the journal of a state, syncing it to disk at most every
+// sync interval. Must be called with state.writes.mu held.
+func (sm *FanOutStateManager) appendJournal(state *FanOutState, entries []byte) error {
+	writes := &state.writes
+	if writes.journal == nil {
+		journal, err := os.OpenFile(sm.journalFile(state.ID), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("failed to open journal: %v", err)
+		}
+		writes.journal = journal
+	}
+	if _, err := writes.journal.Write(entries); err != nil {
+		return fmt.Errorf("failed to write journal: %v", err)
+	}
+	if sm.persistence.SyncInterval <= 0 || sm.now().Sub(writes.lastSync) >= sm.persistence.SyncInterval {
+		if err := writes.journal.Sync(); err != nil {
+			return fmt.Errorf("failed to sync journal: %v", err)
+		}
+		writes.lastSync = sm.now()
+	}
+	return nil
+}
+
+// writeState writes the state file, and the shards of the children updated since it was last
+// written when the state is sharded, then empties the journal, whose updates the state file now
+// includes. Must be called with state.writes.mu held, and not state.mu.
+func (sm *FanOutStateManager) writeState(state *FanOutState) error {
+	writes := &state.writes
+	if writes.removed {
+		return nil
+	}
+	stateFile := filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", state.ID))
+
+	state.mu.Lock()
+	state.loadDetails()
+	if !state.ChildShards && sm.persistence.ShardChildren > 0 && len(state.Children) >= sm.persistence.ShardChildren {
+		// Every child is written to its shard once, when the state starts being sharded
+		state.ChildShards = true
+		writes.dirty = make(map[string]bool, len(state.Children))
+		for childID := range state.Children {
+			writes.dirty[childID] = true
+		}
+	}
+	var data []byte
+	var err error
+	shards := make(map[string][]byte)
+	if state.ChildShards {
+		for childID := range writes.dirty {
+			if child, exists := state.Children[childID]; exists {
+				if shards[childID], err = json.MarshalIndent(child, "", "  "); err != nil {
+					break
+				}
+			}
+		}
+		if err == nil {
+			children := state.Children
+			state.Children = nil
+			data, err = sm.encodeState(state)
+			state.Children = children
+		}
+	} else {
+		data, err = sm.encodeState(state)
+	}
+	status := state.Status
+	state.mu.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %v", err)
+	}
+	if err := sm.faults.fail(FaultStatePersist, state.ID); err != nil {
+		return err
+	}
+	if err := sm.faults.writePartially(stateFile, data, state.ID); err != nil {
+		return err
+	}
+
+	// The journal is only emptied once the files including its updates are on disk
+	durable := sm.persistence.FlushInterval > 0
+	if len(shards) > 0 {
+		if err := os.MkdirAll(sm.shardDir(state.ID), 0755); err != nil {
+			return fmt.Errorf("failed to create shard directory: %v", err)
+		}
+	}
+	for childID, shard := range shards {
+		if err := replaceFile(sm.shardFile(state.ID, childID), shard, durable); err != nil {
+			return fmt.Errorf("failed to write shard of child %s: %v", childID, err)
+		}
+	}
+	// Replace the file atomically so that other processes never read a partial state
+	if err := replaceFile(stateFile, data, durable); err != nil {
+		return fmt.Errorf("failed to write state file: %v", err)
+	}
+
+	writes.flushedStatus = status
+	writes.dirty = nil
+	if writes.flushTimer != nil {
+		writes.flushTimer.Stop()
+		writes.flushTimer = nil
+	}
+	if writes.journal != nil || writes.replayed {
+		if writes.journal != nil {
+			writes.journal.Close()
+			writes.journal = nil
+		}
+		writes.replayed = false
+		if err := os.Truncate(sm.journalFile(state.ID), 0); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to empty journal: %v", err)
+		}
+	}
+	return nil
+}
+
+// flushState writes the updates of the children of a state batched since it was last written.
+func (sm *FanOutStateManager) flushState(state *FanOutState) error {
+	writes := &state.writes
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+
+	if writes.flushTimer != nil {
+		writes.flushTimer.Stop()
+		writes.flushTimer = nil
+	}
+	if len(writes.dirty) == 0 {
+		return nil
+	}
+	return sm.writeState(state)
+}
+
+// Flush writes the updates of the children of the states that are batched for the flush
+// interval, and returns the first error.
+func (sm *FanOutStateManager) Flush() error {
+	sm.mu.RLock()
+	states := make([]*FanOutState, 0, len(sm.states))
+	for _, state := range sm.states {
+		states = append(states, state)
+	}
+	sm.mu.RUnlock()
+
+	var firstErr error
+	for _, state := range states {
+		if err := sm.flushState(state); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// closeWrites stops writing a state that is removed, discarding its batched updates.
+func (state *FanOutState) closeWrites() {
+	writes := &state.writes
+	writes.mu.Lock()
+	defer writes.mu.Unlock()
+
+	if writes.flushTimer != nil {
+		writes.flushTimer.Stop()
+		writes.flushTimer = nil
+	}
+	if writes.journal != nil {
+		writes.journal.Close()
+		writes.journal = nil
+	}
+	writes.removed = true
+}
+
+// readStateFile reads a state file, with the shards of its children and the updates of its
+// journal that are newer than the file, upgrading them all to the latest schema version.
+func (sm *FanOutStateManager) readStateFile(stateFile string) (*FanOutState, error) {
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state file: %v", err)
+	}
+
+	state, version, err := decodeState(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode state: %v", err)
+	}
+	if state.Children == nil {
+		state.Children = make(map[string]*ChildWorkflow)
+	}
+	if state.ID == "" {
+		return state, nil
+	}
+
+	// The children stored apart from the state file are of its schema version
+	var fanOut map[string]interface{}
+	migrateChild := func(child *ChildWorkflow) error {
+		if version == FanOutStateSchemaVersion {
+			return nil
+		}
+		if fanOut == nil {
+			fields, err := fanOutFields(state)
+			if err != nil {
+				return err
+			}
+			fanOut = fields
+		}
+		data, err := json.Marshal(child)
+		if err == nil {
+			data, err = migrateFanOutChild(data, version, fanOut)
+		}
+		if err == nil {
+			*child = ChildWorkflow{}
+			err = json.Unmarshal(data, child)
+		}
+		return err
+	}
+
+	if state.ChildShards {
+		entries, err := os.ReadDir(sm.shardDir(state.ID))
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read child shards: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(sm.shardDir(state.ID), entry.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read child shard: %v", err)
+			}
+			var child ChildWorkflow
+			if err := json.Unmarshal(data, &child); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal child shard %s: %v", entry.Name(), err)
+			}
+			if err := migrateChild(&child); err != nil {
+				return nil, fmt.Errorf("failed to migrate child shard %s: %v", entry.Name(), err)
+			}
+			childID := fmt.Sprintf("%s-%s", child.Repository, child.Workflow)
+			state.Children[childID] = &child
+			if version != FanOutStateSchemaVersion {
+				// The upgraded shards are written with the upgraded state
+				if state.writes.dirty == nil {
+					state.writes.dirty = make(map[string]bool)
+				}
+				state.writes.dirty[childID] = true
+			}
+		}
+	}
+
+	journal, err := os.ReadFile(sm.journalFile(state.ID))
+	if err != nil || len(journal) == 0 {
+		return state, nil
+	}
+	var updates []journalEntry
+	for _, line := range bytes.Split(journal, []byte("\n")) {
+		var entry journalEntry
+		// The last entry may be partially written by a process that died
+		if len(line) == 0 || json.Unmarshal(line, &entry) != nil || entry.Child == nil {
+			continue
+		}
+		if entry.Revision > state.Revision {
+			if err := migrateChild(entry.Child); err != nil {
+				return nil, fmt.Errorf("failed to migrate journal entry of child %s: %v", entry.ChildID, err)
+			}
+			updates = append(updates, entry)
+		}
+	}
+	// Updates persisted concurrently may be appended out of order
+	sort.SliceStable(updates, func(i, j int) bool { return updates[i].Revision < updates[j].Revision })
+	if len(updates) > 0 {
+		// The details of compact states would otherwise replace those of the updates
+		state.loadDetails()
+	}
+	for _, update := range updates {
+		state.Children[update.ChildID] = update.Child
+		state.Revision = update.Revision
+		if state.ChildShards {
+			// The shards of the replayed children are written with the state, which empties the journal
+			if state.writes.dirty == nil {
+				state.writes.dirty = make(map[string]bool)
+			}
+			state.writes.dirty[update.ChildID] = true
+		}
+	}
+	state.writes.replayed = true
+	return state, nil
+}
+
+// replaceFile replaces a file with data atomically through a temporary file, syncing the data to
+// disk first when durable.
+func replaceFile(file string, data []byte, durable bool) error {
+	tempFile, err := os.CreateTemp(filepath.Dir(file), strings.TrimSuffix(filepath.Base(file), ".json")+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write(data)
+	if err == nil && durable {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tempFile.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), file)
+	}
+	return err
+}
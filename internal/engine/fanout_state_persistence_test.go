@@ -0,0 +1,238 @@
+package engine
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// readStateFileForTest returns the state file of a fan-out as it is on disk.
+func readStateFileForTest(t *testing.T, stateDir, id string) *FanOutState {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(stateDir, id+".json"))
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+	var state FanOutState
+	if err := json.Unmarshal(data, &state); err != nil {
+		t.Fatalf("failed to unmarshal state file: %v", err)
+	}
+	return &state
+}
+
+func TestFanOutStateManager_WriteBehind(t *testing.T) {
+	stateDir := t.TempDir()
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	sm.SetPersistence(StatePersistence{FlushInterval: time.Hour})
+
+	state, err := sm.CreateFanOutState("fanout-batched", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	state.AddChildWorkflows([]ChildRegistration{
+		{Repository: "test-org/app-1", Workflow: "update"},
+		{Repository: "test-org/app-2", Workflow: "update"},
+	})
+	if err := state.UpdateChildStatus("test-org/app-1", "update", ChildStatusRunning, "run-1", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+
+	// The updates of the children are batched in the journal
+	if onDisk := readStateFileForTest(t, stateDir, state.ID); len(onDisk.Children) != 0 {
+		t.Errorf("expected the children not to be written yet, got %d", len(onDisk.Children))
+	}
+
+	// A process that died before the flush loses none of them, even with a torn last entry
+	journal, err := os.OpenFile(sm.journalFile(state.ID), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+	journal.WriteString("\n{\"revision\":99,\"child_id\":\"test-org/app-2-upd")
+	journal.Close()
+	reloaded, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	recovered, err := reloaded.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if got := recovered.GetChildStatus("test-org/app-1", "update"); got != ChildStatusRunning {
+		t.Errorf("expected the journaled status of app-1 to be replayed, got %q", got)
+	}
+	if got := recovered.GetChildStatus("test-org/app-2", "update"); got != ChildStatusPending {
+		t.Errorf("expected app-2 to be replayed as pending, got %q", got)
+	}
+
+	// Waiters of other processes see the journaled updates
+	if err := state.UpdateChildStatus("test-org/app-2", "update", ChildStatusRunning, "run-2", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+	if err := reloaded.refreshState(recovered); err != nil {
+		t.Fatalf("refreshState() error = %v", err)
+	}
+	if got := recovered.GetChildStatus("test-org/app-2", "update"); got != ChildStatusRunning {
+		t.Errorf("expected the waiter to see app-2 running, got %q", got)
+	}
+
+	// Updates settling the status of the fan-out are written at once, with the batched ones
+	if err := state.StartWaiting(); err != nil {
+		t.Fatalf("StartWaiting() error = %v", err)
+	}
+	state.UpdateChildStatus("test-org/app-1", "update", ChildStatusCompleted, "", "")
+	if onDisk := readStateFileForTest(t, stateDir, state.ID); onDisk.Status != FanOutStatusWaiting || onDisk.Children["test-org/app-1-update"].Status != ChildStatusRunning {
+		t.Errorf("expected the completion of app-1 to be batched, got %s with app-1 %s", onDisk.Status, onDisk.Children["test-org/app-1-update"].Status)
+	}
+	state.UpdateChildStatus("test-org/app-2", "update", ChildStatusCompleted, "", "")
+	onDisk := readStateFileForTest(t, stateDir, state.ID)
+	if onDisk.Status != FanOutStatusCompleted || onDisk.Children["test-org/app-1-update"].Status != ChildStatusCompleted {
+		t.Errorf("expected the completed fan-out to be written, got %s with app-1 %s", onDisk.Status, onDisk.Children["test-org/app-1-update"].Status)
+	}
+	if info, err := os.Stat(sm.journalFile(state.ID)); err != nil || info.Size() != 0 {
+		t.Errorf("expected the journal to be emptied once written, got %v, %v", info, err)
+	}
+}
+
+func TestFanOutStateManager_FlushInterval(t *testing.T) {
+	stateDir := t.TempDir()
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	sm.SetPersistence(StatePersistence{FlushInterval: 10 * time.Millisecond, SyncInterval: time.Hour})
+
+	state, err := sm.CreateFanOutState("fanout-flushed", "", "test-org/lib", "library_built", false, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	state.AddChildWorkflow("test-org/app", "update", nil)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(readStateFileForTest(t, stateDir, state.ID).Children) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the batched child to be written after the flush interval")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestFanOutStateManager_ShardChildren(t *testing.T) {
+	stateDir := t.TempDir()
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	sm.SetPersistence(StatePersistence{ShardChildren: 3})
+
+	state, err := sm.CreateFanOutState("fanout-sharded", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	state.AddChildWorkflow("test-org/app-1", "update", nil)
+	if onDisk := readStateFileForTest(t, stateDir, state.ID); onDisk.ChildShards || len(onDisk.Children) != 1 {
+		t.Fatalf("expected a state below the threshold to keep its children, got %+v", onDisk)
+	}
+
+	// Once the threshold is reached, every child is written to its own file
+	state.AddChildWorkflows([]ChildRegistration{
+		{Repository: "test-org/app-2", Workflow: "update"},
+		{Repository: "test-org/app-3", Workflow: "update"},
+	})
+	if onDisk := readStateFileForTest(t, stateDir, state.ID); !onDisk.ChildShards || len(onDisk.Children) != 0 {
+		t.Errorf("expected the children to be left out of the state file, got %d", len(onDisk.Children))
+	}
+	shards, err := os.ReadDir(sm.shardDir(state.ID))
+	if err != nil || len(shards) != 3 {
+		t.Fatalf("expected a shard per child, got %d, %v", len(shards), err)
+	}
+
+	// An update writes the shard of its child only
+	shard := sm.shardFile(state.ID, "test-org/app-1-update")
+	before, _ := os.Stat(shard)
+	time.Sleep(20 * time.Millisecond)
+	if err := state.UpdateChildStatus("test-org/app-2", "update", ChildStatusFailed, "run-2", "boom"); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+	if after, _ := os.Stat(shard); !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("expected the shard of app-1 not to be written again")
+	}
+
+	reloaded, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	loaded, err := reloaded.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if children := loaded.GetChildren(); len(children) != 3 || children[1].Status != ChildStatusFailed || children[1].ErrorMessage != "boom" {
+		t.Errorf("expected the children to be loaded from their shards, got %+v", children)
+	}
+
+	// Removing the state removes its shards
+	if err := state.CancelFanOut("cancelled"); err != nil {
+		t.Fatalf("CancelFanOut() error = %v", err)
+	}
+	if err := sm.CleanupCompletedStates(-time.Hour); err != nil {
+		t.Fatalf("CleanupCompletedStates() error = %v", err)
+	}
+	if _, err := os.Stat(sm.shardDir(state.ID)); !os.IsNotExist(err) {
+		t.Errorf("expected the shards to be removed with the state, got %v", err)
+	}
+}
+
+func TestFanOutStateManager_ReplaysJournalIntoShards(t *testing.T) {
+	stateDir := t.TempDir()
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	persistence := StatePersistence{FlushInterval: time.Hour, ShardChildren: 1}
+	sm.SetPersistence(persistence)
+
+	state, err := sm.CreateFanOutState("fanout-replayed", "", "test-org/lib", "library_built", true, 0)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	state.AddChildWorkflows([]ChildRegistration{
+		{Repository: "test-org/app-1", Workflow: "update"},
+		{Repository: "test-org/app-2", Workflow: "update"},
+	})
+	if err := state.StartWaiting(); err != nil {
+		t.Fatalf("StartWaiting() error = %v", err)
+	}
+	if err := state.UpdateChildStatus("test-org/app-1", "update", ChildStatusRunning, "run-1", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+
+	// The process taking over the state writes the replayed update of app-1 to its shard
+	reloaded, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	reloaded.SetPersistence(persistence)
+	recovered, err := reloaded.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if err := recovered.CancelFanOut("cancelled"); err != nil {
+		t.Fatalf("CancelFanOut() error = %v", err)
+	}
+
+	final, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	loaded, err := final.GetFanOutState(state.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if got := loaded.GetChildStatus("test-org/app-1", "update"); got != ChildStatusRunning {
+		t.Errorf("expected the replayed status of app-1 to be written to its shard, got %q", got)
+	}
+}
@@ -1,10 +1,13 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 	"time"
 
@@ -233,6 +236,49 @@ func TestUpdateChildStatusWithFailure(t *testing.T) {
 	}
 }
 
+func TestSetChildLockOwner(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+
+	state, err := manager.CreateFanOutState("test-fanout", "", "org/repo", "build", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create fan-out state: %v", err)
+	}
+	state.AddChildWorkflow("target/repo1", "deploy", map[string]string{})
+
+	if err := state.SetChildLockOwner("target/repo1", "deploy", "run-123"); err != nil {
+		t.Fatalf("Failed to set lock owner: %v", err)
+	}
+
+	// Lock ownership survives a reload so resume knows which children held locks
+	reloaded, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to reload state manager: %v", err)
+	}
+	reloadedState, err := reloaded.GetFanOutState("test-fanout")
+	if err != nil {
+		t.Fatalf("Failed to get reloaded state: %v", err)
+	}
+	if owner := reloadedState.Children["target/repo1-deploy"].LockOwner; owner != "run-123" {
+		t.Errorf("Expected persisted lock owner run-123, got %q", owner)
+	}
+
+	// Clearing the owner records the release
+	if err := state.SetChildLockOwner("target/repo1", "deploy", ""); err != nil {
+		t.Fatalf("Failed to clear lock owner: %v", err)
+	}
+	if owner := state.Children["target/repo1-deploy"].LockOwner; owner != "" {
+		t.Errorf("Expected lock owner to be cleared, got %q", owner)
+	}
+
+	if err := state.SetChildLockOwner("missing/repo", "deploy", "run-123"); err == nil {
+		t.Error("Expected error for unknown child workflow")
+	}
+}
+
 func TestFanOutStateTransitions(t *testing.T) {
 	tempDir := t.TempDir()
 	manager, err := NewFanOutStateManager(tempDir)
@@ -900,7 +946,7 @@ func TestCreateStateAtomic(t *testing.T) {
 	id := "fanout-atomic-test"
 
 	// Create state atomically
-	state, err := manager.createStateAtomic(id, "parent-123", "org/repo", "test_event", true, 5*time.Minute)
+	state, _, err := manager.createStateAtomic(id, "", "parent-123", "org/repo", "test_event", true, 5*time.Minute)
 	if err != nil {
 		t.Fatalf("Failed to create state atomically: %v", err)
 	}
@@ -937,7 +983,7 @@ func TestCreateStateAtomicRaceCondition(t *testing.T) {
 	id := "fanout-race-test"
 
 	// Create state with first manager
-	state1, err := manager1.createStateAtomic(id, "parent-123", "org/repo", "test_event", true, 5*time.Minute)
+	state1, _, err := manager1.createStateAtomic(id, "", "parent-123", "org/repo", "test_event", true, 5*time.Minute)
 	if err != nil {
 		t.Fatalf("Failed to create state with first manager: %v", err)
 	}
@@ -949,10 +995,13 @@ func TestCreateStateAtomicRaceCondition(t *testing.T) {
 	}
 
 	// Attempt to create state with same ID using second manager
-	state2, err := manager2.createStateAtomic(id, "parent-456", "org/repo2", "test_event2", false, 10*time.Minute)
+	state2, created, err := manager2.createStateAtomic(id, "", "parent-456", "org/repo2", "test_event2", false, 10*time.Minute)
 	if err != nil {
 		t.Fatalf("Failed to handle existing state: %v", err)
 	}
+	if created {
+		t.Errorf("Expected the existing state not to be reported as created")
+	}
 
 	// Should return the existing state properties (loaded from disk)
 	if state2.ID != state1.ID {
@@ -963,6 +1012,199 @@ func TestCreateStateAtomicRaceCondition(t *testing.T) {
 	}
 }
 
+func TestFanOutState_ClaimChild(t *testing.T) {
+	tempDir := t.TempDir()
+	manager1, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create first state manager: %v", err)
+	}
+	state1, created, err := manager1.CreateIdempotentFanOutState("claims", "", "org/source", "test_event", true, 0)
+	if err != nil || !created {
+		t.Fatalf("Failed to create state: %v (created: %v)", err, created)
+	}
+
+	// A second process sees the same fan-out
+	manager2, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create second state manager: %v", err)
+	}
+	state2, created, err := manager2.CreateIdempotentFanOutState("claims", "", "org/source", "test_event", true, 0)
+	if err != nil || created {
+		t.Fatalf("Expected the existing state, got %v (created: %v)", err, created)
+	}
+
+	if claimed, err := state1.ClaimChild("org/repo", "build", nil, "run-1"); err != nil || !claimed {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", claimed, err)
+	}
+	if claimed, err := state2.ClaimChild("org/repo", "build", nil, "run-2"); err != nil || claimed {
+		t.Errorf("Expected claim of another process to fail, got %v, %v", claimed, err)
+	}
+	if claimed, err := state2.ClaimChild("org/repo", "deploy", nil, "run-2"); err != nil || !claimed {
+		t.Errorf("Expected claim of another child to succeed, got %v, %v", claimed, err)
+	}
+	if claimed, err := state2.ClaimChild("org/repo", "build", map[string]string{"env": "prod"}, "run-2"); err != nil || !claimed {
+		t.Errorf("Expected claim of the workflow with other inputs to succeed, got %v, %v", claimed, err)
+	}
+
+	// Cleaning up the state once its retention ended removes its claims
+	clock := NewFakeClock(time.Now())
+	manager1.SetClock(clock)
+	state1.CompleteFanOut()
+	clock.Advance(DefaultIdempotencyRetention + time.Minute)
+	if err := manager1.CleanupCompletedStates(-time.Hour); err != nil {
+		t.Fatalf("Failed to clean up states: %v", err)
+	}
+	if _, err := os.Stat(manager1.claimDir(state1.ID)); !os.IsNotExist(err) {
+		t.Errorf("Expected claims to be removed with the state, got %v", err)
+	}
+}
+
+// deadProcessID returns the PID of a process that already exited.
+func deadProcessID(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command("git", "--version")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Failed to run a process: %v", err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestFanOutState_ClaimChildTakeover(t *testing.T) {
+	tempDir := t.TempDir()
+	manager, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	state, _, err := manager.CreateIdempotentFanOutState("takeover", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-1"); err != nil || !claimed {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", claimed, err)
+	}
+	claimFiles, _ := filepath.Glob(filepath.Join(manager.claimDir(state.ID), "*"))
+	if len(claimFiles) != 1 {
+		t.Fatalf("Expected one claim file, got %v", claimFiles)
+	}
+	rewriteClaim := func(update func(*childClaim)) {
+		t.Helper()
+		data, err := os.ReadFile(claimFiles[0])
+		if err != nil {
+			t.Fatalf("Failed to read claim: %v", err)
+		}
+		var claim childClaim
+		if err := json.Unmarshal(data, &claim); err != nil {
+			t.Fatalf("Failed to parse claim: %v", err)
+		}
+		update(&claim)
+		data, _ = json.Marshal(claim)
+		if err := os.WriteFile(claimFiles[0], data, 0644); err != nil {
+			t.Fatalf("Failed to write claim: %v", err)
+		}
+	}
+
+	// A live owner within its lease keeps the claim
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-2"); err != nil || claimed {
+		t.Errorf("Expected the claim of a live owner to hold, got %v, %v", claimed, err)
+	}
+
+	// The claim of an owner that died is taken over, once
+	rewriteClaim(func(claim *childClaim) { claim.PID = deadProcessID(t) })
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-2"); err != nil || !claimed {
+		t.Errorf("Expected the claim of a dead owner to be taken over, got %v, %v", claimed, err)
+	}
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-3"); err != nil || claimed {
+		t.Errorf("Expected the claim taken over to hold, got %v, %v", claimed, err)
+	}
+
+	// An expired lease is taken over too
+	rewriteClaim(func(claim *childClaim) { claim.ExpiresAt = time.Now().Add(-time.Minute) })
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-3"); err != nil || !claimed {
+		t.Errorf("Expected an expired claim to be taken over, got %v, %v", claimed, err)
+	}
+
+	// A child that finished is never triggered again
+	state.AddChildWorkflow("org/repo", "build", nil)
+	state.UpdateChildStatus("org/repo", "build", ChildStatusCompleted, "run-3", "")
+	rewriteClaim(func(claim *childClaim) { claim.PID = deadProcessID(t) })
+	if claimed, err := state.ClaimChild("org/repo", "build", nil, "run-4"); err != nil || claimed {
+		t.Errorf("Expected the claim of a finished child to hold, got %v, %v", claimed, err)
+	}
+}
+
+func TestFanOutState_ClaimRenewedByHeartbeats(t *testing.T) {
+	tempDir := t.TempDir()
+	manager1, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	clock := NewFakeClock(time.Now())
+	manager1.SetClock(clock)
+	state1, _, err := manager1.CreateIdempotentFanOutState("renewal", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	if claimed, err := state1.ClaimChild("org/repo", "build", nil, "run-1"); err != nil || !claimed {
+		t.Fatalf("Expected first claim to succeed, got %v, %v", claimed, err)
+	}
+	state1.AddChildWorkflow("org/repo", "build", nil)
+	state1.UpdateChildStatus("org/repo", "build", ChildStatusRunning, "run-1", "")
+
+	// A child running for longer than a lease keeps its claim while its heartbeats renew it
+	clock.Advance(defaultClaimLease - time.Minute)
+	if err := state1.HeartbeatChild("org/repo", "build"); err != nil {
+		t.Fatalf("HeartbeatChild() error = %v", err)
+	}
+	clock.Advance(defaultClaimLease - time.Minute)
+	if claimed, err := state1.ClaimChild("org/repo", "build", nil, "run-2"); err != nil || claimed {
+		t.Errorf("Expected the renewed claim to hold, got %v, %v", claimed, err)
+	}
+
+	// Once the heartbeats stop, the lease expires, but a child another process finished is
+	// not triggered again even though this process still sees it running
+	manager2, err := NewFanOutStateManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	state2, err := manager2.GetFanOutState(state1.ID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if err := state2.UpdateChildStatus("org/repo", "build", ChildStatusCompleted, "run-1", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+	clock.Advance(defaultClaimLease)
+	if claimed, err := state1.ClaimChild("org/repo", "build", nil, "run-2"); err != nil || claimed {
+		t.Errorf("Expected the claim of a child finished by another process to hold, got %v, %v", claimed, err)
+	}
+}
+
+func TestFanOutState_Abandoned(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	state, err := manager.CreateFanOutState("abandoned", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	state.StartFanOut()
+	if state.Abandoned() {
+		t.Error("Expected a fan-out of this process not to be abandoned")
+	}
+	state.OwnerPID = deadProcessID(t)
+	if !state.Abandoned() {
+		t.Error("Expected a running fan-out of a dead process to be abandoned")
+	}
+	state.CompleteFanOut()
+	state.OwnerPID = deadProcessID(t)
+	if state.Abandoned() {
+		t.Error("Expected a completed fan-out not to be abandoned")
+	}
+}
+
 func TestIdempotencyRetentionConfiguration(t *testing.T) {
 	tempDir := t.TempDir()
 	manager, err := NewFanOutStateManager(tempDir)
@@ -1113,6 +1355,61 @@ func TestCleanupCompletedStatesWithIdempotencyRetention(t *testing.T) {
 	}
 }
 
+func TestIdempotentStates(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	clock := NewFakeClock(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+	manager.SetClock(clock)
+	manager.SetIdempotencyRetention(time.Hour)
+
+	finished, _, err := manager.CreateIdempotentFanOutState("event-1", "", "org/lib", "released", false, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	if err := finished.CompleteFanOut(); err != nil {
+		t.Fatalf("Failed to complete fan-out: %v", err)
+	}
+	clock.Advance(time.Minute)
+	if _, _, err := manager.CreateIdempotentFanOutState("event-2", "", "org/lib", "released", false, 0); err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	if _, err := manager.CreateFanOutState("fanout-1-released", "", "org/lib", "released", false, 0); err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+
+	states := manager.ListIdempotentStates()
+	if len(states) != 2 || states[0].Fingerprint != "event-2" || states[1].Fingerprint != "event-1" {
+		t.Fatalf("expected the idempotent states most recent first, got %+v", states)
+	}
+	if states[0].ExpiresAt != nil || states[1].ExpiresAt == nil || !states[1].ExpiresAt.Equal(finished.EndTime.Add(time.Hour)) {
+		t.Errorf("expected only the finished state to expire, got %+v", states)
+	}
+
+	if err := manager.PurgeFingerprint("event-2"); err == nil || !strings.Contains(err.Error(), "cancel it before purging") {
+		t.Errorf("expected a running fan-out not to be purged, got %v", err)
+	}
+	if err := manager.PurgeFingerprint("event-3"); err == nil {
+		t.Errorf("expected an unknown fingerprint to be rejected")
+	}
+
+	clock.Advance(time.Hour)
+	if !manager.Expired(finished) {
+		t.Errorf("expected the state to expire after the retention")
+	}
+	purged, err := manager.PurgeExpiredStates()
+	if err != nil || len(purged) != 1 || purged[0] != "event-1" {
+		t.Fatalf("PurgeExpiredStates() = %v, %v", purged, err)
+	}
+	if state, err := manager.GetIdempotentState("event-1"); err != nil || state != nil {
+		t.Errorf("expected the expired state to be purged, got %+v, %v", state, err)
+	}
+	if _, err := os.Stat(filepath.Join(manager.stateDir, "fanout-event-1.json")); !os.IsNotExist(err) {
+		t.Errorf("expected the state file to be removed, got %v", err)
+	}
+}
+
 // Test subscription fingerprinting functionality.
 func TestGenerateSubscriptionFingerprint(t *testing.T) {
 	eventFingerprint := "test-event-fingerprint-abc123"
@@ -1,12 +1,20 @@
 package engine
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
 )
 
 func TestNewFanOutExecutor(t *testing.T) {
@@ -141,6 +149,26 @@ func TestFanOutExecutor_parseFanOutParams(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "strict inputs",
+			withParams: map[string]interface{}{
+				"event_type":    "library_built",
+				"strict_inputs": true,
+			},
+			expected: &FanOutParams{
+				EventType:    "library_built",
+				Payload:      map[string]interface{}{},
+				StrictInputs: true,
+			},
+		},
+		{
+			name: "invalid strict_inputs type",
+			withParams: map[string]interface{}{
+				"event_type":    "library_built",
+				"strict_inputs": "yes",
+			},
+			expectError: true,
+		},
 		{
 			name: "invalid timeout type",
 			withParams: map[string]interface{}{
@@ -173,6 +201,99 @@ func TestFanOutExecutor_parseFanOutParams(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "targets and exclude",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"targets":    []interface{}{"my-org/*", "other-org/app"},
+				"exclude":    "my-org/legacy-*",
+			},
+			expected: &FanOutParams{
+				EventType: "library_built",
+				Payload:   map[string]interface{}{},
+				Targets:   []string{"my-org/*", "other-org/app"},
+				Exclude:   []string{"my-org/legacy-*"},
+			},
+		},
+		{
+			name: "invalid targets type",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"targets":    []interface{}{"my-org/*", 1},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid exclude pattern",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"exclude":    []interface{}{"my-org/[app"},
+			},
+			expectError: true,
+		},
+		{
+			name: "pinned refs",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"refs":       map[string]interface{}{"my-org/app": "main@abc1234", "my-org/lib": "v1.2.0"},
+			},
+			expected: &FanOutParams{
+				EventType: "library_built",
+				Payload:   map[string]interface{}{},
+				Refs:      map[string]string{"my-org/app": "main@abc1234", "my-org/lib": "v1.2.0"},
+			},
+		},
+		{
+			name: "invalid pinned commit",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"refs":       map[string]interface{}{"my-org/app": "main@not-a-sha"},
+			},
+			expectError: true,
+		},
+		{
+			name: "invalid refs repository",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"refs":       map[string]interface{}{"my-org/app:main": "main"},
+			},
+			expectError: true,
+		},
+		{
+			name: "batch of events",
+			withParams: map[string]interface{}{
+				"events": []interface{}{
+					map[string]interface{}{"event_type": "library_built", "payload": map[string]interface{}{"version": "2.1.0"}},
+					map[string]interface{}{"event_type": "docs_built", "event_id": "docs-2.1.0"},
+				},
+			},
+			expected: &FanOutParams{
+				EventType: "library_built,docs_built",
+				Payload:   map[string]interface{}{},
+			},
+		},
+		{
+			name: "empty batch",
+			withParams: map[string]interface{}{
+				"events": []interface{}{},
+			},
+			expectError: true,
+		},
+		{
+			name: "batch event without type",
+			withParams: map[string]interface{}{
+				"events": []interface{}{map[string]interface{}{"payload": map[string]interface{}{}}},
+			},
+			expectError: true,
+		},
+		{
+			name: "batch with top-level event_type",
+			withParams: map[string]interface{}{
+				"event_type": "library_built",
+				"events":     []interface{}{map[string]interface{}{"event_type": "docs_built"}},
+			},
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -206,6 +327,20 @@ func TestFanOutExecutor_parseFanOutParams(t *testing.T) {
 			if params.SchemaVersion != tt.expected.SchemaVersion {
 				t.Errorf("SchemaVersion = %v, want %v", params.SchemaVersion, tt.expected.SchemaVersion)
 			}
+			if strings.Join(params.Targets, ",") != strings.Join(tt.expected.Targets, ",") {
+				t.Errorf("Targets = %v, want %v", params.Targets, tt.expected.Targets)
+			}
+			if strings.Join(params.Exclude, ",") != strings.Join(tt.expected.Exclude, ",") {
+				t.Errorf("Exclude = %v, want %v", params.Exclude, tt.expected.Exclude)
+			}
+			if len(params.Refs) != len(tt.expected.Refs) {
+				t.Errorf("Refs = %v, want %v", params.Refs, tt.expected.Refs)
+			}
+			for repository, ref := range tt.expected.Refs {
+				if params.Refs[repository] != ref {
+					t.Errorf("Refs[%s] = %v, want %v", repository, params.Refs[repository], ref)
+				}
+			}
 
 			// Check payload
 			if len(params.Payload) != len(tt.expected.Payload) {
@@ -655,6 +790,16 @@ subscriptions:
 	if result1.FanOutID == result3.FanOutID {
 		t.Errorf("Expected different FanOutID for different events, got same: %s", result1.FanOutID)
 	}
+
+	// Execute again once the retention of the first state ended - should be replayed
+	executor.SetIdempotencyRetention(time.Nanosecond)
+	result4, err := executor.Execute(step, sourceRepo)
+	if err != nil {
+		t.Fatalf("Fourth execution failed: %v", err)
+	}
+	if result4.TriggeredCount != 1 || result4.FanOutID != result1.FanOutID {
+		t.Errorf("Expected the expired event to trigger again under the same FanOutID, got %d triggered in %s", result4.TriggeredCount, result4.FanOutID)
+	}
 }
 
 func TestFanOutExecutor_IdempotencyDisabled(t *testing.T) {
@@ -1019,7 +1164,7 @@ func TestFanOutExecutor_DiamondDependencyResolution(t *testing.T) {
 	}
 
 	// Test diamond dependency resolution
-	triggeredCount, errors, detailedErrors := executor.triggerSubscribersWithState(subscribers, event, params, state)
+	triggeredCount, errors, detailedErrors := executor.triggerSubscribersWithState(context.Background(), subscribers, event, params, state)
 
 	// Should only trigger 2 workflows: org/repo1:build.yml (winner) and org/repo3:test.yml (different workflow)
 	if triggeredCount != 2 {
@@ -1114,7 +1259,7 @@ func TestFanOutExecutor_DiamondDependencyWithDifferentInputs(t *testing.T) {
 	}
 
 	// Test - should trigger both because inputs are different
-	triggeredCount, errors, _ := executor.triggerSubscribersWithState(subscribers, event, params, state)
+	triggeredCount, errors, _ := executor.triggerSubscribersWithState(context.Background(), subscribers, event, params, state)
 
 	// Should trigger both workflows since they have different inputs
 	if triggeredCount != 2 {
@@ -1173,7 +1318,7 @@ func TestFanOutExecutor_DiamondDependencyWhitespaceNormalization(t *testing.T) {
 	}
 
 	// Test - should only trigger one due to normalization
-	triggeredCount, errors, _ := executor.triggerSubscribersWithState(subscribers, event, params, state)
+	triggeredCount, errors, _ := executor.triggerSubscribersWithState(context.Background(), subscribers, event, params, state)
 
 	// Should only trigger 1 workflow due to whitespace normalization
 	if triggeredCount != 1 {
@@ -1236,7 +1381,7 @@ func TestFanOutExecutor_DiamondDependencyMultipleFilters(t *testing.T) {
 	}
 
 	// Test - should trigger 2: first two are diamonds (only trigger repo1), third has different filters
-	triggeredCount, errors, _ := executor.triggerSubscribersWithState(subscribers, event, params, state)
+	triggeredCount, errors, _ := executor.triggerSubscribersWithState(context.Background(), subscribers, event, params, state)
 
 	// Should trigger 2 workflows: repo1 (winner of diamond) + repo3 (different filters)
 	if triggeredCount != 2 {
@@ -1486,3 +1631,595 @@ func TestResolveDiamondDependencies_ErrorHandling(t *testing.T) {
 		t.Errorf("Expected no errors with single input, got: %v", errors)
 	}
 }
+
+func TestResolveDiamonds_Strategies(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, NewTestMockWorkflowRunner())
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	subscription := func(repository string, priority int, inputs map[string]string) SubscriptionMatch {
+		return SubscriptionMatch{Repository: repository, Subscription: config.Subscription{Workflow: "update", Priority: priority, Inputs: inputs}}
+	}
+	subscribers := []SubscriptionMatch{
+		subscription("org/a", 0, map[string]string{"version": "{{ .event.payload.version }}"}),
+		subscription("org/b", 10, map[string]string{"version": "{{ .event.payload.version }}"}),
+		subscription("org/c", 0, map[string]string{"version": "{{ .event.payload.version }}", "channel": "beta"}),
+	}
+
+	unique, resolutions, _ := executor.resolveDiamonds(subscribers, "event", config.DiamondStrategyPriority)
+	if len(unique) != 2 || len(resolutions) != 1 || resolutions[0].winner.Repository != "org/b" {
+		t.Fatalf("expected the subscription of highest priority to win, got %+v", resolutions)
+	}
+	if record := resolutions[0].record("library_built"); record.Winner != "org/b:update" || !reflect.DeepEqual(record.Losers, []string{"org/a:update"}) {
+		t.Errorf("unexpected record %+v", record)
+	}
+
+	unique, resolutions, _ = executor.resolveDiamonds(subscribers, "event", config.DiamondStrategyMergeInputs)
+	if len(unique) != 1 || len(resolutions) != 1 || len(resolutions[0].losers) != 2 {
+		t.Fatalf("expected the subscriptions differing by inputs to be merged, got %+v", resolutions)
+	}
+	want := map[string]string{"version": "{{ .event.payload.version }}", "channel": "beta"}
+	if unique[0].Repository != "org/a" || !reflect.DeepEqual(unique[0].Subscription.Inputs, want) {
+		t.Errorf("expected org/a to win with the merged inputs, got %+v", unique[0])
+	}
+	if _, ok := subscribers[0].Subscription.Inputs["channel"]; ok {
+		t.Errorf("expected the inputs of the subscription not to be modified")
+	}
+
+	if record := (diamondResolution{strategy: config.DiamondStrategyFail, winner: subscribers[0], losers: subscribers[1:2]}).record("library_built"); record.Winner != "" || len(record.Losers) != 2 {
+		t.Errorf("expected no winner under the fail strategy, got %+v", record)
+	}
+}
+
+func TestFanOutExecutor_DiamondStrategies(t *testing.T) {
+	tempDir := t.TempDir()
+	takoYml := `version: "1.0"
+workflows:
+  update:
+    steps:
+      - run: echo "update triggered"
+subscriptions:
+  - artifact: "source-org/library:default"
+    events: ["library_built"]
+    workflow: "update"
+`
+	for _, repo := range []string{"repo1", "repo2"} {
+		repoPath := filepath.Join(tempDir, "repos", "test-org", repo, "main")
+		if err := os.MkdirAll(repoPath, 0755); err != nil {
+			t.Fatalf("Failed to create test repo directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+			t.Fatalf("Failed to write tako.yml: %v", err)
+		}
+	}
+
+	executor, err := NewFanOutExecutor(tempDir, false, NewTestMockWorkflowRunner())
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{"event_type": "library_built", "payload": map[string]interface{}{"version": "2.1.0"}},
+	}
+
+	result, err := executor.Execute(step, "source-org/library")
+	if err != nil {
+		t.Fatalf("Execution failed: %v", err)
+	}
+	want := []DiamondResolution{{EventType: "library_built", Strategy: config.DiamondStrategyFirst, Winner: "test-org/repo1:update", Losers: []string{"test-org/repo2:update"}}}
+	if result.TriggeredCount != 1 || !reflect.DeepEqual(result.Diamonds, want) {
+		t.Errorf("expected the diamond to be resolved for the first repository, got %d triggered and %+v", result.TriggeredCount, result.Diamonds)
+	}
+
+	executor.SetDiamondStrategies(&config.EventsConfig{DiamondStrategies: map[string]string{"library_built": config.DiamondStrategyFail}})
+	result, err = executor.Execute(step, "source-org/library")
+	if err == nil || !strings.Contains(err.Error(), "diamond_strategy is fail") {
+		t.Fatalf("expected the diamond to fail the fan-out, got %v", err)
+	}
+	if result.TriggeredCount != 0 || len(result.Diamonds) != 1 || len(result.Diamonds[0].Losers) != 2 {
+		t.Errorf("expected no child to be triggered, got %d triggered and %+v", result.TriggeredCount, result.Diamonds)
+	}
+}
+
+// orderRecordingWorkflowRunner records the order in which child workflows are started.
+type orderRecordingWorkflowRunner struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *orderRecordingWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	r.mu.Lock()
+	r.order = append(r.order, repoPath)
+	r.mu.Unlock()
+
+	return &interfaces.ExecutionResult{
+		RunID:     fmt.Sprintf("run-%s", workflowName),
+		Success:   true,
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	}, nil
+}
+
+func TestFanOutExecutor_SchedulesByPriority(t *testing.T) {
+	runner := &orderRecordingWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	subscription := func(workflow string, priority int) config.Subscription {
+		return config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   []string{"library_built"},
+			Workflow: workflow,
+			Priority: priority,
+		}
+	}
+	subscriptions := []interfaces.SubscriptionMatch{
+		{Repository: "org/repo-a", Subscription: subscription("low", -1)},
+		{Repository: "org/repo-b", Subscription: subscription("normal", 0)},
+		{Repository: "org/repo-c", Subscription: subscription("critical", 50)},
+	}
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type":        "library_built",
+			"concurrency_limit": 1,
+		},
+	}
+
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if result.TriggeredCount != 3 {
+		t.Fatalf("Expected 3 triggered workflows, got %d (errors: %v)", result.TriggeredCount, result.Errors)
+	}
+
+	// With a concurrency limit of one, children start strictly in priority order
+	expected := []string{"org/repo-c", "org/repo-b", "org/repo-a"}
+	for i, repo := range expected {
+		if runner.order[i] != repo {
+			t.Errorf("Expected child %d to be %s, got %s", i, repo, runner.order[i])
+		}
+	}
+}
+
+func TestFanOutExecutor_TargetingFilters(t *testing.T) {
+	runner := &orderRecordingWorkflowRunner{}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	// Distinct workflows keep diamond resolution from merging the subscriptions
+	subscription := func(workflow string) config.Subscription {
+		return config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   []string{"library_built"},
+			Workflow: workflow,
+		}
+	}
+	subscriptions := []interfaces.SubscriptionMatch{
+		{Repository: "my-org/canary-a", Subscription: subscription("update-a")},
+		{Repository: "my-org/canary-b", Subscription: subscription("update-b")},
+		{Repository: "my-org/service", Subscription: subscription("update-service")},
+		{Repository: "other-org/canary-c", Subscription: subscription("update-c")},
+	}
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type": "library_built",
+			"targets":    []interface{}{"*/canary-*"},
+			"exclude":    []interface{}{"other-org/*"},
+		},
+	}
+
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if result.SubscribersFound != 4 || result.TargetedOut != 2 || result.TriggeredCount != 2 {
+		t.Fatalf("Expected 4 found, 2 targeted out and 2 triggered, got %d, %d and %d (errors: %v)",
+			result.SubscribersFound, result.TargetedOut, result.TriggeredCount, result.Errors)
+	}
+
+	sort.Strings(runner.order)
+	triggered := strings.Join(runner.order, ",")
+	if triggered != "my-org/canary-a,my-org/canary-b" {
+		t.Errorf("Expected only the my-org canaries to be triggered, got %s", triggered)
+	}
+}
+
+func TestFilterTargetedSubscribers(t *testing.T) {
+	subscribers := []SubscriptionMatch{
+		{Repository: "my-org/app"},
+		{Repository: "my-org/lib"},
+		{Repository: "other-org/app"},
+	}
+
+	tests := []struct {
+		name     string
+		targets  []string
+		exclude  []string
+		expected []string
+	}{
+		{"no filters", nil, nil, []string{"my-org/app", "my-org/lib", "other-org/app"}},
+		{"targets only", []string{"my-org/*"}, nil, []string{"my-org/app", "my-org/lib"}},
+		{"exclude only", nil, []string{"*/app"}, []string{"my-org/lib"}},
+		{"targets and exclude", []string{"*/app", "my-org/lib"}, []string{"other-org/*"}, []string{"my-org/app", "my-org/lib"}},
+		{"no match", []string{"missing/*"}, nil, []string{}},
+		{"star does not cross the slash", []string{"*"}, nil, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filtered := filterTargetedSubscribers(subscribers, tt.targets, tt.exclude)
+			repos := make([]string, 0, len(filtered))
+			for _, subscriber := range filtered {
+				repos = append(repos, subscriber.Repository)
+			}
+			if strings.Join(repos, ",") != strings.Join(tt.expected, ",") {
+				t.Errorf("Expected %v, got %v", tt.expected, repos)
+			}
+		})
+	}
+}
+
+func TestFanOutExecutor_ExactlyOnceAcrossProcesses(t *testing.T) {
+	cacheDir := t.TempDir()
+	runner := &failingRepoWorkflowRunner{}
+	subscriptions := rolloutSubscriptions(3)
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"payload":           map[string]interface{}{"version": "4.0.0"},
+	}}
+
+	// Each executor has its own state manager, as concurrent tako processes sharing a cache do
+	const emitters = 4
+	results := make([]*FanOutResult, emitters)
+	var wg sync.WaitGroup
+	for i := 0; i < emitters; i++ {
+		executor, err := NewFanOutExecutor(cacheDir, false, runner)
+		if err != nil {
+			t.Fatalf("Failed to create executor: %v", err)
+		}
+		executor.SetIdempotency(true)
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+			if err != nil {
+				t.Errorf("Emitter %d failed: %v", i, err)
+				return
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+
+	if len(runner.order) != len(subscriptions) {
+		t.Fatalf("Expected each of the %d children to run once, got %v", len(subscriptions), runner.order)
+	}
+	triggered := 0
+	for i, result := range results {
+		if result == nil {
+			continue
+		}
+		if !result.Success {
+			t.Errorf("Emitter %d should succeed, got errors: %v", i, result.Errors)
+		}
+		triggered += result.TriggeredCount
+	}
+	if triggered != len(subscriptions) {
+		t.Errorf("Expected %d children triggered across emitters, got %d", len(subscriptions), triggered)
+	}
+}
+
+// outputsWorkflowRunner returns the repository of each child as its declared outputs.
+type outputsWorkflowRunner struct{}
+
+func (outputsWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	return &interfaces.ExecutionResult{
+		RunID:     fmt.Sprintf("run-%s", workflowName),
+		Success:   true,
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+		Outputs:   map[string]string{"repository": repoPath},
+	}, nil
+}
+
+func TestFanOutExecutor_RecordsChildOutputs(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, outputsWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2))
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+
+	state, err := executor.stateManager.GetFanOutState(result.FanOutID)
+	if err != nil {
+		t.Fatalf("Failed to get fan-out state: %v", err)
+	}
+	for _, child := range state.Children {
+		if child.Outputs["repository"] != child.Repository {
+			t.Errorf("Expected the outputs of %s to be recorded, got %v", child.Repository, child.Outputs)
+		}
+	}
+	if len(state.Children) != 2 {
+		t.Errorf("Expected 2 children, got %d", len(state.Children))
+	}
+}
+
+func TestFanOutExecutor_TakesOverAbandonedFanOut(t *testing.T) {
+	cacheDir := t.TempDir()
+	runner := &failingRepoWorkflowRunner{}
+	subscriptions := rolloutSubscriptions(3)
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"payload":           map[string]interface{}{"version": "5.0.0"},
+	}}
+
+	executor, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	executor.SetIdempotency(true)
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil || !result.Success {
+		t.Fatalf("Fan-out failed: %v %v", err, result.Errors)
+	}
+
+	// Make it look like the process died while the child of repo-3 was running
+	state, err := executor.stateManager.GetFanOutState(result.FanOutID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	deadPID := deadProcessID(t)
+	state.mu.Lock()
+	state.Status = FanOutStatusRunning
+	state.EndTime = nil
+	state.OwnerPID = deadPID
+	state.Children["test-org/repo-3-update-3"].Status = ChildStatusRunning
+	state.Children["test-org/repo-3-update-3"].LockOwner = "run-dead"
+	state.mu.Unlock()
+	if err := executor.stateManager.persistState(state); err != nil {
+		t.Fatalf("Failed to persist state: %v", err)
+	}
+	if interrupted := state.InterruptedChildren(); len(interrupted) != 1 || interrupted[0].Repository != "test-org/repo-3" {
+		t.Errorf("Expected the child of repo-3 to be interrupted, got %+v", interrupted)
+	}
+
+	// The dead process still holds the lock of repo-3
+	if err := executor.repoLocks.WaitForLock(context.Background(), "run-dead", "", "test-org/repo-3", LockTypeWrite); err != nil {
+		t.Fatalf("Failed to lock repo-3: %v", err)
+	}
+	lockFile := filepath.Join(executor.repoLocks.lockDir, executor.repoLocks.getLockKey("test-org/repo-3", LockTypeWrite)+".lock")
+	data, err := os.ReadFile(lockFile)
+	if err != nil {
+		t.Fatalf("Failed to read lock file: %v", err)
+	}
+	var lockInfo LockInfo
+	json.Unmarshal(data, &lockInfo)
+	lockInfo.ProcessID = deadPID
+	data, _ = json.Marshal(lockInfo)
+	os.WriteFile(lockFile, data, 0644)
+	claimFiles, _ := filepath.Glob(filepath.Join(executor.stateManager.claimDir(state.ID), "*"))
+	for _, claimFile := range claimFiles {
+		data, _ := os.ReadFile(claimFile)
+		var claim childClaim
+		if err := json.Unmarshal(data, &claim); err != nil {
+			t.Fatalf("Failed to parse claim: %v", err)
+		}
+		claim.PID = deadPID
+		data, _ = json.Marshal(claim)
+		os.WriteFile(claimFile, data, 0644)
+	}
+
+	// A later emitter of the same event triggers only the child that did not finish
+	other, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	other.SetIdempotency(true)
+	result, err = other.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil || !result.Success {
+		t.Fatalf("Takeover failed: %v %v", err, result.Errors)
+	}
+	if result.TriggeredCount != 1 || len(runner.order) != 4 || runner.order[3] != "test-org/repo-3" {
+		t.Errorf("Expected only repo-3 to run again, got %d triggered and %v", result.TriggeredCount, runner.order)
+	}
+}
+
+func TestFanOutExecutor_BatchEvents(t *testing.T) {
+	cacheDir := t.TempDir()
+	runner := &inputsRecordingWorkflowRunner{inputs: make(map[string]map[string]string)}
+	executor, err := NewFanOutExecutor(cacheDir, false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	subscription := func(workflow string, events ...string) config.Subscription {
+		return config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   events,
+			Workflow: workflow,
+			Inputs:   map[string]string{"version": "{{ .payload.version }}"},
+		}
+	}
+	subscriptions := []interfaces.SubscriptionMatch{
+		{Repository: "org/app", Subscription: subscription("update-app", "library_built")},
+		{Repository: "org/docs", Subscription: subscription("update-docs", "docs_built")},
+		// Subscribes to both events of the batch: triggered once, by the first
+		{Repository: "org/site", Subscription: subscription("update-site", "library_built", "docs_built")},
+	}
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"wait_for_children": true,
+		"events": []interface{}{
+			map[string]interface{}{"event_type": "library_built", "payload": map[string]interface{}{"version": "2.0.0"}},
+			map[string]interface{}{"event_type": "docs_built", "payload": map[string]interface{}{"version": "2.0.1"}},
+		},
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	if !result.Success || result.SubscribersFound != 4 || result.BatchDuplicates != 1 || result.TriggeredCount != 3 {
+		t.Fatalf("expected 4 found, 1 batch duplicate and 3 triggered, got %d, %d and %d (errors: %v)",
+			result.SubscribersFound, result.BatchDuplicates, result.TriggeredCount, result.Errors)
+	}
+	for repository, version := range map[string]string{"org/app": "2.0.0", "org/docs": "2.0.1", "org/site": "2.0.0"} {
+		if got := runner.inputs[repository]["version"]; got != version {
+			t.Errorf("expected %s to receive version %s from its event, got %q", repository, version, got)
+		}
+	}
+
+	// The children of every event belong to a single fan-out
+	state, err := executor.stateManager.GetFanOutState(result.FanOutID)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if state.EventType != "library_built,docs_built" || len(state.GetChildren()) != 3 {
+		t.Errorf("expected one state with the children of both events, got %s with %d children", state.EventType, len(state.GetChildren()))
+	}
+
+	audit, err := NewAuditLog(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to open audit log: %v", err)
+	}
+	entries, err := audit.Entries(result.FanOutID)
+	if err != nil {
+		t.Fatalf("failed to read entries: %v", err)
+	}
+	emitted := 0
+	for _, entry := range entries {
+		if entry.Decision == AuditEventEmitted {
+			emitted++
+		}
+		if entry.Decision == AuditSubscriptionRejected && entry.Repository == "org/site" && entry.Reason != "already triggered by event 'library_built' of the batch" {
+			t.Errorf("expected the duplicate trigger to be explained, got %q", entry.Reason)
+		}
+	}
+	if emitted != 2 {
+		t.Errorf("expected both events to be emitted, got %d", emitted)
+	}
+}
+
+func TestFanOutExecutor_BatchEventsAtomic(t *testing.T) {
+	executor, err := NewFanOutExecutor(t.TempDir(), false, &orderRecordingWorkflowRunner{})
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	sink := &failingSink{}
+	publisher := &EventPublisher{}
+	publisher.AddSink(sink)
+	executor.SetEventPublisher(publisher)
+
+	// An invalid event keeps every event of the batch from being emitted
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"events": []interface{}{
+			map[string]interface{}{"event_type": "library_built"},
+			map[string]interface{}{"event_type": "library_built", "schema_version": "9.9.9"},
+		},
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2))
+	if err == nil || result.EventEmitted || result.TriggeredCount != 0 {
+		t.Fatalf("expected the batch to fail without emitting, got %+v, %v", result, err)
+	}
+	if sink.calls != 0 {
+		t.Errorf("expected no event to be published, got %d", sink.calls)
+	}
+}
+
+// inputsRecordingWorkflowRunner records the inputs of the child workflows it runs, by repository.
+type inputsRecordingWorkflowRunner struct {
+	mu     sync.Mutex
+	inputs map[string]map[string]string
+}
+
+func (r *inputsRecordingWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	r.mu.Lock()
+	r.inputs[repoPath] = inputs
+	r.mu.Unlock()
+
+	return &interfaces.ExecutionResult{
+		RunID:     fmt.Sprintf("run-%s", workflowName),
+		Success:   true,
+		StartTime: time.Now(),
+		EndTime:   time.Now(),
+	}, nil
+}
+
+func TestFanOutExecutor_InputMappingFailed(t *testing.T) {
+	subscriptions := []interfaces.SubscriptionMatch{
+		{Repository: "org/app", Subscription: config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   []string{"library_built"},
+			Workflow: "update",
+			Inputs:   map[string]string{"version": "{{ .payload.version }}"},
+		}},
+		{Repository: "org/docs", Subscription: config.Subscription{
+			Artifact: "source-org/library:default",
+			Events:   []string{"library_built"},
+			Workflow: "publish",
+			Inputs:   map[string]string{"major": "{{ .payload.version.major }}"},
+		}},
+	}
+
+	for _, strict := range []bool{false, true} {
+		t.Run(fmt.Sprintf("strict=%v", strict), func(t *testing.T) {
+			runner := &inputsRecordingWorkflowRunner{inputs: make(map[string]map[string]string)}
+			executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+			if err != nil {
+				t.Fatalf("Failed to create executor: %v", err)
+			}
+
+			step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+				"event_type":        "library_built",
+				"wait_for_children": true,
+				"strict_inputs":     strict,
+				"payload":           map[string]interface{}{"version": "2.0.0"},
+			}}
+			result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", subscriptions)
+			if strict != (err != nil) {
+				t.Fatalf("Expected the fan-out to stop only with strict inputs, got %v", err)
+			}
+			if result.Success {
+				t.Error("Expected the input mapping failure to fail the fan-out")
+			}
+
+			if len(result.DetailedErrors) != 1 {
+				t.Fatalf("Expected 1 detailed error, got %+v", result.DetailedErrors)
+			}
+			detailed := result.DetailedErrors[0]
+			if detailed.ErrorType != "input_mapping_failed" || detailed.Repository != "org/docs" || detailed.Template != "{{ .payload.version.major }}" {
+				t.Errorf("Unexpected detailed error: %+v", detailed)
+			}
+			if !strings.Contains(detailed.ErrorMessage, "failed to process input 'major'") {
+				t.Errorf("Expected the error to name the input, got %q", detailed.ErrorMessage)
+			}
+
+			expectedTriggered := 1
+			if strict {
+				expectedTriggered = 0
+			}
+			if result.TriggeredCount != expectedTriggered || len(runner.inputs) != expectedTriggered {
+				t.Errorf("Expected %d children to be triggered, got %d (%v)", expectedTriggered, result.TriggeredCount, runner.inputs)
+			}
+		})
+	}
+}
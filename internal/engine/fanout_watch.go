@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// defaultStateWatchInterval is how often waiters check the state file for updates written by
+// other processes, when the state directory cannot be watched.
+const defaultStateWatchInterval = 250 * time.Millisecond
+
+// Changes returns a channel that is closed the next time the state changes.
+// Callers must check the condition they wait for after obtaining the channel, and obtain a
+// new channel after every wake-up.
+func (state *FanOutState) Changes() <-chan struct{} {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.changed == nil {
+		state.changed = make(chan struct{})
+	}
+	return state.changed
+}
+
+// notifyChanged wakes up every goroutine waiting on the current Changes channel.
+func (state *FanOutState) notifyChanged() {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	if state.changed != nil {
+		close(state.changed)
+		state.changed = nil
+	}
+}
+
+// SetWatchInterval sets how often waiters check state files for updates written by other
+// processes, when the state directory cannot be watched.
+func (sm *FanOutStateManager) SetWatchInterval(interval time.Duration) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if interval > 0 {
+		sm.watchInterval = interval
+	}
+}
+
+// WaitForCompletion blocks until the fan-out is complete or the timeout expires, and reports
+// whether it completed. Updates made in this process wake the waiter immediately; updates
+// written by other processes are picked up by watching the state directory with the file
+// notifications of the OS, or by polling the modification time of the state file where they
+// are not available.
+func (sm *FanOutStateManager) WaitForCompletion(state *FanOutState, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	updates, stop := sm.watchStateFile(state.ID)
+	defer stop()
+
+	// Children whose process died stop sending heartbeats
+	heartbeats := time.NewTicker(sm.getHeartbeatInterval())
+	defer heartbeats.Stop()
+
+	lastModTime := sm.stateFileModTime(state.ID)
+	for {
+		changes := state.Changes()
+		if state.IsComplete() {
+			return true
+		}
+
+		select {
+		case <-changes:
+		case <-updates:
+			// A partially written file fails to load and is read again on the next update
+			if modTime := sm.stateFileModTime(state.ID); !modTime.Equal(lastModTime) && sm.refreshState(state) == nil {
+				lastModTime = modTime
+			}
+		case <-heartbeats.C:
+			state.failLostChildren(state.stateManager.now())
+		case <-deadline.C:
+			return state.IsComplete()
+		}
+	}
+}
+
+// watchStateFile returns a channel receiving a value when the state file or its journal may have
+// been updated, and a function stopping the watch. The state directory is watched rather than
+// the file, which is replaced on every update.
+func (sm *FanOutStateManager) watchStateFile(id string) (<-chan struct{}, func()) {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(sm.stateDir); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		return sm.pollStateFile()
+	}
+
+	updates := make(chan struct{}, 1)
+	done := make(chan struct{})
+	name, journal := fmt.Sprintf("%s.json", id), fmt.Sprintf("%s.journal", id)
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if base := filepath.Base(event.Name); (base != name && base != journal) || !event.Has(fsnotify.Create|fsnotify.Write|fsnotify.Rename) {
+					continue
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been dropped: check the file anyway
+			case <-done:
+				return
+			}
+			select {
+			case updates <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return updates, func() {
+		close(done)
+		watcher.Close()
+	}
+}
+
+// pollStateFile returns a channel receiving a value every watch interval, for platforms and
+// file systems without file notifications.
+func (sm *FanOutStateManager) pollStateFile() (<-chan struct{}, func()) {
+	sm.mu.RLock()
+	watchInterval := sm.watchInterval
+	sm.mu.RUnlock()
+
+	ticker := time.NewTicker(watchInterval)
+	updates := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case updates <- struct{}{}:
+				default:
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return updates, func() {
+		close(done)
+		ticker.Stop()
+	}
+}
+
+// stateFileModTime returns the latest modification time of a state file and of its journal, or
+// the zero time if neither can be read.
+func (sm *FanOutStateManager) stateFileModTime(id string) time.Time {
+	var modTime time.Time
+	for _, file := range []string{filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", id)), sm.journalFile(id)} {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime
+}
+
+// refreshState reloads a state from its file and journal when another process persisted a newer
+// revision.
+func (sm *FanOutStateManager) refreshState(state *FanOutState) error {
+	loaded, err := sm.readStateFile(filepath.Join(sm.stateDir, fmt.Sprintf("%s.json", state.ID)))
+	if err != nil {
+		return err
+	}
+
+	state.mu.Lock()
+	if loaded.Revision <= state.Revision {
+		state.mu.Unlock()
+		return nil
+	}
+	state.Status = loaded.Status
+	state.EndTime = loaded.EndTime
+	state.Children = loaded.Children
+	state.details = loaded.details
+	state.ErrorMessage = loaded.ErrorMessage
+	state.Revision = loaded.Revision
+	state.mu.Unlock()
+
+	state.notifyChanged()
+	return nil
+}
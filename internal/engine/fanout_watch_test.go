@@ -0,0 +1,166 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+// newWaitingFanOutState creates a fan-out state waiting for one running child.
+func newWaitingFanOutState(t *testing.T, manager *FanOutStateManager) *FanOutState {
+	t.Helper()
+
+	state, err := manager.CreateFanOutState("test-fanout", "", "org/repo", "build", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create fan-out state: %v", err)
+	}
+	state.AddChildWorkflow("target/repo1", "deploy", map[string]string{})
+	if err := state.UpdateChildStatus("target/repo1", "deploy", ChildStatusRunning, "run-1", ""); err != nil {
+		t.Fatalf("Failed to update child status: %v", err)
+	}
+	if err := state.StartWaiting(); err != nil {
+		t.Fatalf("Failed to start waiting: %v", err)
+	}
+	return state
+}
+
+func TestFanOutState_ChangesNotifiesWaiters(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	state := newWaitingFanOutState(t, manager)
+
+	changes := state.Changes()
+	select {
+	case <-changes:
+		t.Fatal("Expected no notification before the state changes")
+	default:
+	}
+
+	if err := state.UpdateChildStatus("target/repo1", "deploy", ChildStatusCompleted, "", ""); err != nil {
+		t.Fatalf("Failed to update child status: %v", err)
+	}
+	select {
+	case <-changes:
+	default:
+		t.Fatal("Expected a notification after the state changed")
+	}
+}
+
+func TestFanOutStateManager_WaitForCompletion(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	// Only in-process notifications can wake the waiter within the test
+	manager.SetWatchInterval(time.Hour)
+	state := newWaitingFanOutState(t, manager)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		state.UpdateChildStatus("target/repo1", "deploy", ChildStatusCompleted, "", "")
+	}()
+
+	start := time.Now()
+	if !manager.WaitForCompletion(state, 10*time.Second) {
+		t.Fatal("Expected the fan-out to complete")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the waiter to be woken up immediately, took %v", elapsed)
+	}
+	if state.Status != FanOutStatusCompleted {
+		t.Errorf("Expected status %s, got %s", FanOutStatusCompleted, state.Status)
+	}
+}
+
+func TestFanOutStateManager_WaitForCompletionTimeout(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	state := newWaitingFanOutState(t, manager)
+
+	if manager.WaitForCompletion(state, 50*time.Millisecond) {
+		t.Error("Expected the wait to time out")
+	}
+}
+
+func TestFanOutStateManager_WaitForCompletionAcrossManagers(t *testing.T) {
+	stateDir := t.TempDir()
+	writer, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	newWaitingFanOutState(t, writer)
+
+	// A second manager stands in for another process sharing the state directory
+	reader, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	reader.SetWatchInterval(10 * time.Millisecond)
+	readerState, err := reader.GetFanOutState("test-fanout")
+	if err != nil {
+		t.Fatalf("Failed to get fan-out state: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writerState, _ := writer.GetFanOutState("test-fanout")
+		writerState.UpdateChildStatus("target/repo1", "deploy", ChildStatusFailed, "", "boom")
+	}()
+
+	if !reader.WaitForCompletion(readerState, 10*time.Second) {
+		t.Fatal("Expected the fan-out written by the other manager to complete")
+	}
+	summary := readerState.GetSummary()
+	if summary.Status != FanOutStatusFailed || summary.FailedChildren != 1 {
+		t.Errorf("Expected the failed child to be picked up, got %+v", summary)
+	}
+}
+
+func TestFanOutStateManager_WaitForCompletionWatchesStateFile(t *testing.T) {
+	stateDir := t.TempDir()
+	writer, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	newWaitingFanOutState(t, writer)
+
+	// Polling would not pick the update up before the timeout: the file notifications must
+	reader, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	reader.SetWatchInterval(time.Hour)
+	readerState, err := reader.GetFanOutState("test-fanout")
+	if err != nil {
+		t.Fatalf("Failed to get fan-out state: %v", err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		writerState, _ := writer.GetFanOutState("test-fanout")
+		writerState.UpdateChildStatus("target/repo1", "deploy", ChildStatusCompleted, "run-1", "")
+	}()
+
+	if !reader.WaitForCompletion(readerState, 5*time.Second) {
+		t.Fatal("Expected the update of the other manager to be noticed through the state directory watch")
+	}
+}
+
+func TestFanOutStateManager_PollStateFile(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	manager.SetWatchInterval(10 * time.Millisecond)
+
+	updates, stop := manager.pollStateFile()
+	defer stop()
+	select {
+	case <-updates:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected polling to check the state file every watch interval")
+	}
+}
@@ -0,0 +1,208 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FaultsEnv lists the faults injected into the runs of a build with the faults tag, e.g.
+// child_trigger:target=org/app:times=1,state_persist:after=2.
+const FaultsEnv = "TAKO_FAULTS"
+
+// FaultPoint is a point of the engine where faults can be injected.
+type FaultPoint string
+
+// Fault points, and what a fault injected at each does.
+const (
+	FaultStatePersist   FaultPoint = "state_persist"   // Persisting an execution or fan-out state fails
+	FaultPartialWrite   FaultPoint = "partial_write"   // A state file is left half written, then persisting it fails
+	FaultChildTrigger   FaultPoint = "child_trigger"   // Triggering a child workflow fails
+	FaultSlowSubscriber FaultPoint = "slow_subscriber" // A child workflow starts after a delay
+)
+
+// ErrInjectedFault is the error of the failures injected by faults.
+var ErrInjectedFault = errors.New("injected fault")
+
+// Fault is a failure injected at a point of the engine. Occurrences of the point are counted
+// in order across the runs sharing the injector, so that faults fire deterministically.
+type Fault struct {
+	Point  FaultPoint
+	Target string        // Repository of the child, or ID of the run or fan-out of the state; any when empty
+	After  int           // Matching occurrences let through before the first fault
+	Times  int           // Faults injected in total; unlimited when zero
+	Delay  time.Duration // Delay of slow_subscriber faults
+}
+
+// FaultInjector injects faults at the fault points of the engine, for chaos testing. A nil
+// injector injects none.
+type FaultInjector struct {
+	mu     sync.Mutex
+	faults []*injectedFault
+}
+
+// injectedFault is a fault with the occurrences it matched and the faults it injected.
+type injectedFault struct {
+	Fault
+	seen     int
+	injected int
+}
+
+// NewFaultInjector creates an injector of faults.
+func NewFaultInjector(faults ...Fault) *FaultInjector {
+	fi := &FaultInjector{}
+	for _, fault := range faults {
+		fi.faults = append(fi.faults, &injectedFault{Fault: fault})
+	}
+	return fi
+}
+
+// ParseFaults parses a comma-separated list of faults, each a point followed by its options,
+// e.g. slow_subscriber:delay=2s:target=org/app or state_persist:after=3:times=1.
+func ParseFaults(spec string) ([]Fault, error) {
+	var faults []Fault
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.Split(entry, ":")
+		fault := Fault{Point: FaultPoint(parts[0])}
+		switch fault.Point {
+		case FaultStatePersist, FaultPartialWrite, FaultChildTrigger, FaultSlowSubscriber:
+		default:
+			return nil, fmt.Errorf("unknown fault point '%s'", parts[0])
+		}
+
+		for _, option := range parts[1:] {
+			key, value, found := strings.Cut(option, "=")
+			if !found {
+				return nil, fmt.Errorf("fault '%s': option '%s' is not key=value", entry, option)
+			}
+			var err error
+			switch key {
+			case "target":
+				fault.Target = value
+			case "after":
+				fault.After, err = strconv.Atoi(value)
+			case "times":
+				fault.Times, err = strconv.Atoi(value)
+			case "delay":
+				fault.Delay, err = time.ParseDuration(value)
+			default:
+				return nil, fmt.Errorf("fault '%s': unknown option '%s'", entry, key)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("fault '%s': invalid %s: %v", entry, key, err)
+			}
+		}
+		if fault.After < 0 || fault.Times < 0 {
+			return nil, fmt.Errorf("fault '%s': after and times cannot be negative", entry)
+		}
+		if fault.Point == FaultSlowSubscriber && fault.Delay <= 0 {
+			return nil, fmt.Errorf("fault '%s': slow_subscriber requires a positive delay", entry)
+		}
+		faults = append(faults, fault)
+	}
+	return faults, nil
+}
+
+// faultsFromEnvironment returns the injector of the faults listed in TAKO_FAULTS, or nil when
+// it is unset. Builds without the faults tag refuse to run with it set.
+func faultsFromEnvironment(environment []string) (*FaultInjector, error) {
+	spec, ok := lookupEnvironment(environment, FaultsEnv)
+	if !ok || spec == "" {
+		return nil, nil
+	}
+	if !FaultInjectionEnabled {
+		return nil, fmt.Errorf("%s is set, but tako was built without fault injection (the faults build tag)", FaultsEnv)
+	}
+	faults, err := ParseFaults(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", FaultsEnv, err)
+	}
+	return NewFaultInjector(faults...), nil
+}
+
+// inject counts an occurrence of a fault point for a target, and returns the fault injected
+// into it, or nil.
+func (fi *FaultInjector) inject(point FaultPoint, target string) *Fault {
+	if fi == nil {
+		return nil
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	for _, fault := range fi.faults {
+		if fault.Point != point || (fault.Target != "" && fault.Target != target) {
+			continue
+		}
+		fault.seen++
+		if fault.seen <= fault.After || (fault.Times > 0 && fault.injected >= fault.Times) {
+			continue
+		}
+		fault.injected++
+		injected := fault.Fault
+		return &injected
+	}
+	return nil
+}
+
+// fail returns the error injected at a fault point for a target, or nil.
+func (fi *FaultInjector) fail(point FaultPoint, target string) error {
+	if fi.inject(point, target) == nil {
+		return nil
+	}
+	return fmt.Errorf("%w: %s of %s", ErrInjectedFault, point, target)
+}
+
+// delay waits for the delay of the fault injected at a fault point for a target, if any, or
+// until ctx is done.
+func (fi *FaultInjector) delay(ctx context.Context, point FaultPoint, target string) error {
+	fault := fi.inject(point, target)
+	if fault == nil {
+		return nil
+	}
+	timer := time.NewTimer(fault.Delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// writePartially leaves the file at path half written with data when a partial_write fault is
+// injected for a target, and returns the injected error; otherwise it returns nil.
+func (fi *FaultInjector) writePartially(path string, data []byte, target string) error {
+	if fi.inject(FaultPartialWrite, target) == nil {
+		return nil
+	}
+	if err := os.WriteFile(path, data[:len(data)/2], 0644); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: %s of %s", ErrInjectedFault, FaultPartialWrite, target)
+}
+
+// Injected returns the number of faults injected at a fault point so far.
+func (fi *FaultInjector) Injected(point FaultPoint) int {
+	if fi == nil {
+		return 0
+	}
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	count := 0
+	for _, fault := range fi.faults {
+		if fault.Point == point {
+			count += fault.injected
+		}
+	}
+	return count
+}
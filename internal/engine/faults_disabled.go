@@ -0,0 +1,7 @@
+//go:build !faults
+
+package engine
+
+// FaultInjectionEnabled reports whether the build honors TAKO_FAULTS and --inject-faults.
+// Release builds never inject faults; build with -tags faults for chaos testing.
+const FaultInjectionEnabled = false
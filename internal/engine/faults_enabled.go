@@ -0,0 +1,6 @@
+//go:build faults
+
+package engine
+
+// FaultInjectionEnabled reports whether the build honors TAKO_FAULTS and --inject-faults.
+const FaultInjectionEnabled = true
@@ -0,0 +1,182 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults("child_trigger:target=org/app:times=2, slow_subscriber:delay=1s,state_persist:after=3")
+	if err != nil {
+		t.Fatalf("ParseFaults() error = %v", err)
+	}
+	expected := []Fault{
+		{Point: FaultChildTrigger, Target: "org/app", Times: 2},
+		{Point: FaultSlowSubscriber, Delay: time.Second},
+		{Point: FaultStatePersist, After: 3},
+	}
+	if len(faults) != len(expected) {
+		t.Fatalf("expected %d faults, got %+v", len(expected), faults)
+	}
+	for i := range expected {
+		if faults[i] != expected[i] {
+			t.Errorf("fault %d: expected %+v, got %+v", i, expected[i], faults[i])
+		}
+	}
+
+	for spec, want := range map[string]string{
+		"disk_full":                  "unknown fault point",
+		"child_trigger:target":       "not key=value",
+		"child_trigger:every=2":      "unknown option",
+		"state_persist:times=x":      "invalid times",
+		"state_persist:after=-1":     "cannot be negative",
+		"slow_subscriber":            "requires a positive delay",
+		"slow_subscriber:delay=soon": "invalid delay",
+	} {
+		if _, err := ParseFaults(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseFaults(%q): expected an error containing %q, got %v", spec, want, err)
+		}
+	}
+}
+
+func TestFaultInjectorCountsOccurrences(t *testing.T) {
+	faults := NewFaultInjector(Fault{Point: FaultChildTrigger, Target: "org/app", After: 1, Times: 2})
+
+	var failed []bool
+	for i := 0; i < 5; i++ {
+		if err := faults.fail(FaultChildTrigger, "org/other"); err != nil {
+			t.Fatalf("expected other targets not to fail, got %v", err)
+		}
+		failed = append(failed, faults.fail(FaultChildTrigger, "org/app") != nil)
+	}
+	expected := []bool{false, true, true, false, false}
+	for i := range expected {
+		if failed[i] != expected[i] {
+			t.Fatalf("expected faults %v, got %v", expected, failed)
+		}
+	}
+	if faults.Injected(FaultChildTrigger) != 2 || faults.Injected(FaultStatePersist) != 0 {
+		t.Errorf("unexpected injected counts: %d, %d", faults.Injected(FaultChildTrigger), faults.Injected(FaultStatePersist))
+	}
+
+	var none *FaultInjector
+	if none.fail(FaultChildTrigger, "org/app") != nil || none.Injected(FaultChildTrigger) != 0 {
+		t.Error("expected a nil injector to inject nothing")
+	}
+}
+
+func TestFaultsFromEnvironment(t *testing.T) {
+	if faults, err := faultsFromEnvironment(nil); faults != nil || err != nil {
+		t.Errorf("expected no faults without %s, got %v, %v", FaultsEnv, faults, err)
+	}
+
+	faults, err := faultsFromEnvironment([]string{FaultsEnv + "=child_trigger"})
+	if FaultInjectionEnabled {
+		if err != nil || faults == nil {
+			t.Errorf("expected the faults of %s, got %v, %v", FaultsEnv, faults, err)
+		}
+	} else if err == nil || !strings.Contains(err.Error(), "built without fault injection") {
+		t.Errorf("expected builds without the faults tag to refuse %s, got %v", FaultsEnv, err)
+	}
+}
+
+func TestExecutionStateFaults(t *testing.T) {
+	workspace := t.TempDir()
+	state, err := NewExecutionState("exec-1", workspace)
+	if err != nil {
+		t.Fatalf("NewExecutionState() error = %v", err)
+	}
+	state.faults = NewFaultInjector(
+		Fault{Point: FaultStatePersist, Times: 1},
+		Fault{Point: FaultPartialWrite, After: 1, Times: 1},
+	)
+
+	if err := state.StartExecution("build", "org/app", nil); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected the first save to fail, got %v", err)
+	}
+	if err := state.StartStep("compile"); err != nil {
+		t.Fatalf("expected the second save to succeed, got %v", err)
+	}
+	if _, err := LoadExecutionState("exec-1", workspace); err != nil {
+		t.Fatalf("expected the saved state to load, got %v", err)
+	}
+
+	if err := state.CompleteStep("compile", "", nil); !errors.Is(err, ErrInjectedFault) {
+		t.Fatalf("expected the partial write to fail, got %v", err)
+	}
+	if _, err := LoadExecutionState("exec-1", workspace); err == nil || !strings.Contains(err.Error(), "failed to parse state file") {
+		t.Errorf("expected the half-written state not to load, got %v", err)
+	}
+}
+
+func TestFanOutStateManagerFaults(t *testing.T) {
+	manager, err := NewFanOutStateManager(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	manager.SetFaultInjector(NewFaultInjector(Fault{Point: FaultStatePersist, Target: "fanout-broken"}))
+
+	if _, err := manager.CreateFanOutState("fanout-broken", "", "org/lib", "built", false, 0); err == nil || !strings.Contains(err.Error(), ErrInjectedFault.Error()) {
+		t.Errorf("expected persisting the targeted state to fail, got %v", err)
+	}
+	if _, err := manager.CreateFanOutState("fanout-ok", "", "org/lib", "built", false, 0); err != nil {
+		t.Errorf("expected other states to persist, got %v", err)
+	}
+}
+
+func TestFanOutExecutorChildFaults(t *testing.T) {
+	runner := NewRecordingWorkflowRunner()
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	faults := NewFaultInjector(
+		Fault{Point: FaultChildTrigger, Target: "test-org/repo-1", Times: 1},
+		Fault{Point: FaultSlowSubscriber, Target: "test-org/repo-2", Delay: time.Hour},
+	)
+	executor.SetFaultInjector(faults)
+
+	// The transient failure of the first child is retried
+	retry := DefaultRetryConfig()
+	retry.InitialDelay = time.Millisecond
+	retry.RetryableErrors = []string{ErrInjectedFault.Error()}
+	executor.ConfigureRetry(retry)
+
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+		"timeout":           "200ms",
+	}}
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2))
+	if err != nil {
+		t.Fatalf("ExecuteWithSubscriptions() error = %v", err)
+	}
+	if result.Success {
+		t.Error("expected the slow subscriber to time out the fan-out")
+	}
+
+	if faults.Injected(FaultChildTrigger) != 1 || faults.Injected(FaultSlowSubscriber) != 1 {
+		t.Errorf("expected one fault of each point, got %d and %d", faults.Injected(FaultChildTrigger), faults.Injected(FaultSlowSubscriber))
+	}
+	recorded := runner.Recorded()
+	if len(recorded) != 1 || recorded[0].Repository != "test-org/repo-1" {
+		t.Errorf("expected only the retried child to run, got %+v", recorded)
+	}
+	for _, child := range result.Children {
+		if child.Repository == "test-org/repo-1" && child.Status != ChildStatusCompleted {
+			t.Errorf("expected the retried child to complete, got %s", child.Status)
+		}
+	}
+
+	// Slow subscribers give up when their context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := executor.executeChildWorkflow(ctx, "test-org/repo-2", "update-2", "", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the delay to stop with the context, got %v", err)
+	}
+}
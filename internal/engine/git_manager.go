@@ -0,0 +1,483 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/git"
+)
+
+// DefaultGitFetchInterval is how long a cached repository is considered fresh after it was
+// last fetched.
+const DefaultGitFetchInterval = time.Hour
+
+// GitOptions configures how repositories missing from the cache are cloned and how stale
+// ones are updated.
+type GitOptions struct {
+	// LocalOnly disables all network operations; only repositories already in the cache are used
+	LocalOnly bool
+
+	// Protocol is "https" (the default) or "ssh"
+	Protocol string
+
+	// Host is the Git host repositories are cloned from; defaults to github.com
+	Host string
+
+	// BaseURL overrides the URL repositories are cloned from, as <BaseURL>/<owner>/<repo>.git
+	BaseURL string
+
+	// Auth provides the token of each owner for HTTPS operations; tokens are passed per
+	// command and never stored in the clone
+	Auth auth.TokenSource
+
+	// FetchInterval is how long a cached repository is used without fetching it again;
+	// DefaultGitFetchInterval when zero, and negative to fetch on every use
+	FetchInterval time.Duration
+
+	// Prefetch clones or fetches the repositories subscribing to the events a workflow emits in
+	// the background when it starts, instead of when its fan-out steps trigger them
+	Prefetch bool
+}
+
+// GitManager clones repositories that are missing from the cache and fetches the ones that
+// are stale, so that discovery and execution see up-to-date repositories.
+type GitManager struct {
+	cacheDir    string
+	environment []string // Environment of git commands
+	opts        GitOptions
+
+	// Serializes operations on the same clone
+	mu        sync.Mutex
+	repoLocks map[string]*sync.Mutex
+}
+
+// NewGitManager creates a Git manager for the repositories cached under cacheDir. Git runs
+// with the given environment.
+func NewGitManager(cacheDir string, environment []string, opts GitOptions) (*GitManager, error) {
+	switch opts.Protocol {
+	case "":
+		opts.Protocol = "https"
+	case "https", "ssh":
+	default:
+		return nil, fmt.Errorf("invalid git protocol '%s': must be https or ssh", opts.Protocol)
+	}
+	if opts.Host == "" {
+		opts.Host = "github.com"
+	}
+	if opts.FetchInterval == 0 {
+		opts.FetchInterval = DefaultGitFetchInterval
+	}
+
+	return &GitManager{
+		cacheDir:    cacheDir,
+		environment: environment,
+		opts:        opts,
+		repoLocks:   make(map[string]*sync.Mutex),
+	}, nil
+}
+
+// Options returns the options of the manager, with defaults applied.
+func (gm *GitManager) Options() GitOptions {
+	return gm.opts
+}
+
+// CachePath returns the cache path of a repository given as owner/repo or owner/repo:ref.
+func (gm *GitManager) CachePath(repoSpec string) (string, error) {
+	owner, repo, ref, err := parseRepositorySpec(repoSpec)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(gm.cacheDir, "repos", owner, repo, ref), nil
+}
+
+// CloneURL returns the URL a repository is cloned from.
+func (gm *GitManager) CloneURL(owner, repo string) string {
+	if gm.opts.BaseURL != "" {
+		return fmt.Sprintf("%s/%s/%s.git", strings.TrimSuffix(gm.opts.BaseURL, "/"), owner, repo)
+	}
+	if gm.opts.Protocol == "ssh" {
+		return fmt.Sprintf("git@%s:%s/%s.git", gm.opts.Host, owner, repo)
+	}
+	return fmt.Sprintf("https://%s/%s/%s.git", gm.opts.Host, owner, repo)
+}
+
+// EnsureRepository returns the cache path of a repository given as owner/repo or
+// owner/repo:ref, cloning it when it is missing and fetching it when it is stale. In
+// local-only mode, a missing repository is an error and cached ones are used as they are.
+func (gm *GitManager) EnsureRepository(ctx context.Context, repoSpec string) (string, error) {
+	owner, repo, ref, err := parseRepositorySpec(repoSpec)
+	if err != nil {
+		return "", err
+	}
+	cachePath := filepath.Join(gm.cacheDir, "repos", owner, repo, ref)
+
+	unlock := gm.lockRepository(cachePath)
+	defer unlock()
+
+	if _, err := os.Stat(cachePath); err == nil {
+		if !gm.opts.LocalOnly && gm.isStale(cachePath) {
+			// A failed update keeps the cached clone usable, e.g. while offline
+			if err := gm.update(ctx, owner, cachePath, ref); err != nil {
+				slog.Warn("failed to update cached repository", "repository", repoSpec, "error", err)
+			}
+			InvalidateSubscriptions(gm.cacheDir, owner+"/"+repo)
+		}
+		_ = cache.Touch(cachePath)
+		return cachePath, nil
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to access cached repository %s: %w", repoSpec, err)
+	}
+
+	if gm.opts.LocalOnly {
+		return "", fmt.Errorf("repository %s not found in cache at %s", repoSpec, cachePath)
+	}
+	if err := gm.clone(ctx, owner, gm.CloneURL(owner, repo), cachePath, ref); err != nil {
+		return "", fmt.Errorf("repository %s not found in cache and could not be cloned: %w", repoSpec, err)
+	}
+	InvalidateSubscriptions(gm.cacheDir, owner+"/"+repo)
+	return cachePath, nil
+}
+
+// RefreshStale fetches the cached repositories that were not fetched within the fetch
+// interval, so that discovery sees their current subscriptions. Repositories that fail to
+// update are logged and left as they are.
+func (gm *GitManager) RefreshStale(ctx context.Context) {
+	if gm.opts.LocalOnly {
+		return
+	}
+
+	repos, err := cache.Repositories(gm.cacheDir)
+	if err != nil {
+		slog.Warn("failed to list cached repositories", "error", err)
+		return
+	}
+	for _, repo := range repos {
+		if ctx.Err() != nil {
+			return
+		}
+		if !gm.isStale(repo.Path) {
+			continue
+		}
+		owner, _, _ := strings.Cut(repo.Name, "/")
+		unlock := gm.lockRepository(repo.Path)
+		if !gm.isStale(repo.Path) {
+			// Another goroutine, such as a prefetch, fetched it meanwhile
+			unlock()
+			continue
+		}
+		if err := gm.update(ctx, owner, repo.Path, cache.RepositoryRef(repo)); err != nil {
+			slog.Warn("failed to update cached repository", "repository", repo.Name, "error", err)
+		}
+		InvalidateSubscriptions(gm.cacheDir, repo.Name)
+		unlock()
+	}
+}
+
+// ResolveCommit returns the full SHA of the commit a repository, given as owner/repo, runs
+// against for a pinned revision: the pinned commit, or the head of the pinned branch or tag
+// (the default branch when none is pinned). A pinned commit missing from the cached clone is
+// fetched unless the manager is local-only.
+func (gm *GitManager) ResolveCommit(ctx context.Context, repository string, pinned config.PinnedRef) (string, error) {
+	ref := pinned.Ref
+	if ref == "" {
+		ref = "main"
+	}
+	clonePath, err := gm.EnsureRepository(ctx, repository+":"+ref)
+	if err != nil {
+		return "", err
+	}
+
+	// Without this check, git would resolve the commit of an enclosing repository
+	if _, err := os.Stat(filepath.Join(clonePath, ".git")); err != nil {
+		return "", fmt.Errorf("cached repository %s is not a Git clone", repository)
+	}
+
+	target := "HEAD"
+	if pinned.Commit != "" {
+		target = pinned.Commit
+	}
+
+	unlock := gm.lockRepository(clonePath)
+	defer unlock()
+
+	commit, err := gm.output(ctx, clonePath, "", "rev-parse", "--verify", "--quiet", target+"^{commit}")
+	if err != nil && pinned.Commit != "" && !gm.opts.LocalOnly {
+		owner, _, _ := strings.Cut(repository, "/")
+		if fetchErr := gm.run(ctx, clonePath, owner, "fetch", "--tags", "origin"); fetchErr != nil {
+			return "", fmt.Errorf("failed to fetch commit %s of %s: %w", pinned.Commit, repository, fetchErr)
+		}
+		commit, err = gm.output(ctx, clonePath, "", "rev-parse", "--verify", "--quiet", target+"^{commit}")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s of %s: commit not found", pinned.String(), repository)
+	}
+	return commit, nil
+}
+
+// ChangedPaths returns the slash-separated paths of the files of the repository in dir that
+// differ from a revision, including the changes not committed yet and the untracked files that
+// are not ignored, sorted.
+func (gm *GitManager) ChangedPaths(ctx context.Context, dir, since string) ([]string, error) {
+	if err := git.ValidateRef(since); err != nil {
+		return nil, err
+	}
+	out, err := gm.output(ctx, dir, "", "diff", "--name-only", since, "--")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := gm.output(ctx, dir, "", "ls-files", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for _, line := range strings.Split(out+"\n"+untracked, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paths = append(paths, line)
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// isStale reports whether a cached clone is due to be fetched. Directories that are not Git
+// clones, such as repositories copied into the cache, are never stale.
+func (gm *GitManager) isStale(path string) bool {
+	if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+		return false
+	}
+	if gm.opts.FetchInterval < 0 {
+		return true
+	}
+	fetched, ok := git.LastFetchTime(path)
+	return !ok || time.Since(fetched) > gm.opts.FetchInterval
+}
+
+// clone clones a repository at a ref into a temporary directory next to the cache path and
+// moves it into place, so that an interrupted clone never leaves a partial repository.
+func (gm *GitManager) clone(ctx context.Context, owner, url, cachePath, ref string) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmpPath, err := os.MkdirTemp(filepath.Dir(cachePath), "."+filepath.Base(cachePath)+"-clone-")
+	if err != nil {
+		return fmt.Errorf("failed to create clone directory: %w", err)
+	}
+	defer os.RemoveAll(tmpPath)
+
+	if err := gm.run(ctx, "", owner, "clone", "--no-checkout", url, tmpPath); err != nil {
+		return err
+	}
+	if err := gm.run(ctx, tmpPath, "", "checkout", ref); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, cachePath); err != nil {
+		// Another process may have cloned the repository in the meantime
+		if _, statErr := os.Stat(cachePath); statErr == nil {
+			return nil
+		}
+		return fmt.Errorf("failed to move clone into the cache: %w", err)
+	}
+	return nil
+}
+
+// update fetches a cached clone and brings the checkout of its ref up to date.
+func (gm *GitManager) update(ctx context.Context, owner, path, ref string) error {
+	if err := gm.run(ctx, path, owner, "fetch", "--prune", "--tags", "origin"); err != nil {
+		return err
+	}
+	if err := gm.run(ctx, path, "", "checkout", ref); err != nil {
+		return err
+	}
+	branch, err := git.CurrentBranch(path)
+	if err != nil || branch == "HEAD" {
+		// Tags and commits are checked out detached and do not move
+		return err
+	}
+	return gm.run(ctx, path, "", "merge", "--ff-only", "@{upstream}")
+}
+
+// run runs a git command. Network commands name the owner of the remote repository, so that
+// they get the token of that owner.
+func (gm *GitManager) run(ctx context.Context, dir, owner string, args ...string) error {
+	_, err := gm.output(ctx, dir, owner, args...)
+	return err
+}
+
+// output runs a git command and returns its trimmed standard output.
+func (gm *GitManager) output(ctx context.Context, dir, owner string, args ...string) (string, error) {
+	var fullArgs []string
+	if dir != "" {
+		fullArgs = append(fullArgs, "-C", dir)
+	}
+	// Never prompt for credentials: runs are not interactive
+	env := append(append([]string{}, gm.environment...), "GIT_TERMINAL_PROMPT=0")
+	if owner != "" && gm.opts.Auth != nil && gm.opts.Protocol == "https" {
+		token, err := gm.opts.Auth.Token(ctx, owner)
+		if err != nil && !errors.Is(err, auth.ErrNoToken) {
+			return "", err
+		}
+		if token != "" {
+			auth.RegisterSecret(token)
+			credentials := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + token))
+			auth.RegisterSecret(credentials)
+			// The header is passed in the environment: the arguments of a process can be read
+			// by any local user
+			env = withGitConfig(env, "http.extraHeader", "Authorization: Basic "+credentials)
+		}
+	}
+	fullArgs = append(fullArgs, args...)
+
+	cmd := exec.CommandContext(ctx, "git", fullArgs...)
+	cmd.Env = env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %v: %s", args[0], err, auth.Redact(strings.TrimSpace(stderr.String())))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// withGitConfig adds a configuration entry to the environment of a git command, after the
+// entries the environment already passes with GIT_CONFIG_COUNT.
+func withGitConfig(env []string, key, value string) []string {
+	count := 0
+	result := make([]string, 0, len(env)+3)
+	for _, variable := range env {
+		if name, val, _ := strings.Cut(variable, "="); name == "GIT_CONFIG_COUNT" {
+			if n, err := strconv.Atoi(val); err == nil && n > 0 {
+				count = n
+			}
+			continue
+		}
+		result = append(result, variable)
+	}
+	return append(result,
+		fmt.Sprintf("GIT_CONFIG_COUNT=%d", count+1),
+		fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", count, key),
+		fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", count, value),
+	)
+}
+
+// lockRepository serializes operations on a cached clone within this process.
+func (gm *GitManager) lockRepository(path string) func() {
+	gm.mu.Lock()
+	lock, exists := gm.repoLocks[path]
+	if !exists {
+		lock = &sync.Mutex{}
+		gm.repoLocks[path] = lock
+	}
+	gm.mu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
+
+// exportCommit writes the files of a commit of the repository at repoPath into dst, without
+// the Git metadata, so that a workspace holds exactly that revision.
+func exportCommit(ctx context.Context, repoPath, commit, dst string) error {
+	cmd := exec.CommandContext(ctx, "git", "-C", repoPath, "archive", "--format=tar", commit)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to archive commit %s: %w", commit, err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to archive commit %s: %w", commit, err)
+	}
+
+	extractErr := extractTar(stdout, dst)
+	// Drain the archive so git does not block on a full pipe after an extraction error
+	_, _ = io.Copy(io.Discard, stdout)
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("failed to archive commit %s: %v: %s", commit, err, strings.TrimSpace(stderr.String()))
+	}
+	if extractErr != nil {
+		return fmt.Errorf("failed to extract commit %s: %w", commit, extractErr)
+	}
+	return nil
+}
+
+// extractTar extracts the directories, files and symbolic links of a tar stream into dst.
+func extractTar(r io.Reader, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(header.Name))
+		if target != filepath.Clean(dst) && !strings.HasPrefix(target, filepath.Clean(dst)+string(filepath.Separator)) {
+			return fmt.Errorf("archive entry %s is outside the destination", header.Name)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, tr); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseRepositorySpec splits owner/repo:ref, defaulting the ref to main.
+func parseRepositorySpec(repoSpec string) (string, string, string, error) {
+	name, ref, _ := strings.Cut(repoSpec, ":")
+	if ref == "" {
+		ref = "main"
+	}
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", fmt.Errorf("invalid repository specification: %s (expected format: owner/repo or owner/repo:branch)", repoSpec)
+	}
+	return parts[0], parts[1], ref, nil
+}
@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// gitForTest runs a git command in a directory and returns its trimmed output.
+func gitForTest(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.email=test@example.com", "-c", "user.name=Test"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// createOriginRepository creates <remotes>/<owner>/<repo>.git with a tako.yml on main.
+func createOriginRepository(t *testing.T, remotes, owner, repo string) string {
+	t.Helper()
+	origin := filepath.Join(remotes, owner, repo+".git")
+	if err := os.MkdirAll(origin, 0755); err != nil {
+		t.Fatalf("failed to create origin: %v", err)
+	}
+	gitForTest(t, origin, "init", "-b", "main")
+	if err := os.WriteFile(filepath.Join(origin, "tako.yml"), []byte("version: 0.1.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	gitForTest(t, origin, "add", ".")
+	gitForTest(t, origin, "commit", "-m", "initial commit")
+	return origin
+}
+
+func TestGitManager_ClonesMissingRepository(t *testing.T) {
+	remotes := t.TempDir()
+	cacheDir := t.TempDir()
+	createOriginRepository(t, remotes, "org", "service")
+
+	gm, err := NewGitManager(cacheDir, nil, GitOptions{BaseURL: "file://" + remotes})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+
+	path, err := gm.EnsureRepository(context.Background(), "org/service")
+	if err != nil {
+		t.Fatalf("EnsureRepository() error = %v", err)
+	}
+	if want := filepath.Join(cacheDir, "repos", "org", "service", "main"); path != want {
+		t.Errorf("expected repository at %s, got %s", want, path)
+	}
+	if _, err := os.Stat(filepath.Join(path, "tako.yml")); err != nil {
+		t.Errorf("expected tako.yml in the clone: %v", err)
+	}
+
+	// No partial clones are left next to the repository
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("failed to read cache: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the clone in %s, got %d entries", filepath.Dir(path), len(entries))
+	}
+}
+
+func TestGitManager_LocalOnly(t *testing.T) {
+	remotes := t.TempDir()
+	cacheDir := t.TempDir()
+	createOriginRepository(t, remotes, "org", "service")
+
+	gm, err := NewGitManager(cacheDir, nil, GitOptions{LocalOnly: true, BaseURL: "file://" + remotes})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+
+	_, err = gm.EnsureRepository(context.Background(), "org/service:main")
+	if err == nil || !strings.Contains(err.Error(), "repository org/service:main not found in cache") {
+		t.Errorf("expected a not found in cache error, got %v", err)
+	}
+}
+
+func TestGitManager_FetchesStaleRepository(t *testing.T) {
+	remotes := t.TempDir()
+	cacheDir := t.TempDir()
+	origin := createOriginRepository(t, remotes, "org", "service")
+
+	gm, err := NewGitManager(cacheDir, nil, GitOptions{BaseURL: "file://" + remotes})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+	path, err := gm.EnsureRepository(context.Background(), "org/service")
+	if err != nil {
+		t.Fatalf("EnsureRepository() error = %v", err)
+	}
+
+	gitForTest(t, origin, "commit", "--allow-empty", "-m", "second commit")
+	want := gitForTest(t, origin, "rev-parse", "HEAD")
+
+	// A fresh clone is not fetched again
+	if _, err := gm.EnsureRepository(context.Background(), "org/service"); err != nil {
+		t.Fatalf("EnsureRepository() error = %v", err)
+	}
+	if got := gitForTest(t, path, "rev-parse", "HEAD"); got == want {
+		t.Errorf("expected a fresh clone not to be fetched")
+	}
+
+	// Once stale, discovery brings it up to date
+	old := time.Now().Add(-2 * DefaultGitFetchInterval)
+	for _, name := range []string{"FETCH_HEAD", "HEAD"} {
+		_ = os.Chtimes(filepath.Join(path, ".git", name), old, old)
+	}
+	gm.RefreshStale(context.Background())
+	if got := gitForTest(t, path, "rev-parse", "HEAD"); got != want {
+		t.Errorf("expected the stale clone to be updated to %s, got %s", want, got)
+	}
+}
+
+func TestGitManager_CloneURL(t *testing.T) {
+	tests := []struct {
+		name string
+		opts GitOptions
+		want string
+	}{
+		{name: "https", opts: GitOptions{}, want: "https://github.com/org/repo.git"},
+		{name: "ssh", opts: GitOptions{Protocol: "ssh"}, want: "git@github.com:org/repo.git"},
+		{name: "host", opts: GitOptions{Host: "git.example.com"}, want: "https://git.example.com/org/repo.git"},
+		{name: "base url", opts: GitOptions{BaseURL: "file:///remotes/"}, want: "file:///remotes/org/repo.git"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gm, err := NewGitManager(t.TempDir(), nil, tt.opts)
+			if err != nil {
+				t.Fatalf("NewGitManager() error = %v", err)
+			}
+			if got := gm.CloneURL("org", "repo"); got != tt.want {
+				t.Errorf("CloneURL() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewGitManager(t.TempDir(), nil, GitOptions{Protocol: "ftp"}); err == nil {
+		t.Errorf("expected an error for an invalid protocol")
+	}
+}
+
+func TestWithGitConfig(t *testing.T) {
+	env := withGitConfig(append(os.Environ(),
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=user.name",
+		"GIT_CONFIG_VALUE_0=Existing",
+	), "http.extraHeader", "Authorization: Basic c2VjcmV0")
+
+	// git reads both the existing entry and the added one from the environment
+	for key, want := range map[string]string{"user.name": "Existing", "http.extraHeader": "Authorization: Basic c2VjcmV0"} {
+		cmd := exec.Command("git", "config", "--get", key)
+		cmd.Env = env
+		output, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("git config --get %s failed: %v", key, err)
+		}
+		if got := strings.TrimSpace(string(output)); got != want {
+			t.Errorf("Expected %s to be %q, got %q", key, want, got)
+		}
+	}
+}
+
+func TestGitManager_ResolveCommitAndExport(t *testing.T) {
+	remotes := t.TempDir()
+	cacheDir := t.TempDir()
+	origin := createOriginRepository(t, remotes, "org", "service")
+	pinned := gitForTest(t, origin, "rev-parse", "HEAD")
+
+	if err := os.WriteFile(filepath.Join(origin, "tako.yml"), []byte("version: 0.2.0\n"), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	gitForTest(t, origin, "commit", "-am", "second commit")
+	head := gitForTest(t, origin, "rev-parse", "HEAD")
+
+	gm, err := NewGitManager(cacheDir, nil, GitOptions{BaseURL: "file://" + remotes})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+
+	got, err := gm.ResolveCommit(context.Background(), "org/service", config.PinnedRef{})
+	if err != nil {
+		t.Fatalf("ResolveCommit() error = %v", err)
+	}
+	if got != head {
+		t.Errorf("expected the head of main %s, got %s", head, got)
+	}
+
+	got, err = gm.ResolveCommit(context.Background(), "org/service", config.PinnedRef{Ref: "main", Commit: pinned[:10]})
+	if err != nil {
+		t.Fatalf("ResolveCommit() error = %v", err)
+	}
+	if got != pinned {
+		t.Errorf("expected the pinned commit to resolve to %s, got %s", pinned, got)
+	}
+
+	if _, err := gm.ResolveCommit(context.Background(), "org/service", config.PinnedRef{Commit: "0000000"}); err == nil {
+		t.Errorf("expected an error for a commit that does not exist")
+	}
+
+	// The workspace holds exactly the pinned revision
+	workspace := filepath.Join(t.TempDir(), "service")
+	if err := exportCommit(context.Background(), filepath.Join(cacheDir, "repos", "org", "service", "main"), pinned, workspace); err != nil {
+		t.Fatalf("exportCommit() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(workspace, "tako.yml"))
+	if err != nil {
+		t.Fatalf("failed to read exported tako.yml: %v", err)
+	}
+	if string(data) != "version: 0.1.0\n" {
+		t.Errorf("expected the tako.yml of the pinned commit, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(workspace, ".git")); !os.IsNotExist(err) {
+		t.Errorf("expected no Git metadata in the workspace")
+	}
+}
+
+func TestGitManager_ChangedPaths(t *testing.T) {
+	repo := createOriginRepository(t, t.TempDir(), "org", "library")
+	base := gitForTest(t, repo, "rev-parse", "HEAD")
+	for name, content := range map[string]string{"src/lib.go": "package lib\n", "docs/index.md": "# Docs\n"} {
+		if err := os.MkdirAll(filepath.Join(repo, filepath.Dir(name)), 0755); err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	gitForTest(t, repo, "add", "src")
+	gitForTest(t, repo, "commit", "-m", "add library")
+	gitForTest(t, repo, "add", "docs")
+	if err := os.WriteFile(filepath.Join(repo, "NOTES.md"), []byte("untracked"), 0644); err != nil {
+		t.Fatalf("failed to write NOTES.md: %v", err)
+	}
+
+	gm, err := NewGitManager(t.TempDir(), nil, GitOptions{})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+
+	// Committed, staged and untracked changes are all included
+	got, err := gm.ChangedPaths(context.Background(), repo, base)
+	if err != nil {
+		t.Fatalf("ChangedPaths() error = %v", err)
+	}
+	if want := []string{"NOTES.md", "docs/index.md", "src/lib.go"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	if _, err := gm.ChangedPaths(context.Background(), repo, "no-such-ref"); err == nil {
+		t.Error("expected an error for an unknown revision")
+	}
+	if _, err := gm.ChangedPaths(context.Background(), repo, "--output=diff.txt"); err == nil {
+		t.Error("expected an error for a revision starting with '-'")
+	}
+}
+
+func TestFanOutExecutor_ResolveChildRevision(t *testing.T) {
+	remotes := t.TempDir()
+	cacheDir := t.TempDir()
+	origin := createOriginRepository(t, remotes, "org", "service")
+	commit := gitForTest(t, origin, "rev-parse", "HEAD")
+
+	executor, err := NewFanOutExecutor(cacheDir, false, NewTestMockWorkflowRunner())
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	gm, err := NewGitManager(cacheDir, nil, GitOptions{BaseURL: "file://" + remotes})
+	if err != nil {
+		t.Fatalf("NewGitManager() error = %v", err)
+	}
+	executor.SetGitManager(gm)
+
+	state, err := executor.stateManager.CreateFanOutState("fanout-pin", "", "org/lib", "built", false, 0)
+	if err != nil {
+		t.Fatalf("failed to create state: %v", err)
+	}
+	sub := SubscriptionMatch{Repository: "org/service", Subscription: config.Subscription{Workflow: "build", Ref: "main"}}
+	state.AddChildWorkflow(sub.Repository, sub.Subscription.Workflow, nil)
+
+	// The refs of the fan-out step override the ref of the subscription
+	params := &FanOutParams{Refs: map[string]string{"org/service": "main@" + commit[:8]}}
+	repo, err := executor.resolveChildRevision(context.Background(), sub, params, state)
+	if err != nil {
+		t.Fatalf("resolveChildRevision() error = %v", err)
+	}
+	if want := "org/service:main@" + commit; repo != want {
+		t.Errorf("expected child repository %s, got %s", want, repo)
+	}
+
+	child := state.Children["org/service-build"]
+	if child.Ref != "main@"+commit[:8] || child.Commit != commit {
+		t.Errorf("expected the pinned ref and resolved commit to be recorded, got ref %q commit %q", child.Ref, child.Commit)
+	}
+}
@@ -0,0 +1,185 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/dangazineu/tako/internal/cache"
+)
+
+// Engine health statuses, from best to worst.
+const (
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+// unhealthyIssues is the number of issues from which the engine is unhealthy rather than degraded,
+// like for the health of fan-outs.
+const unhealthyIssues = 3
+
+// HealthOptions configures a health check of the engine.
+type HealthOptions struct {
+	CacheDir      string
+	WorkspaceRoot string
+	// StaleAfter is how long a running state that does not record its owner process goes without
+	// being updated before it is stale (DefaultOrphanStaleAfter when zero).
+	StaleAfter time.Duration
+	// MaxCacheSize is the size quota of the cache; a larger cache is an issue (no quota when zero).
+	MaxCacheSize int64
+}
+
+// EngineHealth is the health of the engine, as seen from the states of its cache and workspaces.
+type EngineHealth struct {
+	Status          string                `json:"status"` // healthy, degraded or unhealthy
+	CheckedAt       time.Time             `json:"checked_at"`
+	ActiveFanOuts   int                   `json:"active_fan_outs"`
+	CircuitBreakers CircuitBreakerSummary `json:"circuit_breakers"`
+	Disk            DiskUsage             `json:"disk"`
+	Stale           StaleStates           `json:"stale"`
+	Issues          []string              `json:"issues,omitempty"`
+	Errors          []string              `json:"errors,omitempty"`
+}
+
+// CircuitBreakerSummary counts the circuit breakers with recorded failures by state.
+type CircuitBreakerSummary struct {
+	Open     int `json:"open"`
+	HalfOpen int `json:"half_open"`
+	// Failing counts the closed circuit breakers with failures below their threshold.
+	Failing int `json:"failing"`
+	// OpenEndpoints are the endpoints whose circuit breakers block requests.
+	OpenEndpoints []string `json:"open_endpoints,omitempty"`
+}
+
+// DiskUsage is the size in bytes of the cache and workspaces.
+type DiskUsage struct {
+	Cache        int64 `json:"cache"`
+	MaxCacheSize int64 `json:"max_cache_size,omitempty"`
+	Workspaces   int64 `json:"workspaces"`
+}
+
+// StaleStates counts the states left running by processes that died, which Reconcile recovers.
+type StaleStates struct {
+	Runs    int `json:"runs"`
+	FanOuts int `json:"fan_outs"`
+}
+
+// CheckEngineHealth checks the health of the engine from its cache and workspaces. Every open
+// circuit breaker, kind of stale state and exceeded quota is an issue: the engine is degraded
+// with issues, and unhealthy with 3 or more of them or when part of the check failed.
+func CheckEngineHealth(opts HealthOptions, now time.Time) EngineHealth {
+	health := EngineHealth{CheckedAt: now}
+	staleAfter := opts.StaleAfter
+	if staleAfter <= 0 {
+		staleAfter = DefaultOrphanStaleAfter
+	}
+	fail := func(format string, args ...interface{}) {
+		health.Errors = append(health.Errors, fmt.Sprintf(format, args...))
+	}
+
+	if states, err := NewFanOutStateManager(filepath.Join(opts.CacheDir, "fanout-states")); err != nil {
+		fail("failed to read fan-out states: %v", err)
+	} else {
+		health.Stale.FanOuts = len(states.orphanedStates(staleAfter, now))
+		health.ActiveFanOuts = len(states.ListActiveFanOuts()) - health.Stale.FanOuts
+	}
+	if runs, err := orphanedExecutionStates(opts.WorkspaceRoot, staleAfter, now); err != nil {
+		fail("failed to read execution states: %v", err)
+	} else {
+		health.Stale.Runs = len(runs)
+	}
+
+	if store, err := NewCircuitBreakerStore(opts.CacheDir); err != nil {
+		fail("%v", err)
+	} else if snapshots, err := store.List(); err != nil {
+		fail("%v", err)
+	} else {
+		health.CircuitBreakers = summarizeCircuitBreakers(snapshots, now)
+	}
+
+	if size, err := cache.DirSize(opts.CacheDir); err != nil {
+		fail("%v", err)
+	} else {
+		health.Disk.Cache = size
+	}
+	if size, err := cache.DirSize(opts.WorkspaceRoot); err != nil {
+		fail("%v", err)
+	} else {
+		health.Disk.Workspaces = size
+	}
+	health.Disk.MaxCacheSize = opts.MaxCacheSize
+
+	for _, endpoint := range health.CircuitBreakers.OpenEndpoints {
+		health.Issues = append(health.Issues, fmt.Sprintf("Circuit breaker open for endpoint: %s", endpoint))
+	}
+	if health.Stale.Runs > 0 {
+		health.Issues = append(health.Issues, fmt.Sprintf("Stale runs: %d", health.Stale.Runs))
+	}
+	if health.Stale.FanOuts > 0 {
+		health.Issues = append(health.Issues, fmt.Sprintf("Stale fan-outs: %d", health.Stale.FanOuts))
+	}
+	if opts.MaxCacheSize > 0 && health.Disk.Cache > opts.MaxCacheSize {
+		health.Issues = append(health.Issues, fmt.Sprintf("Cache over its quota: %s of %s",
+			cache.FormatSize(health.Disk.Cache), cache.FormatSize(opts.MaxCacheSize)))
+	}
+
+	switch {
+	case len(health.Errors) > 0 || len(health.Issues) >= unhealthyIssues:
+		health.Status = HealthUnhealthy
+	case len(health.Issues) > 0:
+		health.Status = HealthDegraded
+	default:
+		health.Status = HealthHealthy
+	}
+	return health
+}
+
+// summarizeCircuitBreakers counts persisted circuit breakers by the state they are in at a time:
+// an open circuit breaker whose timeout elapsed lets a probe through, like a half-open one.
+func summarizeCircuitBreakers(snapshots []CircuitBreakerSnapshot, now time.Time) CircuitBreakerSummary {
+	var summary CircuitBreakerSummary
+	for _, snapshot := range snapshots {
+		switch snapshot.State {
+		case CircuitBreakerOpen.String():
+			if snapshot.OpenUntil != nil && !now.Before(*snapshot.OpenUntil) {
+				summary.HalfOpen++
+				continue
+			}
+			summary.Open++
+			summary.OpenEndpoints = append(summary.OpenEndpoints, snapshot.Endpoint)
+		case CircuitBreakerHalfOpen.String():
+			summary.HalfOpen++
+		default:
+			summary.Failing++
+		}
+	}
+	return summary
+}
+
+// Health checks the health of the runner's engine.
+func (r *Runner) Health(opts HealthOptions) EngineHealth {
+	opts.CacheDir = r.getCacheDir()
+	opts.WorkspaceRoot = r.workspaceRoot
+	return CheckEngineHealth(opts, r.now())
+}
+
+// HealthHandler serves the health of the runner's engine as JSON, with a 503 status when it is
+// unhealthy, for the liveness and readiness probes of orchestrators.
+func (r *Runner) HealthHandler(opts HealthOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		health := r.Health(opts)
+		w.Header().Set("Content-Type", "application/json")
+		if health.Status == HealthUnhealthy {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(health)
+	})
+}
@@ -0,0 +1,87 @@
+package engine
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCheckEngineHealth(t *testing.T) {
+	cacheDir, workspaceRoot := t.TempDir(), t.TempDir()
+	opts := HealthOptions{CacheDir: cacheDir, WorkspaceRoot: workspaceRoot, StaleAfter: time.Minute}
+	now := time.Now()
+
+	health := CheckEngineHealth(opts, now)
+	if health.Status != HealthHealthy || len(health.Issues) != 0 || len(health.Errors) != 0 {
+		t.Fatalf("expected an empty cache to be healthy, got %+v", health)
+	}
+
+	manager, err := NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	for _, id := range []string{"fanout-live", "fanout-stale"} {
+		state, err := manager.CreateFanOutState(id, "", "org/source", "test_event", true, 0)
+		if err != nil {
+			t.Fatalf("Failed to create state: %v", err)
+		}
+		state.StartFanOut()
+		if id == "fanout-stale" {
+			state.mu.Lock()
+			state.OwnerPID = deadProcessID(t)
+			state.mu.Unlock()
+			manager.persistState(state)
+		}
+	}
+
+	store, err := NewCircuitBreakerStore(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	future, past := now.Add(time.Minute), now.Add(-time.Minute)
+	for _, snapshot := range []CircuitBreakerSnapshot{
+		{Endpoint: "org/app:update", State: "open", Failures: 5, OpenUntil: &future},
+		{Endpoint: "org/api:deploy", State: "open", Failures: 5, OpenUntil: &past},
+		{Endpoint: "org/docs:publish", State: "closed", Failures: 1},
+	} {
+		if err := store.Save(snapshot); err != nil {
+			t.Fatalf("Failed to save snapshot: %v", err)
+		}
+	}
+
+	health = CheckEngineHealth(opts, now)
+	if health.Status != HealthDegraded || len(health.Issues) != 2 {
+		t.Errorf("expected an open circuit breaker and a stale fan-out to degrade the engine, got %s: %v", health.Status, health.Issues)
+	}
+	if health.ActiveFanOuts != 1 || health.Stale.FanOuts != 1 || health.Stale.Runs != 0 {
+		t.Errorf("unexpected fan-outs: %d active, %+v stale", health.ActiveFanOuts, health.Stale)
+	}
+	breakers := health.CircuitBreakers
+	if breakers.Open != 1 || breakers.HalfOpen != 1 || breakers.Failing != 1 || len(breakers.OpenEndpoints) != 1 || breakers.OpenEndpoints[0] != "org/app:update" {
+		t.Errorf("unexpected circuit breakers %+v", breakers)
+	}
+	if health.Disk.Cache == 0 {
+		t.Errorf("expected the size of the cache to be measured")
+	}
+
+	// A cache over its quota is a third issue
+	opts.MaxCacheSize = 1
+	health = CheckEngineHealth(opts, now)
+	if health.Status != HealthUnhealthy || len(health.Issues) != 3 {
+		t.Errorf("expected three issues to make the engine unhealthy, got %s: %v", health.Status, health.Issues)
+	}
+
+	runner := &Runner{workspaceRoot: workspaceRoot, cacheDir: cacheDir}
+	recorder := httptest.NewRecorder()
+	runner.HealthHandler(opts).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	var served EngineHealth
+	if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+		t.Fatalf("expected the health as JSON, got %q: %v", recorder.Body.String(), err)
+	}
+	if recorder.Code != http.StatusServiceUnavailable || served.Status != HealthUnhealthy {
+		t.Errorf("expected an unhealthy engine to be served with a 503, got %d (%s)", recorder.Code, served.Status)
+	}
+}
@@ -0,0 +1,286 @@
+package engine
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Statuses of completed runs in the history.
+const (
+	HistoryStatusCompleted = "completed"
+	HistoryStatusFailed    = "failed"
+	HistoryStatusCancelled = "cancelled"
+	HistoryStatusTimedOut  = "timed_out"
+)
+
+// HistoryRecord is the compact record of a completed run kept in the execution history.
+type HistoryRecord struct {
+	RunID         string        `json:"run_id"`
+	ParentRunID   string        `json:"parent_run_id,omitempty"`
+	CorrelationID string        `json:"correlation_id,omitempty"`
+	Repository    string        `json:"repository"`
+	Workflow      string        `json:"workflow"`
+	Status        string        `json:"status"`
+	StartTime     time.Time     `json:"start_time"`
+	EndTime       time.Time     `json:"end_time"`
+	Duration      time.Duration `json:"duration"`
+	Error         string        `json:"error,omitempty"`
+
+	// Children counts the child workflows triggered by the run's fan-out steps.
+	Children HistoryChildCounts `json:"children"`
+
+	// Steps are the steps the run executed, in order.
+	Steps []HistoryStep `json:"steps,omitempty"`
+
+	// LogDir is the directory of the logs of the run's steps, if any was logged.
+	LogDir string `json:"log_dir,omitempty"`
+}
+
+// Statuses of steps in the history.
+const (
+	HistoryStepSucceeded = "succeeded"
+	HistoryStepFailed    = "failed"
+	HistoryStepSkipped   = "skipped"
+)
+
+// HistoryStep is the record of a step of a run.
+type HistoryStep struct {
+	ID       string            `json:"id"`
+	Status   string            `json:"status"`
+	Duration time.Duration     `json:"duration"`
+	Outputs  map[string]string `json:"outputs,omitempty"`
+}
+
+// newHistorySteps records the results of the steps of a run.
+func newHistorySteps(results []StepResult) []HistoryStep {
+	steps := make([]HistoryStep, 0, len(results))
+	for _, result := range results {
+		step := HistoryStep{
+			ID:       result.ID,
+			Status:   HistoryStepSucceeded,
+			Duration: result.EndTime.Sub(result.StartTime),
+			Outputs:  result.Outputs,
+		}
+		if result.Skipped {
+			step.Status = HistoryStepSkipped
+		} else if !result.Success {
+			step.Status = HistoryStepFailed
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// HistoryChildCounts counts the child workflows of a run by outcome.
+type HistoryChildCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+	TimedOut  int `json:"timed_out,omitempty"`
+	Cancelled int `json:"cancelled,omitempty"`
+	Skipped   int `json:"skipped,omitempty"`
+}
+
+// add adds the children of a fan-out to the counts.
+func (c *HistoryChildCounts) add(summary FanOutSummary) {
+	c.Total += summary.TotalChildren
+	c.Completed += summary.CompletedChildren
+	c.Failed += summary.FailedChildren
+	c.TimedOut += summary.TimedOutChildren
+	c.Cancelled += summary.CancelledChildren
+	c.Skipped += summary.SkippedChildren
+}
+
+// HistoryFilter selects records of the execution history. Zero fields select every record.
+type HistoryFilter struct {
+	Repository    string
+	Workflow      string
+	CorrelationID string    // Runs of the execution tree with this correlation ID
+	Since         time.Time // Runs that ended at or after this time
+	Limit         int       // Most recent records returned; all when zero
+}
+
+// matches reports whether a record is selected by the filter.
+func (f HistoryFilter) matches(record HistoryRecord) bool {
+	if f.Repository != "" && record.Repository != f.Repository {
+		return false
+	}
+	if f.CorrelationID != "" && record.CorrelationID != f.CorrelationID {
+		return false
+	}
+	if f.Workflow != "" && record.Workflow != f.Workflow {
+		return false
+	}
+	return f.Since.IsZero() || !record.EndTime.Before(f.Since)
+}
+
+// HistoryStore is the append-only execution history of the cache: one JSON record per line,
+// appended when a run completes.
+type HistoryStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewHistoryStore creates the execution history of a cache directory.
+func NewHistoryStore(cacheDir string) (*HistoryStore, error) {
+	dir := filepath.Join(cacheDir, "history")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create history directory: %v", err)
+	}
+	return &HistoryStore{path: filepath.Join(dir, "runs.jsonl")}, nil
+}
+
+// Append adds a record to the history. Records are written with a single append, so that
+// concurrent processes do not interleave them.
+func (h *HistoryStore) Append(record HistoryRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history record: %v", err)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open history: %v", err)
+	}
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to append to history: %v", err)
+	}
+	return file.Close()
+}
+
+// Get returns the record of a run, or nil when the history has none.
+func (h *HistoryStore) Get(runID string) (*HistoryRecord, error) {
+	records, err := h.Query(HistoryFilter{})
+	if err != nil {
+		return nil, err
+	}
+	for i := range records {
+		if records[i].RunID == runID {
+			return &records[i], nil
+		}
+	}
+	return nil, nil
+}
+
+// Query returns the records selected by the filter, most recent first. Lines that are not
+// records, e.g. a record truncated by a crash, are ignored.
+func (h *HistoryStore) Query(filter HistoryFilter) ([]HistoryRecord, error) {
+	file, err := os.Open(h.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %v", err)
+	}
+	defer file.Close()
+
+	var records []HistoryRecord
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		var record HistoryRecord
+		if len(line) > 0 && json.Unmarshal(line, &record) == nil && record.RunID != "" && filter.matches(record) {
+			records = append(records, record)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %v", err)
+		}
+	}
+
+	// Records are appended as runs end
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+// Compact removes the records of the runs that ended before a time, and the lines that are not
+// records, by rewriting the history. Records appended by other processes while it is rewritten
+// are carried over. It returns the number of records removed.
+func (h *HistoryStore) Compact(before time.Time) (int, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	data, err := os.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read history: %v", err)
+	}
+
+	var kept []byte
+	removed := 0
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		var record HistoryRecord
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if json.Unmarshal(line, &record) != nil || record.RunID == "" {
+			// A record being appended is not complete yet; it is carried over below
+			if !bytes.HasSuffix(line, []byte("\n")) {
+				data = data[:len(data)-len(line)]
+			}
+			continue
+		}
+		if record.EndTime.Before(before) {
+			removed++
+			continue
+		}
+		kept = append(kept, line...)
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(h.path), ".tmp-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to compact history: %v", err)
+	}
+	_, err = temp.Write(kept)
+	if err == nil {
+		err = h.carryOver(temp, int64(len(data)))
+	}
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(temp.Name(), h.path)
+	}
+	if err != nil {
+		os.Remove(temp.Name()) // Clean up on failure
+		return 0, fmt.Errorf("failed to compact history: %v", err)
+	}
+	return removed, nil
+}
+
+// carryOver copies to the compacted history the bytes appended to the history since offset.
+func (h *HistoryStore) carryOver(temp *os.File, offset int64) error {
+	file, err := os.Open(h.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	_, err = io.Copy(temp, file)
+	return err
+}
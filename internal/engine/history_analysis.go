@@ -0,0 +1,165 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// RunComparison compares two runs of the same workflow step by step.
+type RunComparison struct {
+	Base  *HistoryRecord   `json:"base"`
+	Other *HistoryRecord   `json:"other"`
+	Steps []StepComparison `json:"steps"`
+}
+
+// StepComparison compares a step of two runs. A step that one of the runs did not execute has
+// an empty status in that run.
+type StepComparison struct {
+	ID            string        `json:"id"`
+	BaseStatus    string        `json:"base_status,omitempty"`
+	OtherStatus   string        `json:"other_status,omitempty"`
+	BaseDuration  time.Duration `json:"base_duration"`
+	OtherDuration time.Duration `json:"other_duration"`
+	// ChangedOutputs are the outputs whose values differ, with their values in both runs.
+	ChangedOutputs []OutputChange `json:"changed_outputs,omitempty"`
+}
+
+// OutputChange is an output of a step whose value differs between two runs.
+type OutputChange struct {
+	Name  string `json:"name"`
+	Base  string `json:"base"`
+	Other string `json:"other"`
+}
+
+// DurationDelta returns how much longer the step took in the other run.
+func (c StepComparison) DurationDelta() time.Duration {
+	return c.OtherDuration - c.BaseDuration
+}
+
+// StatusChanged reports whether the step had different outcomes in the two runs.
+func (c StepComparison) StatusChanged() bool {
+	return c.BaseStatus != c.OtherStatus
+}
+
+// CompareRuns compares two runs of the same workflow. Steps are listed in the order of the base
+// run, followed by the steps only the other run executed.
+func CompareRuns(base, other *HistoryRecord) (*RunComparison, error) {
+	if base.Repository != other.Repository || base.Workflow != other.Workflow {
+		return nil, fmt.Errorf("runs %s and %s are of different workflows: %s:%s and %s:%s",
+			base.RunID, other.RunID, base.Repository, base.Workflow, other.Repository, other.Workflow)
+	}
+
+	otherSteps := make(map[string]HistoryStep, len(other.Steps))
+	for _, step := range other.Steps {
+		otherSteps[step.ID] = step
+	}
+
+	comparison := &RunComparison{Base: base, Other: other}
+	seen := make(map[string]bool, len(base.Steps))
+	for _, step := range base.Steps {
+		seen[step.ID] = true
+		stepComparison := StepComparison{ID: step.ID, BaseStatus: step.Status, BaseDuration: step.Duration}
+		if otherStep, ok := otherSteps[step.ID]; ok {
+			stepComparison.OtherStatus = otherStep.Status
+			stepComparison.OtherDuration = otherStep.Duration
+			stepComparison.ChangedOutputs = compareOutputs(step.Outputs, otherStep.Outputs)
+		}
+		comparison.Steps = append(comparison.Steps, stepComparison)
+	}
+	for _, step := range other.Steps {
+		if !seen[step.ID] {
+			comparison.Steps = append(comparison.Steps, StepComparison{ID: step.ID, OtherStatus: step.Status, OtherDuration: step.Duration})
+		}
+	}
+	return comparison, nil
+}
+
+// compareOutputs returns the outputs whose values differ, sorted by name.
+func compareOutputs(base, other map[string]string) []OutputChange {
+	var changes []OutputChange
+	for name, value := range base {
+		if otherValue, ok := other[name]; !ok || otherValue != value {
+			changes = append(changes, OutputChange{Name: name, Base: value, Other: other[name]})
+		}
+	}
+	for name, value := range other {
+		if _, ok := base[name]; !ok {
+			changes = append(changes, OutputChange{Name: name, Other: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Name < changes[j].Name })
+	return changes
+}
+
+// FlakyStep is a step that fails intermittently across recent runs of its workflow.
+type FlakyStep struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	Step       string `json:"step"`
+	Runs       int    `json:"runs"`
+	Failures   int    `json:"failures"`
+	// Flips counts the changes between success and failure from one run to the next.
+	Flips       int       `json:"flips"`
+	LastFailure time.Time `json:"last_failure"`
+}
+
+// FailureRate returns the percentage of the runs in which the step failed.
+func (s FlakyStep) FailureRate() float64 {
+	return float64(s.Failures) * 100 / float64(s.Runs)
+}
+
+// FindFlakySteps identifies the steps that fail intermittently in the given runs: steps that
+// both failed and succeeded, and whose outcome changed at least twice in a row of runs. A step
+// that broke once and kept failing, or that was fixed once, flips only once and is not flaky.
+// Skipped steps are ignored. Steps are sorted by decreasing number of flips, then failures.
+func FindFlakySteps(records []HistoryRecord) []FlakyStep {
+	type stepKey struct{ repository, workflow, step string }
+
+	// Walk the runs from the oldest to the most recent
+	chronological := append([]HistoryRecord(nil), records...)
+	sort.SliceStable(chronological, func(i, j int) bool { return chronological[i].EndTime.Before(chronological[j].EndTime) })
+
+	stats := make(map[stepKey]*FlakyStep)
+	lastStatus := make(map[stepKey]string)
+	for _, record := range chronological {
+		for _, step := range record.Steps {
+			if step.Status == HistoryStepSkipped {
+				continue
+			}
+			key := stepKey{record.Repository, record.Workflow, step.ID}
+			stat, ok := stats[key]
+			if !ok {
+				stat = &FlakyStep{Repository: record.Repository, Workflow: record.Workflow, Step: step.ID}
+				stats[key] = stat
+			}
+			stat.Runs++
+			if step.Status == HistoryStepFailed {
+				stat.Failures++
+				stat.LastFailure = record.EndTime
+			}
+			if previous, ok := lastStatus[key]; ok && previous != step.Status {
+				stat.Flips++
+			}
+			lastStatus[key] = step.Status
+		}
+	}
+
+	var flaky []FlakyStep
+	for _, stat := range stats {
+		if stat.Failures > 0 && stat.Failures < stat.Runs && stat.Flips >= 2 {
+			flaky = append(flaky, *stat)
+		}
+	}
+	sort.Slice(flaky, func(i, j int) bool {
+		if flaky[i].Flips != flaky[j].Flips {
+			return flaky[i].Flips > flaky[j].Flips
+		}
+		if flaky[i].Failures != flaky[j].Failures {
+			return flaky[i].Failures > flaky[j].Failures
+		}
+		a, b := flaky[i], flaky[j]
+		return a.Repository+":"+a.Workflow+":"+a.Step < b.Repository+":"+b.Workflow+":"+b.Step
+	})
+	return flaky
+}
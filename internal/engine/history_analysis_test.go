@@ -0,0 +1,79 @@
+package engine
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareRuns(t *testing.T) {
+	base := &HistoryRecord{RunID: "exec-a", Repository: "org/app", Workflow: "build", Steps: []HistoryStep{
+		{ID: "compile", Status: HistoryStepSucceeded, Duration: time.Second, Outputs: map[string]string{"version": "1.0", "sha": "abc"}},
+		{ID: "test", Status: HistoryStepFailed, Duration: 2 * time.Second},
+	}}
+	other := &HistoryRecord{RunID: "exec-b", Repository: "org/app", Workflow: "build", Steps: []HistoryStep{
+		{ID: "compile", Status: HistoryStepSucceeded, Duration: 1500 * time.Millisecond, Outputs: map[string]string{"version": "1.1", "sha": "abc", "tag": "v1.1"}},
+		{ID: "test", Status: HistoryStepSucceeded, Duration: time.Second},
+		{ID: "publish", Status: HistoryStepSucceeded, Duration: time.Second},
+	}}
+
+	comparison, err := CompareRuns(base, other)
+	if err != nil {
+		t.Fatalf("CompareRuns failed: %v", err)
+	}
+	if len(comparison.Steps) != 3 {
+		t.Fatalf("expected 3 steps, got %+v", comparison.Steps)
+	}
+
+	compile := comparison.Steps[0]
+	if compile.StatusChanged() || compile.DurationDelta() != 500*time.Millisecond {
+		t.Errorf("unexpected comparison of compile: %+v", compile)
+	}
+	if len(compile.ChangedOutputs) != 2 ||
+		compile.ChangedOutputs[0] != (OutputChange{Name: "tag", Other: "v1.1"}) ||
+		compile.ChangedOutputs[1] != (OutputChange{Name: "version", Base: "1.0", Other: "1.1"}) {
+		t.Errorf("unexpected changed outputs: %+v", compile.ChangedOutputs)
+	}
+	if test := comparison.Steps[1]; !test.StatusChanged() || test.DurationDelta() != -time.Second {
+		t.Errorf("unexpected comparison of test: %+v", test)
+	}
+	if publish := comparison.Steps[2]; publish.ID != "publish" || publish.BaseStatus != "" || publish.OtherStatus != HistoryStepSucceeded {
+		t.Errorf("unexpected comparison of publish: %+v", publish)
+	}
+
+	other.Workflow = "release"
+	if _, err := CompareRuns(base, other); err == nil {
+		t.Error("expected an error comparing runs of different workflows")
+	}
+}
+
+func TestFindFlakySteps(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Outcomes of the steps, from the oldest run to the most recent
+	outcomes := []map[string]string{
+		{"flaky": HistoryStepSucceeded, "broken": HistoryStepSucceeded, "stable": HistoryStepSucceeded, "optional": HistoryStepSkipped},
+		{"flaky": HistoryStepFailed, "broken": HistoryStepSucceeded, "stable": HistoryStepSucceeded, "optional": HistoryStepFailed},
+		{"flaky": HistoryStepSucceeded, "broken": HistoryStepFailed, "stable": HistoryStepSucceeded, "optional": HistoryStepSkipped},
+		{"flaky": HistoryStepFailed, "broken": HistoryStepFailed, "stable": HistoryStepSucceeded, "optional": HistoryStepSucceeded},
+	}
+
+	var records []HistoryRecord
+	for i, steps := range outcomes {
+		record := HistoryRecord{RunID: "exec", Repository: "org/app", Workflow: "build", EndTime: start.Add(time.Duration(i) * time.Hour)}
+		for _, id := range []string{"flaky", "broken", "stable", "optional"} {
+			record.Steps = append(record.Steps, HistoryStep{ID: id, Status: steps[id]})
+		}
+		// The history lists the most recent runs first
+		records = append([]HistoryRecord{record}, records...)
+	}
+
+	// The broken step failed from one run on and the optional step, whose skipped runs do not
+	// count, was fixed once: neither flipped twice
+	flaky := FindFlakySteps(records)
+	if len(flaky) != 1 {
+		t.Fatalf("expected 1 flaky step, got %+v", flaky)
+	}
+	if flaky[0].Step != "flaky" || flaky[0].Runs != 4 || flaky[0].Failures != 2 || flaky[0].Flips != 3 ||
+		!flaky[0].LastFailure.Equal(start.Add(3*time.Hour)) || flaky[0].FailureRate() != 50 {
+		t.Errorf("unexpected flaky step: %+v", flaky[0])
+	}
+}
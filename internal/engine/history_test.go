@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHistoryStore_Query(t *testing.T) {
+	cacheDir := t.TempDir()
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create history: %v", err)
+	}
+
+	if records, err := history.Query(HistoryFilter{}); err != nil || len(records) != 0 {
+		t.Fatalf("Expected an empty history, got %v, %v", records, err)
+	}
+
+	now := time.Now()
+	for i, record := range []HistoryRecord{
+		{RunID: "run-1", Repository: "org/app", Workflow: "build", EndTime: now.Add(-48 * time.Hour)},
+		{RunID: "run-2", Repository: "org/app", Workflow: "deploy", CorrelationID: "run-2", EndTime: now.Add(-time.Hour)},
+		{RunID: "run-3", Repository: "org/lib", Workflow: "build", CorrelationID: "run-2", EndTime: now},
+	} {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("Failed to append record %d: %v", i, err)
+		}
+	}
+
+	// A record truncated by a crash is ignored
+	file, err := os.OpenFile(filepath.Join(cacheDir, "history", "runs.jsonl"), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	file.WriteString(`{"run_id": "run-4", "repos`)
+	file.Close()
+
+	tests := []struct {
+		name     string
+		filter   HistoryFilter
+		expected []string
+	}{
+		{name: "all", filter: HistoryFilter{}, expected: []string{"run-3", "run-2", "run-1"}},
+		{name: "repository", filter: HistoryFilter{Repository: "org/app"}, expected: []string{"run-2", "run-1"}},
+		{name: "workflow", filter: HistoryFilter{Workflow: "build"}, expected: []string{"run-3", "run-1"}},
+		{name: "correlation", filter: HistoryFilter{CorrelationID: "run-2"}, expected: []string{"run-3", "run-2"}},
+		{name: "since", filter: HistoryFilter{Since: now.Add(-24 * time.Hour)}, expected: []string{"run-3", "run-2"}},
+		{name: "limit", filter: HistoryFilter{Limit: 1}, expected: []string{"run-3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			records, err := history.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			var ids []string
+			for _, record := range records {
+				ids = append(ids, record.RunID)
+			}
+			if len(ids) != len(tt.expected) {
+				t.Fatalf("Expected %v, got %v", tt.expected, ids)
+			}
+			for i := range ids {
+				if ids[i] != tt.expected[i] {
+					t.Errorf("Expected %v, got %v", tt.expected, ids)
+				}
+			}
+		})
+	}
+}
+
+func TestHistoryStore_Compact(t *testing.T) {
+	history, err := NewHistoryStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create history: %v", err)
+	}
+	if removed, err := history.Compact(time.Now()); err != nil || removed != 0 {
+		t.Fatalf("Expected nothing to compact in an empty history, got %d, %v", removed, err)
+	}
+
+	now := time.Now()
+	for i, record := range []HistoryRecord{
+		{RunID: "run-1", EndTime: now.Add(-72 * time.Hour)},
+		{RunID: "run-2", EndTime: now.Add(-48 * time.Hour)},
+		{RunID: "run-3", EndTime: now},
+	} {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("Failed to append record %d: %v", i, err)
+		}
+	}
+
+	removed, err := history.Compact(now.Add(-24 * time.Hour))
+	if err != nil || removed != 2 {
+		t.Fatalf("Expected the 2 old records removed, got %d, %v", removed, err)
+	}
+	if err := history.Append(HistoryRecord{RunID: "run-4", EndTime: now}); err != nil {
+		t.Fatalf("Failed to append record: %v", err)
+	}
+	records, err := history.Query(HistoryFilter{})
+	if err != nil || len(records) != 2 || records[0].RunID != "run-4" || records[1].RunID != "run-3" {
+		t.Errorf("Expected the recent records kept, got %+v, %v", records, err)
+	}
+}
+
+func TestRunnerRecordsHistory(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - run: echo building
+  broken:
+    steps:
+      - run: exit 1
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	for _, workflow := range []string{"build", "broken"} {
+		runner, err := NewRunner(RunnerOptions{WorkspaceRoot: filepath.Join(tempDir, "workspace"), CacheDir: cacheDir})
+		if err != nil {
+			t.Fatalf("Failed to create runner: %v", err)
+		}
+		runner.ExecuteWorkflow(context.Background(), workflow, nil, tempDir)
+		runner.Close()
+	}
+
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	records, err := history.Query(HistoryFilter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 recorded runs, got %+v", records)
+	}
+	if records[0].Workflow != "broken" || records[0].Status != HistoryStatusFailed || records[0].Error == "" {
+		t.Errorf("Unexpected record of the failed run: %+v", records[0])
+	}
+	if records[1].Workflow != "build" || records[1].Status != HistoryStatusCompleted || records[1].RunID == "" {
+		t.Errorf("Unexpected record of the successful run: %+v", records[1])
+	}
+}
@@ -0,0 +1,38 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// ErrRunInterrupted is the cause of contexts cancelled because the tako process received an
+// interrupt or termination signal.
+var ErrRunInterrupted = errors.New("run was interrupted")
+
+// NotifyInterrupt returns a context cancelled with ErrRunInterrupted when the process receives
+// SIGINT or SIGTERM, so that runs stop and persist their states as interrupted before the
+// process exits. stop releases the signals.
+func NotifyInterrupt(parent context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signals:
+			cancel(ErrRunInterrupted)
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, func() {
+		signal.Stop(signals)
+		cancel(context.Canceled)
+	}
+}
+
+// IsRunInterrupted reports whether a context was cancelled because the process was interrupted.
+func IsRunInterrupted(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrRunInterrupted)
+}
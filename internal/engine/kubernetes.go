@@ -0,0 +1,509 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// BackendKubernetes runs child workflows as Kubernetes Jobs.
+const BackendKubernetes = "kubernetes"
+
+// Defaults of the Kubernetes backend.
+const (
+	DefaultKubernetesNamespace    = "default"
+	DefaultKubernetesPollInterval = 5 * time.Second
+	DefaultKubernetesTimeout      = time.Hour
+
+	// kubernetesLogGrace is how long logs are awaited once the Job finished.
+	kubernetesLogGrace = 10 * time.Second
+)
+
+// KubernetesOptions configures the Kubernetes backend.
+type KubernetesOptions struct {
+	// Namespace of the Jobs, DefaultKubernetesNamespace when empty
+	Namespace string
+
+	// Image runs the Jobs unless the workflow or the execution.image of its tako.yml sets
+	// one; it must provide the tako binary
+	Image string
+
+	// Kubectl is the kubectl binary, "kubectl" when empty
+	Kubectl string
+
+	// Context is the kubeconfig context; the current context when empty
+	Context string
+
+	// ServiceAccount runs the Jobs' pods; the namespace default when empty
+	ServiceAccount string
+
+	// EnvSecret names a Secret whose keys are set as environment variables of the Jobs,
+	// e.g. to provide TAKO_GITHUB_TOKEN
+	EnvSecret string
+
+	// PollInterval is how often Job status is polled, DefaultKubernetesPollInterval when zero
+	PollInterval time.Duration
+
+	// Timeout is the active deadline of Jobs, unless their workflow sets a timeout;
+	// DefaultKubernetesTimeout when zero
+	Timeout time.Duration
+}
+
+// KubernetesJobExecutor runs each child workflow as a Kubernetes Job that runs
+// `tako exec <workflow> --repo <repository>` in a container, through kubectl. The pod logs
+// are streamed into the output of the result, and the Job status is mapped to the status of
+// the child workflow. It implements the interfaces.WorkflowRunner interface.
+type KubernetesJobExecutor struct {
+	cacheDir      string
+	parentRunID   string
+	correlationID string
+	environment   []string // Environment of kubectl
+	opts          KubernetesOptions
+}
+
+// NewKubernetesJobExecutor creates an executor running the child workflows of a run as Jobs.
+// The tako.yml of cached repositories provides their image, resources and timeout.
+func NewKubernetesJobExecutor(cacheDir, parentRunID string, environment []string, opts KubernetesOptions) *KubernetesJobExecutor {
+	if opts.Namespace == "" {
+		opts.Namespace = DefaultKubernetesNamespace
+	}
+	if opts.Kubectl == "" {
+		opts.Kubectl = "kubectl"
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultKubernetesPollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultKubernetesTimeout
+	}
+	return &KubernetesJobExecutor{
+		cacheDir:    cacheDir,
+		parentRunID: parentRunID,
+		environment: environment,
+		opts:        opts,
+	}
+}
+
+// ExecuteWorkflow runs a workflow of a repository, given as owner/repo, owner/repo:ref or
+// owner/repo:ref@commit, as a Job and waits for it to finish. Failed, timed out and
+// cancelled Jobs give an unsuccessful result.
+func (e *KubernetesJobExecutor) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	if workflowName == "" {
+		return nil, fmt.Errorf("workflow name is required")
+	}
+	owner, repo, ref, _, err := parseRemoteRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := e.jobSpec(owner, repo, ref, workflowName)
+	if err != nil {
+		return nil, err
+	}
+
+	runID := GenerateRunID()
+	jobName := "tako-" + runID
+	lineage, _ := lineageFromContext(ctx)
+	correlationID, ok := correlationIDFromContext(ctx)
+	if !ok {
+		correlationID = e.correlationID
+	}
+	manifest, err := e.jobManifest(jobName, runID, repoPath, workflowName, inputs, correlationID, lineage, spec)
+	if err != nil {
+		return nil, err
+	}
+
+	startTime := time.Now()
+	if _, err := e.kubectl(ctx, bytes.NewReader(manifest), "create", "-f", "-"); err != nil {
+		return nil, fmt.Errorf("failed to create job for workflow '%s' of %s: %w", workflowName, repoPath, err)
+	}
+
+	// Stream the logs of the Job's pod while it runs
+	logCtx, stopLogs := context.WithCancel(context.WithoutCancel(ctx))
+	defer stopLogs()
+	logs := &lockedBuffer{}
+	logsDone := make(chan struct{})
+	go func() {
+		defer close(logsDone)
+		_ = e.kubectlStream(logCtx, logs, "logs", "--follow", "job/"+jobName, "--pod-running-timeout="+spec.timeout.String())
+	}()
+
+	status, waitErr := e.awaitJob(ctx, jobName)
+	if ctx.Err() != nil {
+		// Stop the Job's pods when the run is cancelled or times out
+		deleteCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Minute)
+		if _, err := e.kubectl(deleteCtx, nil, "delete", "job", jobName, "--ignore-not-found", "--wait=false", "--cascade=foreground"); err != nil {
+			fmt.Fprintf(os.Stderr, "warning: failed to delete job %s: %v\n", jobName, err)
+		}
+		cancel()
+	}
+
+	select {
+	case <-logsDone:
+	case <-time.After(kubernetesLogGrace):
+		stopLogs()
+		<-logsDone
+	}
+
+	result := &interfaces.ExecutionResult{
+		RunID:     runID,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+	}
+	step := interfaces.StepResult{
+		ID:        "kubernetes",
+		StartTime: startTime,
+		EndTime:   result.EndTime,
+		Output:    logs.String(),
+		Outputs: map[string]string{
+			"job":       jobName,
+			"namespace": e.opts.Namespace,
+			"status":    string(status),
+		},
+	}
+	switch {
+	case waitErr != nil:
+		result.Error = waitErr
+		if ctx.Err() != nil {
+			step.ErrorType = interfaces.StepErrorCancelled
+		}
+	case status == ChildStatusTimedOut:
+		result.Error = fmt.Errorf("job %s exceeded its deadline of %s", jobName, spec.timeout)
+		step.ErrorType = interfaces.StepErrorWorkflowTimeout
+	case status != ChildStatusCompleted:
+		result.Error = fmt.Errorf("job %s failed", jobName)
+	default:
+		result.Success = true
+	}
+	step.Success = result.Success
+	step.Error = result.Error
+	result.Steps = []interfaces.StepResult{step}
+	return result, nil
+}
+
+// kubernetesJobSpec holds what the tako.yml of a workflow contributes to its Job.
+type kubernetesJobSpec struct {
+	image   string
+	cpu     string // Kubernetes quantity, empty for no limit
+	memory  string // Kubernetes quantity, empty for no limit
+	timeout time.Duration
+}
+
+// jobSpec reads the image, resources and timeout of a workflow from its cached tako.yml.
+// Repositories that are not cached run with the options alone.
+func (e *KubernetesJobExecutor) jobSpec(owner, repo, ref, workflowName string) (kubernetesJobSpec, error) {
+	spec := kubernetesJobSpec{image: e.opts.Image, timeout: e.opts.Timeout}
+
+	takoYmlPath := filepath.Join(e.cacheDir, "repos", owner, repo, ref, "tako.yml")
+	if _, err := os.Stat(takoYmlPath); err == nil {
+		cfg, err := config.LoadWithCache(takoYmlPath, e.cacheDir)
+		if err != nil {
+			return spec, fmt.Errorf("failed to load tako.yml of %s/%s: %w", owner, repo, err)
+		}
+		if cfg.Execution != nil && cfg.Execution.Image != "" {
+			spec.image = cfg.Execution.Image
+		}
+		if workflow, ok := cfg.Workflows[workflowName]; ok {
+			if workflow.Image != "" {
+				spec.image = workflow.Image
+			}
+			if workflow.Timeout != "" {
+				if timeout, err := time.ParseDuration(workflow.Timeout); err == nil {
+					spec.timeout = timeout
+				}
+			}
+			if spec.cpu, spec.memory, err = kubernetesLimits(workflow); err != nil {
+				return spec, fmt.Errorf("invalid resources of workflow '%s': %w", workflowName, err)
+			}
+		}
+	}
+
+	if spec.image == "" {
+		return spec, fmt.Errorf("no image to run workflow '%s' of %s/%s: set execution.image in its tako.yml or the image of the kubernetes backend", workflowName, owner, repo)
+	}
+	return spec, nil
+}
+
+// kubernetesLimits converts the resources of a workflow into Kubernetes quantities. The
+// workflow's resources apply, or else the largest limits of its steps, since the Job runs
+// the steps one at a time.
+func kubernetesLimits(workflow config.Workflow) (cpu, memory string, err error) {
+	cpuSpecs := []string{workflow.Resources.CPULimit}
+	memSpecs := []string{workflow.Resources.MemLimit}
+	if workflow.Resources.CPULimit == "" || workflow.Resources.MemLimit == "" {
+		for _, step := range workflow.Steps {
+			if step.Resources == nil {
+				continue
+			}
+			if workflow.Resources.CPULimit == "" {
+				cpuSpecs = append(cpuSpecs, step.Resources.CPULimit)
+			}
+			if workflow.Resources.MemLimit == "" {
+				memSpecs = append(memSpecs, step.Resources.MemLimit)
+			}
+		}
+	}
+
+	maxCPU, err := maxResourceValue(cpuSpecs, ResourceTypeCPU)
+	if err != nil {
+		return "", "", err
+	}
+	maxMemory, err := maxResourceValue(memSpecs, ResourceTypeMemory)
+	if err != nil {
+		return "", "", err
+	}
+	if maxCPU > 0 {
+		cpu = fmt.Sprintf("%dm", int64(math.Ceil(maxCPU*1000)))
+	}
+	if maxMemory > 0 {
+		memory = fmt.Sprintf("%dMi", int64(math.Ceil(maxMemory)))
+	}
+	return cpu, memory, nil
+}
+
+// maxResourceValue returns the largest of resource specifications, in cores or megabytes.
+func maxResourceValue(specs []string, resourceType ResourceType) (float64, error) {
+	var maxValue float64
+	for _, spec := range specs {
+		if spec == "" {
+			continue
+		}
+		limit, err := ParseResourceSpec(spec, resourceType)
+		if err != nil {
+			return 0, err
+		}
+		maxValue = math.Max(maxValue, limit.Value)
+	}
+	return maxValue, nil
+}
+
+// kubernetesLabelValueRegex matches the values labels accept; correlation IDs received with
+// events may not be one.
+var kubernetesLabelValueRegex = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]{0,61}[A-Za-z0-9])?$`)
+
+// SetCorrelationID sets the correlation ID the Jobs pass to the runs of the child workflows.
+func (e *KubernetesJobExecutor) SetCorrelationID(correlationID string) {
+	e.correlationID = correlationID
+}
+
+// jobManifest returns the JSON manifest of the Job running a workflow.
+func (e *KubernetesJobExecutor) jobManifest(jobName, runID, repoPath, workflowName string, inputs map[string]string, correlationID string, lineage []string, spec kubernetesJobSpec) ([]byte, error) {
+	args := []string{"exec", workflowName, "--repo", repoPath}
+	for _, name := range slices.Sorted(maps.Keys(inputs)) {
+		args = append(args, fmt.Sprintf("--inputs.%s=%s", name, inputs[name]))
+	}
+
+	container := map[string]interface{}{
+		"name":    "tako",
+		"image":   spec.image,
+		"command": []string{"tako"},
+		"args":    args,
+		"env": []map[string]string{
+			{"name": "TAKO_RUN_ID", "value": runID},
+			{"name": ParentRunIDEnv, "value": e.parentRunID},
+			{"name": CorrelationIDEnv, "value": correlationID},
+			{"name": LineageEnv, "value": strings.Join(lineage, ",")},
+		},
+	}
+	if spec.cpu != "" || spec.memory != "" {
+		limits := map[string]string{}
+		if spec.cpu != "" {
+			limits["cpu"] = spec.cpu
+		}
+		if spec.memory != "" {
+			limits["memory"] = spec.memory
+		}
+		container["resources"] = map[string]interface{}{"limits": limits, "requests": limits}
+	}
+	if e.opts.EnvSecret != "" {
+		container["envFrom"] = []map[string]interface{}{{"secretRef": map[string]string{"name": e.opts.EnvSecret}}}
+	}
+
+	podSpec := map[string]interface{}{
+		"restartPolicy": "Never",
+		"containers":    []interface{}{container},
+	}
+	if e.opts.ServiceAccount != "" {
+		podSpec["serviceAccountName"] = e.opts.ServiceAccount
+	}
+
+	labels := map[string]string{
+		"app.kubernetes.io/managed-by": "tako",
+		"tako.dev/run-id":              runID,
+	}
+	if e.parentRunID != "" {
+		labels["tako.dev/parent-run-id"] = e.parentRunID
+	}
+	if kubernetesLabelValueRegex.MatchString(correlationID) {
+		labels["tako.dev/correlation-id"] = correlationID
+	}
+
+	job := map[string]interface{}{
+		"apiVersion": "batch/v1",
+		"kind":       "Job",
+		"metadata": map[string]interface{}{
+			"name":      jobName,
+			"namespace": e.opts.Namespace,
+			"labels":    labels,
+		},
+		"spec": map[string]interface{}{
+			// Retries are the fan-out's business: a failed pod fails the Job
+			"backoffLimit":            0,
+			"activeDeadlineSeconds":   int64(math.Ceil(spec.timeout.Seconds())),
+			"ttlSecondsAfterFinished": 3600,
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{"labels": labels},
+				"spec":     podSpec,
+			},
+		},
+	}
+	return json.Marshal(job)
+}
+
+// kubernetesJobStatus is the part of a Job's status tako reads.
+type kubernetesJobStatus struct {
+	Status struct {
+		Active     int `json:"active"`
+		Succeeded  int `json:"succeeded"`
+		Failed     int `json:"failed"`
+		Conditions []struct {
+			Type   string `json:"type"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		} `json:"conditions"`
+	} `json:"status"`
+}
+
+// childStatus maps the status of a Job to the status of its child workflow.
+func (j kubernetesJobStatus) childStatus() ChildWorkflowStatus {
+	for _, condition := range j.Status.Conditions {
+		if condition.Status != "True" {
+			continue
+		}
+		switch condition.Type {
+		case "Complete", "SuccessCriteriaMet":
+			return ChildStatusCompleted
+		case "Failed", "FailureTarget":
+			if condition.Reason == "DeadlineExceeded" {
+				return ChildStatusTimedOut
+			}
+			return ChildStatusFailed
+		}
+	}
+	switch {
+	case j.Status.Succeeded > 0:
+		return ChildStatusCompleted
+	case j.Status.Failed > 0:
+		return ChildStatusFailed
+	case j.Status.Active > 0:
+		return ChildStatusRunning
+	}
+	return ChildStatusPending
+}
+
+// awaitJob polls a Job until it finishes and returns the status of its child workflow.
+func (e *KubernetesJobExecutor) awaitJob(ctx context.Context, jobName string) (ChildWorkflowStatus, error) {
+	ticker := time.NewTicker(e.opts.PollInterval)
+	defer ticker.Stop()
+
+	status := ChildStatusPending
+	for {
+		output, err := e.kubectl(ctx, nil, "get", "job", jobName, "--output=json")
+		if err == nil {
+			var job kubernetesJobStatus
+			if err := json.Unmarshal(output, &job); err != nil {
+				return status, fmt.Errorf("failed to parse status of job %s: %w", jobName, err)
+			}
+			status = job.childStatus()
+			switch status {
+			case ChildStatusCompleted, ChildStatusFailed, ChildStatusTimedOut:
+				return status, nil
+			}
+		} else if ctx.Err() == nil {
+			// Transient API errors are retried; the Job's deadline bounds the wait
+			fmt.Fprintf(os.Stderr, "warning: failed to get status of job %s: %v\n", jobName, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return ChildStatusTimedOut, ctx.Err()
+			}
+			return ChildStatusCancelled, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// kubectl runs a kubectl command in the namespace and context of the backend and returns its
+// standard output.
+func (e *KubernetesJobExecutor) kubectl(ctx context.Context, stdin io.Reader, args ...string) ([]byte, error) {
+	var stdout bytes.Buffer
+	cmd := e.kubectlCommand(ctx, &stdout, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl %s failed: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
+
+// kubectlStream runs a kubectl command whose output is written as it comes.
+func (e *KubernetesJobExecutor) kubectlStream(ctx context.Context, out *lockedBuffer, args ...string) error {
+	cmd := e.kubectlCommand(ctx, out, args...)
+	cmd.Stderr = out
+	return cmd.Run()
+}
+
+func (e *KubernetesJobExecutor) kubectlCommand(ctx context.Context, stdout io.Writer, args ...string) *exec.Cmd {
+	fullArgs := []string{"--namespace", e.opts.Namespace}
+	if e.opts.Context != "" {
+		fullArgs = append(fullArgs, "--context", e.opts.Context)
+	}
+	fullArgs = append(fullArgs, args...)
+
+	cmd := exec.CommandContext(ctx, e.opts.Kubectl, fullArgs...)
+	cmd.Env = e.environment
+	cmd.Stdout = stdout
+	return cmd
+}
+
+// lockedBuffer is a buffer safe for concurrent writes and reads.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// _ ensures KubernetesJobExecutor implements the WorkflowRunner interface.
+var _ interfaces.WorkflowRunner = (*KubernetesJobExecutor)(nil)
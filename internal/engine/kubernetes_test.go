@@ -0,0 +1,191 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// fakeKubectl is a kubectl that records the manifest of created Jobs in $STATE and reports
+// them active on the first poll and with the status of $STATE/final.json afterwards.
+const fakeKubectl = `#!/bin/sh
+while [ $# -gt 0 ]; do
+  case "$1" in
+    --namespace|--context) shift 2 ;;
+    *) break ;;
+  esac
+done
+case "$1" in
+  create) cat > "$STATE/manifest.json" ;;
+  get)
+    n=$(cat "$STATE/polls" 2>/dev/null || echo 0)
+    n=$((n + 1))
+    echo $n > "$STATE/polls"
+    if [ $n -lt 2 ]; then echo '{"status":{"active":1}}'; else cat "$STATE/final.json"; fi ;;
+  logs) echo "hello from the pod" ;;
+  delete) touch "$STATE/deleted" ;;
+esac
+`
+
+func newKubernetesExecutorForTest(t *testing.T, cacheDir, finalStatus string) (*KubernetesJobExecutor, string) {
+	t.Helper()
+	state := t.TempDir()
+	kubectl := filepath.Join(t.TempDir(), "kubectl")
+	if err := os.WriteFile(kubectl, []byte(fakeKubectl), 0755); err != nil {
+		t.Fatalf("failed to write fake kubectl: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(state, "final.json"), []byte(finalStatus), 0644); err != nil {
+		t.Fatalf("failed to write job status: %v", err)
+	}
+
+	executor := NewKubernetesJobExecutor(cacheDir, "exec-parent", []string{"PATH=" + os.Getenv("PATH"), "STATE=" + state}, KubernetesOptions{
+		Namespace:    "ci",
+		Image:        "ghcr.io/example/tako:latest",
+		Kubectl:      kubectl,
+		EnvSecret:    "tako-tokens",
+		PollInterval: 10 * time.Millisecond,
+	})
+	return executor, state
+}
+
+func TestKubernetesJobExecutor_Completed(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoDir := filepath.Join(cacheDir, "repos", "org", "service", "main")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	takoYml := `version: 0.1.0
+workflows:
+  build:
+    image: golang:1.24
+    timeout: 10m
+    resources:
+      cpu_limit: "500m"
+    steps:
+      - id: test
+        run: go test ./...
+        resources:
+          mem_limit: 1GiB
+      - id: vet
+        run: go vet ./...
+        resources:
+          mem_limit: 256MB
+`
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+
+	executor, state := newKubernetesExecutorForTest(t, cacheDir, `{"status":{"succeeded":1,"conditions":[{"type":"Complete","status":"True"}]}}`)
+	result, err := executor.ExecuteWorkflow(context.Background(), "org/service", "build", map[string]string{"version": "1.2.0"})
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("expected success, got %v", result.Error)
+	}
+	step := result.Steps[0]
+	if !strings.Contains(step.Output, "hello from the pod") {
+		t.Errorf("expected the pod logs in the output, got %q", step.Output)
+	}
+	if step.Outputs["status"] != string(ChildStatusCompleted) || step.Outputs["job"] != "tako-"+result.RunID {
+		t.Errorf("unexpected outputs: %v", step.Outputs)
+	}
+
+	data, err := os.ReadFile(filepath.Join(state, "manifest.json"))
+	if err != nil {
+		t.Fatalf("failed to read manifest: %v", err)
+	}
+	var job struct {
+		Metadata struct {
+			Namespace string `json:"namespace"`
+		} `json:"metadata"`
+		Spec struct {
+			ActiveDeadlineSeconds int `json:"activeDeadlineSeconds"`
+			Template              struct {
+				Spec struct {
+					Containers []struct {
+						Image     string   `json:"image"`
+						Args      []string `json:"args"`
+						Resources struct {
+							Limits map[string]string `json:"limits"`
+						} `json:"resources"`
+						EnvFrom []struct {
+							SecretRef struct {
+								Name string `json:"name"`
+							} `json:"secretRef"`
+						} `json:"envFrom"`
+					} `json:"containers"`
+				} `json:"spec"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &job); err != nil {
+		t.Fatalf("failed to parse manifest: %v", err)
+	}
+	container := job.Spec.Template.Spec.Containers[0]
+	if job.Metadata.Namespace != "ci" || job.Spec.ActiveDeadlineSeconds != 600 {
+		t.Errorf("unexpected namespace %q or deadline %d", job.Metadata.Namespace, job.Spec.ActiveDeadlineSeconds)
+	}
+	if container.Image != "golang:1.24" {
+		t.Errorf("expected the workflow's image, got %s", container.Image)
+	}
+	if got := strings.Join(container.Args, " "); got != "exec build --repo org/service --inputs.version=1.2.0" {
+		t.Errorf("unexpected args: %s", got)
+	}
+	if container.Resources.Limits["cpu"] != "500m" || container.Resources.Limits["memory"] != "1024Mi" {
+		t.Errorf("expected the workflow's CPU and the largest step memory, got %v", container.Resources.Limits)
+	}
+	if len(container.EnvFrom) != 1 || container.EnvFrom[0].SecretRef.Name != "tako-tokens" {
+		t.Errorf("expected the environment from the secret, got %v", container.EnvFrom)
+	}
+}
+
+func TestKubernetesJobExecutor_DeadlineExceeded(t *testing.T) {
+	executor, _ := newKubernetesExecutorForTest(t, t.TempDir(), `{"status":{"failed":1,"conditions":[{"type":"Failed","status":"True","reason":"DeadlineExceeded"}]}}`)
+
+	result, err := executor.ExecuteWorkflow(context.Background(), "org/uncached", "build", nil)
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if result.Success {
+		t.Fatalf("expected the job to fail")
+	}
+	if result.Steps[0].ErrorType != interfaces.StepErrorWorkflowTimeout || !resultTimedOut(result) {
+		t.Errorf("expected a timeout, got error type %q", result.Steps[0].ErrorType)
+	}
+}
+
+func TestKubernetesJobStatus_ChildStatus(t *testing.T) {
+	tests := []struct {
+		json string
+		want ChildWorkflowStatus
+	}{
+		{json: `{"status":{}}`, want: ChildStatusPending},
+		{json: `{"status":{"active":1}}`, want: ChildStatusRunning},
+		{json: `{"status":{"succeeded":1}}`, want: ChildStatusCompleted},
+		{json: `{"status":{"failed":1,"conditions":[{"type":"Failed","status":"True","reason":"BackoffLimitExceeded"}]}}`, want: ChildStatusFailed},
+		{json: `{"status":{"conditions":[{"type":"Failed","status":"True","reason":"DeadlineExceeded"}]}}`, want: ChildStatusTimedOut},
+	}
+	for _, tt := range tests {
+		var job kubernetesJobStatus
+		if err := json.Unmarshal([]byte(tt.json), &job); err != nil {
+			t.Fatalf("failed to parse %s: %v", tt.json, err)
+		}
+		if got := job.childStatus(); got != tt.want {
+			t.Errorf("childStatus(%s) = %s, want %s", tt.json, got, tt.want)
+		}
+	}
+}
+
+func TestKubernetesJobExecutor_NoImage(t *testing.T) {
+	executor := NewKubernetesJobExecutor(t.TempDir(), "", nil, KubernetesOptions{})
+	if _, err := executor.ExecuteWorkflow(context.Background(), "org/service", "build", nil); err == nil || !strings.Contains(err.Error(), "no image") {
+		t.Errorf("expected a missing image error, got %v", err)
+	}
+}
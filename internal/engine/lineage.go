@@ -0,0 +1,93 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// DefaultMaxFanOutDepth is how many levels of fan-out children an execution tree can have:
+// the children of the root run are at depth 1, theirs at depth 2, and so on.
+const DefaultMaxFanOutDepth = 5
+
+// LineageEnv is the environment variable carrying the lineage of a run to the processes it
+// starts, as comma-separated repository:workflow entries.
+const LineageEnv = "TAKO_LINEAGE"
+
+// contextKeyLineage carries the lineage of the child workflow a backend runs.
+const contextKeyLineage contextKey = "lineage"
+
+var (
+	// ErrFanOutCycle is returned when a fan-out would trigger a workflow of its own lineage.
+	ErrFanOutCycle = errors.New("event cycle detected")
+
+	// ErrFanOutDepthExceeded is returned when a fan-out would trigger children deeper than
+	// the maximum fan-out depth.
+	ErrFanOutDepthExceeded = errors.New("maximum fan-out depth exceeded")
+)
+
+// lineageNode identifies a workflow of a repository in a lineage, ignoring the ref the
+// repository is pinned to.
+func lineageNode(repository, workflow string) string {
+	repository, _, _ = strings.Cut(repository, ":")
+	return repository + ":" + workflow
+}
+
+// parseLineage parses the lineage of the LineageEnv environment variable.
+func parseLineage(value string) []string {
+	var lineage []string
+	for _, node := range strings.Split(value, ",") {
+		if node = strings.TrimSpace(node); node != "" {
+			lineage = append(lineage, node)
+		}
+	}
+	return lineage
+}
+
+// withLineage returns a context carrying the lineage of the child workflow run with it.
+func withLineage(ctx context.Context, lineage []string) context.Context {
+	return context.WithValue(ctx, contextKeyLineage, lineage)
+}
+
+// lineageFromContext returns the lineage carried by a context, and whether it carries one.
+func lineageFromContext(ctx context.Context) ([]string, bool) {
+	lineage, ok := ctx.Value(contextKeyLineage).([]string)
+	return lineage, ok
+}
+
+// checkLineage fails when triggering the workflow of a subscriber would close an event cycle,
+// a workflow triggering itself through the events of its descendants, or grow the execution
+// tree past the maximum fan-out depth.
+func (fe *FanOutExecutor) checkLineage(subscribers []SubscriptionMatch) error {
+	for _, subscriber := range subscribers {
+		node := lineageNode(subscriber.Repository, subscriber.Subscription.Workflow)
+		if i := slices.Index(fe.lineage, node); i >= 0 {
+			chain := append(slices.Clone(fe.lineage[i:]), node)
+			return fmt.Errorf("%w: %s", ErrFanOutCycle, strings.Join(chain, " -> "))
+		}
+	}
+
+	maxDepth := fe.maxDepth
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxFanOutDepth
+	}
+	// The lineage starts with the root run, at depth 0, so the children run at its length
+	depth := max(len(fe.lineage), 1)
+	if len(subscribers) > 0 && depth > maxDepth {
+		subscriber := subscribers[0]
+		chain := append(slices.Clone(fe.lineage), lineageNode(subscriber.Repository, subscriber.Subscription.Workflow))
+		return fmt.Errorf("%w: %s would run at depth %d, past the limit of %d", ErrFanOutDepthExceeded,
+			strings.Join(chain, " -> "), depth, maxDepth)
+	}
+	return nil
+}
+
+// SetLineage sets the lineage of the run whose fan-outs the executor performs, the
+// repository:workflow of the runs from the root of its execution tree to it, and the maximum
+// fan-out depth of the tree; DefaultMaxFanOutDepth when zero.
+func (fe *FanOutExecutor) SetLineage(lineage []string, maxDepth int) {
+	fe.lineage = lineage
+	fe.maxDepth = maxDepth
+}
@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// lineageWorkflowRunner records the lineage each child workflow is run with.
+type lineageWorkflowRunner struct {
+	mu       sync.Mutex
+	lineages map[string][]string
+}
+
+func (r *lineageWorkflowRunner) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	lineage, _ := lineageFromContext(ctx)
+	r.mu.Lock()
+	r.lineages[repoPath] = lineage
+	r.mu.Unlock()
+	return &interfaces.ExecutionResult{Success: true, StartTime: time.Now(), EndTime: time.Now()}, nil
+}
+
+func TestFanOutExecutor_CheckLineage(t *testing.T) {
+	subscriptions := rolloutSubscriptions(2)
+	tests := []struct {
+		name     string
+		lineage  []string
+		maxDepth int
+		wantErr  error
+		message  string
+	}{
+		{name: "root", lineage: nil},
+		{name: "within depth", lineage: []string{"org/a:build", "org/b:build"}, maxDepth: 3},
+		{
+			name:    "cycle",
+			lineage: []string{"org/a:build", "test-org/repo-2:update-2", "org/b:build"},
+			wantErr: ErrFanOutCycle,
+			message: "test-org/repo-2:update-2 -> org/b:build -> test-org/repo-2:update-2",
+		},
+		{
+			name:     "too deep",
+			lineage:  []string{"org/a:build", "org/b:build", "org/c:build"},
+			maxDepth: 2,
+			wantErr:  ErrFanOutDepthExceeded,
+			message:  "depth 3, past the limit of 2",
+		},
+		{
+			name:    "default depth",
+			lineage: []string{"org/a:0", "org/a:1", "org/a:2", "org/a:3", "org/a:4", "org/a:5"},
+			wantErr: ErrFanOutDepthExceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := &FanOutExecutor{}
+			executor.SetLineage(tt.lineage, tt.maxDepth)
+			err := executor.checkLineage(subscriptions)
+			if !errors.Is(err, tt.wantErr) || (err == nil) != (tt.wantErr == nil) {
+				t.Fatalf("checkLineage() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil && !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("expected the diagnostic to contain %q, got %q", tt.message, err.Error())
+			}
+		})
+	}
+}
+
+func TestFanOutExecutor_PropagatesLineage(t *testing.T) {
+	runner := &lineageWorkflowRunner{lineages: map[string][]string{}}
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "library_built",
+		"wait_for_children": true,
+	}}
+
+	executor.SetLineage([]string{"org/a:build"}, 0)
+	if _, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2)); err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	want := []string{"org/a:build", "test-org/repo-1:update-1"}
+	if got := runner.lineages["test-org/repo-1"]; !slices.Equal(got, want) {
+		t.Errorf("expected the child run with lineage %v, got %v", want, got)
+	}
+
+	// A child triggering its ancestor fails the fan-out without running it
+	runner.lineages = map[string][]string{}
+	executor.SetLineage([]string{"test-org/repo-1:update-1", "org/a:build"}, 0)
+	result, err := executor.ExecuteWithSubscriptions(step, "source-org/library", rolloutSubscriptions(2))
+	if !errors.Is(err, ErrFanOutCycle) {
+		t.Fatalf("expected an event cycle error, got %v", err)
+	}
+	if result.TriggeredCount != 0 || len(runner.lineages) != 0 {
+		t.Errorf("expected no child triggered, got %d", result.TriggeredCount)
+	}
+}
+
+func TestNewRunner_InheritsLineage(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{LineageEnv + "=org/a:build,org/b:update"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	want := []string{"org/a:build", "org/b:update"}
+	if !slices.Equal(runner.lineage, want) || !slices.Equal(runner.state.Lineage, want) {
+		t.Errorf("expected the lineage of the environment, got %v", runner.lineage)
+	}
+	if !slices.Contains(runner.runLinkEnvironment(), LineageEnv+"=org/a:build,org/b:update") {
+		t.Errorf("expected steps to pass the lineage on, got %v", runner.runLinkEnvironment())
+	}
+}
+
+// writeRootCycle writes a root workflow of test-org/lib whose child, in test-org/app, triggers
+// it again, returning a runner of the root and the directory of its repository.
+func writeRootCycle(t *testing.T) (*Runner, string) {
+	t.Helper()
+	release := `  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+`
+	runner, repoDir := newCallWorkflowRunner(t, release)
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", "version: 0.1.0\nworkflows:\n"+release+`subscriptions:
+  - artifact: test-org/app:default
+    events: [app_updated]
+    workflow: release
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: app_updated
+          wait_for_children: true
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+`)
+	runner.repository = "test-org/lib"
+	return runner, repoDir
+}
+
+func TestRunner_ChildCannotTriggerTheRootWorkflow(t *testing.T) {
+	runner, repoDir := writeRootCycle(t)
+	result, err := runner.ExecuteWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+
+	want := []string{"test-org/lib:release"}
+	if !slices.Equal(runner.lineage, want) || !slices.Equal(runner.state.Lineage, want) {
+		t.Errorf("expected the lineage to start with the root workflow, got %v", runner.lineage)
+	}
+	// The fan-out of the child fails before the root workflow runs again
+	publish := result.Steps[len(result.Steps)-1]
+	if publish.Error == nil || !strings.Contains(publish.Error.Error(), "test-org/lib:release -> test-org/app:update -> test-org/lib:release") {
+		t.Errorf("expected the event of the child not to trigger the root workflow, got %v", publish.Error)
+	}
+
+	tree, err := runner.SimulateWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+	app := tree.FanOuts[0].Children[0]
+	if len(app.FanOuts) != 1 || !strings.Contains(app.FanOuts[0].Error, "test-org/lib:release -> test-org/app:update -> test-org/lib:release") {
+		t.Errorf("expected the fan-out of the child to report the cycle through the root, got %+v", app.FanOuts)
+	}
+}
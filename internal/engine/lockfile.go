@@ -0,0 +1,212 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// LockfileName is the file the lockfile of a run is written to, in the workspace of the run.
+const LockfileName = "tako.lock"
+
+// LockfileVersion is the version of the lockfile format.
+const LockfileVersion = 1
+
+// Lockfile records the exact commit every repository of an execution tree ran against, so that
+// the run can be reproduced against the same commits.
+type Lockfile struct {
+	Version      int                `json:"version"`
+	RunID        string             `json:"run_id"`
+	Workflow     string             `json:"workflow"`
+	CreatedAt    time.Time          `json:"created_at"`
+	Repositories []LockedRepository `json:"repositories"`
+}
+
+// LockedRepository is the commit a repository of an execution tree ran against.
+type LockedRepository struct {
+	Repository string `json:"repository"`
+	// Ref is the branch or tag the commit was resolved from; HEAD for a detached checkout
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	// Root is whether the repository ran the workflow that started the execution tree
+	Root bool `json:"root,omitempty"`
+}
+
+// LoadLockfile reads and validates a lockfile.
+func LoadLockfile(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %v", err)
+	}
+	var lock Lockfile
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile %s: %v", path, err)
+	}
+	if lock.Version != LockfileVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d in %s", lock.Version, path)
+	}
+
+	seen := make(map[string]bool)
+	roots := 0
+	for _, locked := range lock.Repositories {
+		if locked.Repository == "" {
+			return nil, fmt.Errorf("lockfile %s has a repository without a name", path)
+		}
+		if locked.Ref == "" {
+			return nil, fmt.Errorf("repository %s in lockfile %s has no ref", locked.Repository, path)
+		}
+		if _, err := config.ParsePinnedRef(locked.Ref + "@" + locked.Commit); err != nil {
+			return nil, fmt.Errorf("repository %s in lockfile %s: %v", locked.Repository, path, err)
+		}
+		key := locked.Repository + ":" + locked.Ref
+		if seen[key] {
+			return nil, fmt.Errorf("repository %s is locked more than once in lockfile %s", key, path)
+		}
+		seen[key] = true
+		if locked.Root {
+			roots++
+		}
+	}
+	if roots > 1 {
+		return nil, fmt.Errorf("lockfile %s has %d root repositories", path, roots)
+	}
+	return &lock, nil
+}
+
+// WriteLockfile writes a lockfile, replacing the file atomically.
+func WriteLockfile(lock *Lockfile, path string) error {
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode lockfile: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create lockfile directory: %v", err)
+	}
+	tempFile := path + ".tmp"
+	if err := os.WriteFile(tempFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %v", err)
+	}
+	if err := os.Rename(tempFile, path); err != nil {
+		os.Remove(tempFile)
+		return fmt.Errorf("failed to write lockfile: %v", err)
+	}
+	return nil
+}
+
+// Root returns the repository of the lockfile that started the execution tree.
+func (l *Lockfile) Root() (LockedRepository, bool) {
+	for _, locked := range l.Repositories {
+		if locked.Root {
+			return locked, true
+		}
+	}
+	return LockedRepository{}, false
+}
+
+// RevisionLock collects the commits the repositories of an execution tree run against as they
+// are resolved, and pins the repositories to the commits of a replayed lockfile. It is shared by
+// the runners of the tree.
+type RevisionLock struct {
+	replay   *Lockfile // Nil when no lockfile is replayed
+	resolved map[string]LockedRepository
+	mu       sync.Mutex
+}
+
+// NewRevisionLock creates a revision lock pinning the repositories to the commits of a replayed
+// lockfile; nil to run the revisions of the subscriptions.
+func NewRevisionLock(replay *Lockfile) *RevisionLock {
+	return &RevisionLock{replay: replay, resolved: make(map[string]LockedRepository)}
+}
+
+// Replay returns the lockfile the revisions are pinned to; nil for none.
+func (l *RevisionLock) Replay() *Lockfile {
+	return l.replay
+}
+
+// Pinned returns the commit a repository is pinned to by the replayed lockfile, for a branch or
+// tag (main when empty). A repository locked for a single ref is pinned to it whatever the ref,
+// since the subscriptions of the tree may have changed since the lockfile was written.
+func (l *RevisionLock) Pinned(repository, ref string) (LockedRepository, bool) {
+	if l == nil || l.replay == nil {
+		return LockedRepository{}, false
+	}
+	if ref == "" {
+		ref = "main"
+	}
+	var matches []LockedRepository
+	for _, locked := range l.replay.Repositories {
+		if locked.Repository != repository {
+			continue
+		}
+		if locked.Ref == ref {
+			return locked, true
+		}
+		matches = append(matches, locked)
+	}
+	if len(matches) == 1 {
+		return matches[0], true
+	}
+	return LockedRepository{}, false
+}
+
+// Record records the commit a repository runs against. The first commit recorded for a ref of
+// a repository is kept.
+func (l *RevisionLock) Record(locked LockedRepository) {
+	if l == nil || locked.Commit == "" {
+		return
+	}
+	if locked.Ref == "" {
+		locked.Ref = "main"
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key := locked.Repository + ":" + locked.Ref
+	if previous, ok := l.resolved[key]; ok {
+		if previous.Commit != locked.Commit {
+			slog.Warn("repository ran against more than one commit", "repository", key, "locked", previous.Commit, "commit", locked.Commit)
+		}
+		return
+	}
+	l.resolved[key] = locked
+}
+
+// reset forgets the recorded commits, when a new execution tree starts.
+func (l *RevisionLock) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.resolved = make(map[string]LockedRepository)
+}
+
+// Lockfile returns the lockfile of the recorded commits, sorted by repository and ref.
+func (l *RevisionLock) Lockfile(runID, workflow string, createdAt time.Time) *Lockfile {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock := &Lockfile{
+		Version:      LockfileVersion,
+		RunID:        runID,
+		Workflow:     workflow,
+		CreatedAt:    createdAt,
+		Repositories: make([]LockedRepository, 0, len(l.resolved)),
+	}
+	for _, locked := range l.resolved {
+		lock.Repositories = append(lock.Repositories, locked)
+	}
+	sort.Slice(lock.Repositories, func(i, j int) bool {
+		a, b := lock.Repositories[i], lock.Repositories[j]
+		if a.Repository != b.Repository {
+			return a.Repository < b.Repository
+		}
+		return a.Ref < b.Ref
+	})
+	return lock
+}
@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadLockfile(t *testing.T) {
+	dir := t.TempDir()
+	commit := strings.Repeat("a", 40)
+	lock := &Lockfile{
+		Version:   LockfileVersion,
+		RunID:     "exec-1",
+		Workflow:  "release",
+		CreatedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Repositories: []LockedRepository{
+			{Repository: "org/app", Ref: "main", Commit: commit},
+			{Repository: "org/lib", Ref: "v1", Commit: commit, Root: true},
+		},
+	}
+	path := filepath.Join(dir, LockfileName)
+	if err := WriteLockfile(lock, path); err != nil {
+		t.Fatalf("WriteLockfile() error = %v", err)
+	}
+	loaded, err := LoadLockfile(path)
+	if err != nil {
+		t.Fatalf("LoadLockfile() error = %v", err)
+	}
+	if loaded.RunID != "exec-1" || len(loaded.Repositories) != 2 {
+		t.Errorf("unexpected lockfile: %+v", loaded)
+	}
+	if root, ok := loaded.Root(); !ok || root.Repository != "org/lib" {
+		t.Errorf("expected org/lib to be the root, got %+v", root)
+	}
+
+	testCases := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "version", content: `{"version": 2}`, wantErr: "unsupported lockfile version 2"},
+		{name: "no ref", content: `{"version": 1, "repositories": [{"repository": "org/app", "commit": "` + commit + `"}]}`, wantErr: "has no ref"},
+		{name: "invalid commit", content: `{"version": 1, "repositories": [{"repository": "org/app", "ref": "main", "commit": "main"}]}`,
+			wantErr: "must be 7 to 40 lowercase hexadecimal characters"},
+		{name: "duplicate", content: `{"version": 1, "repositories": [{"repository": "org/app", "ref": "main", "commit": "` + commit + `"}, {"repository": "org/app", "ref": "main", "commit": "` + commit + `"}]}`,
+			wantErr: "locked more than once"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".lock")
+			if err := os.WriteFile(path, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("failed to write lockfile: %v", err)
+			}
+			if _, err := LoadLockfile(path); err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestRevisionLock(t *testing.T) {
+	revisions := NewRevisionLock(&Lockfile{Version: LockfileVersion, Repositories: []LockedRepository{
+		{Repository: "org/app", Ref: "main", Commit: "1111111"},
+		{Repository: "org/app", Ref: "release", Commit: "2222222"},
+		{Repository: "org/lib", Ref: "v1", Commit: "3333333"},
+	}})
+
+	for _, tc := range []struct {
+		repository, ref, want string
+	}{
+		{"org/app", "", "1111111"},
+		{"org/app", "release", "2222222"},
+		{"org/app", "develop", ""}, // Locked for more than one other ref
+		{"org/lib", "v2", "3333333"},
+		{"org/other", "main", ""},
+	} {
+		locked, ok := revisions.Pinned(tc.repository, tc.ref)
+		if ok != (tc.want != "") || locked.Commit != tc.want {
+			t.Errorf("Pinned(%s, %s) = %+v, %v; want commit %q", tc.repository, tc.ref, locked, ok, tc.want)
+		}
+	}
+
+	// The first commit of a ref is kept, and the recorded commits are sorted
+	revisions.Record(LockedRepository{Repository: "org/lib", Ref: "v1", Commit: "3333333"})
+	revisions.Record(LockedRepository{Repository: "org/app", Commit: "1111111"})
+	revisions.Record(LockedRepository{Repository: "org/app", Commit: "4444444"})
+	revisions.Record(LockedRepository{Repository: "org/unresolved"})
+	lock := revisions.Lockfile("exec-1", "release", time.Now())
+	if len(lock.Repositories) != 2 || lock.Repositories[0].Repository != "org/app" || lock.Repositories[0].Ref != "main" ||
+		lock.Repositories[0].Commit != "1111111" || lock.Repositories[1].Repository != "org/lib" {
+		t.Errorf("unexpected recorded revisions: %+v", lock.Repositories)
+	}
+}
+
+// writeLockedRepository writes a repository of the cache as a Git clone whose version.txt holds
+// the version, and returns its commit.
+func writeLockedRepository(t *testing.T, runner *Runner, repository, takoYml, version string) string {
+	t.Helper()
+	repoDir := filepath.Join(runner.cacheDir, "repos", repository, "main")
+	if _, err := os.Stat(filepath.Join(repoDir, ".git")); err != nil {
+		writeCachedRepo(t, runner.cacheDir, repository, takoYml)
+		gitForTest(t, repoDir, "init", "-b", "main")
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "version.txt"), []byte(version+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write version.txt: %v", err)
+	}
+	gitForTest(t, repoDir, "add", ".")
+	gitForTest(t, repoDir, "commit", "-m", version)
+	return gitForTest(t, repoDir, "rev-parse", "HEAD")
+}
+
+func TestRunnerLockfileReplay(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	newRunner := func(revisions *RevisionLock) *Runner {
+		runner, err := NewRunner(RunnerOptions{
+			WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+			CacheDir:      cacheDir,
+			Git:           GitOptions{LocalOnly: true},
+			Revisions:     revisions,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create runner: %v", err)
+		}
+		t.Cleanup(func() { runner.Close() })
+		return runner
+	}
+	runner := newRunner(nil)
+
+	repositories := map[string]string{
+		"test-org/lib": `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+`,
+		"test-org/app": `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - id: version
+        run: cat version.txt
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: app_updated
+          wait_for_children: true
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+`,
+		"test-org/deploy": `version: 0.1.0
+workflows:
+  deploy:
+    steps:
+      - id: version
+        run: cat version.txt
+subscriptions:
+  - artifact: test-org/app:default
+    events: [app_updated]
+    workflow: deploy
+`,
+	}
+	commits := make(map[string]string)
+	for repository, takoYml := range repositories {
+		commits[repository] = writeLockedRepository(t, runner, repository, takoYml, "v1")
+	}
+
+	// The lockfile records the commits of the whole execution tree
+	if _, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib"); err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+	if want := filepath.Join(tempDir, "workspace", runner.runID, LockfileName); runner.LockfilePath() != want {
+		t.Fatalf("Expected the lockfile at %s, got %q", want, runner.LockfilePath())
+	}
+	lock, err := LoadLockfile(runner.LockfilePath())
+	if err != nil {
+		t.Fatalf("LoadLockfile() error = %v", err)
+	}
+	if len(lock.Repositories) != 3 {
+		t.Fatalf("Expected 3 locked repositories, got %+v", lock.Repositories)
+	}
+	for _, locked := range lock.Repositories {
+		if locked.Commit != commits[locked.Repository] || locked.Ref != "main" || locked.Root != (locked.Repository == "test-org/lib") {
+			t.Errorf("Unexpected locked repository %+v, want commit %s", locked, commits[locked.Repository])
+		}
+	}
+
+	// Replaying the lockfile runs the locked commits rather than the new ones
+	for repository, takoYml := range repositories {
+		writeLockedRepository(t, runner, repository, takoYml, "v2")
+	}
+	replay := newRunner(NewRevisionLock(lock))
+	result, err := replay.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if err != nil {
+		t.Fatalf("Replayed execution failed: %v", err)
+	}
+	if len(result.Children) != 1 || result.Children[0].Result == nil {
+		t.Fatalf("Expected the execution of the child, got %+v", result.Children)
+	}
+	app := result.Children[0].Result
+	if output := strings.TrimSpace(app.Steps[0].Output); output != "v1" {
+		t.Errorf("Expected the child to run the locked commit, got version %q", output)
+	}
+	if len(app.Children) != 1 || app.Children[0].Result == nil || strings.TrimSpace(app.Children[0].Result.Steps[0].Output) != "v1" {
+		t.Errorf("Expected the grandchild to run the locked commit, got %+v", app.Children)
+	}
+	replayed, err := LoadLockfile(replay.LockfilePath())
+	if err != nil {
+		t.Fatalf("LoadLockfile() error = %v", err)
+	}
+	for i, locked := range replayed.Repositories {
+		if locked != lock.Repositories[i] {
+			t.Errorf("Expected the replay to lock %+v, got %+v", lock.Repositories[i], locked)
+		}
+	}
+}
+
+func TestRunnerLockfileLocalRoot(t *testing.T) {
+	tempDir := t.TempDir()
+	repoDir := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte("version: 0.1.0\nworkflows:\n  build:\n    steps:\n      - run: echo built\n"), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	gitForTest(t, repoDir, "init", "-b", "main")
+	gitForTest(t, repoDir, "add", ".")
+	gitForTest(t, repoDir, "commit", "-m", "initial commit")
+	commit := gitForTest(t, repoDir, "rev-parse", "HEAD")
+
+	replay := &Lockfile{Version: LockfileVersion, Repositories: []LockedRepository{
+		{Repository: "org/repo", Ref: "main", Commit: strings.Repeat("0", 40), Root: true},
+	}}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Revisions:     NewRevisionLock(replay),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	// A local repository is run as it is checked out, so it must be at the locked commit
+	_, err = runner.ExecuteWorkflow(context.Background(), "build", nil, repoDir)
+	if err == nil || !strings.Contains(err.Error(), "check out that commit first") {
+		t.Fatalf("Expected the commit mismatch to be rejected, got %v", err)
+	}
+
+	replay.Repositories[0].Commit = commit[:12]
+	if _, err := runner.ExecuteWorkflow(context.Background(), "build", nil, repoDir); err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	lock, err := LoadLockfile(runner.LockfilePath())
+	if err != nil {
+		t.Fatalf("LoadLockfile() error = %v", err)
+	}
+	if len(lock.Repositories) != 1 || lock.Repositories[0].Commit != commit || lock.Repositories[0].Ref != "main" || !lock.Repositories[0].Root {
+		t.Errorf("Expected the HEAD of the local repository to be locked, got %+v", lock.Repositories)
+	}
+}
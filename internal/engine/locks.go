@@ -5,13 +5,17 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -23,17 +27,39 @@ const (
 	LockTypeWrite LockType = "write"
 )
 
+// ErrDeadlock is returned when waiting for a lock would complete a wait-for cycle.
+var ErrDeadlock = errors.New("deadlock detected")
+
 // LockInfo contains information about a held lock.
 type LockInfo struct {
-	RunID      string    `json:"run_id"`
-	Repository string    `json:"repository"`
-	Type       LockType  `json:"type"`
-	AcquiredAt time.Time `json:"acquired_at"`
-	ExpiresAt  time.Time `json:"expires_at"`
-	ProcessID  int       `json:"process_id"`
+	RunID       string    `json:"run_id"`
+	ParentRunID string    `json:"parent_run_id,omitempty"`
+	Repository  string    `json:"repository"`
+	Type        LockType  `json:"type"`
+	AcquiredAt  time.Time `json:"acquired_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	ProcessID   int       `json:"process_id"`
+
+	// holds counts reentrant acquisitions by the same run
+	holds int
+}
+
+// lockWait records a run that is blocked waiting for a repository lock.
+// Wait records are persisted next to the lock files so that wait-for cycles can be
+// detected across lock managers and processes sharing the same lock directory.
+type lockWait struct {
+	RunID       string    `json:"run_id"`
+	ParentRunID string    `json:"parent_run_id,omitempty"`
+	Repository  string    `json:"repository"`
+	Type        LockType  `json:"type"`
+	Since       time.Time `json:"since"`
+	ProcessID   int       `json:"process_id"`
 }
 
-// LockManager provides fine-grained repository locking with deadlock detection.
+// LockManager provides fine-grained repository locking with deadlock detection. Locks are not
+// acquired in a canonical order: the children of a fan-out each lock their repository when they
+// start, so a run may hold some repositories while it waits for another. Wait-for cycles between
+// runs are therefore not prevented, but detected when they form, by WaitForLock.
 type LockManager struct {
 	lockDir string
 	locks   map[string]*LockInfo
@@ -42,6 +68,8 @@ type LockManager struct {
 	// Lock timeout configuration
 	defaultTimeout time.Duration
 	maxTimeout     time.Duration
+
+	clock Clock // Clock the locks expire on; the system clock when nil
 }
 
 // NewLockManager creates a new lock manager.
@@ -58,13 +86,23 @@ func NewLockManager(lockDir string) (*LockManager, error) {
 	}
 
 	// Clean up any stale locks on startup
-	if err := lm.cleanupStaleLocks(); err != nil {
+	if _, err := lm.cleanupStaleLocks(); err != nil {
 		return nil, fmt.Errorf("failed to cleanup stale locks: %v", err)
 	}
 
 	return lm, nil
 }
 
+// SetClock sets the clock the locks are acquired and expire on.
+func (lm *LockManager) SetClock(clock Clock) {
+	lm.clock = clock
+}
+
+// now returns the time of the manager's clock.
+func (lm *LockManager) now() time.Time {
+	return clockOrSystem(lm.clock).Now()
+}
+
 // AcquireLock attempts to acquire a lock on a repository.
 func (lm *LockManager) AcquireLock(ctx context.Context, runID, repository string, lockType LockType) error {
 	return lm.AcquireLockWithTimeout(ctx, runID, repository, lockType, lm.defaultTimeout)
@@ -85,12 +123,13 @@ func (lm *LockManager) AcquireLockWithTimeout(ctx context.Context, runID, reposi
 	}
 
 	// Create lock info
+	now := lm.now()
 	lockInfo := &LockInfo{
 		RunID:      runID,
 		Repository: repository,
 		Type:       lockType,
-		AcquiredAt: time.Now(),
-		ExpiresAt:  time.Now().Add(timeout),
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(timeout),
 		ProcessID:  os.Getpid(),
 	}
 
@@ -131,6 +170,47 @@ func (lm *LockManager) AcquireLockWithTimeout(ctx context.Context, runID, reposi
 	return fmt.Errorf("failed to acquire %s lock on repository %s after %d retries", lockType, repository, maxRetries)
 }
 
+// WaitForLock blocks until a lock on the repository is acquired or the context is done.
+// Locks are reentrant for the same run ID, so parallel branches of one run share the lock.
+// The parentRunID links a child run to the run waiting for it, which lets cycles through
+// nested fan-outs be detected. When waiting would complete a wait-for cycle, the waiter
+// with the highest run ID in the cycle gives up with ErrDeadlock so the others can proceed.
+// Cycles are only detected: nothing orders the locks that runs wait for to prevent them.
+func (lm *LockManager) WaitForLock(ctx context.Context, runID, parentRunID, repository string, lockType LockType) error {
+	lockKey := lm.getLockKey(repository, lockType)
+
+	if err := lm.tryLock(runID, parentRunID, repository, lockType); err == nil {
+		return nil
+	}
+
+	// Record the wait so other lock managers can see it in the wait-for graph
+	if err := lm.recordWait(runID, parentRunID, repository, lockType); err != nil {
+		return err
+	}
+	defer lm.clearWait(runID, lockKey)
+
+	delay := 50 * time.Millisecond
+	for {
+		if cycle, victim := lm.findWaitCycle(runID); victim == runID {
+			return fmt.Errorf("%w: %s", ErrDeadlock, strings.Join(cycle, " -> "))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		if err := lm.tryLock(runID, parentRunID, repository, lockType); err == nil {
+			return nil
+		}
+
+		if delay < time.Second {
+			delay *= 2
+		}
+	}
+}
+
 // ReleaseLock releases a previously acquired lock.
 func (lm *LockManager) ReleaseLock(runID, repository string, lockType LockType) error {
 	lockKey := lm.getLockKey(repository, lockType)
@@ -149,6 +229,12 @@ func (lm *LockManager) ReleaseLock(runID, repository string, lockType LockType)
 		return fmt.Errorf("lock on repository %s is held by run %s, not %s", repository, lockInfo.RunID, runID)
 	}
 
+	// Reentrant acquisitions only drop a hold
+	if lockInfo.holds > 1 {
+		lockInfo.holds--
+		return nil
+	}
+
 	// Remove lock file
 	if err := os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
 		return fmt.Errorf("failed to remove lock file: %v", err)
@@ -219,12 +305,9 @@ func (lm *LockManager) DetectDeadlocks() ([]string, error) {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
-	// For now, implement a simple timeout-based deadlock detection
-	// In a more sophisticated implementation, this would build a wait-for graph
-	// and detect cycles
-
+	// Locks held past their expiry usually mean the holder is stuck
 	var deadlocks []string
-	now := time.Now()
+	now := lm.now()
 
 	for lockKey, lockInfo := range lm.locks {
 		if now.After(lockInfo.ExpiresAt) {
@@ -232,6 +315,27 @@ func (lm *LockManager) DetectDeadlocks() ([]string, error) {
 		}
 	}
 
+	// Report every distinct cycle in the wait-for graph
+	waits, err := lm.loadWaits()
+	if err != nil {
+		return deadlocks, err
+	}
+	reported := make(map[string]bool)
+	for _, wait := range waits {
+		cycle, _ := lm.findWaitCycle(wait.RunID)
+		if len(cycle) == 0 {
+			continue
+		}
+		members := append([]string(nil), cycle[:len(cycle)-1]...)
+		sort.Strings(members)
+		key := strings.Join(members, ",")
+		if reported[key] {
+			continue
+		}
+		reported[key] = true
+		deadlocks = append(deadlocks, fmt.Sprintf("wait cycle: %s", strings.Join(cycle, " -> ")))
+	}
+
 	return deadlocks, nil
 }
 
@@ -283,11 +387,56 @@ func (lm *LockManager) tryAcquireLock(lockFile string, lockInfo *LockInfo) error
 	return nil
 }
 
+// tryLock makes a single attempt to acquire a lock, treating locks already held by the
+// same run as reentrant.
+func (lm *LockManager) tryLock(runID, parentRunID, repository string, lockType LockType) error {
+	lockKey := lm.getLockKey(repository, lockType)
+	lockFile := filepath.Join(lm.lockDir, lockKey+".lock")
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+
+	if held, exists := lm.locks[lockKey]; exists && held.RunID == runID {
+		if held.holds < 1 {
+			held.holds = 1
+		}
+		held.holds++
+		return nil
+	}
+
+	if err := lm.conflictingLocks(repository, lockType); err != nil {
+		return err
+	}
+
+	now := lm.now()
+	lockInfo := &LockInfo{
+		RunID:       runID,
+		ParentRunID: parentRunID,
+		Repository:  repository,
+		Type:        lockType,
+		AcquiredAt:  now,
+		ExpiresAt:   now.Add(lm.defaultTimeout),
+		ProcessID:   os.Getpid(),
+		holds:       1,
+	}
+	if err := lm.tryAcquireLock(lockFile, lockInfo); err != nil {
+		return err
+	}
+
+	lm.locks[lockKey] = lockInfo
+	return nil
+}
+
 // checkConflictingLocks checks for conflicting locks before acquiring a new one.
 func (lm *LockManager) checkConflictingLocks(repository string, lockType LockType) error {
 	lm.mu.RLock()
 	defer lm.mu.RUnlock()
 
+	return lm.conflictingLocks(repository, lockType)
+}
+
+// conflictingLocks checks the in-memory locks for conflicts. The caller must hold lm.mu.
+func (lm *LockManager) conflictingLocks(repository string, lockType LockType) error {
 	if lockType == LockTypeWrite {
 		// Write locks conflict with all other locks
 		readKey := lm.getLockKey(repository, LockTypeRead)
@@ -325,7 +474,7 @@ func (lm *LockManager) checkStaleLock(lockFile string) error {
 	}
 
 	// Check if lock has expired
-	if time.Now().After(lockInfo.ExpiresAt) {
+	if lm.now().After(lockInfo.ExpiresAt) {
 		os.Remove(lockFile)
 		return nil
 	}
@@ -340,30 +489,217 @@ func (lm *LockManager) checkStaleLock(lockFile string) error {
 	return fmt.Errorf("lock is still valid")
 }
 
-// cleanupStaleLocks removes stale lock files on startup.
-func (lm *LockManager) cleanupStaleLocks() error {
+// cleanupStaleLocks removes stale lock files on startup, and returns the number of locks removed.
+func (lm *LockManager) cleanupStaleLocks() (int, error) {
 	entries, err := os.ReadDir(lm.lockDir)
 	if err != nil {
-		return fmt.Errorf("failed to read lock directory: %v", err)
+		return 0, fmt.Errorf("failed to read lock directory: %v", err)
 	}
 
+	removed := 0
 	for _, entry := range entries {
 		if !entry.IsDir() && filepath.Ext(entry.Name()) == ".lock" {
 			lockFile := filepath.Join(lm.lockDir, entry.Name())
-			lm.checkStaleLock(lockFile) // This will remove stale locks
+			if lm.checkStaleLock(lockFile) == nil { // This will remove stale locks
+				removed++
+			}
 		}
 	}
 
+	// Wait records left behind by dead processes would show up as phantom waiters
+	if _, err := lm.loadWaits(); err != nil {
+		return removed, err
+	}
+
+	return removed, nil
+}
+
+// waitDir returns the directory holding persisted wait records.
+func (lm *LockManager) waitDir() string {
+	return filepath.Join(lm.lockDir, "waits")
+}
+
+// waitFile returns the wait record path for a run waiting on a lock key.
+// The same run may wait on several repositories at once from parallel branches.
+func (lm *LockManager) waitFile(runID, lockKey string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(runID))
+	hash := hex.EncodeToString(hasher.Sum(nil))[:16]
+	return filepath.Join(lm.waitDir(), fmt.Sprintf("%s_%s.wait", hash, lockKey))
+}
+
+// recordWait persists a wait record for a run blocked on a repository lock.
+func (lm *LockManager) recordWait(runID, parentRunID, repository string, lockType LockType) error {
+	if err := os.MkdirAll(lm.waitDir(), 0755); err != nil {
+		return fmt.Errorf("failed to create wait directory: %v", err)
+	}
+
+	data, err := json.Marshal(&lockWait{
+		RunID:       runID,
+		ParentRunID: parentRunID,
+		Repository:  repository,
+		Type:        lockType,
+		Since:       lm.now(),
+		ProcessID:   os.Getpid(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal wait record: %v", err)
+	}
+
+	waitFile := lm.waitFile(runID, lm.getLockKey(repository, lockType))
+	if err := os.WriteFile(waitFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write wait record: %v", err)
+	}
+
 	return nil
 }
 
+// clearWait removes the wait record of a run once it stops waiting.
+func (lm *LockManager) clearWait(runID, lockKey string) {
+	os.Remove(lm.waitFile(runID, lockKey)) // Ignore errors, a missing record is harmless
+}
+
+// loadWaits reads all persisted wait records, discarding those of dead processes.
+func (lm *LockManager) loadWaits() ([]*lockWait, error) {
+	entries, err := os.ReadDir(lm.waitDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read wait directory: %v", err)
+	}
+
+	var waits []*lockWait
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".wait" {
+			continue
+		}
+
+		waitFile := filepath.Join(lm.waitDir(), entry.Name())
+		data, err := os.ReadFile(waitFile)
+		if err != nil {
+			continue // Removed concurrently
+		}
+
+		var wait lockWait
+		if err := json.Unmarshal(data, &wait); err != nil || !lm.isProcessAlive(wait.ProcessID) {
+			os.Remove(waitFile)
+			continue
+		}
+		waits = append(waits, &wait)
+	}
+
+	return waits, nil
+}
+
+// readLockFile returns the lock persisted under a lock key, or nil if it is not held.
+func (lm *LockManager) readLockFile(lockKey string) *LockInfo {
+	data, err := os.ReadFile(filepath.Join(lm.lockDir, lockKey+".lock"))
+	if err != nil {
+		return nil
+	}
+
+	var lockInfo LockInfo
+	if err := json.Unmarshal(data, &lockInfo); err != nil {
+		return nil
+	}
+	return &lockInfo
+}
+
+// buildWaitForGraph builds the wait-for graph from persisted lock and wait records.
+// A waiting run has an edge to every run holding a conflicting lock, and a parent run
+// has an edge to each child run it is blocked on. Also returns the set of waiting runs.
+func (lm *LockManager) buildWaitForGraph() (map[string][]string, map[string]bool) {
+	graph := make(map[string][]string)
+	waiters := make(map[string]bool)
+
+	addEdge := func(from, to string) {
+		if from == "" || to == "" || from == to {
+			return
+		}
+		for _, existing := range graph[from] {
+			if existing == to {
+				return
+			}
+		}
+		graph[from] = append(graph[from], to)
+	}
+
+	waits, _ := lm.loadWaits()
+	for _, wait := range waits {
+		waiters[wait.RunID] = true
+		addEdge(wait.ParentRunID, wait.RunID)
+
+		// Write locks conflict with everything, read locks only with writers
+		conflicting := []LockType{LockTypeWrite}
+		if wait.Type == LockTypeWrite {
+			conflicting = append(conflicting, LockTypeRead)
+		}
+		for _, lockType := range conflicting {
+			holder := lm.readLockFile(lm.getLockKey(wait.Repository, lockType))
+			if holder == nil {
+				continue
+			}
+			addEdge(wait.RunID, holder.RunID)
+			addEdge(holder.ParentRunID, holder.RunID)
+		}
+	}
+
+	return graph, waiters
+}
+
+// findWaitCycle looks for a wait-for cycle passing through the given run.
+// Returns the cycle (starting and ending at runID) and the waiter chosen to break it,
+// which is the waiting run with the highest run ID so that every member agrees on it.
+func (lm *LockManager) findWaitCycle(runID string) ([]string, string) {
+	graph, waiters := lm.buildWaitForGraph()
+
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(node string) bool
+	visit = func(node string) bool {
+		path = append(path, node)
+		for _, next := range graph[node] {
+			if next == runID {
+				path = append(path, next)
+				return true
+			}
+			if !visited[next] {
+				visited[next] = true
+				if visit(next) {
+					return true
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+
+	visited[runID] = true
+	if !visit(runID) {
+		return nil, ""
+	}
+
+	victim := ""
+	for _, member := range path {
+		if waiters[member] && member > victim {
+			victim = member
+		}
+	}
+	return path, victim
+}
+
+// lockNameReplacer replaces the characters that are not safe in the file names of locks.
+var lockNameReplacer = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "*", "_", "?", "_", "\"", "_", "<", "_", ">", "_", "|", "_")
+
 // getLockKey generates a unique key for a repository and lock type combination.
 func (lm *LockManager) getLockKey(repository string, lockType LockType) string {
 	// Create a unique key that prevents conflicts between repositories
 	// with the same base name but different paths/organizations
 
-	// Normalize the repository path by cleaning it
-	normalizedRepo := filepath.Clean(repository)
+	// Normalize the repository path by cleaning it, with forward slashes so that a
+	// repository gets the same key on Windows and elsewhere
+	normalizedRepo := filepath.ToSlash(filepath.Clean(repository))
 
 	// Create a hash of the full repository path to ensure uniqueness
 	// while keeping the key filesystem-safe
@@ -372,11 +708,10 @@ func (lm *LockManager) getLockKey(repository string, lockType LockType) string {
 	hash := hex.EncodeToString(hasher.Sum(nil))[:16] // Use first 16 chars for brevity
 
 	// Create a human-readable base name for easier debugging
-	baseName := filepath.Base(normalizedRepo)
-	// Sanitize the base name to be filesystem-safe
-	safeName := strings.ReplaceAll(baseName, "/", "_")
-	safeName = strings.ReplaceAll(safeName, "\\", "_")
-	safeName = strings.ReplaceAll(safeName, ":", "_")
+	baseName := path.Base(normalizedRepo)
+	// Sanitize the base name to be filesystem-safe, including the characters Windows
+	// forbids in file names
+	safeName := lockNameReplacer.Replace(baseName)
 
 	// Combine safe name, hash, and lock type for a unique key
 	return fmt.Sprintf("%s_%s_%s", safeName, hash, lockType)
@@ -384,6 +719,11 @@ func (lm *LockManager) getLockKey(repository string, lockType LockType) string {
 
 // isProcessAlive checks if a process with the given PID is still running.
 func (lm *LockManager) isProcessAlive(pid int) bool {
+	return processAlive(pid)
+}
+
+// processAlive checks if a process with the given PID is still running.
+func processAlive(pid int) bool {
 	if pid <= 0 {
 		return false
 	}
@@ -409,11 +749,11 @@ func (lm *LockManager) isProcessAlive(pid int) bool {
 		}
 
 		// Try to send a null signal (signal 0) to check if process exists
-		err = process.Signal(os.Signal(nil))
+		err = process.Signal(syscall.Signal(0))
 		if err != nil {
 			// If we get permission denied, the process exists but we can't signal it
-			// If we get no such process, the process doesn't exist
-			return !strings.Contains(err.Error(), "no such process")
+			// Otherwise, e.g. no such process or process already finished, the process doesn't exist
+			return errors.Is(err, syscall.EPERM)
 		}
 
 		return true
@@ -2,9 +2,11 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -81,6 +83,39 @@ func TestLockManager_AcquireLockWithTimeout(t *testing.T) {
 	lm.ReleaseLock("run-1", repository, LockTypeWrite)
 }
 
+func TestLockManager_LockExpiresOnClock(t *testing.T) {
+	tempDir := t.TempDir()
+	ctx := context.Background()
+	repository := "test/repo"
+
+	holder, err := NewLockManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer holder.Close()
+	clock := NewFakeClock(time.Now())
+	holder.SetClock(clock)
+	if err := holder.AcquireLockWithTimeout(ctx, "run-1", repository, LockTypeWrite, time.Minute); err != nil {
+		t.Fatalf("Failed to acquire initial write lock: %v", err)
+	}
+
+	// Another process sees the lock file until it expires on the shared clock
+	other, err := NewLockManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer other.Close()
+	other.SetClock(clock)
+	if err := other.AcquireLockWithTimeout(ctx, "run-2", repository, LockTypeWrite, 50*time.Millisecond); err == nil {
+		t.Fatal("Should not acquire a lock that has not expired")
+	}
+
+	clock.Advance(2 * time.Minute)
+	if err := other.AcquireLockWithTimeout(ctx, "run-2", repository, LockTypeWrite, time.Second); err != nil {
+		t.Errorf("Failed to acquire the expired lock: %v", err)
+	}
+}
+
 func TestLockManager_ReleaseLock(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -373,6 +408,11 @@ func TestLockManager_getLockKey(t *testing.T) {
 			t.Errorf("Lock key should not start or end with problematic character: %s", char)
 		}
 	}
+
+	// Characters Windows forbids in file names are replaced
+	if key := lm.getLockKey(`org/we"ird<name>?`, LockTypeRead); strings.ContainsAny(key, `"<>?`) {
+		t.Errorf("Lock key should not contain characters forbidden on Windows, got %s", key)
+	}
 }
 
 func TestLockManager_isProcessAlive(t *testing.T) {
@@ -392,6 +432,11 @@ func TestLockManager_isProcessAlive(t *testing.T) {
 		t.Error("PID 0 should not be alive")
 	}
 
+	// Test with a process that exited
+	if lm.isProcessAlive(deadProcessID(t)) {
+		t.Error("Exited process should not be alive")
+	}
+
 	// Test with very high PID (likely non-existent)
 	// Note: This test may be flaky on some systems where high PIDs exist
 	// so we'll make it less strict
@@ -475,13 +520,157 @@ func TestLockManager_cleanupStaleLocks(t *testing.T) {
 	}
 
 	// Run cleanup
-	err = lm.cleanupStaleLocks()
+	removed, err := lm.cleanupStaleLocks()
 	if err != nil {
 		t.Fatalf("Failed to cleanup stale locks: %v", err)
 	}
+	if removed != 1 {
+		t.Errorf("Expected 1 stale lock removed, got %d", removed)
+	}
 
 	// Stale lock file should be removed
 	if _, err := os.Stat(lockFile); !os.IsNotExist(err) {
 		t.Error("Stale lock file should have been removed")
 	}
 }
+
+func TestLockManager_WaitForLock(t *testing.T) {
+	tempDir := t.TempDir()
+
+	lm, err := NewLockManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer lm.Close()
+
+	ctx := context.Background()
+	repository := "test/repo"
+
+	if err := lm.WaitForLock(ctx, "run-1", "", repository, LockTypeWrite); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	// Locks are reentrant for the same run
+	if err := lm.WaitForLock(ctx, "run-1", "", repository, LockTypeWrite); err != nil {
+		t.Fatalf("Reentrant acquisition failed: %v", err)
+	}
+	if err := lm.ReleaseLock("run-1", repository, LockTypeWrite); err != nil {
+		t.Fatalf("Failed to release reentrant hold: %v", err)
+	}
+	if !lm.IsLocked(repository) {
+		t.Fatal("Repository should stay locked until every hold is released")
+	}
+
+	// Another run blocks until the lock is released
+	acquired := make(chan error, 1)
+	go func() {
+		acquired <- lm.WaitForLock(ctx, "run-2", "", repository, LockTypeWrite)
+	}()
+
+	select {
+	case err := <-acquired:
+		t.Fatalf("Second run should block while the lock is held, got %v", err)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	if err := lm.ReleaseLock("run-1", repository, LockTypeWrite); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("Second run failed to acquire released lock: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Second run did not acquire the released lock")
+	}
+
+	// Waiting honours context cancellation
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	if err := lm.WaitForLock(timeoutCtx, "run-3", "", repository, LockTypeWrite); err == nil {
+		t.Error("Expected wait to fail when the context expires")
+	}
+
+	// Wait records are removed once the wait ends
+	waits, err := lm.loadWaits()
+	if err != nil {
+		t.Fatalf("Failed to load waits: %v", err)
+	}
+	if len(waits) != 0 {
+		t.Errorf("Expected no wait records, got %d", len(waits))
+	}
+}
+
+func TestLockManager_WaitForLockDetectsDeadlock(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Separate managers sharing a lock directory, as with nested fan-outs
+	lm1, err := NewLockManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer lm1.Close()
+	lm2, err := NewLockManager(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create lock manager: %v", err)
+	}
+	defer lm2.Close()
+
+	ctx := context.Background()
+
+	// Locks are not taken in a canonical order, so nothing prevents parent runs P and Q from
+	// each holding the repository the other's child waits for: the cycle is detected instead
+	if err := lm1.WaitForLock(ctx, "run-p", "", "org/repo-b", LockTypeWrite); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	if err := lm2.WaitForLock(ctx, "run-q", "", "org/repo-a", LockTypeWrite); err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	// Their children wait for the repository held by the other parent
+	results := make(chan error, 2)
+	go func() {
+		results <- lm1.WaitForLock(ctx, "run-c", "run-p", "org/repo-a", LockTypeWrite)
+	}()
+	go func() {
+		results <- lm2.WaitForLock(ctx, "run-d", "run-q", "org/repo-b", LockTypeWrite)
+	}()
+
+	// Exactly one waiter, the one with the highest run ID, is chosen to break the cycle
+	select {
+	case err := <-results:
+		if !errors.Is(err, ErrDeadlock) {
+			t.Fatalf("Expected deadlock error, got %v", err)
+		}
+		if !strings.Contains(err.Error(), "run-d") {
+			t.Errorf("Expected run-d to be the deadlock victim, got %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Deadlock was not detected")
+	}
+
+	deadlocks, err := lm1.DetectDeadlocks()
+	if err != nil {
+		t.Fatalf("Failed to detect deadlocks: %v", err)
+	}
+	for _, deadlock := range deadlocks {
+		if strings.HasPrefix(deadlock, "wait cycle") {
+			t.Errorf("Cycle should be broken after the victim gave up: %s", deadlock)
+		}
+	}
+
+	// Releasing the parent's lock lets the surviving waiter through
+	if err := lm2.ReleaseLock("run-q", "org/repo-a", LockTypeWrite); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	select {
+	case err := <-results:
+		if err != nil {
+			t.Fatalf("Surviving waiter failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Surviving waiter did not acquire the lock")
+	}
+}
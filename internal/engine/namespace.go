@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// NamespaceEnv is the environment variable selecting the namespace of a run when no
+// --namespace flag is given.
+const NamespaceEnv = "TAKO_NAMESPACE"
+
+// namespaceRegex matches namespace names, which appear in directory names and run IDs.
+var namespaceRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,62}$`)
+
+// ValidateNamespace checks that a namespace is a lowercase name of letters, digits, dashes
+// and underscores. The empty namespace is the default one.
+func ValidateNamespace(namespace string) error {
+	if namespace != "" && !namespaceRegex.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace '%s': must be lowercase letters, digits, dashes and underscores", namespace)
+	}
+	return nil
+}
+
+// NamespaceDir returns the directory of a namespace for a cache or workspace directory, next to
+// it so that the directories of the default namespace never contain those of tenants:
+// ~/.tako/cache is ~/.tako/namespaces/<namespace>/cache. The default namespace keeps dir.
+func NamespaceDir(dir, namespace string) string {
+	if namespace == "" {
+		return dir
+	}
+	return filepath.Join(filepath.Dir(dir), "namespaces", namespace, filepath.Base(dir))
+}
+
+// NamespacedRunID records a namespace in a run ID, as a .<namespace> suffix.
+func NamespacedRunID(runID, namespace string) string {
+	if namespace == "" {
+		return runID
+	}
+	return runID + "." + namespace
+}
+
+// RunIDNamespace returns the namespace recorded in a run ID; empty for the default namespace.
+func RunIDNamespace(runID string) string {
+	_, namespace, _ := strings.Cut(runID, ".")
+	return namespace
+}
@@ -0,0 +1,67 @@
+package engine
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestNamespaceDir(t *testing.T) {
+	cacheDir := filepath.Join("home", ".tako", "cache")
+	if got := NamespaceDir(cacheDir, ""); got != cacheDir {
+		t.Errorf("expected the default namespace to keep %s, got %s", cacheDir, got)
+	}
+	expected := filepath.Join("home", ".tako", "namespaces", "team-a", "cache")
+	if got := NamespaceDir(cacheDir, "team-a"); got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestValidateNamespace(t *testing.T) {
+	for _, namespace := range []string{"", "team-a", "ci_01"} {
+		if err := ValidateNamespace(namespace); err != nil {
+			t.Errorf("expected %q to be valid, got %v", namespace, err)
+		}
+	}
+	for _, namespace := range []string{"Team", "-team", "team/a", "team.a", ".."} {
+		if err := ValidateNamespace(namespace); err == nil {
+			t.Errorf("expected %q to be invalid", namespace)
+		}
+	}
+}
+
+func TestNamespacedRunID(t *testing.T) {
+	runID := GenerateRunID()
+	if got := NamespacedRunID(runID, ""); got != runID || RunIDNamespace(got) != "" {
+		t.Errorf("expected the default namespace to keep %s, got %s", runID, got)
+	}
+
+	namespaced := NamespacedRunID(runID, "team-a")
+	if RunIDNamespace(namespaced) != "team-a" {
+		t.Errorf("expected the namespace recorded in %s", namespaced)
+	}
+	if !IsValidRunID(namespaced) {
+		t.Errorf("expected %s to be a valid run ID", namespaced)
+	}
+	if IsValidRunID(runID + ".Team") {
+		t.Errorf("expected a run ID with an invalid namespace to be rejected")
+	}
+}
+
+func TestNewRunner_Namespace(t *testing.T) {
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: t.TempDir(),
+		CacheDir:      t.TempDir(),
+		Namespace:     "team-a",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if RunIDNamespace(runner.runID) != "team-a" || runner.state.Namespace != "team-a" {
+		t.Errorf("expected the namespace recorded in the run ID and state, got %s", runner.runID)
+	}
+	if _, err := NewRunner(RunnerOptions{WorkspaceRoot: t.TempDir(), CacheDir: t.TempDir(), Namespace: "Team A"}); err == nil {
+		t.Errorf("expected an invalid namespace to be rejected")
+	}
+}
@@ -0,0 +1,221 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// natsServerInfo is the part of the INFO message of a NATS server tako reads.
+type natsServerInfo struct {
+	Headers     bool `json:"headers"`
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConn is a connection speaking the NATS client protocol, enough of it to publish
+// messages and subscribe to subjects without a client library.
+type natsConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	info   natsServerInfo
+
+	mu     sync.Mutex // Serializes writes
+	writer io.Writer
+}
+
+// dialNATS connects to the server of a nats:// (or tls://) URL, 4222 being the default port,
+// and authenticates with the user and password, or the token, of the URL.
+func dialNATS(ctx context.Context, server *url.URL) (*natsConn, error) {
+	host := server.Host
+	if server.Port() == "" {
+		host = net.JoinHostPort(server.Hostname(), "4222")
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, err
+	}
+	nc := &natsConn{conn: conn, reader: bufio.NewReader(conn), writer: conn}
+	if err := nc.handshake(ctx, server); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return nc, nil
+}
+
+func (nc *natsConn) handshake(ctx context.Context, server *url.URL) error {
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = nc.conn.SetDeadline(deadline)
+	}
+
+	line, err := nc.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read server info: %w", err)
+	}
+	infoJSON, ok := strings.CutPrefix(strings.TrimSpace(line), "INFO ")
+	if !ok {
+		return fmt.Errorf("unexpected server greeting: %s", strings.TrimSpace(line))
+	}
+	if err := json.Unmarshal([]byte(infoJSON), &nc.info); err != nil {
+		return fmt.Errorf("invalid server info: %w", err)
+	}
+
+	if nc.info.TLSRequired || server.Scheme == "tls" {
+		tlsConn := tls.Client(nc.conn, &tls.Config{ServerName: server.Hostname()})
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			return fmt.Errorf("TLS handshake failed: %w", err)
+		}
+		nc.conn, nc.reader, nc.writer = tlsConn, bufio.NewReader(tlsConn), tlsConn
+	}
+
+	connect := map[string]interface{}{"verbose": false, "pedantic": false, "name": "tako", "lang": "go", "headers": nc.info.Headers}
+	if user := server.User; user != nil {
+		if password, ok := user.Password(); ok {
+			connect["user"], connect["pass"] = user.Username(), password
+		} else {
+			connect["auth_token"] = user.Username()
+		}
+	}
+	connectJSON, err := json.Marshal(connect)
+	if err != nil {
+		return err
+	}
+	return nc.write(fmt.Sprintf("CONNECT %s\r\n", connectJSON))
+}
+
+// write sends protocol lines to the server.
+func (nc *natsConn) write(data string) error {
+	nc.mu.Lock()
+	defer nc.mu.Unlock()
+
+	_, err := io.WriteString(nc.writer, data)
+	return err
+}
+
+// publish sends a message, with a Nats-Msg-Id header when msgID is set and the server
+// supports headers.
+func (nc *natsConn) publish(subject, msgID string, data []byte) error {
+	if nc.info.Headers && msgID != "" {
+		headers := fmt.Sprintf("NATS/1.0\r\nNats-Msg-Id: %s\r\n\r\n", msgID)
+		return nc.write(fmt.Sprintf("HPUB %s %d %d\r\n%s%s\r\n", subject, len(headers), len(headers)+len(data), headers, data))
+	}
+	return nc.write(fmt.Sprintf("PUB %s %d\r\n%s\r\n", subject, len(data), data))
+}
+
+// flush waits for the server to answer a PING, which confirms that it processed the
+// messages sent before, and fails on the -ERR the server sends instead.
+func (nc *natsConn) flush() error {
+	if err := nc.write("PING\r\n"); err != nil {
+		return err
+	}
+	for {
+		line, err := nc.reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("failed to read server reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return natsError(line)
+		}
+	}
+}
+
+// natsMessage is a message delivered to a subscription.
+type natsMessage struct {
+	Subject string
+	Reply   string
+	Headers map[string]string
+	Data    []byte
+}
+
+// next reads protocol messages until the server delivers a message, answering its PINGs.
+func (nc *natsConn) next() (*natsMessage, error) {
+	for {
+		line, err := nc.reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			if err := nc.write("PONG\r\n"); err != nil {
+				return nil, err
+			}
+		case "-ERR":
+			return nil, natsError(strings.TrimSpace(line))
+		case "MSG", "HMSG":
+			return nc.readMessage(fields)
+		}
+	}
+}
+
+// readMessage reads the payload of MSG <subject> <sid> [reply] <size> or
+// HMSG <subject> <sid> [reply] <header size> <total size>.
+func (nc *natsConn) readMessage(fields []string) (*natsMessage, error) {
+	headerSize := 0
+	args := fields[1:]
+	if fields[0] == "HMSG" {
+		if len(args) < 4 {
+			return nil, fmt.Errorf("invalid HMSG: %s", strings.Join(fields, " "))
+		}
+		if _, err := fmt.Sscanf(args[len(args)-2], "%d", &headerSize); err != nil {
+			return nil, fmt.Errorf("invalid HMSG header size: %w", err)
+		}
+		args = append(args[:len(args)-2:len(args)-2], args[len(args)-1])
+	}
+	if len(args) < 3 || len(args) > 4 {
+		return nil, fmt.Errorf("invalid %s: %s", fields[0], strings.Join(fields, " "))
+	}
+	var size int
+	if _, err := fmt.Sscanf(args[len(args)-1], "%d", &size); err != nil || size < headerSize {
+		return nil, fmt.Errorf("invalid %s size: %s", fields[0], args[len(args)-1])
+	}
+
+	msg := &natsMessage{Subject: args[0]}
+	if len(args) == 4 {
+		msg.Reply = args[2]
+	}
+	payload := make([]byte, size+2) // Followed by CRLF
+	if _, err := io.ReadFull(nc.reader, payload); err != nil {
+		return nil, err
+	}
+	msg.Headers = parseNATSHeaders(string(payload[:headerSize]))
+	msg.Data = payload[headerSize:size]
+	return msg, nil
+}
+
+// parseNATSHeaders parses the NATS/1.0 header block of a message.
+func parseNATSHeaders(block string) map[string]string {
+	headers := make(map[string]string)
+	for i, line := range strings.Split(block, "\r\n") {
+		if i == 0 {
+			continue // NATS/1.0 status line
+		}
+		if name, value, ok := strings.Cut(line, ":"); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	return headers
+}
+
+func natsError(line string) error {
+	return fmt.Errorf("server error: %s", strings.Trim(strings.TrimSpace(strings.TrimPrefix(line, "-ERR")), "'"))
+}
+
+// Close closes the connection.
+func (nc *natsConn) Close() error {
+	return nc.conn.Close()
+}
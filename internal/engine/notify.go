@@ -0,0 +1,351 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// notificationTimeout bounds the delivery of a notification to a channel.
+const notificationTimeout = 10 * time.Second
+
+// NotificationMessage is a notification sent to a channel.
+type NotificationMessage struct {
+	// Trigger is the policy trigger that sent the notification; empty for notification steps.
+	Trigger    string    `json:"trigger,omitempty"`
+	Title      string    `json:"title"`
+	Text       string    `json:"text"`
+	Repository string    `json:"repository,omitempty"`
+	Workflow   string    `json:"workflow,omitempty"`
+	RunID      string    `json:"run_id,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// Notifier sends notifications to a channel.
+type Notifier interface {
+	// Name identifies the channel in logs.
+	Name() string
+	// Notify sends a notification.
+	Notify(ctx context.Context, message *NotificationMessage) error
+}
+
+// NewNotifier creates the notifier of a channel. The environment, given as KEY=value, provides
+// the URLs and credentials the channel reads from variables.
+func NewNotifier(cfg config.NotificationChannel, environment []string) (Notifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	lookup := func(field, name string) (string, error) {
+		value, ok := lookupEnvironment(environment, name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("%s %s is not set", field, name)
+		}
+		return value, nil
+	}
+
+	target := cfg.URL
+	if cfg.URLEnv != "" {
+		value, err := lookup("url_env", cfg.URLEnv)
+		if err != nil {
+			return nil, err
+		}
+		target = value
+	}
+
+	switch cfg.Type {
+	case config.NotificationSlack:
+		return &SlackNotifier{url: target, channel: cfg.Channel, client: http.DefaultClient}, nil
+	case config.NotificationWebhook:
+		notifier := &WebhookNotifier{url: target, headers: cfg.Headers, client: http.DefaultClient}
+		if cfg.SecretEnv != "" {
+			secret, err := lookup("secret_env", cfg.SecretEnv)
+			if err != nil {
+				return nil, err
+			}
+			notifier.secret = []byte(secret)
+		}
+		return notifier, nil
+	default:
+		notifier := &EmailNotifier{addr: cfg.SMTP, from: cfg.From, to: cfg.To, sendMail: smtp.SendMail}
+		if cfg.UsernameEnv != "" {
+			username, err := lookup("username_env", cfg.UsernameEnv)
+			if err != nil {
+				return nil, err
+			}
+			password, err := lookup("password_env", cfg.PasswordEnv)
+			if err != nil {
+				return nil, err
+			}
+			host, _, _ := net.SplitHostPort(cfg.SMTP)
+			notifier.auth = smtp.PlainAuth("", username, password, host)
+		}
+		return notifier, nil
+	}
+}
+
+// SlackNotifier POSTs notifications to a Slack incoming webhook.
+type SlackNotifier struct {
+	url     string
+	channel string
+	client  *http.Client
+}
+
+// Name implements Notifier.
+func (n *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify implements Notifier.
+func (n *SlackNotifier) Notify(ctx context.Context, message *NotificationMessage) error {
+	text := message.Text
+	if message.Title != "" {
+		text = "*" + message.Title + "*\n" + text
+	}
+	payload := map[string]string{"text": text}
+	if n.channel != "" {
+		payload["channel"] = n.channel
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+	return postEvent(ctx, n.client, n.url, "application/json", body, nil)
+}
+
+// WebhookNotifier POSTs notifications as NotificationMessage JSON to a URL. With a secret, the
+// X-Tako-Signature-256 header holds the hex HMAC-SHA256 of the body, as for webhook sinks.
+type WebhookNotifier struct {
+	url     string
+	headers map[string]string
+	secret  []byte
+	client  *http.Client
+}
+
+// Name implements Notifier.
+func (n *WebhookNotifier) Name() string {
+	if parsed, err := url.Parse(n.url); err == nil {
+		return "webhook " + parsed.Host
+	}
+	return "webhook"
+}
+
+// Notify implements Notifier.
+func (n *WebhookNotifier) Notify(ctx context.Context, message *NotificationMessage) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	headers := make(map[string]string, len(n.headers)+1)
+	for name, value := range n.headers {
+		headers[name] = value
+	}
+	if len(n.secret) > 0 {
+		mac := hmac.New(sha256.New, n.secret)
+		mac.Write(body)
+		headers["X-Tako-Signature-256"] = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	return postEvent(ctx, n.client, n.url, "application/json", body, headers)
+}
+
+// EmailNotifier sends notifications as plain text emails through an SMTP server.
+type EmailNotifier struct {
+	addr     string
+	from     string
+	to       []string
+	auth     smtp.Auth
+	sendMail func(addr string, auth smtp.Auth, from string, to []string, msg []byte) error
+}
+
+// Name implements Notifier.
+func (n *EmailNotifier) Name() string {
+	return "email via " + n.addr
+}
+
+// Notify implements Notifier. The SMTP client does not take a context: the delivery is only
+// abandoned, not interrupted, when ctx is done.
+func (n *EmailNotifier) Notify(ctx context.Context, message *NotificationMessage) error {
+	subject := message.Title
+	if subject == "" {
+		subject = "tako notification"
+	}
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", strings.NewReplacer("\r", " ", "\n", " ").Replace(subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", message.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(message.Text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- n.sendMail(n.addr, n.auth, n.from, n.to, []byte(msg.String()))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NotificationPolicy notifies a channel when one of its triggers happens.
+type NotificationPolicy struct {
+	triggers []string
+	notifier Notifier
+}
+
+// NewNotificationPolicies creates the notification policies of a workflow.
+func NewNotificationPolicies(notifications []config.Notification, environment []string) ([]NotificationPolicy, error) {
+	policies := make([]NotificationPolicy, 0, len(notifications))
+	for i, cfg := range notifications {
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid notification %d: %w", i, err)
+		}
+		notifier, err := NewNotifier(cfg.NotificationChannel, environment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notification %d: %w", i, err)
+		}
+		policies = append(policies, NotificationPolicy{triggers: cfg.On, notifier: notifier})
+	}
+	return policies, nil
+}
+
+// notify sends a notification to the channels of the policies with its trigger. Notifications
+// are best effort: failed deliveries are logged and never fail the run.
+func (r *Runner) notify(ctx context.Context, message *NotificationMessage) {
+	message.Repository = r.repository
+	message.RunID = r.runID
+	message.Time = time.Now()
+
+	for _, policy := range r.notifications {
+		if !slices.Contains(policy.triggers, message.Trigger) {
+			continue
+		}
+		notifyCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), notificationTimeout)
+		if err := policy.notifier.Notify(notifyCtx, message); err != nil {
+			slog.Warn("failed to send notification", "channel", policy.notifier.Name(), "trigger", message.Trigger, "error", err)
+		}
+		cancel()
+	}
+}
+
+// notifyFanOut sends the notifications of a fan-out step that failed, or whose children
+// failed or timed out.
+func (r *Runner) notifyFanOut(ctx context.Context, stepID string, result *FanOutResult, fanOutErr error) {
+	if len(r.notifications) == 0 {
+		return
+	}
+	workflowName := r.state.WorkflowName
+
+	var failures []string
+	if result != nil {
+		for _, childErr := range result.DetailedErrors {
+			failures = append(failures, fmt.Sprintf("- %s:%s (%s): %s", childErr.Repository, childErr.Workflow, childErr.ErrorType, childErr.ErrorMessage))
+		}
+	}
+	details := strings.Join(failures, "\n")
+
+	if fanOutErr != nil || (result != nil && !result.Success) {
+		text := fmt.Sprintf("Fan-out step '%s' of workflow '%s' failed", stepID, workflowName)
+		if fanOutErr != nil {
+			text += ": " + fanOutErr.Error()
+		}
+		if details != "" {
+			text += "\n" + details
+		}
+		r.notify(ctx, &NotificationMessage{Trigger: config.NotifyFanOutFailed, Title: "tako fan-out failed", Text: text, Workflow: workflowName})
+	}
+	if result == nil || result.ChildrenSummary == nil {
+		return
+	}
+
+	summary := result.ChildrenSummary
+	if summary.FailedChildren > 0 {
+		text := fmt.Sprintf("%d of %d child workflows of fan-out step '%s' of workflow '%s' failed",
+			summary.FailedChildren, summary.TotalChildren, stepID, workflowName)
+		if details != "" {
+			text += "\n" + details
+		}
+		r.notify(ctx, &NotificationMessage{Trigger: config.NotifyChildFailed, Title: "tako child workflows failed", Text: text, Workflow: workflowName})
+	}
+	if summary.TimedOutChildren > 0 {
+		text := fmt.Sprintf("%d of %d child workflows of fan-out step '%s' of workflow '%s' timed out",
+			summary.TimedOutChildren, summary.TotalChildren, stepID, workflowName)
+		if details != "" {
+			text += "\n" + details
+		}
+		r.notify(ctx, &NotificationMessage{Trigger: config.NotifyChildTimedOut, Title: "tako child workflows timed out", Text: text, Workflow: workflowName})
+	}
+}
+
+// executeNotifyStep executes the tako/notify-slack@v1, tako/notify-webhook@v1 and
+// tako/notify-email@v1 built-in steps. Unlike notification policies, a notification step fails
+// when its notification cannot be delivered.
+func (r *Runner) executeNotifyStep(ctx context.Context, step config.WorkflowStep, stepID string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
+	fail := func(err error) (StepResult, error) {
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   time.Now(),
+		}, err
+	}
+
+	params, err := config.ParseNotifyStepParams(step.Uses, step.With)
+	if err != nil {
+		return fail(err)
+	}
+	text, err := r.expandTemplate(params.Message, inputs, stepOutputs)
+	if err != nil {
+		return fail(fmt.Errorf("failed to expand message: %v", err))
+	}
+	title, err := r.expandTemplate(params.Title, inputs, stepOutputs)
+	if err != nil {
+		return fail(fmt.Errorf("failed to expand title: %v", err))
+	}
+	notifier, err := NewNotifier(params.NotificationChannel, r.getEnvironment())
+	if err != nil {
+		return fail(err)
+	}
+
+	message := &NotificationMessage{
+		Title:      title,
+		Text:       text,
+		Repository: r.repository,
+		Workflow:   r.state.WorkflowName,
+		RunID:      r.runID,
+		Time:       time.Now(),
+	}
+	notifyCtx, cancel := context.WithTimeout(ctx, notificationTimeout)
+	defer cancel()
+	if err := notifier.Notify(notifyCtx, message); err != nil {
+		return fail(fmt.Errorf("failed to notify %s: %w", notifier.Name(), err))
+	}
+
+	output := fmt.Sprintf("Notified %s", notifier.Name())
+	r.state.CompleteStep(stepID, output, nil)
+	return StepResult{
+		ID:        stepID,
+		Success:   true,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+		Output:    output,
+	}, nil
+}
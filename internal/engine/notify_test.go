@@ -0,0 +1,272 @@
+package engine
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// notificationRecorder is a webhook server recording the bodies it receives.
+type notificationRecorder struct {
+	mu      sync.Mutex
+	bodies  []string
+	headers []http.Header
+}
+
+func newNotificationRecorder(t *testing.T) (*notificationRecorder, string) {
+	t.Helper()
+	recorder := &notificationRecorder{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorder.mu.Lock()
+		recorder.bodies = append(recorder.bodies, string(body))
+		recorder.headers = append(recorder.headers, r.Header.Clone())
+		recorder.mu.Unlock()
+	}))
+	t.Cleanup(server.Close)
+	return recorder, server.URL
+}
+
+func (n *notificationRecorder) received() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.bodies...)
+}
+
+func TestSlackNotifier(t *testing.T) {
+	recorder, url := newNotificationRecorder(t)
+	notifier, err := NewNotifier(config.NotificationChannel{Type: config.NotificationSlack, URLEnv: "SLACK_WEBHOOK_URL", Channel: "#releases"},
+		[]string{"SLACK_WEBHOOK_URL=" + url})
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+	if err := notifier.Notify(context.Background(), &NotificationMessage{Title: "Released", Text: "v1.2.0 is out"}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(recorder.received()[0]), &payload); err != nil {
+		t.Fatalf("failed to decode payload: %v", err)
+	}
+	if payload["text"] != "*Released*\nv1.2.0 is out" || payload["channel"] != "#releases" {
+		t.Errorf("unexpected payload: %v", payload)
+	}
+
+	if _, err := NewNotifier(config.NotificationChannel{Type: config.NotificationSlack, URLEnv: "SLACK_WEBHOOK_URL"}, nil); err == nil {
+		t.Error("expected an error when the webhook URL variable is not set")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	recorder, url := newNotificationRecorder(t)
+	notifier, err := NewNotifier(config.NotificationChannel{Type: config.NotificationWebhook, URL: url, SecretEnv: "HOOK_SECRET",
+		Headers: map[string]string{"X-Team": "platform"}}, []string{"HOOK_SECRET=s3cret"})
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+	message := &NotificationMessage{Trigger: config.NotifyChildFailed, Title: "Children failed", Text: "org/app failed", RunID: "exec-1"}
+	if err := notifier.Notify(context.Background(), message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	body := recorder.received()[0]
+	var received NotificationMessage
+	if err := json.Unmarshal([]byte(body), &received); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if received.Trigger != config.NotifyChildFailed || received.Text != "org/app failed" || received.RunID != "exec-1" {
+		t.Errorf("unexpected notification: %+v", received)
+	}
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write([]byte(body))
+	headers := recorder.headers[0]
+	if headers.Get("X-Tako-Signature-256") != "sha256="+hex.EncodeToString(mac.Sum(nil)) || headers.Get("X-Team") != "platform" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	notifier, err := NewNotifier(config.NotificationChannel{Type: config.NotificationEmail, SMTP: "smtp.example.com:587", From: "tako@example.com",
+		To: []string{"oncall@example.com", "team@example.com"}, UsernameEnv: "SMTP_USER", PasswordEnv: "SMTP_PASSWORD"},
+		[]string{"SMTP_USER=tako", "SMTP_PASSWORD=secret"})
+	if err != nil {
+		t.Fatalf("NewNotifier() error = %v", err)
+	}
+
+	var addr, from, msg string
+	var to []string
+	var auth smtp.Auth
+	email := notifier.(*EmailNotifier)
+	email.sendMail = func(a string, au smtp.Auth, f string, t []string, m []byte) error {
+		addr, auth, from, to, msg = a, au, f, t, string(m)
+		return nil
+	}
+	message := &NotificationMessage{Title: "Workflow\nfailed", Text: "release failed\nsee logs", Time: time.Now()}
+	if err := notifier.Notify(context.Background(), message); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if addr != "smtp.example.com:587" || auth == nil || from != "tako@example.com" || len(to) != 2 {
+		t.Errorf("unexpected delivery: addr=%s auth=%v from=%s to=%v", addr, auth, from, to)
+	}
+	for _, expected := range []string{"To: oncall@example.com, team@example.com\r\n", "Subject: Workflow failed\r\n", "\r\n\r\nrelease failed\r\nsee logs\r\n"} {
+		if !strings.Contains(msg, expected) {
+			t.Errorf("expected the email to contain %q, got %q", expected, msg)
+		}
+	}
+}
+
+func TestRunnerNotifyStep(t *testing.T) {
+	recorder, url := newNotificationRecorder(t)
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: build
+        run: echo 1.2.3
+        produces:
+          outputs:
+            version: from_stdout
+      - id: announce
+        uses: tako/notify-webhook@v1
+        with:
+          url: `+url+`
+          title: Released
+          message: "Released {{ .Steps.build.version }}"
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if !result.Steps[1].Success {
+		t.Errorf("Expected the notification step to succeed: %+v", result.Steps[1])
+	}
+
+	bodies := recorder.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected 1 notification, got %d", len(bodies))
+	}
+	var received NotificationMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &received); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if received.Title != "Released" || received.Text != "Released 1.2.3" || received.Workflow != "test" {
+		t.Errorf("Unexpected notification: %+v", received)
+	}
+}
+
+func TestRunnerNotifyStepFailsWhenUndelivered(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid token", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	_, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: announce
+        uses: tako/notify-slack@v1
+        with:
+          url: `+server.URL+`
+          message: hello
+`)
+	if err == nil || !strings.Contains(err.Error(), "failed to notify slack") {
+		t.Errorf("Expected the step to fail, got %v", err)
+	}
+}
+
+func TestRunnerWorkflowFailedNotification(t *testing.T) {
+	recorder, url := newNotificationRecorder(t)
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    notifications:
+      - on: [workflow_failed]
+        type: webhook
+        url_env: HOOK_URL
+      - on: [fan_out_failed]
+        type: webhook
+        url_env: HOOK_URL
+    steps:
+      - id: build
+        run: exit 2
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{"HOOK_URL=" + url},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir); err == nil {
+		t.Fatal("Expected the workflow to fail")
+	}
+
+	bodies := recorder.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected only the workflow_failed policy to notify, got %v", bodies)
+	}
+	var received NotificationMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &received); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if received.Trigger != config.NotifyWorkflowFailed || received.RunID != runner.GetRunID() || !strings.Contains(received.Text, "step 'build' failed") {
+		t.Errorf("Unexpected notification: %+v", received)
+	}
+}
+
+func TestRunnerNotifyFanOut(t *testing.T) {
+	recorder, url := newNotificationRecorder(t)
+	policies, err := NewNotificationPolicies([]config.Notification{
+		{On: []string{config.NotifyChildTimedOut}, NotificationChannel: config.NotificationChannel{Type: config.NotificationWebhook, URL: url}},
+		{On: []string{config.NotifyFanOutFailed, config.NotifyChildFailed}, NotificationChannel: config.NotificationChannel{Type: config.NotificationWebhook, URL: url}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewNotificationPolicies() error = %v", err)
+	}
+	runner := &Runner{runID: "exec-parent", state: &ExecutionState{WorkflowName: "release"}, notifications: policies}
+
+	result := &FanOutResult{
+		Success:         true,
+		ChildrenSummary: &FanOutSummary{TotalChildren: 3, CompletedChildren: 2, TimedOutChildren: 1},
+		DetailedErrors:  []ChildExecutionError{{Repository: "org/app", Workflow: "update", ErrorType: "timeout", ErrorMessage: "context deadline exceeded"}},
+	}
+	runner.notifyFanOut(context.Background(), "fan-out", result, nil)
+
+	bodies := recorder.received()
+	if len(bodies) != 1 {
+		t.Fatalf("Expected only the child_timed_out policy to notify, got %v", bodies)
+	}
+	var received NotificationMessage
+	if err := json.Unmarshal([]byte(bodies[0]), &received); err != nil {
+		t.Fatalf("failed to decode notification: %v", err)
+	}
+	if received.Trigger != config.NotifyChildTimedOut || received.Workflow != "release" ||
+		!strings.Contains(received.Text, "1 of 3 child workflows") || !strings.Contains(received.Text, "org/app:update (timeout)") {
+		t.Errorf("Unexpected notification: %+v", received)
+	}
+
+	result.Success = false
+	result.ChildrenSummary = &FanOutSummary{TotalChildren: 3, CompletedChildren: 2, FailedChildren: 1}
+	runner.notifyFanOut(context.Background(), "fan-out", result, nil)
+	if bodies := recorder.received(); len(bodies) != 3 {
+		t.Errorf("Expected the fan_out_failed and child_failed notifications, got %v", bodies[1:])
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"sort"
+	"time"
 
 	"github.com/dangazineu/tako/internal/interfaces"
 )
@@ -14,7 +15,7 @@ import (
 //
 // The orchestrator supports filtering and prioritization of subscriptions:
 //   - Filtering subscriptions based on criteria
-//   - Prioritizing subscriptions by repository path for deterministic ordering
+//   - Prioritizing subscriptions by priority and repository path for deterministic ordering
 //   - Adding structured logging and monitoring
 //   - Coordinating workflow triggering with state management
 //   - Handling idempotency and diamond dependency resolution
@@ -82,6 +83,12 @@ func NewOrchestratorWithConfig(discoverer interfaces.SubscriptionDiscoverer, con
 	}, nil
 }
 
+// contextDiscoverer is a discoverer that gives up on discovery when its context is done, like
+// DiscoveryManager.
+type contextDiscoverer interface {
+	FindSubscribersContext(ctx context.Context, artifact, eventType string) ([]interfaces.SubscriptionMatch, error)
+}
+
 // DiscoverSubscriptions finds all repositories that subscribe to the specified
 // artifact and event type. This method provides the orchestration layer for
 // subscription discovery with optional filtering and prioritization capabilities.
@@ -127,7 +134,13 @@ func (o *Orchestrator) DiscoverSubscriptions(ctx context.Context, artifact, even
 	}
 
 	// Delegate to the discoverer for raw subscription discovery
-	rawMatches, err := o.discoverer.FindSubscribers(artifact, eventType)
+	var rawMatches []interfaces.SubscriptionMatch
+	var err error
+	if discoverer, ok := o.discoverer.(contextDiscoverer); ok {
+		rawMatches, err = discoverer.FindSubscribersContext(ctx, artifact, eventType)
+	} else {
+		rawMatches, err = o.discoverer.FindSubscribers(artifact, eventType)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +154,7 @@ func (o *Orchestrator) DiscoverSubscriptions(ctx context.Context, artifact, even
 
 // filterSubscriptions applies filtering logic to subscription matches.
 // Currently supports filtering out disabled subscriptions if configured.
+// Subscriptions disabled with an until time are kept once that time has passed.
 func (o *Orchestrator) filterSubscriptions(matches []interfaces.SubscriptionMatch) []interfaces.SubscriptionMatch {
 	if !o.config.EnableFiltering {
 		return matches
@@ -150,31 +164,40 @@ func (o *Orchestrator) filterSubscriptions(matches []interfaces.SubscriptionMatc
 		return matches
 	}
 
-	// Filter out disabled subscriptions (if the subscription has a Disabled field)
-	// Note: Since config.Subscription doesn't currently have a Disabled field,
-	// this filtering is a no-op for now but provides the infrastructure
-	// for future enhancement when the schema is extended.
+	now := time.Now()
 	filtered := make([]interfaces.SubscriptionMatch, 0, len(matches))
-	filtered = append(filtered, matches...)
+	for _, match := range matches {
+		if match.Subscription.IsActive(now) {
+			filtered = append(filtered, match)
+		}
+	}
 
 	return filtered
 }
 
 // prioritizeSubscriptions applies priority-based sorting to subscription matches.
-// Sorts by repository path for deterministic ordering, supporting the "first-wins"
-// diamond dependency resolution rule implemented in the fan-out executor.
+// Higher priority subscriptions come first; ties are sorted by repository path for
+// deterministic ordering, supporting the "first-wins" diamond dependency resolution
+// rule implemented in the fan-out executor.
 func (o *Orchestrator) prioritizeSubscriptions(matches []interfaces.SubscriptionMatch) []interfaces.SubscriptionMatch {
 	if !o.config.EnablePrioritization {
 		return matches
 	}
 
+	return sortSubscriptionsByPriority(matches)
+}
+
+// sortSubscriptionsByPriority returns a copy of the matches sorted by descending
+// subscription priority, then by repository path and workflow name.
+func sortSubscriptionsByPriority(matches []interfaces.SubscriptionMatch) []interfaces.SubscriptionMatch {
 	// Create a copy to avoid modifying the original slice
 	prioritized := make([]interfaces.SubscriptionMatch, len(matches))
 	copy(prioritized, matches)
 
-	// Sort by repository path for deterministic ordering
-	// This supports the "first-wins" rule for diamond dependency resolution
-	sort.Slice(prioritized, func(i, j int) bool {
+	sort.SliceStable(prioritized, func(i, j int) bool {
+		if prioritized[i].Subscription.Priority != prioritized[j].Subscription.Priority {
+			return prioritized[i].Subscription.Priority > prioritized[j].Subscription.Priority
+		}
 		if prioritized[i].Repository != prioritized[j].Repository {
 			return prioritized[i].Repository < prioritized[j].Repository
 		}
@@ -511,6 +511,50 @@ func TestOrchestrator_PrioritizeSubscriptions(t *testing.T) {
 		}
 	})
 
+	t.Run("higher priority first", func(t *testing.T) {
+		prioritizedMatches := []interfaces.SubscriptionMatch{
+			{Repository: "org/repo-a", Subscription: config.Subscription{Workflow: "low", Priority: -5}},
+			{Repository: "org/repo-z", Subscription: config.Subscription{Workflow: "critical", Priority: 10}},
+			{Repository: "org/repo-b", Subscription: config.Subscription{Workflow: "normal"}},
+			{Repository: "org/repo-m", Subscription: config.Subscription{Workflow: "critical", Priority: 10}},
+		}
+
+		discoverer := &mockSubscriptionDiscoverer{
+			findSubscribersFunc: func(artifact, eventType string) ([]interfaces.SubscriptionMatch, error) {
+				return prioritizedMatches, nil
+			},
+		}
+
+		orchestrator, err := NewOrchestratorWithConfig(discoverer, OrchestratorConfig{EnablePrioritization: true})
+		if err != nil {
+			t.Fatalf("Failed to create orchestrator: %v", err)
+		}
+
+		matches, err := orchestrator.DiscoverSubscriptions(context.Background(), "test/lib:lib", "build_completed")
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Should be sorted by descending priority, then by repository
+		expectedOrder := []string{
+			"org/repo-m:critical",
+			"org/repo-z:critical",
+			"org/repo-b:normal",
+			"org/repo-a:low",
+		}
+
+		if len(matches) != len(expectedOrder) {
+			t.Fatalf("Expected %d matches, got %d", len(expectedOrder), len(matches))
+		}
+
+		for i, match := range matches {
+			actual := fmt.Sprintf("%s:%s", match.Repository, match.Subscription.Workflow)
+			if actual != expectedOrder[i] {
+				t.Errorf("Expected match %d to be '%s', got '%s'", i, expectedOrder[i], actual)
+			}
+		}
+	})
+
 	t.Run("prioritization disabled", func(t *testing.T) {
 		config := OrchestratorConfig{
 			EnablePrioritization: false,
@@ -583,6 +627,44 @@ func TestOrchestrator_PrioritizeSubscriptions(t *testing.T) {
 	})
 }
 
+func TestOrchestrator_FilterDisabledSubscriptions(t *testing.T) {
+	testMatches := []interfaces.SubscriptionMatch{
+		{Repository: "org/enabled", Subscription: config.Subscription{Workflow: "build"}},
+		{Repository: "org/disabled", Subscription: config.Subscription{Workflow: "build", Disabled: true}},
+		{Repository: "org/maintenance", Subscription: config.Subscription{Workflow: "build", Disabled: true, Until: time.Now().Add(time.Hour).Format(time.RFC3339)}},
+		{Repository: "org/maintenance-over", Subscription: config.Subscription{Workflow: "build", Disabled: true, Until: time.Now().Add(-time.Hour).Format(time.RFC3339)}},
+	}
+
+	discoverer := &mockSubscriptionDiscoverer{
+		findSubscribersFunc: func(artifact, eventType string) ([]interfaces.SubscriptionMatch, error) {
+			return testMatches, nil
+		},
+	}
+
+	orchestrator, err := NewOrchestratorWithConfig(discoverer, OrchestratorConfig{
+		EnableFiltering:             true,
+		FilterDisabledSubscriptions: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create orchestrator: %v", err)
+	}
+
+	matches, err := orchestrator.DiscoverSubscriptions(context.Background(), "test/lib:lib", "build_completed")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := []string{"org/enabled", "org/maintenance-over"}
+	if len(matches) != len(expected) {
+		t.Fatalf("Expected %d matches, got %d", len(expected), len(matches))
+	}
+	for i, match := range matches {
+		if match.Repository != expected[i] {
+			t.Errorf("Expected match %d to be %s, got %s", i, expected[i], match.Repository)
+		}
+	}
+}
+
 func TestOrchestrator_FilterSubscriptions(t *testing.T) {
 	testMatches := []interfaces.SubscriptionMatch{
 		{
@@ -0,0 +1,114 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// emittedEventTypes returns the event types the fan-out steps of a workflow emit, including
+// those of its parallel groups, as far as they are known before it runs: event types computed
+// by templates are left out.
+func emittedEventTypes(steps []config.WorkflowStep) []string {
+	var eventTypes []string
+	for _, step := range steps {
+		if len(step.Parallel) > 0 {
+			for _, eventType := range emittedEventTypes(step.Parallel) {
+				if !slices.Contains(eventTypes, eventType) {
+					eventTypes = append(eventTypes, eventType)
+				}
+			}
+			continue
+		}
+		if step.Uses != "tako/fan-out@v1" {
+			continue
+		}
+		stepEventTypes, err := fanOutEventTypes(step.With)
+		if err != nil {
+			continue
+		}
+		for _, eventType := range stepEventTypes {
+			if !strings.Contains(eventType, "{{") && !slices.Contains(eventTypes, eventType) {
+				eventTypes = append(eventTypes, eventType)
+			}
+		}
+	}
+	return eventTypes
+}
+
+// prefetchOnStart brings the repositories that subscribe to the events the workflow emits into
+// the cache in the background, cloning the missing ones and fetching the stale ones, so that its
+// fan-out steps do not wait for them. Close waits for the prefetch to finish.
+func (r *Runner) prefetchOnStart(ctx context.Context, workflow config.Workflow) {
+	eventTypes := emittedEventTypes(workflow.Steps)
+	if len(eventTypes) == 0 {
+		return
+	}
+	artifact := fmt.Sprintf("%s:default", r.getSourceRepository())
+
+	r.prefetches.Add(1)
+	go func() {
+		defer r.prefetches.Done()
+		r.prefetchSubscribers(ctx, artifact, eventTypes)
+	}()
+}
+
+// prefetchSubscribers clones or fetches the repositories subscribing to events of an artifact,
+// at the revision their subscriptions pin, at most maxConcurrentRepos at once. Repositories that
+// fail are left for the fan-out, which reports the failure.
+func (r *Runner) prefetchSubscribers(ctx context.Context, artifact string, eventTypes []string) {
+	// Stale clones are fetched first, so that the current subscriptions are discovered
+	r.gitManager.RefreshStale(ctx)
+
+	var subscribers []SubscriptionMatch
+	for _, eventType := range eventTypes {
+		discovered, err := r.orchestrator.DiscoverSubscriptions(ctx, artifact, eventType)
+		if err != nil {
+			slog.Debug("failed to discover subscribers to prefetch", "event", eventType, "error", err)
+			continue
+		}
+		subscribers = mergeSubscriptions(subscribers, discovered)
+	}
+
+	limit := r.maxConcurrentRepos
+	if limit <= 0 {
+		limit = 1
+	}
+	semaphore := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	prefetched := make(map[string]bool)
+	for _, subscriber := range subscribers {
+		var pinned config.PinnedRef
+		if subscriber.Subscription.Ref != "" {
+			var err error
+			if pinned, err = config.ParsePinnedRef(subscriber.Subscription.Ref); err != nil {
+				continue
+			}
+		}
+		key := subscriber.Repository + ":" + pinned.String()
+		if prefetched[key] {
+			continue
+		}
+		prefetched[key] = true
+
+		wg.Add(1)
+		go func(repository string, pinned config.PinnedRef) {
+			defer wg.Done()
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-ctx.Done():
+				return
+			}
+			if _, err := r.gitManager.ResolveCommit(ctx, repository, pinned); err != nil {
+				slog.Debug("failed to prefetch subscriber", "repository", repository, "error", err)
+			}
+		}(subscriber.Repository, pinned)
+	}
+	wg.Wait()
+}
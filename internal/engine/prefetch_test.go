@@ -0,0 +1,75 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestEmittedEventTypes(t *testing.T) {
+	steps := []config.WorkflowStep{
+		{ID: "build", Run: "make"},
+		{ID: "publish", Uses: "tako/fan-out@v1", With: map[string]interface{}{"event_type": "library_built"}},
+		{ID: "notify", Parallel: []config.WorkflowStep{
+			{Uses: "tako/fan-out@v1", With: map[string]interface{}{"event_type": "docs_built"}},
+			{Uses: "tako/fan-out@v1", With: map[string]interface{}{"event_type": "{{ .Inputs.event }}"}},
+		}},
+		{ID: "republish", Uses: "tako/fan-out@v1", With: map[string]interface{}{"event_type": "library_built"}},
+	}
+	if got, want := emittedEventTypes(steps), []string{"library_built", "docs_built"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("emittedEventTypes() = %v, want %v", got, want)
+	}
+}
+
+func TestRunnerPrefetchesSubscribers(t *testing.T) {
+	remotes := t.TempDir()
+	tempDir := t.TempDir()
+
+	// The app subscribes from its release branch, which is not cached yet
+	origin := createOriginRepository(t, remotes, "org", "app")
+	if err := os.WriteFile(filepath.Join(origin, "tako.yml"), []byte(`version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: org/lib:default
+    events: [library_built]
+    workflow: update
+    ref: release
+`), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	gitForTest(t, origin, "commit", "-am", "subscribe to the library")
+	gitForTest(t, origin, "branch", "release")
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot:      filepath.Join(tempDir, "workspace"),
+		CacheDir:           filepath.Join(tempDir, "cache"),
+		MaxConcurrentRepos: 2,
+		Git:                GitOptions{BaseURL: "file://" + remotes, Prefetch: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	if _, err := runner.gitManager.EnsureRepository(context.Background(), "org/app"); err != nil {
+		t.Fatalf("EnsureRepository() error = %v", err)
+	}
+
+	runner.repository = "org/lib"
+	runner.prefetchOnStart(context.Background(), config.Workflow{Steps: []config.WorkflowStep{
+		{ID: "build", Run: "make"},
+		{ID: "publish", Uses: "tako/fan-out@v1", With: map[string]interface{}{"event_type": "library_built"}},
+	}})
+	if err := runner.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "cache", "repos", "org", "app", "release", "tako.yml")); err != nil {
+		t.Errorf("expected the release branch of the subscriber to be prefetched: %v", err)
+	}
+}
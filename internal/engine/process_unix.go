@@ -0,0 +1,21 @@
+//go:build !windows
+
+package engine
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel runs cmd in its own process group and, when its context is
+// cancelled, kills the whole group so that processes spawned by a step do not outlive it.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// setCommandLine is a no-op outside Windows, where arguments are passed to processes as they
+// are.
+func setCommandLine(cmd *exec.Cmd, line string) {}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package engine
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroupOnCancel is a no-op on Windows, where only the step's own process is
+// killed when its context is cancelled.
+func killProcessGroupOnCancel(cmd *exec.Cmd) {}
+
+// setCommandLine passes cmd a raw command line instead of quoting its arguments, for programs
+// such as cmd.exe that parse their command line themselves.
+func setCommandLine(cmd *exec.Cmd, line string) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.CmdLine = line
+}
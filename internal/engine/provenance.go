@@ -0,0 +1,600 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// Types of the provenance of runs: in-toto statements of SLSA provenance, in DSSE envelopes
+// when signed with a key.
+const (
+	InTotoStatementType     = "https://in-toto.io/Statement/v1"
+	InTotoPayloadType       = "application/vnd.in-toto+json"
+	SLSAProvenancePredicate = "https://slsa.dev/provenance/v1"
+	ProvenanceBuildType     = "https://github.com/dangazineu/tako/workflow/v1"
+	ProvenanceBuilderID     = "https://github.com/dangazineu/tako/exec"
+)
+
+// Types of the triggers that start runs, in their provenance.
+const (
+	ProvenanceTriggerExec  = "tako exec" // A run started by tako exec, such as the root of an execution tree
+	ProvenanceTriggerEvent = "event"     // A child workflow a fan-out triggered with an event
+	ProvenanceTriggerCall  = "call"      // A workflow a step called
+)
+
+// contextKeyProvenanceTrigger carries the trigger of the child workflow a backend runs.
+const contextKeyProvenanceTrigger contextKey = "provenance_trigger"
+
+// Files of the provenance of a run in the provenance store, by their suffix after the run ID.
+const (
+	ProvenanceStatementFile = ".intoto.json"   // The in-toto statement
+	ProvenanceEnvelopeFile  = ".dsse.json"     // The DSSE envelope of the statement signed with a key
+	ProvenanceBundleFile    = ".sigstore.json" // The Sigstore bundle of the statement signed keylessly
+)
+
+// ProvenanceOptions configures the signing of the provenance of runs.
+type ProvenanceOptions struct {
+	// SigningKey is a PEM file of the PKCS #8 Ed25519 or ECDSA private key signing the
+	// provenance in a DSSE envelope; empty not to sign with a key
+	SigningKey string
+	// Keyless signs the provenance with Sigstore keyless signing, through cosign sign-blob, whose
+	// certificate binds the OIDC identity cosign obtains
+	Keyless bool
+	// Cosign is the cosign binary, "cosign" when empty
+	Cosign string
+	// BuilderVersion is the version of tako recorded in the provenance
+	BuilderVersion string
+}
+
+// ProvenanceStatement is the provenance of a run: an in-toto statement whose subjects are the
+// artifacts the run published and whose predicate is SLSA provenance.
+type ProvenanceStatement struct {
+	Type          string               `json:"_type"`
+	Subject       []ResourceDescriptor `json:"subject"`
+	PredicateType string               `json:"predicateType"`
+	Predicate     ProvenancePredicate  `json:"predicate"`
+}
+
+// ResourceDescriptor describes an artifact, a source repository or a byproduct of a run.
+type ResourceDescriptor struct {
+	Name        string            `json:"name,omitempty"`
+	URI         string            `json:"uri,omitempty"`
+	Digest      map[string]string `json:"digest,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ProvenancePredicate is the SLSA provenance of a run.
+type ProvenancePredicate struct {
+	BuildDefinition ProvenanceBuildDefinition `json:"buildDefinition"`
+	RunDetails      ProvenanceRunDetails      `json:"runDetails"`
+}
+
+// ProvenanceBuildDefinition is how a run was started, and the commits of the repositories of its
+// execution tree.
+type ProvenanceBuildDefinition struct {
+	BuildType            string               `json:"buildType"`
+	ExternalParameters   ProvenanceParameters `json:"externalParameters"`
+	InternalParameters   map[string]string    `json:"internalParameters,omitempty"`
+	ResolvedDependencies []ResourceDescriptor `json:"resolvedDependencies,omitempty"`
+}
+
+// ProvenanceParameters are the parameters a run was started with.
+type ProvenanceParameters struct {
+	Workflow   string            `json:"workflow"`
+	Repository string            `json:"repository"`
+	Inputs     map[string]string `json:"inputs,omitempty"`
+	Profile    string            `json:"profile,omitempty"`
+	// Trigger is what started the run: tako exec, the event of a fan-out or a calling step
+	Trigger ProvenanceTrigger `json:"trigger"`
+}
+
+// ProvenanceTrigger is what started a run: tako exec, the event a fan-out triggered the run with
+// or a step calling its workflow.
+type ProvenanceTrigger struct {
+	Type string `json:"type"` // ProvenanceTriggerExec, ProvenanceTriggerEvent or ProvenanceTriggerCall
+	// EventType, Source, EventID and Fingerprint identify the event of a fan-out: its type, the
+	// repository that emitted it, its ID and its fingerprint
+	EventType   string `json:"eventType,omitempty"`
+	Source      string `json:"source,omitempty"`
+	EventID     string `json:"eventId,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	FanOutID    string `json:"fanOutId,omitempty"`    // Fan-out that triggered the run
+	ParentRunID string `json:"parentRunId,omitempty"` // Run that triggered the run
+}
+
+// String describes the trigger, such as "event library_built from org/lib (id 42)".
+func (t ProvenanceTrigger) String() string {
+	if t.Type != ProvenanceTriggerEvent {
+		return t.Type
+	}
+	description := fmt.Sprintf("%s %s from %s", t.Type, t.EventType, t.Source)
+	if t.EventID != "" {
+		description += fmt.Sprintf(" (id %s)", t.EventID)
+	}
+	return description
+}
+
+// withProvenanceTrigger returns a context carrying the trigger of the child workflow run with it.
+func withProvenanceTrigger(ctx context.Context, trigger ProvenanceTrigger) context.Context {
+	return context.WithValue(ctx, contextKeyProvenanceTrigger, trigger)
+}
+
+// provenanceTriggerFromContext returns the trigger carried by a context, and whether it carries
+// one.
+func provenanceTriggerFromContext(ctx context.Context) (ProvenanceTrigger, bool) {
+	trigger, ok := ctx.Value(contextKeyProvenanceTrigger).(ProvenanceTrigger)
+	return trigger, ok
+}
+
+// ProvenanceRunDetails is who ran a run, when, and what it did: its steps, the events its
+// fan-outs emitted and the child workflows they triggered.
+type ProvenanceRunDetails struct {
+	Builder    ProvenanceBuilder    `json:"builder"`
+	Metadata   ProvenanceMetadata   `json:"metadata"`
+	Byproducts []ResourceDescriptor `json:"byproducts,omitempty"`
+}
+
+// ProvenanceBuilder identifies tako as the builder of a run.
+type ProvenanceBuilder struct {
+	ID      string            `json:"id"`
+	Version map[string]string `json:"version,omitempty"`
+}
+
+// ProvenanceMetadata identifies a run and tells when it ran.
+type ProvenanceMetadata struct {
+	InvocationID string    `json:"invocationId"`
+	StartedOn    time.Time `json:"startedOn"`
+	FinishedOn   time.Time `json:"finishedOn"`
+}
+
+// DSSEEnvelope is a Dead Simple Signing Envelope of a statement.
+type DSSEEnvelope struct {
+	PayloadType string          `json:"payloadType"`
+	Payload     string          `json:"payload"` // Base64 of the statement
+	Signatures  []DSSESignature `json:"signatures"`
+}
+
+// DSSESignature is a signature of a DSSE envelope. The key ID is the hex SHA-256 of the
+// PKIX encoding of the public key.
+type DSSESignature struct {
+	KeyID string `json:"keyid"`
+	Sig   string `json:"sig"`
+}
+
+// dssePAE returns the pre-authentication encoding of a DSSE payload, which is what is signed.
+func dssePAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
+
+// ParseProvenanceSigningKey parses a PEM PKCS #8 Ed25519 or ECDSA private key, or a PEM SEC 1
+// ECDSA private key.
+func ParseProvenanceSigningKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM private key found")
+	}
+	if block.Type == "EC PRIVATE KEY" {
+		return x509.ParseECPrivateKey(block.Bytes)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	switch key := key.(type) {
+	case ed25519.PrivateKey:
+		return key, nil
+	case *ecdsa.PrivateKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T: must be Ed25519 or ECDSA", key)
+	}
+}
+
+// provenanceKeyID returns the key ID of a public key in DSSE signatures.
+func provenanceKeyID(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode public key: %v", err)
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// SignProvenance signs a statement in a DSSE envelope.
+func SignProvenance(statement []byte, key crypto.Signer) (*DSSEEnvelope, error) {
+	keyID, err := provenanceKeyID(key.Public())
+	if err != nil {
+		return nil, err
+	}
+	message := dssePAE(InTotoPayloadType, statement)
+	var sig []byte
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		sig, err = key.Sign(rand.Reader, message, crypto.Hash(0))
+	} else {
+		digest := sha256.Sum256(message)
+		sig, err = key.Sign(rand.Reader, digest[:], crypto.SHA256)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign provenance: %v", err)
+	}
+	return &DSSEEnvelope{
+		PayloadType: InTotoPayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(statement),
+		Signatures:  []DSSESignature{{KeyID: keyID, Sig: base64.StdEncoding.EncodeToString(sig)}},
+	}, nil
+}
+
+// VerifyProvenance verifies that a DSSE envelope is signed by a PEM PKIX Ed25519 or ECDSA
+// public key, and returns the statement it carries.
+func VerifyProvenance(envelope *DSSEEnvelope, publicKeyPEM []byte) (*ProvenanceStatement, error) {
+	block, _ := pem.Decode(publicKeyPEM)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM public key found")
+	}
+	public, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key: %v", err)
+	}
+	keyID, err := provenanceKeyID(public)
+	if err != nil {
+		return nil, err
+	}
+	if envelope.PayloadType != InTotoPayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", envelope.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(envelope.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+
+	message := dssePAE(envelope.PayloadType, payload)
+	verified := false
+	for _, signature := range envelope.Signatures {
+		if signature.KeyID != "" && signature.KeyID != keyID {
+			continue
+		}
+		sig, err := base64.StdEncoding.DecodeString(signature.Sig)
+		if err != nil {
+			continue
+		}
+		switch public := public.(type) {
+		case ed25519.PublicKey:
+			verified = ed25519.Verify(public, message, sig)
+		case *ecdsa.PublicKey:
+			digest := sha256.Sum256(message)
+			verified = ecdsa.VerifyASN1(public, digest[:], sig)
+		default:
+			return nil, fmt.Errorf("unsupported public key type %T: must be Ed25519 or ECDSA", public)
+		}
+		if verified {
+			break
+		}
+	}
+	if !verified {
+		return nil, fmt.Errorf("no valid signature of key %s", keyID)
+	}
+
+	var statement ProvenanceStatement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("failed to parse statement: %v", err)
+	}
+	if statement.Type != InTotoStatementType || statement.PredicateType != SLSAProvenancePredicate {
+		return nil, fmt.Errorf("unexpected statement type %q with predicate %q", statement.Type, statement.PredicateType)
+	}
+	return &statement, nil
+}
+
+// ProvenanceStore is the append-only store of the provenance of runs, in the cache. Files are
+// created once, read-only, and never replaced.
+type ProvenanceStore struct {
+	dir string
+}
+
+// NewProvenanceStore creates the provenance store of a cache directory.
+func NewProvenanceStore(cacheDir string) (*ProvenanceStore, error) {
+	dir := filepath.Join(cacheDir, "provenance")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create provenance directory: %v", err)
+	}
+	return &ProvenanceStore{dir: dir}, nil
+}
+
+// Path returns the path of a provenance file of a run, by its suffix.
+func (s *ProvenanceStore) Path(runID, suffix string) (string, error) {
+	if runID == "" || runID == "." || runID == ".." || strings.ContainsAny(runID, `/\`) {
+		return "", fmt.Errorf("invalid run ID %q", runID)
+	}
+	return filepath.Join(s.dir, runID+suffix), nil
+}
+
+// write creates a provenance file of a run, failing when it already exists.
+func (s *ProvenanceStore) write(runID, suffix string, data []byte) (string, error) {
+	path, err := s.Path(runID, suffix)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0444)
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("provenance %s already exists", path)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create provenance: %v", err)
+	}
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to write provenance: %v", err)
+	}
+	return path, nil
+}
+
+// Statement reads the statement of the provenance of a run.
+func (s *ProvenanceStore) Statement(runID string) (*ProvenanceStatement, error) {
+	path, err := s.Path(runID, ProvenanceStatementFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no provenance found for run %s", runID)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provenance: %v", err)
+	}
+	var statement ProvenanceStatement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, fmt.Errorf("failed to parse provenance %s: %v", path, err)
+	}
+	return &statement, nil
+}
+
+// Envelope reads the DSSE envelope of the provenance of a run.
+func (s *ProvenanceStore) Envelope(runID string) (*DSSEEnvelope, error) {
+	path, err := s.Path(runID, ProvenanceEnvelopeFile)
+	if err != nil {
+		return nil, err
+	}
+	return LoadDSSEEnvelope(path)
+}
+
+// Verify verifies the signed provenance of a run with a PEM public key: the signature of its
+// DSSE envelope, and that the envelope carries the statement of the store.
+func (s *ProvenanceStore) Verify(runID string, publicKeyPEM []byte) (*ProvenanceStatement, error) {
+	envelope, err := s.Envelope(runID)
+	if err != nil {
+		return nil, err
+	}
+	statement, err := VerifyProvenance(envelope, publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("provenance of run %s: %v", runID, err)
+	}
+	path, err := s.Path(runID, ProvenanceStatementFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provenance: %v", err)
+	}
+	payload, _ := base64.StdEncoding.DecodeString(envelope.Payload) // Decoded by VerifyProvenance
+	if !bytes.Equal(bytes.TrimSpace(data), bytes.TrimSpace(payload)) {
+		return nil, fmt.Errorf("provenance %s does not match its signed envelope", path)
+	}
+	return statement, nil
+}
+
+// LoadDSSEEnvelope reads a DSSE envelope.
+func LoadDSSEEnvelope(path string) (*DSSEEnvelope, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no signed provenance found at %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read provenance: %v", err)
+	}
+	var envelope DSSEEnvelope
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse provenance envelope %s: %v", path, err)
+	}
+	return &envelope, nil
+}
+
+// newProvenanceStatement returns the provenance of a finished run: the artifacts it published
+// as subjects, how it was started and by what, the commits of its execution tree, and its steps, the events
+// its fan-outs emitted and the child workflows they triggered, recursively.
+func (r *Runner) newProvenanceStatement(workflowName, repoPath string, inputs map[string]string, startTime, endTime time.Time, steps []StepResult, children []interfaces.ChildResult, lock *Lockfile, runErr error) *ProvenanceStatement {
+	statement := &ProvenanceStatement{
+		Type:          InTotoStatementType,
+		Subject:       make([]ResourceDescriptor, 0),
+		PredicateType: SLSAProvenancePredicate,
+	}
+
+	r.publishMu.Lock()
+	for _, name := range sortedKeys(r.publishedArtifacts) {
+		published := r.publishedArtifacts[name]
+		algorithm, digest, _ := strings.Cut(published.Digest, ":")
+		statement.Subject = append(statement.Subject, ResourceDescriptor{
+			Name:   name,
+			URI:    published.Reference,
+			Digest: map[string]string{algorithm: digest},
+		})
+	}
+	r.publishMu.Unlock()
+
+	repository := r.repository
+	if repository == "" {
+		repository = r.getRepositoryNameFromPath(repoPath)
+	}
+	trigger := r.trigger
+	if trigger.Type == "" {
+		trigger.Type = ProvenanceTriggerExec
+	}
+	trigger.ParentRunID = r.parentRunID
+	definition := &statement.Predicate.BuildDefinition
+	definition.BuildType = ProvenanceBuildType
+	definition.ExternalParameters = ProvenanceParameters{
+		Workflow:   workflowName,
+		Repository: repository,
+		Inputs:     inputs,
+		Profile:    r.profile,
+		Trigger:    trigger,
+	}
+	definition.InternalParameters = map[string]string{
+		"correlation_id": r.correlationID,
+		"status":         historyStatus(runErr),
+	}
+	if r.namespace != "" {
+		definition.InternalParameters["namespace"] = r.namespace
+	}
+	for _, locked := range lock.Repositories {
+		dependency := ResourceDescriptor{
+			Name:   locked.Repository,
+			Digest: map[string]string{"gitCommit": locked.Commit},
+		}
+		if owner, repo, ok := strings.Cut(locked.Repository, "/"); ok && !strings.Contains(repo, "/") {
+			dependency.URI = "git+" + r.gitManager.CloneURL(owner, repo) + "@" + locked.Ref
+		}
+		if locked.Root {
+			dependency.Annotations = map[string]string{"root": "true"}
+		}
+		definition.ResolvedDependencies = append(definition.ResolvedDependencies, dependency)
+	}
+
+	details := &statement.Predicate.RunDetails
+	details.Builder = ProvenanceBuilder{ID: ProvenanceBuilderID}
+	if r.provenance.BuilderVersion != "" {
+		details.Builder.Version = map[string]string{"tako": r.provenance.BuilderVersion}
+	}
+	details.Metadata = ProvenanceMetadata{InvocationID: r.runID, StartedOn: startTime.UTC(), FinishedOn: endTime.UTC()}
+	for _, step := range newHistorySteps(steps) {
+		details.Byproducts = append(details.Byproducts, ResourceDescriptor{
+			Name:        "step:" + step.ID,
+			Annotations: map[string]string{"status": step.Status, "duration": step.Duration.String()},
+		})
+	}
+	r.childMu.Lock()
+	for _, step := range steps {
+		for _, eventType := range r.emittedEvents[step.ID] {
+			details.Byproducts = append(details.Byproducts, ResourceDescriptor{
+				Name:        "event:" + eventType,
+				Annotations: map[string]string{"step": step.ID, "source": repository},
+			})
+		}
+	}
+	r.childMu.Unlock()
+	details.Byproducts = appendProvenanceChildren(details.Byproducts, r.runID, children)
+	return statement
+}
+
+// appendProvenanceChildren appends the child workflows triggered by a run, and theirs, to the
+// byproducts of its provenance.
+func appendProvenanceChildren(byproducts []ResourceDescriptor, parentRunID string, children []interfaces.ChildResult) []ResourceDescriptor {
+	for _, child := range children {
+		annotations := map[string]string{"status": child.Status, "parent_run_id": parentRunID, "step": child.StepID}
+		if child.RunID != "" {
+			annotations["run_id"] = child.RunID
+		}
+		byproducts = append(byproducts, ResourceDescriptor{
+			Name:        "workflow:" + child.Repository + ":" + child.Workflow,
+			Annotations: annotations,
+		})
+		if child.Result != nil {
+			byproducts = appendProvenanceChildren(byproducts, child.RunID, child.Result.Children)
+		}
+	}
+	return byproducts
+}
+
+// writeProvenance writes the provenance of the run to the provenance store, signed with the
+// signing key and keylessly as configured. Failures are logged: the run already finished.
+func (r *Runner) writeProvenance(ctx context.Context, statement *ProvenanceStatement) {
+	r.provenancePath = ""
+	store, err := NewProvenanceStore(r.cacheDir)
+	if err != nil {
+		slog.Warn("failed to write provenance", "run_id", r.runID, "error", err)
+		return
+	}
+	data, err := json.MarshalIndent(statement, "", "  ")
+	if err != nil {
+		slog.Warn("failed to encode provenance", "run_id", r.runID, "error", err)
+		return
+	}
+	path, err := store.write(r.runID, ProvenanceStatementFile, data)
+	if err != nil {
+		slog.Warn("failed to write provenance", "run_id", r.runID, "error", err)
+		return
+	}
+	r.provenancePath = path
+
+	if r.provenanceKey != nil {
+		envelope, err := SignProvenance(data, r.provenanceKey)
+		if err == nil {
+			var signed []byte
+			if signed, err = json.MarshalIndent(envelope, "", "  "); err == nil {
+				_, err = store.write(r.runID, ProvenanceEnvelopeFile, signed)
+			}
+		}
+		if err != nil {
+			slog.Warn("failed to sign provenance", "run_id", r.runID, "error", err)
+		}
+	}
+	if r.provenance.Keyless {
+		if err := r.signProvenanceKeyless(ctx, store, path); err != nil {
+			slog.Warn("failed to sign provenance keylessly", "run_id", r.runID, "error", err)
+		}
+	}
+}
+
+// signProvenanceKeyless signs the statement of the provenance of the run with cosign sign-blob,
+// which writes the Sigstore bundle of the signature, its certificate and its transparency log
+// entry next to the statement. cosign verify-blob --bundle verifies it.
+func (r *Runner) signProvenanceKeyless(ctx context.Context, store *ProvenanceStore, statementPath string) error {
+	bundle, err := store.Path(r.runID, ProvenanceBundleFile)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(bundle); err == nil {
+		return fmt.Errorf("provenance %s already exists", bundle)
+	}
+	cosign := r.provenance.Cosign
+	if cosign == "" {
+		cosign = "cosign"
+	}
+	cmd := exec.CommandContext(ctx, cosign, "sign-blob", "--yes", "--bundle", bundle, statementPath)
+	cmd.Env = r.getEnvironment()
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("cosign sign-blob failed: %v: %s", err, strings.TrimSpace(output.String()))
+	}
+	return nil
+}
+
+// ProvenancePath returns the file the provenance statement of the last run was written to;
+// empty when none was.
+func (r *Runner) ProvenancePath() string {
+	return r.provenancePath
+}
@@ -0,0 +1,262 @@
+package engine
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeProvenanceKeys writes a PEM PKCS #8 private key and its PEM PKIX public key, and returns
+// their paths.
+func writeProvenanceKeys(t *testing.T, dir string, key crypto.Signer) (string, string) {
+	t.Helper()
+	private, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to encode private key: %v", err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+	privatePath := filepath.Join(dir, "provenance.key")
+	publicPath := filepath.Join(dir, "provenance.pub")
+	if err := os.WriteFile(privatePath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: private}), 0600); err != nil {
+		t.Fatalf("failed to write private key: %v", err)
+	}
+	if err := os.WriteFile(publicPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public}), 0644); err != nil {
+		t.Fatalf("failed to write public key: %v", err)
+	}
+	return privatePath, publicPath
+}
+
+func TestSignProvenance(t *testing.T) {
+	_, ed25519Key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	_, otherPublic := writeProvenanceKeys(t, t.TempDir(), otherKey)
+	otherPEM, _ := os.ReadFile(otherPublic)
+
+	statement := []byte(`{"_type":"` + InTotoStatementType + `","subject":[],"predicateType":"` + SLSAProvenancePredicate + `","predicate":{}}`)
+	for name, key := range map[string]crypto.Signer{"ed25519": ed25519Key, "ecdsa": ecdsaKey} {
+		t.Run(name, func(t *testing.T) {
+			privatePath, publicPath := writeProvenanceKeys(t, t.TempDir(), key)
+			privatePEM, _ := os.ReadFile(privatePath)
+			publicPEM, _ := os.ReadFile(publicPath)
+			signer, err := ParseProvenanceSigningKey(privatePEM)
+			if err != nil {
+				t.Fatalf("ParseProvenanceSigningKey() error = %v", err)
+			}
+
+			envelope, err := SignProvenance(statement, signer)
+			if err != nil {
+				t.Fatalf("SignProvenance() error = %v", err)
+			}
+			if _, err := VerifyProvenance(envelope, publicPEM); err != nil {
+				t.Errorf("VerifyProvenance() error = %v", err)
+			}
+			if _, err := VerifyProvenance(envelope, otherPEM); err == nil || !strings.Contains(err.Error(), "no valid signature") {
+				t.Errorf("expected the signature of another key to be rejected, got %v", err)
+			}
+
+			tampered := *envelope
+			tampered.Payload = base64.StdEncoding.EncodeToString([]byte(strings.Replace(string(statement), `"subject":[]`, `"subject":[{"name":"x"}]`, 1)))
+			if _, err := VerifyProvenance(&tampered, publicPEM); err == nil {
+				t.Error("expected a modified statement to be rejected")
+			}
+		})
+	}
+
+	if _, err := ParseProvenanceSigningKey([]byte("not a key")); err == nil {
+		t.Error("expected an invalid key to be rejected")
+	}
+}
+
+// fakeCosign is a cosign that writes the blob it signs as its bundle.
+const fakeCosign = `#!/bin/sh
+[ "$1" = sign-blob ] && [ "$2" = --yes ] && [ "$3" = --bundle ] || exit 1
+cp "$5" "$4"
+`
+
+func TestRunnerWritesProvenance(t *testing.T) {
+	tempDir := t.TempDir()
+	repoDir := filepath.Join(tempDir, "repo")
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("failed to create repository: %v", err)
+	}
+	takoYml := `version: 0.1.0
+workflows:
+  build:
+    inputs:
+      version:
+        type: string
+    steps:
+      - id: compile
+        run: echo compiled {{ .Inputs.version }}
+`
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("failed to write tako.yml: %v", err)
+	}
+	gitForTest(t, repoDir, "init", "-b", "main")
+	gitForTest(t, repoDir, "add", ".")
+	gitForTest(t, repoDir, "commit", "-m", "initial commit")
+	commit := gitForTest(t, repoDir, "rev-parse", "HEAD")
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	privatePath, publicPath := writeProvenanceKeys(t, tempDir, key)
+	cosign := filepath.Join(tempDir, "cosign")
+	if err := os.WriteFile(cosign, []byte(fakeCosign), 0755); err != nil {
+		t.Fatalf("failed to write fake cosign: %v", err)
+	}
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      cacheDir,
+		Provenance:    ProvenanceOptions{SigningKey: privatePath, Keyless: true, Cosign: cosign, BuilderVersion: "v1.2.3"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if _, err := runner.ExecuteWorkflow(context.Background(), "build", map[string]string{"version": "1.0"}, repoDir); err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+
+	store, err := NewProvenanceStore(cacheDir)
+	if err != nil {
+		t.Fatalf("NewProvenanceStore() error = %v", err)
+	}
+	if want, _ := store.Path(runner.runID, ProvenanceStatementFile); runner.ProvenancePath() != want {
+		t.Errorf("expected the provenance at %s, got %q", want, runner.ProvenancePath())
+	}
+	publicPEM, _ := os.ReadFile(publicPath)
+	statement, err := store.Verify(runner.runID, publicPEM)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+
+	definition := statement.Predicate.BuildDefinition
+	if definition.ExternalParameters.Workflow != "build" || definition.ExternalParameters.Inputs["version"] != "1.0" || definition.InternalParameters["status"] != HistoryStatusCompleted {
+		t.Errorf("unexpected build definition: %+v", definition)
+	}
+	if len(definition.ResolvedDependencies) != 1 || definition.ResolvedDependencies[0].Digest["gitCommit"] != commit {
+		t.Errorf("expected the commit of the repository to be resolved, got %+v", definition.ResolvedDependencies)
+	}
+	details := statement.Predicate.RunDetails
+	if details.Builder.Version["tako"] != "v1.2.3" || details.Metadata.InvocationID != runner.runID {
+		t.Errorf("unexpected run details: %+v", details)
+	}
+	if len(details.Byproducts) != 1 || details.Byproducts[0].Name != "step:compile" || details.Byproducts[0].Annotations["status"] != HistoryStepSucceeded {
+		t.Errorf("expected the step in the byproducts, got %+v", details.Byproducts)
+	}
+
+	// The keyless signature is written next to the statement
+	bundle, _ := store.Path(runner.runID, ProvenanceBundleFile)
+	if _, err := os.Stat(bundle); err != nil {
+		t.Errorf("expected the Sigstore bundle: %v", err)
+	}
+
+	// The store is append-only
+	if _, err := store.write(runner.runID, ProvenanceStatementFile, []byte("{}")); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected the provenance not to be replaced, got %v", err)
+	}
+}
+
+func TestProvenanceOfExecutionTree(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+`)
+
+	result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+	store, err := NewProvenanceStore(runner.cacheDir)
+	if err != nil {
+		t.Fatalf("NewProvenanceStore() error = %v", err)
+	}
+	statement, err := store.Statement(result.RunID)
+	if err != nil {
+		t.Fatalf("Statement() error = %v", err)
+	}
+
+	// The events of the fan-outs and the children they triggered are byproducts of the run
+	byproducts := make(map[string]map[string]string)
+	for _, byproduct := range statement.Predicate.RunDetails.Byproducts {
+		byproducts[byproduct.Name] = byproduct.Annotations
+	}
+	if event := byproducts["event:library_built"]; event["step"] != "publish" || event["source"] != "test-org/lib" {
+		t.Errorf("expected the emitted event, got %+v", statement.Predicate.RunDetails.Byproducts)
+	}
+	if child := byproducts["workflow:test-org/app:update"]; child["parent_run_id"] != result.RunID || child["status"] != string(ChildStatusCompleted) || child["run_id"] == "" {
+		t.Errorf("expected the child workflow, got %+v", statement.Predicate.RunDetails.Byproducts)
+	}
+	parameters := statement.Predicate.BuildDefinition.ExternalParameters
+	if parameters.Repository != "test-org/lib" || parameters.Trigger.Type != ProvenanceTriggerExec {
+		t.Errorf("unexpected parameters: %+v", parameters)
+	}
+
+	// The child writes its own provenance, recording the event that triggered it
+	childStatement, err := store.Statement(byproducts["workflow:test-org/app:update"]["run_id"])
+	if err != nil {
+		t.Fatalf("expected the provenance of the child: %v", err)
+	}
+	trigger := childStatement.Predicate.BuildDefinition.ExternalParameters.Trigger
+	if trigger.Type != ProvenanceTriggerEvent || trigger.EventType != "library_built" || trigger.Source != "test-org/lib" || trigger.EventID == "" || trigger.Fingerprint == "" || trigger.FanOutID == "" || trigger.ParentRunID != result.RunID {
+		t.Errorf("expected the trigger of the child to be the event of the fan-out, got %+v", trigger)
+	}
+	if got := childStatement.Predicate.BuildDefinition.ExternalParameters.Workflow; got != "update" {
+		t.Errorf("expected the provenance of the update workflow, got %s", got)
+	}
+}
@@ -0,0 +1,649 @@
+package engine
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// Payload field in which fan-outs tell subscribers the artifacts the emitting workflow published.
+const PayloadArtifacts = "artifacts"
+
+// Media types of the OCI artifacts tako pushes: an empty config, and the artifact as a single
+// gzipped tar layer.
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+	ociArtifactType      = "application/vnd.tako.artifact.v1"
+	ociEmptyMediaType    = "application/vnd.oci.empty.v1+json"
+	ociLayerMediaType    = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociEmptyDigest       = "sha256:44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+)
+
+// PublishedArtifact is an artifact a tako/publish-artifact@v1 step pushed to a registry.
+type PublishedArtifact struct {
+	// Digest is the content digest subscribers pull the artifact by: that of the OCI manifest, or
+	// that of the archive uploaded to S3.
+	Digest string `yaml:"digest" json:"digest"`
+	// Reference locates the artifact by its digest: host/repository@digest, or s3://bucket/key.
+	Reference string `yaml:"reference" json:"reference"`
+}
+
+// artifactArchive is the gzipped tar archive of an artifact, in a temporary file.
+type artifactArchive struct {
+	path   string
+	digest string // Hex sha256 of the archive
+	size   int64
+}
+
+// archiveArtifact archives the file or directory of an artifact, skipping .git directories. The
+// archive is reproducible: entries are sorted and their times and owners are cleared, so that
+// unchanged artifacts keep their digest.
+func archiveArtifact(root string) (*artifactArchive, error) {
+	if _, err := os.Stat(root); err != nil {
+		return nil, fmt.Errorf("failed to read artifact: %v", err)
+	}
+	tmp, err := os.CreateTemp("", "tako-artifact-*.tar.gz")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %v", err)
+	}
+	archive := &artifactArchive{path: tmp.Name()}
+	hash := sha256.New()
+	gz := gzip.NewWriter(io.MultiWriter(tmp, hash))
+	tw := tar.NewWriter(gz)
+
+	err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			if entry.IsDir() {
+				return nil
+			}
+			rel = entry.Name() // The artifact is a single file
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if entry.IsDir() {
+			header.Name += "/"
+		}
+		header.ModTime = time.Unix(0, 0)
+		header.AccessTime, header.ChangeTime = time.Time{}, time.Time{}
+		header.Uid, header.Gid, header.Uname, header.Gname = 0, 0, "", ""
+		header.Format = tar.FormatPAX
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err == nil {
+		err = tw.Close()
+	}
+	if err == nil {
+		err = gz.Close()
+	}
+	if err == nil {
+		archive.size, err = tmp.Seek(0, io.SeekCurrent)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(archive.path)
+		return nil, fmt.Errorf("failed to archive artifact: %v", err)
+	}
+	archive.digest = hex.EncodeToString(hash.Sum(nil))
+	return archive, nil
+}
+
+// ociClient pushes artifacts to a repository of an OCI distribution registry, authenticating
+// with basic credentials or with the bearer tokens the registry challenges for.
+type ociClient struct {
+	client   *http.Client
+	baseURL  string // scheme://host of the registry
+	host     string
+	name     string // Repository name within the registry
+	username string
+	password string
+	token    string // Bearer token, once the registry challenged for one
+}
+
+// newOCIClient creates a client of an OCI repository such as ghcr.io/my-org/go-lib.
+func newOCIClient(repository string, insecure bool, username, password string) *ociClient {
+	host, name, _ := strings.Cut(repository, "/")
+	scheme := "https"
+	if insecure {
+		scheme = "http"
+	}
+	return &ociClient{
+		client:   http.DefaultClient,
+		baseURL:  scheme + "://" + host,
+		host:     host,
+		name:     name,
+		username: username,
+		password: password,
+	}
+}
+
+// push pushes the archive as the single layer of an artifact manifest tagged tag, and returns
+// the artifact by the digest of its manifest.
+func (c *ociClient) push(ctx context.Context, archive *artifactArchive, title, tag string) (*PublishedArtifact, error) {
+	layerDigest := "sha256:" + archive.digest
+	err := c.pushBlob(ctx, layerDigest, archive.size, func() (io.ReadCloser, error) {
+		return os.Open(archive.path)
+	})
+	if err != nil {
+		return nil, err
+	}
+	emptyConfig := []byte("{}")
+	err = c.pushBlob(ctx, ociEmptyDigest, int64(len(emptyConfig)), func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(emptyConfig)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	manifest, err := json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     ociManifestMediaType,
+		"artifactType":  ociArtifactType,
+		"config": map[string]interface{}{
+			"mediaType": ociEmptyMediaType,
+			"digest":    ociEmptyDigest,
+			"size":      len(emptyConfig),
+		},
+		"layers": []map[string]interface{}{{
+			"mediaType":   ociLayerMediaType,
+			"digest":      layerDigest,
+			"size":        archive.size,
+			"annotations": map[string]string{"org.opencontainers.image.title": title},
+		}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %v", err)
+	}
+	sum := sha256.Sum256(manifest)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	resp, err := c.do(ctx, http.MethodPut, c.url("manifests/"+tag), ociManifestMediaType, int64(len(manifest)), func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(manifest)), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to push manifest: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, fmt.Errorf("failed to push manifest: %s", resp.Status)
+	}
+	return &PublishedArtifact{Digest: digest, Reference: c.host + "/" + c.name + "@" + digest}, nil
+}
+
+// pushBlob uploads a blob in a single request, unless the repository already has it.
+func (c *ociClient) pushBlob(ctx context.Context, digest string, size int64, body func() (io.ReadCloser, error)) error {
+	resp, err := c.do(ctx, http.MethodHead, c.url("blobs/"+digest), "", 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to check blob %s: %v", digest, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	resp, err = c.do(ctx, http.MethodPost, c.url("blobs/uploads/"), "", 0, nil)
+	if err != nil {
+		return fmt.Errorf("failed to start upload of blob %s: %v", digest, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("failed to start upload of blob %s: %s", digest, resp.Status)
+	}
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("failed to start upload of blob %s: invalid upload location '%s'", digest, resp.Header.Get("Location"))
+	}
+	base, _ := url.Parse(c.baseURL + "/")
+	upload := base.ResolveReference(location)
+	query := upload.Query()
+	query.Set("digest", digest)
+	upload.RawQuery = query.Encode()
+
+	resp, err = c.do(ctx, http.MethodPut, upload.String(), "application/octet-stream", size, body)
+	if err != nil {
+		return fmt.Errorf("failed to upload blob %s: %v", digest, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("failed to upload blob %s: %s", digest, resp.Status)
+	}
+	return nil
+}
+
+// url returns the URL of a path of the repository's API.
+func (c *ociClient) url(p string) string {
+	return c.baseURL + "/v2/" + c.name + "/" + p
+}
+
+// do sends a request to the registry. When the registry challenges it for a bearer token, the
+// token is fetched and the request sent again.
+func (c *ociClient) do(ctx context.Context, method, target, contentType string, size int64, body func() (io.ReadCloser, error)) (*http.Response, error) {
+	send := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, method, target, nil)
+		if err != nil {
+			return nil, err
+		}
+		if body != nil {
+			if req.Body, err = body(); err != nil {
+				return nil, err
+			}
+			req.ContentLength = size
+			req.Header.Set("Content-Type", contentType)
+		}
+		switch {
+		case c.token != "":
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		case c.username != "":
+			req.SetBasicAuth(c.username, c.password)
+		}
+		return c.client.Do(req)
+	}
+
+	resp, err := send()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || c.token != "" {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := c.authenticate(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return send()
+}
+
+// authenticate fetches a bearer token from the realm of the registry's challenge.
+func (c *ociClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return fmt.Errorf("registry requires unsupported authentication '%s'", challenge)
+	}
+	attributes := parseAuthChallenge(params)
+	realm, err := url.Parse(attributes["realm"])
+	if err != nil || attributes["realm"] == "" {
+		return fmt.Errorf("registry challenged with invalid realm '%s'", attributes["realm"])
+	}
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if value := attributes[key]; value != "" {
+			query.Set(key, value)
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to fetch registry token: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch registry token: %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return fmt.Errorf("failed to decode registry token: %v", err)
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return fmt.Errorf("registry returned no token")
+	}
+	return nil
+}
+
+// parseAuthChallenge parses the comma-separated key="value" attributes of a WWW-Authenticate
+// challenge.
+func parseAuthChallenge(params string) map[string]string {
+	attributes := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, ", "), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		attributes[strings.ToLower(strings.TrimSpace(key))] = value
+		params = rest
+	}
+	return attributes
+}
+
+// s3Uploader uploads artifacts to an S3 bucket, signing its requests with AWS Signature
+// Version 4.
+type s3Uploader struct {
+	client          *http.Client
+	bucket          string
+	region          string
+	endpoint        string // URL of an S3-compatible object store; empty for AWS
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+}
+
+// upload uploads the archive under a key made of its digest, and returns the artifact by it.
+func (u *s3Uploader) upload(ctx context.Context, archive *artifactArchive, key string) (*PublishedArtifact, error) {
+	target := "https://" + u.bucket + ".s3." + u.region + ".amazonaws.com/" + s3EncodePath(key)
+	if u.endpoint != "" {
+		target = strings.TrimSuffix(u.endpoint, "/") + "/" + s3EncodePath(u.bucket+"/"+key)
+	}
+	file, err := os.Open(archive.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read archive: %v", err)
+	}
+	defer file.Close()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, file)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = archive.size
+	req.Header.Set("Content-Type", "application/gzip")
+	if u.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.sessionToken)
+	}
+	signS3Request(req, archive.digest, u.accessKeyID, u.secretAccessKey, u.region, time.Now())
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload to bucket %s: %v", u.bucket, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("failed to upload to bucket %s: %s: %s", u.bucket, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	return &PublishedArtifact{Digest: "sha256:" + archive.digest, Reference: "s3://" + u.bucket + "/" + key}, nil
+}
+
+// signS3Request signs a request to S3 with AWS Signature Version 4, covering its host and all
+// its headers. payloadHash is the hex sha256 of the request body.
+func signS3Request(req *http.Request, payloadHash, accessKeyID, secretAccessKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := sortedKeys(headers)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := req.URL.Query()
+	queryKeys := sortedKeys(query)
+	queryParts := make([]string, 0, len(queryKeys))
+	for _, key := range queryKeys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			queryParts = append(queryParts, s3Encode(key)+"="+s3Encode(value))
+		}
+	}
+	canonicalPath := req.URL.EscapedPath()
+	if canonicalPath == "" {
+		canonicalPath = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath,
+		strings.Join(queryParts, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretAccessKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", accessKeyID, scope, signedHeaders, signature))
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Encode percent-encodes a string as AWS Signature Version 4 requires: everything but the
+// unreserved characters of RFC 3986.
+func s3Encode(s string) string {
+	var encoded strings.Builder
+	for _, b := range []byte(s) {
+		if ('A' <= b && b <= 'Z') || ('a' <= b && b <= 'z') || ('0' <= b && b <= '9') || strings.IndexByte("-_.~", b) >= 0 {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+// s3EncodePath percent-encodes each segment of a slash-separated object path.
+func s3EncodePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		segments[i] = s3Encode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// executePublishArtifactStep archives an artifact of the repository and pushes it to the OCI
+// registry or S3 bucket of the step. The step outputs the digest and reference of the artifact,
+// which the run's fan-outs add to the payloads of their events.
+func (r *Runner) executePublishArtifactStep(ctx context.Context, step config.WorkflowStep, stepID string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
+	fail := func(err error) (StepResult, error) {
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
+	params, err := config.ParsePublishArtifactParams(step.With)
+	if err != nil {
+		return fail(err)
+	}
+	artifactPath, ok := r.artifactPaths[params.Artifact]
+	if !ok {
+		return fail(fmt.Errorf("artifact '%s' is not declared", params.Artifact))
+	}
+	environment := r.getEnvironment()
+	lookup := func(field, name string) (string, error) {
+		value, ok := lookupEnvironment(environment, name)
+		if !ok || value == "" {
+			return "", fmt.Errorf("%s %s is not set", field, name)
+		}
+		return value, nil
+	}
+
+	archive, err := archiveArtifact(artifactPath)
+	if err != nil {
+		return fail(err)
+	}
+	defer os.Remove(archive.path)
+
+	var published *PublishedArtifact
+	switch params.Registry {
+	case config.RegistryOCI:
+		tag := params.Tag
+		if tag == "" {
+			tag = "latest"
+		}
+		if tag, err = r.expandTemplate(tag, inputs, stepOutputs); err != nil {
+			return fail(fmt.Errorf("failed to expand tag: %v", err))
+		}
+		var username, password string
+		if params.UsernameEnv != "" {
+			if username, err = lookup("username_env", params.UsernameEnv); err != nil {
+				return fail(err)
+			}
+			if password, err = lookup("password_env", params.PasswordEnv); err != nil {
+				return fail(err)
+			}
+		}
+		client := newOCIClient(params.Repository, params.Insecure, username, password)
+		published, err = client.push(ctx, archive, params.Artifact+".tar.gz", tag)
+	case config.RegistryS3:
+		uploader := &s3Uploader{
+			client:   http.DefaultClient,
+			bucket:   params.Bucket,
+			region:   params.Region,
+			endpoint: params.Endpoint,
+		}
+		if uploader.region == "" {
+			uploader.region = "us-east-1"
+		}
+		accessKeyIDEnv, secretAccessKeyEnv := params.AccessKeyIDEnv, params.SecretAccessKeyEnv
+		if accessKeyIDEnv == "" {
+			accessKeyIDEnv = "AWS_ACCESS_KEY_ID"
+		}
+		if secretAccessKeyEnv == "" {
+			secretAccessKeyEnv = "AWS_SECRET_ACCESS_KEY"
+		}
+		if uploader.accessKeyID, err = lookup("access_key_id_env", accessKeyIDEnv); err != nil {
+			return fail(err)
+		}
+		if uploader.secretAccessKey, err = lookup("secret_access_key_env", secretAccessKeyEnv); err != nil {
+			return fail(err)
+		}
+		uploader.sessionToken, _ = lookupEnvironment(environment, "AWS_SESSION_TOKEN")
+		key := path.Join(params.Prefix, params.Artifact, "sha256", archive.digest+".tar.gz")
+		published, err = uploader.upload(ctx, archive, key)
+	}
+	if err != nil {
+		return fail(fmt.Errorf("failed to publish artifact '%s': %w", params.Artifact, err))
+	}
+
+	r.publishMu.Lock()
+	if r.publishedArtifacts == nil {
+		r.publishedArtifacts = make(map[string]PublishedArtifact)
+	}
+	r.publishedArtifacts[params.Artifact] = *published
+	r.publishMu.Unlock()
+
+	outputs := map[string]string{"digest": published.Digest, "reference": published.Reference}
+	output := fmt.Sprintf("Published %s as %s", params.Artifact, published.Reference)
+	r.state.CompleteStep(stepID, output, outputs)
+	return StepResult{
+		ID:        stepID,
+		Success:   true,
+		StartTime: startTime,
+		EndTime:   r.now(),
+		Output:    output,
+		Outputs:   outputs,
+	}, nil
+}
+
+// addPublishedArtifacts returns the fan-out step with the artifacts the run published so far,
+// so that subscribers can pull exactly what was built: they are added to the artifacts of the
+// fan-out, and the digest of a single published artifact becomes its artifact_digest. Artifacts
+// and digests the step sets itself are kept.
+func (r *Runner) addPublishedArtifacts(step config.WorkflowStep) config.WorkflowStep {
+	r.publishMu.Lock()
+	defer r.publishMu.Unlock()
+	if len(r.publishedArtifacts) == 0 {
+		return step
+	}
+
+	with := make(map[string]interface{}, len(step.With)+2)
+	for key, value := range step.With {
+		with[key] = value
+	}
+	if _, ok := with["artifacts"]; !ok {
+		artifacts := make(map[string]interface{}, len(r.publishedArtifacts))
+		for name, published := range r.publishedArtifacts {
+			artifacts[name] = map[string]interface{}{"digest": published.Digest, "reference": published.Reference}
+		}
+		with["artifacts"] = artifacts
+	}
+	if _, ok := with["artifact_digest"]; !ok && len(r.publishedArtifacts) == 1 {
+		for _, published := range r.publishedArtifacts {
+			with["artifact_digest"] = published.Digest
+		}
+	}
+	step.With = with
+	return step
+}
@@ -0,0 +1,150 @@
+package engine
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// DefaultOrphanStaleAfter is how long a running state that does not record its owner process
+// goes without being updated before it is considered orphaned.
+const DefaultOrphanStaleAfter = 10 * time.Minute
+
+// orphanReason is the error recorded in the states whose process died before they finished.
+const orphanReason = "the process running it died before it finished"
+
+// ReconcileReport lists the states a startup reconciliation recovered.
+type ReconcileReport struct {
+	Runs    []string // Execution states marked interrupted, by run ID
+	FanOuts []string // Fan-out states marked interrupted or failed, by fan-out ID
+}
+
+// Reconcile recovers the states left running by tako processes that were killed: runs are
+// marked interrupted, and can be resumed, while idempotent fan-outs are marked interrupted,
+// for the next dispatch of their event to take them over, and other fan-outs failed. A state
+// is orphaned when its owner process is dead, or, for states that do not record their owner,
+// when it was not updated for staleAfter.
+func (r *Runner) Reconcile(staleAfter time.Duration) (ReconcileReport, error) {
+	var report ReconcileReport
+	runs, err := ReconcileExecutionStates(r.workspaceRoot, staleAfter, r.now())
+	if err != nil {
+		return report, err
+	}
+	report.Runs = runs
+
+	states, err := NewFanOutStateManager(filepath.Join(r.getCacheDir(), "fanout-states"))
+	if err != nil {
+		return report, err
+	}
+	states.SetClock(r.clock)
+	report.FanOuts, err = states.ReconcileOrphans(staleAfter)
+	return report, err
+}
+
+// ReconcileExecutionStates marks the running execution states under a workspace root whose
+// process died by now as interrupted, and returns their run IDs.
+func ReconcileExecutionStates(workspaceRoot string, staleAfter time.Duration, now time.Time) ([]string, error) {
+	states, err := orphanedExecutionStates(workspaceRoot, staleAfter, now)
+	var recovered []string
+	for _, state := range states {
+		if err := state.InterruptExecution(orphanReason); err != nil {
+			return recovered, err
+		}
+		slog.Warn("marked run interrupted", "run_id", state.RunID, "owner_pid", state.OwnerPID)
+		recovered = append(recovered, state.RunID)
+	}
+	return recovered, err
+}
+
+// orphanedExecutionStates returns the running execution states under a workspace root whose
+// process died by now.
+func orphanedExecutionStates(workspaceRoot string, staleAfter time.Duration, now time.Time) ([]*ExecutionState, error) {
+	files := []string{filepath.Join(workspaceRoot, "state", "execution.json")}
+	children, err := filepath.Glob(filepath.Join(workspaceRoot, "children", "*", "state", "execution.json"))
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, children...)
+
+	var orphans []*ExecutionState
+	for _, file := range files {
+		info, err := os.Stat(file)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return orphans, fmt.Errorf("failed to read state file: %v", err)
+		}
+		state := &ExecutionState{stateFile: file}
+		if err := decodeExecutionState(data, state); err != nil {
+			slog.Warn("skipping unreadable execution state", "file", file, "error", err)
+			continue
+		}
+		if state.Status == StatusRunning && orphaned(state.OwnerPID, info.ModTime(), staleAfter, now) {
+			orphans = append(orphans, state)
+		}
+	}
+	return orphans, nil
+}
+
+// ReconcileOrphans finishes the unfinished fan-out states whose process died: idempotent
+// fan-outs are marked interrupted and the others failed. It returns their IDs.
+func (sm *FanOutStateManager) ReconcileOrphans(staleAfter time.Duration) ([]string, error) {
+	var recovered []string
+	for _, state := range sm.orphanedStates(staleAfter, sm.now()) {
+		var err error
+		recoveredStatus := FanOutStatusFailed
+		if state.Fingerprint != "" || sm.isIdempotentState(state.ID) {
+			recoveredStatus = FanOutStatusInterrupted
+			err = state.InterruptFanOut(orphanReason)
+		} else {
+			err = state.FailFanOut(orphanReason)
+		}
+		if err != nil {
+			return recovered, err
+		}
+		slog.Warn("recovered orphaned fan-out", "fan_out_id", state.ID, "owner_pid", state.OwnerPID, "status", recoveredStatus)
+		recovered = append(recovered, state.ID)
+	}
+	return recovered, nil
+}
+
+// orphanedStates returns the unfinished fan-out states whose process died by now, sorted by ID.
+func (sm *FanOutStateManager) orphanedStates(staleAfter time.Duration, now time.Time) []*FanOutState {
+	sm.mu.RLock()
+	states := make([]*FanOutState, 0, len(sm.states))
+	for _, state := range sm.states {
+		states = append(states, state)
+	}
+	sm.mu.RUnlock()
+	sort.Slice(states, func(i, j int) bool { return states[i].ID < states[j].ID })
+
+	var orphans []*FanOutState
+	for _, state := range states {
+		state.mu.RLock()
+		status, owner := state.Status, state.OwnerPID
+		state.mu.RUnlock()
+		if status != FanOutStatusPending && status != FanOutStatusRunning && status != FanOutStatusWaiting {
+			continue
+		}
+		info, err := os.Stat(filepath.Join(sm.stateDir, state.ID+".json"))
+		if err != nil || !orphaned(owner, info.ModTime(), staleAfter, now) {
+			continue
+		}
+		orphans = append(orphans, state)
+	}
+	return orphans
+}
+
+// orphaned reports whether a running state was left behind by its process: its owner is dead
+// or, when it does not record one, it was last updated more than staleAfter before now.
+func orphaned(ownerPID int, updated time.Time, staleAfter time.Duration, now time.Time) bool {
+	if ownerPID > 0 {
+		return ownerPID != os.Getpid() && !processAlive(ownerPID)
+	}
+	return now.Sub(updated) > staleAfter
+}
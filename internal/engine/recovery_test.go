@@ -0,0 +1,157 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestReconcileExecutionStates(t *testing.T) {
+	workspaceRoot := t.TempDir()
+	newState := func(runID, workspace string, ownerPID int) *ExecutionState {
+		state, err := NewExecutionState(runID, workspace)
+		if err != nil {
+			t.Fatalf("Failed to create state: %v", err)
+		}
+		if err := state.StartExecution("build", "org/app", nil); err != nil {
+			t.Fatalf("Failed to start execution: %v", err)
+		}
+		if err := state.StartStep("compile"); err != nil {
+			t.Fatalf("Failed to start step: %v", err)
+		}
+		state.OwnerPID = ownerPID
+		if err := state.save(); err != nil {
+			t.Fatalf("Failed to save state: %v", err)
+		}
+		return state
+	}
+	newState("exec-dead", workspaceRoot, deadProcessID(t))
+	newState("exec-alive", filepath.Join(workspaceRoot, "children", "exec-alive"), os.Getpid())
+	ownerless := newState("exec-ownerless", filepath.Join(workspaceRoot, "children", "exec-ownerless"), 0)
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(ownerless.stateFile, old, old); err != nil {
+		t.Fatalf("Failed to age state: %v", err)
+	}
+
+	recovered, err := ReconcileExecutionStates(workspaceRoot, time.Minute, time.Now())
+	if err != nil {
+		t.Fatalf("ReconcileExecutionStates failed: %v", err)
+	}
+	if len(recovered) != 2 || recovered[0] != "exec-dead" || recovered[1] != "exec-ownerless" {
+		t.Errorf("expected the runs of dead and stale owners recovered, got %v", recovered)
+	}
+
+	state, err := LoadExecutionState("exec-dead", workspaceRoot)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if state.Status != StatusInterrupted || state.Steps["compile"].Status != StatusInterrupted || !state.IsResumable() {
+		t.Errorf("expected a resumable interrupted run, got %s (step %s)", state.Status, state.Steps["compile"].Status)
+	}
+	alive, err := LoadExecutionState("exec-alive", filepath.Join(workspaceRoot, "children", "exec-alive"))
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if alive.Status != StatusRunning {
+		t.Errorf("expected the run of a live process untouched, got %s", alive.Status)
+	}
+}
+
+func TestFanOutStateManager_ReconcileOrphans(t *testing.T) {
+	stateDir := t.TempDir()
+	manager, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	dead := deadProcessID(t)
+
+	idempotent, _, err := manager.CreateIdempotentFanOutState(strings.Repeat("ab", 32), "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	plain, err := manager.CreateFanOutState("fanout-plain", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	live, err := manager.CreateFanOutState("fanout-live", "", "org/source", "test_event", true, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	for _, state := range []*FanOutState{idempotent, plain, live} {
+		state.StartFanOut()
+	}
+	for _, state := range []*FanOutState{idempotent, plain} {
+		state.mu.Lock()
+		state.OwnerPID = dead
+		state.mu.Unlock()
+		manager.persistState(state)
+	}
+
+	// A process starting later loads the states from disk
+	restarted, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	recovered, err := restarted.ReconcileOrphans(time.Minute)
+	if err != nil {
+		t.Fatalf("ReconcileOrphans failed: %v", err)
+	}
+	if len(recovered) != 2 {
+		t.Fatalf("expected the fan-outs of the dead process recovered, got %v", recovered)
+	}
+
+	if state, _ := restarted.GetFanOutState(idempotent.ID); state.Status != FanOutStatusInterrupted || !state.Abandoned() {
+		t.Errorf("expected the idempotent fan-out interrupted for a takeover, got %s", state.Status)
+	}
+	if state, _ := restarted.GetFanOutState(plain.ID); state.Status != FanOutStatusFailed {
+		t.Errorf("expected the other fan-out failed, got %s", state.Status)
+	}
+	if state, _ := restarted.GetFanOutState(live.ID); state.Status != FanOutStatusRunning {
+		t.Errorf("expected the fan-out of a live process untouched, got %s", state.Status)
+	}
+}
+
+func TestFanOutExecutor_Interrupted(t *testing.T) {
+	runner := &blockingWorkflowRunner{}
+	runner.running.Add(2)
+	executor, err := NewFanOutExecutor(t.TempDir(), false, runner)
+	if err != nil {
+		t.Fatalf("Failed to create executor: %v", err)
+	}
+
+	// Interrupt once the children of the concurrency limit are running
+	ctx, cancel := context.WithCancelCause(context.Background())
+	go func() {
+		runner.running.Wait()
+		cancel(ErrRunInterrupted)
+	}()
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type":        "library_built",
+			"wait_for_children": true,
+			"concurrency_limit": 2,
+		},
+	}
+	result, err := executor.ExecuteWithSubscriptionsContext(ctx, step, "source-org/library", rolloutSubscriptions(4))
+	if err != nil {
+		t.Fatalf("Fan-out failed: %v", err)
+	}
+	state, err := executor.stateManager.GetFanOutState(result.FanOutID)
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != FanOutStatusInterrupted {
+		t.Errorf("expected an interrupted fan-out, got %s", state.Status)
+	}
+	summary := state.GetSummary()
+	if summary.RunningChildren != 2 || summary.PendingChildren != 2 {
+		t.Errorf("expected the unfinished children kept for a takeover, got %+v", summary)
+	}
+}
@@ -0,0 +1,297 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/auth"
+	"github.com/dangazineu/tako/internal/interfaces"
+	"github.com/google/go-github/v63/github"
+)
+
+// Dispatch modes of remote execution.
+const (
+	RemoteDispatchWorkflow   = "workflow_dispatch"   // Triggers a GitHub Actions workflow by file name
+	RemoteDispatchRepository = "repository_dispatch" // Sends a repository_dispatch event
+)
+
+// Defaults of remote execution.
+const (
+	DefaultRemoteWorkflowFile = "tako.yml"
+	DefaultRemoteEventType    = "tako"
+	DefaultRemotePollInterval = 15 * time.Second
+	DefaultRemoteTimeout      = time.Hour
+)
+
+// RemoteOptions configures the remote execution of child workflows on GitHub Actions.
+type RemoteOptions struct {
+	// Enabled runs child workflows remotely instead of in local workspaces
+	Enabled bool
+
+	// Dispatch is RemoteDispatchWorkflow (the default) or RemoteDispatchRepository
+	Dispatch string
+
+	// WorkflowFile is the GitHub Actions workflow triggered by workflow_dispatch,
+	// DefaultRemoteWorkflowFile when empty
+	WorkflowFile string
+
+	// EventType is the type of repository_dispatch events, DefaultRemoteEventType when empty
+	EventType string
+
+	// PollInterval is how often check runs are polled, DefaultRemotePollInterval when zero
+	PollInterval time.Duration
+
+	// Timeout bounds how long a remote run is awaited, DefaultRemoteTimeout when zero
+	Timeout time.Duration
+
+	// BaseURL is the URL of the GitHub API; api.github.com when empty
+	BaseURL string
+
+	// Auth provides the token of each owner
+	Auth auth.TokenSource
+}
+
+// RemoteWorkflowExecutor runs child workflows on GitHub Actions: it dispatches the run to the
+// child repository and polls its check runs until the run completes. The dispatched run is
+// identified by a correlation ID, passed to the GitHub Actions workflow as the
+// "correlation_id" input (or client payload field), that must appear in the name of the
+// check run reporting it, e.g. with `name: tako ${{ inputs.correlation_id }}` on its job.
+// It implements the interfaces.WorkflowRunner interface.
+type RemoteWorkflowExecutor struct {
+	opts      RemoteOptions
+	parentRun string
+}
+
+// NewRemoteWorkflowExecutor creates an executor dispatching the child workflows of a run.
+func NewRemoteWorkflowExecutor(parentRunID string, opts RemoteOptions) (*RemoteWorkflowExecutor, error) {
+	switch opts.Dispatch {
+	case "":
+		opts.Dispatch = RemoteDispatchWorkflow
+	case RemoteDispatchWorkflow, RemoteDispatchRepository:
+	default:
+		return nil, fmt.Errorf("invalid remote dispatch '%s': must be %s or %s", opts.Dispatch, RemoteDispatchWorkflow, RemoteDispatchRepository)
+	}
+	if opts.WorkflowFile == "" {
+		opts.WorkflowFile = DefaultRemoteWorkflowFile
+	}
+	if opts.EventType == "" {
+		opts.EventType = DefaultRemoteEventType
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultRemotePollInterval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultRemoteTimeout
+	}
+	if opts.BaseURL != "" {
+		if _, err := url.Parse(opts.BaseURL); err != nil {
+			return nil, fmt.Errorf("invalid GitHub API URL '%s': %w", opts.BaseURL, err)
+		}
+	}
+
+	return &RemoteWorkflowExecutor{
+		opts:      opts,
+		parentRun: parentRunID,
+	}, nil
+}
+
+// ExecuteWorkflow dispatches a workflow to a repository given as owner/repo, owner/repo:ref or
+// owner/repo:ref@commit, and waits for its check run to complete. Runs that fail, or do not
+// complete within the timeout, give an unsuccessful result.
+func (e *RemoteWorkflowExecutor) ExecuteWorkflow(ctx context.Context, repoPath, workflowName string, inputs map[string]string) (*interfaces.ExecutionResult, error) {
+	if workflowName == "" {
+		return nil, fmt.Errorf("workflow name is required")
+	}
+	owner, repo, ref, commit, err := parseRemoteRepository(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := e.client(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	correlationID := GenerateRunID()
+	startTime := time.Now()
+	if err := e.dispatch(ctx, client, owner, repo, ref, commit, correlationID, workflowName, inputs); err != nil {
+		return nil, fmt.Errorf("failed to dispatch workflow '%s' to %s/%s: %w", workflowName, owner, repo, err)
+	}
+	slog.Info("dispatched remote workflow",
+		"repository", owner+"/"+repo,
+		"workflow", workflowName,
+		"correlation_id", correlationID)
+
+	// Dispatched runs start from the head of the ref, which holds their check runs
+	checkRun, err := e.awaitCheckRun(ctx, client, owner, repo, ref, correlationID)
+
+	result := &interfaces.ExecutionResult{
+		RunID:     correlationID,
+		StartTime: startTime,
+		EndTime:   time.Now(),
+	}
+	step := interfaces.StepResult{ID: "remote", StartTime: startTime, EndTime: result.EndTime}
+	switch {
+	case err != nil:
+		result.Error = err
+		step.Error = err
+		if ctx.Err() != nil {
+			step.ErrorType = interfaces.StepErrorCancelled
+		}
+	case checkRun.GetConclusion() != "success":
+		result.Error = fmt.Errorf("remote workflow '%s' in %s/%s concluded with %s: %s", workflowName, owner, repo, checkRun.GetConclusion(), checkRun.GetHTMLURL())
+		step.Error = result.Error
+	default:
+		result.Success = true
+		step.Success = true
+	}
+	if checkRun != nil {
+		step.Output = checkRun.GetHTMLURL()
+		step.Outputs = map[string]string{
+			"check_run_id": fmt.Sprintf("%d", checkRun.GetID()),
+			"conclusion":   checkRun.GetConclusion(),
+			"html_url":     checkRun.GetHTMLURL(),
+		}
+	}
+	result.Steps = []interfaces.StepResult{step}
+	return result, nil
+}
+
+// dispatch triggers the remote run with the tako workflow, its inputs and the correlation ID.
+func (e *RemoteWorkflowExecutor) dispatch(ctx context.Context, client *github.Client, owner, repo, ref, commit, correlationID, workflowName string, inputs map[string]string) error {
+	encodedInputs, err := json.Marshal(inputs)
+	if err != nil {
+		return fmt.Errorf("failed to encode inputs: %w", err)
+	}
+
+	if e.opts.Dispatch == RemoteDispatchRepository {
+		payload, err := json.Marshal(map[string]interface{}{
+			"correlation_id": correlationID,
+			"parent_run_id":  e.parentRun,
+			"workflow":       workflowName,
+			"inputs":         inputs,
+			"ref":            ref,
+			"commit":         commit,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to encode client payload: %w", err)
+		}
+		raw := json.RawMessage(payload)
+		_, _, err = client.Repositories.Dispatch(ctx, owner, repo, github.DispatchRequestOptions{
+			EventType:     e.opts.EventType,
+			ClientPayload: &raw,
+		})
+		return err
+	}
+
+	// workflow_dispatch inputs are strings, and must be declared by the GitHub Actions workflow;
+	// commit is only sent for pinned revisions
+	dispatchInputs := map[string]interface{}{
+		"correlation_id": correlationID,
+		"workflow":       workflowName,
+		"inputs":         string(encodedInputs),
+	}
+	if commit != "" {
+		dispatchInputs["commit"] = commit
+	}
+	_, err = client.Actions.CreateWorkflowDispatchEventByFileName(ctx, owner, repo, e.opts.WorkflowFile, github.CreateWorkflowDispatchEventRequest{
+		Ref:    ref,
+		Inputs: dispatchInputs,
+	})
+	return err
+}
+
+// awaitCheckRun polls the check runs of a ref until the one named after the correlation ID completes.
+func (e *RemoteWorkflowExecutor) awaitCheckRun(ctx context.Context, client *github.Client, owner, repo, ref, correlationID string) (*github.CheckRun, error) {
+	ctx, cancel := context.WithTimeout(ctx, e.opts.Timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(e.opts.PollInterval)
+	defer ticker.Stop()
+
+	var last *github.CheckRun
+	for {
+		checkRun, err := findCheckRun(ctx, client, owner, repo, ref, correlationID)
+		if err != nil && ctx.Err() == nil {
+			// Transient API errors are retried until the timeout
+			slog.Warn("failed to poll check runs", "repository", owner+"/"+repo, "error", err)
+		}
+		if checkRun != nil {
+			last = checkRun
+			if checkRun.GetStatus() == "completed" {
+				return checkRun, nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return last, fmt.Errorf("remote run %s in %s/%s did not complete within %s", correlationID, owner, repo, e.opts.Timeout)
+			}
+			return last, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// findCheckRun returns the check run of a ref whose name contains the correlation ID, if any.
+func findCheckRun(ctx context.Context, client *github.Client, owner, repo, ref, correlationID string) (*github.CheckRun, error) {
+	opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, ref, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, run := range runs.CheckRuns {
+			if strings.Contains(run.GetName(), correlationID) {
+				return run, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// client returns the API client of an owner, authenticated with its token when there is one.
+func (e *RemoteWorkflowExecutor) client(ctx context.Context, owner string) (*github.Client, error) {
+	client := github.NewClient(nil)
+	if e.opts.Auth != nil {
+		token, err := e.opts.Auth.Token(ctx, owner)
+		if err != nil && !errors.Is(err, auth.ErrNoToken) {
+			return nil, err
+		}
+		if token != "" {
+			client = client.WithAuthToken(token)
+		}
+	}
+	if e.opts.BaseURL != "" {
+		baseURL, _ := url.Parse(strings.TrimSuffix(e.opts.BaseURL, "/") + "/")
+		client.BaseURL = baseURL
+	}
+	return client, nil
+}
+
+// parseRemoteRepository splits owner/repo[:ref[@commit]], defaulting the ref to main.
+func parseRemoteRepository(spec string) (owner, repo, ref, commit string, err error) {
+	name, ref, _ := strings.Cut(spec, ":")
+	ref, commit, _ = strings.Cut(ref, "@")
+	if ref == "" {
+		ref = "main"
+	}
+	owner, repo, ok := strings.Cut(name, "/")
+	if !ok || owner == "" || repo == "" || strings.Contains(repo, "/") {
+		return "", "", "", "", fmt.Errorf("invalid repository format: %s (expected owner/repo)", spec)
+	}
+	return owner, repo, ref, commit, nil
+}
+
+// _ ensures RemoteWorkflowExecutor implements the WorkflowRunner interface.
+var _ interfaces.WorkflowRunner = (*RemoteWorkflowExecutor)(nil)
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/auth"
+)
+
+// fakeActions fakes the GitHub API of org/service: dispatched runs report a check run named
+// after their correlation ID, in progress on the first poll and completed with the conclusion
+// on the next ones.
+type fakeActions struct {
+	t          *testing.T
+	conclusion string
+
+	mu            sync.Mutex
+	dispatched    map[string]interface{}
+	correlationID string
+	polls         int
+	authorization string
+}
+
+func (f *fakeActions) handler() http.Handler {
+	mux := http.NewServeMux()
+	record := func(w http.ResponseWriter, r *http.Request, correlationID func(map[string]interface{}) string) {
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			f.t.Errorf("failed to decode dispatch: %v", err)
+		}
+		f.mu.Lock()
+		f.dispatched = body
+		f.correlationID = correlationID(body)
+		f.authorization = r.Header.Get("Authorization")
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}
+	mux.HandleFunc("/repos/org/service/actions/workflows/tako.yml/dispatches", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r, func(body map[string]interface{}) string {
+			return body["inputs"].(map[string]interface{})["correlation_id"].(string)
+		})
+	})
+	mux.HandleFunc("/repos/org/service/dispatches", func(w http.ResponseWriter, r *http.Request) {
+		record(w, r, func(body map[string]interface{}) string {
+			return body["client_payload"].(map[string]interface{})["correlation_id"].(string)
+		})
+	})
+	mux.HandleFunc("/repos/org/service/commits/main/check-runs", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.polls++
+		status, conclusion := "in_progress", ""
+		if f.polls > 1 {
+			status, conclusion = "completed", f.conclusion
+		}
+		fmt.Fprintf(w, `{"total_count": 2, "check_runs": [
+			{"id": 1, "name": "lint", "status": "completed", "conclusion": "success"},
+			{"id": 2, "name": "tako %s", "status": %q, "conclusion": %q, "html_url": "https://github.com/org/service/runs/2"}
+		]}`, f.correlationID, status, conclusion)
+	})
+	return mux
+}
+
+func newRemoteExecutorForTest(t *testing.T, fake *fakeActions, dispatch string) *RemoteWorkflowExecutor {
+	t.Helper()
+	server := httptest.NewServer(fake.handler())
+	t.Cleanup(server.Close)
+
+	executor, err := NewRemoteWorkflowExecutor("exec-parent", RemoteOptions{
+		Enabled:      true,
+		Dispatch:     dispatch,
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      5 * time.Second,
+		BaseURL:      server.URL,
+		Auth:         auth.StaticToken("remote-test-token"),
+	})
+	if err != nil {
+		t.Fatalf("NewRemoteWorkflowExecutor() error = %v", err)
+	}
+	return executor
+}
+
+func TestRemoteWorkflowExecutor_WorkflowDispatch(t *testing.T) {
+	fake := &fakeActions{t: t, conclusion: "success"}
+	executor := newRemoteExecutorForTest(t, fake, "")
+
+	result, err := executor.ExecuteWorkflow(context.Background(), "org/service", "build", map[string]string{"version": "1.2.0"})
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("expected success, got %v", result.Error)
+	}
+	if result.RunID != fake.correlationID {
+		t.Errorf("expected the run ID to be the correlation ID %s, got %s", fake.correlationID, result.RunID)
+	}
+	if got := result.Steps[0].Outputs["html_url"]; got != "https://github.com/org/service/runs/2" {
+		t.Errorf("expected the check run URL in the outputs, got %q", got)
+	}
+
+	if fake.dispatched["ref"] != "main" {
+		t.Errorf("expected the dispatch on main, got %v", fake.dispatched["ref"])
+	}
+	inputs := fake.dispatched["inputs"].(map[string]interface{})
+	if inputs["workflow"] != "build" || inputs["inputs"] != `{"version":"1.2.0"}` {
+		t.Errorf("unexpected dispatch inputs: %v", inputs)
+	}
+	if fake.authorization != "Bearer remote-test-token" {
+		t.Errorf("expected the token of the owner, got %q", fake.authorization)
+	}
+}
+
+func TestRemoteWorkflowExecutor_RepositoryDispatchFailure(t *testing.T) {
+	fake := &fakeActions{t: t, conclusion: "failure"}
+	executor := newRemoteExecutorForTest(t, fake, RemoteDispatchRepository)
+
+	result, err := executor.ExecuteWorkflow(context.Background(), "org/service:main@abc1234", "build", nil)
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if result.Success {
+		t.Fatalf("expected the failed check run to fail the workflow")
+	}
+	if !strings.Contains(result.Error.Error(), "concluded with failure") {
+		t.Errorf("unexpected error: %v", result.Error)
+	}
+
+	if fake.dispatched["event_type"] != DefaultRemoteEventType {
+		t.Errorf("expected event type %s, got %v", DefaultRemoteEventType, fake.dispatched["event_type"])
+	}
+	payload := fake.dispatched["client_payload"].(map[string]interface{})
+	if payload["commit"] != "abc1234" || payload["parent_run_id"] != "exec-parent" {
+		t.Errorf("unexpected client payload: %v", payload)
+	}
+}
+
+func TestRemoteWorkflowExecutor_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/check-runs") {
+			fmt.Fprint(w, `{"total_count": 0, "check_runs": []}`)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	executor, err := NewRemoteWorkflowExecutor("", RemoteOptions{
+		PollInterval: 10 * time.Millisecond,
+		Timeout:      50 * time.Millisecond,
+		BaseURL:      server.URL,
+	})
+	if err != nil {
+		t.Fatalf("NewRemoteWorkflowExecutor() error = %v", err)
+	}
+
+	result, err := executor.ExecuteWorkflow(context.Background(), "org/service", "build", nil)
+	if err != nil {
+		t.Fatalf("ExecuteWorkflow() error = %v", err)
+	}
+	if result.Success || !strings.Contains(result.Error.Error(), "did not complete within") {
+		t.Errorf("expected a timeout, got %v", result.Error)
+	}
+}
+
+func TestNewRemoteWorkflowExecutor_InvalidOptions(t *testing.T) {
+	if _, err := NewRemoteWorkflowExecutor("", RemoteOptions{Dispatch: "push"}); err == nil {
+		t.Errorf("expected an error for an invalid dispatch mode")
+	}
+
+	executor, err := NewRemoteWorkflowExecutor("", RemoteOptions{})
+	if err != nil {
+		t.Fatalf("NewRemoteWorkflowExecutor() error = %v", err)
+	}
+	if _, err := executor.ExecuteWorkflow(context.Background(), "service", "build", nil); err == nil {
+		t.Errorf("expected an error for a repository without owner")
+	}
+}
@@ -0,0 +1,443 @@
+package engine
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// Formats of execution reports.
+const (
+	ReportFormatJSON  = "json"
+	ReportFormatJUnit = "junit"
+	ReportFormatSARIF = "sarif"
+	ReportFormatNone  = "none" // No report is written
+)
+
+// Error classes of the steps and child workflows of execution reports, besides the
+// StepResult.ErrorType of steps and the ChildExecutionError.ErrorType of children.
+const (
+	ReportErrorRunFailed      = "run_failed"      // The run failed outside of its steps
+	ReportErrorStepFailed     = "step_failed"     // The step failed on its own
+	ReportErrorWorkflowFailed = "workflow_failed" // A child workflow failed
+	ReportErrorTimeout        = "timeout"         // A child workflow timed out
+	ReportErrorCancelled      = "cancelled"       // The step or child workflow was cancelled
+)
+
+// ReportOptions configures the execution report written after a run.
+type ReportOptions struct {
+	// Format is json, junit, sarif or none; json when empty
+	Format string
+	// Path is the file the report is written to; report.<extension> in the workspace of the run
+	// when empty
+	Path string
+}
+
+// ParseReportFormat validates a report format, returning json for an empty one.
+func ParseReportFormat(format string) (string, error) {
+	switch strings.ToLower(format) {
+	case "", ReportFormatJSON:
+		return ReportFormatJSON, nil
+	case ReportFormatJUnit, "xml":
+		return ReportFormatJUnit, nil
+	case ReportFormatSARIF:
+		return ReportFormatSARIF, nil
+	case ReportFormatNone:
+		return ReportFormatNone, nil
+	default:
+		return "", fmt.Errorf("unsupported report format '%s': must be json, junit, sarif or none", format)
+	}
+}
+
+// reportExtension returns the file extension of the reports of a format.
+func reportExtension(format string) string {
+	switch format {
+	case ReportFormatJUnit:
+		return "xml"
+	case ReportFormatSARIF:
+		return "sarif"
+	default:
+		return "json"
+	}
+}
+
+// ExecutionReport summarizes a run for tools: every step, with the child workflows of its
+// fan-outs, with their timings, statuses and the class of their errors.
+type ExecutionReport struct {
+	RunID       string            `json:"run_id"`
+	ParentRunID string            `json:"parent_run_id,omitempty"`
+	Repository  string            `json:"repository"`
+	Workflow    string            `json:"workflow"`
+	Status      string            `json:"status"`
+	StartTime   time.Time         `json:"start_time"`
+	EndTime     time.Time         `json:"end_time"`
+	Duration    time.Duration     `json:"duration"`
+	Error       string            `json:"error,omitempty"`
+	ErrorType   string            `json:"error_type,omitempty"`
+	Outputs     map[string]string `json:"outputs,omitempty"`
+	Steps       []ReportStep      `json:"steps"`
+}
+
+// ReportStep is the report of a step; its status is one of the HistoryStep statuses.
+type ReportStep struct {
+	ID        string        `json:"id"`
+	Status    string        `json:"status"`
+	StartTime time.Time     `json:"start_time"`
+	EndTime   time.Time     `json:"end_time"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+	ErrorType string        `json:"error_type,omitempty"`
+	ErrorLine int           `json:"error_line,omitempty"`
+	Cached    bool          `json:"cached,omitempty"`
+	Children  []ReportChild `json:"children,omitempty"`
+	// AllowedFailure is whether the step failed without failing the run, under continue_on_error.
+	AllowedFailure bool `json:"allowed_failure,omitempty"`
+}
+
+// ReportChild is the report of a child workflow triggered by a fan-out step.
+type ReportChild struct {
+	Repository string              `json:"repository"`
+	Workflow   string              `json:"workflow"`
+	RunID      string              `json:"run_id,omitempty"`
+	Status     ChildWorkflowStatus `json:"status"`
+	StartTime  time.Time           `json:"start_time"`
+	EndTime    *time.Time          `json:"end_time,omitempty"`
+	Duration   time.Duration       `json:"duration"`
+	Error      string              `json:"error,omitempty"`
+	ErrorType  string              `json:"error_type,omitempty"`
+	SkipReason string              `json:"skip_reason,omitempty"`
+	Outputs    map[string]string   `json:"outputs,omitempty"`
+}
+
+// failed reports whether the step did not succeed, nor was skipped.
+func (s ReportStep) failed() bool {
+	return s.Status == HistoryStepFailed
+}
+
+// failed reports whether the child workflow did not complete.
+func (c ReportChild) failed() bool {
+	return c.Status != ChildStatusCompleted && c.Status != ChildStatusSkipped
+}
+
+// newReportSteps reports the results of the steps of a run, with the children of their
+// fan-outs.
+func newReportSteps(results []StepResult, children map[string][]ReportChild) []ReportStep {
+	steps := make([]ReportStep, 0, len(results))
+	for _, result := range results {
+		step := ReportStep{
+			ID:        result.ID,
+			Status:    HistoryStepSucceeded,
+			StartTime: result.StartTime,
+			EndTime:   result.EndTime,
+			Duration:  result.EndTime.Sub(result.StartTime),
+			Children:  children[result.ID],
+		}
+		step.Cached = result.Cached
+		step.AllowedFailure = result.AllowedFailure
+		if result.Skipped {
+			step.Status = HistoryStepSkipped
+		} else if !result.Success {
+			step.Status = HistoryStepFailed
+			step.ErrorType = result.ErrorType
+			step.ErrorLine = result.ErrorLine
+			if step.ErrorType == "" {
+				step.ErrorType = ReportErrorStepFailed
+			}
+			if result.Error != nil {
+				step.Error = result.Error.Error()
+			}
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+// newReportChildren reports the child workflows of a fan-out. The errors of the children are
+// classified as the fan-out classified them, or from their status.
+func newReportChildren(result *FanOutResult) []ReportChild {
+	errorTypes := make(map[string]string)
+	for _, childErr := range result.DetailedErrors {
+		errorTypes[childErr.Repository+"/"+childErr.Workflow] = childErr.ErrorType
+	}
+	children := make([]ReportChild, 0, len(result.Children))
+	for _, child := range result.Children {
+		report := ReportChild{
+			Repository: child.Repository,
+			Workflow:   child.Workflow,
+			RunID:      child.RunID,
+			Status:     child.Status,
+			StartTime:  child.StartTime,
+			EndTime:    child.EndTime,
+			Error:      child.ErrorMessage,
+			SkipReason: child.SkipReason,
+			Outputs:    child.Outputs,
+		}
+		if child.EndTime != nil {
+			report.Duration = child.EndTime.Sub(child.StartTime)
+		}
+		if report.failed() {
+			report.ErrorType = errorTypes[child.Repository+"/"+child.Workflow]
+			if report.ErrorType == "" {
+				switch child.Status {
+				case ChildStatusTimedOut:
+					report.ErrorType = ReportErrorTimeout
+				case ChildStatusCancelled:
+					report.ErrorType = ReportErrorCancelled
+				default:
+					report.ErrorType = ReportErrorWorkflowFailed
+				}
+			}
+		}
+		children = append(children, report)
+	}
+	return children
+}
+
+// WriteReport writes a report to a file in a format, creating its directory.
+func WriteReport(report *ExecutionReport, format, path string) error {
+	var data []byte
+	var err error
+	switch format {
+	case ReportFormatJSON:
+		data, err = json.MarshalIndent(report, "", "  ")
+	case ReportFormatJUnit:
+		data, err = marshalJUnitReport(report)
+	case ReportFormatSARIF:
+		data, err = json.MarshalIndent(newSARIFReport(report), "", "  ")
+	default:
+		return fmt.Errorf("unsupported report format '%s'", format)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %v", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %v", err)
+	}
+	return nil
+}
+
+// junitTestSuites is the root of a JUnit XML report. The steps of the run are the test cases
+// of a suite, and the children of each fan-out step those of a suite of their own.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Type    string `xml:"type,attr"`
+	Message string `xml:"message,attr"`
+}
+
+// add appends a test case to the suite, counting it.
+func (s *junitTestSuite) add(testCase junitTestCase) {
+	s.Tests++
+	if testCase.Failure != nil {
+		s.Failures++
+	}
+	if testCase.Skipped != nil {
+		s.Skipped++
+	}
+	s.Cases = append(s.Cases, testCase)
+}
+
+// junitSeconds formats a duration in seconds, as JUnit reports time.
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// marshalJUnitReport encodes a report as JUnit XML.
+func marshalJUnitReport(report *ExecutionReport) ([]byte, error) {
+	name := report.Repository + ":" + report.Workflow
+	suites := junitTestSuites{Name: "tako " + report.RunID, Time: junitSeconds(report.Duration)}
+	suite := junitTestSuite{Name: name, Time: junitSeconds(report.Duration), Timestamp: report.StartTime.Format(time.RFC3339)}
+	var childSuites []junitTestSuite
+	for _, step := range report.Steps {
+		testCase := junitTestCase{ClassName: name, Name: step.ID, Time: junitSeconds(step.Duration)}
+		if step.failed() {
+			testCase.Failure = &junitFailure{Type: step.ErrorType, Message: step.Error}
+		} else if step.Status == HistoryStepSkipped {
+			testCase.Skipped = &struct{}{}
+		}
+		suite.add(testCase)
+
+		if len(step.Children) == 0 {
+			continue
+		}
+		childSuite := junitTestSuite{Name: name + "/" + step.ID, Timestamp: step.StartTime.Format(time.RFC3339), Time: junitSeconds(step.Duration)}
+		for _, child := range step.Children {
+			testCase := junitTestCase{ClassName: child.Repository, Name: child.Workflow, Time: junitSeconds(child.Duration)}
+			if child.failed() {
+				testCase.Failure = &junitFailure{Type: child.ErrorType, Message: child.Error}
+			} else if child.Status == ChildStatusSkipped {
+				testCase.Skipped = &struct{}{}
+			}
+			childSuite.add(testCase)
+		}
+		childSuites = append(childSuites, childSuite)
+	}
+	suites.Suites = append([]junitTestSuite{suite}, childSuites...)
+	for _, s := range suites.Suites {
+		suites.Tests += s.Tests
+		suites.Failures += s.Failures
+		suites.Skipped += s.Skipped
+	}
+
+	data, err := xml.MarshalIndent(suites, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// sarifLog is a SARIF 2.1.0 report, with a result for every failed step and child workflow.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// newSARIFReport converts a report to SARIF, the error class of each failure being its rule.
+func newSARIFReport(report *ExecutionReport) *sarifLog {
+	var rules []sarifRule
+	results := []sarifResult{}
+	addResult := func(errorType, text string, properties map[string]string) {
+		if !containsRule(rules, errorType) {
+			rules = append(rules, sarifRule{ID: errorType})
+		}
+		results = append(results, sarifResult{
+			RuleID:     errorType,
+			Level:      "error",
+			Message:    sarifMessage{Text: text},
+			Locations:  []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: "tako.yml"}}}},
+			Properties: properties,
+		})
+	}
+	for _, step := range report.Steps {
+		if step.failed() {
+			addResult(step.ErrorType, fmt.Sprintf("Step '%s' of workflow '%s' failed: %s", step.ID, report.Workflow, step.Error),
+				map[string]string{"run_id": report.RunID, "step": step.ID})
+		}
+		for _, child := range step.Children {
+			if child.failed() {
+				addResult(child.ErrorType, fmt.Sprintf("Child workflow '%s' of %s failed: %s", child.Workflow, child.Repository, child.Error),
+					map[string]string{"run_id": child.RunID, "step": step.ID, "repository": child.Repository})
+			}
+		}
+	}
+	if rules == nil {
+		rules = []sarifRule{}
+	}
+	return &sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool:    sarifTool{Driver: sarifDriver{Name: "tako", InformationURI: "https://github.com/dangazineu/tako", Rules: rules}},
+			Results: results,
+		}},
+	}
+}
+
+// containsRule reports whether a rule is among rules.
+func containsRule(rules []sarifRule, id string) bool {
+	for _, rule := range rules {
+		if rule.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// runErrorType classifies the error of a run: the class of its first failed step, or of how
+// it stopped.
+func runErrorType(runErr error, steps []ReportStep) string {
+	switch {
+	case runErr == nil:
+		return ""
+	case errors.Is(runErr, ErrRunCancelled):
+		return ReportErrorCancelled
+	case errors.Is(runErr, ErrWorkflowTimeout):
+		return interfaces.StepErrorWorkflowTimeout
+	}
+	for _, step := range steps {
+		if step.failed() {
+			return step.ErrorType
+		}
+	}
+	return ReportErrorRunFailed
+}
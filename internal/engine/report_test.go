@@ -0,0 +1,200 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *ExecutionReport {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	childEnd := start.Add(3 * time.Second)
+	fanOut := &FanOutResult{
+		Children: []ChildWorkflow{
+			{Repository: "org/api", Workflow: "deploy", Status: ChildStatusCompleted, StartTime: start, EndTime: &childEnd},
+			{Repository: "org/web", Workflow: "deploy", Status: ChildStatusFailed, StartTime: start, EndTime: &childEnd, ErrorMessage: "exit status 1"},
+			{Repository: "org/worker", Workflow: "deploy", Status: ChildStatusTimedOut, StartTime: start},
+		},
+		DetailedErrors: []ChildExecutionError{{Repository: "org/web", Workflow: "deploy", ErrorType: "circuit_breaker"}},
+	}
+	steps := []StepResult{
+		{ID: "build", Success: true, StartTime: start, EndTime: start.Add(2 * time.Second)},
+		{ID: "lint", Skipped: true, Success: true, StartTime: start, EndTime: start},
+		{ID: "release", Success: false, Error: errors.New("fan-out failed"), StartTime: start, EndTime: start.Add(5 * time.Second)},
+	}
+	report := &ExecutionReport{
+		RunID:      "exec-1",
+		Repository: "org/lib",
+		Workflow:   "release",
+		Status:     HistoryStatusFailed,
+		StartTime:  start,
+		EndTime:    start.Add(7 * time.Second),
+		Duration:   7 * time.Second,
+		Steps:      newReportSteps(steps, map[string][]ReportChild{"release": newReportChildren(fanOut)}),
+	}
+	report.Error = "fan-out failed"
+	report.ErrorType = runErrorType(errors.New("fan-out failed"), report.Steps)
+	return report
+}
+
+func TestExecutionReport_Classification(t *testing.T) {
+	report := testReport()
+	if report.ErrorType != ReportErrorStepFailed {
+		t.Errorf("expected the run to be classified as its failed step, got %q", report.ErrorType)
+	}
+	statuses := []string{report.Steps[0].Status, report.Steps[1].Status, report.Steps[2].Status}
+	if strings.Join(statuses, ",") != "succeeded,skipped,failed" {
+		t.Errorf("unexpected step statuses %v", statuses)
+	}
+
+	children := report.Steps[2].Children
+	if len(children) != 3 {
+		t.Fatalf("expected the children of the fan-out step, got %+v", children)
+	}
+	expected := []string{"", "circuit_breaker", ReportErrorTimeout}
+	for i, child := range children {
+		if child.ErrorType != expected[i] {
+			t.Errorf("expected child %s to be classified as %q, got %q", child.Repository, expected[i], child.ErrorType)
+		}
+	}
+	if children[0].Duration != 3*time.Second {
+		t.Errorf("expected the duration of the child, got %v", children[0].Duration)
+	}
+
+	if got := runErrorType(ErrRunCancelled, nil); got != ReportErrorCancelled {
+		t.Errorf("expected a cancelled run, got %q", got)
+	}
+	if got := runErrorType(errors.New("invalid outputs"), report.Steps[:2]); got != ReportErrorRunFailed {
+		t.Errorf("expected a run failing outside of its steps, got %q", got)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	dir := t.TempDir()
+	report := testReport()
+
+	// JSON
+	path := filepath.Join(dir, "report.json")
+	if err := WriteReport(report, ReportFormatJSON, path); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+	var decoded ExecutionReport
+	data, _ := os.ReadFile(path)
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("failed to decode report: %v", err)
+	}
+	if decoded.RunID != "exec-1" || len(decoded.Steps) != 3 || len(decoded.Steps[2].Children) != 3 {
+		t.Errorf("unexpected report %+v", decoded)
+	}
+
+	// JUnit
+	path = filepath.Join(dir, "nested", "report.xml")
+	if err := WriteReport(report, ReportFormatJUnit, path); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+	var suites junitTestSuites
+	data, _ = os.ReadFile(path)
+	if err := xml.Unmarshal(data, &suites); err != nil {
+		t.Fatalf("failed to decode JUnit report: %v\n%s", err, data)
+	}
+	if suites.Tests != 6 || suites.Failures != 3 || suites.Skipped != 1 || len(suites.Suites) != 2 {
+		t.Errorf("unexpected JUnit counts: tests=%d failures=%d skipped=%d suites=%d", suites.Tests, suites.Failures, suites.Skipped, len(suites.Suites))
+	}
+	if suites.Suites[1].Name != "org/lib:release/release" || suites.Suites[1].Cases[1].Failure.Type != "circuit_breaker" {
+		t.Errorf("unexpected suite of the children: %+v", suites.Suites[1])
+	}
+
+	// SARIF
+	path = filepath.Join(dir, "report.sarif")
+	if err := WriteReport(report, ReportFormatSARIF, path); err != nil {
+		t.Fatalf("failed to write report: %v", err)
+	}
+	var sarif sarifLog
+	data, _ = os.ReadFile(path)
+	if err := json.Unmarshal(data, &sarif); err != nil {
+		t.Fatalf("failed to decode SARIF report: %v", err)
+	}
+	if sarif.Version != "2.1.0" || len(sarif.Runs[0].Results) != 3 || len(sarif.Runs[0].Tool.Driver.Rules) != 3 {
+		t.Errorf("unexpected SARIF report %+v", sarif)
+	}
+
+	if _, err := ParseReportFormat("yaml"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestRunnerReport(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    steps:
+      - id: build
+        run: echo "building"
+      - id: test
+        run: exit 3
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	workspaceRoot := filepath.Join(tempDir, "workspace")
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: workspaceRoot,
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir); err == nil {
+		t.Fatal("Expected the workflow to fail")
+	}
+	expectedPath := filepath.Join(workspaceRoot, runner.GetRunID(), "report.json")
+	if runner.ReportPath() != expectedPath {
+		t.Fatalf("Expected the report at %s, got %q", expectedPath, runner.ReportPath())
+	}
+	data, err := os.ReadFile(expectedPath)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	var report ExecutionReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Failed to decode report: %v", err)
+	}
+	if report.Status != HistoryStatusFailed || report.ErrorType != ReportErrorStepFailed || len(report.Steps) != 2 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if report.Steps[1].Status != HistoryStepFailed || report.Steps[1].Error == "" {
+		t.Errorf("Expected the failed step in the report, got %+v", report.Steps[1])
+	}
+
+	// The format and path of the report can be chosen, or no report written
+	junitPath := filepath.Join(tempDir, "out", "junit.xml")
+	junitRunner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: workspaceRoot,
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{},
+		Report:        ReportOptions{Format: ReportFormatJUnit, Path: junitPath},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer junitRunner.Close()
+	_, _ = junitRunner.ExecuteWorkflow(context.Background(), "test", nil, tempDir)
+	if data, err := os.ReadFile(junitPath); err != nil || !strings.Contains(string(data), `<testcase classname="`) {
+		t.Errorf("Expected a JUnit report at %s: %v", junitPath, err)
+	}
+
+	if _, err := NewRunner(RunnerOptions{WorkspaceRoot: workspaceRoot, CacheDir: filepath.Join(tempDir, "cache"), Report: ReportOptions{Format: "html"}}); err == nil {
+		t.Error("Expected an error for an unsupported report format")
+	}
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// errLimitsUnsupported reports that resource limits cannot be enforced on this system, or with
+// the privileges tako runs with.
+var errLimitsUnsupported = errors.New("resource limits cannot be enforced")
+
+// ProcessLimits are resource limits enforced by the operating system on the processes of a
+// shell step, or on all the shell steps of a repository together. Zero values mean no limit.
+type ProcessLimits struct {
+	CPU         float64 // In cores
+	MemoryBytes int64
+}
+
+// IsZero reports whether the limits do not restrict anything.
+func (l ProcessLimits) IsZero() bool {
+	return l.CPU <= 0 && l.MemoryBytes <= 0
+}
+
+// processLimitsFromResources converts the resources of a step or workflow into process limits.
+func processLimitsFromResources(resources *config.Resources) (ProcessLimits, error) {
+	var limits ProcessLimits
+	if resources == nil {
+		return limits, nil
+	}
+
+	if resources.CPULimit != "" {
+		limit, err := ParseResourceSpec(resources.CPULimit, ResourceTypeCPU)
+		if err != nil {
+			return limits, fmt.Errorf("invalid CPU limit: %w", err)
+		}
+		limits.CPU = limit.Value
+	}
+
+	if resources.MemLimit != "" {
+		limit, err := ParseResourceSpec(resources.MemLimit, ResourceTypeMemory)
+		if err != nil {
+			return limits, fmt.Errorf("invalid memory limit: %w", err)
+		}
+		// Parsed memory limits are stored in mebibytes
+		limits.MemoryBytes = int64(limit.Value * 1024 * 1024)
+	}
+
+	return limits, nil
+}
+
+// processLimiter enforces resource limits on the processes of shell steps. Each step runs in
+// its own confinement, nested in a confinement shared by all the steps of its repository, so
+// that the limits of the repository bound their aggregate consumption.
+type processLimiter interface {
+	// Confine prepares cmd, before it starts, to run within the limits of its step and of its
+	// repository.
+	Confine(cmd *exec.Cmd, repoName, stepID string, step, repo ProcessLimits) (*confinement, error)
+}
+
+// confinement is the enforcement of limits around one running step. A nil confinement
+// enforces nothing.
+type confinement struct {
+	// started places the started process in the confinement, on platforms that cannot do it
+	// when the process is created.
+	started func(pid int) error
+	// exceeded returns an error describing a limit the step ran into, if any.
+	exceeded func() error
+	// release stops the processes left in the confinement and removes it.
+	release func()
+}
+
+// Started must be called once the step's process has started.
+func (c *confinement) Started(pid int) error {
+	if c == nil || c.started == nil {
+		return nil
+	}
+	return c.started(pid)
+}
+
+// Exceeded returns an error when the step was stopped by one of its limits.
+func (c *confinement) Exceeded() error {
+	if c == nil || c.exceeded == nil {
+		return nil
+	}
+	return c.exceeded()
+}
+
+// Release must be called once the step's process has exited.
+func (c *confinement) Release() {
+	if c == nil || c.release == nil {
+		return
+	}
+	c.release()
+}
+
+// confinementName turns a repository or step name into a single path element.
+func confinementName(name string) string {
+	if name == "" {
+		return "default"
+	}
+	return strings.NewReplacer("/", "_", `\`, "_", ":", "_", "..", "_").Replace(name)
+}
@@ -0,0 +1,245 @@
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// cgroupMount is where the cgroup v2 hierarchy is mounted.
+	cgroupMount = "/sys/fs/cgroup"
+	// cgroupCPUPeriod is the period, in microseconds, of the CPU quotas written to cpu.max.
+	cgroupCPUPeriod = 100000
+)
+
+// cgroupLimiter enforces limits with cgroups v2. Steps run in <base>/tako/<repo>/<step>, where
+// base is the cgroup of the tako process, so the cgroup of a repository bounds all its steps.
+type cgroupLimiter struct {
+	base string
+
+	setupOnce sync.Once
+	setupErr  error
+	root      string
+
+	// mu keeps a repository cgroup from being removed while a step of it is being created
+	mu sync.Mutex
+}
+
+// newProcessLimiter returns the cgroup v2 limiter of the current process.
+func newProcessLimiter() (processLimiter, error) {
+	if _, err := os.Stat(filepath.Join(cgroupMount, "cgroup.controllers")); err != nil {
+		return nil, fmt.Errorf("%w: cgroup v2 is not mounted at %s", errLimitsUnsupported, cgroupMount)
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the cgroup of the process: %w", err)
+	}
+	own, err := parseOwnCgroup(string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return &cgroupLimiter{base: filepath.Join(cgroupMount, own)}, nil
+}
+
+// parseOwnCgroup returns the cgroup v2 path of a process from the content of /proc/<pid>/cgroup.
+func parseOwnCgroup(content string) (string, error) {
+	for _, line := range strings.Split(content, "\n") {
+		if path, found := strings.CutPrefix(line, "0::"); found {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%w: process is not in a cgroup v2 hierarchy", errLimitsUnsupported)
+}
+
+// Confine implements processLimiter. The step's process is created directly in the cgroup of
+// the step, so none of its children can escape it.
+func (l *cgroupLimiter) Confine(cmd *exec.Cmd, repoName, stepID string, step, repo ProcessLimits) (*confinement, error) {
+	l.setupOnce.Do(func() { l.setupErr = l.setup() })
+	if l.setupErr != nil {
+		return nil, fmt.Errorf("%w: %v", errLimitsUnsupported, l.setupErr)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	repoDir := filepath.Join(l.root, confinementName(repoName))
+	if err := makeCgroup(repoDir); err != nil {
+		return nil, err
+	}
+	if err := enableControllers(repoDir); err != nil {
+		return nil, fmt.Errorf("failed to enable cgroup controllers in %s: %w", repoDir, err)
+	}
+	if !repo.IsZero() {
+		if err := writeCgroupLimits(repoDir, repo); err != nil {
+			return nil, fmt.Errorf("failed to set limits of repository %s: %w", repoName, err)
+		}
+	}
+
+	stepDir := filepath.Join(repoDir, confinementName(stepID))
+	if err := makeCgroup(stepDir); err != nil {
+		return nil, err
+	}
+	if err := writeCgroupLimits(stepDir, step); err != nil {
+		removeCgroup(stepDir, false)
+		return nil, fmt.Errorf("failed to set limits of step %s: %w", stepID, err)
+	}
+
+	fd, err := syscall.Open(stepDir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		removeCgroup(stepDir, false)
+		return nil, fmt.Errorf("failed to open cgroup %s: %w", stepDir, err)
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = fd
+
+	return &confinement{
+		exceeded: func() error {
+			if cgroupOOMKills(stepDir) > 0 {
+				return fmt.Errorf("step exceeded the memory limit of the step or its repository")
+			}
+			return nil
+		},
+		release: func() {
+			syscall.Close(fd)
+
+			l.mu.Lock()
+			defer l.mu.Unlock()
+			removeCgroup(stepDir, true)
+			// The repository cgroup stays while other steps of the repository run
+			removeCgroup(repoDir, false)
+		},
+	}, nil
+}
+
+// setup creates the cgroup tako confines steps in, with the cpu and memory controllers enabled.
+// Only the root cgroup may delegate controllers while it has processes of its own, so when tako
+// runs in another cgroup it first moves itself to a leaf cgroup next to the ones of its steps.
+func (l *cgroupLimiter) setup() error {
+	err := enableControllers(l.base)
+	if errors.Is(err, syscall.EBUSY) {
+		leaf := filepath.Join(l.base, "tako-main")
+		if err := makeCgroup(leaf); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(leaf, "cgroup.procs"), []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
+			return fmt.Errorf("failed to move tako to cgroup %s: %w", leaf, err)
+		}
+		err = enableControllers(l.base)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to enable cgroup controllers in %s: %w", l.base, err)
+	}
+
+	root := filepath.Join(l.base, "tako")
+	if err := makeCgroup(root); err != nil {
+		return err
+	}
+	if err := enableControllers(root); err != nil {
+		return fmt.Errorf("failed to enable cgroup controllers in %s: %w", root, err)
+	}
+
+	l.root = root
+	return nil
+}
+
+// makeCgroup creates a cgroup if it does not exist yet.
+func makeCgroup(dir string) error {
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("failed to create cgroup %s: %w", dir, err)
+	}
+	return nil
+}
+
+// enableControllers delegates the cpu and memory controllers available in a cgroup to the
+// cgroups it contains.
+func enableControllers(dir string) error {
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+
+	var enable []string
+	for _, controller := range strings.Fields(string(data)) {
+		if controller == "cpu" || controller == "memory" {
+			enable = append(enable, "+"+controller)
+		}
+	}
+	if len(enable) == 0 {
+		return fmt.Errorf("neither the cpu nor the memory controller is available")
+	}
+
+	return os.WriteFile(filepath.Join(dir, "cgroup.subtree_control"), []byte(strings.Join(enable, " ")), 0644)
+}
+
+// writeCgroupLimits writes the limits that are set to the interface files of a cgroup.
+func writeCgroupLimits(dir string, limits ProcessLimits) error {
+	if limits.CPU > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "cpu.max"), []byte(formatCPUMax(limits.CPU)), 0644); err != nil {
+			return err
+		}
+	}
+
+	if limits.MemoryBytes > 0 {
+		if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(strconv.FormatInt(limits.MemoryBytes, 10)), 0644); err != nil {
+			return err
+		}
+		// Keep the limit from being bypassed by swapping; swap accounting may be disabled
+		_ = os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0644)
+	}
+
+	return nil
+}
+
+// formatCPUMax formats a limit in cores as the quota and period written to cpu.max.
+func formatCPUMax(cores float64) string {
+	quota := int64(cores * cgroupCPUPeriod)
+	if quota < 1000 {
+		quota = 1000 // The kernel rejects quotas below 1ms
+	}
+	return fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+}
+
+// cgroupOOMKills returns how many processes of a cgroup were killed for running out of memory.
+func cgroupOOMKills(dir string) int {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if value, found := strings.CutPrefix(line, "oom_kill "); found {
+			count, _ := strconv.Atoi(strings.TrimSpace(value))
+			return count
+		}
+	}
+	return 0
+}
+
+// removeCgroup removes a cgroup. When kill is set, processes left in it are killed first and
+// the removal is retried until they are gone; otherwise a cgroup still in use is left alone.
+func removeCgroup(dir string, kill bool) {
+	if kill {
+		// cgroup.kill requires Linux 5.14; older kernels keep leftover processes alive
+		_ = os.WriteFile(filepath.Join(dir, "cgroup.kill"), []byte("1"), 0644)
+	}
+
+	for attempt := 0; attempt < 20; attempt++ {
+		err := syscall.Rmdir(dir)
+		if err == nil || errors.Is(err, syscall.ENOENT) || !kill || !errors.Is(err, syscall.EBUSY) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseOwnCgroup(t *testing.T) {
+	path, err := parseOwnCgroup("12:memory:/legacy\n0::/user.slice/session-1.scope\n")
+	if err != nil {
+		t.Fatalf("parseOwnCgroup() failed: %v", err)
+	}
+	if path != "/user.slice/session-1.scope" {
+		t.Errorf("parseOwnCgroup() = %q", path)
+	}
+
+	if _, err := parseOwnCgroup("4:memory:/legacy\n"); err == nil {
+		t.Error("Expected an error without a cgroup v2 entry")
+	}
+}
+
+func TestFormatCPUMax(t *testing.T) {
+	testCases := map[float64]string{
+		2:     "200000 100000",
+		0.5:   "50000 100000",
+		0.001: "1000 100000",
+	}
+	for cores, expected := range testCases {
+		if got := formatCPUMax(cores); got != expected {
+			t.Errorf("formatCPUMax(%v) = %q, want %q", cores, got, expected)
+		}
+	}
+}
+
+func TestCgroupOOMKills(t *testing.T) {
+	dir := t.TempDir()
+	if kills := cgroupOOMKills(dir); kills != 0 {
+		t.Errorf("Expected no OOM kills without memory.events, got %d", kills)
+	}
+
+	events := "low 0\nhigh 0\nmax 3\noom 1\noom_kill 2\n"
+	if err := os.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if kills := cgroupOOMKills(dir); kills != 2 {
+		t.Errorf("Expected 2 OOM kills, got %d", kills)
+	}
+}
+
+func TestCgroupLimiterConfine(t *testing.T) {
+	// A fake hierarchy: the kernel creates cgroup.controllers in every new cgroup
+	base := t.TempDir()
+	for _, dir := range []string{base, filepath.Join(base, "tako"), filepath.Join(base, "tako", "owner_repo")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "cgroup.controllers"), []byte("cpuset cpu io memory pids"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	limiter := &cgroupLimiter{base: base}
+	cmd := exec.Command("true")
+	c, err := limiter.Confine(cmd, "owner/repo", "run-1-build", ProcessLimits{MemoryBytes: 128 * 1024 * 1024}, ProcessLimits{CPU: 2, MemoryBytes: 1024 * 1024 * 1024})
+	if err != nil {
+		t.Fatalf("Confine() failed: %v", err)
+	}
+	defer c.Release()
+
+	expectFile := func(path, expected string) {
+		t.Helper()
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", path, err)
+		}
+		if string(data) != expected {
+			t.Errorf("%s = %q, want %q", path, string(data), expected)
+		}
+	}
+
+	repoDir := filepath.Join(base, "tako", "owner_repo")
+	expectFile(filepath.Join(base, "cgroup.subtree_control"), "+cpu +memory")
+	expectFile(filepath.Join(repoDir, "cgroup.subtree_control"), "+cpu +memory")
+	expectFile(filepath.Join(repoDir, "cpu.max"), "200000 100000")
+	expectFile(filepath.Join(repoDir, "memory.max"), "1073741824")
+	expectFile(filepath.Join(repoDir, "run-1-build", "memory.max"), "134217728")
+	if _, err := os.Stat(filepath.Join(repoDir, "run-1-build", "cpu.max")); !os.IsNotExist(err) {
+		t.Errorf("Expected no CPU limit on the step, got %v", err)
+	}
+
+	if cmd.SysProcAttr == nil || !cmd.SysProcAttr.UseCgroupFD {
+		t.Error("Expected the step to be started in its cgroup")
+	}
+}
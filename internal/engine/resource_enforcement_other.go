@@ -0,0 +1,14 @@
+//go:build !linux && !windows
+
+package engine
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newProcessLimiter reports that the resource limits of shell steps cannot be enforced on
+// this platform; they are still validated against the quotas of the resource manager.
+func newProcessLimiter() (processLimiter, error) {
+	return nil, fmt.Errorf("%w on %s", errLimitsUnsupported, runtime.GOOS)
+}
@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestProcessLimitsFromResources(t *testing.T) {
+	limits, err := processLimitsFromResources(&config.Resources{CPULimit: "500m", MemLimit: "256Mi"})
+	if err != nil {
+		t.Fatalf("processLimitsFromResources() failed: %v", err)
+	}
+	if limits.CPU != 0.5 {
+		t.Errorf("Expected 0.5 cores, got %v", limits.CPU)
+	}
+	if limits.MemoryBytes != 256*1024*1024 {
+		t.Errorf("Expected 256Mi in bytes, got %d", limits.MemoryBytes)
+	}
+
+	if limits, err := processLimitsFromResources(nil); err != nil || !limits.IsZero() {
+		t.Errorf("Expected no limits without resources, got %+v, %v", limits, err)
+	}
+	if limits, err := processLimitsFromResources(&config.Resources{DiskLimit: "1Gi"}); err != nil || !limits.IsZero() {
+		t.Errorf("Expected disk limits not to be enforced on processes, got %+v, %v", limits, err)
+	}
+
+	if _, err := processLimitsFromResources(&config.Resources{MemLimit: "lots"}); err == nil || !strings.Contains(err.Error(), "invalid memory limit") {
+		t.Errorf("Expected an invalid memory limit error, got %v", err)
+	}
+}
+
+func TestConfinementName(t *testing.T) {
+	testCases := map[string]string{
+		"":                 "default",
+		"owner/repo":       "owner_repo",
+		"run-1-../escape":  "run-1-__escape",
+		`owner\repo:main`:  "owner_repo_main",
+		"exec-20240726-ab": "exec-20240726-ab",
+	}
+	for name, expected := range testCases {
+		if got := confinementName(name); got != expected {
+			t.Errorf("confinementName(%q) = %q, want %q", name, got, expected)
+		}
+	}
+}
+
+func TestNilConfinement(t *testing.T) {
+	var c *confinement
+	if err := c.Started(1); err != nil {
+		t.Errorf("Started() on a nil confinement failed: %v", err)
+	}
+	if err := c.Exceeded(); err != nil {
+		t.Errorf("Exceeded() on a nil confinement = %v", err)
+	}
+	c.Release()
+}
+
+func TestRunnerShellStepResources(t *testing.T) {
+	result, err := runParallelWorkflow(t, `  test:
+    resources:
+      cpu_limit: "2"
+      mem_limit: "1Gi"
+    steps:
+      - id: limited
+        run: echo limited-ok
+        resources:
+          cpu_limit: "500m"
+          mem_limit: "256Mi"
+        produces:
+          outputs:
+            status: from_stdout
+`)
+	if err != nil {
+		t.Fatalf("Expected the limited step to succeed, got %v", err)
+	}
+	if got := result.Steps[0].Outputs["status"]; got != "limited-ok" {
+		t.Errorf("Expected the step output, got %q", got)
+	}
+
+	_, err = runParallelWorkflow(t, `  test:
+    steps:
+      - id: greedy
+        run: echo never
+        resources:
+          mem_limit: "64Gi"
+`)
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit") {
+		t.Errorf("Expected a step exceeding the repository quota to fail, got %v", err)
+	}
+}
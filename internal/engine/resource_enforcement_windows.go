@@ -0,0 +1,207 @@
+package engine
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procSetInformationJobObject  = kernel32.NewProc("SetInformationJobObject")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+)
+
+const (
+	jobObjectExtendedLimitInformation  = 9
+	jobObjectCPURateControlInformation = 15
+
+	jobObjectLimitJobMemory      = 0x00000200
+	jobObjectLimitKillOnJobClose = 0x00002000
+
+	jobObjectCPURateControlEnable  = 0x1
+	jobObjectCPURateControlHardCap = 0x4
+
+	processSetQuota  = 0x0100
+	processTerminate = 0x0001
+)
+
+// jobObjectBasicLimitInformation mirrors JOBOBJECT_BASIC_LIMIT_INFORMATION.
+type jobObjectBasicLimitInformation struct {
+	PerProcessUserTimeLimit int64
+	PerJobUserTimeLimit     int64
+	LimitFlags              uint32
+	MinimumWorkingSetSize   uintptr
+	MaximumWorkingSetSize   uintptr
+	ActiveProcessLimit      uint32
+	Affinity                uintptr
+	PriorityClass           uint32
+	SchedulingClass         uint32
+}
+
+// jobObjectExtendedLimitInfo mirrors JOBOBJECT_EXTENDED_LIMIT_INFORMATION.
+type jobObjectExtendedLimitInfo struct {
+	BasicLimitInformation jobObjectBasicLimitInformation
+	IoInfo                [6]uint64
+	ProcessMemoryLimit    uintptr
+	JobMemoryLimit        uintptr
+	PeakProcessMemoryUsed uintptr
+	PeakJobMemoryUsed     uintptr
+}
+
+// jobObjectCPURateControl mirrors JOBOBJECT_CPU_RATE_CONTROL_INFORMATION.
+type jobObjectCPURateControl struct {
+	ControlFlags uint32
+	CPURate      uint32
+}
+
+// jobObjectLimiter enforces limits with job objects. Each step gets a job nested in the job of
+// its repository, which bounds all the steps of the repository that run in this process.
+type jobObjectLimiter struct {
+	mu       sync.Mutex
+	repoJobs map[string]syscall.Handle
+}
+
+// newProcessLimiter returns the job object limiter.
+func newProcessLimiter() (processLimiter, error) {
+	if err := procCreateJobObjectW.Find(); err != nil {
+		return nil, fmt.Errorf("%w: job objects are not available: %v", errLimitsUnsupported, err)
+	}
+	return &jobObjectLimiter{repoJobs: make(map[string]syscall.Handle)}, nil
+}
+
+// Confine implements processLimiter. Processes can only be assigned to a job once they exist,
+// so processes the step starts before Started is called are not confined.
+func (l *jobObjectLimiter) Confine(_ *exec.Cmd, repoName, stepID string, step, repo ProcessLimits) (*confinement, error) {
+	repoJob, err := l.repositoryJob(repoName, repo)
+	if err != nil {
+		return nil, err
+	}
+
+	stepJob, err := createJobObject(step, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create job object for step %s: %w", stepID, err)
+	}
+
+	return &confinement{
+		started: func(pid int) error {
+			process, err := syscall.OpenProcess(processSetQuota|processTerminate, false, uint32(pid))
+			if err != nil {
+				return fmt.Errorf("failed to open process %d: %w", pid, err)
+			}
+			defer syscall.CloseHandle(process)
+
+			// Assigning the process to the step job second nests the step job in the repository job
+			if err := assignProcessToJobObject(repoJob, process); err != nil {
+				return fmt.Errorf("failed to assign process to the job of repository %s: %w", repoName, err)
+			}
+			if err := assignProcessToJobObject(stepJob, process); err != nil {
+				return fmt.Errorf("failed to assign process to the job of step %s: %w", stepID, err)
+			}
+			return nil
+		},
+		release: func() {
+			// The step job kills the processes it still holds when it is closed
+			syscall.CloseHandle(stepJob)
+		},
+	}, nil
+}
+
+// repositoryJob returns the job shared by the steps of a repository, updating its limits.
+func (l *jobObjectLimiter) repositoryJob(repoName string, limits ProcessLimits) (syscall.Handle, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if job, exists := l.repoJobs[repoName]; exists {
+		if !limits.IsZero() {
+			if err := setJobObjectLimits(job, limits, false); err != nil {
+				return 0, fmt.Errorf("failed to set limits of repository %s: %w", repoName, err)
+			}
+		}
+		return job, nil
+	}
+
+	job, err := createJobObject(limits, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create job object for repository %s: %w", repoName, err)
+	}
+	l.repoJobs[repoName] = job
+	return job, nil
+}
+
+// createJobObject creates an anonymous job object with the given limits.
+func createJobObject(limits ProcessLimits, killOnClose bool) (syscall.Handle, error) {
+	handle, _, err := procCreateJobObjectW.Call(0, 0)
+	if handle == 0 {
+		return 0, err
+	}
+	job := syscall.Handle(handle)
+
+	if err := setJobObjectLimits(job, limits, killOnClose); err != nil {
+		syscall.CloseHandle(job)
+		return 0, err
+	}
+	return job, nil
+}
+
+// setJobObjectLimits applies memory and CPU rate limits to a job object.
+func setJobObjectLimits(job syscall.Handle, limits ProcessLimits, killOnClose bool) error {
+	var info jobObjectExtendedLimitInfo
+	if killOnClose {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitKillOnJobClose
+	}
+	if limits.MemoryBytes > 0 {
+		info.BasicLimitInformation.LimitFlags |= jobObjectLimitJobMemory
+		info.JobMemoryLimit = uintptr(limits.MemoryBytes)
+	}
+	if info.BasicLimitInformation.LimitFlags != 0 {
+		if err := setInformationJobObject(job, jobObjectExtendedLimitInformation, unsafe.Pointer(&info), unsafe.Sizeof(info)); err != nil {
+			return err
+		}
+	}
+
+	if limits.CPU > 0 {
+		control := jobObjectCPURateControl{
+			ControlFlags: jobObjectCPURateControlEnable | jobObjectCPURateControlHardCap,
+			CPURate:      cpuRate(limits.CPU, runtime.NumCPU()),
+		}
+		if err := setInformationJobObject(job, jobObjectCPURateControlInformation, unsafe.Pointer(&control), unsafe.Sizeof(control)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cpuRate converts a limit in cores into the share of all processors, in hundredths of a
+// percent, that job objects are limited to.
+func cpuRate(cores float64, numCPU int) uint32 {
+	rate := uint32(cores / float64(numCPU) * 10000)
+	if rate < 1 {
+		rate = 1
+	}
+	if rate > 10000 {
+		rate = 10000
+	}
+	return rate
+}
+
+func setInformationJobObject(job syscall.Handle, class uint32, info unsafe.Pointer, size uintptr) error {
+	ok, _, err := procSetInformationJobObject.Call(uintptr(job), uintptr(class), uintptr(info), size)
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
+
+func assignProcessToJobObject(job, process syscall.Handle) error {
+	ok, _, err := procAssignProcessToJobObject.Call(uintptr(job), uintptr(process))
+	if ok == 0 {
+		return err
+	}
+	return nil
+}
@@ -239,22 +239,26 @@ func parseCPUSpec(spec string) (*ResourceLimit, error) {
 
 // parseMemorySpec parses memory/disk resource specifications.
 func parseMemorySpec(spec string, resourceType ResourceType) (*ResourceLimit, error) {
-	// Define unit multipliers (to bytes)
-	unitMultipliers := map[string]float64{
-		"B":   1,
-		"KB":  1000,
-		"MB":  1000 * 1000,
-		"GB":  1000 * 1000 * 1000,
-		"Ki":  1024,
-		"Mi":  1024 * 1024,
-		"Gi":  1024 * 1024 * 1024,
-		"KiB": 1024,
-		"MiB": 1024 * 1024,
-		"GiB": 1024 * 1024 * 1024,
+	// Define unit multipliers (to bytes), longest suffixes first so that "MB" is not read as "B"
+	unitMultipliers := []struct {
+		suffix     string
+		multiplier float64
+	}{
+		{"KiB", 1024},
+		{"MiB", 1024 * 1024},
+		{"GiB", 1024 * 1024 * 1024},
+		{"KB", 1000},
+		{"MB", 1000 * 1000},
+		{"GB", 1000 * 1000 * 1000},
+		{"Ki", 1024},
+		{"Mi", 1024 * 1024},
+		{"Gi", 1024 * 1024 * 1024},
+		{"B", 1},
 	}
 
 	// Try to match unit suffixes
-	for suffix, multiplier := range unitMultipliers {
+	for _, unit := range unitMultipliers {
+		suffix, multiplier := unit.suffix, unit.multiplier
 		if strings.HasSuffix(spec, suffix) {
 			valueStr := strings.TrimSuffix(spec, suffix)
 			value, err := strconv.ParseFloat(valueStr, 64)
@@ -73,6 +73,18 @@ func TestParseResourceSpec(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name:         "Memory gibibytes with B suffix",
+			spec:         "1GiB",
+			resourceType: ResourceTypeMemory,
+			want: &ResourceLimit{
+				Type:         ResourceTypeMemory,
+				Value:        1024,
+				Unit:         UnitMegabytes,
+				OriginalSpec: "1GiB",
+			},
+			wantErr: false,
+		},
 		{
 			name:         "Memory no unit",
 			spec:         "1024",
@@ -0,0 +1,396 @@
+package engine
+
+import (
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/cache"
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// Default retentions of the artifacts of finished runs.
+const (
+	DefaultStateRetention     = 7 * 24 * time.Hour
+	DefaultWorkspaceRetention = 24 * time.Hour
+	DefaultLogRetention       = 30 * 24 * time.Hour
+	DefaultHistoryRetention   = 90 * 24 * time.Hour
+)
+
+// DefaultCompactionInterval is how long the compaction at start waits after the last compaction
+// of the cache, by any process, before compacting again.
+const DefaultCompactionInterval = time.Hour
+
+// RetentionPolicies are how long the artifacts of finished runs are kept after their last update,
+// by artifact type; zero keeps them forever.
+type RetentionPolicies struct {
+	// States are the execution states of child runs and the states of fan-outs, but those of
+	// idempotent fan-outs that keep their idempotency retention.
+	States time.Duration
+	// Workspaces are the files left in the workspaces of runs, but their logs and reports.
+	Workspaces time.Duration
+	// Logs are the step logs and execution reports of runs.
+	Logs time.Duration
+	// History are the records of the execution history.
+	History time.Duration
+}
+
+// DefaultRetentionPolicies returns the default retentions of the artifacts of finished runs.
+func DefaultRetentionPolicies() RetentionPolicies {
+	return RetentionPolicies{
+		States:     DefaultStateRetention,
+		Workspaces: DefaultWorkspaceRetention,
+		Logs:       DefaultLogRetention,
+		History:    DefaultHistoryRetention,
+	}
+}
+
+// RetentionOptions configure the compaction of the artifacts of finished runs by a runner.
+type RetentionOptions struct {
+	Policies RetentionPolicies
+	// CompactOnStart compacts the artifacts in the background when the runner starts, unless
+	// they were compacted within DefaultCompactionInterval.
+	CompactOnStart bool
+}
+
+// NewRetentionOptions returns the retention options of the user configuration: the default
+// retention policies with the retentions that are set replacing them.
+func NewRetentionOptions(cfg *config.UserConfig) (RetentionOptions, error) {
+	opts := RetentionOptions{Policies: DefaultRetentionPolicies()}
+	if cfg.Retention == nil {
+		return opts, nil
+	}
+	opts.CompactOnStart = cfg.Retention.CompactOnStart
+	for _, retention := range []struct {
+		name  string
+		value string
+		field *time.Duration
+	}{
+		{"states", cfg.Retention.States, &opts.Policies.States},
+		{"workspaces", cfg.Retention.Workspaces, &opts.Policies.Workspaces},
+		{"logs", cfg.Retention.Logs, &opts.Policies.Logs},
+		{"history", cfg.Retention.History, &opts.Policies.History},
+	} {
+		if retention.value == "" {
+			continue
+		}
+		duration, err := time.ParseDuration(retention.value)
+		if err != nil {
+			return RetentionOptions{}, fmt.Errorf("invalid retention %s '%s': %v", retention.name, retention.value, err)
+		}
+		*retention.field = duration
+	}
+	return opts, nil
+}
+
+// CompactionReport counts the artifacts a compaction removed.
+type CompactionReport struct {
+	ExecutionStates int `json:"execution_states"`
+	FanOutStates    int `json:"fan_out_states"`
+	Locks           int `json:"locks"`
+	Workspaces      int `json:"workspaces"`
+	Logs            int `json:"logs"`
+	HistoryRecords  int `json:"history_records"`
+	// Freed is the number of bytes freed.
+	Freed int64 `json:"freed"`
+}
+
+// RetentionManager compacts the artifacts of finished runs that accumulate in a cache directory
+// and a workspace root: it removes those older than their retention policy, and the stale locks
+// of dead processes. The artifacts of runs in progress are never removed.
+type RetentionManager struct {
+	cacheDir      string
+	workspaceRoot string
+	policies      RetentionPolicies
+	clock         Clock
+}
+
+// NewRetentionManager creates the retention manager of a cache directory and a workspace root.
+func NewRetentionManager(cacheDir, workspaceRoot string, policies RetentionPolicies) *RetentionManager {
+	return &RetentionManager{cacheDir: cacheDir, workspaceRoot: workspaceRoot, policies: policies}
+}
+
+// SetClock sets the clock telling the age of the artifacts. Used for testing.
+func (m *RetentionManager) SetClock(clock Clock) {
+	m.clock = clock
+}
+
+// Compact removes the artifacts older than their retention policy.
+func (m *RetentionManager) Compact() (CompactionReport, error) {
+	c := &compaction{policies: m.policies, now: clockOrSystem(m.clock).Now()}
+
+	if m.policies.States > 0 {
+		stateDir := filepath.Join(m.cacheDir, "fanout-states")
+		before, _ := cache.DirSize(stateDir)
+		states, err := NewFanOutStateManager(stateDir)
+		if err != nil {
+			return c.report, err
+		}
+		states.SetClock(m.clock)
+		c.report.FanOutStates, err = states.cleanupCompletedStates(m.policies.States)
+		after, _ := cache.DirSize(stateDir)
+		c.report.Freed += max(before-after, 0)
+		if err != nil {
+			return c.report, err
+		}
+	}
+
+	if m.policies.History > 0 {
+		history, err := NewHistoryStore(m.cacheDir)
+		if err != nil {
+			return c.report, err
+		}
+		before, _ := cache.DirSize(history.path)
+		c.report.HistoryRecords, err = history.Compact(c.now.Add(-m.policies.History))
+		after, _ := cache.DirSize(history.path)
+		c.report.Freed += max(before-after, 0)
+		if err != nil {
+			return c.report, err
+		}
+	}
+
+	err := c.compactWorkspaceRoot(m.workspaceRoot, false)
+	return c.report, err
+}
+
+// CompactIfDue compacts the artifacts unless they were compacted, by any process sharing the
+// cache, within an interval. It reports whether it compacted them.
+func (m *RetentionManager) CompactIfDue(interval time.Duration) (CompactionReport, bool, error) {
+	marker := filepath.Join(m.cacheDir, "retention", "compacted")
+	now := clockOrSystem(m.clock).Now()
+	if info, err := os.Stat(marker); err == nil && now.Sub(info.ModTime()) < interval {
+		return CompactionReport{}, false, nil
+	}
+
+	// The marker is updated first, so that processes starting meanwhile do not compact too
+	if err := os.MkdirAll(filepath.Dir(marker), 0755); err != nil {
+		return CompactionReport{}, false, fmt.Errorf("failed to create retention directory: %v", err)
+	}
+	if err := os.WriteFile(marker, nil, 0644); err != nil {
+		return CompactionReport{}, false, fmt.Errorf("failed to record compaction: %v", err)
+	}
+	if err := os.Chtimes(marker, now, now); err != nil {
+		return CompactionReport{}, false, fmt.Errorf("failed to record compaction: %v", err)
+	}
+	report, err := m.Compact()
+	return report, true, err
+}
+
+// compaction is a compaction in progress.
+type compaction struct {
+	policies RetentionPolicies
+	now      time.Time
+	report   CompactionReport
+}
+
+// expired reports whether an artifact last updated at a time is older than its retention.
+func (c *compaction) expired(updated time.Time, retention time.Duration) bool {
+	return retention > 0 && c.now.Sub(updated) > retention
+}
+
+// remove removes a file or directory, counting the bytes it frees.
+func (c *compaction) remove(path string) error {
+	size, _ := cache.DirSize(path)
+	if err := os.RemoveAll(path); err != nil {
+		return fmt.Errorf("failed to remove %s: %v", path, err)
+	}
+	c.report.Freed += size
+	return nil
+}
+
+// compactWorkspaceRoot compacts the run workspaces, locks and child workspace roots of a
+// workspace root. The execution state of a child workspace root is removed once expired, and
+// the child workspace root once empty and older than the workspace retention; a top-level root
+// keeps its state, the next run replacing it.
+func (c *compaction) compactWorkspaceRoot(root string, child bool) error {
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read workspaces: %v", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return fmt.Errorf("failed to read workspaces: %v", err)
+	}
+	state := readExecutionStateFile(filepath.Join(root, "state", "execution.json"))
+	active := state != nil && (state.Status == StatusPending || state.Status == StatusRunning)
+
+	for _, entry := range entries {
+		path := filepath.Join(root, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		switch entry.Name() {
+		case "state":
+		case "locks":
+			removed, err := (&LockManager{lockDir: path}).cleanupStaleLocks()
+			c.report.Locks += removed
+			if err != nil {
+				return err
+			}
+		case "children":
+			children, err := os.ReadDir(path)
+			if err != nil {
+				return fmt.Errorf("failed to read child workspaces: %v", err)
+			}
+			for _, childEntry := range children {
+				if childEntry.IsDir() {
+					if err := c.compactWorkspaceRoot(filepath.Join(path, childEntry.Name()), true); err != nil {
+						return err
+					}
+				}
+			}
+		default:
+			if active && entry.Name() == state.RunID {
+				continue
+			}
+			if err := c.compactRunWorkspace(path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if !child || active {
+		return nil
+	}
+	stateFile := filepath.Join(root, "state", "execution.json")
+	if info, err := os.Stat(stateFile); err == nil && c.expired(info.ModTime(), c.policies.States) {
+		if err := c.remove(stateFile); err != nil {
+			return err
+		}
+		c.report.ExecutionStates++
+	}
+	// A child workspace root being created holds no files yet either
+	if !c.expired(info.ModTime(), c.policies.Workspaces) {
+		return nil
+	}
+	if empty, err := holdsNoFiles(root); err == nil && empty {
+		return os.RemoveAll(root)
+	}
+	return nil
+}
+
+// compactRunWorkspace removes the files of the workspace of a finished run once the workspace
+// retention expired, and its logs and reports once the log retention expired. Their age is the
+// last time any of them was updated.
+func (c *compaction) compactRunWorkspace(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return fmt.Errorf("failed to read workspace %s: %v", path, err)
+	}
+	var files, logs []string
+	for _, entry := range entries {
+		if (entry.Name() == "logs" && entry.IsDir()) || strings.HasPrefix(entry.Name(), "report.") {
+			logs = append(logs, filepath.Join(path, entry.Name()))
+		} else {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	for _, artifact := range []struct {
+		paths     []string
+		retention time.Duration
+		count     *int
+	}{
+		{files, c.policies.Workspaces, &c.report.Workspaces},
+		{logs, c.policies.Logs, &c.report.Logs},
+	} {
+		if len(artifact.paths) == 0 {
+			continue
+		}
+		updated, err := lastModified(artifact.paths)
+		if err != nil || !c.expired(updated, artifact.retention) {
+			continue
+		}
+		for _, artifactPath := range artifact.paths {
+			if err := c.remove(artifactPath); err != nil {
+				return err
+			}
+		}
+		*artifact.count++
+	}
+
+	if remaining, err := os.ReadDir(path); err == nil && len(remaining) == 0 {
+		return os.Remove(path)
+	}
+	return nil
+}
+
+// readExecutionStateFile reads an execution state file, returning nil when it cannot be read.
+func readExecutionStateFile(path string) *ExecutionState {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var state ExecutionState
+	if err := decodeExecutionState(data, &state); err != nil {
+		slog.Warn("skipping unreadable execution state", "file", path, "error", err)
+		return nil
+	}
+	return &state
+}
+
+// lastModified returns the last time any of the files under paths was modified.
+func lastModified(paths []string) (time.Time, error) {
+	var last time.Time
+	for _, path := range paths {
+		err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			if info.ModTime().After(last) {
+				last = info.ModTime()
+			}
+			return nil
+		})
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+	return last, nil
+}
+
+// holdsNoFiles reports whether a directory only holds directories without files.
+func holdsNoFiles(dir string) (bool, error) {
+	empty := true
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			empty = false
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	return empty, err
+}
+
+// compactOnStart compacts the artifacts of finished runs in the background, unless they were
+// compacted within DefaultCompactionInterval. Close waits for the compaction to finish.
+func (r *Runner) compactOnStart(policies RetentionPolicies) {
+	manager := NewRetentionManager(r.cacheDir, r.workspaceRoot, policies)
+	manager.SetClock(r.clock)
+	r.compacted = make(chan struct{})
+	go func() {
+		defer close(r.compacted)
+		report, compacted, err := manager.CompactIfDue(DefaultCompactionInterval)
+		if err != nil {
+			slog.Warn("failed to compact finished runs", "error", err)
+		}
+		if compacted {
+			slog.Debug("compacted finished runs", "execution_states", report.ExecutionStates, "fan_out_states", report.FanOutStates,
+				"locks", report.Locks, "workspaces", report.Workspaces, "logs", report.Logs, "history_records", report.HistoryRecords, "freed", report.Freed)
+		}
+	}()
+}
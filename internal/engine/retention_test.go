@@ -0,0 +1,168 @@
+package engine
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestNewRetentionOptions(t *testing.T) {
+	opts, err := NewRetentionOptions(&config.UserConfig{})
+	if err != nil || opts != (RetentionOptions{Policies: DefaultRetentionPolicies()}) {
+		t.Fatalf("expected the default policies without retention settings, got %+v, %v", opts, err)
+	}
+
+	opts, err = NewRetentionOptions(&config.UserConfig{Retention: &config.RetentionSettings{States: "72h", Logs: "0", CompactOnStart: true}})
+	if err != nil {
+		t.Fatalf("NewRetentionOptions failed: %v", err)
+	}
+	expected := DefaultRetentionPolicies()
+	expected.States, expected.Logs = 72*time.Hour, 0
+	if opts.Policies != expected || !opts.CompactOnStart {
+		t.Errorf("expected the settings to replace the defaults, got %+v", opts)
+	}
+}
+
+func TestRetentionManager_Compact(t *testing.T) {
+	cacheDir, workspaceRoot := t.TempDir(), t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	writeFile := func(path string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte("data"), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	age := func(path string) {
+		t.Helper()
+		err := filepath.WalkDir(path, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Chtimes(path, old, old)
+		})
+		if err != nil {
+			t.Fatalf("Failed to age %s: %v", path, err)
+		}
+	}
+	newState := func(root, runID string, finish bool) {
+		t.Helper()
+		state, err := NewExecutionState(runID, root)
+		if err != nil {
+			t.Fatalf("Failed to create state: %v", err)
+		}
+		if err := state.StartExecution("build", "org/app", nil); err != nil {
+			t.Fatalf("Failed to start execution: %v", err)
+		}
+		if finish {
+			if err := state.CompleteExecution(); err != nil {
+				t.Fatalf("Failed to complete execution: %v", err)
+			}
+		}
+	}
+
+	// The workspace of a failed run kept for debugging, with recent logs
+	writeFile(filepath.Join(workspaceRoot, "exec-failed", "app", "main.go"))
+	age(filepath.Join(workspaceRoot, "exec-failed", "app"))
+	writeFile(filepath.Join(workspaceRoot, "exec-failed", "logs", "build.log"))
+	// The logs and report of a finished run
+	writeFile(filepath.Join(workspaceRoot, "exec-done", "logs", "build.log"))
+	writeFile(filepath.Join(workspaceRoot, "exec-done", "report.json"))
+	age(filepath.Join(workspaceRoot, "exec-done"))
+	// The state of the top-level root, which the next run replaces
+	newState(workspaceRoot, "exec-done", true)
+	age(filepath.Join(workspaceRoot, "state"))
+	// A finished child run and a child run in progress
+	finished := filepath.Join(workspaceRoot, "children", "exec-child")
+	newState(finished, "exec-child", true)
+	writeFile(filepath.Join(finished, "exec-child", "logs", "build.log"))
+	age(finished)
+	running := filepath.Join(workspaceRoot, "children", "exec-running")
+	newState(running, "exec-running", false)
+	writeFile(filepath.Join(running, "exec-running", "app", "main.go"))
+	age(running)
+	// A lock of a dead process
+	writeFile(filepath.Join(workspaceRoot, "locks", "org_app_write.lock"))
+
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("Failed to create history: %v", err)
+	}
+	for _, record := range []HistoryRecord{{RunID: "exec-old", EndTime: old}, {RunID: "exec-new", EndTime: time.Now()}} {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("Failed to append record: %v", err)
+		}
+	}
+	clock := NewFakeClock(old)
+	states, err := NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("Failed to create state manager: %v", err)
+	}
+	states.SetClock(clock)
+	fanOut, err := states.CreateFanOutState("fanout-old", "", "org/lib", "released", false, 0)
+	if err != nil {
+		t.Fatalf("Failed to create state: %v", err)
+	}
+	if err := fanOut.CompleteFanOut(); err != nil {
+		t.Fatalf("Failed to complete fan-out: %v", err)
+	}
+
+	policies := RetentionPolicies{States: 24 * time.Hour, Workspaces: 24 * time.Hour, Logs: 24 * time.Hour, History: 24 * time.Hour}
+	report, err := NewRetentionManager(cacheDir, workspaceRoot, policies).Compact()
+	if err != nil {
+		t.Fatalf("Compact failed: %v", err)
+	}
+	expected := CompactionReport{ExecutionStates: 1, FanOutStates: 1, Locks: 1, Workspaces: 1, Logs: 2, HistoryRecords: 1, Freed: report.Freed}
+	if report != expected || report.Freed == 0 {
+		t.Errorf("expected %+v, got %+v", expected, report)
+	}
+
+	for path, kept := range map[string]bool{
+		filepath.Join(workspaceRoot, "exec-failed", "app"):               false,
+		filepath.Join(workspaceRoot, "exec-failed", "logs", "build.log"): true,
+		filepath.Join(workspaceRoot, "exec-done"):                        false,
+		filepath.Join(workspaceRoot, "state", "execution.json"):          true,
+		finished: false,
+		filepath.Join(running, "exec-running", "app", "main.go"):    true,
+		filepath.Join(running, "state", "execution.json"):           true,
+		filepath.Join(workspaceRoot, "locks", "org_app_write.lock"): false,
+		filepath.Join(cacheDir, "fanout-states", "fanout-old.json"): false,
+	} {
+		if _, err := os.Stat(path); (err == nil) != kept {
+			t.Errorf("expected %s to be kept: %v, got %v", path, kept, err)
+		}
+	}
+	if records, _ := history.Query(HistoryFilter{}); len(records) != 1 || records[0].RunID != "exec-new" {
+		t.Errorf("expected the recent history record kept, got %+v", records)
+	}
+
+	// The compaction at start skips caches compacted within the interval
+	manager := NewRetentionManager(cacheDir, workspaceRoot, policies)
+	if _, compacted, err := manager.CompactIfDue(time.Hour); err != nil || !compacted {
+		t.Errorf("expected a first compaction at start, got %v, %v", compacted, err)
+	}
+	if _, compacted, err := manager.CompactIfDue(time.Hour); err != nil || compacted {
+		t.Errorf("expected the compaction at start to wait for the interval, got %v, %v", compacted, err)
+	}
+
+	// Runners compact at start when configured to, in the background until they are closed
+	startCache := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: workspaceRoot,
+		CacheDir:      startCache,
+		Retention:     RetentionOptions{Policies: policies, CompactOnStart: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	runner.Close()
+	if _, err := os.Stat(filepath.Join(startCache, "retention", "compacted")); err != nil {
+		t.Errorf("expected the runner to compact at start: %v", err)
+	}
+}
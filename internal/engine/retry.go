@@ -49,6 +49,7 @@ func DefaultRetryConfig() RetryConfig {
 type RetryableExecutor struct {
 	config RetryConfig
 	rand   *rand.Rand
+	clock  Clock // Clock the delays between attempts elapse on; the system clock when nil
 }
 
 // NewRetryableExecutor creates a new retryable executor with the given configuration.
@@ -59,6 +60,11 @@ func NewRetryableExecutor(config RetryConfig) *RetryableExecutor {
 	}
 }
 
+// SetClock sets the clock the delays between attempts elapse on.
+func (re *RetryableExecutor) SetClock(clock Clock) {
+	re.clock = clock
+}
+
 // Execute executes a function with retry logic.
 func (re *RetryableExecutor) Execute(ctx context.Context, fn func() error) error {
 	return re.ExecuteWithCallback(ctx, fn, nil)
@@ -102,7 +108,7 @@ func (re *RetryableExecutor) ExecuteWithCallback(ctx context.Context, fn func()
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(delay):
+		case <-clockOrSystem(re.clock).After(delay):
 			// Continue to next attempt
 		}
 	}
@@ -288,6 +294,12 @@ func NewResilientExecutor(cbConfig CircuitBreakerConfig, retryConfig RetryConfig
 	}
 }
 
+// SetClock sets the clock of the circuit breaker and of the delays between retries.
+func (re *ResilientExecutor) SetClock(clock Clock) {
+	re.circuitBreaker.SetClock(clock)
+	re.retryExecutor.SetClock(clock)
+}
+
 // Execute executes a function with both circuit breaker and retry protection.
 func (re *ResilientExecutor) Execute(ctx context.Context, fn func() error) error {
 	err := re.circuitBreaker.Call(func() error {
@@ -0,0 +1,282 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// RunTree is a run of an execution tree and the child workflows its fan-outs triggered, as
+// observed from the execution history, the execution states of the workspaces and the fan-out
+// states of the cache, while the tree runs or after it finished.
+type RunTree struct {
+	// RunID is empty for a child that has not started yet
+	RunID      string
+	Repository string
+	Workflow   string
+	Status     string
+	StartTime  time.Time
+	EndTime    time.Time // Zero while the run is not finished
+	Error      string
+	Inputs     map[string]string
+
+	// Steps are the steps that started, in the order they started
+	Steps []RunTreeStep
+
+	// LogDir is the directory of the logs of the steps; empty when none is known
+	LogDir string
+
+	// FanOutID is the fan-out that triggered the run; empty for the root of the tree
+	FanOutID string
+
+	Children []*RunTree
+}
+
+// RunTreeStep is a step of a run of an execution tree.
+type RunTreeStep struct {
+	ID       string
+	Status   string
+	Duration time.Duration
+	Error    string
+}
+
+// Finished reports whether the run reached a final status.
+func (t *RunTree) Finished() bool {
+	switch t.Status {
+	case string(StatusPending), string(StatusRunning), string(StatusWaitingForApproval), "":
+		return false
+	}
+	return true
+}
+
+// Failed reports whether the run finished without completing.
+func (t *RunTree) Failed() bool {
+	switch t.Status {
+	case string(StatusFailed), string(ChildStatusTimedOut), string(StatusCancelled), string(StatusInterrupted):
+		return true
+	}
+	return false
+}
+
+// runTreeSources are the records a run tree is built from, read once per load.
+type runTreeSources struct {
+	records    map[string]*HistoryRecord
+	executions map[string]*ExecutionState
+	logDirs    map[string]string // Log directories of the runs with an execution state
+	fanOuts    *FanOutStateManager
+	now        time.Time
+}
+
+// LoadRunTree loads the execution tree of a run from the cache directory and the workspace root
+// the run was executed in.
+func LoadRunTree(cacheDir, workspaceRoot, runID string) (*RunTree, error) {
+	sources, err := loadRunTreeSources(cacheDir, workspaceRoot)
+	if err != nil {
+		return nil, err
+	}
+	if sources.records[runID] == nil && sources.executions[runID] == nil {
+		return nil, fmt.Errorf("run %s not found", runID)
+	}
+	return sources.tree(runID, nil, make(map[string]bool)), nil
+}
+
+// LatestRunID returns the run that started last in a workspace root, running or finished, as
+// the root of an execution tree.
+func LatestRunID(cacheDir, workspaceRoot string) (string, error) {
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		return "", err
+	}
+	records, err := history.Query(HistoryFilter{})
+	if err != nil {
+		return "", err
+	}
+
+	var latest string
+	var latestStart time.Time
+	for _, record := range records {
+		if record.ParentRunID == "" {
+			latest, latestStart = record.RunID, record.StartTime
+			break
+		}
+	}
+	// The state of the workspace root is the one of the last run started in it
+	if state := readExecutionStateFile(filepath.Join(workspaceRoot, "state", "execution.json")); state != nil && state.RunID != "" &&
+		(latest == "" || state.StartTime.After(latestStart)) {
+		latest = state.RunID
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no runs found")
+	}
+	return latest, nil
+}
+
+// loadRunTreeSources reads the execution history, the fan-out states and the execution states of
+// the workspace root and of the child workspaces under it.
+func loadRunTreeSources(cacheDir, workspaceRoot string) (*runTreeSources, error) {
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		return nil, err
+	}
+	records, err := history.Query(HistoryFilter{})
+	if err != nil {
+		return nil, err
+	}
+	fanOuts, err := NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := &runTreeSources{
+		records:    make(map[string]*HistoryRecord, len(records)),
+		executions: make(map[string]*ExecutionState),
+		logDirs:    make(map[string]string),
+		fanOuts:    fanOuts,
+		now:        time.Now(),
+	}
+	// Records are the most recent first; a resumed run keeps its last record
+	for i := range records {
+		if _, ok := sources.records[records[i].RunID]; !ok {
+			sources.records[records[i].RunID] = &records[i]
+		}
+	}
+	sources.readExecutionStates(workspaceRoot)
+	return sources, nil
+}
+
+// readExecutionStates reads the execution state of a workspace root, and those of the child
+// workspace roots under it.
+func (s *runTreeSources) readExecutionStates(root string) {
+	if state := readExecutionStateFile(filepath.Join(root, "state", "execution.json")); state != nil && state.RunID != "" {
+		s.executions[state.RunID] = state
+		s.logDirs[state.RunID] = filepath.Join(root, state.RunID, "logs")
+	}
+	children, err := os.ReadDir(filepath.Join(root, "children"))
+	if err != nil {
+		return
+	}
+	for _, child := range children {
+		if child.IsDir() {
+			s.readExecutionStates(filepath.Join(root, "children", child.Name()))
+		}
+	}
+}
+
+// tree builds the tree of a run; child is the fan-out child that triggered it, nil for the root.
+func (s *runTreeSources) tree(runID string, child *ChildWorkflow, visited map[string]bool) *RunTree {
+	node := &RunTree{RunID: runID}
+	if child != nil {
+		node.Repository = child.Repository
+		node.Workflow = child.Workflow
+		node.Status = string(child.Status)
+		if child.Status == ChildStatusPending && child.Approval == ApprovalPending {
+			node.Status = string(StatusWaitingForApproval)
+		}
+		node.StartTime = child.StartTime
+		if child.EndTime != nil {
+			node.EndTime = *child.EndTime
+		}
+		node.Error = child.ErrorMessage
+		node.Inputs = child.Inputs
+	}
+	if runID == "" || visited[runID] {
+		return node
+	}
+	visited[runID] = true
+
+	// A live execution state is more recent than the record of an earlier attempt of the run
+	state := s.executions[runID]
+	record := s.records[runID]
+	switch {
+	case state != nil && (record == nil || state.Status == StatusRunning || state.Status == StatusPending):
+		s.applyExecutionState(node, state)
+	case record != nil:
+		applyHistoryRecord(node, record)
+	}
+
+	for _, fanOut := range s.fanOuts.FanOutsOfRun(runID) {
+		for _, fanOutChild := range fanOut.GetChildren() {
+			subtree := s.tree(fanOutChild.RunID, &fanOutChild, visited)
+			subtree.FanOutID = fanOut.ID
+			node.Children = append(node.Children, subtree)
+		}
+		if node.Repository == "" {
+			node.Repository = fanOut.SourceRepo
+		}
+	}
+	// The execution state only knows the path of the repository of a run
+	if node.Repository == "" && state != nil && state.Repository != "" {
+		node.Repository = filepath.Base(state.Repository)
+	}
+	return node
+}
+
+// applyExecutionState fills a run from its execution state.
+func (s *runTreeSources) applyExecutionState(node *RunTree, state *ExecutionState) {
+	if node.Workflow == "" {
+		node.Workflow = state.WorkflowName
+	}
+	if node.Inputs == nil {
+		node.Inputs = state.Inputs
+	}
+	node.Status = string(state.Status)
+	if state.WaitingForApproval() {
+		node.Status = string(StatusWaitingForApproval)
+	}
+	node.StartTime = state.StartTime
+	if state.EndTime != nil {
+		node.EndTime = *state.EndTime
+	}
+	if state.Error != "" {
+		node.Error = state.Error
+	}
+	node.LogDir = s.logDirs[state.RunID]
+
+	steps := make([]*StepState, 0, len(state.Steps))
+	for _, step := range state.Steps {
+		steps = append(steps, step)
+	}
+	sort.Slice(steps, func(i, j int) bool {
+		a, b := steps[i], steps[j]
+		switch {
+		case a.StartTime == nil || b.StartTime == nil:
+			return a.StartTime != nil && b.StartTime == nil
+		case !a.StartTime.Equal(*b.StartTime):
+			return a.StartTime.Before(*b.StartTime)
+		}
+		return a.ID < b.ID
+	})
+	for _, step := range steps {
+		treeStep := RunTreeStep{ID: step.ID, Status: string(step.Status), Error: step.Error}
+		if step.StartTime != nil {
+			end := s.now
+			if step.EndTime != nil {
+				end = *step.EndTime
+			}
+			treeStep.Duration = end.Sub(*step.StartTime)
+		}
+		node.Steps = append(node.Steps, treeStep)
+	}
+}
+
+// applyHistoryRecord fills a run from its record in the execution history.
+func applyHistoryRecord(node *RunTree, record *HistoryRecord) {
+	if node.Workflow == "" {
+		node.Workflow = record.Workflow
+	}
+	if node.Repository == "" {
+		node.Repository = record.Repository
+	}
+	node.Status = record.Status
+	node.StartTime = record.StartTime
+	node.EndTime = record.EndTime
+	if record.Error != "" {
+		node.Error = record.Error
+	}
+	node.LogDir = record.LogDir
+	for _, step := range record.Steps {
+		node.Steps = append(node.Steps, RunTreeStep{ID: step.ID, Status: step.Status, Duration: step.Duration})
+	}
+}
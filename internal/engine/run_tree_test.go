@@ -0,0 +1,141 @@
+package engine
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRunTree(t *testing.T) {
+	cacheDir := t.TempDir()
+	workspaceRoot := t.TempDir()
+	now := time.Now()
+
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("NewHistoryStore() error = %v", err)
+	}
+	records := []HistoryRecord{
+		{RunID: "exec-root", Repository: "org/lib", Workflow: "release", Status: HistoryStatusFailed, StartTime: now.Add(-time.Minute), EndTime: now,
+			Steps: []HistoryStep{{ID: "build", Status: HistoryStepSucceeded}, {ID: "publish", Status: HistoryStepFailed}}},
+		{RunID: "exec-app", ParentRunID: "exec-root", Repository: "org/app", Workflow: "update", Status: HistoryStatusFailed, Error: "tests failed",
+			StartTime: now.Add(-time.Minute), EndTime: now},
+	}
+	for _, record := range records {
+		if err := history.Append(record); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	// The fan-out of the root triggered a failed child, a running one and one not started yet
+	states, err := NewFanOutStateManager(filepath.Join(cacheDir, "fanout-states"))
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	fanOut, err := states.CreateFanOutState("fanout-1", "exec-root", "org/lib", "library_built", true, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateFanOutState() error = %v", err)
+	}
+	fanOut.AddChildWorkflow("org/app", "update", map[string]string{"version": "1.0"})
+	fanOut.AddChildWorkflow("org/deploy", "deploy", nil)
+	fanOut.AddChildWorkflow("org/docs", "publish", nil)
+	if err := fanOut.UpdateChildStatus("org/app", "update", ChildStatusFailed, "exec-app", "tests failed"); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+	if err := fanOut.UpdateChildStatus("org/deploy", "deploy", ChildStatusRunning, "exec-deploy", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+
+	// The running child only has its execution state, in its child workspace root
+	childRoot := filepath.Join(workspaceRoot, "children", "exec-deploy")
+	state, err := NewExecutionState("exec-deploy", childRoot)
+	if err != nil {
+		t.Fatalf("NewExecutionState() error = %v", err)
+	}
+	if err := state.StartExecution("deploy", filepath.Join(cacheDir, "repos", "org", "deploy", "main"), nil); err != nil {
+		t.Fatalf("StartExecution() error = %v", err)
+	}
+	if err := state.StartStep("rollout"); err != nil {
+		t.Fatalf("StartStep() error = %v", err)
+	}
+
+	tree, err := LoadRunTree(cacheDir, workspaceRoot, "exec-root")
+	if err != nil {
+		t.Fatalf("LoadRunTree() error = %v", err)
+	}
+	if tree.Repository != "org/lib" || tree.Status != HistoryStatusFailed || len(tree.Steps) != 2 || !tree.Failed() {
+		t.Errorf("unexpected root: %+v", tree)
+	}
+	if len(tree.Children) != 3 {
+		t.Fatalf("expected 3 children, got %+v", tree.Children)
+	}
+	app, deploy, docs := tree.Children[0], tree.Children[1], tree.Children[2]
+	if app.RunID != "exec-app" || app.Status != HistoryStatusFailed || app.Inputs["version"] != "1.0" || app.FanOutID != "fanout-1" {
+		t.Errorf("unexpected failed child: %+v", app)
+	}
+	if deploy.Status != string(StatusRunning) || deploy.Finished() || len(deploy.Steps) != 1 || deploy.Steps[0].ID != "rollout" ||
+		deploy.LogDir != filepath.Join(childRoot, "exec-deploy", "logs") {
+		t.Errorf("unexpected running child: %+v", deploy)
+	}
+	if docs.RunID != "" || docs.Status != string(ChildStatusPending) {
+		t.Errorf("unexpected pending child: %+v", docs)
+	}
+
+	if _, err := LoadRunTree(cacheDir, workspaceRoot, "exec-unknown"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected an unknown run to be rejected, got %v", err)
+	}
+	if latest, err := LatestRunID(cacheDir, workspaceRoot); err != nil || latest != "exec-root" {
+		t.Errorf("LatestRunID() = %q, %v; want exec-root", latest, err)
+	}
+}
+
+func TestLoadRunTreeOfExecution(t *testing.T) {
+	tempDir := t.TempDir()
+	workspaceRoot := filepath.Join(tempDir, "workspace")
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: workspaceRoot,
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+`)
+
+	result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+
+	// The fan-outs of a run are found from the run that emitted them
+	tree, err := LoadRunTree(runner.cacheDir, workspaceRoot, result.RunID)
+	if err != nil {
+		t.Fatalf("LoadRunTree() error = %v", err)
+	}
+	if len(tree.Children) != 1 || tree.Children[0].Repository != "test-org/app" || tree.Children[0].Status != string(ChildStatusCompleted) || tree.Children[0].FanOutID == "" {
+		t.Errorf("expected the child of the fan-out of the run, got %+v", tree.Children)
+	}
+}
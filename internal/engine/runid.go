@@ -4,6 +4,7 @@ import (
 	"crypto/md5"
 	"fmt"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -25,9 +26,15 @@ func GenerateRunID() string {
 	return fmt.Sprintf("exec-%s-%s", timestamp, shortHash)
 }
 
-// ParseRunID extracts components from a run ID
+// ParseRunID extracts components from a run ID, ignoring the namespace it records.
 // Returns timestamp, hash, and error if parsing fails.
 func ParseRunID(runID string) (time.Time, string, error) {
+	if namespace := RunIDNamespace(runID); namespace != "" {
+		if err := ValidateNamespace(namespace); err != nil {
+			return time.Time{}, "", fmt.Errorf("invalid run ID format: %s", runID)
+		}
+		runID = strings.TrimSuffix(runID, "."+namespace)
+	}
 	if len(runID) < 29 || runID[:5] != "exec-" {
 		return time.Time{}, "", fmt.Errorf("invalid run ID format: %s", runID)
 	}
@@ -1,12 +1,14 @@
 package engine
 
 import (
-	"bytes"
 	"context"
+	"crypto"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -14,6 +16,7 @@ import (
 	"time"
 
 	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/git"
 	"github.com/dangazineu/tako/internal/interfaces"
 )
 
@@ -26,6 +29,14 @@ const (
 	ExecutionModeDebug
 )
 
+var (
+	// ErrStepTimeout is the cause of contexts cancelled because a step exceeded its timeout.
+	ErrStepTimeout = errors.New("step timed out")
+
+	// ErrWorkflowTimeout is the cause of contexts cancelled because a workflow exceeded its timeout.
+	ErrWorkflowTimeout = errors.New("workflow timed out")
+)
+
 // ExecutionResult is now defined in the interfaces package.
 type ExecutionResult = interfaces.ExecutionResult
 
@@ -39,25 +50,118 @@ type Runner struct {
 	cacheDir      string
 
 	// Execution tree management
-	runID string
-	state *ExecutionState
-	locks *LockManager
+	runID          string
+	parentRunID    string
+	correlationID  string   // Shared by the runs of the execution tree
+	lineage        []string // repository:workflow of the runs from the root of the tree to this run
+	maxFanOutDepth int
+	namespace      string // Tenant of the run; empty for the default namespace
+	state          *ExecutionState
+	locks          *LockManager
+
+	// Budget of the child workflows of the execution tree, capped by the options or else by
+	// the execution configuration of the workflow's repository
+	childBudget      *ChildBudgetStore
+	maxTotalChildren int
+	executionConfig  *config.Execution
+
+	// Cancellation markers and approval gates shared through the cache directory
+	cancellations *CancellationManager
+	approvals     *ApprovalManager
+
+	// Workspace isolation
+	workspaces     *WorkspaceManager
+	cleanupManager *CleanupManager
 
 	// Template processing
 	templateEngine *TemplateEngine
+	conditions     *ConditionEvaluator
 
 	// Container management
 	containerManager *ContainerManager
+	containerErr     error         // Why no container runtime is available, when containerManager is nil
+	services         *ServiceGroup // Services of the running workflow, if any
 
 	// Resource management
-	resourceManager *ResourceManager
+	resourceManager   *ResourceManager
+	processLimiter    processLimiter // Nil when shell step limits cannot be enforced
+	processLimiterErr error
+	repoLimits        ProcessLimits // Aggregate limits of the running workflow's repository
 
 	// Orchestration
 	orchestrator *Orchestrator
+	gitManager   *GitManager
 
 	// Child workflow execution
 	childRunnerFactory  *ChildRunnerFactory
 	childWorkflowRunner interfaces.WorkflowRunner
+	backends            *BackendRegistry // Backends child workflows run on
+	backend             string           // Backend selected by the options; tako.yml's when empty
+
+	// Image of the steps without one, when the runner runs on the container backend
+	containerImage string
+
+	// Publisher of fan-out events to the sinks of tako.yml; nil when it has none
+	eventPublisher *EventPublisher
+	// Key signing fan-out events, from the signing section of tako.yml; nil when it has none
+	eventSigningKey []byte
+	// Payload schemas of the events of the repository, from the schemas section of tako.yml
+	eventSchemas []config.EventPayloadSchema
+	// Diamond strategies of the events of the repository, from the events section of tako.yml
+	diamondStrategies *config.EventsConfig
+
+	// Notification policies of the running workflow
+	notifications []NotificationPolicy
+
+	// Environment variables of the running workflow's steps, and the patterns of the host
+	// variables they inherit; nil patterns inherit the whole host environment
+	workflowEnv    map[string]string
+	envPassthrough []string
+
+	// Absolute paths of the artifacts of the repository, and the directory the running
+	// workflow's steps run in by default, relative to the repository
+	artifactPaths    map[string]string
+	workingDirectory string
+
+	// Artifacts the running workflow's tako/publish-artifact@v1 steps published, by name
+	publishedArtifacts map[string]PublishedArtifact
+	publishMu          sync.Mutex
+
+	// Shell that runs the commands of the running workflow's steps that do not choose one
+	shell string
+
+	// Inputs declared by the running workflow, whose types templates and conditions see
+	inputDefinitions map[string]config.WorkflowInput
+	repoPath         string // Directory of the running workflow's repository
+
+	// Circuit breakers of the child workflows of all the runner's fan-outs
+	circuitBreakers *CircuitBreakerManager
+
+	// Execution history completed runs are recorded in, with the children of the running workflow
+	history     *HistoryStore
+	repository  string // owner/repo of the run, when known from its repository specification
+	childCounts HistoryChildCounts
+	childMu     sync.Mutex
+
+	// Execution report written when a run completes, with the children of its fan-out steps
+	report         ReportOptions
+	reportChildren map[string][]ReportChild            // By fan-out step, guarded by childMu
+	childResults   map[string][]interfaces.ChildResult // By fan-out step, guarded by childMu
+	reportPath     string
+
+	// Revisions of the repositories of the execution tree, shared with the child runs, and the
+	// lockfile the root of the tree writes them to
+	revisions    *RevisionLock
+	rootRevision *LockedRepository // Commit ExecuteMultiRepoWorkflow runs the root against
+	lockfilePath string
+
+	// Provenance the runs of the tree write, with the key signing it, what triggered the run and
+	// the events the fan-out steps of the running workflow emitted, by step, guarded by childMu
+	provenance     ProvenanceOptions
+	provenanceKey  crypto.Signer     // Nil not to sign with a key
+	trigger        ProvenanceTrigger // Tako exec when empty
+	provenancePath string
+	emittedEvents  map[string][]string
 
 	// Configuration
 	maxConcurrentRepos int
@@ -65,6 +169,17 @@ type Runner struct {
 	debug              bool
 	noCache            bool
 	environment        []string
+	promptInputs       InputPrompter
+	profile            string
+	waitForChildren    *bool // Overrides the wait_for_children of fan-out steps; nil for none
+	fanOuts            FanOutOptions
+	changedSince       string // Git ref limiting the fan-outs to the changed subtree; see RunnerOptions.ChangedSince
+	fanOutSince        string // Git ref the fan-outs of the running workflow limit their subscribers to; empty for none
+	logs               LogOptions
+	faults             *FaultInjector // Faults injected into the run and its children; nil for none
+	clock              Clock          // Clock of the run and its children
+	compacted          chan struct{}  // Closed when the compaction at start finished; nil without one
+	prefetches         sync.WaitGroup // Prefetches of the subscribers of the workflows run; see prefetchOnStart
 
 	// Synchronization
 	mu sync.RWMutex
@@ -72,7 +187,19 @@ type Runner struct {
 
 // NewRunner creates a new execution runner with the specified configuration.
 func NewRunner(opts RunnerOptions) (*Runner, error) {
-	runID := GenerateRunID()
+	if err := ValidateNamespace(opts.Namespace); err != nil {
+		return nil, err
+	}
+	runID := opts.RunID
+	if runID == "" {
+		runID = NamespacedRunID(GenerateRunID(), opts.Namespace)
+	}
+	parentRunID, correlationID := inheritRunLinks(runID, opts)
+	lineage := opts.Lineage
+	if lineage == nil {
+		value, _ := lookupEnvironment(opts.Environment, LineageEnv)
+		lineage = parseLineage(value)
+	}
 
 	// Use the provided workspace root
 	workspaceRoot := opts.WorkspaceRoot
@@ -85,26 +212,86 @@ func NewRunner(opts RunnerOptions) (*Runner, error) {
 		return nil, fmt.Errorf("failed to create workspace directory: %v", err)
 	}
 
+	faults := opts.Faults
+	if faults == nil {
+		var err error
+		if faults, err = faultsFromEnvironment(opts.Environment); err != nil {
+			return nil, err
+		}
+	}
+
 	// Initialize state manager
 	state, err := NewExecutionState(runID, workspaceRoot)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize execution state: %v", err)
 	}
+	clock := clockOrSystem(opts.Clock)
+	state.faults = faults
+	state.clock = clock
+	state.ParentRunID = parentRunID
+	state.CorrelationID = correlationID
+	state.Lineage = lineage
+	state.Namespace = opts.Namespace
 
 	// Initialize lock manager
 	locks, err := NewLockManager(filepath.Join(workspaceRoot, "locks"))
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize lock manager: %v", err)
 	}
+	locks.SetClock(clock)
+
+	// Initialize cancellation markers in the shared cache
+	cancellations, err := NewCancellationManager(opts.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize cancellation manager: %v", err)
+	}
+
+	approvals, err := NewApprovalManager(opts.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize approval manager: %v", err)
+	}
+	approvals.SetClock(clock)
+
+	history, err := NewHistoryStore(opts.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize execution history: %v", err)
+	}
+
+	childBudget, err := NewChildBudgetStore(opts.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize child workflow budgets: %v", err)
+	}
 
-	// Initialize container manager (optional - only log warning if unavailable)
-	containerManager, err := NewContainerManager(opts.Debug)
+	// Initialize per-run workspace isolation
+	workspaces, err := NewWorkspaceManager(workspaceRoot)
 	if err != nil {
-		// Container runtime is optional - log warning but continue
-		if opts.Debug {
-			fmt.Printf("Warning: Container runtime not available: %v\n", err)
+		return nil, fmt.Errorf("failed to initialize workspace manager: %v", err)
+	}
+	cleanupManager := NewCleanupManager(workspaceRoot, 0, opts.Debug)
+	cleanupManager.SetKeepOnFailure(opts.KeepWorkspaceOnFailure)
+
+	// Initialize step condition evaluator
+	conditions, err := NewConditionEvaluator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize condition evaluator: %v", err)
+	}
+	conditions.SetClock(clock)
+
+	// Initialize container manager. A runtime that was asked for explicitly is required;
+	// otherwise containers are optional and only containerized steps fail without one.
+	requestedRuntime, err := ParseContainerRuntime(opts.ContainerRuntime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid container runtime: %w", err)
+	}
+	containerManager, containerErr := NewContainerManagerWithRuntime(requestedRuntime, opts.Debug)
+	if containerErr != nil {
+		if requestedRuntime != RuntimeNone {
+			return nil, fmt.Errorf("failed to initialize container runtime: %w", containerErr)
 		}
+		slog.Debug("container runtime not available", "error", containerErr)
 		containerManager = nil
+	} else if containerManager.Rootless() {
+		slog.Debug("using rootless container runtime", "runtime", containerManager.Runtime())
 	}
 
 	// Initialize resource manager
@@ -115,19 +302,73 @@ func NewRunner(opts RunnerOptions) (*Runner, error) {
 		Debug:              opts.Debug,
 	}
 	resourceManager := NewResourceManager(resourceConfig)
+	processLimiter, processLimiterErr := newProcessLimiter()
+
+	// Initialize the Git manager that clones and updates cached repositories
+	gitManager, err := NewGitManager(opts.CacheDir, opts.Environment, opts.Git)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize git manager: %v", err)
+	}
 
 	// Initialize orchestrator with discovery manager
 	discoveryManager := NewDiscoveryManager(opts.CacheDir)
-	orchestrator, err := NewOrchestrator(discoveryManager)
+	orchestrator, err := NewOrchestratorWithConfig(discoveryManager, OrchestratorConfig{
+		EnableFiltering:             true,
+		EnablePrioritization:        true,
+		FilterDisabledSubscriptions: true,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize orchestrator: %v", err)
 	}
 
+	if opts.ChangedSince != "" {
+		if err := git.ValidateRef(opts.ChangedSince); err != nil {
+			return nil, err
+		}
+	}
+
+	reportFormat, err := ParseReportFormat(opts.Report.Format)
+	if err != nil {
+		return nil, err
+	}
+
+	var provenanceKey crypto.Signer
+	if opts.Provenance.SigningKey != "" {
+		data, err := os.ReadFile(opts.Provenance.SigningKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provenance signing key: %v", err)
+		}
+		if provenanceKey, err = ParseProvenanceSigningKey(data); err != nil {
+			return nil, fmt.Errorf("invalid provenance signing key %s: %v", opts.Provenance.SigningKey, err)
+		}
+	}
+
+	// Child runs share the limits of the step logs and the followed output
+	logs := opts.Logs.withDefaults()
+
 	// Initialize child workflow execution components
 	childRunnerFactory, err := NewChildRunnerFactory(workspaceRoot, opts.CacheDir, opts.MaxConcurrentRepos, opts.Debug, opts.Environment)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize child runner factory: %v", err)
 	}
+	childRunnerFactory.SetKeepWorkspaceOnFailure(opts.KeepWorkspaceOnFailure)
+	childRunnerFactory.SetContainerRuntime(opts.ContainerRuntime)
+	childRunnerFactory.SetGitManager(gitManager)
+	childRunnerFactory.SetLogOptions(logs)
+	childRunnerFactory.SetParentRunID(runID)
+	childRunnerFactory.SetCorrelationID(correlationID)
+	childRunnerFactory.SetLineage(lineage, opts.MaxFanOutDepth)
+	childRunnerFactory.SetMaxTotalChildren(opts.MaxTotalChildren)
+	childRunnerFactory.SetNamespace(opts.Namespace)
+	childRunnerFactory.SetFaultInjector(faults)
+	childRunnerFactory.SetFanOutOptions(opts.FanOuts)
+	childRunnerFactory.SetClock(clock)
+	childRunnerFactory.SetProvenance(opts.Provenance)
+	revisions := opts.Revisions
+	if revisions == nil {
+		revisions = NewRevisionLock(nil)
+	}
+	childRunnerFactory.SetRevisionLock(revisions)
 
 	// Create child workflow executor
 	childWorkflowExecutor, err := NewChildWorkflowExecutor(childRunnerFactory, NewTemplateEngine(), containerManager, resourceManager)
@@ -135,6 +376,35 @@ func NewRunner(opts RunnerOptions) (*Runner, error) {
 		return nil, fmt.Errorf("failed to initialize child workflow executor: %v", err)
 	}
 
+	// Register the backends child workflows can run on
+	containerExecutor, err := NewChildWorkflowExecutor(childRunnerFactory, NewTemplateEngine(), containerManager, resourceManager)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize container execution: %v", err)
+	}
+	containerExecutor.SetContainerImage(DefaultContainerBackendImage)
+	remoteExecutor, err := NewRemoteWorkflowExecutor(runID, opts.Remote)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize remote execution: %v", err)
+	}
+	backends := NewBackendRegistry()
+	backends.Register(BackendLocal, childWorkflowExecutor)
+	backends.Register(BackendContainer, containerExecutor)
+	backends.Register(BackendRemote, remoteExecutor)
+	backends.Register(BackendNoop, NewRecordingWorkflowRunner())
+	kubernetesExecutor := NewKubernetesJobExecutor(opts.CacheDir, runID, opts.Environment, opts.Kubernetes)
+	kubernetesExecutor.SetCorrelationID(correlationID)
+	backends.Register(BackendKubernetes, kubernetesExecutor)
+
+	backend := opts.Backend
+	if backend == "" && opts.Remote.Enabled {
+		backend = BackendRemote
+	}
+	if backend != "" {
+		if err := backends.SetDefault(backend); err != nil {
+			return nil, err
+		}
+	}
+
 	mode := ExecutionModeNormal
 	if opts.DryRun {
 		mode = ExecutionModeDryRun
@@ -142,29 +412,86 @@ func NewRunner(opts RunnerOptions) (*Runner, error) {
 		mode = ExecutionModeDebug
 	}
 
-	return &Runner{
+	circuitBreakerConfig, circuitBreakerOverrides, err := CircuitBreakerConfigs(opts.FanOuts.CircuitBreakers)
+	if err != nil {
+		return nil, fmt.Errorf("invalid circuit breakers: %v", err)
+	}
+	circuitBreakers := NewCircuitBreakerManager(circuitBreakerConfig)
+	circuitBreakers.Configure(circuitBreakerConfig, circuitBreakerOverrides)
+	circuitBreakers.SetClock(clock)
+	if opts.CacheDir != "" {
+		// Circuit breakers keep protecting flapping subscribers across restarts
+		breakerStore, err := NewCircuitBreakerStore(opts.CacheDir)
+		if err != nil {
+			return nil, err
+		}
+		if err := circuitBreakers.SetStore(breakerStore); err != nil {
+			return nil, fmt.Errorf("failed to restore circuit breakers: %v", err)
+		}
+	}
+
+	runner := &Runner{
 		mode:                mode,
 		workspaceRoot:       workspaceRoot,
 		cacheDir:            opts.CacheDir,
 		runID:               runID,
+		parentRunID:         parentRunID,
+		correlationID:       correlationID,
+		lineage:             lineage,
+		maxFanOutDepth:      opts.MaxFanOutDepth,
+		childBudget:         childBudget,
+		maxTotalChildren:    opts.MaxTotalChildren,
+		namespace:           opts.Namespace,
 		state:               state,
 		locks:               locks,
+		cancellations:       cancellations,
+		approvals:           approvals,
+		workspaces:          workspaces,
+		cleanupManager:      cleanupManager,
 		templateEngine:      NewTemplateEngine(),
+		conditions:          conditions,
 		containerManager:    containerManager,
+		containerErr:        containerErr,
 		resourceManager:     resourceManager,
+		processLimiter:      processLimiter,
+		processLimiterErr:   processLimiterErr,
 		orchestrator:        orchestrator,
+		gitManager:          gitManager,
+		revisions:           revisions,
+		provenance:          opts.Provenance,
+		provenanceKey:       provenanceKey,
 		childRunnerFactory:  childRunnerFactory,
-		childWorkflowRunner: childWorkflowExecutor,
+		childWorkflowRunner: backends,
+		backends:            backends,
+		backend:             backend,
+		circuitBreakers:     circuitBreakers,
+		history:             history,
 		maxConcurrentRepos:  opts.MaxConcurrentRepos,
 		dryRun:              opts.DryRun,
 		debug:               opts.Debug,
 		noCache:             opts.NoCache,
 		environment:         opts.Environment,
-	}, nil
+		promptInputs:        opts.PromptInputs,
+		profile:             opts.Profile,
+		waitForChildren:     opts.WaitForChildren,
+		fanOuts:             opts.FanOuts,
+		changedSince:        opts.ChangedSince,
+		logs:                logs,
+		report:              ReportOptions{Format: reportFormat, Path: opts.Report.Path},
+		faults:              faults,
+		clock:               clock,
+	}
+	if opts.Retention.CompactOnStart && opts.CacheDir != "" {
+		runner.compactOnStart(opts.Retention.Policies)
+	}
+	return runner, nil
 }
 
 // RunnerOptions configures the execution runner.
 type RunnerOptions struct {
+	RunID              string // Optional run ID; generated when empty
+	ParentRunID        string // Run that triggered this one, for child runs; inherited from TAKO_PARENT_RUN_ID when empty
+	CorrelationID      string // Correlation ID of the execution tree; inherited from TAKO_CORRELATION_ID, or the run ID, when empty
 	WorkspaceRoot      string
 	CacheDir           string
 	MaxConcurrentRepos int
@@ -172,6 +499,102 @@ type RunnerOptions struct {
 	Debug              bool
 	NoCache            bool
 	Environment        []string // Environment variables for command execution
+
+	// Lineage is the repository:workflow of the runs from the root of the execution tree to
+	// this run; inherited from TAKO_LINEAGE when nil, and started with the workflow of the run
+	// when empty. MaxFanOutDepth bounds the depth of the fan-out children of the tree;
+	// DefaultMaxFanOutDepth when zero.
+	Lineage        []string
+	MaxFanOutDepth int
+
+	// MaxTotalChildren caps the child workflows the fan-outs of the execution tree trigger in
+	// total; the execution.max_total_children of tako.yml, or DefaultMaxTotalChildren, when zero.
+	// The cap of the first fan-out of a tree holds for the whole tree.
+	MaxTotalChildren int
+
+	// Namespace isolates the runs of a tenant sharing the machine; the default namespace when
+	// empty. It is recorded in run IDs and states, while WorkspaceRoot and CacheDir are
+	// expected to be the directories of the namespace, as returned by NamespaceDir.
+	Namespace string
+
+	// KeepWorkspaceOnFailure preserves the isolated workspaces of failed runs for debugging
+	KeepWorkspaceOnFailure bool
+
+	// ContainerRuntime selects docker, podman or nerdctl; auto-detected when empty or "auto"
+	ContainerRuntime string
+
+	// Git configures cloning of missing repositories and fetching of stale ones
+	Git GitOptions
+
+	// Backend is the default backend of child workflows, overriding the execution.backend of
+	// tako.yml; BackendRemote when Remote is enabled, and BackendLocal otherwise
+	Backend string
+
+	// Remote configures the remote backend; enabling it makes it the default backend
+	Remote RemoteOptions
+
+	// Kubernetes configures the kubernetes backend
+	Kubernetes KubernetesOptions
+
+	// Logs configures the step logs and how much of the output of steps their results keep
+	Logs LogOptions
+
+	// Report configures the execution report written when a run completes
+	Report ReportOptions
+
+	// Profile selects the profile of tako.yml merged over the workflow; none when empty. Child
+	// runs use the base definition of their workflows.
+	Profile string
+
+	// WaitForChildren overrides the wait_for_children of the fan-out steps of the workflow: true
+	// waits for the child workflows they trigger, false only triggers them; per step when nil.
+	// Child workflows follow their own steps.
+	WaitForChildren *bool
+
+	// PromptInputs asks for the required inputs of the workflow that were not provided, instead
+	// of failing the run; nil to fail. Child runs never prompt.
+	PromptInputs InputPrompter
+
+	// FanOuts configures the retries, circuit breakers and idempotency of the fan-outs of the run
+	// and its children
+	FanOuts FanOutOptions
+
+	// Retention configures the compaction of the artifacts of finished runs at start; child runs
+	// never compact them.
+	Retention RetentionOptions
+
+	// Faults injects failures into the run and its children, for chaos testing; the faults of
+	// TAKO_FAULTS in builds with the faults tag when nil.
+	Faults *FaultInjector
+
+	// Clock tells the time of the run and its children: the times recorded in their states and
+	// results, the backoff of retries and the open duration of circuit breakers; the system clock
+	// when nil. Tests set a FakeClock to control time.
+	Clock Clock
+
+	// Revisions pins the repositories of the run and its children to the commits of a replayed
+	// lockfile, and records the commits they run against for the lockfile of the run; one without
+	// a replayed lockfile when nil. Child runs share the revisions of their parent.
+	Revisions *RevisionLock
+
+	// ChangedSince limits the fan-outs of the run to the subtree affected by the changes since a
+	// git ref: when the repository of the run did not change since it, its fan-outs only trigger
+	// the subscribers whose repositories changed. The child workflows they trigger are affected,
+	// so their fan-outs trigger all their subscribers. No limit when empty.
+	ChangedSince string
+
+	// Provenance configures the signing of the provenance the run writes. Child runs write their
+	// own, signed like their parent's.
+	Provenance ProvenanceOptions
+}
+
+// InputPrompter asks for the values of the missing required inputs of a workflow, such as
+// from an interactive terminal. The values are validated like the provided inputs.
+type InputPrompter func(workflowName string, missing map[string]config.WorkflowInput) (map[string]string, error)
+
+// now returns the time of the runner's clock.
+func (r *Runner) now() time.Time {
+	return clockOrSystem(r.clock).Now()
 }
 
 // ExecuteWorkflow executes a workflow in single-repository mode.
@@ -179,21 +602,47 @@ func (r *Runner) ExecuteWorkflow(ctx context.Context, workflowName string, input
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	startTime := time.Now()
+	startTime := r.now()
+
+	// The root of an execution tree records the commit it runs against, for its lockfile
+	if r.parentRunID == "" {
+		if err := r.lockRootRevision(repoPath); err != nil {
+			return &ExecutionResult{
+				RunID:     r.runID,
+				Success:   false,
+				Error:     err,
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+	}
 
 	// Load workflow configuration
 	configPath := filepath.Join(repoPath, "tako.yml")
-	cfg, err := config.Load(configPath)
+	cfg, err := config.LoadWithCache(configPath, r.cacheDir)
 	if err != nil {
 		return &ExecutionResult{
 			RunID:     r.runID,
 			Success:   false,
 			Error:     fmt.Errorf("failed to load config: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
+	// The selected profile is merged over the workflows
+	if r.profile != "" {
+		if err := cfg.ApplyProfile(r.profile); err != nil {
+			return &ExecutionResult{
+				RunID:     r.runID,
+				Success:   false,
+				Error:     err,
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+	}
+
 	// Find the specified workflow
 	workflow, exists := cfg.Workflows[workflowName]
 	if !exists {
@@ -203,43 +652,222 @@ func (r *Runner) ExecuteWorkflow(ctx context.Context, workflowName string, input
 			Success:   false,
 			Error:     err,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
-	// Validate inputs
-	if err := r.validateInputs(workflow, inputs); err != nil {
+	// Validate inputs, asking for the missing ones when the runner prompts for them
+	if inputs == nil {
+		inputs = make(map[string]string)
+	}
+	err = r.promptMissingInputs(workflowName, workflow, inputs)
+	if err == nil {
+		err = r.validateInputs(workflow, inputs)
+	}
+	if err != nil {
 		return &ExecutionResult{
 			RunID:     r.runID,
 			Success:   false,
 			Error:     fmt.Errorf("input validation failed: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
+		}, err
+	}
+
+	r.executionConfig = cfg.Execution
+
+	// Subscribers of the events of the workflow are cloned or fetched while its first steps run
+	if r.gitManager.Options().Prefetch && !r.gitManager.Options().LocalOnly && !r.dryRun {
+		r.prefetchOnStart(ctx, workflow)
+	}
+
+	// Child workflows run on the backend of the options, or else of tako.yml
+	if err := r.selectBackend(cfg.Execution); err != nil {
+		return &ExecutionResult{
+			RunID:     r.runID,
+			Success:   false,
+			Error:     fmt.Errorf("invalid execution backend: %v", err),
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
+	// Fan-out events are also published to the sinks of tako.yml
+	if cfg.Events != nil && len(cfg.Events.Sinks) > 0 {
+		publisher, err := NewEventPublisher(cfg.Events.Sinks, r.getEnvironment())
+		if err != nil {
+			return &ExecutionResult{
+				RunID:     r.runID,
+				Success:   false,
+				Error:     fmt.Errorf("invalid event sinks: %v", err),
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+		r.eventPublisher = publisher
+	}
+	if cfg.Events != nil && cfg.Events.Signing != nil {
+		key, err := eventSigningKey(r.getEnvironment(), cfg.Events.Signing.KeyEnv)
+		if err != nil {
+			return &ExecutionResult{
+				RunID:     r.runID,
+				Success:   false,
+				Error:     fmt.Errorf("invalid event signing: %v", err),
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+		r.eventSigningKey = key
+	}
+	if cfg.Events != nil {
+		r.eventSchemas = cfg.Events.Schemas
+		r.diamondStrategies = cfg.Events
+	}
+
+	// Operators are notified of the failures the workflow's policies select
+	notifications, err := NewNotificationPolicies(workflow.Notifications, r.getEnvironment())
+	if err != nil {
+		return &ExecutionResult{
+			RunID:     r.runID,
+			Success:   false,
+			Error:     fmt.Errorf("invalid notifications: %v", err),
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+	r.notifications = notifications
+	r.workflowEnv = workflow.Env
+	r.envPassthrough = workflow.EnvPassthrough
+	r.inputDefinitions = workflow.Inputs
+	r.repoPath = repoPath
+	r.workingDirectory = workflow.WorkingDirectory
+	r.shell = workflow.Shell
+	r.artifactPaths = make(map[string]string, len(cfg.Artifacts))
+	for name, artifact := range cfg.Artifacts {
+		r.artifactPaths[name] = filepath.Join(repoPath, artifact.Path)
+	}
+	r.publishedArtifacts = nil
+
+	// Circuit breakers follow tako.yml, including its changes while the workflow runs
+	reloadCtx, stopReloading := context.WithCancel(ctx)
+	defer stopReloading()
+	if err := r.WatchCircuitBreakers(reloadCtx, configPath); err != nil {
+		return &ExecutionResult{
+			RunID:     r.runID,
+			Success:   false,
+			Error:     fmt.Errorf("invalid circuit breakers: %v", err),
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
+	// The workflow's resources bound the aggregate consumption of its repository's steps
+	if err := r.setRepositoryLimits(workflow.Resources, repoPath); err != nil {
+		return &ExecutionResult{
+			RunID:     r.runID,
+			Success:   false,
+			Error:     fmt.Errorf("invalid workflow resources: %v", err),
+			StartTime: startTime,
+			EndTime:   r.now(),
 		}, err
 	}
 
 	// Update execution state
+	r.childMu.Lock()
+	r.childCounts = HistoryChildCounts{}
+	r.reportChildren = make(map[string][]ReportChild)
+	r.childResults = make(map[string][]interfaces.ChildResult)
+	r.emittedEvents = make(map[string][]string)
+	r.childMu.Unlock()
+	r.seedLineage(repoPath, workflowName)
+	r.fanOutSince = r.resolveFanOutSince(ctx, repoPath)
 	if err := r.state.StartExecution(workflowName, repoPath, inputs); err != nil {
 		return &ExecutionResult{
 			RunID:     r.runID,
 			Success:   false,
 			Error:     fmt.Errorf("failed to start execution: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
-	// Execute workflow steps
-	stepResults, err := r.executeSteps(ctx, workflow.Steps, repoPath, inputs)
+	// Stop as soon as this run, or the run that started it, is cancelled
+	ctx, stopWatching := r.cancellations.Watch(ctx, r.runID, r.parentRunID)
+	defer stopWatching()
+
+	// Bound the whole run by the workflow timeout
+	if workflow.Timeout != "" {
+		timeout, _ := time.ParseDuration(workflow.Timeout) // Validated when the config is loaded
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, timeout, ErrWorkflowTimeout)
+		defer cancel()
+	}
+
+	// Execute workflow steps, with the workflow's services running alongside them
+	var stepResults []StepResult
+	var outputs map[string]string
+	stepOutputs := make(map[string]map[string]string)
+	stopServices, err := r.startServices(ctx, workflow.Services)
+	if err == nil {
+		stepResults, err = r.executeSteps(ctx, workflow.Steps, repoPath, inputs, stepOutputs)
+		stopServices()
+	}
+	if err == nil {
+		outputs, err = r.evaluateWorkflowOutputs(workflow.Outputs, inputs, stepOutputs)
+	}
+
+	// Hooks run whatever the outcome, including once the run is cancelled or timed out
+	hooks := workflow.OnSuccess
+	if err != nil {
+		hooks = workflow.OnFailure
+	}
+	if len(hooks) > 0 {
+		hookResults, hookErr := r.executeSteps(context.WithoutCancel(ctx), hooks, repoPath, inputs, stepOutputs)
+		stepResults = append(stepResults, hookResults...)
+		if hookErr != nil {
+			slog.Warn("workflow hook failed", "workflow", workflowName, "run_id", r.runID, "error", hookErr)
+		}
+	}
 
-	endTime := time.Now()
+	endTime := r.now()
 	success := err == nil
 
 	// Update final state
 	if success {
 		r.state.CompleteExecution()
+	} else if IsRunCancelled(ctx) {
+		err = fmt.Errorf("workflow '%s' stopped: %w", workflowName, ErrRunCancelled)
+		r.state.CancelExecution(r.cancellationReason())
+	} else if IsRunInterrupted(ctx) {
+		err = fmt.Errorf("workflow '%s' stopped: %w", workflowName, ErrRunInterrupted)
+		r.state.InterruptExecution("interrupted by a signal")
 	} else {
+		if errors.Is(context.Cause(ctx), ErrWorkflowTimeout) && !errors.Is(err, ErrWorkflowTimeout) {
+			err = fmt.Errorf("%w after %s: %w", ErrWorkflowTimeout, workflow.Timeout, err)
+		}
 		r.state.FailExecution(err.Error())
+		r.notify(ctx, &NotificationMessage{
+			Trigger:  config.NotifyWorkflowFailed,
+			Title:    "tako workflow failed",
+			Text:     fmt.Sprintf("Workflow '%s' failed: %v", workflowName, err),
+			Workflow: workflowName,
+		})
+	}
+	if clearErr := r.cancellations.ClearCancellation(r.runID); clearErr != nil {
+		slog.Warn("failed to clear cancellation marker", "run_id", r.runID, "error", clearErr)
+	}
+	r.recordHistory(workflowName, repoPath, startTime, endTime, stepResults, err)
+	r.writeReport(workflowName, repoPath, startTime, endTime, stepResults, outputs, err)
+	children := r.runChildResults(stepResults)
+	// The root of the tree writes its lockfile; child runs record the commits of the tree so far
+	var lock *Lockfile
+	if r.parentRunID == "" {
+		lock = r.writeLockfile(workflowName, endTime)
+	} else {
+		lock = r.revisions.Lockfile(r.runID, workflowName, endTime)
+	}
+	if !r.dryRun {
+		r.writeProvenance(context.WithoutCancel(ctx), r.newProvenanceStatement(workflowName, repoPath, inputs, startTime, endTime, stepResults, children, lock, err))
 	}
 
 	return &ExecutionResult{
@@ -249,59 +877,337 @@ func (r *Runner) ExecuteWorkflow(ctx context.Context, workflowName string, input
 		StartTime: startTime,
 		EndTime:   endTime,
 		Steps:     stepResults,
+		Outputs:   outputs,
+		Children:  children,
+
+		AllowedFailures: allowedFailures(stepResults),
 	}, err
 }
 
-// ExecuteMultiRepoWorkflow executes a workflow with multi-repository orchestration.
-func (r *Runner) ExecuteMultiRepoWorkflow(ctx context.Context, workflowName string, inputs map[string]string, parentRepo string) (*ExecutionResult, error) {
-	// For now, implement basic multi-repository execution by resolving the repo path
-	// and delegating to single-repository execution
-	// TODO: Implement full multi-repository execution with event-driven orchestration
-	// This will be the main orchestration logic that handles:
-	// 1. Parent repository workflow execution
-	// 2. Event emission via tako/fan-out@v1 steps
-	// 3. Child repository subscription evaluation
-	// 4. Parallel execution of child workflows
-	// 5. State synchronization across all repositories
+// runChildResults returns the child workflows triggered by the fan-out steps of the run, in the
+// order of the steps, with the executions of those this process ran and their own children.
+func (r *Runner) runChildResults(steps []StepResult) []interfaces.ChildResult {
+	r.childMu.Lock()
+	defer r.childMu.Unlock()
+
+	var children []interfaces.ChildResult
+	for _, step := range steps {
+		children = append(children, r.childResults[step.ID]...)
+	}
+	return children
+}
 
+// newChildResults returns the child workflows of the fan-out of a step.
+func newChildResults(stepID string, result *FanOutResult) []interfaces.ChildResult {
+	children := make([]interfaces.ChildResult, 0, len(result.Children))
+	for _, child := range result.Children {
+		children = append(children, interfaces.ChildResult{
+			StepID:     stepID,
+			Repository: child.Repository,
+			Workflow:   child.Workflow,
+			RunID:      child.RunID,
+			Status:     string(child.Status),
+			Error:      child.ErrorMessage,
+			Result:     child.Result,
+		})
+	}
+	return children
+}
+
+// ExecuteMultiRepoWorkflow executes a workflow of a repository of the cache, such as
+// "owner/repo:branch", cloning it when missing, in a workspace of the run. The rest of the
+// dependency graph is orchestrated by the fan-out steps of the workflow: they emit events,
+// evaluate the subscriptions of the dependent repositories and run their workflows, at most
+// MaxConcurrentRepos at once, waiting for them unless WaitForChildren says otherwise.
+func (r *Runner) ExecuteMultiRepoWorkflow(ctx context.Context, workflowName string, inputs map[string]string, parentRepo string) (*ExecutionResult, error) {
 	// Parse repository specification (e.g., "owner/repo:branch")
-	repoPath, err := r.resolveRepositoryPath(parentRepo)
+	cachePath, err := r.resolveRepositoryPath(ctx, parentRepo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve repository path: %v", err)
 	}
 
-	// Delegate to single-repository execution for now
-	return r.ExecuteWorkflow(ctx, workflowName, inputs, repoPath)
+	// The repository runs against the commit a replayed lockfile locks, or its cached checkout
+	root, err := r.resolveRootRevision(ctx, parentRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository revision: %v", err)
+	}
+	var lockedCommit string
+	if _, locked := r.revisions.Pinned(root.Repository, root.Ref); locked {
+		lockedCommit = root.Commit
+	}
+
+	// Never execute in the shared cache: overlay the repository into the run workspace
+	repoPath, err := r.prepareRunWorkspace(ctx, parentRepo, cachePath, lockedCommit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare workspace: %v", err)
+	}
+
+	r.repository = strings.Split(parentRepo, ":")[0]
+	if root.Commit != "" {
+		r.rootRevision = root
+	}
+	result, err := r.ExecuteWorkflow(ctx, workflowName, inputs, repoPath)
+
+	success := err == nil && result != nil && result.Success
+	if kept, cleanErr := r.cleanupManager.FinalizeWorkspace(r.runID, success); cleanErr != nil {
+		slog.Warn("failed to cleanup run workspace", "run_id", r.runID, "error", cleanErr)
+	} else if kept {
+		slog.Info("keeping workspace of failed run", "run_id", r.runID, "path", filepath.Dir(repoPath))
+	}
+	r.workspaces.DetachWorkspace(r.runID)
+
+	return result, err
+}
+
+// recordHistory appends the record of a completed run to the execution history. A run that
+// cannot be recorded is only logged: the history must not fail the run.
+func (r *Runner) recordHistory(workflowName, repoPath string, startTime, endTime time.Time, steps []StepResult, runErr error) {
+	record := HistoryRecord{
+		RunID:         r.runID,
+		ParentRunID:   r.parentRunID,
+		CorrelationID: r.correlationID,
+		Repository:    r.repository,
+		Workflow:      workflowName,
+		StartTime:     startTime,
+		EndTime:       endTime,
+		Duration:      endTime.Sub(startTime),
+		Steps:         newHistorySteps(steps),
+	}
+	if _, err := os.Stat(r.logDir()); err == nil {
+		record.LogDir = r.logDir()
+	}
+	if record.Repository == "" {
+		record.Repository = r.getRepositoryNameFromPath(repoPath)
+	}
+	record.Status = historyStatus(runErr)
+	if runErr != nil {
+		record.Error = runErr.Error()
+	}
+	r.childMu.Lock()
+	record.Children = r.childCounts
+	r.childMu.Unlock()
+
+	if err := r.history.Append(record); err != nil {
+		slog.Warn("failed to record run in history", "run_id", r.runID, "error", err)
+	}
+}
+
+// historyStatus returns the status of a run that stopped with an error, or completed.
+func historyStatus(runErr error) string {
+	switch {
+	case runErr == nil:
+		return HistoryStatusCompleted
+	case errors.Is(runErr, ErrRunCancelled):
+		return HistoryStatusCancelled
+	case errors.Is(runErr, ErrWorkflowTimeout):
+		return HistoryStatusTimedOut
+	default:
+		return HistoryStatusFailed
+	}
+}
+
+// writeReport writes the execution report of a completed run. A report that cannot be written
+// is only logged, like the history.
+func (r *Runner) writeReport(workflowName, repoPath string, startTime, endTime time.Time, steps []StepResult, outputs map[string]string, runErr error) {
+	r.reportPath = ""
+	if r.report.Format == ReportFormatNone {
+		return
+	}
+	r.childMu.Lock()
+	report := &ExecutionReport{
+		RunID:       r.runID,
+		ParentRunID: r.parentRunID,
+		Repository:  r.repository,
+		Workflow:    workflowName,
+		Status:      historyStatus(runErr),
+		StartTime:   startTime,
+		EndTime:     endTime,
+		Duration:    endTime.Sub(startTime),
+		Outputs:     outputs,
+		Steps:       newReportSteps(steps, r.reportChildren),
+	}
+	r.childMu.Unlock()
+	if report.Repository == "" {
+		report.Repository = r.getRepositoryNameFromPath(repoPath)
+	}
+	if runErr != nil {
+		report.Error = runErr.Error()
+		report.ErrorType = runErrorType(runErr, report.Steps)
+	}
+
+	path := r.report.Path
+	if path == "" {
+		path = filepath.Join(r.workspaceRoot, r.runID, "report."+reportExtension(r.report.Format))
+	}
+	if err := WriteReport(report, r.report.Format, path); err != nil {
+		slog.Warn("failed to write execution report", "run_id", r.runID, "error", err)
+		return
+	}
+	r.reportPath = path
+}
+
+// ReportPath returns the file the execution report of the last run was written to; empty when
+// none was.
+func (r *Runner) ReportPath() string {
+	return r.reportPath
 }
 
-// resolveRepositoryPath resolves a repository specification to a local path.
-func (r *Runner) resolveRepositoryPath(repoSpec string) (string, error) {
-	// Parse repository specification: "owner/repo:branch" or "owner/repo"
-	parts := strings.Split(repoSpec, ":")
-	repoPath := parts[0]
-	branch := "main"
-	if len(parts) > 1 {
-		branch = parts[1]
+// cancellationReason returns the reason recorded when this run, or its parent, was cancelled.
+func (r *Runner) cancellationReason() string {
+	for _, runID := range []string{r.runID, r.parentRunID} {
+		if runID == "" {
+			continue
+		}
+		if request, _ := r.cancellations.GetCancellation(runID); request != nil {
+			if request.Reason != "" {
+				return fmt.Sprintf("cancelled: %s", request.Reason)
+			}
+			if runID != r.runID {
+				return fmt.Sprintf("cancelled with parent run %s", runID)
+			}
+			break
+		}
 	}
+	return "cancelled"
+}
 
-	// Split owner/repo
-	ownerRepo := strings.Split(repoPath, "/")
-	if len(ownerRepo) != 2 {
-		return "", fmt.Errorf("invalid repository specification: %s (expected format: owner/repo or owner/repo:branch)", repoSpec)
+// prepareRunWorkspace creates the isolated workspace for this run at
+// <workspace-root>/<run-id> and overlays the repository into <run-id>/<repo>, or checks out
+// a commit of it there when one is given.
+func (r *Runner) prepareRunWorkspace(ctx context.Context, repoSpec, sourcePath, commit string) (string, error) {
+	workspace, err := r.workspaces.CreateWorkspace(r.runID, sourcePath)
+	if err != nil {
+		return "", err
 	}
 
-	owner := ownerRepo[0]
-	repo := ownerRepo[1]
+	// owner/repo:branch -> repo
+	repoName := path.Base(strings.Split(repoSpec, ":")[0])
 
-	// Construct cache path: ~/.tako/cache/repos/owner/repo/branch
-	cachePath := filepath.Join(r.cacheDir, "repos", owner, repo, branch)
+	if commit != "" {
+		repoPath := filepath.Join(workspace.Path, repoName)
+		if err := exportCommit(ctx, sourcePath, commit, repoPath); err != nil {
+			return "", fmt.Errorf("failed to check out %s@%s: %w", repoSpec, commit, err)
+		}
+		return repoPath, nil
+	}
+	return workspace.OverlayRepository(repoName, sourcePath)
+}
+
+// resolveRootRevision returns the commit a repository given as owner/repo:ref runs against as
+// the root of an execution tree: the commit a replayed lockfile locks, fetched when missing, or
+// else the head of its cached clone. The commit is empty when the cached repository is not a
+// Git clone.
+func (r *Runner) resolveRootRevision(ctx context.Context, repoSpec string) (*LockedRepository, error) {
+	name, ref, _ := strings.Cut(repoSpec, ":")
+	if ref == "" {
+		ref = "main"
+	}
+	root := &LockedRepository{Repository: name, Ref: ref}
+
+	pinned := config.PinnedRef{Ref: ref}
+	locked, isLocked := r.revisions.Pinned(name, ref)
+	if isLocked {
+		pinned.Commit = locked.Commit
+	}
+	commit, err := r.gitManager.ResolveCommit(ctx, name, pinned)
+	if err != nil {
+		if isLocked {
+			return nil, err
+		}
+		return root, nil
+	}
+	root.Commit = commit
+	return root, nil
+}
 
-	// Check if repository exists in cache
-	if _, err := os.Stat(cachePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("repository %s not found in cache at %s", repoSpec, cachePath)
+// lockRootRevision starts recording the revisions of the execution tree the run is the root
+// of, with the commit its repository runs against: the one resolved by ExecuteMultiRepoWorkflow,
+// or else the HEAD of a local Git repository, which must be the root commit of a replayed
+// lockfile since the local checkout is run as it is.
+func (r *Runner) lockRootRevision(repoPath string) error {
+	r.revisions.reset()
+	root := r.rootRevision
+	r.rootRevision = nil
+
+	if root == nil {
+		// Without this check, git would resolve the commit of an enclosing repository
+		if _, err := os.Stat(filepath.Join(repoPath, ".git")); err != nil {
+			return nil
+		}
+		commit, err := git.HeadCommit(repoPath)
+		if err != nil {
+			return nil // No commit yet
+		}
+		if replay := r.revisions.Replay(); replay != nil {
+			if locked, ok := replay.Root(); ok && !strings.HasPrefix(commit, locked.Commit) {
+				return fmt.Errorf("repository %s is at commit %s, but the lockfile locks %s at %s: check out that commit first", repoPath, commit, locked.Repository, locked.Commit)
+			}
+		}
+		ref, err := git.CurrentBranch(repoPath)
+		if err != nil {
+			ref = "HEAD"
+		}
+		name := r.repository
+		if name == "" {
+			if name, err = git.GetRepoName(repoPath); err != nil {
+				name = r.getRepositoryNameFromPath(repoPath)
+			}
+		}
+		root = &LockedRepository{Repository: name, Ref: ref, Commit: commit}
+	}
+
+	root.Root = true
+	r.revisions.Record(*root)
+	return nil
+}
+
+// writeLockfile writes the lockfile of the commits the repositories of the execution tree ran
+// against to the workspace of the run, next to its report, and returns it. Children of fan-outs
+// that do not wait for them are recorded once they are triggered, but not the children those
+// trigger later.
+func (r *Runner) writeLockfile(workflowName string, endTime time.Time) *Lockfile {
+	r.lockfilePath = ""
+	lock := r.revisions.Lockfile(r.runID, workflowName, endTime)
+	if len(lock.Repositories) == 0 {
+		return lock
+	}
+	path := filepath.Join(r.workspaceRoot, r.runID, LockfileName)
+	if err := WriteLockfile(lock, path); err != nil {
+		slog.Warn("failed to write lockfile", "run_id", r.runID, "error", err)
+		return lock
+	}
+	r.lockfilePath = path
+	return lock
+}
+
+// resolveFanOutSince returns the git ref the fan-outs of a run in a repository limit their
+// subscribers to: the ChangedSince ref, unless the repository changed since it, or cannot be
+// diffed against it, and all its subscribers are affected.
+func (r *Runner) resolveFanOutSince(ctx context.Context, repoPath string) string {
+	if r.changedSince == "" {
+		return ""
+	}
+	changed, err := r.gitManager.ChangedPaths(ctx, repoPath, r.changedSince)
+	if err != nil {
+		slog.Warn("failed to diff the repository of the run, triggering all subscribers", "since", r.changedSince, "error", err)
+		return ""
 	}
+	if len(changed) > 0 {
+		return ""
+	}
+	return r.changedSince
+}
+
+// LockfilePath returns the file the lockfile of the last run was written to; empty when none
+// was.
+func (r *Runner) LockfilePath() string {
+	return r.lockfilePath
+}
 
-	return cachePath, nil
+// resolveRepositoryPath resolves a repository specification to its path in the cache,
+// cloning the repository when it is missing unless the runner is local-only.
+func (r *Runner) resolveRepositoryPath(ctx context.Context, repoSpec string) (string, error) {
+	return r.gitManager.EnsureRepository(ctx, repoSpec)
 }
 
 // Resume resumes a previously failed or interrupted execution.
@@ -316,7 +1222,9 @@ func (r *Runner) Resume(ctx context.Context, runID string) (*ExecutionResult, er
 	return nil, fmt.Errorf("execution resume not yet implemented")
 }
 
-// validateInputs validates workflow inputs against the schema.
+// validateInputs validates workflow inputs against the schema. Missing inputs take their
+// default, and typed inputs are rewritten in the string form of their type, so that "TRUE" and
+// "true" are the same boolean for templates and child workflows alike.
 func (r *Runner) validateInputs(workflow config.Workflow, inputs map[string]string) error {
 	for name, input := range workflow.Inputs {
 		value, provided := inputs[name]
@@ -328,41 +1236,82 @@ func (r *Runner) validateInputs(workflow config.Workflow, inputs map[string]stri
 
 		// Use default if not provided
 		if !provided && input.Default != nil {
-			inputs[name] = fmt.Sprintf("%v", input.Default)
+			inputs[name] = config.FormatInputValue(input.Default)
 			continue
 		}
 
 		// Validate provided value
 		if provided {
-			if err := r.validateInputValue(name, input, value); err != nil {
+			typed, err := r.validateInputValue(name, input, value)
+			if err != nil {
 				return err
 			}
+			if input.Type != "" && input.Type != config.InputTypeString {
+				inputs[name] = config.FormatInputValue(typed)
+			}
 		}
 	}
 
 	return nil
 }
 
-// validateInputValue validates a single input value against its schema.
-func (r *Runner) validateInputValue(name string, input config.WorkflowInput, value string) error {
-	// Type validation would go here
-	// For now, we'll implement basic enum validation
-	if len(input.Validation.Enum) > 0 {
-		for _, validValue := range input.Validation.Enum {
-			if value == validValue {
-				return nil
-			}
+// promptMissingInputs asks the prompter of the runner, if any, for the required inputs that
+// were not provided.
+func (r *Runner) promptMissingInputs(workflowName string, workflow config.Workflow, inputs map[string]string) error {
+	if r.promptInputs == nil {
+		return nil
+	}
+	missing := make(map[string]config.WorkflowInput)
+	for name, input := range workflow.Inputs {
+		if _, provided := inputs[name]; input.Required && !provided {
+			missing[name] = input
 		}
-		return fmt.Errorf("input '%s' value '%s' is not in allowed values %v", name, value, input.Validation.Enum)
+	}
+	if len(missing) == 0 {
+		return nil
 	}
 
+	values, err := r.promptInputs(workflowName, missing)
+	if err != nil {
+		return err
+	}
+	for name, value := range values {
+		inputs[name] = value
+	}
 	return nil
 }
 
-// executeSteps executes a list of workflow steps.
-func (r *Runner) executeSteps(ctx context.Context, steps []config.WorkflowStep, workDir string, inputs map[string]string) ([]StepResult, error) {
+// validateInputValue validates a single input value against its schema and returns it
+// converted to the type of the input.
+func (r *Runner) validateInputValue(name string, input config.WorkflowInput, value string) (interface{}, error) {
+	typed, err := input.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("input '%s': %v", name, err)
+	}
+	if err := input.Check(typed); err != nil {
+		return nil, fmt.Errorf("input '%s': %v", name, err)
+	}
+	return typed, nil
+}
+
+// typedInputs returns the inputs of the workflow being run converted to the types they are
+// declared with, for templates and step conditions. Undeclared inputs remain strings.
+func (r *Runner) typedInputs(inputs map[string]string) map[string]interface{} {
+	typed := make(map[string]interface{}, len(inputs))
+	for name, value := range inputs {
+		typed[name] = value
+		if input, declared := r.inputDefinitions[name]; declared {
+			if v, err := input.Parse(value); err == nil {
+				typed[name] = v
+			}
+		}
+	}
+	return typed
+}
+
+// executeSteps executes a list of workflow steps, recording their outputs in stepOutputs.
+func (r *Runner) executeSteps(ctx context.Context, steps []config.WorkflowStep, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string) ([]StepResult, error) {
 	var results []StepResult
-	stepOutputs := make(map[string]map[string]string)
 
 	for _, step := range steps {
 		select {
@@ -371,11 +1320,22 @@ func (r *Runner) executeSteps(ctx context.Context, steps []config.WorkflowStep,
 		default:
 		}
 
+		if len(step.Parallel) > 0 {
+			groupResults, err := r.executeParallelStep(ctx, step, workDir, inputs, stepOutputs)
+			err = r.allowFailure(ctx, step, &groupResults[0], err)
+			results = append(results, groupResults...)
+			if err != nil {
+				return results, fmt.Errorf("step '%s' failed: %w", step.ID, err)
+			}
+			continue
+		}
+
 		result, err := r.executeStep(ctx, step, workDir, inputs, stepOutputs)
+		err = r.allowFailure(ctx, step, &result, err)
 		results = append(results, result)
 
 		if err != nil {
-			return results, fmt.Errorf("step '%s' failed: %v", step.ID, err)
+			return results, fmt.Errorf("step '%s' failed: %w", step.ID, err)
 		}
 
 		// Store step outputs for future steps
@@ -387,9 +1347,49 @@ func (r *Runner) executeSteps(ctx context.Context, steps []config.WorkflowStep,
 	return results, nil
 }
 
+// allowFailure lets the workflow go on after a step with continue_on_error failed, marking its
+// result as an allowed failure. Failures caused by the cancellation or the timeout of the run are
+// never allowed.
+func (r *Runner) allowFailure(ctx context.Context, step config.WorkflowStep, result *StepResult, err error) error {
+	if err == nil || !step.ContinueOnError || ctx.Err() != nil {
+		return err
+	}
+	result.AllowedFailure = true
+	slog.Warn("step failed, continuing on error", "step", result.ID, "run_id", r.runID, "error", err)
+	return nil
+}
+
+// allowedFailures returns the IDs of the steps whose failure was allowed.
+func allowedFailures(results []StepResult) []string {
+	var ids []string
+	for _, result := range results {
+		if result.AllowedFailure {
+			ids = append(ids, result.ID)
+		}
+	}
+	return ids
+}
+
+// evaluateWorkflowOutputs evaluates the outputs declared by a workflow over the outputs of its
+// steps. It returns nil when the workflow declares none.
+func (r *Runner) evaluateWorkflowOutputs(declared, inputs map[string]string, stepOutputs map[string]map[string]string) (map[string]string, error) {
+	if len(declared) == 0 {
+		return nil, nil
+	}
+	outputs := make(map[string]string, len(declared))
+	for name, value := range declared {
+		expanded, err := r.expandTemplate(value, inputs, stepOutputs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to evaluate workflow output '%s': %v", name, err)
+		}
+		outputs[name] = expanded
+	}
+	return outputs, nil
+}
+
 // executeStep executes a single workflow step.
 func (r *Runner) executeStep(ctx context.Context, step config.WorkflowStep, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string) (StepResult, error) {
-	startTime := time.Now()
+	startTime := r.now()
 	stepID := step.ID
 	if stepID == "" {
 		stepID = fmt.Sprintf("step-%d", time.Now().UnixNano())
@@ -402,7 +1402,7 @@ func (r *Runner) executeStep(ctx context.Context, step config.WorkflowStep, work
 			Success:   false,
 			Error:     fmt.Errorf("failed to start step tracking: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
@@ -417,29 +1417,144 @@ func (r *Runner) executeStep(ctx context.Context, step config.WorkflowStep, work
 			ID:        stepID,
 			Success:   true,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 			Output:    output,
 		}, nil
 	}
 
+	// Skip the step when its if: condition does not hold
+	if result, done, err := r.evaluateStepCondition(step, stepID, inputs, stepOutputs, startTime); done {
+		return result, err
+	}
+
+	// Steps whose cache has an entry for their key are restored instead of run
+	cacheKey, result, done, err := r.restoreStepCache(step, stepID, workDir, inputs, stepOutputs, startTime)
+	if done {
+		return result, err
+	}
+
+	stepCtx, cancel := withStepTimeout(ctx, step)
+	defer cancel()
+
+	result, err = r.runStep(stepCtx, step, stepID, workDir, inputs, stepOutputs, startTime)
+	if result.Success && cacheKey != "" {
+		if cacheErr := r.saveStepCache(step, stepID, cacheKey, workDir, result); cacheErr != nil {
+			slog.Warn("failed to cache step", "step", stepID, "error", cacheErr)
+		}
+	}
+
+	// Tell apart steps stopped by a timeout or a cancellation from ordinary failures
+	if !result.Success && stepCtx.Err() != nil {
+		if errorType, interruption := stepInterruption(stepCtx); interruption != nil {
+			err = fmt.Errorf("%w: %v", interruption, result.Error)
+			result.Error = err
+			result.ErrorType = errorType
+			r.state.FailStep(stepID, err.Error())
+		}
+	}
+
+	return result, err
+}
+
+// runStep runs a step according to its kind: built-in, container, or shell command.
+func (r *Runner) runStep(ctx context.Context, step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
 	// Check if this is a built-in step (uses: field)
 	if step.Uses != "" {
-		return r.executeBuiltinStep(ctx, step, stepID, startTime)
+		return r.executeBuiltinStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
+	}
+
+	// On the container backend, steps without an image run in the workflow's image
+	if step.Image == "" && r.containerImage != "" {
+		step.Image = r.containerImage
+	}
+
+	// Check if this is a container step (image: field)
+	if IsContainerStep(step) {
+		return r.executeContainerStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
 	}
 
-	// Check if this is a container step (image: field)
-	if IsContainerStep(step) {
-		return r.executeContainerStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
+	// Execute shell command
+	return r.executeShellStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
+}
+
+// evaluateStepCondition evaluates the if: condition of a step. When the step must not run,
+// because the condition does not hold or cannot be evaluated, it records the outcome and
+// returns the final result of the step with done set.
+func (r *Runner) evaluateStepCondition(step config.WorkflowStep, stepID string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, bool, error) {
+	if step.If == "" {
+		return StepResult{}, false, nil
+	}
+
+	run, err := r.conditions.Evaluate(step.If, r.typedInputs(inputs), stepOutputs)
+	if err != nil {
+		err = fmt.Errorf("failed to evaluate condition '%s': %v", step.If, err)
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, true, err
+	}
+	if !run {
+		r.state.SkipStep(stepID)
+		return StepResult{
+			ID:        stepID,
+			Success:   true,
+			Skipped:   true,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, true, nil
+	}
+	return StepResult{}, false, nil
+}
+
+// withStepTimeout bounds a step by its own timeout, within whatever remains of the workflow timeout.
+func withStepTimeout(ctx context.Context, step config.WorkflowStep) (context.Context, context.CancelFunc) {
+	if step.Timeout == "" {
+		return ctx, func() {}
 	}
+	timeout, _ := time.ParseDuration(step.Timeout) // Validated when the config is loaded
+	return context.WithTimeoutCause(ctx, timeout, fmt.Errorf("%w after %s", ErrStepTimeout, step.Timeout))
+}
 
-	// Execute shell command
-	return r.executeShellStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
+// stepInterruption returns the error type and error describing why a step's context ended:
+// its own timeout, the workflow timeout, a cancellation of the run, or the failure of a
+// parallel step running alongside it. It returns a nil error when the context ended for
+// another reason.
+func stepInterruption(ctx context.Context) (string, error) {
+	cause := context.Cause(ctx)
+	switch {
+	case errors.Is(cause, ErrRunCancelled):
+		return interfaces.StepErrorCancelled, ErrRunCancelled
+	case errors.Is(cause, ErrStepTimeout):
+		return interfaces.StepErrorStepTimeout, cause
+	case errors.Is(cause, ErrWorkflowTimeout):
+		return interfaces.StepErrorWorkflowTimeout, ErrWorkflowTimeout
+	case errors.Is(cause, errParallelStepFailed):
+		return interfaces.StepErrorCancelled, errParallelStepFailed
+	default:
+		return "", nil
+	}
 }
 
 // executeShellStep executes a step with a shell command.
 func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
+	dir, err := r.resolveWorkingDirectory(step, workDir, inputs, stepOutputs)
+	if err != nil {
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
 	// Expand template variables in the command
-	command, err := r.expandTemplate(step.Run, inputs, stepOutputs)
+	command, err := r.expandTemplateIn(step.Run, dir, inputs, stepOutputs)
 	if err != nil {
 		r.state.FailStep(stepID, fmt.Sprintf("template expansion failed: %v", err))
 		return StepResult{
@@ -447,38 +1562,116 @@ func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep,
 			Success:   false,
 			Error:     fmt.Errorf("template expansion failed: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
-	// Create command with proper context cancellation
-	cmd := exec.CommandContext(ctx, "sh", "-c", command)
-	cmd.Dir = workDir
+	// Create command with proper context cancellation, run by the step's shell
+	shell := step.Shell
+	if shell == "" {
+		shell = r.shell
+	}
+	if shell == "" {
+		shell = defaultShell()
+	}
+	// Multi-line commands run from a script, so that failures can point at their line
+	var script *stepScript
+	if isMultilineScript(command) {
+		script, err = writeStepScript(shell, command)
+		if err != nil {
+			r.state.FailStep(stepID, fmt.Sprintf("failed to write script: %v", err))
+			return StepResult{
+				ID:        stepID,
+				Success:   false,
+				Error:     fmt.Errorf("failed to write script: %v", err),
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+		defer script.Remove()
+	}
+	var cmd *exec.Cmd
+	if script != nil {
+		cmd = script.Command(ctx)
+	} else {
+		cmd = newShellCommand(ctx, shell, command)
+	}
+	cmd.Dir = dir
+	killProcessGroupOnCancel(cmd)
+	// Processes that escaped the step's process group may keep its output pipes open;
+	// do not wait for them for more than a few seconds after a cancellation
+	cmd.WaitDelay = 5 * time.Second
 
 	// Set up environment variables
-	env := r.getEnvironment()
+	env := r.stepEnvironment()
 	cmd.Env = append(env,
 		fmt.Sprintf("TAKO_RUN_ID=%s", r.runID),
 		fmt.Sprintf("TAKO_STEP_ID=%s", stepID),
 		fmt.Sprintf("TAKO_WORKSPACE=%s", r.workspaceRoot),
 	)
+	cmd.Env = append(cmd.Env, r.runLinkEnvironment()...)
 
 	// Add inputs as environment variables
 	for key, value := range inputs {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("TAKO_INPUT_%s=%s", strings.ToUpper(key), value))
 	}
 
-	// Capture stdout and stderr
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	// Tell the step where to reach the workflow's services
+	for key, value := range r.services.Env(false) {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// The workflow's environment variables, then the step's own, including those of the
+	// profile, come last and win
+	for key, value := range r.workflowEnv {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+	for key, value := range step.Env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
+	}
+
+	// Stream stdout and stderr to the step log, keeping their end in memory
+	capture := newStepOutput(r.logDir(), stepID, r.followLabel(stepID), r.logs, step.Produces != nil && len(step.Produces.Outputs) > 0)
+	defer capture.Close()
+	cmd.Stdout = capture.Stdout()
+	cmd.Stderr = capture.Stderr()
+
+	// Enforce the resource limits of the step and its repository on its processes
+	confinement, err := r.confineStep(cmd, step, stepID, workDir)
+	if err != nil {
+		r.state.FailStep(stepID, fmt.Sprintf("resource enforcement failed: %v", err))
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     fmt.Errorf("resource enforcement failed: %v", err),
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+	defer confinement.Release()
 
 	// Execute the command
-	err = cmd.Run()
+	err = cmd.Start()
+	if err == nil {
+		if confineErr := confinement.Started(cmd.Process.Pid); confineErr != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			err = confineErr
+		} else {
+			err = cmd.Wait()
+		}
+	}
+	if err != nil {
+		if exceeded := confinement.Exceeded(); exceeded != nil {
+			err = fmt.Errorf("%v: %w", exceeded, err)
+		}
+	}
 
-	endTime := time.Now()
-	output := stdout.String()
-	errorOutput := stderr.String()
+	endTime := r.now()
+	stdout := capture.stdout.String()
+	stderr := capture.stderr.String()
+	output := capture.Output()
+	errorOutput := capture.ErrorOutput()
 
 	// Process outputs if step produces them
 	stepOutputValues := make(map[string]string)
@@ -486,13 +1679,13 @@ func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep,
 		for outputName, outputFormat := range step.Produces.Outputs {
 			switch outputFormat {
 			case "from_stdout":
-				stepOutputValues[outputName] = strings.TrimSpace(output)
+				stepOutputValues[outputName] = strings.TrimSpace(stdout)
 			case "from_stderr":
-				stepOutputValues[outputName] = strings.TrimSpace(errorOutput)
+				stepOutputValues[outputName] = strings.TrimSpace(stderr)
 			default:
 				// Try to extract from stdout using the format as a regex
 				if re, regexErr := regexp.Compile(outputFormat); regexErr == nil {
-					matches := re.FindStringSubmatch(output)
+					matches := re.FindStringSubmatch(stdout)
 					if len(matches) > 1 {
 						stepOutputValues[outputName] = matches[1]
 					}
@@ -503,7 +1696,16 @@ func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep,
 
 	// Update state based on execution result
 	if err != nil {
-		fullError := fmt.Sprintf("command failed: %v", err)
+		// Scripts report the line of their command that failed
+		errorLine := 0
+		failure := err.Error()
+		if script != nil {
+			if errorLine = script.ErrorLine(stderr); errorLine > 0 {
+				failure = fmt.Sprintf("line %d: %v", errorLine, err)
+			}
+		}
+
+		fullError := fmt.Sprintf("command failed: %s", failure)
 		if errorOutput != "" {
 			fullError = fmt.Sprintf("%s\nstderr: %s", fullError, errorOutput)
 		}
@@ -513,11 +1715,12 @@ func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep,
 		return StepResult{
 			ID:        stepID,
 			Success:   false,
-			Error:     fmt.Errorf("command execution failed: %v", err),
+			Error:     fmt.Errorf("command execution failed: %s", failure),
 			StartTime: startTime,
 			EndTime:   endTime,
 			Output:    output,
 			Outputs:   stepOutputValues,
+			ErrorLine: errorLine,
 		}, err
 	}
 
@@ -535,10 +1738,32 @@ func (r *Runner) executeShellStep(ctx context.Context, step config.WorkflowStep,
 }
 
 // executeBuiltinStep executes a built-in Tako step.
-func (r *Runner) executeBuiltinStep(ctx context.Context, step config.WorkflowStep, stepID string, startTime time.Time) (StepResult, error) {
+func (r *Runner) executeBuiltinStep(ctx context.Context, step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
 	switch step.Uses {
 	case "tako/fan-out@v1":
-		return r.executeFanOutStep(ctx, step, stepID, startTime)
+		expanded, err := r.expandFanOutPayloads(step, inputs, stepOutputs)
+		if err == nil {
+			expanded, err = r.resolveChangedPaths(ctx, expanded, workDir)
+		}
+		if err != nil {
+			r.state.FailStep(stepID, err.Error())
+			return StepResult{
+				ID:        stepID,
+				Success:   false,
+				Error:     err,
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
+		return r.executeFanOutStep(ctx, r.overrideFanOutWait(r.addPublishedArtifacts(expanded)), stepID, startTime)
+	case "tako/call-workflow@v1":
+		return r.executeCallWorkflowStep(ctx, step, stepID, workDir, inputs, stepOutputs, startTime)
+	case "tako/notify-slack@v1", "tako/notify-webhook@v1", "tako/notify-email@v1":
+		return r.executeNotifyStep(ctx, step, stepID, inputs, stepOutputs, startTime)
+	case "tako/publish-artifact@v1":
+		return r.executePublishArtifactStep(ctx, step, stepID, inputs, stepOutputs, startTime)
+	case "tako/approval@v1":
+		return r.executeApprovalStep(ctx, step, stepID, inputs, stepOutputs, startTime)
 	default:
 		err := fmt.Errorf("unknown built-in step: %s", step.Uses)
 		r.state.FailStep(stepID, err.Error())
@@ -547,26 +1772,161 @@ func (r *Runner) executeBuiltinStep(ctx context.Context, step config.WorkflowSte
 			Success:   false,
 			Error:     err,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 }
 
+// expandFanOutPayloads returns the fan-out step with the templates in the string values of its
+// payload, and of the payloads of a batch of events, expanded over the inputs and the outputs of
+// the prior steps, so the FanOutExecutor only sees the resulting values.
+func (r *Runner) expandFanOutPayloads(step config.WorkflowStep, inputs map[string]string, stepOutputs map[string]map[string]string) (config.WorkflowStep, error) {
+	expand := func(value interface{}) (interface{}, error) {
+		return r.expandPayloadValue(value, inputs, stepOutputs)
+	}
+
+	with := make(map[string]interface{}, len(step.With))
+	for key, value := range step.With {
+		with[key] = value
+	}
+	if payload, ok := with["payload"]; ok {
+		expanded, err := expand(payload)
+		if err != nil {
+			return step, fmt.Errorf("failed to expand payload: %v", err)
+		}
+		with["payload"] = expanded
+	}
+	for _, key := range []string{"changed_since", "changed_paths", "artifact_digest"} {
+		if value, ok := with[key]; ok {
+			expanded, err := expand(value)
+			if err != nil {
+				return step, fmt.Errorf("failed to expand %s: %v", key, err)
+			}
+			with[key] = expanded
+		}
+	}
+	if events, ok := with["events"].([]interface{}); ok {
+		expandedEvents := make([]interface{}, len(events))
+		for i, event := range events {
+			expandedEvents[i] = event
+			fields, ok := event.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			payload, ok := fields["payload"]
+			if !ok {
+				continue
+			}
+			expanded, err := expand(payload)
+			if err != nil {
+				return step, fmt.Errorf("failed to expand events[%d].payload: %v", i, err)
+			}
+			expandedFields := make(map[string]interface{}, len(fields))
+			for key, value := range fields {
+				expandedFields[key] = value
+			}
+			expandedFields["payload"] = expanded
+			expandedEvents[i] = expandedFields
+		}
+		with["events"] = expandedEvents
+	}
+
+	step.With = with
+	return step, nil
+}
+
+// overrideFanOutWait returns the fan-out step with the wait_for_children of the run, when set.
+func (r *Runner) overrideFanOutWait(step config.WorkflowStep) config.WorkflowStep {
+	if r.waitForChildren == nil {
+		return step
+	}
+	with := make(map[string]interface{}, len(step.With)+1)
+	for key, value := range step.With {
+		with[key] = value
+	}
+	with["wait_for_children"] = *r.waitForChildren
+	step.With = with
+	return step
+}
+
+// resolveChangedPaths replaces the changed_since revision of a fan-out step with the
+// changed_paths of the repository since that revision, which the FanOutExecutor adds to the
+// payloads of the events.
+func (r *Runner) resolveChangedPaths(ctx context.Context, step config.WorkflowStep, workDir string) (config.WorkflowStep, error) {
+	since, ok := step.With["changed_since"]
+	if !ok {
+		return step, nil
+	}
+	sinceRef, ok := since.(string)
+	if !ok || strings.TrimSpace(sinceRef) == "" {
+		return step, fmt.Errorf("changed_since must be a revision")
+	}
+	if _, ok := step.With["changed_paths"]; ok {
+		return step, fmt.Errorf("changed_since cannot be used with changed_paths")
+	}
+	changedPaths, err := r.gitManager.ChangedPaths(ctx, workDir, sinceRef)
+	if err != nil {
+		return step, fmt.Errorf("failed to compute the paths changed since %s: %v", sinceRef, err)
+	}
+
+	with := make(map[string]interface{}, len(step.With))
+	for key, value := range step.With {
+		with[key] = value
+	}
+	delete(with, "changed_since")
+	with["changed_paths"] = changedPaths
+	step.With = with
+	return step, nil
+}
+
+// expandPayloadValue expands the templates in the strings of a payload value, walking its maps
+// and lists. Strings without a template are kept as they are.
+func (r *Runner) expandPayloadValue(value interface{}, inputs map[string]string, stepOutputs map[string]map[string]string) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !strings.Contains(v, "{{") {
+			return v, nil
+		}
+		return r.expandTemplate(v, inputs, stepOutputs)
+	case map[string]interface{}:
+		expanded := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			expandedItem, err := r.expandPayloadValue(item, inputs, stepOutputs)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", key, err)
+			}
+			expanded[key] = expandedItem
+		}
+		return expanded, nil
+	case []interface{}:
+		expanded := make([]interface{}, len(v))
+		for i, item := range v {
+			expandedItem, err := r.expandPayloadValue(item, inputs, stepOutputs)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %v", i, err)
+			}
+			expanded[i] = expandedItem
+		}
+		return expanded, nil
+	default:
+		return value, nil
+	}
+}
+
 // executeFanOutStep executes the tako/fan-out@v1 built-in step.
 //
-//nolint:contextcheck,unparam // TODO: Pass context through FanOutExecutor in future refactoring
+//nolint:unparam // Keeps the signature shared by the built-in step executors
 func (r *Runner) executeFanOutStep(ctx context.Context, step config.WorkflowStep, stepID string, startTime time.Time) (StepResult, error) {
-	// Extract event type from step parameters
-	eventType, ok := step.With["event_type"].(string)
-	if !ok || eventType == "" {
-		err := fmt.Errorf("event_type is required for fan-out step")
+	// Extract the event types from step parameters: its event_type, or those of a batch
+	eventTypes, err := fanOutEventTypes(step.With)
+	if err != nil {
 		r.state.FailStep(stepID, err.Error())
 		return StepResult{
 			ID:        stepID,
 			Success:   false,
 			Error:     err,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
@@ -574,53 +1934,56 @@ func (r *Runner) executeFanOutStep(ctx context.Context, step config.WorkflowStep
 	sourceRepo := r.getSourceRepository()
 	artifact := fmt.Sprintf("%s:default", sourceRepo)
 
+	// Bring stale cached repositories up to date so their current subscriptions are seen
+	r.gitManager.RefreshStale(ctx)
+
 	// Use Orchestrator to discover subscriptions
-	subscriptions, err := r.orchestrator.DiscoverSubscriptions(ctx, artifact, eventType)
-	if err != nil {
-		slog.Error("failed to discover subscriptions", "event", eventType, "error", err)
-		r.state.FailStep(stepID, err.Error())
-		return StepResult{
-			ID:        stepID,
-			Success:   false,
-			Error:     fmt.Errorf("failed to discover subscriptions: %w", err),
-			StartTime: startTime,
-			EndTime:   time.Now(),
-		}, err
-	}
+	subscriptions := []interfaces.SubscriptionMatch{}
+	for _, eventType := range eventTypes {
+		discovered, err := r.orchestrator.DiscoverSubscriptions(ctx, artifact, eventType)
+		if err != nil {
+			slog.Error("failed to discover subscriptions", "event", eventType, "error", err)
+			r.state.FailStep(stepID, err.Error())
+			return StepResult{
+				ID:        stepID,
+				Success:   false,
+				Error:     fmt.Errorf("failed to discover subscriptions: %w", err),
+				StartTime: startTime,
+				EndTime:   r.now(),
+			}, err
+		}
 
-	// Log discovered subscriptions
-	if len(subscriptions) == 0 {
-		slog.Info("no subscriptions found for event, skipping fan-out", "event", eventType)
-	} else {
-		slog.Info("discovered subscriptions for fan-out", "event", eventType, "count", len(subscriptions))
-		for _, sub := range subscriptions {
-			slog.Debug("subscription found",
-				"repository", sub.Repository,
-				"workflow", sub.Subscription.Workflow,
-				"artifact", sub.Subscription.Artifact)
+		// Log discovered subscriptions
+		if len(discovered) == 0 {
+			slog.Info("no subscriptions found for event, skipping fan-out", "event", eventType)
+		} else {
+			slog.Info("discovered subscriptions for fan-out", "event", eventType, "count", len(discovered))
+			for _, sub := range discovered {
+				slog.Debug("subscription found",
+					"repository", sub.Repository,
+					"workflow", sub.Subscription.Workflow,
+					"artifact", sub.Subscription.Artifact)
+			}
 		}
+		subscriptions = mergeSubscriptions(subscriptions, discovered)
 	}
 
-	// Create fan-out executor with cache directory and debug mode
-	cacheDir := r.getCacheDir()
-	debug := r.isDebugMode()
-
-	executor, err := NewFanOutExecutor(cacheDir, debug, r.childWorkflowRunner)
+	executor, err := r.newFanOutExecutor()
 	if err != nil {
-		err = fmt.Errorf("failed to create fan-out executor: %v", err)
 		r.state.FailStep(stepID, err.Error())
 		return StepResult{
 			ID:        stepID,
 			Success:   false,
 			Error:     err,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
 	// Execute the fan-out step with pre-discovered subscriptions
-	result, err := executor.ExecuteWithSubscriptions(step, sourceRepo, subscriptions)
-	endTime := time.Now()
+	result, err := executor.ExecuteWithSubscriptionsContext(ctx, step, sourceRepo, subscriptions)
+	endTime := r.now()
+	r.notifyFanOut(ctx, stepID, result, err)
 
 	if err != nil {
 		r.state.FailStep(stepID, err.Error())
@@ -633,6 +1996,21 @@ func (r *Runner) executeFanOutStep(ctx context.Context, step config.WorkflowStep
 		}, err
 	}
 
+	r.childMu.Lock()
+	if result.ChildrenSummary != nil {
+		r.childCounts.add(*result.ChildrenSummary)
+	}
+	if r.reportChildren != nil {
+		r.reportChildren[stepID] = newReportChildren(result)
+	}
+	if r.childResults != nil {
+		r.childResults[stepID] = newChildResults(stepID, result)
+	}
+	if r.emittedEvents != nil && result.EventEmitted {
+		r.emittedEvents[stepID] = eventTypes
+	}
+	r.childMu.Unlock()
+
 	// Convert fan-out result to StepResult
 	stepResult := StepResult{
 		ID:        stepID,
@@ -645,6 +2023,15 @@ func (r *Runner) executeFanOutStep(ctx context.Context, step config.WorkflowStep
 	if result.Success {
 		stepResult.Output = fmt.Sprintf("Fan-out completed: triggered %d workflows, found %d subscribers",
 			result.TriggeredCount, result.SubscribersFound)
+		if result.Unchanged > 0 {
+			stepResult.Output += fmt.Sprintf(", skipped %d unchanged", result.Unchanged)
+		}
+		for _, diamond := range result.Diamonds {
+			stepResult.Output += fmt.Sprintf(", skipped %s for %s (diamond strategy %s)", strings.Join(diamond.Losers, ", "), diamond.Winner, diamond.Strategy)
+		}
+		for _, subscriber := range result.SchemaIncompatible {
+			stepResult.Output += fmt.Sprintf(", excluded %s: incompatible with schema version %s of %s", subscriber, subscriber.SchemaVersion, subscriber.EventType)
+		}
 		r.state.CompleteStep(stepID, stepResult.Output, nil)
 	} else {
 		errorMsg := fmt.Sprintf("Fan-out failed: %v", result.Errors)
@@ -673,12 +2060,31 @@ func (r *Runner) isDebugMode() bool {
 	return r.mode == ExecutionModeDebug
 }
 
+// seedLineage starts the lineage of the root run of an execution tree with its own workflow,
+// so that the events of its descendants cannot trigger it again. Runs that inherited a lineage
+// already end with their own workflow.
+func (r *Runner) seedLineage(repoPath, workflowName string) {
+	if len(r.lineage) > 0 {
+		return
+	}
+	repository := r.repository
+	if repository == "" {
+		repository = r.getRepositoryNameFromPath(repoPath)
+	}
+	r.lineage = []string{lineageNode(repository, workflowName)}
+	r.state.mu.Lock()
+	r.state.Lineage = r.lineage
+	r.state.mu.Unlock()
+}
+
 // getSourceRepository returns the source repository identifier for fan-out events.
-// This identifies which repository is emitting the event.
+// This identifies which repository is emitting the event: owner/repo when the run knows it
+// from its repository specification, as child runs do, or else a placeholder.
 func (r *Runner) getSourceRepository() string {
-	// For now, return a placeholder
-	// In production, this should be derived from the workflow context
-	// TODO: Enhance to get actual repository from workflow context
+	if r.repository != "" {
+		return r.repository
+	}
+	// TODO: Enhance to get actual repository of local runs from workflow context
 	return "current-repo"
 }
 
@@ -686,21 +2092,46 @@ func (r *Runner) getSourceRepository() string {
 func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (StepResult, error) {
 	// Check if container manager is available
 	if r.containerManager == nil {
-		err := fmt.Errorf("container execution requested but no container runtime is available")
+		err := fmt.Errorf("container execution requested but no container runtime is available: %v", r.containerErr)
+		r.state.FailStep(stepID, err.Error())
+		return StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, err
+	}
+
+	// The repository is mounted at /workspace, and the step runs in its working directory there
+	dir, err := r.resolveWorkingDirectory(step, workDir, inputs, stepOutputs)
+	if err != nil {
 		r.state.FailStep(stepID, err.Error())
 		return StepResult{
 			ID:        stepID,
 			Success:   false,
 			Error:     err,
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
+	containerDir := ""
+	if dir != workDir {
+		rel, _ := filepath.Rel(workDir, dir)
+		containerDir = path.Join("/workspace", filepath.ToSlash(rel))
+	}
 
 	// Expand template variables in the command
 	command := step.Run
 	if command != "" {
-		expandedCommand, err := r.expandTemplate(command, inputs, stepOutputs)
+		templateDir := containerDir
+		if templateDir == "" {
+			templateDir = "/workspace"
+			if step.Container != nil && step.Container.WorkDir != "" {
+				templateDir = step.Container.WorkDir
+			}
+		}
+		expandedCommand, err := r.expandTemplateIn(command, templateDir, inputs, stepOutputs)
 		if err != nil {
 			r.state.FailStep(stepID, fmt.Sprintf("template expansion failed: %v", err))
 			return StepResult{
@@ -708,7 +2139,7 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 				Success:   false,
 				Error:     fmt.Errorf("template expansion failed: %v", err),
 				StartTime: startTime,
-				EndTime:   time.Now(),
+				EndTime:   r.now(),
 			}, err
 		}
 		command = expandedCommand
@@ -717,9 +2148,25 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 	// Create a modified step with expanded command for container config
 	containerStep := step
 	containerStep.Run = command
+	if containerStep.Shell == "" {
+		containerStep.Shell = r.shell
+	}
+	if containerDir != "" {
+		options := config.ContainerOptions{}
+		if step.Container != nil {
+			options = *step.Container
+		}
+		options.WorkDir = containerDir
+		containerStep.Container = &options
+	}
+
+	// Containers join the network of the workflow's services unless the step chose a network
+	if r.services != nil && step.Network == "" && (step.Container == nil || step.Container.Network == "") {
+		containerStep.Network = r.services.Network
+	}
 
 	// Build container configuration
-	env := r.getEnvironment()
+	env := r.stepEnvironment()
 	envMap := make(map[string]string)
 	for _, envVar := range env {
 		if parts := strings.SplitN(envVar, "=", 2); len(parts) == 2 {
@@ -731,12 +2178,24 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 	envMap["TAKO_RUN_ID"] = r.runID
 	envMap["TAKO_STEP_ID"] = stepID
 	envMap["TAKO_WORKSPACE"] = r.workspaceRoot
+	envMap[ParentRunIDEnv] = r.runID
+	envMap[CorrelationIDEnv] = r.correlationID
 
 	// Add inputs as environment variables
 	for key, value := range inputs {
 		envMap[fmt.Sprintf("TAKO_INPUT_%s", strings.ToUpper(key))] = value
 	}
 
+	// Tell the step where to reach the workflow's services
+	for key, value := range r.services.Env(true) {
+		envMap[key] = value
+	}
+
+	// The workflow's environment variables; the container manager adds the step's over them
+	for key, value := range r.workflowEnv {
+		envMap[key] = value
+	}
+
 	// Get repository name from work directory for resource validation
 	repoName := r.getRepositoryNameFromPath(workDir)
 
@@ -760,7 +2219,7 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 				Success:   false,
 				Error:     fmt.Errorf("resource validation failed: %v", err),
 				StartTime: startTime,
-				EndTime:   time.Now(),
+				EndTime:   r.now(),
 			}, err
 		}
 	}
@@ -779,15 +2238,21 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 			Success:   false,
 			Error:     fmt.Errorf("container configuration failed: %v", err),
 			StartTime: startTime,
-			EndTime:   time.Now(),
+			EndTime:   r.now(),
 		}, err
 	}
 
-	// Pull image if needed (with retry for network issues)
+	// Stream stdout and stderr to the step log, keeping their end in memory
+	capture := newStepOutput(r.logDir(), stepID, r.followLabel(stepID), r.logs, step.Produces != nil && len(step.Produces.Outputs) > 0)
+	defer capture.Close()
+	containerConfig.Stdout = capture.Stdout()
+	containerConfig.Stderr = capture.Stderr()
+
+	// Pull image according to the step's pull policy
 	pullCtx, pullCancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer pullCancel()
 
-	if err := r.containerManager.PullImage(pullCtx, step.Image); err != nil {
+	if err := r.containerManager.EnsureImage(pullCtx, step.Image, containerConfig.PullPolicy); err != nil {
 		// Log warning but continue if image might be available locally
 		if r.debug {
 			fmt.Printf("Warning: failed to pull image %s: %v\n", step.Image, err)
@@ -796,7 +2261,7 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 
 	// Execute container
 	result, err := r.containerManager.RunContainer(ctx, containerConfig, stepID)
-	endTime := time.Now()
+	endTime := r.now()
 
 	if err != nil {
 		r.state.FailStep(stepID, fmt.Sprintf("container execution failed: %v", err))
@@ -806,14 +2271,14 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 			Error:     fmt.Errorf("container execution failed: %v", err),
 			StartTime: startTime,
 			EndTime:   endTime,
-			Output:    result.Stderr, // Include stderr in output for debugging
+			Output:    capture.ErrorOutput(), // Include stderr in output for debugging
 		}, err
 	}
 
 	// Combine stdout and stderr for output
-	output := result.Stdout
-	if result.Stderr != "" {
-		output = fmt.Sprintf("%s\nSTDERR:\n%s", result.Stdout, result.Stderr)
+	output := capture.Output()
+	if errorOutput := capture.ErrorOutput(); errorOutput != "" {
+		output = fmt.Sprintf("%s\nSTDERR:\n%s", output, errorOutput)
 	}
 
 	// Check exit code
@@ -836,12 +2301,12 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 		for outputName, outputType := range step.Produces.Outputs {
 			switch outputType {
 			case "from_stdout":
-				stepOutputValues[outputName] = strings.TrimSpace(result.Stdout)
+				stepOutputValues[outputName] = strings.TrimSpace(capture.stdout.String())
 			case "from_stderr":
-				stepOutputValues[outputName] = strings.TrimSpace(result.Stderr)
+				stepOutputValues[outputName] = strings.TrimSpace(capture.stderr.String())
 			default:
 				// For other output types, would need to implement file reading, etc.
-				stepOutputValues[outputName] = strings.TrimSpace(result.Stdout)
+				stepOutputValues[outputName] = strings.TrimSpace(capture.stdout.String())
 			}
 		}
 	}
@@ -859,12 +2324,230 @@ func (r *Runner) executeContainerStep(ctx context.Context, step config.WorkflowS
 	}, nil
 }
 
+// childBudgetLimit returns the cap of the child workflows of the execution tree: that of the
+// options, or else that of the execution configuration of the workflow's repository.
+func (r *Runner) childBudgetLimit() int {
+	if r.maxTotalChildren == 0 && r.executionConfig != nil {
+		return r.executionConfig.MaxTotalChildren
+	}
+	return r.maxTotalChildren
+}
+
+// Backends returns the registry of the backends child workflows run on, to register
+// additional backends.
+func (r *Runner) Backends() *BackendRegistry {
+	return r.backends
+}
+
+// CircuitBreakers returns the manager of the circuit breakers of the runner's fan-outs.
+func (r *Runner) CircuitBreakers() *CircuitBreakerManager {
+	return r.circuitBreakers
+}
+
+// newFanOutExecutor creates the executor of the runner's fan-outs.
+func (r *Runner) newFanOutExecutor() (*FanOutExecutor, error) {
+	executor, err := NewFanOutExecutor(r.getCacheDir(), r.isDebugMode(), r.childWorkflowRunner)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create fan-out executor: %v", err)
+	}
+	executor.SetLockOwner(r.runID, r.parentRunID)
+	executor.SetNamespace(r.namespace)
+	executor.SetCorrelationID(r.correlationID)
+	executor.SetLineage(r.lineage, r.maxFanOutDepth)
+	executor.SetChildBudget(r.childBudget, r.childBudgetLimit())
+	executor.SetEventPublisher(r.eventPublisher)
+	executor.SetEventSigning(r.eventSigningKey, r.getEnvironment())
+	executor.SetEventSchemas(r.eventSchemas)
+	executor.SetDiamondStrategies(r.diamondStrategies)
+	executor.SetCircuitBreakerManager(r.circuitBreakers)
+	executor.SetFaultInjector(r.faults)
+	executor.SetClock(r.clock)
+	executor.SetRevisionLock(r.revisions)
+	executor.SetChangedSince(r.fanOutSince)
+	r.fanOuts.apply(executor)
+	if r.backends.Default() != BackendRemote {
+		// Remote children run on the revisions GitHub resolves, without local clones
+		executor.SetGitManager(r.gitManager)
+	}
+	return executor, nil
+}
+
+// WatchCircuitBreakers configures the circuit breakers of the runner's fan-outs from the
+// circuit_breakers section of a tako.yml or daemon config file, or from FanOutOptions when it has
+// none, then reloads them whenever the file changes until ctx is done.
+func (r *Runner) WatchCircuitBreakers(ctx context.Context, path string) error {
+	watcher := NewCircuitBreakerConfigWatcher(path, r.circuitBreakers)
+	watcher.SetFallback(r.fanOuts.CircuitBreakers)
+	if _, err := watcher.Reload(); err != nil {
+		return err
+	}
+	go watcher.Watch(ctx, DefaultCircuitBreakerReloadInterval)
+	return nil
+}
+
+// WatchSubscriptions reloads the subscriptions of the cached repositories whose tako.yml
+// changes, or which are added to or removed from the cache, until ctx is done.
+func (r *Runner) WatchSubscriptions(ctx context.Context) error {
+	return SubscriptionCatalogFor(r.getCacheDir()).Watch(ctx)
+}
+
+// DispatchEvent triggers the subscribers of an event received from outside a workflow, e.g.
+// from a message broker, as if its source repository had emitted it with a fan-out step that
+// waits for its children. A non-empty eventID makes the fan-out idempotent: the subscribers of
+// an event are triggered once however many times it is dispatched with the same ID.
+func (r *Runner) DispatchEvent(ctx context.Context, event *EnhancedEvent, eventID string) (*FanOutResult, error) {
+	if event.Metadata.Source == "" {
+		return nil, fmt.Errorf("event '%s' has no source repository", event.Type)
+	}
+
+	r.gitManager.RefreshStale(ctx)
+	subscriptions, err := r.orchestrator.DiscoverSubscriptions(ctx, fmt.Sprintf("%s:default", event.Metadata.Source), event.Type)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover subscriptions: %w", err)
+	}
+
+	executor, err := r.newFanOutExecutor()
+	if err != nil {
+		return nil, err
+	}
+	with := map[string]interface{}{
+		"event_type":        event.Type,
+		"payload":           event.Payload,
+		"wait_for_children": true,
+	}
+	if _, version, ok := strings.Cut(event.Schema, "@"); ok {
+		with["schema_version"] = version
+	}
+	// Subscribers verify the signature of the envelope as it was received, when it is known
+	if received, ok := receivedEventFromContext(ctx); ok {
+		executor.SetReceivedEvent(received)
+	} else {
+		executor.SetReceivedEvent(event)
+	}
+
+	// Every dispatched event starts an execution tree, unless it belongs to the tree of its emitter
+	correlationID := event.Metadata.Correlation
+	if correlationID == "" {
+		correlationID = NamespacedRunID(GenerateRunID(), r.namespace)
+	}
+	executor.SetCorrelationID(correlationID)
+	if eventID != "" {
+		executor.SetIdempotency(true)
+		with["event_id"] = eventID
+	}
+
+	step := config.WorkflowStep{ID: "dispatch", Uses: "tako/fan-out@v1", With: with}
+	return executor.ExecuteWithSubscriptionsContext(ctx, step, event.Metadata.Source, subscriptions)
+}
+
+// RetryFanOut triggers the children of a finished fan-out that did not complete again, or with
+// onlyFailed only those that failed or timed out, with the events the fan-out emitted. The
+// fan-out state is updated in place rather than a new fan-out being started.
+func (r *Runner) RetryFanOut(ctx context.Context, fanOutID string, onlyFailed bool) (*FanOutResult, error) {
+	r.gitManager.RefreshStale(ctx)
+	executor, err := r.newFanOutExecutor()
+	if err != nil {
+		return nil, err
+	}
+	return executor.Retry(ctx, fanOutID, onlyFailed)
+}
+
+// selectBackend selects the default backend of child workflows: the backend of the options,
+// or else the one of the repository's execution configuration, or else BackendLocal.
+func (r *Runner) selectBackend(execution *config.Execution) error {
+	backend := r.backend
+	if backend == "" && execution != nil {
+		backend = execution.Backend
+	}
+	if backend == "" {
+		backend = BackendLocal
+	}
+	return r.backends.SetDefault(backend)
+}
+
+// setRepositoryLimits sets the aggregate resource limits of the repository a workflow runs in.
+func (r *Runner) setRepositoryLimits(resources config.Resources, repoPath string) error {
+	limits, err := processLimitsFromResources(&resources)
+	if err != nil {
+		return err
+	}
+	r.repoLimits = limits
+
+	if r.resourceManager != nil && !limits.IsZero() {
+		return r.resourceManager.SetRepositoryQuota(r.getRepositoryNameFromPath(repoPath), resources)
+	}
+	return nil
+}
+
+// confineStep prepares the command of a shell step to run within the resource limits of the
+// step and of its repository. It returns a nil confinement when there is nothing to enforce,
+// or when limits cannot be enforced on this system, in which case they are only validated.
+func (r *Runner) confineStep(cmd *exec.Cmd, step config.WorkflowStep, stepID, workDir string) (*confinement, error) {
+	stepLimits, err := processLimitsFromResources(step.Resources)
+	if err != nil {
+		return nil, err
+	}
+	if stepLimits.IsZero() && r.repoLimits.IsZero() {
+		return nil, nil
+	}
+
+	repoName := r.getRepositoryNameFromPath(workDir)
+	if r.resourceManager != nil && step.Resources != nil {
+		if err := r.resourceManager.ValidateResourceRequest(repoName, stepID, step.Resources.CPULimit, step.Resources.MemLimit); err != nil {
+			return nil, err
+		}
+	}
+
+	if r.processLimiter == nil {
+		slog.Warn("resource limits of shell steps are not enforced", "step", stepID, "reason", r.processLimiterErr)
+		return nil, nil
+	}
+	confinement, err := r.processLimiter.Confine(cmd, repoName, fmt.Sprintf("%s-%s", r.runID, stepID), stepLimits, r.repoLimits)
+	if errors.Is(err, errLimitsUnsupported) {
+		slog.Warn("resource limits of shell steps are not enforced", "step", stepID, "reason", err)
+		return nil, nil
+	}
+	return confinement, err
+}
+
+// startServices starts the services of a workflow and returns the function stopping them.
+func (r *Runner) startServices(ctx context.Context, services map[string]config.Service) (func(), error) {
+	if len(services) == 0 {
+		return func() {}, nil
+	}
+	if r.containerManager == nil {
+		return nil, fmt.Errorf("workflow services require a container runtime, but none is available: %v", r.containerErr)
+	}
+
+	group, err := r.containerManager.StartServices(ctx, r.runID, services)
+	if err != nil {
+		return nil, err
+	}
+	r.services = group
+
+	return func() {
+		r.services = nil
+		if err := r.containerManager.StopServices(group); err != nil {
+			slog.Warn("failed to stop workflow services", "run_id", r.runID, "error", err)
+		}
+	}, nil
+}
+
 // expandTemplate expands template variables in a string using the enhanced template engine.
 func (r *Runner) expandTemplate(tmplStr string, inputs map[string]string, stepOutputs map[string]map[string]string) (string, error) {
+	return r.expandTemplateIn(tmplStr, r.repoPath, inputs, stepOutputs)
+}
+
+// expandTemplateIn expands template variables in a string for a step running in dir.
+func (r *Runner) expandTemplateIn(tmplStr, dir string, inputs map[string]string, stepOutputs map[string]map[string]string) (string, error) {
 	// Build template context
 	context := NewContextBuilder().
-		WithInputs(inputs).
+		WithTypedInputs(r.typedInputs(inputs)).
 		WithStepOutputs(stepOutputs).
+		WithEnvironment(r.getEnvironment()).
+		WithWorkDir(r.repoPath).
+		WithArtifacts(r.artifactPaths).
+		WithWorkingDirectory(dir).
 		Build()
 
 	// Use the enhanced template engine
@@ -876,6 +2559,11 @@ func (r *Runner) GetRunID() string {
 	return r.runID
 }
 
+// logDir returns the directory of the step logs of the run, the logs directory of its workspace.
+func (r *Runner) logDir() string {
+	return filepath.Join(r.workspaceRoot, r.runID, "logs")
+}
+
 // GetWorkspaceRoot returns the workspace root directory.
 func (r *Runner) GetWorkspaceRoot() string {
 	return r.workspaceRoot
@@ -890,6 +2578,65 @@ func (r *Runner) getEnvironment() []string {
 	return []string{}
 }
 
+// resolveWorkingDirectory returns the absolute directory a step runs in: its working_directory,
+// or its workflow's, expanded and resolved inside the repository at workDir.
+func (r *Runner) resolveWorkingDirectory(step config.WorkflowStep, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string) (string, error) {
+	spec := step.WorkingDirectory
+	if spec == "" {
+		spec = r.workingDirectory
+	}
+	if spec == "" {
+		return workDir, nil
+	}
+
+	expanded, err := r.expandTemplate(spec, inputs, stepOutputs)
+	if err != nil {
+		return "", fmt.Errorf("failed to expand working directory: %v", err)
+	}
+	dir := expanded
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(workDir, dir)
+	}
+	dir = filepath.Clean(dir)
+	if rel, err := filepath.Rel(workDir, dir); err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("working directory '%s' is outside the repository", expanded)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("working directory '%s' is not a directory of the repository", expanded)
+	}
+	return dir, nil
+}
+
+// stepEnvironment returns the host environment variables the steps of the running workflow
+// inherit: all of them, unless its env_passthrough patterns select some.
+func (r *Runner) stepEnvironment() []string {
+	env := r.getEnvironment()
+	if r.envPassthrough == nil {
+		return env
+	}
+	inherited := []string{}
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		for _, pattern := range r.envPassthrough {
+			if matched, _ := path.Match(pattern, name); matched {
+				inherited = append(inherited, entry)
+				break
+			}
+		}
+	}
+	return inherited
+}
+
+// followLabel returns the prefix of the followed output of a step: the repository of the run,
+// or the directory of the workflow when it is not known, and the step.
+func (r *Runner) followLabel(stepID string) string {
+	repository := r.repository
+	if repository == "" {
+		repository = filepath.Base(r.repoPath)
+	}
+	return repository + "/" + stepID
+}
+
 // getRepositoryNameFromPath extracts repository name from work directory path.
 func (r *Runner) getRepositoryNameFromPath(workDir string) string {
 	// Extract repository name from path like /cache/repos/owner/repo/branch
@@ -915,6 +2662,12 @@ func (r *Runner) getRepositoryNameFromPath(workDir string) string {
 func (r *Runner) Close() error {
 	var err error
 
+	// Wait for the compaction at start, which may be removing files
+	if r.compacted != nil {
+		<-r.compacted
+	}
+	r.prefetches.Wait()
+
 	// Close child runner factory first
 	if r.childRunnerFactory != nil {
 		if closeErr := r.childRunnerFactory.Close(); closeErr != nil {
@@ -138,7 +138,7 @@ func TestExecuteBuiltinStep_FanOut(t *testing.T) {
 
 			// Execute the built-in step
 			ctx := context.Background()
-			result, err := runner.executeBuiltinStep(ctx, tt.step, tt.step.ID, runner.state.StartTime)
+			result, err := runner.executeBuiltinStep(ctx, tt.step, tt.step.ID, "", nil, nil, runner.state.StartTime)
 
 			// Check error expectation
 			if tt.expectError {
@@ -179,3 +179,25 @@ func TestExecuteBuiltinStep_FanOut(t *testing.T) {
 		})
 	}
 }
+
+func TestRunnerOverrideFanOutWait(t *testing.T) {
+	step := config.WorkflowStep{Uses: "tako/fan-out@v1", With: map[string]interface{}{
+		"event_type":        "build_completed",
+		"wait_for_children": true,
+	}}
+
+	runner := &Runner{}
+	if got := runner.overrideFanOutWait(step); got.With["wait_for_children"] != true {
+		t.Errorf("expected the wait_for_children of the step without an override, got %v", got.With["wait_for_children"])
+	}
+
+	noWait := false
+	runner.waitForChildren = &noWait
+	got := runner.overrideFanOutWait(step)
+	if got.With["wait_for_children"] != false {
+		t.Errorf("expected wait_for_children to be overridden, got %v", got.With["wait_for_children"])
+	}
+	if step.With["wait_for_children"] != true {
+		t.Errorf("expected the step not to be modified")
+	}
+}
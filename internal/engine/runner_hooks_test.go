@@ -0,0 +1,190 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunnerWorkflowOutputs(t *testing.T) {
+	result, err := runParallelWorkflow(t, `  test:
+    outputs:
+      version: "{{ .Steps.build.version }}"
+      summary: "built {{ .Steps.build.version }} in {{ .Steps.package.format }}"
+    steps:
+      - id: build
+        run: echo 1.2.3
+        produces:
+          outputs:
+            version: from_stdout
+      - id: package
+        run: echo tarball
+        produces:
+          outputs:
+            format: from_stdout
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if result.Outputs["version"] != "1.2.3" || result.Outputs["summary"] != "built 1.2.3 in tarball" {
+		t.Errorf("Unexpected workflow outputs: %v", result.Outputs)
+	}
+
+	result, err = runParallelWorkflow(t, `  test:
+    steps:
+      - id: build
+        run: echo 1.2.3
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if result.Outputs != nil {
+		t.Errorf("Expected no outputs for a workflow declaring none, got %v", result.Outputs)
+	}
+}
+
+func TestRunnerWorkflowHooks(t *testing.T) {
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: build
+        run: echo 1.2.3
+        produces:
+          outputs:
+            version: from_stdout
+    on_success:
+      - id: notify
+        run: echo "released {{ .Steps.build.version }}"
+        produces:
+          outputs:
+            message: from_stdout
+    on_failure:
+      - id: rollback
+        run: echo rollback
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if got := strings.Join(stepIDs(result.Steps), ","); got != "build,notify" {
+		t.Errorf("Expected only the on_success hook to run, got %s", got)
+	}
+	if message := result.Steps[1].Outputs["message"]; message != "released 1.2.3" {
+		t.Errorf("Expected the hook to see the step outputs, got %q", message)
+	}
+
+	result, err = runParallelWorkflow(t, `  test:
+    steps:
+      - id: build
+        run: exit 1
+      - id: unreachable
+        run: echo unreachable
+    on_success:
+      - id: notify
+        run: echo notify
+    on_failure:
+      - id: cleanup
+        run: exit 3
+      - id: rollback
+        run: echo rollback
+`)
+	if err == nil || result.Success {
+		t.Fatal("Expected the workflow to fail")
+	}
+	if !strings.Contains(err.Error(), "step 'build' failed") {
+		t.Errorf("Expected the failure of the hook not to replace the error of the run, got %v", err)
+	}
+	if got := strings.Join(stepIDs(result.Steps), ","); got != "build,cleanup" {
+		t.Errorf("Expected only the on_failure hooks up to the failed one to run, got %s", got)
+	}
+}
+
+func TestRunnerContinueOnError(t *testing.T) {
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: lint
+        run: exit 1
+        continue_on_error: true
+      - id: checks
+        parallel:
+          - id: unit
+            run: echo unit
+          - id: flaky
+            run: exit 2
+            continue_on_error: true
+      - id: build
+        run: echo build
+    on_success:
+      - id: notify
+        run: echo notify
+`)
+	if err != nil || !result.Success {
+		t.Fatalf("Expected the allowed failures not to fail the workflow, got %v", err)
+	}
+	if got := strings.Join(stepIDs(result.Steps), ","); got != "lint,checks,unit,flaky,build,notify" {
+		t.Errorf("Expected every step and the on_success hook to run, got %s", got)
+	}
+	if got := strings.Join(result.AllowedFailures, ","); got != "lint,flaky" {
+		t.Errorf("Expected lint and flaky to be allowed failures, got %s", got)
+	}
+	if lint := result.Steps[0]; lint.Success || !lint.AllowedFailure || lint.Error == nil {
+		t.Errorf("Expected lint to be recorded as a failure, got %+v", lint)
+	}
+	if checks := result.Steps[1]; !checks.Success || checks.AllowedFailure {
+		t.Errorf("Expected the group to succeed despite its allowed failure, got %+v", checks)
+	}
+
+	result, err = runParallelWorkflow(t, `  test:
+    steps:
+      - id: lint
+        run: exit 1
+        continue_on_error: true
+      - id: build
+        run: exit 1
+      - id: unreachable
+        run: echo unreachable
+`)
+	if err == nil || result.Success {
+		t.Fatal("Expected the hard failure to fail the workflow")
+	}
+	if !strings.Contains(err.Error(), "step 'build' failed") {
+		t.Errorf("Expected the hard failure to fail the run, got %v", err)
+	}
+	if got := strings.Join(result.AllowedFailures, ","); got != "lint" || result.Steps[1].AllowedFailure {
+		t.Errorf("Expected only lint to be an allowed failure, got %s", got)
+	}
+}
+
+func TestRunnerWorkflowHooksRunAfterTimeout(t *testing.T) {
+	tempDir := t.TempDir()
+	marker := filepath.Join(tempDir, "cleaned")
+	content := `version: 0.1.0
+workflows:
+  test:
+    timeout: 200ms
+    steps:
+      - id: slow
+        run: sleep 5
+    on_failure:
+      - id: cleanup
+        run: touch ` + marker + `
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir); err == nil {
+		t.Fatal("Expected the workflow to time out")
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Errorf("Expected the on_failure hook to run after the timeout: %v", err)
+	}
+}
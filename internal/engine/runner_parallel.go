@@ -0,0 +1,132 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// errParallelStepFailed is the cause of contexts cancelled because another step of the same
+// parallel group failed.
+var errParallelStepFailed = errors.New("stopped because another parallel step failed")
+
+// executeParallelStep runs the steps of a parallel group concurrently, at most MaxParallel at a
+// time, and stops the remaining ones as soon as one fails. It returns the result of the group
+// followed by the results of the steps that were started, in declaration order. Outputs of the
+// group's steps are merged into stepOutputs, in declaration order, once every step has finished,
+// so they are only visible to the steps after the group.
+func (r *Runner) executeParallelStep(ctx context.Context, step config.WorkflowStep, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string) ([]StepResult, error) {
+	startTime := time.Now()
+	stepID := step.ID
+	if stepID == "" {
+		stepID = fmt.Sprintf("parallel-%d", time.Now().UnixNano())
+	}
+
+	if err := r.state.StartStep(stepID); err != nil {
+		return []StepResult{{
+			ID:        stepID,
+			Success:   false,
+			Error:     fmt.Errorf("failed to start step tracking: %v", err),
+			StartTime: startTime,
+			EndTime:   time.Now(),
+		}}, err
+	}
+
+	if result, done, err := r.evaluateStepCondition(step, stepID, inputs, stepOutputs, startTime); done {
+		return []StepResult{result}, err
+	}
+
+	timeoutCtx, cancelTimeout := withStepTimeout(ctx, step)
+	defer cancelTimeout()
+	groupCtx, cancelGroup := context.WithCancelCause(timeoutCtx)
+	defer cancelGroup(nil)
+
+	limit := step.MaxParallel
+	if limit <= 0 || limit > len(step.Parallel) {
+		limit = len(step.Parallel)
+	}
+	semaphore := make(chan struct{}, limit)
+
+	results := make([]StepResult, len(step.Parallel))
+	started := make([]bool, len(step.Parallel))
+	var (
+		wg       sync.WaitGroup
+		errMu    sync.Mutex
+		firstErr error
+	)
+
+	for i, parallelStep := range step.Parallel {
+		// Unique IDs keep the state of concurrently running steps apart
+		if parallelStep.ID == "" {
+			parallelStep.ID = fmt.Sprintf("%s-%d", stepID, i+1)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				defer func() { <-semaphore }()
+			case <-groupCtx.Done():
+				return
+			}
+			if groupCtx.Err() != nil {
+				return
+			}
+
+			started[i] = true
+			result, err := r.executeStep(groupCtx, parallelStep, workDir, inputs, stepOutputs)
+			err = r.allowFailure(groupCtx, parallelStep, &result, err)
+			results[i] = result
+			if err != nil {
+				errMu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("parallel step '%s' failed: %w", parallelStep.ID, err)
+					cancelGroup(errParallelStepFailed)
+				}
+				errMu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	groupResults := []StepResult{{ID: stepID, StartTime: startTime}}
+	for i, result := range results {
+		if !started[i] {
+			continue
+		}
+		groupResults = append(groupResults, result)
+		if result.Success && len(result.Outputs) > 0 {
+			stepOutputs[result.ID] = result.Outputs
+		}
+	}
+
+	group := &groupResults[0]
+	group.EndTime = time.Now()
+
+	// A group stopped by its timeout or a cancellation may have no failed step of its own
+	var errorType string
+	var interruption error
+	if timeoutCtx.Err() != nil {
+		errorType, interruption = stepInterruption(timeoutCtx)
+	}
+	err := firstErr
+	if err == nil {
+		err = interruption
+	}
+	if err == nil {
+		group.Success = true
+		r.state.CompleteStep(stepID, "", nil)
+		return groupResults, nil
+	}
+
+	group.Error = err
+	group.ErrorType = errorType
+	r.state.FailStep(stepID, err.Error())
+	return groupResults, err
+}
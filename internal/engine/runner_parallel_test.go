@@ -0,0 +1,136 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/interfaces"
+)
+
+// runParallelWorkflow writes a tako.yml with the given workflows and runs the "test" workflow.
+func runParallelWorkflow(t *testing.T, workflows string) (*ExecutionResult, error) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	content := "version: 0.1.0\nworkflows:\n" + workflows
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	t.Cleanup(func() { runner.Close() })
+
+	return runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir)
+}
+
+// stepIDs returns the IDs of step results, in order.
+func stepIDs(results []StepResult) []string {
+	ids := make([]string, 0, len(results))
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	return ids
+}
+
+func TestRunnerParallelSteps(t *testing.T) {
+	start := time.Now()
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: checks
+        parallel:
+          - id: lint
+            run: sleep 0.5 && echo lint-ok
+            produces:
+              outputs:
+                status: from_stdout
+          - id: unit
+            run: sleep 0.5 && echo unit-ok
+            produces:
+              outputs:
+                status: from_stdout
+      - id: report
+        run: echo "{{ .Steps.lint.status }} {{ .Steps.unit.status }}"
+        produces:
+          outputs:
+            summary: from_stdout
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected parallel steps to run concurrently, took %v", elapsed)
+	}
+
+	if got := strings.Join(stepIDs(result.Steps), ","); got != "checks,lint,unit,report" {
+		t.Errorf("Expected results in declaration order, got %s", got)
+	}
+	if summary := result.Steps[3].Outputs["summary"]; summary != "lint-ok unit-ok" {
+		t.Errorf("Expected outputs of parallel steps to be visible after the group, got %q", summary)
+	}
+}
+
+func TestRunnerParallelStepsMaxParallel(t *testing.T) {
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: checks
+        max_parallel: 1
+        parallel:
+          - id: first
+            run: sleep 0.3
+          - id: second
+            run: sleep 0.3
+`)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+
+	first, second := result.Steps[1], result.Steps[2]
+	if first.EndTime.After(second.StartTime) && second.EndTime.After(first.StartTime) {
+		t.Errorf("Expected steps not to overlap with max_parallel 1, got %v-%v and %v-%v",
+			first.StartTime, first.EndTime, second.StartTime, second.EndTime)
+	}
+}
+
+func TestRunnerParallelStepsFailFast(t *testing.T) {
+	start := time.Now()
+	result, err := runParallelWorkflow(t, `  test:
+    steps:
+      - id: checks
+        parallel:
+          - id: slow
+            run: sleep 30
+          - id: broken
+            run: sleep 0.2 && exit 1
+      - id: after
+        run: echo unreachable
+`)
+	if err == nil {
+		t.Fatal("Expected the workflow to fail")
+	}
+	if !strings.Contains(err.Error(), "parallel step 'broken' failed") {
+		t.Errorf("Expected the failing parallel step in the error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the remaining parallel steps to be stopped, took %v", elapsed)
+	}
+
+	if got := strings.Join(stepIDs(result.Steps), ","); got != "checks,slow,broken" {
+		t.Fatalf("Expected results of the group and its steps only, got %s", got)
+	}
+	if result.Steps[0].Success {
+		t.Error("Expected the parallel group to fail")
+	}
+	if result.Steps[1].ErrorType != interfaces.StepErrorCancelled {
+		t.Errorf("Expected the stopped step to have error type %q, got %q", interfaces.StepErrorCancelled, result.Steps[1].ErrorType)
+	}
+}
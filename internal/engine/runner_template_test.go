@@ -2,7 +2,10 @@ package engine
 
 import (
 	"context"
+	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -160,6 +163,83 @@ func TestRunner_expandTemplate_EdgeCases(t *testing.T) {
 	}
 }
 
+func TestRunner_expandFanOutPayloads(t *testing.T) {
+	tempDir := t.TempDir()
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	inputs := map[string]string{"environment": "prod"}
+	stepOutputs := map[string]map[string]string{"build": {"version": "1.2.3"}}
+
+	step := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type": "library_built",
+			"payload": map[string]interface{}{
+				"version": "{{ .Steps.build.version }}",
+				"targets": []interface{}{"{{ .Inputs.environment }}", "staging"},
+				"meta":    map[string]interface{}{"tag": "v{{ .Steps.build.version }}", "attempt": 2},
+			},
+		},
+	}
+
+	expanded, err := runner.expandFanOutPayloads(step, inputs, stepOutputs)
+	if err != nil {
+		t.Fatalf("expandFanOutPayloads() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"version": "1.2.3",
+		"targets": []interface{}{"prod", "staging"},
+		"meta":    map[string]interface{}{"tag": "v1.2.3", "attempt": 2},
+	}
+	if !reflect.DeepEqual(expanded.With["payload"], want) {
+		t.Errorf("expanded payload = %v, want %v", expanded.With["payload"], want)
+	}
+	if got := step.With["payload"].(map[string]interface{})["version"]; got != "{{ .Steps.build.version }}" {
+		t.Errorf("original step payload was modified: version = %v", got)
+	}
+
+	batch := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"events": []interface{}{
+				map[string]interface{}{"event_type": "library_built", "payload": map[string]interface{}{"version": "{{ .Steps.build.version }}"}},
+				map[string]interface{}{"event_type": "docs_built"},
+			},
+		},
+	}
+	expanded, err = runner.expandFanOutPayloads(batch, inputs, stepOutputs)
+	if err != nil {
+		t.Fatalf("expandFanOutPayloads() error = %v", err)
+	}
+	events := expanded.With["events"].([]interface{})
+	if got := events[0].(map[string]interface{})["payload"].(map[string]interface{})["version"]; got != "1.2.3" {
+		t.Errorf("events[0].payload.version = %v, want 1.2.3", got)
+	}
+	if _, ok := events[1].(map[string]interface{})["payload"]; ok {
+		t.Errorf("events[1] should have no payload")
+	}
+
+	invalid := config.WorkflowStep{
+		Uses: "tako/fan-out@v1",
+		With: map[string]interface{}{
+			"event_type": "library_built",
+			"payload":    map[string]interface{}{"version": "{{ .Steps.build.version"},
+		},
+	}
+	if _, err := runner.expandFanOutPayloads(invalid, inputs, stepOutputs); err == nil || !strings.Contains(err.Error(), "failed to expand payload: version") {
+		t.Errorf("expandFanOutPayloads() error = %v, want a payload expansion error", err)
+	}
+}
+
 func TestRunner_executeBuiltinStep(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -186,7 +266,7 @@ func TestRunner_executeBuiltinStep(t *testing.T) {
 	startTime := time.Now()
 
 	// Execute built-in step (should return parameter validation error)
-	result, err := runner.executeBuiltinStep(context.Background(), step, stepID, startTime)
+	result, err := runner.executeBuiltinStep(context.Background(), step, stepID, "", nil, nil, startTime)
 
 	// Should return error indicating missing required parameter
 	if err == nil {
@@ -250,7 +330,7 @@ func TestRunner_executeBuiltinStep_DifferentBuiltins(t *testing.T) {
 			}
 
 			startTime := time.Now()
-			result, err := runner.executeBuiltinStep(context.Background(), step, step.ID, startTime)
+			result, err := runner.executeBuiltinStep(context.Background(), step, step.ID, "", nil, nil, startTime)
 
 			// Should return error (different messages for different steps)
 			if err == nil {
@@ -343,11 +423,47 @@ func TestRunner_validateInputValue_Comprehensive(t *testing.T) {
 			value:       "dev",
 			shouldError: true,
 		},
+		{
+			name:        "boolean",
+			input:       config.WorkflowInput{Type: config.InputTypeBoolean},
+			value:       "TRUE",
+			shouldError: false,
+		},
+		{
+			name:        "invalid boolean",
+			input:       config.WorkflowInput{Type: config.InputTypeBoolean},
+			value:       "yes",
+			shouldError: true,
+		},
+		{
+			name:        "integer above the maximum",
+			input:       config.WorkflowInput{Type: config.InputTypeInteger, Validation: config.WorkflowInputValidation{Max: &[]float64{10}[0]}},
+			value:       "11",
+			shouldError: true,
+		},
+		{
+			name:        "fractional integer",
+			input:       config.WorkflowInput{Type: config.InputTypeInteger},
+			value:       "1.5",
+			shouldError: true,
+		},
+		{
+			name:        "string not matching the pattern",
+			input:       config.WorkflowInput{Validation: config.WorkflowInputValidation{Pattern: `^v[0-9]+$`}},
+			value:       "1",
+			shouldError: true,
+		},
+		{
+			name:        "invalid object",
+			input:       config.WorkflowInput{Type: config.InputTypeObject},
+			value:       "[1, 2]",
+			shouldError: true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := runner.validateInputValue("test-input", tt.input, tt.value)
+			_, err := runner.validateInputValue("test-input", tt.input, tt.value)
 
 			if tt.shouldError {
 				if err == nil {
@@ -413,3 +529,381 @@ func TestRunner_executeStep_BuiltinVsShell(t *testing.T) {
 		t.Error("Shell step should succeed in dry-run")
 	}
 }
+
+func TestRunnerTypedInputs(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    inputs:
+      dry_run:
+        type: boolean
+        default: false
+      replicas:
+        type: integer
+        default: 2
+        validation:
+          min: 1
+      targets:
+        type: list
+        default: [eu, us]
+      settings:
+        type: object
+        default:
+          region: eu-west-1
+    steps:
+      - id: deploy
+        if: "!inputs.dry_run && inputs.replicas > 1 && size(inputs.targets) == 3"
+        run: echo "{{ range .Inputs.targets }}{{ . }};{{ end }}{{ .Inputs.settings.region }} x{{ .Inputs.replicas }}"
+        produces:
+          outputs:
+            summary: from_stdout
+      - id: preview
+        if: inputs.dry_run
+        run: echo preview
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	inputs := map[string]string{"dry_run": "FALSE", "replicas": "3", "targets": "eu, us, ap"}
+	result, err := runner.ExecuteWorkflow(context.Background(), "test", inputs, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if summary := result.Steps[0].Outputs["summary"]; strings.TrimSpace(summary) != "eu;us;ap;eu-west-1 x3" {
+		t.Errorf("Expected the typed inputs in the template, got %q", summary)
+	}
+	if !result.Steps[1].Skipped {
+		t.Errorf("Expected the dry run step to be skipped: %+v", result.Steps[1])
+	}
+	// Typed inputs are passed on in the string form of their type
+	if inputs["dry_run"] != "false" || inputs["targets"] != `["eu","us","ap"]` || inputs["settings"] != `{"region":"eu-west-1"}` {
+		t.Errorf("Unexpected normalized inputs: %v", inputs)
+	}
+
+	_, err = runner.ExecuteWorkflow(context.Background(), "test", map[string]string{"replicas": "0"}, tempDir)
+	if err == nil || !strings.Contains(err.Error(), "input 'replicas': value 0 is less than the minimum 1") {
+		t.Errorf("Expected the minimum to be enforced, got %v", err)
+	}
+}
+
+func TestRunnerPromptsForMissingInputs(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    inputs:
+      environment:
+        required: true
+        validation:
+          enum: [dev, prod]
+      replicas:
+        type: integer
+        required: true
+      verbose:
+        type: boolean
+    steps:
+      - id: deploy
+        run: echo "{{ .Inputs.environment }} x{{ .Inputs.replicas }}"
+        produces:
+          outputs:
+            summary: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	var prompted []string
+	answers := map[string]string{"environment": "prod", "replicas": "3"}
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		PromptInputs: func(workflowName string, missing map[string]config.WorkflowInput) (map[string]string, error) {
+			values := make(map[string]string)
+			for name := range missing {
+				prompted = append(prompted, workflowName+"."+name)
+				values[name] = answers[name]
+			}
+			return values, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "test", map[string]string{"replicas": "2"}, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if len(prompted) != 1 || prompted[0] != "test.environment" {
+		t.Errorf("Expected only the missing required input to be prompted, got %v", prompted)
+	}
+	if summary := strings.TrimSpace(result.Steps[0].Outputs["summary"]); summary != "prod x2" {
+		t.Errorf("Expected the prompted input in the template, got %q", summary)
+	}
+
+	// Prompted values are validated like provided ones
+	answers["environment"] = "staging"
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", map[string]string{"replicas": "2"}, tempDir); err == nil ||
+		!strings.Contains(err.Error(), "not in allowed values") {
+		t.Errorf("Expected the prompted value to be rejected, got %v", err)
+	}
+}
+
+func TestRunnerProfile(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    inputs:
+      environment:
+        default: dev
+    steps:
+      - id: deploy
+        run: echo "{{ .Inputs.environment }} $LOG_LEVEL"
+        env:
+          LOG_LEVEL: debug
+        produces:
+          outputs:
+            summary: from_stdout
+profiles:
+  prod:
+    inputs:
+      environment: prod
+    env:
+      LOG_LEVEL: warn
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		profile  string
+		inputs   map[string]string
+		expected string
+	}{
+		{name: "no profile", expected: "dev debug"},
+		{name: "profile", profile: "prod", expected: "prod warn"},
+		{name: "inputs win over the profile", profile: "prod", inputs: map[string]string{"environment": "staging"}, expected: "staging warn"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			runner, err := NewRunner(RunnerOptions{
+				WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+				CacheDir:      filepath.Join(tempDir, "cache"),
+				Profile:       tc.profile,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create runner: %v", err)
+			}
+			defer runner.Close()
+
+			result, err := runner.ExecuteWorkflow(context.Background(), "test", tc.inputs, tempDir)
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+			if summary := strings.TrimSpace(result.Steps[0].Outputs["summary"]); summary != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, summary)
+			}
+		})
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Profile:       "staging",
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir); err == nil || !strings.Contains(err.Error(), "profile 'staging' not found") {
+		t.Errorf("Expected an unknown profile error, got %v", err)
+	}
+}
+
+func TestRunnerEnvPassthrough(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  allowlisted:
+    env_passthrough: ["PATH", "GO*"]
+    env:
+      STAGE: ci
+      GOFLAGS: "-v"
+    steps:
+      - id: show
+        run: echo "$HOME|$GOFLAGS|$SECRET_TOKEN|$STAGE|${PATH:+path}"
+        env:
+          STAGE: step
+        produces:
+          outputs:
+            env: from_stdout
+  isolated:
+    env_passthrough: []
+    steps:
+      - id: show
+        run: echo "$HOME|$GOFLAGS"
+        produces:
+          outputs:
+            env: from_stdout
+  inherited:
+    env:
+      STAGE: ci
+    steps:
+      - id: show
+        run: echo "$HOME|$SECRET_TOKEN|$STAGE"
+        produces:
+          outputs:
+            env: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	testCases := []struct {
+		workflow string
+		expected string
+	}{
+		{workflow: "allowlisted", expected: "|-v||step|path"},
+		{workflow: "isolated", expected: "|"},
+		{workflow: "inherited", expected: "/home/tako|s3cret|ci"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.workflow, func(t *testing.T) {
+			runner, err := NewRunner(RunnerOptions{
+				WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+				CacheDir:      filepath.Join(tempDir, "cache"),
+				Environment:   []string{"PATH=/usr/bin:/bin", "HOME=/home/tako", "GOFLAGS=-mod=mod", "SECRET_TOKEN=s3cret"},
+			})
+			if err != nil {
+				t.Fatalf("Failed to create runner: %v", err)
+			}
+			defer runner.Close()
+
+			result, err := runner.ExecuteWorkflow(context.Background(), tc.workflow, nil, tempDir)
+			if err != nil {
+				t.Fatalf("Workflow failed: %v", err)
+			}
+			if env := strings.TrimSpace(result.Steps[0].Outputs["env"]); env != tc.expected {
+				t.Errorf("Expected %q, got %q", tc.expected, env)
+			}
+		})
+	}
+}
+
+func TestRunnerWorkingDirectory(t *testing.T) {
+	tempDir := t.TempDir()
+	for _, dir := range []string{"services/api", "docs"} {
+		if err := os.MkdirAll(filepath.Join(tempDir, dir), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	content := `version: 0.1.0
+artifacts:
+  api:
+    path: services/api
+workflows:
+  build:
+    working_directory: "{{ .Artifacts.api }}"
+    steps:
+      - id: default
+        run: pwd
+        produces:
+          outputs:
+            dir: from_stdout
+      - id: docs
+        run: echo "$(pwd)|{{ .WorkingDirectory }}"
+        working_directory: docs
+        produces:
+          outputs:
+            dir: from_stdout
+  outside:
+    steps:
+      - run: pwd
+        working_directory: "{{ .Inputs.dir }}"
+    inputs:
+      dir:
+        default: "/"
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if dir := strings.TrimSpace(result.Steps[0].Outputs["dir"]); dir != filepath.Join(tempDir, "services/api") {
+		t.Errorf("Expected the step to run in the artifact directory, got %q", dir)
+	}
+	docs := filepath.Join(tempDir, "docs")
+	if dir := strings.TrimSpace(result.Steps[1].Outputs["dir"]); dir != docs+"|"+docs {
+		t.Errorf("Expected the step to run in its own working directory, got %q", dir)
+	}
+
+	// Working directories must stay inside the repository
+	if _, err := runner.ExecuteWorkflow(context.Background(), "outside", nil, tempDir); err == nil || !strings.Contains(err.Error(), "working directory '/' is outside the repository") {
+		t.Errorf("Expected an outside working directory error, got %v", err)
+	}
+}
+
+func TestRunnerTemplateFunctions(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    inputs:
+      config:
+        type: object
+        default: {region: eu}
+    steps:
+      - id: build
+        run: echo '{{ env "DEPLOY_ENV" | upper }} {{ .Inputs.config.region }} {{ hash_files "tako.yml" | len }}'
+        produces:
+          outputs:
+            summary: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{"DEPLOY_ENV=staging"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if summary := strings.TrimSpace(result.Steps[0].Outputs["summary"]); summary != "STAGING eu 64" {
+		t.Errorf("Expected the environment and a SHA-256 digest of tako.yml, got %q", summary)
+	}
+}
@@ -2,6 +2,8 @@ package engine
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -9,6 +11,7 @@ import (
 	"time"
 
 	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/interfaces"
 )
 
 func TestNewRunner(t *testing.T) {
@@ -227,6 +230,7 @@ func TestRunnerMultiRepoRepositoryNotFound(t *testing.T) {
 		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
 		CacheDir:      filepath.Join(tempDir, "cache"),
 		Environment:   []string{}, // Empty environment for tests
+		Git:           GitOptions{LocalOnly: true},
 	}
 
 	runner, err := NewRunner(opts)
@@ -249,6 +253,86 @@ func TestRunnerMultiRepoRepositoryNotFound(t *testing.T) {
 	}
 }
 
+func TestRunnerMultiRepoRunsInIsolatedWorkspace(t *testing.T) {
+	tempDir := t.TempDir()
+	cacheDir := filepath.Join(tempDir, "cache")
+	workspaceRoot := filepath.Join(tempDir, "workspace")
+
+	// The workflow writes a file into its working directory
+	cachedRepo := filepath.Join(cacheDir, "repos", "org", "repo", "main")
+	if err := os.MkdirAll(cachedRepo, 0755); err != nil {
+		t.Fatalf("Failed to create cached repo: %v", err)
+	}
+	takoYml := `version: "0.1.0"
+workflows:
+  build:
+    steps:
+      - id: write
+        run: echo built > output.txt
+  broken:
+    steps:
+      - id: fail
+        run: exit 1
+`
+	if err := os.WriteFile(filepath.Join(cachedRepo, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: workspaceRoot,
+		CacheDir:      cacheDir,
+		Environment:   []string{"PATH=/usr/bin:/bin"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "build", map[string]string{}, "org/repo")
+	if err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+	if !result.Success {
+		t.Fatalf("Expected successful execution, got error: %v", result.Error)
+	}
+
+	// The shared cache must not be modified by the workflow
+	if _, err := os.Stat(filepath.Join(cachedRepo, "output.txt")); !os.IsNotExist(err) {
+		t.Error("Workflow should not write into the shared cache")
+	}
+
+	// The run workspace is cleaned up after a successful run, except for the step logs and report
+	entries, err := os.ReadDir(filepath.Join(workspaceRoot, runner.GetRunID()))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read run workspace: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.Name() != "logs" && entry.Name() != "report.json" {
+			t.Errorf("Run workspace should be removed after success, found %s", entry.Name())
+		}
+	}
+
+	// Failed runs keep their workspace when requested
+	failingRunner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot:          workspaceRoot,
+		CacheDir:               cacheDir,
+		Environment:            []string{"PATH=/usr/bin:/bin"},
+		KeepWorkspaceOnFailure: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer failingRunner.Close()
+
+	if _, err := failingRunner.ExecuteMultiRepoWorkflow(context.Background(), "broken", map[string]string{}, "org/repo"); err == nil {
+		t.Fatal("Expected failing workflow to return an error")
+	}
+	keptRepo := filepath.Join(workspaceRoot, failingRunner.GetRunID(), "repo")
+	if _, err := os.Stat(filepath.Join(keptRepo, "tako.yml")); err != nil {
+		t.Errorf("Failed run workspace should be kept at %s: %v", keptRepo, err)
+	}
+}
+
 func TestRunnerResumeNotImplemented(t *testing.T) {
 	tempDir := t.TempDir()
 
@@ -920,3 +1004,243 @@ subscriptions: []
 		t.Errorf("Output should contain TAKO_INPUT_TEST_INPUT, got: %s", output)
 	}
 }
+
+// TestRunnerStepConditions tests that steps are skipped when their if: condition does not hold.
+func TestRunnerStepConditions(t *testing.T) {
+	tempDir := t.TempDir()
+
+	takoFile := filepath.Join(tempDir, "tako.yml")
+	content := `version: 0.1.0
+workflows:
+  conditional:
+    inputs:
+      version:
+        type: string
+      has_breaking_changes:
+        type: string
+        default: "false"
+    steps:
+      - id: check
+        run: echo "ok"
+        produces:
+          outputs:
+            status: from_stdout
+      - id: run_tests
+        if: "!(.inputs.has_breaking_changes == 'true') && .steps.check.status == 'ok'"
+        run: echo "tests"
+      - id: run_breaking_change_tests
+        if: .inputs.has_breaking_changes == 'true'
+        run: echo "breaking"
+      - id: major_release
+        if: semver.major(inputs.version) > 1
+        run: echo "major"
+`
+	if err := os.WriteFile(takoFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "conditional", map[string]string{
+		"version":              "v2.0.0",
+		"has_breaking_changes": "false",
+	}, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow execution should succeed: %v", err)
+	}
+
+	wantSkipped := map[string]bool{
+		"check":                     false,
+		"run_tests":                 false,
+		"run_breaking_change_tests": true,
+		"major_release":             false,
+	}
+	if len(result.Steps) != len(wantSkipped) {
+		t.Fatalf("Expected %d steps, got %d", len(wantSkipped), len(result.Steps))
+	}
+	for _, step := range result.Steps {
+		if step.Skipped != wantSkipped[step.ID] {
+			t.Errorf("Step %s: expected skipped=%v, got %v", step.ID, wantSkipped[step.ID], step.Skipped)
+		}
+		if !step.Success {
+			t.Errorf("Step %s should succeed", step.ID)
+		}
+	}
+	if status := runner.state.GetStepStatus("run_breaking_change_tests"); status != StatusSkipped {
+		t.Errorf("Expected skipped step status, got %s", status)
+	}
+
+	// Conditions that cannot be evaluated fail the step
+	content = `version: 0.1.0
+workflows:
+  broken:
+    steps:
+      - id: bad
+        if: inputs.missing == 'x'
+        run: echo "never"
+`
+	if err := os.WriteFile(takoFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to update test tako.yml: %v", err)
+	}
+	if _, err := runner.ExecuteWorkflow(context.Background(), "broken", nil, tempDir); err == nil || !strings.Contains(err.Error(), "failed to evaluate condition") {
+		t.Errorf("Expected condition evaluation error, got %v", err)
+	}
+}
+
+func TestRunnerTimeouts(t *testing.T) {
+	tests := []struct {
+		name            string
+		workflowTimeout string
+		stepTimeout     string
+		wantErr         error
+		wantErrorType   string
+	}{
+		{
+			name:          "step timeout",
+			stepTimeout:   "200ms",
+			wantErr:       ErrStepTimeout,
+			wantErrorType: interfaces.StepErrorStepTimeout,
+		},
+		{
+			name:            "workflow timeout",
+			workflowTimeout: "200ms",
+			wantErr:         ErrWorkflowTimeout,
+			wantErrorType:   interfaces.StepErrorWorkflowTimeout,
+		},
+		{
+			name:            "workflow timeout shorter than step timeout",
+			workflowTimeout: "200ms",
+			stepTimeout:     "1m",
+			wantErr:         ErrWorkflowTimeout,
+			wantErrorType:   interfaces.StepErrorWorkflowTimeout,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+
+			workflowTimeout, stepTimeout := "", ""
+			if tt.workflowTimeout != "" {
+				workflowTimeout = fmt.Sprintf("\n    timeout: %s", tt.workflowTimeout)
+			}
+			if tt.stepTimeout != "" {
+				stepTimeout = fmt.Sprintf("\n        timeout: %s", tt.stepTimeout)
+			}
+			content := fmt.Sprintf(`version: 0.1.0
+workflows:
+  slow:%s
+    steps:
+      - id: wait
+        run: sleep 30%s
+`, workflowTimeout, stepTimeout)
+			if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+				t.Fatalf("Failed to create test tako.yml: %v", err)
+			}
+
+			runner, err := NewRunner(RunnerOptions{
+				WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+				CacheDir:      filepath.Join(tempDir, "cache"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create runner: %v", err)
+			}
+			defer runner.Close()
+
+			start := time.Now()
+			result, err := runner.ExecuteWorkflow(context.Background(), "slow", nil, tempDir)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Expected error wrapping %v, got %v", tt.wantErr, err)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Expected the step to be stopped by the timeout, took %v", elapsed)
+			}
+			if len(result.Steps) != 1 || result.Steps[0].ErrorType != tt.wantErrorType {
+				t.Fatalf("Expected step error type %q, got %+v", tt.wantErrorType, result.Steps)
+			}
+			if runner.state.GetStatus() != StatusFailed {
+				t.Errorf("Expected failed state, got %s", runner.state.GetStatus())
+			}
+		})
+	}
+}
+
+func TestRunnerMultiRepoChildResults(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - id: build
+        run: echo updated
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: app_updated
+          wait_for_children: true
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/deploy", `version: 0.1.0
+workflows:
+  deploy:
+    steps:
+      - run: echo deployed
+subscriptions:
+  - artifact: test-org/app:default
+    events: [app_updated]
+    workflow: deploy
+`)
+
+	result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), "release", nil, "test-org/lib")
+	if err != nil {
+		t.Fatalf("Multi-repo execution failed: %v", err)
+	}
+
+	// The result carries the whole execution tree: the child and the grandchild it triggered
+	if len(result.Children) != 1 {
+		t.Fatalf("Expected 1 child, got %+v", result.Children)
+	}
+	app := result.Children[0]
+	if app.StepID != "publish" || app.Repository != "test-org/app" || app.Workflow != "update" || app.Status != string(ChildStatusCompleted) {
+		t.Errorf("Unexpected child %+v", app)
+	}
+	if app.Result == nil || !app.Result.Success || len(app.Result.Steps) != 2 {
+		t.Fatalf("Expected the execution of the child, got %+v", app.Result)
+	}
+	if app.RunID != app.Result.RunID {
+		t.Errorf("Expected the run ID of the child %s, got %s", app.Result.RunID, app.RunID)
+	}
+	if len(app.Result.Children) != 1 || app.Result.Children[0].Repository != "test-org/deploy" || app.Result.Children[0].Result == nil {
+		t.Errorf("Expected the grandchild in the result of the child, got %+v", app.Result.Children)
+	}
+}
@@ -0,0 +1,256 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+const (
+	// defaultServiceCheckInterval is the time between two health checks of a service.
+	defaultServiceCheckInterval = time.Second
+	// defaultServiceReadyTimeout bounds the wait for a service to become ready.
+	defaultServiceReadyTimeout = 60 * time.Second
+)
+
+// ServiceGroup holds the service containers of a workflow run and the network connecting
+// them to the containerized steps of the run.
+type ServiceGroup struct {
+	Network  string
+	Services []*RunningService
+}
+
+// RunningService is a started service container.
+type RunningService struct {
+	Name          string
+	ContainerName string
+	// Ports are the published ports of the service, in declaration order.
+	Ports []ServicePort
+}
+
+// ServicePort is a container port of a service and the host port it is published on.
+type ServicePort struct {
+	Container string
+	Host      string
+}
+
+// StartServices starts the services of a workflow on a network dedicated to the run, and waits
+// until every one of them is ready. Services that were started are removed again when one of
+// them fails to start or become ready.
+func (cm *ContainerManager) StartServices(ctx context.Context, runID string, services map[string]config.Service) (*ServiceGroup, error) {
+	group := &ServiceGroup{Network: fmt.Sprintf("tako-%s", runID)}
+
+	output, err := exec.CommandContext(ctx, string(cm.runtime), "network", "create", group.Network).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create service network %s: %w\nOutput: %s", group.Network, err, string(output))
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		service := services[name]
+		running, err := cm.startService(ctx, group.Network, runID, name, service)
+		if running != nil {
+			group.Services = append(group.Services, running)
+		}
+		if err == nil {
+			err = cm.waitForService(ctx, running, service.HealthCheck)
+		}
+		if err != nil {
+			if stopErr := cm.StopServices(group); stopErr != nil && cm.debug {
+				fmt.Printf("Warning: failed to stop services: %v\n", stopErr)
+			}
+			return nil, fmt.Errorf("service '%s' failed to start: %w", name, err)
+		}
+	}
+
+	return group, nil
+}
+
+// startService runs a service container in the background. The returned service is set as soon
+// as a container may exist, so that it gets removed even if starting it failed.
+func (cm *ContainerManager) startService(ctx context.Context, network, runID, name string, service config.Service) (*RunningService, error) {
+	if err := cm.EnsureImage(ctx, service.Image, config.PullPolicyMissing); err != nil {
+		return nil, err
+	}
+
+	running := &RunningService{
+		Name:          name,
+		ContainerName: fmt.Sprintf("tako-%s-%s", runID, name),
+	}
+
+	args := buildServiceRunCommand(running.ContainerName, network, name, service)
+	if cm.debug {
+		fmt.Printf("Service command: %s %s\n", cm.runtime, strings.Join(args, " "))
+	}
+	if output, err := exec.CommandContext(ctx, string(cm.runtime), args...).CombinedOutput(); err != nil {
+		return running, fmt.Errorf("failed to run container %s: %w\nOutput: %s", running.ContainerName, err, string(output))
+	}
+
+	for _, port := range service.Ports {
+		containerPort := port[strings.LastIndex(port, ":")+1:]
+		hostPort, err := cm.publishedPort(ctx, running.ContainerName, containerPort)
+		if err != nil {
+			return running, err
+		}
+		running.Ports = append(running.Ports, ServicePort{
+			Container: strings.Split(containerPort, "/")[0],
+			Host:      hostPort,
+		})
+	}
+
+	return running, nil
+}
+
+// buildServiceRunCommand builds the arguments running a service container in the background,
+// reachable from the network under its service name.
+func buildServiceRunCommand(containerName, network, name string, service config.Service) []string {
+	args := []string{"run", "--detach", "--name", containerName, "--network", network, "--network-alias", name}
+
+	keys := make([]string, 0, len(service.Env))
+	for key := range service.Env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--env", fmt.Sprintf("%s=%s", key, service.Env[key]))
+	}
+
+	for _, port := range service.Ports {
+		args = append(args, "--publish", port)
+	}
+
+	args = append(args, service.Image)
+	return append(args, service.Command...)
+}
+
+// publishedPort returns the host port a container port of a service is published on.
+func (cm *ContainerManager) publishedPort(ctx context.Context, containerName, containerPort string) (string, error) {
+	output, err := exec.CommandContext(ctx, string(cm.runtime), "port", containerName, containerPort).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to find host port of %s port %s: %w", containerName, containerPort, err)
+	}
+	return parsePublishedPort(string(output))
+}
+
+// parsePublishedPort extracts the host port from the output of the runtime's port command,
+// such as "0.0.0.0:49153", which lists one address per line.
+func parsePublishedPort(output string) (string, error) {
+	line, _, _ := strings.Cut(strings.TrimSpace(output), "\n")
+	_, port, err := net.SplitHostPort(strings.TrimSpace(line))
+	if err != nil || port == "" {
+		return "", fmt.Errorf("unexpected port mapping '%s'", strings.TrimSpace(output))
+	}
+	return port, nil
+}
+
+// waitForService waits until a service container is running and, when it has a health check,
+// until the check succeeds.
+func (cm *ContainerManager) waitForService(ctx context.Context, service *RunningService, healthCheck *config.ServiceHealthCheck) error {
+	interval := defaultServiceCheckInterval
+	timeout := defaultServiceReadyTimeout
+	if healthCheck != nil {
+		// Durations are validated when the config is loaded
+		if healthCheck.Interval != "" {
+			interval, _ = time.ParseDuration(healthCheck.Interval)
+		}
+		if healthCheck.Timeout != "" {
+			timeout, _ = time.ParseDuration(healthCheck.Timeout)
+		}
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if !cm.containerRunning(waitCtx, service.ContainerName) {
+			if waitCtx.Err() == nil {
+				return fmt.Errorf("container %s exited", service.ContainerName)
+			}
+		} else if healthCheck == nil {
+			return nil
+		} else if err := exec.CommandContext(waitCtx, string(cm.runtime), "exec", service.ContainerName, "sh", "-c", healthCheck.Command).Run(); err == nil {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-waitCtx.Done():
+			if ctx.Err() != nil {
+				return context.Cause(ctx)
+			}
+			return fmt.Errorf("not ready after %s", timeout)
+		}
+	}
+}
+
+// containerRunning reports whether a container exists and is running.
+func (cm *ContainerManager) containerRunning(ctx context.Context, containerName string) bool {
+	output, err := exec.CommandContext(ctx, string(cm.runtime), "inspect", "--format", "{{.State.Running}}", containerName).Output()
+	return err == nil && strings.TrimSpace(string(output)) == "true"
+}
+
+// StopServices removes the service containers and the network of a service group. It does not
+// use the context of the run, so that services are removed even when the run was cancelled.
+func (cm *ContainerManager) StopServices(group *ServiceGroup) error {
+	var errs []string
+	for _, service := range group.Services {
+		if err := cm.cleanupContainer(service.ContainerName); err != nil {
+			errs = append(errs, fmt.Sprintf("container %s: %v", service.ContainerName, err))
+		}
+	}
+	if output, err := exec.Command(string(cm.runtime), "network", "rm", group.Network).CombinedOutput(); err != nil {
+		errs = append(errs, fmt.Sprintf("network %s: %v: %s", group.Network, err, strings.TrimSpace(string(output))))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to remove services: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Env returns the environment variables telling steps how to reach the services. Steps running
+// in containers reach them on the service network, by service name and container port; steps
+// running on the host reach them on localhost, through their published ports.
+//
+// For a service named "postgres" publishing port 5432, it sets TAKO_SERVICE_POSTGRES_HOST,
+// TAKO_SERVICE_POSTGRES_PORT_5432, and TAKO_SERVICE_POSTGRES_PORT for its first port.
+func (group *ServiceGroup) Env(inContainer bool) map[string]string {
+	env := make(map[string]string)
+	if group == nil {
+		return env
+	}
+
+	for _, service := range group.Services {
+		prefix := fmt.Sprintf("TAKO_SERVICE_%s", strings.ToUpper(strings.ReplaceAll(service.Name, "-", "_")))
+		env[prefix+"_HOST"] = "localhost"
+		if inContainer {
+			env[prefix+"_HOST"] = service.Name
+		}
+
+		for i, port := range service.Ports {
+			value := port.Host
+			if inContainer {
+				value = port.Container
+			}
+			env[fmt.Sprintf("%s_PORT_%s", prefix, port.Container)] = value
+			if i == 0 {
+				env[prefix+"_PORT"] = value
+			}
+		}
+	}
+
+	return env
+}
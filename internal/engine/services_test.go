@@ -0,0 +1,133 @@
+package engine
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestBuildServiceRunCommand(t *testing.T) {
+	service := config.Service{
+		Image:   "postgres:16",
+		Env:     map[string]string{"POSTGRES_USER": "tako", "POSTGRES_PASSWORD": "secret"},
+		Ports:   []string{"5432", "15432:5433/tcp"},
+		Command: []string{"postgres", "-c", "fsync=off"},
+	}
+
+	args := buildServiceRunCommand("tako-run-1-postgres", "tako-run-1", "postgres", service)
+
+	expected := []string{
+		"run", "--detach", "--name", "tako-run-1-postgres", "--network", "tako-run-1", "--network-alias", "postgres",
+		"--env", "POSTGRES_PASSWORD=secret", "--env", "POSTGRES_USER=tako",
+		"--publish", "5432", "--publish", "15432:5433/tcp",
+		"postgres:16", "postgres", "-c", "fsync=off",
+	}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("buildServiceRunCommand() = %v, want %v", args, expected)
+	}
+}
+
+func TestParsePublishedPort(t *testing.T) {
+	testCases := []struct {
+		output  string
+		want    string
+		wantErr bool
+	}{
+		{output: "0.0.0.0:49153\n", want: "49153"},
+		{output: "0.0.0.0:49153\n[::]:49153\n", want: "49153"},
+		{output: "[::]:5432", want: "5432"},
+		{output: "", wantErr: true},
+		{output: "no port", wantErr: true},
+	}
+
+	for _, tc := range testCases {
+		got, err := parsePublishedPort(tc.output)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("parsePublishedPort(%q) expected an error, got %q", tc.output, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("parsePublishedPort(%q) failed: %v", tc.output, err)
+		} else if got != tc.want {
+			t.Errorf("parsePublishedPort(%q) = %q, want %q", tc.output, got, tc.want)
+		}
+	}
+}
+
+func TestServiceGroupEnv(t *testing.T) {
+	group := &ServiceGroup{
+		Network: "tako-run-1",
+		Services: []*RunningService{
+			{
+				Name:          "postgres",
+				ContainerName: "tako-run-1-postgres",
+				Ports:         []ServicePort{{Container: "5432", Host: "49153"}, {Container: "8080", Host: "8081"}},
+			},
+			{Name: "object-store", ContainerName: "tako-run-1-object-store"},
+		},
+	}
+
+	hostEnv := group.Env(false)
+	expectedHost := map[string]string{
+		"TAKO_SERVICE_POSTGRES_HOST":      "localhost",
+		"TAKO_SERVICE_POSTGRES_PORT":      "49153",
+		"TAKO_SERVICE_POSTGRES_PORT_5432": "49153",
+		"TAKO_SERVICE_POSTGRES_PORT_8080": "8081",
+		"TAKO_SERVICE_OBJECT_STORE_HOST":  "localhost",
+	}
+	if !reflect.DeepEqual(hostEnv, expectedHost) {
+		t.Errorf("Env(false) = %v, want %v", hostEnv, expectedHost)
+	}
+
+	containerEnv := group.Env(true)
+	expectedContainer := map[string]string{
+		"TAKO_SERVICE_POSTGRES_HOST":      "postgres",
+		"TAKO_SERVICE_POSTGRES_PORT":      "5432",
+		"TAKO_SERVICE_POSTGRES_PORT_5432": "5432",
+		"TAKO_SERVICE_POSTGRES_PORT_8080": "8080",
+		"TAKO_SERVICE_OBJECT_STORE_HOST":  "object-store",
+	}
+	if !reflect.DeepEqual(containerEnv, expectedContainer) {
+		t.Errorf("Env(true) = %v, want %v", containerEnv, expectedContainer)
+	}
+
+	var noServices *ServiceGroup
+	if env := noServices.Env(false); len(env) != 0 {
+		t.Errorf("Expected no environment without services, got %v", env)
+	}
+}
+
+func TestRunnerServicesRequireContainerRuntime(t *testing.T) {
+	if _, err := NewContainerManager(false); err == nil {
+		t.Skip("a container runtime is available")
+	}
+
+	result, err := runParallelWorkflow(t, `  test:
+    services:
+      redis:
+        image: "redis:7"
+    steps:
+      - id: never-run
+        run: echo should-not-run
+`)
+	if err == nil || !strings.Contains(err.Error(), "require a container runtime") {
+		t.Fatalf("Expected a missing container runtime error, got %v", err)
+	}
+	if result.Success || len(result.Steps) != 0 {
+		t.Errorf("Expected no step to run without services, got %+v", result.Steps)
+	}
+}
+
+func TestStartServicesFailsWithoutRuntime(t *testing.T) {
+	cm := &ContainerManager{runtime: ContainerRuntime("tako-missing-runtime")}
+
+	_, err := cm.StartServices(context.Background(), "run-1", map[string]config.Service{"redis": {Image: "redis:7"}})
+	if err == nil || !strings.Contains(err.Error(), "failed to create service network tako-run-1") {
+		t.Errorf("Expected the network creation to fail, got %v", err)
+	}
+}
@@ -0,0 +1,194 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// defaultShell returns the shell that runs the commands of steps that do not choose one: sh,
+// or on Windows pwsh when it is installed and Windows PowerShell otherwise.
+func defaultShell() string {
+	if runtime.GOOS != "windows" {
+		return config.ShellSh
+	}
+	if _, err := exec.LookPath(config.ShellPwsh); err == nil {
+		return config.ShellPwsh
+	}
+	return config.ShellPowerShell
+}
+
+// shellProgram returns the program of a shell. python runs python3, the name most Linux and
+// macOS hosts and images install it under.
+func shellProgram(shell string) string {
+	if shell == config.ShellPython {
+		return "python3"
+	}
+	return shell
+}
+
+// hostProgram returns the program that runs on the host under a name, which for python3 is
+// python on hosts, such as Windows ones, that only have the latter.
+func hostProgram(program string) string {
+	if program != "python3" {
+		return program
+	}
+	if _, err := exec.LookPath(program); err != nil {
+		if _, err := exec.LookPath("python"); err == nil {
+			return "python"
+		}
+	}
+	return program
+}
+
+// shellArgs returns the command line that runs a script with a shell.
+func shellArgs(shell, script string) []string {
+	program := shellProgram(shell)
+	switch shell {
+	case config.ShellPwsh, config.ShellPowerShell:
+		return []string{program, "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", script}
+	case config.ShellCmd:
+		return []string{program, "/D", "/S", "/C", script}
+	case config.ShellNode:
+		return []string{program, "-e", script}
+	default:
+		return []string{program, "-c", script}
+	}
+}
+
+// newShellCommand returns the command that runs a script with a shell. cmd parses its own
+// command line, so its script is passed verbatim instead of being quoted as an argument.
+func newShellCommand(ctx context.Context, shell, script string) *exec.Cmd {
+	args := shellArgs(shell, script)
+	cmd := exec.CommandContext(ctx, hostProgram(args[0]), args[1:]...)
+	if shell == config.ShellCmd {
+		setCommandLine(cmd, shell+` /D /S /C "`+script+`"`)
+	}
+	return cmd
+}
+
+// isMultilineScript reports whether a command spans several lines, and so runs as a script.
+func isMultilineScript(command string) bool {
+	return strings.Contains(strings.TrimSpace(command), "\n")
+}
+
+// stepScript is a multi-line command written to a temporary file for its shell to run.
+type stepScript struct {
+	shell  string
+	path   string
+	header int // Lines written before the command's own
+}
+
+// scriptHeaders are the lines written before the commands of the scripts of each shell: a
+// shebang, then what makes the script stop at its first failing command. bash also reports the
+// line of the failing command, which it would not otherwise do.
+var scriptHeaders = map[string][]string{
+	config.ShellSh: {"#!/bin/sh"},
+	config.ShellBash: {
+		"#!/usr/bin/env bash",
+		"set -euo pipefail",
+		`trap 'echo "$0: line $LINENO: command exited with status $?" >&2' ERR`,
+	},
+	config.ShellPwsh:       {"#!/usr/bin/env pwsh", "$ErrorActionPreference = 'Stop'"},
+	config.ShellPowerShell: {"$ErrorActionPreference = 'Stop'"},
+	config.ShellCmd:        {"@echo off"},
+	config.ShellPython:     {"#!/usr/bin/env python3"},
+	config.ShellNode:       {"#!/usr/bin/env node"},
+}
+
+// scriptExtensions are the file extensions of the scripts of each shell.
+var scriptExtensions = map[string]string{
+	config.ShellSh:         ".sh",
+	config.ShellBash:       ".sh",
+	config.ShellPwsh:       ".ps1",
+	config.ShellPowerShell: ".ps1",
+	config.ShellCmd:        ".cmd",
+	config.ShellPython:     ".py",
+	config.ShellNode:       ".js",
+}
+
+// writeStepScript writes a multi-line command to a temporary script for a shell. The caller
+// removes it once the step ran.
+func writeStepScript(shell, command string) (*stepScript, error) {
+	file, err := os.CreateTemp("", "tako-step-*"+scriptExtensions[shell])
+	if err != nil {
+		return nil, err
+	}
+	header := scriptHeaders[shell]
+	content := strings.Join(append(header[:len(header):len(header)], command), "\n")
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	if shell == config.ShellCmd {
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+	if _, err := file.WriteString(content); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	if err := os.Chmod(file.Name(), 0700); err != nil {
+		_ = os.Remove(file.Name())
+		return nil, err
+	}
+	return &stepScript{shell: shell, path: file.Name(), header: len(header)}, nil
+}
+
+// Command returns the command that runs the script with its shell.
+func (s *stepScript) Command(ctx context.Context) *exec.Cmd {
+	program := hostProgram(shellProgram(s.shell))
+	switch s.shell {
+	case config.ShellPwsh, config.ShellPowerShell:
+		return exec.CommandContext(ctx, program, "-NoLogo", "-NoProfile", "-NonInteractive", "-File", s.path)
+	case config.ShellCmd:
+		return exec.CommandContext(ctx, program, "/D", "/C", s.path)
+	default:
+		return exec.CommandContext(ctx, program, s.path)
+	}
+}
+
+// Remove deletes the script.
+func (s *stepScript) Remove() {
+	_ = os.Remove(s.path)
+}
+
+// ErrorLine returns the line of the command that failed, as the shell reported it on the
+// standard error, or 0 when it did not. Python reports its innermost frame last, the other
+// shells report the failing line first.
+func (s *stepScript) ErrorLine(stderr string) int {
+	path := regexp.QuoteMeta(s.path)
+	var pattern string
+	switch s.shell {
+	case config.ShellSh, config.ShellBash:
+		pattern = path + `: (?:line )?(\d+):`
+	case config.ShellPython:
+		pattern = `File "` + path + `", line (\d+)`
+	case config.ShellCmd:
+		return 0
+	default:
+		pattern = path + `:(\d+)`
+	}
+	matches := regexp.MustCompile(pattern).FindAllStringSubmatch(stderr, -1)
+	if len(matches) == 0 {
+		return 0
+	}
+	match := matches[0]
+	if s.shell == config.ShellPython {
+		match = matches[len(matches)-1]
+	}
+	line, err := strconv.Atoi(match[1])
+	if err != nil || line <= s.header {
+		return 0
+	}
+	return line - s.header
+}
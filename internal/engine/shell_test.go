@@ -0,0 +1,192 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestShellArgs(t *testing.T) {
+	tests := []struct {
+		shell string
+		want  []string
+	}{
+		{"sh", []string{"sh", "-c", "echo hi"}},
+		{"bash", []string{"bash", "-c", "echo hi"}},
+		{"pwsh", []string{"pwsh", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+		{"powershell", []string{"powershell", "-NoLogo", "-NoProfile", "-NonInteractive", "-Command", "echo hi"}},
+		{"cmd", []string{"cmd", "/D", "/S", "/C", "echo hi"}},
+		{"python", []string{"python3", "-c", "echo hi"}},
+		{"node", []string{"node", "-e", "echo hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			if got := shellArgs(tt.shell, "echo hi"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shellArgs(%q) = %v, want %v", tt.shell, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultShell(t *testing.T) {
+	shell := defaultShell()
+	switch runtime.GOOS {
+	case "windows":
+		if shell != "pwsh" && shell != "powershell" {
+			t.Errorf("defaultShell() = %q, want pwsh or powershell", shell)
+		}
+	default:
+		if shell != "sh" {
+			t.Errorf("defaultShell() = %q, want sh", shell)
+		}
+	}
+}
+
+func TestNewShellCommand(t *testing.T) {
+	tests := []struct {
+		shell  string
+		script string
+		goos   string
+	}{
+		{"sh", `echo "$((1 + 1))"`, ""},
+		{"bash", `words=(one two); echo "${#words[@]}"`, ""},
+		{"pwsh", `Write-Output (1 + 1)`, ""},
+		{"powershell", `Write-Output (1 + 1)`, "windows"},
+		{"cmd", `set /a 1+1 >nul && echo 2`, "windows"},
+		{"python", `print(1 + 1)`, ""},
+		{"node", `console.log(1 + 1)`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			if tt.goos != "" && runtime.GOOS != tt.goos {
+				t.Skipf("%s only runs on %s", tt.shell, tt.goos)
+			}
+			if _, err := exec.LookPath(hostProgram(shellProgram(tt.shell))); err != nil {
+				t.Skipf("%s is not installed", tt.shell)
+			}
+			out, err := newShellCommand(context.Background(), tt.shell, tt.script).Output()
+			if err != nil {
+				t.Fatalf("%s failed: %v", tt.shell, err)
+			}
+			if got := strings.TrimSpace(string(out)); got != "2" {
+				t.Errorf("%s printed %q, want 2", tt.shell, got)
+			}
+		})
+	}
+}
+
+func TestRunnerShell(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  build:
+    shell: bash
+    steps:
+      - id: workflow
+        run: 'words=(one two); echo "${#words[@]}"'
+        produces:
+          outputs:
+            count: from_stdout
+      - id: step
+        shell: sh
+        run: echo "$0"
+        produces:
+          outputs:
+            shell: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if count := strings.TrimSpace(result.Steps[0].Outputs["count"]); count != "2" {
+		t.Errorf("Expected the step to run with the workflow's shell, got %q", count)
+	}
+	if shell := strings.TrimSpace(result.Steps[1].Outputs["shell"]); shell != "sh" {
+		t.Errorf("Expected the step to run with its own shell, got %q", shell)
+	}
+}
+
+func TestRunnerScripts(t *testing.T) {
+	tests := []struct {
+		shell  string
+		script string
+		line   int
+	}{
+		{"sh", "echo start\nmissing-command\nexit 3", 2},
+		{"bash", "echo start\nfalse\necho unreachable", 2},
+		{"bash", "echo start\n\nfalse | true\nexit 0", 3},
+		{"python", "import sys\nprint('start')\nraise SystemError('boom')", 3},
+		{"node", "console.log('start');\n\nthrow new Error('boom');", 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shell, func(t *testing.T) {
+			if _, err := exec.LookPath(hostProgram(shellProgram(tt.shell))); err != nil {
+				t.Skipf("%s is not installed", tt.shell)
+			}
+			tempDir := t.TempDir()
+			workflow := map[string]interface{}{
+				"version": "0.1.0",
+				"workflows": map[string]interface{}{
+					"build": map[string]interface{}{
+						"steps": []interface{}{map[string]interface{}{"id": "script", "shell": tt.shell, "run": tt.script}},
+					},
+				},
+			}
+			content, err := yaml.Marshal(workflow)
+			if err != nil {
+				t.Fatalf("Failed to marshal tako.yml: %v", err)
+			}
+			if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), content, 0644); err != nil {
+				t.Fatalf("Failed to create test tako.yml: %v", err)
+			}
+
+			runner, err := NewRunner(RunnerOptions{
+				WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+				CacheDir:      filepath.Join(tempDir, "cache"),
+			})
+			if err != nil {
+				t.Fatalf("Failed to create runner: %v", err)
+			}
+			defer runner.Close()
+
+			result, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir)
+			if err == nil {
+				t.Fatal("Expected the script to fail")
+			}
+			step := result.Steps[0]
+			if step.ErrorLine != tt.line {
+				t.Errorf("Expected the script to fail at line %d, got %d (%v)", tt.line, step.ErrorLine, step.Error)
+			}
+			if want := fmt.Sprintf("line %d:", tt.line); step.Error == nil || !strings.Contains(step.Error.Error(), want) {
+				t.Errorf("Expected the error to contain %q, got %v", want, step.Error)
+			}
+			if strings.Contains(step.Output, "unreachable") {
+				t.Errorf("Expected the script to stop at its failing command, got %q", step.Output)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// SimulatedWorkflow is a workflow of the execution tree walked by a simulation, with the
+// fan-out steps it would run and the workflows they would trigger.
+type SimulatedWorkflow struct {
+	Repository string            `json:"repository"`
+	Workflow   string            `json:"workflow"`
+	Inputs     map[string]string `json:"inputs,omitempty"` // Resolved inputs, with the defaults of the workflow
+	FanOuts    []SimulatedFanOut `json:"fan_outs,omitempty"`
+	Error      string            `json:"error,omitempty"` // Why the workflow would not run; its fan-outs are not walked
+
+	definition config.Workflow // Definition the workflow was simulated from, for estimates
+}
+
+// SimulatedFanOut is a fan-out step of a simulated workflow.
+type SimulatedFanOut struct {
+	StepID           string               `json:"step_id"`
+	EventType        string               `json:"event_type,omitempty"`
+	ConcurrencyLimit int                  `json:"concurrency_limit,omitempty"` // Children running at once; all of them when zero
+	WaitForChildren  bool                 `json:"wait_for_children,omitempty"`
+	Condition        string               `json:"condition,omitempty"` // if: of the step, which a simulation cannot evaluate
+	Children         []*SimulatedWorkflow `json:"children,omitempty"`
+	Skipped          []SimulatedSkip      `json:"skipped,omitempty"`
+	Error            string               `json:"error,omitempty"` // Why the fan-out would fail without triggering its children
+}
+
+// SimulatedSkip is a subscriber a simulated fan-out would not trigger.
+type SimulatedSkip struct {
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	Reason     string `json:"reason"`
+}
+
+// Count returns the number of workflows of the simulated tree rooted at the workflow,
+// including itself.
+func (w *SimulatedWorkflow) Count() int {
+	count := 1
+	for _, fanOut := range w.FanOuts {
+		for _, child := range fanOut.Children {
+			count += child.Count()
+		}
+	}
+	return count
+}
+
+// SimulateWorkflow walks the execution tree a workflow would start without running any of its
+// steps. The subscribers of each fan-out step are discovered and their filters evaluated as a
+// run would, and the workflows they would trigger are simulated in turn with their resolved
+// inputs. Payloads are taken as written, since no step produces outputs, and deduplication
+// windows, signatures and child budgets are not checked.
+func (r *Runner) SimulateWorkflow(ctx context.Context, workflowName string, inputs map[string]string, repoPath string) (*SimulatedWorkflow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create subscription evaluator: %v", err)
+	}
+
+	// Discovery sees the current subscriptions, like the fan-outs of a run
+	r.gitManager.RefreshStale(ctx)
+
+	repository := r.repository
+	if repository == "" {
+		repository = r.getRepositoryNameFromPath(repoPath)
+	}
+	// The root of the simulated tree starts its lineage, like the root run of ExecuteWorkflow
+	lineage := r.lineage
+	if len(lineage) == 0 {
+		lineage = []string{lineageNode(repository, workflowName)}
+	}
+	root := r.simulateWorkflow(ctx, evaluator, repository, r.getSourceRepository(), workflowName, inputs, repoPath, lineage, r.profile)
+	if root.Error != "" {
+		return root, fmt.Errorf("%s", root.Error)
+	}
+	return root, ctx.Err()
+}
+
+// SimulateMultiRepoWorkflow simulates a workflow of a repository given as owner/repo:ref, like
+// ExecuteMultiRepoWorkflow runs it.
+func (r *Runner) SimulateMultiRepoWorkflow(ctx context.Context, workflowName string, inputs map[string]string, parentRepo string) (*SimulatedWorkflow, error) {
+	repoPath, err := r.resolveRepositoryPath(ctx, parentRepo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve repository path: %v", err)
+	}
+	r.repository = strings.Split(parentRepo, ":")[0]
+	return r.SimulateWorkflow(ctx, workflowName, inputs, repoPath)
+}
+
+// simulateWorkflow simulates a workflow of the repository at repoPath, run with the given
+// lineage, whose fan-outs emit events from sourceRepo. Only the root of the tree is merged
+// with the profile of the runner.
+func (r *Runner) simulateWorkflow(ctx context.Context, evaluator *SubscriptionEvaluator, repository, sourceRepo, workflowName string, inputs map[string]string, repoPath string, lineage []string, profile string) *SimulatedWorkflow {
+	node := &SimulatedWorkflow{Repository: repository, Workflow: workflowName}
+
+	cfg, err := config.LoadWithCache(filepath.Join(repoPath, "tako.yml"), r.cacheDir)
+	if err != nil {
+		node.Error = fmt.Sprintf("failed to load config: %v", err)
+		return node
+	}
+	if profile != "" {
+		if err := cfg.ApplyProfile(profile); err != nil {
+			node.Error = err.Error()
+			return node
+		}
+	}
+	workflow, exists := cfg.Workflows[workflowName]
+	if !exists {
+		node.Error = fmt.Sprintf("workflow '%s' not found", workflowName)
+		return node
+	}
+	node.definition = workflow
+
+	node.Inputs = make(map[string]string, len(inputs))
+	for name, value := range inputs {
+		node.Inputs[name] = value
+	}
+	if err := r.validateInputs(workflow, node.Inputs); err != nil {
+		node.Error = fmt.Sprintf("input validation failed: %v", err)
+		return node
+	}
+
+	for _, step := range simulatedSteps(workflow.Steps) {
+		if ctx.Err() != nil {
+			break
+		}
+		if step.Uses == "tako/fan-out@v1" {
+			node.FanOuts = append(node.FanOuts, r.simulateFanOut(ctx, evaluator, step, sourceRepo, lineage))
+		}
+	}
+	return node
+}
+
+// simulatedSteps returns the steps of a workflow in order, with the steps of parallel groups
+// in place of their groups.
+func simulatedSteps(steps []config.WorkflowStep) []config.WorkflowStep {
+	var flattened []config.WorkflowStep
+	for _, step := range steps {
+		if len(step.Parallel) > 0 {
+			flattened = append(flattened, simulatedSteps(step.Parallel)...)
+			continue
+		}
+		flattened = append(flattened, step)
+	}
+	return flattened
+}
+
+// simulateFanOut simulates a fan-out step of a workflow run with the given lineage, simulating
+// the workflows of the subscribers it would trigger.
+func (r *Runner) simulateFanOut(ctx context.Context, evaluator *SubscriptionEvaluator, step config.WorkflowStep, sourceRepo string, lineage []string) SimulatedFanOut {
+	fanOut := SimulatedFanOut{StepID: step.ID, Condition: step.If}
+
+	executor := &FanOutExecutor{lineage: lineage, maxDepth: r.maxFanOutDepth}
+	params, err := executor.parseFanOutParams(step.With)
+	if err != nil {
+		fanOut.Error = fmt.Sprintf("invalid parameters: %v", err)
+		return fanOut
+	}
+	fanOut.EventType = params.EventType
+	fanOut.ConcurrencyLimit = params.ConcurrencyLimit
+	fanOut.WaitForChildren = params.WaitForChildren
+
+	skip := func(subscriber SubscriptionMatch, reason string) {
+		fanOut.Skipped = append(fanOut.Skipped, SimulatedSkip{
+			Repository: subscriber.Repository,
+			Workflow:   subscriber.Subscription.Workflow,
+			Reason:     reason,
+		})
+	}
+
+	// Each subscriber is triggered once, by the first event of a batch it matches
+	now := time.Now()
+	var matched []SubscriptionMatch
+	var childInputs []map[string]string
+	for _, emitted := range params.emittedEvents() {
+		subscriptions, err := r.orchestrator.DiscoverSubscriptions(ctx, fmt.Sprintf("%s:default", sourceRepo), emitted.EventType)
+		if err != nil {
+			fanOut.Error = fmt.Sprintf("failed to discover subscriptions: %v", err)
+			return fanOut
+		}
+
+		event := NewEventBuilder(emitted.EventType).
+			WithSource(sourceRepo).
+			WithPayload(emitted.Payload).
+			WithCorrelation(r.correlationID).
+			Build()
+		if emitted.SchemaVersion != "" {
+			event.Schema = fmt.Sprintf("%s@%s", emitted.EventType, emitted.SchemaVersion)
+		}
+		legacyEvent := event.ToLegacyEvent()
+
+		targeted := subscriptions
+		if len(params.Targets) > 0 || len(params.Exclude) > 0 {
+			targeted = filterTargetedSubscribers(subscriptions, params.Targets, params.Exclude)
+			for _, subscriber := range subscriptions {
+				if !containsSubscriber(targeted, subscriber) {
+					skip(subscriber, "not targeted by the fan-out")
+				}
+			}
+		}
+
+		for _, subscriber := range targeted {
+			if !subscriber.Subscription.IsActive(now) {
+				skip(subscriber, "subscription is disabled")
+				continue
+			}
+			evaluation, err := evaluator.ExplainSubscription(subscriber.Subscription, legacyEvent)
+			if err != nil {
+				skip(subscriber, fmt.Sprintf("evaluation failed: %v", err))
+				continue
+			}
+			if !evaluation.Matched {
+				skip(subscriber, evaluation.Reason)
+				continue
+			}
+			if len(params.Events) > 0 && containsSubscriber(matched, subscriber) {
+				skip(subscriber, "already triggered by an earlier event of the batch")
+				continue
+			}
+			workflowInputs, err := evaluator.ProcessEvent(legacyEvent, subscriber.Subscription)
+			if err != nil {
+				skip(subscriber, fmt.Sprintf("failed to map inputs: %v", err))
+				continue
+			}
+			matched = append(matched, subscriber)
+			childInputs = append(childInputs, workflowInputs)
+		}
+	}
+
+	// A run stops the whole fan-out when a child would close a cycle or run too deep
+	if err := executor.checkLineage(matched); err != nil {
+		fanOut.Error = err.Error()
+		return fanOut
+	}
+
+	for i, subscriber := range matched {
+		childLineage := append(slices.Clone(lineage), lineageNode(subscriber.Repository, subscriber.Subscription.Workflow))
+		// Child runs emit their events from their own repository
+		repository, _, _ := strings.Cut(subscriber.Repository, ":")
+		child := r.simulateWorkflow(ctx, evaluator, subscriber.Repository, repository, subscriber.Subscription.Workflow, childInputs[i], subscriber.RepoPath, childLineage, "")
+		fanOut.Children = append(fanOut.Children, child)
+	}
+	return fanOut
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunnerSimulateWorkflow(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    inputs:
+      version:
+        default: "1.2.0"
+    steps:
+      - id: build
+        run: touch built
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          payload:
+            version: "1.2.0"
+            channel: stable
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    inputs:
+      version:
+        required: true
+      mode:
+        default: fast
+    steps:
+      - run: touch updated
+      - id: notify
+        uses: tako/fan-out@v1
+        with:
+          event_type: app_updated
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    inputs:
+      version: "{{ .payload.version }}"
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/beta", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: touch updated
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built]
+    workflow: update
+    filters:
+      - payload.channel == "beta"
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/deploy", `version: 0.1.0
+workflows:
+  deploy:
+    steps:
+      - run: touch deployed
+subscriptions:
+  - artifact: test-org/app:default
+    events: [app_updated]
+    workflow: deploy
+`)
+
+	runner.repository = "test-org/lib"
+	tree, err := runner.SimulateWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+
+	if tree.Workflow != "release" || tree.Inputs["version"] != "1.2.0" {
+		t.Errorf("Expected the root workflow with its default inputs, got %+v", tree)
+	}
+	if len(tree.FanOuts) != 1 || tree.FanOuts[0].EventType != "library_built" {
+		t.Fatalf("Expected the fan-out of the root workflow, got %+v", tree.FanOuts)
+	}
+	fanOut := tree.FanOuts[0]
+	if len(fanOut.Children) != 1 || fanOut.Children[0].Repository != "test-org/app" {
+		t.Fatalf("Expected only test-org/app to be triggered, got %+v", fanOut.Children)
+	}
+	if len(fanOut.Skipped) != 1 || fanOut.Skipped[0].Repository != "test-org/beta" || !strings.Contains(fanOut.Skipped[0].Reason, "did not hold") {
+		t.Errorf("Expected test-org/beta to be skipped by its filter, got %+v", fanOut.Skipped)
+	}
+
+	app := fanOut.Children[0]
+	if app.Inputs["version"] != "1.2.0" || app.Inputs["mode"] != "fast" {
+		t.Errorf("Expected the mapped and default inputs of the child, got %v", app.Inputs)
+	}
+	if len(app.FanOuts) != 1 || len(app.FanOuts[0].Children) != 1 || app.FanOuts[0].Children[0].Workflow != "deploy" {
+		t.Fatalf("Expected the grandchild triggered by the child, got %+v", app.FanOuts)
+	}
+	if count := tree.Count(); count != 3 {
+		t.Errorf("Expected 3 workflows in the tree, got %d", count)
+	}
+
+	// Nothing ran: neither the steps of the root nor those of the subscribers
+	if _, err := os.Stat(filepath.Join(repoDir, "built")); !os.IsNotExist(err) {
+		t.Errorf("Expected the steps of the root workflow not to run")
+	}
+	if _, err := os.Stat(filepath.Join(runner.cacheDir, "repos", "test-org", "app", "main", "updated")); !os.IsNotExist(err) {
+		t.Errorf("Expected the steps of the children not to run")
+	}
+}
+
+func TestRunnerSimulateWorkflowCycle(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    steps:
+      - id: publish
+        uses: tako/fan-out@v1
+        with:
+          event_type: ping
+`)
+	writeCachedRepo(t, runner.cacheDir, "test-org/echo", `version: 0.1.0
+workflows:
+  echo:
+    steps:
+      - id: reply
+        uses: tako/fan-out@v1
+        with:
+          event_type: ping
+subscriptions:
+  - artifact: test-org/echo:default
+    events: [ping]
+    workflow: echo
+`)
+
+	runner.repository = "test-org/echo"
+	tree, err := runner.SimulateWorkflow(context.Background(), "release", nil, repoDir)
+	if err != nil {
+		t.Fatalf("Simulation failed: %v", err)
+	}
+
+	echo := tree.FanOuts[0].Children[0]
+	if len(echo.FanOuts) != 1 || !strings.Contains(echo.FanOuts[0].Error, ErrFanOutCycle.Error()) {
+		t.Errorf("Expected the fan-out of the child to report the cycle, got %+v", echo.FanOuts)
+	}
+}
+
+func TestRunnerSimulateWorkflowMissingWorkflow(t *testing.T) {
+	runner, repoDir := newCallWorkflowRunner(t, `  release:
+    steps:
+      - run: echo release
+`)
+
+	tree, err := runner.SimulateWorkflow(context.Background(), "missing", nil, repoDir)
+	if err == nil || !strings.Contains(err.Error(), "workflow 'missing' not found") {
+		t.Fatalf("Expected the missing workflow to fail the simulation, got %v", err)
+	}
+	if tree == nil || tree.Error == "" || errors.Unwrap(err) != nil {
+		t.Errorf("Expected the tree to record the error, got %+v", tree)
+	}
+}
@@ -18,6 +18,13 @@ const (
 	StatusCompleted ExecutionStatus = "completed"
 	StatusFailed    ExecutionStatus = "failed"
 	StatusCancelled ExecutionStatus = "cancelled"
+	StatusSkipped   ExecutionStatus = "skipped"
+	// StatusInterrupted marks a run stopped by a signal, or whose process died, before it
+	// finished. Interrupted runs are resumable.
+	StatusInterrupted ExecutionStatus = "interrupted"
+	// StatusWaitingForApproval marks a step, or a fan-out child, held by an approval gate until
+	// tako approve decides it. The run of a waiting step stays running.
+	StatusWaitingForApproval ExecutionStatus = "waiting_for_approval"
 )
 
 // ExecutionState manages the persistent state of workflow executions.
@@ -32,10 +39,22 @@ type ExecutionState struct {
 	EndTime      *time.Time        `json:"end_time,omitempty"`
 	Error        string            `json:"error,omitempty"`
 
+	// OwnerPID is the process running the execution, whose death leaves the run interrupted.
+	OwnerPID int `json:"owner_pid,omitempty"`
+
 	// Execution tree support
 	ParentRunID string   `json:"parent_run_id,omitempty"`
 	ChildRuns   []string `json:"child_runs,omitempty"`
 
+	// CorrelationID is shared by the runs of an execution tree: the run ID of its root
+	CorrelationID string `json:"correlation_id,omitempty"`
+
+	// Lineage is the repository:workflow of the runs from the root of the tree to this run
+	Lineage []string `json:"lineage,omitempty"`
+
+	// Namespace is the tenant the run belongs to; empty for the default namespace
+	Namespace string `json:"namespace,omitempty"`
+
 	// Step-level state
 	Steps       map[string]*StepState `json:"steps"`
 	CurrentStep string                `json:"current_step,omitempty"`
@@ -44,8 +63,14 @@ type ExecutionState struct {
 	Version     string    `json:"version"`
 	LastUpdated time.Time `json:"last_updated"`
 
+	// SchemaVersion is the version of the shape of the state file, which older files are
+	// migrated from when they are loaded.
+	SchemaVersion int `json:"schema_version"`
+
 	// Internal state management
 	stateFile string
+	faults    *FaultInjector // Faults injected when the state is saved; nil for none
+	clock     Clock          // Clock of the times recorded in the state; the system clock when nil
 	mu        sync.RWMutex
 }
 
@@ -71,12 +96,13 @@ func NewExecutionState(runID, workspaceRoot string) (*ExecutionState, error) {
 	stateFile := filepath.Join(stateDir, "execution.json")
 
 	state := &ExecutionState{
-		RunID:       runID,
-		Status:      StatusPending,
-		Steps:       make(map[string]*StepState),
-		Version:     "1.0",
-		LastUpdated: time.Now(),
-		stateFile:   stateFile,
+		RunID:         runID,
+		Status:        StatusPending,
+		Steps:         make(map[string]*StepState),
+		Version:       "1.0",
+		LastUpdated:   time.Now(),
+		SchemaVersion: ExecutionStateSchemaVersion,
+		stateFile:     stateFile,
 	}
 
 	// Try to load existing state
@@ -97,7 +123,7 @@ func LoadExecutionState(runID, workspaceRoot string) (*ExecutionState, error) {
 	}
 
 	var state ExecutionState
-	if err := json.Unmarshal(data, &state); err != nil {
+	if err := decodeExecutionState(data, &state); err != nil {
 		return nil, fmt.Errorf("failed to parse state file: %v", err)
 	}
 
@@ -117,11 +143,12 @@ func (s *ExecutionState) StartExecution(workflowName, repository string, inputs
 	defer s.mu.Unlock()
 
 	s.Status = StatusRunning
+	s.OwnerPID = os.Getpid()
 	s.WorkflowName = workflowName
 	s.Repository = repository
 	s.Inputs = inputs
-	s.StartTime = time.Now()
-	s.LastUpdated = time.Now()
+	s.StartTime = s.now()
+	s.LastUpdated = s.now()
 
 	return s.save()
 }
@@ -131,7 +158,7 @@ func (s *ExecutionState) CompleteExecution() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 	s.Status = StatusCompleted
 	s.EndTime = &now
 	s.LastUpdated = now
@@ -145,7 +172,7 @@ func (s *ExecutionState) FailExecution(errorMsg string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 	s.Status = StatusFailed
 	s.EndTime = &now
 	s.Error = errorMsg
@@ -154,25 +181,59 @@ func (s *ExecutionState) FailExecution(errorMsg string) error {
 	return s.save()
 }
 
-// CancelExecution marks the execution as cancelled.
-func (s *ExecutionState) CancelExecution() error {
+// CancelExecution marks the execution as cancelled, along with the step that was
+// running when the cancellation was observed.
+func (s *ExecutionState) CancelExecution(reason string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 	s.Status = StatusCancelled
 	s.EndTime = &now
+	s.Error = reason
 	s.LastUpdated = now
 
+	if step := s.Steps[s.CurrentStep]; step != nil && (step.Status == StatusRunning || step.Status == StatusWaitingForApproval || step.Status == StatusFailed) {
+		step.Status = StatusCancelled
+		step.EndTime = &now
+	}
+	s.CurrentStep = ""
+
 	return s.save()
 }
 
+// InterruptExecution marks the execution as interrupted, along with the step that was running,
+// so that it can be resumed from its completed steps.
+func (s *ExecutionState) InterruptExecution(reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.interrupt(reason, s.now())
+	return s.save()
+}
+
+// interrupt marks the execution and its running steps as interrupted. Must be called with
+// s.mu held.
+func (s *ExecutionState) interrupt(reason string, now time.Time) {
+	s.Status = StatusInterrupted
+	s.EndTime = &now
+	s.Error = reason
+	s.LastUpdated = now
+	for _, step := range s.Steps {
+		if step.Status == StatusRunning || step.Status == StatusWaitingForApproval {
+			step.Status = StatusInterrupted
+			step.EndTime = &now
+		}
+	}
+	s.CurrentStep = ""
+}
+
 // StartStep marks the beginning of a workflow step execution.
 func (s *ExecutionState) StartStep(stepID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	now := time.Now()
+	now := s.now()
 
 	if s.Steps[stepID] == nil {
 		s.Steps[stepID] = &StepState{
@@ -194,6 +255,43 @@ func (s *ExecutionState) StartStep(stepID string) error {
 	return s.save()
 }
 
+// WaitForApproval marks a running step as waiting for the decision of its approval gate.
+func (s *ExecutionState) WaitForApproval(stepID string) error {
+	return s.setStepStatus(stepID, StatusRunning, StatusWaitingForApproval)
+}
+
+// ResumeStep marks a step waiting for approval as running again, once its gate was decided.
+func (s *ExecutionState) ResumeStep(stepID string) error {
+	return s.setStepStatus(stepID, StatusWaitingForApproval, StatusRunning)
+}
+
+// WaitingForApproval reports whether the current step of a running execution waits for approval.
+func (s *ExecutionState) WaitingForApproval() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	step := s.Steps[s.CurrentStep]
+	return s.Status == StatusRunning && step != nil && step.Status == StatusWaitingForApproval
+}
+
+// setStepStatus moves a step from one status to another.
+func (s *ExecutionState) setStepStatus(stepID string, from, to ExecutionStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	step := s.Steps[stepID]
+	if step == nil {
+		return fmt.Errorf("step %s not found", stepID)
+	}
+	if step.Status != from {
+		return fmt.Errorf("step %s is %s, not %s", stepID, step.Status, from)
+	}
+	step.Status = to
+	s.LastUpdated = s.now()
+
+	return s.save()
+}
+
 // CompleteStep marks a step as successfully completed.
 func (s *ExecutionState) CompleteStep(stepID, output string, outputs map[string]string) error {
 	s.mu.Lock()
@@ -204,7 +302,7 @@ func (s *ExecutionState) CompleteStep(stepID, output string, outputs map[string]
 		return fmt.Errorf("step %s not found", stepID)
 	}
 
-	now := time.Now()
+	now := s.now()
 	step.Status = StatusCompleted
 	step.EndTime = &now
 	step.Output = output
@@ -227,7 +325,7 @@ func (s *ExecutionState) FailStep(stepID, errorMsg string) error {
 		return fmt.Errorf("step %s not found", stepID)
 	}
 
-	now := time.Now()
+	now := s.now()
 	step.Status = StatusFailed
 	step.EndTime = &now
 	step.Error = errorMsg
@@ -237,13 +335,32 @@ func (s *ExecutionState) FailStep(stepID, errorMsg string) error {
 	return s.save()
 }
 
+// SkipStep marks a step as skipped because its condition did not hold.
+func (s *ExecutionState) SkipStep(stepID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	step := s.Steps[stepID]
+	if step == nil {
+		return fmt.Errorf("step %s not found", stepID)
+	}
+
+	now := s.now()
+	step.Status = StatusSkipped
+	step.EndTime = &now
+
+	s.LastUpdated = now
+
+	return s.save()
+}
+
 // AddChildRun adds a child run ID to the execution tree.
 func (s *ExecutionState) AddChildRun(childRunID string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	s.ChildRuns = append(s.ChildRuns, childRunID)
-	s.LastUpdated = time.Now()
+	s.LastUpdated = s.now()
 
 	return s.save()
 }
@@ -312,7 +429,7 @@ func (s *ExecutionState) IsResumable() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.Status == StatusFailed && len(s.GetFailedSteps()) > 0
+	return s.Status == StatusInterrupted || (s.Status == StatusFailed && len(s.GetFailedSteps()) > 0)
 }
 
 // GetExecutionSummary returns a summary of the execution state.
@@ -370,6 +487,12 @@ func (s *ExecutionState) save() error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal state: %v", err)
 	}
+	if err := s.faults.fail(FaultStatePersist, s.RunID); err != nil {
+		return err
+	}
+	if err := s.faults.writePartially(s.stateFile, data, s.RunID); err != nil {
+		return err
+	}
 
 	// Write to temporary file first, then atomic rename
 	tempFile := s.stateFile + ".tmp"
@@ -392,5 +515,10 @@ func (s *ExecutionState) load() error {
 		return err
 	}
 
-	return json.Unmarshal(data, s)
+	return decodeExecutionState(data, s)
+}
+
+// now returns the time of the state's clock.
+func (s *ExecutionState) now() time.Time {
+	return clockOrSystem(s.clock).Now()
 }
@@ -0,0 +1,180 @@
+package engine
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Schema versions of the state files written. Files without a schema version predate the
+// versioning and are version 0. Changing the shape of a state requires a new version, with a
+// migration upgrading the files of the previous one and a fixture of it under testdata/states.
+const (
+	// ExecutionStateSchemaVersion is the schema version of the execution states.
+	ExecutionStateSchemaVersion = 1
+	// FanOutStateSchemaVersion is the schema version of the fan-out states.
+	FanOutStateSchemaVersion = 1
+)
+
+// stateMigration upgrades a state file from a schema version to the next one. It edits the
+// state decoded as generic JSON, so that it does not depend on the structs of any version.
+type stateMigration func(state map[string]interface{}) error
+
+// executionStateMigrations are the migrations of the execution states, by the schema version
+// they upgrade from.
+var executionStateMigrations = []stateMigration{
+	0: migrateExecutionStateV0,
+}
+
+// fanOutStateMigrations are the migrations of the fan-out states, by the schema version they
+// upgrade from.
+var fanOutStateMigrations = []stateMigration{
+	0: migrateFanOutStateV0,
+}
+
+// childMigration upgrades a child of a fan-out state from a schema version to the next one,
+// given the other fields of the fan-out, upgraded to the same version.
+type childMigration func(child, fanOut map[string]interface{}) error
+
+// fanOutChildMigrations are the migrations of the children of the fan-out states, by the schema
+// version they upgrade from; nil for versions that leave the children as they are. The state
+// migrations apply them to the children of the state files, and migrateFanOutChild to the
+// children stored apart, in shards and journals.
+var fanOutChildMigrations = []childMigration{
+	0: migrateFanOutChildV0,
+}
+
+// migrateState upgrades a state file of a kind to the latest schema version, the number of its
+// migrations, and returns the schema version it was written with. Files that are up to date are
+// returned as they are, and files of a newer schema version, written by a newer tako, fail.
+func migrateState(kind string, data []byte, migrations []stateMigration) ([]byte, int, error) {
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, 0, err
+	}
+	latest := len(migrations)
+	if header.SchemaVersion == latest {
+		return data, latest, nil
+	}
+	if header.SchemaVersion > latest || header.SchemaVersion < 0 {
+		return nil, 0, fmt.Errorf("%s state has schema version %d, this tako supports up to %d", kind, header.SchemaVersion, latest)
+	}
+
+	state, err := decodeGenericJSON(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	for version := header.SchemaVersion; version < latest; version++ {
+		if err := migrations[version](state); err != nil {
+			return nil, 0, fmt.Errorf("failed to migrate %s state from schema version %d: %v", kind, version, err)
+		}
+	}
+	state["schema_version"] = latest
+	data, err = json.Marshal(state)
+	return data, header.SchemaVersion, err
+}
+
+// decodeGenericJSON decodes a JSON object for the migrations. Numbers are kept as they are
+// written, so that durations and revisions do not lose precision.
+func decodeGenericJSON(data []byte) (map[string]interface{}, error) {
+	var object map[string]interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// decodeExecutionState decodes an execution state file into state, upgrading it to the latest
+// schema version.
+func decodeExecutionState(data []byte, state *ExecutionState) error {
+	data, _, err := migrateState("execution", data, executionStateMigrations)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, state)
+}
+
+// migrateExecutionStateV0 upgrades the execution states written before the schema was
+// versioned. Their steps may be null, and the root runs started before correlation IDs were
+// recorded are given their own run ID, the correlation ID of their tree.
+func migrateExecutionStateV0(state map[string]interface{}) error {
+	if steps, _ := state["steps"].(map[string]interface{}); steps == nil {
+		state["steps"] = map[string]interface{}{}
+	}
+	if correlationID, _ := state["correlation_id"].(string); correlationID == "" {
+		if parentRunID, _ := state["parent_run_id"].(string); parentRunID == "" {
+			state["correlation_id"] = state["run_id"]
+		}
+	}
+	return nil
+}
+
+// migrateFanOutStateV0 upgrades the fan-out states written before the schema was versioned.
+// Their children may be null.
+func migrateFanOutStateV0(state map[string]interface{}) error {
+	children, _ := state["children"].(map[string]interface{})
+	if children == nil {
+		state["children"] = map[string]interface{}{}
+	}
+	for childID, value := range children {
+		child, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid child %s", childID)
+		}
+		if err := migrateFanOutChildV0(child, state); err != nil {
+			return fmt.Errorf("failed to migrate child %s: %v", childID, err)
+		}
+	}
+	return nil
+}
+
+// migrateFanOutChildV0 upgrades the children of the fan-out states written before the schema
+// was versioned. The children triggered before correlation IDs were recorded for them are
+// given the correlation ID of the fan-out.
+func migrateFanOutChildV0(child, fanOut map[string]interface{}) error {
+	correlationID, _ := fanOut["correlation_id"].(string)
+	if id, _ := child["correlation_id"].(string); id == "" && correlationID != "" {
+		child["correlation_id"] = correlationID
+	}
+	return nil
+}
+
+// migrateFanOutChild upgrades a child of a fan-out stored apart from its state file, from the
+// schema version the state file was written with. fanOut are the fields of the upgraded state,
+// as returned by fanOutFields. The child may already be upgraded, when the process that wrote it
+// upgraded the state without writing the state file yet, so the child migrations leave upgraded
+// children as they are.
+func migrateFanOutChild(data []byte, version int, fanOut map[string]interface{}) ([]byte, error) {
+	if version >= FanOutStateSchemaVersion {
+		return data, nil
+	}
+	child, err := decodeGenericJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	for ; version < FanOutStateSchemaVersion; version++ {
+		if migration := fanOutChildMigrations[version]; migration != nil {
+			if err := migration(child, fanOut); err != nil {
+				return nil, fmt.Errorf("failed to migrate child from schema version %d: %v", version, err)
+			}
+		}
+	}
+	return json.Marshal(child)
+}
+
+// fanOutFields returns the fields of a fan-out state but its children as generic JSON, for the
+// child migrations. The state must not be shared yet.
+func fanOutFields(state *FanOutState) (map[string]interface{}, error) {
+	children := state.Children
+	state.Children = nil
+	data, err := json.Marshal(state)
+	state.Children = children
+	if err != nil {
+		return nil, err
+	}
+	return decodeGenericJSON(data)
+}
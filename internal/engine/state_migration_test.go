@@ -0,0 +1,251 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// copyStateFixture copies a state fixture of testdata/states to file.
+func copyStateFixture(t *testing.T, fixture, file string) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "states", fixture))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatalf("failed to write fixture: %v", err)
+	}
+}
+
+func TestStateMigrations_CoverEverySchemaVersion(t *testing.T) {
+	for _, kind := range []struct {
+		name       string
+		version    int
+		migrations []stateMigration
+	}{
+		{"execution", ExecutionStateSchemaVersion, executionStateMigrations},
+		{"fanout", FanOutStateSchemaVersion, fanOutStateMigrations},
+	} {
+		if len(kind.migrations) != kind.version {
+			t.Errorf("expected a migration to each of the %d schema versions of %s states, got %d", kind.version, kind.name, len(kind.migrations))
+		}
+		for version := 0; version <= kind.version; version++ {
+			fixtures, _ := filepath.Glob(filepath.Join("testdata", "states", fmt.Sprintf("%s-v%d*.json", kind.name, version)))
+			if len(fixtures) == 0 {
+				t.Errorf("expected a fixture of schema version %d of %s states", version, kind.name)
+			}
+		}
+	}
+}
+
+func TestLoadExecutionState_MigratesFixtures(t *testing.T) {
+	tests := []struct {
+		fixture       string
+		runID         string
+		correlationID string
+		check         func(t *testing.T, state *ExecutionState)
+	}{
+		{
+			fixture:       "execution-v0.json",
+			runID:         "exec-20240105-093000-1a2b3c4d",
+			correlationID: "exec-20240105-093000-1a2b3c4d",
+			check: func(t *testing.T, state *ExecutionState) {
+				if state.GetStepOutputs("build")["artifact"] != "lib-1.2.0.tar.gz" || !state.IsResumable() {
+					t.Errorf("expected the steps to be kept, got %+v", state.Steps)
+				}
+			},
+		},
+		{
+			fixture:       "execution-v1.json",
+			runID:         "exec-20261016-101500-5e6f7a8b",
+			correlationID: "exec-20261016-101400-9c0d1e2f",
+			check: func(t *testing.T, state *ExecutionState) {
+				if !state.WaitingForApproval() || state.OwnerPID != 4242 || state.Namespace != "team-a" || len(state.Lineage) != 1 {
+					t.Errorf("expected the state to be loaded as it is, got %+v", state)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			workspaceRoot := t.TempDir()
+			stateFile := filepath.Join(workspaceRoot, "state", "execution.json")
+			copyStateFixture(t, tt.fixture, stateFile)
+
+			state, err := LoadExecutionState(tt.runID, workspaceRoot)
+			if err != nil {
+				t.Fatalf("LoadExecutionState() error = %v", err)
+			}
+			if state.SchemaVersion != ExecutionStateSchemaVersion || state.CorrelationID != tt.correlationID {
+				t.Errorf("expected schema version %d with correlation ID %s, got %d with %s", ExecutionStateSchemaVersion, tt.correlationID, state.SchemaVersion, state.CorrelationID)
+			}
+			tt.check(t, state)
+
+			// The upgraded state is written back by the next update
+			resumed, err := NewExecutionState(tt.runID, workspaceRoot)
+			if err != nil {
+				t.Fatalf("NewExecutionState() error = %v", err)
+			}
+			if err := resumed.AddChildRun("exec-child"); err != nil {
+				t.Fatalf("AddChildRun() error = %v", err)
+			}
+			data, err := os.ReadFile(stateFile)
+			if err != nil {
+				t.Fatalf("failed to read state file: %v", err)
+			}
+			if !strings.Contains(string(data), fmt.Sprintf(`"schema_version": %d`, ExecutionStateSchemaVersion)) {
+				t.Errorf("expected the state to be written with the latest schema version:\n%s", data)
+			}
+		})
+	}
+}
+
+// copyFanOutFixture copies a fan-out state fixture of testdata/states to a state directory as
+// the state of id, along with the shards and journal of the fixture, if any.
+func copyFanOutFixture(t *testing.T, fixture, stateDir, id string) {
+	t.Helper()
+	copyStateFixture(t, fixture+".json", filepath.Join(stateDir, id+".json"))
+	if _, err := os.Stat(filepath.Join("testdata", "states", fixture+".journal")); err == nil {
+		copyStateFixture(t, fixture+".journal", filepath.Join(stateDir, id+".journal"))
+	}
+	shards, _ := os.ReadDir(filepath.Join("testdata", "states", "shards", fixture))
+	for _, shard := range shards {
+		copyStateFixture(t, filepath.Join("shards", fixture, shard.Name()), filepath.Join(stateDir, "shards", id, shard.Name()))
+	}
+}
+
+func TestFanOutStateManager_MigratesFixtures(t *testing.T) {
+	stateDir := t.TempDir()
+	fixtures := map[string]string{
+		"fanout-v0":            "fanout-1704447000000000000",
+		"fanout-v0-correlated": "fanout-1760000000000000000",
+		"fanout-v0-sharded":    "fanout-1760300000000000000",
+		"fanout-v0-compact":    "fanout-1760425200000000000",
+		"fanout-v1":            "fanout-1760609700000000000",
+	}
+	for fixture, id := range fixtures {
+		copyFanOutFixture(t, fixture, stateDir, id)
+	}
+
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	load := func(fixture string) *FanOutState {
+		t.Helper()
+		state, err := sm.GetFanOutState(fixtures[fixture])
+		if err != nil {
+			t.Fatalf("GetFanOutState(%s) error = %v", fixture, err)
+		}
+		if state.SchemaVersion != FanOutStateSchemaVersion {
+			t.Errorf("expected %s to be upgraded to schema version %d, got %d", fixture, FanOutStateSchemaVersion, state.SchemaVersion)
+		}
+		return state
+	}
+	correlated := func(t *testing.T, state *FanOutState, want int) {
+		t.Helper()
+		children := state.GetChildren()
+		if len(children) != want {
+			t.Fatalf("expected %d children, got %d", want, len(children))
+		}
+		for _, child := range children {
+			if child.CorrelationID != state.CorrelationID {
+				t.Errorf("expected %s to be given the correlation ID of the fan-out, got %q", child.Repository, child.CorrelationID)
+			}
+		}
+	}
+
+	original := load("fanout-v0")
+	if summary := original.GetSummary(); summary.TotalChildren != 2 || summary.FailedChildren != 1 || original.Timeout != time.Hour {
+		t.Errorf("expected the children and timeout to be kept, got %+v with %v", summary, original.Timeout)
+	}
+
+	state := load("fanout-v0-correlated")
+	if state.Revision != 7 || state.OwnerPID != 31337 {
+		t.Errorf("expected the revision and owner to be kept, got %d and %d", state.Revision, state.OwnerPID)
+	}
+	children := state.GetChildren()
+	if children[0].CorrelationID != state.CorrelationID || children[1].CorrelationID != "exec-20261009-080000-0f0f0f0f" {
+		t.Errorf("expected the children without a correlation ID to be given the one of the fan-out, got %s and %s", children[0].CorrelationID, children[1].CorrelationID)
+	}
+	if events, err := state.GetEvents(); err != nil || len(events) != 1 || events[0].Payload["version"] != "1.3.0" {
+		t.Errorf("expected the events to be kept, got %+v, %v", events, err)
+	}
+
+	// The children of shards and journals are upgraded like those of the state files
+	sharded := load("fanout-v0-sharded")
+	correlated(t, sharded, 3)
+	if got := sharded.GetChildStatus("test-org/app-3", "update"); got != ChildStatusFailed {
+		t.Errorf("expected the journaled status of app-3 to be replayed, got %q", got)
+	}
+
+	compact := load("fanout-v0-compact")
+	correlated(t, compact, 2)
+	if children := compact.GetChildren(); children[0].Outputs["image"] != "app-1:1.5.0" || children[1].ErrorMessage != "tests failed" {
+		t.Errorf("expected the details of the compact children to be kept, got %+v", children)
+	}
+
+	if current := load("fanout-v1"); !current.ChildShards || current.Children == nil || current.Namespace != "team-a" {
+		t.Errorf("expected the sharded state to be loaded as it is, got %+v", current)
+	}
+}
+
+func TestFanOutStateManager_WritesUpgradedShards(t *testing.T) {
+	stateDir := t.TempDir()
+	id := "fanout-1760300000000000000"
+	copyFanOutFixture(t, "fanout-v0-sharded", stateDir, id)
+
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	state, err := sm.GetFanOutState(id)
+	if err != nil {
+		t.Fatalf("GetFanOutState() error = %v", err)
+	}
+	if err := state.UpdateChildStatus("test-org/app-2", "update", ChildStatusCompleted, "", ""); err != nil {
+		t.Fatalf("UpdateChildStatus() error = %v", err)
+	}
+
+	// Every shard is written upgraded with the state, whose file is then of the latest version
+	for _, childID := range []string{"test-org/app-1-update", "test-org/app-2-update", "test-org/app-3-update"} {
+		data, err := os.ReadFile(sm.shardFile(id, childID))
+		if err != nil {
+			t.Fatalf("failed to read shard: %v", err)
+		}
+		if !strings.Contains(string(data), state.CorrelationID) {
+			t.Errorf("expected the shard of %s to be written upgraded:\n%s", childID, data)
+		}
+	}
+	if onDisk := readStateFileForTest(t, stateDir, id); onDisk.SchemaVersion != FanOutStateSchemaVersion {
+		t.Errorf("expected the state file to be written with the latest schema version, got %d", onDisk.SchemaVersion)
+	}
+}
+
+func TestStateMigrations_RejectNewerSchemaVersions(t *testing.T) {
+	workspaceRoot := t.TempDir()
+	stateFile := filepath.Join(workspaceRoot, "state", "execution.json")
+	os.MkdirAll(filepath.Dir(stateFile), 0755)
+	os.WriteFile(stateFile, []byte(`{"run_id": "exec-future", "schema_version": 99}`), 0644)
+	if _, err := LoadExecutionState("exec-future", workspaceRoot); err == nil || !strings.Contains(err.Error(), "schema version 99") {
+		t.Errorf("expected an execution state of a newer schema version to fail, got %v", err)
+	}
+
+	stateDir := t.TempDir()
+	os.WriteFile(filepath.Join(stateDir, "fanout-future.json"), []byte(`{"id": "fanout-future", "schema_version": 99}`), 0644)
+	sm, err := NewFanOutStateManager(stateDir)
+	if err != nil {
+		t.Fatalf("NewFanOutStateManager() error = %v", err)
+	}
+	if _, err := sm.GetFanOutState("fanout-future"); err == nil {
+		t.Errorf("expected a fan-out state of a newer schema version not to be loaded")
+	}
+}
@@ -0,0 +1,170 @@
+package engine
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// stepCacheEntryFile is the file of a step cache entry recording what a hit restores.
+const stepCacheEntryFile = "entry.json"
+
+// stepCacheEntry is the result of a successful run of a cached step, restored by the later
+// runs of the step with the same key. The paths are stored under the paths directory of the
+// entry.
+type stepCacheEntry struct {
+	Key       string            `json:"key"`
+	Output    string            `json:"output,omitempty"`
+	Outputs   map[string]string `json:"outputs,omitempty"`
+	Paths     []string          `json:"paths,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// stepCacheDir returns the directory of the cache entry of a step of the running workflow's
+// repository for a key.
+func (r *Runner) stepCacheDir(stepID, key string) string {
+	digest := sha256.Sum256([]byte(r.repoPath + "\x00" + stepID + "\x00" + key))
+	return filepath.Join(r.getCacheDir(), "steps", hex.EncodeToString(digest[:]))
+}
+
+// restoreStepCache looks up the cache of a step. On a hit, it restores the cached paths into
+// the repository, records the step as completed and returns its cached result with done set.
+// It returns the expanded key, empty when the step is not cached, for the step to be stored
+// under once it succeeds. Entries that cannot be read or restored count as misses.
+func (r *Runner) restoreStepCache(step config.WorkflowStep, stepID, workDir string, inputs map[string]string, stepOutputs map[string]map[string]string, startTime time.Time) (string, StepResult, bool, error) {
+	if step.Cache == nil {
+		return "", StepResult{}, false, nil
+	}
+
+	key, err := r.expandTemplate(step.Cache.Key, inputs, stepOutputs)
+	if err != nil {
+		err = fmt.Errorf("failed to expand cache key: %v", err)
+		r.state.FailStep(stepID, err.Error())
+		return "", StepResult{
+			ID:        stepID,
+			Success:   false,
+			Error:     err,
+			StartTime: startTime,
+			EndTime:   r.now(),
+		}, true, err
+	}
+	// A key without content, such as the digest of no file, does not identify anything
+	if strings.TrimSpace(key) == "" {
+		slog.Debug("cache key of step is empty, running it uncached", "step", stepID)
+		return "", StepResult{}, false, nil
+	}
+
+	dir := r.stepCacheDir(stepID, key)
+	data, err := os.ReadFile(filepath.Join(dir, stepCacheEntryFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("failed to read step cache entry", "step", stepID, "error", err)
+		}
+		return key, StepResult{}, false, nil
+	}
+	var entry stepCacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key {
+		slog.Warn("ignoring invalid step cache entry", "step", stepID, "dir", dir)
+		return key, StepResult{}, false, nil
+	}
+	for _, cachePath := range entry.Paths {
+		if err := restoreCachedPath(filepath.Join(dir, "paths", cachePath), filepath.Join(workDir, cachePath)); err != nil {
+			slog.Warn("failed to restore cached path, running step", "step", stepID, "path", cachePath, "error", err)
+			return key, StepResult{}, false, nil
+		}
+	}
+
+	r.state.CompleteStep(stepID, entry.Output, entry.Outputs)
+	return key, StepResult{
+		ID:        stepID,
+		Success:   true,
+		Cached:    true,
+		StartTime: startTime,
+		EndTime:   r.now(),
+		Output:    entry.Output,
+		Outputs:   entry.Outputs,
+	}, true, nil
+}
+
+// saveStepCache stores the result of a successful run of a step, with the paths of its cache
+// that exist, under a key. The entry replaces any prior one as a whole.
+func (r *Runner) saveStepCache(step config.WorkflowStep, stepID, key, workDir string, result StepResult) error {
+	stepsDir := filepath.Join(r.getCacheDir(), "steps")
+	if err := os.MkdirAll(stepsDir, 0755); err != nil {
+		return err
+	}
+	tmpDir, err := os.MkdirTemp(stepsDir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	entry := stepCacheEntry{
+		Key:       key,
+		Output:    result.Output,
+		Outputs:   result.Outputs,
+		CreatedAt: r.now(),
+	}
+	for _, cachePath := range step.Cache.Paths {
+		src := filepath.Join(workDir, cachePath)
+		if _, err := os.Lstat(src); os.IsNotExist(err) {
+			continue // Steps may not produce all of their paths
+		}
+		if err := copyCachedPath(src, filepath.Join(tmpDir, "paths", cachePath)); err != nil {
+			return fmt.Errorf("failed to cache '%s': %v", cachePath, err)
+		}
+		entry.Paths = append(entry.Paths, cachePath)
+	}
+
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, stepCacheEntryFile), data, 0644); err != nil {
+		return err
+	}
+
+	dir := r.stepCacheDir(stepID, key)
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return os.Rename(tmpDir, dir)
+}
+
+// copyCachedPath copies a file or directory tree.
+func copyCachedPath(src, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return copyTree(src, dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	}
+	return copyFile(src, dst)
+}
+
+// restoreCachedPath replaces a file or directory tree of the repository with its cached copy.
+func restoreCachedPath(src, dst string) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	return copyCachedPath(src, dst)
+}
@@ -0,0 +1,138 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunnerStepCache(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - id: compile
+        run: |
+          echo run >> runs.log
+          mkdir -p out
+          echo "built $(cat go.sum)" > out/bin
+          echo "digest-$(cat go.sum)"
+        cache:
+          key: 'compile-{{ hashFiles "go.sum" }}'
+          paths: [out]
+        produces:
+          outputs:
+            digest: from_stdout
+      - id: use
+        run: echo "{{ .Steps.compile.digest }}"
+        produces:
+          outputs:
+            digest: from_stdout
+`
+	files := map[string]string{"tako.yml": content, "go.sum": "v1"}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tempDir, name), []byte(data), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+	}
+
+	run := func() *ExecutionResult {
+		t.Helper()
+		runner, err := NewRunner(RunnerOptions{
+			WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+			CacheDir:      filepath.Join(tempDir, "cache"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create runner: %v", err)
+		}
+		defer runner.Close()
+		result, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir)
+		if err != nil {
+			t.Fatalf("Workflow failed: %v", err)
+		}
+		return result
+	}
+	runs := func() int {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(tempDir, "runs.log"))
+		if err != nil {
+			t.Fatalf("Failed to read runs.log: %v", err)
+		}
+		return strings.Count(string(data), "run")
+	}
+
+	// The first run populates the cache
+	result := run()
+	if result.Steps[0].Cached || runs() != 1 {
+		t.Fatalf("Expected the first run to execute the step, got cached=%v and %d runs", result.Steps[0].Cached, runs())
+	}
+
+	// The second run restores the outputs and paths without running the step
+	if err := os.RemoveAll(filepath.Join(tempDir, "out")); err != nil {
+		t.Fatalf("Failed to remove out: %v", err)
+	}
+	result = run()
+	if !result.Steps[0].Cached || runs() != 1 {
+		t.Errorf("Expected the second run to be restored from the cache, got cached=%v and %d runs", result.Steps[0].Cached, runs())
+	}
+	if digest := result.Steps[1].Outputs["digest"]; digest != "digest-v1" {
+		t.Errorf("Expected later steps to see the cached outputs, got %q", digest)
+	}
+	if data, err := os.ReadFile(filepath.Join(tempDir, "out", "bin")); err != nil || strings.TrimSpace(string(data)) != "built v1" {
+		t.Errorf("Expected the cached paths to be restored, got %q, %v", data, err)
+	}
+
+	// Changing the hashed files changes the key
+	if err := os.WriteFile(filepath.Join(tempDir, "go.sum"), []byte("v2"), 0644); err != nil {
+		t.Fatalf("Failed to update go.sum: %v", err)
+	}
+	result = run()
+	if result.Steps[0].Cached || runs() != 2 {
+		t.Errorf("Expected a new key to run the step, got cached=%v and %d runs", result.Steps[0].Cached, runs())
+	}
+	if digest := result.Steps[1].Outputs["digest"]; digest != "digest-v2" {
+		t.Errorf("Expected the new outputs, got %q", digest)
+	}
+}
+
+func TestRunnerStepCacheFailedStep(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  build:
+    steps:
+      - id: flaky
+        run: echo run >> runs.log; exit 1
+        cache:
+          key: flaky
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		runner, err := NewRunner(RunnerOptions{
+			WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+			CacheDir:      filepath.Join(tempDir, "cache"),
+		})
+		if err != nil {
+			t.Fatalf("Failed to create runner: %v", err)
+		}
+		if _, err := runner.ExecuteWorkflow(context.Background(), "build", nil, tempDir); err == nil {
+			t.Error("Expected the workflow to fail")
+		}
+		runner.Close()
+	}
+
+	// Failed runs are not cached
+	data, err := os.ReadFile(filepath.Join(tempDir, "runs.log"))
+	if err != nil {
+		t.Fatalf("Failed to read runs.log: %v", err)
+	}
+	if runs := strings.Count(string(data), "run"); runs != 2 {
+		t.Errorf("Expected the failed step to run twice, got %d runs", runs)
+	}
+}
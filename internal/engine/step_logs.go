@@ -0,0 +1,467 @@
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Default limits of the capture of step output.
+const (
+	DefaultStepLogMaxSize  = 10 * 1024 * 1024 // 10MB per log file
+	DefaultStepLogMaxFiles = 4                // Rotated files kept per step
+	DefaultStepOutputTail  = 64 * 1024        // 64KB of output kept in StepResult.Output
+
+	// maxCapturedOutputs is how much of the end of stdout and stderr is kept in memory for the
+	// steps that produce outputs from them.
+	maxCapturedOutputs = 1024 * 1024 // 1MB
+)
+
+// LogOptions configures the capture of the output of steps. The stdout and stderr of shell and
+// container steps are streamed to a log file per step in the logs directory of the run's
+// workspace, and only the end of the output is kept in memory.
+type LogOptions struct {
+	// MaxFileSize is the size at which a step log is rotated; DefaultStepLogMaxSize when zero
+	MaxFileSize int64
+	// MaxFiles is the number of rotated files kept per step, besides the current one; older
+	// output is dropped. DefaultStepLogMaxFiles when zero.
+	MaxFiles int
+	// OutputTail is how many bytes of the end of the output StepResult.Output keeps;
+	// DefaultStepOutputTail when zero
+	OutputTail int
+	// Follow receives the output of steps as they run, line by line, each line prefixed with
+	// the repository and step it comes from; nil to only log it. Child runs share it.
+	Follow io.Writer
+}
+
+// withDefaults returns the options with the defaults of the unset limits.
+func (o LogOptions) withDefaults() LogOptions {
+	if o.MaxFileSize <= 0 {
+		o.MaxFileSize = DefaultStepLogMaxSize
+	}
+	if o.MaxFiles <= 0 {
+		o.MaxFiles = DefaultStepLogMaxFiles
+	}
+	if o.OutputTail <= 0 {
+		o.OutputTail = DefaultStepOutputTail
+	}
+	// Steps running in parallel, and child runs, write to the same output
+	if _, ok := o.Follow.(*lockedWriter); o.Follow != nil && !ok {
+		o.Follow = &lockedWriter{w: o.Follow}
+	}
+	return o
+}
+
+// stepLogName returns the name of the log file of a step. Characters that cannot appear in file
+// names are replaced.
+func stepLogName(stepID string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		default:
+			return '_'
+		}
+	}, stepID)
+	return strings.TrimLeft(name, ".") + ".log"
+}
+
+// stepLog is the log file of a step, rotated when it reaches its maximum size: step.log is
+// renamed to step.log.1, step.log.1 to step.log.2, and so on. Writes never fail, so that a full
+// disk does not fail the step; the first error is reported when the log is closed.
+type stepLog struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	err      error
+	mu       sync.Mutex
+}
+
+// openStepLog creates the log of a step in a directory, replacing any previous one.
+func openStepLog(dir, stepID string, opts LogOptions) (*stepLog, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create log directory: %v", err)
+	}
+	path := filepath.Join(dir, stepLogName(stepID))
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create step log: %v", err)
+	}
+	return &stepLog{path: path, maxSize: opts.MaxFileSize, maxFiles: opts.MaxFiles, file: file}, nil
+}
+
+// Write appends to the log, rotating it first when the write would go over its maximum size.
+func (l *stepLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return len(p), nil
+	}
+	if l.size > 0 && l.size+int64(len(p)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.fail(err)
+			return len(p), nil
+		}
+	}
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	if err != nil {
+		l.fail(err)
+	}
+	return len(p), nil
+}
+
+// rotate moves the current file to step.log.1, shifting the older ones, and starts a new one.
+func (l *stepLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	_ = os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+	for i := l.maxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(fmt.Sprintf("%s.%d", l.path, i), fmt.Sprintf("%s.%d", l.path, i+1)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil {
+		return err
+	}
+	file, err := os.Create(l.path)
+	if err != nil {
+		return err
+	}
+	l.file = file
+	l.size = 0
+	return nil
+}
+
+// fail records the first error of the log and stops writing to it.
+func (l *stepLog) fail(err error) {
+	if l.err == nil {
+		l.err = fmt.Errorf("failed to write step log %s: %v", l.path, err)
+	}
+	if l.file != nil {
+		_ = l.file.Close()
+		l.file = nil
+	}
+}
+
+// Close closes the log, returning the first error writing to it.
+func (l *stepLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file != nil {
+		if err := l.file.Close(); err != nil && l.err == nil {
+			l.err = err
+		}
+		l.file = nil
+	}
+	return l.err
+}
+
+// tailBuffer keeps the last bytes written to it, up to a limit.
+type tailBuffer struct {
+	limit   int
+	buf     []byte
+	dropped int64 // Bytes written before those kept
+}
+
+// Write appends to the buffer, dropping the oldest bytes over the limit.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+	// Compacted once the buffer holds twice the limit, to copy the kept bytes less often
+	if len(b.buf) > 2*b.limit {
+		drop := len(b.buf) - b.limit
+		b.dropped += int64(drop)
+		b.buf = append(b.buf[:0], b.buf[drop:]...)
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept, at most limit of them.
+func (b *tailBuffer) String() string {
+	return string(b.tail(b.limit))
+}
+
+// tail returns the last n bytes written, or fewer if the buffer does not keep them.
+func (b *tailBuffer) tail(n int) []byte {
+	if len(b.buf) > n {
+		return b.buf[len(b.buf)-n:]
+	}
+	return b.buf
+}
+
+// truncated returns how many of the bytes written are not among the last n.
+func (b *tailBuffer) truncated(n int) int64 {
+	return b.dropped + int64(len(b.buf)-len(b.tail(n)))
+}
+
+// stepOutput captures the output of a step: stdout and stderr are streamed, interleaved, to
+// the step log, and the end of each is kept in memory for the step result and outputs.
+type stepOutput struct {
+	log    *stepLog    // Nil when the log could not be created
+	follow *lineWriter // Nil when the output is not followed
+	stdout *tailBuffer
+	stderr *tailBuffer
+	tail   int
+}
+
+// newStepOutput starts the capture of the output of a step. The end of stdout and stderr is
+// kept up to the output tail, or more for steps producing outputs from them. When the log
+// cannot be created, the output is only kept in memory. Followed output is prefixed with
+// label.
+func newStepOutput(logDir, stepID, label string, opts LogOptions, producesOutputs bool) *stepOutput {
+	capture := opts.OutputTail
+	if producesOutputs && capture < maxCapturedOutputs {
+		capture = maxCapturedOutputs
+	}
+	output := &stepOutput{
+		stdout: &tailBuffer{limit: capture},
+		stderr: &tailBuffer{limit: capture},
+		tail:   opts.OutputTail,
+	}
+	if opts.Follow != nil {
+		output.follow = &lineWriter{out: opts.Follow, prefix: label + " | ", limit: opts.OutputTail}
+	}
+	log, err := openStepLog(logDir, stepID, opts)
+	if err != nil {
+		slog.Warn("step output is not logged", "step", stepID, "error", err)
+		return output
+	}
+	output.log = log
+	return output
+}
+
+// Stdout returns the writer of the stdout of the step.
+func (o *stepOutput) Stdout() io.Writer {
+	return o.writer(o.stdout)
+}
+
+// Stderr returns the writer of the stderr of the step.
+func (o *stepOutput) Stderr() io.Writer {
+	return o.writer(o.stderr)
+}
+
+// writer returns the writer of a stream of the step, writing to its buffer, the log and the
+// followed output.
+func (o *stepOutput) writer(buffer *tailBuffer) io.Writer {
+	writers := []io.Writer{buffer}
+	if o.log != nil {
+		writers = append(writers, o.log)
+	}
+	if o.follow != nil {
+		writers = append(writers, o.follow)
+	}
+	if len(writers) == 1 {
+		return buffer
+	}
+	return io.MultiWriter(writers...)
+}
+
+// Output returns the end of stdout, up to the output tail, noting the bytes left out.
+func (o *stepOutput) Output() string {
+	return tailString(o.stdout, o.tail)
+}
+
+// ErrorOutput returns the end of stderr, up to the output tail, noting the bytes left out.
+func (o *stepOutput) ErrorOutput() string {
+	return tailString(o.stderr, o.tail)
+}
+
+// Close ends the capture, logging the errors writing the step log.
+func (o *stepOutput) Close() {
+	if o.follow != nil {
+		o.follow.Flush()
+	}
+	if o.log == nil {
+		return
+	}
+	if err := o.log.Close(); err != nil {
+		slog.Warn("step log is incomplete", "error", err)
+	}
+}
+
+// lineWriter writes complete lines to an output, each preceded by a prefix, so that the lines
+// of steps writing to the same output are not mixed up. Lines longer than the limit are cut,
+// so that output without newlines is not held in memory. Writes never fail, so that a closed
+// output does not fail the step.
+type lineWriter struct {
+	out        io.Writer
+	prefix     string
+	limit      int    // Maximum length of a line, or zero for no limit
+	partial    []byte // Start of a line not yet written
+	discarding bool   // Whether the rest of a cut line is dropped until its newline
+	mu         sync.Mutex
+}
+
+// Write writes the complete lines of p, keeping the end of the last one for the next write.
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, p...)
+	var lines []byte
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		if w.discarding {
+			w.discarding = false
+		} else {
+			lines = append(lines, w.prefix...)
+			lines = append(lines, w.partial[:i+1]...)
+		}
+		w.partial = w.partial[i+1:]
+	}
+	if w.discarding {
+		w.partial = nil
+	} else if w.limit > 0 && len(w.partial) > w.limit {
+		lines = append(lines, w.prefix...)
+		lines = append(lines, w.partial[:w.limit]...)
+		lines = append(lines, " [line truncated]\n"...)
+		w.partial = nil
+		w.discarding = true
+	}
+	if len(lines) > 0 {
+		_, _ = w.out.Write(lines)
+	}
+	return len(p), nil
+}
+
+// Flush writes the last line, when the output did not end with a newline.
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.partial) > 0 {
+		_, _ = w.out.Write([]byte(w.prefix + string(w.partial) + "\n"))
+	}
+	w.partial = nil
+	w.discarding = false
+}
+
+// lockedWriter serializes the writes to a writer.
+type lockedWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+// Write writes p to the writer, waiting for the other writes to complete.
+func (w *lockedWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
+}
+
+// tailString returns the last n bytes of a buffer, preceded by a note of how many were left
+// out, if any.
+func tailString(b *tailBuffer, n int) string {
+	if truncated := b.truncated(n); truncated > 0 {
+		return fmt.Sprintf("[%d bytes truncated]\n%s", truncated, b.tail(n))
+	}
+	return string(b.tail(n))
+}
+
+// StepLogFiles returns the log files of a step in a logs directory, oldest first: the rotated
+// files, then the current one. It fails when the step has no log.
+func StepLogFiles(logDir, stepID string) ([]string, error) {
+	path := filepath.Join(logDir, stepLogName(stepID))
+	if _, err := os.Stat(path); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no log of step '%s' in %s", stepID, logDir)
+		}
+		return nil, err
+	}
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	index := func(file string) int {
+		i, _ := strconv.Atoi(strings.TrimPrefix(file, path+"."))
+		return i
+	}
+	sort.Slice(rotated, func(i, j int) bool { return index(rotated[i]) > index(rotated[j]) })
+	return append(rotated, path), nil
+}
+
+// ListStepLogs returns the names of the step logs of a logs directory, without their .log
+// extension, in the order the steps last wrote to them.
+func ListStepLogs(logDir string) ([]string, error) {
+	entries, err := os.ReadDir(logDir)
+	if err != nil {
+		return nil, err
+	}
+	type stepLogEntry struct {
+		name    string
+		modTime int64
+	}
+	var logs []stepLogEntry
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".log") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		logs = append(logs, stepLogEntry{strings.TrimSuffix(entry.Name(), ".log"), info.ModTime().UnixNano()})
+	}
+	sort.SliceStable(logs, func(i, j int) bool { return logs[i].modTime < logs[j].modTime })
+	names := make([]string, 0, len(logs))
+	for _, log := range logs {
+		names = append(names, log.name)
+	}
+	return names, nil
+}
+
+// OpenStepLog returns the full log of a step in a logs directory, including its rotated files.
+func OpenStepLog(logDir, stepID string) (io.ReadCloser, error) {
+	paths, err := StepLogFiles(logDir, stepID)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*os.File, 0, len(paths))
+	readers := make([]io.Reader, 0, len(paths))
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			for _, f := range files {
+				_ = f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, file)
+		readers = append(readers, file)
+	}
+	return &multiFileReader{Reader: io.MultiReader(readers...), files: files}, nil
+}
+
+// multiFileReader reads files one after the other.
+type multiFileReader struct {
+	io.Reader
+	files []*os.File
+}
+
+// Close closes all the files.
+func (r *multiFileReader) Close() error {
+	var err error
+	for _, file := range r.files {
+		if closeErr := file.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,246 @@
+package engine
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStepLog_Rotation(t *testing.T) {
+	logDir := t.TempDir()
+	log, err := openStepLog(logDir, "build", LogOptions{MaxFileSize: 10, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := log.Write([]byte(line)); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+	if err := log.Close(); err != nil {
+		t.Fatalf("failed to close log: %v", err)
+	}
+
+	files, err := StepLogFiles(logDir, "build")
+	if err != nil {
+		t.Fatalf("failed to list log files: %v", err)
+	}
+	want := []string{"build.log.2", "build.log.1", "build.log"}
+	if len(files) != len(want) {
+		t.Fatalf("expected files %v, got %v", want, files)
+	}
+	for i, file := range files {
+		if filepath.Base(file) != want[i] {
+			t.Errorf("expected files %v, got %v", want, files)
+		}
+	}
+
+	// The oldest output is dropped past the rotated files kept
+	reader, err := OpenStepLog(logDir, "build")
+	if err != nil {
+		t.Fatalf("failed to open log: %v", err)
+	}
+	defer reader.Close()
+	content, err := io.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if string(content) != "second\nthird\nfourth\n" {
+		t.Errorf("unexpected log content %q", content)
+	}
+
+	if _, err := OpenStepLog(logDir, "test"); err == nil || !strings.Contains(err.Error(), "no log of step 'test'") {
+		t.Errorf("expected an error for a step without log, got %v", err)
+	}
+}
+
+func TestStepOutput_Tail(t *testing.T) {
+	logDir := t.TempDir()
+	output := newStepOutput(logDir, "build/linux", "app/build", LogOptions{OutputTail: 4}.withDefaults(), false)
+	if _, err := io.WriteString(output.Stdout(), "0123456789"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	if _, err := io.WriteString(output.Stderr(), "err"); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+	output.Close()
+
+	if got := output.Output(); got != "[6 bytes truncated]\n6789" {
+		t.Errorf("unexpected output %q", got)
+	}
+	if got := output.ErrorOutput(); got != "err" {
+		t.Errorf("unexpected error output %q", got)
+	}
+
+	logs, err := ListStepLogs(logDir)
+	if err != nil {
+		t.Fatalf("failed to list logs: %v", err)
+	}
+	if len(logs) != 1 || logs[0] != "build_linux" {
+		t.Fatalf("unexpected logs %v", logs)
+	}
+	content, err := os.ReadFile(filepath.Join(logDir, "build_linux.log"))
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if string(content) != "0123456789err" {
+		t.Errorf("unexpected log content %q", content)
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	b := &tailBuffer{limit: 3}
+	for _, s := range []string{"ab", "cd", "ef", "g"} {
+		_, _ = b.Write([]byte(s))
+	}
+	if b.String() != "efg" {
+		t.Errorf("expected the last bytes, got %q", b.String())
+	}
+	if b.truncated(3) != 4 || b.truncated(2) != 5 {
+		t.Errorf("unexpected truncated counts %d and %d", b.truncated(3), b.truncated(2))
+	}
+}
+
+func TestRunnerStepLogs(t *testing.T) {
+	tempDir := t.TempDir()
+	content := `version: 0.1.0
+workflows:
+  test:
+    steps:
+      - id: build
+        run: for i in 1 2 3 4 5; do echo "line $i"; done
+      - id: version
+        run: echo "1.2.3"
+        produces:
+          outputs:
+            version: from_stdout
+`
+	if err := os.WriteFile(filepath.Join(tempDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	cacheDir := filepath.Join(tempDir, "cache")
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      cacheDir,
+		Environment:   []string{},
+		Logs:          LogOptions{OutputTail: 7},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	result, err := runner.ExecuteWorkflow(context.Background(), "test", nil, tempDir)
+	if err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	if got := result.Steps[0].Output; got != "[28 bytes truncated]\nline 5\n" {
+		t.Errorf("expected the tail of the output, got %q", got)
+	}
+	// Outputs are extracted from the full output, not its tail
+	if got := result.Steps[1].Outputs["version"]; strings.TrimSpace(got) != "1.2.3" {
+		t.Errorf("expected the version output, got %q", got)
+	}
+
+	history, err := NewHistoryStore(cacheDir)
+	if err != nil {
+		t.Fatalf("failed to open history: %v", err)
+	}
+	record, err := history.Get(result.RunID)
+	if err != nil || record == nil {
+		t.Fatalf("expected a history record, got %v, %v", record, err)
+	}
+	if record.LogDir == "" {
+		t.Fatal("expected the log directory in the history record")
+	}
+	log, err := OpenStepLog(record.LogDir, "build")
+	if err != nil {
+		t.Fatalf("failed to open the log of the step: %v", err)
+	}
+	defer log.Close()
+	full, err := io.ReadAll(log)
+	if err != nil {
+		t.Fatalf("failed to read log: %v", err)
+	}
+	if string(full) != "line 1\nline 2\nline 3\nline 4\nline 5\n" {
+		t.Errorf("expected the full output in the log, got %q", full)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var out strings.Builder
+	w := &lineWriter{out: &out, prefix: "org/app/build | "}
+	for _, s := range []string{"com", "piling\nlinking\nd", "one"} {
+		_, _ = w.Write([]byte(s))
+	}
+	if out.String() != "org/app/build | compiling\norg/app/build | linking\n" {
+		t.Errorf("expected only the complete lines, got %q", out.String())
+	}
+	w.Flush()
+	if !strings.HasSuffix(out.String(), "org/app/build | done\n") {
+		t.Errorf("expected the last line once flushed, got %q", out.String())
+	}
+}
+
+func TestLineWriter_LongLine(t *testing.T) {
+	var out strings.Builder
+	w := &lineWriter{out: &out, prefix: "app | ", limit: 8}
+	_, _ = w.Write([]byte("short\n0123456789"))
+	for i := 0; i < 1000; i++ {
+		_, _ = w.Write([]byte("abcdefghij"))
+	}
+	if len(w.partial) != 0 {
+		t.Errorf("expected the rest of a cut line not to be kept, got %d bytes", len(w.partial))
+	}
+	_, _ = w.Write([]byte("xyz\nnext\n"))
+	w.Flush()
+
+	expected := "app | short\napp | 01234567 [line truncated]\napp | next\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestRunnerFollow(t *testing.T) {
+	tempDir := t.TempDir()
+	repoDir := filepath.Join(tempDir, "app")
+	content := `version: 0.1.0
+workflows:
+  test:
+    steps:
+      - id: build
+        run: printf 'compiling\nlinking'
+      - id: check
+        run: echo "warning" >&2
+`
+	if err := os.MkdirAll(repoDir, 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "tako.yml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test tako.yml: %v", err)
+	}
+
+	var followed strings.Builder
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Environment:   []string{},
+		Logs:          LogOptions{Follow: &followed},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	if _, err := runner.ExecuteWorkflow(context.Background(), "test", nil, repoDir); err != nil {
+		t.Fatalf("Workflow failed: %v", err)
+	}
+	expected := "app/build | compiling\napp/build | linking\napp/check | warning\n"
+	if followed.String() != expected {
+		t.Errorf("expected %q, got %q", expected, followed.String())
+	}
+}
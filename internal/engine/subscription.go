@@ -1,24 +1,30 @@
 package engine
 
 import (
+	"encoding/json"
 	"fmt"
+	"reflect"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
+	"text/template/parse"
+	"time"
 
 	"github.com/dangazineu/tako/internal/config"
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Event represents an event emitted by a fan-out step.
 type Event struct {
-	Type          string
-	SchemaVersion string
-	Payload       map[string]interface{}
-	Source        string
-	Timestamp     int64
+	Type          string                 `json:"type"`
+	SchemaVersion string                 `json:"schema_version,omitempty"`
+	Payload       map[string]interface{} `json:"payload,omitempty"`
+	Source        string                 `json:"source"`
+	Timestamp     int64                  `json:"timestamp"`
 }
 
 // celProgramCacheEntry represents a cached CEL program with metadata.
@@ -150,36 +156,102 @@ func (c *celProgramCache) removeLRU() {
 	c.removeEntry(c.tail)
 }
 
+var (
+	// templateExpressionPattern matches any {{ ... }} expression in an input mapping.
+	templateExpressionPattern = regexp.MustCompile(`\{\{.*?\}\}`)
+	// payloadFieldPattern matches the {{ .payload.field }} expressions of input mappings that are
+	// substituted without the template engine.
+	payloadFieldPattern = regexp.MustCompile(`\{\{\s*\.payload\.([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+)
+
 // SubscriptionEvaluator handles event-subscription matching and filtering.
 type SubscriptionEvaluator struct {
-	celEnv       *cel.Env
-	costLimit    uint64           // Maximum cost for CEL expression evaluation
-	programCache *celProgramCache // LRU cache for compiled CEL programs
+	celEnv         *cel.Env
+	costLimit      uint64               // Maximum cost for CEL expression evaluation
+	programCache   *celProgramCache     // LRU cache for compiled CEL programs
+	templateEngine *TemplateEngine      // Renders template-based payload transforms
+	precompiled    *SubscriptionCatalog // Checked CEL expressions of the subscriptions of the cache; nil for none
+	clock          Clock                // Clock of time.now(); the system clock when nil
 }
 
 // NewSubscriptionEvaluator creates a new subscription evaluator with security safeguards.
 func NewSubscriptionEvaluator() (*SubscriptionEvaluator, error) {
+	se := &SubscriptionEvaluator{
+		costLimit:      1000000,                 // 1M cost units - prevents complex expressions from causing DoS
+		programCache:   newCELProgramCache(100), // Cache up to 100 compiled CEL programs
+		templateEngine: NewTemplateEngineWithLimits(SubscriptionTemplateLimits()),
+	}
+	env, err := newSubscriptionCELEnv(se.now)
+	if err != nil {
+		return nil, err
+	}
+	se.celEnv = env
+	return se, nil
+}
+
+// newSubscriptionCELEnv creates the CEL environment of the filters and transforms of
+// subscriptions, with the event variables they see. time.now() reads now, or the system time
+// when now is nil.
+func newSubscriptionCELEnv(now func() time.Time) (*cel.Env, error) {
 	// Create CEL environment with security constraints
-	env, err := cel.NewEnv(
+	options := []cel.EnvOption{
 		cel.Variable("event", cel.MapType(cel.StringType, cel.DynType)),
 		cel.Variable("payload", cel.MapType(cel.StringType, cel.DynType)),
 		cel.Variable("event_type", cel.StringType),
 		cel.Variable("schema_version", cel.StringType),
 		cel.Variable("source", cel.StringType),
-	)
+	}
+	env, err := cel.NewEnv(append(options, celFunctionLibrary(now)...)...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create CEL environment: %v", err)
 	}
+	return env, nil
+}
+
+// SetPrecompiled makes the evaluator use the CEL expressions a subscription catalog checked
+// ahead of time, rather than parsing and checking them again.
+func (se *SubscriptionEvaluator) SetPrecompiled(catalog *SubscriptionCatalog) {
+	se.precompiled = catalog
+}
 
-	return &SubscriptionEvaluator{
-		celEnv:       env,
-		costLimit:    1000000,                 // 1M cost units - prevents complex expressions from causing DoS
-		programCache: newCELProgramCache(100), // Cache up to 100 compiled CEL programs
-	}, nil
+// SetClock sets the clock time.now() reads in filters.
+func (se *SubscriptionEvaluator) SetClock(clock Clock) {
+	se.clock = clock
+}
+
+// now returns the time of the evaluator's clock.
+func (se *SubscriptionEvaluator) now() time.Time {
+	return clockOrSystem(se.clock).Now()
 }
 
 // EvaluateSubscription checks if a subscription matches the specified event.
 func (se *SubscriptionEvaluator) EvaluateSubscription(subscription config.Subscription, event Event) (bool, error) {
+	evaluation, err := se.ExplainSubscription(subscription, event)
+	return evaluation.Matched, err
+}
+
+// SubscriptionEvaluation explains whether a subscription matches an event.
+type SubscriptionEvaluation struct {
+	Matched bool
+	// Reason is why the subscription does not match; empty when it matches
+	Reason string
+	// SchemaIncompatible is whether the subscription does not match because its schema_version
+	// range rejects the schema version of the event
+	SchemaIncompatible bool
+	// Filters are the results of the filters evaluated, in order, up to the first one that
+	// does not hold
+	Filters []FilterResult
+}
+
+// FilterResult is the result of the evaluation of a filter of a subscription.
+type FilterResult struct {
+	Expression string `json:"expression"`
+	Result     bool   `json:"result"`
+	Error      string `json:"error,omitempty"`
+}
+
+// ExplainSubscription checks if a subscription matches the specified event, explaining why.
+func (se *SubscriptionEvaluator) ExplainSubscription(subscription config.Subscription, event Event) (SubscriptionEvaluation, error) {
 	// First check basic event type matching
 	eventTypeMatches := false
 	for _, subEventType := range subscription.Events {
@@ -189,32 +261,46 @@ func (se *SubscriptionEvaluator) EvaluateSubscription(subscription config.Subscr
 		}
 	}
 	if !eventTypeMatches {
-		return false, nil
+		return SubscriptionEvaluation{Reason: fmt.Sprintf("not subscribed to event type '%s'", event.Type)}, nil
 	}
 
 	// Check schema version compatibility if specified
 	if subscription.SchemaVersion != "" {
 		compatible, err := se.CheckSchemaCompatibility(event.SchemaVersion, subscription.SchemaVersion)
 		if err != nil {
-			return false, fmt.Errorf("schema compatibility check failed: %v", err)
+			return SubscriptionEvaluation{Reason: "schema compatibility check failed"}, fmt.Errorf("schema compatibility check failed: %v", err)
 		}
 		if !compatible {
-			return false, nil
+			return SubscriptionEvaluation{
+				Reason:             fmt.Sprintf("schema version '%s' is not in range '%s'", event.SchemaVersion, subscription.SchemaVersion),
+				SchemaIncompatible: true,
+			}, nil
 		}
 	}
 
+	// Events must carry the payload fields the subscription consumes, with their type
+	if violations := checkConsumedFields(subscription.Consumes, payloadTypes(event.Payload)); len(violations) > 0 {
+		return SubscriptionEvaluation{Reason: "payload contract violated"}, fmt.Errorf("payload contract violated: %s", strings.Join(violations, "; "))
+	}
+
 	// Evaluate CEL filter expressions if present
+	evaluation := SubscriptionEvaluation{}
 	for i, filter := range subscription.Filters {
 		matches, err := se.evaluateCELFilter(filter, event)
 		if err != nil {
-			return false, fmt.Errorf("filter %d evaluation failed: %v", i, err)
+			evaluation.Filters = append(evaluation.Filters, FilterResult{Expression: filter, Error: err.Error()})
+			evaluation.Reason = fmt.Sprintf("filter %d failed", i)
+			return evaluation, fmt.Errorf("filter %d evaluation failed: %v", i, err)
 		}
+		evaluation.Filters = append(evaluation.Filters, FilterResult{Expression: filter, Result: matches})
 		if !matches {
-			return false, nil
+			evaluation.Reason = fmt.Sprintf("filter %d did not hold", i)
+			return evaluation, nil
 		}
 	}
 
-	return true, nil
+	evaluation.Matched = true
+	return evaluation, nil
 }
 
 // CheckSchemaCompatibility checks if the event's schema version is compatible with the subscription's version range.
@@ -239,17 +325,36 @@ func (se *SubscriptionEvaluator) CheckSchemaCompatibility(eventVersion, subscrip
 	return evaluateVersionRange(eventSemVer, subscriptionRange)
 }
 
+// InputMappingError is the failure to map an event to an input of the workflow of a subscription.
+type InputMappingError struct {
+	Input string
+	// Template is the input template, or the expression of the payload transform, that failed.
+	Template  string
+	Transform bool
+	Err       error
+}
+
+func (e *InputMappingError) Error() string {
+	if e.Transform {
+		return fmt.Sprintf("failed to transform input '%s': %v", e.Input, e.Err)
+	}
+	return fmt.Sprintf("failed to process input '%s': %v", e.Input, e.Err)
+}
+
+func (e *InputMappingError) Unwrap() error {
+	return e.Err
+}
+
 // ProcessEventPayload processes the event payload for input mapping to workflow inputs.
 func (se *SubscriptionEvaluator) ProcessEventPayload(payload map[string]interface{}, subscription config.Subscription) (map[string]string, error) {
 	result := make(map[string]string)
 
-	// Process each input mapping in the subscription
-	for inputName, inputValue := range subscription.Inputs {
-		// For now, we'll do simple template variable substitution
-		// This will be enhanced to use the full template engine in later phases
-		processedValue, err := se.processSimpleTemplate(inputValue, payload)
+	// Process each input mapping in the subscription, in order for the same input to fail first
+	for _, inputName := range sortedKeys(subscription.Inputs) {
+		inputValue := subscription.Inputs[inputName]
+		processedValue, err := se.processInputTemplate(inputValue, payload)
 		if err != nil {
-			return nil, fmt.Errorf("failed to process input '%s': %v", inputName, err)
+			return nil, &InputMappingError{Input: inputName, Template: inputValue, Err: err}
 		}
 		result[inputName] = processedValue
 	}
@@ -257,6 +362,86 @@ func (se *SubscriptionEvaluator) ProcessEventPayload(payload map[string]interfac
 	return result, nil
 }
 
+// ProcessEvent maps an event to workflow inputs using the subscription's input mappings
+// and, when present, its payload transform.
+func (se *SubscriptionEvaluator) ProcessEvent(event Event, subscription config.Subscription) (map[string]string, error) {
+	result, err := se.ProcessEventPayload(event.Payload, subscription)
+	if err != nil {
+		return nil, err
+	}
+
+	if subscription.Transform == nil {
+		return result, nil
+	}
+
+	language := subscription.Transform.EffectiveLanguage()
+	for _, inputName := range sortedKeys(subscription.Transform.Inputs) {
+		expression := subscription.Transform.Inputs[inputName]
+		value, err := se.transformInput(language, expression, event)
+		if err != nil {
+			return nil, &InputMappingError{Input: inputName, Template: expression, Transform: true, Err: err}
+		}
+		result[inputName] = value
+	}
+
+	return result, nil
+}
+
+// CheckTransform verifies ahead of time that the expressions of a payload transform compile.
+func (se *SubscriptionEvaluator) CheckTransform(transform config.SubscriptionTransform) error {
+	for inputName, expression := range transform.Inputs {
+		var err error
+		switch transform.EffectiveLanguage() {
+		case config.TransformLanguageCEL:
+			_, issues := se.celEnv.Compile(expression)
+			if issues != nil && issues.Err() != nil {
+				err = fmt.Errorf("CEL compilation error: %v", issues.Err())
+			}
+		case config.TransformLanguageTemplate:
+			err = se.templateEngine.ValidateTemplate(expression)
+		default:
+			err = fmt.Errorf("unsupported transform language '%s'", transform.Language)
+		}
+		if err != nil {
+			return fmt.Errorf("input '%s': %v", inputName, err)
+		}
+	}
+
+	return nil
+}
+
+// CheckFilter compiles a CEL filter expression without evaluating it.
+// It reports syntax errors, references to unknown variables, and expressions that cannot return a boolean.
+func (se *SubscriptionEvaluator) CheckFilter(filterExpr string) error {
+	ast, issues := se.celEnv.Compile(filterExpr)
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("CEL compilation error: %v", issues.Err())
+	}
+
+	outputType := ast.OutputType()
+	if outputType != cel.BoolType && outputType != cel.DynType {
+		return fmt.Errorf("CEL expression must return boolean, got %v", outputType)
+	}
+
+	return nil
+}
+
+// CheckInputTemplate verifies that an input mapping is a valid template that only reads the
+// event payload, as .payload fields.
+func (se *SubscriptionEvaluator) CheckInputTemplate(template string) error {
+	if isSimpleInputTemplate(template) {
+		return nil
+	}
+	tmpl, err := se.templateEngine.getOrCreateTemplate(template)
+	if err != nil {
+		return err
+	}
+	if tmpl.Tree == nil {
+		return nil
+	}
+	return checkPayloadFields(tmpl.Tree.Root)
+}
+
 // GetCacheStats returns CEL program cache statistics.
 func (se *SubscriptionEvaluator) GetCacheStats() (hits, misses int64, size int) {
 	return se.programCache.stats()
@@ -264,24 +449,75 @@ func (se *SubscriptionEvaluator) GetCacheStats() (hits, misses int64, size int)
 
 // evaluateCELFilter evaluates a CEL expression against an event.
 func (se *SubscriptionEvaluator) evaluateCELFilter(filterExpr string, event Event) (bool, error) {
+	result, err := se.evaluateCEL(filterExpr, event)
+	if err != nil {
+		return false, err
+	}
+
+	// Convert result to boolean
+	if result.Type() != types.BoolType {
+		return false, fmt.Errorf("CEL expression must return boolean, got %v", result.Type())
+	}
+
+	return result.Value().(bool), nil
+}
+
+// transformInput computes a single transformed input from an event.
+// CEL results that are not scalars are rendered as JSON.
+func (se *SubscriptionEvaluator) transformInput(language, expression string, event Event) (string, error) {
+	if language == config.TransformLanguageTemplate {
+		return se.templateEngine.ExpandTemplateData(expression, eventToMap(event))
+	}
+
+	result, err := se.evaluateCEL(expression, event)
+	if err != nil {
+		return "", err
+	}
+
+	switch result.Type() {
+	case types.StringType:
+		return string(result.(types.String)), nil
+	case types.BoolType, types.IntType, types.UintType, types.DoubleType:
+		return fmt.Sprintf("%v", result.Value()), nil
+	case types.NullType:
+		return "", nil
+	}
+
+	native, err := result.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return "", fmt.Errorf("cannot render %v as JSON: %v", result.Type(), err)
+	}
+	data, err := json.Marshal(native.(*structpb.Value).AsInterface())
+	if err != nil {
+		return "", fmt.Errorf("cannot render %v as JSON: %v", result.Type(), err)
+	}
+	return string(data), nil
+}
+
+// evaluateCEL compiles (or fetches from cache) and evaluates a CEL expression against an event.
+func (se *SubscriptionEvaluator) evaluateCEL(expr string, event Event) (ref.Val, error) {
 	// Try to get compiled program from cache
-	program, found := se.programCache.get(filterExpr)
+	program, found := se.programCache.get(expr)
 	if !found {
-		// Cache miss - compile the expression
-		ast, issues := se.celEnv.Compile(filterExpr)
-		if issues != nil && issues.Err() != nil {
-			return false, fmt.Errorf("CEL compilation error: %v", issues.Err())
+		// Cache miss - use the expression checked by the catalog, or compile it
+		ast, ok := se.precompiled.compiledExpression(expr)
+		if !ok {
+			var issues *cel.Issues
+			ast, issues = se.celEnv.Compile(expr)
+			if issues != nil && issues.Err() != nil {
+				return nil, fmt.Errorf("CEL compilation error: %v", issues.Err())
+			}
 		}
 
 		// Create evaluation program
 		var err error
-		program, err = se.celEnv.Program(ast)
+		program, err = se.celEnv.Program(ast, cel.CostLimit(se.costLimit))
 		if err != nil {
-			return false, fmt.Errorf("CEL program creation error: %v", err)
+			return nil, fmt.Errorf("CEL program creation error: %v", err)
 		}
 
 		// Cache the compiled program for future use
-		se.programCache.put(filterExpr, program)
+		se.programCache.put(expr, program)
 	}
 
 	// Prepare evaluation context
@@ -296,33 +532,104 @@ func (se *SubscriptionEvaluator) evaluateCELFilter(filterExpr string, event Even
 	// Evaluate the expression
 	result, _, err := program.Eval(evalCtx)
 	if err != nil {
-		return false, fmt.Errorf("CEL evaluation error: %v", err)
+		return nil, fmt.Errorf("CEL evaluation error: %v", err)
 	}
 
-	// Convert result to boolean
-	if result.Type() != types.BoolType {
-		return false, fmt.Errorf("CEL expression must return boolean, got %v", result.Type())
+	return result, nil
+}
+
+// processInputTemplate expands an input mapping over an event payload. Mappings that only
+// substitute payload fields render values other than strings as JSON; the others are expanded
+// by the template engine, with the payload as .payload.
+func (se *SubscriptionEvaluator) processInputTemplate(template string, payload map[string]interface{}) (string, error) {
+	if isSimpleInputTemplate(template) {
+		return se.processSimpleTemplate(template, payload)
 	}
+	return se.templateEngine.ExpandTemplateData(template, map[string]interface{}{"payload": payload})
+}
 
-	return result.Value().(bool), nil
+// isSimpleInputTemplate reports whether every expression of an input mapping is a
+// {{ .payload.field }} substitution.
+func isSimpleInputTemplate(template string) bool {
+	for _, expression := range templateExpressionPattern.FindAllString(template, -1) {
+		if !payloadFieldPattern.MatchString(expression) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPayloadFields reports the fields of a template node, read from the top-level data, that
+// are not under .payload. The bodies of range and with blocks, where the data is another value,
+// are not checked.
+func checkPayloadFields(node parse.Node) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, child := range n.Nodes {
+			if err := checkPayloadFields(child); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return checkPayloadFields(n.Pipe)
+	case *parse.IfNode:
+		return checkBranchPayloadFields(&n.BranchNode, true)
+	case *parse.RangeNode:
+		return checkBranchPayloadFields(&n.BranchNode, false)
+	case *parse.WithNode:
+		return checkBranchPayloadFields(&n.BranchNode, false)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				if err := checkPayloadFields(arg); err != nil {
+					return err
+				}
+			}
+		}
+	case *parse.FieldNode:
+		if n.Ident[0] != "payload" {
+			return fmt.Errorf("unsupported template field '%s': only .payload fields are available", n.String())
+		}
+	case *parse.ChainNode:
+		return checkPayloadFields(n.Node)
+	}
+	return nil
+}
+
+// checkBranchPayloadFields checks the pipeline of an if, range or with block and the blocks run
+// with the top-level data.
+func checkBranchPayloadFields(branch *parse.BranchNode, body bool) error {
+	if err := checkPayloadFields(branch.Pipe); err != nil {
+		return err
+	}
+	if body {
+		if err := checkPayloadFields(branch.List); err != nil {
+			return err
+		}
+	}
+	return checkPayloadFields(branch.ElseList)
 }
 
 // processSimpleTemplate processes a simple template string with variable substitution.
-// This is a simplified implementation - full template processing will be added in later phases.
 func (se *SubscriptionEvaluator) processSimpleTemplate(template string, payload map[string]interface{}) (string, error) {
 	result := template
 
 	// Simple variable substitution for {{ .payload.field }} patterns
-	re := regexp.MustCompile(`\{\{\s*\.payload\.([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
-	matches := re.FindAllStringSubmatch(template, -1)
+	matches := payloadFieldPattern.FindAllStringSubmatch(template, -1)
 
 	for _, match := range matches {
 		fullMatch := match[0]
 		fieldName := match[1]
 
 		if value, exists := payload[fieldName]; exists {
-			// Convert value to string
-			strValue := fmt.Sprintf("%v", value)
+			// Values other than strings, such as lists for list inputs, are rendered as JSON
+			strValue := config.FormatInputValue(value)
 			result = strings.ReplaceAll(result, fullMatch, strValue)
 		} else {
 			return "", fmt.Errorf("payload field '%s' not found", fieldName)
@@ -0,0 +1,709 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/cel-go/cel"
+	exprpb "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/proto"
+)
+
+// SubscriptionCatalog indexes the subscriptions of the repositories of a cache by artifact and
+// event type, so that fan-outs find their subscribers without reading the tako.yml of every
+// cached repository. The catalog is built on its first lookup, reading repositories with a
+// bounded pool of workers; repositories invalidated since, e.g. because they were cloned or
+// fetched, are reloaded on the next lookup.
+//
+// The subscriptions of each repository, with their CEL filters and transforms checked, are
+// persisted in the subscription index of the cache, keyed by the hash of its tako.yml, so that
+// other processes only parse the tako.yml files that changed since.
+type SubscriptionCatalog struct {
+	cacheDir string
+
+	mu           sync.Mutex
+	workers      int // Repositories read concurrently; DefaultDiscoveryWorkers when zero
+	built        bool
+	repositories map[string][]SubscriptionMatch     // Subscriptions of each repository, by owner/repo
+	index        map[catalogKey][]SubscriptionMatch // Subscriptions of each artifact and event type
+	invalidated  map[string]bool                    // Repositories to reload on the next lookup
+	persisted    map[string]indexedRepository       // Persisted index, by owner/repo; nil until read
+	env          *cel.Env                           // Checks CEL expressions; nil until first needed
+
+	expressionsMu sync.Mutex
+	expressions   map[string]*compiledExpression // Checked CEL expressions, by source
+}
+
+// DefaultDiscoveryWorkers is how many cached repositories are read concurrently when the
+// catalog of subscriptions is built.
+const DefaultDiscoveryWorkers = 16
+
+// SubscriptionIndexFile is the file of the cache directory persisting its subscription index.
+const SubscriptionIndexFile = "subscription-index.json"
+
+// subscriptionIndexVersion is the version of the format of the subscription index; indexes of
+// other versions are discarded.
+const subscriptionIndexVersion = 1
+
+// catalogKey is an artifact and one of the event types subscribed to for it.
+type catalogKey struct {
+	artifact  string
+	eventType string
+}
+
+// subscriptionIndex is the persisted subscription index of a cache directory.
+type subscriptionIndex struct {
+	Version      int                          `json:"version"`
+	Repositories map[string]indexedRepository `json:"repositories"`
+}
+
+// indexedRepository is the entry of a repository in the subscription index.
+type indexedRepository struct {
+	Hash          string                `json:"hash"` // SHA-256 of its tako.yml
+	Subscriptions []config.Subscription `json:"subscriptions,omitempty"`
+	// Expressions holds its checked CEL expressions as serialized CheckedExpr messages, by source
+	Expressions map[string][]byte `json:"expressions,omitempty"`
+}
+
+// compiledExpression is a checked CEL expression, deserialized on first use.
+type compiledExpression struct {
+	data []byte
+	ast  *cel.Ast
+}
+
+// subscriptionCatalogs holds the catalog of each cache directory, shared by the discovery
+// managers of the process.
+var subscriptionCatalogs = struct {
+	sync.Mutex
+	byCacheDir map[string]*SubscriptionCatalog
+}{byCacheDir: make(map[string]*SubscriptionCatalog)}
+
+// SubscriptionCatalogFor returns the catalog of the subscriptions of a cache directory, shared
+// by the discovery managers of the process.
+func SubscriptionCatalogFor(cacheDir string) *SubscriptionCatalog {
+	key := catalogCacheKey(cacheDir)
+
+	subscriptionCatalogs.Lock()
+	defer subscriptionCatalogs.Unlock()
+
+	catalog, ok := subscriptionCatalogs.byCacheDir[key]
+	if !ok {
+		catalog = &SubscriptionCatalog{cacheDir: cacheDir}
+		subscriptionCatalogs.byCacheDir[key] = catalog
+	}
+	return catalog
+}
+
+// InvalidateSubscriptions marks a repository of a cache directory, given as owner/repo, for
+// reloading by the catalog of that directory, after its checkout changed.
+func InvalidateSubscriptions(cacheDir, repository string) {
+	subscriptionCatalogs.Lock()
+	catalog, ok := subscriptionCatalogs.byCacheDir[catalogCacheKey(cacheDir)]
+	subscriptionCatalogs.Unlock()
+
+	if ok {
+		catalog.Invalidate(repository)
+	}
+}
+
+// catalogCacheKey returns the key of the catalog of a cache directory.
+func catalogCacheKey(cacheDir string) string {
+	if abs, err := filepath.Abs(cacheDir); err == nil {
+		return abs
+	}
+	return filepath.Clean(cacheDir)
+}
+
+// Invalidate marks a repository, given as owner/repo, for reloading on the next lookup.
+func (c *SubscriptionCatalog) Invalidate(repository string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.built {
+		return
+	}
+	if c.invalidated == nil {
+		c.invalidated = make(map[string]bool)
+	}
+	c.invalidated[repository] = true
+}
+
+// InvalidateAll discards the catalog, which is rebuilt from the whole cache on the next lookup.
+// Repositories whose tako.yml did not change are still loaded from the subscription index.
+func (c *SubscriptionCatalog) InvalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.built = false
+	c.repositories = nil
+	c.index = nil
+	c.invalidated = nil
+}
+
+// SetWorkers sets how many repositories are read concurrently when the catalog is built;
+// DefaultDiscoveryWorkers when n is not positive.
+func (c *SubscriptionCatalog) SetWorkers(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.workers = n
+}
+
+// Lookup returns the subscriptions to an event type of an artifact, sorted by repository.
+func (c *SubscriptionCatalog) Lookup(artifact, eventType string) ([]SubscriptionMatch, error) {
+	return c.LookupContext(context.Background(), artifact, eventType)
+}
+
+// LookupContext is Lookup, giving up on building the catalog when ctx is done.
+func (c *SubscriptionCatalog) LookupContext(ctx context.Context, artifact, eventType string) ([]SubscriptionMatch, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.refresh(ctx, nil); err != nil {
+		return nil, err
+	}
+	indexed := c.index[catalogKey{artifact: artifact, eventType: eventType}]
+	matches := make([]SubscriptionMatch, len(indexed))
+	copy(matches, indexed)
+	return matches, nil
+}
+
+// Stream calls yield with the subscriptions to an event type of an artifact as they are found:
+// in the order repositories are read while the catalog is built or reloaded, so that callers
+// can act on partial results, and in repository order once it is. yield must not use the
+// catalog. Stream gives up when ctx is done, leaving the catalog to be built again.
+func (c *SubscriptionCatalog) Stream(ctx context.Context, artifact, eventType string, yield func(SubscriptionMatch)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	reloaded := make(map[string]bool)
+	err := c.refresh(ctx, func(repository string, matches []SubscriptionMatch) {
+		reloaded[repository] = true
+		for _, match := range matches {
+			if subscriptionMatches(match.Subscription, artifact, eventType) {
+				yield(match)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	for _, match := range c.index[catalogKey{artifact: artifact, eventType: eventType}] {
+		if !reloaded[match.Repository] {
+			yield(match)
+		}
+	}
+	return nil
+}
+
+// Repositories returns the number of cached repositories the catalog indexes.
+func (c *SubscriptionCatalog) Repositories() (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.refresh(context.Background(), nil); err != nil {
+		return 0, err
+	}
+	return len(c.repositories), nil
+}
+
+// Watch invalidates the repositories whose tako.yml changes, or which are added to or removed
+// from the cache, until ctx is done, so that long-running processes see the changes other
+// processes make to the cache.
+func (c *SubscriptionCatalog) Watch(ctx context.Context) error {
+	reposDir := filepath.Join(c.cacheDir, "repos")
+	if err := os.MkdirAll(reposDir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %v", err)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create watcher: %v", err)
+	}
+	if err := watchCacheTree(watcher, reposDir, 0); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch cached repositories: %v", err)
+	}
+
+	go func() {
+		defer watcher.Close()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				c.handleCacheEvent(watcher, reposDir, event)
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				// Events may have been dropped: read the whole cache again
+				slog.Warn("failed to watch cached repositories", "error", err)
+				c.InvalidateAll()
+			}
+		}
+	}()
+	return nil
+}
+
+// watchCacheTree watches a directory of the cache and the directories below it, down to the
+// checkouts of main branches. depth is 0 for the repos directory, 1 for owners, 2 for
+// repositories and 3 for main branches.
+func watchCacheTree(watcher *fsnotify.Watcher, dir string, depth int) error {
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+	if depth == 3 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil // Removed in the meantime
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() || (depth == 2 && entry.Name() != "main") {
+			continue
+		}
+		if err := watchCacheTree(watcher, filepath.Join(dir, entry.Name()), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleCacheEvent invalidates the repositories a change of the cache affects, and watches the
+// directories it creates.
+func (c *SubscriptionCatalog) handleCacheEvent(watcher *fsnotify.Watcher, reposDir string, event fsnotify.Event) {
+	rel, err := filepath.Rel(reposDir, event.Name)
+	if err != nil {
+		return
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	switch {
+	case len(parts) == 4 && parts[2] == "main" && parts[3] == "tako.yml":
+		c.Invalidate(parts[0] + "/" + parts[1])
+	case len(parts) == 1 || len(parts) == 2 || (len(parts) == 3 && parts[2] == "main"):
+		if event.Has(fsnotify.Create) {
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				watchCacheTree(watcher, event.Name, len(parts))
+			}
+		}
+		if len(parts) > 1 {
+			c.Invalidate(parts[0] + "/" + parts[1])
+			return
+		}
+		// An owner was added or removed: reload its repositories, cached and indexed
+		c.invalidateOwner(parts[0], filepath.Join(reposDir, parts[0]))
+	}
+}
+
+// invalidateOwner marks the repositories of an owner for reloading, both those the catalog
+// indexes and those in the directory of the owner.
+func (c *SubscriptionCatalog) invalidateOwner(owner, ownerDir string) {
+	var repositories []string
+	c.mu.Lock()
+	for repository := range c.repositories {
+		if strings.HasPrefix(repository, owner+"/") {
+			repositories = append(repositories, repository)
+		}
+	}
+	c.mu.Unlock()
+
+	if entries, err := os.ReadDir(ownerDir); err == nil {
+		for _, entry := range entries {
+			if entry.IsDir() {
+				repositories = append(repositories, owner+"/"+entry.Name())
+			}
+		}
+	}
+	for _, repository := range repositories {
+		c.Invalidate(repository)
+	}
+}
+
+// compiledExpression returns a CEL expression of the subscriptions of the catalog as checked
+// when they were indexed, if it was valid. It is safe to call on a nil catalog.
+func (c *SubscriptionCatalog) compiledExpression(expr string) (*cel.Ast, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.expressionsMu.Lock()
+	defer c.expressionsMu.Unlock()
+
+	compiled, ok := c.expressions[expr]
+	if !ok {
+		return nil, false
+	}
+	if compiled.ast == nil {
+		var checked exprpb.CheckedExpr
+		if err := proto.Unmarshal(compiled.data, &checked); err != nil {
+			delete(c.expressions, expr)
+			return nil, false
+		}
+		compiled.ast = cel.CheckedExprToAst(&checked)
+	}
+	return compiled.ast, true
+}
+
+// refresh builds the catalog, or reloads its invalidated repositories, calling loaded with the
+// subscriptions of each repository read, when not nil. When ctx is done first, a catalog being
+// built is discarded and invalidated repositories stay invalidated. The caller must hold the
+// lock.
+func (c *SubscriptionCatalog) refresh(ctx context.Context, loaded func(repository string, matches []SubscriptionMatch)) error {
+	if c.built && len(c.invalidated) == 0 {
+		return nil
+	}
+	if c.persisted == nil {
+		c.persisted = c.readIndex()
+	}
+	if c.env == nil {
+		// Without an environment, expressions are checked when they are evaluated
+		c.env, _ = newSubscriptionCELEnv(nil)
+	}
+
+	var repositories []string
+	if !c.built {
+		scanned, err := c.scan()
+		if err != nil {
+			return err
+		}
+		repositories = scanned
+	} else {
+		for repository := range c.invalidated {
+			repositories = append(repositories, repository)
+		}
+		sort.Strings(repositories)
+	}
+
+	results, err := c.loadAll(ctx, repositories, loaded)
+	if err != nil {
+		return err
+	}
+	if !c.built {
+		c.repositories = make(map[string][]SubscriptionMatch, len(results))
+	}
+	changed := false
+	for _, repository := range repositories {
+		result, ok := results[repository]
+		if !ok {
+			delete(c.repositories, repository)
+			if _, ok := c.persisted[repository]; ok {
+				delete(c.persisted, repository)
+				changed = true
+			}
+			continue
+		}
+		c.repositories[repository] = result.matches
+		c.addExpressions(result.entry.Expressions)
+		if result.parsed {
+			c.persisted[repository] = result.entry
+			changed = true
+		}
+	}
+	if !c.built {
+		// Repositories removed from the cache leave the index
+		for repository := range c.persisted {
+			if _, ok := c.repositories[repository]; !ok {
+				delete(c.persisted, repository)
+				changed = true
+			}
+		}
+	}
+	if changed {
+		c.writeIndex()
+	}
+
+	c.built = true
+	c.invalidated = nil
+	c.reindex()
+	return nil
+}
+
+// loadedRepository is a repository read by the catalog.
+type loadedRepository struct {
+	matches []SubscriptionMatch
+	entry   indexedRepository
+	parsed  bool // Whether its tako.yml was parsed rather than found in the subscription index
+}
+
+// loadAll reads the subscriptions of repositories with a bounded pool of workers, and returns
+// those of the repositories that exist, calling loaded as each of them is read.
+func (c *SubscriptionCatalog) loadAll(ctx context.Context, repositories []string, loaded func(repository string, matches []SubscriptionMatch)) (map[string]loadedRepository, error) {
+	type result struct {
+		repository string
+		repo       loadedRepository
+		exists     bool
+	}
+
+	workers := c.workers
+	if workers <= 0 {
+		workers = DefaultDiscoveryWorkers
+	}
+	if workers > len(repositories) {
+		workers = len(repositories)
+	}
+
+	jobs := make(chan string)
+	results := make(chan result)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for repository := range jobs {
+				repo, exists := c.load(repository)
+				results <- result{repository: repository, repo: repo, exists: exists}
+			}
+		}()
+	}
+	go func() {
+		defer close(jobs)
+		for _, repository := range repositories {
+			select {
+			case jobs <- repository:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	loadedRepositories := make(map[string]loadedRepository, len(repositories))
+	for result := range results {
+		if !result.exists || ctx.Err() != nil {
+			continue
+		}
+		loadedRepositories[result.repository] = result.repo
+		if loaded != nil {
+			loaded(result.repository, result.repo.matches)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return loadedRepositories, nil
+}
+
+// scan returns the repositories of the cache.
+func (c *SubscriptionCatalog) scan() ([]string, error) {
+	repoBaseDir := filepath.Join(c.cacheDir, "repos")
+	ownerEntries, err := os.ReadDir(repoBaseDir)
+	if os.IsNotExist(err) {
+		// No cached repositories - this is not an error, just return empty results
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cache directory: %v", err)
+	}
+
+	var repositories []string
+	for _, ownerEntry := range ownerEntries {
+		if !ownerEntry.IsDir() {
+			continue
+		}
+		repoEntries, err := os.ReadDir(filepath.Join(repoBaseDir, ownerEntry.Name()))
+		if err != nil {
+			continue // Skip directories we can't read
+		}
+		for _, repoEntry := range repoEntries {
+			if repoEntry.IsDir() {
+				repositories = append(repositories, ownerEntry.Name()+"/"+repoEntry.Name())
+			}
+		}
+	}
+	return repositories, nil
+}
+
+// load reads the subscriptions of the main branch of a repository, from the subscription index
+// when its tako.yml did not change, and reports whether it has a checkout of its main branch.
+// Repositories whose tako.yml fails to load have none. load runs concurrently with other loads
+// and only reads the catalog.
+func (c *SubscriptionCatalog) load(repository string) (loadedRepository, bool) {
+	mainBranchPath := filepath.Join(c.cacheDir, "repos", filepath.FromSlash(repository), "main")
+	if _, err := os.Stat(mainBranchPath); err != nil {
+		return loadedRepository{}, false // Skip if main branch doesn't exist
+	}
+
+	// Repositories without a tako.yml are indexed with an empty hash
+	var hash string
+	if content, err := os.ReadFile(filepath.Join(mainBranchPath, "tako.yml")); err == nil {
+		sum := sha256.Sum256(content)
+		hash = hex.EncodeToString(sum[:])
+	}
+
+	var repo loadedRepository
+	if entry, ok := c.persisted[repository]; ok && entry.Hash == hash {
+		repo.entry = entry
+	} else {
+		repo.entry = indexedRepository{Hash: hash}
+		repo.parsed = true
+		if subscriptions, err := loadSubscriptions(mainBranchPath, c.cacheDir); err == nil {
+			repo.entry.Subscriptions = subscriptions
+			repo.entry.Expressions = c.compileExpressions(subscriptions)
+		} // Skip repositories with loading errors
+	}
+
+	repo.matches = make([]SubscriptionMatch, 0, len(repo.entry.Subscriptions))
+	for _, subscription := range repo.entry.Subscriptions {
+		repo.matches = append(repo.matches, SubscriptionMatch{
+			Repository:   repository,
+			Subscription: subscription,
+			RepoPath:     mainBranchPath,
+		})
+	}
+	return repo, true
+}
+
+// compileExpressions checks the CEL filters and CEL transform inputs of subscriptions, and
+// returns the valid ones serialized, by source. Invalid expressions fail when evaluated.
+func (c *SubscriptionCatalog) compileExpressions(subscriptions []config.Subscription) map[string][]byte {
+	if c.env == nil {
+		return nil
+	}
+	var sources []string
+	for _, subscription := range subscriptions {
+		sources = append(sources, subscription.Filters...)
+		if subscription.Transform != nil && subscription.Transform.EffectiveLanguage() == config.TransformLanguageCEL {
+			for _, expr := range subscription.Transform.Inputs {
+				sources = append(sources, expr)
+			}
+		}
+	}
+
+	expressions := make(map[string][]byte)
+	for _, expr := range sources {
+		if _, ok := expressions[expr]; ok {
+			continue
+		}
+		ast, issues := c.env.Compile(expr)
+		if issues != nil && issues.Err() != nil {
+			continue
+		}
+		checked, err := cel.AstToCheckedExpr(ast)
+		if err != nil {
+			continue
+		}
+		data, err := proto.Marshal(checked)
+		if err != nil {
+			continue
+		}
+		expressions[expr] = data
+	}
+	if len(expressions) == 0 {
+		return nil
+	}
+	return expressions
+}
+
+// addExpressions makes checked CEL expressions available to the evaluators using the catalog.
+func (c *SubscriptionCatalog) addExpressions(expressions map[string][]byte) {
+	if len(expressions) == 0 {
+		return
+	}
+	c.expressionsMu.Lock()
+	defer c.expressionsMu.Unlock()
+
+	if c.expressions == nil {
+		c.expressions = make(map[string]*compiledExpression)
+	}
+	for expr, data := range expressions {
+		if _, ok := c.expressions[expr]; !ok {
+			c.expressions[expr] = &compiledExpression{data: data}
+		}
+	}
+}
+
+// readIndex reads the subscription index of the cache; an index that is missing, corrupted or
+// of another version is empty.
+func (c *SubscriptionCatalog) readIndex() map[string]indexedRepository {
+	data, err := os.ReadFile(filepath.Join(c.cacheDir, SubscriptionIndexFile))
+	if err != nil {
+		return make(map[string]indexedRepository)
+	}
+	var index subscriptionIndex
+	if err := json.Unmarshal(data, &index); err != nil || index.Version != subscriptionIndexVersion || index.Repositories == nil {
+		return make(map[string]indexedRepository)
+	}
+	return index.Repositories
+}
+
+// writeIndex persists the subscription index of the cache atomically. Failures are logged, as
+// the index only saves parsing.
+func (c *SubscriptionCatalog) writeIndex() {
+	data, err := json.Marshal(subscriptionIndex{Version: subscriptionIndexVersion, Repositories: c.persisted})
+	if err != nil {
+		slog.Warn("failed to encode subscription index", "error", err)
+		return
+	}
+	indexPath := filepath.Join(c.cacheDir, SubscriptionIndexFile)
+	tempPath := fmt.Sprintf("%s.tmp.%d", indexPath, os.Getpid())
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		slog.Warn("failed to write subscription index", "path", indexPath, "error", err)
+		return
+	}
+	if err := os.Rename(tempPath, indexPath); err != nil {
+		os.Remove(tempPath)
+		slog.Warn("failed to write subscription index", "path", indexPath, "error", err)
+	}
+}
+
+// reindex rebuilds the index of the subscriptions by artifact and event type, with the
+// subscriptions of each key sorted by repository for deterministic behavior. The caller must
+// hold the lock.
+func (c *SubscriptionCatalog) reindex() {
+	repositories := make([]string, 0, len(c.repositories))
+	for repository := range c.repositories {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+
+	c.index = make(map[catalogKey][]SubscriptionMatch)
+	for _, repository := range repositories {
+		for _, match := range c.repositories[repository] {
+			seen := make(map[string]bool, len(match.Subscription.Events))
+			for _, eventType := range match.Subscription.Events {
+				if seen[eventType] {
+					continue
+				}
+				seen[eventType] = true
+				key := catalogKey{artifact: match.Subscription.Artifact, eventType: eventType}
+				c.index[key] = append(c.index[key], match)
+			}
+		}
+	}
+}
+
+// loadSubscriptions loads the subscriptions of the tako.yml of a repository, resolving its
+// includes from the cache.
+func loadSubscriptions(repoPath, cacheDir string) ([]config.Subscription, error) {
+	takoYmlPath := filepath.Join(repoPath, "tako.yml")
+
+	// Check if tako.yml exists
+	if _, err := os.Stat(takoYmlPath); os.IsNotExist(err) {
+		// No tako.yml file - this is not an error, just return empty subscriptions
+		return []config.Subscription{}, nil
+	}
+
+	// Load the configuration
+	cfg, err := config.LoadWithCache(takoYmlPath, cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tako.yml from %s: %v", takoYmlPath, err)
+	}
+
+	return cfg.Subscriptions, nil
+}
@@ -0,0 +1,439 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Performance budget of subscription discovery with benchmarkRepositories cached repositories,
+// as documented in the README: building the catalog from the cache, and finding the
+// subscribers of an event once it is built. Budgets leave headroom for slow CI machines and
+// the race detector; see BenchmarkFindSubscribers for actual figures.
+const (
+	benchmarkRepositories = 1000
+	catalogBuildBudget    = 5 * time.Second
+	discoveryLookupBudget = time.Millisecond
+)
+
+// writeCachedRepositories writes count cached repositories, each subscribing to the built
+// event of org/lib-<i%10>, and returns their cache directory.
+func writeCachedRepositories(tb testing.TB, count int) string {
+	tb.Helper()
+	cacheDir := tb.TempDir()
+	for i := 0; i < count; i++ {
+		repoPath := filepath.Join(cacheDir, "repos", fmt.Sprintf("org-%d", i%20), fmt.Sprintf("repo-%d", i), "main")
+		if err := os.MkdirAll(repoPath, 0755); err != nil {
+			tb.Fatalf("Failed to create repository: %v", err)
+		}
+		takoYml := fmt.Sprintf(`version: "0.1.0"
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: org/lib-%d:default
+    events: [built, released]
+    workflow: update
+`, i%10)
+		if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+			tb.Fatalf("Failed to write tako.yml: %v", err)
+		}
+	}
+	return cacheDir
+}
+
+func TestSubscriptionCatalogInvalidation(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 3)
+	dm := NewDiscoveryManager(cacheDir)
+	if NewDiscoveryManager(cacheDir).Catalog() != dm.Catalog() {
+		t.Fatal("expected the discovery managers of a cache to share its catalog")
+	}
+
+	matches, err := dm.FindSubscribers("org/lib-1:default", "built")
+	if err != nil || len(matches) != 1 || matches[0].Repository != "org-1/repo-1" {
+		t.Fatalf("expected org-1/repo-1 to subscribe, got %+v, %v", matches, err)
+	}
+
+	// Changes to the cache are only seen once the repository is invalidated
+	repoPath := filepath.Join(cacheDir, "repos", "org-2", "repo-2", "main")
+	takoYml := `version: "0.1.0"
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: org/lib-1:default
+    events: [built]
+    workflow: update
+`
+	if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	if matches, _ := dm.FindSubscribers("org/lib-1:default", "built"); len(matches) != 1 {
+		t.Fatalf("expected the catalog not to read the cache again, got %+v", matches)
+	}
+	InvalidateSubscriptions(cacheDir, "org-2/repo-2")
+	matches, err = dm.FindSubscribers("org/lib-1:default", "built")
+	if err != nil || len(matches) != 2 || matches[0].Repository != "org-1/repo-1" || matches[1].Repository != "org-2/repo-2" {
+		t.Fatalf("expected the invalidated repository to be reloaded, got %+v, %v", matches, err)
+	}
+
+	// Removed repositories lose their subscriptions
+	if err := os.RemoveAll(filepath.Join(cacheDir, "repos", "org-1")); err != nil {
+		t.Fatalf("Failed to remove repository: %v", err)
+	}
+	dm.Catalog().Invalidate("org-1/repo-1")
+	if matches, _ := dm.FindSubscribers("org/lib-1:default", "built"); len(matches) != 1 || matches[0].Repository != "org-2/repo-2" {
+		t.Errorf("expected the removed repository to be dropped, got %+v", matches)
+	}
+
+	// Lookups return copies of the index
+	matches[0].Repository = "modified"
+	if again, _ := dm.FindSubscribers("org/lib-1:default", "built"); again[0].Repository != "org-2/repo-2" {
+		t.Error("expected callers not to modify the catalog")
+	}
+
+	dm.Catalog().InvalidateAll()
+	if count, err := dm.Catalog().Repositories(); err != nil || count != 2 {
+		t.Errorf("expected the rebuilt catalog to index 2 repositories, got %d, %v", count, err)
+	}
+}
+
+func TestSubscriptionCatalogWorkers(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 50)
+	catalog := SubscriptionCatalogFor(cacheDir)
+
+	var expected []SubscriptionMatch
+	for _, workers := range []int{1, 8, 100} {
+		catalog.InvalidateAll()
+		catalog.SetWorkers(workers)
+		matches, err := catalog.Lookup("org/lib-4:default", "built")
+		if err != nil {
+			t.Fatalf("Lookup() with %d workers error = %v", workers, err)
+		}
+		if expected == nil {
+			expected = matches
+		}
+		if len(matches) != 5 || fmt.Sprint(matches) != fmt.Sprint(expected) {
+			t.Errorf("expected %d workers to find the same sorted subscribers, got %+v", workers, matches)
+		}
+	}
+}
+
+func TestStreamSubscribers(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 30)
+	dm := NewDiscoveryManager(cacheDir)
+
+	// Subscribers are streamed as the catalog is built, then from the catalog
+	for _, building := range []bool{true, false} {
+		streamed := make(map[string]bool)
+		err := dm.StreamSubscribers(context.Background(), "org/lib-2:default", "released", func(match SubscriptionMatch) {
+			streamed[match.Repository] = true
+		})
+		if err != nil {
+			t.Fatalf("StreamSubscribers() error = %v", err)
+		}
+		if len(streamed) != 3 || !streamed["org-2/repo-2"] || !streamed["org-12/repo-12"] || !streamed["org-2/repo-22"] {
+			t.Errorf("expected the subscribers of org/lib-2 (building: %v), got %v", building, streamed)
+		}
+	}
+
+	// Reloaded repositories are streamed once
+	InvalidateSubscriptions(cacheDir, "org-12/repo-12")
+	count := 0
+	dm.StreamSubscribers(context.Background(), "org/lib-2:default", "released", func(SubscriptionMatch) { count++ })
+	if count != 3 {
+		t.Errorf("expected 3 subscribers, got %d", count)
+	}
+
+	if err := dm.StreamSubscribers(context.Background(), "", "released", func(SubscriptionMatch) {}); err == nil {
+		t.Error("expected an empty artifact to be rejected")
+	}
+}
+
+func TestFindSubscribersContextCancelled(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 30)
+	dm := NewDiscoveryManager(cacheDir)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := dm.FindSubscribersContext(ctx, "org/lib-1:default", "built"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected discovery to stop when cancelled, got %v", err)
+	}
+
+	// Stopping while streaming discards the partial catalog
+	ctx, cancel = context.WithCancel(context.Background())
+	err := dm.StreamSubscribers(ctx, "org/lib-1:default", "built", func(SubscriptionMatch) { cancel() })
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected streaming to stop when cancelled, got %v", err)
+	}
+	matches, err := dm.FindSubscribers("org/lib-1:default", "built")
+	if err != nil || len(matches) != 3 {
+		t.Errorf("expected the catalog to be built in full after a cancelled build, got %d subscribers, %v", len(matches), err)
+	}
+}
+
+func TestSubscriptionIndexPersistence(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 3)
+	if _, err := SubscriptionCatalogFor(cacheDir).Lookup("org/lib-1:default", "built"); err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cacheDir, SubscriptionIndexFile))
+	if err != nil {
+		t.Fatalf("expected the subscription index to be written, got %v", err)
+	}
+	var index subscriptionIndex
+	if err := json.Unmarshal(data, &index); err != nil || index.Version != subscriptionIndexVersion || len(index.Repositories) != 3 {
+		t.Fatalf("expected 3 indexed repositories, got %+v, %v", index, err)
+	}
+
+	// Other processes load unchanged repositories from the index rather than parsing them
+	entry := index.Repositories["org-1/repo-1"]
+	entry.Subscriptions[0].Workflow = "indexed"
+	index.Repositories["org-1/repo-1"] = entry
+	data, _ = json.Marshal(index)
+	if err := os.WriteFile(filepath.Join(cacheDir, SubscriptionIndexFile), data, 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	matches, err := (&SubscriptionCatalog{cacheDir: cacheDir}).Lookup("org/lib-1:default", "built")
+	if err != nil || len(matches) != 1 || matches[0].Subscription.Workflow != "indexed" {
+		t.Fatalf("expected the subscriptions to be loaded from the index, got %+v, %v", matches, err)
+	}
+
+	// Changed tako.yml files are parsed again
+	takoYml := filepath.Join(cacheDir, "repos", "org-1", "repo-1", "main", "tako.yml")
+	content, _ := os.ReadFile(takoYml)
+	if err := os.WriteFile(takoYml, append(content, []byte("# changed\n")...), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	matches, err = (&SubscriptionCatalog{cacheDir: cacheDir}).Lookup("org/lib-1:default", "built")
+	if err != nil || len(matches) != 1 || matches[0].Subscription.Workflow != "update" {
+		t.Fatalf("expected the changed tako.yml to be parsed, got %+v, %v", matches, err)
+	}
+
+	// Indexes of other versions are discarded
+	if err := os.WriteFile(filepath.Join(cacheDir, SubscriptionIndexFile), []byte(`{"version": 0}`), 0644); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	if count, err := (&SubscriptionCatalog{cacheDir: cacheDir}).Repositories(); err != nil || count != 3 {
+		t.Errorf("expected 3 repositories, got %d, %v", count, err)
+	}
+}
+
+func TestSubscriptionIndexPrecompiledExpressions(t *testing.T) {
+	cacheDir := t.TempDir()
+	repoPath := filepath.Join(cacheDir, "repos", "org", "app", "main")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repository: %v", err)
+	}
+	takoYml := `version: "0.1.0"
+workflows:
+  update:
+    inputs:
+      version:
+        type: string
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: org/lib:default
+    events: [built]
+    workflow: update
+    filters:
+      - payload.version.startsWith("1.")
+    transform:
+      language: cel
+      inputs:
+        version: payload.version + "-patched"
+`
+	if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml: %v", err)
+	}
+	if _, err := (&SubscriptionCatalog{cacheDir: cacheDir}).Lookup("org/lib:default", "built"); err != nil {
+		t.Fatalf("Lookup() error = %v", err)
+	}
+
+	// Expressions are deserialized from the index by another process
+	catalog := &SubscriptionCatalog{cacheDir: cacheDir}
+	matches, err := catalog.Lookup("org/lib:default", "built")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("expected 1 subscriber, got %+v, %v", matches, err)
+	}
+	for _, expr := range []string{`payload.version.startsWith("1.")`, `payload.version + "-patched"`} {
+		if _, ok := catalog.compiledExpression(expr); !ok {
+			t.Errorf("expected %q to be checked ahead of time", expr)
+		}
+	}
+
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("NewSubscriptionEvaluator() error = %v", err)
+	}
+	evaluator.SetPrecompiled(catalog)
+	subscription := matches[0].Subscription
+	event := Event{Type: "built", Payload: map[string]interface{}{"version": "1.2.0"}}
+	if ok, err := evaluator.EvaluateSubscription(subscription, event); err != nil || !ok {
+		t.Errorf("expected the precompiled filter to match, got %v, %v", ok, err)
+	}
+	inputs, err := evaluator.ProcessEvent(event, subscription)
+	if err != nil || inputs["version"] != "1.2.0-patched" {
+		t.Errorf("expected the precompiled transform to run, got %v, %v", inputs, err)
+	}
+	event.Payload["version"] = "2.0.0"
+	if ok, _ := evaluator.EvaluateSubscription(subscription, event); ok {
+		t.Error("expected the precompiled filter not to match")
+	}
+}
+
+func TestSubscriptionCatalogWatch(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, 3)
+	catalog := SubscriptionCatalogFor(cacheDir)
+	if matches, err := catalog.Lookup("org/lib-1:default", "built"); err != nil || len(matches) != 1 {
+		t.Fatalf("expected 1 subscriber, got %+v, %v", matches, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := catalog.Watch(ctx); err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+
+	subscribe := func(repository string) {
+		repoPath := filepath.Join(append([]string{cacheDir, "repos"}, append(strings.Split(repository, "/"), "main")...)...)
+		if err := os.MkdirAll(repoPath, 0755); err != nil {
+			t.Fatalf("Failed to create repository: %v", err)
+		}
+		takoYml := `version: "0.1.0"
+workflows:
+  update:
+    steps:
+      - run: echo updated
+subscriptions:
+  - artifact: org/lib-1:default
+    events: [built]
+    workflow: update
+`
+		if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+			t.Fatalf("Failed to write tako.yml: %v", err)
+		}
+	}
+	waitForSubscribers := func(count int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			matches, err := catalog.Lookup("org/lib-1:default", "built")
+			if err == nil && len(matches) == count {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d subscribers, got %+v, %v", count, matches, err)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Changed tako.yml files, and added and removed repositories, are reloaded
+	subscribe("org-2/repo-2")
+	waitForSubscribers(2)
+	subscribe("new-org/repo")
+	waitForSubscribers(3)
+	if err := os.RemoveAll(filepath.Join(cacheDir, "repos", "org-1")); err != nil {
+		t.Fatalf("Failed to remove repository: %v", err)
+	}
+	waitForSubscribers(2)
+}
+
+func TestDiscoveryPerformanceBudget(t *testing.T) {
+	cacheDir := writeCachedRepositories(t, benchmarkRepositories)
+	dm := NewDiscoveryManager(cacheDir)
+
+	start := time.Now()
+	matches, err := dm.FindSubscribers("org/lib-3:default", "built")
+	if err != nil {
+		t.Fatalf("FindSubscribers() error = %v", err)
+	}
+	if build := time.Since(start); build > catalogBuildBudget {
+		t.Errorf("building the catalog of %d repositories took %s, over the budget of %s", benchmarkRepositories, build, catalogBuildBudget)
+	}
+	if len(matches) != benchmarkRepositories/10 {
+		t.Fatalf("expected %d subscribers, got %d", benchmarkRepositories/10, len(matches))
+	}
+
+	const lookups = 100
+	start = time.Now()
+	for i := 0; i < lookups; i++ {
+		if _, err := dm.FindSubscribers(fmt.Sprintf("org/lib-%d:default", i%10), "released"); err != nil {
+			t.Fatalf("FindSubscribers() error = %v", err)
+		}
+	}
+	if lookup := time.Since(start) / lookups; lookup > discoveryLookupBudget {
+		t.Errorf("finding subscribers among %d repositories took %s, over the budget of %s", benchmarkRepositories, lookup, discoveryLookupBudget)
+	}
+}
+
+func BenchmarkFindSubscribers(b *testing.B) {
+	cacheDir := writeCachedRepositories(b, benchmarkRepositories)
+	dm := NewDiscoveryManager(cacheDir)
+	if _, err := dm.FindSubscribers("org/lib-0:default", "built"); err != nil {
+		b.Fatalf("FindSubscribers() error = %v", err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dm.FindSubscribers(fmt.Sprintf("org/lib-%d:default", i%10), "built")
+	}
+}
+
+func BenchmarkBuildSubscriptionCatalog(b *testing.B) {
+	cacheDir := writeCachedRepositories(b, benchmarkRepositories)
+
+	// Without a subscription index, every tako.yml is parsed
+	for _, workers := range []int{1, DefaultDiscoveryWorkers} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				os.Remove(filepath.Join(cacheDir, SubscriptionIndexFile))
+				catalog := &SubscriptionCatalog{cacheDir: cacheDir}
+				catalog.SetWorkers(workers)
+				if _, err := catalog.Lookup("org/lib-0:default", "built"); err != nil {
+					b.Fatalf("Lookup() error = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkLoadSubscriptionIndex(b *testing.B) {
+	cacheDir := writeCachedRepositories(b, benchmarkRepositories)
+	if _, err := SubscriptionCatalogFor(cacheDir).Lookup("org/lib-0:default", "built"); err != nil {
+		b.Fatalf("Lookup() error = %v", err)
+	}
+	b.ResetTimer()
+
+	// A new process whose cache did not change parses no tako.yml
+	for i := 0; i < b.N; i++ {
+		if _, err := (&SubscriptionCatalog{cacheDir: cacheDir}).Lookup("org/lib-0:default", "built"); err != nil {
+			b.Fatalf("Lookup() error = %v", err)
+		}
+	}
+}
+
+func BenchmarkReloadInvalidatedSubscriptions(b *testing.B) {
+	cacheDir := writeCachedRepositories(b, benchmarkRepositories)
+	catalog := SubscriptionCatalogFor(cacheDir)
+	if _, err := catalog.Lookup("org/lib-0:default", "built"); err != nil {
+		b.Fatalf("Lookup() error = %v", err)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		catalog.Invalidate("org-0/repo-0")
+		catalog.Lookup("org/lib-0:default", "built")
+	}
+}
@@ -0,0 +1,229 @@
+package engine
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+// SubscriptionIssue describes a problem found while linting the cached subscriptions.
+type SubscriptionIssue struct {
+	Repository string `json:"repository"`
+	// Index is the position of the subscription in the repository's tako.yml, or -1 when
+	// the issue concerns the repository as a whole.
+	Index    int    `json:"index"`
+	Artifact string `json:"artifact,omitempty"`
+	Workflow string `json:"workflow,omitempty"`
+	Message  string `json:"message"`
+}
+
+// String formats the issue for display.
+func (i SubscriptionIssue) String() string {
+	if i.Index < 0 {
+		return fmt.Sprintf("%s: %s", i.Repository, i.Message)
+	}
+	return fmt.Sprintf("%s: subscription %d (%s -> %s): %s", i.Repository, i.Index, i.Artifact, i.Workflow, i.Message)
+}
+
+// ListSubscriptions returns every subscription declared by the cached repositories,
+// sorted by repository name. Repositories whose tako.yml cannot be loaded are skipped.
+func (dm *DiscoveryManager) ListSubscriptions() ([]SubscriptionMatch, error) {
+	repositories, err := dm.ScanRepositories()
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]SubscriptionMatch, 0)
+	for _, repository := range repositories {
+		repoPath := dm.repositoryMainPath(repository)
+		subscriptions, err := dm.LoadSubscriptions(repoPath)
+		if err != nil {
+			continue // Skip repositories with loading errors
+		}
+
+		for _, subscription := range subscriptions {
+			matches = append(matches, SubscriptionMatch{
+				Repository:   repository,
+				Subscription: subscription,
+				RepoPath:     repoPath,
+			})
+		}
+	}
+
+	return matches, nil
+}
+
+// LintSubscriptions checks the subscriptions of every cached repository ahead of time.
+// Unlike discovery, which silently skips repositories that fail to load, linting reports
+// every problem it finds: invalid subscriptions, CEL filters and payload transforms that do
+// not compile, input templates that cannot be resolved, and subscriptions pointing to workflows or artifacts
+// that do not exist.
+func (dm *DiscoveryManager) LintSubscriptions(evaluator *SubscriptionEvaluator) ([]SubscriptionIssue, error) {
+	repositories, configs, issues, err := dm.loadCachedConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, repository := range repositories {
+		cfg := configs[repository]
+		if cfg == nil {
+			continue
+		}
+
+		for i, subscription := range cfg.Subscriptions {
+			for _, message := range lintSubscription(subscription, cfg, configs, evaluator) {
+				issues = append(issues, SubscriptionIssue{
+					Repository: repository,
+					Index:      i,
+					Artifact:   subscription.Artifact,
+					Workflow:   subscription.Workflow,
+					Message:    message,
+				})
+			}
+		}
+	}
+
+	sortSubscriptionIssues(issues)
+	return issues, nil
+}
+
+// sortSubscriptionIssues sorts issues by repository, then by subscription.
+func sortSubscriptionIssues(issues []SubscriptionIssue) {
+	sort.SliceStable(issues, func(i, j int) bool {
+		if issues[i].Repository != issues[j].Repository {
+			return issues[i].Repository < issues[j].Repository
+		}
+		return issues[i].Index < issues[j].Index
+	})
+}
+
+// loadCachedConfigs loads the tako.yml of every cached repository. The configs map holds nil
+// for the repositories without a usable tako.yml, and the issues report those that fail to load.
+func (dm *DiscoveryManager) loadCachedConfigs() ([]string, map[string]*config.Config, []SubscriptionIssue, error) {
+	repositories, err := dm.ScanRepositories()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	configs := make(map[string]*config.Config, len(repositories))
+	issues := make([]SubscriptionIssue, 0)
+	for _, repository := range repositories {
+		// Repositories without a usable tako.yml are still recorded, so that
+		// references to them are not reported as missing from the cache.
+		configs[repository] = nil
+
+		takoPath := filepath.Join(dm.repositoryMainPath(repository), "tako.yml")
+		if _, err := os.Stat(takoPath); os.IsNotExist(err) {
+			continue
+		}
+
+		cfg, err := config.LoadRaw(takoPath)
+		if err != nil {
+			issues = append(issues, SubscriptionIssue{
+				Repository: repository,
+				Index:      -1,
+				Message:    err.Error(),
+			})
+			continue
+		}
+		configs[repository] = cfg
+	}
+	return repositories, configs, issues, nil
+}
+
+// lintSubscription returns the problems found in a single subscription of cfg.
+// The configs map holds the loaded configuration of every cached repository, or nil when
+// the repository has no usable tako.yml.
+func lintSubscription(subscription config.Subscription, cfg *config.Config, configs map[string]*config.Config, evaluator *SubscriptionEvaluator) []string {
+	var messages []string
+
+	if err := subscription.ValidateSubscription(); err != nil {
+		messages = append(messages, err.Error())
+	}
+
+	for i, filter := range subscription.Filters {
+		if err := evaluator.CheckFilter(filter); err != nil {
+			messages = append(messages, fmt.Sprintf("filter %d: %v", i, err))
+		}
+	}
+
+	inputNames := make([]string, 0, len(subscription.Inputs))
+	for inputName := range subscription.Inputs {
+		inputNames = append(inputNames, inputName)
+	}
+	sort.Strings(inputNames)
+
+	workflow, workflowExists := cfg.Workflows[subscription.Workflow]
+	if subscription.Workflow != "" && !workflowExists {
+		messages = append(messages, fmt.Sprintf("workflow '%s' does not exist", subscription.Workflow))
+	}
+
+	for _, inputName := range inputNames {
+		if err := evaluator.CheckInputTemplate(subscription.Inputs[inputName]); err != nil {
+			messages = append(messages, fmt.Sprintf("input '%s': %v", inputName, err))
+		}
+		if workflowExists {
+			if _, declared := workflow.Inputs[inputName]; !declared {
+				messages = append(messages, fmt.Sprintf("input '%s' is not declared by workflow '%s'", inputName, subscription.Workflow))
+			}
+		}
+	}
+
+	if subscription.Transform != nil {
+		if err := evaluator.CheckTransform(*subscription.Transform); err != nil {
+			messages = append(messages, fmt.Sprintf("transform: %v", err))
+		}
+		if workflowExists {
+			transformNames := make([]string, 0, len(subscription.Transform.Inputs))
+			for inputName := range subscription.Transform.Inputs {
+				transformNames = append(transformNames, inputName)
+			}
+			sort.Strings(transformNames)
+			for _, inputName := range transformNames {
+				if _, declared := workflow.Inputs[inputName]; !declared {
+					messages = append(messages, fmt.Sprintf("transform input '%s' is not declared by workflow '%s'", inputName, subscription.Workflow))
+				}
+			}
+		}
+	}
+
+	if message := lintArtifactReference(subscription.Artifact, configs); message != "" {
+		messages = append(messages, message)
+	}
+
+	return messages
+}
+
+// lintArtifactReference checks that an "owner/repo:artifact" reference points to a cached
+// repository that declares the artifact. The default artifact is implicitly provided by
+// every repository.
+func lintArtifactReference(reference string, configs map[string]*config.Config) string {
+	parts := strings.SplitN(reference, ":", 2)
+	if len(parts) != 2 {
+		return "" // Malformed references are reported by ValidateSubscription
+	}
+	repository, artifact := parts[0], parts[1]
+
+	cfg, ok := configs[repository]
+	if !ok {
+		return fmt.Sprintf("artifact repository '%s' was not found in the cache", repository)
+	}
+	if cfg == nil || artifact == "default" {
+		return ""
+	}
+	if _, ok := cfg.Artifacts[artifact]; !ok {
+		return fmt.Sprintf("artifact '%s' is not declared by repository '%s'", artifact, repository)
+	}
+
+	return ""
+}
+
+// repositoryMainPath returns the path of the main branch of an "owner/repo" repository in the cache.
+func (dm *DiscoveryManager) repositoryMainPath(repository string) string {
+	owner, repo, _ := strings.Cut(repository, "/")
+	return dm.GetRepositoryPath(owner, repo, "")
+}
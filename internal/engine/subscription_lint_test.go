@@ -0,0 +1,228 @@
+package engine
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeCachedRepo writes a tako.yml to the main branch of a repository in the cache.
+func writeCachedRepo(t *testing.T, cacheDir, repository, takoYml string) {
+	t.Helper()
+	repoPath := filepath.Join(cacheDir, "repos", repository, "main")
+	if err := os.MkdirAll(repoPath, 0755); err != nil {
+		t.Fatalf("Failed to create repository %s: %v", repository, err)
+	}
+	if err := os.WriteFile(filepath.Join(repoPath, "tako.yml"), []byte(takoYml), 0644); err != nil {
+		t.Fatalf("Failed to write tako.yml for %s: %v", repository, err)
+	}
+}
+
+func TestDiscoveryManager_ListSubscriptions(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/library", `version: "1.0"
+artifacts:
+  lib:
+    path: "."
+workflows:
+  build:
+    steps:
+      - run: echo "build"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    steps:
+      - run: echo "update"
+subscriptions:
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "update"
+  - artifact: "test-org/library:default"
+    events: ["library_released"]
+    workflow: "update"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/broken", `version: "1.0"
+subscriptions:
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "missing"
+`)
+
+	dm := NewDiscoveryManager(cacheDir)
+	matches, err := dm.ListSubscriptions()
+	if err != nil {
+		t.Fatalf("ListSubscriptions failed: %v", err)
+	}
+
+	if len(matches) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %d", len(matches))
+	}
+	for _, match := range matches {
+		if match.Repository != "test-org/app" {
+			t.Errorf("Expected subscriptions from test-org/app, got %s", match.Repository)
+		}
+	}
+	if matches[0].Subscription.Artifact != "test-org/library:lib" {
+		t.Errorf("Expected subscriptions in file order, got %s first", matches[0].Subscription.Artifact)
+	}
+}
+
+func TestDiscoveryManager_LintSubscriptions(t *testing.T) {
+	cacheDir := t.TempDir()
+	writeCachedRepo(t, cacheDir, "test-org/library", `version: "1.0"
+artifacts:
+  lib:
+    path: "."
+workflows:
+  build:
+    steps:
+      - run: echo "build"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/app", `version: "1.0"
+workflows:
+  update:
+    inputs:
+      version:
+        type: string
+    steps:
+      - run: echo "update"
+subscriptions:
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    filters: ["payload.version != ''"]
+    workflow: "update"
+    inputs:
+      version: "{{ .payload.version }}"
+  - artifact: "test-org/library:default"
+    events: ["library_built"]
+    workflow: "update"
+  - artifact: "test-org/library:missing"
+    events: ["library_built"]
+    workflow: "update"
+  - artifact: "test-org/unknown:lib"
+    events: ["library_built"]
+    workflow: "update"
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "deleted"
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    filters: ["payload.version +"]
+    workflow: "update"
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    filters: ["unknown_variable == 'x'"]
+    workflow: "update"
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "update"
+    inputs:
+      version: "{{ .inputs.version }}"
+      extra: "{{ .payload.extra }}"
+  - artifact: "test-org/library:lib"
+    events: ["library_built"]
+    workflow: "update"
+    transform:
+      language: cel
+      inputs:
+        version: "unknown.version"
+`)
+	writeCachedRepo(t, cacheDir, "test-org/unparsable", "version: [")
+
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	dm := NewDiscoveryManager(cacheDir)
+	issues, err := dm.LintSubscriptions(evaluator)
+	if err != nil {
+		t.Fatalf("LintSubscriptions failed: %v", err)
+	}
+
+	expected := []struct {
+		repository string
+		index      int
+		contains   string
+	}{
+		{"test-org/app", 2, "artifact 'missing' is not declared by repository 'test-org/library'"},
+		{"test-org/app", 3, "artifact repository 'test-org/unknown' was not found in the cache"},
+		{"test-org/app", 4, "workflow 'deleted' does not exist"},
+		{"test-org/app", 5, "filter 0: CEL compilation error"},
+		{"test-org/app", 6, "filter 0: CEL compilation error"},
+		{"test-org/app", 7, "input 'extra' is not declared by workflow 'update'"},
+		{"test-org/app", 7, "input 'version': unsupported template field '.inputs.version'"},
+		{"test-org/app", 8, "transform: input 'version': CEL compilation error"},
+		{"test-org/unparsable", -1, "could not unmarshal config"},
+	}
+
+	if len(issues) != len(expected) {
+		for _, issue := range issues {
+			t.Log(issue.String())
+		}
+		t.Fatalf("Expected %d issues, got %d", len(expected), len(issues))
+	}
+	for i, want := range expected {
+		issue := issues[i]
+		if issue.Repository != want.repository || issue.Index != want.index || !strings.Contains(issue.Message, want.contains) {
+			t.Errorf("Issue %d: expected %s subscription %d containing %q, got %s", i, want.repository, want.index, want.contains, issue.String())
+		}
+	}
+}
+
+func TestSubscriptionEvaluator_CheckFilter(t *testing.T) {
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		filter  string
+		wantErr bool
+	}{
+		{"payload.version == '1.0.0'", false},
+		{"event_type == 'library_built' && source != ''", false},
+		{"payload.count", false},
+		{"payload.version ==", true},
+		{"missing == 'x'", true},
+		{"event_type", true},
+	}
+
+	for _, tt := range tests {
+		err := evaluator.CheckFilter(tt.filter)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckFilter(%q) error = %v, wantErr %v", tt.filter, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSubscriptionEvaluator_CheckInputTemplate(t *testing.T) {
+	evaluator, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create evaluator: %v", err)
+	}
+
+	tests := []struct {
+		template string
+		wantErr  bool
+	}{
+		{"static value", false},
+		{"{{ .payload.version }}", false},
+		{"v{{.payload.major}}.{{ .payload.minor }}", false},
+		{"{{ .payload.version | upper }}", false},
+		{"{{ if .payload.tags }}{{ range .payload.tags }}{{ .name }}{{ end }}{{ end }}", false},
+		{"{{ .payload.version | default \"latest\" }}", false},
+		{"{{ .inputs.version }}", true},
+		{"{{ if .payload.tags }}{{ .inputs.version }}{{ end }}", true},
+		{"{{ .payload.version | unknown }}", true},
+	}
+
+	for _, tt := range tests {
+		err := evaluator.CheckInputTemplate(tt.template)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("CheckInputTemplate(%q) error = %v, wantErr %v", tt.template, err, tt.wantErr)
+		}
+	}
+}
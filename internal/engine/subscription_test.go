@@ -156,6 +156,36 @@ func TestSubscriptionEvaluator_EvaluateSubscription(t *testing.T) {
 			event:       event,
 			expectError: true,
 		},
+		{
+			name: "consumed fields present",
+			subscription: config.Subscription{
+				Events:   []string{"library_built"},
+				Workflow: "update",
+				Consumes: map[string]string{"version": "string", "status": "string"},
+			},
+			event: event,
+			want:  true,
+		},
+		{
+			name: "consumed field missing",
+			subscription: config.Subscription{
+				Events:   []string{"library_built"},
+				Workflow: "update",
+				Consumes: map[string]string{"commit": "string"},
+			},
+			event:       event,
+			expectError: true,
+		},
+		{
+			name: "consumed field with another type",
+			subscription: config.Subscription{
+				Events:   []string{"library_built"},
+				Workflow: "update",
+				Consumes: map[string]string{"version": "number"},
+			},
+			event:       event,
+			expectError: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -313,6 +343,7 @@ func TestSubscriptionEvaluator_ProcessEventPayload(t *testing.T) {
 		"version": "2.1.0",
 		"status":  "success",
 		"tags":    []string{"latest", "stable"},
+		"size":    float64(1500000),
 	}
 
 	tests := []struct {
@@ -374,6 +405,36 @@ func TestSubscriptionEvaluator_ProcessEventPayload(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name:    "list and number payload fields",
+			payload: payload,
+			subscription: config.Subscription{
+				Inputs: map[string]string{
+					"tags": "{{ .payload.tags }}",
+					"size": "{{ .payload.size }}",
+				},
+			},
+			want: map[string]string{
+				"tags": `["latest","stable"]`,
+				"size": "1500000",
+			},
+		},
+		{
+			name:    "template functions",
+			payload: payload,
+			subscription: config.Subscription{
+				Inputs: map[string]string{
+					"version": "v{{ .payload.version | upper }}",
+					"channel": `{{ .payload.channel | default "stable" }}`,
+					"tags":    "{{ to_json .payload.tags }}",
+				},
+			},
+			want: map[string]string{
+				"version": "v2.1.0",
+				"channel": "stable",
+				"tags":    `["latest","stable"]`,
+			},
+		},
 		{
 			name:    "empty inputs",
 			payload: payload,
@@ -416,6 +477,146 @@ func TestSubscriptionEvaluator_ProcessEventPayload(t *testing.T) {
 	}
 }
 
+func TestSubscriptionEvaluator_ProcessEvent(t *testing.T) {
+	se, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create subscription evaluator: %v", err)
+	}
+
+	event := Event{
+		Type:   "library_built",
+		Source: "my-org/go-lib",
+		Payload: map[string]interface{}{
+			"version": "2.1.0",
+			"modules": []interface{}{
+				map[string]interface{}{"name": "core", "changed": true},
+				map[string]interface{}{"name": "cli", "changed": false},
+			},
+			"build": map[string]interface{}{"number": 42, "ok": true},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		transform   *config.SubscriptionTransform
+		want        map[string]string
+		expectError bool
+	}{
+		{
+			name: "no transform",
+			want: map[string]string{"version": "2.1.0"},
+		},
+		{
+			name: "CEL list rendered as JSON",
+			transform: &config.SubscriptionTransform{
+				Language: config.TransformLanguageCEL,
+				Inputs: map[string]string{
+					"changed": "payload.modules.filter(m, m.changed).map(m, m.name)",
+				},
+			},
+			want: map[string]string{"version": "2.1.0", "changed": `["core"]`},
+		},
+		{
+			name: "CEL map and scalars",
+			transform: &config.SubscriptionTransform{
+				Language: config.TransformLanguageCEL,
+				Inputs: map[string]string{
+					"build":  "{'number': payload.build.number, 'source': source}",
+					"count":  "size(payload.modules)",
+					"ok":     "payload.build.ok",
+					"origin": "event_type + '@' + source",
+				},
+			},
+			want: map[string]string{
+				"version": "2.1.0",
+				"build":   `{"number":42,"source":"my-org/go-lib"}`,
+				"count":   "2",
+				"ok":      "true",
+				"origin":  "library_built@my-org/go-lib",
+			},
+		},
+		{
+			name: "template with JSON rendering",
+			transform: &config.SubscriptionTransform{
+				Inputs: map[string]string{
+					"modules": "{{ range $i, $m := .payload.modules }}{{ if $i }},{{ end }}{{ $m.name | upper }}{{ end }}",
+					"build":   "{{ to_json .payload.build }}",
+				},
+			},
+			want: map[string]string{
+				"version": "2.1.0",
+				"modules": "CORE,CLI",
+				"build":   `{"number":42,"ok":true}`,
+			},
+		},
+		{
+			name: "CEL evaluation error",
+			transform: &config.SubscriptionTransform{
+				Language: config.TransformLanguageCEL,
+				Inputs:   map[string]string{"missing": "payload.missing.name"},
+			},
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			subscription := config.Subscription{
+				Inputs:    map[string]string{"version": "{{ .payload.version }}"},
+				Transform: tt.transform,
+			}
+
+			got, err := se.ProcessEvent(event, subscription)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Errorf("ProcessEvent() = %v, want %v", got, tt.want)
+			}
+			for key, expectedValue := range tt.want {
+				if got[key] != expectedValue {
+					t.Errorf("ProcessEvent() key %s = %q, want %q", key, got[key], expectedValue)
+				}
+			}
+		})
+	}
+}
+
+func TestSubscriptionEvaluator_CheckTransform(t *testing.T) {
+	se, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create subscription evaluator: %v", err)
+	}
+
+	valid := []config.SubscriptionTransform{
+		{Language: config.TransformLanguageCEL, Inputs: map[string]string{"a": "payload.modules.map(m, m.name)"}},
+		{Inputs: map[string]string{"a": "{{ to_json .payload.modules }}"}},
+	}
+	for _, transform := range valid {
+		if err := se.CheckTransform(transform); err != nil {
+			t.Errorf("CheckTransform(%v) unexpected error: %v", transform, err)
+		}
+	}
+
+	invalid := []config.SubscriptionTransform{
+		{Language: config.TransformLanguageCEL, Inputs: map[string]string{"a": "unknown.field"}},
+		{Inputs: map[string]string{"a": "{{ .payload.modules | no_such_function }}"}},
+		{Language: "jq", Inputs: map[string]string{"a": ".payload"}},
+	}
+	for _, transform := range invalid {
+		if err := se.CheckTransform(transform); err == nil {
+			t.Errorf("CheckTransform(%v) expected error", transform)
+		}
+	}
+}
+
 func TestParseSemVer(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -3,7 +3,20 @@ package engine
 import (
 	"bytes"
 	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
+	"html"
+	"io"
+	"io/fs"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"text/template"
@@ -14,15 +27,32 @@ import (
 type TemplateEngine struct {
 	cache     *templateCache
 	functions template.FuncMap
+	limits    TemplateLimits
 	mu        sync.RWMutex
 }
 
 // TemplateContext represents the complete context available in templates.
 type TemplateContext struct {
-	Inputs  map[string]string            `json:"inputs"`
+	Inputs  map[string]interface{}       `json:"inputs"`
 	Steps   map[string]map[string]string `json:"steps"`
 	Event   *EventContext                `json:"event,omitempty"`
 	Trigger *TriggerContext              `json:"trigger,omitempty"` // Legacy compatibility
+
+	// Artifacts maps the artifacts of the repository to their absolute path
+	Artifacts map[string]string `json:"artifacts,omitempty"`
+	// WorkingDirectory is the absolute directory the step runs in; inside the container for
+	// containerized steps
+	WorkingDirectory string `json:"working_directory,omitempty"`
+
+	// What the env and hash_files functions read
+	scope templateScope
+}
+
+// templateScope is the part of a run that the functions reading the environment see: its
+// environment variables, given as KEY=value, and the directory hash_files globs are relative to.
+type templateScope struct {
+	environment []string
+	workDir     string
 }
 
 // EventContext provides event-specific data for subscription-triggered workflows.
@@ -63,10 +93,17 @@ type templateCache struct {
 	mu        sync.RWMutex
 }
 
-// NewTemplateEngine creates a new template engine with caching and security functions.
+// NewTemplateEngine creates a new template engine with caching and security functions, and the
+// default limits.
 func NewTemplateEngine() *TemplateEngine {
+	return NewTemplateEngineWithLimits(DefaultTemplateLimits())
+}
+
+// NewTemplateEngineWithLimits creates a new template engine evaluating templates within limits.
+func NewTemplateEngineWithLimits(limits TemplateLimits) *TemplateEngine {
 	engine := &TemplateEngine{
-		cache: newTemplateCache(100 * 1024 * 1024), // 100MB cache
+		cache:  newTemplateCache(100 * 1024 * 1024), // 100MB cache
+		limits: limits,
 	}
 
 	// Initialize security and utility functions
@@ -84,6 +121,8 @@ func NewTemplateEngine() *TemplateEngine {
 		"html_escape": func(s interface{}) string {
 			return htmlEscape(toString(s))
 		},
+		"to_json":   toJSON,
+		"from_json": fromJSON,
 
 		// Event processing functions
 		"event_field":     eventField,
@@ -139,18 +178,57 @@ func NewTemplateEngine() *TemplateEngine {
 		"first":     first,
 		"last":      last,
 
+		// Date functions
+		"now":  time.Now,
+		"date": formatDate,
+
 		// Conditional functions
 		"if_then_else": ifThenElse,
 		"or":           or,
 		"and":          and,
 		"not":          not,
+
+		// Aliases for the names other CI systems give these functions
+		"toJson":   toJSON,
+		"fromJson": fromJSON,
+	}
+
+	// Templates expanded without a run see an empty environment and no files
+	maps.Copy(engine.functions, templateScope{}.functions())
+	maps.Copy(engine.functions, newLimitedBuffer(TemplateLimits{}).functions())
+	if limits.MaxOutputSize > 0 {
+		limitValueSizes(engine.functions, limits.MaxOutputSize)
 	}
 
 	return engine
 }
 
-// ExpandTemplate processes a template string with the provided context.
+// functions returns the template functions reading the environment of a run.
+func (s templateScope) functions() template.FuncMap {
+	return template.FuncMap{
+		"env":        s.env,
+		"hash_files": s.hashFiles,
+		"hashFiles":  s.hashFiles,
+	}
+}
+
+// ExpandTemplate processes a template string with the provided context. The env and hash_files
+// functions read the environment and directory of the context.
 func (te *TemplateEngine) ExpandTemplate(tmplStr string, context *TemplateContext) (string, error) {
+	var scope templateScope
+	if context != nil {
+		scope = context.scope
+	}
+	return te.expand(tmplStr, context, scope)
+}
+
+// ExpandTemplateData processes a template string with arbitrary data as the template context.
+func (te *TemplateEngine) ExpandTemplateData(tmplStr string, data interface{}) (string, error) {
+	return te.expand(tmplStr, data, templateScope{})
+}
+
+// expand processes a template string with the functions reading the environment bound to a scope.
+func (te *TemplateEngine) expand(tmplStr string, data interface{}, scope templateScope) (string, error) {
 	if tmplStr == "" {
 		return "", nil
 	}
@@ -161,9 +239,22 @@ func (te *TemplateEngine) ExpandTemplate(tmplStr string, context *TemplateContex
 		return "", fmt.Errorf("failed to parse template: %v", err)
 	}
 
+	// Cached templates are shared, so the functions of a scope and of the limits of this
+	// evaluation are bound to a copy
+	tmpl, err = tmpl.Clone()
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %v", err)
+	}
+	buf := newLimitedBuffer(te.limits)
+	functions := scope.functions()
+	maps.Copy(functions, buf.functions())
+	tmpl.Funcs(functions)
+
 	// Execute template with context
-	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, context); err != nil {
+	if err := tmpl.Execute(buf, data); err != nil {
+		if buf.err != nil {
+			return "", fmt.Errorf("failed to execute template: %v", buf.err)
+		}
 		return "", fmt.Errorf("failed to execute template: %v", err)
 	}
 
@@ -193,6 +284,10 @@ func (te *TemplateEngine) getOrCreateTemplate(tmplStr string) (*template.Templat
 	if err != nil {
 		return nil, fmt.Errorf("template parse error: %v", err)
 	}
+	if err := checkBannedFunctions(tmpl, te.limits.BannedFunctions); err != nil {
+		return nil, fmt.Errorf("template parse error: %v", err)
+	}
+	addDeadlineChecks(tmpl)
 
 	// Cache the template
 	te.cache.put(tmplStr, tmpl)
@@ -234,10 +329,11 @@ func newTemplateCache(maxSize int64) *templateCache {
 	}
 }
 
-// get retrieves a template from the cache.
+// get retrieves a template from the cache. It takes the write lock, since it moves the entry
+// to the front of the LRU list.
 func (tc *templateCache) get(key string) *template.Template {
-	tc.mu.RLock()
-	defer tc.mu.RUnlock()
+	tc.mu.Lock()
+	defer tc.mu.Unlock()
 
 	if elem, exists := tc.entries[key]; exists {
 		tc.lru.MoveToFront(elem)
@@ -316,24 +412,168 @@ func shellQuote(s string) string {
 	return fmt.Sprintf("'%s'", strings.ReplaceAll(s, "'", "'\"'\"'"))
 }
 
+// toJSON renders a value as a JSON document. HTML characters are kept as is, since the
+// document is meant for commands and payloads rather than web pages.
+func toJSON(val interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(val); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// fromJSON decodes a JSON document, such as a step output, into maps, lists and scalars.
+func fromJSON(s interface{}) (interface{}, error) {
+	var val interface{}
+	if err := json.Unmarshal([]byte(toString(s)), &val); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %v", err)
+	}
+	return val, nil
+}
+
+// jsonEscape escapes a string for use inside a JSON string literal, including all control
+// characters.
 func jsonEscape(s string) string {
-	s = strings.ReplaceAll(s, "\\", "\\\\")
-	s = strings.ReplaceAll(s, "\"", "\\\"")
-	s = strings.ReplaceAll(s, "\n", "\\n")
-	s = strings.ReplaceAll(s, "\t", "\\t")
-	s = strings.ReplaceAll(s, "\r", "\\r")
-	return s
+	quoted, _ := toJSON(s) // Strings always encode
+	return quoted[1 : len(quoted)-1]
 }
 
 func urlEncode(s string) string {
-	s = strings.ReplaceAll(s, "&", "%26")
-	s = strings.ReplaceAll(s, "=", "%3D")
-	s = strings.ReplaceAll(s, " ", "+")
-	return s
+	return url.QueryEscape(s)
 }
 
 func htmlEscape(s string) string {
-	return strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(s, "&", "&amp;"), "<", "&lt;"), ">", "&gt;")
+	return html.EscapeString(s)
+}
+
+// env returns the value of an environment variable of the run, or an empty string when it is
+// not set.
+func (s templateScope) env(name string) string {
+	value, _ := lookupEnvironment(s.environment, name)
+	return value
+}
+
+// hashFiles returns the SHA-256 digest of the files of the run's directory matching any of the
+// glob patterns, for cache keys. Patterns are relative to the directory, and ** matches any
+// number of directories. The digest is empty when no file matches.
+func (s templateScope) hashFiles(patterns ...string) (string, error) {
+	if s.workDir == "" {
+		return "", fmt.Errorf("hash_files is not available without a working directory")
+	}
+	matchers := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		if filepath.IsAbs(pattern) || strings.HasPrefix(filepath.Clean(pattern), "..") {
+			return "", fmt.Errorf("hash_files pattern '%s' must be relative to the working directory", pattern)
+		}
+		matchers = append(matchers, globPattern(filepath.ToSlash(pattern)))
+	}
+
+	var files []string
+	err := filepath.WalkDir(s.workDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if entry.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(s.workDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		for _, matcher := range matchers {
+			if matcher.MatchString(rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list files to hash: %v", err)
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+	sort.Strings(files)
+
+	// The digest covers the digests of the files, so that it changes with any of them
+	digest := sha256.New()
+	for _, file := range files {
+		f, err := os.Open(filepath.Join(s.workDir, file))
+		if err != nil {
+			return "", fmt.Errorf("failed to hash '%s': %v", file, err)
+		}
+		fileDigest := sha256.New()
+		_, err = io.Copy(fileDigest, f)
+		_ = f.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to hash '%s': %v", file, err)
+		}
+		digest.Write(fileDigest.Sum(nil))
+	}
+	return hex.EncodeToString(digest.Sum(nil)), nil
+}
+
+// globPattern compiles a glob pattern over slash-separated paths: * and ? match within a path
+// element, and ** matches any number of them.
+func globPattern(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			expr.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
+
+// formatDate formats a time with a Go layout, such as "2006-01-02". The time is a time.Time, an
+// RFC 3339 string or Unix seconds, as in event timestamps and payloads.
+func formatDate(layout string, val interface{}) (string, error) {
+	var t time.Time
+	switch v := val.(type) {
+	case time.Time:
+		t = v
+	case *time.Time:
+		t = *v
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			seconds, convErr := strconv.ParseInt(v, 10, 64)
+			if convErr != nil {
+				return "", fmt.Errorf("'%s' is not an RFC 3339 time or Unix seconds", v)
+			}
+			parsed = time.Unix(seconds, 0).UTC()
+		}
+		t = parsed
+	case int:
+		t = time.Unix(int64(v), 0).UTC()
+	case int64:
+		t = time.Unix(v, 0).UTC()
+	case float64:
+		t = time.Unix(int64(v), 0).UTC()
+	default:
+		return "", fmt.Errorf("cannot format %T as a date", val)
+	}
+	return t.Format(layout), nil
 }
 
 func defaultValue(def interface{}, val interface{}) interface{} {
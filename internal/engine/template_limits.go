@@ -0,0 +1,244 @@
+package engine
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+// TemplateLimits bounds the evaluation of templates. Templates come from the tako.yml of any
+// repository, including the subscriptions evaluated during fan-outs, so that a template must
+// not be able to hang or exhaust the memory of tako.
+type TemplateLimits struct {
+	// Timeout is how long a template may take to evaluate, or zero for no limit. Evaluation
+	// stops at the next loop iteration or output after it is reached.
+	Timeout time.Duration
+	// MaxOutputSize is the maximum size in bytes of the output of a template, or zero for no
+	// limit. It also bounds the strings built by the functions of the template, so that values
+	// assigned to variables cannot grow past it either.
+	MaxOutputSize int
+	// BannedFunctions are the functions that templates cannot call. Templates calling them are
+	// rejected when they are parsed.
+	BannedFunctions []string
+}
+
+// DefaultTemplateLimits returns the limits of the templates of workflow steps.
+func DefaultTemplateLimits() TemplateLimits {
+	return TemplateLimits{
+		Timeout:       10 * time.Second,
+		MaxOutputSize: 1024 * 1024, // 1MB
+	}
+}
+
+// SubscriptionTemplateLimits returns the limits of the input templates of subscriptions, which
+// are evaluated by the orchestrator for events of other repositories. They cannot read the
+// environment or the files of the orchestrator.
+func SubscriptionTemplateLimits() TemplateLimits {
+	return TemplateLimits{
+		Timeout:         time.Second,
+		MaxOutputSize:   64 * 1024, // 64KB
+		BannedFunctions: []string{"env", "hash_files", "hashFiles"},
+	}
+}
+
+// deadlineFunction is the function called at the start of every loop iteration of a template,
+// which stops the evaluation once the template has run out of time.
+const deadlineFunction = "_check_deadline"
+
+// checkBannedFunctions reports the first call of a banned function in a template, including
+// the templates it defines.
+func checkBannedFunctions(tmpl *template.Template, banned []string) error {
+	if len(banned) == 0 {
+		return nil
+	}
+	var err error
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		walkTemplate(t.Tree.Root, func(node parse.Node) {
+			if ident, ok := node.(*parse.IdentifierNode); ok && err == nil {
+				for _, name := range banned {
+					if ident.Ident == name {
+						err = fmt.Errorf("function '%s' is not allowed", name)
+					}
+				}
+			}
+		})
+	}
+	return err
+}
+
+// addDeadlineChecks makes the loops of a template check the deadline of the evaluation at the
+// start of every iteration. Loops producing no output would otherwise run to completion.
+func addDeadlineChecks(tmpl *template.Template) {
+	check := &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Args:     []parse.Node{parse.NewIdentifier(deadlineFunction)},
+			}},
+		},
+	}
+	for _, t := range tmpl.Templates() {
+		if t.Tree == nil {
+			continue
+		}
+		walkTemplate(t.Tree.Root, func(node parse.Node) {
+			if loop, ok := node.(*parse.RangeNode); ok && loop.List != nil {
+				loop.List.Nodes = append([]parse.Node{check}, loop.List.Nodes...)
+			}
+		})
+	}
+}
+
+// limitValueSizes makes the functions of templates fail when they build a string larger than
+// max bytes, including the printf, print and println builtins they replace. Strings assigned to
+// variables never reach the output, so the output limit alone would let a loop doubling a
+// variable exhaust the memory of tako.
+func limitValueSizes(functions template.FuncMap, max int) {
+	functions["printf"] = fmt.Sprintf
+	functions["print"] = fmt.Sprint
+	functions["println"] = fmt.Sprintln
+	for name, fn := range functions {
+		functions[name] = limitResultSize(fn, max)
+	}
+}
+
+// limitResultSize wraps a function so that it fails when it returns a string larger than max
+// bytes, wrapping the functions it returns in turn. Template functions without an error result
+// fail by panicking, which templates report as an error of the call.
+func limitResultSize(fn interface{}, max int) interface{} {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return fn
+	}
+	fnType := value.Type()
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		var results []reflect.Value
+		if fnType.IsVariadic() {
+			results = value.CallSlice(args)
+		} else {
+			results = value.Call(args)
+		}
+		for i, result := range results {
+			switch result.Kind() {
+			case reflect.String:
+				if result.Len() > max {
+					panic(fmt.Errorf("template value exceeds the limit of %d bytes", max))
+				}
+			case reflect.Func:
+				if !result.IsNil() {
+					results[i] = reflect.ValueOf(limitResultSize(result.Interface(), max))
+				}
+			}
+		}
+		return results
+	}).Interface()
+}
+
+// walkTemplate calls visit for a node of a template parse tree and all the nodes below it.
+func walkTemplate(node parse.Node, visit func(parse.Node)) {
+	switch n := node.(type) {
+	case nil:
+		return
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		visit(n)
+		for _, child := range n.Nodes {
+			walkTemplate(child, visit)
+		}
+		return
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		visit(n)
+		for _, cmd := range n.Cmds {
+			walkTemplate(cmd, visit)
+		}
+		return
+	}
+
+	visit(node)
+	switch n := node.(type) {
+	case *parse.ActionNode:
+		walkTemplate(n.Pipe, visit)
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			walkTemplate(arg, visit)
+		}
+	case *parse.ChainNode:
+		walkTemplate(n.Node, visit)
+	case *parse.IfNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.RangeNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.WithNode:
+		walkBranch(&n.BranchNode, visit)
+	case *parse.TemplateNode:
+		walkTemplate(n.Pipe, visit)
+	}
+}
+
+// walkBranch walks the pipeline and blocks of an if, range or with node.
+func walkBranch(branch *parse.BranchNode, visit func(parse.Node)) {
+	walkTemplate(branch.Pipe, visit)
+	walkTemplate(branch.List, visit)
+	walkTemplate(branch.ElseList, visit)
+}
+
+// limitedBuffer is the output of a template evaluation, failing writes past the size limit or
+// the deadline of the evaluation.
+type limitedBuffer struct {
+	bytes.Buffer
+	limits   TemplateLimits
+	deadline time.Time
+	err      error // Why the evaluation was stopped, if it was
+}
+
+// newLimitedBuffer starts an evaluation with limits.
+func newLimitedBuffer(limits TemplateLimits) *limitedBuffer {
+	b := &limitedBuffer{limits: limits}
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+	return b
+}
+
+// Write appends to the output, unless the evaluation went over a limit.
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if err := b.checkDeadline(); err != nil {
+		return 0, err
+	}
+	if b.limits.MaxOutputSize > 0 && b.Len()+len(p) > b.limits.MaxOutputSize {
+		b.err = fmt.Errorf("template output exceeds the limit of %d bytes", b.limits.MaxOutputSize)
+		return 0, b.err
+	}
+	return b.Buffer.Write(p)
+}
+
+// checkDeadline fails once the evaluation has run out of time.
+func (b *limitedBuffer) checkDeadline() error {
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		b.err = fmt.Errorf("template evaluation exceeded the time limit of %v", b.limits.Timeout)
+		return b.err
+	}
+	return nil
+}
+
+// functions returns the template functions checking the limits of the evaluation.
+func (b *limitedBuffer) functions() template.FuncMap {
+	return template.FuncMap{
+		deadlineFunction: func() (string, error) {
+			return "", b.checkDeadline()
+		},
+	}
+}
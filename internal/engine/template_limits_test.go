@@ -0,0 +1,126 @@
+package engine
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dangazineu/tako/internal/config"
+)
+
+func TestTemplateEngine_Limits(t *testing.T) {
+	engine := NewTemplateEngineWithLimits(TemplateLimits{
+		Timeout:         100 * time.Millisecond,
+		MaxOutputSize:   100,
+		BannedFunctions: []string{"env", "hash_files"},
+	})
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		errMsg   string
+	}{
+		{name: "within the limits", template: "{{ range 3 }}{{ . }}{{ end }}", expected: "012"},
+		{name: "loop without output", template: "{{ range 100000000000 }}{{ end }}", errMsg: "exceeded the time limit of 100ms"},
+		{name: "nested loops", template: "{{ range 100000 }}{{ range 100000 }}{{ end }}{{ end }}", errMsg: "exceeded the time limit"},
+		{name: "loop in a defined template", template: `{{ define "spin" }}{{ range 100000000000 }}{{ end }}{{ end }}{{ template "spin" }}`, errMsg: "exceeded the time limit"},
+		{name: "output over the limit", template: "{{ range 1000 }}0123456789{{ end }}", errMsg: "output exceeds the limit of 100 bytes"},
+		{name: "value over the limit", template: `{{ $x := printf "%0200d" 0 }}{{ len $x }}`, errMsg: "value exceeds the limit of 100 bytes"},
+		{name: "curried function over the limit", template: `{{ call (replace "a" "aaaaaaaaaaaaaaaaaaaa") "aaaaaaaaaa" }}`, errMsg: "value exceeds the limit of 100 bytes"},
+		{name: "banned function", template: `{{ env "HOME" }}`, errMsg: "function 'env' is not allowed"},
+		{name: "banned function in a block", template: `{{ if true }}{{ "go.sum" | hash_files }}{{ end }}`, errMsg: "function 'hash_files' is not allowed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			result, err := engine.ExpandTemplate(tt.template, &TemplateContext{})
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected the evaluation to stop at the limits, took %v", elapsed)
+			}
+			if tt.errMsg != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+					t.Errorf("Expected error containing %q, got %v", tt.errMsg, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+
+	if err := engine.ValidateTemplate(`{{ env "HOME" }}`); err == nil {
+		t.Error("Expected the validation of a template calling a banned function to fail")
+	}
+
+	// Templates within the limits can be expanded again from the cache
+	for i := 0; i < 2; i++ {
+		if result, err := engine.ExpandTemplate("{{ range 2 }}x{{ end }}", &TemplateContext{}); err != nil || result != "xx" {
+			t.Errorf("Expansion %d: expected %q, got %q (%v)", i, "xx", result, err)
+		}
+	}
+}
+
+func TestTemplateEngine_LimitsDoublingVariable(t *testing.T) {
+	engine := NewTemplateEngineWithLimits(SubscriptionTemplateLimits())
+
+	// The variable never reaches the output, which would otherwise stay within its limit
+	// while the variable grows to gigabytes
+	template := `{{ $x := "aaaaaaaa" }}{{ range 40 }}{{ $x = printf "%s%s" $x $x }}{{ end }}{{ len $x }}`
+	start := time.Now()
+	_, err := engine.ExpandTemplate(template, &TemplateContext{})
+	if err == nil || !strings.Contains(err.Error(), "value exceeds the limit of 65536 bytes") {
+		t.Errorf("Expected the variable to be capped, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the evaluation to stop at the size limit, took %v", elapsed)
+	}
+
+	template = `{{ $x := "aaaaaaaa" }}{{ range 40 }}{{ $x = join (split (printf "%s,%s" $x $x) ",") "" }}{{ end }}`
+	if _, err := engine.ExpandTemplate(template, &TemplateContext{}); err == nil || !strings.Contains(err.Error(), "value exceeds the limit") {
+		t.Errorf("Expected join to be capped, got %v", err)
+	}
+
+	// Values within the limit are unaffected
+	result, err := engine.ExpandTemplate(`{{ $x := "ab" }}{{ range 3 }}{{ $x = printf "%s%s" $x $x }}{{ end }}{{ $x | upper }}`, &TemplateContext{})
+	if err != nil || result != strings.Repeat("AB", 8) {
+		t.Errorf("Expected %q, got %q (%v)", strings.Repeat("AB", 8), result, err)
+	}
+}
+
+func TestSubscriptionEvaluator_Limits(t *testing.T) {
+	se, err := NewSubscriptionEvaluator()
+	if err != nil {
+		t.Fatalf("Failed to create subscription evaluator: %v", err)
+	}
+
+	payload := map[string]interface{}{"version": "1.0.0"}
+	subscription := config.Subscription{Inputs: map[string]string{"home": `{{ env "HOME" }}`}}
+	if _, err := se.ProcessEventPayload(payload, subscription); err == nil || !strings.Contains(err.Error(), "function 'env' is not allowed") {
+		t.Errorf("Expected the environment to be unavailable to subscriptions, got %v", err)
+	}
+	if err := se.CheckInputTemplate(`{{ hash_files "**" }}`); err == nil {
+		t.Error("Expected CheckInputTemplate to reject hash_files")
+	}
+
+	subscription = config.Subscription{Inputs: map[string]string{"big": "{{ range 100000 }}{{ $.payload.version }}{{ end }}"}}
+	if _, err := se.ProcessEventPayload(payload, subscription); err == nil || !strings.Contains(err.Error(), "output exceeds the limit") {
+		t.Errorf("Expected the output of subscription templates to be capped, got %v", err)
+	}
+
+	// CEL filters are bounded by their cost limit
+	items := make([]interface{}, 300)
+	for i := range items {
+		items[i] = i
+	}
+	event := Event{Type: "built", Payload: map[string]interface{}{"items": items}}
+	filter := "payload.items.all(a, payload.items.all(b, payload.items.all(c, a + b + c >= 0)))"
+	if _, err := se.evaluateCELFilter(filter, event); err == nil || !strings.Contains(err.Error(), "cost limit") {
+		t.Errorf("Expected the filter to exceed the cost limit, got %v", err)
+	}
+}
@@ -1,6 +1,10 @@
 package engine
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -10,7 +14,7 @@ func TestTemplateEngine_BasicExpansion(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"version":     "1.2.3",
 			"environment": "prod",
 		},
@@ -139,7 +143,7 @@ func TestTemplateEngine_SecurityFunctions(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"unsafe_input": "test'; rm -rf /; echo 'hacked",
 			"json_data":    "test\"with\\quotes\nand\tspecial\rchars",
 			"url_param":    "hello world & special chars",
@@ -172,6 +176,11 @@ func TestTemplateEngine_SecurityFunctions(t *testing.T) {
 			template: "{{ .Inputs.html_content | html_escape }}",
 			contains: "&lt;script&gt;",
 		},
+		{
+			name:     "to json",
+			template: "{{ to_json .Inputs.json_data }}",
+			contains: `"test\"with\\quotes\nand\tspecial\rchars"`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -191,7 +200,7 @@ func TestTemplateEngine_UtilityFunctions(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"empty_val":  "",
 			"text":       "  Hello World  ",
 			"number":     "42",
@@ -254,7 +263,7 @@ func TestTemplateEngine_ConditionalFunctions(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"env":     "prod",
 			"enabled": "true",
 			"count":   "5",
@@ -377,7 +386,7 @@ func TestTemplateEngine_Caching(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"value": "test",
 		},
 	}
@@ -454,7 +463,7 @@ func TestTemplateEngine_ComplexWorkflow(t *testing.T) {
 	engine := NewTemplateEngine()
 
 	context := &TemplateContext{
-		Inputs: map[string]string{
+		Inputs: map[string]interface{}{
 			"environment": "prod",
 			"version":     "2.1.0",
 			"service":     "api",
@@ -545,3 +554,173 @@ echo "Deployment completed successfully"`
 		}
 	}
 }
+
+func TestTemplateEngine_EscapingRules(t *testing.T) {
+	engine := NewTemplateEngine()
+
+	context := &TemplateContext{
+		Inputs: map[string]interface{}{
+			"quote":   "it's",
+			"control": "a\"b\\c\nd\x01<e>&",
+			"query":   "a b&c=d/é",
+			"markup":  `<a href="x">'&'</a>`,
+			"object":  map[string]interface{}{"html": "<b>&</b>", "list": []interface{}{int64(1), true}},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{"shell quote closes and reopens quotes", "{{ .Inputs.quote | shell_quote }}", `'it'"'"'s'`},
+		{"shell quote of empty value", `{{ "" | shell_quote }}`, `''`},
+		{"json escape of control characters", "{{ .Inputs.control | json_escape }}", `a\"b\\c\nd\u0001<e>&`},
+		{"url encode of reserved characters", "{{ .Inputs.query | url_encode }}", "a+b%26c%3Dd%2F%C3%A9"},
+		{"html escape of quotes", "{{ .Inputs.markup | html_escape }}", "&lt;a href=&#34;x&#34;&gt;&#39;&amp;&#39;&lt;/a&gt;"},
+		{"to json keeps html characters", "{{ to_json .Inputs.object }}", `{"html":"<b>&</b>","list":[1,true]}`},
+		{"to json alias", "{{ toJson .Inputs.quote }}", `"it's"`},
+		{"output is not escaped", "{{ .Inputs.markup }}", `<a href="x">'&'</a>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.ExpandTemplate(tt.template, context)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTemplateEngine_JSONAndDateFunctions(t *testing.T) {
+	engine := NewTemplateEngine()
+
+	context := &TemplateContext{
+		Inputs: map[string]interface{}{
+			"document": `{"name": "api", "ports": [80, 443]}`,
+			"rfc3339":  "2024-03-05T10:30:00Z",
+			"unix":     "1709634600",
+			"missing":  nil,
+		},
+		Event: &EventContext{Timestamp: time.Date(2024, 3, 5, 10, 30, 0, 0, time.UTC)},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{name: "from json field", template: "{{ (from_json .Inputs.document).name }}", expected: "api"},
+		{name: "from json list", template: "{{ range (fromJson .Inputs.document).ports }}{{ . }} {{ end }}", expected: "80 443 "},
+		{name: "from json round trip", template: "{{ .Inputs.document | from_json | to_json }}", expected: `{"name":"api","ports":[80,443]}`},
+		{name: "invalid json", template: "{{ from_json \"{\" }}", wantErr: true},
+		{name: "default of missing value", template: `{{ .Inputs.missing | default "none" }}`, expected: "none"},
+		{name: "date of time", template: `{{ .Event.Timestamp | date "2006-01-02 15:04" }}`, expected: "2024-03-05 10:30"},
+		{name: "date of rfc3339 string", template: `{{ .Inputs.rfc3339 | date "Jan 2, 2006" }}`, expected: "Mar 5, 2024"},
+		{name: "date of unix seconds", template: `{{ .Inputs.unix | date "2006-01-02T15:04:05Z07:00" }}`, expected: "2024-03-05T10:30:00Z"},
+		{name: "date of now", template: `{{ now | date "2006" }}`, expected: time.Now().Format("2006")},
+		{name: "date of invalid value", template: `{{ "yesterday" | date "2006" }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.ExpandTemplate(tt.template, context)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestTemplateEngine_EnvironmentFunctions(t *testing.T) {
+	engine := NewTemplateEngine()
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod":               "module example",
+		"go.sum":               "example v1.0.0 h1:abc",
+		"sub/pkg/go.sum":       "nested v1.0.0 h1:def",
+		"sub/README.md":        "docs",
+		".git/objects/go.sum":  "ignored",
+		"vendor/lib/notes.txt": "notes",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	hashOf := func(names ...string) string {
+		digest := sha256.New()
+		for _, name := range names {
+			fileDigest := sha256.Sum256([]byte(files[name]))
+			digest.Write(fileDigest[:])
+		}
+		return hex.EncodeToString(digest.Sum(nil))
+	}
+
+	context := NewContextBuilder().
+		WithEnvironment([]string{"DEPLOY_ENV=prod", "EMPTY="}).
+		WithWorkDir(dir).
+		Build()
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{name: "env lookup", template: `{{ env "DEPLOY_ENV" }}`, expected: "prod"},
+		{name: "env of unset variable", template: `{{ env "UNSET" | default "dev" }}`, expected: "dev"},
+		{name: "env of empty variable", template: `[{{ env "EMPTY" }}]`, expected: "[]"},
+		{name: "hash files", template: `{{ hash_files "go.sum" }}`, expected: hashOf("go.sum")},
+		{name: "hash files recursive", template: `{{ hash_files "**/go.sum" }}`, expected: hashOf("go.sum", "sub/pkg/go.sum")},
+		{name: "hash files of several patterns", template: `{{ hashFiles "go.*" "sub/*.md" }}`, expected: hashOf("go.mod", "go.sum", "sub/README.md")},
+		{name: "hash files without match", template: `[{{ hash_files "*.lock" }}]`, expected: "[]"},
+		{name: "hash files outside the directory", template: `{{ hash_files "../go.sum" }}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := engine.ExpandTemplate(tt.template, context)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error, got %q", result)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+
+	// Templates expanded without a run see neither its environment nor its files, including
+	// the cached templates that a run expanded
+	if result, err := engine.ExpandTemplate(`[{{ env "DEPLOY_ENV" }}]`, &TemplateContext{}); err != nil || result != "[]" {
+		t.Errorf("Expected an empty environment, got %q (%v)", result, err)
+	}
+	if _, err := engine.ExpandTemplateData(`{{ hash_files "go.sum" }}`, nil); err == nil {
+		t.Error("Expected hash_files to fail without a working directory")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -111,6 +112,40 @@ func (ws *Workspace) PrepareRepository(repoPath string) (string, error) {
 	return workspaceRepoPath, nil
 }
 
+// OverlayRepository copies a repository into the workspace under the given name so that
+// the workflow can modify its files without touching the shared cache. The .git
+// directory is not copied. Returns the path of the overlaid repository.
+func (ws *Workspace) OverlayRepository(name, sourcePath string) (string, error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid repository name for workspace overlay: %q", name)
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to access source repository: %v", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("source repository %s is not a directory", sourcePath)
+	}
+
+	overlayPath := filepath.Join(ws.Path, name)
+
+	// Check if already overlaid
+	if _, err := os.Stat(overlayPath); err == nil {
+		return overlayPath, nil
+	}
+
+	if err := copyTree(sourcePath, overlayPath); err != nil {
+		os.RemoveAll(overlayPath) // Don't leave a partial overlay behind
+		return "", fmt.Errorf("failed to overlay repository %s: %v", sourcePath, err)
+	}
+
+	return overlayPath, nil
+}
+
 // GetExecutionDir returns the directory for execution-specific files.
 func (ws *Workspace) GetExecutionDir() string {
 	return filepath.Join(ws.Path, "execution")
@@ -203,6 +238,15 @@ func (wm *WorkspaceManager) CleanupWorkspace(runID string) error {
 	return nil
 }
 
+// DetachWorkspace stops tracking a workspace without removing it from disk.
+// This is used when a workspace is deliberately kept around for debugging.
+func (wm *WorkspaceManager) DetachWorkspace(runID string) {
+	wm.mu.Lock()
+	defer wm.mu.Unlock()
+
+	delete(wm.workspaces, runID)
+}
+
 // CleanupAll removes all workspaces.
 func (wm *WorkspaceManager) CleanupAll() error {
 	wm.mu.Lock()
@@ -238,6 +282,43 @@ func (wm *WorkspaceManager) ListWorkspaces() []string {
 	return runIDs
 }
 
+// copyTree copies a directory tree from src to dst, skipping .git directories.
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, relPath)
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(dstPath, info.Mode().Perm()|0700)
+		}
+
+		// Recreate symbolic links instead of following them
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil // Skip sockets, devices and other special files
+		}
+
+		return copyFile(path, dstPath)
+	})
+}
+
 // copyFile copies a file from src to dst.
 func copyFile(src, dst string) error {
 	sourceFile, err := os.Open(src)
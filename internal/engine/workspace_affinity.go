@@ -0,0 +1,218 @@
+package engine
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// contextKeyWorkspaceAffinity carries the workspace affinity of the child workflow a backend runs.
+const contextKeyWorkspaceAffinity contextKey = "workspace_affinity"
+
+// WorkspaceAffinity identifies the prepared workspace a child workflow reuses: the one the
+// previous child of the same repository and workflow left behind for the same event type.
+type WorkspaceAffinity struct {
+	EventType  string
+	Repository string
+	Workflow   string
+	StaleAfter time.Duration // How long an unused workspace is kept for reuse
+}
+
+// withWorkspaceAffinity returns a context carrying the workspace affinity of the child workflow
+// run with it.
+func withWorkspaceAffinity(ctx context.Context, affinity WorkspaceAffinity) context.Context {
+	return context.WithValue(ctx, contextKeyWorkspaceAffinity, affinity)
+}
+
+// workspaceAffinityFromContext returns the workspace affinity carried by a context, and whether
+// it carries one.
+func workspaceAffinityFromContext(ctx context.Context) (WorkspaceAffinity, bool) {
+	affinity, ok := ctx.Value(contextKeyWorkspaceAffinity).(WorkspaceAffinity)
+	return affinity, ok
+}
+
+// affinityMeta describes the workspace kept for an affinity.
+type affinityMeta struct {
+	EventType  string        `json:"event_type"`
+	Repository string        `json:"repository"`
+	Workflow   string        `json:"workflow"`
+	Source     string        `json:"source"` // The repository reference the workspace was prepared from
+	LastUsed   time.Time     `json:"last_used"`
+	StaleAfter time.Duration `json:"stale_after"`
+	Runs       int           `json:"runs"`
+}
+
+// stale reports whether the workspace went unused for longer than its stale-after duration.
+func (m affinityMeta) stale(now time.Time) bool {
+	return m.StaleAfter > 0 && now.Sub(m.LastUsed) > m.StaleAfter
+}
+
+// WorkspaceAffinityStore keeps the workspaces of the children of subscriptions with affinity,
+// so that the next fan-out of the same event type runs in them instead of a fresh copy of the
+// repository. Workspaces live in the shared cache directory; a workspace is leased to a single
+// child at a time, and the lease of a process that died is taken over.
+type WorkspaceAffinityStore struct {
+	dir string
+}
+
+// NewWorkspaceAffinityStore creates a store keeping workspaces under cacheDir.
+func NewWorkspaceAffinityStore(cacheDir string) (*WorkspaceAffinityStore, error) {
+	dir := filepath.Join(cacheDir, "affinity")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create affinity directory: %v", err)
+	}
+
+	return &WorkspaceAffinityStore{dir: dir}, nil
+}
+
+// WorkspaceLease is the exclusive use of the workspace of an affinity by a child run.
+type WorkspaceLease struct {
+	entryDir string
+	meta     affinityMeta
+	warm     string
+}
+
+// Warm returns the path of the workspace prepared by an earlier run, or an empty string when
+// the child starts from a fresh copy of the repository.
+func (l *WorkspaceLease) Warm() string {
+	return l.warm
+}
+
+// Acquire leases the workspace of an affinity to a child run preparing it from source, the
+// repository reference it runs. The workspace is warm unless it is stale, or was prepared from
+// another source. It returns nil when another run holds the lease, in which case the child
+// runs in a fresh workspace. Workspaces of other affinities that went stale are discarded.
+func (s *WorkspaceAffinityStore) Acquire(affinity WorkspaceAffinity, source string) (*WorkspaceLease, error) {
+	s.prune(time.Now())
+
+	entryDir := filepath.Join(s.dir, affinityKey(affinity))
+	if err := os.MkdirAll(entryDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create affinity directory: %v", err)
+	}
+	acquired, err := lockAffinityEntry(entryDir)
+	if err != nil || !acquired {
+		return nil, err
+	}
+
+	lease := &WorkspaceLease{entryDir: entryDir}
+	meta, err := readAffinityMeta(entryDir)
+	repoDir := filepath.Join(entryDir, "repo")
+	if _, statErr := os.Stat(repoDir); err == nil && statErr == nil && meta.Source == source && !meta.stale(time.Now()) {
+		lease.warm = repoDir
+		lease.meta = meta
+	} else if err := os.RemoveAll(repoDir); err != nil {
+		lease.Release("", false)
+		return nil, fmt.Errorf("failed to discard workspace: %v", err)
+	}
+	lease.meta.EventType = affinity.EventType
+	lease.meta.Repository = affinity.Repository
+	lease.meta.Workflow = affinity.Workflow
+	lease.meta.Source = source
+	lease.meta.StaleAfter = affinity.StaleAfter
+	return lease, nil
+}
+
+// Release ends the lease. When keep is set, the workspace at repoDir is kept for the next run
+// of the affinity; otherwise the workspace of the affinity is discarded.
+func (l *WorkspaceLease) Release(repoDir string, keep bool) error {
+	defer os.Remove(filepath.Join(l.entryDir, "lock"))
+
+	target := filepath.Join(l.entryDir, "repo")
+	if err := os.RemoveAll(target); err != nil {
+		return fmt.Errorf("failed to discard workspace: %v", err)
+	}
+	if !keep || repoDir == "" {
+		return nil
+	}
+	if err := os.Rename(repoDir, target); err != nil {
+		return fmt.Errorf("failed to keep workspace: %v", err)
+	}
+
+	l.meta.LastUsed = time.Now()
+	l.meta.Runs++
+	data, err := json.MarshalIndent(l.meta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal workspace metadata: %v", err)
+	}
+	metaFile := filepath.Join(l.entryDir, "meta.json")
+	tempFile := metaFile + ".tmp"
+	if err := os.WriteFile(tempFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write workspace metadata: %v", err)
+	}
+	if err := os.Rename(tempFile, metaFile); err != nil {
+		os.Remove(tempFile) // Clean up on failure
+		return fmt.Errorf("failed to write workspace metadata: %v", err)
+	}
+	return nil
+}
+
+// prune discards the workspaces that went stale and are not leased.
+func (s *WorkspaceAffinityStore) prune(now time.Time) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		entryDir := filepath.Join(s.dir, entry.Name())
+		meta, err := readAffinityMeta(entryDir)
+		if err != nil || !meta.stale(now) {
+			continue
+		}
+		if acquired, _ := lockAffinityEntry(entryDir); acquired {
+			os.RemoveAll(entryDir)
+		}
+	}
+}
+
+// affinityKey returns the directory name of the workspace of an affinity.
+func affinityKey(affinity WorkspaceAffinity) string {
+	key := sha256.Sum256([]byte(affinity.EventType + "\x00" + affinity.Repository + "\x00" + affinity.Workflow))
+	return hex.EncodeToString(key[:8])
+}
+
+// readAffinityMeta reads the metadata of the workspace kept in entryDir.
+func readAffinityMeta(entryDir string) (affinityMeta, error) {
+	var meta affinityMeta
+	data, err := os.ReadFile(filepath.Join(entryDir, "meta.json"))
+	if err != nil {
+		return meta, err
+	}
+	err = json.Unmarshal(data, &meta)
+	return meta, err
+}
+
+// lockAffinityEntry leases the workspace kept in entryDir to this process. It reports false
+// when a live process holds the lease.
+func lockAffinityEntry(entryDir string) (bool, error) {
+	lockFile := filepath.Join(entryDir, "lock")
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.WriteString(strconv.Itoa(os.Getpid()))
+			file.Close()
+			return true, err
+		}
+		if !os.IsExist(err) {
+			return false, fmt.Errorf("failed to lock workspace: %v", err)
+		}
+
+		// The lease of a process that died is taken over
+		data, readErr := os.ReadFile(lockFile)
+		if readErr != nil {
+			return false, nil
+		}
+		pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+		if pid <= 0 || pid == os.Getpid() || processAlive(pid) {
+			return false, nil
+		}
+		os.Remove(lockFile)
+	}
+	return false, nil
+}
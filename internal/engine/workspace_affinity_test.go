@@ -0,0 +1,139 @@
+package engine
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkspaceAffinityStore(t *testing.T) {
+	store, err := NewWorkspaceAffinityStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewWorkspaceAffinityStore() error = %v", err)
+	}
+	affinity := WorkspaceAffinity{EventType: "library_built", Repository: "test-org/app", Workflow: "update", StaleAfter: time.Hour}
+
+	// keep prepares a workspace in a lease and keeps it for the next one
+	keep := func(lease *WorkspaceLease) {
+		t.Helper()
+		repoDir := filepath.Join(t.TempDir(), "app")
+		if err := os.MkdirAll(repoDir, 0755); err != nil {
+			t.Fatalf("failed to create workspace: %v", err)
+		}
+		if err := lease.Release(repoDir, true); err != nil {
+			t.Fatalf("Release() error = %v", err)
+		}
+	}
+
+	lease, err := store.Acquire(affinity, "test-org/app")
+	if err != nil || lease == nil || lease.Warm() != "" {
+		t.Fatalf("expected a fresh workspace, got %+v, %v", lease, err)
+	}
+	if other, err := store.Acquire(affinity, "test-org/app"); err != nil || other != nil {
+		t.Errorf("expected the leased workspace to be unavailable, got %+v, %v", other, err)
+	}
+	keep(lease)
+
+	lease, err = store.Acquire(affinity, "test-org/app")
+	if err != nil || lease == nil || lease.Warm() == "" {
+		t.Fatalf("expected the kept workspace to be reused, got %+v, %v", lease, err)
+	}
+	keep(lease)
+
+	// A workspace prepared from another revision is not reused
+	lease, err = store.Acquire(affinity, "test-org/app:main@abc123")
+	if err != nil || lease == nil || lease.Warm() != "" {
+		t.Fatalf("expected a fresh workspace for another revision, got %+v, %v", lease, err)
+	}
+	keep(lease)
+
+	// A workspace unused for longer than its stale-after duration is discarded
+	affinity.StaleAfter = time.Millisecond
+	lease, err = store.Acquire(affinity, "test-org/app")
+	if err != nil || lease == nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	keep(lease)
+	time.Sleep(10 * time.Millisecond)
+	lease, err = store.Acquire(affinity, "test-org/app")
+	if err != nil || lease == nil || lease.Warm() != "" {
+		t.Fatalf("expected the stale workspace to be discarded, got %+v, %v", lease, err)
+	}
+	if err := lease.Release("", false); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+}
+
+func TestFanOutWorkspaceAffinity(t *testing.T) {
+	tempDir := t.TempDir()
+	runner, err := NewRunner(RunnerOptions{
+		WorkspaceRoot: filepath.Join(tempDir, "workspace"),
+		CacheDir:      filepath.Join(tempDir, "cache"),
+		Git:           GitOptions{LocalOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create runner: %v", err)
+	}
+	defer runner.Close()
+
+	writeCachedRepo(t, runner.cacheDir, "test-org/lib", `version: 0.1.0
+workflows:
+  release:
+    inputs:
+      version:
+        required: true
+    steps:
+      - uses: tako/fan-out@v1
+        with:
+          event_type: library_built
+          wait_for_children: true
+          payload:
+            version: "{{ .Inputs.version }}"
+  docs:
+    steps:
+      - uses: tako/fan-out@v1
+        with:
+          event_type: docs_built
+          wait_for_children: true
+`)
+	// The app records whether it runs in the workspace of an earlier run
+	runs := filepath.Join(tempDir, "runs.log")
+	writeCachedRepo(t, runner.cacheDir, "test-org/app", `version: 0.1.0
+workflows:
+  update:
+    steps:
+      - run: if [ -f .warm ]; then echo reused >> `+runs+`; else echo fresh >> `+runs+`; fi; touch .warm
+subscriptions:
+  - artifact: test-org/lib:default
+    events: [library_built, docs_built]
+    workflow: update
+    affinity:
+      stale_after: 1h
+`)
+
+	for _, run := range []struct {
+		workflow string
+		inputs   map[string]string
+	}{
+		{workflow: "release", inputs: map[string]string{"version": "1.0.0"}},
+		{workflow: "release", inputs: map[string]string{"version": "1.1.0"}},
+		{workflow: "docs"},
+	} {
+		result, err := runner.ExecuteMultiRepoWorkflow(context.Background(), run.workflow, run.inputs, "test-org/lib")
+		if err != nil || len(result.Steps) != 1 || !result.Steps[0].Success {
+			t.Fatalf("expected %s to succeed, got %+v, %v", run.workflow, result, err)
+		}
+	}
+
+	// The second release reuses the workspace of the first, the docs event gets its own
+	data, err := os.ReadFile(runs)
+	if err != nil {
+		t.Fatalf("failed to read runs: %v", err)
+	}
+	if got := strings.Fields(string(data)); strings.Join(got, ",") != "fresh,reused,fresh" {
+		t.Errorf("expected fresh, reused and fresh workspaces, got %v", got)
+	}
+}
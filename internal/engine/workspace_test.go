@@ -175,6 +175,88 @@ func TestWorkspace_PrepareRepository(t *testing.T) {
 	}
 }
 
+func TestWorkspace_OverlayRepository(t *testing.T) {
+	tempDir := t.TempDir()
+	wm, err := NewWorkspaceManager(filepath.Join(tempDir, "workspaces"))
+	if err != nil {
+		t.Fatalf("Failed to create workspace manager: %v", err)
+	}
+
+	// Create a source repository that simulates the shared cache
+	sourceRepo := filepath.Join(tempDir, "cache", "repos", "org", "lib", "main")
+	if err := os.MkdirAll(filepath.Join(sourceRepo, "pkg"), 0755); err != nil {
+		t.Fatalf("Failed to create source repo: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(sourceRepo, ".git"), 0755); err != nil {
+		t.Fatalf("Failed to create .git dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceRepo, "pkg", "lib.go"), []byte("package pkg"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	runID := "exec-20240101-000000-abcdef12"
+	ws, err := wm.CreateWorkspace(runID, sourceRepo)
+	if err != nil {
+		t.Fatalf("Failed to create workspace: %v", err)
+	}
+
+	overlayPath, err := ws.OverlayRepository("lib", sourceRepo)
+	if err != nil {
+		t.Fatalf("Failed to overlay repository: %v", err)
+	}
+
+	expectedPath := filepath.Join(tempDir, "workspaces", runID, "lib")
+	if overlayPath != expectedPath {
+		t.Errorf("Expected overlay path %s, got %s", expectedPath, overlayPath)
+	}
+
+	// Files should be real copies, not links into the cache
+	copied := filepath.Join(overlayPath, "pkg", "lib.go")
+	info, err := os.Lstat(copied)
+	if err != nil {
+		t.Fatalf("Expected file to be copied: %v", err)
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		t.Error("Overlay should contain copies, not symbolic links")
+	}
+	if _, err := os.Stat(filepath.Join(overlayPath, ".git")); !os.IsNotExist(err) {
+		t.Error(".git directory should not be copied")
+	}
+
+	// Writes in the overlay must not reach the shared cache
+	if err := os.WriteFile(copied, []byte("modified"), 0644); err != nil {
+		t.Fatalf("Failed to modify overlay file: %v", err)
+	}
+	original, err := os.ReadFile(filepath.Join(sourceRepo, "pkg", "lib.go"))
+	if err != nil {
+		t.Fatalf("Failed to read original file: %v", err)
+	}
+	if string(original) != "package pkg" {
+		t.Errorf("Original file was modified through overlay: %q", original)
+	}
+
+	// Overlaying again should be a no-op that returns the same path
+	overlayPath2, err := ws.OverlayRepository("lib", sourceRepo)
+	if err != nil {
+		t.Fatalf("Failed to overlay repository second time: %v", err)
+	}
+	if overlayPath2 != overlayPath {
+		t.Errorf("Expected same overlay path, got %s", overlayPath2)
+	}
+
+	// Invalid names must be rejected
+	for _, name := range []string{"", "..", "org/lib"} {
+		if _, err := ws.OverlayRepository(name, sourceRepo); err == nil {
+			t.Errorf("Expected error for repository name %q", name)
+		}
+	}
+
+	// Missing sources must be rejected
+	if _, err := ws.OverlayRepository("missing", filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("Expected error for missing source repository")
+	}
+}
+
 func TestWorkspace_GetDirectories(t *testing.T) {
 	tempDir := t.TempDir()
 	wm, err := NewWorkspaceManager(tempDir)
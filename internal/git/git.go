@@ -2,10 +2,12 @@ package git
 
 import (
 	"fmt"
+	"github.com/dangazineu/tako/internal/cache"
 	"github.com/dangazineu/tako/internal/errors"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -36,6 +38,101 @@ func Checkout(path, ref string) error {
 	return nil
 }
 
+// Fetch fetches updates from the remote of the repository at the given path.
+func Fetch(path string) error {
+	cmd := exec.Command("git", "-C", path, "fetch", "--prune")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, "TAKO_E009", fmt.Sprintf("failed to fetch %s: %s", path, string(output)))
+	}
+	return nil
+}
+
+// FastForward fast-forwards the branch checked out in the given repository path to its
+// upstream. Repositories on a detached commit, such as a tag, are left as they are.
+func FastForward(path string) error {
+	branch, err := CurrentBranch(path)
+	if err != nil {
+		return err
+	}
+	if branch == "HEAD" {
+		return nil
+	}
+	cmd := exec.Command("git", "-C", path, "merge", "--ff-only", "@{upstream}")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrap(err, "TAKO_E011", fmt.Sprintf("failed to fast-forward %s in %s: %s", branch, path, string(output)))
+	}
+	return nil
+}
+
+// CurrentBranch returns the branch checked out in the given repository path, or "HEAD" when
+// the repository is on a detached commit.
+func CurrentBranch(path string) (string, error) {
+	return revParse(path, "--abbrev-ref", "HEAD")
+}
+
+// HeadCommit returns the commit checked out in the given repository path.
+func HeadCommit(path string) (string, error) {
+	return revParse(path, "HEAD")
+}
+
+func revParse(path string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", path, "rev-parse"}, args...)...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", errors.Wrap(err, "TAKO_E010", fmt.Sprintf("failed to resolve %s in %s: %s", strings.Join(args, " "), path, string(output)))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// ChangedFiles returns the files of the repository at the given path that differ from a ref,
+// including the changes not committed yet and the untracked files that are not ignored, sorted.
+func ChangedFiles(path, since string) ([]string, error) {
+	if err := ValidateRef(since); err != nil {
+		return nil, err
+	}
+	output, err := exec.Command("git", "-C", path, "diff", "--name-only", since, "--").CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, "TAKO_E012", fmt.Sprintf("failed to diff %s against %s: %s", path, since, strings.TrimSpace(string(output))))
+	}
+	untracked, err := exec.Command("git", "-C", path, "ls-files", "--others", "--exclude-standard").CombinedOutput()
+	if err != nil {
+		return nil, errors.Wrap(err, "TAKO_E012", fmt.Sprintf("failed to list the untracked files of %s: %s", path, strings.TrimSpace(string(untracked))))
+	}
+	files := make(map[string]bool)
+	for _, line := range strings.Split(string(output)+"\n"+string(untracked), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			files[line] = true
+		}
+	}
+	sorted := make([]string, 0, len(files))
+	for file := range files {
+		sorted = append(sorted, file)
+	}
+	sort.Strings(sorted)
+	return sorted, nil
+}
+
+// ValidateRef checks that a ref given on the command line cannot be taken for an option of git.
+func ValidateRef(ref string) error {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return errors.New("TAKO_E012", fmt.Sprintf("invalid ref '%s': refs must not be empty or start with '-'", ref))
+	}
+	return nil
+}
+
+// LastFetchTime returns when the repository at the given path was last fetched, falling back
+// to when it was cloned if it was never fetched. It returns false if neither is known.
+func LastFetchTime(path string) (time.Time, bool) {
+	for _, name := range []string{"FETCH_HEAD", "HEAD"} {
+		if info, err := os.Stat(filepath.Join(path, ".git", name)); err == nil {
+			return info.ModTime(), true
+		}
+	}
+	return time.Time{}, false
+}
+
 func GetEntrypointPath(root, repo, cacheDir, workingDir, homeDir string, localOnly bool) (string, error) {
 	if repo != "" {
 		// When --repo is used, there's no "current" path, so we pass ""
@@ -134,6 +231,10 @@ func GetRepoPath(repo, currentPath, cacheDir, homeDir string, localOnly bool) (s
 				}
 			}
 		}
+		if strings.HasPrefix(repoPath, filepath.Join(cacheDir, "repos")) {
+			// Record the use so that cache eviction removes the least recently used clones first
+			_ = cache.Touch(repoPath)
+		}
 		return repoPath, nil
 	}
 
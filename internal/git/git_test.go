@@ -92,6 +92,43 @@ func TestCheckout(t *testing.T) {
 	}
 }
 
+func TestChangedFiles(t *testing.T) {
+	repoPath := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"config", "user.email", "you@example.com"},
+		{"config", "user.name", "Your Name"},
+		{"commit", "-q", "--allow-empty", "-m", "initial commit"},
+	} {
+		if output, err := exec.Command("git", append([]string{"-C", repoPath}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, output)
+		}
+	}
+	for name, content := range map[string]string{".gitignore": "*.log\n", "new.txt": "new", "debug.log": "ignored"} {
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Untracked files are changed, unless they are ignored
+	files, err := git.ChangedFiles(repoPath, "HEAD")
+	if err != nil {
+		t.Fatalf("ChangedFiles() error = %v", err)
+	}
+	if strings.Join(files, ",") != ".gitignore,new.txt" {
+		t.Errorf("expected the untracked files that are not ignored, got %v", files)
+	}
+
+	// Refs that git would take for options are rejected
+	outputPath := filepath.Join(t.TempDir(), "diff")
+	if _, err := git.ChangedFiles(repoPath, "--output="+outputPath); err == nil || !strings.Contains(err.Error(), "must not be empty or start with '-'") {
+		t.Errorf("expected a ref starting with '-' to be rejected, got %v", err)
+	}
+	if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+		t.Errorf("expected git not to write %s", outputPath)
+	}
+}
+
 func TestGetEntrypointPath(t *testing.T) {
 	t.Run("with repo flag", func(t *testing.T) {
 		tmpDir := t.TempDir()
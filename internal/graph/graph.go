@@ -103,6 +103,106 @@ func (n *Node) TopologicalSort() ([]*Node, error) {
 	return sorted, nil
 }
 
+// Levels groups the nodes by depth, each after all the nodes it depends on: the nodes of a level
+// only depend on nodes of earlier levels, so they can be processed concurrently.
+func (n *Node) Levels() ([][]*Node, error) {
+	sorted, err := n.TopologicalSort()
+	if err != nil {
+		return nil, err
+	}
+
+	depth := make(map[string]int)
+	var levels [][]*Node
+	for _, node := range sorted {
+		level := depth[node.Name]
+		if level == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[level] = append(levels[level], node)
+		for _, child := range node.Children {
+			if depth[child.Name] < level+1 {
+				depth[child.Name] = level + 1
+			}
+		}
+	}
+	for _, level := range levels {
+		sort.Slice(level, func(i, j int) bool {
+			return level[i].Name < level[j].Name
+		})
+	}
+	return levels, nil
+}
+
+// Related is a repository reached from another through the edges of the graph, at the depth of
+// the shortest path to it.
+type Related struct {
+	Name  string `json:"repository"`
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+}
+
+// Find returns the node of the graph with the given name, or nil when there is none.
+func (n *Node) Find(name string) *Node {
+	for _, node := range n.AllNodes() {
+		if node.Name == name {
+			return node
+		}
+	}
+	return nil
+}
+
+// Dependents returns the repositories that depend on the named one, directly or not, up to
+// maxDepth edges away (0 for no limit), by depth then name.
+func (n *Node) Dependents(name string, maxDepth int) ([]Related, error) {
+	start := n.Find(name)
+	if start == nil {
+		return nil, fmt.Errorf("repository %q not found in the graph", name)
+	}
+	return reach(start, maxDepth, func(node *Node) []*Node { return node.Children }), nil
+}
+
+// Dependencies returns the repositories the named one depends on, directly or not, up to
+// maxDepth edges away (0 for no limit), by depth then name.
+func (n *Node) Dependencies(name string, maxDepth int) ([]Related, error) {
+	start := n.Find(name)
+	if start == nil {
+		return nil, fmt.Errorf("repository %q not found in the graph", name)
+	}
+	parents := make(map[string][]*Node)
+	for _, node := range n.AllNodes() {
+		for _, child := range node.Children {
+			parents[child.Name] = append(parents[child.Name], node)
+		}
+	}
+	return reach(start, maxDepth, func(node *Node) []*Node { return parents[node.Name] }), nil
+}
+
+// reach walks the graph breadth-first from a node along the given edges.
+func reach(start *Node, maxDepth int, next func(*Node) []*Node) []Related {
+	related := []Related{}
+	visited := map[string]bool{start.Name: true}
+	frontier := []*Node{start}
+	for depth := 1; len(frontier) > 0 && (maxDepth <= 0 || depth <= maxDepth); depth++ {
+		var reached []*Node
+		for _, node := range frontier {
+			for _, other := range next(node) {
+				if !visited[other.Name] {
+					visited[other.Name] = true
+					reached = append(reached, other)
+				}
+			}
+		}
+		sort.Slice(reached, func(i, j int) bool {
+			return reached[i].Name < reached[j].Name
+		})
+		for _, node := range reached {
+			related = append(related, Related{Name: node.Name, Path: node.Path, Depth: depth})
+		}
+		frontier = reached
+	}
+	return related
+}
+
 func (n *Node) Filter(only, ignore []string) (*Node, error) {
 	allNodes := n.AllNodes()
 	nodeMap := make(map[string]*Node)
@@ -227,7 +327,11 @@ func buildGraphRecursive(repoName, path, cacheDir, homeDir string, visited map[s
 		return node, nil
 	}
 
-	cfg, err := config.Load(filepath.Join(absPath, "tako.yml"))
+	includeCacheDir := cacheDir
+	if includeCacheDir == "" {
+		includeCacheDir = filepath.Join(homeDir, ".tako", "cache")
+	}
+	cfg, err := config.LoadWithCache(filepath.Join(absPath, "tako.yml"), includeCacheDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
@@ -140,6 +140,73 @@ func TestTopologicalSort(t *testing.T) {
 	}
 }
 
+func TestLevels(t *testing.T) {
+	// A -> B -> D, A -> C -> D, A -> D, C -> E
+	nodeE := &Node{Name: "E"}
+	nodeD := &Node{Name: "D"}
+	nodeC := &Node{Name: "C", Children: []*Node{nodeE, nodeD}}
+	nodeB := &Node{Name: "B", Children: []*Node{nodeD}}
+	nodeA := &Node{Name: "A", Children: []*Node{nodeD, nodeC, nodeB}}
+
+	levels, err := nodeA.Levels()
+	if err != nil {
+		t.Fatalf("Levels() error = %v", err)
+	}
+	var names [][]string
+	for _, level := range levels {
+		var levelNames []string
+		for _, node := range level {
+			levelNames = append(levelNames, node.Name)
+		}
+		names = append(names, levelNames)
+	}
+	expected := [][]string{{"A"}, {"B", "C"}, {"D", "E"}}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected levels %v, got %v", expected, names)
+	}
+
+	nodeX := &Node{Name: "X"}
+	nodeY := &Node{Name: "Y", Children: []*Node{nodeX}}
+	nodeX.Children = []*Node{nodeY}
+	if _, err := (&Node{Name: "root", Children: []*Node{nodeX}}).Levels(); err == nil {
+		t.Error("Expected a circular dependency to be rejected")
+	}
+}
+
+func TestDependentsAndDependencies(t *testing.T) {
+	// A -> B -> D, A -> C -> D -> E
+	nodeE := &Node{Name: "E"}
+	nodeD := &Node{Name: "D", Children: []*Node{nodeE}}
+	nodeC := &Node{Name: "C", Children: []*Node{nodeD}}
+	nodeB := &Node{Name: "B", Children: []*Node{nodeD}}
+	nodeA := &Node{Name: "A", Children: []*Node{nodeC, nodeB}}
+
+	dependents, err := nodeA.Dependents("A", 0)
+	if err != nil {
+		t.Fatalf("Dependents() error = %v", err)
+	}
+	expected := []Related{{Name: "B", Depth: 1}, {Name: "C", Depth: 1}, {Name: "D", Depth: 2}, {Name: "E", Depth: 3}}
+	if !reflect.DeepEqual(dependents, expected) {
+		t.Errorf("Expected dependents %v, got %v", expected, dependents)
+	}
+	if dependents, _ := nodeA.Dependents("A", 2); len(dependents) != 3 {
+		t.Errorf("Expected the depth limit to leave out E, got %v", dependents)
+	}
+
+	dependencies, err := nodeA.Dependencies("E", 0)
+	if err != nil {
+		t.Fatalf("Dependencies() error = %v", err)
+	}
+	expected = []Related{{Name: "D", Depth: 1}, {Name: "B", Depth: 2}, {Name: "C", Depth: 2}, {Name: "A", Depth: 3}}
+	if !reflect.DeepEqual(dependencies, expected) {
+		t.Errorf("Expected dependencies %v, got %v", expected, dependencies)
+	}
+
+	if _, err := nodeA.Dependents("X", 0); err == nil {
+		t.Error("Expected an unknown repository to be rejected")
+	}
+}
+
 func TestBuildGraph_CircularDependency(t *testing.T) {
 	tmpDir := t.TempDir()
 
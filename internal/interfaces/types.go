@@ -1,6 +1,8 @@
 package interfaces
 
 import (
+	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/dangazineu/tako/internal/config"
@@ -15,23 +17,131 @@ type SubscriptionMatch struct {
 }
 
 // ExecutionResult represents the result of a workflow execution.
-// This type is used by WorkflowRunner implementations.
+// This type is used by WorkflowRunner implementations. Its JSON encoding carries errors as their
+// messages.
 type ExecutionResult struct {
-	RunID     string
-	Success   bool
-	Error     error
-	StartTime time.Time
-	EndTime   time.Time
-	Steps     []StepResult
+	RunID     string       `json:"run_id"`
+	Success   bool         `json:"success"`
+	Error     error        `json:"-"`
+	StartTime time.Time    `json:"start_time"`
+	EndTime   time.Time    `json:"end_time"`
+	Steps     []StepResult `json:"steps"`
+	// Outputs are the outputs declared by the workflow; nil when it declares none.
+	Outputs map[string]string `json:"outputs,omitempty"`
+	// Children are the child workflows triggered by the fan-out steps of the workflow, in the
+	// order of the steps; nil when it triggered none.
+	Children []ChildResult `json:"children,omitempty"`
+	// AllowedFailures are the IDs of the steps that failed without failing the workflow, under
+	// continue_on_error. A successful workflow may have allowed failures; its hard failures fail it.
+	AllowedFailures []string `json:"allowed_failures,omitempty"`
+}
+
+// Child returns the first child workflow of a repository triggered by the fan-out steps of the
+// workflow, or nil when none was.
+func (r *ExecutionResult) Child(repository, workflow string) *ChildResult {
+	for i := range r.Children {
+		if r.Children[i].Repository == repository && r.Children[i].Workflow == workflow {
+			return &r.Children[i]
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the result with its error message.
+func (r ExecutionResult) MarshalJSON() ([]byte, error) {
+	type result ExecutionResult
+	return json.Marshal(struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result(r), errorMessage(r.Error)})
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+func (r *ExecutionResult) UnmarshalJSON(data []byte) error {
+	type result ExecutionResult
+	decoded := struct {
+		*result
+		Error string `json:"error"`
+	}{result: (*result)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	r.Error = messageError(decoded.Error)
+	return nil
+}
+
+// ChildResult represents a child workflow triggered by a fan-out step of a workflow execution.
+type ChildResult struct {
+	StepID     string `json:"step_id"` // Fan-out step that triggered the child
+	Repository string `json:"repository"`
+	Workflow   string `json:"workflow"`
+	RunID      string `json:"run_id,omitempty"`
+	Status     string `json:"status"` // Status of the child in its fan-out: completed, failed, skipped...
+	Error      string `json:"error,omitempty"`
+	// Result is the execution of the child workflow, with its own children; nil when it did not
+	// run in this process, such as on a remote backend, or did not finish before its fan-out.
+	Result *ExecutionResult `json:"result,omitempty"`
 }
 
 // StepResult represents the result of a single step execution.
 type StepResult struct {
-	ID        string
-	Success   bool
-	Error     error
-	StartTime time.Time
-	EndTime   time.Time
-	Output    string
-	Outputs   map[string]string
+	ID        string            `json:"id"`
+	Success   bool              `json:"success"`
+	Error     error             `json:"-"`
+	StartTime time.Time         `json:"start_time"`
+	EndTime   time.Time         `json:"end_time"`
+	Output    string            `json:"output,omitempty"`
+	Outputs   map[string]string `json:"outputs,omitempty"`
+	Skipped   bool              `json:"skipped,omitempty"`    // The step's if: condition did not hold
+	ErrorType string            `json:"error_type,omitempty"` // Why an unsuccessful step stopped; empty for ordinary failures
+	ErrorLine int               `json:"error_line,omitempty"` // Line of the step's multi-line script that failed; 0 when unknown
+	Cached    bool              `json:"cached,omitempty"`     // The step did not run, its cache restored its outputs and paths
+	// AllowedFailure is whether the step failed without failing the workflow, under continue_on_error.
+	AllowedFailure bool `json:"allowed_failure,omitempty"`
+}
+
+// MarshalJSON encodes the result with its error message.
+func (r StepResult) MarshalJSON() ([]byte, error) {
+	type result StepResult
+	return json.Marshal(struct {
+		result
+		Error string `json:"error,omitempty"`
+	}{result(r), errorMessage(r.Error)})
+}
+
+// UnmarshalJSON decodes a result encoded by MarshalJSON.
+func (r *StepResult) UnmarshalJSON(data []byte) error {
+	type result StepResult
+	decoded := struct {
+		*result
+		Error string `json:"error"`
+	}{result: (*result)(r)}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	r.Error = messageError(decoded.Error)
+	return nil
+}
+
+// errorMessage returns the message of an error; empty for nil.
+func errorMessage(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
 }
+
+// messageError returns an error with a message; nil for an empty one.
+func messageError(message string) error {
+	if message == "" {
+		return nil
+	}
+	return errors.New(message)
+}
+
+// Error types reported in StepResult.ErrorType.
+const (
+	StepErrorStepTimeout     = "step_timeout"     // The step exceeded its own timeout
+	StepErrorWorkflowTimeout = "workflow_timeout" // The workflow exceeded its timeout while the step ran
+	StepErrorCancelled       = "cancelled"        // The run was cancelled while the step ran
+)
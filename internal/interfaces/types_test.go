@@ -0,0 +1,55 @@
+package interfaces
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExecutionResultJSON(t *testing.T) {
+	start := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	result := ExecutionResult{
+		RunID:     "exec-1",
+		Error:     errors.New("fan-out failed"),
+		StartTime: start,
+		EndTime:   start.Add(time.Minute),
+		Steps:     []StepResult{{ID: "publish", Error: errors.New("1 child failed"), ErrorType: "workflow_failed"}},
+		Children: []ChildResult{{
+			StepID:     "publish",
+			Repository: "org/app",
+			Workflow:   "update",
+			Status:     "failed",
+			Result: &ExecutionResult{
+				RunID: "exec-2",
+				Steps: []StepResult{{ID: "build", Success: true, Output: "ok"}},
+			},
+		}},
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	for _, want := range []string{`"error":"fan-out failed"`, `"error":"1 child failed"`, `"repository":"org/app"`, `"run_id":"exec-2"`} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("expected %s in %s", want, data)
+		}
+	}
+
+	var decoded ExecutionResult
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if decoded.Error == nil || decoded.Error.Error() != "fan-out failed" || decoded.Steps[0].Error.Error() != "1 child failed" {
+		t.Errorf("expected the errors to be decoded, got %v and %v", decoded.Error, decoded.Steps[0].Error)
+	}
+	child := decoded.Child("org/app", "update")
+	if child == nil || child.Result == nil || child.Result.Error != nil || child.Result.Steps[0].Output != "ok" {
+		t.Errorf("expected the child result to be decoded, got %+v", child)
+	}
+	if decoded.Child("org/app", "deploy") != nil {
+		t.Errorf("expected no child for another workflow")
+	}
+}
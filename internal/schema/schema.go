@@ -0,0 +1,217 @@
+// Package schema generates the JSON Schema of the tako.yml format.
+//
+// The schema is derived from the configuration structs through their yaml tags, so it follows
+// the format as it evolves. The parameters of the built-in steps that take structured
+// parameters, such as tako/fan-out@v1, are applied to the with section of the steps using them.
+package schema
+
+//go:generate go run ../../cmd/tako schema export --output ../../schema/tako.schema.json
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/config"
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+// ID is the URL the schema is published at.
+const ID = "https://raw.githubusercontent.com/dangazineu/tako/main/schema/tako.schema.json"
+
+// Schema is a JSON Schema (draft-07) document or subschema.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	ID                   string             `json:"$id,omitempty"`
+	Ref                  string             `json:"$ref,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Const                string             `json:"const,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	If                   *Schema            `json:"if,omitempty"`
+	Then                 *Schema            `json:"then,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+
+	// closed marks the object schemas that accept no other properties. It is marshaled as
+	// additionalProperties: false.
+	closed bool
+}
+
+// MarshalJSON encodes a schema, writing additionalProperties: false for closed objects.
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	type schemaAlias Schema
+	if !s.closed {
+		return json.Marshal((*schemaAlias)(s))
+	}
+	return json.Marshal(struct {
+		*schemaAlias
+		AdditionalProperties bool `json:"additionalProperties"`
+	}{(*schemaAlias)(s), false})
+}
+
+// stepParams are the parameter structs of the built-in steps, by step name. The with section of
+// a step using one of them is validated against its struct.
+var stepParams = map[string]reflect.Type{
+	"tako/fan-out":          reflect.TypeOf(engine.FanOutParams{}),
+	"tako/approval":         reflect.TypeOf(config.ApprovalParams{}),
+	"tako/notify-slack":     reflect.TypeOf(config.NotifyStepParams{}),
+	"tako/notify-webhook":   reflect.TypeOf(config.NotifyStepParams{}),
+	"tako/notify-email":     reflect.TypeOf(config.NotifyStepParams{}),
+	"tako/publish-artifact": reflect.TypeOf(config.PublishArtifactParams{}),
+}
+
+// requiredFields are the fields that a configuration must set, by struct. The yaml tags do not
+// tell them apart from the optional ones.
+var requiredFields = map[reflect.Type][]string{
+	reflect.TypeOf(config.Config{}):                {"version"},
+	reflect.TypeOf(config.Service{}):               {"image"},
+	reflect.TypeOf(config.NotifyStepParams{}):      {"message"},
+	reflect.TypeOf(config.PublishArtifactParams{}): {"artifact", "registry"},
+	reflect.TypeOf(engine.PublishedArtifact{}):     {"digest", "reference"},
+}
+
+// Generate returns the JSON Schema of the tako.yml format.
+func Generate() *Schema {
+	g := &generator{definitions: make(map[string]*Schema)}
+	root := g.object(reflect.TypeOf(config.Config{}))
+	root.Schema = "http://json-schema.org/draft-07/schema#"
+	root.ID = ID
+	root.Title = "tako.yml"
+	root.Description = "Configuration of a repository managed by tako."
+
+	// The with section of built-in steps is validated against their parameters
+	step := g.definitions[definitionName(reflect.TypeOf(config.WorkflowStep{}))]
+	object := step.OneOf[1]
+	names := make([]string, 0, len(stepParams))
+	for name := range stepParams {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		object.AllOf = append(object.AllOf, &Schema{
+			If: &Schema{
+				Properties: map[string]*Schema{"uses": {Type: "string", Pattern: "^" + regexp.QuoteMeta(name) + "@"}},
+				Required:   []string{"uses"},
+			},
+			Then: &Schema{Properties: map[string]*Schema{"with": g.schema(stepParams[name])}},
+		})
+	}
+
+	root.Definitions = g.definitions
+	return root
+}
+
+// Marshal returns the JSON Schema of the tako.yml format, indented and ending with a newline.
+func Marshal() ([]byte, error) {
+	data, err := json.MarshalIndent(Generate(), "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the schema: %v", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// generator builds the schemas of the configuration types. Structs are defined once and referred
+// to by name, which also covers recursive types such as steps.
+type generator struct {
+	definitions map[string]*Schema
+}
+
+// schema returns the schema of a Go type.
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return g.schema(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		name := definitionName(t)
+		if _, defined := g.definitions[name]; !defined {
+			// Reserved before the fields are visited, for recursive types
+			g.definitions[name] = &Schema{}
+			*g.definitions[name] = *g.definition(t)
+		}
+		return &Schema{Ref: "#/definitions/" + name}
+	default:
+		// Interfaces hold any value
+		return &Schema{}
+	}
+}
+
+// definition returns the schema of a struct. The types decoded by hand, whose YAML form is not
+// the one of their fields, have their own.
+func (g *generator) definition(t reflect.Type) *Schema {
+	switch t {
+	case reflect.TypeOf(config.WorkflowStep{}):
+		// A step is either a command or an object
+		return &Schema{OneOf: []*Schema{{Type: "string"}, g.object(t)}}
+	case reflect.TypeOf(engine.FailurePolicy{}):
+		// A failure policy is either a mode or an object with a mode and a threshold
+		modes := []string{engine.FailurePolicyContinue, engine.FailurePolicyFailFast, engine.FailurePolicyThreshold}
+		return &Schema{OneOf: []*Schema{
+			{Type: "string", Enum: modes},
+			{Type: "object", closed: true, Properties: map[string]*Schema{
+				"mode":      {Type: "string", Enum: modes},
+				"threshold": {OneOf: []*Schema{{Type: "number"}, {Type: "string", Pattern: `^[0-9.]+%?$`}}},
+			}},
+		}}
+	default:
+		return g.object(t)
+	}
+}
+
+// object returns the schema of the fields of a struct, following their yaml tags.
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema), Required: requiredFields[t], closed: true}
+	g.addFields(s, t)
+	return s
+}
+
+// addFields adds the fields of a struct to an object schema, including those of inlined structs.
+func (g *generator) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		tag := field.Tag.Get("yaml")
+		if tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if strings.Contains(options, "inline") || (field.Anonymous && tag == "") {
+			g.addFields(s, field.Type)
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(field.Name)
+		}
+		s.Properties[name] = g.schema(field.Type)
+	}
+}
+
+// definitionName returns the name of the definition of a struct.
+func definitionName(t reflect.Type) string {
+	return t.Name()
+}
@@ -0,0 +1,79 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func TestGeneratedSchemaIsUpToDate(t *testing.T) {
+	expected, err := Marshal()
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	actual, err := os.ReadFile("../../schema/tako.schema.json")
+	if err != nil {
+		t.Fatalf("failed to read the generated schema: %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Error("schema/tako.schema.json is out of date, run go generate ./internal/schema")
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	schema := Generate()
+
+	if schema.Required[0] != "version" || schema.Properties["workflows"].AdditionalProperties.Ref != "#/definitions/Workflow" {
+		t.Errorf("unexpected root schema: %+v", schema)
+	}
+	if resources := schema.Definitions["Workflow"].Properties["resources"]; resources == nil || resources.Ref != "#/definitions/Resources" {
+		t.Errorf("expected the workflow resources to refer to their definition, got %+v", resources)
+	}
+	if _, ok := schema.Definitions["Workflow"].Properties["Name"]; ok {
+		t.Error("expected the fields excluded from YAML not to be part of the schema")
+	}
+
+	// Steps are either a command or an object, with the parameters of the built-in steps they use
+	step := schema.Definitions["WorkflowStep"]
+	if len(step.OneOf) != 2 || step.OneOf[0].Type != "string" {
+		t.Fatalf("expected a step to be a string or an object, got %+v", step)
+	}
+	object := step.OneOf[1]
+	if object.Properties["on_failure"].Items.Ref != "#/definitions/WorkflowStep" {
+		t.Errorf("expected on_failure to refer to the step definition, got %+v", object.Properties["on_failure"])
+	}
+	var fanOut *Schema
+	for _, condition := range object.AllOf {
+		if condition.If.Properties["uses"].Pattern == "^tako/fan-out@" {
+			fanOut = condition.Then.Properties["with"]
+		}
+	}
+	if fanOut == nil || fanOut.Ref != "#/definitions/FanOutParams" {
+		t.Fatalf("expected the with section of fan-out steps to refer to their parameters, got %+v", fanOut)
+	}
+	params := schema.Definitions["FanOutParams"]
+	if params.Properties["wait_for_children"].Type != "boolean" || params.Properties["concurrency_limit"].Type != "integer" {
+		t.Errorf("unexpected fan-out parameters: %+v", params)
+	}
+	// Fan-outs emit the event of event_type, or a batch of events
+	if len(params.Required) != 0 || params.Properties["events"].Items.Ref != "#/definitions/FanOutEvent" {
+		t.Errorf("expected event_type to be optional with a batch of events, got %+v", params)
+	}
+	if policy := schema.Definitions["FailurePolicy"]; len(policy.OneOf) != 2 || policy.OneOf[0].Type != "string" {
+		t.Errorf("expected a failure policy to be a mode or an object, got %+v", policy)
+	}
+
+	// Notification channels are inlined in their policies
+	if notification := schema.Definitions["Notification"]; notification.Properties["url_env"] == nil || notification.Properties["on"] == nil {
+		t.Errorf("expected the channel fields to be inlined, got %+v", notification)
+	}
+
+	data, err := json.Marshal(schema.Definitions["Artifact"])
+	if err != nil {
+		t.Fatalf("failed to encode the artifact definition: %v", err)
+	}
+	if !bytes.Contains(data, []byte(`"additionalProperties":false`)) {
+		t.Errorf("expected the objects to reject unknown properties, got %s", data)
+	}
+}
@@ -28,6 +28,15 @@ type FanOutStepParams struct {
 	ConcurrencyLimit int                    `yaml:"concurrency_limit"`
 	Payload          map[string]interface{} `yaml:"payload"`
 	SchemaVersion    string                 `yaml:"schema_version"`
+	Targets          []string               `yaml:"targets"`
+	Exclude          []string               `yaml:"exclude"`
+	Rollout          *FanOutStepRollout     `yaml:"rollout"`
+}
+
+// FanOutStepRollout represents the staged rollout configuration of a fan-out step.
+type FanOutStepRollout struct {
+	Waves []string `yaml:"waves"`
+	Gate  string   `yaml:"gate"`
 }
 
 // FanOutStepResult represents the result of a fan-out execution.
@@ -1,27 +1,44 @@
 package e2e
 
-// FileDef represents a file to be created in a repository from a template.
+import "github.com/dangazineu/tako/internal/config"
+
+// FileDef represents a file to be created in a repository, from a template or inline content.
 type FileDef struct {
-	Path     string // Relative path within the repository
-	Template string // Name of the template file (e.g., "java-library/pom.xml")
+	Path     string `yaml:"path"`               // Relative path within the repository
+	Template string `yaml:"template,omitempty"` // Name of the template file (e.g., "java-library/pom.xml")
+	Content  string `yaml:"content,omitempty"`  // Content of the file, when it is not from a template
+}
+
+// CommitDef defines a commit seeded on top of the initial files of a repository.
+type CommitDef struct {
+	Message string    `yaml:"message"`
+	Files   []FileDef `yaml:"files"` // Files created or overwritten by the commit
 }
 
 // RepositoryDef defines a repository within an environment.
 type RepositoryDef struct {
-	Name         string
-	Branch       string
-	Files        []FileDef
-	Dependencies []string
+	Name         string    `yaml:"name"`
+	Branch       string    `yaml:"branch,omitempty"`
+	Files        []FileDef `yaml:"files,omitempty"`
+	Dependencies []string  `yaml:"dependencies,omitempty"`
+
+	// TakoYAML is the content of the tako.yml of the repository; when empty, a tako.yml with a
+	// default workflow is generated.
+	TakoYAML string `yaml:"tako.yml,omitempty"`
+	// Subscriptions are added to the tako.yml. Artifacts without an owner, like repo-b:default,
+	// refer to the repositories of the environment.
+	Subscriptions []config.Subscription `yaml:"subscriptions,omitempty"`
+	Commits       []CommitDef           `yaml:"commits,omitempty"`
 }
 
 // TestEnvironmentDef defines the repository layout for a test world.
 type TestEnvironmentDef struct {
-	Name         string
-	Repositories []RepositoryDef
+	Name         string          `yaml:"name"`
+	Repositories []RepositoryDef `yaml:"repositories"`
 }
 
 func GetEnvironments(owner string) map[string]TestEnvironmentDef {
-	return map[string]TestEnvironmentDef{
+	environments := map[string]TestEnvironmentDef{
 		"simple-graph": {
 			Name: "simple-graph",
 			Repositories: []RepositoryDef{
@@ -246,4 +263,10 @@ func GetEnvironments(owner string) map[string]TestEnvironmentDef {
 			},
 		},
 	}
+
+	// Scenarios embedded in the e2e tests are environments too
+	for _, env := range embeddedScenarios() {
+		environments[env.Name] = env
+	}
+	return environments
 }
@@ -0,0 +1,164 @@
+package e2e
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed scenarios/*.yml
+var scenarios embed.FS
+
+// LoadScenario loads a scenario file: a test environment written in YAML, with the tako.yml,
+// subscriptions, files and seeded commits of its repositories, which `takotest setup --scenario`
+// materializes like the built-in environments.
+func LoadScenario(path string) (TestEnvironmentDef, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return TestEnvironmentDef{}, fmt.Errorf("failed to read scenario: %w", err)
+	}
+	env, err := ParseScenario(data)
+	if err != nil {
+		return TestEnvironmentDef{}, fmt.Errorf("invalid scenario %s: %w", path, err)
+	}
+	return env, nil
+}
+
+// ParseScenario parses and validates the YAML of a scenario. Repositories use the main branch
+// unless they set another.
+func ParseScenario(data []byte) (TestEnvironmentDef, error) {
+	var env TestEnvironmentDef
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&env); err != nil {
+		return TestEnvironmentDef{}, err
+	}
+
+	if env.Name == "" {
+		return TestEnvironmentDef{}, fmt.Errorf("scenario has no name")
+	}
+	if len(env.Repositories) == 0 {
+		return TestEnvironmentDef{}, fmt.Errorf("scenario has no repositories")
+	}
+	names := make(map[string]bool, len(env.Repositories))
+	for i := range env.Repositories {
+		repo := &env.Repositories[i]
+		if repo.Name == "" {
+			return TestEnvironmentDef{}, fmt.Errorf("repository %d has no name", i+1)
+		}
+		if names[repo.Name] {
+			return TestEnvironmentDef{}, fmt.Errorf("repository '%s' is defined twice", repo.Name)
+		}
+		names[repo.Name] = true
+		if repo.Branch == "" {
+			repo.Branch = "main"
+		}
+	}
+
+	for _, repo := range env.Repositories {
+		for _, dep := range repo.Dependencies {
+			if !names[dep] {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s' depends on unknown repository '%s'", repo.Name, dep)
+			}
+		}
+		for _, sub := range repo.Subscriptions {
+			if sub.Artifact == "" || sub.Workflow == "" || len(sub.Events) == 0 {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s': subscriptions need an artifact, events and a workflow", repo.Name)
+			}
+			if target, _, _ := strings.Cut(sub.Artifact, ":"); !strings.Contains(target, "/") && !names[target] {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s' subscribes to unknown repository '%s'", repo.Name, target)
+			}
+		}
+		if err := validateFiles(repo.Files); err != nil {
+			return TestEnvironmentDef{}, fmt.Errorf("repository '%s': %w", repo.Name, err)
+		}
+		for i, commit := range repo.Commits {
+			if commit.Message == "" {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s': commit %d has no message", repo.Name, i+1)
+			}
+			if len(commit.Files) == 0 {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s': commit '%s' changes no files", repo.Name, commit.Message)
+			}
+			if err := validateFiles(commit.Files); err != nil {
+				return TestEnvironmentDef{}, fmt.Errorf("repository '%s': commit '%s': %w", repo.Name, commit.Message, err)
+			}
+		}
+	}
+	return env, nil
+}
+
+// validateFiles checks that files have a path and either a template or inline content.
+func validateFiles(files []FileDef) error {
+	for _, file := range files {
+		if file.Path == "" {
+			return fmt.Errorf("file has no path")
+		}
+		if file.Template != "" && file.Content != "" {
+			return fmt.Errorf("file %s sets both a template and content", file.Path)
+		}
+	}
+	return nil
+}
+
+// RepositoryName returns the owner/repo name of a repository. Repositories without an owner,
+// like repo-b, are repositories of the environment, named <environment>-<repository> under owner.
+func RepositoryName(owner, envName, repository string) string {
+	if strings.Contains(repository, "/") {
+		return repository
+	}
+	return fmt.Sprintf("%s/%s-%s", owner, envName, repository)
+}
+
+// RepositoryArtifact returns the artifact an environment's subscription refers to, with the
+// repository named like RepositoryName.
+func RepositoryArtifact(owner, envName, artifact string) string {
+	target, name, found := strings.Cut(artifact, ":")
+	if strings.Contains(target, "/") {
+		return artifact
+	}
+	if !found {
+		name = "default"
+	}
+	return fmt.Sprintf("%s:%s", RepositoryName(owner, envName, target), name)
+}
+
+// FileContent returns the content of a file of an environment, with the {{.Owner}} and
+// {{.EnvName}} placeholders replaced.
+func FileContent(file FileDef, envName, owner string) (string, error) {
+	content := file.Content
+	if file.Template != "" {
+		var err error
+		if content, err = GetTemplate(file.Template); err != nil {
+			return "", err
+		}
+	}
+	content = strings.ReplaceAll(content, "{{.Owner}}", owner)
+	content = strings.ReplaceAll(content, "{{.EnvName}}", envName)
+	return content, nil
+}
+
+// embeddedScenarios returns the scenarios of the scenarios directory.
+func embeddedScenarios() []TestEnvironmentDef {
+	entries, err := scenarios.ReadDir("scenarios")
+	if err != nil {
+		panic(fmt.Sprintf("failed to read embedded scenarios: %v", err))
+	}
+	var envs []TestEnvironmentDef
+	for _, entry := range entries {
+		data, err := scenarios.ReadFile(path.Join("scenarios", entry.Name()))
+		if err != nil {
+			panic(fmt.Sprintf("failed to read embedded scenario %s: %v", entry.Name(), err))
+		}
+		env, err := ParseScenario(data)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded scenario %s: %v", entry.Name(), err))
+		}
+		envs = append(envs, env)
+	}
+	return envs
+}
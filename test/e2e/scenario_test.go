@@ -0,0 +1,103 @@
+package e2e
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseScenario(t *testing.T) {
+	env, err := ParseScenario([]byte(`name: pair
+repositories:
+  - name: lib
+    files:
+      - path: VERSION
+        content: "1.0.0"
+    commits:
+      - message: Bump version
+        files:
+          - path: VERSION
+            content: "1.1.0"
+  - name: app
+    branch: develop
+    subscriptions:
+      - artifact: lib:default
+        events: [released]
+        workflow: update
+`))
+	if err != nil {
+		t.Fatalf("ParseScenario() failed: %v", err)
+	}
+	if env.Name != "pair" || len(env.Repositories) != 2 {
+		t.Fatalf("unexpected environment: %+v", env)
+	}
+	if lib := env.Repositories[0]; lib.Branch != "main" || len(lib.Commits) != 1 || lib.Commits[0].Files[0].Content != "1.1.0" {
+		t.Errorf("unexpected repository lib: %+v", lib)
+	}
+	if app := env.Repositories[1]; app.Branch != "develop" || app.Subscriptions[0].Workflow != "update" {
+		t.Errorf("unexpected repository app: %+v", app)
+	}
+}
+
+func TestParseScenarioInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		scenario string
+		want     string
+	}{
+		{"no name", "repositories: [{name: a}]", "no name"},
+		{"no repositories", "name: x", "no repositories"},
+		{"duplicate repository", "name: x\nrepositories: [{name: a}, {name: a}]", "defined twice"},
+		{"unknown dependency", "name: x\nrepositories: [{name: a, dependencies: [b]}]", "unknown repository 'b'"},
+		{"unknown subscription", "name: x\nrepositories: [{name: a, subscriptions: [{artifact: 'b:default', events: [e], workflow: w}]}]", "subscribes to unknown repository 'b'"},
+		{"empty commit", "name: x\nrepositories: [{name: a, commits: [{message: m}]}]", "changes no files"},
+		{"template and content", "name: x\nrepositories: [{name: a, files: [{path: f, template: t, content: c}]}]", "both a template and content"},
+		{"unknown field", "name: x\nrepos: []", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseScenario([]byte(tt.scenario))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadScenario(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scenario.yml")
+	if err := os.WriteFile(path, []byte("name: x\nrepositories: [{name: a}]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadScenario(path); err != nil {
+		t.Errorf("LoadScenario() failed: %v", err)
+	}
+	if _, err := LoadScenario(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("expected a missing scenario to fail")
+	}
+}
+
+func TestRepositoryArtifact(t *testing.T) {
+	tests := map[string]string{
+		"lib:default":       "acme/env-lib:default",
+		"lib":               "acme/env-lib:default",
+		"other/lib:default": "other/lib:default",
+		"lib:docs":          "acme/env-lib:docs",
+	}
+	for artifact, want := range tests {
+		if got := RepositoryArtifact("acme", "env", artifact); got != want {
+			t.Errorf("RepositoryArtifact(%q) = %q, want %q", artifact, got, want)
+		}
+	}
+}
+
+func TestEmbeddedScenariosAreEnvironments(t *testing.T) {
+	env, ok := GetEnvironments(Org)["release-train"]
+	if !ok {
+		t.Fatal("expected the release-train scenario to be an environment")
+	}
+	if len(env.Repositories) != 3 || env.Repositories[0].TakoYAML == "" {
+		t.Errorf("unexpected release-train environment: %+v", env)
+	}
+}
@@ -13,14 +13,36 @@ type Step struct {
 
 // VerifyFileExists checks if a file exists and optionally verifies its content.
 type VerifyFileExists struct {
-	FileName        string // Name of the file to check (relative to repo root)
-	ShouldExist     bool   // Whether the file should exist
-	ExpectedContent string // Expected content (optional, only checked if ShouldExist is true)
+	Repository      string `yaml:"repository,omitempty"` // Repository to check; every repository of the environment when empty
+	FileName        string `yaml:"path"`                 // Name of the file to check (relative to repo root), or a glob pattern
+	ShouldExist     bool   `yaml:"should_exist"`         // Whether the file should exist
+	ExpectedContent string `yaml:"content,omitempty"`    // Expected content (optional, only checked if ShouldExist is true)
+}
+
+// VerifyFanOut checks the fan-outs recorded in the fan-out states of the cache directory.
+type VerifyFanOut struct {
+	EventType   string `yaml:"event_type"`
+	Source      string `yaml:"source,omitempty"`       // Repository that emitted the event; any when empty
+	Status      string `yaml:"status,omitempty"`       // Status of every matching fan-out
+	Count       *int   `yaml:"count,omitempty"`        // Number of matching fan-outs; at least one when unset
+	Children    *int   `yaml:"children,omitempty"`     // Children recorded by each matching fan-out
+	ChildStatus string `yaml:"child_status,omitempty"` // Status of every child of the matching fan-outs
+}
+
+// VerifyRun checks the runs recorded in the execution history of the cache directory.
+type VerifyRun struct {
+	Repository string `yaml:"repository,omitempty"` // Any repository when empty
+	Workflow   string `yaml:"workflow,omitempty"`   // Any workflow when empty
+	Status     string `yaml:"status,omitempty"`     // Status of every matching run
+	Count      *int   `yaml:"count,omitempty"`      // Number of matching runs; at least one when unset
+	Children   *int   `yaml:"children,omitempty"`   // Child workflows triggered by each matching run
 }
 
 // Verification defines what to verify after test execution.
 type Verification struct {
-	Files []VerifyFileExists // Files to check in each repository
+	Files   []VerifyFileExists `yaml:"files,omitempty"` // Files to check in the repositories
+	FanOuts []VerifyFanOut     `yaml:"fan_outs,omitempty"`
+	Runs    []VerifyRun        `yaml:"runs,omitempty"`
 }
 
 // TestCase defines a multi-step test to run within an environment.
@@ -0,0 +1,242 @@
+package e2e
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dangazineu/tako/internal/engine"
+	"gopkg.in/yaml.v3"
+)
+
+// VerifyTarget locates the repositories and the cache directory of an environment set up by
+// takotest, which verifications check.
+type VerifyTarget struct {
+	Env                TestEnvironmentDef
+	Owner              string
+	WorkDir            string
+	CacheDir           string
+	WithRepoEntrypoint bool
+}
+
+// RepositoryPath returns the directory of a repository of the environment: the work directory
+// holds the first repository unless the environment was set up with a repository entrypoint,
+// and the cache holds the others.
+func (t VerifyTarget) RepositoryPath(repo RepositoryDef) string {
+	repoName := fmt.Sprintf("%s-%s", t.Env.Name, repo.Name)
+	if !t.WithRepoEntrypoint && repo.Name == t.Env.Repositories[0].Name {
+		return filepath.Join(t.WorkDir, repoName)
+	}
+	return filepath.Join(t.CacheDir, "repos", t.Owner, repoName, repo.Branch)
+}
+
+// ParseVerification parses and validates the YAML of a verification.
+func ParseVerification(data []byte) (Verification, error) {
+	var verification Verification
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&verification); err != nil {
+		return Verification{}, err
+	}
+	for i, file := range verification.Files {
+		if file.FileName == "" {
+			return Verification{}, fmt.Errorf("file check %d has no path", i+1)
+		}
+	}
+	for i, fanOut := range verification.FanOuts {
+		if fanOut.EventType == "" {
+			return Verification{}, fmt.Errorf("fan-out check %d has no event_type", i+1)
+		}
+	}
+	return verification, nil
+}
+
+// Checks returns the number of checks of the verification.
+func (v Verification) Checks() int {
+	return len(v.Files) + len(v.FanOuts) + len(v.Runs)
+}
+
+// Failures runs the checks of the verification against an environment and returns why those
+// that did not hold failed.
+func (v Verification) Failures(target VerifyTarget) []string {
+	var failures []string
+	for _, file := range v.Files {
+		failures = append(failures, verifyFile(target, file)...)
+	}
+
+	if len(v.FanOuts) > 0 {
+		states, err := loadFanOutStates(filepath.Join(target.CacheDir, "fanout-states"))
+		if err != nil {
+			return append(failures, err.Error())
+		}
+		for _, fanOut := range v.FanOuts {
+			failures = append(failures, verifyFanOut(target, states, fanOut)...)
+		}
+	}
+
+	if len(v.Runs) > 0 {
+		history, err := engine.NewHistoryStore(target.CacheDir)
+		if err != nil {
+			return append(failures, err.Error())
+		}
+		for _, run := range v.Runs {
+			records, err := history.Query(engine.HistoryFilter{
+				Repository: repositoryName(target, run.Repository),
+				Workflow:   run.Workflow,
+			})
+			if err != nil {
+				failures = append(failures, err.Error())
+				continue
+			}
+			failures = append(failures, verifyRun(records, run)...)
+		}
+	}
+	return failures
+}
+
+// verifyFile checks a file in the repositories it names.
+func verifyFile(target VerifyTarget, check VerifyFileExists) []string {
+	var failures []string
+	found := false
+	for _, repo := range target.Env.Repositories {
+		if check.Repository != "" && check.Repository != repo.Name {
+			continue
+		}
+		found = true
+
+		pattern := filepath.Join(target.RepositoryPath(repo), check.FileName)
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("invalid file pattern %s: %v", pattern, err))
+			continue
+		}
+
+		if !check.ShouldExist {
+			for _, match := range matches {
+				failures = append(failures, fmt.Sprintf("file %s should not exist", match))
+			}
+			continue
+		}
+		if len(matches) == 0 {
+			failures = append(failures, fmt.Sprintf("expected file %s to exist", pattern))
+			continue
+		}
+		if check.ExpectedContent == "" {
+			continue
+		}
+		for _, match := range matches {
+			content, err := os.ReadFile(match)
+			if err != nil {
+				failures = append(failures, fmt.Sprintf("failed to read file %s: %v", match, err))
+				continue
+			}
+			if actual := strings.TrimSpace(string(content)); actual != check.ExpectedContent {
+				failures = append(failures, fmt.Sprintf("file %s: expected content %q, got %q", match, check.ExpectedContent, actual))
+			}
+		}
+	}
+	if !found {
+		failures = append(failures, fmt.Sprintf("file %s: unknown repository '%s'", check.FileName, check.Repository))
+	}
+	return failures
+}
+
+// verifyFanOut checks the fan-outs of an event.
+func verifyFanOut(target VerifyTarget, states []*engine.FanOutState, check VerifyFanOut) []string {
+	source := repositoryName(target, check.Source)
+	var matched []*engine.FanOutState
+	for _, state := range states {
+		if state.EventType == check.EventType && (source == "" || state.SourceRepo == source) {
+			matched = append(matched, state)
+		}
+	}
+
+	name := fmt.Sprintf("fan-outs of '%s'", check.EventType)
+	if source != "" {
+		name += " from " + source
+	}
+	failures := verifyCount(name, len(matched), check.Count)
+	for _, state := range matched {
+		if check.Status != "" && string(state.Status) != check.Status {
+			failures = append(failures, fmt.Sprintf("fan-out %s: expected status %s, got %s", state.ID, check.Status, state.Status))
+		}
+		if check.Children != nil && len(state.Children) != *check.Children {
+			failures = append(failures, fmt.Sprintf("fan-out %s: expected %d children, got %d", state.ID, *check.Children, len(state.Children)))
+		}
+		if check.ChildStatus == "" {
+			continue
+		}
+		for _, child := range state.Children {
+			if string(child.Status) != check.ChildStatus {
+				failures = append(failures, fmt.Sprintf("fan-out %s: expected child %s:%s to be %s, got %s", state.ID, child.Repository, child.Workflow, check.ChildStatus, child.Status))
+			}
+		}
+	}
+	return failures
+}
+
+// verifyRun checks the runs of the history selected by a check.
+func verifyRun(records []engine.HistoryRecord, check VerifyRun) []string {
+	name := "runs"
+	if check.Repository != "" {
+		name += " of " + check.Repository
+	}
+	if check.Workflow != "" {
+		name += fmt.Sprintf(" of workflow '%s'", check.Workflow)
+	}
+	failures := verifyCount(name, len(records), check.Count)
+	for _, record := range records {
+		if check.Status != "" && record.Status != check.Status {
+			failures = append(failures, fmt.Sprintf("run %s: expected status %s, got %s", record.RunID, check.Status, record.Status))
+		}
+		if check.Children != nil && record.Children.Total != *check.Children {
+			failures = append(failures, fmt.Sprintf("run %s: expected %d children, got %d", record.RunID, *check.Children, record.Children.Total))
+		}
+	}
+	return failures
+}
+
+// verifyCount checks the number of records matched by a check: exactly count, or at least one
+// when count is nil.
+func verifyCount(name string, actual int, count *int) []string {
+	if count == nil && actual == 0 {
+		return []string{fmt.Sprintf("expected %s to be recorded, found none", name)}
+	}
+	if count != nil && actual != *count {
+		return []string{fmt.Sprintf("expected %d %s, found %d", *count, name, actual)}
+	}
+	return nil
+}
+
+// repositoryName returns the owner/repo name of a repository of a check: repositories of the
+// environment are given by their name in the environment.
+func repositoryName(target VerifyTarget, name string) string {
+	if name == "" {
+		return ""
+	}
+	return RepositoryName(target.Owner, target.Env.Name, name)
+}
+
+// loadFanOutStates reads the fan-out states of a state directory.
+func loadFanOutStates(stateDir string) ([]*engine.FanOutState, error) {
+	files, err := filepath.Glob(filepath.Join(stateDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	states := make([]*engine.FanOutState, 0, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read fan-out state: %v", err)
+		}
+		var state engine.FanOutState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to parse fan-out state %s: %v", file, err)
+		}
+		states = append(states, &state)
+	}
+	return states, nil
+}
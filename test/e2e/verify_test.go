@@ -0,0 +1,162 @@
+package e2e
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dangazineu/tako/internal/engine"
+)
+
+// newVerifyTarget creates the directories of a two-repository environment set up in path mode.
+func newVerifyTarget(t *testing.T) VerifyTarget {
+	t.Helper()
+	target := VerifyTarget{
+		Env: TestEnvironmentDef{
+			Name: "env",
+			Repositories: []RepositoryDef{
+				{Name: "lib", Branch: "main"},
+				{Name: "app", Branch: "main"},
+			},
+		},
+		Owner:    "acme",
+		WorkDir:  t.TempDir(),
+		CacheDir: t.TempDir(),
+	}
+	for _, repo := range target.Env.Repositories {
+		if err := os.MkdirAll(target.RepositoryPath(repo), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return target
+}
+
+func TestVerificationFiles(t *testing.T) {
+	target := newVerifyTarget(t)
+	if got := target.RepositoryPath(target.Env.Repositories[0]); got != filepath.Join(target.WorkDir, "env-lib") {
+		t.Errorf("expected the first repository in the work directory, got %s", got)
+	}
+	appPath := target.RepositoryPath(target.Env.Repositories[1])
+	if err := os.WriteFile(filepath.Join(appPath, "version.txt"), []byte("1.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := ParseVerification([]byte(`files:
+  - repository: app
+    path: version.txt
+    should_exist: true
+    content: "1.1.0"
+  - path: "*.log"
+    should_exist: false
+`))
+	if err != nil {
+		t.Fatalf("ParseVerification() failed: %v", err)
+	}
+	if failures := verification.Failures(target); len(failures) != 0 {
+		t.Errorf("expected the checks to pass, got %v", failures)
+	}
+
+	failing := Verification{Files: []VerifyFileExists{
+		{Repository: "lib", FileName: "version.txt", ShouldExist: true},
+		{Repository: "app", FileName: "version.txt", ShouldExist: true, ExpectedContent: "2.0.0"},
+		{FileName: "*.txt", ShouldExist: false},
+		{Repository: "missing", FileName: "version.txt", ShouldExist: true},
+	}}
+	failures := failing.Failures(target)
+	for _, want := range []string{"env-lib/version.txt to exist", `expected content "2.0.0"`, "should not exist", "unknown repository 'missing'"} {
+		if !strings.Contains(strings.Join(failures, "\n"), want) {
+			t.Errorf("expected a failure containing %q, got %v", want, failures)
+		}
+	}
+}
+
+func TestVerificationFanOutsAndRuns(t *testing.T) {
+	target := newVerifyTarget(t)
+
+	stateDir := filepath.Join(target.CacheDir, "fanout-states")
+	if err := os.MkdirAll(stateDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	state := engine.FanOutState{
+		ID:         "fanout-1",
+		SourceRepo: "acme/env-lib",
+		EventType:  "released",
+		Status:     engine.FanOutStatusCompleted,
+		Children: map[string]*engine.ChildWorkflow{
+			"acme/env-app:update": {Repository: "acme/env-app", Workflow: "update", Status: engine.ChildStatusFailed},
+		},
+	}
+	data, err := json.Marshal(&state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(stateDir, "fanout-1.json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := engine.NewHistoryStore(target.CacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := engine.HistoryRecord{RunID: "exec-1", Repository: "acme/env-lib", Workflow: "release", Status: engine.HistoryStatusCompleted}
+	record.Children.Total = 1
+	if err := history.Append(record); err != nil {
+		t.Fatal(err)
+	}
+
+	verification, err := ParseVerification([]byte(`fan_outs:
+  - event_type: released
+    source: lib
+    status: completed
+    children: 1
+runs:
+  - repository: lib
+    workflow: release
+    status: completed
+    count: 1
+    children: 1
+`))
+	if err != nil {
+		t.Fatalf("ParseVerification() failed: %v", err)
+	}
+	if failures := verification.Failures(target); len(failures) != 0 {
+		t.Errorf("expected the checks to pass, got %v", failures)
+	}
+
+	none := 0
+	failing := Verification{
+		FanOuts: []VerifyFanOut{
+			{EventType: "released", ChildStatus: "completed"},
+			{EventType: "deployed"},
+		},
+		Runs: []VerifyRun{
+			{Repository: "lib", Count: &none},
+			{Workflow: "release", Status: engine.HistoryStatusFailed},
+		},
+	}
+	failures := strings.Join(failing.Failures(target), "\n")
+	for _, want := range []string{
+		"expected child acme/env-app:update to be completed, got failed",
+		"expected fan-outs of 'deployed' to be recorded, found none",
+		"expected 0 runs of lib, found 1",
+		"run exec-1: expected status failed, got completed",
+	} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("expected a failure containing %q, got:\n%s", want, failures)
+		}
+	}
+}
+
+func TestParseVerificationInvalid(t *testing.T) {
+	for scenario, want := range map[string]string{
+		"files: [{should_exist: true}]": "has no path",
+		"fan_outs: [{status: failed}]":  "has no event_type",
+		"checks: []":                    "not found",
+	} {
+		if _, err := ParseVerification([]byte(scenario)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseVerification(%q): expected an error containing %q, got %v", scenario, want, err)
+		}
+	}
+}
@@ -146,8 +146,12 @@ echo "✅ Negative case test passed"
 echo "🎯 Step 8: Verifying legacy service isolation..."
 
 # Check that no deployment files exist for legacy service across all test runs
-LEGACY_FILES_COUNT=$(find . -name "*go-legacy-service*deployed*" | wc -l)
-if [[ $LEGACY_FILES_COUNT -eq 0 ]]; then
+if takotest verify --work-dir "$WORK_DIR" --cache-dir "$CACHE_DIR" --owner "protobuf-api-evolution" protobuf-api-evolution --checks - <<'EOF'
+files:
+  - path: "*go-legacy-service*deployed*"
+    should_exist: false
+EOF
+then
     echo "✅ Legacy service was never triggered (perfect isolation)"
 else
     echo "❌ Legacy service was incorrectly triggered"